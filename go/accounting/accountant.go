@@ -0,0 +1,219 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package accounting contains a privacy budget accountant, which tracks the
+// cumulative privacy loss of many differentially private operations.
+package accounting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// ErrBudgetExceeded is returned (wrapped) when spending on an Accountant that
+// enforces its budget would exceed that budget.
+var ErrBudgetExceeded = errors.New("privacy budget exceeded")
+
+// ErrNotPureDP is returned (wrapped) when an Accountant in pure DP mode is
+// asked to spend, or to create, a mechanism that isn't ε-differentially
+// private.
+var ErrNotPureDP = errors.New("mechanism is not ε-differentially private")
+
+// DefaultOrders are the Rényi orders α used by an Accountant by default.
+var DefaultOrders = []float64{1.25, 1.5, 1.75, 2, 2.25, 2.5, 3, 3.5, 4, 4.5, 5, 6, 7, 8, 10, 12, 14, 16, 20, 24, 28, 32, 48, 64, 128, 256, 512, 1024}
+
+// budgetTolerance is the relative slack allowed when comparing the spent ε
+// with the budget, to absorb floating point errors when the budget is split
+// into parts that are spent separately.
+const budgetTolerance = 1e-9
+
+// Accountant tracks the total privacy loss of a sequence of events, e.g. the
+// aggregations of a differentially private release, against an (ε, δ) budget.
+//
+// Events are composed using both basic composition and Rényi differential
+// privacy (RDP), see Mironov's "Rényi Differential Privacy"
+// (https://arxiv.org/abs/1702.07476), and the tighter of the two guarantees
+// is reported. RDP composition is much tighter than basic composition for
+// many events, especially with Gaussian noise. Events without an RDP
+// guarantee are composed with basic composition.
+//
+// Events spent with Release are also recorded as named releases in a ledger,
+// in which past releases can be marked as retracted, see Retract.
+//
+// Not thread-safe.
+type Accountant struct {
+	// Parameters
+	epsilon       float64
+	delta         float64
+	enforceBudget bool
+	pureDP        bool
+	orders        []float64
+
+	// State variables
+	// Cumulative RDP guarantee of the events with an RDP guarantee, per order.
+	rdp []float64
+	// Basic composition of all events.
+	basicEpsilon, basicDelta float64
+	// Basic composition of the events without an RDP guarantee.
+	approxEpsilon, approxDelta float64
+	// Named releases recorded with Release, in order.
+	ledger []LedgerEntry
+}
+
+// AccountantOptions contains the options necessary to initialize an Accountant.
+type AccountantOptions struct {
+	Epsilon float64 // Privacy budget ε. Required.
+	// Privacy budget δ. Defaults to 0, in which case only basic composition is
+	// used since RDP guarantees can't be converted to pure ε-differential privacy.
+	Delta float64
+	// Whether spending beyond the budget fails with ErrBudgetExceeded. Defaults
+	// to false, in which case the Accountant only tracks the privacy loss.
+	EnforceBudget bool
+	// Rényi orders α > 1 at which RDP guarantees are tracked. Defaults to
+	// DefaultOrders.
+	Orders []float64
+	// Whether the Accountant only accepts ε-differentially private mechanisms,
+	// for deployments whose policy mandates pure differential privacy. If set,
+	// Delta must be 0, spending an event with δ > 0 or without a finite ε fails
+	// with ErrNotPureDP, and so does creating an aggregation with Gaussian
+	// noise, a non-zero Delta or Rho, or a partition selection. Defaults to
+	// false.
+	PureDP bool
+}
+
+// NewAccountant returns a new Accountant, with no privacy loss spent.
+func NewAccountant(opt *AccountantOptions) (*Accountant, error) {
+	if opt == nil {
+		opt = &AccountantOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewAccountant: %w", err)
+	}
+	if err := checks.CheckDelta(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewAccountant: %w", err)
+	}
+	if opt.PureDP && opt.Delta != 0 {
+		return nil, fmt.Errorf("NewAccountant: Delta is %e, must be 0 with PureDP", opt.Delta)
+	}
+	orders := opt.Orders
+	if len(orders) == 0 {
+		orders = DefaultOrders
+	}
+	for _, alpha := range orders {
+		if !(alpha > 1) || math.IsInf(alpha, 0) {
+			return nil, fmt.Errorf("NewAccountant: order %v must be finite and strictly larger than 1", alpha)
+		}
+	}
+	return &Accountant{
+		epsilon:       opt.Epsilon,
+		delta:         opt.Delta,
+		enforceBudget: opt.EnforceBudget,
+		pureDP:        opt.PureDP,
+		orders:        append([]float64(nil), orders...),
+		rdp:           make([]float64, len(orders)),
+	}, nil
+}
+
+// Spend records the privacy loss of the given events. If the Accountant
+// enforces its budget and the events would exceed it, Spend returns an error
+// wrapping ErrBudgetExceeded and records nothing. In pure DP mode, Spend
+// returns an error wrapping ErrNotPureDP and records nothing if one of the
+// events isn't ε-differentially private.
+func (a *Accountant) Spend(events ...Event) error {
+	if err := a.checkPureDP(events); err != nil {
+		return fmt.Errorf("Accountant: %w", err)
+	}
+	next := a.compose(events)
+	if a.enforceBudget {
+		if eps, _ := next.Spent(); eps > a.epsilon*(1+budgetTolerance) {
+			return fmt.Errorf("Accountant: spending would bring ε to %v with a budget of (%v, %v): %w", eps, a.epsilon, a.delta, ErrBudgetExceeded)
+		}
+	}
+	*a = *next
+	return nil
+}
+
+// CanSpend returns whether the given events can be spent without exceeding
+// the budget, regardless of whether the Accountant enforces it.
+func (a *Accountant) CanSpend(events ...Event) bool {
+	eps, _ := a.compose(events).Spent()
+	return eps <= a.epsilon*(1+budgetTolerance)
+}
+
+// Spent returns the privacy loss (ε, δ) of all events spent so far. δ is
+// either the budget δ or, if basic composition is tighter, the sum of the δs
+// of all events. ε is +∞ if the δs of the events exceed the budget δ.
+func (a *Accountant) Spent() (epsilon, delta float64) {
+	epsilon, delta = math.Inf(1), a.delta
+	if a.basicDelta <= a.delta {
+		epsilon, delta = a.basicEpsilon, a.basicDelta
+	}
+	// Events without an RDP guarantee use part of the δ budget; the rest is used
+	// to convert the RDP guarantee to an (ε, δ) guarantee.
+	if rdpDelta := a.delta - a.approxDelta; rdpDelta > 0 {
+		for i, alpha := range a.orders {
+			if eps := a.approxEpsilon + rdpToEpsilon(a.rdp[i], alpha, rdpDelta); eps < epsilon {
+				epsilon, delta = eps, a.delta
+			}
+		}
+	}
+	return epsilon, delta
+}
+
+// checkPureDP returns an error wrapping ErrNotPureDP if the Accountant is in
+// pure DP mode and one of the events has δ > 0 or an infinite ε.
+func (a *Accountant) checkPureDP(events []Event) error {
+	if !a.pureDP {
+		return nil
+	}
+	for i, e := range events {
+		if e.delta != 0 || math.IsInf(e.epsilon, 1) {
+			return fmt.Errorf("event %d has a guarantee of (%v, %v) in pure DP mode: %w", i, e.epsilon, e.delta, ErrNotPureDP)
+		}
+	}
+	return nil
+}
+
+// compose returns a copy of a with the given events added.
+func (a *Accountant) compose(events []Event) *Accountant {
+	next := *a
+	next.rdp = append([]float64(nil), a.rdp...)
+	for _, e := range events {
+		next.basicEpsilon += e.epsilon
+		next.basicDelta += e.delta
+		if e.rdp == nil {
+			next.approxEpsilon += e.epsilon
+			next.approxDelta += e.delta
+			continue
+		}
+		for i, alpha := range next.orders {
+			next.rdp[i] += e.rdp(alpha)
+		}
+	}
+	return &next
+}
+
+// rdpToEpsilon converts an RDP guarantee at order α into an (ε, δ) guarantee,
+// using Proposition 12 of Canonne, Kamath and Steinke's "The Discrete Gaussian
+// for Differential Privacy" (https://arxiv.org/abs/2004.00010), which is
+// tighter than the original conversion of Mironov.
+func rdpToEpsilon(rdp, alpha, delta float64) float64 {
+	eps := rdp + math.Log1p(-1/alpha) - (math.Log(delta)+math.Log(alpha))/(alpha-1)
+	return math.Max(0, eps)
+}
@@ -0,0 +1,148 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNewAccountantInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *AccountantOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &AccountantOptions{Delta: 1e-5}},
+		{"delta of 1", &AccountantOptions{Epsilon: 1, Delta: 1}},
+		{"order of 1", &AccountantOptions{Epsilon: 1, Delta: 1e-5, Orders: []float64{1}}},
+		{"infinite order", &AccountantOptions{Epsilon: 1, Delta: 1e-5, Orders: []float64{math.Inf(1)}}},
+		{"non-zero delta with PureDP", &AccountantOptions{Epsilon: 1, Delta: 1e-5, PureDP: true}},
+	} {
+		if _, err := NewAccountant(tc.opts); err == nil {
+			t.Errorf("NewAccountant: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestAccountantSingleLaplaceEvent(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	e, _ := LaplaceEvent(0.5)
+	if err := a.Spend(e); err != nil {
+		t.Fatalf("Spend: got error %v", err)
+	}
+	// Basic composition is tight for a single event.
+	if eps, del := a.Spent(); eps != 0.5 || del != 0 {
+		t.Errorf("Spent: got (%f, %e), want (0.5, 0)", eps, del)
+	}
+}
+
+// Tests that RDP composition of many Gaussian events is tighter than basic
+// composition.
+func TestAccountantRDPCompositionIsTighter(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 10, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	e, err := GaussianEvent(0.1, 1e-8)
+	if err != nil {
+		t.Fatalf("GaussianEvent: got error %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := a.Spend(e); err != nil {
+			t.Fatalf("Spend: got error %v", err)
+		}
+	}
+	eps, del := a.Spent()
+	if del != 1e-5 {
+		t.Errorf("Spent: got δ %e, want 1e-5", del)
+	}
+	// Basic composition gives ε = 10.
+	if eps > 5 {
+		t.Errorf("Spent: got ε %f, want at most 5", eps)
+	}
+}
+
+func TestAccountantEnforcesBudget(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	e, _ := LaplaceEvent(0.6)
+	if err := a.Spend(e); err != nil {
+		t.Fatalf("Spend: got error %v", err)
+	}
+	if a.CanSpend(e) {
+		t.Errorf("CanSpend: got true, want false")
+	}
+	if err := a.Spend(e); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Spend: got error %v, want ErrBudgetExceeded", err)
+	}
+	// A failed Spend doesn't record anything.
+	if eps, _ := a.Spent(); eps != 0.6 {
+		t.Errorf("Spent: got ε %f, want 0.6", eps)
+	}
+	// Spending exactly the remaining budget is allowed, even with floating point
+	// errors.
+	rest, _ := LaplaceEvent(1 - 0.6)
+	if err := a.Spend(rest); err != nil {
+		t.Errorf("Spend: got error %v when spending the remaining budget", err)
+	}
+}
+
+func TestAccountantDeltaExceedsBudget(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, Delta: 1e-5, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	e, _ := ApproxDPEvent(0.1, 1e-3)
+	if err := a.Spend(e); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Spend: got error %v for δ above the budget, want ErrBudgetExceeded", err)
+	}
+}
+
+func TestAccountantPureDP(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, PureDP: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	laplace, _ := LaplaceEvent(0.5)
+	if err := a.Spend(laplace); err != nil {
+		t.Fatalf("Spend with a Laplace event: got error %v", err)
+	}
+	gaussian, _ := GaussianEvent(0.1, 1e-10)
+	zcdp, _ := ZCDPEvent(0.01)
+	for _, tc := range []struct {
+		desc string
+		e    Event
+	}{
+		{"Gaussian event", gaussian},
+		{"zCDP event", zcdp},
+	} {
+		if err := a.Spend(laplace, tc.e); !errors.Is(err, ErrNotPureDP) {
+			t.Errorf("Spend with a %s: got error %v, want ErrNotPureDP", tc.desc, err)
+		}
+	}
+	// Rejected events record nothing.
+	if eps, del := a.Spent(); eps != 0.5 || del != 0 {
+		t.Errorf("Spent: got (%f, %e), want (0.5, 0)", eps, del)
+	}
+}
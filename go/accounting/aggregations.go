@@ -0,0 +1,224 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// The methods below create dpagg aggregations and spend their privacy loss on
+// the Accountant. They fail without creating the aggregation if the Accountant
+// enforces its budget and the aggregation would exceed it.
+//
+// Each call is accounted as a separate release. When one aggregation is
+// created per partition for a single query, the budget of the query is shared
+// across partitions via MaxPartitionsContributed, so only one of the
+// aggregations must be accounted: create the others with the dpagg
+// constructors directly.
+//
+// In pure DP mode, the methods fail with an error wrapping ErrNotPureDP and
+// naming the offending option if the aggregation isn't ε-differentially
+// private.
+
+// NewCount returns a new dpagg.Count and spends its privacy loss.
+func (a *Accountant) NewCount(opt *dpagg.CountOptions) (*dpagg.Count, error) {
+	c, err := dpagg.NewCount(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewCount: %w", err)
+	}
+	if err := a.spendNoise(opt.Noise, opt.Rho, []float64{opt.Epsilon}, []float64{opt.Delta}); err != nil {
+		return nil, fmt.Errorf("Accountant.NewCount: %w", err)
+	}
+	return c, nil
+}
+
+// NewBoundedSumInt64 returns a new dpagg.BoundedSumInt64 and spends its
+// privacy loss.
+func (a *Accountant) NewBoundedSumInt64(opt *dpagg.BoundedSumInt64Options) (*dpagg.BoundedSumInt64, error) {
+	bs, err := dpagg.NewBoundedSumInt64(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedSumInt64: %w", err)
+	}
+	if err := a.spendNoise(opt.Noise, opt.Rho, []float64{opt.Epsilon}, []float64{opt.Delta}); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedSumInt64: %w", err)
+	}
+	return bs, nil
+}
+
+// NewBoundedSumFloat64 returns a new dpagg.BoundedSumFloat64 and spends its
+// privacy loss.
+func (a *Accountant) NewBoundedSumFloat64(opt *dpagg.BoundedSumFloat64Options) (*dpagg.BoundedSumFloat64, error) {
+	bs, err := dpagg.NewBoundedSumFloat64(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedSumFloat64: %w", err)
+	}
+	if err := a.spendNoise(opt.Noise, opt.Rho, []float64{opt.Epsilon}, []float64{opt.Delta}); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedSumFloat64: %w", err)
+	}
+	return bs, nil
+}
+
+// NewBoundedMeanFloat64 returns a new dpagg.BoundedMeanFloat64 and spends its
+// privacy loss.
+func (a *Accountant) NewBoundedMeanFloat64(opt *dpagg.BoundedMeanFloat64Options) (*dpagg.BoundedMeanFloat64, error) {
+	bm, err := dpagg.NewBoundedMeanFloat64(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedMeanFloat64: %w", err)
+	}
+	// BoundedMeanFloat64 splits its budget in half between a count and a sum.
+	eps, del := opt.Epsilon/2, opt.Delta/2
+	if err := a.spendNoise(opt.Noise, opt.Rho, []float64{eps, eps}, []float64{del, del}); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedMeanFloat64: %w", err)
+	}
+	return bm, nil
+}
+
+// NewBoundedVariance returns a new dpagg.BoundedVariance and spends its
+// privacy loss.
+func (a *Accountant) NewBoundedVariance(opt *dpagg.BoundedVarianceOptions) (*dpagg.BoundedVariance, error) {
+	bv, err := dpagg.NewBoundedVariance(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedVariance: %w", err)
+	}
+	if err := a.spendVariance(opt.Noise, opt.Rho, opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedVariance: %w", err)
+	}
+	return bv, nil
+}
+
+// NewBoundedStandardDeviation returns a new dpagg.BoundedStandardDeviation and
+// spends its privacy loss.
+func (a *Accountant) NewBoundedStandardDeviation(opt *dpagg.BoundedStandardDeviationOptions) (*dpagg.BoundedStandardDeviation, error) {
+	bstdv, err := dpagg.NewBoundedStandardDeviation(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedStandardDeviation: %w", err)
+	}
+	if err := a.spendVariance(opt.Noise, opt.Rho, opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedStandardDeviation: %w", err)
+	}
+	return bstdv, nil
+}
+
+// NewBoundedQuantiles returns a new dpagg.BoundedQuantiles and spends its
+// privacy loss.
+func (a *Accountant) NewBoundedQuantiles(opt *dpagg.BoundedQuantilesOptions) (*dpagg.BoundedQuantiles, error) {
+	bq, err := dpagg.NewBoundedQuantiles(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkPureDPOptions(opt.Noise, opt.Rho, opt.Delta); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedQuantiles: %w", err)
+	}
+	if err := a.spendNoise(opt.Noise, opt.Rho, []float64{opt.Epsilon}, []float64{opt.Delta}); err != nil {
+		return nil, fmt.Errorf("Accountant.NewBoundedQuantiles: %w", err)
+	}
+	return bq, nil
+}
+
+// NewPreAggSelectPartition returns a new dpagg.PreAggSelectPartition and
+// spends its privacy loss.
+func (a *Accountant) NewPreAggSelectPartition(opt *dpagg.PreAggSelectPartitionOptions) (*dpagg.PreAggSelectPartition, error) {
+	s, err := dpagg.NewPreAggSelectPartition(opt)
+	if err != nil {
+		return nil, err
+	}
+	if a.pureDP {
+		return nil, fmt.Errorf("Accountant.NewPreAggSelectPartition: partition selection requires a Delta > 0, use public partitions in pure DP mode: %w", ErrNotPureDP)
+	}
+	e, err := ApproxDPEvent(opt.Epsilon, opt.Delta)
+	if err != nil {
+		return nil, fmt.Errorf("Accountant.NewPreAggSelectPartition: %w", err)
+	}
+	if err := a.Spend(e); err != nil {
+		return nil, fmt.Errorf("Accountant.NewPreAggSelectPartition: %w", err)
+	}
+	return s, nil
+}
+
+// checkPureDPOptions returns an error wrapping ErrNotPureDP if the Accountant
+// is in pure DP mode and the options of an aggregation with noise n, zCDP
+// budget ρ and privacy parameter δ make it not ε-differentially private.
+func (a *Accountant) checkPureDPOptions(n noise.Noise, rho, delta float64) error {
+	if !a.pureDP {
+		return nil
+	}
+	if rho != 0 {
+		return fmt.Errorf("Rho is %v, zCDP aggregations aren't allowed in pure DP mode: %w", rho, ErrNotPureDP)
+	}
+	if delta != 0 {
+		return fmt.Errorf("Delta is %e, must be 0 in pure DP mode: %w", delta, ErrNotPureDP)
+	}
+	if k := noise.ToKind(n); n != nil && k != noise.LaplaceNoise && k != noise.GeometricNoise {
+		return fmt.Errorf("Noise must be Laplace or Geometric noise in pure DP mode: %w", ErrNotPureDP)
+	}
+	return nil
+}
+
+// spendVariance spends the privacy loss of a BoundedVariance, which splits its
+// budget in three between a count, a sum and a sum of squares.
+func (a *Accountant) spendVariance(n noise.Noise, rho, eps, del float64) error {
+	countEpsilon, countDelta := eps/3, del/3
+	sumEpsilon, sumDelta := eps/3, del/3
+	sumOfSquaresEpsilon := eps - countEpsilon - sumEpsilon
+	sumOfSquaresDelta := del - countDelta - sumDelta
+	return a.spendNoise(n, rho,
+		[]float64{countEpsilon, sumEpsilon, sumOfSquaresEpsilon},
+		[]float64{countDelta, sumDelta, sumOfSquaresDelta})
+}
+
+// spendNoise spends the privacy loss of adding noise n once for each of the
+// given (ε, δ) pairs, or of a ρ-zCDP aggregation if ρ is set.
+func (a *Accountant) spendNoise(n noise.Noise, rho float64, epsilons, deltas []float64) error {
+	if rho != 0 {
+		// The aggregation splits ρ between its noise calls, which compose to ρ.
+		e, err := ZCDPEvent(rho)
+		if err != nil {
+			return err
+		}
+		return a.Spend(e)
+	}
+	events := make([]Event, len(epsilons))
+	for i := range epsilons {
+		var err error
+		events[i], err = NoiseEvent(n, epsilons[i], deltas[i])
+		if err != nil {
+			return err
+		}
+	}
+	return a.Spend(events...)
+}
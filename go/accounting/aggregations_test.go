@@ -0,0 +1,158 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestAccountantNewAggregations(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 10, Delta: 1e-5, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	if _, err := a.NewCount(&dpagg.CountOptions{Epsilon: 1}); err != nil {
+		t.Fatalf("NewCount: got error %v", err)
+	}
+	if _, err := a.NewBoundedSumInt64(&dpagg.BoundedSumInt64Options{Epsilon: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedSumInt64: got error %v", err)
+	}
+	if _, err := a.NewBoundedSumFloat64(&dpagg.BoundedSumFloat64Options{Epsilon: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedSumFloat64: got error %v", err)
+	}
+	if _, err := a.NewBoundedMeanFloat64(&dpagg.BoundedMeanFloat64Options{Epsilon: 1, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedMeanFloat64: got error %v", err)
+	}
+	if _, err := a.NewBoundedVariance(&dpagg.BoundedVarianceOptions{Epsilon: 1, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedVariance: got error %v", err)
+	}
+	if _, err := a.NewBoundedStandardDeviation(&dpagg.BoundedStandardDeviationOptions{Epsilon: 1, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedStandardDeviation: got error %v", err)
+	}
+	if _, err := a.NewBoundedQuantiles(&dpagg.BoundedQuantilesOptions{Epsilon: 1, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedQuantiles: got error %v", err)
+	}
+	if _, err := a.NewPreAggSelectPartition(&dpagg.PreAggSelectPartitionOptions{Epsilon: 1, Delta: 1e-6}); err != nil {
+		t.Fatalf("NewPreAggSelectPartition: got error %v", err)
+	}
+	// All aggregations use Laplace noise, so basic composition gives ε = 8.
+	if eps, _ := a.Spent(); eps > 8+1e-9 {
+		t.Errorf("Spent: got ε %f, want at most 8", eps)
+	}
+}
+
+func TestAccountantRejectsAggregationAboveBudget(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	if _, err := a.NewCount(&dpagg.CountOptions{Epsilon: 0.75}); err != nil {
+		t.Fatalf("NewCount: got error %v", err)
+	}
+	bm, err := a.NewBoundedMeanFloat64(&dpagg.BoundedMeanFloat64Options{Epsilon: 0.5, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("NewBoundedMeanFloat64: got error %v, want ErrBudgetExceeded", err)
+	}
+	if bm != nil {
+		t.Errorf("NewBoundedMeanFloat64: got non-nil aggregation above the budget")
+	}
+	// Invalid options are reported without spending any budget.
+	if _, err := a.NewCount(&dpagg.CountOptions{Epsilon: math.Inf(1)}); err == nil {
+		t.Errorf("NewCount: got no error for infinite epsilon, want error")
+	}
+	if eps, _ := a.Spent(); eps != 0.75 {
+		t.Errorf("Spent: got ε %f, want 0.75", eps)
+	}
+}
+
+func TestAccountantNewAggregationWithRho(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 10, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	if _, err := a.NewBoundedMeanFloat64(&dpagg.BoundedMeanFloat64Options{Rho: 0.1, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5}); err != nil {
+		t.Fatalf("NewBoundedMeanFloat64: got error %v", err)
+	}
+	// The conversion of ρ-zCDP with the RDP curve is at least as tight as the
+	// generic zCDP conversion.
+	if eps, _ := a.Spent(); eps > noise.EpsilonForZCDP(0.1, 1e-5) {
+		t.Errorf("Spent: got ε %f, want at most %f", eps, noise.EpsilonForZCDP(0.1, 1e-5))
+	}
+}
+
+func TestAccountantNewAggregationsPureDP(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 10, PureDP: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	if _, err := a.NewCount(&dpagg.CountOptions{Epsilon: 1}); err != nil {
+		t.Errorf("NewCount with Laplace noise: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		new  func() error
+	}{
+		{"Count with Gaussian noise", func() error {
+			_, err := a.NewCount(&dpagg.CountOptions{Epsilon: 1, Delta: 1e-5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"Count with Rho", func() error {
+			_, err := a.NewCount(&dpagg.CountOptions{Rho: 0.1, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"BoundedSumInt64 with Gaussian noise", func() error {
+			_, err := a.NewBoundedSumInt64(&dpagg.BoundedSumInt64Options{Epsilon: 1, Delta: 1e-5, Lower: 0, Upper: 5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"BoundedSumFloat64 with Gaussian noise", func() error {
+			_, err := a.NewBoundedSumFloat64(&dpagg.BoundedSumFloat64Options{Epsilon: 1, Delta: 1e-5, Lower: 0, Upper: 5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"BoundedMeanFloat64 with Gaussian noise", func() error {
+			_, err := a.NewBoundedMeanFloat64(&dpagg.BoundedMeanFloat64Options{Epsilon: 1, Delta: 1e-5, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"BoundedVariance with Gaussian noise", func() error {
+			_, err := a.NewBoundedVariance(&dpagg.BoundedVarianceOptions{Epsilon: 1, Delta: 1e-5, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"BoundedStandardDeviation with Gaussian noise", func() error {
+			_, err := a.NewBoundedStandardDeviation(&dpagg.BoundedStandardDeviationOptions{Epsilon: 1, Delta: 1e-5, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"BoundedQuantiles with Gaussian noise", func() error {
+			_, err := a.NewBoundedQuantiles(&dpagg.BoundedQuantilesOptions{Epsilon: 1, Delta: 1e-5, MaxContributionsPerPartition: 1, Lower: 0, Upper: 5, Noise: noise.Gaussian()})
+			return err
+		}},
+		{"PreAggSelectPartition", func() error {
+			_, err := a.NewPreAggSelectPartition(&dpagg.PreAggSelectPartitionOptions{Epsilon: 1, Delta: 1e-6})
+			return err
+		}},
+	} {
+		if err := tc.new(); !errors.Is(err, ErrNotPureDP) {
+			t.Errorf("Creating a %s: got error %v, want ErrNotPureDP", tc.desc, err)
+		}
+	}
+	if eps, _ := a.Spent(); eps != 1 {
+		t.Errorf("Spent: got ε %f, want 1", eps)
+	}
+}
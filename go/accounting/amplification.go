@@ -0,0 +1,158 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// ShuffleEpsilon returns the central ε guaranteed, with the given δ, by the
+// shuffle model: each of numUsers users reports the output of a local
+// randomizer that is localEpsilon-locally differentially private, e.g. one of
+// the localdp package, and a shuffler releases the reports in a uniformly
+// random order, hiding which user sent which report.
+//
+// The bound is the closed form of Theorem 3.1 of Feldman, McMillan and
+// Talwar's "Hiding Among the Clones: A Simple and Nearly Optimal Analysis of
+// Privacy Amplification by Shuffling" (https://arxiv.org/abs/2012.12803):
+//
+//	ε = log(1 + (e^ε₀-1)/(e^ε₀+1)·(8·√(e^ε₀·log(4/δ))/√n + 8·e^ε₀/n))
+//
+// which holds when ε₀ ≤ log(n/(16·log(2/δ))). Shuffling is post-processing of
+// the reports, so the result is never more than localEpsilon, which is
+// returned when the bound doesn't hold or doesn't amplify, e.g. for too few
+// users.
+func ShuffleEpsilon(localEpsilon float64, numUsers int64, delta float64) (float64, error) {
+	if err := checkShuffleArgs(localEpsilon, numUsers, delta); err != nil {
+		return 0, fmt.Errorf("ShuffleEpsilon: %w", err)
+	}
+	return shuffleEpsilon(localEpsilon, float64(numUsers), delta), nil
+}
+
+func shuffleEpsilon(localEpsilon, n, delta float64) float64 {
+	if localEpsilon > math.Log(n/(16*math.Log(2/delta))) {
+		return localEpsilon
+	}
+	e := math.Exp(localEpsilon)
+	amplified := math.Log1p((e - 1) / (e + 1) * (8*math.Sqrt(e*math.Log(4/delta))/math.Sqrt(n) + 8*e/n))
+	return math.Min(localEpsilon, amplified)
+}
+
+// ShuffleLocalEpsilon returns the largest local ε₀ such that ShuffleEpsilon
+// guarantees the given central ε with the given δ for numUsers users, e.g. to
+// calibrate the local randomizers of a shuffle deployment to a central budget.
+// Since the central guarantee is never more than the local one, the result is
+// at least epsilon.
+func ShuffleLocalEpsilon(epsilon float64, numUsers int64, delta float64) (float64, error) {
+	if err := checkShuffleArgs(epsilon, numUsers, delta); err != nil {
+		return 0, fmt.Errorf("ShuffleLocalEpsilon: %w", err)
+	}
+	n := float64(numUsers)
+	// The bound only amplifies up to ε₀ = log(n/(16·log(2/δ))), and is
+	// non-decreasing in ε₀ up to there, so the largest ε₀ is found by binary
+	// search below this limit.
+	lower, upper := epsilon, math.Log(n/(16*math.Log(2/delta)))
+	if upper <= lower {
+		return epsilon, nil
+	}
+	if shuffleEpsilon(upper, n, delta) <= epsilon {
+		return upper, nil
+	}
+	for i := 0; i < 100; i++ {
+		mid := lower + (upper-lower)/2
+		if shuffleEpsilon(mid, n, delta) <= epsilon {
+			lower = mid
+		} else {
+			upper = mid
+		}
+	}
+	return lower, nil
+}
+
+// ShuffleEvent returns the event of releasing the shuffled reports of numUsers
+// users whose local randomizers are localEpsilon-locally differentially
+// private, with the (ε, δ) guarantee of ShuffleEpsilon for the given δ. Like
+// ApproxDPEvent with a non-zero δ, the event is composed using basic
+// composition.
+func ShuffleEvent(localEpsilon float64, numUsers int64, delta float64) (Event, error) {
+	epsilon, err := ShuffleEpsilon(localEpsilon, numUsers, delta)
+	if err != nil {
+		return Event{}, fmt.Errorf("ShuffleEvent: %w", err)
+	}
+	return ApproxDPEvent(epsilon, delta)
+}
+
+func checkShuffleArgs(epsilon float64, numUsers int64, delta float64) error {
+	if err := checks.CheckEpsilonStrict(epsilon); err != nil {
+		return err
+	}
+	if numUsers <= 0 {
+		return fmt.Errorf("NumUsers is %d, must be strictly positive", numUsers)
+	}
+	return checks.CheckDeltaStrict(delta)
+}
+
+// SubsampledEpsilon returns the (ε, δ) guarantee of running an (epsilon,
+// delta)-differentially private mechanism on a random subsample of the
+// database, e.g. a pipeline that only processes a fraction samplingRate of the
+// users in each run. The guarantee is
+//
+//	ε' = log(1 + q·(e^ε-1)), δ' = q·δ
+//
+// with q = samplingRate, see Theorem 9 of Balle, Barthe and Gaboardi's "Privacy
+// Amplification by Subsampling: Tight Analyses via Couplings and Divergences"
+// (https://arxiv.org/abs/1807.01647). It holds for Poisson subsampling, where
+// each privacy unit is included independently with probability q, with
+// add/remove neighboring databases; and for uniform subsampling of m out of n
+// privacy units without replacement, with q = m/n and substitution
+// neighboring databases. Note that the sampling must be secret: the guarantee
+// doesn't hold if the sampled privacy units can be known.
+func SubsampledEpsilon(epsilon, delta, samplingRate float64) (float64, float64, error) {
+	if err := checks.CheckEpsilon(epsilon); err != nil {
+		return 0, 0, fmt.Errorf("SubsampledEpsilon: %w", err)
+	}
+	if math.IsInf(epsilon, 1) {
+		return 0, 0, fmt.Errorf("SubsampledEpsilon: Epsilon is +∞, must be finite")
+	}
+	if err := checks.CheckDelta(delta); err != nil {
+		return 0, 0, fmt.Errorf("SubsampledEpsilon: %w", err)
+	}
+	if !(samplingRate > 0 && samplingRate <= 1) {
+		return 0, 0, fmt.Errorf("SubsampledEpsilon: SamplingRate is %f, must be in (0, 1]", samplingRate)
+	}
+	return math.Log1p(samplingRate * math.Expm1(epsilon)), samplingRate * delta, nil
+}
+
+// SubsampledEvent returns the event of running the mechanism of event e on a
+// random subsample of the database with the given sampling rate, with the
+// guarantee of SubsampledEpsilon, e.g. to compose many runs of a pipeline that
+// samples a fraction of the users in each run with an Accountant. Like
+// ApproxDPEvent, the event is composed with the RDP guarantee of pure
+// differential privacy if its δ is 0, and with basic composition otherwise.
+//
+// Events without a finite ε, e.g. of ZCDPEvent, can't be amplified this way;
+// for subsampled Gaussian noise, use SampledGaussianEvent instead.
+func SubsampledEvent(e Event, samplingRate float64) (Event, error) {
+	epsilon, delta, err := SubsampledEpsilon(e.epsilon, e.delta, samplingRate)
+	if err != nil {
+		return Event{}, fmt.Errorf("SubsampledEvent: %w", err)
+	}
+	return ApproxDPEvent(epsilon, delta)
+}
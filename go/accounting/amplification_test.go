@@ -0,0 +1,201 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShuffleEpsilon(t *testing.T) {
+	for _, tc := range []struct {
+		localEpsilon float64
+		numUsers     int64
+		delta        float64
+	}{
+		{1, 10000, 1e-6},
+		{2, 1000000, 1e-8},
+		{0.5, 100000, 1e-5},
+	} {
+		e, n := math.Exp(tc.localEpsilon), float64(tc.numUsers)
+		want := math.Log(1 + (e-1)/(e+1)*(8*math.Sqrt(e*math.Log(4/tc.delta))/math.Sqrt(n)+8*e/n))
+		got, err := ShuffleEpsilon(tc.localEpsilon, tc.numUsers, tc.delta)
+		if err != nil {
+			t.Fatalf("ShuffleEpsilon(%f, %d, %e): got error %v", tc.localEpsilon, tc.numUsers, tc.delta, err)
+		}
+		if math.Abs(got-want) > 1e-12 {
+			t.Errorf("ShuffleEpsilon(%f, %d, %e): got %f, want %f", tc.localEpsilon, tc.numUsers, tc.delta, got, want)
+		}
+		if got >= tc.localEpsilon {
+			t.Errorf("ShuffleEpsilon(%f, %d, %e): got %f, want an amplified ε below the local ε", tc.localEpsilon, tc.numUsers, tc.delta, got)
+		}
+	}
+}
+
+func TestShuffleEpsilonWithoutAmplification(t *testing.T) {
+	// With too few users, or a too large local ε, the bound doesn't hold and
+	// the local ε is returned.
+	for _, tc := range []struct {
+		localEpsilon float64
+		numUsers     int64
+	}{
+		{1, 100},
+		{8, 10000},
+	} {
+		got, err := ShuffleEpsilon(tc.localEpsilon, tc.numUsers, 1e-6)
+		if err != nil {
+			t.Fatalf("ShuffleEpsilon(%f, %d, 1e-6): got error %v", tc.localEpsilon, tc.numUsers, err)
+		}
+		if got != tc.localEpsilon {
+			t.Errorf("ShuffleEpsilon(%f, %d, 1e-6): got %f, want %f", tc.localEpsilon, tc.numUsers, got, tc.localEpsilon)
+		}
+	}
+}
+
+func TestShuffleLocalEpsilon(t *testing.T) {
+	for _, epsilon := range []float64{0.1, 0.5, 1} {
+		local, err := ShuffleLocalEpsilon(epsilon, 1000000, 1e-6)
+		if err != nil {
+			t.Fatalf("ShuffleLocalEpsilon(%f): got error %v", epsilon, err)
+		}
+		if local <= epsilon {
+			t.Errorf("ShuffleLocalEpsilon(%f): got %f, want a local ε above the central ε", epsilon, local)
+		}
+		central, err := ShuffleEpsilon(local, 1000000, 1e-6)
+		if err != nil {
+			t.Fatalf("ShuffleEpsilon(%f): got error %v", local, err)
+		}
+		if central > epsilon || central < epsilon-1e-9 {
+			t.Errorf("ShuffleEpsilon(ShuffleLocalEpsilon(%f)): got %f, want %f", epsilon, central, epsilon)
+		}
+	}
+	// Without amplification, the local ε is the central ε.
+	if got, err := ShuffleLocalEpsilon(1, 100, 1e-6); err != nil || got != 1 {
+		t.Errorf("ShuffleLocalEpsilon(1, 100, 1e-6): got (%f, %v), want (1, nil)", got, err)
+	}
+}
+
+func TestShuffleEvent(t *testing.T) {
+	e, err := ShuffleEvent(1, 10000, 1e-6)
+	if err != nil {
+		t.Fatalf("ShuffleEvent: got error %v", err)
+	}
+	want, err := ShuffleEpsilon(1, 10000, 1e-6)
+	if err != nil {
+		t.Fatalf("ShuffleEpsilon: got error %v", err)
+	}
+	if e.Epsilon() != want || e.Delta() != 1e-6 {
+		t.Errorf("ShuffleEvent: got (ε, δ) = (%f, %e), want (%f, 1e-6)", e.Epsilon(), e.Delta(), want)
+	}
+}
+
+func TestShuffleInvalidParameters(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		localEpsilon float64
+		numUsers     int64
+		delta        float64
+	}{
+		{"zero epsilon", 0, 10000, 1e-6},
+		{"no users", 1, 0, 1e-6},
+		{"zero delta", 1, 10000, 0},
+		{"delta of 1", 1, 10000, 1},
+	} {
+		if _, err := ShuffleEpsilon(tc.localEpsilon, tc.numUsers, tc.delta); err == nil {
+			t.Errorf("ShuffleEpsilon with %s: got no error, want error", tc.desc)
+		}
+		if _, err := ShuffleLocalEpsilon(tc.localEpsilon, tc.numUsers, tc.delta); err == nil {
+			t.Errorf("ShuffleLocalEpsilon with %s: got no error, want error", tc.desc)
+		}
+		if _, err := ShuffleEvent(tc.localEpsilon, tc.numUsers, tc.delta); err == nil {
+			t.Errorf("ShuffleEvent with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSubsampledEpsilon(t *testing.T) {
+	for _, tc := range []struct {
+		epsilon, delta, samplingRate float64
+		wantEpsilon, wantDelta       float64
+	}{
+		{1, 1e-5, 1, 1, 1e-5},
+		{1, 1e-5, 0.1, math.Log(1 + 0.1*(math.E-1)), 1e-6},
+		{math.Log(3), 0, 0.5, math.Log(2), 0},
+	} {
+		eps, del, err := SubsampledEpsilon(tc.epsilon, tc.delta, tc.samplingRate)
+		if err != nil {
+			t.Fatalf("SubsampledEpsilon(%f, %e, %f): got error %v", tc.epsilon, tc.delta, tc.samplingRate, err)
+		}
+		if math.Abs(eps-tc.wantEpsilon) > 1e-12 || math.Abs(del-tc.wantDelta) > 1e-18 {
+			t.Errorf("SubsampledEpsilon(%f, %e, %f): got (%f, %e), want (%f, %e)", tc.epsilon, tc.delta, tc.samplingRate, eps, del, tc.wantEpsilon, tc.wantDelta)
+		}
+	}
+}
+
+func TestSubsampledEvent(t *testing.T) {
+	e, err := LaplaceEvent(1)
+	if err != nil {
+		t.Fatalf("LaplaceEvent: got error %v", err)
+	}
+	sampled, err := SubsampledEvent(e, 0.01)
+	if err != nil {
+		t.Fatalf("SubsampledEvent: got error %v", err)
+	}
+	want := math.Log1p(0.01 * (math.E - 1))
+	if math.Abs(sampled.Epsilon()-want) > 1e-12 || sampled.Delta() != 0 {
+		t.Errorf("SubsampledEvent: got (ε, δ) = (%f, %e), want (%f, 0)", sampled.Epsilon(), sampled.Delta(), want)
+	}
+	// Composing 100 subsampled runs costs less than a single run without
+	// subsampling would cost 100 times.
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 10, Delta: 1e-6})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := a.Spend(sampled); err != nil {
+			t.Fatalf("Spend: got error %v", err)
+		}
+	}
+	if eps, _ := a.Spent(); eps >= 100*want {
+		t.Errorf("Spent after 100 subsampled runs: got ε %f, want less than %f", eps, 100*want)
+	}
+
+	z, err := ZCDPEvent(0.5)
+	if err != nil {
+		t.Fatalf("ZCDPEvent: got error %v", err)
+	}
+	if _, err := SubsampledEvent(z, 0.01); err == nil {
+		t.Errorf("SubsampledEvent of a zCDP event: got no error, want error")
+	}
+}
+
+func TestSubsampledEpsilonInvalidParameters(t *testing.T) {
+	for _, tc := range []struct {
+		desc                         string
+		epsilon, delta, samplingRate float64
+	}{
+		{"negative epsilon", -1, 0, 0.5},
+		{"infinite epsilon", math.Inf(1), 0, 0.5},
+		{"delta of 1", 1, 1, 0.5},
+		{"zero sampling rate", 1, 0, 0},
+		{"sampling rate above 1", 1, 0, 1.5},
+	} {
+		if _, _, err := SubsampledEpsilon(tc.epsilon, tc.delta, tc.samplingRate); err == nil {
+			t.Errorf("SubsampledEpsilon with %s: got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import "fmt"
+
+// BundleMetric is a metric of a release bundle, see ReleaseBundle.
+type BundleMetric struct {
+	Name string // Name of the metric, unique within the bundle. Required.
+	// Privacy loss of computing the metric, e.g. the events of its
+	// aggregations.
+	Events []Event
+	// Compute computes the differentially private value of the metric.
+	// Required.
+	Compute func() (interface{}, error)
+}
+
+// ReleaseBundle computes the metrics of a bundle, e.g. the tiles of a
+// dashboard, and releases them together under the given name: either all
+// metrics are computed successfully, in which case their values are returned
+// by name and their combined privacy loss is recorded as a single release in
+// the ledger, see Release, or none of them is released and no privacy loss is
+// recorded. This avoids partial releases, which tempt re-running the whole
+// bundle and spending the budget of the released metrics twice.
+//
+// The budget and the ledger are checked before any metric is computed, so that
+// a bundle that can't be released doesn't compute anything. If computing a
+// metric fails, ReleaseBundle returns its error without computing the
+// remaining metrics, and the values of the metrics computed so far must be
+// discarded. Not recording their privacy loss is only safe if they are never
+// published, and if the failure doesn't depend on the private data, e.g. is
+// due to an unavailable storage system.
+func (a *Accountant) ReleaseBundle(name string, metrics []BundleMetric) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Accountant: ReleaseBundle requires a name")
+	}
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("Accountant: bundle %q has no metric", name)
+	}
+	var events []Event
+	seen := make(map[string]bool)
+	for i, m := range metrics {
+		if m.Name == "" {
+			return nil, fmt.Errorf("Accountant: metric %d of bundle %q has no Name", i, name)
+		}
+		if seen[m.Name] {
+			return nil, fmt.Errorf("Accountant: metric %q is declared twice in bundle %q", m.Name, name)
+		}
+		if m.Compute == nil {
+			return nil, fmt.Errorf("Accountant: metric %q of bundle %q has no Compute function", m.Name, name)
+		}
+		seen[m.Name] = true
+		events = append(events, m.Events...)
+	}
+	if i := a.lastRelease(name); i >= 0 && !a.ledger[i].Retracted {
+		return nil, fmt.Errorf("Accountant: release %q is already in the ledger, retract it before releasing it again: %w", name, ErrAlreadyReleased)
+	}
+	if err := a.checkPureDP(events); err != nil {
+		return nil, fmt.Errorf("Accountant: bundle %q: %w", name, err)
+	}
+	if a.enforceBudget && !a.CanSpend(events...) {
+		eps, _ := a.compose(events).Spent()
+		return nil, fmt.Errorf("Accountant: bundle %q would bring ε to %v with a budget of (%v, %v): %w", name, eps, a.epsilon, a.delta, ErrBudgetExceeded)
+	}
+
+	values := make(map[string]interface{})
+	for _, m := range metrics {
+		v, err := m.Compute()
+		if err != nil {
+			return nil, fmt.Errorf("Accountant: computing metric %q of bundle %q failed, nothing was released: %w", m.Name, name, err)
+		}
+		values[m.Name] = v
+	}
+	if err := a.Release(name, events...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,134 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// bundleMetric returns a metric spending ε = epsilon with Laplace noise, whose
+// computation returns value and err and is counted in *computed.
+func bundleMetric(t *testing.T, name string, epsilon float64, value interface{}, err error, computed *int) BundleMetric {
+	t.Helper()
+	e, eventErr := LaplaceEvent(epsilon)
+	if eventErr != nil {
+		t.Fatalf("LaplaceEvent(%f): got error %v", epsilon, eventErr)
+	}
+	return BundleMetric{
+		Name:   name,
+		Events: []Event{e},
+		Compute: func() (interface{}, error) {
+			*computed++
+			return value, err
+		},
+	}
+}
+
+func TestReleaseBundle(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	var computed int
+	got, err := a.ReleaseBundle("dashboard", []BundleMetric{
+		bundleMetric(t, "visits", 0.25, int64(10), nil, &computed),
+		bundleMetric(t, "revenue", 0.25, 12.5, nil, &computed),
+	})
+	if err != nil {
+		t.Fatalf("ReleaseBundle: got error %v", err)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"visits": int64(10), "revenue": 12.5}, got); diff != "" {
+		t.Errorf("ReleaseBundle: got diff (-want +got):\n%s", diff)
+	}
+	// The metrics are recorded as a single release with their combined budget.
+	if diff := cmp.Diff([]LedgerEntry{{Name: "dashboard", Epsilon: 0.5}}, a.Ledger()); diff != "" {
+		t.Errorf("Ledger: got diff (-want +got):\n%s", diff)
+	}
+	if _, err := a.ReleaseBundle("dashboard", []BundleMetric{bundleMetric(t, "visits", 0.25, 0, nil, &computed)}); !errors.Is(err, ErrAlreadyReleased) {
+		t.Errorf("ReleaseBundle of an active release: got error %v, want ErrAlreadyReleased", err)
+	}
+	if computed != 2 {
+		t.Errorf("ReleaseBundle of an active release: got %d metrics computed in total, want 2", computed)
+	}
+}
+
+func TestReleaseBundleAllOrNothing(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	errStorage := errors.New("storage unavailable")
+	var computed int
+	_, err = a.ReleaseBundle("dashboard", []BundleMetric{
+		bundleMetric(t, "visits", 0.25, int64(10), nil, &computed),
+		bundleMetric(t, "revenue", 0.25, nil, errStorage, &computed),
+		bundleMetric(t, "sessions", 0.25, int64(3), nil, &computed),
+	})
+	if !errors.Is(err, errStorage) {
+		t.Errorf("ReleaseBundle with a failing metric: got error %v, want %v", err, errStorage)
+	}
+	// The metrics after the failing one aren't computed, and nothing is spent.
+	if computed != 2 {
+		t.Errorf("ReleaseBundle with a failing metric: got %d metrics computed, want 2", computed)
+	}
+	if eps, _ := a.Spent(); eps != 0 || len(a.Ledger()) != 0 {
+		t.Errorf("ReleaseBundle with a failing metric: got ε %f spent and ledger %v, want nothing", eps, a.Ledger())
+	}
+
+	// A bundle exceeding the budget isn't computed at all.
+	computed = 0
+	_, err = a.ReleaseBundle("dashboard", []BundleMetric{
+		bundleMetric(t, "visits", 0.75, int64(10), nil, &computed),
+		bundleMetric(t, "revenue", 0.75, 12.5, nil, &computed),
+	})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("ReleaseBundle beyond the budget: got error %v, want ErrBudgetExceeded", err)
+	}
+	if computed != 0 {
+		t.Errorf("ReleaseBundle beyond the budget: got %d metrics computed, want 0", computed)
+	}
+}
+
+func TestReleaseBundleInvalid(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	var computed int
+	m := bundleMetric(t, "visits", 0.25, 1, nil, &computed)
+	for _, tc := range []struct {
+		desc    string
+		name    string
+		metrics []BundleMetric
+	}{
+		{"no name", "", []BundleMetric{m}},
+		{"no metric", "dashboard", nil},
+		{"duplicate metric", "dashboard", []BundleMetric{m, m}},
+		{"metric without name", "dashboard", []BundleMetric{{Compute: m.Compute}}},
+		{"metric without Compute", "dashboard", []BundleMetric{{Name: "visits"}}},
+	} {
+		if _, err := a.ReleaseBundle(tc.name, tc.metrics); err == nil {
+			t.Errorf("ReleaseBundle with %s: got no error, want error", tc.desc)
+		}
+	}
+	if computed != 0 {
+		t.Errorf("ReleaseBundle with invalid bundles: got %d metrics computed, want 0", computed)
+	}
+}
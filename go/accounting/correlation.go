@@ -0,0 +1,211 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// ReleaseDescription describes a differentially private release, planned or
+// already made, for the purpose of analyzing how it combines with other
+// releases, e.g. an entry of an audit log.
+type ReleaseDescription struct {
+	Name string // Name of the release, unique among the analyzed releases. Required.
+	// Metric released, e.g. "count of visits" or "sum of revenue". Releases of
+	// the same metric are assumed to be computed over the same privacy units.
+	// Required.
+	Metric string
+	// Partition keys of the release, e.g. {"country", "city"}. Empty for a
+	// release without partitions, i.e. a single total.
+	Dimensions []string
+	// Privacy budget of the release.
+	Epsilon, Delta float64
+}
+
+// CorrelationKind is the way in which releases of the same metric combine.
+type CorrelationKind int
+
+const (
+	// RepeatedRelease flags several releases of the same metric with the same
+	// dimensions: they can be averaged to reduce the noise.
+	RepeatedRelease CorrelationKind = iota
+	// NestedGranularity flags releases of the same metric at a coarse and a
+	// fine granularity, e.g. by country and by country and city: each coarse
+	// partition is also estimated by summing up the fine partitions it
+	// contains.
+	NestedGranularity
+	// OverlappingGranularity flags releases of the same metric whose dimensions
+	// aren't nested, e.g. by country and age and by country and gender: both
+	// releases can be summed up to the partitions of their common dimensions,
+	// or to the total if they have none in common.
+	OverlappingGranularity
+)
+
+func (k CorrelationKind) String() string {
+	switch k {
+	case RepeatedRelease:
+		return "RepeatedRelease"
+	case NestedGranularity:
+		return "NestedGranularity"
+	case OverlappingGranularity:
+		return "OverlappingGranularity"
+	}
+	return fmt.Sprintf("CorrelationKind(%d)", int(k))
+}
+
+// CorrelationWarning flags a set of releases whose combination leaks more
+// about the common partitions than each release does on its own.
+type CorrelationWarning struct {
+	Kind     CorrelationKind
+	Metric   string
+	Releases []string // Names of the releases, in the order in which they were described.
+	// Privacy budget spent on the common partitions by the releases together,
+	// using basic composition.
+	Epsilon, Delta float64
+}
+
+// String returns a human-readable description of the warning.
+func (w CorrelationWarning) String() string {
+	return fmt.Sprintf("%v: releases %s of metric %q combine to ε = %v, δ = %v", w.Kind, strings.Join(w.Releases, ", "), w.Metric, w.Epsilon, w.Delta)
+}
+
+// AnalyzeCorrelations inspects the given releases and flags the sets of
+// releases of the same metric whose combination effectively multiplies the
+// privacy loss of their common partitions, e.g. because the same partitions
+// are released several times, or at different granularities.
+//
+// The analysis only relies on the metrics and dimensions of the releases: it
+// doesn't replace an Accountant, which tracks the total privacy loss of all
+// releases, but it points at the releases that a reviewer may want to merge,
+// e.g. by releasing the fine partitions only and deriving the coarse ones.
+//
+// Warnings are grouped by metric, in the order in which the metrics first
+// appear, and RepeatedRelease warnings come first within a metric.
+func AnalyzeCorrelations(releases []ReleaseDescription) ([]CorrelationWarning, error) {
+	names := make(map[string]bool)
+	var metrics []string
+	byMetric := make(map[string][]int)
+	for i, r := range releases {
+		if r.Name == "" {
+			return nil, fmt.Errorf("AnalyzeCorrelations: release %d has no Name", i)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("AnalyzeCorrelations: release %q is described twice", r.Name)
+		}
+		names[r.Name] = true
+		if r.Metric == "" {
+			return nil, fmt.Errorf("AnalyzeCorrelations: release %q has no Metric", r.Name)
+		}
+		if err := checks.CheckEpsilon(r.Epsilon); err != nil {
+			return nil, fmt.Errorf("AnalyzeCorrelations: release %q: %w", r.Name, err)
+		}
+		if err := checks.CheckDelta(r.Delta); err != nil {
+			return nil, fmt.Errorf("AnalyzeCorrelations: release %q: %w", r.Name, err)
+		}
+		if _, ok := byMetric[r.Metric]; !ok {
+			metrics = append(metrics, r.Metric)
+		}
+		byMetric[r.Metric] = append(byMetric[r.Metric], i)
+	}
+
+	var warnings []CorrelationWarning
+	for _, metric := range metrics {
+		// Group the releases of the metric by their set of dimensions.
+		var groups []dimensionGroup
+		index := make(map[string]int)
+		for _, i := range byMetric[metric] {
+			dims := dimensionSet(releases[i].Dimensions)
+			key := strings.Join(dims, "\x00")
+			g, ok := index[key]
+			if !ok {
+				g = len(groups)
+				index[key] = g
+				groups = append(groups, dimensionGroup{dimensions: dims})
+			}
+			groups[g].releases = append(groups[g].releases, i)
+		}
+		for _, g := range groups {
+			if len(g.releases) > 1 {
+				warnings = append(warnings, newCorrelationWarning(RepeatedRelease, metric, releases, g.releases))
+			}
+		}
+		for a := range groups {
+			for b := a + 1; b < len(groups); b++ {
+				kind := granularityRelation(groups[a].dimensions, groups[b].dimensions)
+				indices := append(append([]int(nil), groups[a].releases...), groups[b].releases...)
+				sort.Ints(indices)
+				warnings = append(warnings, newCorrelationWarning(kind, metric, releases, indices))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// dimensionGroup holds the indices of the releases of a metric with the same
+// set of dimensions.
+type dimensionGroup struct {
+	dimensions []string
+	releases   []int
+}
+
+// dimensionSet returns the sorted distinct dimensions.
+func dimensionSet(dimensions []string) []string {
+	seen := make(map[string]bool)
+	var set []string
+	for _, d := range dimensions {
+		if !seen[d] {
+			seen[d] = true
+			set = append(set, d)
+		}
+	}
+	sort.Strings(set)
+	return set
+}
+
+// granularityRelation returns the relation between two distinct sets of
+// dimensions.
+func granularityRelation(a, b []string) CorrelationKind {
+	inA := make(map[string]bool, len(a))
+	for _, d := range a {
+		inA[d] = true
+	}
+	common := 0
+	for _, d := range b {
+		if inA[d] {
+			common++
+		}
+	}
+	// An empty set of dimensions, i.e. a total, is nested in any other.
+	if common == len(a) || common == len(b) {
+		return NestedGranularity
+	}
+	return OverlappingGranularity
+}
+
+func newCorrelationWarning(kind CorrelationKind, metric string, releases []ReleaseDescription, indices []int) CorrelationWarning {
+	w := CorrelationWarning{Kind: kind, Metric: metric}
+	for _, i := range indices {
+		w.Releases = append(w.Releases, releases[i].Name)
+		w.Epsilon += releases[i].Epsilon
+		w.Delta += releases[i].Delta
+	}
+	return w
+}
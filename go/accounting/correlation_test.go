@@ -0,0 +1,104 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeCorrelationsInvalidReleases(t *testing.T) {
+	visits := ReleaseDescription{Name: "visits", Metric: "visits", Epsilon: 1}
+	for _, tc := range []struct {
+		desc     string
+		releases []ReleaseDescription
+	}{
+		{"no name", []ReleaseDescription{{Metric: "visits", Epsilon: 1}}},
+		{"no metric", []ReleaseDescription{{Name: "visits", Epsilon: 1}}},
+		{"duplicate name", []ReleaseDescription{visits, visits}},
+		{"negative epsilon", []ReleaseDescription{{Name: "visits", Metric: "visits", Epsilon: -1}}},
+		{"delta larger than 1", []ReleaseDescription{{Name: "visits", Metric: "visits", Epsilon: 1, Delta: 2}}},
+	} {
+		if _, err := AnalyzeCorrelations(tc.releases); err == nil {
+			t.Errorf("AnalyzeCorrelations: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestAnalyzeCorrelations(t *testing.T) {
+	releases := []ReleaseDescription{
+		{Name: "visits by country", Metric: "visits", Dimensions: []string{"country"}, Epsilon: 1, Delta: 1e-6},
+		{Name: "revenue by country", Metric: "revenue", Dimensions: []string{"country"}, Epsilon: 1},
+		{Name: "visits by city", Metric: "visits", Dimensions: []string{"city", "country"}, Epsilon: 0.5},
+		{Name: "visits by country again", Metric: "visits", Dimensions: []string{"country", "country"}, Epsilon: 2},
+		{Name: "visits by country and age", Metric: "visits", Dimensions: []string{"country", "age"}, Epsilon: 0.25},
+	}
+	got, err := AnalyzeCorrelations(releases)
+	if err != nil {
+		t.Fatalf("AnalyzeCorrelations: got error %v", err)
+	}
+	want := []CorrelationWarning{
+		{Kind: RepeatedRelease, Metric: "visits", Releases: []string{"visits by country", "visits by country again"}, Epsilon: 3, Delta: 1e-6},
+		{Kind: NestedGranularity, Metric: "visits", Releases: []string{"visits by country", "visits by city", "visits by country again"}, Epsilon: 3.5, Delta: 1e-6},
+		{Kind: NestedGranularity, Metric: "visits", Releases: []string{"visits by country", "visits by country again", "visits by country and age"}, Epsilon: 3.25, Delta: 1e-6},
+		{Kind: OverlappingGranularity, Metric: "visits", Releases: []string{"visits by city", "visits by country and age"}, Epsilon: 0.75},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("AnalyzeCorrelations: got %d warnings %v, want %d warnings %v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i].Kind != want[i].Kind || got[i].Metric != want[i].Metric || !reflect.DeepEqual(got[i].Releases, want[i].Releases) ||
+			math.Abs(got[i].Epsilon-want[i].Epsilon) > 1e-12 || math.Abs(got[i].Delta-want[i].Delta) > 1e-18 {
+			t.Errorf("AnalyzeCorrelations: warning %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAnalyzeCorrelationsTotalAndDisjointDimensions(t *testing.T) {
+	got, err := AnalyzeCorrelations([]ReleaseDescription{
+		{Name: "total", Metric: "visits", Epsilon: 1},
+		{Name: "by age", Metric: "visits", Dimensions: []string{"age"}, Epsilon: 1},
+		{Name: "by gender", Metric: "visits", Dimensions: []string{"gender"}, Epsilon: 1},
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCorrelations: got error %v", err)
+	}
+	var kinds []CorrelationKind
+	for _, w := range got {
+		kinds = append(kinds, w.Kind)
+	}
+	// The total is nested in both releases, and both releases add up to the
+	// total.
+	want := []CorrelationKind{NestedGranularity, NestedGranularity, OverlappingGranularity}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("AnalyzeCorrelations: got warnings of kinds %v, want %v", kinds, want)
+	}
+}
+
+func TestAnalyzeCorrelationsIndependentReleases(t *testing.T) {
+	got, err := AnalyzeCorrelations([]ReleaseDescription{
+		{Name: "visits", Metric: "visits", Dimensions: []string{"country"}, Epsilon: 1},
+		{Name: "revenue", Metric: "revenue", Dimensions: []string{"country"}, Epsilon: 1},
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCorrelations: got error %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("AnalyzeCorrelations: got warnings %v, want none", got)
+	}
+}
@@ -0,0 +1,251 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Event describes a differentially private operation whose privacy loss is
+// tracked by an Accountant, e.g. a single call to a noise mechanism.
+//
+// Every event has an (ε, δ)-differential privacy guarantee. Events of
+// mechanisms with a known Rényi differential privacy (RDP) curve also carry
+// that curve, which the Accountant uses for tight composition.
+type Event struct {
+	epsilon, delta float64
+	// rdp returns the RDP guarantee of the event at order α > 1, or is nil if
+	// the event only has an (ε, δ) guarantee.
+	rdp func(alpha float64) float64
+}
+
+// Epsilon returns the privacy parameter ε of the event.
+func (e Event) Epsilon() float64 {
+	return e.epsilon
+}
+
+// Delta returns the privacy parameter δ of the event.
+func (e Event) Delta() float64 {
+	return e.delta
+}
+
+// LaplaceEvent returns the event of adding Laplace noise calibrated to ε,
+// i.e. with a scale of Δ₁/ε where Δ₁ is the L_1 sensitivity of the query.
+func LaplaceEvent(epsilon float64) (Event, error) {
+	if err := checks.CheckEpsilonStrict(epsilon); err != nil {
+		return Event{}, fmt.Errorf("LaplaceEvent: %w", err)
+	}
+	return Event{
+		epsilon: epsilon,
+		rdp: func(alpha float64) float64 {
+			return laplaceRDP(epsilon, alpha)
+		},
+	}, nil
+}
+
+// laplaceRDP returns the RDP guarantee at order α of the Laplace mechanism
+// with scale 1/ε for a query of sensitivity 1, see Proposition 6 of Mironov's
+// "Rényi Differential Privacy" (https://arxiv.org/abs/1702.07476):
+//
+//	1/(α-1)·log(α/(2α-1)·exp((α-1)ε) + (α-1)/(2α-1)·exp(-αε))
+//
+// The expression is rewritten to avoid overflows for large values of (α-1)ε.
+func laplaceRDP(epsilon, alpha float64) float64 {
+	a := alpha / (2*alpha - 1)
+	b := (alpha - 1) / (2*alpha - 1) * math.Exp(-(2*alpha-1)*epsilon)
+	return math.Min(epsilon, epsilon+math.Log(a+b)/(alpha-1))
+}
+
+// GaussianEvent returns the event of adding Gaussian noise calibrated to
+// (ε, δ) by the Gaussian noise of the noise package, i.e. with the standard
+// deviation returned by noise.SigmaForGaussian.
+func GaussianEvent(epsilon, delta float64) (Event, error) {
+	if err := checks.CheckEpsilonStrict(epsilon); err != nil {
+		return Event{}, fmt.Errorf("GaussianEvent: %w", err)
+	}
+	if err := checks.CheckDeltaStrict(delta); err != nil {
+		return Event{}, fmt.Errorf("GaussianEvent: %w", err)
+	}
+	// The standard deviation grows linearly with the L_2 sensitivity, so the
+	// ratio between the two only depends on ε and δ.
+	ratio := 1 / noise.SigmaForGaussian(1, 1, epsilon, delta)
+	return gaussianRatioEvent(epsilon, delta, ratio), nil
+}
+
+// gaussianRatioEvent returns the event of adding Gaussian noise whose standard
+// deviation is 1/ratio times the L_2 sensitivity of the query. The RDP
+// guarantee at order α of such a mechanism is α·ratio²/2.
+func gaussianRatioEvent(epsilon, delta, ratio float64) Event {
+	return Event{
+		epsilon: epsilon,
+		delta:   delta,
+		rdp: func(alpha float64) float64 {
+			return alpha * ratio * ratio / 2
+		},
+	}
+}
+
+// LaplaceScaleEvent returns the event of adding Laplace noise of an explicit
+// scale b to a query with the given sensitivities. Its guarantee is the one of
+// LaplaceEvent with the implied ε = Δ₁/b, see noise.LaplaceEpsilonForScale.
+func LaplaceScaleEvent(l0Sensitivity int64, lInfSensitivity, b float64) (Event, error) {
+	epsilon, err := noise.LaplaceEpsilonForScale(l0Sensitivity, lInfSensitivity, b)
+	if err != nil {
+		return Event{}, fmt.Errorf("LaplaceScaleEvent: %w", err)
+	}
+	return LaplaceEvent(epsilon)
+}
+
+// GaussianSigmaEvent returns the event of adding Gaussian noise of an explicit
+// standard deviation σ to a query with the given sensitivities. Its (ε, δ)
+// guarantee is the smallest ε for the given δ, see
+// noise.GaussianEpsilonForSigma, and its RDP guarantee at order α is
+// α·Δ₂²/(2σ²) where Δ₂ is the L_2 sensitivity of the query.
+func GaussianSigmaEvent(l0Sensitivity int64, lInfSensitivity, sigma, delta float64) (Event, error) {
+	epsilon, err := noise.GaussianEpsilonForSigma(l0Sensitivity, lInfSensitivity, sigma, delta)
+	if err != nil {
+		return Event{}, fmt.Errorf("GaussianSigmaEvent: %w", err)
+	}
+	l2Sensitivity := lInfSensitivity * math.Sqrt(float64(l0Sensitivity))
+	return gaussianRatioEvent(epsilon, delta, l2Sensitivity/sigma), nil
+}
+
+// ZCDPEvent returns the event of a ρ-zero-concentrated differentially private
+// mechanism, e.g. adding Gaussian noise calibrated to ρ. Its RDP guarantee at
+// order α is α·ρ.
+//
+// zCDP doesn't imply pure differential privacy, so the event's basic
+// composition guarantee is (+∞, 0).
+func ZCDPEvent(rho float64) (Event, error) {
+	if rho <= 0 || math.IsInf(rho, 0) || math.IsNaN(rho) {
+		return Event{}, fmt.Errorf("ZCDPEvent: Rho is %f, must be strictly positive and finite", rho)
+	}
+	return Event{
+		epsilon: math.Inf(1),
+		rdp: func(alpha float64) float64 {
+			return alpha * rho
+		},
+	}, nil
+}
+
+// SampledGaussianEvent returns the event of the sampled Gaussian mechanism,
+// e.g. one step of DP-SGD: each record of the database is included in a batch
+// independently with probability samplingRate, and Gaussian noise whose
+// standard deviation is noiseMultiplier times the L_2 sensitivity of the query
+// is added to the result of the query on the batch.
+//
+// Its RDP guarantee is computed following Section 3.3 of Mironov, Talwar and
+// Zhang's "Rényi Differential Privacy of the Sampled Gaussian Mechanism"
+// (https://arxiv.org/abs/1908.10530), which is the moments accountant of Abadi
+// et al. at integer orders. Like ZCDPEvent, the event's basic composition
+// guarantee is (+∞, 0).
+func SampledGaussianEvent(noiseMultiplier, samplingRate float64) (Event, error) {
+	if noiseMultiplier <= 0 || math.IsInf(noiseMultiplier, 0) || math.IsNaN(noiseMultiplier) {
+		return Event{}, fmt.Errorf("SampledGaussianEvent: NoiseMultiplier is %f, must be strictly positive and finite", noiseMultiplier)
+	}
+	if !(samplingRate > 0 && samplingRate <= 1) {
+		return Event{}, fmt.Errorf("SampledGaussianEvent: SamplingRate is %f, must be in (0, 1]", samplingRate)
+	}
+	return Event{
+		epsilon: math.Inf(1),
+		rdp: func(alpha float64) float64 {
+			return sampledGaussianRDP(noiseMultiplier, samplingRate, alpha)
+		},
+	}, nil
+}
+
+// sampledGaussianRDP returns the RDP guarantee at order α of the sampled
+// Gaussian mechanism with noise multiplier σ and sampling rate q. At integer
+// orders, it is log(A_α)/(α-1) where
+//
+//	A_α = Σ_{k=0}^{α} C(α,k)·(1-q)^(α-k)·q^k·exp((k²-k)/(2σ²)).
+//
+// Rényi divergences are non-decreasing in α, so the guarantee at ⌈α⌉ holds at
+// non-integer orders. The guarantee α/(2σ²) of the Gaussian mechanism without
+// sampling also holds, and is used if it is tighter.
+func sampledGaussianRDP(sigma, q, alpha float64) float64 {
+	gaussian := alpha / (2 * sigma * sigma)
+	if q == 1 {
+		return gaussian
+	}
+	n := math.Ceil(alpha)
+	logQ, log1MinusQ := math.Log(q), math.Log1p(-q)
+	lgammaN1, _ := math.Lgamma(n + 1)
+	// A_α is computed in log space since its terms can overflow for large
+	// orders.
+	logTerms := make([]float64, 0, int(n)+1)
+	maxLogTerm := math.Inf(-1)
+	for k := 0.0; k <= n; k++ {
+		lgammaK1, _ := math.Lgamma(k + 1)
+		lgammaNK1, _ := math.Lgamma(n - k + 1)
+		logTerm := lgammaN1 - lgammaK1 - lgammaNK1 + (n-k)*log1MinusQ + k*logQ + (k*k-k)/(2*sigma*sigma)
+		logTerms = append(logTerms, logTerm)
+		maxLogTerm = math.Max(maxLogTerm, logTerm)
+	}
+	var sum float64
+	for _, logTerm := range logTerms {
+		sum += math.Exp(logTerm - maxLogTerm)
+	}
+	return math.Min(gaussian, (maxLogTerm+math.Log(sum))/(n-1))
+}
+
+// ApproxDPEvent returns the event of an arbitrary (ε, δ)-differentially
+// private mechanism, e.g. a partition selection.
+//
+// If δ is 0, the event is composed using the RDP guarantee min(ε, α·ε²/2)
+// of ε-differentially private mechanisms, see Proposition 1.4 of Bun and
+// Steinke's "Concentrated Differential Privacy: Simplifications, Extensions,
+// and Lower Bounds" (https://arxiv.org/abs/1605.02065). Otherwise, the event
+// is composed using basic composition.
+func ApproxDPEvent(epsilon, delta float64) (Event, error) {
+	if err := checks.CheckEpsilon(epsilon); err != nil {
+		return Event{}, fmt.Errorf("ApproxDPEvent: %w", err)
+	}
+	if err := checks.CheckDelta(delta); err != nil {
+		return Event{}, fmt.Errorf("ApproxDPEvent: %w", err)
+	}
+	e := Event{epsilon: epsilon, delta: delta}
+	if delta == 0 {
+		e.rdp = func(alpha float64) float64 {
+			return math.Min(epsilon, alpha*epsilon*epsilon/2)
+		}
+	}
+	return e, nil
+}
+
+// NoiseEvent returns the event of adding noise n calibrated to (ε, δ) with
+// n.AddNoiseInt64 or n.AddNoiseFloat64. Unrecognised noise is treated as an
+// arbitrary (ε, δ)-differentially private mechanism.
+func NoiseEvent(n noise.Noise, epsilon, delta float64) (Event, error) {
+	if n == nil {
+		// Aggregations default to Laplace noise.
+		n = noise.Laplace()
+	}
+	switch noise.ToKind(n) {
+	case noise.LaplaceNoise, noise.GeometricNoise:
+		return LaplaceEvent(epsilon)
+	case noise.GaussianNoise, noise.DiscreteGaussianNoise:
+		// The discrete Gaussian has the same standard deviation as the Gaussian,
+		// and an RDP guarantee at least as good.
+		return GaussianEvent(epsilon, delta)
+	}
+	return ApproxDPEvent(epsilon, delta)
+}
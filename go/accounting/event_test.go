@@ -0,0 +1,189 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestLaplaceRDP(t *testing.T) {
+	for _, tc := range []struct {
+		epsilon, alpha float64
+	}{
+		{1, 2},
+		{0.1, 1.5},
+		{2, 10},
+	} {
+		a := tc.alpha
+		want := math.Log(a/(2*a-1)*math.Exp((a-1)*tc.epsilon)+(a-1)/(2*a-1)*math.Exp(-a*tc.epsilon)) / (a - 1)
+		if got := laplaceRDP(tc.epsilon, a); math.Abs(got-want) > 1e-12 {
+			t.Errorf("laplaceRDP(%f, %f): got %f, want %f", tc.epsilon, a, got, want)
+		}
+	}
+	// For large orders, the RDP guarantee tends to ε and must not overflow.
+	if got := laplaceRDP(1, 1e6); math.Abs(got-1) > 1e-5 {
+		t.Errorf("laplaceRDP(1, 1e6): got %f, want 1", got)
+	}
+}
+
+func TestEventsInvalidParameters(t *testing.T) {
+	if _, err := LaplaceEvent(0); err == nil {
+		t.Errorf("LaplaceEvent: got no error for zero epsilon, want error")
+	}
+	if _, err := GaussianEvent(1, 0); err == nil {
+		t.Errorf("GaussianEvent: got no error for zero delta, want error")
+	}
+	if _, err := ApproxDPEvent(-1, 0); err == nil {
+		t.Errorf("ApproxDPEvent: got no error for negative epsilon, want error")
+	}
+	if _, err := ApproxDPEvent(1, 1); err == nil {
+		t.Errorf("ApproxDPEvent: got no error for delta of 1, want error")
+	}
+}
+
+func TestNoiseEvent(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		n       noise.Noise
+		delta   float64
+		wantRDP bool
+	}{
+		{"nil noise", nil, 0, true},
+		{"Laplace noise", noise.Laplace(), 0, true},
+		{"Gaussian noise", noise.Gaussian(), 1e-5, true},
+		{"discrete Gaussian noise", noise.DiscreteGaussian(), 1e-5, true},
+	} {
+		e, err := NoiseEvent(tc.n, 1, tc.delta)
+		if err != nil {
+			t.Fatalf("NoiseEvent with %s: got error %v", tc.desc, err)
+		}
+		if e.Epsilon() != 1 || e.Delta() != tc.delta {
+			t.Errorf("NoiseEvent with %s: got (%f, %e), want (1, %e)", tc.desc, e.Epsilon(), e.Delta(), tc.delta)
+		}
+		if (e.rdp != nil) != tc.wantRDP {
+			t.Errorf("NoiseEvent with %s: got RDP guarantee %t, want %t", tc.desc, e.rdp != nil, tc.wantRDP)
+		}
+	}
+}
+
+func TestScaleEvents(t *testing.T) {
+	// Laplace noise of scale 4 on a query of L_1 sensitivity 2 is 0.5-DP.
+	e, err := LaplaceScaleEvent(2, 1, 4)
+	if err != nil {
+		t.Fatalf("LaplaceScaleEvent: got error %v", err)
+	}
+	if e.Epsilon() != 0.5 || e.Delta() != 0 {
+		t.Errorf("LaplaceScaleEvent: got (%f, %e), want (0.5, 0)", e.Epsilon(), e.Delta())
+	}
+
+	// Gaussian noise of standard deviation 2σ on a query of L_2 sensitivity 2
+	// has the same guarantee as noise of standard deviation σ on a query of
+	// L_2 sensitivity 1.
+	sigma := noise.SigmaForGaussian(1, 1, 1, 1e-5)
+	e, err = GaussianSigmaEvent(4, 1, 2*sigma, 1e-5)
+	if err != nil {
+		t.Fatalf("GaussianSigmaEvent: got error %v", err)
+	}
+	if math.Abs(e.Epsilon()-1) > 1e-3 || e.Delta() != 1e-5 {
+		t.Errorf("GaussianSigmaEvent: got (%f, %e), want (1, 1e-5)", e.Epsilon(), e.Delta())
+	}
+	want, err := GaussianEvent(1, 1e-5)
+	if err != nil {
+		t.Fatalf("GaussianEvent: got error %v", err)
+	}
+	if got, want := e.rdp(2), want.rdp(2); math.Abs(got-want) > 1e-9 {
+		t.Errorf("GaussianSigmaEvent: got an RDP guarantee of %f at order 2, want %f", got, want)
+	}
+
+	if _, err := LaplaceScaleEvent(1, 1, 0); err == nil {
+		t.Errorf("LaplaceScaleEvent: got no error for zero scale, want error")
+	}
+	if _, err := GaussianSigmaEvent(1, 1, 1, 0); err == nil {
+		t.Errorf("GaussianSigmaEvent: got no error for zero delta, want error")
+	}
+}
+
+func TestZCDPEvent(t *testing.T) {
+	if _, err := ZCDPEvent(0); err == nil {
+		t.Errorf("ZCDPEvent: got no error for zero rho, want error")
+	}
+	e, err := ZCDPEvent(0.5)
+	if err != nil {
+		t.Fatalf("ZCDPEvent: got error %v", err)
+	}
+	if got := e.rdp(3); got != 1.5 {
+		t.Errorf("ZCDPEvent(0.5): got RDP guarantee %f at order 3, want 1.5", got)
+	}
+}
+
+func TestSampledGaussianRDP(t *testing.T) {
+	const sigma, q = 1.5, 0.01
+	// At order 2, A_2 = 1 + q²·(exp(1/σ²) - 1).
+	want := math.Log1p(q * q * math.Expm1(1/(sigma*sigma)))
+	if got := sampledGaussianRDP(sigma, q, 2); math.Abs(got-want) > 1e-12 {
+		t.Errorf("sampledGaussianRDP(%f, %f, 2): got %e, want %e", sigma, q, got, want)
+	}
+	// Without sampling, the mechanism is the Gaussian mechanism.
+	if got, want := sampledGaussianRDP(sigma, 1, 3), 3/(2*sigma*sigma); math.Abs(got-want) > 1e-12 {
+		t.Errorf("sampledGaussianRDP(%f, 1, 3): got %f, want %f", sigma, got, want)
+	}
+	// Sampling amplifies privacy, and the guarantee must not overflow for large
+	// orders.
+	for _, alpha := range DefaultOrders {
+		got := sampledGaussianRDP(sigma, q, alpha)
+		if math.IsNaN(got) || got < 0 || got > alpha/(2*sigma*sigma) {
+			t.Errorf("sampledGaussianRDP(%f, %f, %f): got %f, want in [0, %f]", sigma, q, alpha, got, alpha/(2*sigma*sigma))
+		}
+	}
+}
+
+func TestSampledGaussianEvent(t *testing.T) {
+	for _, tc := range []struct {
+		noiseMultiplier, samplingRate float64
+	}{
+		{0, 0.1},
+		{math.Inf(1), 0.1},
+		{1, 0},
+		{1, 1.5},
+		{1, math.NaN()},
+	} {
+		if _, err := SampledGaussianEvent(tc.noiseMultiplier, tc.samplingRate); err == nil {
+			t.Errorf("SampledGaussianEvent(%f, %f): got no error, want error", tc.noiseMultiplier, tc.samplingRate)
+		}
+	}
+	// Many steps of DP-SGD with a small sampling rate compose to a reasonable
+	// budget, much smaller than without amplification by sampling.
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 10, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("NewAccountant: got error %v", err)
+	}
+	e, err := SampledGaussianEvent(1.1, 0.01)
+	if err != nil {
+		t.Fatalf("SampledGaussianEvent: got error %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := a.Spend(e); err != nil {
+			t.Fatalf("Spend: got error %v", err)
+		}
+	}
+	if eps, _ := a.Spent(); eps <= 0 || eps > 2 {
+		t.Errorf("Spent after 1000 steps with σ = 1.1 and q = 0.01: got ε = %f, want in (0, 2]", eps)
+	}
+}
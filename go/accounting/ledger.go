@@ -0,0 +1,99 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAlreadyReleased is returned (wrapped) when recording a release whose name
+// is already in the ledger of an Accountant and hasn't been retracted.
+var ErrAlreadyReleased = errors.New("release already recorded")
+
+// LedgerEntry records a named release in the ledger of an Accountant.
+type LedgerEntry struct {
+	Name string
+	// Privacy loss of the events of the release, using basic composition.
+	Epsilon, Delta float64
+	// Whether the release was retracted, and why.
+	Retracted        bool
+	RetractionReason string
+}
+
+// Release is like Spend, but also records the events as a release with the
+// given name in the ledger of the Accountant, see Ledger. It returns an error
+// wrapping ErrAlreadyReleased and spends nothing if a release with the same
+// name is in the ledger and hasn't been retracted.
+//
+// A retracted release can be released again under the same name, which spends
+// the privacy loss of the new events: the budget of the retracted release is
+// never reused.
+func (a *Accountant) Release(name string, events ...Event) error {
+	if name == "" {
+		return fmt.Errorf("Accountant: Release requires a name")
+	}
+	if i := a.lastRelease(name); i >= 0 && !a.ledger[i].Retracted {
+		return fmt.Errorf("Accountant: release %q is already in the ledger, retract it before releasing it again: %w", name, ErrAlreadyReleased)
+	}
+	if err := a.Spend(events...); err != nil {
+		return err
+	}
+	entry := LedgerEntry{Name: name}
+	for _, e := range events {
+		entry.Epsilon += e.epsilon
+		entry.Delta += e.delta
+	}
+	a.ledger = append(a.ledger, entry)
+	return nil
+}
+
+// Retract marks the last release with the given name as retracted, e.g.
+// because it was computed on incorrect data, with the given reason. The
+// privacy loss of the release is NOT refunded: the release may already have
+// been seen, so it still counts towards the privacy loss reported by Spent.
+// Retract returns an error if there is no such release, or if it has already
+// been retracted.
+func (a *Accountant) Retract(name, reason string) error {
+	i := a.lastRelease(name)
+	if i < 0 {
+		return fmt.Errorf("Accountant: release %q isn't in the ledger", name)
+	}
+	if a.ledger[i].Retracted {
+		return fmt.Errorf("Accountant: release %q has already been retracted", name)
+	}
+	a.ledger[i].Retracted = true
+	a.ledger[i].RetractionReason = reason
+	return nil
+}
+
+// Ledger returns the releases recorded with Release, in the order in which
+// they were made, including the retracted ones.
+func (a *Accountant) Ledger() []LedgerEntry {
+	return append([]LedgerEntry(nil), a.ledger...)
+}
+
+// lastRelease returns the index of the last release with the given name in the
+// ledger, or -1 if there is none.
+func (a *Accountant) lastRelease(name string) int {
+	for i := len(a.ledger) - 1; i >= 0; i-- {
+		if a.ledger[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,71 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccountantRetraction(t *testing.T) {
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("Couldn't initialize accountant: %v", err)
+	}
+	e, _ := LaplaceEvent(0.4)
+	if err := a.Release("daily", e); err != nil {
+		t.Fatalf("Release: got error %v", err)
+	}
+	if err := a.Release("daily", e); !errors.Is(err, ErrAlreadyReleased) {
+		t.Errorf("Release of an active release: got error %v, want ErrAlreadyReleased", err)
+	}
+	if err := a.Retract("daily", "wrong data"); err != nil {
+		t.Fatalf("Retract: got error %v", err)
+	}
+	if err := a.Retract("daily", "again"); err == nil {
+		t.Errorf("Retract of a retracted release: got no error, want error")
+	}
+	if err := a.Retract("weekly", ""); err == nil {
+		t.Errorf("Retract of an unknown release: got no error, want error")
+	}
+	// The budget of the retracted release isn't refunded.
+	if eps, _ := a.Spent(); eps != 0.4 {
+		t.Errorf("Spent after Retract: got ε %f, want 0.4", eps)
+	}
+	// Releasing it again spends fresh budget.
+	if err := a.Release("daily", e); err != nil {
+		t.Fatalf("Release after Retract: got error %v", err)
+	}
+	if eps, _ := a.Spent(); eps != 0.8 {
+		t.Errorf("Spent after re-release: got ε %f, want 0.8", eps)
+	}
+	if err := a.Retract("daily", "wrong again"); err != nil {
+		t.Fatalf("Retract: got error %v", err)
+	}
+	if err := a.Release("daily", e); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Release beyond the budget: got error %v, want ErrBudgetExceeded", err)
+	}
+	want := []LedgerEntry{
+		{Name: "daily", Epsilon: 0.4, Retracted: true, RetractionReason: "wrong data"},
+		{Name: "daily", Epsilon: 0.4, Retracted: true, RetractionReason: "wrong again"},
+	}
+	if diff := cmp.Diff(want, a.Ledger()); diff != "" {
+		t.Errorf("Ledger: got diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,267 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// BudgetRecord records a privacy budget expenditure on a dataset in a
+// PersistentLedger.
+type BudgetRecord struct {
+	Dataset string
+	Time    time.Time
+	// Mechanism that spent the budget, e.g. "Count" or the name of a release.
+	Mechanism string
+	// Privacy loss of the expenditure, using basic composition.
+	Epsilon, Delta float64
+	// Parameters of the mechanism, e.g. its contribution bounds, for
+	// auditing. Optional.
+	Parameters map[string]string
+}
+
+// LedgerStorage stores the records of a PersistentLedger, e.g. in a file with
+// FileLedgerStorage or in a database with SQLLedgerStorage. Implementations
+// must persist a record before Append returns, so that it survives restarts.
+type LedgerStorage interface {
+	// Append stores a new record.
+	Append(r BudgetRecord) error
+	// Records returns the records of the given dataset, in the order in which
+	// they were appended.
+	Records(dataset string) ([]BudgetRecord, error)
+}
+
+// PersistentLedger records every privacy budget expenditure on a dataset in a
+// LedgerStorage, and refuses expenditures that would exceed the budget of the
+// dataset, e.g. to enforce a lifetime budget per dataset across the runs of a
+// production pipeline.
+//
+// Unlike an Accountant, whose state is lost when the process exits, the
+// spent budget of a dataset is recomputed from the stored records, so it
+// survives restarts. Records only store (ε, δ) guarantees, so expenditures are
+// composed using basic composition; to benefit from tighter composition
+// within a run, compose its events with an Accountant and record its Spent
+// privacy loss.
+//
+// A PersistentLedger is thread-safe, but processes sharing a LedgerStorage
+// must serialize their expenditures on a dataset, e.g. with a lock of their
+// own, since checking the budget and appending the record aren't atomic
+// across processes.
+type PersistentLedger struct {
+	// Parameters
+	storage LedgerStorage
+	epsilon float64
+	delta   float64
+	now     func() time.Time
+
+	mu sync.Mutex
+}
+
+// PersistentLedgerOptions contains the options necessary to initialize a
+// PersistentLedger.
+type PersistentLedgerOptions struct {
+	Storage LedgerStorage // Storage of the records. Required.
+	// Privacy budget (ε, δ) of each dataset. Epsilon is required.
+	Epsilon, Delta float64
+	// Returns the time of new records. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewPersistentLedger returns a new PersistentLedger, whose spent budgets are
+// those of the records already in its storage.
+func NewPersistentLedger(opt *PersistentLedgerOptions) (*PersistentLedger, error) {
+	if opt == nil {
+		opt = &PersistentLedgerOptions{}
+	}
+	if opt.Storage == nil {
+		return nil, fmt.Errorf("NewPersistentLedger requires a Storage")
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewPersistentLedger: %w", err)
+	}
+	if err := checks.CheckDelta(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewPersistentLedger: %w", err)
+	}
+	now := opt.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &PersistentLedger{
+		storage: opt.Storage,
+		epsilon: opt.Epsilon,
+		delta:   opt.Delta,
+		now:     now,
+	}, nil
+}
+
+// Spend records the privacy loss of the given events on the given dataset,
+// with the given mechanism and parameters. If the events would exceed the
+// budget of the dataset, Spend returns an error wrapping ErrBudgetExceeded and
+// records nothing, so the aggregations of the events must not be run.
+func (l *PersistentLedger) Spend(dataset, mechanism string, parameters map[string]string, events ...Event) error {
+	if dataset == "" {
+		return fmt.Errorf("PersistentLedger: Spend requires a dataset")
+	}
+	if mechanism == "" {
+		return fmt.Errorf("PersistentLedger: Spend requires a mechanism")
+	}
+	r := BudgetRecord{Dataset: dataset, Mechanism: mechanism, Parameters: parameters}
+	for _, e := range events {
+		r.Epsilon += e.epsilon
+		r.Delta += e.delta
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	eps, del, err := l.spent(dataset)
+	if err != nil {
+		return err
+	}
+	if eps+r.Epsilon > l.epsilon*(1+budgetTolerance) || del+r.Delta > l.delta*(1+budgetTolerance) {
+		return fmt.Errorf("PersistentLedger: spending (%v, %v) on dataset %q would bring its privacy loss to (%v, %v) with a budget of (%v, %v): %w", r.Epsilon, r.Delta, dataset, eps+r.Epsilon, del+r.Delta, l.epsilon, l.delta, ErrBudgetExceeded)
+	}
+	r.Time = l.now()
+	if err := l.storage.Append(r); err != nil {
+		return fmt.Errorf("PersistentLedger: couldn't store record: %w", err)
+	}
+	return nil
+}
+
+// Spent returns the privacy loss (ε, δ) spent on the given dataset so far,
+// using basic composition of its records.
+func (l *PersistentLedger) Spent(dataset string) (epsilon, delta float64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spent(dataset)
+}
+
+// Remaining returns the privacy budget (ε, δ) left on the given dataset.
+func (l *PersistentLedger) Remaining(dataset string) (epsilon, delta float64, err error) {
+	eps, del, err := l.Spent(dataset)
+	if err != nil {
+		return 0, 0, err
+	}
+	return max0(l.epsilon - eps), max0(l.delta - del), nil
+}
+
+// Records returns the records of the given dataset, in the order in which
+// they were stored.
+func (l *PersistentLedger) Records(dataset string) ([]BudgetRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records, err := l.storage.Records(dataset)
+	if err != nil {
+		return nil, fmt.Errorf("PersistentLedger: couldn't read records: %w", err)
+	}
+	return records, nil
+}
+
+func (l *PersistentLedger) spent(dataset string) (epsilon, delta float64, err error) {
+	records, err := l.storage.Records(dataset)
+	if err != nil {
+		return 0, 0, fmt.Errorf("PersistentLedger: couldn't read records: %w", err)
+	}
+	for _, r := range records {
+		epsilon += r.Epsilon
+		delta += r.Delta
+	}
+	return epsilon, delta, nil
+}
+
+func max0(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	return x
+}
+
+// FileLedgerStorage is a LedgerStorage that stores records in a file, as one
+// JSON object per line. Records are appended to the file and synced to disk
+// before Append returns. The file is read in full by Records, so this is meant
+// for ledgers of up to a few thousand records.
+//
+// Not safe for use by several processes at once.
+type FileLedgerStorage struct {
+	path string
+}
+
+// NewFileLedgerStorage returns a FileLedgerStorage storing records in the file
+// at the given path, which is created if it doesn't exist.
+func NewFileLedgerStorage(path string) (*FileLedgerStorage, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("NewFileLedgerStorage: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("NewFileLedgerStorage: %w", err)
+	}
+	return &FileLedgerStorage{path: path}, nil
+}
+
+// Append appends r to the file.
+func (s *FileLedgerStorage) Append(r BudgetRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Records returns the records of the given dataset stored in the file.
+func (s *FileLedgerStorage) Records(dataset string) ([]BudgetRecord, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []BudgetRecord
+	scanner := bufio.NewScanner(f)
+	// Records with many parameters can be longer than the default limit of
+	// 64 KiB per line.
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var r BudgetRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("couldn't decode record on line %d of %s: %w", line, s.path, err)
+		}
+		if r.Dataset == dataset {
+			records = append(records, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
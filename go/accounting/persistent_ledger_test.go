@@ -0,0 +1,143 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newFileLedger(t *testing.T, path string, now time.Time) *PersistentLedger {
+	t.Helper()
+	storage, err := NewFileLedgerStorage(path)
+	if err != nil {
+		t.Fatalf("NewFileLedgerStorage: got error %v", err)
+	}
+	l, err := NewPersistentLedger(&PersistentLedgerOptions{
+		Storage: storage,
+		Epsilon: 1,
+		Delta:   1e-5,
+		Now:     func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("NewPersistentLedger: got error %v", err)
+	}
+	return l
+}
+
+func TestPersistentLedgerSurvivesRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := newFileLedger(t, path, now)
+	e1, _ := LaplaceEvent(0.5)
+	e2, _ := ApproxDPEvent(0.25, 1e-6)
+	if err := l.Spend("visits", "Count", map[string]string{"MaxPartitionsContributed": "1"}, e1); err != nil {
+		t.Fatalf("Spend: got error %v", err)
+	}
+	if err := l.Spend("visits", "SelectPartitions", nil, e2); err != nil {
+		t.Fatalf("Spend: got error %v", err)
+	}
+
+	// A new ledger on the same file knows the records of the previous one.
+	l = newFileLedger(t, path, now)
+	want := []BudgetRecord{
+		{Dataset: "visits", Time: now, Mechanism: "Count", Epsilon: 0.5, Parameters: map[string]string{"MaxPartitionsContributed": "1"}},
+		{Dataset: "visits", Time: now, Mechanism: "SelectPartitions", Epsilon: 0.25, Delta: 1e-6},
+	}
+	got, err := l.Records("visits")
+	if err != nil {
+		t.Fatalf("Records: got error %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Records after a restart: got diff (-want +got):\n%s", diff)
+	}
+	if eps, del, err := l.Remaining("visits"); err != nil || eps != 0.25 || !approxEqualDelta(del, 9e-6) {
+		t.Errorf("Remaining after a restart: got (%v, %v, %v), want (0.25, 9e-6, nil)", eps, del, err)
+	}
+
+	// Spending beyond the budget of the dataset fails and records nothing,
+	// while other datasets have their own budget.
+	e3, _ := LaplaceEvent(0.5)
+	if err := l.Spend("visits", "Count", nil, e3); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Spend beyond the budget: got error %v, want ErrBudgetExceeded", err)
+	}
+	if got, _ := l.Records("visits"); len(got) != 2 {
+		t.Errorf("Records after a refused expenditure: got %d records, want 2", len(got))
+	}
+	if err := l.Spend("purchases", "Count", nil, e3); err != nil {
+		t.Errorf("Spend on another dataset: got error %v", err)
+	}
+	e4, _ := ApproxDPEvent(0.1, 1e-4)
+	if err := l.Spend("purchases", "Count", nil, e4); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Spend beyond the δ budget: got error %v, want ErrBudgetExceeded", err)
+	}
+}
+
+// approxEqualDelta returns whether two values of δ are equal up to floating
+// point errors.
+func approxEqualDelta(a, b float64) bool {
+	return a-b < 1e-15 && b-a < 1e-15
+}
+
+func TestPersistentLedgerInvalidArguments(t *testing.T) {
+	storage, err := NewFileLedgerStorage(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFileLedgerStorage: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		opt  *PersistentLedgerOptions
+	}{
+		{"nil options", nil},
+		{"no Storage", &PersistentLedgerOptions{Epsilon: 1}},
+		{"no Epsilon", &PersistentLedgerOptions{Storage: storage}},
+		{"Delta of 1", &PersistentLedgerOptions{Storage: storage, Epsilon: 1, Delta: 1}},
+	} {
+		if _, err := NewPersistentLedger(tc.opt); err == nil {
+			t.Errorf("NewPersistentLedger with %s: got no error, want error", tc.desc)
+		}
+	}
+	l, err := NewPersistentLedger(&PersistentLedgerOptions{Storage: storage, Epsilon: 1})
+	if err != nil {
+		t.Fatalf("NewPersistentLedger: got error %v", err)
+	}
+	e, _ := LaplaceEvent(0.1)
+	if err := l.Spend("", "Count", nil, e); err == nil {
+		t.Errorf("Spend without dataset: got no error, want error")
+	}
+	if err := l.Spend("visits", "", nil, e); err == nil {
+		t.Errorf("Spend without mechanism: got no error, want error")
+	}
+}
+
+func TestFileLedgerStorageCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	if err := os.WriteFile(path, []byte("not json\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: got error %v", err)
+	}
+	l := newFileLedger(t, path, time.Now())
+	e, _ := LaplaceEvent(0.1)
+	// A ledger whose records can't be read refuses all expenditures.
+	if err := l.Spend("visits", "Count", nil, e); err == nil {
+		t.Errorf("Spend with a corrupt file: got no error, want error")
+	}
+}
@@ -0,0 +1,201 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// PlanMetric is a metric of a Plan, e.g. a count or a vector sum.
+type PlanMetric struct {
+	Name string // Name of the metric, unique within the plan. Required.
+	// Noise of the metric's aggregation: noise.Laplace(), noise.Gaussian() or
+	// noise.DiscreteGaussian(), which is accounted for like Gaussian noise.
+	// Defaults to Laplace noise.
+	Noise noise.Noise
+	// Relative share of the budget, e.g. 2 for a metric that should get twice
+	// the ε of the metrics of weight 1. Defaults to 1.
+	Weight float64
+}
+
+// PlannedMetric is the privacy budget allocated to a metric by a Plan. Epsilon
+// and Delta are the parameters to initialize the metric's aggregation with
+// its Noise.
+type PlannedMetric struct {
+	Name           string
+	Noise          noise.Noise
+	Epsilon, Delta float64
+}
+
+// PlanOptions contains the options necessary to initialize a Plan.
+type PlanOptions struct {
+	Epsilon float64 // Total privacy budget ε. Required.
+	// Total privacy budget δ. Required if a metric uses Gaussian noise.
+	Delta   float64
+	Metrics []PlanMetric // Metrics of the plan. Required.
+	// Rényi orders at which the events of the metrics are composed. Defaults
+	// to DefaultOrders.
+	Orders []float64
+}
+
+// Plan splits a total (ε, δ) budget between metrics which may use different
+// noise mechanisms, e.g. Laplace noise for scalar counts and Gaussian noise for
+// high-dimensional vectors, instead of a single noise for the whole pipeline.
+//
+// Each metric gets an ε proportional to its weight, and Gaussian metrics are
+// calibrated with an equal share of half of δ. The proportionality constant is
+// the largest one for which the composition of the events of all metrics by
+// an Accountant, which composes Laplace and Gaussian events with Rényi
+// differential privacy, fits in the total budget. This allocates more budget
+// than splitting ε with basic composition, especially with many Gaussian
+// metrics.
+type Plan struct {
+	metrics []PlannedMetric
+	byName  map[string]int
+	events  []Event
+}
+
+// NewPlan returns the Plan of the given metrics.
+func NewPlan(opt *PlanOptions) (*Plan, error) {
+	if opt == nil {
+		opt = &PlanOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewPlan: %w", err)
+	}
+	if err := checks.CheckDelta(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewPlan: %w", err)
+	}
+	if len(opt.Metrics) == 0 {
+		return nil, fmt.Errorf("NewPlan requires at least one metric")
+	}
+	metrics := make([]PlannedMetric, len(opt.Metrics))
+	weights := make([]float64, len(opt.Metrics))
+	byName := make(map[string]int)
+	var totalWeight float64
+	var numGaussian int
+	for i, m := range opt.Metrics {
+		if m.Name == "" {
+			return nil, fmt.Errorf("NewPlan: metric %d has no Name", i)
+		}
+		if _, ok := byName[m.Name]; ok {
+			return nil, fmt.Errorf("NewPlan: metric %q is declared twice", m.Name)
+		}
+		n := m.Noise
+		if n == nil {
+			n = noise.Laplace()
+		}
+		switch noise.ToKind(n) {
+		case noise.LaplaceNoise:
+		case noise.GaussianNoise, noise.DiscreteGaussianNoise:
+			numGaussian++
+		default:
+			return nil, fmt.Errorf("NewPlan: metric %q: unsupported noise, must be Laplace or Gaussian", m.Name)
+		}
+		weight := m.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if !(weight > 0) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("NewPlan: metric %q: Weight is %f, must be strictly positive and finite", m.Name, weight)
+		}
+		byName[m.Name] = i
+		metrics[i] = PlannedMetric{Name: m.Name, Noise: n}
+		weights[i] = weight
+		totalWeight += weight
+	}
+	if numGaussian > 0 && opt.Delta == 0 {
+		return nil, fmt.Errorf("NewPlan: Delta is 0, must be strictly positive with Gaussian metrics")
+	}
+	a, err := NewAccountant(&AccountantOptions{Epsilon: opt.Epsilon, Delta: opt.Delta, Orders: opt.Orders})
+	if err != nil {
+		return nil, fmt.Errorf("NewPlan: %w", err)
+	}
+
+	// planWith allocates ε = scale·weight to each metric.
+	var gaussianDelta float64
+	if numGaussian > 0 {
+		gaussianDelta = opt.Delta / 2 / float64(numGaussian)
+	}
+	planWith := func(scale float64) ([]PlannedMetric, []Event, error) {
+		planned := make([]PlannedMetric, len(metrics))
+		events := make([]Event, len(metrics))
+		for i, m := range metrics {
+			m.Epsilon = scale * weights[i]
+			var err error
+			if noise.NeedsDelta(noise.ToKind(m.Noise)) {
+				m.Delta = gaussianDelta
+				events[i], err = GaussianEvent(m.Epsilon, m.Delta)
+			} else {
+				events[i], err = LaplaceEvent(m.Epsilon)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			planned[i] = m
+		}
+		return planned, events, nil
+	}
+	fits := func(scale float64) bool {
+		_, events, err := planWith(scale)
+		return err == nil && a.CanSpend(events...)
+	}
+	// With basic composition, the events fit the budget exactly.
+	lo := opt.Epsilon / totalWeight
+	hi := 2 * lo
+	for i := 0; i < 64 && fits(hi); i++ {
+		lo, hi = hi, 2*hi
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	planned, events, err := planWith(lo)
+	if err != nil {
+		return nil, fmt.Errorf("NewPlan: %w", err)
+	}
+	return &Plan{metrics: planned, byName: byName, events: events}, nil
+}
+
+// Metrics returns the budgets allocated to the metrics, in the order of the
+// options.
+func (p *Plan) Metrics() []PlannedMetric {
+	return append([]PlannedMetric(nil), p.metrics...)
+}
+
+// Metric returns the budget allocated to the metric with the given name.
+func (p *Plan) Metric(name string) (PlannedMetric, error) {
+	i, ok := p.byName[name]
+	if !ok {
+		return PlannedMetric{}, fmt.Errorf("Plan has no metric %q", name)
+	}
+	return p.metrics[i], nil
+}
+
+// Events returns the events of all the metrics, to be spent on an Accountant
+// when the metrics are released.
+func (p *Plan) Events() []Event {
+	return append([]Event(nil), p.events...)
+}
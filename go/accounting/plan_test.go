@@ -0,0 +1,117 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewPlanInvalidOptions(t *testing.T) {
+	count := PlanMetric{Name: "count"}
+	for _, tc := range []struct {
+		desc string
+		opts *PlanOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &PlanOptions{Metrics: []PlanMetric{count}}},
+		{"no metrics", &PlanOptions{Epsilon: 1}},
+		{"no name", &PlanOptions{Epsilon: 1, Metrics: []PlanMetric{{}}}},
+		{"duplicate name", &PlanOptions{Epsilon: 1, Metrics: []PlanMetric{count, count}}},
+		{"negative weight", &PlanOptions{Epsilon: 1, Metrics: []PlanMetric{{Name: "count", Weight: -1}}}},
+		{"unsupported noise", &PlanOptions{Epsilon: 1, Delta: 1e-5, Metrics: []PlanMetric{{Name: "count", Noise: noise.Geometric()}}}},
+		{"Gaussian metric without delta", &PlanOptions{Epsilon: 1, Metrics: []PlanMetric{{Name: "vector", Noise: noise.Gaussian()}}}},
+	} {
+		if _, err := NewPlan(tc.opts); err == nil {
+			t.Errorf("NewPlan: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestPlanLaplaceOnly(t *testing.T) {
+	// Without δ, the budget is split with basic composition.
+	p, err := NewPlan(&PlanOptions{
+		Epsilon: 1,
+		Metrics: []PlanMetric{{Name: "count"}, {Name: "sum", Weight: 3}},
+	})
+	if err != nil {
+		t.Fatalf("NewPlan: got error %v", err)
+	}
+	for _, want := range []PlannedMetric{
+		{Name: "count", Noise: noise.Laplace(), Epsilon: 0.25},
+		{Name: "sum", Noise: noise.Laplace(), Epsilon: 0.75},
+	} {
+		got, err := p.Metric(want.Name)
+		if err != nil {
+			t.Fatalf("Metric(%q): got error %v", want.Name, err)
+		}
+		if got.Noise != want.Noise || math.Abs(got.Epsilon-want.Epsilon) > 1e-6 || got.Delta != 0 {
+			t.Errorf("Metric(%q): got %+v, want %+v", want.Name, got, want)
+		}
+	}
+	if _, err := p.Metric("mean"); err == nil {
+		t.Errorf("Metric of an unknown metric: got no error, want error")
+	}
+}
+
+func TestPlanMixedNoise(t *testing.T) {
+	metrics := []PlanMetric{{Name: "count", Noise: noise.Laplace()}}
+	for _, name := range []string{"v1", "v2", "v3", "v4", "v5", "v6", "v7", "v8", "v9"} {
+		metrics = append(metrics, PlanMetric{Name: name, Noise: noise.Gaussian()})
+	}
+	// Discrete Gaussian noise is planned like Gaussian noise.
+	metrics = append(metrics, PlanMetric{Name: "v10", Noise: noise.DiscreteGaussian()})
+	p, err := NewPlan(&PlanOptions{Epsilon: 1, Delta: 1e-5, Metrics: metrics})
+	if err != nil {
+		t.Fatalf("NewPlan: got error %v", err)
+	}
+	planned := p.Metrics()
+	if len(planned) != len(metrics) {
+		t.Fatalf("Metrics: got %d metrics, want %d", len(planned), len(metrics))
+	}
+	// Metrics have the same weight, so they get the same ε, which is larger
+	// than with basic composition thanks to RDP composition.
+	basicEpsilon := 1.0 / float64(len(metrics))
+	for _, m := range planned {
+		if math.Abs(m.Epsilon-planned[0].Epsilon) > 1e-12 {
+			t.Errorf("Metrics: got ε=%f for %q and ε=%f for %q, want equal", m.Epsilon, m.Name, planned[0].Epsilon, planned[0].Name)
+		}
+		if m.Epsilon <= basicEpsilon {
+			t.Errorf("Metrics: got ε=%f for %q, want more than %f", m.Epsilon, m.Name, basicEpsilon)
+		}
+		wantDelta := 0.0
+		if noise.NeedsDelta(noise.ToKind(m.Noise)) {
+			wantDelta = 1e-5 / 20
+		}
+		if !approxEqualDelta(m.Delta, wantDelta) {
+			t.Errorf("Metrics: got δ=%e for %q, want %e", m.Delta, m.Name, wantDelta)
+		}
+	}
+	// The events of the plan fit the budget.
+	a, err := NewAccountant(&AccountantOptions{Epsilon: 1, Delta: 1e-5, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("NewAccountant: got error %v", err)
+	}
+	if err := a.Spend(p.Events()...); err != nil {
+		t.Errorf("Spend(Events()): got error %v", err)
+	}
+	if eps, _ := a.Spent(); eps < 0.99 {
+		t.Errorf("Spent after Events(): got ε=%f, want the whole budget of 1", eps)
+	}
+}
@@ -0,0 +1,300 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// ErrNotScheduled is returned (wrapped) when a release isn't allowed by a
+// Schedule, e.g. because the backfill pool is exhausted.
+var ErrNotScheduled = errors.New("release not allowed by schedule")
+
+// RecurringRelease declares a release that happens at a fixed cadence, e.g. a
+// daily report.
+type RecurringRelease struct {
+	Name  string        // Name of the release, unique within a Schedule. Required.
+	Every time.Duration // Cadence of the release. Required; must be at most the Period of the Schedule.
+	// Relative share of the budget of each occurrence of the release, compared
+	// to the other releases of the Schedule. Defaults to 1.
+	Weight float64
+}
+
+// ScheduleEntry describes the budget derived for a RecurringRelease.
+type ScheduleEntry struct {
+	Name  string
+	Every time.Duration
+	// Number of occurrences of the release in each period.
+	ReleasesPerPeriod int64
+	// Privacy budget of each occurrence of the release.
+	Epsilon, Delta float64
+}
+
+// Schedule derives the budgets of recurring releases from a privacy budget cap
+// per period, e.g. per year, and enforces that releases follow the schedule.
+//
+// Time is split into consecutive periods of length Period starting at Start,
+// and each period is split into consecutive slots of length Every for each
+// release, the last slot being shorter if Every doesn't divide Period. Each
+// release may happen at most once per slot. The cap is split between all the
+// occurrences of all releases in a period proportionally to their weights, so
+// that the releases of a period compose to at most the cap using basic
+// composition.
+//
+// Slots may be released in any order, e.g. a slot skipped on a holiday can be
+// released later using its own budget. Releasing a slot again, e.g. to
+// backfill a past period, never silently spends the budget of the period a
+// second time: Release returns the cached result of the slot, and Rerun
+// recomputes it with budget drawn from a dedicated backfill pool.
+//
+// Not thread-safe.
+type Schedule struct {
+	// Parameters
+	period  time.Duration
+	start   time.Time
+	entries []ScheduleEntry
+	byName  map[string]int
+
+	// State variables
+	// Results of the used slots of each release, by index of the slot since
+	// Start. A used slot whose result failed is present with a nil value.
+	results []map[int64]*slotResult
+	// Remaining budget of the backfill pool.
+	backfillEpsilon, backfillDelta float64
+}
+
+// slotResult is the cached result of a slot.
+type slotResult struct {
+	value interface{}
+}
+
+// ScheduleOptions contains the options necessary to initialize a Schedule.
+type ScheduleOptions struct {
+	Epsilon float64 // Privacy budget ε of each period. Required.
+	Delta   float64 // Privacy budget δ of each period. Defaults to 0.
+	// Length of a period, e.g. 365 days. Required; calendar months and years
+	// must be approximated by a fixed duration.
+	Period   time.Duration
+	Start    time.Time          // Beginning of the first period. Required.
+	Releases []RecurringRelease // Releases of the schedule. Required.
+	// Privacy budget of the backfill pool, used by Rerun over the lifetime of
+	// the schedule, in addition to the budget of the periods. Default to 0, in
+	// which case slots can't be re-run.
+	BackfillEpsilon, BackfillDelta float64
+}
+
+// NewSchedule returns a new Schedule for the given releases, none of which
+// has happened yet.
+func NewSchedule(opt *ScheduleOptions) (*Schedule, error) {
+	if opt == nil {
+		opt = &ScheduleOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewSchedule: %w", err)
+	}
+	if err := checks.CheckDelta(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewSchedule: %w", err)
+	}
+	if opt.Period <= 0 {
+		return nil, fmt.Errorf("NewSchedule: Period is %v, must be strictly positive", opt.Period)
+	}
+	if opt.Start.IsZero() {
+		return nil, fmt.Errorf("NewSchedule requires a non-zero Start")
+	}
+	if err := checks.CheckEpsilon(opt.BackfillEpsilon); err != nil {
+		return nil, fmt.Errorf("NewSchedule: backfill pool: %w", err)
+	}
+	if err := checks.CheckDelta(opt.BackfillDelta); err != nil {
+		return nil, fmt.Errorf("NewSchedule: backfill pool: %w", err)
+	}
+	if len(opt.Releases) == 0 {
+		return nil, fmt.Errorf("NewSchedule requires at least one release")
+	}
+
+	entries := make([]ScheduleEntry, len(opt.Releases))
+	weights := make([]float64, len(opt.Releases))
+	byName := make(map[string]int)
+	var totalWeight float64
+	for i, r := range opt.Releases {
+		if r.Name == "" {
+			return nil, fmt.Errorf("NewSchedule: release %d has no Name", i)
+		}
+		if _, ok := byName[r.Name]; ok {
+			return nil, fmt.Errorf("NewSchedule: release %q is declared twice", r.Name)
+		}
+		if r.Every <= 0 || r.Every > opt.Period {
+			return nil, fmt.Errorf("NewSchedule: release %q: Every is %v, must be in (0, %v]", r.Name, r.Every, opt.Period)
+		}
+		weight := r.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if !(weight > 0) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("NewSchedule: release %q: Weight is %f, must be strictly positive and finite", r.Name, weight)
+		}
+		byName[r.Name] = i
+		releasesPerPeriod := slotsPerPeriod(opt.Period, r.Every)
+		entries[i] = ScheduleEntry{Name: r.Name, Every: r.Every, ReleasesPerPeriod: releasesPerPeriod}
+		weights[i] = weight
+		totalWeight += weight * float64(releasesPerPeriod)
+	}
+	for i := range entries {
+		entries[i].Epsilon = opt.Epsilon * weights[i] / totalWeight
+		entries[i].Delta = opt.Delta * weights[i] / totalWeight
+	}
+
+	results := make([]map[int64]*slotResult, len(entries))
+	for i := range results {
+		results[i] = make(map[int64]*slotResult)
+	}
+	return &Schedule{
+		period:          opt.Period,
+		start:           opt.Start,
+		entries:         entries,
+		byName:          byName,
+		results:         results,
+		backfillEpsilon: opt.BackfillEpsilon,
+		backfillDelta:   opt.BackfillDelta,
+	}, nil
+}
+
+// slotsPerPeriod returns the number of slots of length every in a period,
+// counting the last partial slot.
+func slotsPerPeriod(period, every time.Duration) int64 {
+	return int64((period + every - 1) / every)
+}
+
+// Entries returns the budgets derived for each release, in the order in which
+// the releases were declared, e.g. for review before the schedule is used.
+func (s *Schedule) Entries() []ScheduleEntry {
+	return append([]ScheduleEntry(nil), s.entries...)
+}
+
+// String returns a human-readable table of the schedule's entries.
+func (s *Schedule) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Schedule starting at %v with a period of %v:\n", s.start, s.period)
+	for _, e := range s.entries {
+		fmt.Fprintf(&b, "  %s: every %v, %d releases per period, ε = %v, δ = %v per release\n", e.Name, e.Every, e.ReleasesPerPeriod, e.Epsilon, e.Delta)
+	}
+	return b.String()
+}
+
+// Budget returns the privacy budget (ε, δ) of each occurrence of the release
+// with the given name, to be used to initialize its aggregations.
+func (s *Schedule) Budget(name string) (epsilon, delta float64, err error) {
+	i, ok := s.byName[name]
+	if !ok {
+		return 0, 0, fmt.Errorf("Schedule: unknown release %q", name)
+	}
+	return s.entries[i].Epsilon, s.entries[i].Delta, nil
+}
+
+// Release runs result, which should compute the results of the aggregations
+// of the release with the given name happening at time at, if the slot of at
+// hasn't been used yet, and returns the value computed by result. If the slot
+// has already been used successfully, Release returns its cached value without
+// running result, so that re-running a past period doesn't spend its budget
+// again.
+//
+// Release returns an error wrapping ErrNotScheduled without running result if
+// at is before Start, or if the slot has already been used and computing its
+// result failed; such a slot can only be recomputed with Rerun.
+func (s *Schedule) Release(name string, at time.Time, result func() (interface{}, error)) (interface{}, error) {
+	i, slot, err := s.slotOf(name, at)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := s.results[i][slot]; ok {
+		if r == nil {
+			return nil, fmt.Errorf("Schedule: release %q already failed in the slot of %v, use Rerun to recompute it: %w", name, at, ErrNotScheduled)
+		}
+		return r.value, nil
+	}
+	return s.run(i, slot, result)
+}
+
+// Rerun recomputes the release with the given name in the slot of time at,
+// which must already have been used, e.g. to correct a past release or to
+// retry a failed one. The budget of the release, see Budget, is drawn from the
+// backfill pool, and the new value replaces the cached one.
+//
+// Rerun returns an error wrapping ErrNotScheduled without running result if
+// the slot hasn't been used yet, in which case Release should be used, or if
+// the backfill pool doesn't have enough budget left.
+func (s *Schedule) Rerun(name string, at time.Time, result func() (interface{}, error)) (interface{}, error) {
+	i, slot, err := s.slotOf(name, at)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.results[i][slot]; !ok {
+		return nil, fmt.Errorf("Schedule: release %q hasn't happened in the slot of %v, use Release instead: %w", name, at, ErrNotScheduled)
+	}
+	eps, del := s.entries[i].Epsilon, s.entries[i].Delta
+	if eps > s.backfillEpsilon*(1+budgetTolerance) || del > s.backfillDelta*(1+budgetTolerance) {
+		return nil, fmt.Errorf("Schedule: re-running release %q needs (%v, %v) but the backfill pool has (%v, %v) left: %w", name, eps, del, s.backfillEpsilon, s.backfillDelta, ErrNotScheduled)
+	}
+	s.backfillEpsilon = math.Max(0, s.backfillEpsilon-eps)
+	s.backfillDelta = math.Max(0, s.backfillDelta-del)
+	return s.run(i, slot, result)
+}
+
+// BackfillRemaining returns the budget (ε, δ) left in the backfill pool.
+func (s *Schedule) BackfillRemaining() (epsilon, delta float64) {
+	return s.backfillEpsilon, s.backfillDelta
+}
+
+// run marks the slot of release i as used, and caches the value computed by
+// result if it succeeds. The slot is used even if result returns an error,
+// since the aggregations may have spent their budget.
+func (s *Schedule) run(i int, slot int64, result func() (interface{}, error)) (interface{}, error) {
+	s.results[i][slot] = nil
+	value, err := result()
+	if err != nil {
+		return nil, err
+	}
+	s.results[i][slot] = &slotResult{value: value}
+	return value, nil
+}
+
+// slotOf returns the index of the release with the given name and the index of
+// the slot of time at.
+func (s *Schedule) slotOf(name string, at time.Time) (int, int64, error) {
+	i, ok := s.byName[name]
+	if !ok {
+		return 0, 0, fmt.Errorf("Schedule: unknown release %q: %w", name, ErrNotScheduled)
+	}
+	if at.Before(s.start) {
+		return 0, 0, fmt.Errorf("Schedule: release %q at %v is before the start of the schedule (%v): %w", name, at, s.start, ErrNotScheduled)
+	}
+	return i, s.slot(s.entries[i].Every, at), nil
+}
+
+// slot returns the index since Start of the slot of length every containing
+// time at.
+func (s *Schedule) slot(every time.Duration, at time.Time) int64 {
+	elapsed := at.Sub(s.start)
+	periodIndex := int64(elapsed / s.period)
+	inPeriod := elapsed % s.period
+	return periodIndex*slotsPerPeriod(s.period, every) + int64(inPeriod/every)
+}
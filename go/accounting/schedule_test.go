@@ -0,0 +1,195 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+var scheduleStart = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestNewScheduleInvalidOptions(t *testing.T) {
+	daily := RecurringRelease{Name: "daily", Every: day}
+	for _, tc := range []struct {
+		desc string
+		opts *ScheduleOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &ScheduleOptions{Period: 7 * day, Start: scheduleStart, Releases: []RecurringRelease{daily}}},
+		{"zero period", &ScheduleOptions{Epsilon: 1, Start: scheduleStart, Releases: []RecurringRelease{daily}}},
+		{"zero start", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Releases: []RecurringRelease{daily}}},
+		{"no releases", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Start: scheduleStart}},
+		{"no name", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Start: scheduleStart, Releases: []RecurringRelease{{Every: day}}}},
+		{"duplicate name", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Start: scheduleStart, Releases: []RecurringRelease{daily, daily}}},
+		{"cadence longer than period", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Start: scheduleStart, Releases: []RecurringRelease{{Name: "monthly", Every: 30 * day}}}},
+		{"negative backfill epsilon", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Start: scheduleStart, Releases: []RecurringRelease{daily}, BackfillEpsilon: -1}},
+		{"negative weight", &ScheduleOptions{Epsilon: 1, Period: 7 * day, Start: scheduleStart, Releases: []RecurringRelease{{Name: "daily", Every: day, Weight: -1}}}},
+	} {
+		if _, err := NewSchedule(tc.opts); err == nil {
+			t.Errorf("NewSchedule: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestScheduleBudgets(t *testing.T) {
+	s, err := NewSchedule(&ScheduleOptions{
+		Epsilon: 11,
+		Delta:   1.1e-5,
+		Period:  7 * day,
+		Start:   scheduleStart,
+		Releases: []RecurringRelease{
+			{Name: "daily", Every: day},
+			// The last slot of the period is 1 day long.
+			{Name: "three-daily", Every: 3 * day, Weight: 4 / 3.0},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize schedule: %v", err)
+	}
+	// 7 daily releases of weight 1 and 3 releases of weight 4/3 share the budget.
+	for i, want := range []ScheduleEntry{
+		{Name: "daily", Every: day, ReleasesPerPeriod: 7, Epsilon: 1, Delta: 1e-6},
+		{Name: "three-daily", Every: 3 * day, ReleasesPerPeriod: 3, Epsilon: 4 / 3.0, Delta: 4 / 3.0 * 1e-6},
+	} {
+		got := s.Entries()[i]
+		if got.Name != want.Name || got.Every != want.Every || got.ReleasesPerPeriod != want.ReleasesPerPeriod ||
+			math.Abs(got.Epsilon-want.Epsilon) > 1e-12 || math.Abs(got.Delta-want.Delta) > 1e-18 {
+			t.Errorf("Entries()[%d]: got %+v, want %+v", i, got, want)
+		}
+	}
+	eps, del, err := s.Budget("daily")
+	if err != nil {
+		t.Fatalf("Budget: got error %v", err)
+	}
+	if math.Abs(eps-1) > 1e-12 || math.Abs(del-1e-6) > 1e-18 {
+		t.Errorf("Budget(daily): got (%v, %e), want (1, 1e-6)", eps, del)
+	}
+	if _, _, err := s.Budget("hourly"); err == nil {
+		t.Errorf("Budget(hourly): got no error for an unknown release, want error")
+	}
+}
+
+func TestScheduleRelease(t *testing.T) {
+	s, err := NewSchedule(&ScheduleOptions{
+		Epsilon:  1,
+		Period:   7 * day,
+		Start:    scheduleStart,
+		Releases: []RecurringRelease{{Name: "three-daily", Every: 3 * day}},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize schedule: %v", err)
+	}
+	for _, tc := range []struct {
+		desc    string
+		name    string
+		at      time.Time
+		value   int
+		wantRun bool
+		// Expected returned value, or 0 if ErrNotScheduled is expected.
+		want int
+	}{
+		{"before start", "three-daily", scheduleStart.Add(-time.Hour), 1, false, 0},
+		{"unknown release", "daily", scheduleStart, 1, false, 0},
+		{"first slot", "three-daily", scheduleStart.Add(time.Hour), 1, true, 1},
+		{"first slot again", "three-daily", scheduleStart.Add(2 * day), 2, false, 1},
+		// The third slot of the first period is only 1 day long.
+		{"third slot", "three-daily", scheduleStart.Add(6 * day), 3, true, 3},
+		// Skipped slots can be released later.
+		{"skipped second slot", "three-daily", scheduleStart.Add(4 * day), 4, true, 4},
+		{"first slot of the second period", "three-daily", scheduleStart.Add(7 * day), 5, true, 5},
+	} {
+		ran := false
+		got, err := s.Release(tc.name, tc.at, func() (interface{}, error) {
+			ran = true
+			return tc.value, nil
+		})
+		if ran != tc.wantRun {
+			t.Errorf("Release: for %s got ran = %t, want %t", tc.desc, ran, tc.wantRun)
+		}
+		if tc.want == 0 {
+			if !errors.Is(err, ErrNotScheduled) {
+				t.Errorf("Release: for %s got error %v, want ErrNotScheduled", tc.desc, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("Release: for %s got (%v, %v), want (%d, nil)", tc.desc, got, err, tc.want)
+		}
+	}
+}
+
+func TestScheduleReleaseUsesSlotOnError(t *testing.T) {
+	s, err := NewSchedule(&ScheduleOptions{
+		Epsilon:  1,
+		Period:   7 * day,
+		Start:    scheduleStart,
+		Releases: []RecurringRelease{{Name: "daily", Every: day}},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize schedule: %v", err)
+	}
+	resultErr := errors.New("result failed")
+	if _, err := s.Release("daily", scheduleStart, func() (interface{}, error) { return nil, resultErr }); !errors.Is(err, resultErr) {
+		t.Errorf("Release: got error %v, want %v", err, resultErr)
+	}
+	if _, err := s.Release("daily", scheduleStart.Add(time.Hour), func() (interface{}, error) { return 1, nil }); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("Release: got error %v after a failed release in the same slot, want ErrNotScheduled", err)
+	}
+}
+
+func TestScheduleRerun(t *testing.T) {
+	s, err := NewSchedule(&ScheduleOptions{
+		Epsilon:         7,
+		Delta:           7e-6,
+		Period:          7 * day,
+		Start:           scheduleStart,
+		Releases:        []RecurringRelease{{Name: "daily", Every: day}},
+		BackfillEpsilon: 1.5,
+		BackfillDelta:   1e-5,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize schedule: %v", err)
+	}
+	if _, err := s.Rerun("daily", scheduleStart, func() (interface{}, error) { return 1, nil }); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("Rerun: got error %v for an unused slot, want ErrNotScheduled", err)
+	}
+	if _, err := s.Release("daily", scheduleStart, func() (interface{}, error) { return 1, nil }); err != nil {
+		t.Fatalf("Release: got error %v", err)
+	}
+	got, err := s.Rerun("daily", scheduleStart, func() (interface{}, error) { return 2, nil })
+	if err != nil || got != 2 {
+		t.Errorf("Rerun: got (%v, %v), want (2, nil)", got, err)
+	}
+	if eps, del := s.BackfillRemaining(); math.Abs(eps-0.5) > 1e-12 || math.Abs(del-9e-6) > 1e-18 {
+		t.Errorf("BackfillRemaining: got (%v, %e), want (0.5, 9e-6)", eps, del)
+	}
+	// The re-run value replaces the cached one.
+	got, err = s.Release("daily", scheduleStart, func() (interface{}, error) { return 3, nil })
+	if err != nil || got != 2 {
+		t.Errorf("Release: got (%v, %v), want cached (2, nil)", got, err)
+	}
+	// The backfill pool only has ε = 0.5 left.
+	ran := false
+	if _, err := s.Rerun("daily", scheduleStart, func() (interface{}, error) { ran = true; return 4, nil }); !errors.Is(err, ErrNotScheduled) || ran {
+		t.Errorf("Rerun: got error %v and ran = %t with an exhausted backfill pool, want ErrNotScheduled", err, ran)
+	}
+}
@@ -0,0 +1,135 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlTimeLayout is the layout of the times of the records stored by
+// SQLLedgerStorage, which has a fixed width so that the stored times sort
+// chronologically.
+const sqlTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+var sqlTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLLedgerStorage is a LedgerStorage that stores records in a table of an SQL
+// database, accessed with database/sql, so that any database with a driver can
+// be used, e.g. PostgreSQL, MySQL or SQLite. The table has the columns
+//
+//	dataset TEXT, time TEXT, mechanism TEXT, epsilon DOUBLE PRECISION,
+//	delta DOUBLE PRECISION, parameters TEXT
+//
+// where times are stored in UTC with a fixed-width layout, and parameters as a
+// JSON object. CreateTable creates it if needed.
+type SQLLedgerStorage struct {
+	db     *sql.DB
+	table  string
+	dollar bool
+}
+
+// SQLLedgerStorageOptions contains the options necessary to initialize an
+// SQLLedgerStorage.
+type SQLLedgerStorageOptions struct {
+	DB *sql.DB // Database of the table. Required.
+	// Name of the table, made of letters, digits and underscores. Defaults to
+	// "privacy_budget_ledger".
+	Table string
+	// Whether query parameters are written $1, $2, …, as in PostgreSQL,
+	// instead of ?. Defaults to false.
+	DollarPlaceholders bool
+}
+
+// NewSQLLedgerStorage returns a new SQLLedgerStorage.
+func NewSQLLedgerStorage(opt *SQLLedgerStorageOptions) (*SQLLedgerStorage, error) {
+	if opt == nil {
+		opt = &SQLLedgerStorageOptions{}
+	}
+	if opt.DB == nil {
+		return nil, fmt.Errorf("NewSQLLedgerStorage requires a DB")
+	}
+	table := opt.Table
+	if table == "" {
+		table = "privacy_budget_ledger"
+	}
+	// The table name is part of the queries, so it must not allow injections.
+	if !sqlTableName.MatchString(table) {
+		return nil, fmt.Errorf("NewSQLLedgerStorage: Table is %q, must be made of letters, digits and underscores", table)
+	}
+	return &SQLLedgerStorage{db: opt.DB, table: table, dollar: opt.DollarPlaceholders}, nil
+}
+
+// CreateTable creates the table of the records if it doesn't exist.
+func (s *SQLLedgerStorage) CreateTable() error {
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS " + s.table + " (dataset TEXT, time TEXT, mechanism TEXT, epsilon DOUBLE PRECISION, delta DOUBLE PRECISION, parameters TEXT)")
+	return err
+}
+
+// Append inserts r into the table.
+func (s *SQLLedgerStorage) Append(r BudgetRecord) error {
+	parameters, err := json.Marshal(r.Parameters)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO "+s.table+" (dataset, time, mechanism, epsilon, delta, parameters) VALUES ("+s.placeholders(6)+")",
+		r.Dataset, r.Time.UTC().Format(sqlTimeLayout), r.Mechanism, r.Epsilon, r.Delta, string(parameters))
+	return err
+}
+
+// Records returns the records of the given dataset, ordered by time.
+func (s *SQLLedgerStorage) Records(dataset string) ([]BudgetRecord, error) {
+	rows, err := s.db.Query("SELECT time, mechanism, epsilon, delta, parameters FROM "+s.table+" WHERE dataset = "+s.placeholders(1)+" ORDER BY time", dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []BudgetRecord
+	for rows.Next() {
+		r := BudgetRecord{Dataset: dataset}
+		var t, parameters string
+		if err := rows.Scan(&t, &r.Mechanism, &r.Epsilon, &r.Delta, &parameters); err != nil {
+			return nil, err
+		}
+		if r.Time, err = time.Parse(sqlTimeLayout, t); err != nil {
+			return nil, fmt.Errorf("couldn't parse time of record: %w", err)
+		}
+		if err := json.Unmarshal([]byte(parameters), &r.Parameters); err != nil {
+			return nil, fmt.Errorf("couldn't decode parameters of record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// placeholders returns n comma-separated query parameters.
+func (s *SQLLedgerStorage) placeholders(n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = "?"
+		if s.dollar {
+			p[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	return strings.Join(p, ", ")
+}
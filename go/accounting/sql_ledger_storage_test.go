@@ -0,0 +1,194 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package accounting
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeLedgerDriver is a database/sql driver that only understands the queries
+// of SQLLedgerStorage, and keeps the rows of each data source name in memory.
+type fakeLedgerDriver struct {
+	mu      sync.Mutex
+	rows    map[string][][]driver.Value
+	queries []string
+}
+
+var (
+	fakeDriver         = &fakeLedgerDriver{rows: make(map[string][][]driver.Value)}
+	registerFakeDriver sync.Once
+)
+
+func openFakeLedgerDB(t *testing.T) *sql.DB {
+	t.Helper()
+	registerFakeDriver.Do(func() { sql.Register("fakeledger", fakeDriver) })
+	db, err := sql.Open("fakeledger", t.Name())
+	if err != nil {
+		t.Fatalf("sql.Open: got error %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *fakeLedgerDriver) Open(name string) (driver.Conn, error) {
+	return &fakeLedgerConn{d: d, name: name}, nil
+}
+
+type fakeLedgerConn struct {
+	d    *fakeLedgerDriver
+	name string
+}
+
+func (c *fakeLedgerConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	return &fakeLedgerStmt{c: c, query: query}, nil
+}
+
+func (c *fakeLedgerConn) Close() error { return nil }
+func (c *fakeLedgerConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+type fakeLedgerStmt struct {
+	c     *fakeLedgerConn
+	query string
+}
+
+func (s *fakeLedgerStmt) Close() error  { return nil }
+func (s *fakeLedgerStmt) NumInput() int { return -1 }
+
+func (s *fakeLedgerStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT"):
+		d.rows[s.c.name] = append(d.rows[s.c.name], args)
+	default:
+		return nil, errors.New("unsupported query")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeLedgerStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !strings.HasPrefix(s.query, "SELECT") {
+		return nil, errors.New("unsupported query")
+	}
+	// Rows are returned in insertion order, which is chronological in the
+	// tests.
+	var rows [][]driver.Value
+	for _, r := range d.rows[s.c.name] {
+		if r[0] == args[0] {
+			rows = append(rows, r[1:])
+		}
+	}
+	return &fakeLedgerRows{rows: rows}, nil
+}
+
+type fakeLedgerRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeLedgerRows) Columns() []string {
+	return []string{"time", "mechanism", "epsilon", "delta", "parameters"}
+}
+func (r *fakeLedgerRows) Close() error { return nil }
+
+func (r *fakeLedgerRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLLedgerStorage(t *testing.T) {
+	db := openFakeLedgerDB(t)
+	storage, err := NewSQLLedgerStorage(&SQLLedgerStorageOptions{DB: db, DollarPlaceholders: true})
+	if err != nil {
+		t.Fatalf("NewSQLLedgerStorage: got error %v", err)
+	}
+	if err := storage.CreateTable(); err != nil {
+		t.Fatalf("CreateTable: got error %v", err)
+	}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 5, time.FixedZone("CEST", 2*3600))
+	l, err := NewPersistentLedger(&PersistentLedgerOptions{Storage: storage, Epsilon: 1, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("NewPersistentLedger: got error %v", err)
+	}
+	e, _ := LaplaceEvent(0.5)
+	for _, dataset := range []string{"visits", "purchases", "visits"} {
+		if err := l.Spend(dataset, "Count", map[string]string{"Noise": "Laplace"}, e); err != nil {
+			t.Fatalf("Spend on %s: got error %v", dataset, err)
+		}
+	}
+	if err := l.Spend("visits", "Count", nil, e); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Spend beyond the budget: got error %v, want ErrBudgetExceeded", err)
+	}
+	got, err := l.Records("visits")
+	if err != nil {
+		t.Fatalf("Records: got error %v", err)
+	}
+	r := BudgetRecord{Dataset: "visits", Time: now.UTC(), Mechanism: "Count", Epsilon: 0.5, Parameters: map[string]string{"Noise": "Laplace"}}
+	if diff := cmp.Diff([]BudgetRecord{r, r}, got); diff != "" {
+		t.Errorf("Records: got diff (-want +got):\n%s", diff)
+	}
+	var sawInsert bool
+	for _, q := range fakeDriver.queries {
+		if strings.HasPrefix(q, "INSERT INTO privacy_budget_ledger ") {
+			sawInsert = true
+			if !strings.Contains(q, "$6") {
+				t.Errorf("Append with DollarPlaceholders: got query %q, want $ placeholders", q)
+			}
+		}
+	}
+	if !sawInsert {
+		t.Errorf("Append: got no insertion into the default table")
+	}
+}
+
+func TestNewSQLLedgerStorageInvalidOptions(t *testing.T) {
+	db := openFakeLedgerDB(t)
+	for _, tc := range []struct {
+		desc string
+		opt  *SQLLedgerStorageOptions
+	}{
+		{"nil options", nil},
+		{"no DB", &SQLLedgerStorageOptions{Table: "ledger"}},
+		{"invalid Table", &SQLLedgerStorageOptions{DB: db, Table: "ledger; DROP TABLE users"}},
+	} {
+		if _, err := NewSQLLedgerStorage(tc.opt); err == nil {
+			t.Errorf("NewSQLLedgerStorage with %s: got no error, want error", tc.desc)
+		}
+	}
+}
@@ -118,13 +118,37 @@ func CheckLInfSensitivity(lInfSensitivity float64) error {
 	return nil
 }
 
+// CheckL2Sensitivity returns an error if l2Sensitivity is nonpositive or +∞.
+func CheckL2Sensitivity(l2Sensitivity float64) error {
+	if l2Sensitivity <= 0 || math.IsInf(l2Sensitivity, 0) || math.IsNaN(l2Sensitivity) {
+		return fmt.Errorf("L2Sensitivity is %f, must be strictly positive and finite", l2Sensitivity)
+	}
+	return nil
+}
+
+// InvalidBoundsError is the error returned by the checks of clamping bounds, so
+// that callers can tell misconfigured bounds apart from other errors with
+// errors.As. Int64 bounds are converted to float64.
+type InvalidBoundsError struct {
+	Lower, Upper float64
+	msg          string
+}
+
+func invalidBounds(lower, upper float64, format string, a ...any) *InvalidBoundsError {
+	return &InvalidBoundsError{Lower: lower, Upper: upper, msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *InvalidBoundsError) Error() string {
+	return e.msg
+}
+
 // CheckBoundsInt64 returns an error if lower is larger than upper, and ensures it won't lead to sensitivity overflow.
 func CheckBoundsInt64(lower, upper int64) error {
 	if lower == math.MinInt64 || upper == math.MinInt64 {
-		return fmt.Errorf("Lower bound (%d) and upper bound (%d) must be strictly larger than MinInt64=%d to avoid sensitivity overflow", lower, upper, math.MinInt64)
+		return invalidBounds(float64(lower), float64(upper), "Lower bound (%d) and upper bound (%d) must be strictly larger than MinInt64=%d to avoid sensitivity overflow", lower, upper, math.MinInt64)
 	}
 	if lower > upper {
-		return fmt.Errorf("Upper bound (%d) must be larger than lower bound (%d)", upper, lower)
+		return invalidBounds(float64(lower), float64(upper), "Upper bound (%d) must be larger than lower bound (%d)", upper, lower)
 	}
 	if lower == upper {
 		log.Warningf("Lower bound is equal to upper bound: all added elements will be clamped to %d", upper)
@@ -136,7 +160,7 @@ func CheckBoundsInt64(lower, upper int64) error {
 // This is used when noise is unrecognised.
 func CheckBoundsInt64IgnoreOverflows(lower, upper int64) error {
 	if lower > upper {
-		return fmt.Errorf("Upper bound (%d) must be larger than lower bound (%d)", upper, lower)
+		return invalidBounds(float64(lower), float64(upper), "Upper bound (%d) must be larger than lower bound (%d)", upper, lower)
 	}
 	if lower == upper {
 		log.Warningf("Lower bound is equal to upper bound: all added elements will be clamped to %d", upper)
@@ -147,19 +171,19 @@ func CheckBoundsInt64IgnoreOverflows(lower, upper int64) error {
 // CheckBoundsFloat64 returns an error if lower is larger than upper, or if either parameter is ±∞.
 func CheckBoundsFloat64(lower, upper float64) error {
 	if math.IsNaN(lower) {
-		return fmt.Errorf("Lower bound cannot be NaN")
+		return invalidBounds(lower, upper, "Lower bound cannot be NaN")
 	}
 	if math.IsNaN(upper) {
-		return fmt.Errorf("Upper bound cannot be NaN")
+		return invalidBounds(lower, upper, "Upper bound cannot be NaN")
 	}
 	if math.IsInf(lower, 0) {
-		return fmt.Errorf("Lower bound cannot be infinity")
+		return invalidBounds(lower, upper, "Lower bound cannot be infinity")
 	}
 	if math.IsInf(upper, 0) {
-		return fmt.Errorf("Upper bound cannot be infinity")
+		return invalidBounds(lower, upper, "Upper bound cannot be infinity")
 	}
 	if lower > upper {
-		return fmt.Errorf("Upper bound (%f) must be larger than lower bound (%f)", upper, lower)
+		return invalidBounds(lower, upper, "Upper bound (%f) must be larger than lower bound (%f)", upper, lower)
 	}
 	if lower == upper {
 		log.Warningf("Lower bound is equal to upper bound: all added elements will be clamped to %f", upper)
@@ -170,13 +194,13 @@ func CheckBoundsFloat64(lower, upper float64) error {
 // CheckBoundsFloat64IgnoreOverflows returns an error if lower is larger than upper but accepts either parameter being ±∞.
 func CheckBoundsFloat64IgnoreOverflows(lower, upper float64) error {
 	if math.IsNaN(lower) {
-		return fmt.Errorf("Lower bound cannot be NaN")
+		return invalidBounds(lower, upper, "Lower bound cannot be NaN")
 	}
 	if math.IsNaN(upper) {
-		return fmt.Errorf("Upper bound cannot be NaN")
+		return invalidBounds(lower, upper, "Upper bound cannot be NaN")
 	}
 	if lower > upper {
-		return fmt.Errorf("Upper bound (%f) must be larger than lower bound(%f)", upper, lower)
+		return invalidBounds(lower, upper, "Upper bound (%f) must be larger than lower bound(%f)", upper, lower)
 	}
 	if lower == upper {
 		log.Warningf("Lower bound is equal to upper bound: all added elements will be clamped to %f", upper)
@@ -187,18 +211,18 @@ func CheckBoundsFloat64IgnoreOverflows(lower, upper float64) error {
 // CheckBoundsFloat64AsInt64 returns an error if lower is larger are NaN, or if either parameter overflow after conversion to int64.
 func CheckBoundsFloat64AsInt64(lower, upper float64) error {
 	if math.IsNaN(lower) {
-		return fmt.Errorf("Lower bound cannot be NaN")
+		return invalidBounds(lower, upper, "Lower bound cannot be NaN")
 	}
 	if math.IsNaN(upper) {
-		return fmt.Errorf("Upper bound cannot be NaN")
+		return invalidBounds(lower, upper, "Upper bound cannot be NaN")
 	}
 	maxInt := float64(math.MaxInt64)
 	minInt := float64(math.MinInt64)
 	if lower < minInt || lower > maxInt {
-		return fmt.Errorf("Lower bound (%f) must be within [MinInt64=%f, MaxInt64=%f]", lower, minInt, maxInt)
+		return invalidBounds(lower, upper, "Lower bound (%f) must be within [MinInt64=%f, MaxInt64=%f]", lower, minInt, maxInt)
 	}
 	if upper < minInt || upper > maxInt {
-		return fmt.Errorf("Upper bound (%f) must be within [MinInt64=%f, MaxInt64=%f]", upper, minInt, maxInt)
+		return invalidBounds(lower, upper, "Upper bound (%f) must be within [MinInt64=%f, MaxInt64=%f]", upper, minInt, maxInt)
 	}
 	return CheckBoundsInt64(int64(lower), int64(upper))
 }
@@ -219,10 +243,19 @@ func CheckAlpha(alpha float64) error {
 	return nil
 }
 
+// CheckBoundsNotDefault returns an error if lower and upper bounds are both 0,
+// i.e. if they were left unset.
+func CheckBoundsNotDefault(lower, upper float64) error {
+	if lower == 0 && upper == 0 {
+		return invalidBounds(lower, upper, "Lower and upper bounds are both 0: they must be set, automatic bounds determination is not implemented yet")
+	}
+	return nil
+}
+
 // CheckBoundsNotEqual returns an error if lower and upper bounds are equal.
 func CheckBoundsNotEqual(lower, upper float64) error {
 	if lower == upper {
-		return fmt.Errorf("Lower and upper bounds are both %f, they cannot be equal to each other", lower)
+		return invalidBounds(lower, upper, "Lower and upper bounds are both %f, they cannot be equal to each other", lower)
 	}
 	return nil
 }
@@ -17,6 +17,7 @@
 package checks
 
 import (
+	"errors"
 	"math"
 	"testing"
 )
@@ -287,6 +288,34 @@ func TestCheckLInfSensitivity(t *testing.T) {
 	}
 }
 
+func TestCheckL2Sensitivity(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		l2Sensitivity float64
+		wantErr       bool
+	}{
+		{"negative l2 sensitivity",
+			-2,
+			true},
+		{"zero l2 sensitivity",
+			0,
+			true},
+		{"l2 sensitivity is infinity",
+			math.Inf(1),
+			true},
+		{"l2 sensitivity is NaN",
+			math.NaN(),
+			true},
+		{"l2 sensitivity == 10",
+			10,
+			false},
+	} {
+		if err := CheckL2Sensitivity(tc.l2Sensitivity); (err != nil) != tc.wantErr {
+			t.Errorf("CheckL2Sensitivity: when %s for err got %v, want %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
 func TestCheckBoundsInt64(t *testing.T) {
 	for _, tc := range []struct {
 		desc         string
@@ -529,6 +558,44 @@ func TestCheckBoundsNotEqual(t *testing.T) {
 	}
 }
 
+func TestCheckBoundsNotDefault(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		lower   float64
+		upper   float64
+		wantErr bool
+	}{
+		{"both bounds are 0", 0, 0, true},
+		{"lower bound is 0", 0, 1, false},
+		{"upper bound is 0", -1, 0, false},
+	} {
+		if err := CheckBoundsNotDefault(tc.lower, tc.upper); (err != nil) != tc.wantErr {
+			t.Errorf("CheckBoundsNotDefault: when %s for err got %v, want %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestInvalidBoundsError(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		err  error
+	}{
+		{"CheckBoundsInt64", CheckBoundsInt64(5, 1)},
+		{"CheckBoundsFloat64", CheckBoundsFloat64(5, 1)},
+		{"CheckBoundsFloat64AsInt64", CheckBoundsFloat64AsInt64(5, 1)},
+		{"CheckBoundsNotEqual", CheckBoundsNotEqual(5, 5)},
+	} {
+		var boundsErr *InvalidBoundsError
+		if !errors.As(tc.err, &boundsErr) {
+			t.Errorf("%s: got error %v, want an InvalidBoundsError", tc.desc, tc.err)
+			continue
+		}
+		if boundsErr.Lower != 5 {
+			t.Errorf("%s: got Lower = %f, want 5", tc.desc, boundsErr.Lower)
+		}
+	}
+}
+
 func TestCheckTreeHeight(t *testing.T) {
 	for _, tc := range []struct {
 		desc       string
@@ -0,0 +1,300 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// config contains the parameters of a differentially private aggregation of a
+// table, see the flags in main.go.
+type config struct {
+	Aggregation     string // "count", "sum", "mean" or "quantiles".
+	KeyColumn       string // Column to group by, or "" to aggregate the whole table.
+	ValueColumn     string // Column of the aggregated values, not needed for counts.
+	PrivacyIDColumn string // Column identifying the privacy units.
+	// Lower and Upper bounds of the values, not needed for counts.
+	Lower, Upper float64
+	// Total privacy budget, split between partition selection and the
+	// aggregation if PublicPartitions is nil.
+	Epsilon, Delta               float64
+	MaxPartitionsContributed     int64
+	MaxContributionsPerPartition int64
+	// Keys to release without partition selection, or nil.
+	PublicPartitions []string
+	Ranks            []float64   // Ranks of the quantiles.
+	Noise            noise.Noise // Required.
+}
+
+// unitValues holds the values of the kept contributions of each privacy unit
+// to a key. Contribution bounding is done by KeyedAggregation; the values are
+// then aggregated per privacy unit for counts and sums, which assume a single
+// contribution per privacy unit.
+type unitValues map[string][]float64
+
+// rowReader reads a table row by row, starting with the names of its columns,
+// and returns io.EOF after the last row. It is implemented by csv.Reader and
+// parquetReader.
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// run reads the table from r, computes the aggregation per key and writes one
+// CSV row per released key to out, sorted by key.
+func run(cfg *config, r rowReader, out io.Writer) error {
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("couldn't read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	column := func(flag, name string) (int, error) {
+		i, ok := columns[name]
+		if !ok {
+			return 0, fmt.Errorf("%s %q is not a column of the input", flag, name)
+		}
+		return i, nil
+	}
+	idCol, err := column("privacy_id_column", cfg.PrivacyIDColumn)
+	if err != nil {
+		return err
+	}
+	keyCol, valueCol := -1, -1
+	if cfg.KeyColumn != "" {
+		if keyCol, err = column("key_column", cfg.KeyColumn); err != nil {
+			return err
+		}
+	}
+	if cfg.Aggregation != "count" {
+		if valueCol, err = column("value_column", cfg.ValueColumn); err != nil {
+			return err
+		}
+	}
+
+	release, resultHeader, err := newRelease(cfg)
+	if err != nil {
+		return err
+	}
+	publicPartitions := cfg.PublicPartitions
+	selectionEpsilon, selectionDelta := cfg.Epsilon/2, cfg.Delta/2
+	if !noise.NeedsDelta(noise.ToKind(cfg.Noise)) {
+		// Only partition selection needs δ with Laplace noise.
+		selectionDelta = cfg.Delta
+	}
+	if cfg.KeyColumn == "" {
+		// The whole table is a single public partition.
+		publicPartitions = []string{""}
+	}
+	if publicPartitions != nil {
+		selectionEpsilon, selectionDelta = 0, 0
+	}
+	ka, err := dpagg.NewKeyedAggregation(&dpagg.KeyedAggregationOptions[string, unitValues]{
+		New:                          func() (unitValues, error) { return make(unitValues), nil },
+		Epsilon:                      selectionEpsilon,
+		Delta:                        selectionDelta,
+		PublicPartitions:             publicPartitions,
+		MaxPartitionsContributed:     cfg.MaxPartitionsContributed,
+		MaxContributionsPerPartition: cfg.MaxContributionsPerPartition,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't initialize aggregation: %w", err)
+	}
+
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read row %d: %w", row, err)
+		}
+		id, key, value := record[idCol], "", 1.0
+		if keyCol >= 0 {
+			key = record[keyCol]
+		}
+		if valueCol >= 0 {
+			if value, err = strconv.ParseFloat(record[valueCol], 64); err != nil {
+				return fmt.Errorf("row %d: couldn't parse value %q: %w", row, record[valueCol], err)
+			}
+		}
+		err = ka.AddValue(id, key, value, func(u unitValues) error {
+			u[id] = append(u[id], value)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+	}
+
+	results, err := ka.SortedResult()
+	if err != nil {
+		return fmt.Errorf("couldn't compute result: %w", err)
+	}
+	w := csv.NewWriter(out)
+	header = append([]string{cfg.KeyColumn}, resultHeader...)
+	if cfg.KeyColumn == "" {
+		header = resultHeader
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, res := range results {
+		row, err := release(res.Aggregation, cfg.Epsilon-selectionEpsilon, cfg.Delta-selectionDelta)
+		if err != nil {
+			return fmt.Errorf("couldn't compute result for key %q: %w", res.Key, err)
+		}
+		if cfg.KeyColumn != "" {
+			row = append([]string{res.Key}, row...)
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// newRelease returns the function computing the differentially private result
+// of the aggregation of a key with the given budget, and the header of its
+// columns.
+func newRelease(cfg *config) (func(u unitValues, epsilon, delta float64) ([]string, error), []string, error) {
+	l0, lInf := cfg.MaxPartitionsContributed, cfg.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	switch cfg.Aggregation {
+	case "count":
+		// Each privacy unit adds the number of its contributions, at most lInf.
+		return func(u unitValues, epsilon, delta float64) ([]string, error) {
+			bs, err := dpagg.NewBoundedSumInt64(&dpagg.BoundedSumInt64Options{
+				Epsilon: epsilon, Delta: delta, MaxPartitionsContributed: l0, Lower: 0, Upper: lInf, Noise: cfg.Noise,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, values := range u {
+				if err := bs.Add(int64(len(values))); err != nil {
+					return nil, err
+				}
+			}
+			result, err := bs.Result()
+			if err != nil {
+				return nil, err
+			}
+			return []string{strconv.FormatInt(result, 10)}, nil
+		}, []string{"count"}, nil
+	case "sum":
+		// Each privacy unit adds the sum of its clamped values, in
+		// [lInf·min(0, Lower), lInf·max(0, Upper)].
+		lower, upper := float64(lInf)*math.Min(0, cfg.Lower), float64(lInf)*math.Max(0, cfg.Upper)
+		return func(u unitValues, epsilon, delta float64) ([]string, error) {
+			bs, err := dpagg.NewBoundedSumFloat64(&dpagg.BoundedSumFloat64Options{
+				Epsilon: epsilon, Delta: delta, MaxPartitionsContributed: l0, Lower: lower, Upper: upper, Noise: cfg.Noise,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, values := range u {
+				var sum float64
+				for _, v := range values {
+					clamped, err := dpagg.ClampFloat64(v, cfg.Lower, cfg.Upper)
+					if err != nil {
+						return nil, err
+					}
+					sum += clamped
+				}
+				if err := bs.Add(sum); err != nil {
+					return nil, err
+				}
+			}
+			result, err := bs.Result()
+			if err != nil {
+				return nil, err
+			}
+			return []string{formatFloat(result)}, nil
+		}, []string{"sum"}, nil
+	case "mean":
+		return func(u unitValues, epsilon, delta float64) ([]string, error) {
+			bm, err := dpagg.NewBoundedMeanFloat64(&dpagg.BoundedMeanFloat64Options{
+				Epsilon: epsilon, Delta: delta, MaxPartitionsContributed: l0, MaxContributionsPerPartition: lInf,
+				Lower: cfg.Lower, Upper: cfg.Upper, Noise: cfg.Noise,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, values := range u {
+				for _, v := range values {
+					if err := bm.Add(v); err != nil {
+						return nil, err
+					}
+				}
+			}
+			result, err := bm.Result()
+			if err != nil {
+				return nil, err
+			}
+			return []string{formatFloat(result)}, nil
+		}, []string{"mean"}, nil
+	case "quantiles":
+		if len(cfg.Ranks) == 0 {
+			return nil, nil, fmt.Errorf("quantiles require at least one rank")
+		}
+		header := make([]string, len(cfg.Ranks))
+		for i, rank := range cfg.Ranks {
+			header[i] = "quantile_" + formatFloat(rank)
+		}
+		return func(u unitValues, epsilon, delta float64) ([]string, error) {
+			bq, err := dpagg.NewBoundedQuantiles(&dpagg.BoundedQuantilesOptions{
+				Epsilon: epsilon, Delta: delta, MaxPartitionsContributed: l0, MaxContributionsPerPartition: lInf,
+				Lower: cfg.Lower, Upper: cfg.Upper, Noise: cfg.Noise,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, values := range u {
+				for _, v := range values {
+					if err := bq.Add(v); err != nil {
+						return nil, err
+					}
+				}
+			}
+			row := make([]string, len(cfg.Ranks))
+			for i, rank := range cfg.Ranks {
+				result, err := bq.Result(rank)
+				if err != nil {
+					return nil, err
+				}
+				row[i] = formatFloat(result)
+			}
+			return row, nil
+		}, header, nil
+	}
+	return nil, nil, fmt.Errorf("unknown aggregation %q, must be count, sum, mean or quantiles", cfg.Aggregation)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
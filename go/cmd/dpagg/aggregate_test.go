@@ -0,0 +1,160 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// visits has 3 visitors on Monday, 2 of which visit twice, and 1 visitor on
+// Tuesday.
+const visits = `visitor,day,spent
+a,mon,10
+a,mon,30
+b,mon,20
+b,mon,100
+c,mon,5
+d,tue,7
+`
+
+// runTable runs cfg on table and returns the rows of the result, without the
+// header.
+func runTable(t *testing.T, cfg *config, table string) [][]string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run(cfg, csv.NewReader(strings.NewReader(table)), &out); err != nil {
+		t.Fatalf("run(%+v): got error %v", cfg, err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("couldn't read output of run(%+v): %v", cfg, err)
+	}
+	return rows[1:]
+}
+
+func TestRun(t *testing.T) {
+	// With a very large budget, the noise is negligible.
+	for _, tc := range []struct {
+		aggregation string
+		lInf        int64
+		want        []float64 // for mon and tue
+	}{
+		{"count", 1, []float64{3, 1}},
+		{"count", 2, []float64{5, 1}},
+		// Each visitor contributes at most 2 values clamped to [0, 50].
+		{"sum", 2, []float64{115, 7}},
+		{"mean", 2, []float64{23, 7}},
+		{"quantiles", 2, []float64{20, 7}},
+	} {
+		cfg := &config{
+			Aggregation:                  tc.aggregation,
+			KeyColumn:                    "day",
+			ValueColumn:                  "spent",
+			PrivacyIDColumn:              "visitor",
+			Lower:                        0,
+			Upper:                        50,
+			Epsilon:                      1e9,
+			PublicPartitions:             []string{"mon", "tue"},
+			MaxPartitionsContributed:     1,
+			MaxContributionsPerPartition: tc.lInf,
+			Ranks:                        []float64{0.5},
+			Noise:                        noise.Laplace(),
+		}
+		rows := runTable(t, cfg, visits)
+		if len(rows) != 2 {
+			t.Fatalf("run with %s: got %d rows, want 2", tc.aggregation, len(rows))
+		}
+		for i, key := range []string{"mon", "tue"} {
+			if rows[i][0] != key {
+				t.Errorf("run with %s: got key %q in row %d, want %q", tc.aggregation, rows[i][0], i, key)
+			}
+			got, err := strconv.ParseFloat(rows[i][1], 64)
+			if err != nil {
+				t.Fatalf("run with %s: couldn't parse result %q: %v", tc.aggregation, rows[i][1], err)
+			}
+			// Quantiles are only precise up to the size of the leaves of the tree.
+			if math.Abs(got-tc.want[i]) > 1 {
+				t.Errorf("run with %s and MaxContributionsPerPartition=%d: got %f for %s, want %f", tc.aggregation, tc.lInf, got, key, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestRunPartitionSelection(t *testing.T) {
+	// Monday has enough visitors to be kept, Tuesday doesn't.
+	var table strings.Builder
+	table.WriteString("visitor,day\n")
+	for i := 0; i < 100; i++ {
+		table.WriteString(strconv.Itoa(i) + ",mon\n")
+	}
+	table.WriteString("x,tue\n")
+	cfg := &config{
+		Aggregation:              "count",
+		KeyColumn:                "day",
+		PrivacyIDColumn:          "visitor",
+		Epsilon:                  10,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+		Noise:                    noise.Laplace(),
+	}
+	rows := runTable(t, cfg, table.String())
+	if len(rows) != 1 || rows[0][0] != "mon" {
+		t.Errorf("run with partition selection: got rows %v, want only mon", rows)
+	}
+}
+
+func TestRunWholeTable(t *testing.T) {
+	cfg := &config{
+		Aggregation:              "count",
+		PrivacyIDColumn:          "visitor",
+		Epsilon:                  1e9,
+		MaxPartitionsContributed: 1,
+		Noise:                    noise.Laplace(),
+	}
+	rows := runTable(t, cfg, visits)
+	if len(rows) != 1 || len(rows[0]) != 1 || rows[0][0] != "4" {
+		t.Errorf("run without key column: got rows %v, want [[4]]", rows)
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		cfg   config
+		table string
+	}{
+		{"unknown aggregation", config{Aggregation: "median", PrivacyIDColumn: "visitor", ValueColumn: "spent"}, visits},
+		{"unknown privacy ID column", config{Aggregation: "count", PrivacyIDColumn: "user"}, visits},
+		{"unknown value column", config{Aggregation: "sum", PrivacyIDColumn: "visitor", ValueColumn: "price"}, visits},
+		{"invalid value", config{Aggregation: "sum", PrivacyIDColumn: "visitor", ValueColumn: "spent", Lower: 0, Upper: 1}, "visitor,spent\na,ten\n"},
+		{"quantiles without ranks", config{Aggregation: "quantiles", PrivacyIDColumn: "visitor", ValueColumn: "spent"}, visits},
+	} {
+		tc.cfg.Epsilon = 1
+		tc.cfg.MaxPartitionsContributed = 1
+		tc.cfg.Noise = noise.Laplace()
+		if err := run(&tc.cfg, csv.NewReader(strings.NewReader(tc.table)), new(bytes.Buffer)); err == nil {
+			t.Errorf("run with %s: got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// dpagg is a command line tool computing differentially private counts, sums,
+// means or quantiles per key of a CSV or Parquet table, e.g.
+//
+//	go run ./cmd/dpagg --input_file=visits.csv --privacy_id_column=visitor_id \
+//	  --key_column=day --aggregation=sum --value_column=spent --lower=0 --upper=50 \
+//	  --epsilon=1 --delta=1e-5 --max_partitions_contributed=3
+//
+// Input files whose name ends with .parquet are read as Parquet tables, and
+// other input as CSV tables, whose first row must contain the names of the
+// columns. Values of Parquet columns are converted as they would be written in
+// a CSV table, and null values are read as empty strings. The result
+// is written as a CSV table with one row per released key, sorted by key. Keys
+// are released by differentially private partition selection, unless they are
+// passed with --public_partitions, and the budget is then split equally between
+// partition selection and the aggregation. Without --key_column, the whole
+// table is aggregated.
+//
+// dpagg is a separate Go module, so that the library doesn't depend on Apache
+// Arrow, which is needed to read Parquet tables.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+var (
+	inputFile       = flag.String("input_file", "", "Input CSV or Parquet file. Files ending with .parquet are read as Parquet. Defaults to CSV from the standard input.")
+	outputFile      = flag.String("output_file", "", "Output CSV file. Defaults to the standard output.")
+	aggregation     = flag.String("aggregation", "count", "Aggregation to compute: count, sum, mean or quantiles.")
+	keyColumn       = flag.String("key_column", "", "Column to group by. Defaults to aggregating the whole table.")
+	valueColumn     = flag.String("value_column", "", "Column of the aggregated values. Not needed for counts.")
+	privacyIDColumn = flag.String("privacy_id_column", "", "Column identifying the privacy units, e.g. users. Required.")
+	lower           = flag.Float64("lower", 0, "Lower bound of the values. Not needed for counts.")
+	upper           = flag.Float64("upper", 0, "Upper bound of the values. Not needed for counts.")
+	epsilon         = flag.Float64("epsilon", 0, "Privacy parameter ε. Required.")
+	delta           = flag.Float64("delta", 0, "Privacy parameter δ. Required for partition selection and with Gaussian noise.")
+	maxPartitions   = flag.Int64("max_partitions_contributed", 1, "How many distinct keys may a single privacy unit contribute to?")
+	maxContribs     = flag.Int64("max_contributions_per_partition", 1, "How many times may a single privacy unit contribute to a single key?")
+	publicKeys      = flag.String("public_partitions", "", "Comma-separated keys to release without partition selection.")
+	ranks           = flag.String("ranks", "0.5", "Comma-separated ranks of the quantiles.")
+	noiseKind       = flag.String("noise", "laplace", "Noise: laplace or gaussian.")
+)
+
+func main() {
+	flag.Parse()
+
+	cfg := &config{
+		Aggregation:                  *aggregation,
+		KeyColumn:                    *keyColumn,
+		ValueColumn:                  *valueColumn,
+		PrivacyIDColumn:              *privacyIDColumn,
+		Lower:                        *lower,
+		Upper:                        *upper,
+		Epsilon:                      *epsilon,
+		Delta:                        *delta,
+		MaxPartitionsContributed:     *maxPartitions,
+		MaxContributionsPerPartition: *maxContribs,
+	}
+	if *privacyIDColumn == "" {
+		log.Exit("No privacy ID column was chosen")
+	}
+	switch *noiseKind {
+	case "laplace":
+		cfg.Noise = noise.Laplace()
+	case "gaussian":
+		cfg.Noise = noise.Gaussian()
+	default:
+		log.Exitf("Unknown noise %q, must be laplace or gaussian", *noiseKind)
+	}
+	if *publicKeys != "" {
+		cfg.PublicPartitions = strings.Split(*publicKeys, ",")
+	}
+	if *aggregation == "quantiles" {
+		for _, s := range strings.Split(*ranks, ",") {
+			rank, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				log.Exitf("Couldn't parse rank %q: %v", s, err)
+			}
+			cfg.Ranks = append(cfg.Ranks, rank)
+		}
+	}
+
+	var in rowReader = csv.NewReader(os.Stdin)
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			log.Exitf("Couldn't open input file: %v", err)
+		}
+		defer f.Close()
+		in = csv.NewReader(f)
+		if strings.HasSuffix(strings.ToLower(*inputFile), ".parquet") {
+			pr, err := newParquetReader(f)
+			if err != nil {
+				log.Exitf("Couldn't read input file: %v", err)
+			}
+			defer pr.Close()
+			in = pr
+		}
+	}
+	var out io.Writer = os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			log.Exitf("Couldn't create output file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := run(cfg, in, out); err != nil {
+		log.Exitf("Couldn't compute aggregation: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/file"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+)
+
+// parquetBatchSize is the number of rows read from a Parquet table at once.
+const parquetBatchSize = 1 << 16
+
+// parquetReader reads a Parquet table row by row, see rowReader. The values
+// are formatted as strings, like in a CSV table, and null values are read as
+// empty strings.
+type parquetReader struct {
+	pf      *file.Reader
+	records pqarrow.RecordReader
+	header  []string
+	started bool // whether the header was read
+
+	// Current record batch, nil before the first one. It is owned by records,
+	// which releases it when reading the next one.
+	record arrow.Record
+	row    int // next row of record
+}
+
+// newParquetReader returns a reader of the Parquet table in r.
+func newParquetReader(r parquet.ReaderAtSeeker) (*parquetReader, error) {
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open Parquet file: %w", err)
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: parquetBatchSize}, memory.DefaultAllocator)
+	if err != nil {
+		pf.Close()
+		return nil, fmt.Errorf("couldn't read Parquet schema: %w", err)
+	}
+	records, err := fr.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		pf.Close()
+		return nil, fmt.Errorf("couldn't read Parquet table: %w", err)
+	}
+	var header []string
+	for _, field := range records.Schema().Fields() {
+		header = append(header, field.Name)
+	}
+	return &parquetReader{pf: pf, records: records, header: header}, nil
+}
+
+// Read returns the names of the columns on the first call, and the next row
+// of the table on the following ones, or io.EOF after the last row.
+func (r *parquetReader) Read() ([]string, error) {
+	if !r.started {
+		r.started = true
+		return r.header, nil
+	}
+	for r.record == nil || r.row == int(r.record.NumRows()) {
+		record, err := r.records.Read()
+		if err != nil {
+			// io.EOF after the last record batch.
+			return nil, err
+		}
+		r.record, r.row = record, 0
+	}
+	row := make([]string, r.record.NumCols())
+	for i, col := range r.record.Columns() {
+		if !col.IsNull(r.row) {
+			row[i] = col.ValueStr(r.row)
+		}
+	}
+	r.row++
+	return row, nil
+}
+
+// Close releases the resources held by r.
+func (r *parquetReader) Close() error {
+	r.records.Release()
+	return r.pf.Close()
+}
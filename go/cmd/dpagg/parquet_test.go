@@ -0,0 +1,159 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeVisitsParquet returns the visits table as a Parquet file, whose spent
+// column is an integer column. If nullSpent is set, the spent value of the
+// last row is null.
+func writeVisitsParquet(t *testing.T, nullSpent bool) []byte {
+	t.Helper()
+	rows, err := csv.NewReader(strings.NewReader(visits)).ReadAll()
+	if err != nil {
+		t.Fatalf("Couldn't read visits: %v", err)
+	}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "visitor", Type: arrow.BinaryTypes.String},
+		{Name: "day", Type: arrow.BinaryTypes.String},
+		{Name: "spent", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for i, row := range rows[1:] {
+		b.Field(0).(*array.StringBuilder).Append(row[0])
+		b.Field(1).(*array.StringBuilder).Append(row[1])
+		if nullSpent && i == len(rows)-2 {
+			b.Field(2).AppendNull()
+			continue
+		}
+		if err := b.Field(2).AppendValueFromString(row[2]); err != nil {
+			t.Fatalf("Couldn't append %q: %v", row[2], err)
+		}
+	}
+	record := b.NewRecord()
+	defer record.Release()
+	table := array.NewTableFromRecords(schema, []arrow.Record{record})
+	defer table.Release()
+	var buf bytes.Buffer
+	if err := pqarrow.WriteTable(table, &buf, 2, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps()); err != nil {
+		t.Fatalf("Couldn't write Parquet table: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetReader(t *testing.T) {
+	r, err := newParquetReader(bytes.NewReader(writeVisitsParquet(t, true)))
+	if err != nil {
+		t.Fatalf("newParquetReader: got error %v", err)
+	}
+	defer r.Close()
+	var got [][]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: got error %v", err)
+		}
+		got = append(got, row)
+	}
+	want, err := csv.NewReader(strings.NewReader(visits)).ReadAll()
+	if err != nil {
+		t.Fatalf("Couldn't read visits: %v", err)
+	}
+	// The null value is read as an empty string.
+	want[len(want)-1][2] = ""
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Read: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunParquet(t *testing.T) {
+	cfg := &config{
+		Aggregation:                  "sum",
+		KeyColumn:                    "day",
+		ValueColumn:                  "spent",
+		PrivacyIDColumn:              "visitor",
+		Lower:                        0,
+		Upper:                        50,
+		Epsilon:                      1e9,
+		PublicPartitions:             []string{"mon", "tue"},
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 2,
+		Noise:                        noise.Laplace(),
+	}
+	var out bytes.Buffer
+	r, err := newParquetReader(bytes.NewReader(writeVisitsParquet(t, false)))
+	if err != nil {
+		t.Fatalf("newParquetReader: got error %v", err)
+	}
+	defer r.Close()
+	if err := run(cfg, r, &out); err != nil {
+		t.Fatalf("run: got error %v", err)
+	}
+	// The results of the CSV and the Parquet tables are equal with negligible
+	// noise, see TestRun.
+	want := runTable(t, cfg, visits)
+	got, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Couldn't read output of run: %v", err)
+	}
+	if len(got) != len(want)+1 {
+		t.Fatalf("run: got %d rows, want %d", len(got)-1, len(want))
+	}
+	for i, row := range got[1:] {
+		gotSum, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			t.Fatalf("run: couldn't parse result %q: %v", row[1], err)
+		}
+		wantSum, err := strconv.ParseFloat(want[i][1], 64)
+		if err != nil {
+			t.Fatalf("run: couldn't parse result %q: %v", want[i][1], err)
+		}
+		if row[0] != want[i][0] || math.Abs(gotSum-wantSum) > 1 {
+			t.Errorf("run: got row %v, want %v", row, want[i])
+		}
+	}
+
+	// A null value can't be aggregated.
+	r, err = newParquetReader(bytes.NewReader(writeVisitsParquet(t, true)))
+	if err != nil {
+		t.Fatalf("newParquetReader: got error %v", err)
+	}
+	defer r.Close()
+	if err := run(cfg, r, new(bytes.Buffer)); err == nil {
+		t.Errorf("run with a null value: got no error, want error")
+	}
+}
@@ -16,32 +16,58 @@
 
 package dpagg
 
-type aggregationState int
+// AggregationState is the lifecycle state of an aggregation. A new aggregation
+// is in StateDefault, where it can be amended, merged, serialized and queried.
+// Merging an aggregation into another one moves it to StateMerged, serializing
+// it moves it to StateSerialized, in which it can only be serialized again, and
+// computing its result moves it to StateResultReturned.
+//
+// The state describes the local object only and is never serialized: an
+// aggregation decoded from a serialized one, e.g. on another worker, is in
+// StateDefault, so that it can be merged with other aggregations.
+type AggregationState int
+
+// aggregationState is the name of AggregationState within this package.
+type aggregationState = AggregationState
+
+// The states of an aggregation.
+const (
+	StateDefault AggregationState = iota
+	StateMerged
+	StateSerialized
+	StateResultReturned
+)
 
-var errorMessages = map[int]string{
+const (
+	defaultState   = StateDefault
+	merged         = StateMerged
+	serialized     = StateSerialized
+	resultReturned = StateResultReturned
+)
+
+var errorMessages = map[AggregationState]string{
 	defaultState:   "",
 	merged:         "Object has been already merged",
 	serialized:     "Object has been already serialized",
 	resultReturned: "DP result was already computed and returned.",
 }
-var stateName = map[int]string{
+var stateName = map[AggregationState]string{
 	defaultState:   "Default",
 	merged:         "Merged",
 	serialized:     "Serialized",
 	resultReturned: "ResultReturned",
 }
 
-const (
-	defaultState = iota
-	merged
-	serialized
-	resultReturned
-)
+func (s AggregationState) errorMessage() string {
+	return errorMessages[s]
+}
 
-func (s aggregationState) errorMessage() string {
-	return errorMessages[int(s)]
+// transitionError returns the error of an operation that would move an
+// aggregation in state s to state to, which isn't allowed.
+func (s AggregationState) transitionError(to AggregationState) error {
+	return &StateTransitionError{From: s, To: to}
 }
 
-func (s aggregationState) String() string {
-	return stateName[int(s)]
+func (s AggregationState) String() string {
+	return stateName[s]
 }
@@ -0,0 +1,124 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package arrowtest checks that the arrays of Apache Arrow can be aggregated
+// with dpagg.ColumnBounder, and take its fast path. It is a separate module so
+// that dpagg doesn't depend on Arrow.
+package arrowtest
+
+import (
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// The arrays of float64 and int64 values are read in bulk by ColumnBounder.
+var (
+	_ dpagg.Column[string]      = (*array.String)(nil)
+	_ dpagg.Float64ValuesColumn = (*array.Float64)(nil)
+	_ dpagg.Int64ValuesColumn   = (*array.Int64)(nil)
+)
+
+// noNoise adds no noise, so that results can be checked exactly. The other
+// methods of noise.Noise aren't used by the tests.
+type noNoise struct {
+	noise.Noise
+}
+
+func (noNoise) AddNoiseFloat64(x float64, _ int64, _, _, _ float64) (float64, error) {
+	return x, nil
+}
+
+func (noNoise) AddNoiseInt64(x, _, _ int64, _, _ float64) (int64, error) {
+	return x, nil
+}
+
+func newIDs(t *testing.T, ids []string, valid []bool) *array.String {
+	t.Helper()
+	b := array.NewStringBuilder(memory.DefaultAllocator)
+	defer b.Release()
+	b.AppendValues(ids, valid)
+	return b.NewStringArray()
+}
+
+func TestColumnBounderFloat64Array(t *testing.T) {
+	ids := newIDs(t, []string{"a", "b", "c", "", "a"}, []bool{true, true, true, false, true})
+	defer ids.Release()
+	b := array.NewFloat64Builder(memory.DefaultAllocator)
+	defer b.Release()
+	// The value of c is null, as is the ID of the fourth row.
+	b.AppendValues([]float64{1, 2, 100, 100, 3}, []bool{true, true, false, true, true})
+	values := b.NewFloat64Array()
+	defer values.Release()
+
+	cb, err := dpagg.NewColumnBounder[string, float64](&dpagg.ColumnBounderOptions{MaxContributionsPerPartition: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ColumnBounder: %v", err)
+	}
+	if err := cb.AddColumns(ids, values); err != nil {
+		t.Fatalf("AddColumns: got error %v", err)
+	}
+	bs, err := dpagg.NewBoundedSumFloat64(&dpagg.BoundedSumFloat64Options{Epsilon: 1, Lower: 0, Upper: 10, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+	}
+	if err := cb.AddToBoundedSum(bs); err != nil {
+		t.Fatalf("AddToBoundedSum: got error %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 6 {
+		t.Errorf("Result: got %f, want 6", got)
+	}
+}
+
+func TestColumnBounderInt64Array(t *testing.T) {
+	ids := newIDs(t, []string{"a", "b", "a", "a"}, nil)
+	defer ids.Release()
+	b := array.NewInt64Builder(memory.DefaultAllocator)
+	defer b.Release()
+	b.AppendValues([]int64{4, 5, 4, 4}, []bool{true, false, true, true})
+	values := b.NewInt64Array()
+	defer values.Release()
+
+	// Only 2 of the 3 values of a are kept, and b has no value.
+	cb, err := dpagg.NewColumnBounder[string, int64](&dpagg.ColumnBounderOptions{MaxContributionsPerPartition: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ColumnBounder: %v", err)
+	}
+	if err := cb.AddColumns(ids, values); err != nil {
+		t.Fatalf("AddColumns: got error %v", err)
+	}
+	bs, err := dpagg.NewBoundedSumInt64(&dpagg.BoundedSumInt64Options{Epsilon: 1, Lower: 0, Upper: 10, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+	}
+	if err := cb.AddToBoundedSum(bs); err != nil {
+		t.Fatalf("AddToBoundedSum: got error %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 8 {
+		t.Errorf("Result: got %d, want 8", got)
+	}
+}
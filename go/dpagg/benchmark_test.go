@@ -0,0 +1,269 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Sinks for the results of the benchmarks, so that the compiler doesn't
+// optimize the benchmarked calls away.
+var (
+	benchResultInt64   int64
+	benchResultFloat64 float64
+	benchErr           error
+)
+
+// Adding entries is the hot path of the aggregations, so it must not allocate.
+func TestAddDoesNotAllocate(t *testing.T) {
+	c, err := NewCount(&CountOptions{Epsilon: ln3})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	bsInt, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, Lower: 0, Upper: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+	}
+	bsFloat, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Lower: 0, Upper: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+	}
+	bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+	}
+	bv, err := NewBoundedVariance(&BoundedVarianceOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedVariance: %v", err)
+	}
+	bq, err := NewBoundedQuantiles(&BoundedQuantilesOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		add  func()
+	}{
+		{"Count.Increment", func() { c.Increment() }},
+		{"BoundedSumInt64.Add", func() { bsInt.Add(3) }},
+		{"BoundedSumFloat64.Add", func() { bsFloat.Add(3.5) }},
+		{"BoundedMeanFloat64.Add", func() { bm.Add(3.5) }},
+		{"BoundedVariance.Add", func() { bv.Add(3.5) }},
+		{"BoundedQuantiles.Add", func() { bq.Add(3.5) }},
+	} {
+		if allocs := testing.AllocsPerRun(100, tc.add); allocs != 0 {
+			t.Errorf("%s: got %f allocations per call, want 0", tc.name, allocs)
+		}
+	}
+}
+
+func BenchmarkCountIncrement(b *testing.B) {
+	c, err := NewCount(&CountOptions{Epsilon: ln3})
+	if err != nil {
+		b.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchErr = c.Increment()
+	}
+}
+
+func BenchmarkBoundedSumInt64Add(b *testing.B) {
+	bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, Lower: 0, Upper: 10})
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchErr = bs.Add(int64(i & 15))
+	}
+}
+
+func BenchmarkBoundedSumFloat64Add(b *testing.B) {
+	bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Lower: 0, Upper: 10})
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchErr = bs.Add(float64(i & 15))
+	}
+}
+
+func BenchmarkBoundedMeanFloat64Add(b *testing.B) {
+	bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchErr = bm.Add(float64(i & 15))
+	}
+}
+
+func BenchmarkBoundedVarianceAdd(b *testing.B) {
+	bv, err := NewBoundedVariance(&BoundedVarianceOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedVariance: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchErr = bv.Add(float64(i & 15))
+	}
+}
+
+func BenchmarkBoundedQuantilesAdd(b *testing.B) {
+	bq, err := NewBoundedQuantiles(&BoundedQuantilesOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchErr = bq.Add(float64(i & 15))
+	}
+}
+
+func BenchmarkCountResult(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c, err := NewCount(&CountOptions{Epsilon: ln3})
+		if err != nil {
+			b.Fatalf("Couldn't initialize Count: %v", err)
+		}
+		b.StartTimer()
+		benchResultInt64, benchErr = c.Result()
+	}
+}
+
+func BenchmarkBoundedSumFloat64Result(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Delta: tenten, Lower: 0, Upper: 10, Noise: noise.Gaussian()})
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+		}
+		b.StartTimer()
+		benchResultFloat64, benchErr = bs.Result()
+	}
+}
+
+func BenchmarkBoundedMeanFloat64Result(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+		}
+		b.StartTimer()
+		benchResultFloat64, benchErr = bm.Result()
+	}
+}
+
+func BenchmarkBoundedQuantilesResult(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bq, err := NewBoundedQuantiles(&BoundedQuantilesOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10})
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+		}
+		b.StartTimer()
+		benchResultFloat64, benchErr = bq.Result(0.5)
+	}
+}
+
+func BenchmarkCountMerge(b *testing.B) {
+	c, err := NewCount(&CountOptions{Epsilon: ln3})
+	if err != nil {
+		b.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c2, err := NewCount(&CountOptions{Epsilon: ln3})
+		if err != nil {
+			b.Fatalf("Couldn't initialize Count: %v", err)
+		}
+		b.StartTimer()
+		benchErr = c.Merge(c2)
+	}
+}
+
+func BenchmarkBoundedSumInt64Merge(b *testing.B) {
+	opt := &BoundedSumInt64Options{Epsilon: ln3, Lower: 0, Upper: 10}
+	bs, err := NewBoundedSumInt64(opt)
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bs2, err := NewBoundedSumInt64(opt)
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+		}
+		b.StartTimer()
+		benchErr = bs.Merge(bs2)
+	}
+}
+
+func BenchmarkBoundedMeanFloat64Merge(b *testing.B) {
+	opt := &BoundedMeanFloat64Options{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10}
+	bm, err := NewBoundedMeanFloat64(opt)
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bm2, err := NewBoundedMeanFloat64(opt)
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+		}
+		b.StartTimer()
+		benchErr = bm.Merge(bm2)
+	}
+}
+
+func BenchmarkBoundedQuantilesMerge(b *testing.B) {
+	opt := &BoundedQuantilesOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10}
+	bq, err := NewBoundedQuantiles(opt)
+	if err != nil {
+		b.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bq2, err := NewBoundedQuantiles(opt)
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+		}
+		b.StartTimer()
+		benchErr = bq.Merge(bq2)
+	}
+}
@@ -0,0 +1,208 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+const (
+	defaultBoundsRefresherLowerRank = 0.05
+	defaultBoundsRefresherUpperRank = 0.95
+)
+
+// BoundsRefresher keeps the bounds of a recurring release calibrated as data
+// drifts. Releases are split into epochs (e.g. days); every RefreshEvery
+// epochs, the contributions of the epoch are used to estimate new bounds by
+// computing differentially private quantiles, and the new bounds are used by
+// the aggregations of the following epochs.
+//
+// Each set of bounds is versioned: the BoundsVersion returned by Bounds should
+// be published in the metadata of the releases computed with these bounds.
+//
+// Estimating bounds uses its own privacy budget, spent once per refresh, in
+// addition to the budget of the aggregations using the bounds. The quantiles
+// are computed with a BoundedQuantiles over [SearchLower, SearchUpper].
+//
+// Not thread-safe.
+type BoundsRefresher struct {
+	// Parameters
+	quantilesOpt *BoundedQuantilesOptions
+	lowerRank    float64
+	upperRank    float64
+	refreshEvery int64
+
+	// State variables
+	epoch     int64
+	bounds    BoundsVersion
+	quantiles *BoundedQuantiles // nil if the current epoch doesn't refresh the bounds
+}
+
+// BoundsVersion is a versioned set of bounds.
+type BoundsVersion struct {
+	// Version of the bounds, starting at 0 for the initial bounds and
+	// incremented with each refresh.
+	Version int64
+	// Epoch whose contributions were used to estimate the bounds, or -1 for the
+	// initial bounds.
+	EstimatedInEpoch int64
+	Lower, Upper     float64
+}
+
+// BoundsRefresherOptions contains the options necessary to initialize a BoundsRefresher.
+type BoundsRefresherOptions struct {
+	Epsilon                      float64 // Privacy parameter ε of each refresh. Required.
+	Delta                        float64 // Privacy parameter δ of each refresh. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed     int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64   // How many times may a single privacy unit contribute to a single partition? Required.
+	// Bounds used before the first refresh. Default to 0; must be such that
+	// InitialLower < InitialUpper.
+	InitialLower, InitialUpper float64
+	// Range of values in which the bounds are searched. Default to 0; must be
+	// such that SearchLower < SearchUpper.
+	SearchLower, SearchUpper float64
+	// Ranks of the quantiles used as lower and upper bounds. Default to 0.05
+	// and 0.95; must be such that 0 <= LowerRank < UpperRank <= 1.
+	LowerRank, UpperRank float64
+	RefreshEvery         int64       // Number of epochs between refreshes. Defaults to 1.
+	Noise                noise.Noise // Type of noise used to compute quantiles. Defaults to Laplace noise.
+}
+
+// NewBoundsRefresher returns a new BoundsRefresher, at epoch 0 with the
+// initial bounds. Contributions of epoch 0 are used for the first refresh.
+func NewBoundsRefresher(opt *BoundsRefresherOptions) (*BoundsRefresher, error) {
+	if opt == nil {
+		opt = &BoundsRefresherOptions{}
+	}
+	// Set defaults.
+	lowerRank, upperRank := opt.LowerRank, opt.UpperRank
+	if lowerRank == 0 && upperRank == 0 {
+		lowerRank, upperRank = defaultBoundsRefresherLowerRank, defaultBoundsRefresherUpperRank
+	}
+	refreshEvery := opt.RefreshEvery
+	if refreshEvery == 0 {
+		refreshEvery = 1
+	}
+
+	if !(0 <= lowerRank && lowerRank < upperRank && upperRank <= 1) {
+		return nil, fmt.Errorf("NewBoundsRefresher: LowerRank = %f and UpperRank = %f must be such that 0 <= LowerRank < UpperRank <= 1", lowerRank, upperRank)
+	}
+	if refreshEvery < 0 {
+		return nil, fmt.Errorf("NewBoundsRefresher: RefreshEvery is %d, must be strictly positive", refreshEvery)
+	}
+	if err := checks.CheckBoundsFloat64(opt.InitialLower, opt.InitialUpper); err != nil {
+		return nil, fmt.Errorf("NewBoundsRefresher: initial bounds: %w", err)
+	}
+	if err := checks.CheckBoundsNotEqual(opt.InitialLower, opt.InitialUpper); err != nil {
+		return nil, fmt.Errorf("NewBoundsRefresher: initial bounds: %w", err)
+	}
+	quantilesOpt := &BoundedQuantilesOptions{
+		Epsilon:                      opt.Epsilon,
+		Delta:                        opt.Delta,
+		MaxPartitionsContributed:     opt.MaxPartitionsContributed,
+		MaxContributionsPerPartition: opt.MaxContributionsPerPartition,
+		Lower:                        opt.SearchLower,
+		Upper:                        opt.SearchUpper,
+		Noise:                        opt.Noise,
+	}
+	br := &BoundsRefresher{
+		quantilesOpt: quantilesOpt,
+		lowerRank:    lowerRank,
+		upperRank:    upperRank,
+		refreshEvery: refreshEvery,
+		bounds: BoundsVersion{
+			Version:          0,
+			EstimatedInEpoch: -1,
+			Lower:            opt.InitialLower,
+			Upper:            opt.InitialUpper,
+		},
+	}
+	// Creating the quantiles of epoch 0 checks the remaining parameters.
+	if err := br.startEpoch(); err != nil {
+		return nil, fmt.Errorf("NewBoundsRefresher: %w", err)
+	}
+	return br, nil
+}
+
+// Epoch returns the current epoch.
+func (br *BoundsRefresher) Epoch() int64 {
+	return br.epoch
+}
+
+// Bounds returns the bounds to use for the aggregations of the current epoch.
+func (br *BoundsRefresher) Bounds() BoundsVersion {
+	return br.bounds
+}
+
+// Add adds a contribution of the current epoch. Contributions are only used
+// in epochs that refresh the bounds, and are ignored otherwise.
+func (br *BoundsRefresher) Add(e float64) error {
+	if br.quantiles == nil {
+		return nil
+	}
+	return br.quantiles.Add(e)
+}
+
+// EndEpoch ends the current epoch, refreshing the bounds if the epoch
+// estimates new bounds, and returns the bounds to use in the next epoch.
+//
+// If the estimated lower bound isn't strictly smaller than the estimated upper
+// bound, e.g. because the epoch had too few contributions, the bounds are not
+// refreshed and keep their version.
+func (br *BoundsRefresher) EndEpoch() (BoundsVersion, error) {
+	if br.quantiles != nil {
+		lower, err := br.quantiles.Result(br.lowerRank)
+		if err != nil {
+			return BoundsVersion{}, fmt.Errorf("couldn't estimate lower bound: %w", err)
+		}
+		upper, err := br.quantiles.Result(br.upperRank)
+		if err != nil {
+			return BoundsVersion{}, fmt.Errorf("couldn't estimate upper bound: %w", err)
+		}
+		if lower < upper {
+			br.bounds = BoundsVersion{
+				Version:          br.bounds.Version + 1,
+				EstimatedInEpoch: br.epoch,
+				Lower:            lower,
+				Upper:            upper,
+			}
+		}
+	}
+	br.epoch++
+	if err := br.startEpoch(); err != nil {
+		return BoundsVersion{}, err
+	}
+	return br.bounds, nil
+}
+
+// startEpoch initializes the quantiles of the current epoch, if it refreshes
+// the bounds.
+func (br *BoundsRefresher) startEpoch() error {
+	br.quantiles = nil
+	if br.epoch%br.refreshEvery != 0 {
+		return nil
+	}
+	bq, err := NewBoundedQuantiles(br.quantilesOpt)
+	if err != nil {
+		return fmt.Errorf("couldn't initialize quantiles for epoch %d: %w", br.epoch, err)
+	}
+	br.quantiles = bq
+	return nil
+}
@@ -0,0 +1,126 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewBoundsRefresherInvalidOptions(t *testing.T) {
+	valid := BoundsRefresherOptions{
+		Epsilon:                      ln3,
+		MaxContributionsPerPartition: 1,
+		InitialLower:                 0,
+		InitialUpper:                 1,
+		SearchLower:                  -100,
+		SearchUpper:                  100,
+	}
+	for _, tc := range []struct {
+		desc   string
+		modify func(*BoundsRefresherOptions)
+	}{
+		{"zero epsilon", func(o *BoundsRefresherOptions) { o.Epsilon = 0 }},
+		{"equal initial bounds", func(o *BoundsRefresherOptions) { o.InitialUpper = 0 }},
+		{"default search bounds", func(o *BoundsRefresherOptions) { o.SearchLower, o.SearchUpper = 0, 0 }},
+		{"lower rank above upper rank", func(o *BoundsRefresherOptions) { o.LowerRank, o.UpperRank = 0.9, 0.1 }},
+		{"negative refresh period", func(o *BoundsRefresherOptions) { o.RefreshEvery = -1 }},
+	} {
+		opt := valid
+		tc.modify(&opt)
+		if _, err := NewBoundsRefresher(&opt); err == nil {
+			t.Errorf("NewBoundsRefresher: with %s got no error, want error", tc.desc)
+		}
+	}
+	if _, err := NewBoundsRefresher(nil); err == nil {
+		t.Errorf("NewBoundsRefresher: with nil options got no error, want error")
+	}
+}
+
+func TestBoundsRefresherFollowsDrift(t *testing.T) {
+	br, err := NewBoundsRefresher(&BoundsRefresherOptions{
+		Epsilon:                      1e6, // Large ε so that the quantiles are accurate.
+		MaxContributionsPerPartition: 1,
+		InitialLower:                 0,
+		InitialUpper:                 1,
+		SearchLower:                  0,
+		SearchUpper:                  1000,
+		LowerRank:                    0.1,
+		UpperRank:                    0.9,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize bounds refresher: %v", err)
+	}
+	if got := br.Bounds(); got != (BoundsVersion{Version: 0, EstimatedInEpoch: -1, Lower: 0, Upper: 1}) {
+		t.Errorf("Bounds: got %+v for the initial bounds", got)
+	}
+	// The data is uniform over [offset, offset+100] in each epoch.
+	for epoch, offset := range []float64{100, 500} {
+		for i := 0; i <= 1000; i++ {
+			br.Add(offset + float64(i)/10)
+		}
+		got, err := br.EndEpoch()
+		if err != nil {
+			t.Fatalf("EndEpoch: got error %v", err)
+		}
+		if got.Version != int64(epoch+1) || got.EstimatedInEpoch != int64(epoch) {
+			t.Errorf("EndEpoch after epoch %d: got version %d estimated in epoch %d, want version %d estimated in epoch %d", epoch, got.Version, got.EstimatedInEpoch, epoch+1, epoch)
+		}
+		if math.Abs(got.Lower-(offset+10)) > 2 || math.Abs(got.Upper-(offset+90)) > 2 {
+			t.Errorf("EndEpoch after epoch %d: got bounds [%f, %f], want about [%f, %f]", epoch, got.Lower, got.Upper, offset+10, offset+90)
+		}
+		if br.Bounds() != got {
+			t.Errorf("Bounds: got %+v, want the bounds returned by EndEpoch %+v", br.Bounds(), got)
+		}
+	}
+}
+
+func TestBoundsRefresherRefreshEvery(t *testing.T) {
+	br, err := NewBoundsRefresher(&BoundsRefresherOptions{
+		Epsilon:                      1e6,
+		MaxContributionsPerPartition: 1,
+		InitialLower:                 0,
+		InitialUpper:                 1,
+		SearchLower:                  0,
+		SearchUpper:                  1000,
+		RefreshEvery:                 2,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize bounds refresher: %v", err)
+	}
+	var versions []int64
+	for epoch := 0; epoch < 4; epoch++ {
+		for i := 0; i <= 100; i++ {
+			br.Add(float64(100*epoch + i))
+		}
+		got, err := br.EndEpoch()
+		if err != nil {
+			t.Fatalf("EndEpoch: got error %v", err)
+		}
+		versions = append(versions, got.Version)
+	}
+	want := []int64{1, 1, 2, 2}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Errorf("EndEpoch: got versions %v, want %v", versions, want)
+			break
+		}
+	}
+	if br.Epoch() != 4 {
+		t.Errorf("Epoch: got %d, want 4", br.Epoch())
+	}
+}
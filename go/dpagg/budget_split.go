@@ -0,0 +1,241 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// BudgetSplitStrategy specifies how a privacy budget is split between the
+// aggregations of the keys a privacy unit contributes to, see
+// BudgetSplitOptions.
+type BudgetSplitStrategy int
+
+const (
+	// EvenSplit gives each key ε/MaxPartitionsContributed and
+	// δ/MaxPartitionsContributed, by basic composition. It is the default.
+	EvenSplit BudgetSplitStrategy = iota
+	// WeightedSplit gives each key a share of ε proportional to its weight,
+	// e.g. its expected size, so that large keys, whose results are less
+	// affected by noise anyway, can be traded for more accurate small keys, or
+	// the reverse. δ is split evenly.
+	WeightedSplit
+	// AdvancedCompositionSplit gives each key the ε₀ of the advanced
+	// composition theorem, see AdvancedCompositionEpsilon, which is larger than
+	// ε/MaxPartitionsContributed when privacy units contribute to many keys, at
+	// the cost of a part of δ.
+	AdvancedCompositionSplit
+)
+
+// String returns the name of the budget split strategy.
+func (s BudgetSplitStrategy) String() string {
+	switch s {
+	case EvenSplit:
+		return "EvenSplit"
+	case WeightedSplit:
+		return "WeightedSplit"
+	case AdvancedCompositionSplit:
+		return "AdvancedCompositionSplit"
+	}
+	return fmt.Sprintf("BudgetSplitStrategy(%d)", int(s))
+}
+
+// BudgetSplitOptions contains the options of an explicit split of an (ε,δ)
+// budget between the aggregations of the keys of a KeyedAggregation. Since a
+// privacy unit contributes to at most MaxPartitionsContributed keys, each
+// aggregation is then created with its own share of the budget and a
+// MaxPartitionsContributed of 1, see KeyedAggregationOptions.NewWithBudget.
+type BudgetSplitOptions[K comparable] struct {
+	// How the budget is split. Defaults to EvenSplit.
+	Strategy BudgetSplitStrategy
+	// Epsilon and Delta specify the (ε,δ)-differential privacy budget of the
+	// aggregations of all the keys a privacy unit contributes to, in addition
+	// to the budget of partition selection. Epsilon is required.
+	Epsilon float64
+	Delta   float64
+	// Weight of each key with WeightedSplit, e.g. its expected number of
+	// contributions from public data or a previous release. Weights must be
+	// strictly positive, and must not be derived from the private data. The
+	// budget is normalized so that the MaxPartitionsContributed keys with the
+	// largest weights, i.e. the worst case for a privacy unit, get Epsilon in
+	// total. Required with WeightedSplit, ignored otherwise.
+	Weights map[K]float64
+	// Weight of the keys missing from Weights with WeightedSplit. Defaults to
+	// the smallest of Weights.
+	DefaultWeight float64
+	// Part of Delta spent by advanced composition with
+	// AdvancedCompositionSplit; the rest is split evenly between the keys, e.g.
+	// for Gaussian noise. Defaults to Delta, which leaves no δ to the
+	// aggregations, as needed for Laplace noise. Ignored by the other
+	// strategies.
+	CompositionDelta float64
+}
+
+// budgetSplit is the share of the budget of each key, computed from
+// BudgetSplitOptions.
+type budgetSplit[K comparable] struct {
+	strategy BudgetSplitStrategy
+	// ε and δ of each key, except for WeightedSplit, where the ε of a key is
+	// its weight times epsilonPerWeight.
+	epsilon          float64
+	delta            float64
+	weights          map[K]float64
+	defaultWeight    float64
+	epsilonPerWeight float64
+}
+
+// newBudgetSplit checks opt and computes the budget of each key for
+// maxPartitionsContributed keys per privacy unit. publicPartitions is nil
+// unless the keys are known in advance.
+func newBudgetSplit[K comparable](opt *BudgetSplitOptions[K], maxPartitionsContributed int64, publicPartitions []K) (*budgetSplit[K], error) {
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("BudgetSplit: %w", err)
+	}
+	if err := checks.CheckDelta(opt.Delta); err != nil {
+		return nil, fmt.Errorf("BudgetSplit: %w", err)
+	}
+	l0 := float64(maxPartitionsContributed)
+	b := &budgetSplit[K]{strategy: opt.Strategy, epsilon: opt.Epsilon / l0, delta: opt.Delta / l0}
+	switch opt.Strategy {
+	case EvenSplit:
+	case WeightedSplit:
+		if err := b.normalizeWeights(opt, maxPartitionsContributed, publicPartitions); err != nil {
+			return nil, fmt.Errorf("BudgetSplit: %w", err)
+		}
+	case AdvancedCompositionSplit:
+		compositionDelta := opt.CompositionDelta
+		if compositionDelta == 0 {
+			compositionDelta = opt.Delta
+		}
+		if compositionDelta <= 0 || compositionDelta > opt.Delta {
+			return nil, fmt.Errorf("BudgetSplit: CompositionDelta is %e, must be strictly positive and at most Delta (%e) with AdvancedCompositionSplit", compositionDelta, opt.Delta)
+		}
+		epsilon, err := AdvancedCompositionEpsilon(opt.Epsilon, compositionDelta, maxPartitionsContributed)
+		if err != nil {
+			return nil, fmt.Errorf("BudgetSplit: %w", err)
+		}
+		b.epsilon = epsilon
+		b.delta = (opt.Delta - compositionDelta) / l0
+	default:
+		return nil, fmt.Errorf("BudgetSplit: unknown Strategy %v", opt.Strategy)
+	}
+	return b, nil
+}
+
+// normalizeWeights sets the weights of b and scales them so that the
+// maxPartitionsContributed largest weights a privacy unit can contribute to
+// sum to opt.Epsilon.
+func (b *budgetSplit[K]) normalizeWeights(opt *BudgetSplitOptions[K], maxPartitionsContributed int64, publicPartitions []K) error {
+	if len(opt.Weights) == 0 {
+		return fmt.Errorf("WeightedSplit requires Weights")
+	}
+	b.weights = opt.Weights
+	b.defaultWeight = opt.DefaultWeight
+	for key, w := range opt.Weights {
+		if w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return fmt.Errorf("weight of key %v is %f, must be strictly positive and finite", key, w)
+		}
+		if opt.DefaultWeight == 0 && (b.defaultWeight == 0 || w < b.defaultWeight) {
+			b.defaultWeight = w
+		}
+	}
+	if b.defaultWeight <= 0 || math.IsInf(b.defaultWeight, 0) || math.IsNaN(b.defaultWeight) {
+		return fmt.Errorf("DefaultWeight is %f, must be strictly positive and finite", b.defaultWeight)
+	}
+	// The weights of the keys a privacy unit can contribute to.
+	var weights []float64
+	if publicPartitions != nil {
+		for _, key := range publicPartitions {
+			weights = append(weights, b.weight(key))
+		}
+	} else {
+		for _, w := range opt.Weights {
+			weights = append(weights, w)
+		}
+		for i := int64(0); i < maxPartitionsContributed; i++ {
+			weights = append(weights, b.defaultWeight)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(weights)))
+	var total float64
+	for i := 0; i < len(weights) && int64(i) < maxPartitionsContributed; i++ {
+		total += weights[i]
+	}
+	if total == 0 {
+		// No key can be released, e.g. with empty PublicPartitions.
+		return nil
+	}
+	b.epsilonPerWeight = opt.Epsilon / total
+	return nil
+}
+
+func (b *budgetSplit[K]) weight(key K) float64 {
+	if w, ok := b.weights[key]; ok {
+		return w
+	}
+	return b.defaultWeight
+}
+
+// keyBudget returns the (ε,δ) budget of the aggregation of the given key.
+func (b *budgetSplit[K]) keyBudget(key K) (epsilon, delta float64) {
+	if b.strategy == WeightedSplit {
+		return b.weight(key) * b.epsilonPerWeight, b.delta
+	}
+	return b.epsilon, b.delta
+}
+
+// AdvancedCompositionEpsilon returns the ε₀ such that numPartitions
+// ε₀-differentially private mechanisms are (ε,δ)-differentially private
+// together, by the advanced composition theorem of Dwork, Rothblum and Vadhan
+// (Theorem 3.20 of "The Algorithmic Foundations of Differential Privacy"):
+//
+//	ε = √(2·k·ln(1/δ))·ε₀ + k·ε₀·(e^ε₀-1)
+//
+// for k = numPartitions. The result is never less than ε/numPartitions, which
+// is returned when advanced composition doesn't improve on basic composition,
+// e.g. for few partitions or a large ε.
+func AdvancedCompositionEpsilon(epsilon, delta float64, numPartitions int64) (float64, error) {
+	if err := checks.CheckEpsilonStrict(epsilon); err != nil {
+		return 0, fmt.Errorf("AdvancedCompositionEpsilon: %w", err)
+	}
+	if err := checks.CheckDeltaStrict(delta); err != nil {
+		return 0, fmt.Errorf("AdvancedCompositionEpsilon: %w", err)
+	}
+	if numPartitions <= 0 {
+		return 0, fmt.Errorf("AdvancedCompositionEpsilon: numPartitions is %d, must be strictly positive", numPartitions)
+	}
+	k := float64(numPartitions)
+	composed := func(e float64) float64 {
+		return math.Sqrt(2*k*math.Log(1/delta))*e + k*e*math.Expm1(e)
+	}
+	// composed is increasing, and at least epsilon at hi, so ε₀ is found by
+	// binary search; lo always satisfies the bound.
+	lo, hi := 0.0, epsilon/math.Sqrt(2*k*math.Log(1/delta))
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if composed(mid) <= epsilon {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return math.Max(lo, epsilon/k), nil
+}
@@ -0,0 +1,286 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAdvancedCompositionEpsilon(t *testing.T) {
+	for _, tc := range []struct {
+		epsilon, delta float64
+		numPartitions  int64
+	}{
+		{1, 1e-6, 100},
+		{1, 1e-10, 1000},
+		{0.1, 1e-5, 10000},
+	} {
+		got, err := AdvancedCompositionEpsilon(tc.epsilon, tc.delta, tc.numPartitions)
+		if err != nil {
+			t.Fatalf("AdvancedCompositionEpsilon(%f, %e, %d): got error %v", tc.epsilon, tc.delta, tc.numPartitions, err)
+		}
+		k := float64(tc.numPartitions)
+		composed := math.Sqrt(2*k*math.Log(1/tc.delta))*got + k*got*math.Expm1(got)
+		if composed > tc.epsilon || !ApproxEqual(composed, tc.epsilon) {
+			t.Errorf("AdvancedCompositionEpsilon(%f, %e, %d) = %f, composes to %f, want %f", tc.epsilon, tc.delta, tc.numPartitions, got, composed, tc.epsilon)
+		}
+		if got <= tc.epsilon/k {
+			t.Errorf("AdvancedCompositionEpsilon(%f, %e, %d) = %f, want more than the even split %f", tc.epsilon, tc.delta, tc.numPartitions, got, tc.epsilon/k)
+		}
+	}
+}
+
+func TestAdvancedCompositionEpsilonFallsBackToEvenSplit(t *testing.T) {
+	// With few partitions, advanced composition is worse than basic composition.
+	got, err := AdvancedCompositionEpsilon(1, 1e-10, 2)
+	if err != nil {
+		t.Fatalf("AdvancedCompositionEpsilon: got error %v", err)
+	}
+	if got != 0.5 {
+		t.Errorf("AdvancedCompositionEpsilon(1, 1e-10, 2) = %f, want 0.5", got)
+	}
+}
+
+func TestAdvancedCompositionEpsilonInvalidParameters(t *testing.T) {
+	for _, tc := range []struct {
+		epsilon, delta float64
+		numPartitions  int64
+	}{
+		{0, 1e-6, 10},
+		{math.Inf(1), 1e-6, 10},
+		{1, 0, 10},
+		{1, 1, 10},
+		{1, 1e-6, 0},
+	} {
+		if _, err := AdvancedCompositionEpsilon(tc.epsilon, tc.delta, tc.numPartitions); err == nil {
+			t.Errorf("AdvancedCompositionEpsilon(%f, %e, %d): got no error, want error", tc.epsilon, tc.delta, tc.numPartitions)
+		}
+	}
+}
+
+func TestBudgetSplitStrategyString(t *testing.T) {
+	for s, want := range map[BudgetSplitStrategy]string{
+		EvenSplit:                "EvenSplit",
+		WeightedSplit:            "WeightedSplit",
+		AdvancedCompositionSplit: "AdvancedCompositionSplit",
+		BudgetSplitStrategy(7):   "BudgetSplitStrategy(7)",
+	} {
+		if got := s.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+// newKeyedCountWithBudgetSplit returns a KeyedAggregation of noiseless counts
+// over the public partitions "a", "b" and "c", with the given budget split and
+// MaxPartitionsContributed = 2, and the budgets its aggregations were created
+// with.
+func newKeyedCountWithBudgetSplit(t *testing.T, split *BudgetSplitOptions[string]) (*KeyedAggregation[string, *Count], map[float64]bool) {
+	t.Helper()
+	budgets := make(map[float64]bool)
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		BudgetSplit: split,
+		NewWithBudget: func(epsilon, delta float64) (*Count, error) {
+			budgets[epsilon] = true
+			return NewCount(&CountOptions{Epsilon: epsilon, Delta: delta, Noise: noNoise{}})
+		},
+		PublicPartitions:         []string{"a", "b", "c"},
+		MaxPartitionsContributed: 2,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	return ka, budgets
+}
+
+func TestKeyedAggregationBudgetSplit(t *testing.T) {
+	advanced, err := AdvancedCompositionEpsilon(2, 1e-5, 2)
+	if err != nil {
+		t.Fatalf("AdvancedCompositionEpsilon: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc       string
+		split      *BudgetSplitOptions[string]
+		wantBudget map[string][2]float64
+	}{
+		{
+			"even split",
+			&BudgetSplitOptions[string]{Epsilon: 2, Delta: 1e-5},
+			map[string][2]float64{"a": {1, 5e-6}, "b": {1, 5e-6}, "c": {1, 5e-6}},
+		},
+		{
+			// The two largest weights sum to 4, so a weight of 1 gets ε/4.
+			"weighted split",
+			&BudgetSplitOptions[string]{Strategy: WeightedSplit, Epsilon: 2, Weights: map[string]float64{"a": 3, "b": 1, "c": 1}},
+			map[string][2]float64{"a": {1.5, 0}, "b": {0.5, 0}, "c": {0.5, 0}},
+		},
+		{
+			// "c" gets the default weight, which is the smallest weight.
+			"weighted split with missing weight",
+			&BudgetSplitOptions[string]{Strategy: WeightedSplit, Epsilon: 2, Weights: map[string]float64{"a": 3, "b": 1}},
+			map[string][2]float64{"a": {1.5, 0}, "b": {0.5, 0}, "c": {0.5, 0}},
+		},
+		{
+			"advanced composition split",
+			&BudgetSplitOptions[string]{Strategy: AdvancedCompositionSplit, Epsilon: 2, Delta: 1e-5},
+			map[string][2]float64{"a": {advanced, 0}, "b": {advanced, 0}, "c": {advanced, 0}},
+		},
+		{
+			"advanced composition split with CompositionDelta",
+			&BudgetSplitOptions[string]{Strategy: AdvancedCompositionSplit, Epsilon: 2, Delta: 2e-5, CompositionDelta: 1e-5},
+			map[string][2]float64{"a": {advanced, 5e-6}, "b": {advanced, 5e-6}, "c": {advanced, 5e-6}},
+		},
+	} {
+		ka, budgets := newKeyedCountWithBudgetSplit(t, tc.split)
+		gotBudget := make(map[string][2]float64)
+		for key := range tc.wantBudget {
+			epsilon, delta, err := ka.PartitionBudget(key)
+			if err != nil {
+				t.Fatalf("With %s, PartitionBudget(%q): got error %v", tc.desc, key, err)
+			}
+			gotBudget[key] = [2]float64{epsilon, delta}
+		}
+		if diff := cmp.Diff(tc.wantBudget, gotBudget); diff != "" {
+			t.Errorf("With %s, PartitionBudget: got diff (-want +got):\n%s", tc.desc, diff)
+		}
+		ka.Add("user", "a", increment)
+		ka.Add("user", "b", increment)
+		result, err := ka.Result()
+		if err != nil {
+			t.Fatalf("With %s, Result: got error %v", tc.desc, err)
+		}
+		if len(result) != 3 {
+			t.Errorf("With %s, Result: got %d keys, want 3", tc.desc, len(result))
+		}
+		// The aggregations are created with the budget of their key.
+		for _, b := range gotBudget {
+			if !budgets[b[0]] {
+				t.Errorf("With %s, no aggregation was created with epsilon %f, got %v", tc.desc, b[0], budgets)
+			}
+		}
+	}
+}
+
+func TestKeyedAggregationWeightedSplitWithoutPublicPartitions(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		BudgetSplit: &BudgetSplitOptions[string]{
+			Strategy:      WeightedSplit,
+			Epsilon:       1,
+			Weights:       map[string]float64{"a": 4},
+			DefaultWeight: 1,
+		},
+		NewWithBudget: func(epsilon, delta float64) (*Count, error) {
+			return NewCount(&CountOptions{Epsilon: epsilon, Delta: delta})
+		},
+		Epsilon:                  ln3,
+		Delta:                    1e-5,
+		MaxPartitionsContributed: 2,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	// A privacy unit can contribute to "a" and to any other key, with weights
+	// summing to 5.
+	for key, want := range map[string]float64{"a": 0.8, "unknown": 0.2} {
+		epsilon, _, err := ka.PartitionBudget(key)
+		if err != nil {
+			t.Fatalf("PartitionBudget(%q): got error %v", key, err)
+		}
+		if !ApproxEqual(epsilon, want) {
+			t.Errorf("PartitionBudget(%q): got epsilon %f, want %f", key, epsilon, want)
+		}
+	}
+}
+
+func TestKeyedAggregationPartitionBudgetWithoutBudgetSplit(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		PublicPartitions:         []string{"a"},
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	if _, _, err := ka.PartitionBudget("a"); err == nil {
+		t.Errorf("PartitionBudget: without BudgetSplit got no error, want error")
+	}
+}
+
+func TestKeyedAggregationBudgetSplitInvalidOptions(t *testing.T) {
+	newWithBudget := func(epsilon, delta float64) (*Count, error) {
+		return NewCount(&CountOptions{Epsilon: epsilon, Delta: delta})
+	}
+	for _, tc := range []struct {
+		desc string
+		opts *KeyedAggregationOptions[string, *Count]
+	}{
+		{"BudgetSplit without NewWithBudget", &KeyedAggregationOptions[string, *Count]{
+			New:                      newNoiselessCountForKey(1),
+			BudgetSplit:              &BudgetSplitOptions[string]{Epsilon: 1},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"NewWithBudget without BudgetSplit", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"zero Epsilon", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			BudgetSplit:              &BudgetSplitOptions[string]{},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"unknown Strategy", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			BudgetSplit:              &BudgetSplitOptions[string]{Strategy: -1, Epsilon: 1},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"WeightedSplit without Weights", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			BudgetSplit:              &BudgetSplitOptions[string]{Strategy: WeightedSplit, Epsilon: 1},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"WeightedSplit with negative weight", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			BudgetSplit:              &BudgetSplitOptions[string]{Strategy: WeightedSplit, Epsilon: 1, Weights: map[string]float64{"a": -1}},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"AdvancedCompositionSplit without Delta", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			BudgetSplit:              &BudgetSplitOptions[string]{Strategy: AdvancedCompositionSplit, Epsilon: 1},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+		{"AdvancedCompositionSplit with CompositionDelta larger than Delta", &KeyedAggregationOptions[string, *Count]{
+			NewWithBudget:            newWithBudget,
+			BudgetSplit:              &BudgetSplitOptions[string]{Strategy: AdvancedCompositionSplit, Epsilon: 1, Delta: 1e-6, CompositionDelta: 1e-5},
+			PublicPartitions:         []string{"a"},
+			MaxPartitionsContributed: 1,
+		}},
+	} {
+		if _, err := NewKeyedAggregation(tc.opts); err == nil {
+			t.Errorf("NewKeyedAggregation with %s: got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Builder sets the options of an aggregation one at a time, e.g.
+//
+//	bm, err := dpagg.NewBuilder().
+//		Epsilon(math.Log(3)).
+//		MaxContributionsPerPartition(2).
+//		Bounds(0, 100).
+//		BoundedMeanFloat64()
+//
+// Unlike the constructors of the aggregations, which fail on the first invalid
+// option, the methods building an aggregation validate all its options and
+// return a *ValidationError listing every problem, including the options that
+// were set but aren't supported by the aggregation. Options that aren't set
+// take the defaults documented in the Options struct of the aggregation, and
+// Parameters returns the effective parameters of the aggregation built.
+//
+// A Builder can build several aggregations, each with the full budget. Options
+// that it doesn't cover, e.g. Clamper, are set with the Options structs.
+type Builder struct {
+	epsilon, delta, rho          float64
+	maxPartitionsContributed     int64
+	maxContributionsPerPartition int64
+	lower, upper                 float64
+	maxPrivacyUnits              int64
+	treeHeight, branchingFactor  int
+	noise                        noise.Noise
+	privacyLevel                 PrivacyLevel
+	set                          map[string]bool // names of the options set
+}
+
+// NewBuilder returns a Builder with no option set.
+func NewBuilder() *Builder {
+	return &Builder{set: map[string]bool{}}
+}
+
+// Epsilon sets the privacy parameter ε.
+func (b *Builder) Epsilon(epsilon float64) *Builder {
+	b.epsilon = epsilon
+	b.set["Epsilon"] = true
+	return b
+}
+
+// Delta sets the privacy parameter δ.
+func (b *Builder) Delta(delta float64) *Builder {
+	b.delta = delta
+	b.set["Delta"] = true
+	return b
+}
+
+// Rho sets the privacy parameter ρ of zero-concentrated differential privacy,
+// instead of Epsilon and Delta.
+func (b *Builder) Rho(rho float64) *Builder {
+	b.rho = rho
+	b.set["Rho"] = true
+	return b
+}
+
+// MaxPartitionsContributed sets how many distinct partitions a single privacy
+// unit may contribute to.
+func (b *Builder) MaxPartitionsContributed(l0 int64) *Builder {
+	b.maxPartitionsContributed = l0
+	b.set["MaxPartitionsContributed"] = true
+	return b
+}
+
+// MaxContributionsPerPartition sets how many times a single privacy unit may
+// contribute to a single partition.
+func (b *Builder) MaxContributionsPerPartition(lInf int64) *Builder {
+	b.maxContributionsPerPartition = lInf
+	b.set["MaxContributionsPerPartition"] = true
+	return b
+}
+
+// Bounds sets the Lower and Upper bounds for clamping.
+func (b *Builder) Bounds(lower, upper float64) *Builder {
+	b.lower, b.upper = lower, upper
+	b.set["Bounds"] = true
+	return b
+}
+
+// MaxPrivacyUnits sets the public upper bound on the number of privacy units.
+func (b *Builder) MaxPrivacyUnits(maxPrivacyUnits int64) *Builder {
+	b.maxPrivacyUnits = maxPrivacyUnits
+	b.set["MaxPrivacyUnits"] = true
+	return b
+}
+
+// TreeHeight sets the height of the tree of a BoundedQuantiles.
+func (b *Builder) TreeHeight(treeHeight int) *Builder {
+	b.treeHeight = treeHeight
+	b.set["TreeHeight"] = true
+	return b
+}
+
+// BranchingFactor sets the number of children of the inner nodes of the tree of
+// a BoundedQuantiles.
+func (b *Builder) BranchingFactor(branchingFactor int) *Builder {
+	b.branchingFactor = branchingFactor
+	b.set["BranchingFactor"] = true
+	return b
+}
+
+// Noise sets the type of noise used.
+func (b *Builder) Noise(n noise.Noise) *Builder {
+	b.noise = n
+	b.set["Noise"] = true
+	return b
+}
+
+// PrivacyLevel sets what is protected by differential privacy, see
+// PrivacyLevel. With EventLevel, MaxPartitionsContributed and
+// MaxContributionsPerPartition are both 1 and don't need to be set.
+func (b *Builder) PrivacyLevel(level PrivacyLevel) *Builder {
+	b.privacyLevel = level
+	b.set["PrivacyLevel"] = true
+	return b
+}
+
+// Count returns a new Count.
+func (b *Builder) Count() (*Count, error) {
+	v := b.validate("Count", "MaxPrivacyUnits")
+	v.budget(false)
+	v.contributions(false)
+	v.maxPrivacyUnits()
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewCount(&CountOptions{
+		Epsilon:                  b.epsilon,
+		Delta:                    b.delta,
+		Rho:                      b.rho,
+		MaxPartitionsContributed: b.maxPartitionsContributed,
+		Noise:                    b.noise,
+		MaxPrivacyUnits:          b.maxPrivacyUnits,
+		PrivacyLevel:             b.privacyLevel,
+	})
+}
+
+// BoundedSumInt64 returns a new BoundedSumInt64. The bounds are truncated to
+// int64.
+func (b *Builder) BoundedSumInt64() (*BoundedSumInt64, error) {
+	v := b.validate("BoundedSumInt64", "Bounds", "MaxPrivacyUnits")
+	v.budget(false)
+	v.contributions(false)
+	if err := checks.CheckBoundsNotDefault(b.lower, b.upper); err != nil {
+		v.check(err)
+	} else {
+		v.check(checks.CheckBoundsFloat64AsInt64(b.lower, b.upper))
+	}
+	v.maxPrivacyUnits()
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewBoundedSumInt64(&BoundedSumInt64Options{
+		Epsilon:                  b.epsilon,
+		Delta:                    b.delta,
+		Rho:                      b.rho,
+		MaxPartitionsContributed: b.maxPartitionsContributed,
+		Lower:                    int64(b.lower),
+		Upper:                    int64(b.upper),
+		Noise:                    b.noise,
+		MaxPrivacyUnits:          b.maxPrivacyUnits,
+		PrivacyLevel:             b.privacyLevel,
+	})
+}
+
+// BoundedSumFloat64 returns a new BoundedSumFloat64.
+func (b *Builder) BoundedSumFloat64() (*BoundedSumFloat64, error) {
+	v := b.validate("BoundedSumFloat64", "Bounds", "MaxPrivacyUnits")
+	v.budget(false)
+	v.contributions(false)
+	v.bounds(true)
+	v.maxPrivacyUnits()
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewBoundedSumFloat64(&BoundedSumFloat64Options{
+		Epsilon:                  b.epsilon,
+		Delta:                    b.delta,
+		Rho:                      b.rho,
+		MaxPartitionsContributed: b.maxPartitionsContributed,
+		Lower:                    b.lower,
+		Upper:                    b.upper,
+		Noise:                    b.noise,
+		MaxPrivacyUnits:          b.maxPrivacyUnits,
+		PrivacyLevel:             b.privacyLevel,
+	})
+}
+
+// BoundedMeanFloat64 returns a new BoundedMeanFloat64.
+func (b *Builder) BoundedMeanFloat64() (*BoundedMeanFloat64, error) {
+	v := b.validate("BoundedMeanFloat64", "MaxContributionsPerPartition", "Bounds")
+	v.budget(false)
+	v.contributions(true)
+	v.bounds(false)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewBoundedMeanFloat64(&BoundedMeanFloat64Options{
+		Epsilon:                      b.epsilon,
+		Delta:                        b.delta,
+		Rho:                          b.rho,
+		MaxPartitionsContributed:     b.maxPartitionsContributed,
+		MaxContributionsPerPartition: b.maxContributionsPerPartition,
+		Lower:                        b.lower,
+		Upper:                        b.upper,
+		Noise:                        b.noise,
+		PrivacyLevel:                 b.privacyLevel,
+	})
+}
+
+// BoundedVariance returns a new BoundedVariance.
+func (b *Builder) BoundedVariance() (*BoundedVariance, error) {
+	v := b.validate("BoundedVariance", "MaxContributionsPerPartition", "Bounds")
+	v.budget(false)
+	v.contributions(true)
+	v.bounds(false)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewBoundedVariance(b.varianceOptions())
+}
+
+// BoundedStandardDeviation returns a new BoundedStandardDeviation.
+func (b *Builder) BoundedStandardDeviation() (*BoundedStandardDeviation, error) {
+	v := b.validate("BoundedStandardDeviation", "MaxContributionsPerPartition", "Bounds")
+	v.budget(false)
+	v.contributions(true)
+	v.bounds(false)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	opt := BoundedStandardDeviationOptions(*b.varianceOptions())
+	return NewBoundedStandardDeviation(&opt)
+}
+
+func (b *Builder) varianceOptions() *BoundedVarianceOptions {
+	return &BoundedVarianceOptions{
+		Epsilon:                      b.epsilon,
+		Delta:                        b.delta,
+		Rho:                          b.rho,
+		MaxPartitionsContributed:     b.maxPartitionsContributed,
+		MaxContributionsPerPartition: b.maxContributionsPerPartition,
+		Lower:                        b.lower,
+		Upper:                        b.upper,
+		Noise:                        b.noise,
+		PrivacyLevel:                 b.privacyLevel,
+	}
+}
+
+// BoundedQuantiles returns a new BoundedQuantiles.
+func (b *Builder) BoundedQuantiles() (*BoundedQuantiles, error) {
+	v := b.validate("BoundedQuantiles", "MaxContributionsPerPartition", "Bounds", "TreeHeight", "BranchingFactor")
+	v.budget(false)
+	v.contributions(true)
+	v.bounds(false)
+	if b.set["TreeHeight"] {
+		v.check(checks.CheckTreeHeight(b.treeHeight))
+	}
+	if b.set["BranchingFactor"] {
+		v.check(checks.CheckBranchingFactor(b.branchingFactor))
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewBoundedQuantiles(&BoundedQuantilesOptions{
+		Epsilon:                      b.epsilon,
+		Delta:                        b.delta,
+		Rho:                          b.rho,
+		MaxPartitionsContributed:     b.maxPartitionsContributed,
+		MaxContributionsPerPartition: b.maxContributionsPerPartition,
+		Lower:                        b.lower,
+		Upper:                        b.upper,
+		Noise:                        b.noise,
+		TreeHeight:                   b.treeHeight,
+		BranchingFactor:              b.branchingFactor,
+		PrivacyLevel:                 b.privacyLevel,
+	})
+}
+
+// PreAggSelectPartition returns a new PreAggSelectPartition. It doesn't support
+// Rho and Noise.
+func (b *Builder) PreAggSelectPartition() (*PreAggSelectPartition, error) {
+	v := b.validate("PreAggSelectPartition")
+	v.budget(true)
+	v.contributions(false)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return NewPreAggSelectPartition(&PreAggSelectPartitionOptions{
+		Epsilon:                  b.epsilon,
+		Delta:                    b.delta,
+		MaxPartitionsContributed: b.maxPartitionsContributed,
+	})
+}
+
+// builderValidation collects the problems of the options of a Builder for an
+// aggregation.
+type builderValidation struct {
+	b        *Builder
+	name     string
+	problems []error
+}
+
+// validate starts the validation of the options of b for aggregation name,
+// which supports the privacy parameters, MaxPartitionsContributed and the
+// options listed in supported.
+func (b *Builder) validate(name string, supported ...string) *builderValidation {
+	v := &builderValidation{b: b, name: name}
+	ok := map[string]bool{"Epsilon": true, "Delta": true, "Rho": true, "MaxPartitionsContributed": true, "Noise": true, "PrivacyLevel": true}
+	if name == "PreAggSelectPartition" {
+		ok["Rho"], ok["Noise"], ok["PrivacyLevel"] = false, false, false
+	}
+	for _, s := range supported {
+		ok[s] = true
+	}
+	var unsupported []string
+	for s := range b.set {
+		if !ok[s] {
+			unsupported = append(unsupported, s)
+		}
+	}
+	sort.Strings(unsupported)
+	for _, s := range unsupported {
+		v.problems = append(v.problems, fmt.Errorf("%s is not supported by %s", s, name))
+	}
+	return v
+}
+
+func (v *builderValidation) check(err error) {
+	if err != nil {
+		v.problems = append(v.problems, err)
+	}
+}
+
+// budget checks the privacy parameters. deltaRequired is set for aggregations
+// that require δ > 0 regardless of their noise.
+func (v *builderValidation) budget(deltaRequired bool) {
+	b := v.b
+	n := noiseOrDefault(b.noise, b.rho)
+	if b.rho != 0 {
+		if b.rho < 0 || math.IsInf(b.rho, 0) || math.IsNaN(b.rho) {
+			v.check(fmt.Errorf("Rho is %f, must be strictly positive and finite", b.rho))
+		}
+		if b.epsilon != 0 || b.delta != 0 {
+			v.check(fmt.Errorf("Epsilon and Delta must be 0 when Rho is set, got Epsilon = %v and Delta = %e", b.epsilon, b.delta))
+		}
+		if kind := noise.ToKind(n); kind != noise.GaussianNoise && kind != noise.DiscreteGaussianNoise {
+			v.check(fmt.Errorf("Rho requires Gaussian noise, got %v", n))
+		}
+		return
+	}
+	v.check(checks.CheckEpsilonStrict(b.epsilon))
+	switch kind := noise.ToKind(n); {
+	case deltaRequired, noise.NeedsDelta(kind):
+		v.check(checks.CheckDeltaStrict(b.delta))
+	case kind == noise.LaplaceNoise, kind == noise.GeometricNoise:
+		v.check(checks.CheckNoDelta(b.delta))
+	default:
+		v.check(checks.CheckDelta(b.delta))
+	}
+}
+
+// contributions checks the contribution bounds, MaxContributionsPerPartition
+// being required if lInfRequired is set, unless the privacy level is
+// EventLevel.
+func (v *builderValidation) contributions(lInfRequired bool) {
+	b := v.b
+	if b.privacyLevel != UserLevel {
+		_, _, err := b.privacyLevel.contributionBounds(b.maxPartitionsContributed, b.maxContributionsPerPartition)
+		v.check(err)
+		return
+	}
+	if b.maxPartitionsContributed != 0 {
+		v.check(checks.CheckL0Sensitivity(b.maxPartitionsContributed))
+	}
+	if lInfRequired {
+		v.check(checks.CheckMaxContributionsPerPartition(b.maxContributionsPerPartition))
+	}
+}
+
+// bounds checks the clamping bounds, which may be equal if equalAllowed is set.
+func (v *builderValidation) bounds(equalAllowed bool) {
+	b := v.b
+	if err := checks.CheckBoundsNotDefault(b.lower, b.upper); err != nil {
+		v.check(err)
+		return
+	}
+	v.check(checks.CheckBoundsFloat64(b.lower, b.upper))
+	if !equalAllowed {
+		v.check(checks.CheckBoundsNotEqual(b.lower, b.upper))
+	}
+}
+
+func (v *builderValidation) maxPrivacyUnits() {
+	if v.b.maxPrivacyUnits < 0 {
+		v.check(fmt.Errorf("MaxPrivacyUnits is %d, must be non-negative", v.b.maxPrivacyUnits))
+	}
+}
+
+func (v *builderValidation) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Aggregation: v.name, Problems: v.problems}
+}
@@ -0,0 +1,124 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestBuilderReportsAllProblems(t *testing.T) {
+	_, err := NewBuilder().
+		Epsilon(-1).
+		Delta(0.1).
+		MaxPartitionsContributed(-2).
+		Bounds(5, 1).
+		TreeHeight(3).
+		BoundedMeanFloat64()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("BoundedMeanFloat64: got error %v, want a ValidationError", err)
+	}
+	// TreeHeight isn't supported, ε is negative, δ must be 0 with Laplace noise,
+	// MaxPartitionsContributed is negative, MaxContributionsPerPartition is
+	// missing, and the bounds are inverted.
+	if got := len(validationErr.Problems); got != 6 {
+		t.Errorf("BoundedMeanFloat64: got %d problems (%v), want 6", got, err)
+	}
+	if !strings.Contains(err.Error(), "TreeHeight is not supported by BoundedMeanFloat64") {
+		t.Errorf("BoundedMeanFloat64: got error %v, want it to mention TreeHeight", err)
+	}
+	var boundsErr *InvalidBoundsError
+	if !errors.As(err, &boundsErr) || boundsErr.Lower != 5 || boundsErr.Upper != 1 {
+		t.Errorf("BoundedMeanFloat64: got error %v, want it to wrap an InvalidBoundsError for [5, 1]", err)
+	}
+}
+
+func TestBuilderValidOptions(t *testing.T) {
+	b := NewBuilder().
+		Epsilon(ln3).
+		MaxContributionsPerPartition(2).
+		Bounds(0, 10).
+		Noise(noNoise{})
+	bm, err := b.BoundedMeanFloat64()
+	if err != nil {
+		t.Fatalf("BoundedMeanFloat64: got error %v", err)
+	}
+	bm.Add(2)
+	bm.Add(4)
+	if got, err := bm.Result(); err != nil || !ApproxEqual(got, 3) {
+		t.Errorf("Result: got (%f, %v), want (3, nil)", got, err)
+	}
+	// The same Builder builds other aggregations.
+	if _, err := b.BoundedQuantiles(); err != nil {
+		t.Errorf("BoundedQuantiles: got error %v", err)
+	}
+	if _, err := b.Count(); err == nil {
+		t.Errorf("Count: with MaxContributionsPerPartition and Bounds set got no error, want error")
+	}
+}
+
+func TestBuilderNoise(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		b       *Builder
+		wantErr bool
+	}{
+		{"Laplace noise with δ = 0", NewBuilder().Epsilon(1), false},
+		{"Laplace noise with δ > 0", NewBuilder().Epsilon(1).Delta(1e-5), true},
+		{"Gaussian noise with δ > 0", NewBuilder().Epsilon(1).Delta(1e-5).Noise(noise.Gaussian()), false},
+		{"Gaussian noise with δ = 0", NewBuilder().Epsilon(1).Noise(noise.Gaussian()), true},
+		{"ρ", NewBuilder().Rho(0.5), false},
+		{"ρ and ε", NewBuilder().Rho(0.5).Epsilon(1), true},
+		{"ρ with Laplace noise", NewBuilder().Rho(0.5).Noise(noise.Laplace()), true},
+		{"negative MaxPrivacyUnits", NewBuilder().Epsilon(1).MaxPrivacyUnits(-1), true},
+	} {
+		if _, err := tc.b.Count(); (err != nil) != tc.wantErr {
+			t.Errorf("Count: with %s got error %v, want error %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestBuilderBoundedSumInt64(t *testing.T) {
+	if _, err := NewBuilder().Epsilon(1).Bounds(0, math.Inf(1)).BoundedSumInt64(); err == nil {
+		t.Errorf("BoundedSumInt64: with an infinite upper bound got no error, want error")
+	}
+	bs, err := NewBuilder().Epsilon(1).Bounds(-3, 3).Noise(noNoise{}).BoundedSumInt64()
+	if err != nil {
+		t.Fatalf("BoundedSumInt64: got error %v", err)
+	}
+	bs.Add(5)
+	if got, err := bs.Result(); err != nil || got != 3 {
+		t.Errorf("Result: got (%d, %v), want (3, nil)", got, err)
+	}
+}
+
+func TestBuilderPreAggSelectPartition(t *testing.T) {
+	if _, err := NewBuilder().Epsilon(1).Delta(0.1).PreAggSelectPartition(); err != nil {
+		t.Errorf("PreAggSelectPartition: got error %v", err)
+	}
+	_, err := NewBuilder().Epsilon(1).Noise(noise.Gaussian()).PreAggSelectPartition()
+	var validationErr *ValidationError
+	// Noise isn't supported, and δ is required.
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 2 {
+		t.Errorf("PreAggSelectPartition: got error %v, want 2 problems", err)
+	}
+}
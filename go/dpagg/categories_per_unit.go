@@ -0,0 +1,208 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// CategoriesPerUnit releases differentially private statistics of the number
+// of distinct categories each privacy unit contributes to, e.g. to answer "how
+// many product categories did each user buy from?".
+//
+// Unlike other aggregations, entries are (privacy ID, category) pairs, and the
+// pre-aggregation per privacy unit happens inside CategoriesPerUnit: each
+// privacy unit contributes a single value, its number of distinct categories,
+// bounded by MaxCategoriesPerUnit. Result returns the mean of these values and
+// their histogram, each computed with its own share of the privacy budget.
+//
+// Privacy units without any category are not known by CategoriesPerUnit, so
+// they aren't part of the statistics.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type CategoriesPerUnit struct {
+	// Parameters
+	meanOpt              BoundedMeanFloat64Options
+	histogramOpt         CountOptions
+	maxCategoriesPerUnit int64
+
+	// State variables
+	// Distinct categories of each privacy unit, of which at most
+	// maxCategoriesPerUnit are kept since larger numbers of categories are
+	// bounded anyway.
+	users map[string]map[string]bool
+	state aggregationState
+}
+
+// CategoriesPerUnitOptions contains the options necessary to initialize a
+// CategoriesPerUnit.
+type CategoriesPerUnitOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// Maximum number of distinct categories of a single privacy unit. Privacy
+	// units with more categories count as having MaxCategoriesPerUnit
+	// categories. Required.
+	MaxCategoriesPerUnit int64
+	// Share of ε and δ used for the mean, the rest being used for the
+	// histogram. Defaults to 0.5; must be in (0, 1).
+	MeanFraction float64
+	Noise        noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// CategoriesPerUnitResult contains the statistics released by
+// CategoriesPerUnit.
+type CategoriesPerUnitResult struct {
+	// Mean number of distinct categories per privacy unit.
+	Mean float64
+	// Noisy number of privacy units with each number of distinct categories,
+	// from 1 to MaxCategoriesPerUnit. Since the possible numbers of categories
+	// are public, all of them are released, and noisy counts may be negative.
+	Histogram map[int64]int64
+}
+
+// NewCategoriesPerUnit returns a new CategoriesPerUnit without any privacy
+// unit.
+func NewCategoriesPerUnit(opt *CategoriesPerUnitOptions) (*CategoriesPerUnit, error) {
+	if opt == nil {
+		opt = &CategoriesPerUnitOptions{}
+	}
+	// Set defaults.
+	fraction := opt.MeanFraction
+	if fraction == 0 {
+		fraction = 0.5
+	}
+
+	// Check the parameters.
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewCategoriesPerUnit: %w", err)
+	}
+	if opt.MaxCategoriesPerUnit <= 0 {
+		return nil, fmt.Errorf("NewCategoriesPerUnit: MaxCategoriesPerUnit is %d, must be strictly positive", opt.MaxCategoriesPerUnit)
+	}
+	if !(fraction > 0 && fraction < 1) {
+		return nil, fmt.Errorf("NewCategoriesPerUnit: MeanFraction is %f, must be in (0, 1)", fraction)
+	}
+	meanOpt := BoundedMeanFloat64Options{
+		Epsilon:                      opt.Epsilon * fraction,
+		Delta:                        opt.Delta * fraction,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        float64(opt.MaxCategoriesPerUnit),
+		Noise:                        opt.Noise,
+	}
+	// Each privacy unit is in a single bucket of the histogram, so the counts
+	// of the buckets compose in parallel.
+	histogramOpt := CountOptions{
+		Epsilon:                  opt.Epsilon * (1 - fraction),
+		Delta:                    opt.Delta * (1 - fraction),
+		MaxPartitionsContributed: 1,
+		Noise:                    opt.Noise,
+	}
+	// Check that the parameters of both statistics are valid by initializing
+	// them.
+	if _, err := NewBoundedMeanFloat64(&meanOpt); err != nil {
+		return nil, fmt.Errorf("NewCategoriesPerUnit: mean: %w", err)
+	}
+	if _, err := NewCount(&histogramOpt); err != nil {
+		return nil, fmt.Errorf("NewCategoriesPerUnit: histogram: %w", err)
+	}
+
+	return &CategoriesPerUnit{
+		meanOpt:              meanOpt,
+		histogramOpt:         histogramOpt,
+		maxCategoriesPerUnit: opt.MaxCategoriesPerUnit,
+		users:                make(map[string]map[string]bool),
+		state:                defaultState,
+	}, nil
+}
+
+// Add records that the given privacy unit contributes to the given category.
+// A privacy unit contributing to a category several times counts it once.
+func (cu *CategoriesPerUnit) Add(privacyID, category string) error {
+	if cu.state != defaultState {
+		return fmt.Errorf("CategoriesPerUnit cannot be amended: %w", cu.state.transitionError(defaultState))
+	}
+	categories, ok := cu.users[privacyID]
+	if !ok {
+		categories = make(map[string]bool)
+		cu.users[privacyID] = categories
+	}
+	if int64(len(categories)) < cu.maxCategoriesPerUnit {
+		categories[category] = true
+	}
+	return nil
+}
+
+// Remove removes all the categories of the given privacy unit, e.g. to honor a
+// deletion request that arrives before the result is computed. Removing an
+// unknown privacy unit has no effect.
+func (cu *CategoriesPerUnit) Remove(privacyID string) error {
+	if cu.state != defaultState {
+		return fmt.Errorf("CategoriesPerUnit cannot be amended: %w", cu.state.transitionError(defaultState))
+	}
+	delete(cu.users, privacyID)
+	return nil
+}
+
+// Result returns the noisy mean and histogram of the number of distinct
+// categories per privacy unit. The method can be called only once.
+func (cu *CategoriesPerUnit) Result() (*CategoriesPerUnitResult, error) {
+	if cu.state != defaultState {
+		return nil, fmt.Errorf("CategoriesPerUnit's noised result cannot be computed: %w", cu.state.transitionError(resultReturned))
+	}
+	cu.state = resultReturned
+
+	bm, err := NewBoundedMeanFloat64(&cu.meanOpt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize BoundedMeanFloat64 for mean: %w", err)
+	}
+	counts := make(map[int64]int64)
+	for _, categories := range cu.users {
+		n := int64(len(categories))
+		if err := bm.Add(float64(n)); err != nil {
+			return nil, err
+		}
+		counts[n]++
+	}
+	cu.users = nil
+	mean, err := bm.Result()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't compute noised mean: %w", err)
+	}
+
+	histogram := make(map[int64]int64)
+	for n := int64(1); n <= cu.maxCategoriesPerUnit; n++ {
+		c, err := NewCount(&cu.histogramOpt)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize Count for histogram: %w", err)
+		}
+		if err := c.IncrementBy(counts[n]); err != nil {
+			return nil, err
+		}
+		if histogram[n], err = c.Result(); err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of privacy units with %d categories: %w", n, err)
+		}
+	}
+	return &CategoriesPerUnitResult{Mean: mean, Histogram: histogram}, nil
+}
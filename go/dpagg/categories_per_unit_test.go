@@ -0,0 +1,126 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewCategoriesPerUnitInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *CategoriesPerUnitOptions
+	}{
+		{"nil options", nil},
+		{"no MaxCategoriesPerUnit", &CategoriesPerUnitOptions{Epsilon: ln3}},
+		{"no Epsilon", &CategoriesPerUnitOptions{MaxCategoriesPerUnit: 3}},
+		{"MeanFraction of 1", &CategoriesPerUnitOptions{Epsilon: ln3, MaxCategoriesPerUnit: 3, MeanFraction: 1}},
+		{"Delta with Laplace noise", &CategoriesPerUnitOptions{Epsilon: ln3, Delta: 1e-5, MaxCategoriesPerUnit: 3}},
+		{"no Delta with Gaussian noise", &CategoriesPerUnitOptions{Epsilon: ln3, MaxCategoriesPerUnit: 3, Noise: noise.Gaussian()}},
+	} {
+		if _, err := NewCategoriesPerUnit(tc.opt); err == nil {
+			t.Errorf("NewCategoriesPerUnit with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestCategoriesPerUnit(t *testing.T) {
+	cu, err := NewCategoriesPerUnit(&CategoriesPerUnitOptions{Epsilon: ln3, MaxCategoriesPerUnit: 3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize CategoriesPerUnit: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("user%d", i)
+		// Contributing to a category several times counts once.
+		cu.Add(id, "books")
+		cu.Add(id, "books")
+		if i < 4 {
+			cu.Add(id, "music")
+		}
+		if i < 2 {
+			// Users with more categories than MaxCategoriesPerUnit count as
+			// having MaxCategoriesPerUnit categories.
+			cu.Add(id, "games")
+			cu.Add(id, "garden")
+		}
+	}
+	got, err := cu.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if want := (6*1 + 2*2 + 2*3) / 10.0; !ApproxEqual(got.Mean, want) {
+		t.Errorf("Result: got mean %f, want %f", got.Mean, want)
+	}
+	wantHistogram := map[int64]int64{1: 6, 2: 2, 3: 2}
+	if len(got.Histogram) != len(wantHistogram) {
+		t.Errorf("Result: got histogram %v, want %v", got.Histogram, wantHistogram)
+	}
+	for n, want := range wantHistogram {
+		if got.Histogram[n] != want {
+			t.Errorf("Result: got %d privacy units with %d categories, want %d", got.Histogram[n], n, want)
+		}
+	}
+	if _, err := cu.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := cu.Add("user0", "books"); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
+
+func TestCategoriesPerUnitBudgetSplit(t *testing.T) {
+	cu, err := NewCategoriesPerUnit(&CategoriesPerUnitOptions{
+		Epsilon:              1,
+		Delta:                1e-5,
+		MaxCategoriesPerUnit: 4,
+		MeanFraction:         0.25,
+		Noise:                noise.Gaussian(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize CategoriesPerUnit: %v", err)
+	}
+	if cu.meanOpt.Epsilon != 0.25 || cu.histogramOpt.Epsilon != 0.75 {
+		t.Errorf("ε of the mean and histogram: got (%f, %f), want (0.25, 0.75)", cu.meanOpt.Epsilon, cu.histogramOpt.Epsilon)
+	}
+	if !ApproxEqual(cu.meanOpt.Delta, 2.5e-6) || !ApproxEqual(cu.histogramOpt.Delta, 7.5e-6) {
+		t.Errorf("δ of the mean and histogram: got (%e, %e), want (2.5e-6, 7.5e-6)", cu.meanOpt.Delta, cu.histogramOpt.Delta)
+	}
+}
+
+func TestCategoriesPerUnitRemove(t *testing.T) {
+	cu, err := NewCategoriesPerUnit(&CategoriesPerUnitOptions{Epsilon: ln3, MaxCategoriesPerUnit: 2, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize CategoriesPerUnit: %v", err)
+	}
+	cu.Add("alice", "books")
+	cu.Add("alice", "music")
+	cu.Add("bob", "books")
+	if err := cu.Remove("alice"); err != nil {
+		t.Fatalf("Remove: got error %v", err)
+	}
+	got, err := cu.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if math.Abs(got.Mean-1) > 1e-9 || got.Histogram[1] != 1 || got.Histogram[2] != 0 {
+		t.Errorf("Result after Remove: got %+v, want mean 1 and histogram map[1:1 2:0]", got)
+	}
+}
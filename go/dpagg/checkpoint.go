@@ -0,0 +1,263 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import "fmt"
+
+// This file contains checkpoints of aggregations, for long-running services
+// that persist the progress of an aggregation periodically, e.g. every few
+// minutes, and resume it after a crash.
+//
+// Unlike GobEncode, Checkpoint doesn't consume the aggregation: it may still
+// be amended, merged, checkpointed again and queried afterwards. To resume,
+// initialize a new aggregation with the same options and Restore the last
+// checkpoint into it. A checkpoint holds the exact partial aggregate, so it
+// must be stored as securely as the raw data.
+//
+// Checkpoints can't be taken once the result of an aggregation was computed,
+// so that all checkpoints predate the single differentially private release
+// of the aggregation. Restoring a checkpoint doesn't allow a second release
+// either, as long as the aggregation that crashed didn't release its result:
+// a service must persist the fact that it released a result, and never
+// restore a checkpoint of an aggregation that did.
+
+// Checkpoint returns a snapshot of c, in the format of GobEncode, without
+// consuming c.
+func (c *Count) Checkpoint() ([]byte, error) {
+	if c.state != defaultState {
+		return nil, fmt.Errorf("Count cannot be checkpointed: %w", c.state.transitionError(defaultState))
+	}
+	snapshot := *c
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the entries of c with the ones of a checkpoint of an
+// aggregation initialized with the same options as c. The parameters of c,
+// including its noise, which isn't serialized, are kept.
+func (c *Count) Restore(checkpoint []byte) error {
+	if c.state != defaultState {
+		return fmt.Errorf("Count cannot be restored: %w", c.state.transitionError(defaultState))
+	}
+	var restored Count
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := countIncompatibleField(c, &restored); field != "" {
+		return fmt.Errorf("Count cannot be restored from the checkpoint: %w", &IncompatibleMergeError{Field: field})
+	}
+	c.count = restored.count
+	c.spentEpsilon, c.spentDelta = restored.spentEpsilon, restored.spentDelta
+	return nil
+}
+
+// Checkpoint returns a snapshot of bs, in the format of GobEncode, without
+// consuming bs.
+func (bs *BoundedSum[T]) Checkpoint() ([]byte, error) {
+	if bs.state != defaultState {
+		return nil, fmt.Errorf("%s cannot be checkpointed: %w", bsName[T](), bs.state.transitionError(defaultState))
+	}
+	snapshot := *bs
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the entries of bs with the ones of a checkpoint of an
+// aggregation initialized with the same options as bs, see Count.Restore.
+func (bs *BoundedSum[T]) Restore(checkpoint []byte) error {
+	if bs.state != defaultState {
+		return fmt.Errorf("%s cannot be restored: %w", bsName[T](), bs.state.transitionError(defaultState))
+	}
+	var restored BoundedSum[T]
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := bsIncompatibleField(bs, &restored); field != "" {
+		return fmt.Errorf("%s cannot be restored from the checkpoint: %w", bsName[T](), &IncompatibleMergeError{Field: field})
+	}
+	bs.restoreFrom(&restored)
+	return nil
+}
+
+// restoreFrom copies the entries of restored, which was initialized like bs,
+// to bs.
+func (bs *BoundedSum[T]) restoreFrom(restored *BoundedSum[T]) {
+	bs.sum = restored.sum
+	bs.overflowed = restored.overflowed
+	bs.spentEpsilon, bs.spentDelta = restored.spentEpsilon, restored.spentDelta
+}
+
+// Checkpoint returns a snapshot of bm, in the format of GobEncode, without
+// consuming bm.
+func (bm *BoundedMeanFloat64) Checkpoint() ([]byte, error) {
+	if bm.state != defaultState {
+		return nil, fmt.Errorf("BoundedMeanFloat64 cannot be checkpointed: %w", bm.state.transitionError(defaultState))
+	}
+	snapshot := *bm
+	if bm.weighted() {
+		weightSum := *bm.weightSum
+		snapshot.weightSum = &weightSum
+	}
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the entries of bm with the ones of a checkpoint of an
+// aggregation initialized with the same options as bm, see Count.Restore.
+func (bm *BoundedMeanFloat64) Restore(checkpoint []byte) error {
+	if bm.state != defaultState {
+		return fmt.Errorf("BoundedMeanFloat64 cannot be restored: %w", bm.state.transitionError(defaultState))
+	}
+	var restored BoundedMeanFloat64
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := bmIncompatibleFieldFloat64(bm, &restored); field != "" {
+		return fmt.Errorf("BoundedMeanFloat64 cannot be restored from the checkpoint: %w", &IncompatibleMergeError{Field: field})
+	}
+	bm.NormalizedSum.restoreFrom(&restored.NormalizedSum)
+	bm.Count.count = restored.Count.count
+	if bm.weighted() {
+		bm.weightSum.restoreFrom(restored.weightSum)
+	}
+	return nil
+}
+
+// Checkpoint returns a snapshot of bv, in the format of GobEncode, without
+// consuming bv.
+func (bv *BoundedVariance) Checkpoint() ([]byte, error) {
+	if bv.state != defaultState {
+		return nil, fmt.Errorf("BoundedVariance cannot be checkpointed: %w", bv.state.transitionError(defaultState))
+	}
+	snapshot := *bv
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the entries of bv with the ones of a checkpoint of an
+// aggregation initialized with the same options as bv, see Count.Restore.
+func (bv *BoundedVariance) Restore(checkpoint []byte) error {
+	if bv.state != defaultState {
+		return fmt.Errorf("BoundedVariance cannot be restored: %w", bv.state.transitionError(defaultState))
+	}
+	var restored BoundedVariance
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := bvIncompatibleField(bv, &restored); field != "" {
+		return fmt.Errorf("BoundedVariance cannot be restored from the checkpoint: %w", &IncompatibleMergeError{Field: field})
+	}
+	bv.restoreFrom(&restored)
+	return nil
+}
+
+// restoreFrom copies the entries of restored, which was initialized like bv,
+// to bv.
+func (bv *BoundedVariance) restoreFrom(restored *BoundedVariance) {
+	bv.Count.count = restored.Count.count
+	bv.NormalizedSum.restoreFrom(&restored.NormalizedSum)
+	bv.NormalizedSumOfSquares.restoreFrom(&restored.NormalizedSumOfSquares)
+}
+
+// Checkpoint returns a snapshot of bstdv, in the format of GobEncode, without
+// consuming bstdv.
+func (bstdv *BoundedStandardDeviation) Checkpoint() ([]byte, error) {
+	if bstdv.state != defaultState {
+		return nil, fmt.Errorf("BoundedStandardDeviation cannot be checkpointed: %w", bstdv.state.transitionError(defaultState))
+	}
+	snapshot := *bstdv
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the entries of bstdv with the ones of a checkpoint of an
+// aggregation initialized with the same options as bstdv, see Count.Restore.
+func (bstdv *BoundedStandardDeviation) Restore(checkpoint []byte) error {
+	if bstdv.state != defaultState {
+		return fmt.Errorf("BoundedStandardDeviation cannot be restored: %w", bstdv.state.transitionError(defaultState))
+	}
+	var restored BoundedStandardDeviation
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := bstdvIncompatibleField(bstdv, &restored); field != "" {
+		return fmt.Errorf("BoundedStandardDeviation cannot be restored from the checkpoint: %w", &IncompatibleMergeError{Field: field})
+	}
+	bstdv.Variance.restoreFrom(&restored.Variance)
+	return nil
+}
+
+// Checkpoint returns a snapshot of bq, in the format of GobEncode, without
+// consuming bq.
+func (bq *BoundedQuantiles) Checkpoint() ([]byte, error) {
+	if bq.state != defaultState {
+		return nil, fmt.Errorf("BoundedQuantiles cannot be checkpointed: %w", bq.state.transitionError(defaultState))
+	}
+	snapshot := *bq
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the entries of bq with the ones of a checkpoint of an
+// aggregation initialized with the same options as bq, see Count.Restore.
+func (bq *BoundedQuantiles) Restore(checkpoint []byte) error {
+	if bq.state != defaultState {
+		return fmt.Errorf("BoundedQuantiles cannot be restored: %w", bq.state.transitionError(defaultState))
+	}
+	var restored BoundedQuantiles
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := bqIncompatibleField(bq, &restored); field != "" {
+		return fmt.Errorf("BoundedQuantiles cannot be restored from the checkpoint: %w", &IncompatibleMergeError{Field: field})
+	}
+	bq.tree = restored.tree
+	return nil
+}
+
+// Checkpoint returns a snapshot of be, in the format of GobEncode, without
+// consuming be.
+func (be *boundedExtremum) Checkpoint() ([]byte, error) {
+	return be.quantiles.Checkpoint()
+}
+
+// Restore replaces the entries of be with the ones of a checkpoint of an
+// aggregation initialized with the same options as be, see Count.Restore.
+func (be *boundedExtremum) Restore(checkpoint []byte) error {
+	return be.quantiles.Restore(checkpoint)
+}
+
+// Checkpoint returns a snapshot of s, in the format of GobEncode, without
+// consuming s.
+func (s *PreAggSelectPartition) Checkpoint() ([]byte, error) {
+	if s.state != defaultState {
+		return nil, fmt.Errorf("PreAggSelectPartition cannot be checkpointed: %w", s.state.transitionError(defaultState))
+	}
+	snapshot := *s
+	return snapshot.GobEncode()
+}
+
+// Restore replaces the privacy units of s with the ones of a checkpoint of a
+// PreAggSelectPartition initialized with the same options as s.
+func (s *PreAggSelectPartition) Restore(checkpoint []byte) error {
+	if s.state != defaultState {
+		return fmt.Errorf("PreAggSelectPartition cannot be restored: %w", s.state.transitionError(defaultState))
+	}
+	var restored PreAggSelectPartition
+	if err := restored.GobDecode(checkpoint); err != nil {
+		return err
+	}
+	if field := preAggSelectPartitionIncompatibleField(s, &restored); field != "" {
+		return fmt.Errorf("PreAggSelectPartition cannot be restored from the checkpoint: %w", &IncompatibleMergeError{Field: field})
+	}
+	s.idCount = restored.idCount
+	return nil
+}
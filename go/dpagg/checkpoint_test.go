@@ -0,0 +1,262 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCountCheckpointDoesNotConsume(t *testing.T) {
+	c := getNoiselessCount(t)
+	c.IncrementBy(3)
+	checkpoint, err := c.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	// c can still be amended, checkpointed again and queried.
+	c.IncrementBy(4)
+	if _, err := c.Checkpoint(); err != nil {
+		t.Errorf("Checkpoint called twice: got error %v", err)
+	}
+	if got, err := c.Result(); err != nil || got != 7 {
+		t.Errorf("Result after Checkpoint: got (%d, %v), want (7, nil)", got, err)
+	}
+	if _, err := c.Checkpoint(); err == nil {
+		t.Errorf("Checkpoint after Result: got no error, want error")
+	}
+
+	// A new Count resumes from the checkpoint.
+	restored := getNoiselessCount(t)
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	restored.Increment()
+	if got, err := restored.Result(); err != nil || got != 4 {
+		t.Errorf("Result after Restore: got (%d, %v), want (4, nil)", got, err)
+	}
+}
+
+func TestCountRestoreKeepsNoise(t *testing.T) {
+	c := getNoiselessCount(t)
+	c.IncrementBy(5)
+	checkpoint, err := c.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	// noNoise isn't serialized, so GobDecode would return a Count without noise.
+	restored := getNoiselessCount(t)
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if _, ok := restored.Noise.(noNoise); !ok {
+		t.Errorf("Restore: got noise %v, want noNoise", restored.Noise)
+	}
+}
+
+func TestRestoreDifferentParameters(t *testing.T) {
+	c := getNoiselessCount(t)
+	checkpoint, err := c.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	other, err := NewCount(&CountOptions{Epsilon: 2 * ln3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	if err := other.Restore(checkpoint); err == nil {
+		t.Errorf("Restore of a checkpoint taken with a different epsilon: got no error, want error")
+	}
+
+	bv := getNoiselessBV(t, 0, 10)
+	bvCheckpoint, err := bv.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	if err := getNoiselessBV(t, 0, 20).Restore(bvCheckpoint); err == nil {
+		t.Errorf("Restore of a checkpoint taken with different bounds: got no error, want error")
+	}
+}
+
+func TestRestoreAfterResult(t *testing.T) {
+	bs := getNoiselessBSI(t)
+	checkpoint, err := bs.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	bs.Result()
+	if err := bs.Restore(checkpoint); err == nil {
+		t.Errorf("Restore after Result: got no error, want error")
+	}
+}
+
+func TestBoundedSumCheckpoint(t *testing.T) {
+	bs := getNoiselessBSF(t)
+	bs.Add(1.5)
+	bs.Add(2)
+	checkpoint, err := bs.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	bs.Add(100)
+	restored := getNoiselessBSF(t)
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if got, err := restored.Result(); err != nil || !ApproxEqual(got, 3.5) {
+		t.Errorf("Result after Restore: got (%f, %v), want (3.5, nil)", got, err)
+	}
+}
+
+func TestBoundedMeanCheckpoint(t *testing.T) {
+	bm := getNoiselessBMF(t)
+	bm.Add(1)
+	bm.Add(3)
+	checkpoint, err := bm.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	// The sub-aggregations of bm are not consumed either.
+	bm.Add(5)
+	if got, err := bm.Result(); err != nil || !ApproxEqual(got, 3) {
+		t.Errorf("Result after Checkpoint: got (%f, %v), want (3, nil)", got, err)
+	}
+	restored := getNoiselessBMF(t)
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if got, err := restored.Result(); err != nil || !ApproxEqual(got, 2) {
+		t.Errorf("Result after Restore: got (%f, %v), want (2, nil)", got, err)
+	}
+}
+
+func TestWeightedBoundedMeanCheckpoint(t *testing.T) {
+	newMean := func() *BoundedMeanFloat64 {
+		bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{
+			Epsilon:                      ln3,
+			MaxContributionsPerPartition: 1,
+			Lower:                        -1,
+			Upper:                        5,
+			MaxWeight:                    10,
+			Noise:                        noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+		}
+		return bm
+	}
+	bm := newMean()
+	bm.AddWithWeight(1, 3)
+	bm.AddWithWeight(5, 1)
+	checkpoint, err := bm.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	// The weight sum of bm is not consumed either.
+	if err := bm.AddWithWeight(4, 2); err != nil {
+		t.Fatalf("AddWithWeight after Checkpoint: got error %v", err)
+	}
+	restored := newMean()
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if got, err := restored.Result(); err != nil || !ApproxEqual(got, 2) {
+		t.Errorf("Result after Restore: got (%f, %v), want (2, nil)", got, err)
+	}
+}
+
+func TestBoundedVarianceCheckpoint(t *testing.T) {
+	bstdv, err := NewBoundedStandardDeviation(&BoundedStandardDeviationOptions{
+		Epsilon:                      ln3,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        10,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedStandardDeviation: %v", err)
+	}
+	bstdv.Add(2)
+	bstdv.Add(6)
+	checkpoint, err := bstdv.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	restored, err := NewBoundedStandardDeviation(&BoundedStandardDeviationOptions{
+		Epsilon:                      ln3,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        10,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedStandardDeviation: %v", err)
+	}
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if got, err := restored.Result(); err != nil || !ApproxEqual(got, 2) {
+		t.Errorf("Result after Restore: got (%f, %v), want (2, nil)", got, err)
+	}
+}
+
+func TestBoundedQuantilesCheckpoint(t *testing.T) {
+	bq := getNoiselessBQ(t, 0, 100)
+	for i := 0; i < 100; i++ {
+		bq.Add(40)
+	}
+	checkpoint, err := bq.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		bq.Add(90)
+	}
+	restored := getNoiselessBQ(t, 0, 100)
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	// The resolution of the tree is 0.01.
+	if got, err := restored.Result(0.9); err != nil || math.Abs(got-40) > 0.01 {
+		t.Errorf("Result after Restore: got (%f, %v), want (40, nil)", got, err)
+	}
+}
+
+func TestPreAggSelectPartitionCheckpoint(t *testing.T) {
+	newSelection := func() *PreAggSelectPartition {
+		s, err := NewPreAggSelectPartition(&PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 0.1})
+		if err != nil {
+			t.Fatalf("Couldn't initialize PreAggSelectPartition: %v", err)
+		}
+		return s
+	}
+	s := newSelection()
+	for i := 0; i < 10; i++ {
+		s.Increment()
+	}
+	checkpoint, err := s.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	restored := newSelection()
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if restored.idCount != 10 {
+		t.Errorf("Restore: got %d privacy units, want 10", restored.idCount)
+	}
+}
@@ -0,0 +1,107 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+)
+
+// Clamper maps contributions into the bounds of an aggregation. Bounded
+// aggregations clamp contributions to [Lower, Upper] by default; a Clamper
+// can be used instead to transform contributions more smoothly, which reduces
+// the pileup of clamped contributions at the bounds.
+//
+// The sensitivity of an aggregation is derived from the range of its Clamper,
+// i.e. [lower, upper]. Values returned by Clamp are clamped to [lower, upper]
+// again before being added, so that a Clamper returning values outside of its
+// range cannot break differential privacy.
+//
+// Clampers are not serialized: an aggregation restored with GobDecode uses the
+// default clamping.
+type Clamper interface {
+	// Clamp maps e into [lower, upper]. It is only called with non-NaN values
+	// of e and with lower <= upper.
+	Clamp(e, lower, upper float64) (float64, error)
+}
+
+// HardClamper clamps contributions to the closest bound, like ClampFloat64.
+// This is the default Clamper of bounded aggregations.
+type HardClamper struct{}
+
+// Clamp returns lower if e < lower, upper if e > upper and e otherwise.
+func (HardClamper) Clamp(e, lower, upper float64) (float64, error) {
+	return ClampFloat64(e, lower, upper)
+}
+
+// defaultSmoothClamperMargin is the default Margin of a SmoothClamper.
+const defaultSmoothClamperMargin = 0.1
+
+// SmoothClamper keeps contributions in the inner part of [lower, upper]
+// unchanged, and squashes contributions close to or outside of the bounds
+// into the outer parts of the interval with a tanh curve. The transform is
+// continuous, monotonic and has a continuous derivative, so contributions
+// outside of the bounds are spread over the outer parts of the interval
+// instead of piling up exactly at the bounds.
+type SmoothClamper struct {
+	// Fraction of the width of [lower, upper] on each side of the interval in
+	// which contributions are squashed. Must be in (0, 0.5]. Defaults to 0.1.
+	Margin float64
+}
+
+// Clamp returns e if it is in the inner part of [lower, upper], and squashes
+// it into the margins of the interval otherwise.
+func (c SmoothClamper) Clamp(e, lower, upper float64) (float64, error) {
+	if lower > upper {
+		return 0, fmt.Errorf("lower must be less than or equal to upper, got lower = %v, upper = %v", lower, upper)
+	}
+	margin := c.Margin
+	if margin == 0 {
+		margin = defaultSmoothClamperMargin
+	}
+	if !(margin > 0 && margin <= 0.5) {
+		return 0, fmt.Errorf("SmoothClamper: Margin is %v, must be in (0, 0.5]", c.Margin)
+	}
+	width := (upper - lower) * margin
+	if width == 0 || math.IsInf(width, 0) {
+		return ClampFloat64(e, lower, upper)
+	}
+	innerLower, innerUpper := lower+width, upper-width
+	switch {
+	case e > innerUpper:
+		return innerUpper + width*math.Tanh((e-innerUpper)/width), nil
+	case e < innerLower:
+		return innerLower - width*math.Tanh((innerLower-e)/width), nil
+	}
+	return e, nil
+}
+
+// clampWith clamps e to [lower, upper] using c, or with hard clamping if c is
+// nil. The result is guaranteed to be within [lower, upper].
+func clampWith(c Clamper, e, lower, upper float64) (float64, error) {
+	if c == nil {
+		return ClampFloat64(e, lower, upper)
+	}
+	transformed, err := c.Clamp(e, lower, upper)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(transformed) {
+		return 0, fmt.Errorf("clamper returned NaN for input value %v", e)
+	}
+	return ClampFloat64(transformed, lower, upper)
+}
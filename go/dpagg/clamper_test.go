@@ -0,0 +1,138 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSmoothClamper(t *testing.T) {
+	c := SmoothClamper{Margin: 0.25}
+	for _, tc := range []struct {
+		e, want float64
+	}{
+		// Values in the inner part of [0, 4], i.e. [1, 3], are kept unchanged.
+		{1, 1},
+		{2, 2},
+		{3, 3},
+		// Values outside of the inner part are squashed into the margins.
+		{4, 3 + math.Tanh(1)},
+		{-1, 1 - math.Tanh(2)},
+		{math.Inf(1), 4},
+		{math.Inf(-1), 0},
+	} {
+		got, err := c.Clamp(tc.e, 0, 4)
+		if err != nil {
+			t.Fatalf("Clamp(%f, 0, 4): got error %v", tc.e, err)
+		}
+		if !ApproxEqual(got, tc.want) {
+			t.Errorf("Clamp(%f, 0, 4): got %f, want %f", tc.e, got, tc.want)
+		}
+	}
+}
+
+func TestSmoothClamperIsMonotonic(t *testing.T) {
+	c := SmoothClamper{}
+	prev := math.Inf(-1)
+	for e := -20.0; e <= 20; e += 0.1 {
+		got, err := c.Clamp(e, -10, 10)
+		if err != nil {
+			t.Fatalf("Clamp(%f, -10, 10): got error %v", e, err)
+		}
+		if got < -10 || got > 10 {
+			t.Errorf("Clamp(%f, -10, 10): got %f, want value in [-10, 10]", e, got)
+		}
+		if got < prev {
+			t.Errorf("Clamp(%f, -10, 10): got %f, want at least %f", e, got, prev)
+		}
+		prev = got
+	}
+}
+
+func TestSmoothClamperInvalidMargin(t *testing.T) {
+	for _, margin := range []float64{-0.1, 0.6, math.NaN()} {
+		if _, err := (SmoothClamper{Margin: margin}).Clamp(0, -1, 1); err == nil {
+			t.Errorf("Clamp with Margin %f: got no error, want error", margin)
+		}
+	}
+}
+
+// outOfRangeClamper is a Clamper that doesn't enforce its range.
+type outOfRangeClamper struct{}
+
+func (outOfRangeClamper) Clamp(e, lower, upper float64) (float64, error) {
+	return e * 10, nil
+}
+
+func TestBoundedSumFloat64WithClamper(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		clamper Clamper
+		want    float64
+	}{
+		{"default", nil, 1 + 5},
+		{"hard clamper", HardClamper{}, 1 + 5},
+		{"smooth clamper", SmoothClamper{Margin: 0.2}, 1 + 4 + math.Tanh(3)},
+		// The out of range clamper's results are clamped to [0, 5].
+		{"out of range clamper", outOfRangeClamper{}, 5 + 5},
+	} {
+		bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
+			Epsilon: ln3,
+			Lower:   0,
+			Upper:   5,
+			Noise:   noNoise{},
+			Clamper: tc.clamper,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize sum with %s: %v", tc.desc, err)
+		}
+		bs.Add(1)
+		bs.Add(7)
+		got, err := bs.Result()
+		if err != nil {
+			t.Fatalf("Result with %s: got error %v", tc.desc, err)
+		}
+		if !ApproxEqual(got, tc.want) {
+			t.Errorf("Result with %s: got %f, want %f", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestBoundedMeanFloat64WithClamper(t *testing.T) {
+	bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{
+		Epsilon:                      ln3,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        10,
+		Noise:                        noNoise{},
+		Clamper:                      SmoothClamper{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize mean: %v", err)
+	}
+	bm.Add(5)
+	bm.Add(100)
+	got, err := bm.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// 100 is squashed into [9, 10].
+	if want := (5 + 9 + math.Tanh(91)) / 2; !ApproxEqual(got, want) {
+		t.Errorf("Result: got %f, want %f", got, want)
+	}
+}
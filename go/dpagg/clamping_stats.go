@@ -0,0 +1,206 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// ClampingStats calculates differentially private winsorization statistics:
+// the fractions of contributions that are below the lower bound or above the
+// upper bound of a bounded aggregation, i.e. that are affected by clamping.
+// Large fractions indicate that the bounds are badly chosen.
+//
+// ClampingStats is meant to be used alongside a bounded aggregation with the
+// same bounds and contribution limits, adding each contribution to both. It
+// uses its own privacy budget, which is typically small compared to the
+// budget of the aggregation and must be accounted for in addition to it.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type ClampingStats struct {
+	// Parameters
+	lower float64
+	upper float64
+
+	// State variables
+	// Number of contributions below lower, above upper and within the bounds.
+	// Each contribution is counted in exactly one of them.
+	BelowLower Count
+	AboveUpper Count
+	Within     Count
+	state      aggregationState
+}
+
+func csEquallyInitialized(cs1, cs2 *ClampingStats) bool {
+	return cs1.lower == cs2.lower &&
+		cs1.upper == cs2.upper &&
+		cs1.state == cs2.state &&
+		countEquallyInitialized(&cs1.BelowLower, &cs2.BelowLower) &&
+		countEquallyInitialized(&cs1.AboveUpper, &cs2.AboveUpper) &&
+		countEquallyInitialized(&cs1.Within, &cs2.Within)
+}
+
+// ClampingStatsOptions contains the options necessary to initialize a ClampingStats.
+type ClampingStatsOptions struct {
+	Epsilon                      float64 // Privacy parameter ε. Required.
+	Delta                        float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed     int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64   // How many times may a single privacy unit contribute to a single partition? Defaults to 1.
+	// Lower and Upper bounds of the aggregation. Default to 0; must be such that Lower <= Upper.
+	Lower, Upper float64
+	Noise        noise.Noise // Type of noise used in ClampingStats. Defaults to Laplace noise.
+}
+
+// ClampingStatsResult contains the differentially private fractions of
+// contributions affected by clamping.
+type ClampingStatsResult struct {
+	FractionBelowLower float64
+	FractionAboveUpper float64
+}
+
+// NewClampingStats returns a new ClampingStats.
+func NewClampingStats(opt *ClampingStatsOptions) (*ClampingStats, error) {
+	if opt == nil {
+		opt = &ClampingStatsOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+
+	lower, upper := opt.Lower, opt.Upper
+	if err := checks.CheckBoundsNotDefault(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewClampingStats: %w", err)
+	}
+	if err := checks.CheckBoundsFloat64IgnoreOverflows(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewClampingStats: %w", err)
+	}
+
+	// The three counts are the cells of a histogram: within a partition, a
+	// privacy unit contributes to at most min(3, lInf) of them, for a total of at
+	// most lInf.
+	countOpt := &CountOptions{
+		Epsilon:                      opt.Epsilon,
+		Delta:                        opt.Delta,
+		MaxPartitionsContributed:     l0 * int64(math.Min(3, float64(lInf))),
+		Noise:                        opt.Noise,
+		maxContributionsPerPartition: lInf,
+	}
+	below, err := NewCount(countOpt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize count below lower for NewClampingStats: %w", err)
+	}
+	above, err := NewCount(countOpt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize count above upper for NewClampingStats: %w", err)
+	}
+	within, err := NewCount(countOpt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize count within bounds for NewClampingStats: %w", err)
+	}
+
+	return &ClampingStats{
+		lower:      lower,
+		upper:      upper,
+		BelowLower: *below,
+		AboveUpper: *above,
+		Within:     *within,
+		state:      defaultState,
+	}, nil
+}
+
+// Add adds a contribution to ClampingStats. It ignores NaN contributions, like
+// bounded aggregations do.
+func (cs *ClampingStats) Add(e float64) error {
+	if cs.state != defaultState {
+		return fmt.Errorf("ClampingStats cannot be amended: %w", cs.state.transitionError(defaultState))
+	}
+	switch {
+	case math.IsNaN(e):
+	case e < cs.lower:
+		cs.BelowLower.Increment()
+	case e > cs.upper:
+		cs.AboveUpper.Increment()
+	default:
+		cs.Within.Increment()
+	}
+	return nil
+}
+
+// Merge merges cs2 into cs (i.e., adds to cs all entries that were added to
+// cs2). cs2 is consumed by this operation: cs2 may not be used after it is
+// merged into cs.
+func (cs *ClampingStats) Merge(cs2 *ClampingStats) error {
+	if cs.state != defaultState {
+		return fmt.Errorf("ClampingStats: cs cannot be merged with another ClampingStats instance: %w", cs.state.transitionError(merged))
+	}
+	if cs2.state != defaultState {
+		return fmt.Errorf("ClampingStats: cs2 cannot be merged with another ClampingStats instance: %w", cs2.state.transitionError(merged))
+	}
+	if !csEquallyInitialized(cs, cs2) {
+		return fmt.Errorf("ClampingStats: cs and cs2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+	cs.BelowLower.Merge(&cs2.BelowLower)
+	cs.AboveUpper.Merge(&cs2.AboveUpper)
+	cs.Within.Merge(&cs2.Within)
+	cs2.state = merged
+	return nil
+}
+
+// Result returns differentially private estimates of the fractions of
+// contributions below the lower bound and above the upper bound. The method
+// can be called only once.
+//
+// Noisy counts are clamped to be non-negative before computing the fractions.
+// If the noisy total is 0, both fractions are 0.
+func (cs *ClampingStats) Result() (ClampingStatsResult, error) {
+	if cs.state != defaultState {
+		return ClampingStatsResult{}, fmt.Errorf("ClampingStats' noised result cannot be computed: %w", cs.state.transitionError(resultReturned))
+	}
+	cs.state = resultReturned
+	below, err := cs.BelowLower.Result()
+	if err != nil {
+		return ClampingStatsResult{}, fmt.Errorf("couldn't compute noised count below lower: %w", err)
+	}
+	above, err := cs.AboveUpper.Result()
+	if err != nil {
+		return ClampingStatsResult{}, fmt.Errorf("couldn't compute noised count above upper: %w", err)
+	}
+	within, err := cs.Within.Result()
+	if err != nil {
+		return ClampingStatsResult{}, fmt.Errorf("couldn't compute noised count within bounds: %w", err)
+	}
+	b := math.Max(0, float64(below))
+	a := math.Max(0, float64(above))
+	total := b + a + math.Max(0, float64(within))
+	if total == 0 {
+		return ClampingStatsResult{}, nil
+	}
+	return ClampingStatsResult{FractionBelowLower: b / total, FractionAboveUpper: a / total}, nil
+}
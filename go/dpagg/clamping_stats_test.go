@@ -0,0 +1,112 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewClampingStatsInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *ClampingStatsOptions
+	}{
+		{"nil options", nil},
+		{"default bounds", &ClampingStatsOptions{Epsilon: ln3}},
+		{"lower above upper", &ClampingStatsOptions{Epsilon: ln3, Lower: 5, Upper: 1}},
+		{"zero epsilon", &ClampingStatsOptions{Lower: 0, Upper: 1}},
+	} {
+		if _, err := NewClampingStats(tc.opts); err == nil {
+			t.Errorf("NewClampingStats: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestClampingStatsNoNoise(t *testing.T) {
+	cs, err := NewClampingStats(&ClampingStatsOptions{Epsilon: ln3, Lower: 0, Upper: 10, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize clamping stats: %v", err)
+	}
+	for _, e := range []float64{-1, 0, 5, 10, 11, 12, 20, 3, math.NaN(), 4} {
+		cs.Add(e)
+	}
+	got, err := cs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := ClampingStatsResult{FractionBelowLower: 1.0 / 9, FractionAboveUpper: 3.0 / 9}
+	if !ApproxEqual(got.FractionBelowLower, want.FractionBelowLower) || !ApproxEqual(got.FractionAboveUpper, want.FractionAboveUpper) {
+		t.Errorf("Result: got %+v, want %+v", got, want)
+	}
+}
+
+func TestClampingStatsMerge(t *testing.T) {
+	opt := &ClampingStatsOptions{Epsilon: ln3, Lower: 0, Upper: 1, Noise: noNoise{}}
+	cs1, err := NewClampingStats(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize clamping stats: %v", err)
+	}
+	cs2, err := NewClampingStats(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize clamping stats: %v", err)
+	}
+	cs1.Add(-1)
+	cs2.Add(0.5)
+	if err := cs1.Merge(cs2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	got, err := cs1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got.FractionBelowLower, 0.5) || got.FractionAboveUpper != 0 {
+		t.Errorf("Result: got %+v, want 0.5 below lower and 0 above upper", got)
+	}
+	if err := cs2.Add(1); err == nil {
+		t.Errorf("Add: got no error after merging, want error")
+	}
+
+	cs3, err := NewClampingStats(&ClampingStatsOptions{Epsilon: ln3, Lower: 0, Upper: 2, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize clamping stats: %v", err)
+	}
+	cs4, err := NewClampingStats(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize clamping stats: %v", err)
+	}
+	if err := cs3.Merge(cs4); err == nil {
+		t.Errorf("Merge: got no error for incompatible bounds, want error")
+	}
+}
+
+func TestClampingStatsEmpty(t *testing.T) {
+	cs, err := NewClampingStats(&ClampingStatsOptions{Epsilon: ln3, Lower: 0, Upper: 1, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize clamping stats: %v", err)
+	}
+	got, err := cs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != (ClampingStatsResult{}) {
+		t.Errorf("Result: got %+v for no contributions, want zero fractions", got)
+	}
+	if _, err := cs.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
@@ -19,17 +19,55 @@ package dpagg
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 )
 
 // Helpers for serializing DP aggregations.
+//
+// Aggregations are encoded in a versioned wire format, so that workers of a
+// fleet running different versions of the library, e.g. during a rolling
+// upgrade, either exchange aggregations they can read or fail explicitly
+// instead of merging corrupted values. An encoding is made of:
+//   - wireFormatMagic, a zero byte, which distinguishes versioned encodings
+//     from the unversioned gob encodings of earlier versions of the library:
+//     a gob stream never starts with a zero byte, since it starts with the
+//     length of its first message, which is never empty.
+//   - The version of the wire format, one byte.
+//   - The payload, whose format depends on the version.
+//
+// Version 1 is the gob encoding of the encodable struct of the aggregation,
+// which is backwards and forwards compatible as long as fields are only added
+// or removed: unknown fields are ignored, and missing fields are zero. Any
+// other change to an encodable struct, e.g. changing the type of a field, must
+// introduce a new version, keeping the decoder of the previous one.
+
+const (
+	wireFormatMagic = 0x00
+	// wireFormatVersion is the version of the wire format used by encode.
+	wireFormatVersion = 1
+)
 
 func encode(v interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
+	buf := bytes.NewBuffer([]byte{wireFormatMagic, wireFormatVersion})
+	enc := gob.NewEncoder(buf)
 	err := enc.Encode(v)
 	return buf.Bytes(), err
 }
 
+// decode decodes data encoded by encode, or by the unversioned gob encoding
+// of earlier versions of the library, into v.
 func decode(v interface{}, data []byte) error {
-	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	if len(data) == 0 || data[0] != wireFormatMagic {
+		// Unversioned gob encoding.
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+	if len(data) < 2 {
+		return fmt.Errorf("truncated wire format header")
+	}
+	switch version := data[1]; version {
+	case 1:
+		return gob.NewDecoder(bytes.NewReader(data[2:])).Decode(v)
+	default:
+		return fmt.Errorf("unsupported wire format version %d, the latest supported version is %d: the data may have been encoded by a newer version of the library", version, wireFormatVersion)
+	}
 }
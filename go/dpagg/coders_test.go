@@ -0,0 +1,82 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEncodeWireFormatHeader(t *testing.T) {
+	b, err := encode(encodableCount{Epsilon: ln3, Count: 3})
+	if err != nil {
+		t.Fatalf("encode: got error %v", err)
+	}
+	if len(b) < 2 || b[0] != wireFormatMagic || b[1] != wireFormatVersion {
+		t.Errorf("encode: got header %x, want %x%x", b[:2], wireFormatMagic, wireFormatVersion)
+	}
+}
+
+// Tests that aggregations encoded by earlier versions of the library, without
+// a wire format header, can still be decoded and merged.
+func TestDecodeUnversionedEncoding(t *testing.T) {
+	// The noise kind matches the noise of getNoiselessCount.
+	want := encodableCount{Epsilon: ln3, Delta: tenten, L0Sensitivity: 1, LInfSensitivity: 1, NoiseKind: noise.Unrecognised, Count: 3}
+	var legacy bytes.Buffer
+	if err := gob.NewEncoder(&legacy).Encode(want); err != nil {
+		t.Fatalf("Couldn't encode legacy Count: %v", err)
+	}
+	var got encodableCount
+	if err := decode(&got, legacy.Bytes()); err != nil {
+		t.Fatalf("decode of an unversioned encoding: got error %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("decode of an unversioned encoding: got diff (-want +got):\n%s", diff)
+	}
+
+	c := new(Count)
+	if err := c.GobDecode(legacy.Bytes()); err != nil {
+		t.Fatalf("GobDecode of an unversioned encoding: got error %v", err)
+	}
+	local := getNoiselessCount(t)
+	local.Increment()
+	if err := c.Merge(local); err != nil {
+		t.Fatalf("Merge of a Count decoded from an unversioned encoding: got error %v", err)
+	}
+	if c.count != 4 {
+		t.Errorf("count after Merge: got %d, want 4", c.count)
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	b, err := encode(encodableCount{Count: 3})
+	if err != nil {
+		t.Fatalf("encode: got error %v", err)
+	}
+	b[1] = wireFormatVersion + 1
+	var got encodableCount
+	if err := decode(&got, b); err == nil {
+		t.Errorf("decode of a newer version: got no error, want error")
+	}
+	if err := decode(&got, []byte{wireFormatMagic}); err == nil {
+		t.Errorf("decode of a truncated header: got no error, want error")
+	}
+}
@@ -0,0 +1,210 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// Column is a column of values, some of which may be null. The arrays of
+// Apache Arrow implement it, e.g. *array.Float64 is a Column[float64] and
+// *array.String a Column[string], so record batches can be aggregated without
+// this package depending on Arrow.
+type Column[T any] interface {
+	Len() int
+	IsNull(i int) bool
+	Value(i int) T
+}
+
+// Float64ValuesColumn and Int64ValuesColumn are implemented by the Arrow
+// arrays of float64 and int64 values, *array.Float64 and *array.Int64, whose
+// values ColumnBounder then reads in bulk rather than with a method call per
+// row. The values of null rows are unspecified.
+type Float64ValuesColumn interface {
+	Column[float64]
+	NullN() int
+	Float64Values() []float64
+}
+
+// Int64ValuesColumn is the equivalent of Float64ValuesColumn for int64 values.
+type Int64ValuesColumn interface {
+	Column[int64]
+	NullN() int
+	Int64Values() []int64
+}
+
+// ColumnBounder bounds the contributions of privacy units to a partition for
+// values read in columns, e.g. from record batches of Apache Arrow: each batch
+// has a column of privacy unit IDs of type K and a column of values of type T.
+// At most MaxContributionsPerPartition values are kept for each privacy unit,
+// chosen uniformly at random across all the added batches. Null IDs and
+// values are ignored.
+//
+// The kept values are then added to a Count, a BoundedSum or a
+// BoundedMeanFloat64 with AddToCount, AddToBoundedSum or
+// AddToBoundedMeanFloat64, which use the bulk AddSlice methods.
+//
+// A ColumnBounder should be used for a single partition; contributions across
+// partitions are bounded separately (via MaxPartitionsContributed).
+//
+// Not thread-safe.
+type ColumnBounder[K comparable, T int64 | float64] struct {
+	// Parameters
+	maxContributionsPerPartition int64
+
+	// State variables
+	units map[K]*unitReservoir[T]
+	state aggregationState
+}
+
+// unitReservoir is a reservoir sample of the values of a privacy unit.
+type unitReservoir[T int64 | float64] struct {
+	values []T
+	// Number of values seen so far, including those not sampled.
+	seen int64
+}
+
+// ColumnBounderOptions contains the options necessary to initialize a ColumnBounder.
+type ColumnBounderOptions struct {
+	MaxContributionsPerPartition int64 // How many values of a single privacy unit are kept? Required.
+}
+
+// NewColumnBounder returns a new ColumnBounder.
+func NewColumnBounder[K comparable, T int64 | float64](opt *ColumnBounderOptions) (*ColumnBounder[K, T], error) {
+	if opt == nil {
+		opt = &ColumnBounderOptions{}
+	}
+	if opt.MaxContributionsPerPartition <= 0 {
+		return nil, fmt.Errorf("NewColumnBounder: MaxContributionsPerPartition is %d, must be strictly positive", opt.MaxContributionsPerPartition)
+	}
+	return &ColumnBounder[K, T]{
+		maxContributionsPerPartition: opt.MaxContributionsPerPartition,
+		units:                        make(map[K]*unitReservoir[T]),
+		state:                        defaultState,
+	}, nil
+}
+
+// AddColumns adds the values of a batch, where values.Value(i) is contributed
+// by the privacy unit ids.Value(i). Both columns must have the same length.
+func (cb *ColumnBounder[K, T]) AddColumns(ids Column[K], values Column[T]) error {
+	if cb.state != defaultState {
+		return fmt.Errorf("ColumnBounder cannot be amended: %w", cb.state.transitionError(defaultState))
+	}
+	if ids.Len() != values.Len() {
+		return fmt.Errorf("ColumnBounder: the ID column has %d rows and the value column %d, must have the same length", ids.Len(), values.Len())
+	}
+	raw, hasNulls := rawValues(values)
+	for i, n := 0, ids.Len(); i < n; i++ {
+		if ids.IsNull(i) || (hasNulls && values.IsNull(i)) {
+			continue
+		}
+		var v T
+		if raw != nil {
+			v = raw[i]
+		} else {
+			v = values.Value(i)
+		}
+		cb.add(ids.Value(i), v)
+	}
+	return nil
+}
+
+// rawValues returns the values of c as a slice if c exposes them, and whether
+// c may have nulls.
+func rawValues[T int64 | float64](col Column[T]) (raw []T, hasNulls bool) {
+	switch c := any(col).(type) {
+	case Float64ValuesColumn:
+		if raw, ok := any(c.Float64Values()).([]T); ok && len(raw) >= col.Len() {
+			return raw, c.NullN() > 0
+		}
+	case Int64ValuesColumn:
+		if raw, ok := any(c.Int64Values()).([]T); ok && len(raw) >= col.Len() {
+			return raw, c.NullN() > 0
+		}
+	}
+	return nil, true
+}
+
+// add adds a value of a privacy unit, with reservoir sampling over the values
+// of the unit.
+func (cb *ColumnBounder[K, T]) add(id K, v T) {
+	u, ok := cb.units[id]
+	if !ok {
+		u = &unitReservoir[T]{}
+		cb.units[id] = u
+	}
+	u.seen++
+	switch {
+	case int64(len(u.values)) < cb.maxContributionsPerPartition:
+		u.values = append(u.values, v)
+	case rand.I63n(u.seen) < cb.maxContributionsPerPartition:
+		u.values[rand.I63n(cb.maxContributionsPerPartition)] = v
+	}
+}
+
+// AddToCount adds the number of privacy units with at least one value to c,
+// since a Count assumes that each privacy unit contributes at most once. To
+// count values instead, add the per-unit counts to a BoundedSumInt64 with
+// AddToBoundedSum on a ColumnBounder whose values are all 1. The method can be
+// called only once.
+func (cb *ColumnBounder[K, T]) AddToCount(c *Count) error {
+	if cb.state != defaultState {
+		return fmt.Errorf("ColumnBounder's values cannot be added to a Count: %w", cb.state.transitionError(defaultState))
+	}
+	cb.state = resultReturned
+	return c.IncrementBy(int64(len(cb.units)))
+}
+
+// AddToBoundedSum adds, for each privacy unit, the sum of its kept values to
+// bs, since a BoundedSum assumes that each privacy unit contributes at most
+// once. The bounds of bs thus bound the total contribution of a privacy unit,
+// e.g. MaxContributionsPerPartition·[lower, upper] for values in
+// [lower, upper], and should include 0. The method can be called only once.
+func (cb *ColumnBounder[K, T]) AddToBoundedSum(bs *BoundedSum[T]) error {
+	if cb.state != defaultState {
+		return fmt.Errorf("ColumnBounder's values cannot be added to a BoundedSum: %w", cb.state.transitionError(defaultState))
+	}
+	cb.state = resultReturned
+	sums := make([]T, 0, len(cb.units))
+	for _, u := range cb.units {
+		var sum T
+		for _, v := range u.values {
+			sum += v
+		}
+		sums = append(sums, sum)
+	}
+	return bs.AddSlice(sums)
+}
+
+// AddToBoundedMeanFloat64 adds the kept values to bm, whose
+// MaxContributionsPerPartition must be at least the one of cb. The method can
+// be called only once.
+func (cb *ColumnBounder[K, T]) AddToBoundedMeanFloat64(bm *BoundedMeanFloat64) error {
+	if cb.state != defaultState {
+		return fmt.Errorf("ColumnBounder's values cannot be added to a BoundedMeanFloat64: %w", cb.state.transitionError(defaultState))
+	}
+	cb.state = resultReturned
+	var values []float64
+	for _, u := range cb.units {
+		for _, v := range u.values {
+			values = append(values, float64(v))
+		}
+	}
+	return bm.AddSlice(values)
+}
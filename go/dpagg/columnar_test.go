@@ -0,0 +1,158 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+)
+
+// testColumn is a Column whose values are read one by one.
+type testColumn[T any] struct {
+	values []T
+	nulls  map[int]bool
+}
+
+func (c testColumn[T]) Len() int          { return len(c.values) }
+func (c testColumn[T]) IsNull(i int) bool { return c.nulls[i] }
+func (c testColumn[T]) Value(i int) T     { return c.values[i] }
+
+// testFloat64Array mimics the *array.Float64 of Apache Arrow, whose values can
+// be read in bulk.
+type testFloat64Array struct {
+	testColumn[float64]
+}
+
+func (a testFloat64Array) NullN() int               { return len(a.nulls) }
+func (a testFloat64Array) Float64Values() []float64 { return a.values }
+
+var _ Float64ValuesColumn = testFloat64Array{}
+
+func TestNewColumnBounderInvalidOptions(t *testing.T) {
+	for _, opt := range []*ColumnBounderOptions{nil, {MaxContributionsPerPartition: -1}} {
+		if _, err := NewColumnBounder[string, float64](opt); err == nil {
+			t.Errorf("NewColumnBounder(%+v): got no error, want error", opt)
+		}
+	}
+}
+
+func TestColumnBounderAddColumnsMismatchedLengths(t *testing.T) {
+	cb, err := NewColumnBounder[string, float64](&ColumnBounderOptions{MaxContributionsPerPartition: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ColumnBounder: %v", err)
+	}
+	ids := testColumn[string]{values: []string{"a", "b"}}
+	values := testColumn[float64]{values: []float64{1}}
+	if err := cb.AddColumns(ids, values); err == nil {
+		t.Errorf("AddColumns with columns of different lengths: got no error, want error")
+	}
+}
+
+func TestColumnBounderAddToBoundedSum(t *testing.T) {
+	for _, bulk := range []bool{false, true} {
+		cb, err := NewColumnBounder[string, float64](&ColumnBounderOptions{MaxContributionsPerPartition: 2})
+		if err != nil {
+			t.Fatalf("Couldn't initialize ColumnBounder: %v", err)
+		}
+		// Two batches; "a" contributes 3 values, of which 2 are kept. Null rows
+		// are ignored.
+		batches := []struct {
+			ids    testColumn[string]
+			values testColumn[float64]
+		}{
+			{testColumn[string]{values: []string{"a", "b", "a", ""}, nulls: map[int]bool{3: true}}, testColumn[float64]{values: []float64{1, 5, 1, 100}}},
+			{testColumn[string]{values: []string{"a", "c"}}, testColumn[float64]{values: []float64{1, 100}, nulls: map[int]bool{1: true}}},
+		}
+		for _, b := range batches {
+			var values Column[float64] = b.values
+			if bulk {
+				values = testFloat64Array{b.values}
+			}
+			if err := cb.AddColumns(b.ids, values); err != nil {
+				t.Fatalf("AddColumns (bulk=%t): got error %v", bulk, err)
+			}
+		}
+		bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, MaxPartitionsContributed: 1, Lower: 0, Upper: 10, Noise: noNoise{}})
+		if err != nil {
+			t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+		}
+		if err := cb.AddToBoundedSum(bs); err != nil {
+			t.Fatalf("AddToBoundedSum (bulk=%t): got error %v", bulk, err)
+		}
+		got, err := bs.Result()
+		if err != nil {
+			t.Fatalf("Result (bulk=%t): got error %v", bulk, err)
+		}
+		if want := 7.0; got != want {
+			t.Errorf("AddToBoundedSum (bulk=%t): got sum %f, want %f", bulk, got, want)
+		}
+		if err := cb.AddToBoundedSum(bs); err == nil {
+			t.Errorf("AddToBoundedSum called twice (bulk=%t): got no error, want error", bulk)
+		}
+	}
+}
+
+func TestColumnBounderAddToCount(t *testing.T) {
+	cb, err := NewColumnBounder[int64, int64](&ColumnBounderOptions{MaxContributionsPerPartition: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ColumnBounder: %v", err)
+	}
+	ids := testColumn[int64]{values: []int64{1, 2, 1, 3}}
+	values := testColumn[int64]{values: []int64{4, 4, 4, 4}}
+	if err := cb.AddColumns(ids, values); err != nil {
+		t.Fatalf("AddColumns: got error %v", err)
+	}
+	c, err := NewCount(&CountOptions{Epsilon: ln3, MaxPartitionsContributed: 1, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	if err := cb.AddToCount(c); err != nil {
+		t.Fatalf("AddToCount: got error %v", err)
+	}
+	if got, err := c.Result(); err != nil || got != 3 {
+		t.Errorf("AddToCount: got count %d (error %v), want 3 privacy units", got, err)
+	}
+	if err := cb.AddColumns(ids, values); err == nil {
+		t.Errorf("AddColumns after AddToCount: got no error, want error")
+	}
+}
+
+func TestColumnBounderAddToBoundedMeanFloat64(t *testing.T) {
+	cb, err := NewColumnBounder[string, float64](&ColumnBounderOptions{MaxContributionsPerPartition: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ColumnBounder: %v", err)
+	}
+	// "a" contributes a single value, so its values are kept.
+	ids := testColumn[string]{values: []string{"a", "b", "b"}}
+	values := testFloat64Array{testColumn[float64]{values: []float64{2, 4, 4}}}
+	if err := cb.AddColumns(ids, values); err != nil {
+		t.Fatalf("AddColumns: got error %v", err)
+	}
+	bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, MaxPartitionsContributed: 1, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+	}
+	if err := cb.AddToBoundedMeanFloat64(bm); err != nil {
+		t.Fatalf("AddToBoundedMeanFloat64: got error %v", err)
+	}
+	got, err := bm.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got, 3) {
+		t.Errorf("AddToBoundedMeanFloat64: got mean %f, want 3", got)
+	}
+}
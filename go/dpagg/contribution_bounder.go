@@ -0,0 +1,180 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// ContributionBounder bounds the contributions of privacy units to partitions
+// of type K, for values of type T, before they are added to the aggregations
+// of this package, one per partition:
+//   - at most MaxPartitionsContributed partitions are kept for each privacy
+//     unit, and
+//   - at most MaxContributionsPerPartition values are kept for each privacy
+//     unit and partition,
+//
+// both chosen uniformly at random with reservoir sampling, so that the kept
+// contributions are an unbiased sample of the contributions of each privacy
+// unit. This is the contribution bounding that Privacy on Beam performs, for
+// data processed without Beam.
+//
+// The aggregations must be initialized with the same MaxPartitionsContributed
+// and MaxContributionsPerPartition. Unlike KeyedAggregation, ContributionBounder
+// doesn't select partitions: if the partitions aren't known in advance, they
+// must be released with partition selection, e.g. a PreAggSelectPartition per
+// partition.
+//
+// Contributions are kept in memory until the result is computed.
+//
+// Not thread-safe.
+type ContributionBounder[K comparable, T any] struct {
+	// Parameters
+	maxPartitionsContributed     int64
+	maxContributionsPerPartition int64
+
+	// State variables
+	units map[string]*unitPartitions[K, T]
+	state aggregationState
+}
+
+// unitPartitions holds the partitions a privacy unit contributed to, with a
+// reservoir sample of partitions and, within each partition, a reservoir
+// sample of values.
+type unitPartitions[K comparable, T any] struct {
+	// Sampled partitions, in no particular order.
+	partitions []*unitPartition[K, T]
+	// Index of each sampled partition in partitions.
+	indices map[K]int
+	// Number of distinct partitions seen so far, including those not sampled.
+	numPartitions int64
+	// Partitions that were seen but not sampled.
+	dropped map[K]bool
+}
+
+type unitPartition[K comparable, T any] struct {
+	partition K
+	values    []T
+	// Number of values seen so far, including those not sampled.
+	numValues int64
+}
+
+// ContributionBounderOptions contains the options necessary to initialize a
+// ContributionBounder.
+type ContributionBounderOptions struct {
+	MaxPartitionsContributed     int64 // How many distinct partitions may a single privacy unit contribute to? Required.
+	MaxContributionsPerPartition int64 // How many times may a single privacy unit contribute to a single partition? Defaults to 1.
+}
+
+// NewContributionBounder returns a new ContributionBounder.
+func NewContributionBounder[K comparable, T any](opt *ContributionBounderOptions) (*ContributionBounder[K, T], error) {
+	if opt == nil {
+		opt = &ContributionBounderOptions{}
+	}
+	if opt.MaxPartitionsContributed <= 0 {
+		return nil, fmt.Errorf("NewContributionBounder: MaxPartitionsContributed is %d, must be strictly positive", opt.MaxPartitionsContributed)
+	}
+	maxContributionsPerPartition := opt.MaxContributionsPerPartition
+	if maxContributionsPerPartition == 0 {
+		maxContributionsPerPartition = 1
+	}
+	if maxContributionsPerPartition < 0 {
+		return nil, fmt.Errorf("NewContributionBounder: MaxContributionsPerPartition is %d, must be strictly positive", maxContributionsPerPartition)
+	}
+	return &ContributionBounder[K, T]{
+		maxPartitionsContributed:     opt.MaxPartitionsContributed,
+		maxContributionsPerPartition: maxContributionsPerPartition,
+		units:                        make(map[string]*unitPartitions[K, T]),
+		state:                        defaultState,
+	}, nil
+}
+
+// Add adds the value contributed by the privacy unit privacyID to partition.
+func (cb *ContributionBounder[K, T]) Add(privacyID string, partition K, value T) error {
+	if cb.state != defaultState {
+		return fmt.Errorf("ContributionBounder cannot be amended: %w", cb.state.transitionError(defaultState))
+	}
+	u, ok := cb.units[privacyID]
+	if !ok {
+		u = &unitPartitions[K, T]{indices: make(map[K]int), dropped: make(map[K]bool)}
+		cb.units[privacyID] = u
+	}
+	u.add(partition, value, cb.maxPartitionsContributed, cb.maxContributionsPerPartition)
+	return nil
+}
+
+// add adds a value to the given partition, keeping a reservoir sample of at
+// most maxPartitions partitions, and of at most maxValues values per
+// partition.
+func (u *unitPartitions[K, T]) add(partition K, value T, maxPartitions, maxValues int64) {
+	if u.dropped[partition] {
+		return
+	}
+	i, ok := u.indices[partition]
+	if !ok {
+		// A new partition: reservoir sampling over the partitions of the privacy unit.
+		u.numPartitions++
+		p := &unitPartition[K, T]{partition: partition}
+		switch {
+		case int64(len(u.partitions)) < maxPartitions:
+			i = len(u.partitions)
+			u.partitions = append(u.partitions, p)
+		case rand.I63n(u.numPartitions) < maxPartitions:
+			i = int(rand.I63n(maxPartitions))
+			evicted := u.partitions[i]
+			delete(u.indices, evicted.partition)
+			u.dropped[evicted.partition] = true
+			u.partitions[i] = p
+		default:
+			u.dropped[partition] = true
+			return
+		}
+		u.indices[partition] = i
+	}
+	p := u.partitions[i]
+	p.numValues++
+	switch {
+	case int64(len(p.values)) < maxValues:
+		p.values = append(p.values, value)
+	case rand.I63n(p.numValues) < maxValues:
+		// Reservoir sampling over the values of the partition.
+		p.values[rand.I63n(maxValues)] = value
+	}
+}
+
+// Result returns the kept values of each partition, grouped by privacy unit:
+// each slice of result[k] holds the values of a single privacy unit, so that
+// e.g. their sum can be added to a BoundedSum, which assumes that each privacy
+// unit contributes at most once, and their number of slices is the number of
+// privacy units to add to a Count. Partitions without kept values are absent.
+// The method can be called only once.
+func (cb *ContributionBounder[K, T]) Result() (map[K][][]T, error) {
+	if cb.state != defaultState {
+		return nil, fmt.Errorf("ContributionBounder's result cannot be computed: %w", cb.state.transitionError(resultReturned))
+	}
+	cb.state = resultReturned
+	result := make(map[K][][]T)
+	for _, u := range cb.units {
+		for _, p := range u.partitions {
+			result[p.partition] = append(result[p.partition], p.values)
+		}
+	}
+	cb.units = nil
+	return result, nil
+}
@@ -0,0 +1,148 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewContributionBounderInvalidOptions(t *testing.T) {
+	for _, opt := range []*ContributionBounderOptions{
+		nil,
+		{MaxPartitionsContributed: 0},
+		{MaxPartitionsContributed: 1, MaxContributionsPerPartition: -1},
+	} {
+		if _, err := NewContributionBounder[string, float64](opt); err == nil {
+			t.Errorf("NewContributionBounder(%+v): got no error, want error", opt)
+		}
+	}
+}
+
+func TestContributionBounderBoundsContributions(t *testing.T) {
+	cb, err := NewContributionBounder[int, float64](&ContributionBounderOptions{
+		MaxPartitionsContributed:     2,
+		MaxContributionsPerPartition: 3,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ContributionBounder: %v", err)
+	}
+	// Each of 100 privacy units contributes 10 values to each of 5 partitions.
+	for u := 0; u < 100; u++ {
+		for p := 0; p < 5; p++ {
+			for i := 0; i < 10; i++ {
+				cb.Add(fmt.Sprint(u), p, float64(i))
+			}
+		}
+	}
+	result, err := cb.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	var numUnits int
+	for p, units := range result {
+		numUnits += len(units)
+		for _, values := range units {
+			if len(values) != 3 {
+				t.Errorf("partition %d: got %d values for a privacy unit, want 3", p, len(values))
+			}
+		}
+	}
+	// Each privacy unit keeps 2 partitions.
+	if numUnits != 200 {
+		t.Errorf("got %d contributions of privacy units to partitions, want 200", numUnits)
+	}
+	if _, err := cb.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := cb.Add("0", 0, 1); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
+
+func TestContributionBounderKeepsPartitionsUniformly(t *testing.T) {
+	const numTrials = 10000
+	// A privacy unit contributes to 4 partitions, of which 1 is kept.
+	counts := make(map[string]int)
+	for i := 0; i < numTrials; i++ {
+		cb, err := NewContributionBounder[string, int](&ContributionBounderOptions{MaxPartitionsContributed: 1})
+		if err != nil {
+			t.Fatalf("Couldn't initialize ContributionBounder: %v", err)
+		}
+		for _, p := range []string{"a", "b", "c", "d"} {
+			cb.Add("unit", p, 1)
+		}
+		result, err := cb.Result()
+		if err != nil {
+			t.Fatalf("Result: got error %v", err)
+		}
+		for p := range result {
+			counts[p]++
+		}
+	}
+	for _, p := range []string{"a", "b", "c", "d"} {
+		// The expected count is 2500, with a standard deviation of about 43.
+		if counts[p] < 2250 || counts[p] > 2750 {
+			t.Errorf("partition %s was kept %d times out of %d, want about %d", p, counts[p], numTrials, numTrials/4)
+		}
+	}
+}
+
+// Tests that the bounded contributions can be added to aggregations
+// initialized with the same contribution bounds.
+func TestContributionBounderFeedsAggregations(t *testing.T) {
+	cb, err := NewContributionBounder[string, int64](&ContributionBounderOptions{
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 2,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ContributionBounder: %v", err)
+	}
+	// "a" contributes 3 values to "x", of which 2 are kept.
+	cb.Add("a", "x", 1)
+	cb.Add("a", "x", 1)
+	cb.Add("a", "x", 1)
+	cb.Add("b", "x", 1)
+	result, err := cb.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{
+		Epsilon:                  ln3,
+		MaxPartitionsContributed: 1,
+		Lower:                    0,
+		Upper:                    2,
+		Noise:                    noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sum: %v", err)
+	}
+	for _, values := range result["x"] {
+		var sum int64
+		for _, v := range values {
+			sum += v
+		}
+		bs.Add(sum)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("BoundedSum of the bounded contributions: got %d, want 3", got)
+	}
+}
@@ -0,0 +1,228 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// ContributionBounds are the contribution bounds of an aggregation.
+type ContributionBounds struct {
+	MaxPartitionsContributed     int64
+	MaxContributionsPerPartition int64
+}
+
+// ContributionTuner is a diagnostic that reports, for several choices of
+// MaxPartitionsContributed and MaxContributionsPerPartition, the utility of a
+// differentially private count per partition, e.g. computed with a
+// KeyedAggregation of Counts, and recommends the choice with the lowest
+// expected error.
+//
+// Contribution bounding trades bias for noise: low bounds drop more
+// contributions, which biases the counts downwards, and high bounds require
+// more noise. For each candidate, ContributionTuner computes the expected
+// number of contributions dropped from each partition when the kept
+// partitions of each privacy unit are chosen uniformly at random, and the
+// standard deviation of the noise of a count with the candidate bounds and the
+// privacy budget of the planned aggregation. The error of a candidate is the
+// root mean squared error over the partitions, combining both. The effect of
+// partition selection is ignored, as if the partitions were public.
+//
+// ContributionTuner is a dry run: its report is computed from the exact
+// contributions without any noise, so it is NOT differentially private. It is
+// meant to be used on public data or historical data that isn't subject to the
+// privacy guarantee, e.g. to choose the bounds before running the planned
+// aggregation on private data. Choosing the bounds from the private data
+// itself, and then using them on the same data, violates differential
+// privacy.
+//
+// Not thread-safe.
+type ContributionTuner struct {
+	// Parameters
+	candidates []ContributionBounds
+	epsilon    float64
+	delta      float64
+	noise      noise.Noise
+
+	// State variables
+	// Number of contributions of each privacy unit to each partition.
+	contributions map[string]map[string]int64
+	state         aggregationState
+}
+
+// ContributionTunerOptions contains the options necessary to initialize a
+// ContributionTuner.
+type ContributionTunerOptions struct {
+	// Privacy parameters ε and δ of the planned aggregation, used to compute
+	// the noise of each candidate. ContributionTuner itself doesn't use any
+	// privacy budget. Delta is required with Gaussian noise, and must be 0 with
+	// Laplace noise. Epsilon is required.
+	Epsilon float64
+	Delta   float64
+	// Noise of the planned aggregation. Defaults to Laplace noise; must be
+	// Laplace, Gaussian or discrete Gaussian noise.
+	Noise noise.Noise
+	// Candidate contribution bounds. Defaults to all the combinations of
+	// MaxPartitionsContributed and MaxContributionsPerPartition in 1, 2, 4, …,
+	// 32.
+	Candidates []ContributionBounds
+}
+
+// ContributionBoundsEvaluation contains the expected utility of a count per
+// partition with the given contribution bounds.
+type ContributionBoundsEvaluation struct {
+	Bounds ContributionBounds
+	// Expected fraction of the contributions kept by contribution bounding.
+	KeptFraction float64
+	// Standard deviation of the noise of the count of each partition.
+	NoiseStandardDeviation float64
+	// Expected root mean squared error of the count of a partition, due to
+	// both the dropped contributions and the noise.
+	RootMeanSquaredError float64
+}
+
+// ContributionTuningReport contains the evaluations of the candidate
+// contribution bounds of a ContributionTuner, in the order of the candidates,
+// and the recommended candidate, which has the lowest RootMeanSquaredError.
+// Ties are broken in favor of the first candidate.
+type ContributionTuningReport struct {
+	Evaluations []ContributionBoundsEvaluation
+	Recommended ContributionBounds
+}
+
+// NewContributionTuner returns a new ContributionTuner without any
+// contribution.
+func NewContributionTuner(opt *ContributionTunerOptions) (*ContributionTuner, error) {
+	if opt == nil {
+		opt = &ContributionTunerOptions{}
+	}
+	// Set defaults.
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+	candidates := opt.Candidates
+	if candidates == nil {
+		for l0 := int64(1); l0 <= 32; l0 *= 2 {
+			for lInf := int64(1); lInf <= 32; lInf *= 2 {
+				candidates = append(candidates, ContributionBounds{MaxPartitionsContributed: l0, MaxContributionsPerPartition: lInf})
+			}
+		}
+	}
+
+	// Check the parameters.
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("NewContributionTuner: Candidates must not be empty")
+	}
+	for i, c := range candidates {
+		if c.MaxPartitionsContributed <= 0 || c.MaxContributionsPerPartition <= 0 {
+			return nil, fmt.Errorf("NewContributionTuner: candidate %d has MaxPartitionsContributed %d and MaxContributionsPerPartition %d, must be strictly positive", i, c.MaxPartitionsContributed, c.MaxContributionsPerPartition)
+		}
+		if _, err := NoiseStandardDeviation(n, c.MaxPartitionsContributed, float64(c.MaxContributionsPerPartition), opt.Epsilon, opt.Delta); err != nil {
+			return nil, fmt.Errorf("NewContributionTuner: candidate %d: %w", i, err)
+		}
+	}
+
+	return &ContributionTuner{
+		candidates:    append([]ContributionBounds(nil), candidates...),
+		epsilon:       opt.Epsilon,
+		delta:         opt.Delta,
+		noise:         n,
+		contributions: make(map[string]map[string]int64),
+		state:         defaultState,
+	}, nil
+}
+
+// Add records a contribution of the given privacy unit to the given
+// partition.
+func (ct *ContributionTuner) Add(privacyID, partition string) error {
+	if ct.state != defaultState {
+		return fmt.Errorf("ContributionTuner cannot be amended: %w", ct.state.transitionError(defaultState))
+	}
+	partitions, ok := ct.contributions[privacyID]
+	if !ok {
+		partitions = make(map[string]int64)
+		ct.contributions[privacyID] = partitions
+	}
+	partitions[partition]++
+	return nil
+}
+
+// Report returns the evaluations of the candidate contribution bounds and the
+// recommended candidate. It returns an error if no contribution was added.
+// The method can be called only once.
+func (ct *ContributionTuner) Report() (*ContributionTuningReport, error) {
+	if ct.state != defaultState {
+		return nil, fmt.Errorf("ContributionTuner's report cannot be computed: %w", ct.state.transitionError(resultReturned))
+	}
+	ct.state = resultReturned
+	if len(ct.contributions) == 0 {
+		return nil, fmt.Errorf("ContributionTuner: no contribution was added")
+	}
+
+	var total int64
+	partitionSet := make(map[string]bool)
+	for _, partitions := range ct.contributions {
+		for partition, c := range partitions {
+			total += c
+			partitionSet[partition] = true
+		}
+	}
+	report := &ContributionTuningReport{}
+	bestError := math.Inf(1)
+	for _, b := range ct.candidates {
+		stdDev, err := NoiseStandardDeviation(ct.noise, b.MaxPartitionsContributed, float64(b.MaxContributionsPerPartition), ct.epsilon, ct.delta)
+		if err != nil {
+			return nil, err
+		}
+		// Each privacy unit keeps MaxPartitionsContributed of its m partitions
+		// uniformly at random, i.e. each with probability
+		// min(MaxPartitionsContributed, m)/m, and at most
+		// MaxContributionsPerPartition contributions in each of them.
+		var kept float64
+		dropped := make(map[string]float64)
+		for _, partitions := range ct.contributions {
+			m := int64(len(partitions))
+			p := float64(minInt64(b.MaxPartitionsContributed, m)) / float64(m)
+			for partition, c := range partitions {
+				k := p * float64(minInt64(c, b.MaxContributionsPerPartition))
+				kept += k
+				dropped[partition] += float64(c) - k
+			}
+		}
+		var squaredBias float64
+		for _, d := range dropped {
+			squaredBias += d * d
+		}
+		rmse := math.Sqrt(squaredBias/float64(len(partitionSet)) + stdDev*stdDev)
+		report.Evaluations = append(report.Evaluations, ContributionBoundsEvaluation{
+			Bounds:                 b,
+			KeptFraction:           kept / float64(total),
+			NoiseStandardDeviation: stdDev,
+			RootMeanSquaredError:   rmse,
+		})
+		if rmse < bestError {
+			bestError = rmse
+			report.Recommended = b
+		}
+	}
+	ct.contributions = nil
+	return report, nil
+}
@@ -0,0 +1,138 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewContributionTunerInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *ContributionTunerOptions
+	}{
+		{"nil options", nil},
+		{"no Epsilon", &ContributionTunerOptions{}},
+		{"empty Candidates", &ContributionTunerOptions{Epsilon: ln3, Candidates: []ContributionBounds{}}},
+		{"zero MaxPartitionsContributed", &ContributionTunerOptions{Epsilon: ln3, Candidates: []ContributionBounds{{0, 1}}}},
+		{"negative MaxContributionsPerPartition", &ContributionTunerOptions{Epsilon: ln3, Candidates: []ContributionBounds{{1, -1}}}},
+		{"Delta with Laplace noise", &ContributionTunerOptions{Epsilon: ln3, Delta: 1e-5}},
+		{"no Delta with Gaussian noise", &ContributionTunerOptions{Epsilon: ln3, Noise: noise.Gaussian()}},
+	} {
+		if _, err := NewContributionTuner(tc.opt); err == nil {
+			t.Errorf("NewContributionTuner with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestContributionTunerReport(t *testing.T) {
+	ct, err := NewContributionTuner(&ContributionTunerOptions{
+		Epsilon:    ln3,
+		Candidates: []ContributionBounds{{1, 1}, {2, 3}},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ContributionTuner: %v", err)
+	}
+	for _, c := range []struct{ id, partition string }{
+		{"a", "p1"}, {"a", "p1"}, {"a", "p1"}, {"a", "p2"}, {"b", "p1"},
+	} {
+		if err := ct.Add(c.id, c.partition); err != nil {
+			t.Fatalf("Add(%s, %s): got error %v", c.id, c.partition, err)
+		}
+	}
+	got, err := ct.Report()
+	if err != nil {
+		t.Fatalf("Report: got error %v", err)
+	}
+	// With bounds (1, 1), a keeps each of its 2 partitions with probability
+	// 1/2 and a single contribution in it, so 2 of the 5 contributions are
+	// kept in expectation, and p1 and p2 lose 2.5 and 0.5 contributions. With
+	// bounds (2, 3), all contributions are kept.
+	laplaceStdDev := math.Sqrt2 / ln3
+	want := []ContributionBoundsEvaluation{
+		{ContributionBounds{1, 1}, 0.4, laplaceStdDev, math.Sqrt((2.5*2.5+0.5*0.5)/2 + laplaceStdDev*laplaceStdDev)},
+		{ContributionBounds{2, 3}, 1, 6 * laplaceStdDev, 6 * laplaceStdDev},
+	}
+	if len(got.Evaluations) != len(want) {
+		t.Fatalf("Report: got %d evaluations, want %d", len(got.Evaluations), len(want))
+	}
+	for i, w := range want {
+		g := got.Evaluations[i]
+		if g.Bounds != w.Bounds || !ApproxEqual(g.KeptFraction, w.KeptFraction) || !ApproxEqual(g.NoiseStandardDeviation, w.NoiseStandardDeviation) || !ApproxEqual(g.RootMeanSquaredError, w.RootMeanSquaredError) {
+			t.Errorf("Report: got evaluation %+v, want %+v", g, w)
+		}
+	}
+	if got.Recommended != (ContributionBounds{1, 1}) {
+		t.Errorf("Report: got recommended bounds %+v, want {1 1}", got.Recommended)
+	}
+	if _, err := ct.Report(); err == nil {
+		t.Errorf("Report called twice: got no error, want error")
+	}
+	if err := ct.Add("a", "p1"); err == nil {
+		t.Errorf("Add after Report: got no error, want error")
+	}
+}
+
+func TestContributionTunerRecommendation(t *testing.T) {
+	for _, tc := range []struct {
+		desc                                   string
+		partitionsPerUser, contributionsPerKey int
+		want                                   ContributionBounds
+	}{
+		{"single contributions", 1, 1, ContributionBounds{1, 1}},
+		// Dropping contributions of 1000 privacy units costs much more than
+		// the additional noise.
+		{"many contributions", 4, 4, ContributionBounds{4, 4}},
+	} {
+		ct, err := NewContributionTuner(&ContributionTunerOptions{Epsilon: 10})
+		if err != nil {
+			t.Fatalf("Couldn't initialize ContributionTuner: %v", err)
+		}
+		for i := 0; i < 1000; i++ {
+			for p := 0; p < tc.partitionsPerUser; p++ {
+				for j := 0; j < tc.contributionsPerKey; j++ {
+					ct.Add(fmt.Sprintf("user%d", i), fmt.Sprintf("partition%d", p))
+				}
+			}
+		}
+		got, err := ct.Report()
+		if err != nil {
+			t.Fatalf("Report with %s: got error %v", tc.desc, err)
+		}
+		if got.Recommended != tc.want {
+			t.Errorf("Report with %s: got recommended bounds %+v, want %+v", tc.desc, got.Recommended, tc.want)
+		}
+		// The default candidates are all the combinations of 1, 2, 4, …, 32.
+		if len(got.Evaluations) != 36 {
+			t.Errorf("Report with %s: got %d evaluations, want 36", tc.desc, len(got.Evaluations))
+		}
+	}
+}
+
+func TestContributionTunerReportWithoutContributions(t *testing.T) {
+	ct, err := NewContributionTuner(&ContributionTunerOptions{Epsilon: ln3})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ContributionTuner: %v", err)
+	}
+	if _, err := ct.Report(); err == nil {
+		t.Errorf("Report without contributions: got no error, want error")
+	}
+}
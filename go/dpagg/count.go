@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/google/differential-privacy/go/metrics"
 	"github.com/google/differential-privacy/go/noise"
 )
 
@@ -40,7 +41,7 @@ import (
 // Note: Do not use when your results may cause overflows for int64 values.
 // This aggregation is not hardened for such applications yet.
 //
-// Not thread-safe.
+// Not thread-safe. To aggregate from multiple goroutines, use ShardedCount.
 type Count struct {
 	// Parameters
 	epsilon         float64
@@ -49,20 +50,42 @@ type Count struct {
 	lInfSensitivity int64
 	Noise           noise.Noise
 	noiseKind       noise.Kind // necessary for serializing noise.Noise information
+	maxPrivacyUnits int64      // 0 if there is no public bound on the number of privacy units
 
 	// State variables
 	count       int64
 	state       aggregationState
 	noisedCount int64
+	clamped     bool // whether noisedCount was clamped to the population range
+	// Budget spent by interim releases, see ResultWithBudget.
+	spentEpsilon float64
+	spentDelta   float64
 }
 
 func countEquallyInitialized(c1, c2 *Count) bool {
-	return c1.epsilon == c2.epsilon &&
-		c1.delta == c2.delta &&
-		c1.l0Sensitivity == c2.l0Sensitivity &&
-		c1.lInfSensitivity == c2.lInfSensitivity &&
-		c1.noiseKind == c2.noiseKind &&
-		c1.state == c2.state
+	return countIncompatibleField(c1, c2) == ""
+}
+
+// countIncompatibleField returns the name of the first option with which c1
+// and c2 were initialized differently, or "" if they were initialized equally.
+func countIncompatibleField(c1, c2 *Count) string {
+	switch {
+	case c1.epsilon != c2.epsilon:
+		return "Epsilon"
+	case c1.delta != c2.delta:
+		return "Delta"
+	case c1.l0Sensitivity != c2.l0Sensitivity:
+		return "MaxPartitionsContributed"
+	case c1.lInfSensitivity != c2.lInfSensitivity:
+		return "MaxContributionsPerPartition"
+	case c1.noiseKind != c2.noiseKind:
+		return "Noise"
+	case c1.maxPrivacyUnits != c2.maxPrivacyUnits:
+		return "MaxPrivacyUnits"
+	case c1.state != c2.state:
+		return "state"
+	}
+	return ""
 }
 
 // CountOptions contains the options necessary to initialize a Count.
@@ -70,7 +93,18 @@ type CountOptions struct {
 	Epsilon                  float64     // Privacy parameter ε. Required.
 	Delta                    float64     // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
 	MaxPartitionsContributed int64       // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
-	Noise                    noise.Noise // Type of noise used. Defaults to Laplace noise.
+	Noise                    noise.Noise // Type of noise used. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+	// Public upper bound on the number of privacy units, e.g. the number of
+	// registered users. If set, Result and ComputeConfidenceInterval are
+	// restricted to the possible raw counts, see PopulationCapMetadata.
+	// Defaults to 0, in which case results are not restricted.
+	MaxPrivacyUnits int64
+	// What is protected by differential privacy, see PrivacyLevel. Defaults to
+	// UserLevel.
+	PrivacyLevel PrivacyLevel
 	// How many times may a single privacy unit contribute to a single partition?
 	// Defaults to 1. This is only needed for other aggregation functions using Count;
 	// which is why the option is not exported.
@@ -82,28 +116,35 @@ func NewCount(opt *CountOptions) (*Count, error) {
 	if opt == nil {
 		opt = &CountOptions{}
 	}
+	l0, lInf, err := opt.PrivacyLevel.contributionBounds(opt.MaxPartitionsContributed, opt.maxContributionsPerPartition)
+	if err != nil {
+		return nil, fmt.Errorf("NewCount: %w", err)
+	}
 	// Set defaults.
-	l0 := opt.MaxPartitionsContributed
 	if l0 == 0 {
 		l0 = 1
 	}
 
-	lInf := opt.maxContributionsPerPartition
 	if lInf == 0 {
 		lInf = 1
 	}
 
-	n := opt.Noise
-	if n == nil {
-		n = noise.Laplace()
-	}
+	n := noiseOrDefault(opt.Noise, opt.Rho)
 	// Check that the parameters are compatible with the noise chosen by calling
 	// the noise on some placeholder value.
-	eps, del := opt.Epsilon, opt.Delta
-	_, err := n.AddNoiseInt64(0, l0, lInf, eps, del)
+	eps, del, err := budgetFromRho(opt.Epsilon, opt.Delta, opt.Rho, n)
 	if err != nil {
 		return nil, fmt.Errorf("NewCount: %w", err)
 	}
+	_, err = n.AddNoiseInt64(0, l0, lInf, eps, del)
+	if err != nil {
+		return nil, fmt.Errorf("NewCount: %w", err)
+	}
+	// Each privacy unit adds at most lInf to the count.
+	if err := checkMaxPrivacyUnits(opt.MaxPrivacyUnits, float64(lInf), 0, 1, true); err != nil {
+		return nil, fmt.Errorf("NewCount: %w", err)
+	}
+	metrics.Default().AggregationCreated("Count")
 
 	return &Count{
 		epsilon:         eps,
@@ -112,6 +153,7 @@ func NewCount(opt *CountOptions) (*Count, error) {
 		lInfSensitivity: lInf,
 		Noise:           n,
 		noiseKind:       noise.ToKind(n),
+		maxPrivacyUnits: opt.MaxPrivacyUnits,
 		count:           0,
 		state:           defaultState,
 	}, nil
@@ -127,34 +169,59 @@ func (c *Count) Increment() error {
 // single partition from the same privacy unit.
 func (c *Count) IncrementBy(count int64) error {
 	if c.state != defaultState {
-		return fmt.Errorf("Count cannot be amended: %v", c.state.errorMessage())
+		return fmt.Errorf("Count cannot be amended: %w", c.state.transitionError(defaultState))
 	}
 	c.count += count
 	return nil
 }
 
+// Reset returns c to the state it had when it was initialized, discarding all
+// entries and any result, so that it can be reused, e.g. by a long-lived
+// service computing a new release each epoch, without initializing a new
+// Count. The privacy parameters are kept.
+//
+// Reset starts a new expenditure of the privacy budget: the results computed
+// after Reset spend the whole budget of c again, including the part spent by
+// interim releases, in addition to the results computed before Reset, and both
+// must be accounted for.
+func (c *Count) Reset() {
+	c.count = 0
+	c.noisedCount = 0
+	c.clamped = false
+	c.spentEpsilon, c.spentDelta = 0, 0
+	c.state = defaultState
+}
+
 // Merge merges c2 into c (i.e., adds to c all entries that were added to c2).
 // c2 is consumed by this operation: it may not be used after it is merged
 // into c.
+//
+// The budget spent by interim releases of c2 is deducted from the remaining
+// budget of c, see ResultWithBudget.
 func (c *Count) Merge(c2 *Count) error {
 	if e := checkMergeCount(c, c2); e != nil {
 		return e
 	}
 	c.count += c2.count
+	c.spentEpsilon += c2.spentEpsilon
+	c.spentDelta += c2.spentDelta
 	c2.state = merged
 	return nil
 }
 
 func checkMergeCount(c1, c2 *Count) error {
 	if c1.state != defaultState {
-		return fmt.Errorf("checkMergeCount: c1 cannot be merged with another Count instance: %v", c1.state.errorMessage())
+		return fmt.Errorf("checkMergeCount: c1 cannot be merged with another Count instance: %w", c1.state.transitionError(merged))
 	}
 	if c2.state != defaultState {
-		return fmt.Errorf("checkMergeCount: c2 cannot be merged with another Count instance: %v", c2.state.errorMessage())
+		return fmt.Errorf("checkMergeCount: c2 cannot be merged with another Count instance: %w", c2.state.transitionError(merged))
 	}
 
-	if !countEquallyInitialized(c1, c2) {
-		return fmt.Errorf("checkMergeCount: c1 and c2 are not compatible")
+	if field := countIncompatibleField(c1, c2); field != "" {
+		return fmt.Errorf("checkMergeCount: c1 and c2 are not compatible: %w", &IncompatibleMergeError{Field: field})
+	}
+	if err := checkSpentBudget(c1.epsilon, c1.delta, c1.spentEpsilon+c2.spentEpsilon, c1.spentDelta+c2.spentDelta); err != nil {
+		return fmt.Errorf("checkMergeCount: %w", err)
 	}
 
 	return nil
@@ -168,14 +235,93 @@ func checkMergeCount(c1, c2 *Count) error {
 // The returned value may sometimes be negative. This can be corrected by setting
 // negative results to 0. Note that such post processing introduces bias to the
 // result.
+//
+// If MaxPrivacyUnits is set, the returned value is clamped to the possible raw
+// counts, which introduces such a bias; see PopulationCapMetadata.
 func (c *Count) Result() (int64, error) {
 	if c.state != defaultState {
-		return 0, fmt.Errorf("Count's noised result cannot be computed: " + c.state.errorMessage())
+		return 0, fmt.Errorf("Count's noised result cannot be computed: %w", c.state.transitionError(resultReturned))
 	}
 	c.state = resultReturned
+	eps, del := c.remainingBudget()
 	var err error
-	c.noisedCount, err = c.Noise.AddNoiseInt64(c.count, c.l0Sensitivity, c.lInfSensitivity, c.epsilon, c.delta)
-	return c.noisedCount, err
+	c.noisedCount, err = c.Noise.AddNoiseInt64(c.count, c.l0Sensitivity, c.lInfSensitivity, eps, del)
+	if err != nil {
+		return c.noisedCount, err
+	}
+	metrics.Default().BudgetConsumed(mechanismName(c.noiseKind), eps, del)
+	recordTranscript("Count", c.noiseKind, c.l0Sensitivity, float64(c.lInfSensitivity), eps, del, float64(c.count), float64(c.noisedCount))
+	c.noisedCount, c.clamped = c.restrictToPopulation(c.noisedCount)
+	return c.noisedCount, nil
+}
+
+// restrictToPopulation clamps a noised count to the possible raw counts if
+// MaxPrivacyUnits is set, and returns whether it was clamped.
+func (c *Count) restrictToPopulation(noisedCount int64) (int64, bool) {
+	if c.maxPrivacyUnits == 0 {
+		return noisedCount, false
+	}
+	if maxCount := c.maxPrivacyUnits * c.lInfSensitivity; noisedCount > maxCount {
+		return maxCount, true
+	} else if noisedCount < 0 {
+		return 0, true
+	}
+	return noisedCount, false
+}
+
+// ResultWithBudget returns a differentially private estimate of the current
+// count that spends only the given fractions of the remaining budget of c,
+// e.g. for a monitoring system to peek at an interim value. Unlike Result, it
+// doesn't consume c: c can still be amended and queried afterwards.
+//
+// The spent budget is recorded in c, so that by sequential composition, all
+// the releases of c, including the final one computed by Result with the
+// remaining budget, spend at most the budget c was initialized with. Each
+// interim release thus increases the noise of the next ones, and of the
+// estimates of ExpectedError. The parameters of c, as compared by Merge and
+// serialized, are unchanged. epsilonFraction must be in (0, 1) and
+// deltaFraction in [0, 1); deltaFraction must be positive with Gaussian noise.
+//
+// Interim releases aren't supported with noise of a fixed scale, whose budget
+// isn't determined by the parameters of c.
+func (c *Count) ResultWithBudget(epsilonFraction, deltaFraction float64) (int64, error) {
+	if c.state != defaultState {
+		return 0, fmt.Errorf("Count's noised result cannot be computed: %w", c.state.transitionError(resultReturned))
+	}
+	if err := checkBudgetFractions(c.Noise, epsilonFraction, deltaFraction); err != nil {
+		return 0, fmt.Errorf("ResultWithBudget: %w", err)
+	}
+	remainingEps, remainingDel := c.remainingBudget()
+	eps, del := remainingEps*epsilonFraction, remainingDel*deltaFraction
+	noisedCount, err := c.Noise.AddNoiseInt64(c.count, c.l0Sensitivity, c.lInfSensitivity, eps, del)
+	if err != nil {
+		return 0, err
+	}
+	c.spentEpsilon += eps
+	c.spentDelta += del
+	metrics.Default().BudgetConsumed(mechanismName(c.noiseKind), eps, del)
+	recordTranscript("Count", c.noiseKind, c.l0Sensitivity, float64(c.lInfSensitivity), eps, del, float64(c.count), float64(noisedCount))
+	noisedCount, _ = c.restrictToPopulation(noisedCount)
+	return noisedCount, nil
+}
+
+// remainingBudget returns the budget of c left by interim releases.
+func (c *Count) remainingBudget() (epsilon, delta float64) {
+	return c.epsilon - c.spentEpsilon, c.delta - c.spentDelta
+}
+
+// PopulationCapMetadata returns how the result of c was restricted using
+// MaxPrivacyUnits. Result() needs to be called before PopulationCapMetadata,
+// otherwise this will return an error.
+func (c *Count) PopulationCapMetadata() (PopulationCapMetadata, error) {
+	if c.state != resultReturned {
+		return PopulationCapMetadata{}, fmt.Errorf("Result() must be called before calling PopulationCapMetadata()")
+	}
+	if c.maxPrivacyUnits == 0 {
+		return PopulationCapMetadata{}, nil
+	}
+	lower, upper := populationRange(c.maxPrivacyUnits, float64(c.lInfSensitivity), 0, 1)
+	return PopulationCapMetadata{MaxPrivacyUnits: c.maxPrivacyUnits, Lower: lower, Upper: upper, Clamped: c.clamped}, nil
 }
 
 // ThresholdedResult is similar to Result() but applies thresholding to the result.
@@ -185,7 +331,22 @@ func (c *Count) Result() (int64, error) {
 // Note that the nil results should not be published when the existence of a
 // partition in the output depends on private data.
 func (c *Count) ThresholdedResult(thresholdDelta float64) (*int64, error) {
-	threshold, err := c.Noise.Threshold(c.l0Sensitivity, float64(c.lInfSensitivity), c.epsilon, c.delta, thresholdDelta)
+	result, err := c.thresholdedResult(thresholdDelta)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Default().BudgetConsumed(thresholdingMechanism, 0, thresholdDelta)
+	if result == nil {
+		metrics.Default().PartitionsDropped("Count", 1)
+	}
+	return result, nil
+}
+
+// thresholdedResult is ThresholdedResult without reporting the thresholding to
+// metrics.Recorder, for aggregations thresholding a Count internally.
+func (c *Count) thresholdedResult(thresholdDelta float64) (*int64, error) {
+	eps, del := c.remainingBudget()
+	threshold, err := c.Noise.Threshold(c.l0Sensitivity, float64(c.lInfSensitivity), eps, del, thresholdDelta)
 	if err != nil {
 		return nil, err
 	}
@@ -214,15 +375,36 @@ func (c *Count) ComputeConfidenceInterval(alpha float64) (noise.ConfidenceInterv
 	if c.state != resultReturned {
 		return noise.ConfidenceInterval{}, fmt.Errorf("Result() must be called before calling ComputeConfidenceInterval()")
 	}
-	confInt, err := c.Noise.ComputeConfidenceIntervalInt64(c.noisedCount, c.l0Sensitivity, c.lInfSensitivity, c.epsilon, c.delta, alpha)
+	eps, del := c.remainingBudget()
+	confInt, err := c.Noise.ComputeConfidenceIntervalInt64(c.noisedCount, c.l0Sensitivity, c.lInfSensitivity, eps, del, alpha)
 	if err != nil {
 		return noise.ConfidenceInterval{}, err
 	}
 	// True count cannot be negative.
 	confInt.LowerBound, confInt.UpperBound = math.Max(0, confInt.LowerBound), math.Max(0, confInt.UpperBound)
+	if c.maxPrivacyUnits != 0 {
+		// Nor can it exceed the count of the whole population.
+		lower, upper := populationRange(c.maxPrivacyUnits, float64(c.lInfSensitivity), 0, 1)
+		confInt = restrictConfidenceInterval(confInt, lower, upper)
+	}
 	return confInt, nil
 }
 
+// ExpectedError returns the error e such that the noised count returned by
+// Result is within e of the true count with a probability greater than or
+// equal to 1 - alpha. It only depends on the parameters of the count and on
+// the budget left by interim releases, so it can be called at any time, e.g.
+// before adding any entry to tune the privacy parameters, and no privacy
+// budget is consumed by this operation.
+func (c *Count) ExpectedError(alpha float64) (float64, error) {
+	eps, del := c.remainingBudget()
+	confInt, err := c.Noise.ComputeConfidenceIntervalInt64(0, c.l0Sensitivity, c.lInfSensitivity, eps, del, alpha)
+	if err != nil {
+		return 0, err
+	}
+	return (confInt.UpperBound - confInt.LowerBound) / 2, nil
+}
+
 // encodableCount can be encoded by the gob package.
 type encodableCount struct {
 	Epsilon         float64
@@ -230,13 +412,16 @@ type encodableCount struct {
 	L0Sensitivity   int64
 	LInfSensitivity int64
 	NoiseKind       noise.Kind
+	MaxPrivacyUnits int64
 	Count           int64
+	SpentEpsilon    float64
+	SpentDelta      float64
 }
 
 // GobEncode encodes Count.
 func (c *Count) GobEncode() ([]byte, error) {
 	if c.state != defaultState && c.state != serialized {
-		return nil, fmt.Errorf("Count object cannot be serialized: " + c.state.errorMessage())
+		return nil, fmt.Errorf("Count object cannot be serialized: %w", c.state.transitionError(serialized))
 	}
 	enc := encodableCount{
 		Epsilon:         c.epsilon,
@@ -244,7 +429,10 @@ func (c *Count) GobEncode() ([]byte, error) {
 		L0Sensitivity:   c.l0Sensitivity,
 		LInfSensitivity: c.lInfSensitivity,
 		NoiseKind:       noise.ToKind(c.Noise),
+		MaxPrivacyUnits: c.maxPrivacyUnits,
 		Count:           c.count,
+		SpentEpsilon:    c.spentEpsilon,
+		SpentDelta:      c.spentDelta,
 	}
 	c.state = serialized
 	return encode(enc)
@@ -264,8 +452,136 @@ func (c *Count) GobDecode(data []byte) error {
 		lInfSensitivity: enc.LInfSensitivity,
 		noiseKind:       enc.NoiseKind,
 		Noise:           noise.ToNoise(enc.NoiseKind),
+		maxPrivacyUnits: enc.MaxPrivacyUnits,
 		count:           enc.Count,
+		spentEpsilon:    enc.SpentEpsilon,
+		spentDelta:      enc.SpentDelta,
+		state:           defaultState,
+	}
+	return nil
+}
+
+type jsonCountParameters struct {
+	jsonPrivacyParameters
+	LInfSensitivity int64 `json:"l_inf_sensitivity"`
+	MaxPrivacyUnits int64 `json:"max_privacy_units,omitempty"`
+}
+
+type jsonCountState struct {
+	Count        int64   `json:"count"`
+	SpentEpsilon float64 `json:"spent_epsilon,omitempty"`
+	SpentDelta   float64 `json:"spent_delta,omitempty"`
+}
+
+// MarshalJSON returns the JSON summary of c, see json_summary.go. Like
+// GobEncode, it consumes c: it may not be amended, merged or queried
+// afterwards.
+func (c *Count) MarshalJSON() ([]byte, error) {
+	if c.state != defaultState && c.state != serialized {
+		return nil, fmt.Errorf("Count object cannot be serialized: %w", c.state.transitionError(serialized))
+	}
+	params := jsonCountParameters{
+		jsonPrivacyParameters: jsonPrivacyParameters{
+			Epsilon:                  c.epsilon,
+			Delta:                    c.delta,
+			MaxPartitionsContributed: c.l0Sensitivity,
+			Noise:                    jsonNoiseKind(noise.ToKind(c.Noise)),
+		},
+		LInfSensitivity: c.lInfSensitivity,
+		MaxPrivacyUnits: c.maxPrivacyUnits,
+	}
+	c.state = serialized
+	return marshalJSONSummary("Count", params, jsonCountState{Count: c.count, SpentEpsilon: c.spentEpsilon, SpentDelta: c.spentDelta})
+}
+
+// UnmarshalJSON loads the JSON summary of a Count into c.
+func (c *Count) UnmarshalJSON(data []byte) error {
+	var params jsonCountParameters
+	var state jsonCountState
+	if err := unmarshalJSONSummary(data, "Count", &params, &state); err != nil {
+		return fmt.Errorf("couldn't decode Count from JSON: %w", err)
+	}
+	kind := noise.Kind(params.Noise)
+	*c = Count{
+		epsilon:         params.Epsilon,
+		delta:           params.Delta,
+		l0Sensitivity:   params.MaxPartitionsContributed,
+		lInfSensitivity: params.LInfSensitivity,
+		noiseKind:       kind,
+		Noise:           noise.ToNoise(kind),
+		maxPrivacyUnits: params.MaxPrivacyUnits,
+		count:           state.Count,
+		spentEpsilon:    state.SpentEpsilon,
+		spentDelta:      state.SpentDelta,
 		state:           defaultState,
 	}
 	return nil
 }
+
+// Serialize returns the partial aggregate of c as a serialized CountSummary
+// protobuf message (see proto/summary.proto). This is the format used by the C++
+// and Java libraries, so the summary can be merged into a Count of these
+// libraries (e.g., with mergeWith in Java), or loaded into a Count with
+// Deserialize.
+//
+// Like GobEncode, Serialize consumes c: it may not be amended, merged or queried
+// afterwards. Since CountSummary has no field for the budget spent by interim
+// releases, c can't be serialized after ResultWithBudget.
+func (c *Count) Serialize() ([]byte, error) {
+	if c.state != defaultState && c.state != serialized {
+		return nil, fmt.Errorf("Count object cannot be serialized: %w", c.state.transitionError(serialized))
+	}
+	if c.spentEpsilon != 0 || c.spentDelta != 0 {
+		return nil, fmt.Errorf("Count object cannot be serialized: %w", errBudgetSpent)
+	}
+	s, err := c.summary()
+	if err != nil {
+		return nil, fmt.Errorf("Count object cannot be serialized: %w", err)
+	}
+	c.state = serialized
+	return s.marshal(), nil
+}
+
+// Deserialize merges a serialized CountSummary protobuf message into c, adding
+// its count to the one accumulated so far, like Merge. The summary may have
+// been produced by Serialize or by the C++ or Java libraries.
+//
+// c must have been initialized with the same parameters as the aggregation that
+// produced the summary, and may not have been merged, serialized or queried.
+func (c *Count) Deserialize(data []byte) error {
+	if c.state != defaultState {
+		return fmt.Errorf("Count object cannot be deserialized: %w", c.state.transitionError(defaultState))
+	}
+	var s countSummary
+	if err := s.unmarshal(data); err != nil {
+		return fmt.Errorf("couldn't deserialize Count: %w", err)
+	}
+	want, err := c.summary()
+	if err != nil {
+		return fmt.Errorf("couldn't deserialize Count: %w", err)
+	}
+	if err := s.checkParameters(want); err != nil {
+		return fmt.Errorf("couldn't deserialize Count, summary is not compatible: %w", err)
+	}
+	c.count += s.count
+	return nil
+}
+
+func (c *Count) summary() (*countSummary, error) {
+	l0, err := toInt32("MaxPartitionsContributed", c.l0Sensitivity)
+	if err != nil {
+		return nil, err
+	}
+	lInf, err := toInt32("MaxContributionsPerPartition", c.lInfSensitivity)
+	if err != nil {
+		return nil, err
+	}
+	return &countSummary{
+		count:                        c.count,
+		epsilon:                      c.epsilon,
+		delta:                        c.delta,
+		mechanismType:                toMechanismType(c.noiseKind),
+		maxPartitionsContributed:     l0,
+		maxContributionsPerPartition: lInf,
+	}, nil
+}
@@ -238,3 +238,35 @@ func TestCountComputeConfidenceInterval_StateChecks(t *testing.T) {
 		}
 	}
 }
+
+// Tests that Count.ExpectedError() is half the width of the confidence interval of the noise, and
+// that it can be called before adding any entry.
+func TestCountExpectedError(t *testing.T) {
+	for _, tc := range []struct {
+		n     noise.Noise
+		delta float64
+	}{
+		{noise.Gaussian(), arbitraryDelta},
+		{noise.Laplace(), 0.0},
+	} {
+		count := getCount(t, tc.n)
+		got, err := count.ExpectedError(arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, ExpectedError: got error %v", tc.n, err)
+		}
+		noiseConfInt, err := tc.n.ComputeConfidenceIntervalInt64(1000, arbitraryMaxPartitionsContributed, 1, arbitraryEpsilon, tc.delta, arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, couldn't compute confidence interval: %v", tc.n, err)
+		}
+		if want := (noiseConfInt.UpperBound - noiseConfInt.LowerBound) / 2; got != want {
+			t.Errorf("With %v, ExpectedError: got %f, want %f", tc.n, got, want)
+		}
+		// ExpectedError doesn't consume the count.
+		if err := count.Increment(); err != nil {
+			t.Errorf("With %v, Increment after ExpectedError: got error %v", tc.n, err)
+		}
+		if _, err := count.ExpectedError(-1); err == nil {
+			t.Errorf("With %v, ExpectedError with a negative alpha: got no error, want error", tc.n)
+		}
+	}
+}
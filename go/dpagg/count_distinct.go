@@ -0,0 +1,148 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// CountDistinct calculates a differentially private count of the distinct
+// privacy units (e.g. users) of a collection, using the Laplace or Gaussian
+// mechanism.
+//
+// Unlike Count, contributions are identified by the ID of their privacy unit,
+// and a privacy unit is counted at most once however many times it is added,
+// including across merged CountDistinct instances. The IDs are kept in memory
+// until the result is computed.
+//
+// It supports privacy units that contribute to multiple partitions (via the
+// MaxPartitionsContributed parameter) by scaling the added noise appropriately.
+//
+// Not thread-safe.
+type CountDistinct struct {
+	// Parameters
+	count *Count
+
+	// State variables
+	ids   map[string]bool
+	state aggregationState
+}
+
+// CountDistinctOptions contains the options necessary to initialize a
+// CountDistinct.
+type CountDistinctOptions struct {
+	Epsilon                  float64     // Privacy parameter ε. Required.
+	Delta                    float64     // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed int64       // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	Noise                    noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewCountDistinct returns a new CountDistinct, with no privacy units.
+func NewCountDistinct(opt *CountDistinctOptions) (*CountDistinct, error) {
+	if opt == nil {
+		opt = &CountDistinctOptions{}
+	}
+	c, err := NewCount(&CountOptions{
+		Epsilon:                  opt.Epsilon,
+		Delta:                    opt.Delta,
+		MaxPartitionsContributed: opt.MaxPartitionsContributed,
+		Noise:                    opt.Noise,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NewCountDistinct: %w", err)
+	}
+	return &CountDistinct{
+		count: c,
+		ids:   make(map[string]bool),
+		state: defaultState,
+	}, nil
+}
+
+// Add adds the privacy unit with the given ID, if it hasn't been added yet.
+func (cd *CountDistinct) Add(id string) error {
+	if cd.state != defaultState {
+		return fmt.Errorf("CountDistinct cannot be amended: %w", cd.state.transitionError(defaultState))
+	}
+	cd.ids[id] = true
+	return nil
+}
+
+// Merge merges cd2 into cd (i.e., adds to cd all privacy units that were added
+// to cd2, privacy units added to both being counted once). cd2 is consumed by
+// this operation: it may not be used after it is merged into cd.
+func (cd *CountDistinct) Merge(cd2 *CountDistinct) error {
+	if err := checkMergeCountDistinct(cd, cd2); err != nil {
+		return err
+	}
+	for id := range cd2.ids {
+		cd.ids[id] = true
+	}
+	cd2.state = merged
+	return nil
+}
+
+func checkMergeCountDistinct(cd1, cd2 *CountDistinct) error {
+	if cd1.state != defaultState {
+		return fmt.Errorf("checkMergeCountDistinct: cd1 cannot be merged with another CountDistinct instance: %w", cd1.state.transitionError(merged))
+	}
+	if cd2.state != defaultState {
+		return fmt.Errorf("checkMergeCountDistinct: cd2 cannot be merged with another CountDistinct instance: %w", cd2.state.transitionError(merged))
+	}
+	if field := countIncompatibleField(cd1.count, cd2.count); field != "" {
+		return fmt.Errorf("checkMergeCountDistinct: cd1 and cd2 are not compatible: %w", &IncompatibleMergeError{Field: field})
+	}
+	return nil
+}
+
+// Result returns a differentially private estimate of the number of distinct
+// privacy units. The method can be called only once.
+//
+// The returned value is an unbiased estimate of the raw count, and may
+// sometimes be negative.
+func (cd *CountDistinct) Result() (int64, error) {
+	if cd.state != defaultState {
+		return 0, fmt.Errorf("CountDistinct's noised result cannot be computed: %w", cd.state.transitionError(resultReturned))
+	}
+	cd.state = resultReturned
+	if err := cd.count.IncrementBy(int64(len(cd.ids))); err != nil {
+		return 0, err
+	}
+	return cd.count.Result()
+}
+
+// ThresholdedResult is similar to Result() but applies thresholding to the
+// result, see Count.ThresholdedResult.
+func (cd *CountDistinct) ThresholdedResult(thresholdDelta float64) (*int64, error) {
+	if cd.state != defaultState {
+		return nil, fmt.Errorf("CountDistinct's noised result cannot be computed: %w", cd.state.transitionError(resultReturned))
+	}
+	cd.state = resultReturned
+	if err := cd.count.IncrementBy(int64(len(cd.ids))); err != nil {
+		return nil, err
+	}
+	return cd.count.ThresholdedResult(thresholdDelta)
+}
+
+// ComputeConfidenceInterval computes a confidence interval that contains the
+// true number of distinct privacy units with a probability greater than or
+// equal to 1 - alpha, see Count.ComputeConfidenceInterval. Result() needs to be
+// called before ComputeConfidenceInterval.
+func (cd *CountDistinct) ComputeConfidenceInterval(alpha float64) (noise.ConfidenceInterval, error) {
+	return cd.count.ComputeConfidenceInterval(alpha)
+}
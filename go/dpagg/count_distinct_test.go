@@ -0,0 +1,106 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func getNoiselessCountDistinct(t *testing.T) *CountDistinct {
+	t.Helper()
+	cd, err := NewCountDistinct(&CountDistinctOptions{Epsilon: ln3, MaxPartitionsContributed: 1, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize count distinct: %v", err)
+	}
+	return cd
+}
+
+func TestNewCountDistinctInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *CountDistinctOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &CountDistinctOptions{MaxPartitionsContributed: 1}},
+		{"negative MaxPartitionsContributed", &CountDistinctOptions{Epsilon: ln3, MaxPartitionsContributed: -1}},
+		{"non-zero delta with Laplace noise", &CountDistinctOptions{Epsilon: ln3, Delta: 1e-5, Noise: noise.Laplace()}},
+	} {
+		if _, err := NewCountDistinct(tc.opts); err == nil {
+			t.Errorf("NewCountDistinct: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestCountDistinctDeduplicates(t *testing.T) {
+	cd := getNoiselessCountDistinct(t)
+	for _, id := range []string{"a", "b", "a", "c", "b", "a"} {
+		if err := cd.Add(id); err != nil {
+			t.Fatalf("Couldn't add id %s: %v", id, err)
+		}
+	}
+	got, err := cd.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("Result: got %d, want 3", got)
+	}
+	if err := cd.Add("d"); err == nil {
+		t.Errorf("Add: after Result got no error, want error")
+	}
+	if _, err := cd.Result(); err == nil {
+		t.Errorf("Result: calling Result twice got no error, want error")
+	}
+}
+
+func TestCountDistinctMerge(t *testing.T) {
+	cd1 := getNoiselessCountDistinct(t)
+	cd2 := getNoiselessCountDistinct(t)
+	for _, id := range []string{"a", "b"} {
+		cd1.Add(id)
+	}
+	for _, id := range []string{"b", "c", "d"} {
+		cd2.Add(id)
+	}
+	if err := cd1.Merge(cd2); err != nil {
+		t.Fatalf("Couldn't merge cd1 and cd2: %v", err)
+	}
+	got, err := cd1.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	// "b" is counted once.
+	if got != 4 {
+		t.Errorf("Merge: got %d, want 4", got)
+	}
+	if cd2.state != merged {
+		t.Errorf("Merge: when merging cd2 into cd1 got cd2.state %v, want Merged", cd2.state)
+	}
+}
+
+func TestCheckMergeCountDistinctCompatibility(t *testing.T) {
+	cd1 := getNoiselessCountDistinct(t)
+	cd2, err := NewCountDistinct(&CountDistinctOptions{Epsilon: ln3, MaxPartitionsContributed: 2, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize cd2: %v", err)
+	}
+	if err := checkMergeCountDistinct(cd1, cd2); err == nil {
+		t.Errorf("checkMergeCountDistinct: when MaxPartitionsContributed are different got no error, want error")
+	}
+}
@@ -17,11 +17,15 @@
 package dpagg
 
 import (
+	"encoding/json"
+	"errors"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
 	"github.com/google/go-cmp/cmp"
 	"github.com/grd/stat"
 )
@@ -101,6 +105,7 @@ func compareCount(c1, c2 *Count) bool {
 		c1.lInfSensitivity == c2.lInfSensitivity &&
 		c1.Noise == c2.Noise &&
 		c1.noiseKind == c2.noiseKind &&
+		c1.maxPrivacyUnits == c2.maxPrivacyUnits &&
 		c1.count == c2.count &&
 		c1.state == c2.state
 }
@@ -121,6 +126,10 @@ func TestCountSerialization(t *testing.T) {
 			MaxPartitionsContributed: 5,
 			Noise:                    noise.Gaussian(),
 		}},
+		{"MaxPrivacyUnits", &CountOptions{
+			Epsilon:         ln3,
+			MaxPrivacyUnits: 1000,
+		}},
 	} {
 		c, err := NewCount(tc.opts)
 		if err != nil {
@@ -148,6 +157,56 @@ func TestCountSerialization(t *testing.T) {
 	}
 }
 
+// registeredNoise is a noise registered with noise.Register.
+type registeredNoise struct {
+	noNoise
+}
+
+func TestCountSerializationRegisteredNoise(t *testing.T) {
+	kind, err := noise.Register("dpagg_test_registered_noise", registeredNoise{})
+	if err != nil {
+		t.Fatalf("Couldn't register noise: %v", err)
+	}
+	c, err := NewCount(&CountOptions{Epsilon: ln3, Noise: registeredNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize c: %v", err)
+	}
+	c.IncrementBy(7)
+	bytes, err := encode(c)
+	if err != nil {
+		t.Fatalf("encode(Count) error: %v", err)
+	}
+	cUnmarshalled := new(Count)
+	if err := decode(cUnmarshalled, bytes); err != nil {
+		t.Fatalf("decode(Count) error: %v", err)
+	}
+	if cUnmarshalled.noiseKind != kind || cUnmarshalled.Noise != (registeredNoise{}) {
+		t.Errorf("decode(encode(_)): got noise %v of kind %v, want registeredNoise of kind %v", cUnmarshalled.Noise, cUnmarshalled.noiseKind, kind)
+	}
+	if got, err := cUnmarshalled.Result(); err != nil || got != 7 {
+		t.Errorf("Result: got (%d, %v), want (7, nil)", got, err)
+	}
+
+	c, err = NewCount(&CountOptions{Epsilon: ln3, Noise: registeredNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize c: %v", err)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("json.Marshal: got error %v", err)
+	}
+	if !strings.Contains(string(b), `"dpagg_test_registered_noise"`) {
+		t.Errorf("json.Marshal: got %s, want the registered name of the noise", b)
+	}
+	cUnmarshalled = new(Count)
+	if err := json.Unmarshal(b, cUnmarshalled); err != nil {
+		t.Fatalf("json.Unmarshal: got error %v", err)
+	}
+	if cUnmarshalled.noiseKind != kind {
+		t.Errorf("json.Unmarshal(json.Marshal(_)): got noise kind %v, want %v", cUnmarshalled.noiseKind, kind)
+	}
+}
+
 // Tests that GobEncode() returns errors correctly with different Count aggregation states.
 func TestCountSerializationStateChecks(t *testing.T) {
 	for _, tc := range []struct {
@@ -753,3 +812,386 @@ func TestCountIsUnbiased(t *testing.T) {
 		}
 	}
 }
+
+func TestCountWithRho(t *testing.T) {
+	c, err := NewCount(&CountOptions{Rho: 0.5, MaxPartitionsContributed: 4})
+	if err != nil {
+		t.Fatalf("Couldn't initialize count: %v", err)
+	}
+	if c.Noise != noise.Gaussian() {
+		t.Errorf("NewCount with Rho: got noise %v, want Gaussian noise by default", c.Noise)
+	}
+	// The Gaussian noise calibrated to the converted budget has the standard
+	// deviation required for ρ-zCDP.
+	want := noise.SigmaForRho(4, 1, 0.5)
+	if got := noise.SigmaForGaussian(c.l0Sensitivity, float64(c.lInfSensitivity), c.epsilon, c.delta); math.Abs(got-want) > 2e-3*want {
+		t.Errorf("NewCount with Rho: got σ = %f, want %f", got, want)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		opts *CountOptions
+	}{
+		{"Rho and Epsilon", &CountOptions{Rho: 0.5, Epsilon: 1}},
+		{"Rho and Laplace noise", &CountOptions{Rho: 0.5, Noise: noise.Laplace()}},
+		{"negative Rho", &CountOptions{Rho: -1}},
+	} {
+		if _, err := NewCount(tc.opts); err == nil {
+			t.Errorf("NewCount: with %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+// Tests that a Count using noise with a seeded source is reproducible, e.g. for
+// golden tests.
+func TestCountWithSeededNoiseIsReproducible(t *testing.T) {
+	seed := rand.NewSeed()
+	var results [2]int64
+	for i := range results {
+		r, err := rand.NewRand(seed)
+		if err != nil {
+			t.Fatalf("NewRand: got error %v", err)
+		}
+		n, err := noise.WithSource(noise.Laplace(), r)
+		if err != nil {
+			t.Fatalf("WithSource: got error %v", err)
+		}
+		c, err := NewCount(&CountOptions{Epsilon: ln3, Noise: n})
+		if err != nil {
+			t.Fatalf("Couldn't initialize count: %v", err)
+		}
+		c.IncrementBy(100)
+		results[i], err = c.Result()
+		if err != nil {
+			t.Fatalf("Result: got error %v", err)
+		}
+	}
+	if results[0] != results[1] {
+		t.Errorf("Result with noise seeded twice with the same seed: got %d and %d, want equal results", results[0], results[1])
+	}
+}
+
+// Tests that a Count can use noise of a fixed scale, calibrated outside of
+// the library, without a privacy budget.
+func TestCountWithFixedScaleNoise(t *testing.T) {
+	n, err := noise.GaussianWithStddev(2)
+	if err != nil {
+		t.Fatalf("GaussianWithStddev: got error %v", err)
+	}
+	c, err := NewCount(&CountOptions{Noise: n})
+	if err != nil {
+		t.Fatalf("Couldn't initialize count without a budget: %v", err)
+	}
+	c.IncrementBy(100)
+	if _, err := c.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	stdDev, err := NoiseStandardDeviation(n, 1, 1, 0, 0)
+	if err != nil {
+		t.Fatalf("NoiseStandardDeviation: got error %v", err)
+	}
+	if stdDev != 2 {
+		t.Errorf("NoiseStandardDeviation: got %f, want 2", stdDev)
+	}
+}
+
+func TestCountReset(t *testing.T) {
+	c := getNoiselessCount(t)
+	c.IncrementBy(5)
+	if _, err := c.Result(); err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	c.Reset()
+	// The count can be amended again, and only counts the entries added after Reset.
+	if err := c.IncrementBy(3); err != nil {
+		t.Fatalf("Couldn't increment count after Reset: %v", err)
+	}
+	got, err := c.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result after Reset: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("Result after Reset: got %d, want 3", got)
+	}
+}
+
+// Tests that a Count decoded on another worker can be merged with local counts.
+func TestCountSerializeShipMerge(t *testing.T) {
+	shipped := getNoiselessCount(t)
+	shipped.IncrementBy(3)
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode(Count) error: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode(Count) error: %v", err)
+	}
+	received := new(Count)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode(Count) error: %v", err)
+	}
+	local := getNoiselessCount(t)
+	local.IncrementBy(2)
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded Count: got error %v", err)
+	}
+	if err := received.Increment(); err != nil {
+		t.Fatalf("Increment of a decoded Count: got error %v", err)
+	}
+	if received.count != 6 {
+		t.Errorf("count after merging a decoded Count: got %d, want 6", received.count)
+	}
+}
+
+func TestCountMaxPrivacyUnits(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		count       int64
+		want        int64
+		wantClamped bool
+	}{
+		{"count within the population", 7, 7, false},
+		{"count above the population", 15, 10, true},
+		{"negative count", -3, 0, true},
+	} {
+		c, err := NewCount(&CountOptions{Epsilon: ln3, MaxPrivacyUnits: 10, Noise: noNoise{}})
+		if err != nil {
+			t.Fatalf("Couldn't initialize Count: %v", err)
+		}
+		c.IncrementBy(tc.count)
+		got, err := c.Result()
+		if err != nil {
+			t.Fatalf("Result for %s: got error %v", tc.desc, err)
+		}
+		if got != tc.want {
+			t.Errorf("Result for %s: got %d, want %d", tc.desc, got, tc.want)
+		}
+		metadata, err := c.PopulationCapMetadata()
+		if err != nil {
+			t.Fatalf("PopulationCapMetadata for %s: got error %v", tc.desc, err)
+		}
+		want := PopulationCapMetadata{MaxPrivacyUnits: 10, Lower: 0, Upper: 10, Clamped: tc.wantClamped}
+		if metadata != want {
+			t.Errorf("PopulationCapMetadata for %s: got %+v, want %+v", tc.desc, metadata, want)
+		}
+	}
+}
+
+func TestCountMaxPrivacyUnitsConfidenceInterval(t *testing.T) {
+	c, err := NewCount(&CountOptions{
+		Epsilon:         ln3,
+		MaxPrivacyUnits: 10,
+		Noise:           getMockConfInt(noise.ConfidenceInterval{LowerBound: -3, UpperBound: 25}),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	if _, err := c.PopulationCapMetadata(); err == nil {
+		t.Errorf("PopulationCapMetadata before Result: got no error, want error")
+	}
+	c.IncrementBy(8)
+	if _, err := c.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	got, err := c.ComputeConfidenceInterval(arbitraryAlpha)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceInterval: got error %v", err)
+	}
+	want := noise.ConfidenceInterval{LowerBound: 0, UpperBound: 10}
+	if got != want {
+		t.Errorf("ComputeConfidenceInterval: got %+v, want %+v", got, want)
+	}
+}
+
+func TestCountMaxPrivacyUnitsInvalid(t *testing.T) {
+	for _, maxPrivacyUnits := range []int64{-1, math.MaxInt64} {
+		if _, err := NewCount(&CountOptions{Epsilon: ln3, MaxPrivacyUnits: maxPrivacyUnits, maxContributionsPerPartition: 2}); err == nil {
+			t.Errorf("NewCount with MaxPrivacyUnits = %d: got no error, want error", maxPrivacyUnits)
+		}
+	}
+}
+
+func TestCountMaxPrivacyUnitsMerge(t *testing.T) {
+	c1, err := NewCount(&CountOptions{Epsilon: ln3, MaxPrivacyUnits: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize c1: %v", err)
+	}
+	c2, err := NewCount(&CountOptions{Epsilon: ln3})
+	if err != nil {
+		t.Fatalf("Couldn't initialize c2: %v", err)
+	}
+	if err := c1.Merge(c2); err == nil {
+		t.Errorf("Merge of Counts with different MaxPrivacyUnits: got no error, want error")
+	}
+}
+
+func TestCountResultWithBudget(t *testing.T) {
+	c := getNoiselessCount(t)
+	c.IncrementBy(5)
+	got, err := c.ResultWithBudget(0.25, 0.5)
+	if err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	if got != 5 {
+		t.Errorf("ResultWithBudget: got %d, want 5", got)
+	}
+	// The interim release spent a quarter of the budget, and c can still be
+	// amended and released. The parameters of c are unchanged.
+	if eps, del := c.remainingBudget(); !ApproxEqual(eps, 0.75*ln3) || !ApproxEqual(del, 0.5*tenten) {
+		t.Errorf("ResultWithBudget: got remaining budget (%e, %e), want (%e, %e)", eps, del, 0.75*ln3, 0.5*tenten)
+	}
+	if c.epsilon != ln3 || c.delta != tenten {
+		t.Errorf("ResultWithBudget: got parameters (%e, %e), want (%e, %e)", c.epsilon, c.delta, ln3, tenten)
+	}
+	c.Increment()
+	if _, err := c.ResultWithBudget(0.5, 0.5); err != nil {
+		t.Fatalf("ResultWithBudget called twice: got error %v", err)
+	}
+	if eps, _ := c.remainingBudget(); !ApproxEqual(eps, 0.375*ln3) {
+		t.Errorf("ResultWithBudget called twice: got remaining epsilon %e, want %e", eps, 0.375*ln3)
+	}
+	if got, err := c.Result(); err != nil || got != 6 {
+		t.Errorf("Result after ResultWithBudget: got (%d, %v), want (6, nil)", got, err)
+	}
+	if _, err := c.ResultWithBudget(0.5, 0.5); err == nil {
+		t.Errorf("ResultWithBudget after Result: got no error, want error")
+	}
+}
+
+func TestCountResultWithBudgetInvalidFractions(t *testing.T) {
+	fixedScale, err := noise.LaplaceWithScale(1)
+	if err != nil {
+		t.Fatalf("Couldn't initialize noise: %v", err)
+	}
+	for _, tc := range []struct {
+		desc                           string
+		noise                          noise.Noise
+		epsilonFraction, deltaFraction float64
+	}{
+		{"zero epsilonFraction", noNoise{}, 0, 0.5},
+		{"epsilonFraction of 1", noNoise{}, 1, 0.5},
+		{"negative deltaFraction", noNoise{}, 0.5, -0.5},
+		{"deltaFraction of 1", noNoise{}, 0.5, 1},
+		{"NaN epsilonFraction", noNoise{}, math.NaN(), 0.5},
+		{"fixed scale noise", fixedScale, 0.5, 0},
+	} {
+		c, err := NewCount(&CountOptions{Epsilon: ln3, Noise: tc.noise})
+		if err != nil {
+			t.Fatalf("Couldn't initialize Count: %v", err)
+		}
+		if _, err := c.ResultWithBudget(tc.epsilonFraction, tc.deltaFraction); err == nil {
+			t.Errorf("ResultWithBudget with %s: got no error, want error", tc.desc)
+		}
+		if c.spentEpsilon != 0 {
+			t.Errorf("ResultWithBudget with %s: got spent epsilon %e, want 0", tc.desc, c.spentEpsilon)
+		}
+	}
+}
+
+// Tests that a Count can be merged with an untouched Count after an interim
+// release, and that the merged Count keeps the budget spent by both.
+func TestCountResultWithBudgetMerge(t *testing.T) {
+	c1, c2, c3 := getNoiselessCount(t), getNoiselessCount(t), getNoiselessCount(t)
+	if _, err := c1.ResultWithBudget(0.5, 0.5); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	if _, err := c2.ResultWithBudget(0.25, 0); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	if err := c1.Merge(c3); err != nil {
+		t.Fatalf("Merge with an untouched Count: got error %v", err)
+	}
+	if err := c1.Merge(c2); err != nil {
+		t.Fatalf("Merge with a partially released Count: got error %v", err)
+	}
+	if eps, _ := c1.remainingBudget(); !ApproxEqual(eps, 0.25*ln3) {
+		t.Errorf("Merge: got remaining epsilon %e, want %e", eps, 0.25*ln3)
+	}
+	// Interim releases of merged Counts can't spend more than the budget.
+	c4, c5 := getNoiselessCount(t), getNoiselessCount(t)
+	c4.ResultWithBudget(0.75, 0)
+	c5.ResultWithBudget(0.5, 0)
+	if err := c4.Merge(c5); err == nil {
+		t.Errorf("Merge of Counts that spent their whole budget: got no error, want error")
+	}
+}
+
+// Tests that the budget spent by an interim release is serialized as state,
+// while the serialized parameters are the ones c was initialized with.
+func TestCountResultWithBudgetIsSerialized(t *testing.T) {
+	c := getNoiselessCount(t)
+	if _, err := c.ResultWithBudget(0.5, 0.5); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	checkpoint, err := c.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: got error %v", err)
+	}
+	decoded := new(Count)
+	if err := decoded.GobDecode(checkpoint); err != nil {
+		t.Fatalf("GobDecode: got error %v", err)
+	}
+	if decoded.epsilon != ln3 || !ApproxEqual(decoded.spentEpsilon, 0.5*ln3) {
+		t.Errorf("GobDecode(Checkpoint()): got epsilon %e and spent epsilon %e, want %e and %e", decoded.epsilon, decoded.spentEpsilon, ln3, 0.5*ln3)
+	}
+	restored := getNoiselessCount(t)
+	if err := restored.Restore(checkpoint); err != nil {
+		t.Fatalf("Restore: got error %v", err)
+	}
+	if !ApproxEqual(restored.spentEpsilon, 0.5*ln3) {
+		t.Errorf("Restore: got spent epsilon %e, want %e", restored.spentEpsilon, 0.5*ln3)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("MarshalJSON: got error %v", err)
+	}
+	unmarshaled := new(Count)
+	if err := json.Unmarshal(data, unmarshaled); err != nil {
+		t.Fatalf("UnmarshalJSON: got error %v", err)
+	}
+	if unmarshaled.epsilon != ln3 || !ApproxEqual(unmarshaled.spentEpsilon, 0.5*ln3) {
+		t.Errorf("UnmarshalJSON(MarshalJSON()): got epsilon %e and spent epsilon %e, want %e and %e", unmarshaled.epsilon, unmarshaled.spentEpsilon, ln3, 0.5*ln3)
+	}
+	// Protobuf summaries have no field for the spent budget.
+	if _, err := getNoiselessCount(t).Serialize(); err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	c = getNoiselessCount(t)
+	c.ResultWithBudget(0.5, 0.5)
+	if _, err := c.Serialize(); !errors.Is(err, errBudgetSpent) {
+		t.Errorf("Serialize after ResultWithBudget: got error %v, want %v", err, errBudgetSpent)
+	}
+}
+
+func TestCountResetRestoresBudget(t *testing.T) {
+	c := getNoiselessCount(t)
+	if _, err := c.ResultWithBudget(0.5, 0.5); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	c.Reset()
+	if eps, del := c.remainingBudget(); eps != ln3 || del != tenten {
+		t.Errorf("Reset: got remaining budget (%e, %e), want (%e, %e)", eps, del, ln3, tenten)
+	}
+}
+
+func TestCountResultWithBudgetNoise(t *testing.T) {
+	// The variance of Laplace noise with ε = ln3 / 2 is 2·(2/ln3)².
+	const numSamples = 20000
+	samples := make(stat.Float64Slice, numSamples)
+	for i := range samples {
+		c, err := NewCount(&CountOptions{Epsilon: ln3})
+		if err != nil {
+			t.Fatalf("Couldn't initialize Count: %v", err)
+		}
+		got, err := c.ResultWithBudget(0.5, 0)
+		if err != nil {
+			t.Fatalf("ResultWithBudget: got error %v", err)
+		}
+		samples[i] = float64(got)
+	}
+	want := 2 * (2 / ln3) * (2 / ln3)
+	if got := stat.Variance(samples); math.Abs(got-want) > 0.1*want {
+		t.Errorf("ResultWithBudget: got noise variance %f, want %f", got, want)
+	}
+}
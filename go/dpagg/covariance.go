@@ -0,0 +1,330 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// BoundedCovariance calculates a differentially private covariance and
+// correlation of a collection of pairs (x, y) of float64 values, e.g. two
+// metrics of the same privacy unit.
+//
+// Like BoundedVariance, the statistics are computed by post-processing noisy
+// sums of the entries normalized relative to the midpoints m_x and m_y of
+// [LowerX, UpperX] and [LowerY, UpperY]: a count c, the sums s_x and s_y of
+// x - m_x and y - m_y, the sum s_xy of their products and the sums s_xx and
+// s_yy of their squares. The covariance is s_xy/c - (s_x/c)(s_y/c), since the
+// covariance is invariant to translation, and the correlation is the
+// covariance divided by the product of the standard deviations. The budget is
+// split equally between the six aggregations.
+//
+// BoundedCovariance supports privacy units that contribute to multiple
+// partitions (via the MaxPartitionsContributed parameter) as well as
+// contribute to the same partition multiple times (via the
+// MaxContributionsPerPartition parameter), by scaling the added noise
+// appropriately.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Note: Do not use when your results may cause overflows for float64 values. This
+// aggregation is not hardened for such applications yet.
+//
+// Not thread-safe.
+type BoundedCovariance struct {
+	// Parameters
+	lowerX, upperX float64
+	lowerY, upperY float64
+	// The midpoints between the lower and upper bounds.
+	midPointX, midPointY float64
+
+	// State variables
+	count                   *Count
+	normalizedSumX          *BoundedSumFloat64
+	normalizedSumY          *BoundedSumFloat64
+	normalizedSumOfProducts *BoundedSumFloat64
+	normalizedSumOfSquaresX *BoundedSumFloat64
+	normalizedSumOfSquaresY *BoundedSumFloat64
+	state                   aggregationState
+}
+
+// BoundedCovarianceOptions contains the options necessary to initialize a BoundedCovariance.
+type BoundedCovarianceOptions struct {
+	Epsilon                      float64 // Privacy parameter ε. Required.
+	Delta                        float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed     int64   // How many distinct partitions may a single user contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64   // How many pairs may a single user contribute to a single partition? Required.
+	// Bounds for clamping the x and y coordinates of the pairs. Default to 0;
+	// must be such that LowerX < UpperX and LowerY < UpperY.
+	LowerX, UpperX float64
+	LowerY, UpperY float64
+	Noise          noise.Noise // Type of noise used in BoundedCovariance. Defaults to Laplace noise.
+}
+
+// BoundedCovarianceResult contains the statistics computed by
+// BoundedCovariance.
+type BoundedCovarianceResult struct {
+	Count        int64
+	MeanX, MeanY float64
+	// VarianceX and VarianceY are clamped like the result of BoundedVariance.
+	VarianceX, VarianceY float64
+	// Covariance is clamped to [-√(v_x·v_y), √(v_x·v_y)], where v_x and v_y are
+	// the largest possible variances of x and y.
+	Covariance float64
+	// Correlation is Pearson's correlation coefficient, clamped to [-1, 1]. It
+	// is 0 if VarianceX or VarianceY is 0.
+	Correlation float64
+}
+
+// NewBoundedCovariance returns a new BoundedCovariance.
+func NewBoundedCovariance(opt *BoundedCovarianceOptions) (*BoundedCovariance, error) {
+	if opt == nil {
+		opt = &BoundedCovarianceOptions{}
+	}
+
+	maxContributionsPerPartition := opt.MaxContributionsPerPartition
+	if err := checks.CheckMaxContributionsPerPartition(maxContributionsPerPartition); err != nil {
+		return nil, fmt.Errorf("NewBoundedCovariance: %w", err)
+	}
+
+	// Set defaults.
+	maxPartitionsContributed := opt.MaxPartitionsContributed
+	if maxPartitionsContributed == 0 {
+		maxPartitionsContributed = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	// Check bounds & use them to compute L_∞ sensitivities.
+	for _, bounds := range []struct {
+		name         string
+		lower, upper float64
+	}{
+		{"X", opt.LowerX, opt.UpperX},
+		{"Y", opt.LowerY, opt.UpperY},
+	} {
+		if err := checks.CheckBoundsNotDefault(bounds.lower, bounds.upper); err != nil {
+			return nil, fmt.Errorf("NewBoundedCovariance: bounds of %s: %w", bounds.name, err)
+		}
+		if err := checks.CheckBoundsFloat64(bounds.lower, bounds.upper); err != nil {
+			return nil, fmt.Errorf("NewBoundedCovariance: bounds of %s: %w", bounds.name, err)
+		}
+		if err := checks.CheckBoundsNotEqual(bounds.lower, bounds.upper); err != nil {
+			return nil, fmt.Errorf("NewBoundedCovariance: bounds of %s: %w", bounds.name, err)
+		}
+	}
+	// (lower + upper) / 2 may cause an overflow if lower and upper are large values.
+	midPointX := opt.LowerX + (opt.UpperX-opt.LowerX)/2.0
+	midPointY := opt.LowerY + (opt.UpperY-opt.LowerY)/2.0
+	maxDistX := opt.UpperX - midPointX
+	maxDistY := opt.UpperY - midPointY
+
+	// The budget is split equally between the count and the five normalized sums.
+	eps, del := opt.Epsilon/6, opt.Delta/6
+
+	bc := &BoundedCovariance{
+		lowerX:    opt.LowerX,
+		upperX:    opt.UpperX,
+		lowerY:    opt.LowerY,
+		upperY:    opt.UpperY,
+		midPointX: midPointX,
+		midPointY: midPointY,
+		state:     defaultState,
+	}
+	var err error
+	bc.count, err = NewCount(&CountOptions{
+		Epsilon:                      eps,
+		Delta:                        del,
+		MaxPartitionsContributed:     maxPartitionsContributed,
+		Noise:                        n,
+		maxContributionsPerPartition: maxContributionsPerPartition,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize count for NewBoundedCovariance: %w", err)
+	}
+	newSum := func(name string, lower, upper float64) (*BoundedSumFloat64, error) {
+		bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
+			Epsilon:                      eps,
+			Delta:                        del,
+			MaxPartitionsContributed:     maxPartitionsContributed,
+			Lower:                        lower,
+			Upper:                        upper,
+			Noise:                        n,
+			maxContributionsPerPartition: maxContributionsPerPartition,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize %s for NewBoundedCovariance: %w", name, err)
+		}
+		return bs, nil
+	}
+	if bc.normalizedSumX, err = newSum("normalized sum of x", -maxDistX, maxDistX); err != nil {
+		return nil, err
+	}
+	if bc.normalizedSumY, err = newSum("normalized sum of y", -maxDistY, maxDistY); err != nil {
+		return nil, err
+	}
+	if bc.normalizedSumOfProducts, err = newSum("normalized sum of products", -maxDistX*maxDistY, maxDistX*maxDistY); err != nil {
+		return nil, err
+	}
+	if bc.normalizedSumOfSquaresX, err = newSum("normalized sum of squares of x", 0, maxDistX*maxDistX); err != nil {
+		return nil, err
+	}
+	if bc.normalizedSumOfSquaresY, err = newSum("normalized sum of squares of y", 0, maxDistY*maxDistY); err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// Add adds a pair (x, y) to a BoundedCovariance. It skips pairs with a NaN
+// coordinate and doesn't count them in the final result, like BoundedVariance.
+func (bc *BoundedCovariance) Add(x, y float64) error {
+	if bc.state != defaultState {
+		return fmt.Errorf("BoundedCovariance cannot be amended: %w", bc.state.transitionError(defaultState))
+	}
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return nil
+	}
+	clampedX, err := ClampFloat64(x, bc.lowerX, bc.upperX)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v, err %w", x, err)
+	}
+	clampedY, err := ClampFloat64(y, bc.lowerY, bc.upperY)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v, err %w", y, err)
+	}
+	dx, dy := clampedX-bc.midPointX, clampedY-bc.midPointY
+	bc.count.Increment()
+	bc.normalizedSumX.Add(dx)
+	bc.normalizedSumY.Add(dy)
+	bc.normalizedSumOfProducts.Add(dx * dy)
+	bc.normalizedSumOfSquaresX.Add(dx * dx)
+	bc.normalizedSumOfSquaresY.Add(dy * dy)
+	return nil
+}
+
+// sums returns the normalized sums of bc, in a fixed order.
+func (bc *BoundedCovariance) sums() []*BoundedSumFloat64 {
+	return []*BoundedSumFloat64{bc.normalizedSumX, bc.normalizedSumY, bc.normalizedSumOfProducts, bc.normalizedSumOfSquaresX, bc.normalizedSumOfSquaresY}
+}
+
+// Merge merges bc2 into bc (i.e., adds to bc all entries that were added to
+// bc2). bc2 is consumed by this operation: bc2 may not be used after it is
+// merged into bc.
+func (bc *BoundedCovariance) Merge(bc2 *BoundedCovariance) error {
+	if err := checkMergeBoundedCovariance(bc, bc2); err != nil {
+		return err
+	}
+	bc.count.Merge(bc2.count)
+	sums2 := bc2.sums()
+	for i, s := range bc.sums() {
+		s.Merge(sums2[i])
+	}
+	bc2.state = merged
+	return nil
+}
+
+func checkMergeBoundedCovariance(bc1, bc2 *BoundedCovariance) error {
+	if bc1.state != defaultState {
+		return fmt.Errorf("checkMergeBoundedCovariance: bc1 cannot be merged with another BoundedCovariance instance: %w", bc1.state.transitionError(merged))
+	}
+	if bc2.state != defaultState {
+		return fmt.Errorf("checkMergeBoundedCovariance: bc2 cannot be merged with another BoundedCovariance instance: %w", bc2.state.transitionError(merged))
+	}
+	if !bcovEquallyInitialized(bc1, bc2) {
+		return fmt.Errorf("checkMergeBoundedCovariance: bc1 and bc2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+	return nil
+}
+
+func bcovEquallyInitialized(bc1, bc2 *BoundedCovariance) bool {
+	if bc1.lowerX != bc2.lowerX ||
+		bc1.upperX != bc2.upperX ||
+		bc1.lowerY != bc2.lowerY ||
+		bc1.upperY != bc2.upperY ||
+		bc1.state != bc2.state ||
+		!countEquallyInitialized(bc1.count, bc2.count) {
+		return false
+	}
+	sums2 := bc2.sums()
+	for i, s := range bc1.sums() {
+		if !bsEquallyInitialized(s, sums2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Result returns differentially private estimates of the covariance and
+// correlation of the bounded pairs added so far, along with the means and
+// variances of their coordinates. The method can be called only once.
+//
+// The count is an unbiased estimate of the raw count; the other statistics
+// are not unbiased estimates.
+func (bc *BoundedCovariance) Result() (BoundedCovarianceResult, error) {
+	if bc.state != defaultState {
+		return BoundedCovarianceResult{}, fmt.Errorf("BoundedCovariance's noised result cannot be computed: %w", bc.state.transitionError(resultReturned))
+	}
+	bc.state = resultReturned
+
+	noisedCount, err := bc.count.Result()
+	if err != nil {
+		return BoundedCovarianceResult{}, fmt.Errorf("couldn't compute dp count: %w", err)
+	}
+	noisedCountClamped := math.Max(1.0, float64(noisedCount))
+	var normalizedMeans [5]float64
+	for i, s := range bc.sums() {
+		noisedSum, err := s.Result()
+		if err != nil {
+			return BoundedCovarianceResult{}, fmt.Errorf("couldn't compute dp normalized sum: %w", err)
+		}
+		normalizedMeans[i] = noisedSum / noisedCountClamped
+	}
+	meanX, meanY, meanOfProducts, meanOfSquaresX, meanOfSquaresY := normalizedMeans[0], normalizedMeans[1], normalizedMeans[2], normalizedMeans[3], normalizedMeans[4]
+
+	result := BoundedCovarianceResult{Count: noisedCount}
+	if result.MeanX, err = ClampFloat64(meanX+bc.midPointX, bc.lowerX, bc.upperX); err != nil {
+		return BoundedCovarianceResult{}, fmt.Errorf("couldn't clamp the mean of x: %w", err)
+	}
+	if result.MeanY, err = ClampFloat64(meanY+bc.midPointY, bc.lowerY, bc.upperY); err != nil {
+		return BoundedCovarianceResult{}, fmt.Errorf("couldn't clamp the mean of y: %w", err)
+	}
+	maxVarianceX, maxVarianceY := computeMaxVariance(bc.lowerX, bc.upperX), computeMaxVariance(bc.lowerY, bc.upperY)
+	if result.VarianceX, err = ClampFloat64(meanOfSquaresX-meanX*meanX, 0, maxVarianceX); err != nil {
+		return BoundedCovarianceResult{}, fmt.Errorf("couldn't clamp the variance of x: %w", err)
+	}
+	if result.VarianceY, err = ClampFloat64(meanOfSquaresY-meanY*meanY, 0, maxVarianceY); err != nil {
+		return BoundedCovarianceResult{}, fmt.Errorf("couldn't clamp the variance of y: %w", err)
+	}
+	maxCovariance := math.Sqrt(maxVarianceX * maxVarianceY)
+	if result.Covariance, err = ClampFloat64(meanOfProducts-meanX*meanY, -maxCovariance, maxCovariance); err != nil {
+		return BoundedCovarianceResult{}, fmt.Errorf("couldn't clamp the covariance: %w", err)
+	}
+	if result.VarianceX > 0 && result.VarianceY > 0 {
+		correlation := result.Covariance / math.Sqrt(result.VarianceX*result.VarianceY)
+		if result.Correlation, err = ClampFloat64(correlation, -1, 1); err != nil {
+			return BoundedCovarianceResult{}, fmt.Errorf("couldn't clamp the correlation: %w", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,216 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func getNoiselessBCov(t *testing.T) *BoundedCovariance {
+	t.Helper()
+	bc, err := NewBoundedCovariance(&BoundedCovarianceOptions{
+		Epsilon:                      ln3,
+		Delta:                        tenten,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		LowerX:                       -1,
+		UpperX:                       5,
+		LowerY:                       0,
+		UpperY:                       10,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't get noiseless BoundedCovariance: %v", err)
+	}
+	return bc
+}
+
+func TestNewBoundedCovarianceInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *BoundedCovarianceOptions
+	}{
+		{"nil options", nil},
+		{"no MaxContributionsPerPartition", &BoundedCovarianceOptions{Epsilon: ln3, LowerX: -1, UpperX: 5, LowerY: 0, UpperY: 10}},
+		{"no bounds of y", &BoundedCovarianceOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, LowerX: -1, UpperX: 5}},
+		{"equal bounds of x", &BoundedCovarianceOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, LowerX: 1, UpperX: 1, LowerY: 0, UpperY: 10}},
+		{"lower y greater than upper y", &BoundedCovarianceOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, LowerX: -1, UpperX: 5, LowerY: 10, UpperY: 0}},
+		{"zero epsilon", &BoundedCovarianceOptions{MaxContributionsPerPartition: 1, LowerX: -1, UpperX: 5, LowerY: 0, UpperY: 10}},
+	} {
+		if _, err := NewBoundedCovariance(tc.opt); err == nil {
+			t.Errorf("NewBoundedCovariance: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestBoundedCovarianceResult(t *testing.T) {
+	bc := getNoiselessBCov(t)
+	for _, p := range [][2]float64{{1, 2}, {2, 3}, {3, 7}, {10, 20}, {math.NaN(), 1}, {4, math.NaN()}} {
+		bc.Add(p[0], p[1])
+	}
+	got, err := bc.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// (10, 20) is clamped to (5, 10) and pairs with NaN are skipped.
+	xs, ys := []float64{1, 2, 3, 5}, []float64{2, 3, 7, 10}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i] / 4
+		meanY += ys[i] / 4
+	}
+	var varX, varY, cov float64
+	for i := range xs {
+		varX += (xs[i] - meanX) * (xs[i] - meanX) / 4
+		varY += (ys[i] - meanY) * (ys[i] - meanY) / 4
+		cov += (xs[i] - meanX) * (ys[i] - meanY) / 4
+	}
+	if got.Count != 4 {
+		t.Errorf("Result: got count %d, want 4", got.Count)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"mean of x", got.MeanX, meanX},
+		{"mean of y", got.MeanY, meanY},
+		{"variance of x", got.VarianceX, varX},
+		{"variance of y", got.VarianceY, varY},
+		{"covariance", got.Covariance, cov},
+		{"correlation", got.Correlation, cov / math.Sqrt(varX*varY)},
+	} {
+		if !ApproxEqual(c.got, c.want) {
+			t.Errorf("Result: got %s %f, want %f", c.name, c.got, c.want)
+		}
+	}
+	if _, err := bc.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
+
+func TestBoundedCovarianceNegativeCorrelation(t *testing.T) {
+	bc := getNoiselessBCov(t)
+	for x := 0.0; x <= 4; x++ {
+		bc.Add(x, 8-2*x)
+	}
+	got, err := bc.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if !ApproxEqual(got.Correlation, -1) {
+		t.Errorf("Result: got correlation %f, want -1", got.Correlation)
+	}
+	if got.Covariance >= 0 {
+		t.Errorf("Result: got covariance %f, want negative", got.Covariance)
+	}
+}
+
+func TestBoundedCovarianceZeroVariance(t *testing.T) {
+	bc := getNoiselessBCov(t)
+	for y := 0.0; y < 4; y++ {
+		bc.Add(2, y)
+	}
+	got, err := bc.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if got.Correlation != 0 {
+		t.Errorf("Result: with constant x got correlation %f, want 0", got.Correlation)
+	}
+}
+
+func TestBoundedCovarianceClampsResults(t *testing.T) {
+	// With a large noise, the correlation is clamped to [-1, 1] and the
+	// covariance to the bounds implied by the largest variances.
+	for i := 0; i < 100; i++ {
+		bc, err := NewBoundedCovariance(&BoundedCovarianceOptions{
+			Epsilon:                      0.01,
+			MaxContributionsPerPartition: 1,
+			LowerX:                       -1,
+			UpperX:                       1,
+			LowerY:                       0,
+			UpperY:                       4,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize BoundedCovariance: %v", err)
+		}
+		bc.Add(0.5, 1)
+		got, err := bc.Result()
+		if err != nil {
+			t.Fatalf("Couldn't compute dp result: %v", err)
+		}
+		if got.Correlation < -1 || got.Correlation > 1 {
+			t.Errorf("Result: got correlation %f, want in [-1, 1]", got.Correlation)
+		}
+		// The largest variances are 1 and 4.
+		if math.Abs(got.Covariance) > 2 {
+			t.Errorf("Result: got covariance %f, want in [-2, 2]", got.Covariance)
+		}
+	}
+}
+
+func TestBoundedCovarianceMerge(t *testing.T) {
+	bc1, bc2 := getNoiselessBCov(t), getNoiselessBCov(t)
+	bc1.Add(1, 2)
+	bc1.Add(2, 3)
+	bc2.Add(3, 7)
+	bc2.Add(5, 10)
+	if err := bc1.Merge(bc2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	got, err := bc1.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	want, err := func() (BoundedCovarianceResult, error) {
+		bc := getNoiselessBCov(t)
+		for _, p := range [][2]float64{{1, 2}, {2, 3}, {3, 7}, {5, 10}} {
+			bc.Add(p[0], p[1])
+		}
+		return bc.Result()
+	}()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if got != want {
+		t.Errorf("Merge: got result %+v, want %+v", got, want)
+	}
+	if err := bc2.Add(1, 1); err == nil {
+		t.Errorf("Add after Merge: got no error, want error")
+	}
+}
+
+func TestBoundedCovarianceMergeIncompatible(t *testing.T) {
+	bc1 := getNoiselessBCov(t)
+	bc2, err := NewBoundedCovariance(&BoundedCovarianceOptions{
+		Epsilon:                      ln3,
+		Delta:                        tenten,
+		MaxContributionsPerPartition: 1,
+		LowerX:                       -1,
+		UpperX:                       5,
+		LowerY:                       0,
+		UpperY:                       20,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedCovariance: %v", err)
+	}
+	if err := bc1.Merge(bc2); err == nil {
+		t.Errorf("Merge with different bounds of y: got no error, want error")
+	}
+}
@@ -0,0 +1,75 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+// Deduplicated wraps an aggregation of type A, e.g. a *Count or a
+// *KeyedAggregation, so that each contribution is identified by a key of type
+// C, e.g. an event ID, and contributions whose key was already added are
+// ignored. This protects against upstream retries or replays adding the same
+// contribution several times, which inflates the result and can silently
+// break the contribution bounds the noise is calibrated to.
+//
+// The keys of all added contributions are kept in memory until the
+// Deduplicated is discarded. Duplicates are only detected within a single
+// Deduplicated: when contributions are aggregated in parallel, e.g. with a
+// sharded aggregation, the retries of a contribution must be routed to the
+// same shard, e.g. by sharding on the key.
+//
+// The keys are only used for deduplication and must not be released.
+//
+// Not thread-safe.
+type Deduplicated[C comparable, A any] struct {
+	aggregation A
+	seen        map[C]struct{}
+	duplicates  int64
+}
+
+// NewDeduplicated returns a new Deduplicated adding contributions to
+// aggregation, which must not be modified except through the Deduplicated
+// until its result is computed.
+func NewDeduplicated[C comparable, A any](aggregation A) *Deduplicated[C, A] {
+	return &Deduplicated[C, A]{aggregation: aggregation, seen: make(map[C]struct{})}
+}
+
+// Add adds the contribution with the given key by calling add on the
+// aggregation, e.g. func(c *Count) error { return c.Increment() }, unless a
+// contribution with the same key was already added, in which case add isn't
+// called. If add returns an error, the key isn't recorded, so the contribution
+// can be added again.
+func (d *Deduplicated[C, A]) Add(key C, add func(A) error) error {
+	if _, ok := d.seen[key]; ok {
+		d.duplicates++
+		return nil
+	}
+	if err := add(d.aggregation); err != nil {
+		return err
+	}
+	d.seen[key] = struct{}{}
+	return nil
+}
+
+// Aggregation returns the wrapped aggregation, e.g. to compute its result.
+func (d *Deduplicated[C, A]) Aggregation() A {
+	return d.aggregation
+}
+
+// Duplicates returns the number of contributions ignored so far because their
+// key was already added. Like the keys, it is computed from the raw data and
+// must not be released, but it can be monitored to detect upstream issues.
+func (d *Deduplicated[C, A]) Duplicates() int64 {
+	return d.duplicates
+}
@@ -0,0 +1,98 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeduplicatedIgnoresRepeatedKeys(t *testing.T) {
+	c, err := NewCount(&CountOptions{Epsilon: ln3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	d := NewDeduplicated[string](c)
+	// "b" is retried twice.
+	for _, key := range []string{"a", "b", "b", "c", "b"} {
+		if err := d.Add(key, func(c *Count) error { return c.Increment() }); err != nil {
+			t.Fatalf("Add(%q): got error %v", key, err)
+		}
+	}
+	if got := d.Duplicates(); got != 2 {
+		t.Errorf("Duplicates: got %d, want 2", got)
+	}
+	got, err := d.Aggregation().Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 3 {
+		t.Errorf("Result: got %d, want 3", got)
+	}
+}
+
+func TestDeduplicatedFailedContributionCanBeRetried(t *testing.T) {
+	bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, Lower: 0, Upper: 10, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+	}
+	d := NewDeduplicated[int64](bs)
+	if err := d.Add(1, func(*BoundedSumInt64) error { return errors.New("transient error") }); err == nil {
+		t.Errorf("Add: with failing add got no error, want error")
+	}
+	if err := d.Add(1, func(bs *BoundedSumInt64) error { return bs.Add(4) }); err != nil {
+		t.Fatalf("Add: got error %v", err)
+	}
+	if got := d.Duplicates(); got != 0 {
+		t.Errorf("Duplicates: got %d, want 0", got)
+	}
+	got, err := d.Aggregation().Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 4 {
+		t.Errorf("Result: got %d, want 4", got)
+	}
+}
+
+func TestDeduplicatedKeyedAggregation(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                          newNoiselessCountForKey(1),
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 5,
+		PublicPartitions:             []string{"a"},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	d := NewDeduplicated[string](ka)
+	for i := 0; i < 3; i++ {
+		// The same event is delivered three times.
+		d.Add("event", func(ka *KeyedAggregation[string, *Count]) error { return ka.Add("user", "a", increment) })
+	}
+	result, err := d.Aggregation().Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	got, err := result["a"].Result()
+	if err != nil {
+		t.Fatalf("Result of key a: got error %v", err)
+	}
+	if got != 1 {
+		t.Errorf("Result of key a: got %d, want 1", got)
+	}
+}
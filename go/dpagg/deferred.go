@@ -0,0 +1,377 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// errExactPartial is returned by the methods that would output an exact partial
+// aggregate in a format meant for publication.
+var errExactPartial = errors.New("exact partial aggregates must not be output: serialize them with GobEncode, and release them with Release")
+
+// DeferredReleaseOptions contains the privacy budget and noise with which a
+// deferred aggregation is released.
+type DeferredReleaseOptions struct {
+	Epsilon float64     // Privacy parameter ε. Required.
+	Delta   float64     // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	Noise   noise.Noise // Type of noise used. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+}
+
+// DeferredCount accumulates the exact partial count of a Count whose privacy
+// budget and noise aren't chosen yet: "collect now, noise later". Contribution
+// bounding is set when the DeferredCount is created, since it determines the
+// sensitivity, but no privacy budget is spent until Release is called.
+//
+// A DeferredCount holds the exact count, which must never be published. It can
+// only be serialized with GobEncode, to be merged or released later, e.g. on
+// another machine; formatting it with the fmt package hides the count, and
+// encoding it as JSON or text fails.
+//
+// Not thread-safe.
+type DeferredCount struct {
+	// Parameters
+	l0Sensitivity int64
+
+	// State variables
+	count int64
+	state aggregationState
+}
+
+// DeferredCountOptions contains the options necessary to initialize a
+// DeferredCount.
+type DeferredCountOptions struct {
+	MaxPartitionsContributed int64 // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+}
+
+// NewDeferredCount returns a new DeferredCount, whose count is initialized at 0.
+func NewDeferredCount(opt *DeferredCountOptions) (*DeferredCount, error) {
+	if opt == nil {
+		opt = &DeferredCountOptions{}
+	}
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	if l0 < 0 {
+		return nil, fmt.Errorf("NewDeferredCount: MaxPartitionsContributed is %d, must be strictly positive", l0)
+	}
+	return &DeferredCount{l0Sensitivity: l0, state: defaultState}, nil
+}
+
+// Increment increments the count by one.
+func (dc *DeferredCount) Increment() error {
+	return dc.IncrementBy(1)
+}
+
+// IncrementBy increments the count by the given value. Note that this shouldn't
+// be used to count multiple contributions to a single partition from the same
+// privacy unit.
+func (dc *DeferredCount) IncrementBy(count int64) error {
+	if dc.state != defaultState {
+		return fmt.Errorf("DeferredCount cannot be amended: %w", dc.state.transitionError(defaultState))
+	}
+	dc.count += count
+	return nil
+}
+
+// Merge merges dc2 into dc. The two DeferredCounts must have been initialized
+// with the same contribution bounds.
+//
+// dc2 is consumed by this operation: it may not be used after it is merged
+// into dc.
+func (dc *DeferredCount) Merge(dc2 *DeferredCount) error {
+	if dc.state != defaultState {
+		return fmt.Errorf("DeferredCount cannot be merged: dc %w", dc.state.transitionError(merged))
+	}
+	if dc2.state != defaultState {
+		return fmt.Errorf("DeferredCount cannot be merged: dc2 %w", dc2.state.transitionError(merged))
+	}
+	if dc.l0Sensitivity != dc2.l0Sensitivity {
+		return fmt.Errorf("DeferredCount cannot be merged: dc and dc2 are not compatible: %w", &IncompatibleMergeError{Field: "MaxPartitionsContributed"})
+	}
+	dc.count += dc2.count
+	dc2.state = merged
+	return nil
+}
+
+// Release returns a Count initialized with the given privacy budget and noise
+// and with the contribution bounds of dc, holding the count of dc. Its
+// differentially private result can then be computed with its own methods,
+// e.g. Result or ThresholdedResult. The method can be called only once.
+//
+// The privacy budget is spent by the returned Count, as for any other Count.
+// Note that releasing several copies of the same partial, e.g. decoded
+// several times from the same bytes, releases the count several times.
+func (dc *DeferredCount) Release(opt *DeferredReleaseOptions) (*Count, error) {
+	if dc.state != defaultState {
+		return nil, fmt.Errorf("DeferredCount cannot be released: %w", dc.state.transitionError(resultReturned))
+	}
+	if opt == nil {
+		opt = &DeferredReleaseOptions{}
+	}
+	c, err := NewCount(&CountOptions{
+		Epsilon:                  opt.Epsilon,
+		Delta:                    opt.Delta,
+		MaxPartitionsContributed: dc.l0Sensitivity,
+		Noise:                    opt.Noise,
+		Rho:                      opt.Rho,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DeferredCount cannot be released: %w", err)
+	}
+	c.count = dc.count
+	dc.state = resultReturned
+	return c, nil
+}
+
+// String hides the exact count of dc.
+func (dc *DeferredCount) String() string {
+	return fmt.Sprintf("DeferredCount{MaxPartitionsContributed: %d, count: <redacted>}", dc.l0Sensitivity)
+}
+
+// GoString hides the exact count of dc.
+func (dc *DeferredCount) GoString() string {
+	return dc.String()
+}
+
+// MarshalJSON always fails, so that the exact count isn't output by mistake.
+func (dc *DeferredCount) MarshalJSON() ([]byte, error) {
+	return nil, errExactPartial
+}
+
+// MarshalText always fails, so that the exact count isn't output by mistake.
+func (dc *DeferredCount) MarshalText() ([]byte, error) {
+	return nil, errExactPartial
+}
+
+// encodableDeferredCount can be encoded by the gob package.
+type encodableDeferredCount struct {
+	L0Sensitivity int64
+	Count         int64
+}
+
+// GobEncode encodes DeferredCount.
+func (dc *DeferredCount) GobEncode() ([]byte, error) {
+	if dc.state != defaultState && dc.state != serialized {
+		return nil, fmt.Errorf("DeferredCount object cannot be serialized: %w", dc.state.transitionError(serialized))
+	}
+	dc.state = serialized
+	return encode(encodableDeferredCount{L0Sensitivity: dc.l0Sensitivity, Count: dc.count})
+}
+
+// GobDecode decodes DeferredCount.
+func (dc *DeferredCount) GobDecode(data []byte) error {
+	var enc encodableDeferredCount
+	if err := decode(&enc, data); err != nil {
+		return fmt.Errorf("couldn't decode DeferredCount from bytes")
+	}
+	*dc = DeferredCount{l0Sensitivity: enc.L0Sensitivity, count: enc.Count, state: defaultState}
+	return nil
+}
+
+// DeferredBoundedSum accumulates the exact partial sum of a BoundedSum whose
+// privacy budget and noise aren't chosen yet, see DeferredCount. The clamping
+// bounds and contribution bounds are set when the DeferredBoundedSum is
+// created, since they determine the sensitivity.
+//
+// Not thread-safe.
+type DeferredBoundedSum[T Number] struct {
+	// Parameters
+	l0Sensitivity int64
+	lower, upper  T
+
+	// State variables
+	// The exact partial sum, held by a BoundedSum with a placeholder budget
+	// which is only used for clamping and never released.
+	partial *BoundedSum[T]
+	state   aggregationState
+}
+
+// DeferredBoundedSumOptions contains the options necessary to initialize a
+// DeferredBoundedSum.
+type DeferredBoundedSumOptions[T Number] struct {
+	MaxPartitionsContributed int64 // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower <= Upper.
+	Lower, Upper T
+}
+
+// NewDeferredBoundedSum returns a new DeferredBoundedSum, whose sum is
+// initialized at 0.
+func NewDeferredBoundedSum[T Number](opt *DeferredBoundedSumOptions[T]) (*DeferredBoundedSum[T], error) {
+	if opt == nil {
+		opt = &DeferredBoundedSumOptions[T]{}
+	}
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	partial, err := newDeferredPartial(l0, opt.Lower, opt.Upper)
+	if err != nil {
+		return nil, fmt.Errorf("NewDeferredBoundedSum: %w", err)
+	}
+	return &DeferredBoundedSum[T]{
+		l0Sensitivity: l0,
+		lower:         opt.Lower,
+		upper:         opt.Upper,
+		partial:       partial,
+		state:         defaultState,
+	}, nil
+}
+
+// newDeferredPartial returns a BoundedSum with the given bounds and a
+// placeholder budget, holding the exact partial sum of a DeferredBoundedSum.
+func newDeferredPartial[T Number](l0 int64, lower, upper T) (*BoundedSum[T], error) {
+	return NewBoundedSum(&BoundedSumOptions[T]{
+		Epsilon:                  1,
+		MaxPartitionsContributed: l0,
+		Lower:                    lower,
+		Upper:                    upper,
+	})
+}
+
+// Add adds a new summand to the sum, clamped to [Lower, Upper]. NaN values are
+// ignored.
+func (ds *DeferredBoundedSum[T]) Add(e T) error {
+	if ds.state != defaultState {
+		return fmt.Errorf("DeferredBoundedSum cannot be amended: %w", ds.state.transitionError(defaultState))
+	}
+	return ds.partial.Add(e)
+}
+
+// Merge merges ds2 into ds. The two DeferredBoundedSums must have been
+// initialized with the same bounds.
+//
+// ds2 is consumed by this operation: it may not be used after it is merged
+// into ds.
+func (ds *DeferredBoundedSum[T]) Merge(ds2 *DeferredBoundedSum[T]) error {
+	if ds.state != defaultState {
+		return fmt.Errorf("DeferredBoundedSum cannot be merged: ds %w", ds.state.transitionError(merged))
+	}
+	if ds2.state != defaultState {
+		return fmt.Errorf("DeferredBoundedSum cannot be merged: ds2 %w", ds2.state.transitionError(merged))
+	}
+	if ds.l0Sensitivity != ds2.l0Sensitivity || ds.lower != ds2.lower || ds.upper != ds2.upper {
+		return fmt.Errorf("DeferredBoundedSum cannot be merged: ds and ds2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+	ds2.state = merged
+	ds.partial.overflowed = ds.partial.overflowed || ds2.partial.overflowed
+	return ds.partial.accumulate(ds2.partial.sum)
+}
+
+// Release returns a BoundedSum initialized with the given privacy budget and
+// noise and with the bounds of ds, holding the sum of ds. Its differentially
+// private result can then be computed with its own methods, e.g. Result. The
+// method can be called only once.
+//
+// As with DeferredCount.Release, the privacy budget is spent by the returned
+// BoundedSum.
+func (ds *DeferredBoundedSum[T]) Release(opt *DeferredReleaseOptions) (*BoundedSum[T], error) {
+	if ds.state != defaultState {
+		return nil, fmt.Errorf("DeferredBoundedSum cannot be released: %w", ds.state.transitionError(resultReturned))
+	}
+	if opt == nil {
+		opt = &DeferredReleaseOptions{}
+	}
+	bs, err := NewBoundedSum(&BoundedSumOptions[T]{
+		Epsilon:                  opt.Epsilon,
+		Delta:                    opt.Delta,
+		MaxPartitionsContributed: ds.l0Sensitivity,
+		Lower:                    ds.lower,
+		Upper:                    ds.upper,
+		Noise:                    opt.Noise,
+		Rho:                      opt.Rho,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DeferredBoundedSum cannot be released: %w", err)
+	}
+	bs.sum = ds.partial.sum
+	bs.overflowed = ds.partial.overflowed
+	ds.state = resultReturned
+	return bs, nil
+}
+
+// String hides the exact sum of ds.
+func (ds *DeferredBoundedSum[T]) String() string {
+	return fmt.Sprintf("DeferredBoundedSum{MaxPartitionsContributed: %d, Lower: %v, Upper: %v, sum: <redacted>}", ds.l0Sensitivity, ds.lower, ds.upper)
+}
+
+// GoString hides the exact sum of ds.
+func (ds *DeferredBoundedSum[T]) GoString() string {
+	return ds.String()
+}
+
+// MarshalJSON always fails, so that the exact sum isn't output by mistake.
+func (ds *DeferredBoundedSum[T]) MarshalJSON() ([]byte, error) {
+	return nil, errExactPartial
+}
+
+// MarshalText always fails, so that the exact sum isn't output by mistake.
+func (ds *DeferredBoundedSum[T]) MarshalText() ([]byte, error) {
+	return nil, errExactPartial
+}
+
+// encodableDeferredBoundedSum can be encoded by the gob package.
+type encodableDeferredBoundedSum[T Number] struct {
+	L0Sensitivity int64
+	Lower, Upper  T
+	Sum           wideSum
+	Overflowed    bool
+}
+
+// GobEncode encodes DeferredBoundedSum.
+func (ds *DeferredBoundedSum[T]) GobEncode() ([]byte, error) {
+	if ds.state != defaultState && ds.state != serialized {
+		return nil, fmt.Errorf("DeferredBoundedSum object cannot be serialized: %w", ds.state.transitionError(serialized))
+	}
+	ds.state = serialized
+	return encode(encodableDeferredBoundedSum[T]{
+		L0Sensitivity: ds.l0Sensitivity,
+		Lower:         ds.lower,
+		Upper:         ds.upper,
+		Sum:           ds.partial.sum,
+		Overflowed:    ds.partial.overflowed,
+	})
+}
+
+// GobDecode decodes DeferredBoundedSum.
+func (ds *DeferredBoundedSum[T]) GobDecode(data []byte) error {
+	var enc encodableDeferredBoundedSum[T]
+	if err := decode(&enc, data); err != nil {
+		return fmt.Errorf("couldn't decode DeferredBoundedSum from bytes")
+	}
+	partial, err := newDeferredPartial(enc.L0Sensitivity, enc.Lower, enc.Upper)
+	if err != nil {
+		return fmt.Errorf("couldn't decode DeferredBoundedSum from bytes: %w", err)
+	}
+	partial.sum = enc.Sum
+	partial.overflowed = enc.Overflowed
+	*ds = DeferredBoundedSum[T]{
+		l0Sensitivity: enc.L0Sensitivity,
+		lower:         enc.Lower,
+		upper:         enc.Upper,
+		partial:       partial,
+		state:         defaultState,
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDeferredCountRelease(t *testing.T) {
+	dc1, err := NewDeferredCount(&DeferredCountOptions{MaxPartitionsContributed: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc1: %v", err)
+	}
+	dc2, err := NewDeferredCount(&DeferredCountOptions{MaxPartitionsContributed: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc2: %v", err)
+	}
+	dc1.IncrementBy(10)
+	dc2.Increment()
+	if err := dc1.Merge(dc2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	// Serialize and deserialize the partial, as when releasing it elsewhere.
+	bytes, err := dc1.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode: got error %v", err)
+	}
+	if err := dc1.Increment(); err == nil {
+		t.Errorf("Increment after GobEncode: got no error, want error")
+	}
+	var decoded DeferredCount
+	if err := decoded.GobDecode(bytes); err != nil {
+		t.Fatalf("GobDecode: got error %v", err)
+	}
+	c, err := decoded.Release(&DeferredReleaseOptions{Epsilon: ln3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Release: got error %v", err)
+	}
+	if c.l0Sensitivity != 2 {
+		t.Errorf("Release: got a Count with l0 sensitivity %d, want 2", c.l0Sensitivity)
+	}
+	got, err := c.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 11 {
+		t.Errorf("Result: got %d, want 11", got)
+	}
+	if _, err := decoded.Release(&DeferredReleaseOptions{Epsilon: ln3}); err == nil {
+		t.Errorf("Release called twice: got no error, want error")
+	}
+}
+
+func TestDeferredCountReleaseInvalidBudget(t *testing.T) {
+	dc, err := NewDeferredCount(nil)
+	if err != nil {
+		t.Fatalf("Couldn't initialize DeferredCount: %v", err)
+	}
+	if _, err := dc.Release(nil); err == nil {
+		t.Errorf("Release without budget: got no error, want error")
+	}
+	// A failed release doesn't consume the partial.
+	if _, err := dc.Release(&DeferredReleaseOptions{Epsilon: ln3}); err != nil {
+		t.Errorf("Release after a failed release: got error %v", err)
+	}
+}
+
+func TestDeferredCountMergeIncompatible(t *testing.T) {
+	dc1, err := NewDeferredCount(&DeferredCountOptions{MaxPartitionsContributed: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc1: %v", err)
+	}
+	dc2, err := NewDeferredCount(&DeferredCountOptions{MaxPartitionsContributed: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc2: %v", err)
+	}
+	if err := dc1.Merge(dc2); err == nil {
+		t.Errorf("Merge: got no error, want error")
+	}
+}
+
+func TestDeferredBoundedSumRelease(t *testing.T) {
+	opts := &DeferredBoundedSumOptions[float64]{MaxPartitionsContributed: 1, Lower: 0, Upper: 5}
+	ds1, err := NewDeferredBoundedSum(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize ds1: %v", err)
+	}
+	ds2, err := NewDeferredBoundedSum(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize ds2: %v", err)
+	}
+	ds1.Add(1)
+	ds1.Add(10) // Clamped to 5.
+	ds2.Add(-1) // Clamped to 0.
+	ds2.Add(2.5)
+	if err := ds1.Merge(ds2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	bytes, err := ds1.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode: got error %v", err)
+	}
+	var decoded DeferredBoundedSum[float64]
+	if err := decoded.GobDecode(bytes); err != nil {
+		t.Fatalf("GobDecode: got error %v", err)
+	}
+	bs, err := decoded.Release(&DeferredReleaseOptions{Epsilon: ln3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Release: got error %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got, 8.5) {
+		t.Errorf("Result: got %f, want 8.5", got)
+	}
+}
+
+func TestDeferredBoundedSumInvalidOptions(t *testing.T) {
+	if _, err := NewDeferredBoundedSum(&DeferredBoundedSumOptions[int64]{Lower: 5, Upper: 1}); err == nil {
+		t.Errorf("NewDeferredBoundedSum with Lower > Upper: got no error, want error")
+	}
+	if _, err := NewDeferredCount(&DeferredCountOptions{MaxPartitionsContributed: -1}); err == nil {
+		t.Errorf("NewDeferredCount with negative MaxPartitionsContributed: got no error, want error")
+	}
+}
+
+func TestDeferredPartialsAreNotOutput(t *testing.T) {
+	dc, err := NewDeferredCount(nil)
+	if err != nil {
+		t.Fatalf("Couldn't initialize DeferredCount: %v", err)
+	}
+	dc.IncrementBy(123456)
+	ds, err := NewDeferredBoundedSum(&DeferredBoundedSumOptions[int64]{Upper: 1000000})
+	if err != nil {
+		t.Fatalf("Couldn't initialize DeferredBoundedSum: %v", err)
+	}
+	ds.Add(654321)
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		for _, v := range []interface{}{dc, ds} {
+			if s := fmt.Sprintf(format, v); strings.Contains(s, "123456") || strings.Contains(s, "654321") {
+				t.Errorf("Sprintf(%q) of %T: got %q, want the exact value to be hidden", format, v, s)
+			}
+		}
+	}
+	for _, v := range []interface{}{dc, ds} {
+		if _, err := json.Marshal(v); err == nil {
+			t.Errorf("json.Marshal of %T: got no error, want error", v)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// TotalVariationDistance returns the total variation distance between the
+// distributions described by two histograms with the same bins, i.e. half the
+// L_1 distance between the histograms normalized to sum up to 1. Negative
+// counts, which noisy counts may be, are replaced by 0 before normalizing.
+//
+// TotalVariationDistance is meant to detect data drift by comparing the
+// histogram released for an epoch to a reference release, e.g. the one of a
+// previous epoch. When both histograms are differentially private releases,
+// computing the distance is post-processing and doesn't use any privacy
+// budget. To compare raw data of an epoch to a reference release, use
+// HistogramDrift instead.
+func TotalVariationDistance(reference, current []float64) (float64, error) {
+	if len(reference) != len(current) {
+		return 0, fmt.Errorf("TotalVariationDistance: reference has %d bins and current has %d bins, must be equal", len(reference), len(current))
+	}
+	referenceTotal, err := nonNegativeTotal(reference)
+	if err != nil {
+		return 0, fmt.Errorf("TotalVariationDistance: reference: %w", err)
+	}
+	currentTotal, err := nonNegativeTotal(current)
+	if err != nil {
+		return 0, fmt.Errorf("TotalVariationDistance: current: %w", err)
+	}
+	var distance float64
+	for i := range reference {
+		distance += math.Abs(math.Max(0, reference[i])/referenceTotal - math.Max(0, current[i])/currentTotal)
+	}
+	return distance / 2, nil
+}
+
+// nonNegativeTotal returns the sum of the non-negative counts of a histogram,
+// and an error if it contains NaN or infinite counts or if the sum is 0.
+func nonNegativeTotal(histogram []float64) (float64, error) {
+	var total float64
+	for i, x := range histogram {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return 0, fmt.Errorf("count of bin %d is %f, must be finite", i, x)
+		}
+		total += math.Max(0, x)
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("histogram has no positive count")
+	}
+	return total, nil
+}
+
+// HistogramDrift calculates a differentially private drift score between the
+// raw histogram of an epoch and a reference histogram, e.g. the differentially
+// private histogram released for a previous epoch. The reference histogram is
+// considered public; only the contributions added to HistogramDrift are
+// protected.
+//
+// The drift score is ½·Σ|cᵢ - rᵢ| / Σrᵢ, where cᵢ and rᵢ are the counts of bin i
+// in the raw and reference histograms: it is the total variation distance
+// between the two histograms when their totals are equal, and also reflects
+// changes of volume otherwise. The score is computed by adding noise to the L_1
+// distance Σ|cᵢ - rᵢ| once, using its own privacy budget, which must be
+// accounted for in addition to the budget of the releases. When a
+// differentially private histogram of the epoch is released anyway, comparing
+// it to the reference with TotalVariationDistance doesn't need extra budget.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type HistogramDrift struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	l0Sensitivity   int64
+	lInfSensitivity int64
+	reference       []float64
+	referenceTotal  float64
+	Noise           noise.Noise
+
+	// State variables
+	counts []int64
+	state  aggregationState
+}
+
+// HistogramDriftOptions contains the options necessary to initialize a HistogramDrift.
+type HistogramDriftOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// How many distinct bins may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single bin? Defaults to 1.
+	MaxContributionsPerPartition int64
+	// Reference histogram, whose length is the number of bins. Negative counts are
+	// replaced by 0. Required; must have a positive count.
+	Reference []float64
+	Noise     noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewHistogramDrift returns a new HistogramDrift, whose raw counts are initialized at 0.
+func NewHistogramDrift(opt *HistogramDriftOptions) (*HistogramDrift, error) {
+	if opt == nil {
+		opt = &HistogramDriftOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if len(opt.Reference) == 0 {
+		return nil, fmt.Errorf("NewHistogramDrift requires a non-empty Reference")
+	}
+	referenceTotal, err := nonNegativeTotal(opt.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("NewHistogramDrift: Reference: %w", err)
+	}
+	reference := make([]float64, len(opt.Reference))
+	for i, x := range opt.Reference {
+		reference[i] = math.Max(0, x)
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	eps, del := opt.Epsilon, opt.Delta
+	if _, err := n.AddNoiseFloat64(0, 1, float64(l0*lInf), eps, del); err != nil {
+		return nil, fmt.Errorf("NewHistogramDrift: %w", err)
+	}
+
+	return &HistogramDrift{
+		epsilon:         eps,
+		delta:           del,
+		l0Sensitivity:   l0,
+		lInfSensitivity: lInf,
+		reference:       reference,
+		referenceTotal:  referenceTotal,
+		Noise:           n,
+		counts:          make([]int64, len(reference)),
+		state:           defaultState,
+	}, nil
+}
+
+// Add counts a contribution to the given bin, which must be in
+// [0, len(Reference)).
+func (hd *HistogramDrift) Add(bin int) error {
+	if hd.state != defaultState {
+		return fmt.Errorf("HistogramDrift cannot be amended: %w", hd.state.transitionError(defaultState))
+	}
+	if bin < 0 || bin >= len(hd.counts) {
+		return fmt.Errorf("HistogramDrift cannot be amended: bin is %d, must be in [0, %d)", bin, len(hd.counts))
+	}
+	hd.counts[bin]++
+	return nil
+}
+
+// Merge merges hd2 into hd (i.e., adds to hd all entries that were added to
+// hd2). hd2 is consumed by this operation: hd2 may not be used after it is
+// merged into hd.
+func (hd *HistogramDrift) Merge(hd2 *HistogramDrift) error {
+	if hd.state != defaultState {
+		return fmt.Errorf("HistogramDrift: hd cannot be merged with another HistogramDrift instance: %w", hd.state.transitionError(merged))
+	}
+	if hd2.state != defaultState {
+		return fmt.Errorf("HistogramDrift: hd2 cannot be merged with another HistogramDrift instance: %w", hd2.state.transitionError(merged))
+	}
+	if !hdEquallyInitialized(hd, hd2) {
+		return fmt.Errorf("HistogramDrift: hd and hd2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+	for i, c := range hd2.counts {
+		hd.counts[i] += c
+	}
+	hd2.state = merged
+	return nil
+}
+
+func hdEquallyInitialized(hd1, hd2 *HistogramDrift) bool {
+	if len(hd1.reference) != len(hd2.reference) {
+		return false
+	}
+	for i := range hd1.reference {
+		if hd1.reference[i] != hd2.reference[i] {
+			return false
+		}
+	}
+	return hd1.epsilon == hd2.epsilon &&
+		hd1.delta == hd2.delta &&
+		hd1.l0Sensitivity == hd2.l0Sensitivity &&
+		hd1.lInfSensitivity == hd2.lInfSensitivity &&
+		noise.ToKind(hd1.Noise) == noise.ToKind(hd2.Noise) &&
+		hd1.state == hd2.state
+}
+
+// Result returns the differentially private drift score. The method can be
+// called only once.
+//
+// The noisy L_1 distance is clamped to be non-negative, so the score is
+// non-negative; it is not bounded above.
+func (hd *HistogramDrift) Result() (float64, error) {
+	if hd.state != defaultState {
+		return 0, fmt.Errorf("HistogramDrift's noised result cannot be computed: %w", hd.state.transitionError(resultReturned))
+	}
+	hd.state = resultReturned
+	var distance float64
+	for i, c := range hd.counts {
+		distance += math.Abs(float64(c) - hd.reference[i])
+	}
+	// A privacy unit changes at most l0 counts, each by at most lInf, so it
+	// changes the L_1 distance by at most l0·lInf.
+	noised, err := hd.Noise.AddNoiseFloat64(distance, 1, float64(hd.l0Sensitivity*hd.lInfSensitivity), hd.epsilon, hd.delta)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't compute noised L_1 distance: %w", err)
+	}
+	return math.Max(0, noised) / (2 * hd.referenceTotal), nil
+}
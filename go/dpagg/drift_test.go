@@ -0,0 +1,165 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+)
+
+func TestTotalVariationDistance(t *testing.T) {
+	for _, tc := range []struct {
+		desc               string
+		reference, current []float64
+		want               float64
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 0},
+		{"same distribution, different totals", []float64{1, 2, 3}, []float64{2, 4, 6}, 0},
+		{"disjoint", []float64{1, 0}, []float64{0, 5}, 1},
+		{"partial overlap", []float64{1, 1}, []float64{3, 1}, 0.25},
+		{"negative counts", []float64{1, -2, 1}, []float64{1, 0, 1}, 0},
+	} {
+		got, err := TotalVariationDistance(tc.reference, tc.current)
+		if err != nil {
+			t.Fatalf("TotalVariationDistance: when %s got error %v", tc.desc, err)
+		}
+		if !ApproxEqual(got, tc.want) {
+			t.Errorf("TotalVariationDistance: when %s got %f, want %f", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestTotalVariationDistanceInvalidHistograms(t *testing.T) {
+	for _, tc := range []struct {
+		desc               string
+		reference, current []float64
+	}{
+		{"different lengths", []float64{1, 2}, []float64{1, 2, 3}},
+		{"no positive count", []float64{0, -1}, []float64{1, 2}},
+		{"empty", []float64{}, []float64{}},
+	} {
+		if _, err := TotalVariationDistance(tc.reference, tc.current); err == nil {
+			t.Errorf("TotalVariationDistance: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestNewHistogramDriftInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *HistogramDriftOptions
+	}{
+		{"nil options", nil},
+		{"no reference", &HistogramDriftOptions{Epsilon: ln3}},
+		{"reference with no positive count", &HistogramDriftOptions{Epsilon: ln3, Reference: []float64{0, 0}}},
+		{"zero epsilon", &HistogramDriftOptions{Reference: []float64{1}}},
+	} {
+		if _, err := NewHistogramDrift(tc.opts); err == nil {
+			t.Errorf("NewHistogramDrift: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestHistogramDriftNoNoise(t *testing.T) {
+	hd, err := NewHistogramDrift(&HistogramDriftOptions{
+		Epsilon:   ln3,
+		Reference: []float64{2, 2, -1},
+		Noise:     noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize histogram drift: %v", err)
+	}
+	for _, bin := range []int{0, 0, 0, 2} {
+		if err := hd.Add(bin); err != nil {
+			t.Fatalf("Add(%d): got error %v", bin, err)
+		}
+	}
+	got, err := hd.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// |3-2| + |0-2| + |1-0| = 4, normalized by twice the reference total of 4.
+	if want := 0.5; !ApproxEqual(got, want) {
+		t.Errorf("Result: got %f, want %f", got, want)
+	}
+}
+
+func TestHistogramDriftMerge(t *testing.T) {
+	opt := &HistogramDriftOptions{Epsilon: ln3, Reference: []float64{1, 1}, Noise: noNoise{}}
+	hd1, err := NewHistogramDrift(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize hd1: %v", err)
+	}
+	hd2, err := NewHistogramDrift(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize hd2: %v", err)
+	}
+	hd1.Add(0)
+	hd2.Add(1)
+	if err := hd1.Merge(hd2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	got, err := hd1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 0 {
+		t.Errorf("Result: got %f, want 0", got)
+	}
+	if err := hd2.Add(0); err == nil {
+		t.Errorf("Add: got no error on merged hd2, want error")
+	}
+
+	hd3, err := NewHistogramDrift(&HistogramDriftOptions{Epsilon: ln3, Reference: []float64{1, 2}, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize hd3: %v", err)
+	}
+	hd4, err := NewHistogramDrift(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize hd4: %v", err)
+	}
+	if err := hd4.Merge(hd3); err == nil {
+		t.Errorf("Merge: got no error for different references, want error")
+	}
+}
+
+func TestHistogramDriftAddOutOfRange(t *testing.T) {
+	hd, err := NewHistogramDrift(&HistogramDriftOptions{Epsilon: ln3, Reference: []float64{1, 1}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize histogram drift: %v", err)
+	}
+	for _, bin := range []int{-1, 2} {
+		if err := hd.Add(bin); err == nil {
+			t.Errorf("Add(%d): got no error, want error", bin)
+		}
+	}
+}
+
+func TestHistogramDriftStateChecks(t *testing.T) {
+	hd, err := NewHistogramDrift(&HistogramDriftOptions{Epsilon: ln3, Reference: []float64{1}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize histogram drift: %v", err)
+	}
+	if _, err := hd.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if err := hd.Add(0); err == nil {
+		t.Errorf("Add: got no error after Result, want error")
+	}
+	if _, err := hd.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
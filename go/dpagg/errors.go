@@ -0,0 +1,101 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// The errors of this package distinguish misconfiguration, i.e. invalid
+// options, which wrap an InvalidBoundsError for invalid bounds, from misuse of
+// an aggregation, which wraps a StateTransitionError or an
+// IncompatibleMergeError. Use errors.Is and errors.As to inspect them; their
+// messages are meant for humans only.
+
+// ErrBudgetExhausted is returned (wrapped) when an aggregation whose privacy
+// budget was spent by the release of its result is used again.
+var ErrBudgetExhausted = errors.New("privacy budget exhausted")
+
+// InvalidBoundsError is returned (wrapped) by the constructors of aggregations
+// when their clamping bounds are invalid, e.g. NaN, infinite or such that
+// Lower > Upper.
+type InvalidBoundsError = checks.InvalidBoundsError
+
+// StateTransitionError is returned (wrapped) when an operation would move an
+// aggregation from state From to state To, which isn't allowed, e.g. when an
+// aggregation is amended after it was merged into another one. An error with
+// From == StateResultReturned also matches ErrBudgetExhausted.
+type StateTransitionError struct {
+	From, To AggregationState
+}
+
+func (e *StateTransitionError) Error() string {
+	if msg := e.From.errorMessage(); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("Object cannot move from state %v to state %v", e.From, e.To)
+}
+
+// Unwrap returns ErrBudgetExhausted if the result of the aggregation was
+// already returned, and nil otherwise.
+func (e *StateTransitionError) Unwrap() error {
+	if e.From == StateResultReturned {
+		return ErrBudgetExhausted
+	}
+	return nil
+}
+
+// IncompatibleMergeError is returned (wrapped) when two aggregations that were
+// initialized with different options are merged, or when a checkpoint is
+// restored into an aggregation initialized with different options. Field is
+// the name of the first option found to differ, or empty if the aggregation
+// doesn't report it.
+type IncompatibleMergeError struct {
+	Field string
+}
+
+func (e *IncompatibleMergeError) Error() string {
+	if e.Field == "" {
+		return "aggregations were initialized with different options"
+	}
+	return fmt.Sprintf("aggregations were initialized with different %s", e.Field)
+}
+
+// ValidationError is returned by the methods of Builder building an
+// aggregation, and lists all the problems found in its options.
+type ValidationError struct {
+	Aggregation string
+	Problems    []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+	return fmt.Sprintf("invalid options for %s: %s", e.Aggregation, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the problems, so that errors.Is and errors.As inspect each of
+// them, e.g. to find an InvalidBoundsError.
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
@@ -0,0 +1,133 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestInvalidBoundsError(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		lower, upper float64
+	}{
+		{"unset bounds", 0, 0},
+		{"lower > upper", 5, 1},
+		{"NaN lower bound", math.NaN(), 1},
+		{"equal bounds", 1, 1},
+	} {
+		_, err := NewBoundedQuantiles(&BoundedQuantilesOptions{
+			Epsilon:                      ln3,
+			MaxContributionsPerPartition: 1,
+			Lower:                        tc.lower,
+			Upper:                        tc.upper,
+		})
+		var boundsErr *InvalidBoundsError
+		if !errors.As(err, &boundsErr) {
+			t.Errorf("NewBoundedQuantiles: with %s got error %v, want an InvalidBoundsError", tc.desc, err)
+			continue
+		}
+		if boundsErr.Upper != tc.upper {
+			t.Errorf("NewBoundedQuantiles: with %s got Upper = %f, want %f", tc.desc, boundsErr.Upper, tc.upper)
+		}
+	}
+
+	// Errors that aren't about bounds aren't InvalidBoundsErrors.
+	_, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: -1, Lower: 0, Upper: 1})
+	var boundsErr *InvalidBoundsError
+	if err == nil || errors.As(err, &boundsErr) {
+		t.Errorf("NewBoundedSumInt64: with a negative epsilon got error %v, want an error that isn't an InvalidBoundsError", err)
+	}
+}
+
+func TestStateTransitionError(t *testing.T) {
+	c := getNoiselessCount(t)
+	c2 := getNoiselessCount(t)
+	c.Merge(c2)
+	err := c2.Increment()
+	var stateErr *StateTransitionError
+	if !errors.As(err, &stateErr) {
+		t.Fatalf("Increment after Merge: got error %v, want a StateTransitionError", err)
+	}
+	if stateErr.From != StateMerged || stateErr.To != StateDefault {
+		t.Errorf("Increment after Merge: got transition from %v to %v, want from Merged to Default", stateErr.From, stateErr.To)
+	}
+	if errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Increment after Merge: got ErrBudgetExhausted, want a state error only")
+	}
+
+	c.Result()
+	_, err = c.Result()
+	if !errors.As(err, &stateErr) || stateErr.From != StateResultReturned || stateErr.To != StateResultReturned {
+		t.Errorf("Result called twice: got error %v, want a transition from ResultReturned to ResultReturned", err)
+	}
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Result called twice: got error %v, want ErrBudgetExhausted", err)
+	}
+}
+
+func TestIncompatibleMergeError(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		bs2       *BoundedSumFloat64
+		wantField string
+	}{
+		{"different epsilon", mustBoundedSumFloat64(t, &BoundedSumFloat64Options{Epsilon: 2 * ln3, Lower: -1, Upper: 5, Noise: noNoise{}}), "Epsilon"},
+		{"different upper bound", mustBoundedSumFloat64(t, &BoundedSumFloat64Options{Epsilon: ln3, Lower: -1, Upper: 6, Noise: noNoise{}}), "Upper"},
+		{"different MaxPartitionsContributed", mustBoundedSumFloat64(t, &BoundedSumFloat64Options{Epsilon: ln3, MaxPartitionsContributed: 2, Lower: -1, Upper: 5, Noise: noNoise{}}), "MaxPartitionsContributed"},
+	} {
+		bs := mustBoundedSumFloat64(t, &BoundedSumFloat64Options{Epsilon: ln3, Lower: -1, Upper: 5, Noise: noNoise{}})
+		err := bs.Merge(tc.bs2)
+		var mergeErr *IncompatibleMergeError
+		if !errors.As(err, &mergeErr) {
+			t.Errorf("Merge: with %s got error %v, want an IncompatibleMergeError", tc.desc, err)
+			continue
+		}
+		if mergeErr.Field != tc.wantField {
+			t.Errorf("Merge: with %s got Field %q, want %q", tc.desc, mergeErr.Field, tc.wantField)
+		}
+	}
+
+	// Composite aggregations report the field of their sub-aggregations.
+	bv1 := getNoiselessBV(t, 0, 10)
+	bv2, err := NewBoundedVariance(&BoundedVarianceOptions{
+		Epsilon:                      2 * ln3,
+		Delta:                        tenten,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        10,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedVariance: %v", err)
+	}
+	var mergeErr *IncompatibleMergeError
+	if err := bv1.Merge(bv2); !errors.As(err, &mergeErr) || mergeErr.Field != "Epsilon" {
+		t.Errorf("BoundedVariance.Merge: with different epsilon got error %v, want an IncompatibleMergeError for Epsilon", err)
+	}
+}
+
+func mustBoundedSumFloat64(t *testing.T, opt *BoundedSumFloat64Options) *BoundedSumFloat64 {
+	t.Helper()
+	bs, err := NewBoundedSumFloat64(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+	}
+	return bs
+}
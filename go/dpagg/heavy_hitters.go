@@ -0,0 +1,427 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// numSymbols is the number of symbols extending a prefix in a HeavyHitters
+// sketch: the 256 byte values, and the end of the item.
+const numSymbols = 257
+
+// endOfItem is the symbol marking the end of an item.
+const endOfItem = numSymbols - 1
+
+// HeavyHitters finds the K most frequent items, e.g. query strings, with
+// differentially private estimates of their counts, on a domain too large to
+// be enumerated.
+//
+// Items are byte strings of at most MaxItemLength bytes. The sketch holds one
+// count-min sketch per prefix length, counting the prefixes of the items of
+// that length. The counts of items shorter than a prefix length are counted in
+// the sketch of that length too, as the item followed by an end marker. All
+// cells of all count-min sketches are noised when the result is computed, and
+// the most frequent items are then found by only using the noisy sketches, by
+// successively extending the most frequent prefixes of each length with every
+// possible byte, as in the prefix tree of Zhu et al.'s "Federated Heavy
+// Hitters Discovery with Differential Privacy"
+// (https://arxiv.org/abs/1902.08534). Keeping more prefixes than K at each
+// length, see MaxCandidates, avoids losing a frequent item when many less
+// frequent items share a prefix.
+//
+// Sketches created on different workers can be merged, as long as they have
+// the same parameters, including Seed.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type HeavyHitters struct {
+	// Parameters
+	epsilon          float64
+	delta            float64
+	k                int
+	maxCandidates    int
+	maxContributions int64
+	maxItemLength    int
+	width            int
+	depth            int
+	seed             uint64
+	Noise            noise.Noise
+
+	// State variables
+	// Count-min sketch of the prefixes of each length from 1 to
+	// maxItemLength+1, each made of depth rows of width cells.
+	sketches [][][]int64
+	state    aggregationState
+}
+
+// HeavyHittersOptions contains the options necessary to initialize a
+// HeavyHitters sketch.
+type HeavyHittersOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	K       int     // How many items are released? Required.
+	// How many prefixes of each length are extended to the next length?
+	// Defaults to 4·K, must be at least K.
+	MaxCandidates int
+	// How many items, counted with multiplicity, may a single privacy unit
+	// contribute? Defaults to 1.
+	MaxContributions int64
+	// Maximum length of an item, in bytes. Required.
+	MaxItemLength int
+	// Number of cells of each row of the count-min sketches. Larger sketches
+	// have fewer collisions between items. Defaults to 1024.
+	Width int
+	// Number of rows of the count-min sketches, i.e. of hash functions. The
+	// noise grows with the number of rows. Defaults to 4.
+	Depth int
+	// Seed of the hash functions. Sketches must use the same seed to be merged.
+	// Defaults to 0.
+	Seed  uint64
+	Noise noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// HeavyHitter is a released item of a HeavyHitters sketch, with its noisy
+// count.
+type HeavyHitter struct {
+	Item  string
+	Count int64
+}
+
+// NewHeavyHitters returns a new HeavyHitters sketch, in which all counts are
+// initialized at 0.
+func NewHeavyHitters(opt *HeavyHittersOptions) (*HeavyHitters, error) {
+	if opt == nil {
+		opt = &HeavyHittersOptions{}
+	}
+	// Set defaults.
+	maxContributions := opt.MaxContributions
+	if maxContributions == 0 {
+		maxContributions = 1
+	}
+	maxCandidates := opt.MaxCandidates
+	if maxCandidates == 0 {
+		maxCandidates = 4 * opt.K
+	}
+	width := opt.Width
+	if width == 0 {
+		width = 1024
+	}
+	depth := opt.Depth
+	if depth == 0 {
+		depth = 4
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if opt.K <= 0 {
+		return nil, fmt.Errorf("NewHeavyHitters: K is %d, must be strictly positive", opt.K)
+	}
+	if maxCandidates < opt.K {
+		return nil, fmt.Errorf("NewHeavyHitters: MaxCandidates is %d, must be at least K (%d)", maxCandidates, opt.K)
+	}
+	if opt.MaxItemLength <= 0 {
+		return nil, fmt.Errorf("NewHeavyHitters: MaxItemLength is %d, must be strictly positive", opt.MaxItemLength)
+	}
+	if width < 0 || depth < 0 {
+		return nil, fmt.Errorf("NewHeavyHitters: Width and Depth are %d and %d, must be strictly positive", width, depth)
+	}
+	if err := checks.CheckLInfSensitivity(float64(maxContributions)); err != nil {
+		return nil, fmt.Errorf("NewHeavyHitters: %w", err)
+	}
+	hh := &HeavyHitters{
+		epsilon:          opt.Epsilon,
+		delta:            opt.Delta,
+		k:                opt.K,
+		maxCandidates:    maxCandidates,
+		maxContributions: maxContributions,
+		maxItemLength:    opt.MaxItemLength,
+		width:            width,
+		depth:            depth,
+		seed:             opt.Seed,
+		Noise:            n,
+		state:            defaultState,
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, hh.l0Sensitivity(), maxContributions, opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewHeavyHitters: %w", err)
+	}
+	hh.sketches = make([][][]int64, opt.MaxItemLength+1)
+	for l := range hh.sketches {
+		hh.sketches[l] = make([][]int64, depth)
+		for r := range hh.sketches[l] {
+			hh.sketches[l][r] = make([]int64, width)
+		}
+	}
+	return hh, nil
+}
+
+// l0Sensitivity returns the number of cells a single item contributes to: one
+// per row of the sketch of each prefix length.
+func (hh *HeavyHitters) l0Sensitivity() int64 {
+	return int64(hh.maxItemLength+1) * int64(hh.depth)
+}
+
+// Add adds an occurrence of the given item, which must be at most
+// MaxItemLength bytes long. Note that a single privacy unit must not
+// contribute more than MaxContributions items.
+func (hh *HeavyHitters) Add(item string) error {
+	if hh.state != defaultState {
+		return fmt.Errorf("HeavyHitters cannot be amended: %w", hh.state.transitionError(defaultState))
+	}
+	if len(item) > hh.maxItemLength {
+		return fmt.Errorf("HeavyHitters cannot be amended: item is %d bytes long, must be at most MaxItemLength (%d)", len(item), hh.maxItemLength)
+	}
+	for r := 0; r < hh.depth; r++ {
+		h := hh.rowHash(r)
+		for l := range hh.sketches {
+			if l < len(item) {
+				h = fnvStep(h, item[l])
+				hh.sketches[l][r][hh.cell(h, false)]++
+			} else {
+				hh.sketches[l][r][hh.cell(h, true)]++
+			}
+		}
+	}
+	return nil
+}
+
+// Merge merges hh2 into hh. The two sketches must have been initialized with
+// the same parameters, including Seed.
+//
+// hh2 is consumed by this operation: it may not be used after it is merged
+// into hh.
+func (hh *HeavyHitters) Merge(hh2 *HeavyHitters) error {
+	if err := checkMergeHeavyHitters(hh, hh2); err != nil {
+		return err
+	}
+	for l := range hh.sketches {
+		for r := range hh.sketches[l] {
+			for c, v := range hh2.sketches[l][r] {
+				hh.sketches[l][r][c] += v
+			}
+		}
+	}
+	hh2.state = merged
+	return nil
+}
+
+func checkMergeHeavyHitters(hh1, hh2 *HeavyHitters) error {
+	if hh1.state != defaultState {
+		return fmt.Errorf("checkMergeHeavyHitters: hh1 cannot be merged with another HeavyHitters instance: %w", hh1.state.transitionError(merged))
+	}
+	if hh2.state != defaultState {
+		return fmt.Errorf("checkMergeHeavyHitters: hh2 cannot be merged with another HeavyHitters instance: %w", hh2.state.transitionError(merged))
+	}
+
+	if field := heavyHittersIncompatibleField(hh1, hh2); field != "" {
+		return fmt.Errorf("checkMergeHeavyHitters: hh1 and hh2 are not compatible: %w", &IncompatibleMergeError{Field: field})
+	}
+
+	return nil
+}
+
+// heavyHittersIncompatibleField returns the name of the first option with
+// which hh1 and hh2 were initialized differently, or "" if they were
+// initialized equally.
+func heavyHittersIncompatibleField(hh1, hh2 *HeavyHitters) string {
+	switch {
+	case hh1.epsilon != hh2.epsilon:
+		return "Epsilon"
+	case hh1.delta != hh2.delta:
+		return "Delta"
+	case hh1.k != hh2.k:
+		return "K"
+	case hh1.maxCandidates != hh2.maxCandidates:
+		return "MaxCandidates"
+	case hh1.maxContributions != hh2.maxContributions:
+		return "MaxContributions"
+	case hh1.maxItemLength != hh2.maxItemLength:
+		return "MaxItemLength"
+	case hh1.width != hh2.width:
+		return "Width"
+	case hh1.depth != hh2.depth:
+		return "Depth"
+	case hh1.seed != hh2.seed:
+		return "Seed"
+	case noise.ToKind(hh1.Noise) != noise.ToKind(hh2.Noise):
+		return "Noise"
+	}
+	return ""
+}
+
+// Result returns the K most frequent items, in decreasing order of their noisy
+// counts. Fewer than K items are returned if fewer than K items have a
+// positive noisy count. The method can be called only once.
+//
+// The noisy counts are count-min estimates computed from the noisy sketches,
+// so they may overestimate the true counts of the items because of
+// collisions, and they are biased downwards by taking the minimum of noisy
+// values.
+func (hh *HeavyHitters) Result() ([]HeavyHitter, error) {
+	if hh.state != defaultState {
+		return nil, fmt.Errorf("HeavyHitters' noised result cannot be computed: %w", hh.state.transitionError(resultReturned))
+	}
+	hh.state = resultReturned
+
+	l0 := hh.l0Sensitivity()
+	for l := range hh.sketches {
+		for r := range hh.sketches[l] {
+			for c, v := range hh.sketches[l][r] {
+				noised, err := hh.Noise.AddNoiseInt64(v, l0, hh.maxContributions, hh.epsilon, hh.delta)
+				if err != nil {
+					return nil, fmt.Errorf("couldn't compute noised sketch of HeavyHitters: %w", err)
+				}
+				hh.sketches[l][r][c] = noised
+			}
+		}
+	}
+
+	// From here on, only the noisy sketches are used.
+	candidates := []prefixCandidate{{}}
+	for l := range hh.sketches {
+		var extensions []prefixCandidate
+		for _, c := range candidates {
+			if c.ended {
+				extensions = append(extensions, c)
+				continue
+			}
+			// Items are at most maxItemLength bytes long, so the prefixes of
+			// length maxItemLength can only be followed by the end marker: the
+			// other cells of the last sketch only hold noise and collisions.
+			first := 0
+			if l == hh.maxItemLength {
+				first = endOfItem
+			}
+			for s := first; s < numSymbols; s++ {
+				e := prefixCandidate{prefix: c.prefix, ended: s == endOfItem}
+				if !e.ended {
+					e.prefix = c.prefix + string([]byte{byte(s)})
+				}
+				extensions = append(extensions, e)
+			}
+		}
+		for i := range extensions {
+			extensions[i].count = hh.estimate(l, extensions[i])
+		}
+		// Prefixes are ordered by decreasing noisy count, and then
+		// lexicographically so that the result only depends on the noisy
+		// sketches.
+		sort.Slice(extensions, func(i, j int) bool {
+			a, b := extensions[i], extensions[j]
+			if a.count != b.count {
+				return a.count > b.count
+			}
+			if a.prefix != b.prefix {
+				return a.prefix < b.prefix
+			}
+			return a.ended && !b.ended
+		})
+		candidates = candidates[:0]
+		for _, e := range extensions {
+			if len(candidates) == hh.maxCandidates || e.count <= 0 {
+				break
+			}
+			candidates = append(candidates, e)
+		}
+	}
+	// At the last prefix length, all candidates are complete items, which is
+	// checked again so that no item longer than maxItemLength is released.
+	var result []HeavyHitter
+	for _, c := range candidates {
+		if len(result) == hh.k {
+			break
+		}
+		if c.ended && len(c.prefix) <= hh.maxItemLength {
+			result = append(result, HeavyHitter{Item: c.prefix, Count: c.count})
+		}
+	}
+	return result, nil
+}
+
+// prefixCandidate is a prefix considered by Result, with its noisy count.
+type prefixCandidate struct {
+	prefix string
+	// Whether the prefix is a complete item, followed by the end marker.
+	ended bool
+	count int64
+}
+
+// estimate returns the count-min estimate of the count of the given candidate
+// in the sketch of prefixes of length l+1.
+func (hh *HeavyHitters) estimate(l int, c prefixCandidate) int64 {
+	var min int64
+	for r := 0; r < hh.depth; r++ {
+		h := hh.rowHash(r)
+		for i := 0; i < len(c.prefix); i++ {
+			h = fnvStep(h, c.prefix[i])
+		}
+		v := hh.sketches[l][r][hh.cell(h, c.ended)]
+		if r == 0 || v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// The hash functions of the rows are FNV-1a hashes of the prefixes, seeded
+// with the seed of the sketch and the index of the row, and finalized with the
+// mixing function of SplitMix64 so that the cells are evenly distributed.
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+	// endedSalt distinguishes complete items from the prefixes of the same
+	// length in a sketch.
+	endedSalt = 0x9e3779b97f4a7c15
+)
+
+func (hh *HeavyHitters) rowHash(r int) uint64 {
+	h := uint64(fnvOffset)
+	for _, v := range []uint64{hh.seed, uint64(r)} {
+		for i := 0; i < 8; i++ {
+			h = fnvStep(h, byte(v>>(8*i)))
+		}
+	}
+	return h
+}
+
+func fnvStep(h uint64, b byte) uint64 {
+	return (h ^ uint64(b)) * fnvPrime
+}
+
+// cell returns the index of the cell of the prefix with hash h, followed by
+// the end marker if ended.
+func (hh *HeavyHitters) cell(h uint64, ended bool) int {
+	if ended {
+		h ^= endedSalt
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return int(h % uint64(hh.width))
+}
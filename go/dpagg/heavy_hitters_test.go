@@ -0,0 +1,237 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewHeavyHittersInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *HeavyHittersOptions
+	}{
+		{"nil options", nil},
+		{"K is zero", &HeavyHittersOptions{Epsilon: ln3, MaxItemLength: 8}},
+		{"no max item length", &HeavyHittersOptions{Epsilon: ln3, K: 1}},
+		{"fewer candidates than K", &HeavyHittersOptions{Epsilon: ln3, K: 2, MaxCandidates: 1, MaxItemLength: 8}},
+		{"zero epsilon", &HeavyHittersOptions{K: 1, MaxItemLength: 8}},
+		{"negative width", &HeavyHittersOptions{Epsilon: ln3, K: 1, MaxItemLength: 8, Width: -1}},
+		{"negative depth", &HeavyHittersOptions{Epsilon: ln3, K: 1, MaxItemLength: 8, Depth: -1}},
+		{"negative max contributions", &HeavyHittersOptions{Epsilon: ln3, K: 1, MaxItemLength: 8, MaxContributions: -1}},
+		{"delta with Laplace noise", &HeavyHittersOptions{Epsilon: ln3, Delta: 1e-5, K: 1, MaxItemLength: 8}},
+	} {
+		if _, err := NewHeavyHitters(tc.opts); err == nil {
+			t.Errorf("NewHeavyHitters: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func addItems(t *testing.T, hh *HeavyHitters, counts map[string]int) {
+	t.Helper()
+	for item, count := range counts {
+		for i := 0; i < count; i++ {
+			if err := hh.Add(item); err != nil {
+				t.Fatalf("Add(%q): got error %v", item, err)
+			}
+		}
+	}
+}
+
+func TestHeavyHittersFindsTopItems(t *testing.T) {
+	hh, err := NewHeavyHitters(&HeavyHittersOptions{Epsilon: ln3, K: 3, MaxItemLength: 8, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HeavyHitters: %v", err)
+	}
+	counts := map[string]int{"apple": 50, "app": 40, "banana": 30, "": 20, "apricot": 10}
+	for i := 0; i < 100; i++ {
+		counts[fmt.Sprintf("rare%d", i)] = 1
+	}
+	addItems(t, hh, counts)
+	got, err := hh.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []HeavyHitter{{"apple", 50}, {"app", 40}, {"banana", 30}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHeavyHittersWithNoise(t *testing.T) {
+	hh, err := NewHeavyHitters(&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 4})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HeavyHitters: %v", err)
+	}
+	// The noise has a scale of 20/ln(3) ≈ 18, so counts of 2000 and 1000
+	// are found with overwhelming probability.
+	addItems(t, hh, map[string]int{"ab": 2000, "ba": 1000, "abc": 10, "b": 10})
+	got, err := hh.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if len(got) != 2 || got[0].Item != "ab" || got[1].Item != "ba" {
+		t.Errorf("Result: got %v, want items ab and ba", got)
+	}
+}
+
+func TestHeavyHittersFewerThanKItems(t *testing.T) {
+	hh, err := NewHeavyHitters(&HeavyHittersOptions{Epsilon: ln3, K: 5, MaxItemLength: 4, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HeavyHitters: %v", err)
+	}
+	addItems(t, hh, map[string]int{"a": 2, "b": 1})
+	got, err := hh.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []HeavyHitter{{"a", 2}, {"b", 1}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHeavyHittersItemTooLong(t *testing.T) {
+	hh, err := NewHeavyHitters(&HeavyHittersOptions{Epsilon: ln3, K: 1, MaxItemLength: 4})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HeavyHitters: %v", err)
+	}
+	if err := hh.Add(strings.Repeat("a", 4)); err != nil {
+		t.Errorf("Add with an item of MaxItemLength bytes: got error %v", err)
+	}
+	if err := hh.Add(strings.Repeat("a", 5)); err == nil {
+		t.Errorf("Add with an item longer than MaxItemLength: got no error, want error")
+	}
+}
+
+// Tests that no item longer than MaxItemLength is released, even though the
+// noise of the cells of the last sketch that no item contributes to is
+// positive.
+func TestHeavyHittersResultRespectsMaxItemLength(t *testing.T) {
+	const maxItemLength, width = 2, 1024
+	// One call to check the parameters, and one per cell of the sketches.
+	offsets := make([]int64, 1+(maxItemLength+1)*width)
+	for i := range offsets {
+		offsets[i] = 5
+	}
+	hh, err := NewHeavyHitters(&HeavyHittersOptions{
+		Epsilon:       ln3,
+		K:             10,
+		MaxItemLength: maxItemLength,
+		Width:         width,
+		Depth:         1,
+		Noise:         offsetNoise{offsets: &offsets},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HeavyHitters: %v", err)
+	}
+	addItems(t, hh, map[string]int{"ab": 100, "ba": 50})
+	got, err := hh.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if len(got) == 0 || got[0].Item != "ab" {
+		t.Errorf("Result: got %v, want ab first", got)
+	}
+	for _, h := range got {
+		if len(h.Item) > maxItemLength {
+			t.Errorf("Result: got item %q of %d bytes, want at most MaxItemLength (%d)", h.Item, len(h.Item), maxItemLength)
+		}
+	}
+}
+
+func TestHeavyHittersMerge(t *testing.T) {
+	opts := &HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 8, Seed: 42, Noise: noNoise{}}
+	hh1, err := NewHeavyHitters(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize hh1: %v", err)
+	}
+	hh2, err := NewHeavyHitters(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize hh2: %v", err)
+	}
+	addItems(t, hh1, map[string]int{"a": 10, "b": 6})
+	addItems(t, hh2, map[string]int{"b": 6, "c": 8})
+	if err := hh1.Merge(hh2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	if err := hh2.Add("a"); err == nil {
+		t.Errorf("Add on merged sketch: got no error, want error")
+	}
+	got, err := hh1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []HeavyHitter{{"b", 12}, {"a", 10}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHeavyHittersMergeIncompatible(t *testing.T) {
+	for _, tc := range []struct {
+		opt2      *HeavyHittersOptions
+		wantField string
+	}{
+		{&HeavyHittersOptions{Epsilon: 2 * ln3, K: 2, MaxItemLength: 8}, "Epsilon"},
+		{&HeavyHittersOptions{Epsilon: ln3, Delta: 1e-5, K: 2, MaxItemLength: 8, Noise: noise.Gaussian()}, "Delta"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 3, MaxCandidates: 8, MaxItemLength: 8}, "K"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxCandidates: 4, MaxItemLength: 8}, "MaxCandidates"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxContributions: 2, MaxItemLength: 8}, "MaxContributions"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 4}, "MaxItemLength"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 8, Width: 512}, "Width"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 8, Depth: 2}, "Depth"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 8, Seed: 1}, "Seed"},
+		{&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 8, Noise: noise.Geometric()}, "Noise"},
+	} {
+		hh1, err := NewHeavyHitters(&HeavyHittersOptions{Epsilon: ln3, K: 2, MaxItemLength: 8})
+		if err != nil {
+			t.Fatalf("Couldn't initialize hh1: %v", err)
+		}
+		hh2, err := NewHeavyHitters(tc.opt2)
+		if err != nil {
+			t.Fatalf("Couldn't initialize hh2 for %s: %v", tc.wantField, err)
+		}
+		err = hh1.Merge(hh2)
+		var mergeErr *IncompatibleMergeError
+		if !errors.As(err, &mergeErr) || mergeErr.Field != tc.wantField {
+			t.Errorf("Merge: got error %v, want an IncompatibleMergeError for %s", err, tc.wantField)
+		}
+	}
+}
+
+func TestHeavyHittersResultCalledTwice(t *testing.T) {
+	hh, err := NewHeavyHitters(&HeavyHittersOptions{Epsilon: ln3, K: 1, MaxItemLength: 4})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HeavyHitters: %v", err)
+	}
+	if _, err := hh.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if _, err := hh.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := hh.Add("a"); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
@@ -17,8 +17,11 @@
 package dpagg
 
 import (
+	"errors"
 	"fmt"
 	"math"
+
+	"github.com/google/differential-privacy/go/noise"
 )
 
 // LargestRepresentableDelta is the largest delta we could support in 64 bit precision, approximately equal to one.
@@ -55,3 +58,73 @@ func ClampInt64(e, lower, upper int64) (int64, error) {
 	}
 	return e, nil
 }
+
+// rhoConversionDelta is the δ used to convert a ρ-zCDP budget into the (ε, δ)
+// budget of Gaussian noise. Gaussian noise calibrated to the converted budget
+// has the standard deviation required for ρ-zCDP regardless of δ; δ only
+// determines which point of the privacy curve is reported.
+const rhoConversionDelta = 1e-10
+
+// noiseOrDefault returns n, or the default noise if n is nil: Gaussian noise if
+// a ρ-zCDP budget is used, and Laplace noise otherwise.
+func noiseOrDefault(n noise.Noise, rho float64) noise.Noise {
+	if n != nil {
+		return n
+	}
+	if rho != 0 {
+		return noise.Gaussian()
+	}
+	return noise.Laplace()
+}
+
+// budgetFromRho returns the (ε, δ) budget of noise n for a ρ-zCDP budget, or
+// epsilon and delta if ρ is 0. A ρ-zCDP budget requires Gaussian noise, and
+// epsilon and delta must be 0.
+func budgetFromRho(epsilon, delta, rho float64, n noise.Noise) (float64, float64, error) {
+	if rho == 0 {
+		return epsilon, delta, nil
+	}
+	if epsilon != 0 || delta != 0 {
+		return 0, 0, fmt.Errorf("Epsilon and Delta must be 0 when Rho is set, got Epsilon = %v and Delta = %e", epsilon, delta)
+	}
+	switch noise.ToKind(n) {
+	case noise.GaussianNoise, noise.DiscreteGaussianNoise:
+	default:
+		return 0, 0, fmt.Errorf("Rho requires Gaussian noise, got %v", n)
+	}
+	eps, err := noise.GaussianEpsilonForRho(rho, rhoConversionDelta)
+	if err != nil {
+		return 0, 0, err
+	}
+	return eps, rhoConversionDelta, nil
+}
+
+// checkBudgetFractions checks the fractions of the remaining budget of an
+// aggregation spent by an interim release, see Count.ResultWithBudget.
+func checkBudgetFractions(n noise.Noise, epsilonFraction, deltaFraction float64) error {
+	if _, ok := n.(noise.FixedScale); ok {
+		return fmt.Errorf("budget fractions don't apply to noise of a fixed scale, got %v", n)
+	}
+	if !(epsilonFraction > 0 && epsilonFraction < 1) {
+		return fmt.Errorf("epsilonFraction is %v, must be in (0, 1)", epsilonFraction)
+	}
+	if !(deltaFraction >= 0 && deltaFraction < 1) {
+		return fmt.Errorf("deltaFraction is %v, must be in [0, 1)", deltaFraction)
+	}
+	return nil
+}
+
+// errBudgetSpent is returned when serializing an aggregation to a protobuf
+// summary after an interim release, since the summaries have no field for the
+// spent budget.
+var errBudgetSpent = errors.New("the budget spent by ResultWithBudget can't be written to a protobuf summary")
+
+// checkSpentBudget checks that the interim releases of an aggregation of
+// budget (epsilon, delta), e.g. of the aggregations merged into it, spent
+// (spentEpsilon, spentDelta) and left some budget for the next releases.
+func checkSpentBudget(epsilon, delta, spentEpsilon, spentDelta float64) error {
+	if spentEpsilon >= epsilon || (delta > 0 && spentDelta >= delta) {
+		return fmt.Errorf("interim releases spent (%e, %e), which leaves nothing of the budget (%e, %e)", spentEpsilon, spentDelta, epsilon, delta)
+	}
+	return nil
+}
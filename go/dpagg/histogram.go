@@ -0,0 +1,214 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Histogram calculates differentially private counts of buckets whose keys are
+// not known in advance, e.g. the values of a categorical attribute.
+//
+// Since the set of keys is derived from the data, a bucket that only a few
+// privacy units contribute to could reveal their presence. Histogram therefore
+// uses stability-based thresholding: each bucket count is noised, and buckets
+// whose noisy count is below a threshold derived from δ are suppressed. The
+// buckets that are released are thus the ones that are stable, i.e. whose
+// presence doesn't depend on a single privacy unit, except with probability δ.
+//
+// With Laplace noise, all of δ is used for thresholding. With Gaussian or
+// discrete Gaussian noise, δ is split equally between noising and
+// thresholding.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type Histogram[K comparable] struct {
+	// Parameters
+	epsilon         float64
+	noiseDelta      float64
+	thresholdDelta  float64
+	l0Sensitivity   int64
+	lInfSensitivity int64
+	Noise           noise.Noise
+
+	// State variables
+	counts map[K]int64
+	state  aggregationState
+}
+
+// HistogramOptions contains the options necessary to initialize a Histogram.
+type HistogramOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ, used for noising and thresholding. Required.
+	// How many distinct buckets may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single bucket? Defaults to 1.
+	MaxContributionsPerPartition int64
+	Noise                        noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewHistogram returns a new Histogram without any bucket.
+func NewHistogram[K comparable](opt *HistogramOptions) (*Histogram[K], error) {
+	if opt == nil {
+		opt = &HistogramOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if err := checks.CheckDeltaStrict(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewHistogram: %w", err)
+	}
+	noiseDelta, thresholdDelta := 0.0, opt.Delta
+	if noise.NeedsDelta(noise.ToKind(n)) {
+		noiseDelta, thresholdDelta = opt.Delta/2, opt.Delta/2
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, l0, lInf, opt.Epsilon, noiseDelta); err != nil {
+		return nil, fmt.Errorf("NewHistogram: %w", err)
+	}
+	if _, err := n.Threshold(l0, float64(lInf), opt.Epsilon, noiseDelta, thresholdDelta); err != nil {
+		return nil, fmt.Errorf("NewHistogram: %w", err)
+	}
+
+	return &Histogram[K]{
+		epsilon:         opt.Epsilon,
+		noiseDelta:      noiseDelta,
+		thresholdDelta:  thresholdDelta,
+		l0Sensitivity:   l0,
+		lInfSensitivity: lInf,
+		Noise:           n,
+		counts:          make(map[K]int64),
+		state:           defaultState,
+	}, nil
+}
+
+// Add increments the count of the bucket with the given key by one, creating
+// the bucket if needed.
+func (h *Histogram[K]) Add(key K) error {
+	return h.AddBy(key, 1)
+}
+
+// AddBy increments the count of the bucket with the given key by the given
+// value, creating the bucket if needed. Note that the total contribution of a
+// privacy unit to a single bucket must not exceed MaxContributionsPerPartition,
+// and that a privacy unit must not contribute to more than
+// MaxPartitionsContributed buckets.
+func (h *Histogram[K]) AddBy(key K, count int64) error {
+	if h.state != defaultState {
+		return fmt.Errorf("Histogram cannot be amended: %w", h.state.transitionError(defaultState))
+	}
+	h.counts[key] += count
+	return nil
+}
+
+// Merge merges h2 into h, summing up the counts of their buckets. The two
+// histograms must have been initialized with the same parameters.
+//
+// h2 is consumed by this operation: it may not be used after it is merged
+// into h.
+func (h *Histogram[K]) Merge(h2 *Histogram[K]) error {
+	if err := checkMergeHistogram(h, h2); err != nil {
+		return err
+	}
+	for key, count := range h2.counts {
+		h.counts[key] += count
+	}
+	h2.state = merged
+	return nil
+}
+
+func checkMergeHistogram[K comparable](h1, h2 *Histogram[K]) error {
+	if h1.state != defaultState {
+		return fmt.Errorf("checkMergeHistogram: h1 cannot be merged with another Histogram instance: %w", h1.state.transitionError(merged))
+	}
+	if h2.state != defaultState {
+		return fmt.Errorf("checkMergeHistogram: h2 cannot be merged with another Histogram instance: %w", h2.state.transitionError(merged))
+	}
+
+	if field := histogramIncompatibleField(h1, h2); field != "" {
+		return fmt.Errorf("checkMergeHistogram: h1 and h2 are not compatible: %w", &IncompatibleMergeError{Field: field})
+	}
+
+	return nil
+}
+
+// histogramIncompatibleField returns the name of the first option with which
+// h1 and h2 were initialized differently, or "" if they were initialized
+// equally.
+func histogramIncompatibleField[K comparable](h1, h2 *Histogram[K]) string {
+	switch {
+	case h1.epsilon != h2.epsilon:
+		return "Epsilon"
+	case h1.noiseDelta != h2.noiseDelta || h1.thresholdDelta != h2.thresholdDelta:
+		return "Delta"
+	case h1.l0Sensitivity != h2.l0Sensitivity:
+		return "MaxPartitionsContributed"
+	case h1.lInfSensitivity != h2.lInfSensitivity:
+		return "MaxContributionsPerPartition"
+	case noise.ToKind(h1.Noise) != noise.ToKind(h2.Noise):
+		return "Noise"
+	}
+	return ""
+}
+
+// Result returns the noisy counts of the stable buckets, i.e. the buckets
+// whose noisy count is at least the threshold derived from the parameters of
+// the Histogram. The other buckets are suppressed. The method can be called
+// only once.
+func (h *Histogram[K]) Result() (map[K]int64, error) {
+	if h.state != defaultState {
+		return nil, fmt.Errorf("Histogram's noised result cannot be computed: %w", h.state.transitionError(resultReturned))
+	}
+	h.state = resultReturned
+
+	threshold, err := h.Noise.Threshold(h.l0Sensitivity, float64(h.lInfSensitivity), h.epsilon, h.noiseDelta, h.thresholdDelta)
+	if err != nil {
+		return nil, err
+	}
+	// Rounding up the threshold to ensure that no DP guarantees are violated by
+	// releasing a count that is less than the fractional threshold.
+	minCount := int64(math.Ceil(threshold))
+	result := make(map[K]int64)
+	for key, count := range h.counts {
+		noisedCount, err := h.Noise.AddNoiseInt64(count, h.l0Sensitivity, h.lInfSensitivity, h.epsilon, h.noiseDelta)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of a bucket: %w", err)
+		}
+		if noisedCount >= minCount {
+			result[key] = noisedCount
+		}
+	}
+	return result, nil
+}
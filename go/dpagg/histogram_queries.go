@@ -0,0 +1,304 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// HistogramPlan is the plan used by HistogramQueries to answer its queries.
+type HistogramPlan int
+
+const (
+	// AutomaticPlan uses whichever of CachedHistogramPlan and IndependentPlan
+	// gives the lowest expected total squared error for the queries.
+	AutomaticPlan HistogramPlan = iota
+	// CachedHistogramPlan noises the histogram once, with the whole privacy
+	// budget, and derives the answers of all queries from it as
+	// post-processing, which is free in terms of privacy budget. This is best
+	// when there are many queries, or when they overlap.
+	CachedHistogramPlan
+	// IndependentPlan noises the answer of each query, splitting the privacy
+	// budget between them. This is best for a few queries over wide ranges.
+	IndependentPlan
+)
+
+func (p HistogramPlan) String() string {
+	switch p {
+	case AutomaticPlan:
+		return "AutomaticPlan"
+	case CachedHistogramPlan:
+		return "CachedHistogramPlan"
+	case IndependentPlan:
+		return "IndependentPlan"
+	}
+	return fmt.Sprintf("HistogramPlan(%d)", int(p))
+}
+
+// HistogramQuery is a query answered by HistogramQueries: the total count of
+// the buckets from Lower to Upper, both included.
+type HistogramQuery struct {
+	Lower, Upper int
+}
+
+// BucketQuery returns the query of the count of the given bucket.
+func BucketQuery(bucket int) HistogramQuery {
+	return HistogramQuery{Lower: bucket, Upper: bucket}
+}
+
+// CumulativeQuery returns the query of the total count of the buckets up to
+// the given bucket included, i.e. a point of the unnormalized CDF.
+func CumulativeQuery(bucket int) HistogramQuery {
+	return HistogramQuery{Lower: 0, Upper: bucket}
+}
+
+// RangeQuery returns the query of the total count of the buckets from lower to
+// upper, both included.
+func RangeQuery(lower, upper int) HistogramQuery {
+	return HistogramQuery{Lower: lower, Upper: upper}
+}
+
+// width returns the number of buckets of q.
+func (q HistogramQuery) width() int64 {
+	return int64(q.Upper - q.Lower + 1)
+}
+
+// HistogramQueries answers several counting queries over a histogram with a
+// fixed number of ordered buckets, e.g. the counts of some buckets, points of
+// the CDF and range counts, with a single privacy budget.
+//
+// All these queries are derivable from the histogram, so HistogramQueries can
+// release the noisy histogram once and compute every answer from it, without
+// spending more budget than the histogram itself; or it can noise each answer
+// independently, with a share of the budget. The plan is chosen automatically
+// from the expected errors of both, which only depend on the parameters and
+// the queries, so the choice doesn't leak anything about the data. For other
+// linear queries, or to reduce the error of range queries further, see
+// LinearQueries, or RangeHistogram for arbitrary range queries.
+//
+// The buckets and queries are part of the parameters, so they must not depend
+// on the data.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type HistogramQueries struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	l0Sensitivity   int64
+	lInfSensitivity int64
+	queries         []HistogramQuery
+	plan            HistogramPlan // Plan used, never AutomaticPlan.
+	Noise           noise.Noise
+
+	// State variables
+	counts []int64
+	state  aggregationState
+}
+
+// HistogramQueriesOptions contains the options necessary to initialize a
+// HistogramQueries.
+type HistogramQueriesOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// Number of buckets of the histogram. Required.
+	Buckets int
+	// Queries answered by Result. Required.
+	Queries []HistogramQuery
+	// How many distinct buckets may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single bucket? Defaults to 1.
+	MaxContributionsPerPartition int64
+	// Plan used to answer the queries. Defaults to AutomaticPlan, which
+	// requires Laplace, Gaussian or discrete Gaussian noise.
+	Plan  HistogramPlan
+	Noise noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewHistogramQueries returns a new HistogramQueries, with the count of each
+// bucket initialized at 0.
+func NewHistogramQueries(opt *HistogramQueriesOptions) (*HistogramQueries, error) {
+	if opt == nil {
+		opt = &HistogramQueriesOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	// Check the parameters.
+	if opt.Buckets <= 0 {
+		return nil, fmt.Errorf("NewHistogramQueries: Buckets is %d, must be strictly positive", opt.Buckets)
+	}
+	if len(opt.Queries) == 0 {
+		return nil, fmt.Errorf("NewHistogramQueries: Queries must not be empty")
+	}
+	for i, q := range opt.Queries {
+		if q.Lower < 0 || q.Lower > q.Upper || q.Upper >= opt.Buckets {
+			return nil, fmt.Errorf("NewHistogramQueries: query %d is [%d, %d], must be a non-empty range of buckets in [0, %d]", i, q.Lower, q.Upper, opt.Buckets-1)
+		}
+	}
+	if l0 < 0 {
+		return nil, fmt.Errorf("NewHistogramQueries: MaxPartitionsContributed is %d, must be strictly positive", l0)
+	}
+	if lInf < 0 {
+		return nil, fmt.Errorf("NewHistogramQueries: MaxContributionsPerPartition is %d, must be strictly positive", lInf)
+	}
+
+	hq := &HistogramQueries{
+		epsilon: opt.Epsilon,
+		delta:   opt.Delta,
+		queries: append([]HistogramQuery(nil), opt.Queries...),
+		plan:    opt.Plan,
+		Noise:   n,
+		counts:  make([]int64, opt.Buckets),
+		state:   defaultState,
+	}
+	// With the cached histogram, a privacy unit changes at most l0 buckets by
+	// lInf each. With independent answers, it changes each of the queries by
+	// at most lInf times the number of its buckets in the query.
+	cachedL0, cachedLInf := l0, lInf
+	independentL0, independentLInf := int64(len(opt.Queries)), int64(0)
+	for _, q := range opt.Queries {
+		if m := lInf * minInt64(l0, q.width()); m > independentLInf {
+			independentLInf = m
+		}
+	}
+	switch opt.Plan {
+	case AutomaticPlan:
+		cachedStdDev, err := NoiseStandardDeviation(n, cachedL0, float64(cachedLInf), opt.Epsilon, opt.Delta)
+		if err != nil {
+			return nil, fmt.Errorf("NewHistogramQueries: %w", err)
+		}
+		independentStdDev, err := NoiseStandardDeviation(n, independentL0, float64(independentLInf), opt.Epsilon, opt.Delta)
+		if err != nil {
+			return nil, fmt.Errorf("NewHistogramQueries: %w", err)
+		}
+		// The answer of a query derived from the cached histogram sums the
+		// independent noise of each of its buckets.
+		var cachedError float64
+		for _, q := range opt.Queries {
+			cachedError += float64(q.width()) * cachedStdDev * cachedStdDev
+		}
+		independentError := float64(len(opt.Queries)) * independentStdDev * independentStdDev
+		hq.plan = CachedHistogramPlan
+		if independentError < cachedError {
+			hq.plan = IndependentPlan
+		}
+	case CachedHistogramPlan, IndependentPlan:
+	default:
+		return nil, fmt.Errorf("NewHistogramQueries: unknown Plan %v", opt.Plan)
+	}
+	hq.l0Sensitivity, hq.lInfSensitivity = cachedL0, cachedLInf
+	if hq.plan == IndependentPlan {
+		hq.l0Sensitivity, hq.lInfSensitivity = independentL0, independentLInf
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, hq.l0Sensitivity, hq.lInfSensitivity, opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewHistogramQueries: %w", err)
+	}
+	return hq, nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Plan returns the plan used to answer the queries, which is the plan chosen
+// when AutomaticPlan is used.
+func (hq *HistogramQueries) Plan() HistogramPlan {
+	return hq.plan
+}
+
+// Add increments the count of the given bucket by one.
+func (hq *HistogramQueries) Add(bucket int) error {
+	return hq.AddBy(bucket, 1)
+}
+
+// AddBy increments the count of the given bucket by the given value. Note that
+// the total contribution of a privacy unit to a single bucket must not exceed
+// MaxContributionsPerPartition, and that a privacy unit must not contribute to
+// more than MaxPartitionsContributed buckets.
+func (hq *HistogramQueries) AddBy(bucket int, count int64) error {
+	if hq.state != defaultState {
+		return fmt.Errorf("HistogramQueries cannot be amended: %w", hq.state.transitionError(defaultState))
+	}
+	if bucket < 0 || bucket >= len(hq.counts) {
+		return fmt.Errorf("HistogramQueries: bucket is %d, must be in [0, %d]", bucket, len(hq.counts)-1)
+	}
+	hq.counts[bucket] += count
+	return nil
+}
+
+// Result returns the noisy answers of the queries, in the order of Queries.
+// With CachedHistogramPlan, the answers are consistent with each other, e.g.
+// the CDF is the cumulative sum of the bucket counts. The method can be called
+// only once.
+func (hq *HistogramQueries) Result() ([]int64, error) {
+	if hq.state != defaultState {
+		return nil, fmt.Errorf("HistogramQueries' noised result cannot be computed: %w", hq.state.transitionError(resultReturned))
+	}
+	hq.state = resultReturned
+
+	answers := make([]int64, len(hq.queries))
+	if hq.plan == IndependentPlan {
+		for i, q := range hq.queries {
+			var count int64
+			for b := q.Lower; b <= q.Upper; b++ {
+				count += hq.counts[b]
+			}
+			noised, err := hq.Noise.AddNoiseInt64(count, hq.l0Sensitivity, hq.lInfSensitivity, hq.epsilon, hq.delta)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't compute noised answer of query %d: %w", i, err)
+			}
+			answers[i] = noised
+		}
+		return answers, nil
+	}
+
+	// The noisy histogram is released once, and the answers are derived from
+	// its cumulative sums.
+	cumulative := make([]int64, len(hq.counts)+1)
+	for b, count := range hq.counts {
+		noised, err := hq.Noise.AddNoiseInt64(count, hq.l0Sensitivity, hq.lInfSensitivity, hq.epsilon, hq.delta)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of bucket %d: %w", b, err)
+		}
+		cumulative[b+1] = cumulative[b] + noised
+	}
+	for i, q := range hq.queries {
+		answers[i] = cumulative[q.Upper+1] - cumulative[q.Lower]
+	}
+	return answers, nil
+}
@@ -0,0 +1,156 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewHistogramQueriesInvalidOptions(t *testing.T) {
+	queries := []HistogramQuery{BucketQuery(0), CumulativeQuery(2)}
+	for _, tc := range []struct {
+		desc string
+		opt  *HistogramQueriesOptions
+	}{
+		{"nil options", nil},
+		{"no Buckets", &HistogramQueriesOptions{Epsilon: ln3, Queries: queries}},
+		{"no Queries", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3}},
+		{"query beyond the buckets", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: []HistogramQuery{RangeQuery(1, 3)}}},
+		{"negative query", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: []HistogramQuery{BucketQuery(-1)}}},
+		{"empty query", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: []HistogramQuery{RangeQuery(2, 1)}}},
+		{"no Epsilon", &HistogramQueriesOptions{Buckets: 3, Queries: queries}},
+		{"negative MaxPartitionsContributed", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: queries, MaxPartitionsContributed: -1}},
+		{"negative MaxContributionsPerPartition", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: queries, MaxContributionsPerPartition: -1}},
+		{"Delta with Laplace noise", &HistogramQueriesOptions{Epsilon: ln3, Delta: 1e-5, Buckets: 3, Queries: queries}},
+		{"no Delta with Gaussian noise", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: queries, Noise: noise.Gaussian()}},
+		{"unknown Plan", &HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: queries, Plan: HistogramPlan(3)}},
+		{"Delta with Laplace noise and CachedHistogramPlan", &HistogramQueriesOptions{Epsilon: ln3, Delta: 1e-5, Buckets: 3, Queries: queries, Plan: CachedHistogramPlan}},
+	} {
+		if _, err := NewHistogramQueries(tc.opt); err == nil {
+			t.Errorf("NewHistogramQueries with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestHistogramQueriesResult(t *testing.T) {
+	counts := []int64{3, 0, 5, 2, 7}
+	queries := []HistogramQuery{BucketQuery(2), CumulativeQuery(0), CumulativeQuery(3), RangeQuery(1, 4), CumulativeQuery(4)}
+	want := []int64{5, 3, 10, 14, 17}
+	for _, plan := range []HistogramPlan{CachedHistogramPlan, IndependentPlan} {
+		hq, err := NewHistogramQueries(&HistogramQueriesOptions{
+			Epsilon: ln3,
+			Buckets: len(counts),
+			Queries: queries,
+			Plan:    plan,
+			Noise:   noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize HistogramQueries with %v: %v", plan, err)
+		}
+		for b, c := range counts {
+			if err := hq.AddBy(b, c); err != nil {
+				t.Fatalf("AddBy(%d, %d) with %v: got error %v", b, c, plan, err)
+			}
+		}
+		got, err := hq.Result()
+		if err != nil {
+			t.Fatalf("Result with %v: got error %v", plan, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Result with %v: got diff (-want +got):\n%s", plan, diff)
+		}
+		if _, err := hq.Result(); err == nil {
+			t.Errorf("Result called twice with %v: got no error, want error", plan)
+		}
+		if err := hq.Add(0); err == nil {
+			t.Errorf("Add after Result with %v: got no error, want error", plan)
+		}
+	}
+}
+
+func TestHistogramQueriesAddOutOfRange(t *testing.T) {
+	hq, err := NewHistogramQueries(&HistogramQueriesOptions{Epsilon: ln3, Buckets: 3, Queries: []HistogramQuery{BucketQuery(0)}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HistogramQueries: %v", err)
+	}
+	for _, b := range []int{-1, 3} {
+		if err := hq.Add(b); err == nil {
+			t.Errorf("Add(%d): got no error, want error", b)
+		}
+	}
+}
+
+func TestHistogramQueriesAutomaticPlan(t *testing.T) {
+	var cdf []HistogramQuery
+	for b := 0; b < 10; b++ {
+		cdf = append(cdf, BucketQuery(b), CumulativeQuery(b))
+	}
+	for _, tc := range []struct {
+		desc    string
+		queries []HistogramQuery
+		want    HistogramPlan
+	}{
+		// Answering the 20 queries independently would require 20 times the
+		// noise of a bucket count.
+		{"bucket counts and CDF", cdf, CachedHistogramPlan},
+		// The total count has the noise of a single bucket count when
+		// answered independently, but sums the noise of the 10 buckets
+		// otherwise.
+		{"total count", []HistogramQuery{RangeQuery(0, 9)}, IndependentPlan},
+	} {
+		hq, err := NewHistogramQueries(&HistogramQueriesOptions{Epsilon: ln3, Buckets: 10, Queries: tc.queries})
+		if err != nil {
+			t.Fatalf("Couldn't initialize HistogramQueries for %s: %v", tc.desc, err)
+		}
+		if got := hq.Plan(); got != tc.want {
+			t.Errorf("Plan for %s: got %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestHistogramQueriesCachedAnswersAreConsistent(t *testing.T) {
+	var queries []HistogramQuery
+	for b := 0; b < 5; b++ {
+		queries = append(queries, BucketQuery(b), CumulativeQuery(b))
+	}
+	hq, err := NewHistogramQueries(&HistogramQueriesOptions{Epsilon: ln3, Buckets: 5, Queries: queries})
+	if err != nil {
+		t.Fatalf("Couldn't initialize HistogramQueries: %v", err)
+	}
+	if hq.Plan() != CachedHistogramPlan {
+		t.Fatalf("Plan: got %v, want CachedHistogramPlan", hq.Plan())
+	}
+	for b := 0; b < 5; b++ {
+		hq.AddBy(b, int64(10*b))
+	}
+	got, err := hq.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// Since all answers are derived from the same noisy histogram, each point
+	// of the CDF is exactly the sum of the noisy bucket counts up to it.
+	var sum int64
+	for b := 0; b < 5; b++ {
+		sum += got[2*b]
+		if got[2*b+1] != sum {
+			t.Errorf("CumulativeQuery(%d): got %d, want the sum %d of the noisy bucket counts", b, got[2*b+1], sum)
+		}
+	}
+}
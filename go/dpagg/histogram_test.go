@@ -0,0 +1,187 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewHistogramInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *HistogramOptions
+	}{
+		{"nil options", nil},
+		{"zero delta", &HistogramOptions{Epsilon: ln3}},
+		{"zero epsilon", &HistogramOptions{Delta: 1e-5}},
+		{"negative max partitions", &HistogramOptions{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: -1}},
+		{"negative max contributions", &HistogramOptions{Epsilon: ln3, Delta: 1e-5, MaxContributionsPerPartition: -1}},
+	} {
+		if _, err := NewHistogram[string](tc.opts); err == nil {
+			t.Errorf("NewHistogram: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestHistogramSuppressesUnstableBuckets(t *testing.T) {
+	h, err := NewHistogram[string](&HistogramOptions{Epsilon: ln3, Delta: 1e-5, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize histogram: %v", err)
+	}
+	// noNoise has a threshold of 5.00001, so only buckets with a count of at
+	// least 6 are released.
+	for key, count := range map[string]int64{"a": 1, "b": 5, "c": 6, "d": 100} {
+		if err := h.AddBy(key, count); err != nil {
+			t.Fatalf("AddBy(%q, %d): got error %v", key, count, err)
+		}
+	}
+	got, err := h.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := map[string]int64{"c": 6, "d": 100}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHistogramIntKeys(t *testing.T) {
+	h, err := NewHistogram[int](&HistogramOptions{Epsilon: ln3, Delta: 1e-5, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize histogram: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		h.Add(42)
+		h.Add(i)
+	}
+	got, err := h.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := map[int]int64{42: 10}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// Tests that a bucket that a single privacy unit contributed to is released
+// with a probability of at most δ.
+func TestHistogramSingleContributionIsRarelyReleased(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		noise noise.Noise
+	}{
+		{"Laplace noise", noise.Laplace()},
+		{"Gaussian noise", noise.Gaussian()},
+		{"discrete Gaussian noise", noise.DiscreteGaussian()},
+	} {
+		released := 0
+		for i := 0; i < 1000; i++ {
+			h, err := NewHistogram[string](&HistogramOptions{Epsilon: ln3, Delta: 1e-3, Noise: tc.noise})
+			if err != nil {
+				t.Fatalf("With %s, couldn't initialize histogram: %v", tc.desc, err)
+			}
+			h.Add("a")
+			got, err := h.Result()
+			if err != nil {
+				t.Fatalf("With %s, Result: got error %v", tc.desc, err)
+			}
+			released += len(got)
+		}
+		// The expected number of releases is at most 1, so 10 releases have a
+		// negligible probability.
+		if released >= 10 {
+			t.Errorf("With %s, the bucket was released %d times out of 1000, want fewer than 10", tc.desc, released)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	opts := &HistogramOptions{Epsilon: ln3, Delta: 1e-5, Noise: noNoise{}}
+	h1, err := NewHistogram[string](opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize h1: %v", err)
+	}
+	h2, err := NewHistogram[string](opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize h2: %v", err)
+	}
+	h1.AddBy("a", 4)
+	h2.AddBy("a", 4)
+	h2.AddBy("b", 3)
+	if err := h1.Merge(h2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	if err := h2.Add("a"); err == nil {
+		t.Errorf("Add on merged histogram: got no error, want error")
+	}
+	got, err := h1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := map[string]int64{"a": 8}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHistogramMergeIncompatible(t *testing.T) {
+	for _, tc := range []struct {
+		opt2      *HistogramOptions
+		wantField string
+	}{
+		{&HistogramOptions{Epsilon: 2 * ln3, Delta: 1e-5}, "Epsilon"},
+		{&HistogramOptions{Epsilon: ln3, Delta: 1e-6}, "Delta"},
+		{&HistogramOptions{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 2}, "MaxPartitionsContributed"},
+		{&HistogramOptions{Epsilon: ln3, Delta: 1e-5, MaxContributionsPerPartition: 2}, "MaxContributionsPerPartition"},
+		{&HistogramOptions{Epsilon: ln3, Delta: 1e-5, Noise: noise.Geometric()}, "Noise"},
+	} {
+		h1, err := NewHistogram[string](&HistogramOptions{Epsilon: ln3, Delta: 1e-5})
+		if err != nil {
+			t.Fatalf("Couldn't initialize h1: %v", err)
+		}
+		h2, err := NewHistogram[string](tc.opt2)
+		if err != nil {
+			t.Fatalf("Couldn't initialize h2: %v", err)
+		}
+		err = h1.Merge(h2)
+		var mergeErr *IncompatibleMergeError
+		if !errors.As(err, &mergeErr) || mergeErr.Field != tc.wantField {
+			t.Errorf("Merge: got error %v, want an IncompatibleMergeError for %s", err, tc.wantField)
+		}
+	}
+}
+
+func TestHistogramResultCalledTwice(t *testing.T) {
+	h, err := NewHistogram[string](&HistogramOptions{Epsilon: ln3, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize histogram: %v", err)
+	}
+	if _, err := h.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if _, err := h.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := h.Add("a"); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
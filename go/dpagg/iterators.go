@@ -0,0 +1,92 @@
+//go:build go1.23
+
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"iter"
+)
+
+// This file contains iterator-based variants of the APIs of the aggregations,
+// which need Go 1.23 or later.
+
+// KeyedContribution is a contribution of a privacy unit to a key of a
+// KeyedAggregation, see KeyedAggregation.Add.
+type KeyedContribution[K comparable, M any] struct {
+	PrivacyID  string
+	Key        K
+	Contribute func(M) error
+}
+
+// AddSeq adds all contributions of seq to the KeyedAggregation, as Add. It
+// stops at the first error.
+func (ka *KeyedAggregation[K, M]) AddSeq(seq iter.Seq[KeyedContribution[K, M]]) error {
+	for c := range seq {
+		if err := ka.Add(c.PrivacyID, c.Key, c.Contribute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errStopIteration is returned by the callback of ResultFunc when the loop
+// over an iterator is exited early.
+var errStopIteration = errors.New("iteration stopped")
+
+// ResultSeq is like ResultFunc, but returns an iterator over the released keys
+// and their aggregations, and a function returning the error that stopped the
+// iteration, if any, once the iteration is done. The iterator can be used only
+// once. Exiting the loop early discards the keys that haven't been released yet.
+func (ka *KeyedAggregation[K, M]) ResultSeq() (iter.Seq2[K, M], func() error) {
+	var err error
+	seq := func(yield func(K, M) bool) {
+		err = ka.ResultFunc(func(key K, m M) error {
+			if !yield(key, m) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if errors.Is(err, errStopIteration) {
+			err = nil
+		}
+	}
+	return seq, func() error { return err }
+}
+
+// AddSeq adds the privacy units with the IDs of seq to the CountDistinct, as
+// Add. It stops at the first error.
+func (cd *CountDistinct) AddSeq(seq iter.Seq[string]) error {
+	for id := range seq {
+		if err := cd.Add(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSeq adds all elements of seq as entries to the BoundedStatistics, as Add.
+// It stops at the first error.
+func (bs *BoundedStatistics) AddSeq(seq iter.Seq[float64]) error {
+	for e := range seq {
+		if err := bs.Add(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
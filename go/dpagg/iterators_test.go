@@ -0,0 +1,135 @@
+//go:build go1.23
+
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeyedAggregationSeqs(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	contributions := func(yield func(KeyedContribution[string, *Count]) bool) {
+		for i := 0; i < 2000; i++ {
+			c := KeyedContribution[string, *Count]{PrivacyID: fmt.Sprintf("user%d", i), Key: fmt.Sprintf("key%d", i%2), Contribute: increment}
+			if !yield(c) {
+				return
+			}
+		}
+	}
+	if err := ka.AddSeq(contributions); err != nil {
+		t.Fatalf("AddSeq: got err %v", err)
+	}
+	seq, errFunc := ka.ResultSeq()
+	got := make(map[string]int64)
+	for key, c := range seq {
+		count, err := c.Result()
+		if err != nil {
+			t.Fatalf("Couldn't compute count of key %s: %v", key, err)
+		}
+		got[key] = count
+	}
+	if err := errFunc(); err != nil {
+		t.Fatalf("ResultSeq: got err %v", err)
+	}
+	if diff := cmp.Diff(map[string]int64{"key0": 1000, "key1": 1000}, got); diff != "" {
+		t.Errorf("ResultSeq: got diff (-want +got):\n%s", diff)
+	}
+	// The iterator can be used only once.
+	for range seq {
+		t.Errorf("ResultSeq: got a key when iterating twice, want none")
+	}
+	if errFunc() == nil {
+		t.Errorf("ResultSeq: when iterating twice got no error, want error")
+	}
+}
+
+func TestKeyedAggregationResultSeqBreak(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	for i := 0; i < 3000; i++ {
+		ka.Add(fmt.Sprintf("user%d", i), fmt.Sprintf("key%d", i%3), increment)
+	}
+	seq, errFunc := ka.ResultSeq()
+	keys := 0
+	for range seq {
+		keys++
+		break
+	}
+	if keys != 1 {
+		t.Errorf("ResultSeq: got %d keys before break, want 1", keys)
+	}
+	if err := errFunc(); err != nil {
+		t.Errorf("ResultSeq: after break got err %v, want nil", err)
+	}
+}
+
+func TestCountDistinctAddSeq(t *testing.T) {
+	cd := getNoiselessCountDistinct(t)
+	if err := cd.AddSeq(slices.Values([]string{"a", "b", "a"})); err != nil {
+		t.Fatalf("AddSeq: got err %v", err)
+	}
+	if err := cd.AddSeq(maps.Keys(map[string]bool{"b": true, "c": true})); err != nil {
+		t.Fatalf("AddSeq: got err %v", err)
+	}
+	got, err := cd.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("AddSeq: got %d distinct privacy units, want 3", got)
+	}
+	if err := cd.AddSeq(slices.Values([]string{"d"})); err == nil {
+		t.Errorf("AddSeq: after Result got no error, want error")
+	}
+}
+
+func TestBoundedStatisticsAddSeq(t *testing.T) {
+	bs := getNoiselessBStats(t, AllStatistics)
+	if err := bs.AddSeq(slices.Values([]float64{1, 2, 3, 10})); err != nil {
+		t.Fatalf("AddSeq: got err %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	// 10 is clamped to 5.
+	if got.Count != 4 || !ApproxEqual(got.Sum, 11) {
+		t.Errorf("AddSeq: got count %d and sum %f, want 4 and 11", got.Count, got.Sum)
+	}
+}
@@ -0,0 +1,134 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Helpers for exporting DP aggregations as JSON summaries, so that partial
+// aggregates can be inspected by non-Go services and audit tools.
+//
+// A JSON summary is an object with the following fields:
+//   - "version": the version of the schema, currently 1.
+//   - "type": the name of the aggregation type, e.g. "Count" or "BoundedSumInt64".
+//   - "parameters": the parameters of the aggregation, e.g. its privacy budget.
+//   - "state": the partial aggregate accumulated so far. Aggregations built on
+//     other aggregations, e.g. BoundedMeanFloat64, contain the JSON summaries of
+//     these aggregations.
+//
+// Fields are only ever added to a version of the schema; renaming or removing
+// a field requires a new version. Like the gob encoding, a JSON summary
+// contains the exact partial aggregate, which is not differentially private:
+// it must be handled as carefully as the raw data.
+
+// jsonSummaryVersion is the version of the schema of the JSON summaries.
+const jsonSummaryVersion = 1
+
+type jsonSummary struct {
+	Version    int             `json:"version"`
+	Type       string          `json:"type"`
+	Parameters json.RawMessage `json:"parameters"`
+	State      json.RawMessage `json:"state"`
+}
+
+// marshalJSONSummary returns the JSON summary of an aggregation of type typ
+// with the given parameters and state.
+func marshalJSONSummary(typ string, parameters, state interface{}) ([]byte, error) {
+	p, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, err
+	}
+	s, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonSummary{Version: jsonSummaryVersion, Type: typ, Parameters: p, State: s})
+}
+
+// unmarshalJSONSummary loads the parameters and state of the JSON summary of
+// an aggregation of type typ, checking its version and type.
+func unmarshalJSONSummary(data []byte, typ string, parameters, state interface{}) error {
+	var s jsonSummary
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s.Version != jsonSummaryVersion {
+		return fmt.Errorf("unsupported JSON summary version %d, want %d", s.Version, jsonSummaryVersion)
+	}
+	if s.Type != typ {
+		return fmt.Errorf("JSON summary is of type %q, want %q", s.Type, typ)
+	}
+	if err := json.Unmarshal(s.Parameters, parameters); err != nil {
+		return fmt.Errorf("couldn't decode parameters: %w", err)
+	}
+	if err := json.Unmarshal(s.State, state); err != nil {
+		return fmt.Errorf("couldn't decode state: %w", err)
+	}
+	return nil
+}
+
+// jsonNoiseKind is the name of a noise.Kind in JSON summaries.
+type jsonNoiseKind noise.Kind
+
+var jsonNoiseKindNames = map[noise.Kind]string{
+	noise.LaplaceNoise:          "laplace",
+	noise.GaussianNoise:         "gaussian",
+	noise.DiscreteGaussianNoise: "discrete_gaussian",
+	noise.GeometricNoise:        "geometric",
+	noise.Unrecognised:          "unrecognised",
+}
+
+// Noise registered with noise.Register is named after its registered name.
+func (k jsonNoiseKind) MarshalJSON() ([]byte, error) {
+	name, ok := jsonNoiseKindNames[noise.Kind(k)]
+	if !ok {
+		if name, ok = noise.RegisteredName(noise.Kind(k)); !ok {
+			return nil, fmt.Errorf("unknown noise kind %d", k)
+		}
+	}
+	return json.Marshal(name)
+}
+
+func (k *jsonNoiseKind) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for kind, n := range jsonNoiseKindNames {
+		if n == name {
+			*k = jsonNoiseKind(kind)
+			return nil
+		}
+	}
+	if kind, ok := noise.KindByName(name); ok {
+		*k = jsonNoiseKind(kind)
+		return nil
+	}
+	return fmt.Errorf("unknown noise %q", name)
+}
+
+// jsonPrivacyParameters are the parameters shared by most aggregations.
+type jsonPrivacyParameters struct {
+	Epsilon                  float64       `json:"epsilon"`
+	Delta                    float64       `json:"delta"`
+	MaxPartitionsContributed int64         `json:"max_partitions_contributed"`
+	Noise                    jsonNoiseKind `json:"noise"`
+}
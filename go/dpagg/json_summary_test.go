@@ -0,0 +1,192 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+// summaryComparers compare the aggregations that can be exported as JSON
+// summaries.
+var summaryComparers = []cmp.Option{
+	cmp.Comparer(compareCount),
+	cmp.Comparer(compareBoundedSumInt64),
+	cmp.Comparer(compareBoundedSumFloat64),
+	cmp.Comparer(compareBoundedMeanFloat64),
+	cmp.Comparer(compareBoundedVariance),
+	cmp.Comparer(compareBoundedStandardDeviation),
+	cmp.Comparer(compareBoundedQuantiles),
+	cmp.Comparer(comparePreAggSelectPartitionSelection),
+}
+
+// jsonAggregation is an aggregation that can be exported as a JSON summary.
+type jsonAggregation interface {
+	json.Marshaler
+	json.Unmarshaler
+}
+
+func TestJSONSummaryRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		// new returns a new aggregation with some entries, initialized the
+		// same way every time, and an empty aggregation to decode it into.
+		new func() (agg, empty jsonAggregation)
+	}{
+		{"Count", func() (jsonAggregation, jsonAggregation) {
+			c, err := NewCount(&CountOptions{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 2, Noise: noise.Gaussian()})
+			if err != nil {
+				t.Fatalf("Couldn't initialize Count: %v", err)
+			}
+			c.IncrementBy(7)
+			return c, new(Count)
+		}},
+		{"BoundedSumInt64", func() (jsonAggregation, jsonAggregation) {
+			bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, MaxPartitionsContributed: 3, Lower: -5, Upper: 2})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+			}
+			bs.Add(-3)
+			return bs, new(BoundedSumInt64)
+		}},
+		{"weighted BoundedSumFloat64", func() (jsonAggregation, jsonAggregation) {
+			bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Lower: -1.5, Upper: 2.5, MaxWeight: 3})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+			}
+			bs.AddWithWeight(2, 1.5)
+			return bs, new(BoundedSumFloat64)
+		}},
+		{"BoundedMeanFloat64", func() (jsonAggregation, jsonAggregation) {
+			bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, MaxContributionsPerPartition: 2, Lower: -1, Upper: 5, Noise: noise.Laplace()})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+			}
+			bm.Add(3)
+			return bm, new(BoundedMeanFloat64)
+		}},
+		{"weighted BoundedMeanFloat64", func() (jsonAggregation, jsonAggregation) {
+			bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, MaxContributionsPerPartition: 2, Lower: -1, Upper: 5, MaxWeight: 2, Noise: noise.Laplace()})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedMeanFloat64: %v", err)
+			}
+			bm.AddWithWeight(3, 0.5)
+			return bm, new(BoundedMeanFloat64)
+		}},
+		{"BoundedVariance", func() (jsonAggregation, jsonAggregation) {
+			bv, err := NewBoundedVariance(&BoundedVarianceOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10, Noise: noise.Laplace()})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedVariance: %v", err)
+			}
+			bv.Add(2)
+			bv.Add(9)
+			return bv, new(BoundedVariance)
+		}},
+		{"BoundedStandardDeviation", func() (jsonAggregation, jsonAggregation) {
+			bstdv, err := NewBoundedStandardDeviation(&BoundedStandardDeviationOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10, Noise: noise.Laplace()})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedStandardDeviation: %v", err)
+			}
+			bstdv.Add(4)
+			return bstdv, new(BoundedStandardDeviation)
+		}},
+		{"BoundedQuantiles", func() (jsonAggregation, jsonAggregation) {
+			bq, err := NewBoundedQuantiles(&BoundedQuantilesOptions{Epsilon: ln3, Delta: 1e-5, MaxContributionsPerPartition: 1, Lower: 0, Upper: 10, Noise: noise.Gaussian()})
+			if err != nil {
+				t.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+			}
+			bq.Add(1)
+			bq.Add(7)
+			return bq, new(BoundedQuantiles)
+		}},
+		{"PreAggSelectPartition", func() (jsonAggregation, jsonAggregation) {
+			s, err := NewPreAggSelectPartition(&PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 2})
+			if err != nil {
+				t.Fatalf("Couldn't initialize PreAggSelectPartition: %v", err)
+			}
+			s.Increment()
+			return s, new(PreAggSelectPartition)
+		}},
+	} {
+		agg, decoded := tc.new()
+		unchanged, _ := tc.new()
+		b, err := json.Marshal(agg)
+		if err != nil {
+			t.Fatalf("json.Marshal of %s: got error %v", tc.desc, err)
+		}
+		var s jsonSummary
+		if err := json.Unmarshal(b, &s); err != nil {
+			t.Fatalf("With %s, couldn't decode JSON summary %s: %v", tc.desc, b, err)
+		}
+		if s.Version != jsonSummaryVersion {
+			t.Errorf("With %s, got version %d, want %d", tc.desc, s.Version, jsonSummaryVersion)
+		}
+		if err := json.Unmarshal(b, decoded); err != nil {
+			t.Fatalf("json.Unmarshal of %s: got error %v", tc.desc, err)
+		}
+		// Check that marshalling -> unmarshalling is the identity function.
+		if !cmp.Equal(unchanged, decoded, summaryComparers...) {
+			t.Errorf("json.Unmarshal(json.Marshal(_)): with %s got %+v, want %+v", tc.desc, decoded, unchanged)
+		}
+	}
+}
+
+func TestCountJSONSummarySchema(t *testing.T) {
+	c, err := NewCount(&CountOptions{Epsilon: 0.5, MaxPartitionsContributed: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	c.IncrementBy(3)
+	got, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("json.Marshal: got error %v", err)
+	}
+	const want = `{"version":1,"type":"Count","parameters":{"epsilon":0.5,"delta":0,"max_partitions_contributed":2,"noise":"laplace","l_inf_sensitivity":1},"state":{"count":3}}`
+	if string(got) != want {
+		t.Errorf("json.Marshal: got %s, want %s", got, want)
+	}
+	if c.state != serialized {
+		t.Errorf("Count should have its state set to Serialized, got %v, want Serialized", c.state)
+	}
+	// A Count whose result was computed can't be exported.
+	c = getNoiselessCount(t)
+	c.Result()
+	if _, err := json.Marshal(c); err == nil {
+		t.Errorf("json.Marshal after Result: got no error, want error")
+	}
+}
+
+func TestJSONSummaryInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		data string
+		agg  json.Unmarshaler
+	}{
+		{"unsupported version", `{"version":2,"type":"Count","parameters":{},"state":{}}`, new(Count)},
+		{"wrong type", `{"version":1,"type":"Count","parameters":{},"state":{}}`, new(BoundedSumInt64)},
+		{"unknown noise", `{"version":1,"type":"Count","parameters":{"noise":"uniform"},"state":{}}`, new(Count)},
+		{"missing component", `{"version":1,"type":"BoundedVariance","parameters":{},"state":{}}`, new(BoundedVariance)},
+		{"invalid JSON", `{"version":1`, new(Count)},
+	} {
+		if err := json.Unmarshal([]byte(tc.data), tc.agg); err == nil {
+			t.Errorf("json.Unmarshal: with %s got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+)
+
+// KeyEncoder encodes partition keys of type K into strings, e.g. to serialize
+// or hash them, and decodes them back. Encoding must be deterministic and
+// injective: equal keys have the same encoding, and distinct keys have
+// distinct encodings.
+type KeyEncoder[K any] interface {
+	EncodeKey(key K) (string, error)
+	DecodeKey(encoded string) (K, error)
+}
+
+// StringKeyEncoder encodes string keys as themselves.
+type StringKeyEncoder struct{}
+
+// EncodeKey returns key.
+func (StringKeyEncoder) EncodeKey(key string) (string, error) {
+	return key, nil
+}
+
+// DecodeKey returns encoded.
+func (StringKeyEncoder) DecodeKey(encoded string) (string, error) {
+	return encoded, nil
+}
+
+// GobKeyEncoder encodes keys of any type supported by the gob package, e.g.
+// structs with exported fields such as a (country, device, day) tuple, as
+// base64-encoded gob encodings.
+type GobKeyEncoder[K any] struct{}
+
+// EncodeKey returns the base64-encoded gob encoding of key.
+func (GobKeyEncoder[K]) EncodeKey(key K) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(key); err != nil {
+		return "", fmt.Errorf("GobKeyEncoder: couldn't encode key %v: %w", key, err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeKey decodes a key encoded by EncodeKey.
+func (GobKeyEncoder[K]) DecodeKey(encoded string) (K, error) {
+	var key K
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return key, fmt.Errorf("GobKeyEncoder: couldn't decode key %q: %w", encoded, err)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&key); err != nil {
+		return key, fmt.Errorf("GobKeyEncoder: couldn't decode key %q: %w", encoded, err)
+	}
+	return key, nil
+}
+
+// defaultKeyEncoder returns StringKeyEncoder for string keys, and
+// GobKeyEncoder otherwise.
+func defaultKeyEncoder[K any]() KeyEncoder[K] {
+	if e, ok := any(StringKeyEncoder{}).(KeyEncoder[K]); ok {
+		return e
+	}
+	return GobKeyEncoder[K]{}
+}
@@ -0,0 +1,82 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+)
+
+type testTupleKey struct {
+	Country, Device string
+	Day             int
+}
+
+func TestGobKeyEncoderRoundTrip(t *testing.T) {
+	e := GobKeyEncoder[testTupleKey]{}
+	for _, key := range []testTupleKey{
+		{"FR", "mobile", 1},
+		{"FR", "mobile", 2},
+		{"US", "desktop", 1},
+		{},
+	} {
+		encoded, err := e.EncodeKey(key)
+		if err != nil {
+			t.Fatalf("EncodeKey(%v): got err %v", key, err)
+		}
+		again, err := e.EncodeKey(key)
+		if err != nil || again != encoded {
+			t.Errorf("EncodeKey(%v): got %q and %q when encoding twice, want equal encodings", key, encoded, again)
+		}
+		got, err := e.DecodeKey(encoded)
+		if err != nil {
+			t.Fatalf("DecodeKey(%q): got err %v", encoded, err)
+		}
+		if got != key {
+			t.Errorf("DecodeKey(EncodeKey(%v)): got %v, want %v", key, got, key)
+		}
+	}
+}
+
+func TestGobKeyEncoderDistinctKeys(t *testing.T) {
+	e := GobKeyEncoder[testTupleKey]{}
+	a, err := e.EncodeKey(testTupleKey{"FR", "mobile", 1})
+	if err != nil {
+		t.Fatalf("EncodeKey: got err %v", err)
+	}
+	b, err := e.EncodeKey(testTupleKey{"FRm", "obile", 1})
+	if err != nil {
+		t.Fatalf("EncodeKey: got err %v", err)
+	}
+	if a == b {
+		t.Errorf("EncodeKey: got the same encoding %q for distinct keys, want distinct encodings", a)
+	}
+}
+
+func TestGobKeyEncoderInvalidEncoding(t *testing.T) {
+	if _, err := (GobKeyEncoder[testTupleKey]{}).DecodeKey("not base64!"); err == nil {
+		t.Errorf("DecodeKey: with an invalid encoding got no error, want error")
+	}
+}
+
+func TestDefaultKeyEncoder(t *testing.T) {
+	if _, ok := defaultKeyEncoder[string]().(StringKeyEncoder); !ok {
+		t.Errorf("defaultKeyEncoder[string]: got %T, want StringKeyEncoder", defaultKeyEncoder[string]())
+	}
+	if _, ok := defaultKeyEncoder[testTupleKey]().(GobKeyEncoder[testTupleKey]); !ok {
+		t.Errorf("defaultKeyEncoder[testTupleKey]: got %T, want GobKeyEncoder", defaultKeyEncoder[testTupleKey]())
+	}
+}
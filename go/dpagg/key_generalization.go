@@ -0,0 +1,212 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// KeyGeneralizer coarsens partition keys before aggregation, e.g. mapping ages
+// to age ranges or cities to regions. Coarser keys have fewer distinct values
+// and more contributions each, so that fewer partitions are suppressed by
+// thresholding and the released partitions are less noisy relative to their
+// values.
+//
+// Generalizing keys is applied to each contribution independently and doesn't
+// consume privacy budget, as long as the generalization itself (bin widths,
+// taxonomies, etc.) is public, i.e. not derived from the data.
+type KeyGeneralizer interface {
+	Generalize(key string) (string, error)
+}
+
+// NumericBinning generalizes numeric keys to fixed-width bins. A key k is
+// mapped to the bin [Origin + i·Width, Origin + (i+1)·Width) containing it,
+// labelled as "[lower, upper)".
+type NumericBinning struct {
+	Width  float64 // Width of the bins. Required; must be strictly positive and finite.
+	Origin float64 // Lower bound of one of the bins. Defaults to 0.
+}
+
+// Generalize returns the label of the bin containing key, which must be the
+// decimal representation of a finite number.
+func (b NumericBinning) Generalize(key string) (string, error) {
+	v, err := strconv.ParseFloat(key, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", fmt.Errorf("NumericBinning: key %q is not a finite number", key)
+	}
+	lower, upper, err := b.Bin(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[%v, %v)", lower, upper), nil
+}
+
+// Bin returns the bounds [lower, upper) of the bin containing v.
+func (b NumericBinning) Bin(v float64) (lower, upper float64, err error) {
+	if !(b.Width > 0) || math.IsInf(b.Width, 0) {
+		return 0, 0, fmt.Errorf("NumericBinning: Width is %f, must be strictly positive and finite", b.Width)
+	}
+	i := math.Floor((v - b.Origin) / b.Width)
+	return b.Origin + i*b.Width, b.Origin + (i+1)*b.Width, nil
+}
+
+// PrefixTruncation generalizes string keys to their prefix of Length
+// characters, e.g. postal codes to postal districts. Keys shorter than Length
+// are kept as is. Characters are counted as Unicode code points.
+type PrefixTruncation struct {
+	Length int // Number of characters kept. Required; must be strictly positive.
+}
+
+// Generalize returns the prefix of key of Length characters.
+func (p PrefixTruncation) Generalize(key string) (string, error) {
+	if p.Length <= 0 {
+		return "", fmt.Errorf("PrefixTruncation: Length is %d, must be strictly positive", p.Length)
+	}
+	n := 0
+	for i := range key {
+		if n == p.Length {
+			return key[:i], nil
+		}
+		n++
+	}
+	return key, nil
+}
+
+// TaxonomyRollup generalizes keys by replacing them with their ancestor Levels
+// levels up in a taxonomy, e.g. cities to regions with one level or to
+// countries with two levels. A key without a parent in the taxonomy is a root
+// and is kept as is once reached.
+type TaxonomyRollup struct {
+	// Parent of each key of the taxonomy, e.g. {"Paris": "Île-de-France",
+	// "Île-de-France": "France"}. Required.
+	Parents map[string]string
+	Levels  int // Number of levels to roll up. Defaults to 1.
+	// Key to which keys that are not in the taxonomy are mapped. Defaults to
+	// "", in which case such keys are an error.
+	Unknown string
+}
+
+// Generalize returns the ancestor of key Levels levels up in the taxonomy.
+func (t TaxonomyRollup) Generalize(key string) (string, error) {
+	levels := t.Levels
+	if levels == 0 {
+		levels = 1
+	}
+	if levels < 0 {
+		return "", fmt.Errorf("TaxonomyRollup: Levels is %d, must be strictly positive", levels)
+	}
+	if _, ok := t.Parents[key]; !ok && !t.isRoot(key) {
+		if t.Unknown == "" {
+			return "", fmt.Errorf("TaxonomyRollup: key %q is not in the taxonomy", key)
+		}
+		return t.Unknown, nil
+	}
+	for i := 0; i < levels; i++ {
+		parent, ok := t.Parents[key]
+		if !ok {
+			break
+		}
+		// A taxonomy has at most len(t.Parents) levels, so rolling up more
+		// means that it has a cycle.
+		if i == len(t.Parents) {
+			return "", fmt.Errorf("TaxonomyRollup: the taxonomy has a cycle through %q", key)
+		}
+		key = parent
+	}
+	return key, nil
+}
+
+// isRoot returns whether key is the parent of a key of the taxonomy but has no
+// parent itself.
+func (t TaxonomyRollup) isRoot(key string) bool {
+	for _, parent := range t.Parents {
+		if parent == key {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyGeneralizationRule is the configuration of a single KeyGeneralizer. Kind
+// selects the generalizer; only the fields of that generalizer are used. The
+// struct has JSON tags so that rules can be loaded from configuration files.
+type KeyGeneralizationRule struct {
+	// Type of generalization: "binning", "prefix" or "taxonomy". Required.
+	Kind string `json:"kind"`
+	// Parameters of NumericBinning.
+	BinWidth  float64 `json:"bin_width,omitempty"`
+	BinOrigin float64 `json:"bin_origin,omitempty"`
+	// Parameters of PrefixTruncation.
+	PrefixLength int `json:"prefix_length,omitempty"`
+	// Parameters of TaxonomyRollup.
+	Parents       map[string]string `json:"parents,omitempty"`
+	RollupLevels  int               `json:"rollup_levels,omitempty"`
+	UnknownBucket string            `json:"unknown_bucket,omitempty"`
+}
+
+// KeyGeneralizationChain applies several KeyGeneralizers in order, e.g. a
+// taxonomy rollup followed by a prefix truncation.
+type KeyGeneralizationChain []KeyGeneralizer
+
+// Generalize applies the generalizers of the chain to key in order.
+func (c KeyGeneralizationChain) Generalize(key string) (string, error) {
+	for i, g := range c {
+		var err error
+		key, err = g.Generalize(key)
+		if err != nil {
+			return "", fmt.Errorf("generalizer %d: %w", i, err)
+		}
+	}
+	return key, nil
+}
+
+// NewKeyGeneralizer returns a KeyGeneralizer applying the given rules in
+// order. The parameters of each rule are checked, so that a misconfigured rule
+// fails here rather than when generalizing keys.
+func NewKeyGeneralizer(rules []KeyGeneralizationRule) (KeyGeneralizationChain, error) {
+	chain := make(KeyGeneralizationChain, len(rules))
+	for i, r := range rules {
+		var g KeyGeneralizer
+		switch r.Kind {
+		case "binning":
+			b := NumericBinning{Width: r.BinWidth, Origin: r.BinOrigin}
+			if _, _, err := b.Bin(0); err != nil {
+				return nil, fmt.Errorf("NewKeyGeneralizer: rule %d: %w", i, err)
+			}
+			g = b
+		case "prefix":
+			if r.PrefixLength <= 0 {
+				return nil, fmt.Errorf("NewKeyGeneralizer: rule %d: PrefixLength is %d, must be strictly positive", i, r.PrefixLength)
+			}
+			g = PrefixTruncation{Length: r.PrefixLength}
+		case "taxonomy":
+			if len(r.Parents) == 0 {
+				return nil, fmt.Errorf("NewKeyGeneralizer: rule %d requires a non-empty taxonomy", i)
+			}
+			if r.RollupLevels < 0 {
+				return nil, fmt.Errorf("NewKeyGeneralizer: rule %d: RollupLevels is %d, must be non-negative", i, r.RollupLevels)
+			}
+			g = TaxonomyRollup{Parents: r.Parents, Levels: r.RollupLevels, Unknown: r.UnknownBucket}
+		default:
+			return nil, fmt.Errorf("NewKeyGeneralizer: rule %d has unknown Kind %q, must be one of \"binning\", \"prefix\" or \"taxonomy\"", i, r.Kind)
+		}
+		chain[i] = g
+	}
+	return chain, nil
+}
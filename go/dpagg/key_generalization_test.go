@@ -0,0 +1,122 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testTaxonomy = map[string]string{
+	"Paris":         "Île-de-France",
+	"Versailles":    "Île-de-France",
+	"Lyon":          "Rhône-Alpes",
+	"Île-de-France": "France",
+	"Rhône-Alpes":   "France",
+}
+
+func TestKeyGeneralizers(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		g    KeyGeneralizer
+		key  string
+		want string
+	}{
+		{"binning", NumericBinning{Width: 10}, "37", "[30, 40)"},
+		{"binning negative key", NumericBinning{Width: 10}, "-3", "[-10, 0)"},
+		{"binning with origin", NumericBinning{Width: 10, Origin: 5}, "37", "[35, 45)"},
+		{"binning on bin lower bound", NumericBinning{Width: 0.5}, "1.5", "[1.5, 2)"},
+		{"prefix", PrefixTruncation{Length: 2}, "75011", "75"},
+		{"prefix of short key", PrefixTruncation{Length: 8}, "75011", "75011"},
+		{"prefix counts code points", PrefixTruncation{Length: 2}, "Île", "Îl"},
+		{"taxonomy", TaxonomyRollup{Parents: testTaxonomy}, "Paris", "Île-de-France"},
+		{"taxonomy two levels", TaxonomyRollup{Parents: testTaxonomy, Levels: 2}, "Paris", "France"},
+		{"taxonomy stops at root", TaxonomyRollup{Parents: testTaxonomy, Levels: 5}, "Lyon", "France"},
+		{"taxonomy root", TaxonomyRollup{Parents: testTaxonomy}, "France", "France"},
+		{"taxonomy unknown key", TaxonomyRollup{Parents: testTaxonomy, Unknown: "other"}, "Berlin", "other"},
+		{"chain", KeyGeneralizationChain{TaxonomyRollup{Parents: testTaxonomy}, PrefixTruncation{Length: 3}}, "Versailles", "Île"},
+	} {
+		got, err := tc.g.Generalize(tc.key)
+		if err != nil {
+			t.Errorf("Generalize(%q) with %s: got error %v", tc.key, tc.desc, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Generalize(%q) with %s: got %q, want %q", tc.key, tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestKeyGeneralizersErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		g    KeyGeneralizer
+		key  string
+	}{
+		{"binning non-numeric key", NumericBinning{Width: 10}, "abc"},
+		{"binning NaN key", NumericBinning{Width: 10}, "NaN"},
+		{"binning zero width", NumericBinning{}, "1"},
+		{"prefix zero length", PrefixTruncation{}, "75011"},
+		{"taxonomy unknown key", TaxonomyRollup{Parents: testTaxonomy}, "Berlin"},
+		{"taxonomy negative levels", TaxonomyRollup{Parents: testTaxonomy, Levels: -1}, "Paris"},
+		{"taxonomy cycle", TaxonomyRollup{Parents: map[string]string{"a": "b", "b": "a"}, Levels: 3}, "a"},
+	} {
+		if _, err := tc.g.Generalize(tc.key); err == nil {
+			t.Errorf("Generalize(%q) with %s: got no error, want error", tc.key, tc.desc)
+		}
+	}
+}
+
+func TestNewKeyGeneralizerFromConfig(t *testing.T) {
+	const config = `[
+		{"kind": "taxonomy", "parents": {"Paris": "Île-de-France", "Île-de-France": "France"}, "unknown_bucket": "other"},
+		{"kind": "prefix", "prefix_length": 5}
+	]`
+	var rules []KeyGeneralizationRule
+	if err := json.Unmarshal([]byte(config), &rules); err != nil {
+		t.Fatalf("Couldn't parse config: %v", err)
+	}
+	g, err := NewKeyGeneralizer(rules)
+	if err != nil {
+		t.Fatalf("NewKeyGeneralizer: got error %v", err)
+	}
+	for key, want := range map[string]string{"Paris": "Île-d", "Berlin": "other"} {
+		got, err := g.Generalize(key)
+		if err != nil {
+			t.Errorf("Generalize(%q): got error %v", key, err)
+		} else if got != want {
+			t.Errorf("Generalize(%q): got %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestNewKeyGeneralizerInvalidRules(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		rule KeyGeneralizationRule
+	}{
+		{"unknown kind", KeyGeneralizationRule{Kind: "hash"}},
+		{"binning without width", KeyGeneralizationRule{Kind: "binning"}},
+		{"prefix without length", KeyGeneralizationRule{Kind: "prefix"}},
+		{"taxonomy without parents", KeyGeneralizationRule{Kind: "taxonomy"}},
+		{"taxonomy with negative levels", KeyGeneralizationRule{Kind: "taxonomy", Parents: testTaxonomy, RollupLevels: -1}},
+	} {
+		if _, err := NewKeyGeneralizer([]KeyGeneralizationRule{tc.rule}); err == nil {
+			t.Errorf("NewKeyGeneralizer: when %s got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// ContributionSelection specifies which contributions of a privacy unit to a
+// key are kept when the privacy unit contributes more than
+// MaxContributionsPerPartition times to the key. Any selection preserves
+// differential privacy, since it only depends on the contributions of a single
+// privacy unit; they differ in the bias they introduce in the results.
+type ContributionSelection int
+
+const (
+	// RandomContributions keeps contributions chosen uniformly at random with
+	// reservoir sampling, so that the kept contributions are an unbiased sample
+	// of the contributions of the privacy unit.
+	RandomContributions ContributionSelection = iota
+	// FirstContributions keeps the first contributions added, e.g. the earliest
+	// events if contributions are added in chronological order.
+	FirstContributions
+	// LargestContributions keeps the contributions with the largest values, see
+	// AddValue. Ties are broken in favor of the contributions added first.
+	LargestContributions
+)
+
+// String returns the name of the contribution selection.
+func (cs ContributionSelection) String() string {
+	switch cs {
+	case RandomContributions:
+		return "RandomContributions"
+	case FirstContributions:
+		return "FirstContributions"
+	case LargestContributions:
+		return "LargestContributions"
+	}
+	return fmt.Sprintf("ContributionSelection(%d)", int(cs))
+}
+
+// KeyedAggregation maintains one aggregation of type M, e.g. a *Count or a
+// *BoundedSumFloat64, per partition key of type K, i.e. it computes a
+// differentially private group-by. Keys can be of any comparable type, e.g. a
+// struct for keys made of several columns. It takes care of the parts that don't depend on the aggregation:
+//   - at most MaxPartitionsContributed keys are kept for each privacy unit,
+//     chosen uniformly at random, and at most MaxContributionsPerPartition
+//     contributions are kept for each privacy unit and key, chosen according
+//     to ContributionSelection, and
+//   - keys are released only if they are chosen by differentially private
+//     partition selection, using a PreAggSelectPartition per key.
+//
+// If the keys are known in advance, e.g. the days of a reporting period, they
+// can be passed as PublicPartitions instead: then partition selection isn't
+// needed, contributions to other keys are dropped, and every public key is
+// released, including keys without any contribution, whose aggregations only
+// contain noise.
+//
+// The aggregations are created by the New option when the result is computed,
+// only for released keys. They must be initialized with the same
+// MaxPartitionsContributed and MaxContributionsPerPartition (or larger), and
+// their privacy budget is in addition to the budget of partition selection:
+// the total privacy budget of a KeyedAggregation is the budget of partition
+// selection plus the budget of one aggregation. Alternatively, the BudgetSplit
+// option splits a budget explicitly between the keys a privacy unit
+// contributes to, and the aggregations are created by NewWithBudget with the
+// share of their key, see PartitionBudget.
+//
+// Contributions are kept in memory until the result is computed, since
+// contributions that are dropped by contribution bounding can't be removed
+// from an aggregation. This also allows removing all the contributions of a
+// privacy unit before the release, see Remove.
+//
+// Not thread-safe.
+type KeyedAggregation[K comparable, M any] struct {
+	// Parameters
+	newAggregation               func() (M, error)
+	newAggregationWithBudget     func(epsilon, delta float64) (M, error)
+	budget                       *budgetSplit[K]
+	epsilon                      float64
+	delta                        float64
+	maxPartitionsContributed     int64
+	maxContributionsPerPartition int64
+	contributionSelection        ContributionSelection
+	privacyLevel                 PrivacyLevel
+	encoder                      KeyEncoder[K]
+	// Keys released without partition selection, without duplicates, or nil.
+	publicPartitions []K
+	isPublic         map[K]bool
+
+	// State variables
+	users map[string]*userKeys[K, M]
+	// Number of contributions added with EventLevel, used as their privacy IDs.
+	numEvents int64
+	state     aggregationState
+}
+
+// userKeys holds the keys a privacy unit contributed to, with a reservoir
+// sample of keys and, within each key, a reservoir sample of contributions.
+type userKeys[K comparable, M any] struct {
+	// Sampled keys, in no particular order.
+	keys []*userKey[K, M]
+	// Index of each sampled key in keys.
+	indices map[K]int
+	// Number of distinct keys seen so far, including those not sampled.
+	numKeys int64
+	// Keys that were seen but not sampled.
+	dropped map[K]bool
+}
+
+type userKey[K comparable, M any] struct {
+	key           K
+	contributions []func(M) error
+	// Values of the kept contributions, only used with LargestContributions.
+	values           []float64
+	numContributions int64
+}
+
+// KeyedAggregationOptions contains the options necessary to initialize a
+// KeyedAggregation.
+type KeyedAggregationOptions[K comparable, M any] struct {
+	// New returns a new aggregation for a single key. Required, unless
+	// BudgetSplit is set.
+	New func() (M, error)
+	// Explicit split of the budget of the aggregations between the keys a
+	// privacy unit contributes to, see BudgetSplitOptions. Optional; by
+	// default, each aggregation is created by New with the whole budget and
+	// MaxPartitionsContributed, which amounts to EvenSplit with Laplace noise.
+	BudgetSplit *BudgetSplitOptions[K]
+	// NewWithBudget returns a new aggregation for a single key with the given
+	// budget, e.g. the Epsilon and Delta of a Count. The aggregation must be
+	// initialized with a MaxPartitionsContributed of 1, since the budget of
+	// the key is already a share of the budget of all keys. Required with
+	// BudgetSplit, and must be nil otherwise.
+	NewWithBudget func(epsilon, delta float64) (M, error)
+	// Epsilon and Delta specify the (ε,δ)-differential privacy budget used for
+	// partition selection. Required, unless PublicPartitions is set, in which
+	// case they must be 0.
+	Epsilon float64
+	Delta   float64
+	// Keys known in advance, which are all released without partition
+	// selection. Contributions to other keys are dropped. Optional; note that
+	// an empty non-nil slice means that no key is released.
+	PublicPartitions []K
+	// How many distinct keys may a single privacy unit contribute to? Required,
+	// unless PrivacyLevel is EventLevel.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single key?
+	// Defaults to 1.
+	MaxContributionsPerPartition int64
+	// Which contributions are kept when a privacy unit contributes more than
+	// MaxContributionsPerPartition times to a key. Defaults to
+	// RandomContributions.
+	ContributionSelection ContributionSelection
+	// Encoder of the keys, used by EncodedResult. Defaults to StringKeyEncoder
+	// for string keys, and GobKeyEncoder otherwise.
+	KeyEncoder KeyEncoder[K]
+	// What is protected by differential privacy, see PrivacyLevel. With
+	// EventLevel, the privacy IDs passed to Add are ignored, and each
+	// contribution is its own privacy unit. Defaults to UserLevel.
+	PrivacyLevel PrivacyLevel
+}
+
+// NewKeyedAggregation returns a new KeyedAggregation with no keys.
+func NewKeyedAggregation[K comparable, M any](opt *KeyedAggregationOptions[K, M]) (*KeyedAggregation[K, M], error) {
+	if opt == nil {
+		opt = &KeyedAggregationOptions[K, M]{}
+	}
+	if opt.BudgetSplit != nil {
+		if opt.NewWithBudget == nil {
+			return nil, fmt.Errorf("NewKeyedAggregation requires a NewWithBudget function with BudgetSplit")
+		}
+	} else if opt.NewWithBudget != nil {
+		return nil, fmt.Errorf("NewKeyedAggregation: NewWithBudget is set, requires BudgetSplit")
+	} else if opt.New == nil {
+		return nil, fmt.Errorf("NewKeyedAggregation requires a New function")
+	}
+	maxPartitionsContributed, maxContributionsPerPartition, err := opt.PrivacyLevel.contributionBounds(opt.MaxPartitionsContributed, opt.MaxContributionsPerPartition)
+	if err != nil {
+		return nil, fmt.Errorf("NewKeyedAggregation: %w", err)
+	}
+	if maxPartitionsContributed <= 0 {
+		return nil, fmt.Errorf("NewKeyedAggregation: MaxPartitionsContributed is %d, must be strictly positive", maxPartitionsContributed)
+	}
+	if maxContributionsPerPartition == 0 {
+		maxContributionsPerPartition = 1
+	}
+	if maxContributionsPerPartition < 0 {
+		return nil, fmt.Errorf("NewKeyedAggregation: MaxContributionsPerPartition is %d, must be strictly positive", maxContributionsPerPartition)
+	}
+	switch opt.ContributionSelection {
+	case RandomContributions, FirstContributions, LargestContributions:
+	default:
+		return nil, fmt.Errorf("NewKeyedAggregation: unknown ContributionSelection %v", opt.ContributionSelection)
+	}
+	var publicPartitions []K
+	var isPublic map[K]bool
+	if opt.PublicPartitions == nil {
+		// Check that the parameters are compatible with partition selection.
+		if _, err := NewPreAggSelectPartition(&PreAggSelectPartitionOptions{
+			Epsilon:                  opt.Epsilon,
+			Delta:                    opt.Delta,
+			MaxPartitionsContributed: maxPartitionsContributed,
+		}); err != nil {
+			return nil, fmt.Errorf("NewKeyedAggregation: %w", err)
+		}
+	} else {
+		if opt.Epsilon != 0 || opt.Delta != 0 {
+			return nil, fmt.Errorf("NewKeyedAggregation: Epsilon is %f and Delta is %e, must be 0 with PublicPartitions since partition selection isn't needed", opt.Epsilon, opt.Delta)
+		}
+		isPublic = make(map[K]bool)
+		publicPartitions = make([]K, 0, len(opt.PublicPartitions))
+		for _, key := range opt.PublicPartitions {
+			if !isPublic[key] {
+				isPublic[key] = true
+				publicPartitions = append(publicPartitions, key)
+			}
+		}
+	}
+	var budget *budgetSplit[K]
+	if opt.BudgetSplit != nil {
+		if budget, err = newBudgetSplit(opt.BudgetSplit, maxPartitionsContributed, publicPartitions); err != nil {
+			return nil, fmt.Errorf("NewKeyedAggregation: %w", err)
+		}
+	}
+	encoder := opt.KeyEncoder
+	if encoder == nil {
+		encoder = defaultKeyEncoder[K]()
+	}
+	return &KeyedAggregation[K, M]{
+		newAggregation:               opt.New,
+		newAggregationWithBudget:     opt.NewWithBudget,
+		budget:                       budget,
+		epsilon:                      opt.Epsilon,
+		delta:                        opt.Delta,
+		maxPartitionsContributed:     maxPartitionsContributed,
+		maxContributionsPerPartition: maxContributionsPerPartition,
+		contributionSelection:        opt.ContributionSelection,
+		privacyLevel:                 opt.PrivacyLevel,
+		encoder:                      encoder,
+		publicPartitions:             publicPartitions,
+		isPublic:                     isPublic,
+		users:                        make(map[string]*userKeys[K, M]),
+		state:                        defaultState,
+	}, nil
+}
+
+// Add adds a contribution of the given privacy unit to the given key.
+// contribute is called with the aggregation of the key when the result is
+// computed, if the contribution is kept and the key is released, e.g.
+//
+//	ka.Add(userID, key, func(c *Count) error { return c.Increment() })
+func (ka *KeyedAggregation[K, M]) Add(privacyID string, key K, contribute func(M) error) error {
+	return ka.AddValue(privacyID, key, 0, contribute)
+}
+
+// AddValue is like Add, but the contribution has the given value, e.g. the
+// value that contribute adds to a sum, which is used to rank the
+// contributions with LargestContributions. The value is ignored by the other
+// contribution selections.
+func (ka *KeyedAggregation[K, M]) AddValue(privacyID string, key K, value float64, contribute func(M) error) error {
+	if ka.state != defaultState {
+		return fmt.Errorf("KeyedAggregation cannot be amended: %w", ka.state.transitionError(defaultState))
+	}
+	// Dropping contributions to non-public keys before contribution bounding
+	// keeps more contributions to public keys.
+	if ka.isPublic != nil && !ka.isPublic[key] {
+		return nil
+	}
+	if ka.privacyLevel == EventLevel {
+		ka.numEvents++
+		privacyID = strconv.FormatInt(ka.numEvents, 10)
+	}
+	u, ok := ka.users[privacyID]
+	if !ok {
+		u = &userKeys[K, M]{indices: make(map[K]int), dropped: make(map[K]bool)}
+		ka.users[privacyID] = u
+	}
+	u.add(key, contribute, value, ka.maxPartitionsContributed, ka.maxContributionsPerPartition, ka.contributionSelection)
+	return nil
+}
+
+// Remove removes all the contributions of the given privacy unit, e.g. to
+// honor a deletion request that arrives before the result is computed. The
+// result is then the same as if the privacy unit never contributed. Removing
+// a privacy unit without contributions has no effect; contributions added for
+// it after Remove are kept as those of a new privacy unit. Remove isn't
+// supported with EventLevel, since contributions then have no privacy ID.
+func (ka *KeyedAggregation[K, M]) Remove(privacyID string) error {
+	if ka.state != defaultState {
+		return fmt.Errorf("KeyedAggregation cannot be amended: %w", ka.state.transitionError(defaultState))
+	}
+	if ka.privacyLevel == EventLevel {
+		return fmt.Errorf("KeyedAggregation can't remove privacy units with EventLevel")
+	}
+	delete(ka.users, privacyID)
+	return nil
+}
+
+// add adds a contribution to the given key, keeping a reservoir sample of at
+// most maxKeys keys, and at most maxContributions contributions per key chosen
+// according to selection.
+func (u *userKeys[K, M]) add(key K, contribute func(M) error, value float64, maxKeys, maxContributions int64, selection ContributionSelection) {
+	if u.dropped[key] {
+		return
+	}
+	i, ok := u.indices[key]
+	if !ok {
+		// A new key: reservoir sampling over the keys of the privacy unit.
+		u.numKeys++
+		k := &userKey[K, M]{key: key}
+		switch {
+		case int64(len(u.keys)) < maxKeys:
+			i = len(u.keys)
+			u.keys = append(u.keys, k)
+		case rand.I63n(u.numKeys) < maxKeys:
+			i = int(rand.I63n(maxKeys))
+			evicted := u.keys[i]
+			delete(u.indices, evicted.key)
+			u.dropped[evicted.key] = true
+			u.keys[i] = k
+		default:
+			u.dropped[key] = true
+			return
+		}
+		u.indices[key] = i
+	}
+	k := u.keys[i]
+	k.numContributions++
+	if int64(len(k.contributions)) < maxContributions {
+		k.contributions = append(k.contributions, contribute)
+		if selection == LargestContributions {
+			k.values = append(k.values, value)
+		}
+		return
+	}
+	switch selection {
+	case RandomContributions:
+		// Reservoir sampling over the contributions to the key.
+		if rand.I63n(k.numContributions) < maxContributions {
+			k.contributions[rand.I63n(maxContributions)] = contribute
+		}
+	case LargestContributions:
+		// Replace the smallest kept contribution.
+		smallest := 0
+		for j, v := range k.values {
+			if v < k.values[smallest] {
+				smallest = j
+			}
+		}
+		if value > k.values[smallest] {
+			k.contributions[smallest] = contribute
+			k.values[smallest] = value
+		}
+	}
+}
+
+// Result returns the aggregations of the keys released by partition
+// selection, to which the kept contributions have been added. Their
+// differentially private results can then be computed with their own methods,
+// e.g. Result. The method can be called only once.
+//
+// For releases with many keys, ResultFunc avoids holding all the released
+// aggregations in memory at once.
+func (ka *KeyedAggregation[K, M]) Result() (map[K]M, error) {
+	result := make(map[K]M)
+	err := ka.ResultFunc(func(key K, m M) error {
+		result[key] = m
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResultFunc is like Result, but instead of returning a map, it calls f with
+// each released key and its aggregation, one key at a time and in no
+// particular order, or in the order of PublicPartitions if it is set. The contributions of a key are discarded once f has been
+// called for it, so that f can e.g. write the differentially private result of
+// the aggregation and let it be garbage-collected. If f returns an error,
+// ResultFunc stops and returns it; the keys that haven't been passed to f yet
+// can't be released anymore. The method can be called only once, and
+// ResultFunc, Result and EncodedResult can't be used together.
+func (ka *KeyedAggregation[K, M]) ResultFunc(f func(key K, m M) error) error {
+	if ka.state != defaultState {
+		return fmt.Errorf("KeyedAggregation's noised result cannot be computed: %w", ka.state.transitionError(resultReturned))
+	}
+	ka.state = resultReturned
+	contributions := make(map[K][]func(M) error)
+	idCounts := make(map[K]int64)
+	for _, u := range ka.users {
+		for _, k := range u.keys {
+			contributions[k.key] = append(contributions[k.key], k.contributions...)
+			idCounts[k.key]++
+		}
+	}
+	ka.users = nil
+	if ka.publicPartitions != nil {
+		for _, key := range ka.publicPartitions {
+			keyContributions := contributions[key]
+			delete(contributions, key)
+			if err := ka.release(f, key, keyContributions); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for key, idCount := range idCounts {
+		keyContributions := contributions[key]
+		delete(contributions, key)
+		selection, err := NewPreAggSelectPartition(&PreAggSelectPartitionOptions{
+			Epsilon:                  ka.epsilon,
+			Delta:                    ka.delta,
+			MaxPartitionsContributed: ka.maxPartitionsContributed,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't initialize partition selection for KeyedAggregation: %w", err)
+		}
+		selection.idCount = idCount
+		keep, err := selection.ShouldKeepPartition()
+		if err != nil {
+			return fmt.Errorf("couldn't select partitions for KeyedAggregation: %w", err)
+		}
+		if !keep {
+			continue
+		}
+		if err := ka.release(f, key, keyContributions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release creates the aggregation of a released key, adds the given
+// contributions to it and passes it to f.
+func (ka *KeyedAggregation[K, M]) release(f func(key K, m M) error, key K, contributions []func(M) error) error {
+	var m M
+	var err error
+	if ka.budget != nil {
+		m, err = ka.newAggregationWithBudget(ka.budget.keyBudget(key))
+	} else {
+		m, err = ka.newAggregation()
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't initialize aggregation of KeyedAggregation: %w", err)
+	}
+	for _, contribute := range contributions {
+		if err := contribute(m); err != nil {
+			return fmt.Errorf("couldn't add contribution to aggregation of KeyedAggregation: %w", err)
+		}
+	}
+	return f(key, m)
+}
+
+// PartitionBudget returns the effective (ε,δ) budget of the aggregation of the
+// given key with BudgetSplit, i.e. the budget passed to NewWithBudget, e.g. to
+// report it along with the results. It returns an error if BudgetSplit isn't
+// set, since the aggregations then share a budget that is only split by their
+// noise.
+func (ka *KeyedAggregation[K, M]) PartitionBudget(key K) (epsilon, delta float64, err error) {
+	if ka.budget == nil {
+		return 0, 0, fmt.Errorf("KeyedAggregation has no BudgetSplit, the budget of its aggregations isn't split between keys")
+	}
+	epsilon, delta = ka.budget.keyBudget(key)
+	return epsilon, delta, nil
+}
+
+// EncodedResult is like Result, but the keys of the returned map are encoded
+// with the KeyEncoder of the KeyedAggregation, e.g. to serialize them.
+func (ka *KeyedAggregation[K, M]) EncodedResult() (map[string]M, error) {
+	result, err := ka.Result()
+	if err != nil {
+		return nil, err
+	}
+	encoded := make(map[string]M, len(result))
+	for key, m := range result {
+		e, err := ka.encoder.EncodeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't encode key of KeyedAggregation: %w", err)
+		}
+		encoded[e] = m
+	}
+	return encoded, nil
+}
+
+// KeyedResult is a released key of a KeyedAggregation and its aggregation, see
+// SortedResult.
+type KeyedResult[K comparable, M any] struct {
+	Key K
+	// Encoding of Key by the KeyEncoder of the KeyedAggregation.
+	EncodedKey  string
+	Aggregation M
+}
+
+// SortedResult is like Result, but returns the released keys and their
+// aggregations sorted by the encodings of the keys with the KeyEncoder of the
+// KeyedAggregation, so that results are in a deterministic order across runs,
+// e.g. for stable diffs and golden tests. With PublicPartitions, the result
+// has a fixed schema: every public key has a row, including keys without any
+// contribution.
+func (ka *KeyedAggregation[K, M]) SortedResult() ([]KeyedResult[K, M], error) {
+	var result []KeyedResult[K, M]
+	err := ka.ResultFunc(func(key K, m M) error {
+		e, err := ka.encoder.EncodeKey(key)
+		if err != nil {
+			return fmt.Errorf("couldn't encode key of KeyedAggregation: %w", err)
+		}
+		result = append(result, KeyedResult[K, M]{Key: key, EncodedKey: e, Aggregation: m})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EncodedKey < result[j].EncodedKey })
+	return result, nil
+}
@@ -0,0 +1,411 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newNoiselessCountForKey(maxPartitionsContributed int64) func() (*Count, error) {
+	return func() (*Count, error) {
+		return NewCount(&CountOptions{Epsilon: ln3, MaxPartitionsContributed: maxPartitionsContributed, Noise: noNoise{}})
+	}
+}
+
+func increment(c *Count) error {
+	return c.Increment()
+}
+
+func TestNewKeyedAggregationInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *KeyedAggregationOptions[string, *Count]
+	}{
+		{"nil options", nil},
+		{"no New function", &KeyedAggregationOptions[string, *Count]{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 1}},
+		{"zero MaxPartitionsContributed", &KeyedAggregationOptions[string, *Count]{New: newNoiselessCountForKey(1), Epsilon: ln3, Delta: 1e-5}},
+		{"unknown ContributionSelection", &KeyedAggregationOptions[string, *Count]{New: newNoiselessCountForKey(1), Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 1, ContributionSelection: -1}},
+		{"negative MaxContributionsPerPartition", &KeyedAggregationOptions[string, *Count]{New: newNoiselessCountForKey(1), Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 1, MaxContributionsPerPartition: -1}},
+		{"zero epsilon", &KeyedAggregationOptions[string, *Count]{New: newNoiselessCountForKey(1), Delta: 1e-5, MaxPartitionsContributed: 1}},
+		{"zero delta", &KeyedAggregationOptions[string, *Count]{New: newNoiselessCountForKey(1), Epsilon: ln3, MaxPartitionsContributed: 1}},
+		{"epsilon with PublicPartitions", &KeyedAggregationOptions[string, *Count]{New: newNoiselessCountForKey(1), Epsilon: ln3, PublicPartitions: []string{"a"}, MaxPartitionsContributed: 1}},
+	} {
+		if _, err := NewKeyedAggregation(tc.opts); err == nil {
+			t.Errorf("NewKeyedAggregation: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestKeyedAggregationBoundsContributions(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                          newNoiselessCountForKey(2),
+		Epsilon:                      ln3,
+		Delta:                        1e-10,
+		MaxPartitionsContributed:     2,
+		MaxContributionsPerPartition: 3,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	// Each of 1000 users contributes 5 times to each of 4 keys, so all keys keep
+	// contributions of many users and are released.
+	for i := 0; i < 1000; i++ {
+		for _, key := range []string{"a", "b", "c", "d"} {
+			for j := 0; j < 5; j++ {
+				if err := ka.Add(fmt.Sprintf("user%d", i), key, increment); err != nil {
+					t.Fatalf("Couldn't add contribution: %v", err)
+				}
+			}
+		}
+	}
+	got, err := ka.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("Result: got %d keys, want 4", len(got))
+	}
+	var total int64
+	for key, c := range got {
+		count, err := c.Result()
+		if err != nil {
+			t.Fatalf("Couldn't compute count of key %s: %v", key, err)
+		}
+		total += count
+	}
+	// Each user keeps 2 keys with 3 contributions each.
+	if want := int64(1000 * 2 * 3); total != want {
+		t.Errorf("Result: got a total count of %d, want %d", total, want)
+	}
+}
+
+func TestKeyedAggregationRemove(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := ka.Add(fmt.Sprintf("user%d", i), "a", increment); err != nil {
+			t.Fatalf("Couldn't add contribution: %v", err)
+		}
+	}
+	// The only privacy unit contributing to "b" is removed, so "b" is neither
+	// released nor counted.
+	if err := ka.Add("deleted", "b", increment); err != nil {
+		t.Fatalf("Couldn't add contribution: %v", err)
+	}
+	for _, id := range []string{"deleted", "user0", "unknown"} {
+		if err := ka.Remove(id); err != nil {
+			t.Fatalf("Remove(%q): got error %v", id, err)
+		}
+	}
+	got, err := ka.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	if _, ok := got["b"]; ok {
+		t.Errorf("Result: got key \"b\" whose only privacy unit was removed")
+	}
+	c, ok := got["a"]
+	if !ok {
+		t.Fatalf("Result: key \"a\" wasn't released")
+	}
+	count, err := c.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute count: %v", err)
+	}
+	if count != 999 {
+		t.Errorf("Result: got a count of %d, want 999", count)
+	}
+	if err := ka.Remove("user1"); err == nil {
+		t.Errorf("Remove after Result: got no error, want error")
+	}
+}
+
+// Tests that the contribution selections keep the expected contributions when
+// each user contributes the values 1 to 5, in this order, to a single key.
+func TestKeyedAggregationContributionSelection(t *testing.T) {
+	for _, tc := range []struct {
+		selection ContributionSelection
+		want      float64
+	}{
+		{FirstContributions, 1000 * (1 + 2)},
+		{LargestContributions, 1000 * (4 + 5)},
+		// Kept contributions are a uniform sample, with an expected sum of
+		// 1000 * 2 * 3.
+		{RandomContributions, 1000 * 2 * 3},
+	} {
+		ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *BoundedSumFloat64]{
+			New: func() (*BoundedSumFloat64, error) {
+				return NewBoundedSum(&BoundedSumFloat64Options{Epsilon: ln3, Lower: 0, Upper: 10, Noise: noNoise{}})
+			},
+			Epsilon:                      ln3,
+			Delta:                        1e-10,
+			MaxPartitionsContributed:     1,
+			MaxContributionsPerPartition: 2,
+			ContributionSelection:        tc.selection,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize keyed aggregation with %v: %v", tc.selection, err)
+		}
+		for i := 0; i < 1000; i++ {
+			for v := 1.0; v <= 5; v++ {
+				v := v
+				if err := ka.AddValue(fmt.Sprintf("user%d", i), "key", v, func(bs *BoundedSumFloat64) error { return bs.Add(v) }); err != nil {
+					t.Fatalf("Couldn't add contribution with %v: %v", tc.selection, err)
+				}
+			}
+		}
+		got, err := ka.Result()
+		if err != nil {
+			t.Fatalf("Couldn't compute result with %v: %v", tc.selection, err)
+		}
+		sum, err := got["key"].Result()
+		if err != nil {
+			t.Fatalf("Couldn't compute sum with %v: %v", tc.selection, err)
+		}
+		// The sum of the 2 kept values of a user has a standard deviation below
+		// 2, so the total has a standard deviation below 2·√1000 ≈ 63.
+		if tolerance := 300.0; math.Abs(sum-tc.want) > tolerance {
+			t.Errorf("Result with %v: got a sum of %f, want %f", tc.selection, sum, tc.want)
+		}
+	}
+}
+
+func TestKeyedAggregationSelectsPartitions(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := ka.Add(fmt.Sprintf("user%d", i), "popular", increment); err != nil {
+			t.Fatalf("Couldn't add contribution: %v", err)
+		}
+	}
+	// A key with a single privacy unit is dropped with probability 1-δ.
+	if err := ka.Add("other user", "rare", increment); err != nil {
+		t.Fatalf("Couldn't add contribution: %v", err)
+	}
+	got, err := ka.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	if _, ok := got["rare"]; ok {
+		t.Errorf("Result: got key \"rare\", want it to be dropped")
+	}
+	c, ok := got["popular"]
+	if !ok {
+		t.Fatalf("Result: didn't get key \"popular\", want it to be kept")
+	}
+	if count, err := c.Result(); err != nil || count != 1000 {
+		t.Errorf("Result: got count %d and err %v for key \"popular\", want 1000 and no error", count, err)
+	}
+}
+
+func TestKeyedAggregationResultCalledTwice(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	if _, err := ka.Result(); err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	if _, err := ka.Result(); err == nil {
+		t.Errorf("Result: calling Result twice got no error, want error")
+	}
+	if err := ka.Add("user", "key", increment); err == nil {
+		t.Errorf("Add: calling Add after Result got no error, want error")
+	}
+}
+
+func TestKeyedAggregationTupleKeys(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[testTupleKey, *Count]{
+		New:                      newNoiselessCountForKey(1),
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	key := testTupleKey{"FR", "mobile", 1}
+	for i := 0; i < 1000; i++ {
+		if err := ka.Add(fmt.Sprintf("user%d", i), key, increment); err != nil {
+			t.Fatalf("Couldn't add contribution: %v", err)
+		}
+	}
+	got, err := ka.EncodedResult()
+	if err != nil {
+		t.Fatalf("Couldn't compute result: %v", err)
+	}
+	encoded, err := (GobKeyEncoder[testTupleKey]{}).EncodeKey(key)
+	if err != nil {
+		t.Fatalf("Couldn't encode key: %v", err)
+	}
+	c, ok := got[encoded]
+	if !ok {
+		t.Fatalf("EncodedResult: didn't get key %v, got %v", key, got)
+	}
+	if count, err := c.Result(); err != nil || count != 1000 {
+		t.Errorf("EncodedResult: got count %d and err %v for key %v, want 1000 and no error", count, err, key)
+	}
+}
+
+func TestKeyedAggregationResultFunc(t *testing.T) {
+	newKeyedAggregation := func() *KeyedAggregation[string, *Count] {
+		ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+			New:                      newNoiselessCountForKey(1),
+			Epsilon:                  ln3,
+			Delta:                    1e-10,
+			MaxPartitionsContributed: 1,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+		}
+		for i := 0; i < 3000; i++ {
+			key := fmt.Sprintf("key%d", i%3)
+			if err := ka.Add(fmt.Sprintf("user%d", i), key, increment); err != nil {
+				t.Fatalf("Couldn't add contribution: %v", err)
+			}
+		}
+		return ka
+	}
+
+	got := make(map[string]int64)
+	err := newKeyedAggregation().ResultFunc(func(key string, c *Count) error {
+		if _, ok := got[key]; ok {
+			t.Errorf("ResultFunc: got key %s twice", key)
+		}
+		count, err := c.Result()
+		got[key] = count
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ResultFunc: got err %v", err)
+	}
+	want := map[string]int64{"key0": 1000, "key1": 1000, "key2": 1000}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ResultFunc: got diff (-want +got):\n%s", diff)
+	}
+
+	// ResultFunc stops at the first error.
+	calls := 0
+	wantErr := fmt.Errorf("write failed")
+	err = newKeyedAggregation().ResultFunc(func(string, *Count) error {
+		calls++
+		return wantErr
+	})
+	if err != wantErr || calls != 1 {
+		t.Errorf("ResultFunc: with a failing f got err %v after %d calls, want %v after 1 call", err, calls, wantErr)
+	}
+}
+
+func TestKeyedAggregationPublicPartitions(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:                      newNoiselessCountForKey(2),
+		PublicPartitions:         []string{"c", "a", "b", "a"},
+		MaxPartitionsContributed: 2,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	// A single user contributes to "a", to "c", and to the non-public key "d",
+	// which is dropped before contribution bounding; no user contributes to "b".
+	for _, key := range []string{"d", "a", "c"} {
+		if err := ka.Add("user", key, increment); err != nil {
+			t.Fatalf("Couldn't add contribution: %v", err)
+		}
+	}
+	got, err := ka.SortedResult()
+	if err != nil {
+		t.Fatalf("SortedResult: got error %v", err)
+	}
+	// All public keys are released without partition selection, in sorted
+	// order, including "b" without any contribution.
+	var keys []string
+	counts := make(map[string]int64)
+	for _, r := range got {
+		keys = append(keys, r.Key)
+		if r.EncodedKey != r.Key {
+			t.Errorf("SortedResult: got encoded key %q for key %q, want %q", r.EncodedKey, r.Key, r.Key)
+		}
+		if counts[r.Key], err = r.Aggregation.Result(); err != nil {
+			t.Fatalf("Count.Result for key %s: got error %v", r.Key, err)
+		}
+	}
+	if diff := cmp.Diff([]string{"a", "b", "c"}, keys); diff != "" {
+		t.Errorf("SortedResult: got keys diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int64{"a": 1, "b": 0, "c": 1}, counts); diff != "" {
+		t.Errorf("SortedResult: got counts diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestKeyedAggregationSortedResultIsDeterministic(t *testing.T) {
+	var want []string
+	for run := 0; run < 5; run++ {
+		ka, err := NewKeyedAggregation(&KeyedAggregationOptions[int, *Count]{
+			New:                      newNoiselessCountForKey(1),
+			Epsilon:                  ln3,
+			Delta:                    1e-10,
+			MaxPartitionsContributed: 1,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+		}
+		for i := 0; i < 2000; i++ {
+			if err := ka.Add(fmt.Sprintf("user%d", i), i%4, increment); err != nil {
+				t.Fatalf("Couldn't add contribution: %v", err)
+			}
+		}
+		got, err := ka.SortedResult()
+		if err != nil {
+			t.Fatalf("SortedResult: got error %v", err)
+		}
+		var keys []string
+		for _, r := range got {
+			keys = append(keys, r.EncodedKey)
+		}
+		if run == 0 {
+			want = keys
+			if len(want) != 4 {
+				t.Fatalf("SortedResult: got %d keys, want 4", len(want))
+			}
+		} else if diff := cmp.Diff(want, keys); diff != "" {
+			t.Errorf("SortedResult in run %d: got diff (-want +got):\n%s", run, diff)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// Leaderboard releases the K candidate keys with the largest counts, together
+// with differentially private estimates of these counts.
+//
+// The release consists of two steps, which share the (ε, δ) budget:
+//  1. Selection: the K keys are chosen with the one-shot Gumbel mechanism of
+//     Durfee and Rogers' "Practical Differentially Private Top-k Selection with
+//     Pay-what-you-get Composition" (https://arxiv.org/abs/1905.04273). Half of
+//     ε is used for this step, and no δ.
+//  2. Measurement: the counts of the selected keys are released with the
+//     configured noise, using the other half of ε and all of δ.
+//
+// Since only the selected keys are released, a privacy unit affects at most
+// min(MaxPartitionsContributed, K) released counts.
+//
+// The set of candidate keys must be public, i.e. not derived from the data.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type Leaderboard struct {
+	// Parameters
+	selectionEpsilon   float64
+	measurementEpsilon float64
+	delta              float64
+	k                  int
+	l0Sensitivity      int64
+	lInfSensitivity    int64
+	Noise              noise.Noise
+
+	// State variables
+	counts map[string]int64
+	state  aggregationState
+}
+
+// LeaderboardOptions contains the options necessary to initialize a Leaderboard.
+type LeaderboardOptions struct {
+	Epsilon                      float64     // Privacy parameter ε, split between selection and measurement. Required.
+	Delta                        float64     // Privacy parameter δ, used for measurement only. Required with Gaussian noise, must be 0 with Laplace noise.
+	K                            int         // How many keys are released? Required.
+	Candidates                   []string    // Public set of keys among which the top K are selected. Required.
+	MaxPartitionsContributed     int64       // How many distinct keys may a single privacy unit contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64       // How many times may a single privacy unit contribute to a single key? Defaults to 1.
+	Noise                        noise.Noise // Type of noise used for measurement. Defaults to Laplace noise.
+}
+
+// LeaderboardEntry is a released key of a Leaderboard with its noisy count.
+type LeaderboardEntry struct {
+	Key   string
+	Count int64
+}
+
+// NewLeaderboard returns a new Leaderboard, in which all candidate counts are
+// initialized at 0.
+func NewLeaderboard(opt *LeaderboardOptions) (*Leaderboard, error) {
+	if opt == nil {
+		opt = &LeaderboardOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if len(opt.Candidates) == 0 {
+		return nil, fmt.Errorf("NewLeaderboard requires at least one candidate key")
+	}
+	if opt.K <= 0 || opt.K > len(opt.Candidates) {
+		return nil, fmt.Errorf("NewLeaderboard: K is %d, must be between 1 and the number of candidates (%d)", opt.K, len(opt.Candidates))
+	}
+	counts := make(map[string]int64, len(opt.Candidates))
+	for _, c := range opt.Candidates {
+		if _, ok := counts[c]; ok {
+			return nil, fmt.Errorf("NewLeaderboard: candidate key %q is duplicated", c)
+		}
+		counts[c] = 0
+	}
+
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewLeaderboard: %w", err)
+	}
+	if err := checks.CheckL0Sensitivity(l0); err != nil {
+		return nil, fmt.Errorf("NewLeaderboard: %w", err)
+	}
+	if err := checks.CheckLInfSensitivity(float64(lInf)); err != nil {
+		return nil, fmt.Errorf("NewLeaderboard: %w", err)
+	}
+	selectionEps, measurementEps := opt.Epsilon/2, opt.Epsilon/2
+	l0Measurement := l0
+	if int64(opt.K) < l0Measurement {
+		l0Measurement = int64(opt.K)
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, l0Measurement, lInf, measurementEps, opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewLeaderboard: %w", err)
+	}
+
+	return &Leaderboard{
+		selectionEpsilon:   selectionEps,
+		measurementEpsilon: measurementEps,
+		delta:              opt.Delta,
+		k:                  opt.K,
+		l0Sensitivity:      l0Measurement,
+		lInfSensitivity:    lInf,
+		Noise:              n,
+		counts:             counts,
+		state:              defaultState,
+	}, nil
+}
+
+// Add increments the count of the given candidate key by one.
+func (lb *Leaderboard) Add(key string) error {
+	return lb.AddBy(key, 1)
+}
+
+// AddBy increments the count of the given candidate key by the given value.
+// Note that the total contribution of a privacy unit to a single key must not
+// exceed MaxContributionsPerPartition.
+func (lb *Leaderboard) AddBy(key string, count int64) error {
+	if lb.state != defaultState {
+		return fmt.Errorf("Leaderboard cannot be amended: %w", lb.state.transitionError(defaultState))
+	}
+	if _, ok := lb.counts[key]; !ok {
+		return fmt.Errorf("Leaderboard cannot be amended: %q is not a candidate key", key)
+	}
+	lb.counts[key] += count
+	return nil
+}
+
+// Result returns the K selected keys, in decreasing order of their noisy
+// counts. The method can be called only once.
+//
+// Ties between raw counts are broken by the selection noise, which is drawn
+// afresh for every call to NewLeaderboard. The released order only depends on
+// the noisy counts: ties between noisy counts are broken by the order in which
+// keys were selected, so the ordering is deterministic given the released
+// values and does not reveal additional information about the raw counts.
+func (lb *Leaderboard) Result() ([]LeaderboardEntry, error) {
+	if lb.state != defaultState {
+		return nil, fmt.Errorf("Leaderboard's noised result cannot be computed: %w", lb.state.transitionError(resultReturned))
+	}
+	lb.state = resultReturned
+
+	// Selection. The one-shot Gumbel mechanism selecting K keys is equivalent to
+	// K successive applications of the exponential mechanism (each removing the
+	// selected key), each with privacy parameter ε_sel/K. Counts are monotonic
+	// (adding a privacy unit can only increase them), so each exponential
+	// mechanism with a Gumbel scale of Δ/(ε_sel/K) is (ε_sel/K)-DP, where Δ is
+	// the L_∞ sensitivity of a single count.
+	scale := float64(lb.lInfSensitivity) * float64(lb.k) / lb.selectionEpsilon
+	type scoredKey struct {
+		key   string
+		score float64
+	}
+	scored := make([]scoredKey, 0, len(lb.counts))
+	for key, count := range lb.counts {
+		scored = append(scored, scoredKey{key, float64(count) + scale*gumbel()})
+	}
+	// The iteration order of the map is irrelevant: the scores are continuous
+	// random variables, and exact ties have probability zero. Keys are used as a
+	// last resort so that the selection is a deterministic function of the noise.
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].key < scored[j].key
+	})
+
+	// Measurement.
+	entries := make([]LeaderboardEntry, lb.k)
+	for i := 0; i < lb.k; i++ {
+		key := scored[i].key
+		noisedCount, err := lb.Noise.AddNoiseInt64(lb.counts[key], lb.l0Sensitivity, lb.lInfSensitivity, lb.measurementEpsilon, lb.delta)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of key %q: %w", key, err)
+		}
+		entries[i] = LeaderboardEntry{Key: key, Count: noisedCount}
+	}
+	// A stable sort keeps the selection order among equal noisy counts.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Count > entries[j].Count
+	})
+	return entries, nil
+}
+
+// gumbel returns a sample from the standard Gumbel distribution, i.e. with
+// location 0 and scale 1.
+func gumbel() float64 {
+	u := rand.Uniform()
+	for u == 1 {
+		// -log(-log(1)) is infinite.
+		u = rand.Uniform()
+	}
+	return -math.Log(-math.Log(u))
+}
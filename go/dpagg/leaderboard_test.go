@@ -0,0 +1,165 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewLeaderboardInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *LeaderboardOptions
+	}{
+		{"nil options", nil},
+		{"no candidates", &LeaderboardOptions{Epsilon: ln3, K: 1}},
+		{"K is zero", &LeaderboardOptions{Epsilon: ln3, Candidates: []string{"a"}}},
+		{"K larger than number of candidates", &LeaderboardOptions{Epsilon: ln3, K: 2, Candidates: []string{"a"}}},
+		{"duplicated candidate", &LeaderboardOptions{Epsilon: ln3, K: 1, Candidates: []string{"a", "a"}}},
+		{"zero epsilon", &LeaderboardOptions{K: 1, Candidates: []string{"a"}}},
+		{"negative max partitions", &LeaderboardOptions{Epsilon: ln3, K: 1, Candidates: []string{"a"}, MaxPartitionsContributed: -1}},
+		{"delta with Laplace noise", &LeaderboardOptions{Epsilon: ln3, Delta: 1e-5, K: 1, Candidates: []string{"a"}}},
+	} {
+		if _, err := NewLeaderboard(tc.opts); err == nil {
+			t.Errorf("NewLeaderboard: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestLeaderboardSelectsTopKeys(t *testing.T) {
+	lb, err := NewLeaderboard(&LeaderboardOptions{
+		Epsilon:    1e6, // Selection is effectively deterministic.
+		K:          2,
+		Candidates: []string{"a", "b", "c", "d"},
+		Noise:      noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize leaderboard: %v", err)
+	}
+	for key, count := range map[string]int64{"a": 10, "b": 1000, "c": 500, "d": 20} {
+		if err := lb.AddBy(key, count); err != nil {
+			t.Fatalf("AddBy(%q, %d): got error %v", key, count, err)
+		}
+	}
+	got, err := lb.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []LeaderboardEntry{{"b", 1000}, {"c", 500}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// Tests that ties between raw counts are broken uniformly at random by the
+// selection noise.
+func TestLeaderboardTiesAreBrokenRandomly(t *testing.T) {
+	const numberOfTrials = 2000
+	selectedA := 0
+	for i := 0; i < numberOfTrials; i++ {
+		lb, err := NewLeaderboard(&LeaderboardOptions{
+			Epsilon:    ln3,
+			K:          1,
+			Candidates: []string{"a", "b"},
+			Noise:      noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize leaderboard: %v", err)
+		}
+		lb.AddBy("a", 5)
+		lb.AddBy("b", 5)
+		got, err := lb.Result()
+		if err != nil {
+			t.Fatalf("Result: got error %v", err)
+		}
+		if got[0].Key == "a" {
+			selectedA++
+		}
+	}
+	// The standard deviation of the number of times "a" is selected is about 22.
+	if math.Abs(float64(selectedA)-numberOfTrials/2) > 150 {
+		t.Errorf("Result: selected \"a\" %d times out of %d, want about half", selectedA, numberOfTrials)
+	}
+}
+
+func TestLeaderboardSortsByNoisyCountStably(t *testing.T) {
+	lb, err := NewLeaderboard(&LeaderboardOptions{
+		Epsilon:    1e6,
+		K:          3,
+		Candidates: []string{"a", "b", "c"},
+		Noise:      noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize leaderboard: %v", err)
+	}
+	lb.AddBy("a", 100)
+	lb.AddBy("b", 200)
+	lb.AddBy("c", 300)
+	got, err := lb.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Count > got[i-1].Count {
+			t.Errorf("Result: got %v, want entries in decreasing order of count", got)
+		}
+	}
+}
+
+func TestLeaderboardMeasurementSensitivity(t *testing.T) {
+	lb, err := NewLeaderboard(&LeaderboardOptions{
+		Epsilon:                  ln3,
+		Delta:                    1e-5,
+		K:                        2,
+		Candidates:               []string{"a", "b", "c"},
+		MaxPartitionsContributed: 3,
+		Noise:                    noise.Gaussian(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize leaderboard: %v", err)
+	}
+	// A privacy unit can affect at most K released counts.
+	if lb.l0Sensitivity != 2 {
+		t.Errorf("NewLeaderboard: got l0 sensitivity %d for measurement, want 2", lb.l0Sensitivity)
+	}
+	if lb.selectionEpsilon+lb.measurementEpsilon != ln3 {
+		t.Errorf("NewLeaderboard: got selection ε %f and measurement ε %f, want them to sum to %f", lb.selectionEpsilon, lb.measurementEpsilon, ln3)
+	}
+}
+
+func TestLeaderboardStateChecks(t *testing.T) {
+	lb, err := NewLeaderboard(&LeaderboardOptions{Epsilon: ln3, K: 1, Candidates: []string{"a"}, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize leaderboard: %v", err)
+	}
+	if err := lb.Add("b"); err == nil {
+		t.Errorf("Add: got no error for a key that is not a candidate, want error")
+	}
+	if _, err := lb.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if err := lb.Add("a"); err == nil {
+		t.Errorf("Add: got no error after Result, want error")
+	}
+	if _, err := lb.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
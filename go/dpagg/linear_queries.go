@@ -0,0 +1,430 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+	"gonum.org/v1/gonum/mat"
+)
+
+// QueryStrategy is the strategy used by LinearQueries to answer a workload of
+// linear queries: the queries that are actually noised, from which the
+// answers to the workload are reconstructed.
+type QueryStrategy int
+
+const (
+	// OptimizedStrategy uses whichever of IdentityStrategy,
+	// HierarchicalStrategy, WorkloadStrategy and EigenStrategy gives the lowest
+	// expected total squared error on the workload. It is the default.
+	OptimizedStrategy QueryStrategy = iota
+	// IdentityStrategy noises the count of each bucket, which is best for
+	// queries on few buckets.
+	IdentityStrategy
+	// HierarchicalStrategy noises the counts of the nodes of a binary tree
+	// over the buckets, each node covering a range of consecutive buckets,
+	// which is good for range queries, especially with Laplace noise and many
+	// buckets.
+	HierarchicalStrategy
+	// WorkloadStrategy noises the queries of the workload themselves, i.e.
+	// answers them independently. It is only possible if
+	// the workload determines the count of each bucket, i.e. if the workload
+	// matrix has full column rank.
+	WorkloadStrategy
+	// EigenStrategy noises the projections of the counts on the eigenvectors
+	// of WᵀW, where W is the workload matrix, each scaled by the fourth root of
+	// its eigenvalue. The noise of the buckets is then correlated, following the
+	// structure of the workload, which is close to optimal with Gaussian noise,
+	// see Li and Miklau's "An Adaptive Mechanism for Accurate Query Answering
+	// under Differential Privacy" (https://arxiv.org/abs/1202.3807). Unlike
+	// the other strategies, it only noises the directions the workload depends
+	// on, so it doesn't require the workload to determine the count of each
+	// bucket.
+	EigenStrategy
+)
+
+func (s QueryStrategy) String() string {
+	switch s {
+	case OptimizedStrategy:
+		return "OptimizedStrategy"
+	case IdentityStrategy:
+		return "IdentityStrategy"
+	case HierarchicalStrategy:
+		return "HierarchicalStrategy"
+	case WorkloadStrategy:
+		return "WorkloadStrategy"
+	case EigenStrategy:
+		return "EigenStrategy"
+	}
+	return fmt.Sprintf("QueryStrategy(%d)", int(s))
+}
+
+// LinearQueries answers a workload of linear queries over a histogram with a
+// fixed number of buckets, e.g. range queries or marginals, using the matrix
+// mechanism of Li et al.'s "Optimizing Linear Counting Queries Under
+// Differential Privacy" (https://arxiv.org/abs/0912.4742).
+//
+// Each query of the workload is a row of weights, one per bucket, and its
+// answer is the weighted sum of the counts of the buckets. Instead of noising
+// each answer, which requires noise proportional to the number of queries a
+// bucket is in, a strategy of queries is noised, and the answers to the
+// workload are reconstructed from the noisy strategy answers by least squares.
+// The reconstructed answers are consistent, and are usually much more accurate
+// than answering the queries independently.
+//
+// The workload is part of the parameters, so it must not depend on the data.
+// Computing the strategy takes time cubic in the number of buckets, so this is
+// meant for histograms of up to a few thousand buckets.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type LinearQueries struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	l0Sensitivity   int64 // Sensitivity passed to Noise for each normalized strategy answer.
+	lInfSensitivity int64
+	strategyKind    QueryStrategy // Strategy used, never OptimizedStrategy.
+	strategy        *mat.Dense
+	// Largest norm of a column of the strategy, by which the strategy answers
+	// are normalized before being noised: the L_1 norm with Laplace noise and
+	// the L_2 norm otherwise.
+	strategyNorm float64
+	// Matrix mapping the noisy strategy answers to the workload answers.
+	reconstruction *mat.Dense
+	Noise          noise.Noise
+
+	// State variables
+	counts []int64
+	state  aggregationState
+}
+
+// LinearQueriesOptions contains the options necessary to initialize a
+// LinearQueries.
+type LinearQueriesOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// Number of buckets of the histogram. Required.
+	Buckets int
+	// Queries answered by Result, each with one weight per bucket. Required.
+	Workload [][]float64
+	// How many distinct buckets may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single bucket? Defaults to 1.
+	MaxContributionsPerPartition int64
+	Strategy                     QueryStrategy // Strategy of noised queries. Defaults to OptimizedStrategy.
+	Noise                        noise.Noise   // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewLinearQueries returns a new LinearQueries, with the count of each bucket
+// initialized at 0.
+func NewLinearQueries(opt *LinearQueriesOptions) (*LinearQueries, error) {
+	if opt == nil {
+		opt = &LinearQueriesOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	// Check the parameters.
+	if opt.Buckets <= 0 {
+		return nil, fmt.Errorf("NewLinearQueries: Buckets is %d, must be strictly positive", opt.Buckets)
+	}
+	if len(opt.Workload) == 0 {
+		return nil, fmt.Errorf("NewLinearQueries: Workload must not be empty")
+	}
+	workload := mat.NewDense(len(opt.Workload), opt.Buckets, nil)
+	for i, q := range opt.Workload {
+		if len(q) != opt.Buckets {
+			return nil, fmt.Errorf("NewLinearQueries: query %d of Workload has %d weights, must have Buckets = %d", i, len(q), opt.Buckets)
+		}
+		for j, w := range q {
+			if math.IsNaN(w) || math.IsInf(w, 0) {
+				return nil, fmt.Errorf("NewLinearQueries: weight %d of query %d of Workload is %f, must be finite", j, i, w)
+			}
+		}
+		workload.SetRow(i, q)
+	}
+	if l0 < 0 {
+		return nil, fmt.Errorf("NewLinearQueries: MaxPartitionsContributed is %d, must be strictly positive", l0)
+	}
+	if lInf < 0 {
+		return nil, fmt.Errorf("NewLinearQueries: MaxContributionsPerPartition is %d, must be strictly positive", lInf)
+	}
+	// A privacy unit changes the strategy answers by at most l0·lInf times the
+	// largest norm of a column. With Laplace noise, this bounds the L_1
+	// sensitivity of the normalized answers by l0·lInf. With Gaussian noise,
+	// Noise derives the L_2 sensitivity √l0·lInf, so l0² is passed instead.
+	l1 := noise.ToKind(n) == noise.LaplaceNoise || noise.ToKind(n) == noise.GeometricNoise
+	noiseL0 := l0
+	if !l1 {
+		if l0 > math.MaxInt64/l0 {
+			return nil, fmt.Errorf("NewLinearQueries: MaxPartitionsContributed = %d is too high", l0)
+		}
+		noiseL0 = l0 * l0
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseFloat64(0, noiseL0, float64(lInf), opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewLinearQueries: %w", err)
+	}
+
+	lq := &LinearQueries{
+		epsilon:         opt.Epsilon,
+		delta:           opt.Delta,
+		l0Sensitivity:   noiseL0,
+		lInfSensitivity: lInf,
+		Noise:           n,
+		counts:          make([]int64, opt.Buckets),
+		state:           defaultState,
+	}
+	candidates := []QueryStrategy{opt.Strategy}
+	switch opt.Strategy {
+	case OptimizedStrategy:
+		candidates = []QueryStrategy{IdentityStrategy, HierarchicalStrategy, WorkloadStrategy, EigenStrategy}
+	case IdentityStrategy, HierarchicalStrategy, WorkloadStrategy, EigenStrategy:
+	default:
+		return nil, fmt.Errorf("NewLinearQueries: unknown Strategy %v", opt.Strategy)
+	}
+	bestError := math.Inf(1)
+	for _, kind := range candidates {
+		var strategy, reconstruction *mat.Dense
+		var err error
+		if kind == EigenStrategy {
+			strategy, reconstruction, err = eigenStrategy(workload)
+		} else {
+			strategy = strategyMatrix(kind, workload)
+			reconstruction, err = reconstructionMatrix(workload, strategy)
+		}
+		if err != nil {
+			if opt.Strategy == OptimizedStrategy {
+				continue
+			}
+			return nil, fmt.Errorf("NewLinearQueries: %v: %w", kind, err)
+		}
+		norm := maxColumnNorm(strategy, l1)
+		// The noise of each strategy answer has a variance proportional to
+		// norm², so the total squared error of the workload answers is
+		// proportional to norm² times the squared Frobenius norm of the
+		// reconstruction.
+		frobenius := mat.Norm(reconstruction, 2)
+		if e := norm * norm * frobenius * frobenius; e < bestError {
+			bestError = e
+			lq.strategyKind, lq.strategy, lq.strategyNorm, lq.reconstruction = kind, strategy, norm, reconstruction
+		}
+	}
+	return lq, nil
+}
+
+// strategyMatrix returns the matrix of the queries of the given strategy,
+// with one row per query and one column per bucket.
+func strategyMatrix(kind QueryStrategy, workload *mat.Dense) *mat.Dense {
+	_, buckets := workload.Dims()
+	switch kind {
+	case HierarchicalStrategy:
+		// Each level of the tree has nodes covering 2^level consecutive buckets,
+		// up to a single node covering all the buckets.
+		var rows [][]float64
+		for width := 1; ; width *= 2 {
+			for start := 0; start < buckets; start += width {
+				row := make([]float64, buckets)
+				for j := start; j < start+width && j < buckets; j++ {
+					row[j] = 1
+				}
+				rows = append(rows, row)
+			}
+			if width >= buckets {
+				break
+			}
+		}
+		strategy := mat.NewDense(len(rows), buckets, nil)
+		for i, row := range rows {
+			strategy.SetRow(i, row)
+		}
+		return strategy
+	case WorkloadStrategy:
+		return mat.DenseCopyOf(workload)
+	default:
+		identity := mat.NewDense(buckets, buckets, nil)
+		for j := 0; j < buckets; j++ {
+			identity.Set(j, j, 1)
+		}
+		return identity
+	}
+}
+
+// reconstructionMatrix returns W·(AᵀA)⁻¹·Aᵀ, which maps the answers to the
+// strategy A to the least squares answers to the workload W.
+func reconstructionMatrix(workload, strategy *mat.Dense) (*mat.Dense, error) {
+	var gram mat.SymDense
+	gram.SymOuterK(1, strategy.T())
+	var chol mat.Cholesky
+	if ok := chol.Factorize(&gram); !ok {
+		return nil, fmt.Errorf("the strategy doesn't determine the count of each bucket")
+	}
+	var pseudoInverse mat.Dense
+	if err := chol.SolveTo(&pseudoInverse, strategy.T()); err != nil {
+		return nil, err
+	}
+	var reconstruction mat.Dense
+	reconstruction.Mul(workload, &pseudoInverse)
+	return &reconstruction, nil
+}
+
+// eigenStrategy returns the strategy matrix of EigenStrategy and the matrix
+// mapping its answers to the answers to the workload W. With WᵀW = QΛQᵀ, the
+// strategy is Λ^¼·Qᵀ restricted to the non-zero eigenvalues, and the
+// reconstruction is W·Q·Λ^-¼. Since the rows of W are in the span of the
+// eigenvectors kept, this gives exact answers without noise.
+func eigenStrategy(workload *mat.Dense) (strategy, reconstruction *mat.Dense, err error) {
+	_, buckets := workload.Dims()
+	var gram mat.SymDense
+	gram.SymOuterK(1, workload.T())
+	var eigen mat.EigenSym
+	if ok := eigen.Factorize(&gram, true); !ok {
+		return nil, nil, fmt.Errorf("couldn't compute the eigendecomposition of the workload")
+	}
+	values := eigen.Values(nil)
+	var vectors mat.Dense
+	eigen.VectorsTo(&vectors)
+	var largest float64
+	for _, v := range values {
+		largest = math.Max(largest, v)
+	}
+	// Eigenvalues below this are rounding errors of eigenvalues that are 0.
+	var kept []int
+	for i, v := range values {
+		if v > 1e-10*largest {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, nil, fmt.Errorf("the workload only has queries with zero weights")
+	}
+	strategy = mat.NewDense(len(kept), buckets, nil)
+	basis := mat.NewDense(buckets, len(kept), nil)
+	for r, i := range kept {
+		scale := math.Pow(values[i], 0.25)
+		for j := 0; j < buckets; j++ {
+			strategy.Set(r, j, scale*vectors.At(j, i))
+			basis.Set(j, r, vectors.At(j, i)/scale)
+		}
+	}
+	reconstruction = &mat.Dense{}
+	reconstruction.Mul(workload, basis)
+	return strategy, reconstruction, nil
+}
+
+// maxColumnNorm returns the largest L_1 norm, if l1 is true, or L_2 norm,
+// otherwise, of a column of m.
+func maxColumnNorm(m *mat.Dense, l1 bool) float64 {
+	_, cols := m.Dims()
+	norm := 2.0
+	if l1 {
+		norm = 1
+	}
+	var largest float64
+	for j := 0; j < cols; j++ {
+		largest = math.Max(largest, mat.Norm(m.ColView(j), norm))
+	}
+	return largest
+}
+
+// Strategy returns the strategy used to answer the workload, which is the
+// strategy chosen when OptimizedStrategy is used.
+func (lq *LinearQueries) Strategy() QueryStrategy {
+	return lq.strategyKind
+}
+
+// Add increments the count of the given bucket by one.
+func (lq *LinearQueries) Add(bucket int) error {
+	return lq.AddBy(bucket, 1)
+}
+
+// AddBy increments the count of the given bucket by the given value. Note that
+// this shouldn't be used to count more than MaxContributionsPerPartition
+// contributions to a single bucket from the same privacy unit.
+func (lq *LinearQueries) AddBy(bucket int, count int64) error {
+	if lq.state != defaultState {
+		return fmt.Errorf("LinearQueries cannot be amended: %w", lq.state.transitionError(defaultState))
+	}
+	if bucket < 0 || bucket >= len(lq.counts) {
+		return fmt.Errorf("LinearQueries: bucket is %d, must be in [0, %d)", bucket, len(lq.counts))
+	}
+	lq.counts[bucket] += count
+	return nil
+}
+
+// Result returns differentially private answers to the queries of the
+// workload, in the order of the workload. The method can be called only once.
+func (lq *LinearQueries) Result() ([]float64, error) {
+	if lq.state != defaultState {
+		return nil, fmt.Errorf("LinearQueries' noised result cannot be computed: %w", lq.state.transitionError(resultReturned))
+	}
+	lq.state = resultReturned
+
+	counts := make([]float64, len(lq.counts))
+	for j, c := range lq.counts {
+		counts[j] = float64(c)
+	}
+	var answers mat.VecDense
+	answers.MulVec(lq.strategy, mat.NewVecDense(len(counts), counts))
+	for i := 0; i < answers.Len(); i++ {
+		noised, err := lq.Noise.AddNoiseFloat64(answers.AtVec(i)/lq.strategyNorm, lq.l0Sensitivity, float64(lq.lInfSensitivity), lq.epsilon, lq.delta)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised answer to strategy query %d: %w", i, err)
+		}
+		answers.SetVec(i, noised*lq.strategyNorm)
+	}
+	var result mat.VecDense
+	result.MulVec(lq.reconstruction, &answers)
+	return result.RawVector().Data, nil
+}
+
+// StandardDeviations returns the standard deviation of the noise of the answer
+// to each query of the workload. Only Laplace, geometric, Gaussian and discrete
+// Gaussian noise are supported. This is only a function of the parameters, so it
+// can be published alongside the answers.
+func (lq *LinearQueries) StandardDeviations() ([]float64, error) {
+	stdDev, err := NoiseStandardDeviation(lq.Noise, lq.l0Sensitivity, float64(lq.lInfSensitivity), lq.epsilon, lq.delta)
+	if err != nil {
+		return nil, err
+	}
+	// The noise of the strategy answers is independent, so the variance of an
+	// answer to the workload is the squared norm of its row of the
+	// reconstruction times the variance of the noise of a strategy answer.
+	queries, _ := lq.reconstruction.Dims()
+	result := make([]float64, queries)
+	for i := range result {
+		result[i] = stdDev * lq.strategyNorm * mat.Norm(lq.reconstruction.RowView(i), 2)
+	}
+	return result, nil
+}
@@ -0,0 +1,225 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// rangeWorkload returns all the range queries over the given number of
+// buckets.
+func rangeWorkload(buckets int) [][]float64 {
+	var workload [][]float64
+	for start := 0; start < buckets; start++ {
+		for end := start + 1; end <= buckets; end++ {
+			q := make([]float64, buckets)
+			for j := start; j < end; j++ {
+				q[j] = 1
+			}
+			workload = append(workload, q)
+		}
+	}
+	return workload
+}
+
+func TestNewLinearQueriesInvalidOptions(t *testing.T) {
+	workload := [][]float64{{1, 1, 0}, {0, 1, 1}}
+	for _, tc := range []struct {
+		desc string
+		opt  *LinearQueriesOptions
+	}{
+		{"nil options", nil},
+		{"no Buckets", &LinearQueriesOptions{Epsilon: ln3, Workload: workload}},
+		{"no Workload", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3}},
+		{"query with too few weights", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: [][]float64{{1, 1}}}},
+		{"infinite weight", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: [][]float64{{1, math.Inf(1), 0}}}},
+		{"no Epsilon", &LinearQueriesOptions{Buckets: 3, Workload: workload}},
+		{"negative MaxPartitionsContributed", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: workload, MaxPartitionsContributed: -1}},
+		{"negative MaxContributionsPerPartition", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: workload, MaxContributionsPerPartition: -1}},
+		{"Delta with Laplace noise", &LinearQueriesOptions{Epsilon: ln3, Delta: 1e-5, Buckets: 3, Workload: workload}},
+		{"no Delta with Gaussian noise", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: workload, Noise: noise.Gaussian()}},
+		{"unknown Strategy", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: workload, Strategy: QueryStrategy(5)}},
+		// The workload doesn't determine the count of each bucket.
+		{"WorkloadStrategy without full rank", &LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: workload, Strategy: WorkloadStrategy}},
+	} {
+		if _, err := NewLinearQueries(tc.opt); err == nil {
+			t.Errorf("NewLinearQueries with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestLinearQueriesResult(t *testing.T) {
+	counts := []int64{3, 0, 5, 2, 7}
+	workload := append(rangeWorkload(5), []float64{1, -1, 0.5, 0, 2})
+	for _, strategy := range []QueryStrategy{OptimizedStrategy, IdentityStrategy, HierarchicalStrategy, WorkloadStrategy, EigenStrategy} {
+		lq, err := NewLinearQueries(&LinearQueriesOptions{
+			Epsilon:  ln3,
+			Buckets:  len(counts),
+			Workload: workload,
+			Strategy: strategy,
+			Noise:    noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize LinearQueries with %v: %v", strategy, err)
+		}
+		for j, c := range counts {
+			if err := lq.AddBy(j, c); err != nil {
+				t.Fatalf("AddBy(%d, %d) with %v: got error %v", j, c, strategy, err)
+			}
+		}
+		got, err := lq.Result()
+		if err != nil {
+			t.Fatalf("Result with %v: got error %v", strategy, err)
+		}
+		if len(got) != len(workload) {
+			t.Fatalf("Result with %v: got %d answers, want %d", strategy, len(got), len(workload))
+		}
+		// Without noise, the answers are exact whatever the strategy.
+		for i, q := range workload {
+			var want float64
+			for j, w := range q {
+				want += w * float64(counts[j])
+			}
+			if math.Abs(got[i]-want) > 1e-9 {
+				t.Errorf("Result with %v: got %f for query %v, want %f", strategy, got[i], q, want)
+			}
+		}
+		if _, err := lq.Result(); err == nil {
+			t.Errorf("Result with %v called twice: got no error, want error", strategy)
+		}
+		if err := lq.Add(0); err == nil {
+			t.Errorf("Add after Result with %v: got no error, want error", strategy)
+		}
+	}
+}
+
+func TestLinearQueriesInvalidBucket(t *testing.T) {
+	lq, err := NewLinearQueries(&LinearQueriesOptions{Epsilon: ln3, Buckets: 3, Workload: rangeWorkload(3)})
+	if err != nil {
+		t.Fatalf("Couldn't initialize LinearQueries: %v", err)
+	}
+	for _, bucket := range []int{-1, 3} {
+		if err := lq.Add(bucket); err == nil {
+			t.Errorf("Add(%d): got no error, want error", bucket)
+		}
+	}
+}
+
+func TestLinearQueriesOptimizedStrategy(t *testing.T) {
+	identity := make([][]float64, 16)
+	for j := range identity {
+		identity[j] = make([]float64, 16)
+		identity[j][j] = 1
+	}
+	for _, tc := range []struct {
+		desc     string
+		workload [][]float64
+		noise    noise.Noise
+		delta    float64
+		want     QueryStrategy
+	}{
+		{"point queries", identity, noise.Gaussian(), 1e-5, IdentityStrategy},
+		{"range queries", rangeWorkload(16), noise.Gaussian(), 1e-5, EigenStrategy},
+		// With Laplace noise, the tree only pays off for more buckets.
+		{"range queries with Laplace noise", rangeWorkload(16), noise.Laplace(), 0, IdentityStrategy},
+	} {
+		lq, err := NewLinearQueries(&LinearQueriesOptions{Epsilon: ln3, Delta: tc.delta, Buckets: 16, Workload: tc.workload, Noise: tc.noise})
+		if err != nil {
+			t.Fatalf("Couldn't initialize LinearQueries for %s: %v", tc.desc, err)
+		}
+		if got := lq.Strategy(); got != tc.want {
+			t.Errorf("Strategy for %s: got %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestLinearQueriesStandardDeviations(t *testing.T) {
+	// With the identity strategy, the answer to a query has the noise of the
+	// buckets it covers.
+	lq, err := NewLinearQueries(&LinearQueriesOptions{
+		Epsilon:                  ln3,
+		Buckets:                  3,
+		Workload:                 [][]float64{{1, 0, 0}, {1, 1, 1}},
+		MaxPartitionsContributed: 2,
+		Strategy:                 IdentityStrategy,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize LinearQueries: %v", err)
+	}
+	got, err := lq.StandardDeviations()
+	if err != nil {
+		t.Fatalf("StandardDeviations: got error %v", err)
+	}
+	bucketStdDev := math.Sqrt2 * 2 / ln3
+	want := []float64{bucketStdDev, math.Sqrt(3) * bucketStdDev}
+	for i := range want {
+		if !ApproxEqual(got[i], want[i]) {
+			t.Errorf("StandardDeviations: got %f for query %d, want %f", got[i], i, want[i])
+		}
+	}
+}
+
+func TestLinearQueriesEigenStrategy(t *testing.T) {
+	// The workload doesn't determine the count of each bucket, since only the
+	// sum of the first two buckets is queried.
+	workload := [][]float64{{1, 1, 0, 0}, {1, 1, 1, 0}, {0, 0, 1, 1}, {1, 1, 1, 1}}
+	counts := []int64{4, 1, 3, 2}
+	lq, err := NewLinearQueries(&LinearQueriesOptions{Epsilon: ln3, Buckets: 4, Workload: workload, Strategy: EigenStrategy, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize LinearQueries with EigenStrategy for a workload without full rank: %v", err)
+	}
+	for j, c := range counts {
+		lq.AddBy(j, c)
+	}
+	got, err := lq.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	for i, want := range []float64{5, 8, 5, 10} {
+		if math.Abs(got[i]-want) > 1e-9 {
+			t.Errorf("Result: got %f for query %v, want %f", got[i], workload[i], want)
+		}
+	}
+}
+
+func TestLinearQueriesEigenStrategyImprovesAccuracy(t *testing.T) {
+	// With Gaussian noise, range queries are more accurate with correlated noise
+	// than with the noise of a binary tree, itself more accurate than answering
+	// each query independently.
+	totalVariance := func(strategy QueryStrategy) float64 {
+		lq, err := NewLinearQueries(&LinearQueriesOptions{Epsilon: ln3, Delta: 1e-5, Buckets: 16, Workload: rangeWorkload(16), Strategy: strategy, Noise: noise.Gaussian()})
+		if err != nil {
+			t.Fatalf("Couldn't initialize LinearQueries with %v: %v", strategy, err)
+		}
+		stdDevs, err := lq.StandardDeviations()
+		if err != nil {
+			t.Fatalf("StandardDeviations with %v: got error %v", strategy, err)
+		}
+		var total float64
+		for _, s := range stdDevs {
+			total += s * s
+		}
+		return total
+	}
+	eigen, hierarchical, workload := totalVariance(EigenStrategy), totalVariance(HierarchicalStrategy), totalVariance(WorkloadStrategy)
+	if eigen >= hierarchical || hierarchical >= workload {
+		t.Errorf("Total variance: got %f with EigenStrategy, %f with HierarchicalStrategy and %f with WorkloadStrategy, want them in increasing order", eigen, hierarchical, workload)
+	}
+}
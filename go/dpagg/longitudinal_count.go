@@ -0,0 +1,290 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// NoiseCorrelation describes how the noise of the successive releases of a
+// LongitudinalCount relate to each other.
+type NoiseCorrelation int
+
+const (
+	// IndependentNoise adds independent noise to each release, calibrated to
+	// the number of steps a privacy unit contributes to. It is the default.
+	IndependentNoise NoiseCorrelation = iota
+	// TreeCorrelatedNoise releases each count as the running sum of the changes
+	// of the count between consecutive steps, noised with the binary tree
+	// mechanism of StreamingCount. The noise of nearby releases shares the
+	// nodes of the tree that cover both of them, and is calibrated to the
+	// number of times the contribution of a privacy unit changes instead of the
+	// number of steps it contributes to.
+	TreeCorrelatedNoise
+)
+
+func (c NoiseCorrelation) String() string {
+	switch c {
+	case IndependentNoise:
+		return "IndependentNoise"
+	case TreeCorrelatedNoise:
+		return "TreeCorrelatedNoise"
+	}
+	return fmt.Sprintf("NoiseCorrelation(%d)", int(c))
+}
+
+// LongitudinalCount calculates differentially private counts of a public set
+// of keys, released repeatedly over time (e.g. every week), such that the
+// whole sequence of releases is (ε,δ)-differentially private.
+//
+// Time is split into at most MaxSteps steps. Values are counted per key in the
+// current step, and Release ends the step and returns a noisy count of each
+// key for that step only.
+//
+// With IndependentNoise, each count gets independent noise, so the change of
+// a count between two releases has the noise of both releases. This is
+// preferable when privacy units contribute to few steps. With
+// TreeCorrelatedNoise, the counts are computed from the changes between
+// consecutive steps, whose sensitivity only depends on how often the
+// contribution of a privacy unit changes: a privacy unit contributing the same
+// value to a key for many consecutive steps, e.g. an active user of a weekly
+// dashboard, only changes the count of that key when it starts and when it
+// stops contributing. This is preferable for longitudinal data, where the same
+// privacy units contribute to most steps.
+//
+// A privacy unit may contribute to at most MaxPartitionsContributed keys, at
+// most MaxContributionsPerStep times per step.
+//
+// Note: Do not use when your results may cause overflows for int64 values.
+// This aggregation is not hardened for such applications yet.
+//
+// Not thread-safe.
+type LongitudinalCount struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	l0Sensitivity   int64 // Number of released counts a privacy unit may contribute to, with IndependentNoise.
+	lInfSensitivity int64
+	maxSteps        int64
+	correlation     NoiseCorrelation
+	Noise           noise.Noise
+
+	// State variables
+	// Number of steps released so far.
+	step int64
+	// Raw counts of the current step.
+	counts map[string]int64
+	// With TreeCorrelatedNoise, raw counts of the previous step and running
+	// sums of the changes between consecutive steps of each key.
+	previous map[string]int64
+	changes  map[string]*StreamingCount
+	state    aggregationState
+}
+
+// LongitudinalCountOptions contains the options necessary to initialize a
+// LongitudinalCount.
+type LongitudinalCountOptions struct {
+	Epsilon  float64 // Privacy parameter ε of the whole sequence of releases. Required.
+	Delta    float64 // Privacy parameter δ of the whole sequence of releases. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxSteps int64   // Maximum number of releases. Required.
+	// Keys counted in each release. They must be public, since all of them are
+	// released whether they have contributions or not. Required.
+	Keys []string
+	// How many distinct keys may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single key in
+	// a single step? Defaults to 1.
+	MaxContributionsPerStep int64
+	// With IndependentNoise, how many distinct steps may a single privacy unit
+	// contribute to for a key? Defaults to 1; must be 0 with
+	// TreeCorrelatedNoise.
+	MaxStepsContributed int64
+	// With TreeCorrelatedNoise, how many times may the contribution of a single
+	// privacy unit to a key change between consecutive steps, including when it
+	// starts and stops contributing? Defaults to 2, i.e. a privacy unit
+	// contributing the same value during a single run of consecutive steps;
+	// must be 0 with IndependentNoise.
+	MaxChangesContributed int64
+	Correlation           NoiseCorrelation // Correlation of the noise of successive releases. Defaults to IndependentNoise.
+	Noise                 noise.Noise      // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewLongitudinalCount returns a new LongitudinalCount, in its first step,
+// with all the counts initialized at 0.
+func NewLongitudinalCount(opt *LongitudinalCountOptions) (*LongitudinalCount, error) {
+	if opt == nil {
+		opt = &LongitudinalCountOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerStep
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	// Check the parameters.
+	if opt.MaxSteps <= 0 {
+		return nil, fmt.Errorf("NewLongitudinalCount: MaxSteps is %d, must be strictly positive", opt.MaxSteps)
+	}
+	if len(opt.Keys) == 0 {
+		return nil, fmt.Errorf("NewLongitudinalCount: Keys must not be empty")
+	}
+	if l0 < 0 {
+		return nil, fmt.Errorf("NewLongitudinalCount: MaxPartitionsContributed is %d, must be strictly positive", l0)
+	}
+	if lInf < 0 {
+		return nil, fmt.Errorf("NewLongitudinalCount: MaxContributionsPerStep is %d, must be strictly positive", lInf)
+	}
+	// Number of released counts, or of changes of the counts, of a key that a
+	// privacy unit may contribute to.
+	var perKey int64
+	switch opt.Correlation {
+	case IndependentNoise:
+		if opt.MaxChangesContributed != 0 {
+			return nil, fmt.Errorf("NewLongitudinalCount: MaxChangesContributed is %d, must be 0 with %v", opt.MaxChangesContributed, opt.Correlation)
+		}
+		perKey = opt.MaxStepsContributed
+		if perKey == 0 {
+			perKey = 1
+		}
+		if perKey < 0 {
+			return nil, fmt.Errorf("NewLongitudinalCount: MaxStepsContributed is %d, must be strictly positive", perKey)
+		}
+	case TreeCorrelatedNoise:
+		if opt.MaxStepsContributed != 0 {
+			return nil, fmt.Errorf("NewLongitudinalCount: MaxStepsContributed is %d, must be 0 with %v", opt.MaxStepsContributed, opt.Correlation)
+		}
+		perKey = opt.MaxChangesContributed
+		if perKey == 0 {
+			perKey = 2
+		}
+		if perKey < 0 {
+			return nil, fmt.Errorf("NewLongitudinalCount: MaxChangesContributed is %d, must be strictly positive", perKey)
+		}
+	default:
+		return nil, fmt.Errorf("NewLongitudinalCount: unknown Correlation %v", opt.Correlation)
+	}
+	if perKey > math.MaxInt64/l0 {
+		return nil, fmt.Errorf("NewLongitudinalCount: MaxPartitionsContributed = %d is too high", l0)
+	}
+	l0 *= perKey
+
+	lc := &LongitudinalCount{
+		epsilon:         opt.Epsilon,
+		delta:           opt.Delta,
+		l0Sensitivity:   l0,
+		lInfSensitivity: lInf,
+		maxSteps:        opt.MaxSteps,
+		correlation:     opt.Correlation,
+		Noise:           n,
+		counts:          make(map[string]int64),
+		state:           defaultState,
+	}
+	for _, k := range opt.Keys {
+		if _, ok := lc.counts[k]; ok {
+			return nil, fmt.Errorf("NewLongitudinalCount: key %q is duplicated", k)
+		}
+		lc.counts[k] = 0
+	}
+	if lc.correlation == IndependentNoise {
+		// Check that the parameters are compatible with the noise chosen by
+		// calling the noise on some placeholder value.
+		if _, err := n.AddNoiseInt64(0, l0, lInf, opt.Epsilon, opt.Delta); err != nil {
+			return nil, fmt.Errorf("NewLongitudinalCount: %w", err)
+		}
+		return lc, nil
+	}
+	// The changes of all keys form a single stream of values, of which a
+	// privacy unit may contribute to l0, each changing by at most lInf, so each
+	// StreamingCount is calibrated as if it held all of them.
+	lc.previous = make(map[string]int64)
+	lc.changes = make(map[string]*StreamingCount)
+	for k := range lc.counts {
+		sc, err := NewStreamingCount(&StreamingCountOptions{
+			Epsilon:                 opt.Epsilon,
+			Delta:                   opt.Delta,
+			MaxSteps:                opt.MaxSteps,
+			MaxStepsContributed:     l0,
+			MaxContributionsPerStep: lInf,
+			Noise:                   n,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("NewLongitudinalCount: %w", err)
+		}
+		lc.changes[k] = sc
+	}
+	return lc, nil
+}
+
+// IncrementBy increments the count of the given key in the current step by
+// the given value. Note that this shouldn't be used to count more than
+// MaxContributionsPerStep contributions to a single key in a single step from
+// the same privacy unit.
+func (lc *LongitudinalCount) IncrementBy(key string, count int64) error {
+	if lc.state != defaultState {
+		return fmt.Errorf("LongitudinalCount cannot be amended: %w", lc.state.transitionError(defaultState))
+	}
+	if _, ok := lc.counts[key]; !ok {
+		return fmt.Errorf("LongitudinalCount: key %q is not one of the public keys", key)
+	}
+	lc.counts[key] += count
+	return nil
+}
+
+// Release ends the current step and returns a differentially private estimate
+// of the count of each key in that step. It can be called at most MaxSteps
+// times; afterwards, the LongitudinalCount can't be used anymore.
+//
+// The returned values are unbiased estimates of the raw counts, and may
+// sometimes be negative.
+func (lc *LongitudinalCount) Release() (map[string]int64, error) {
+	if lc.state != defaultState {
+		return nil, fmt.Errorf("LongitudinalCount's noised result cannot be computed: %w", lc.state.transitionError(resultReturned))
+	}
+	lc.step++
+	if lc.step == lc.maxSteps {
+		lc.state = resultReturned
+	}
+	result := make(map[string]int64, len(lc.counts))
+	for k, count := range lc.counts {
+		lc.counts[k] = 0
+		var err error
+		switch lc.correlation {
+		case IndependentNoise:
+			result[k], err = lc.Noise.AddNoiseInt64(count, lc.l0Sensitivity, lc.lInfSensitivity, lc.epsilon, lc.delta)
+		case TreeCorrelatedNoise:
+			if err = lc.changes[k].IncrementBy(count - lc.previous[k]); err == nil {
+				result[k], err = lc.changes[k].Release()
+			}
+			lc.previous[k] = count
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of key %q: %w", k, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,173 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewLongitudinalCountInvalidOptions(t *testing.T) {
+	keys := []string{"a", "b"}
+	for _, tc := range []struct {
+		desc string
+		opt  *LongitudinalCountOptions
+	}{
+		{"nil options", nil},
+		{"zero MaxSteps", &LongitudinalCountOptions{Epsilon: ln3, Keys: keys}},
+		{"no keys", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10}},
+		{"duplicate keys", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: []string{"a", "a"}}},
+		{"zero epsilon", &LongitudinalCountOptions{MaxSteps: 10, Keys: keys}},
+		{"zero epsilon with TreeCorrelatedNoise", &LongitudinalCountOptions{MaxSteps: 10, Keys: keys, Correlation: TreeCorrelatedNoise}},
+		{"negative MaxPartitionsContributed", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, MaxPartitionsContributed: -1}},
+		{"negative MaxContributionsPerStep", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, MaxContributionsPerStep: -1}},
+		{"negative MaxStepsContributed", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, MaxStepsContributed: -1}},
+		{"MaxChangesContributed with IndependentNoise", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, MaxChangesContributed: 2}},
+		{"MaxStepsContributed with TreeCorrelatedNoise", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, MaxStepsContributed: 2, Correlation: TreeCorrelatedNoise}},
+		{"unknown Correlation", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, Correlation: NoiseCorrelation(2)}},
+		{"non-zero delta with Laplace noise", &LongitudinalCountOptions{Epsilon: ln3, Delta: 1e-5, MaxSteps: 10, Keys: keys}},
+		{"zero delta with Gaussian noise", &LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: keys, Correlation: TreeCorrelatedNoise, Noise: noise.Gaussian()}},
+	} {
+		if _, err := NewLongitudinalCount(tc.opt); err == nil {
+			t.Errorf("NewLongitudinalCount: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestNewLongitudinalCountSensitivity(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		opt    *LongitudinalCountOptions
+		wantL0 int64
+	}{
+		{"defaults", &LongitudinalCountOptions{}, 1},
+		{"IndependentNoise", &LongitudinalCountOptions{MaxPartitionsContributed: 2, MaxStepsContributed: 3}, 6},
+		// Each key is a StreamingCount over 8 steps, i.e. with 4 levels.
+		{"TreeCorrelatedNoise with defaults", &LongitudinalCountOptions{Correlation: TreeCorrelatedNoise}, 2 * 4},
+		{"TreeCorrelatedNoise", &LongitudinalCountOptions{Correlation: TreeCorrelatedNoise, MaxPartitionsContributed: 2, MaxChangesContributed: 3}, 6 * 4},
+	} {
+		tc.opt.Epsilon, tc.opt.MaxSteps, tc.opt.Keys = ln3, 8, []string{"a", "b"}
+		lc, err := NewLongitudinalCount(tc.opt)
+		if err != nil {
+			t.Fatalf("Couldn't initialize longitudinal count with %s: %v", tc.desc, err)
+		}
+		got := lc.l0Sensitivity
+		if lc.correlation == TreeCorrelatedNoise {
+			got = lc.changes["a"].l0Sensitivity
+		}
+		if got != tc.wantL0 {
+			t.Errorf("NewLongitudinalCount with %s: got l0Sensitivity %d, want %d", tc.desc, got, tc.wantL0)
+		}
+	}
+}
+
+func TestLongitudinalCountRelease(t *testing.T) {
+	const maxSteps = 10
+	for _, correlation := range []NoiseCorrelation{IndependentNoise, TreeCorrelatedNoise} {
+		lc, err := NewLongitudinalCount(&LongitudinalCountOptions{
+			Epsilon:     ln3,
+			MaxSteps:    maxSteps,
+			Keys:        []string{"a", "b"},
+			Correlation: correlation,
+			Noise:       noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize longitudinal count with %v: %v", correlation, err)
+		}
+		for step := int64(1); step <= maxSteps; step++ {
+			// Key "a" has a count of 5 at all steps, and key "b" a count of
+			// step at odd steps.
+			if err := lc.IncrementBy("a", 5); err != nil {
+				t.Fatalf("Couldn't increment longitudinal count with %v: %v", correlation, err)
+			}
+			var wantB int64
+			if step%2 == 1 {
+				wantB = step
+				if err := lc.IncrementBy("b", step); err != nil {
+					t.Fatalf("Couldn't increment longitudinal count with %v: %v", correlation, err)
+				}
+			}
+			got, err := lc.Release()
+			if err != nil {
+				t.Fatalf("Couldn't release step %d with %v: %v", step, correlation, err)
+			}
+			if len(got) != 2 || got["a"] != 5 || got["b"] != wantB {
+				t.Errorf("Release with %v: at step %d got %v, want map[a:5 b:%d]", correlation, step, got, wantB)
+			}
+		}
+		if _, err := lc.Release(); err == nil {
+			t.Errorf("Release with %v: after MaxSteps releases got no error, want error", correlation)
+		}
+		if err := lc.IncrementBy("a", 1); err == nil {
+			t.Errorf("IncrementBy with %v: after MaxSteps releases got no error, want error", correlation)
+		}
+	}
+}
+
+func TestLongitudinalCountUnknownKey(t *testing.T) {
+	lc, err := NewLongitudinalCount(&LongitudinalCountOptions{Epsilon: ln3, MaxSteps: 10, Keys: []string{"a"}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize longitudinal count: %v", err)
+	}
+	if err := lc.IncrementBy("b", 1); err == nil {
+		t.Errorf("IncrementBy: with an unknown key got no error, want error")
+	}
+}
+
+func TestLongitudinalCountTreeCorrelatedNoiseOfChanges(t *testing.T) {
+	// With a count that doesn't change, the releases at steps 2 and 3 share the
+	// node covering steps 1 and 2, so their difference only has the noise of
+	// the node of step 3, whereas it has the noise of two releases with
+	// IndependentNoise. Both noises are calibrated to the same l0Sensitivity.
+	const numRuns = 1000
+	for _, tc := range []struct {
+		correlation  NoiseCorrelation
+		opt          LongitudinalCountOptions
+		wantVariance float64
+	}{
+		// With 2 keys, l0Sensitivity is 2 × 1 change × 2 levels = 4 with
+		// TreeCorrelatedNoise, and 2 × 2 steps = 4 with IndependentNoise.
+		{TreeCorrelatedNoise, LongitudinalCountOptions{MaxChangesContributed: 1}, 2 * (4 / ln3) * (4 / ln3)},
+		{IndependentNoise, LongitudinalCountOptions{MaxStepsContributed: 2}, 2 * 2 * (4 / ln3) * (4 / ln3)},
+	} {
+		var sumOfSquares float64
+		for run := 0; run < numRuns; run++ {
+			opt := tc.opt
+			opt.Epsilon, opt.MaxSteps, opt.Keys, opt.MaxPartitionsContributed = ln3, 3, []string{"a"}, 2
+			opt.Correlation = tc.correlation
+			lc, err := NewLongitudinalCount(&opt)
+			if err != nil {
+				t.Fatalf("Couldn't initialize longitudinal count with %v: %v", tc.correlation, err)
+			}
+			var releases []int64
+			for step := 0; step < 3; step++ {
+				lc.IncrementBy("a", 100)
+				got, err := lc.Release()
+				if err != nil {
+					t.Fatalf("Couldn't release step %d with %v: %v", step, tc.correlation, err)
+				}
+				releases = append(releases, got["a"])
+			}
+			diff := float64(releases[2] - releases[1])
+			sumOfSquares += diff * diff
+		}
+		if variance := sumOfSquares / numRuns; variance < 0.7*tc.wantVariance || variance > 1.3*tc.wantVariance {
+			t.Errorf("Release with %v: got variance %f of the change between steps 2 and 3, want about %f", tc.correlation, variance, tc.wantVariance)
+		}
+	}
+}
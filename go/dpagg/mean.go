@@ -21,6 +21,7 @@ import (
 	"math"
 
 	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/metrics"
 	"github.com/google/differential-privacy/go/noise"
 )
 
@@ -39,6 +40,11 @@ import (
 // preserved. Moreover, for small numbers of entries, this approach will return
 // results that are closer to the actual mean in expectation.
 //
+// If MaxWeight is set, BoundedMeanFloat64 computes a weighted mean Σ_i w_i·e_i / Σ_i w_i
+// of entries added with AddWithWeight, e.g. a revenue-weighted average. The noisy
+// count is then replaced by a noisy sum of the weights, which is set to the weight of
+// an entry added with Add if it is smaller, and the sensitivity of the normalized sum is scaled by MaxWeight.
+//
 // BoundedMeanFloat64 supports privacy units that contribute to multiple partitions
 // (via the MaxPartitionsContributed parameter) as well as contribute to the same
 // partition multiple times (via the MaxContributionsPerPartition parameter), by
@@ -50,15 +56,19 @@ import (
 // Note: Do not use when your results may cause overflows for float64 values. This
 // aggregation is not hardened for such applications yet.
 //
-// Not thread-safe.
+// Not thread-safe. To aggregate from multiple goroutines, use ShardedBoundedMeanFloat64.
 type BoundedMeanFloat64 struct {
 	// Parameters
-	lower float64
-	upper float64
+	lower     float64
+	upper     float64
+	clamper   Clamper
+	maxWeight float64 // 0 if the mean is not weighted
 
 	// State variables
 	NormalizedSum BoundedSumFloat64
-	Count         Count
+	Count         Count // only used if the mean is not weighted
+	// Sum of the weights of the entries, only used if the mean is weighted.
+	weightSum *BoundedSumFloat64
 	// The midpoint between lower and upper bounds. It cannot be set by the user;
 	// it will be calculated based on the lower and upper values.
 	midPoint float64
@@ -66,12 +76,32 @@ type BoundedMeanFloat64 struct {
 }
 
 func bmEquallyInitializedFloat64(bm1, bm2 *BoundedMeanFloat64) bool {
-	return bm1.lower == bm2.lower &&
-		bm1.upper == bm2.upper &&
-		bm1.midPoint == bm2.midPoint &&
-		bm1.state == bm2.state &&
-		countEquallyInitialized(&bm1.Count, &bm2.Count) &&
-		bsEquallyInitializedFloat64(&bm1.NormalizedSum, &bm2.NormalizedSum)
+	return bmIncompatibleFieldFloat64(bm1, bm2) == ""
+}
+
+// bmIncompatibleFieldFloat64 returns the name of the first option with which
+// bm1 and bm2 were initialized differently, or "" if they were initialized
+// equally.
+func bmIncompatibleFieldFloat64(bm1, bm2 *BoundedMeanFloat64) string {
+	switch {
+	case bm1.lower != bm2.lower:
+		return "Lower"
+	case bm1.upper != bm2.upper:
+		return "Upper"
+	case bm1.maxWeight != bm2.maxWeight || bm1.weighted() != bm2.weighted():
+		return "MaxWeight"
+	case bm1.state != bm2.state:
+		return "state"
+	}
+	if bm1.weighted() {
+		if field := bsIncompatibleField(bm1.weightSum, bm2.weightSum); field != "" {
+			return field
+		}
+	}
+	if field := countIncompatibleField(&bm1.Count, &bm2.Count); field != "" {
+		return field
+	}
+	return bsIncompatibleField(&bm1.NormalizedSum, &bm2.NormalizedSum)
 }
 
 // BoundedMeanFloat64Options contains the options necessary to initialize a BoundedMeanFloat64.
@@ -82,7 +112,20 @@ type BoundedMeanFloat64Options struct {
 	MaxContributionsPerPartition int64   // How many times may a single user contribute to a single partition? Required.
 	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower < Upper.
 	Lower, Upper float64
-	Noise        noise.Noise // Type of noise used in BoundedMean. Defaults to Laplace noise.
+	Noise        noise.Noise // Type of noise used in BoundedMean. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+	// Transform used to bound contributions to [Lower, Upper]. Defaults to hard
+	// clamping; see Clamper.
+	Clamper Clamper
+	// Maximum weight of a single entry, see AddWithWeight. Weights are clamped
+	// to [0, MaxWeight]. Defaults to 0, in which case the mean is not weighted
+	// and AddWithWeight can't be used.
+	MaxWeight float64
+	// What is protected by differential privacy, see PrivacyLevel. Defaults to
+	// UserLevel.
+	PrivacyLevel PrivacyLevel
 }
 
 // NewBoundedMeanFloat64 returns a new BoundedMeanFloat64.
@@ -91,32 +134,29 @@ func NewBoundedMeanFloat64(opt *BoundedMeanFloat64Options) (*BoundedMeanFloat64,
 		opt = &BoundedMeanFloat64Options{}
 	}
 
-	maxContributionsPerPartition := opt.MaxContributionsPerPartition
-	var err error
+	maxPartitionsContributed, maxContributionsPerPartition, err := opt.PrivacyLevel.contributionBounds(opt.MaxPartitionsContributed, opt.MaxContributionsPerPartition)
+	if err != nil {
+		return nil, fmt.Errorf("NewBoundedMeanFloat64: %w", err)
+	}
 	if err = checks.CheckMaxContributionsPerPartition(maxContributionsPerPartition); err != nil {
 		return nil, fmt.Errorf("NewBoundedMeanFloat64: %w", err)
 	}
 
 	// Set defaults.
-	maxPartitionsContributed := opt.MaxPartitionsContributed
 	if maxPartitionsContributed == 0 {
 		maxPartitionsContributed = 1
 	}
 
-	n := opt.Noise
-	if n == nil {
-		n = noise.Laplace()
-	}
+	n := noiseOrDefault(opt.Noise, opt.Rho)
 	// Check bounds & use them to compute L_∞ sensitivity.
 	lower, upper := opt.Lower, opt.Upper
-	if lower == 0 && upper == 0 {
-		return nil, fmt.Errorf("NewBoundedMeanFloat64 requires a non-default value for Lower and Upper (automatic bounds determination is not implemented yet). Lower and Upper cannot be both 0")
+	if err := checks.CheckBoundsNotDefault(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewBoundedMeanFloat64: %w", err)
 	}
-	switch noise.ToKind(opt.Noise) {
-	case noise.Unrecognised:
-		err = checks.CheckBoundsFloat64IgnoreOverflows(lower, upper)
-	default:
+	if noise.IsBuiltin(noise.ToKind(opt.Noise)) {
 		err = checks.CheckBoundsFloat64(lower, upper)
+	} else {
+		err = checks.CheckBoundsFloat64IgnoreOverflows(lower, upper)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("NewBoundedMeanFloat64: %w", err)
@@ -132,12 +172,22 @@ func NewBoundedMeanFloat64(opt *BoundedMeanFloat64Options) (*BoundedMeanFloat64,
 		midPoint = lower + (upper-lower)/2.0
 	}
 	maxDistFromMidpoint := upper - midPoint
+	if opt.MaxWeight < 0 || math.IsNaN(opt.MaxWeight) || math.IsInf(opt.MaxWeight, 0) {
+		return nil, fmt.Errorf("NewBoundedMeanFloat64: MaxWeight is %f, must be non-negative and finite", opt.MaxWeight)
+	}
+	weighted := opt.MaxWeight > 0
+	if weighted {
+		// Each entry contributes its weighted distance from the midpoint to the
+		// normalized sum.
+		maxDistFromMidpoint *= opt.MaxWeight
+	}
 
 	eps, del := opt.Epsilon, opt.Delta
 	// We split the budget in half to calculate the count and the normalized sum
 	// TODO: this can be optimized for the Gaussian noise
 	halfEpsilon := eps / 2
 	halfDelta := del / 2
+	halfRho := opt.Rho / 2
 
 	// Check that the parameters are compatible with the noise chosen by calling
 	// the noise on some placeholder value.
@@ -156,20 +206,43 @@ func NewBoundedMeanFloat64(opt *BoundedMeanFloat64Options) (*BoundedMeanFloat64,
 	//   (Σ_i e_i) / c
 	//
 	// the rest follows from the code.
-	count, err := NewCount(&CountOptions{
-		Epsilon:                      halfEpsilon,
-		Delta:                        halfDelta,
-		MaxPartitionsContributed:     maxPartitionsContributed,
-		Noise:                        n,
-		maxContributionsPerPartition: maxContributionsPerPartition,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("couldn't initialize count for NewBoundedMeanFloat64Fn: %w", err)
+	//
+	// For a weighted mean, the count is replaced by weightSum, a differentially private sum of the
+	// weights w_i, and the normalized sum is Σ_i w_i·(e_i - m).
+	count := &Count{}
+	var weightSum *BoundedSumFloat64
+	if weighted {
+		weightSum, err = NewBoundedSumFloat64(&BoundedSumFloat64Options{
+			Epsilon:                      halfEpsilon,
+			Delta:                        halfDelta,
+			Rho:                          halfRho,
+			MaxPartitionsContributed:     maxPartitionsContributed,
+			Lower:                        0,
+			Upper:                        opt.MaxWeight,
+			Noise:                        n,
+			maxContributionsPerPartition: maxContributionsPerPartition,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize weight sum for NewBoundedMeanFloat64Fn: %w", err)
+		}
+	} else {
+		count, err = NewCount(&CountOptions{
+			Epsilon:                      halfEpsilon,
+			Delta:                        halfDelta,
+			Rho:                          halfRho,
+			MaxPartitionsContributed:     maxPartitionsContributed,
+			Noise:                        n,
+			maxContributionsPerPartition: maxContributionsPerPartition,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize count for NewBoundedMeanFloat64Fn: %w", err)
+		}
 	}
 
 	normalizedSum, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
 		Epsilon:                      halfEpsilon,
 		Delta:                        halfDelta,
+		Rho:                          halfRho,
 		MaxPartitionsContributed:     maxPartitionsContributed,
 		Lower:                        -maxDistFromMidpoint,
 		Upper:                        maxDistFromMidpoint,
@@ -180,26 +253,46 @@ func NewBoundedMeanFloat64(opt *BoundedMeanFloat64Options) (*BoundedMeanFloat64,
 		return nil, fmt.Errorf("couldn't initialize normalized sum for NewBoundedMeanFloat64Fn: %w", err)
 	}
 
+	metrics.Default().AggregationCreated("BoundedMeanFloat64")
 	return &BoundedMeanFloat64{
 		lower:         lower,
 		upper:         upper,
+		clamper:       opt.Clamper,
+		maxWeight:     opt.MaxWeight,
 		midPoint:      midPoint,
 		Count:         *count,
 		NormalizedSum: *normalizedSum,
+		weightSum:     weightSum,
 		state:         defaultState,
 	}, nil
 }
 
+// weighted returns whether bm computes a weighted mean.
+func (bm *BoundedMeanFloat64) weighted() bool {
+	return bm.weightSum != nil
+}
+
+// defaultWeight returns the weight of the entries of a weighted mean added
+// with Add, i.e. 1 clamped to [0, MaxWeight].
+func (bm *BoundedMeanFloat64) defaultWeight() float64 {
+	return math.Min(1, bm.maxWeight)
+}
+
 // Add an entry to a BoundedMeanFloat64. It skips NaN entries and doesn't count them in the final result
 // because introducing even a single NaN entry will result in a NaN mean
 // regardless of other entries, which would break the indistinguishability
 // property required for differential privacy.
+//
+// If the mean is weighted, Add(e) is equivalent to AddWithWeight(e, 1).
 func (bm *BoundedMeanFloat64) Add(e float64) error {
+	if bm.weighted() {
+		return bm.AddWithWeight(e, 1)
+	}
 	if bm.state != defaultState {
-		return fmt.Errorf("BoundedMeanFloat64 cannot be amended: %v", bm.state.errorMessage())
+		return fmt.Errorf("BoundedMeanFloat64 cannot be amended: %w", bm.state.transitionError(defaultState))
 	}
 	if !math.IsNaN(e) {
-		clamped, err := ClampFloat64(e, bm.lower, bm.upper)
+		clamped, err := clampWith(bm.clamper, e, bm.lower, bm.upper)
 		if err != nil {
 			return fmt.Errorf("couldn't clamp input value %v: %w", e, err)
 		}
@@ -211,20 +304,84 @@ func (bm *BoundedMeanFloat64) Add(e float64) error {
 	return nil
 }
 
+// AddWithWeight adds an entry with weight w to a weighted BoundedMeanFloat64,
+// i.e. one initialized with a MaxWeight. The weight is clamped to
+// [0, MaxWeight]. Like Add, it skips NaN entries; it returns an error if w is
+// NaN.
+func (bm *BoundedMeanFloat64) AddWithWeight(e, w float64) error {
+	if bm.state != defaultState {
+		return fmt.Errorf("BoundedMeanFloat64 cannot be amended: %w", bm.state.transitionError(defaultState))
+	}
+	if !bm.weighted() {
+		return fmt.Errorf("BoundedMeanFloat64: AddWithWeight requires a weighted mean, initialized with a MaxWeight")
+	}
+	if math.IsNaN(w) {
+		return fmt.Errorf("couldn't add input value %v, weight is NaN", e)
+	}
+	if math.IsNaN(e) {
+		return nil
+	}
+	clamped, err := clampWith(bm.clamper, e, bm.lower, bm.upper)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v: %w", e, err)
+	}
+	clampedWeight, err := ClampFloat64(w, 0, bm.maxWeight)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp weight %v: %w", w, err)
+	}
+	bm.NormalizedSum.Add(clampedWeight * (clamped - bm.midPoint))
+	bm.weightSum.Add(clampedWeight)
+	return nil
+}
+
+// AddSlice adds all elements of s as entries to the BoundedMeanFloat64,
+// skipping NaN elements like Add. It is equivalent to calling Add on each
+// element, up to floating point rounding, but faster. If clamping an element
+// fails, no element is added.
+func (bm *BoundedMeanFloat64) AddSlice(s []float64) error {
+	if bm.state != defaultState {
+		return fmt.Errorf("BoundedMeanFloat64 cannot be amended: %w", bm.state.transitionError(defaultState))
+	}
+	normalizedSum, count, err := clampedSum(bm.clamper, s, bm.lower, bm.upper, bm.midPoint)
+	if err != nil {
+		return err
+	}
+	// The normalized entries are within the bounds of NormalizedSum, so their sum
+	// can be added directly.
+	if bm.weighted() {
+		w := bm.defaultWeight()
+		bm.NormalizedSum.sum.Float += w * normalizedSum
+		bm.weightSum.sum.Float += w * float64(count)
+		return nil
+	}
+	bm.NormalizedSum.sum.Float += normalizedSum
+	bm.Count.count += count
+	return nil
+}
+
 // Result returns a differentially private estimate of the average of bounded
 // elements added so far. The method can be called only once.
 //
 // Note that the returned value is not an unbiased estimate of the raw bounded mean.
 func (bm *BoundedMeanFloat64) Result() (float64, error) {
 	if bm.state != defaultState {
-		return 0, fmt.Errorf("BoundedMeanFloat64's noised result cannot be computed: " + bm.state.errorMessage())
+		return 0, fmt.Errorf("BoundedMeanFloat64's noised result cannot be computed: %w", bm.state.transitionError(resultReturned))
 	}
 	bm.state = resultReturned
-	noisedCount, err := bm.Count.Result()
-	if err != nil {
-		return 0, fmt.Errorf("couldn't compute dp count: %w", err)
+	var noisedCountClamped float64
+	if bm.weighted() {
+		noisedWeightSum, err := bm.weightSum.Result()
+		if err != nil {
+			return 0, fmt.Errorf("couldn't compute dp weight sum: %w", err)
+		}
+		noisedCountClamped = math.Max(bm.defaultWeight(), noisedWeightSum)
+	} else {
+		noisedCount, err := bm.Count.Result()
+		if err != nil {
+			return 0, fmt.Errorf("couldn't compute dp count: %w", err)
+		}
+		noisedCountClamped = math.Max(1.0, float64(noisedCount))
 	}
-	noisedCountClamped := math.Max(1.0, float64(noisedCount))
 	noisedSum, err := bm.NormalizedSum.Result()
 	if err != nil {
 		return 0, fmt.Errorf("couldn't compute dp sum: %w", err)
@@ -278,15 +435,22 @@ func (bm *BoundedMeanFloat64) computeConfidenceIntervalForExplicitAlphaNum(alpha
 	if err != nil {
 		return noise.ConfidenceInterval{}, err
 	}
-	confIntDen, err := bm.Count.ComputeConfidenceInterval(alphaDen)
+	var confIntDen noise.ConfidenceInterval
+	minDen := 1.0
+	if bm.weighted() {
+		confIntDen, err = bm.weightSum.ComputeConfidenceInterval(alphaDen)
+		minDen = bm.defaultWeight()
+	} else {
+		confIntDen, err = bm.Count.ComputeConfidenceInterval(alphaDen)
+	}
 	if err != nil {
 		return noise.ConfidenceInterval{}, err
 	}
 
 	// Ensuring that the lower and upper bounds of the denominator are consistent
 	// with how Result() processes the denominator.
-	confIntDen.LowerBound = math.Max(confIntDen.LowerBound, 1)
-	confIntDen.UpperBound = math.Max(confIntDen.UpperBound, 1)
+	confIntDen.LowerBound = math.Max(confIntDen.LowerBound, minDen)
+	confIntDen.UpperBound = math.Max(confIntDen.UpperBound, minDen)
 
 	var meanLowerBound, meanUpperBound float64
 	if confIntNum.LowerBound >= 0 {
@@ -312,6 +476,60 @@ func (bm *BoundedMeanFloat64) computeConfidenceIntervalForExplicitAlphaNum(alpha
 	return noise.ConfidenceInterval{LowerBound: meanLowerBound, UpperBound: meanUpperBound}, nil
 }
 
+// ConfidenceWidth predicts the width of the confidence interval at level
+// 1 - alpha returned by ComputeConfidenceInterval, assuming that the mean has
+// expectedCount entries, or a total weight of expectedCount for a weighted
+// mean, and that the true mean is the midpoint of the bounds; the width grows
+// when the mean gets closer to the bounds. It only depends on the parameters
+// of the mean, so it can be called at any time, e.g. before adding any entry
+// to tune the privacy parameters and the bounds, and no privacy budget is
+// consumed by this operation.
+func (bm *BoundedMeanFloat64) ConfidenceWidth(alpha, expectedCount float64) (float64, error) {
+	if !(expectedCount >= 0) || math.IsInf(expectedCount, 0) {
+		return 0, fmt.Errorf("ConfidenceWidth: expectedCount is %f, must be non-negative and finite", expectedCount)
+	}
+	minDen := 1.0
+	if bm.weighted() {
+		minDen = bm.defaultWeight()
+	}
+	// Same brute force search for alphaNum as ComputeConfidenceInterval.
+	width := bm.upper - bm.lower
+	for i := 1; i < 1000; i++ {
+		alphaNum := (float64(i) / 1000.0) * alpha
+		alphaDen := (alpha - alphaNum) / (1 - alphaNum)
+		errNum, err := bm.NormalizedSum.ExpectedError(alphaNum)
+		if err != nil {
+			return 0, err
+		}
+		var errDen float64
+		if bm.weighted() {
+			errDen, err = bm.weightSum.ExpectedError(alphaDen)
+		} else {
+			errDen, err = bm.Count.ExpectedError(alphaDen)
+		}
+		if err != nil {
+			return 0, err
+		}
+		// With a numerator interval centered on 0, both bounds of the mean are
+		// divided by the lower bound of the denominator.
+		den := math.Max(expectedCount-errDen, minDen)
+		width = math.Min(width, 2*errNum/den)
+	}
+	return width, nil
+}
+
+// Reset returns bm to the state it had when it was initialized, discarding all
+// entries and any result. Like Count.Reset, it starts a new expenditure of the
+// privacy budget of bm.
+func (bm *BoundedMeanFloat64) Reset() {
+	bm.NormalizedSum.Reset()
+	bm.Count.Reset()
+	if bm.weightSum != nil {
+		bm.weightSum.Reset()
+	}
+	bm.state = defaultState
+}
+
 // Merge merges bm2 into bm (i.e., adds to bm all entries that were added to
 // bm2). bm2 is consumed by this operation: bm2 may not be used after it is
 // merged into bm.
@@ -320,21 +538,25 @@ func (bm *BoundedMeanFloat64) Merge(bm2 *BoundedMeanFloat64) error {
 		return err
 	}
 	bm.NormalizedSum.Merge(&bm2.NormalizedSum)
-	bm.Count.Merge(&bm2.Count)
+	if bm.weighted() {
+		bm.weightSum.Merge(bm2.weightSum)
+	} else {
+		bm.Count.Merge(&bm2.Count)
+	}
 	bm2.state = merged
 	return nil
 }
 
 func checkMergeBoundedMeanFloat64(bm1, bm2 *BoundedMeanFloat64) error {
 	if bm1.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedMeanFloat64: bm1 cannot be merged with another BoundedMean instance: %v", bm1.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedMeanFloat64: bm1 cannot be merged with another BoundedMean instance: %w", bm1.state.transitionError(merged))
 	}
 	if bm2.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedMeanFloat64: bm2 cannot be merged with another BoundedMean instance: %v", bm2.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedMeanFloat64: bm2 cannot be merged with another BoundedMean instance: %w", bm2.state.transitionError(merged))
 	}
 
-	if !bmEquallyInitializedFloat64(bm1, bm2) {
-		return fmt.Errorf("checkMergeBoundedMeanFloat64: bm1 and bm2 are not compatible")
+	if field := bmIncompatibleFieldFloat64(bm1, bm2); field != "" {
+		return fmt.Errorf("checkMergeBoundedMeanFloat64: bm1 and bm2 are not compatible: %w", &IncompatibleMergeError{Field: field})
 	}
 
 	return nil
@@ -343,14 +565,19 @@ func checkMergeBoundedMeanFloat64(bm1, bm2 *BoundedMeanFloat64) error {
 // GobEncode encodes Count.
 func (bm *BoundedMeanFloat64) GobEncode() ([]byte, error) {
 	if bm.state != defaultState && bm.state != serialized {
-		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: " + bm.state.errorMessage())
+		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: %w", bm.state.transitionError(serialized))
 	}
 	enc := encodableBoundedMeanFloat64{
 		Lower:                  bm.lower,
 		Upper:                  bm.upper,
-		EncodableCount:         &bm.Count,
 		EncodableNormalizedSum: &bm.NormalizedSum,
 		MidPoint:               bm.midPoint,
+		MaxWeight:              bm.maxWeight,
+	}
+	if bm.weighted() {
+		enc.EncodableWeightSum = bm.weightSum
+	} else {
+		enc.EncodableCount = &bm.Count
 	}
 	bm.state = serialized
 	return encode(enc)
@@ -366,11 +593,135 @@ func (bm *BoundedMeanFloat64) GobDecode(data []byte) error {
 	*bm = BoundedMeanFloat64{
 		lower:         enc.Lower,
 		upper:         enc.Upper,
-		Count:         *enc.EncodableCount,
+		maxWeight:     enc.MaxWeight,
 		NormalizedSum: *enc.EncodableNormalizedSum,
+		weightSum:     enc.EncodableWeightSum,
 		midPoint:      enc.MidPoint,
 		state:         defaultState,
 	}
+	if enc.EncodableCount != nil {
+		bm.Count = *enc.EncodableCount
+	}
+	return nil
+}
+
+type jsonBoundedMeanParameters struct {
+	Lower     float64 `json:"lower"`
+	Upper     float64 `json:"upper"`
+	MidPoint  float64 `json:"midpoint"`
+	MaxWeight float64 `json:"max_weight,omitempty"`
+}
+
+type jsonBoundedMeanState struct {
+	Count         *Count             `json:"count,omitempty"` // nil if the mean is weighted
+	NormalizedSum *BoundedSumFloat64 `json:"normalized_sum"`
+	WeightSum     *BoundedSumFloat64 `json:"weight_sum,omitempty"` // nil if the mean is not weighted
+}
+
+// MarshalJSON returns the JSON summary of bm, see json_summary.go, whose state
+// contains the JSON summaries of its count (or sum of weights) and normalized
+// sum. Like GobEncode, it consumes bm: it may not be amended, merged or
+// queried afterwards.
+func (bm *BoundedMeanFloat64) MarshalJSON() ([]byte, error) {
+	if bm.state != defaultState && bm.state != serialized {
+		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: %w", bm.state.transitionError(serialized))
+	}
+	params := jsonBoundedMeanParameters{
+		Lower:     bm.lower,
+		Upper:     bm.upper,
+		MidPoint:  bm.midPoint,
+		MaxWeight: bm.maxWeight,
+	}
+	state := jsonBoundedMeanState{NormalizedSum: &bm.NormalizedSum}
+	if bm.weighted() {
+		state.WeightSum = bm.weightSum
+	} else {
+		state.Count = &bm.Count
+	}
+	bm.state = serialized
+	return marshalJSONSummary("BoundedMeanFloat64", params, state)
+}
+
+// UnmarshalJSON loads the JSON summary of a BoundedMeanFloat64 into bm.
+func (bm *BoundedMeanFloat64) UnmarshalJSON(data []byte) error {
+	var params jsonBoundedMeanParameters
+	var state jsonBoundedMeanState
+	if err := unmarshalJSONSummary(data, "BoundedMeanFloat64", &params, &state); err != nil {
+		return fmt.Errorf("couldn't decode BoundedMeanFloat64 from JSON: %w", err)
+	}
+	if state.NormalizedSum == nil || (state.Count == nil) == (state.WeightSum == nil) {
+		return fmt.Errorf("couldn't decode BoundedMeanFloat64 from JSON: state must contain a normalized sum, and either a count or a weight sum")
+	}
+	*bm = BoundedMeanFloat64{
+		lower:         params.Lower,
+		upper:         params.Upper,
+		maxWeight:     params.MaxWeight,
+		NormalizedSum: *state.NormalizedSum,
+		weightSum:     state.WeightSum,
+		midPoint:      params.MidPoint,
+		state:         defaultState,
+	}
+	if state.Count != nil {
+		bm.Count = *state.Count
+	}
+	return nil
+}
+
+// Serialize returns the partial aggregate of bm as a serialized
+// BoundedMeanSummary protobuf message (see proto/summary.proto), in the format
+// used by the Java library: the normalized sum and the count are stored in the
+// sum_summary and count_summary fields. The summary can be loaded into a
+// BoundedMeanFloat64 with Deserialize. Weighted means can't be serialized in
+// this format, use GobEncode instead.
+//
+// Like GobEncode, Serialize consumes bm: it may not be amended, merged or
+// queried afterwards.
+func (bm *BoundedMeanFloat64) Serialize() ([]byte, error) {
+	if bm.state != defaultState && bm.state != serialized {
+		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: %w", bm.state.transitionError(serialized))
+	}
+	if bm.weighted() {
+		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: BoundedMeanSummary doesn't support weighted means")
+	}
+	sum, err := bm.NormalizedSum.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: %w", err)
+	}
+	count, err := bm.Count.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedMeanFloat64 object cannot be serialized: %w", err)
+	}
+	bm.state = serialized
+	var b []byte
+	b = appendMessageField(b, boundedMeanSummarySumSummaryField, sum)
+	b = appendMessageField(b, boundedMeanSummaryCountSummaryField, count)
+	return b, nil
+}
+
+// Deserialize merges a serialized BoundedMeanSummary protobuf message into bm,
+// adding its partial sum and count to the ones accumulated so far, like Merge.
+// The summary may have been produced by Serialize or by the Java library.
+//
+// bm must have been initialized with the same parameters as the aggregation
+// that produced the summary, and may not have been merged, serialized or
+// queried.
+func (bm *BoundedMeanFloat64) Deserialize(data []byte) error {
+	if bm.state != defaultState {
+		return fmt.Errorf("BoundedMeanFloat64 object cannot be deserialized: %w", bm.state.transitionError(defaultState))
+	}
+	if bm.weighted() {
+		return fmt.Errorf("BoundedMeanFloat64 object cannot be deserialized: BoundedMeanSummary doesn't support weighted means")
+	}
+	fields, err := consumeSubmessages(data, boundedMeanSummarySumSummaryField, boundedMeanSummaryCountSummaryField)
+	if err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedMeanFloat64: %w", err)
+	}
+	if err := bm.NormalizedSum.Deserialize(fields[boundedMeanSummarySumSummaryField]); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedMeanFloat64: %w", err)
+	}
+	if err := bm.Count.Deserialize(fields[boundedMeanSummaryCountSummaryField]); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedMeanFloat64: %w", err)
+	}
 	return nil
 }
 
@@ -378,7 +729,9 @@ func (bm *BoundedMeanFloat64) GobDecode(data []byte) error {
 type encodableBoundedMeanFloat64 struct {
 	Lower                  float64
 	Upper                  float64
-	EncodableCount         *Count
+	EncodableCount         *Count // nil if the mean is weighted
 	EncodableNormalizedSum *BoundedSumFloat64
 	MidPoint               float64
+	MaxWeight              float64
+	EncodableWeightSum     *BoundedSumFloat64 // nil if the mean is not weighted
 }
@@ -17,6 +17,7 @@
 package dpagg
 
 import (
+	"math"
 	"testing"
 
 	"github.com/google/differential-privacy/go/noise"
@@ -300,3 +301,39 @@ func TestMeanComputeConfidenceInterval_StateChecks(t *testing.T) {
 		}
 	}
 }
+
+// Tests that BoundedMeanFloat64.ConfidenceWidth() predicts the width of the confidence interval
+// of a mean at the midpoint of the bounds.
+func TestMeanConfidenceWidth(t *testing.T) {
+	expectedCount := 10000
+	for _, tc := range []struct {
+		n noise.Noise
+	}{
+		{noise.Gaussian()},
+		{noise.Laplace()},
+	} {
+		bm := getBoundedMeanFloat64(t, tc.n, arbitraryLower, arbitraryUpper)
+		predicted, err := bm.ConfidenceWidth(arbitraryAlpha, float64(expectedCount))
+		if err != nil {
+			t.Fatalf("With %v, ConfidenceWidth: got error %v", tc.n, err)
+		}
+		for i := 0; i < expectedCount; i++ {
+			bm.Add(0) // The midpoint of the bounds.
+		}
+		if _, err := bm.Result(); err != nil {
+			t.Fatalf("With %v, couldn't compute dp result: %v", tc.n, err)
+		}
+		confInt, err := bm.ComputeConfidenceInterval(arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, couldn't compute confidence interval: %v", tc.n, err)
+		}
+		// The noisy count is very close to the expected count, and the noisy
+		// numerator only slightly changes the width.
+		if width := confInt.UpperBound - confInt.LowerBound; math.Abs(width-predicted) > 0.05*predicted {
+			t.Errorf("With %v, ConfidenceWidth: got %f, want close to the width %f of the confidence interval", tc.n, predicted, width)
+		}
+		if _, err := bm.ConfidenceWidth(arbitraryAlpha, -1); err == nil {
+			t.Errorf("With %v, ConfidenceWidth with a negative expectedCount: got no error, want error", tc.n)
+		}
+	}
+}
@@ -65,7 +65,6 @@ func TestNewBoundedMeanFloat64(t *testing.T) {
 					upper:           3,
 					Noise:           noNoise{},
 					noiseKind:       noise.Unrecognised,
-					sum:             0,
 					state:           defaultState,
 				},
 			}},
@@ -102,7 +101,6 @@ func TestNewBoundedMeanFloat64(t *testing.T) {
 					upper:           3,
 					noiseKind:       noise.LaplaceNoise,
 					Noise:           noise.Laplace(),
-					sum:             0,
 					state:           defaultState,
 				},
 			}},
@@ -161,6 +159,109 @@ func TestBMAddFloat64IgnoresNaN(t *testing.T) {
 	}
 }
 
+func TestBMAddSliceFloat64(t *testing.T) {
+	bmf := getNoiselessBMF(t)
+	if err := bmf.AddSlice([]float64{1.5, 2.5, math.NaN(), 3.5, 10}); err != nil {
+		t.Fatalf("AddSlice: got error %v", err)
+	}
+	got, err := bmf.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// 10 is clamped to 5 and NaN is skipped.
+	want := (1.5 + 2.5 + 3.5 + 5) / 4
+	if !ApproxEqual(got, want) {
+		t.Errorf("AddSlice: got %f, want %f", got, want)
+	}
+	if err := bmf.AddSlice([]float64{1}); err == nil {
+		t.Errorf("AddSlice: got no error after Result, want error")
+	}
+}
+
+func getNoiselessWeightedBMF(t *testing.T) *BoundedMeanFloat64 {
+	t.Helper()
+	bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{
+		Epsilon:                      ln3,
+		Delta:                        tenten,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        -1,
+		Upper:                        5,
+		MaxWeight:                    10,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't get noiseless weighted BMF: %v", err)
+	}
+	return bm
+}
+
+func TestBMAddWithWeightFloat64(t *testing.T) {
+	bmf := getNoiselessWeightedBMF(t)
+	for _, c := range []struct{ e, w float64 }{
+		{1, 2},
+		{4, 6},
+		{3, 20},         // the weight is clamped to 10
+		{2, -1},         // the weight is clamped to 0
+		{math.NaN(), 5}, // NaN entries are skipped
+	} {
+		if err := bmf.AddWithWeight(c.e, c.w); err != nil {
+			t.Fatalf("AddWithWeight(%f, %f): got error %v", c.e, c.w, err)
+		}
+	}
+	if err := bmf.AddWithWeight(1, math.NaN()); err == nil {
+		t.Errorf("AddWithWeight: got no error with a NaN weight, want error")
+	}
+	if err := bmf.Add(10); err != nil { // weight 1, clamped to 5
+		t.Fatalf("Add: got error %v", err)
+	}
+	got, err := bmf.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	want := (1*2 + 4*6 + 3*10 + 5*1) / (2 + 6 + 10 + 1.0)
+	if !ApproxEqual(got, want) {
+		t.Errorf("AddWithWeight: got %f, want %f", got, want)
+	}
+}
+
+func TestBMAddWithWeightRequiresMaxWeight(t *testing.T) {
+	bmf := getNoiselessBMF(t)
+	if err := bmf.AddWithWeight(1, 1); err == nil {
+		t.Errorf("AddWithWeight: got no error without MaxWeight, want error")
+	}
+	if _, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{
+		Epsilon:                      ln3,
+		MaxContributionsPerPartition: 1,
+		Lower:                        -1,
+		Upper:                        5,
+		MaxWeight:                    -1,
+	}); err == nil {
+		t.Errorf("NewBoundedMeanFloat64: got no error with a negative MaxWeight, want error")
+	}
+}
+
+func TestBMWeightedMergeAndAddSliceFloat64(t *testing.T) {
+	bm1 := getNoiselessWeightedBMF(t)
+	bm2 := getNoiselessWeightedBMF(t)
+	bm1.AddWithWeight(4, 3)
+	bm2.AddSlice([]float64{1, 2}) // weight 1 each
+	if err := bm1.Merge(bm2); err != nil {
+		t.Fatalf("Couldn't merge bm1 and bm2: %v", err)
+	}
+	if err := bm1.Merge(getNoiselessBMF(t)); err == nil {
+		t.Errorf("Merge: got no error when merging weighted and unweighted means, want error")
+	}
+	got, err := bm1.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	want := (4*3 + 1 + 2) / 5.0
+	if !ApproxEqual(got, want) {
+		t.Errorf("Merge: got %f, want %f", got, want)
+	}
+}
+
 func TestBMReturnsEntryIfSingleEntryIsAddedFloat64(t *testing.T) {
 	bmf := getNoiselessBMF(t)
 	// lower = -1, upper = 5
@@ -694,8 +795,13 @@ func TestBMEquallyInitializedFloat64(t *testing.T) {
 }
 
 func compareBoundedMeanFloat64(bm1, bm2 *BoundedMeanFloat64) bool {
+	if (bm1.weightSum == nil) != (bm2.weightSum == nil) ||
+		bm1.weightSum != nil && !compareBoundedSumFloat64(bm1.weightSum, bm2.weightSum) {
+		return false
+	}
 	return bm1.lower == bm2.lower &&
 		bm1.upper == bm2.upper &&
+		bm1.maxWeight == bm2.maxWeight &&
 		compareCount(&bm1.Count, &bm2.Count) &&
 		compareBoundedSumFloat64(&bm1.NormalizedSum, &bm2.NormalizedSum) &&
 		bm1.midPoint == bm2.midPoint &&
@@ -724,6 +830,13 @@ func TestBMFloat64Serialization(t *testing.T) {
 			MaxContributionsPerPartition: 6,
 			Noise:                        noise.Gaussian(),
 		}},
+		{"weighted", &BoundedMeanFloat64Options{
+			Epsilon:                      ln3,
+			Lower:                        0,
+			Upper:                        1,
+			MaxContributionsPerPartition: 1,
+			MaxWeight:                    10,
+		}},
 	} {
 		bm, err := NewBoundedMeanFloat64(tc.opts)
 		if err != nil {
@@ -770,3 +883,84 @@ func TestBoundedMeanFloat64SerializationStateChecks(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundedMeanFloat64WithRho(t *testing.T) {
+	bm, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{
+		Rho:                          0.5,
+		MaxContributionsPerPartition: 1,
+		Lower:                        -1,
+		Upper:                        1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize mean: %v", err)
+	}
+	// ρ is split in half between the count and the normalized sum.
+	want := noise.SigmaForRho(1, 1, 0.25)
+	for _, tc := range []struct {
+		desc           string
+		epsilon, delta float64
+	}{
+		{"count", bm.Count.epsilon, bm.Count.delta},
+		{"normalized sum", bm.NormalizedSum.epsilon, bm.NormalizedSum.delta},
+	} {
+		if got := noise.SigmaForGaussian(1, 1, tc.epsilon, tc.delta); math.Abs(got-want) > 2e-3*want {
+			t.Errorf("NewBoundedMeanFloat64 with Rho: got σ = %f for the %s, want %f", got, tc.desc, want)
+		}
+	}
+}
+
+func TestBMFReset(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		bm   *BoundedMeanFloat64
+	}{
+		{"unweighted", getNoiselessBMF(t)},
+		{"weighted", getNoiselessWeightedBMF(t)},
+	} {
+		tc.bm.Add(4)
+		if _, err := tc.bm.Result(); err != nil {
+			t.Fatalf("With %s mean, couldn't compute dp result: %v", tc.desc, err)
+		}
+		tc.bm.Reset()
+		tc.bm.Add(1)
+		tc.bm.Add(2)
+		got, err := tc.bm.Result()
+		if err != nil {
+			t.Fatalf("With %s mean, couldn't compute dp result after Reset: %v", tc.desc, err)
+		}
+		if !ApproxEqual(got, 1.5) {
+			t.Errorf("With %s mean, Result after Reset: got %f, want 1.5", tc.desc, got)
+		}
+	}
+}
+
+// Tests that a BoundedMeanFloat64 decoded on another worker can be merged with
+// local means.
+func TestBMFSerializeShipMerge(t *testing.T) {
+	shipped := getNoiselessBMF(t)
+	shipped.Add(1)
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode(BoundedMeanFloat64) error: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode(BoundedMeanFloat64) error: %v", err)
+	}
+	received := new(BoundedMeanFloat64)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode(BoundedMeanFloat64) error: %v", err)
+	}
+	local := getNoiselessBMF(t)
+	local.Add(2)
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded BoundedMeanFloat64: got error %v", err)
+	}
+	if err := received.Add(3); err != nil {
+		t.Fatalf("Add to a decoded BoundedMeanFloat64: got error %v", err)
+	}
+	// The normalized sum is the sum of the distances to the midpoint 2 of [-1, 5].
+	if received.Count.count != 3 || !ApproxEqual(received.NormalizedSum.sum.Float, 0) {
+		t.Errorf("count and normalized sum after merging a decoded BoundedMeanFloat64: got (%d, %f), want (3, 0)", received.Count.count, received.NormalizedSum.sum.Float)
+	}
+}
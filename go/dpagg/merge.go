@@ -0,0 +1,106 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Mergeable is an aggregation that merges aggregations of its own type into
+// itself, e.g. *Count, *BoundedSumFloat64 or *BoundedQuantiles.
+type Mergeable[T any] interface {
+	Merge(T) error
+}
+
+// MergeAll merges all aggregations of aggs into one and returns it, e.g. to
+// combine the partial aggregations decoded from the outputs of many workers.
+// All aggregations are consumed, and only the returned one may be used.
+//
+// The aggregations are merged in a balanced tree by a pool of GOMAXPROCS
+// goroutines: each goroutine first merges a contiguous chunk of aggs
+// sequentially, and the results of the chunks are then merged pairwise, each
+// level of the tree concurrently. Merging n aggregations thus takes about
+// n/GOMAXPROCS + log₂(GOMAXPROCS) sequential merges instead of n, while the
+// aggregations that grow with merges, e.g. BoundedQuantiles, are merged into
+// large ones only log₂(GOMAXPROCS) times. If merging fails, e.g. because two
+// aggregations were initialized with different options, MergeAll returns the
+// error and none of the aggregations may be used.
+func MergeAll[T Mergeable[T]](aggs []T) (T, error) {
+	return mergeAll(aggs, runtime.GOMAXPROCS(0))
+}
+
+// mergeAll is MergeAll with numWorkers goroutines.
+func mergeAll[T Mergeable[T]](aggs []T, numWorkers int) (T, error) {
+	var zero T
+	if len(aggs) == 0 {
+		return zero, fmt.Errorf("MergeAll: there are no aggregations to merge")
+	}
+	level := aggs
+	for len(level) > 1 {
+		// Each chunk of the level is merged into its first aggregation, which
+		// moves to the next level. The first level has numWorkers chunks, and the
+		// following ones have chunks of 2 aggregations.
+		chunkSize := (len(level) + numWorkers - 1) / numWorkers
+		if chunkSize < 2 {
+			chunkSize = 2
+		}
+		numChunks := (len(level) + chunkSize - 1) / chunkSize
+		errs := make([]error, numChunks)
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		workers := numWorkers
+		if workers > numChunks {
+			workers = numChunks
+		}
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(level []T) {
+				defer wg.Done()
+				for c := range jobs {
+					end := (c + 1) * chunkSize
+					if end > len(level) {
+						end = len(level)
+					}
+					for _, agg := range level[c*chunkSize+1 : end] {
+						if err := level[c*chunkSize].Merge(agg); err != nil {
+							errs[c] = err
+							break
+						}
+					}
+				}
+			}(level)
+		}
+		for c := 0; c < numChunks; c++ {
+			jobs <- c
+		}
+		close(jobs)
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return zero, fmt.Errorf("MergeAll: %w", err)
+			}
+		}
+		next := make([]T, numChunks)
+		for c := range next {
+			next[c] = level[c*chunkSize]
+		}
+		level = next
+	}
+	return level[0], nil
+}
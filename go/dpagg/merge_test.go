@@ -0,0 +1,162 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMergeAll(t *testing.T) {
+	for _, n := range []int{1, 2, 7, 64, 1000} {
+		for _, numWorkers := range []int{1, 3, 4} {
+			counts := make([]*Count, n)
+			for i := range counts {
+				counts[i] = getNoiselessCount(t)
+				counts[i].IncrementBy(int64(i))
+			}
+			merged, err := mergeAll(counts, numWorkers)
+			if err != nil {
+				t.Fatalf("MergeAll of %d Counts with %d workers: got error %v", n, numWorkers, err)
+			}
+			want := int64(n * (n - 1) / 2)
+			if got, err := merged.Result(); err != nil || got != want {
+				t.Errorf("MergeAll of %d Counts with %d workers: got (%d, %v), want (%d, nil)", n, numWorkers, got, err, want)
+			}
+		}
+	}
+}
+
+func TestMergeAllConsumesAggregations(t *testing.T) {
+	sums := []*BoundedSumFloat64{getNoiselessBSF(t), getNoiselessBSF(t), getNoiselessBSF(t)}
+	merged, err := MergeAll(sums)
+	if err != nil {
+		t.Fatalf("MergeAll: got error %v", err)
+	}
+	for _, bs := range sums {
+		if bs == merged {
+			continue
+		}
+		if err := bs.Add(1); err == nil {
+			t.Errorf("Add to an aggregation merged by MergeAll: got no error, want error")
+		}
+	}
+}
+
+func TestMergeAllErrors(t *testing.T) {
+	if _, err := MergeAll([]*Count{}); err == nil {
+		t.Errorf("MergeAll of no aggregations: got no error, want error")
+	}
+
+	counts := make([]*Count, 10)
+	for i := range counts {
+		counts[i] = getNoiselessCount(t)
+	}
+	incompatible, err := NewCount(&CountOptions{Epsilon: 2 * ln3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	counts[7] = incompatible
+	_, err = MergeAll(counts)
+	var mergeErr *IncompatibleMergeError
+	if !errors.As(err, &mergeErr) {
+		t.Errorf("MergeAll with an incompatible Count: got error %v, want an IncompatibleMergeError", err)
+	}
+}
+
+func TestMergeAllBoundedQuantiles(t *testing.T) {
+	bqs := make([]*BoundedQuantiles, 100)
+	for i := range bqs {
+		bqs[i] = getNoiselessBQ(t, 0, 100)
+		bqs[i].Add(float64(i))
+	}
+	merged, err := MergeAll(bqs)
+	if err != nil {
+		t.Fatalf("MergeAll: got error %v", err)
+	}
+	// The resolution of the tree is 0.01.
+	if got, err := merged.Result(0.5); err != nil || math.Abs(got-50) > 1 {
+		t.Errorf("Result(0.5) after MergeAll: got (%f, %v), want (50, nil)", got, err)
+	}
+}
+
+// newQuantilesToMerge returns n BoundedQuantiles with some entries each, whose
+// trees are expensive to merge.
+func newQuantilesToMerge(b *testing.B, n int) []*BoundedQuantiles {
+	b.Helper()
+	bqs := make([]*BoundedQuantiles, n)
+	for i := range bqs {
+		bq, err := NewBoundedQuantiles(&BoundedQuantilesOptions{
+			Epsilon:                      ln3,
+			MaxContributionsPerPartition: 1,
+			Lower:                        0,
+			Upper:                        1000,
+			Noise:                        noNoise{},
+		})
+		if err != nil {
+			b.Fatalf("Couldn't initialize BoundedQuantiles: %v", err)
+		}
+		for j := 0; j < 100; j++ {
+			bq.Add(float64((i*100 + j) % 1000))
+		}
+		bqs[i] = bq
+	}
+	return bqs
+}
+
+func BenchmarkMergeAllBoundedQuantiles(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bqs := newQuantilesToMerge(b, 1024)
+		b.StartTimer()
+		if _, err := MergeAll(bqs); err != nil {
+			b.Fatalf("MergeAll: got error %v", err)
+		}
+	}
+}
+
+func BenchmarkSequentialMergeBoundedQuantiles(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bqs := newQuantilesToMerge(b, 1024)
+		b.StartTimer()
+		for _, bq := range bqs[1:] {
+			if err := bqs[0].Merge(bq); err != nil {
+				b.Fatalf("Merge: got error %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkMergeAllCount(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		counts := make([]*Count, 4096)
+		for j := range counts {
+			c, err := NewCount(&CountOptions{Epsilon: ln3, Noise: noNoise{}})
+			if err != nil {
+				b.Fatalf("Couldn't initialize Count: %v", err)
+			}
+			counts[j] = c
+		}
+		b.StartTimer()
+		if _, err := MergeAll(counts); err != nil {
+			b.Fatalf("MergeAll: got error %v", err)
+		}
+	}
+}
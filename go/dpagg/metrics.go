@@ -0,0 +1,41 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Names of the mechanisms reported to metrics.Recorder that don't add noise of
+// a noise.Kind.
+const (
+	thresholdingMechanism       = "thresholding"
+	partitionSelectionMechanism = "partition_selection"
+)
+
+// mechanismName returns the name reported to metrics.Recorder for the
+// mechanism adding noise of kind k, e.g. "laplace", or the registered name of
+// noise registered with noise.Register.
+func mechanismName(k noise.Kind) string {
+	if name, ok := jsonNoiseKindNames[k]; ok {
+		return name
+	}
+	if name, ok := noise.RegisteredName(k); ok {
+		return name
+	}
+	return jsonNoiseKindNames[noise.Unrecognised]
+}
@@ -0,0 +1,156 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/metrics"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testRecorder is a metrics.Recorder keeping the reported metrics in memory.
+type testRecorder struct {
+	created           map[string]int
+	epsilon, delta    map[string]float64
+	clamped, total    map[string]int64
+	droppedPartitions map[string]int64
+}
+
+func newTestRecorder() *testRecorder {
+	return &testRecorder{
+		created:           make(map[string]int),
+		epsilon:           make(map[string]float64),
+		delta:             make(map[string]float64),
+		clamped:           make(map[string]int64),
+		total:             make(map[string]int64),
+		droppedPartitions: make(map[string]int64),
+	}
+}
+
+func (r *testRecorder) AggregationCreated(aggregation string) { r.created[aggregation]++ }
+
+func (r *testRecorder) BudgetConsumed(mechanism string, epsilon, delta float64) {
+	r.epsilon[mechanism] += epsilon
+	r.delta[mechanism] += delta
+}
+
+func (r *testRecorder) ValuesClamped(aggregation string, clamped, total int64) {
+	r.clamped[aggregation] += clamped
+	r.total[aggregation] += total
+}
+
+func (r *testRecorder) PartitionsDropped(aggregation string, count int64) {
+	r.droppedPartitions[aggregation] += count
+}
+
+// recordMetrics sets a testRecorder as the metrics.Recorder for the duration
+// of the test.
+func recordMetrics(t *testing.T) *testRecorder {
+	t.Helper()
+	r := newTestRecorder()
+	metrics.SetRecorder(r)
+	t.Cleanup(func() { metrics.SetRecorder(nil) })
+	return r
+}
+
+func TestCountMetrics(t *testing.T) {
+	r := recordMetrics(t)
+	for i := 0; i < 2; i++ {
+		c, err := NewCount(&CountOptions{Epsilon: ln3, Delta: tenten, Noise: noise.Gaussian()})
+		if err != nil {
+			t.Fatalf("Couldn't initialize Count: %v", err)
+		}
+		// The count is far below the threshold, so the partition is dropped.
+		if _, err := c.ThresholdedResult(tenten); err != nil {
+			t.Fatalf("ThresholdedResult: got error %v", err)
+		}
+	}
+	if r.created["Count"] != 2 {
+		t.Errorf("AggregationCreated: got %d Counts, want 2", r.created["Count"])
+	}
+	if !ApproxEqual(r.epsilon["gaussian"], 2*ln3) || !ApproxEqual(r.delta["gaussian"], 2*tenten) {
+		t.Errorf("BudgetConsumed: got (%f, %g) for gaussian, want (%f, %g)", r.epsilon["gaussian"], r.delta["gaussian"], 2*ln3, 2*tenten)
+	}
+	if !ApproxEqual(r.delta[thresholdingMechanism], 2*tenten) {
+		t.Errorf("BudgetConsumed: got δ=%g for thresholding, want %g", r.delta[thresholdingMechanism], 2*tenten)
+	}
+	if r.droppedPartitions["Count"] != 2 {
+		t.Errorf("PartitionsDropped: got %d for Count, want 2", r.droppedPartitions["Count"])
+	}
+}
+
+func TestBoundedSumMetrics(t *testing.T) {
+	r := recordMetrics(t)
+	opt := &BoundedSumFloat64Options{Epsilon: ln3, Lower: -1, Upper: 1, Noise: noNoise{}}
+	bs1, err := NewBoundedSumFloat64(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs1: %v", err)
+	}
+	bs2, err := NewBoundedSumFloat64(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs2: %v", err)
+	}
+	bs1.Add(0.5)
+	bs1.Add(3)
+	bs1.AddMany(-2, 3)
+	bs2.AddSlice([]float64{0, 1, 5})
+	if err := bs1.Merge(bs2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	if _, err := bs1.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := newTestRecorder()
+	want.created["BoundedSumFloat64"] = 2
+	want.epsilon["unrecognised"] = ln3
+	want.delta["unrecognised"] = 0
+	want.clamped["BoundedSumFloat64"] = 5
+	want.total["BoundedSumFloat64"] = 8
+	if diff := cmp.Diff(want, r, cmp.AllowUnexported(testRecorder{})); diff != "" {
+		t.Errorf("metrics of BoundedSumFloat64 (-want +got):\n%s", diff)
+	}
+}
+
+func TestPreAggSelectPartitionMetrics(t *testing.T) {
+	for _, l0 := range []int64{1, 5} {
+		r := recordMetrics(t)
+		s, err := NewPreAggSelectPartition(&PreAggSelectPartitionOptions{Epsilon: ln3, Delta: tenten, MaxPartitionsContributed: l0})
+		if err != nil {
+			t.Fatalf("Couldn't initialize PreAggSelectPartition: %v", err)
+		}
+		// Without privacy units, the partition is always dropped.
+		if keep, err := s.ShouldKeepPartition(); err != nil || keep {
+			t.Fatalf("ShouldKeepPartition with MaxPartitionsContributed=%d: got (%t, %v), want (false, nil)", l0, keep, err)
+		}
+		if r.created["PreAggSelectPartition"] != 1 {
+			t.Errorf("AggregationCreated with MaxPartitionsContributed=%d: got %d PreAggSelectPartitions, want 1", l0, r.created["PreAggSelectPartition"])
+		}
+		if r.droppedPartitions["PreAggSelectPartition"] != 1 || r.droppedPartitions["Count"] != 0 {
+			t.Errorf("PartitionsDropped with MaxPartitionsContributed=%d: got %v, want 1 for PreAggSelectPartition only", l0, r.droppedPartitions)
+		}
+		var epsilon, delta float64
+		for m := range r.epsilon {
+			epsilon += r.epsilon[m]
+			delta += r.delta[m]
+		}
+		if !ApproxEqual(epsilon, ln3) || !ApproxEqual(delta, tenten) {
+			t.Errorf("BudgetConsumed with MaxPartitionsContributed=%d: got (%f, %g) in total, want (%f, %g)", l0, epsilon, delta, ln3, tenten)
+		}
+	}
+}
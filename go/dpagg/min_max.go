@@ -0,0 +1,183 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// BoundedExtremumOptions contains the options necessary to initialize a
+// BoundedMin or a BoundedMax.
+type BoundedExtremumOptions struct {
+	Epsilon                      float64 // Privacy parameter ε. Required.
+	Delta                        float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed     int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64   // How many times may a single user contribute to a single partition? Required.
+	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower < Upper.
+	Lower, Upper float64
+	Noise        noise.Noise // Type of noise used. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+}
+
+// BoundedMinOptions contains the options necessary to initialize a BoundedMin.
+type BoundedMinOptions = BoundedExtremumOptions
+
+// BoundedMaxOptions contains the options necessary to initialize a BoundedMax.
+type BoundedMaxOptions = BoundedExtremumOptions
+
+// boundedExtremum computes the quantile of rank 0 or 1 of the values added to
+// it with a BoundedQuantiles.
+type boundedExtremum struct {
+	quantiles *BoundedQuantiles
+	rank      float64
+}
+
+func newBoundedExtremum(opt *BoundedExtremumOptions, rank float64) (boundedExtremum, error) {
+	if opt == nil {
+		opt = &BoundedExtremumOptions{}
+	}
+	bq, err := NewBoundedQuantiles(&BoundedQuantilesOptions{
+		Epsilon:                      opt.Epsilon,
+		Delta:                        opt.Delta,
+		MaxPartitionsContributed:     opt.MaxPartitionsContributed,
+		MaxContributionsPerPartition: opt.MaxContributionsPerPartition,
+		Lower:                        opt.Lower,
+		Upper:                        opt.Upper,
+		Noise:                        opt.Noise,
+		Rho:                          opt.Rho,
+	})
+	if err != nil {
+		return boundedExtremum{}, err
+	}
+	return boundedExtremum{quantiles: bq, rank: rank}, nil
+}
+
+// Add adds an entry. It skips (ignores) NaN values because their contribution
+// to the final result is not well defined.
+func (be *boundedExtremum) Add(e float64) error {
+	return be.quantiles.Add(e)
+}
+
+// Result returns a differentially private estimate of the extremum of the
+// values added so far. Like BoundedQuantiles.Result, it can be called multiple
+// times, and the privacy budget is paid only once.
+func (be *boundedExtremum) Result() (float64, error) {
+	return be.quantiles.Result(be.rank)
+}
+
+// Reset returns the aggregation to the state it had when it was initialized,
+// like BoundedQuantiles.Reset.
+func (be *boundedExtremum) Reset() {
+	be.quantiles.Reset()
+}
+
+// GobEncode encodes the aggregation.
+func (be *boundedExtremum) GobEncode() ([]byte, error) {
+	return be.quantiles.GobEncode()
+}
+
+// GobDecode decodes the aggregation, except for its rank which is set by the
+// type decoded into.
+func (be *boundedExtremum) GobDecode(data []byte) error {
+	bq := &BoundedQuantiles{}
+	if err := bq.GobDecode(data); err != nil {
+		return err
+	}
+	be.quantiles = bq
+	return nil
+}
+
+// BoundedMin calculates a differentially private minimum of a collection of
+// float64 values, e.g. to find a lower clamping bound for other aggregations
+// or to report the range of the data.
+//
+// The minimum is the quantile of rank 0 of a BoundedQuantiles, whose
+// estimate is the 0.005 quantile to mitigate the inaccuracy of the quantile
+// tree mechanism around the extreme ranks: outliers are thus not reflected in
+// the result. The result is in [Lower, Upper], with a resolution that depends
+// on the width of the bounds, so that loose bounds only reduce accuracy.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type BoundedMin struct {
+	boundedExtremum
+}
+
+// NewBoundedMin returns a new BoundedMin.
+func NewBoundedMin(opt *BoundedMinOptions) (*BoundedMin, error) {
+	be, err := newBoundedExtremum(opt, 0)
+	if err != nil {
+		return nil, fmt.Errorf("NewBoundedMin: %w", err)
+	}
+	return &BoundedMin{be}, nil
+}
+
+// Merge merges bm2 into bm (i.e., adds to bm all entries that were added to
+// bm2). bm2 is consumed by this operation: bm2 may not be used after it is
+// merged into bm.
+func (bm *BoundedMin) Merge(bm2 *BoundedMin) error {
+	return bm.quantiles.Merge(bm2.quantiles)
+}
+
+// GobDecode decodes BoundedMin.
+func (bm *BoundedMin) GobDecode(data []byte) error {
+	bm.rank = 0
+	return bm.boundedExtremum.GobDecode(data)
+}
+
+// BoundedMax calculates a differentially private maximum of a collection of
+// float64 values, e.g. to find an upper clamping bound for other aggregations
+// or to report the range of the data.
+//
+// The maximum is the quantile of rank 1 of a BoundedQuantiles, whose estimate
+// is the 0.995 quantile, see BoundedMin.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type BoundedMax struct {
+	boundedExtremum
+}
+
+// NewBoundedMax returns a new BoundedMax.
+func NewBoundedMax(opt *BoundedMaxOptions) (*BoundedMax, error) {
+	be, err := newBoundedExtremum(opt, 1)
+	if err != nil {
+		return nil, fmt.Errorf("NewBoundedMax: %w", err)
+	}
+	return &BoundedMax{be}, nil
+}
+
+// Merge merges bm2 into bm (i.e., adds to bm all entries that were added to
+// bm2). bm2 is consumed by this operation: bm2 may not be used after it is
+// merged into bm.
+func (bm *BoundedMax) Merge(bm2 *BoundedMax) error {
+	return bm.quantiles.Merge(bm2.quantiles)
+}
+
+// GobDecode decodes BoundedMax.
+func (bm *BoundedMax) GobDecode(data []byte) error {
+	bm.rank = 1
+	return bm.boundedExtremum.GobDecode(data)
+}
@@ -0,0 +1,168 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func noiselessExtremumOptions() *BoundedExtremumOptions {
+	return &BoundedExtremumOptions{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        100,
+		Noise:                        noNoise{},
+	}
+}
+
+func TestNewBoundedMinMaxInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *BoundedExtremumOptions
+	}{
+		{"nil options", nil},
+		{"no MaxContributionsPerPartition", &BoundedExtremumOptions{Epsilon: ln3, Lower: 0, Upper: 100}},
+		{"equal bounds", &BoundedExtremumOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 1, Upper: 1}},
+		{"zero epsilon", &BoundedExtremumOptions{MaxContributionsPerPartition: 1, Lower: 0, Upper: 100}},
+	} {
+		if _, err := NewBoundedMin(tc.opt); err == nil {
+			t.Errorf("NewBoundedMin: when %s got no error, want error", tc.desc)
+		}
+		if _, err := NewBoundedMax(tc.opt); err == nil {
+			t.Errorf("NewBoundedMax: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestBoundedMinMaxResult(t *testing.T) {
+	bmin, err := NewBoundedMin(noiselessExtremumOptions())
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMin: %v", err)
+	}
+	bmax, err := NewBoundedMax(noiselessExtremumOptions())
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMax: %v", err)
+	}
+	// 1000 values evenly spread over [20, 60], plus NaN which is ignored.
+	for i := 0; i < 1000; i++ {
+		e := 20 + 40*float64(i)/999
+		bmin.Add(e)
+		bmax.Add(e)
+	}
+	bmin.Add(math.NaN())
+	bmax.Add(math.NaN())
+	gotMin, err := bmin.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp min: %v", err)
+	}
+	gotMax, err := bmax.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp max: %v", err)
+	}
+	// The extrema are estimated by the 0.005 and 0.995 quantiles, i.e. 20.2 and 59.8.
+	if math.Abs(gotMin-20.2) > 0.1 {
+		t.Errorf("BoundedMin.Result: got %f, want 20.2", gotMin)
+	}
+	if math.Abs(gotMax-59.8) > 0.1 {
+		t.Errorf("BoundedMax.Result: got %f, want 59.8", gotMax)
+	}
+	// Like BoundedQuantiles, the result can be computed multiple times.
+	if again, err := bmin.Result(); err != nil || again != gotMin {
+		t.Errorf("BoundedMin.Result called twice: got (%f, %v), want (%f, nil)", again, err, gotMin)
+	}
+}
+
+func TestBoundedMinMaxClampsToBounds(t *testing.T) {
+	bmin, err := NewBoundedMin(noiselessExtremumOptions())
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMin: %v", err)
+	}
+	bmax, err := NewBoundedMax(noiselessExtremumOptions())
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMax: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		bmin.Add(-50)
+		bmax.Add(500)
+	}
+	if got, _ := bmin.Result(); got < 0 || got > 0.01 {
+		t.Errorf("BoundedMin.Result: got %f, want 0", got)
+	}
+	if got, _ := bmax.Result(); got < 99.99 || got > 100 {
+		t.Errorf("BoundedMax.Result: got %f, want 100", got)
+	}
+}
+
+func TestBoundedMinMerge(t *testing.T) {
+	bm1, err := NewBoundedMin(noiselessExtremumOptions())
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMin: %v", err)
+	}
+	bm2, err := NewBoundedMin(noiselessExtremumOptions())
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMin: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		bm1.Add(50)
+		bm2.Add(10)
+	}
+	if err := bm1.Merge(bm2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	if got, _ := bm1.Result(); math.Abs(got-10) > 0.01 {
+		t.Errorf("BoundedMin.Result after Merge: got %f, want 10", got)
+	}
+	if err := bm2.Add(1); err == nil {
+		t.Errorf("Add after Merge: got no error, want error")
+	}
+}
+
+func TestBoundedMaxSerialization(t *testing.T) {
+	// noNoise can't be serialized: use Laplace noise with a large epsilon for
+	// it to be negligible.
+	opt := noiselessExtremumOptions()
+	opt.Epsilon = 1000
+	opt.Noise = nil
+	bm, err := NewBoundedMax(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedMax: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		bm.Add(30)
+	}
+	bytes, err := encode(bm)
+	if err != nil {
+		t.Fatalf("encode(BoundedMax) error: %v", err)
+	}
+	bmUnmarshalled := new(BoundedMax)
+	if err := decode(bmUnmarshalled, bytes); err != nil {
+		t.Fatalf("decode(BoundedMax) error: %v", err)
+	}
+	got, err := bmUnmarshalled.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp max: %v", err)
+	}
+	if math.Abs(got-30) > 0.1 {
+		t.Errorf("BoundedMax.Result after decode(encode(_)): got %f, want 30", got)
+	}
+	if bmUnmarshalled.rank != 1 {
+		t.Errorf("decode(encode(_)): got rank %f, want 1", bmUnmarshalled.rank)
+	}
+}
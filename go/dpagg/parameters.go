@@ -0,0 +1,167 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parameters are the effective parameters of an aggregation, after defaults
+// were applied and its budget was split among its sub-aggregations, e.g. for
+// audit logging. The budget is the one that the aggregation has left, which is
+// smaller than the initial one after an interim release with ResultWithBudget.
+type Parameters struct {
+	// Name of the aggregation, or of the field holding it for a sub-aggregation.
+	Aggregation              string
+	Epsilon, Delta           float64
+	MaxPartitionsContributed int64
+	// Maximal contribution of a privacy unit to a single partition, i.e. the
+	// maximal number of contributions for Count and BoundedQuantiles, and the
+	// maximal absolute contribution for a BoundedSum. 0 for aggregations whose
+	// sub-aggregations have different sensitivities.
+	LInfSensitivity float64
+	// Lower and Upper bounds for clamping, 0 for unbounded aggregations.
+	Lower, Upper float64
+	Noise        string
+	// Sub-aggregations among which the budget is split. The budget of the
+	// aggregation is the sum of their budgets.
+	Components []Parameters
+}
+
+// String returns a summary of p, with one line per aggregation.
+func (p Parameters) String() string {
+	var b strings.Builder
+	p.write(&b, "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (p Parameters) write(b *strings.Builder, indent string) {
+	fmt.Fprintf(b, "%s%s: ε=%g, δ=%g, MaxPartitionsContributed=%d", indent, p.Aggregation, p.Epsilon, p.Delta, p.MaxPartitionsContributed)
+	if p.LInfSensitivity != 0 {
+		fmt.Fprintf(b, ", L∞ sensitivity=%g", p.LInfSensitivity)
+	}
+	if p.Lower != 0 || p.Upper != 0 {
+		fmt.Fprintf(b, ", bounds=[%g, %g]", p.Lower, p.Upper)
+	}
+	if p.Noise != "" {
+		fmt.Fprintf(b, ", noise=%s", p.Noise)
+	}
+	b.WriteString("\n")
+	for _, c := range p.Components {
+		c.write(b, indent+"  ")
+	}
+}
+
+// composite returns the parameters of an aggregation whose budget is split
+// among components.
+func composite(name string, lower, upper float64, components ...Parameters) Parameters {
+	p := Parameters{Aggregation: name, Lower: lower, Upper: upper, Components: components}
+	for _, c := range components {
+		p.Epsilon += c.Epsilon
+		p.Delta += c.Delta
+	}
+	if len(components) > 0 {
+		p.MaxPartitionsContributed = components[0].MaxPartitionsContributed
+		p.Noise = components[0].Noise
+	}
+	return p
+}
+
+// named returns p for the sub-aggregation held in field name.
+func (p Parameters) named(name string) Parameters {
+	p.Aggregation = name
+	return p
+}
+
+// Parameters returns the effective parameters of c.
+func (c *Count) Parameters() Parameters {
+	eps, del := c.remainingBudget()
+	return Parameters{
+		Aggregation:              "Count",
+		Epsilon:                  eps,
+		Delta:                    del,
+		MaxPartitionsContributed: c.l0Sensitivity,
+		LInfSensitivity:          float64(c.lInfSensitivity),
+		Noise:                    fmt.Sprint(c.Noise),
+	}
+}
+
+// Parameters returns the effective parameters of bs.
+func (bs *BoundedSum[T]) Parameters() Parameters {
+	eps, del := bs.remainingBudget()
+	return Parameters{
+		Aggregation:              bsName[T](),
+		Epsilon:                  eps,
+		Delta:                    del,
+		MaxPartitionsContributed: bs.l0Sensitivity,
+		LInfSensitivity:          float64(bs.lInfSensitivity),
+		Lower:                    float64(bs.lower),
+		Upper:                    float64(bs.upper),
+		Noise:                    fmt.Sprint(bs.Noise),
+	}
+}
+
+// Parameters returns the effective parameters of bm.
+func (bm *BoundedMeanFloat64) Parameters() Parameters {
+	denominator := bm.Count.Parameters().named("Count")
+	if bm.weighted() {
+		denominator = bm.weightSum.Parameters().named("WeightSum")
+	}
+	return composite("BoundedMeanFloat64", bm.lower, bm.upper,
+		denominator,
+		bm.NormalizedSum.Parameters().named("NormalizedSum"))
+}
+
+// Parameters returns the effective parameters of bv.
+func (bv *BoundedVariance) Parameters() Parameters {
+	return composite("BoundedVariance", bv.lower, bv.upper,
+		bv.Count.Parameters().named("Count"),
+		bv.NormalizedSum.Parameters().named("NormalizedSum"),
+		bv.NormalizedSumOfSquares.Parameters().named("NormalizedSumOfSquares"))
+}
+
+// Parameters returns the effective parameters of bstdv.
+func (bstdv *BoundedStandardDeviation) Parameters() Parameters {
+	p := bstdv.Variance.Parameters()
+	p.Aggregation = "BoundedStandardDeviation"
+	return p
+}
+
+// Parameters returns the effective parameters of bq.
+func (bq *BoundedQuantiles) Parameters() Parameters {
+	return Parameters{
+		Aggregation:              "BoundedQuantiles",
+		Epsilon:                  bq.epsilon,
+		Delta:                    bq.delta,
+		MaxPartitionsContributed: bq.l0Sensitivity,
+		LInfSensitivity:          bq.lInfSensitivity,
+		Lower:                    bq.lower,
+		Upper:                    bq.upper,
+		Noise:                    fmt.Sprint(bq.Noise),
+	}
+}
+
+// Parameters returns the effective parameters of s.
+func (s *PreAggSelectPartition) Parameters() Parameters {
+	return Parameters{
+		Aggregation:              "PreAggSelectPartition",
+		Epsilon:                  s.epsilon,
+		Delta:                    s.delta,
+		MaxPartitionsContributed: s.l0Sensitivity,
+	}
+}
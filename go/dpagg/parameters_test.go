@@ -0,0 +1,87 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestCountParameters(t *testing.T) {
+	c, err := NewCount(&CountOptions{Epsilon: 2, MaxPartitionsContributed: 3})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	want := Parameters{
+		Aggregation:              "Count",
+		Epsilon:                  2,
+		MaxPartitionsContributed: 3,
+		LInfSensitivity:          1,
+		Noise:                    "Laplace Noise",
+	}
+	if got := c.Parameters(); got.String() != want.String() {
+		t.Errorf("Parameters: got %v, want %v", got, want)
+	}
+}
+
+func TestBoundedVarianceParametersSplitBudget(t *testing.T) {
+	bv, err := NewBoundedVariance(&BoundedVarianceOptions{
+		Epsilon:                      3,
+		Delta:                        3e-5,
+		MaxContributionsPerPartition: 2,
+		Lower:                        0,
+		Upper:                        10,
+		Noise:                        noise.Gaussian(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedVariance: %v", err)
+	}
+	p := bv.Parameters()
+	if !ApproxEqual(p.Epsilon, 3) || !ApproxEqual(p.Delta, 3e-5) {
+		t.Errorf("Parameters: got (ε, δ) = (%g, %g), want (3, 3e-5)", p.Epsilon, p.Delta)
+	}
+	if p.Lower != 0 || p.Upper != 10 {
+		t.Errorf("Parameters: got bounds [%g, %g], want [0, 10]", p.Lower, p.Upper)
+	}
+	if len(p.Components) != 3 {
+		t.Fatalf("Parameters: got %d components, want 3", len(p.Components))
+	}
+	for _, c := range p.Components {
+		if !ApproxEqual(c.Epsilon, 1) {
+			t.Errorf("Parameters: got ε = %g for %s, want 1", c.Epsilon, c.Aggregation)
+		}
+	}
+	// The normalized sum is bounded by the distance to the midpoint.
+	if sum := p.Components[1]; sum.Aggregation != "NormalizedSum" || sum.Upper != 5 || sum.LInfSensitivity != 10 {
+		t.Errorf("Parameters: got %v for the normalized sum, want bounds [-5, 5] and L∞ sensitivity 10", sum)
+	}
+	if s := p.String(); strings.Count(s, "\n") != 3 || !strings.Contains(s, "  NormalizedSumOfSquares: ") {
+		t.Errorf("String: got %q, want one line per aggregation", s)
+	}
+}
+
+func TestParametersAfterResultWithBudget(t *testing.T) {
+	c := getNoiselessCount(t)
+	if _, err := c.ResultWithBudget(0.25, 0); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	if got := c.Parameters().Epsilon; !ApproxEqual(got, 0.75*ln3) {
+		t.Errorf("Parameters: got ε = %g after spending a quarter of the budget, want %g", got, 0.75*ln3)
+	}
+}
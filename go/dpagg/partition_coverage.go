@@ -0,0 +1,105 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// KeepProbability returns the probability that ShouldKeepPartition keeps a
+// partition with idCount privacy units. It only depends on the privacy
+// parameters of s, not on its state, and no privacy budget is consumed by this
+// operation.
+//
+// The probability is exact when MaxPartitionsContributed ≤ 3. Otherwise,
+// ShouldKeepPartition thresholds a count with Gaussian noise, and the
+// probability is computed with a continuous approximation of the noise.
+func (s *PreAggSelectPartition) KeepProbability(idCount int64) (float64, error) {
+	if idCount < 0 {
+		return 0, fmt.Errorf("KeepProbability: idCount is %d, must be non-negative", idCount)
+	}
+	if s.l0Sensitivity <= 3 {
+		return keepPartitionProbability(idCount, s.l0Sensitivity, s.epsilon, s.delta)
+	}
+	// Same Gaussian thresholding as ShouldKeepPartition.
+	threshold, err := noise.Gaussian().Threshold(s.l0Sensitivity, 1, s.epsilon, s.delta/2, s.delta/2)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't compute threshold for KeepProbability: %w", err)
+	}
+	sigma := noise.SigmaForGaussian(s.l0Sensitivity, 1, s.epsilon, s.delta/2)
+	// The noisy count is an integer, kept if it is at least the rounded up
+	// threshold.
+	gap := math.Ceil(threshold) - 0.5 - float64(idCount)
+	return math.Erfc(gap/(sigma*math.Sqrt2)) / 2, nil
+}
+
+// PartitionCoverage is the predicted outcome of partition selection on a set
+// of partitions, see PredictPartitionCoverage.
+type PartitionCoverage struct {
+	NumPartitions int
+	// Expected number of partitions kept by partition selection.
+	ExpectedKept float64
+	// Expected fraction of the partitions kept by partition selection.
+	KeptFraction float64
+	// Expected fraction of the privacy units of all partitions, counted once
+	// per partition they contribute to, that are in kept partitions.
+	KeptPrivacyUnitFraction float64
+}
+
+// PredictPartitionCoverage predicts how many partitions partition selection
+// with the privacy parameters of opt would keep, given the number of privacy
+// units in each partition, e.g. approximate sizes from a public histogram or
+// sizes sampled from a prior distribution. It lets analysts tune the privacy
+// parameters and the split of the budget between partition selection and the
+// aggregations before spending any budget; since the sizes are public, no
+// privacy budget is consumed by this operation.
+func PredictPartitionCoverage(partitionSizes []int64, opt *PreAggSelectPartitionOptions) (*PartitionCoverage, error) {
+	if opt == nil {
+		opt = &PreAggSelectPartitionOptions{}
+	}
+	s, err := NewPreAggSelectPartition(opt)
+	if err != nil {
+		return nil, fmt.Errorf("PredictPartitionCoverage: %w", err)
+	}
+	coverage := &PartitionCoverage{NumPartitions: len(partitionSizes)}
+	// Many partitions typically have the same size.
+	probabilities := make(map[int64]float64)
+	var keptUnits, totalUnits float64
+	for _, size := range partitionSizes {
+		p, ok := probabilities[size]
+		if !ok {
+			p, err = s.KeepProbability(size)
+			if err != nil {
+				return nil, fmt.Errorf("PredictPartitionCoverage: %w", err)
+			}
+			probabilities[size] = p
+		}
+		coverage.ExpectedKept += p
+		keptUnits += p * float64(size)
+		totalUnits += float64(size)
+	}
+	if len(partitionSizes) > 0 {
+		coverage.KeptFraction = coverage.ExpectedKept / float64(len(partitionSizes))
+	}
+	if totalUnits > 0 {
+		coverage.KeptPrivacyUnitFraction = keptUnits / totalUnits
+	}
+	return coverage, nil
+}
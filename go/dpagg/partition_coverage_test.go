@@ -0,0 +1,80 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+// Tests that KeepProbability matches the frequency at which ShouldKeepPartition keeps a
+// partition, with both the exact and the Gaussian partition selection.
+func TestPreAggSelectPartitionKeepProbability(t *testing.T) {
+	for _, l0 := range []int64{1, 5} {
+		for _, idCount := range []int64{1, 10, 40} {
+			opt := &PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 1e-3, MaxPartitionsContributed: l0}
+			s, err := NewPreAggSelectPartition(opt)
+			if err != nil {
+				t.Fatalf("Couldn't initialize PreAggSelectPartition: %v", err)
+			}
+			want, err := s.KeepProbability(idCount)
+			if err != nil {
+				t.Fatalf("KeepProbability: got error %v", err)
+			}
+			const runs = 10000
+			var kept int
+			for i := 0; i < runs; i++ {
+				s, _ := NewPreAggSelectPartition(opt)
+				s.idCount = idCount
+				if keep, _ := s.ShouldKeepPartition(); keep {
+					kept++
+				}
+			}
+			// 5 standard deviations of the frequency, plus a margin for the
+			// continuous approximation of the Gaussian noise.
+			if got := float64(kept) / runs; math.Abs(got-want) > 5*math.Sqrt(want*(1-want)/runs)+0.01 {
+				t.Errorf("With l0=%d and %d privacy units, KeepProbability: got %f, want close to the observed frequency %f", l0, idCount, want, got)
+			}
+		}
+	}
+}
+
+func TestPredictPartitionCoverage(t *testing.T) {
+	opt := &PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 1e-5}
+	s, _ := NewPreAggSelectPartition(opt)
+	hardThreshold, err := s.GetHardThreshold()
+	if err != nil {
+		t.Fatalf("GetHardThreshold: got error %v", err)
+	}
+	// Empty partitions are never kept, and partitions above the hard threshold
+	// are always kept.
+	sizes := []int64{0, 0, int64(hardThreshold), int64(hardThreshold) + 10}
+	got, err := PredictPartitionCoverage(sizes, opt)
+	if err != nil {
+		t.Fatalf("PredictPartitionCoverage: got error %v", err)
+	}
+	if got.NumPartitions != 4 || got.ExpectedKept != 2 || got.KeptFraction != 0.5 || got.KeptPrivacyUnitFraction != 1 {
+		t.Errorf("PredictPartitionCoverage: got %+v, want 2 of 4 partitions with all privacy units kept", got)
+	}
+
+	if _, err := PredictPartitionCoverage(sizes, &PreAggSelectPartitionOptions{Epsilon: ln3}); err == nil {
+		t.Errorf("PredictPartitionCoverage with a zero delta: got no error, want error")
+	}
+	if _, err := PredictPartitionCoverage([]int64{-1}, opt); err == nil {
+		t.Errorf("PredictPartitionCoverage with a negative size: got no error, want error")
+	}
+}
@@ -0,0 +1,73 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// PopulationCapMetadata describes how the result of an aggregation was post
+// processed using a public upper bound on the number of privacy units, e.g.
+// the number of registered users, set with the MaxPrivacyUnits option of Count
+// or BoundedSum. It should be published along with the result so that its
+// consumers know that the result may be biased by the clamping.
+//
+// Since the raw value of the aggregation is always in [Lower, Upper], clamping
+// the noised value to this range can only bring it closer to the raw value,
+// and the confidence interval can be intersected with it. This is post
+// processing: it only depends on public information, so no privacy budget is
+// consumed by it.
+type PopulationCapMetadata struct {
+	MaxPrivacyUnits int64   // Public upper bound on the number of privacy units, 0 if none was set.
+	Lower, Upper    float64 // Range of the raw value implied by MaxPrivacyUnits.
+	Clamped         bool    // Whether the noised value was outside [Lower, Upper] and was clamped to it.
+}
+
+// checkMaxPrivacyUnits checks the MaxPrivacyUnits option of an aggregation
+// whose contributions are bounded by [lower, upper] and lInf.
+func checkMaxPrivacyUnits(maxPrivacyUnits int64, lInf, lower, upper float64, integer bool) error {
+	if maxPrivacyUnits == 0 {
+		return nil
+	}
+	if maxPrivacyUnits < 0 {
+		return fmt.Errorf("MaxPrivacyUnits is %d, must be non-negative", maxPrivacyUnits)
+	}
+	lo, hi := populationRange(maxPrivacyUnits, lInf, lower, upper)
+	if math.IsInf(lo, 0) || math.IsInf(hi, 0) || (integer && (lo < math.MinInt64 || hi >= math.MaxInt64)) {
+		return fmt.Errorf("MaxPrivacyUnits = %d is too high, the range of the raw value overflows", maxPrivacyUnits)
+	}
+	return nil
+}
+
+// populationRange returns the range of the raw value of an aggregation to
+// which at most maxPrivacyUnits privacy units contribute, each with values in
+// [lower, upper] whose total is at most lInf in absolute value.
+func populationRange(maxPrivacyUnits int64, lInf, lower, upper float64) (float64, float64) {
+	scale := float64(maxPrivacyUnits) * lInf / math.Max(math.Abs(lower), math.Abs(upper))
+	return scale * math.Min(0, lower), scale * math.Max(0, upper)
+}
+
+// restrictConfidenceInterval returns the intersection of confInt with
+// [lower, upper], which contains the raw value.
+func restrictConfidenceInterval(confInt noise.ConfidenceInterval, lower, upper float64) noise.ConfidenceInterval {
+	confInt.LowerBound = math.Min(math.Max(confInt.LowerBound, lower), upper)
+	confInt.UpperBound = math.Max(math.Min(confInt.UpperBound, upper), lower)
+	return confInt
+}
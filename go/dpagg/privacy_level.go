@@ -0,0 +1,71 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import "fmt"
+
+// PrivacyLevel specifies what is protected by the differential privacy
+// guarantees of an aggregation, i.e. what its privacy unit is.
+type PrivacyLevel int
+
+const (
+	// UserLevel protects privacy units that may contribute many times, e.g.
+	// users, within the bounds given by MaxPartitionsContributed and
+	// MaxContributionsPerPartition. It is the default.
+	UserLevel PrivacyLevel = iota
+	// EventLevel protects single contributions: each call to e.g. Add or
+	// Increment is its own privacy unit, as for timestamped telemetry events
+	// that aren't tied to a user ID. Each privacy unit then contributes once to
+	// a single partition, so MaxPartitionsContributed and
+	// MaxContributionsPerPartition are both 1 and must be left unset or set to
+	// 1. Note that a user contributing several events is only protected to the
+	// extent of a single event.
+	EventLevel
+)
+
+// String returns the name of the privacy level.
+func (l PrivacyLevel) String() string {
+	switch l {
+	case UserLevel:
+		return "UserLevel"
+	case EventLevel:
+		return "EventLevel"
+	}
+	return fmt.Sprintf("PrivacyLevel(%d)", int(l))
+}
+
+// contributionBounds returns the maximum number of partitions a privacy unit
+// may contribute to and the maximum number of contributions per partition
+// with privacy level l, given the MaxPartitionsContributed and
+// MaxContributionsPerPartition options. With UserLevel, they are returned
+// unchanged, so that the caller applies its defaults and checks; with
+// EventLevel, they are both 1.
+func (l PrivacyLevel) contributionBounds(maxPartitionsContributed, maxContributionsPerPartition int64) (int64, int64, error) {
+	switch l {
+	case UserLevel:
+		return maxPartitionsContributed, maxContributionsPerPartition, nil
+	case EventLevel:
+		if maxPartitionsContributed != 0 && maxPartitionsContributed != 1 {
+			return 0, 0, fmt.Errorf("MaxPartitionsContributed is %d, must be unset or 1 with EventLevel since each contribution is its own privacy unit", maxPartitionsContributed)
+		}
+		if maxContributionsPerPartition != 0 && maxContributionsPerPartition != 1 {
+			return 0, 0, fmt.Errorf("MaxContributionsPerPartition is %d, must be unset or 1 with EventLevel since each contribution is its own privacy unit", maxContributionsPerPartition)
+		}
+		return 1, 1, nil
+	}
+	return 0, 0, fmt.Errorf("unknown PrivacyLevel %v", l)
+}
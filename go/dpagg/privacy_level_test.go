@@ -0,0 +1,120 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventLevelContributionBounds(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		new     func() error
+		wantErr bool
+	}{
+		{"Count", func() error {
+			_, err := NewCount(&CountOptions{Epsilon: ln3, PrivacyLevel: EventLevel})
+			return err
+		}, false},
+		{"Count with MaxPartitionsContributed = 3", func() error {
+			_, err := NewCount(&CountOptions{Epsilon: ln3, MaxPartitionsContributed: 3, PrivacyLevel: EventLevel})
+			return err
+		}, true},
+		{"BoundedMeanFloat64 without MaxContributionsPerPartition", func() error {
+			_, err := NewBoundedMeanFloat64(&BoundedMeanFloat64Options{Epsilon: ln3, Lower: 0, Upper: 1, PrivacyLevel: EventLevel})
+			return err
+		}, false},
+		{"BoundedQuantiles with MaxContributionsPerPartition = 2", func() error {
+			_, err := NewBoundedQuantiles(&BoundedQuantilesOptions{Epsilon: ln3, MaxContributionsPerPartition: 2, Lower: 0, Upper: 1, PrivacyLevel: EventLevel})
+			return err
+		}, true},
+		{"unknown PrivacyLevel", func() error {
+			_, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Lower: 0, Upper: 1, PrivacyLevel: -1})
+			return err
+		}, true},
+	} {
+		if err := tc.new(); (err != nil) != tc.wantErr {
+			t.Errorf("With EventLevel and %s, got error %v, want error %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEventLevelSensitivity(t *testing.T) {
+	bv, err := NewBoundedVariance(&BoundedVarianceOptions{Epsilon: ln3, Lower: 0, Upper: 10, PrivacyLevel: EventLevel})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedVariance: %v", err)
+	}
+	p := bv.Parameters()
+	if p.MaxPartitionsContributed != 1 {
+		t.Errorf("Parameters: with EventLevel got MaxPartitionsContributed %d, want 1", p.MaxPartitionsContributed)
+	}
+	// Each privacy unit contributes a single value, whose distance to the
+	// midpoint is at most 5.
+	if sum := p.Components[1]; sum.LInfSensitivity != 5 {
+		t.Errorf("Parameters: with EventLevel got L∞ sensitivity %g for the normalized sum, want 5", sum.LInfSensitivity)
+	}
+}
+
+func TestKeyedAggregationEventLevel(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *Count]{
+		New:              newNoiselessCountForKey(1),
+		PublicPartitions: []string{"a", "b"},
+		PrivacyLevel:     EventLevel,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	// With EventLevel, the privacy ID is ignored, and all contributions are kept.
+	for i := 0; i < 10; i++ {
+		if err := ka.Add("user", "a", increment); err != nil {
+			t.Fatalf("Couldn't add contribution: %v", err)
+		}
+	}
+	ka.Add("user", "b", increment)
+	if err := ka.Remove("user"); err == nil {
+		t.Errorf("Remove: with EventLevel got no error, want error")
+	}
+	result, err := ka.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	got := make(map[string]int64)
+	for key, c := range result {
+		if got[key], err = c.Result(); err != nil {
+			t.Fatalf("Result of key %q: got error %v", key, err)
+		}
+	}
+	want := map[string]int64{"a": 10, "b": 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuilderEventLevel(t *testing.T) {
+	b := NewBuilder().Epsilon(ln3).Bounds(0, 10).PrivacyLevel(EventLevel)
+	if _, err := b.BoundedQuantiles(); err != nil {
+		t.Errorf("BoundedQuantiles: with EventLevel and no MaxContributionsPerPartition got error %v", err)
+	}
+	if _, err := b.MaxPartitionsContributed(2).BoundedMeanFloat64(); err == nil {
+		t.Errorf("BoundedMeanFloat64: with EventLevel and MaxPartitionsContributed = 2 got no error, want error")
+	}
+	if _, err := NewBuilder().Epsilon(1).Delta(0.1).PrivacyLevel(EventLevel).PreAggSelectPartition(); err == nil {
+		t.Errorf("PreAggSelectPartition: with PrivacyLevel set got no error, want error")
+	}
+}
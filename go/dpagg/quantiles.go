@@ -21,6 +21,7 @@ import (
 	"math"
 
 	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/metrics"
 	"github.com/google/differential-privacy/go/noise"
 )
 
@@ -58,6 +59,7 @@ type BoundedQuantiles struct {
 	delta           float64
 	lower           float64
 	upper           float64
+	clamper         Clamper
 	treeHeight      int
 	branchingFactor int
 	l0Sensitivity   int64
@@ -81,12 +83,21 @@ type BoundedQuantilesOptions struct {
 	MaxContributionsPerPartition int64   // How many times may a single user contribute to a single partition? Required.
 	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower < Upper.
 	Lower, Upper float64
-	Noise        noise.Noise // Type of noise used in BoundedSum. Defaults to Laplace noise.
+	Noise        noise.Noise // Type of noise used in BoundedSum. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+	// Transform used to bound contributions to [Lower, Upper]. Defaults to hard
+	// clamping; see Clamper.
+	Clamper Clamper
 	// It is not recommended to set TreeHeight and BranchingFactor since they require
 	// implementation-specific insight to modify and they only apply to QuantileTree
 	// algorithm, which might become obsolote if another algorithm is used.
 	TreeHeight      int // Height of the QuantileTree. Defaults to defaultTreeHeight.
 	BranchingFactor int // Number of children of every non-leaf node. Defaults to defaultBranchingFactor.
+	// What is protected by differential privacy, see PrivacyLevel. Defaults to
+	// UserLevel.
+	PrivacyLevel PrivacyLevel
 }
 
 // NewBoundedQuantiles returns a new BoundedQuantiles.
@@ -95,25 +106,24 @@ func NewBoundedQuantiles(opt *BoundedQuantilesOptions) (*BoundedQuantiles, error
 		opt = &BoundedQuantilesOptions{}
 	}
 
-	maxContributionsPerPartition := opt.MaxContributionsPerPartition
+	maxPartitionsContributed, maxContributionsPerPartition, err := opt.PrivacyLevel.contributionBounds(opt.MaxPartitionsContributed, opt.MaxContributionsPerPartition)
+	if err != nil {
+		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
+	}
 	if err := checks.CheckMaxContributionsPerPartition(maxContributionsPerPartition); err != nil {
 		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
 	}
 
 	// Set defaults.
-	maxPartitionsContributed := opt.MaxPartitionsContributed
 	if maxPartitionsContributed == 0 {
 		maxPartitionsContributed = 1
 	}
 
-	n := opt.Noise
-	if n == nil {
-		n = noise.Laplace()
-	}
+	n := noiseOrDefault(opt.Noise, opt.Rho)
 	// Check bounds.
 	lower, upper := opt.Lower, opt.Upper
-	if lower == 0 && upper == 0 {
-		return nil, fmt.Errorf("NewBoundedQuantiles requires a non-default value for Lower and Upper (automatic bounds determination is not implemented yet). Lower and Upper cannot be both 0")
+	if err := checks.CheckBoundsNotDefault(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
 	}
 	if err := checks.CheckBoundsFloat64(lower, upper); err != nil {
 		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
@@ -128,20 +138,23 @@ func NewBoundedQuantiles(opt *BoundedQuantilesOptions) (*BoundedQuantiles, error
 		treeHeight = DefaultTreeHeight
 	}
 	if err := checks.CheckTreeHeight(treeHeight); err != nil {
-		return nil, fmt.Errorf("NewBoundedQuantiles: %v", err)
+		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
 	}
 	branchingFactor := opt.BranchingFactor
 	if branchingFactor == 0 {
 		branchingFactor = DefaultBranchingFactor
 	}
 	if err := checks.CheckBranchingFactor(branchingFactor); err != nil {
-		return nil, fmt.Errorf("NewBoundedQuantiles: %v", err)
+		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
 	}
 	numNodes := getNumNodes(treeHeight, branchingFactor)
 	numLeaves := getNumLeaves(treeHeight, branchingFactor)
 	// The following assumes that nodes are indexed in a breadth first fashion from left to right.
 	leftmostLeafIndex := numNodes - numLeaves
-	eps, del := opt.Epsilon, opt.Delta
+	eps, del, err := budgetFromRho(opt.Epsilon, opt.Delta, opt.Rho, n)
+	if err != nil {
+		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
+	}
 
 	// The l_1 sensitivty of a privacy unit's contribution is
 	//    treeHeight * maxPartitionsContributed * maxContributionsPerPartition
@@ -155,16 +168,18 @@ func NewBoundedQuantiles(opt *BoundedQuantilesOptions) (*BoundedQuantiles, error
 
 	// Check that the parameters are compatible with the noise chosen by calling
 	// the noise on some placeholder value.
-	_, err := n.AddNoiseFloat64(0, l0Sensitivity, lInfSensitivity, eps, del)
+	_, err = n.AddNoiseFloat64(0, l0Sensitivity, lInfSensitivity, eps, del)
 	if err != nil {
 		return nil, fmt.Errorf("NewBoundedQuantiles: %w", err)
 	}
 
+	metrics.Default().AggregationCreated("BoundedQuantiles")
 	return &BoundedQuantiles{
 		epsilon:           eps,
 		delta:             del,
 		lower:             lower,
 		upper:             upper,
+		clamper:           opt.Clamper,
 		treeHeight:        treeHeight,
 		branchingFactor:   branchingFactor,
 		l0Sensitivity:     l0Sensitivity,
@@ -183,12 +198,12 @@ func NewBoundedQuantiles(opt *BoundedQuantilesOptions) (*BoundedQuantiles, error
 // contribution to the final result is not well defined.
 func (bq *BoundedQuantiles) Add(e float64) error {
 	if bq.state != defaultState {
-		return fmt.Errorf("BoundedQuantiles cannot be amended: %v", bq.state.errorMessage())
+		return fmt.Errorf("BoundedQuantiles cannot be amended: %w", bq.state.transitionError(defaultState))
 	}
 	if !math.IsNaN(e) {
 		// Increment all counts on the path from the leaf node where the value is inserted up to the
 		// first level (root not included).
-		clamped, err := ClampFloat64(e, bq.lower, bq.upper)
+		clamped, err := clampWith(bq.clamper, e, bq.lower, bq.upper)
 		if err != nil {
 			return fmt.Errorf("couldn't clamp input value %f, err %w", e, err)
 		}
@@ -213,7 +228,11 @@ func (bq *BoundedQuantiles) Add(e float64) error {
 // Note that the returned values is not an unbiased estimate of the raw bounded quantile.
 func (bq *BoundedQuantiles) Result(rank float64) (float64, error) {
 	if bq.state != defaultState && bq.state != resultReturned {
-		return 0, fmt.Errorf("BoundedQuantiles' noised result cannot be computed: %v", bq.state.errorMessage())
+		return 0, fmt.Errorf("BoundedQuantiles' noised result cannot be computed: %w", bq.state.transitionError(resultReturned))
+	}
+	if bq.state == defaultState {
+		// The budget is only paid on the first invocation.
+		metrics.Default().BudgetConsumed(mechanismName(bq.noiseKind), bq.epsilon, bq.delta)
 	}
 	bq.state = resultReturned
 
@@ -357,6 +376,16 @@ func getNumLeaves(treeHeight, branchingFactor int) int {
 	return int(math.Pow(float64(branchingFactor), float64(treeHeight)))
 }
 
+// Reset returns bq to the state it had when it was initialized, discarding all
+// entries and any result, including the noised tree from which quantiles are
+// computed. Like Count.Reset, it starts a new expenditure of the privacy budget
+// of bq.
+func (bq *BoundedQuantiles) Reset() {
+	bq.tree = make(map[int]int64)
+	bq.noisedTree = make(map[int]float64)
+	bq.state = defaultState
+}
+
 // Merge merges bq2 into bq (i.e., adds to bq all entries that were added to
 // bq2). bq2 is consumed by this operation: bq2 may not be used after it is
 // merged into bq.
@@ -374,30 +403,49 @@ func (bq *BoundedQuantiles) Merge(bq2 *BoundedQuantiles) error {
 
 func checkMergeBoundedQuantiles(bq1, bq2 *BoundedQuantiles) error {
 	if bq1.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedQuantiles: bq1 cannot be merged with another BoundedQuantiles instance: %v", bq1.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedQuantiles: bq1 cannot be merged with another BoundedQuantiles instance: %w", bq1.state.transitionError(merged))
 	}
 	if bq2.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedQuantiles: bq2 cannot be merged with another BoundedQuantiles instance: %v", bq2.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedQuantiles: bq2 cannot be merged with another BoundedQuantiles instance: %w", bq2.state.transitionError(merged))
 	}
 
-	if !bqEquallyInitialized(bq1, bq2) {
-		return fmt.Errorf("checkMergeBoundedQuantiles: bq1 and bq2 are not compatible")
+	if field := bqIncompatibleField(bq1, bq2); field != "" {
+		return fmt.Errorf("checkMergeBoundedQuantiles: bq1 and bq2 are not compatible: %w", &IncompatibleMergeError{Field: field})
 	}
 
 	return nil
 }
 
 func bqEquallyInitialized(bq1, bq2 *BoundedQuantiles) bool {
-	return bq1.epsilon == bq2.epsilon &&
-		bq1.delta == bq2.delta &&
-		bq1.l0Sensitivity == bq2.l0Sensitivity &&
-		bq1.lInfSensitivity == bq2.lInfSensitivity &&
-		bq1.lower == bq2.lower &&
-		bq1.upper == bq2.upper &&
-		bq1.treeHeight == bq2.treeHeight &&
-		bq1.branchingFactor == bq2.branchingFactor &&
-		bq1.noiseKind == bq2.noiseKind &&
-		bq1.state == bq2.state
+	return bqIncompatibleField(bq1, bq2) == ""
+}
+
+// bqIncompatibleField returns the name of the first option with which bq1 and
+// bq2 were initialized differently, or "" if they were initialized equally.
+func bqIncompatibleField(bq1, bq2 *BoundedQuantiles) string {
+	switch {
+	case bq1.epsilon != bq2.epsilon:
+		return "Epsilon"
+	case bq1.delta != bq2.delta:
+		return "Delta"
+	case bq1.l0Sensitivity != bq2.l0Sensitivity:
+		return "MaxPartitionsContributed"
+	case bq1.lInfSensitivity != bq2.lInfSensitivity:
+		return "MaxContributionsPerPartition"
+	case bq1.lower != bq2.lower:
+		return "Lower"
+	case bq1.upper != bq2.upper:
+		return "Upper"
+	case bq1.treeHeight != bq2.treeHeight:
+		return "TreeHeight"
+	case bq1.branchingFactor != bq2.branchingFactor:
+		return "BranchingFactor"
+	case bq1.noiseKind != bq2.noiseKind:
+		return "Noise"
+	case bq1.state != bq2.state:
+		return "state"
+	}
+	return ""
 }
 
 // encodableBoundedQuantiles can be encoded by the gob package.
@@ -419,7 +467,7 @@ type encodableBoundedQuantiles struct {
 // GobEncode encodes BoundedQuantiles.
 func (bq *BoundedQuantiles) GobEncode() ([]byte, error) {
 	if bq.state != defaultState && bq.state != serialized {
-		return nil, fmt.Errorf("BoundedQuantiles object cannot be serialized: " + bq.state.errorMessage())
+		return nil, fmt.Errorf("BoundedQuantiles object cannot be serialized: %w", bq.state.transitionError(serialized))
 	}
 	enc := encodableBoundedQuantiles{
 		Epsilon:           bq.epsilon,
@@ -465,3 +513,174 @@ func (bq *BoundedQuantiles) GobDecode(data []byte) error {
 	}
 	return nil
 }
+
+type jsonBoundedQuantilesParameters struct {
+	jsonPrivacyParameters
+	LInfSensitivity   float64 `json:"l_inf_sensitivity"`
+	TreeHeight        int     `json:"tree_height"`
+	BranchingFactor   int     `json:"branching_factor"`
+	Lower             float64 `json:"lower"`
+	Upper             float64 `json:"upper"`
+	NumLeaves         int     `json:"num_leaves"`
+	LeftmostLeafIndex int     `json:"leftmost_leaf_index"`
+}
+
+type jsonBoundedQuantilesState struct {
+	// Counts of the nodes of the quantile tree, by index of the node.
+	Tree map[int]int64 `json:"tree"`
+}
+
+// MarshalJSON returns the JSON summary of bq, see json_summary.go. Like
+// GobEncode, it consumes bq: it may not be amended, merged or queried
+// afterwards.
+func (bq *BoundedQuantiles) MarshalJSON() ([]byte, error) {
+	if bq.state != defaultState && bq.state != serialized {
+		return nil, fmt.Errorf("BoundedQuantiles object cannot be serialized: %w", bq.state.transitionError(serialized))
+	}
+	params := jsonBoundedQuantilesParameters{
+		jsonPrivacyParameters: jsonPrivacyParameters{
+			Epsilon:                  bq.epsilon,
+			Delta:                    bq.delta,
+			MaxPartitionsContributed: bq.l0Sensitivity,
+			Noise:                    jsonNoiseKind(noise.ToKind(bq.Noise)),
+		},
+		LInfSensitivity:   bq.lInfSensitivity,
+		TreeHeight:        bq.treeHeight,
+		BranchingFactor:   bq.branchingFactor,
+		Lower:             bq.lower,
+		Upper:             bq.upper,
+		NumLeaves:         bq.numLeaves,
+		LeftmostLeafIndex: bq.leftmostLeafIndex,
+	}
+	bq.state = serialized
+	return marshalJSONSummary("BoundedQuantiles", params, jsonBoundedQuantilesState{Tree: bq.tree})
+}
+
+// UnmarshalJSON loads the JSON summary of a BoundedQuantiles into bq.
+func (bq *BoundedQuantiles) UnmarshalJSON(data []byte) error {
+	var params jsonBoundedQuantilesParameters
+	var state jsonBoundedQuantilesState
+	if err := unmarshalJSONSummary(data, "BoundedQuantiles", &params, &state); err != nil {
+		return fmt.Errorf("couldn't decode BoundedQuantiles from JSON: %w", err)
+	}
+	if state.Tree == nil {
+		state.Tree = make(map[int]int64)
+	}
+	kind := noise.Kind(params.Noise)
+	*bq = BoundedQuantiles{
+		epsilon:           params.Epsilon,
+		delta:             params.Delta,
+		l0Sensitivity:     params.MaxPartitionsContributed,
+		lInfSensitivity:   params.LInfSensitivity,
+		treeHeight:        params.TreeHeight,
+		branchingFactor:   params.BranchingFactor,
+		lower:             params.Lower,
+		upper:             params.Upper,
+		noiseKind:         kind,
+		Noise:             noise.ToNoise(kind),
+		numLeaves:         params.NumLeaves,
+		leftmostLeafIndex: params.LeftmostLeafIndex,
+		tree:              state.Tree,
+		noisedTree:        make(map[int]float64),
+		state:             defaultState,
+	}
+	return nil
+}
+
+// Serialize returns the partial aggregate of bq as a serialized
+// BoundedQuantilesSummary protobuf message (see proto/summary.proto). This is
+// the format used by the C++ and Java libraries, so the summary can be merged
+// into bounded quantiles of these libraries, or loaded into a BoundedQuantiles
+// with Deserialize.
+//
+// Like GobEncode, Serialize consumes bq: it may not be amended, merged or
+// queried afterwards.
+func (bq *BoundedQuantiles) Serialize() ([]byte, error) {
+	if bq.state != defaultState && bq.state != serialized {
+		return nil, fmt.Errorf("BoundedQuantiles object cannot be serialized: %w", bq.state.transitionError(serialized))
+	}
+	s, err := bq.summary()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedQuantiles object cannot be serialized: %w", err)
+	}
+	for index, count := range bq.tree {
+		i, err := toInt32("tree index", int64(index))
+		if err != nil {
+			return nil, fmt.Errorf("BoundedQuantiles object cannot be serialized: %w", err)
+		}
+		s.quantileTree[i] = count
+	}
+	bq.state = serialized
+	return s.marshal(), nil
+}
+
+// Deserialize merges a serialized BoundedQuantilesSummary protobuf message into
+// bq, adding its quantile tree to the one accumulated so far, like Merge. The
+// summary may have been produced by Serialize or by the C++ or Java libraries.
+//
+// bq must have been initialized with the same parameters as the aggregation
+// that produced the summary, and may not have been merged, serialized or
+// queried.
+func (bq *BoundedQuantiles) Deserialize(data []byte) error {
+	if bq.state != defaultState {
+		return fmt.Errorf("BoundedQuantiles object cannot be deserialized: %w", bq.state.transitionError(defaultState))
+	}
+	var s boundedQuantilesSummary
+	if err := s.unmarshal(data); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedQuantiles: %w", err)
+	}
+	want, err := bq.summary()
+	if err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedQuantiles: %w", err)
+	}
+	if err := s.checkParameters(want); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedQuantiles, summary is not compatible: %w", err)
+	}
+	numNodes := bq.leftmostLeafIndex + bq.numLeaves
+	// The whole tree is checked before merging it, so that bq is left unchanged
+	// on errors.
+	for index := range s.quantileTree {
+		if index < 0 || int(index) >= numNodes {
+			return fmt.Errorf("couldn't deserialize BoundedQuantiles: tree index %d is out of range [0, %d)", index, numNodes)
+		}
+	}
+	for index, count := range s.quantileTree {
+		bq.tree[int(index)] += count
+	}
+	return nil
+}
+
+// summary returns the parameters of bq as a BoundedQuantilesSummary, with an
+// empty quantile tree.
+func (bq *BoundedQuantiles) summary() (*boundedQuantilesSummary, error) {
+	// The l_0 sensitivity is treeHeight * maxPartitionsContributed, and the
+	// l_inf sensitivity is maxContributionsPerPartition, see NewBoundedQuantiles.
+	l0, err := toInt32("MaxPartitionsContributed", bq.l0Sensitivity/int64(bq.treeHeight))
+	if err != nil {
+		return nil, err
+	}
+	lInf, err := toInt32("MaxContributionsPerPartition", int64(bq.lInfSensitivity))
+	if err != nil {
+		return nil, err
+	}
+	treeHeight, err := toInt32("TreeHeight", int64(bq.treeHeight))
+	if err != nil {
+		return nil, err
+	}
+	branchingFactor, err := toInt32("BranchingFactor", int64(bq.branchingFactor))
+	if err != nil {
+		return nil, err
+	}
+	return &boundedQuantilesSummary{
+		quantileTree:                 make(map[int32]int64),
+		epsilon:                      bq.epsilon,
+		delta:                        bq.delta,
+		mechanismType:                toMechanismType(bq.noiseKind),
+		lower:                        bq.lower,
+		upper:                        bq.upper,
+		maxPartitionsContributed:     l0,
+		maxContributionsPerPartition: lInf,
+		treeHeight:                   treeHeight,
+		branchingFactor:              branchingFactor,
+	}, nil
+}
@@ -1038,3 +1038,62 @@ func compareBoundedQuantiles(bq1, bq2 *BoundedQuantiles) bool {
 		reflect.DeepEqual(bq1.noisedTree, bq2.noisedTree) &&
 		bq1.state == bq2.state
 }
+
+func TestBQReset(t *testing.T) {
+	bq := getNoiselessBQ(t, 0, 10)
+	for i := 0; i < 100; i++ {
+		bq.Add(2)
+	}
+	if _, err := bq.Result(0.5); err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	bq.Reset()
+	for i := 0; i < 100; i++ {
+		bq.Add(8)
+	}
+	got, err := bq.Result(0.5)
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result after Reset: %v", err)
+	}
+	if math.Abs(got-8) > 0.01 {
+		t.Errorf("Result(0.5) after Reset: got %f, want 8", got)
+	}
+}
+
+// Tests that a BoundedQuantiles decoded on another worker can be merged with
+// local quantiles.
+func TestBQSerializeShipMerge(t *testing.T) {
+	shipped := getNoiselessBQ(t, 0, 10)
+	for i := 0; i < 100; i++ {
+		shipped.Add(8)
+	}
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode(BoundedQuantiles) error: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode(BoundedQuantiles) error: %v", err)
+	}
+	received := new(BoundedQuantiles)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode(BoundedQuantiles) error: %v", err)
+	}
+	local := getNoiselessBQ(t, 0, 10)
+	for i := 0; i < 300; i++ {
+		local.Add(2)
+	}
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded BoundedQuantiles: got error %v", err)
+	}
+	// Since the noise of getNoiselessBQ isn't serialized, use it again on the
+	// received aggregation.
+	received.Noise = noNoise{}
+	got, err := received.Result(0.9)
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result after merging a decoded BoundedQuantiles: %v", err)
+	}
+	if math.Abs(got-8) > 0.01 {
+		t.Errorf("Result(0.9) after merging a decoded BoundedQuantiles: got %f, want 8", got)
+	}
+}
@@ -0,0 +1,303 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// RangeHistogram answers arbitrary range counts over a histogram with a fixed
+// number of ordered buckets, e.g. ages or timestamps, by noising the counts of
+// the nodes of a binary tree over the buckets, each node covering a range of
+// consecutive buckets, as in Hay et al.'s "Boosting the Accuracy of
+// Differentially Private Histograms Through Consistency"
+// (https://arxiv.org/abs/0904.0942). Any range is covered by a logarithmic
+// number of nodes, so its noise doesn't grow linearly with its width.
+//
+// The noisy counts are then made consistent by post-processing, which doesn't
+// consume privacy budget: the count of each node is combined with the counts
+// of its descendants into the least squares estimate, and adjusted so that the
+// counts are non-negative and the count of each node is the sum of the counts
+// of its children. The answers to all the range queries are derived from the
+// resulting bucket counts, so they are consistent with each other.
+//
+// The buckets are part of the parameters, so their number must not depend on
+// the data.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type RangeHistogram struct {
+	// Parameters
+	epsilon float64
+	delta   float64
+	// Sensitivity passed to Noise for each node: a contribution to a bucket
+	// changes the count of one node per level of the tree.
+	l0Sensitivity   int64
+	lInfSensitivity int64
+	leaves          int // Number of leaves of the tree, the smallest power of 2 that is at least the number of buckets.
+	Noise           noise.Noise
+
+	// State variables
+	counts []int64
+	state  aggregationState
+}
+
+// RangeHistogramOptions contains the options necessary to initialize a
+// RangeHistogram.
+type RangeHistogramOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// Number of buckets of the histogram. Required.
+	Buckets int
+	// How many distinct buckets may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single bucket? Defaults to 1.
+	MaxContributionsPerPartition int64
+	Noise                        noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewRangeHistogram returns a new RangeHistogram, with the count of each
+// bucket initialized at 0.
+func NewRangeHistogram(opt *RangeHistogramOptions) (*RangeHistogram, error) {
+	if opt == nil {
+		opt = &RangeHistogramOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	// Check the parameters.
+	if opt.Buckets <= 0 {
+		return nil, fmt.Errorf("NewRangeHistogram: Buckets is %d, must be strictly positive", opt.Buckets)
+	}
+	if l0 < 0 {
+		return nil, fmt.Errorf("NewRangeHistogram: MaxPartitionsContributed is %d, must be strictly positive", l0)
+	}
+	if lInf < 0 {
+		return nil, fmt.Errorf("NewRangeHistogram: MaxContributionsPerPartition is %d, must be strictly positive", lInf)
+	}
+	leaves, levels := 1, int64(1)
+	for leaves < opt.Buckets {
+		leaves *= 2
+		levels++
+	}
+	if l0 > math.MaxInt64/levels {
+		return nil, fmt.Errorf("NewRangeHistogram: MaxPartitionsContributed = %d is too high for %d buckets", l0, opt.Buckets)
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, l0*levels, lInf, opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewRangeHistogram: %w", err)
+	}
+
+	return &RangeHistogram{
+		epsilon:         opt.Epsilon,
+		delta:           opt.Delta,
+		l0Sensitivity:   l0 * levels,
+		lInfSensitivity: lInf,
+		leaves:          leaves,
+		Noise:           n,
+		counts:          make([]int64, opt.Buckets),
+		state:           defaultState,
+	}, nil
+}
+
+// Add increments the count of the given bucket by one.
+func (rh *RangeHistogram) Add(bucket int) error {
+	return rh.AddBy(bucket, 1)
+}
+
+// AddBy increments the count of the given bucket by the given value. Note that
+// the total contribution of a privacy unit to a single bucket must not exceed
+// MaxContributionsPerPartition, and that a privacy unit must not contribute to
+// more than MaxPartitionsContributed buckets.
+func (rh *RangeHistogram) AddBy(bucket int, count int64) error {
+	if rh.state != defaultState {
+		return fmt.Errorf("RangeHistogram cannot be amended: %w", rh.state.transitionError(defaultState))
+	}
+	if bucket < 0 || bucket >= len(rh.counts) {
+		return fmt.Errorf("RangeHistogram: bucket is %d, must be in [0, %d]", bucket, len(rh.counts)-1)
+	}
+	rh.counts[bucket] += count
+	return nil
+}
+
+// Merge merges rh2 into rh, summing up the counts of their buckets. The two
+// histograms must have been initialized with the same parameters.
+//
+// rh2 is consumed by this operation: it may not be used after it is merged
+// into rh.
+func (rh *RangeHistogram) Merge(rh2 *RangeHistogram) error {
+	if err := checkMergeRangeHistogram(rh, rh2); err != nil {
+		return err
+	}
+	for b, count := range rh2.counts {
+		rh.counts[b] += count
+	}
+	rh2.state = merged
+	return nil
+}
+
+func checkMergeRangeHistogram(rh1, rh2 *RangeHistogram) error {
+	if rh1.state != defaultState {
+		return fmt.Errorf("checkMergeRangeHistogram: rh1 cannot be merged with another RangeHistogram instance: %w", rh1.state.transitionError(merged))
+	}
+	if rh2.state != defaultState {
+		return fmt.Errorf("checkMergeRangeHistogram: rh2 cannot be merged with another RangeHistogram instance: %w", rh2.state.transitionError(merged))
+	}
+
+	if rh1.epsilon != rh2.epsilon ||
+		rh1.delta != rh2.delta ||
+		rh1.l0Sensitivity != rh2.l0Sensitivity ||
+		rh1.lInfSensitivity != rh2.lInfSensitivity ||
+		len(rh1.counts) != len(rh2.counts) ||
+		noise.ToKind(rh1.Noise) != noise.ToKind(rh2.Noise) {
+		return fmt.Errorf("checkMergeRangeHistogram: rh1 and rh2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+
+	return nil
+}
+
+// Result returns the consistent noisy counts of the buckets, from which the
+// answers to range queries are derived. The method can be called only once.
+func (rh *RangeHistogram) Result() (*RangeHistogramResult, error) {
+	if rh.state != defaultState {
+		return nil, fmt.Errorf("RangeHistogram's noised result cannot be computed: %w", rh.state.transitionError(resultReturned))
+	}
+	rh.state = resultReturned
+
+	// The nodes are stored as a heap: the children of node i are nodes 2i+1
+	// and 2i+2, and the leaves are the last rh.leaves nodes. The leaves beyond
+	// the buckets, and the nodes only covering such leaves, are known to have a
+	// count of 0, so they aren't noised.
+	numNodes := 2*rh.leaves - 1
+	firstLeaf := rh.leaves - 1
+	counts := make([]int64, numNodes)
+	copy(counts[firstLeaf:], rh.counts)
+	for i := firstLeaf - 1; i >= 0; i-- {
+		counts[i] = counts[2*i+1] + counts[2*i+2]
+	}
+	// isPadding returns whether node i only covers leaves beyond the buckets,
+	// i.e. whether its leftmost leaf is beyond the buckets.
+	isPadding := func(i int) bool {
+		for i < firstLeaf {
+			i = 2*i + 1
+		}
+		return i-firstLeaf >= len(rh.counts)
+	}
+
+	// Bottom-up, estimate the count of each node by combining its noisy count
+	// with the sum of the estimates of its children, weighting both by the
+	// inverse of their variance. variances is relative to the variance of the
+	// noise of a single node.
+	estimates := make([]float64, numNodes)
+	variances := make([]float64, numNodes)
+	for i := numNodes - 1; i >= 0; i-- {
+		if isPadding(i) {
+			continue
+		}
+		noised, err := rh.Noise.AddNoiseInt64(counts[i], rh.l0Sensitivity, rh.lInfSensitivity, rh.epsilon, rh.delta)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of node %d: %w", i, err)
+		}
+		if i >= firstLeaf {
+			estimates[i], variances[i] = float64(noised), 1
+			continue
+		}
+		childrenSum := estimates[2*i+1] + estimates[2*i+2]
+		childrenVariance := variances[2*i+1] + variances[2*i+2]
+		estimates[i] = (float64(noised)*childrenVariance + childrenSum) / (childrenVariance + 1)
+		variances[i] = childrenVariance / (childrenVariance + 1)
+	}
+	// Top-down, split the difference between the count of each node and the
+	// sum of the estimates of its children between them proportionally to
+	// their variance, which gives the least squares counts, then make the
+	// counts of the children non-negative while keeping their sum.
+	consistent := make([]float64, numNodes)
+	consistent[0] = math.Max(0, estimates[0])
+	for i := 0; i < firstLeaf; i++ {
+		left, right := 2*i+1, 2*i+2
+		if variances[right] == 0 {
+			// The right child only covers padding leaves.
+			consistent[left] = consistent[i]
+			continue
+		}
+		diff := consistent[i] - estimates[left] - estimates[right]
+		consistent[left] = estimates[left] + diff*variances[left]/(variances[left]+variances[right])
+		consistent[right] = consistent[i] - consistent[left]
+		if consistent[left] < 0 {
+			consistent[left], consistent[right] = 0, consistent[i]
+		} else if consistent[right] < 0 {
+			consistent[left], consistent[right] = consistent[i], 0
+		}
+	}
+
+	result := &RangeHistogramResult{cumulative: make([]float64, len(rh.counts)+1)}
+	for b := range rh.counts {
+		result.cumulative[b+1] = result.cumulative[b] + consistent[firstLeaf+b]
+	}
+	return result, nil
+}
+
+// RangeHistogramResult contains the consistent noisy counts released by
+// RangeHistogram. Computing answers from it is post-processing, so it can be
+// queried any number of times.
+type RangeHistogramResult struct {
+	// Cumulative counts: cumulative[b] is the total count of the buckets
+	// before bucket b.
+	cumulative []float64
+}
+
+// Counts returns the noisy count of each bucket. The counts are non-negative,
+// but may be fractional.
+func (r *RangeHistogramResult) Counts() []float64 {
+	counts := make([]float64, len(r.cumulative)-1)
+	for b := range counts {
+		counts[b] = r.cumulative[b+1] - r.cumulative[b]
+	}
+	return counts
+}
+
+// Total returns the noisy total count of the buckets.
+func (r *RangeHistogramResult) Total() float64 {
+	return r.cumulative[len(r.cumulative)-1]
+}
+
+// Answer returns the noisy answer to the given query, i.e. the total count of
+// the buckets from q.Lower to q.Upper, both included.
+func (r *RangeHistogramResult) Answer(q HistogramQuery) (float64, error) {
+	buckets := len(r.cumulative) - 1
+	if q.Lower < 0 || q.Lower > q.Upper || q.Upper >= buckets {
+		return 0, fmt.Errorf("RangeHistogramResult: query is [%d, %d], must be a non-empty range of buckets in [0, %d]", q.Lower, q.Upper, buckets-1)
+	}
+	return r.cumulative[q.Upper+1] - r.cumulative[q.Lower], nil
+}
@@ -0,0 +1,223 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewRangeHistogramInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *RangeHistogramOptions
+	}{
+		{"nil options", nil},
+		{"no Buckets", &RangeHistogramOptions{Epsilon: ln3}},
+		{"no Epsilon", &RangeHistogramOptions{Buckets: 3}},
+		{"negative MaxPartitionsContributed", &RangeHistogramOptions{Epsilon: ln3, Buckets: 3, MaxPartitionsContributed: -1}},
+		{"negative MaxContributionsPerPartition", &RangeHistogramOptions{Epsilon: ln3, Buckets: 3, MaxContributionsPerPartition: -1}},
+		{"MaxPartitionsContributed overflowing with the levels of the tree", &RangeHistogramOptions{Epsilon: ln3, Buckets: 3, MaxPartitionsContributed: math.MaxInt64}},
+		{"Delta with Laplace noise", &RangeHistogramOptions{Epsilon: ln3, Delta: 1e-5, Buckets: 3}},
+		{"no Delta with Gaussian noise", &RangeHistogramOptions{Epsilon: ln3, Buckets: 3, Noise: noise.Gaussian()}},
+	} {
+		if _, err := NewRangeHistogram(tc.opt); err == nil {
+			t.Errorf("NewRangeHistogram with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestRangeHistogramResult(t *testing.T) {
+	// 5 buckets, so the tree has 3 padding leaves.
+	counts := []int64{3, 0, 5, 2, 7}
+	rh, err := NewRangeHistogram(&RangeHistogramOptions{Epsilon: ln3, Buckets: len(counts), Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize RangeHistogram: %v", err)
+	}
+	for b, c := range counts {
+		if err := rh.AddBy(b, c); err != nil {
+			t.Fatalf("AddBy(%d, %d): got error %v", b, c, err)
+		}
+	}
+	result, err := rh.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if diff := cmp.Diff([]float64{3, 0, 5, 2, 7}, result.Counts()); diff != "" {
+		t.Errorf("Counts: got diff (-want +got):\n%s", diff)
+	}
+	if got := result.Total(); got != 17 {
+		t.Errorf("Total: got %f, want 17", got)
+	}
+	for _, tc := range []struct {
+		q    HistogramQuery
+		want float64
+	}{
+		{BucketQuery(2), 5},
+		{CumulativeQuery(3), 10},
+		{RangeQuery(1, 4), 14},
+	} {
+		if got, err := result.Answer(tc.q); err != nil || got != tc.want {
+			t.Errorf("Answer(%v): got (%f, %v), want %f", tc.q, got, err, tc.want)
+		}
+	}
+	for _, q := range []HistogramQuery{RangeQuery(-1, 2), RangeQuery(3, 2), RangeQuery(2, 5)} {
+		if _, err := result.Answer(q); err == nil {
+			t.Errorf("Answer(%v): got no error, want error", q)
+		}
+	}
+	if _, err := rh.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := rh.Add(0); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
+
+// offsetNoise is a Noise instance that adds the given offsets to the values,
+// in order.
+type offsetNoise struct {
+	noise.Noise
+	offsets *[]int64
+}
+
+func (n offsetNoise) AddNoiseInt64(x, _, _ int64, _, _ float64) (int64, error) {
+	offset := (*n.offsets)[0]
+	*n.offsets = (*n.offsets)[1:]
+	return x + offset, nil
+}
+
+func TestRangeHistogramConsistency(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		counts []int64
+		// Offsets added to the count of the right leaf, the left leaf and the
+		// root, in this order.
+		offsets []int64
+		want    []float64
+	}{
+		// The noisy root is 2 and the leaves sum to 6. The least squares root
+		// is 10/3, since the sum of the leaves has twice the variance of the
+		// root, and the difference is split evenly between the leaves.
+		{"least squares", []int64{3, 1}, []int64{2, 0, -2}, []float64{5.0 / 3, 5.0 / 3}},
+		// The least squares counts of the leaves are -2 and 6, so the left one
+		// is set to 0, and the right one to the count of the root.
+		{"non-negativity", []int64{0, 5}, []int64{0, -3, 0}, []float64{0, 4}},
+		// Negative counts of the root are set to 0.
+		{"negative root", []int64{0, 0}, []int64{-1, -1, -1}, []float64{0, 0}},
+	} {
+		rh, err := NewRangeHistogram(&RangeHistogramOptions{Epsilon: ln3, Buckets: 2, Noise: noNoise{}})
+		if err != nil {
+			t.Fatalf("Couldn't initialize RangeHistogram for %s: %v", tc.desc, err)
+		}
+		rh.Noise = offsetNoise{offsets: &tc.offsets}
+		for b, c := range tc.counts {
+			rh.AddBy(b, c)
+		}
+		result, err := rh.Result()
+		if err != nil {
+			t.Fatalf("Result for %s: got error %v", tc.desc, err)
+		}
+		if diff := cmp.Diff(tc.want, result.Counts(), cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+			t.Errorf("Counts for %s: got diff (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
+func TestRangeHistogramConsistencyWithNoise(t *testing.T) {
+	// Most buckets are empty, so many noisy counts are negative.
+	rh, err := NewRangeHistogram(&RangeHistogramOptions{Epsilon: 0.1, Buckets: 100})
+	if err != nil {
+		t.Fatalf("Couldn't initialize RangeHistogram: %v", err)
+	}
+	rh.AddBy(42, 1000)
+	result, err := rh.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	var sum float64
+	for b, c := range result.Counts() {
+		if c < 0 {
+			t.Errorf("Counts: got %f for bucket %d, want non-negative count", c, b)
+		}
+		sum += c
+	}
+	if !ApproxEqual(sum, result.Total()) {
+		t.Errorf("Total: got %f, want the sum of the counts %f", result.Total(), sum)
+	}
+	lower, _ := result.Answer(RangeQuery(0, 41))
+	upper, _ := result.Answer(RangeQuery(42, 99))
+	if !ApproxEqual(lower+upper, result.Total()) {
+		t.Errorf("Answer: got %f and %f for the ranges splitting the buckets, want them to sum to the total %f", lower, upper, result.Total())
+	}
+}
+
+func TestRangeHistogramSensitivity(t *testing.T) {
+	// A contribution changes one node per level of the tree: with 5 buckets,
+	// the tree has 8 leaves, so 4 levels.
+	rh, err := NewRangeHistogram(&RangeHistogramOptions{Epsilon: ln3, Buckets: 5, MaxPartitionsContributed: 2, MaxContributionsPerPartition: 3})
+	if err != nil {
+		t.Fatalf("Couldn't initialize RangeHistogram: %v", err)
+	}
+	if rh.l0Sensitivity != 8 || rh.lInfSensitivity != 3 {
+		t.Errorf("NewRangeHistogram: got sensitivities (%d, %d), want (8, 3)", rh.l0Sensitivity, rh.lInfSensitivity)
+	}
+}
+
+func TestRangeHistogramMerge(t *testing.T) {
+	opts := &RangeHistogramOptions{Epsilon: ln3, Buckets: 3, Noise: noNoise{}}
+	rh1, err := NewRangeHistogram(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize rh1: %v", err)
+	}
+	rh2, err := NewRangeHistogram(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize rh2: %v", err)
+	}
+	rh1.AddBy(0, 4)
+	rh2.AddBy(0, 1)
+	rh2.AddBy(2, 3)
+	if err := rh1.Merge(rh2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	if err := rh2.Add(0); err == nil {
+		t.Errorf("Add on merged RangeHistogram: got no error, want error")
+	}
+	result, err := rh1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if diff := cmp.Diff([]float64{5, 0, 3}, result.Counts()); diff != "" {
+		t.Errorf("Counts: got diff (-want +got):\n%s", diff)
+	}
+
+	rh3, err := NewRangeHistogram(&RangeHistogramOptions{Epsilon: ln3, Buckets: 4, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize rh3: %v", err)
+	}
+	rh4, err := NewRangeHistogram(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize rh4: %v", err)
+	}
+	if err := rh3.Merge(rh4); err == nil {
+		t.Errorf("Merge with a different number of buckets: got no error, want error")
+	}
+}
@@ -0,0 +1,336 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// ReleaseStatus describes what a ReleaseLimiter did with a release.
+type ReleaseStatus int
+
+const (
+	// Released means that the noised value was released.
+	Released ReleaseStatus = iota
+	// Withheld means that the noised value changed too much compared to the
+	// previous release, and was not released.
+	Withheld
+	// FallbackReleased means that the noised value changed too much compared to
+	// the previous release, and a value noised with the fallback budget, i.e.
+	// with more noise, was released instead.
+	FallbackReleased
+)
+
+func (s ReleaseStatus) String() string {
+	switch s {
+	case Released:
+		return "Released"
+	case Withheld:
+		return "Withheld"
+	case FallbackReleased:
+		return "FallbackReleased"
+	}
+	return fmt.Sprintf("ReleaseStatus(%d)", int(s))
+}
+
+// ReleaseLimiter guards a recurring release of a value, e.g. a daily sum,
+// against accidental publication of the outputs of a broken pipeline. Each
+// release is noised, then compared to the previous published release: if the
+// change exceeds MaxChange times the standard deviation of the noise, the
+// release is withheld or, if a fallback budget is set, replaced by a release
+// with more noise.
+//
+// The comparison only uses the noised value and the previous published
+// release, so withholding doesn't cost any privacy budget on its own. However,
+// every call to Release spends (Epsilon, Delta), whether the release is
+// published or not, and a fallback release additionally spends
+// (FallbackEpsilon, FallbackDelta). The budget spent by each call is reported
+// in its ReleaseResult; accounting must use it rather than assume that
+// withheld releases are free.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type ReleaseLimiter struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	fallbackEpsilon float64
+	fallbackDelta   float64
+	l0Sensitivity   int64
+	lInfSensitivity float64
+	alpha           float64
+	// Standard deviations of the noise of regular and fallback releases.
+	stdDev, fallbackStdDev float64
+	// Largest allowed change, in absolute value, between two consecutive
+	// published releases.
+	maxChange float64
+	Noise     noise.Noise
+
+	// State variables
+	previous    float64
+	hasPrevious bool
+}
+
+// ReleaseLimiterOptions contains the options necessary to initialize a ReleaseLimiter.
+type ReleaseLimiterOptions struct {
+	Epsilon                  float64 // Privacy parameter ε of each release. Required.
+	Delta                    float64 // Privacy parameter δ of each release. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	// Maximum change in the released value caused by a single privacy unit in a
+	// single partition. Required.
+	LInfSensitivity float64
+	// Largest allowed change between consecutive releases, as a multiple of the
+	// standard deviation of the noise. Required; must be strictly positive.
+	MaxChange float64
+	// Privacy parameters of the fallback release. Default to 0, in which case
+	// releases that change too much are withheld. Otherwise, FallbackEpsilon must
+	// be smaller than Epsilon so that the fallback is noisier.
+	FallbackEpsilon, FallbackDelta float64
+	Noise                          noise.Noise // Type of noise used. Defaults to Laplace noise.
+	// Significance level α of the confidence interval reported with each
+	// release, e.g. 0.05 for a 95% confidence interval. Defaults to 0, in
+	// which case no confidence interval is reported.
+	Alpha float64
+}
+
+// ReleaseResult is the outcome of a call to ReleaseLimiter.Release.
+type ReleaseResult struct {
+	Status ReleaseStatus
+	// Released value, or 0 if the release was withheld.
+	Value float64
+	// Privacy budget spent by the call, including the budget of the withheld
+	// or replaced release.
+	Epsilon, Delta float64
+	// Standard deviation of the noise of Value, or 0 if the release was
+	// withheld. After post-processing with Rescale, Clamp or Round, this is an
+	// upper bound on the root mean square error of Value compared to the same
+	// post-processing applied to the raw value.
+	StandardDeviation float64
+	// Confidence interval of the raw value at the significance level Alpha of
+	// the ReleaseLimiter, or the zero interval if Alpha is 0 or the release was
+	// withheld. Post-processing maps it to a confidence interval of the raw
+	// value post-processed in the same way.
+	ConfidenceInterval noise.ConfidenceInterval
+	// Standard deviation of the raw value caused by sampling, or 0 if unknown.
+	// It is not computed by ReleaseLimiter, but can be estimated with
+	// SamplingError and attached with WithSamplingStandardDeviation.
+	SamplingStandardDeviation float64
+}
+
+// WithSamplingStandardDeviation returns the result with its sampling standard
+// deviation set to s, e.g. as estimated by SamplingError. Withheld results are
+// returned unchanged.
+func (r ReleaseResult) WithSamplingStandardDeviation(s float64) ReleaseResult {
+	if r.Status == Withheld {
+		return r
+	}
+	r.SamplingStandardDeviation = s
+	return r
+}
+
+// TotalStandardDeviation returns the end-to-end standard deviation of the
+// released value compared to the population value it estimates. Since the
+// noise is independent of the sampling, their variances add up.
+func (r ReleaseResult) TotalStandardDeviation() float64 {
+	return math.Hypot(r.StandardDeviation, r.SamplingStandardDeviation)
+}
+
+// Rescale returns the result of multiplying the released value by factor, e.g.
+// to convert units, with its standard deviation and confidence interval
+// updated accordingly. Withheld results are returned unchanged.
+func (r ReleaseResult) Rescale(factor float64) ReleaseResult {
+	if r.Status == Withheld {
+		return r
+	}
+	r.Value *= factor
+	r.StandardDeviation *= math.Abs(factor)
+	r.SamplingStandardDeviation *= math.Abs(factor)
+	lower, upper := r.ConfidenceInterval.LowerBound*factor, r.ConfidenceInterval.UpperBound*factor
+	if factor < 0 {
+		lower, upper = upper, lower
+	}
+	r.ConfidenceInterval = noise.ConfidenceInterval{LowerBound: lower, UpperBound: upper}
+	return r
+}
+
+// Clamp returns the result of clamping the released value to [lower, upper],
+// e.g. to make a count non-negative. Since clamping never increases the
+// distance between two values, the standard deviation is kept as an upper
+// bound, and the confidence interval is clamped as well. Withheld results are
+// returned unchanged.
+func (r ReleaseResult) Clamp(lower, upper float64) (ReleaseResult, error) {
+	if r.Status == Withheld {
+		return r, nil
+	}
+	var err error
+	if r.Value, err = ClampFloat64(r.Value, lower, upper); err != nil {
+		return ReleaseResult{}, fmt.Errorf("couldn't clamp release: %w", err)
+	}
+	if r.ConfidenceInterval != (noise.ConfidenceInterval{}) {
+		r.ConfidenceInterval.LowerBound, _ = ClampFloat64(r.ConfidenceInterval.LowerBound, lower, upper)
+		r.ConfidenceInterval.UpperBound, _ = ClampFloat64(r.ConfidenceInterval.UpperBound, lower, upper)
+	}
+	return r, nil
+}
+
+// Round returns the result of rounding the released value to the nearest
+// integer. Rounding two values changes their distance by less than 1, so the
+// standard deviation is increased by 1, and the bounds of the confidence
+// interval are rounded as well. Withheld results are returned unchanged.
+func (r ReleaseResult) Round() ReleaseResult {
+	if r.Status == Withheld {
+		return r
+	}
+	r.Value = math.Round(r.Value)
+	r.StandardDeviation++
+	r.ConfidenceInterval = noise.ConfidenceInterval{
+		LowerBound: math.Round(r.ConfidenceInterval.LowerBound),
+		UpperBound: math.Round(r.ConfidenceInterval.UpperBound),
+	}
+	return r
+}
+
+// NewReleaseLimiter returns a new ReleaseLimiter without previous release.
+func NewReleaseLimiter(opt *ReleaseLimiterOptions) (*ReleaseLimiter, error) {
+	if opt == nil {
+		opt = &ReleaseLimiterOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if err := checks.CheckLInfSensitivity(opt.LInfSensitivity); err != nil {
+		return nil, fmt.Errorf("NewReleaseLimiter: %w", err)
+	}
+	if !(opt.MaxChange > 0) || math.IsInf(opt.MaxChange, 0) {
+		return nil, fmt.Errorf("NewReleaseLimiter: MaxChange is %f, must be strictly positive and finite", opt.MaxChange)
+	}
+	stdDev, err := NoiseStandardDeviation(n, l0, opt.LInfSensitivity, opt.Epsilon, opt.Delta)
+	if err != nil {
+		return nil, fmt.Errorf("NewReleaseLimiter: %w", err)
+	}
+	var fallbackStdDev float64
+	if opt.FallbackEpsilon != 0 || opt.FallbackDelta != 0 {
+		if opt.FallbackEpsilon >= opt.Epsilon {
+			return nil, fmt.Errorf("NewReleaseLimiter: FallbackEpsilon is %f, must be smaller than Epsilon (%f)", opt.FallbackEpsilon, opt.Epsilon)
+		}
+		// Check that the fallback parameters are compatible with the noise chosen
+		// by calling the noise on some placeholder value.
+		if _, err := n.AddNoiseFloat64(0, l0, opt.LInfSensitivity, opt.FallbackEpsilon, opt.FallbackDelta); err != nil {
+			return nil, fmt.Errorf("NewReleaseLimiter: fallback: %w", err)
+		}
+		if fallbackStdDev, err = NoiseStandardDeviation(n, l0, opt.LInfSensitivity, opt.FallbackEpsilon, opt.FallbackDelta); err != nil {
+			return nil, fmt.Errorf("NewReleaseLimiter: fallback: %w", err)
+		}
+	}
+	if opt.Alpha != 0 {
+		if err := checks.CheckAlpha(opt.Alpha); err != nil {
+			return nil, fmt.Errorf("NewReleaseLimiter: %w", err)
+		}
+	}
+
+	return &ReleaseLimiter{
+		epsilon:         opt.Epsilon,
+		delta:           opt.Delta,
+		fallbackEpsilon: opt.FallbackEpsilon,
+		fallbackDelta:   opt.FallbackDelta,
+		l0Sensitivity:   l0,
+		lInfSensitivity: opt.LInfSensitivity,
+		alpha:           opt.Alpha,
+		stdDev:          stdDev,
+		fallbackStdDev:  fallbackStdDev,
+		maxChange:       opt.MaxChange * stdDev,
+		Noise:           n,
+	}, nil
+}
+
+// NoiseStandardDeviation returns the standard deviation of noise n calibrated
+// to the given parameters. Only Laplace, geometric, Gaussian, discrete Gaussian
+// and noise.FixedScale noise are supported. This is only a function of the
+// parameters, so it can be published alongside the noisy values, e.g. to
+// reconcile them with ReconcileTotal.
+func NoiseStandardDeviation(n noise.Noise, l0 int64, lInf, epsilon, delta float64) (float64, error) {
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseFloat64(0, l0, lInf, epsilon, delta); err != nil {
+		return 0, err
+	}
+	if fs, ok := n.(noise.FixedScale); ok {
+		return fs.StandardDeviation(), nil
+	}
+	switch noise.ToKind(n) {
+	case noise.LaplaceNoise, noise.GeometricNoise:
+		// Geometric noise adds Laplace noise to floating point values, and noise
+		// with a smaller variance to integers.
+		return math.Sqrt2 * float64(l0) * lInf / epsilon, nil
+	case noise.GaussianNoise, noise.DiscreteGaussianNoise:
+		return noise.SigmaForGaussian(l0, lInf, epsilon, delta), nil
+	}
+	return 0, fmt.Errorf("the standard deviation of %v noise is unknown", n)
+}
+
+// Release noises the raw value x of the current release, whose sensitivities
+// must be those of the options, and returns what was released. The first
+// release is always published, since it has nothing to be compared to.
+func (rl *ReleaseLimiter) Release(x float64) (ReleaseResult, error) {
+	noised, err := rl.Noise.AddNoiseFloat64(x, rl.l0Sensitivity, rl.lInfSensitivity, rl.epsilon, rl.delta)
+	if err != nil {
+		return ReleaseResult{}, fmt.Errorf("couldn't compute noised release: %w", err)
+	}
+	result := ReleaseResult{Status: Released, Value: noised, Epsilon: rl.epsilon, Delta: rl.delta, StandardDeviation: rl.stdDev}
+	if rl.hasPrevious && math.Abs(noised-rl.previous) > rl.maxChange {
+		if rl.fallbackEpsilon == 0 {
+			return ReleaseResult{Status: Withheld, Epsilon: rl.epsilon, Delta: rl.delta}, nil
+		}
+		fallback, err := rl.Noise.AddNoiseFloat64(x, rl.l0Sensitivity, rl.lInfSensitivity, rl.fallbackEpsilon, rl.fallbackDelta)
+		if err != nil {
+			return ReleaseResult{}, fmt.Errorf("couldn't compute noised fallback release: %w", err)
+		}
+		result = ReleaseResult{
+			Status:  FallbackReleased,
+			Value:   fallback,
+			Epsilon: rl.epsilon + rl.fallbackEpsilon,
+			Delta:   rl.delta + rl.fallbackDelta,
+			// The budget of the withheld release doesn't reduce the noise of
+			// the fallback release.
+			StandardDeviation: rl.fallbackStdDev,
+		}
+	}
+	if rl.alpha != 0 {
+		eps, del := rl.epsilon, rl.delta
+		if result.Status == FallbackReleased {
+			eps, del = rl.fallbackEpsilon, rl.fallbackDelta
+		}
+		if result.ConfidenceInterval, err = rl.Noise.ComputeConfidenceIntervalFloat64(result.Value, rl.l0Sensitivity, rl.lInfSensitivity, eps, del, rl.alpha); err != nil {
+			return ReleaseResult{}, fmt.Errorf("couldn't compute confidence interval of release: %w", err)
+		}
+	}
+	rl.previous, rl.hasPrevious = result.Value, true
+	return result, nil
+}
@@ -0,0 +1,228 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewReleaseLimiterInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *ReleaseLimiterOptions
+	}{
+		{"nil options", nil},
+		{"zero max change", &ReleaseLimiterOptions{Epsilon: ln3, LInfSensitivity: 1}},
+		{"zero sensitivity", &ReleaseLimiterOptions{Epsilon: ln3, MaxChange: 3}},
+		{"zero epsilon", &ReleaseLimiterOptions{LInfSensitivity: 1, MaxChange: 3}},
+		{"fallback epsilon not smaller than epsilon", &ReleaseLimiterOptions{Epsilon: ln3, LInfSensitivity: 1, MaxChange: 3, FallbackEpsilon: ln3}},
+		{"fallback delta without fallback epsilon", &ReleaseLimiterOptions{Epsilon: ln3, LInfSensitivity: 1, MaxChange: 3, FallbackDelta: 1e-5}},
+		{"invalid alpha", &ReleaseLimiterOptions{Epsilon: ln3, LInfSensitivity: 1, MaxChange: 3, Alpha: 1.5}},
+		{"unknown standard deviation", &ReleaseLimiterOptions{Epsilon: ln3, LInfSensitivity: 1, MaxChange: 3, Noise: noNoise{}}},
+	} {
+		if _, err := NewReleaseLimiter(tc.opts); err == nil {
+			t.Errorf("NewReleaseLimiter: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestReleaseLimiterWithholds(t *testing.T) {
+	// With a very large ε, the noise is negligible compared to the changes
+	// between releases.
+	rl, err := NewReleaseLimiter(&ReleaseLimiterOptions{Epsilon: 1e6, LInfSensitivity: 1, MaxChange: 1000})
+	if err != nil {
+		t.Fatalf("Couldn't initialize release limiter: %v", err)
+	}
+	for _, tc := range []struct {
+		x          float64
+		wantStatus ReleaseStatus
+		wantValue  float64
+	}{
+		{100, Released, 100},
+		{100, Released, 100},
+		{200, Withheld, 0},
+		// The withheld release isn't used for comparison.
+		{200, Withheld, 0},
+		{100, Released, 100},
+	} {
+		got, err := rl.Release(tc.x)
+		if err != nil {
+			t.Fatalf("Release(%f): got error %v", tc.x, err)
+		}
+		if got.Status != tc.wantStatus || math.Abs(got.Value-tc.wantValue) > 1e-3 {
+			t.Errorf("Release(%f): got status %v and value %f, want %v and %f", tc.x, got.Status, got.Value, tc.wantStatus, tc.wantValue)
+		}
+		if got.Epsilon != 1e6 || got.Delta != 0 {
+			t.Errorf("Release(%f): got budget (%f, %e), want (1e6, 0)", tc.x, got.Epsilon, got.Delta)
+		}
+	}
+}
+
+func TestReleaseLimiterFallback(t *testing.T) {
+	rl, err := NewReleaseLimiter(&ReleaseLimiterOptions{
+		Epsilon:         1e6,
+		LInfSensitivity: 1,
+		MaxChange:       1000,
+		FallbackEpsilon: 1e5,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize release limiter: %v", err)
+	}
+	for _, tc := range []struct {
+		x                 float64
+		wantStatus        ReleaseStatus
+		wantValue         float64
+		wantEps, wantDelt float64
+	}{
+		{100, Released, 100, 1e6, 0},
+		{200, FallbackReleased, 200, 1.1e6, 0},
+		// The fallback release is used for comparison.
+		{200, Released, 200, 1e6, 0},
+	} {
+		got, err := rl.Release(tc.x)
+		if err != nil {
+			t.Fatalf("Release(%f): got error %v", tc.x, err)
+		}
+		if got.Status != tc.wantStatus || math.Abs(got.Value-tc.wantValue) > 1e-3 {
+			t.Errorf("Release(%f): got status %v and value %f, want %v and %f", tc.x, got.Status, got.Value, tc.wantStatus, tc.wantValue)
+		}
+		if !ApproxEqual(got.Epsilon, tc.wantEps) || !ApproxEqual(got.Delta, tc.wantDelt) {
+			t.Errorf("Release(%f): got budget (%f, %e), want (%f, %e)", tc.x, got.Epsilon, got.Delta, tc.wantEps, tc.wantDelt)
+		}
+	}
+}
+
+func TestReleaseLimiterGaussianMaxChange(t *testing.T) {
+	rl, err := NewReleaseLimiter(&ReleaseLimiterOptions{
+		Epsilon:         ln3,
+		Delta:           1e-5,
+		LInfSensitivity: 1,
+		MaxChange:       2,
+		Noise:           noise.Gaussian(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize release limiter: %v", err)
+	}
+	if want := 2 * noise.SigmaForGaussian(1, 1, ln3, 1e-5); !ApproxEqual(rl.maxChange, want) {
+		t.Errorf("maxChange: got %f, want %f", rl.maxChange, want)
+	}
+}
+
+func TestReleaseLimiterStandardDeviationAndConfidenceInterval(t *testing.T) {
+	rl, err := NewReleaseLimiter(&ReleaseLimiterOptions{
+		Epsilon:         1e6,
+		LInfSensitivity: 1,
+		MaxChange:       1000,
+		FallbackEpsilon: 1e5,
+		Alpha:           0.05,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize release limiter: %v", err)
+	}
+	for _, tc := range []struct {
+		x          float64
+		wantStdDev float64
+		eps        float64
+	}{
+		{100, math.Sqrt2 / 1e6, 1e6},
+		// The fallback release is noised with the fallback budget only.
+		{200, math.Sqrt2 / 1e5, 1e5},
+	} {
+		got, err := rl.Release(tc.x)
+		if err != nil {
+			t.Fatalf("Release(%f): got error %v", tc.x, err)
+		}
+		if !ApproxEqual(got.StandardDeviation, tc.wantStdDev) {
+			t.Errorf("Release(%f): got standard deviation %e, want %e", tc.x, got.StandardDeviation, tc.wantStdDev)
+		}
+		wantCI, err := noise.Laplace().ComputeConfidenceIntervalFloat64(got.Value, 1, 1, tc.eps, 0, 0.05)
+		if err != nil {
+			t.Fatalf("Couldn't compute confidence interval: %v", err)
+		}
+		if got.ConfidenceInterval != wantCI {
+			t.Errorf("Release(%f): got confidence interval %+v, want %+v", tc.x, got.ConfidenceInterval, wantCI)
+		}
+	}
+}
+
+func TestReleaseResultPostProcessing(t *testing.T) {
+	r := ReleaseResult{
+		Status:             Released,
+		Value:              -1.4,
+		StandardDeviation:  2,
+		ConfidenceInterval: noise.ConfidenceInterval{LowerBound: -5.2, UpperBound: 2.4},
+	}
+	rescaled := r.Rescale(-10)
+	if want := (ReleaseResult{
+		Status:             Released,
+		Value:              14,
+		StandardDeviation:  20,
+		ConfidenceInterval: noise.ConfidenceInterval{LowerBound: -24, UpperBound: 52},
+	}); !ApproxEqual(rescaled.Value, want.Value) || !ApproxEqual(rescaled.StandardDeviation, want.StandardDeviation) ||
+		!ApproxEqual(rescaled.ConfidenceInterval.LowerBound, want.ConfidenceInterval.LowerBound) ||
+		!ApproxEqual(rescaled.ConfidenceInterval.UpperBound, want.ConfidenceInterval.UpperBound) {
+		t.Errorf("Rescale(-10): got %+v, want %+v", rescaled, want)
+	}
+
+	clamped, err := r.Clamp(0, 100)
+	if err != nil {
+		t.Fatalf("Clamp(0, 100): got error %v", err)
+	}
+	if want := (ReleaseResult{
+		Status:             Released,
+		Value:              0,
+		StandardDeviation:  2,
+		ConfidenceInterval: noise.ConfidenceInterval{LowerBound: 0, UpperBound: 2.4},
+	}); clamped != want {
+		t.Errorf("Clamp(0, 100): got %+v, want %+v", clamped, want)
+	}
+	if _, err := r.Clamp(1, 0); err == nil {
+		t.Errorf("Clamp(1, 0): got no error, want error")
+	}
+
+	rounded := clamped.Round()
+	if want := (ReleaseResult{
+		Status:             Released,
+		Value:              0,
+		StandardDeviation:  3,
+		ConfidenceInterval: noise.ConfidenceInterval{LowerBound: 0, UpperBound: 2},
+	}); rounded != want {
+		t.Errorf("Round(): got %+v, want %+v", rounded, want)
+	}
+
+	withheld := ReleaseResult{Status: Withheld, Epsilon: 1}
+	if got := withheld.Rescale(2).Round(); got != withheld {
+		t.Errorf("Post-processing a withheld result: got %+v, want %+v", got, withheld)
+	}
+}
+
+func TestReleaseResultSamplingStandardDeviation(t *testing.T) {
+	r := ReleaseResult{Status: Released, Value: 10, StandardDeviation: 3}.WithSamplingStandardDeviation(4)
+	if got := r.TotalStandardDeviation(); !ApproxEqual(got, 5) {
+		t.Errorf("TotalStandardDeviation: got %f, want 5", got)
+	}
+	if got := r.Rescale(-2).SamplingStandardDeviation; !ApproxEqual(got, 8) {
+		t.Errorf("Rescale(-2): got sampling standard deviation %f, want 8", got)
+	}
+	withheld := ReleaseResult{Status: Withheld, Epsilon: 1}
+	if got := withheld.WithSamplingStandardDeviation(4); got != withheld {
+		t.Errorf("WithSamplingStandardDeviation of a withheld result: got %+v, want %+v", got, withheld)
+	}
+}
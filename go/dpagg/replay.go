@@ -0,0 +1,296 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// ErrSeedMismatch is returned (wrapped) when replaying a release with a seed
+// that doesn't match the seed commitment of its audit record.
+var ErrSeedMismatch = errors.New("seed doesn't match the seed commitment")
+
+// ErrReplayMismatch is returned (wrapped) when the replayed result of a release
+// differs from the result recorded in its audit record.
+var ErrReplayMismatch = errors.New("replayed result differs from the recorded result")
+
+// AuditRecord records a release of a deferred aggregation (see DeferredCount),
+// so that the release can be replayed deterministically during an internal
+// review, e.g. with ReplayCount.
+//
+// The record holds the exact partial aggregate, so it must be stored as
+// securely as the raw data. It doesn't hold the seed of the noise, which
+// should be kept separately, e.g. in escrow: it only holds a SHA-256
+// commitment to the seed, so that a reviewer can check that the seed they are
+// given is the one that was used.
+type AuditRecord struct {
+	// Type of the released aggregation, e.g. "Count" or "BoundedSumFloat64".
+	Aggregation string
+	// Release parameters, see DeferredReleaseOptions.
+	Epsilon, Delta, Rho float64
+	NoiseKind           noise.Kind
+	SeedCommitment      [sha256.Size]byte
+	// Snapshot of the exact partial aggregate, in the format of GobEncode.
+	Partial []byte
+	// Result of the release.
+	Result float64
+}
+
+// String hides the exact partial aggregate of the record.
+func (ar *AuditRecord) String() string {
+	return fmt.Sprintf("AuditRecord{Aggregation: %s, Epsilon: %v, Delta: %v, Rho: %v, NoiseKind: %v, SeedCommitment: %x, Partial: <redacted>, Result: %v}",
+		ar.Aggregation, ar.Epsilon, ar.Delta, ar.Rho, ar.NoiseKind, ar.SeedCommitment, ar.Result)
+}
+
+// GoString hides the exact partial aggregate of the record.
+func (ar *AuditRecord) GoString() string {
+	return ar.String()
+}
+
+// AuditedRelease is like Release, but the noise is generated from the given
+// seed, which must be generated with rand.NewSeed and kept secret, and the
+// differentially private result is computed right away and returned with an
+// audit record of the release, from which ReplayCount can reproduce it.
+func (dc *DeferredCount) AuditedRelease(opt *DeferredReleaseOptions, seed []byte) (int64, *AuditRecord, error) {
+	if opt == nil {
+		opt = &DeferredReleaseOptions{}
+	}
+	if dc.state != defaultState {
+		return 0, nil, fmt.Errorf("DeferredCount cannot be released: %w", dc.state.transitionError(resultReturned))
+	}
+	partial, err := encode(encodableDeferredCount{L0Sensitivity: dc.l0Sensitivity, Count: dc.count})
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't snapshot DeferredCount: %w", err)
+	}
+	seededOpt, record, err := newAuditRecord("Count", opt, seed, partial)
+	if err != nil {
+		return 0, nil, err
+	}
+	c, err := dc.Release(seededOpt)
+	if err != nil {
+		return 0, nil, err
+	}
+	result, err := c.Result()
+	if err != nil {
+		return 0, nil, err
+	}
+	record.Result = float64(result)
+	return result, record, nil
+}
+
+// AuditedRelease is like Release, but the noise is generated from the given
+// seed, see DeferredCount.AuditedRelease. ReplayBoundedSum reproduces the
+// release from its audit record.
+func (ds *DeferredBoundedSum[T]) AuditedRelease(opt *DeferredReleaseOptions, seed []byte) (T, *AuditRecord, error) {
+	if opt == nil {
+		opt = &DeferredReleaseOptions{}
+	}
+	if ds.state != defaultState {
+		return 0, nil, fmt.Errorf("DeferredBoundedSum cannot be released: %w", ds.state.transitionError(resultReturned))
+	}
+	partial, err := encode(encodableDeferredBoundedSum[T]{
+		L0Sensitivity: ds.l0Sensitivity,
+		Lower:         ds.lower,
+		Upper:         ds.upper,
+		Sum:           ds.partial.sum,
+		Overflowed:    ds.partial.overflowed,
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't snapshot DeferredBoundedSum: %w", err)
+	}
+	seededOpt, record, err := newAuditRecord(bsName[T](), opt, seed, partial)
+	if err != nil {
+		return 0, nil, err
+	}
+	bs, err := ds.Release(seededOpt)
+	if err != nil {
+		return 0, nil, err
+	}
+	result, err := bs.Result()
+	if err != nil {
+		return 0, nil, err
+	}
+	record.Result = float64(result)
+	return result, record, nil
+}
+
+// newAuditRecord returns the release options of opt with noise generated from
+// seed, and the audit record of the release, without its result.
+func newAuditRecord(aggregation string, opt *DeferredReleaseOptions, seed, partial []byte) (*DeferredReleaseOptions, *AuditRecord, error) {
+	n := noiseOrDefault(opt.Noise, opt.Rho)
+	seeded, err := seededNoise(n, seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	seededOpt := *opt
+	seededOpt.Noise = seeded
+	return &seededOpt, &AuditRecord{
+		Aggregation:    aggregation,
+		Epsilon:        opt.Epsilon,
+		Delta:          opt.Delta,
+		Rho:            opt.Rho,
+		NoiseKind:      noise.ToKind(n),
+		SeedCommitment: sha256.Sum256(seed),
+		Partial:        partial,
+	}, nil
+}
+
+func seededNoise(n noise.Noise, seed []byte) (noise.Noise, error) {
+	r, err := rand.NewRand(seed)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't seed the noise: %w", err)
+	}
+	seeded, err := noise.WithSource(n, r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't seed the noise: %w", err)
+	}
+	return seeded, nil
+}
+
+// replayOptions checks that the record is a release of the given aggregation
+// made with the given seed, and returns its release options.
+func replayOptions(record *AuditRecord, aggregation string, seed []byte) (*DeferredReleaseOptions, error) {
+	if record.Aggregation != aggregation {
+		return nil, fmt.Errorf("couldn't replay release: the record is a release of %s, not %s", record.Aggregation, aggregation)
+	}
+	commitment := sha256.Sum256(seed)
+	if subtle.ConstantTimeCompare(commitment[:], record.SeedCommitment[:]) != 1 {
+		return nil, fmt.Errorf("couldn't replay release: %w", ErrSeedMismatch)
+	}
+	n := noise.ToNoise(record.NoiseKind)
+	if n == nil {
+		return nil, fmt.Errorf("couldn't replay release: noise kind %v is not supported", record.NoiseKind)
+	}
+	seeded, err := seededNoise(n, seed)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	return &DeferredReleaseOptions{Epsilon: record.Epsilon, Delta: record.Delta, Rho: record.Rho, Noise: seeded}, nil
+}
+
+// ReplayCount regenerates the release of a DeferredCount from its audit record
+// and the seed of its noise, e.g. for a reproducibility review. It returns the
+// replayed result, and an error wrapping ErrReplayMismatch if it differs from
+// the recorded result, or ErrSeedMismatch if the seed isn't the one that was
+// used. No additional privacy budget is spent, since the replayed result is
+// the same as the recorded one.
+func ReplayCount(record *AuditRecord, seed []byte) (int64, error) {
+	opt, err := replayOptions(record, "Count", seed)
+	if err != nil {
+		return 0, err
+	}
+	var dc DeferredCount
+	if err := dc.GobDecode(record.Partial); err != nil {
+		return 0, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	c, err := dc.Release(opt)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	result, err := c.Result()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	if float64(result) != record.Result {
+		return result, fmt.Errorf("replayed %d, recorded %v: %w", result, record.Result, ErrReplayMismatch)
+	}
+	return result, nil
+}
+
+// ReplayBoundedSum regenerates the release of a DeferredBoundedSum from its
+// audit record and the seed of its noise, see ReplayCount.
+func ReplayBoundedSum[T Number](record *AuditRecord, seed []byte) (T, error) {
+	opt, err := replayOptions(record, bsName[T](), seed)
+	if err != nil {
+		return 0, err
+	}
+	var ds DeferredBoundedSum[T]
+	if err := ds.GobDecode(record.Partial); err != nil {
+		return 0, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	bs, err := ds.Release(opt)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	result, err := bs.Result()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't replay release: %w", err)
+	}
+	if float64(result) != record.Result {
+		return result, fmt.Errorf("replayed %v, recorded %v: %w", result, record.Result, ErrReplayMismatch)
+	}
+	return result, nil
+}
+
+// UnsafeReviewer gives access to the exact partial aggregates of audit
+// records, which must never be published. It must only be used for internal
+// reviews, e.g. to check that a partial matches the raw data.
+type UnsafeReviewer struct {
+	acknowledged bool
+}
+
+// NewUnsafeReviewer returns an UnsafeReviewer. Calling it acknowledges that
+// the exact partial aggregates it reads are not differentially private.
+func NewUnsafeReviewer() *UnsafeReviewer {
+	return &UnsafeReviewer{acknowledged: true}
+}
+
+func (r *UnsafeReviewer) check() error {
+	if r == nil || !r.acknowledged {
+		return fmt.Errorf("exact partial aggregates can only be read by an UnsafeReviewer returned by NewUnsafeReviewer")
+	}
+	return nil
+}
+
+// ExactCount returns the exact partial count of the audit record of a
+// DeferredCount release.
+func (r *UnsafeReviewer) ExactCount(record *AuditRecord) (int64, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	if record.Aggregation != "Count" {
+		return 0, fmt.Errorf("ExactCount: the record is a release of %s, not Count", record.Aggregation)
+	}
+	var enc encodableDeferredCount
+	if err := decode(&enc, record.Partial); err != nil {
+		return 0, fmt.Errorf("ExactCount: couldn't decode partial: %w", err)
+	}
+	return enc.Count, nil
+}
+
+// ExactBoundedSum returns the exact partial sum of the audit record of a
+// DeferredBoundedSum release. It is a function rather than a method of
+// UnsafeReviewer since methods can't have type parameters.
+func ExactBoundedSum[T Number](r *UnsafeReviewer, record *AuditRecord) (T, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	if record.Aggregation != bsName[T]() {
+		return 0, fmt.Errorf("ExactBoundedSum: the record is a release of %s, not %s", record.Aggregation, bsName[T]())
+	}
+	var enc encodableDeferredBoundedSum[T]
+	if err := decode(&enc, record.Partial); err != nil {
+		return 0, fmt.Errorf("ExactBoundedSum: couldn't decode partial: %w", err)
+	}
+	return fromWideSum[T](enc.Sum), nil
+}
@@ -0,0 +1,143 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+func TestReplayCount(t *testing.T) {
+	for _, opt := range []*DeferredReleaseOptions{
+		{Epsilon: ln3, Noise: noise.Laplace()},
+		{Epsilon: ln3, Delta: 1e-5, Noise: noise.Gaussian()},
+	} {
+		dc, err := NewDeferredCount(nil)
+		if err != nil {
+			t.Fatalf("Couldn't initialize dc: %v", err)
+		}
+		dc.IncrementBy(42)
+		seed := rand.NewSeed()
+		got, record, err := dc.AuditedRelease(opt, seed)
+		if err != nil {
+			t.Fatalf("AuditedRelease with %v: got error %v", opt.Noise, err)
+		}
+		if record.Aggregation != "Count" || record.Result != float64(got) || record.NoiseKind != noise.ToKind(opt.Noise) {
+			t.Errorf("AuditedRelease with %v: got record %v, want a Count record with result %d", opt.Noise, record, got)
+		}
+		replayed, err := ReplayCount(record, seed)
+		if err != nil {
+			t.Fatalf("ReplayCount with %v: got error %v", opt.Noise, err)
+		}
+		if replayed != got {
+			t.Errorf("ReplayCount with %v: got %d, want %d", opt.Noise, replayed, got)
+		}
+	}
+}
+
+func TestReplayBoundedSum(t *testing.T) {
+	ds, err := NewDeferredBoundedSum(&DeferredBoundedSumOptions[float64]{MaxPartitionsContributed: 1, Lower: 0, Upper: 5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize ds: %v", err)
+	}
+	ds.Add(1.5)
+	ds.Add(10) // Clamped to 5.
+	seed := rand.NewSeed()
+	got, record, err := ds.AuditedRelease(&DeferredReleaseOptions{Epsilon: ln3}, seed)
+	if err != nil {
+		t.Fatalf("AuditedRelease: got error %v", err)
+	}
+	replayed, err := ReplayBoundedSum[float64](record, seed)
+	if err != nil {
+		t.Fatalf("ReplayBoundedSum: got error %v", err)
+	}
+	if replayed != got {
+		t.Errorf("ReplayBoundedSum: got %v, want %v", replayed, got)
+	}
+	if _, err := ReplayBoundedSum[int64](record, seed); err == nil {
+		t.Errorf("ReplayBoundedSum[int64] of a BoundedSumFloat64 record: got no error, want error")
+	}
+	exact, err := ExactBoundedSum[float64](NewUnsafeReviewer(), record)
+	if err != nil {
+		t.Fatalf("ExactBoundedSum: got error %v", err)
+	}
+	if exact != 6.5 {
+		t.Errorf("ExactBoundedSum: got %v, want 6.5", exact)
+	}
+}
+
+func TestReplayCountMismatch(t *testing.T) {
+	dc, err := NewDeferredCount(nil)
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc: %v", err)
+	}
+	dc.IncrementBy(42)
+	seed := rand.NewSeed()
+	got, record, err := dc.AuditedRelease(&DeferredReleaseOptions{Epsilon: ln3}, seed)
+	if err != nil {
+		t.Fatalf("AuditedRelease: got error %v", err)
+	}
+	if _, err := ReplayCount(record, rand.NewSeed()); !errors.Is(err, ErrSeedMismatch) {
+		t.Errorf("ReplayCount with a different seed: got error %v, want %v", err, ErrSeedMismatch)
+	}
+	tampered := *record
+	tampered.Result = float64(got + 1)
+	if _, err := ReplayCount(&tampered, seed); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("ReplayCount of a tampered record: got error %v, want %v", err, ErrReplayMismatch)
+	}
+}
+
+func TestAuditedReleaseInvalidSeed(t *testing.T) {
+	dc, err := NewDeferredCount(nil)
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc: %v", err)
+	}
+	if _, _, err := dc.AuditedRelease(&DeferredReleaseOptions{Epsilon: ln3}, []byte("too short")); err == nil {
+		t.Errorf("AuditedRelease with an invalid seed: got no error, want error")
+	}
+}
+
+func TestUnsafeReviewer(t *testing.T) {
+	dc, err := NewDeferredCount(nil)
+	if err != nil {
+		t.Fatalf("Couldn't initialize dc: %v", err)
+	}
+	dc.IncrementBy(42)
+	_, record, err := dc.AuditedRelease(&DeferredReleaseOptions{Epsilon: ln3}, rand.NewSeed())
+	if err != nil {
+		t.Fatalf("AuditedRelease: got error %v", err)
+	}
+	if s := record.String(); !strings.Contains(s, "Partial: <redacted>") {
+		t.Errorf("String: got %q, want the partial to be redacted", s)
+	}
+	got, err := NewUnsafeReviewer().ExactCount(record)
+	if err != nil {
+		t.Fatalf("ExactCount: got error %v", err)
+	}
+	if got != 42 {
+		t.Errorf("ExactCount: got %d, want 42", got)
+	}
+	for _, r := range []*UnsafeReviewer{nil, {}} {
+		if _, err := r.ExactCount(record); err == nil {
+			t.Errorf("ExactCount with an UnsafeReviewer not returned by NewUnsafeReviewer: got no error, want error")
+		}
+	}
+}
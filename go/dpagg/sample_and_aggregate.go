@@ -0,0 +1,283 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// BlockAggregation is the differentially private aggregation used by
+// SampleAndAggregate to combine the estimates of the blocks.
+type BlockAggregation int
+
+const (
+	// MeanOfBlocks releases the noisy mean of the block estimates. It is the
+	// default, and is the most accurate when the estimates are concentrated
+	// within a small fraction of [Lower, Upper].
+	MeanOfBlocks BlockAggregation = iota
+	// MedianOfBlocks releases the noisy median of the block estimates, which
+	// is robust to a few blocks with outlying estimates.
+	MedianOfBlocks
+)
+
+func (a BlockAggregation) String() string {
+	switch a {
+	case MeanOfBlocks:
+		return "MeanOfBlocks"
+	case MedianOfBlocks:
+		return "MedianOfBlocks"
+	}
+	return fmt.Sprintf("BlockAggregation(%d)", int(a))
+}
+
+// SampleAndAggregate computes a differentially private version of an
+// arbitrary statistic using the sample-and-aggregate framework: privacy units
+// are split uniformly at random into Blocks disjoint blocks, the statistic is
+// computed on the records of each block by a black-box Estimator, and the
+// block estimates are combined with a differentially private mean or median.
+//
+// Since each privacy unit is in a single block, it can only change a single
+// estimate, whatever the estimator, so no sensitivity analysis of the
+// estimator is needed. The estimates are clamped to [Lower, Upper], which must
+// be chosen without looking at the data. The accuracy of the result depends on
+// how well the statistic can be estimated on a 1/Blocks fraction of the data.
+//
+// Unlike other aggregations, entries are (privacy ID, record) pairs, and the
+// records of all privacy units are kept in memory until Result is called.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type SampleAndAggregate[T any] struct {
+	// Parameters
+	blocks       int64
+	estimator    func([]T) (float64, error)
+	lower, upper float64
+	aggregation  BlockAggregation
+	sumOpt       BoundedSumFloat64Options
+	quantilesOpt BoundedQuantilesOptions
+
+	// State variables
+	units *privacyUnitBlocks[T]
+	state aggregationState
+}
+
+// SampleAndAggregateOptions contains the options necessary to initialize a
+// SampleAndAggregate.
+type SampleAndAggregateOptions[T any] struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// Number of blocks the privacy units are split into. More blocks make the
+	// aggregation of the estimates more accurate, but each estimate is computed
+	// on fewer records. Required; must be at least 2.
+	Blocks int64
+	// Estimator computes the statistic on the records of a block. It is called
+	// once per block, including on blocks without any record, in which case
+	// its argument is empty. Required.
+	Estimator func([]T) (float64, error)
+	// Lower and Upper bounds of the estimates, to which they are clamped.
+	// Required; must be such that Lower < Upper.
+	Lower, Upper float64
+	// Aggregation of the block estimates. Defaults to MeanOfBlocks.
+	Aggregation BlockAggregation
+	Noise       noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewSampleAndAggregate returns a new SampleAndAggregate without any record.
+func NewSampleAndAggregate[T any](opt *SampleAndAggregateOptions[T]) (*SampleAndAggregate[T], error) {
+	if opt == nil {
+		opt = &SampleAndAggregateOptions[T]{}
+	}
+
+	// Check the parameters.
+	if opt.Blocks < 2 {
+		return nil, fmt.Errorf("NewSampleAndAggregate: Blocks is %d, must be at least 2", opt.Blocks)
+	}
+	if opt.Estimator == nil {
+		return nil, fmt.Errorf("NewSampleAndAggregate: Estimator must be set")
+	}
+	if err := checks.CheckBoundsFloat64(opt.Lower, opt.Upper); err != nil {
+		return nil, fmt.Errorf("NewSampleAndAggregate: %w", err)
+	}
+	if err := checks.CheckBoundsNotEqual(opt.Lower, opt.Upper); err != nil {
+		return nil, fmt.Errorf("NewSampleAndAggregate: %w", err)
+	}
+	sa := &SampleAndAggregate[T]{
+		blocks:      opt.Blocks,
+		estimator:   opt.Estimator,
+		lower:       opt.Lower,
+		upper:       opt.Upper,
+		aggregation: opt.Aggregation,
+		units:       newPrivacyUnitBlocks[T](opt.Blocks),
+		state:       defaultState,
+	}
+	// Check that the parameters of the aggregation are valid by initializing
+	// it.
+	switch opt.Aggregation {
+	case MeanOfBlocks:
+		// Replacing the records of a privacy unit changes a single estimate by
+		// at most Upper-Lower. The estimates are centered around the midpoint of
+		// [Lower, Upper] so that the sum has this sensitivity, as the number of
+		// blocks is public.
+		width := opt.Upper - opt.Lower
+		sa.sumOpt = BoundedSumFloat64Options{
+			Epsilon:                  opt.Epsilon,
+			Delta:                    opt.Delta,
+			MaxPartitionsContributed: 1,
+			Lower:                    -width,
+			Upper:                    width,
+			Noise:                    opt.Noise,
+		}
+		if _, err := NewBoundedSumFloat64(&sa.sumOpt); err != nil {
+			return nil, fmt.Errorf("NewSampleAndAggregate: mean: %w", err)
+		}
+	case MedianOfBlocks:
+		// Replacing the records of a privacy unit removes an estimate and adds
+		// another, which changes the counts of at most two nodes of each level
+		// of the quantile tree.
+		sa.quantilesOpt = BoundedQuantilesOptions{
+			Epsilon:                      opt.Epsilon,
+			Delta:                        opt.Delta,
+			MaxPartitionsContributed:     2,
+			MaxContributionsPerPartition: 1,
+			Lower:                        opt.Lower,
+			Upper:                        opt.Upper,
+			Noise:                        opt.Noise,
+		}
+		if _, err := NewBoundedQuantiles(&sa.quantilesOpt); err != nil {
+			return nil, fmt.Errorf("NewSampleAndAggregate: median: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("NewSampleAndAggregate: unknown Aggregation %v", opt.Aggregation)
+	}
+	return sa, nil
+}
+
+// Add adds a record of the given privacy unit to its block. All the records
+// of a privacy unit are in the same block.
+func (sa *SampleAndAggregate[T]) Add(privacyID string, record T) error {
+	if sa.state != defaultState {
+		return fmt.Errorf("SampleAndAggregate cannot be amended: %w", sa.state.transitionError(defaultState))
+	}
+	sa.units.add(privacyID, record)
+	return nil
+}
+
+// Result runs the estimator on each block and returns the noisy aggregation
+// of the estimates. The method can be called only once.
+//
+// An error of the estimator is returned as is. Since it depends on the
+// records, it must not be released. An estimate of NaN is replaced by the
+// midpoint of [Lower, Upper].
+func (sa *SampleAndAggregate[T]) Result() (float64, error) {
+	if sa.state != defaultState {
+		return 0, fmt.Errorf("SampleAndAggregate's noised result cannot be computed: %w", sa.state.transitionError(resultReturned))
+	}
+	sa.state = resultReturned
+
+	estimates, err := sa.units.estimates(sa.estimator, sa.lower, sa.upper)
+	if err != nil {
+		return 0, err
+	}
+	sa.units = nil
+
+	midpoint := sa.lower + (sa.upper-sa.lower)/2
+
+	switch sa.aggregation {
+	case MeanOfBlocks:
+		bs, err := NewBoundedSumFloat64(&sa.sumOpt)
+		if err != nil {
+			return 0, fmt.Errorf("couldn't initialize BoundedSumFloat64 for mean: %w", err)
+		}
+		for _, e := range estimates {
+			if err := bs.Add(e - midpoint); err != nil {
+				return 0, err
+			}
+		}
+		sum, err := bs.Result()
+		if err != nil {
+			return 0, fmt.Errorf("couldn't compute noised mean: %w", err)
+		}
+		mean := midpoint + sum/float64(sa.blocks)
+		return math.Min(math.Max(mean, sa.lower), sa.upper), nil
+	default:
+		bq, err := NewBoundedQuantiles(&sa.quantilesOpt)
+		if err != nil {
+			return 0, fmt.Errorf("couldn't initialize BoundedQuantiles for median: %w", err)
+		}
+		for _, e := range estimates {
+			if err := bq.Add(e); err != nil {
+				return 0, err
+			}
+		}
+		median, err := bq.Result(0.5)
+		if err != nil {
+			return 0, fmt.Errorf("couldn't compute noised median: %w", err)
+		}
+		return median, nil
+	}
+}
+
+// privacyUnitBlocks splits the records of privacy units into disjoint blocks,
+// all the records of a privacy unit being in the same block.
+type privacyUnitBlocks[T any] struct {
+	// Block of each privacy unit, chosen uniformly at random when its first
+	// record is added.
+	blockOf map[string]int64
+	records [][]T
+}
+
+func newPrivacyUnitBlocks[T any](blocks int64) *privacyUnitBlocks[T] {
+	return &privacyUnitBlocks[T]{
+		blockOf: make(map[string]int64),
+		records: make([][]T, blocks),
+	}
+}
+
+func (b *privacyUnitBlocks[T]) add(privacyID string, record T) {
+	block, ok := b.blockOf[privacyID]
+	if !ok {
+		block = rand.I63n(int64(len(b.records)))
+		b.blockOf[privacyID] = block
+	}
+	b.records[block] = append(b.records[block], record)
+}
+
+// estimates runs estimator on each block and returns the estimates clamped to
+// [lower, upper]. An estimate of NaN is replaced by the midpoint of [lower,
+// upper].
+func (b *privacyUnitBlocks[T]) estimates(estimator func([]T) (float64, error), lower, upper float64) ([]float64, error) {
+	midpoint := lower + (upper-lower)/2
+	estimates := make([]float64, len(b.records))
+	for i, records := range b.records {
+		e, err := estimator(records)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(e) {
+			e = midpoint
+		}
+		estimates[i] = math.Min(math.Max(e, lower), upper)
+	}
+	return estimates, nil
+}
@@ -0,0 +1,165 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func meanEstimator(records []float64) (float64, error) {
+	if len(records) == 0 {
+		return math.NaN(), nil
+	}
+	var sum float64
+	for _, r := range records {
+		sum += r
+	}
+	return sum / float64(len(records)), nil
+}
+
+func TestNewSampleAndAggregateInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *SampleAndAggregateOptions[float64]
+	}{
+		{"nil options", nil},
+		{"no Blocks", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Estimator: meanEstimator, Lower: 0, Upper: 10}},
+		{"a single block", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Blocks: 1, Estimator: meanEstimator, Lower: 0, Upper: 10}},
+		{"no Estimator", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Blocks: 10, Lower: 0, Upper: 10}},
+		{"equal bounds", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Blocks: 10, Estimator: meanEstimator, Lower: 5, Upper: 5}},
+		{"no Epsilon", &SampleAndAggregateOptions[float64]{Blocks: 10, Estimator: meanEstimator, Lower: 0, Upper: 10}},
+		{"no Epsilon with MedianOfBlocks", &SampleAndAggregateOptions[float64]{Blocks: 10, Estimator: meanEstimator, Lower: 0, Upper: 10, Aggregation: MedianOfBlocks}},
+		{"Delta with Laplace noise", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Delta: 1e-5, Blocks: 10, Estimator: meanEstimator, Lower: 0, Upper: 10}},
+		{"no Delta with Gaussian noise", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Blocks: 10, Estimator: meanEstimator, Lower: 0, Upper: 10, Noise: noise.Gaussian()}},
+		{"unknown Aggregation", &SampleAndAggregateOptions[float64]{Epsilon: ln3, Blocks: 10, Estimator: meanEstimator, Lower: 0, Upper: 10, Aggregation: BlockAggregation(2)}},
+	} {
+		if _, err := NewSampleAndAggregate(tc.opt); err == nil {
+			t.Errorf("NewSampleAndAggregate with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSampleAndAggregate(t *testing.T) {
+	for _, tc := range []struct {
+		aggregation BlockAggregation
+		value       float64
+		want        float64
+	}{
+		{MeanOfBlocks, 3, 3},
+		{MedianOfBlocks, 3, 3},
+		// Estimates are clamped to [Lower, Upper].
+		{MeanOfBlocks, 100, 10},
+		{MedianOfBlocks, -100, 0},
+	} {
+		sa, err := NewSampleAndAggregate(&SampleAndAggregateOptions[float64]{
+			Epsilon:     ln3,
+			Blocks:      10,
+			Estimator:   meanEstimator,
+			Lower:       0,
+			Upper:       10,
+			Aggregation: tc.aggregation,
+			Noise:       noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize SampleAndAggregate: %v", err)
+		}
+		// With 1000 privacy units, no block is empty in practice.
+		for i := 0; i < 1000; i++ {
+			sa.Add(fmt.Sprintf("user%d", i), tc.value)
+		}
+		got, err := sa.Result()
+		if err != nil {
+			t.Fatalf("Result with %v and records of value %f: got error %v", tc.aggregation, tc.value, err)
+		}
+		if math.Abs(got-tc.want) > 0.01 {
+			t.Errorf("Result with %v and records of value %f: got %f, want %f", tc.aggregation, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestSampleAndAggregateKeepsPrivacyUnitsInASingleBlock(t *testing.T) {
+	// The estimator fails if a privacy unit has records in several blocks, and
+	// returns the number of privacy units of the block otherwise.
+	seen := make(map[string]bool)
+	estimator := func(records []string) (float64, error) {
+		block := make(map[string]bool)
+		for _, id := range records {
+			if seen[id] && !block[id] {
+				return 0, fmt.Errorf("privacy unit %s is in several blocks", id)
+			}
+			seen[id] = true
+			block[id] = true
+		}
+		return float64(len(block)), nil
+	}
+	sa, err := NewSampleAndAggregate(&SampleAndAggregateOptions[string]{
+		Epsilon:   ln3,
+		Blocks:    10,
+		Estimator: estimator,
+		Lower:     0,
+		Upper:     100,
+		Noise:     noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SampleAndAggregate: %v", err)
+	}
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 100; i++ {
+			id := fmt.Sprintf("user%d", i)
+			sa.Add(id, id)
+		}
+	}
+	got, err := sa.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// The blocks contain 100 privacy units in total.
+	if !ApproxEqual(got, 10) {
+		t.Errorf("Result: got %f, want 10", got)
+	}
+}
+
+func TestSampleAndAggregateEstimatorError(t *testing.T) {
+	errEstimator := errors.New("estimator failed")
+	sa, err := NewSampleAndAggregate(&SampleAndAggregateOptions[float64]{
+		Epsilon:   ln3,
+		Blocks:    10,
+		Estimator: func([]float64) (float64, error) { return 0, errEstimator },
+		Lower:     0,
+		Upper:     10,
+		Noise:     noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SampleAndAggregate: %v", err)
+	}
+	sa.Add("user", 1)
+	if _, err := sa.Result(); !errors.Is(err, errEstimator) {
+		t.Errorf("Result with a failing estimator: got error %v, want %v", err, errEstimator)
+	}
+	// The result can't be computed again.
+	if err := sa.Add("user", 1); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+	if _, err := sa.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+}
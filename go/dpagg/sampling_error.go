@@ -0,0 +1,169 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// SamplingError privately estimates the sampling error of a statistic, i.e.
+// the standard deviation of the statistic caused by the data being a random
+// sample of a larger population, as opposed to the noise added for privacy.
+// Together with the standard deviation of the noise, e.g. the
+// StandardDeviation of a ReleaseResult, it gives end-to-end error bars of a
+// release; see ReleaseResult.WithSamplingStandardDeviation.
+//
+// Privacy units are split uniformly at random into Subsamples disjoint
+// subsamples, and the statistic is computed on each subsample by a black-box
+// Estimator, as in SampleAndAggregate. The variance of the statistic on the
+// full data is estimated as the noisy variance of the subsample estimates
+// divided by Subsamples, which assumes that the variance of the statistic is
+// inversely proportional to the number of records, as is the case for means,
+// proportions and most smooth statistics.
+//
+// The estimate spends its own privacy budget, independent of the budget of the
+// release whose error it quantifies.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type SamplingError[T any] struct {
+	// Parameters
+	estimator    func([]T) (float64, error)
+	lower, upper float64
+	varianceOpt  BoundedVarianceOptions
+
+	// State variables
+	units *privacyUnitBlocks[T]
+	state aggregationState
+}
+
+// SamplingErrorOptions contains the options necessary to initialize a
+// SamplingError.
+type SamplingErrorOptions[T any] struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// Number of subsamples the privacy units are split into. Defaults to 10;
+	// must be at least 2.
+	Subsamples int64
+	// Estimator computes the statistic on the records of a subsample. It is
+	// called once per subsample, including on subsamples without any record,
+	// in which case its argument is empty. Required.
+	Estimator func([]T) (float64, error)
+	// Lower and Upper bounds of the estimates, to which they are clamped.
+	// Required; must be such that Lower < Upper.
+	Lower, Upper float64
+	Noise        noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewSamplingError returns a new SamplingError without any record.
+func NewSamplingError[T any](opt *SamplingErrorOptions[T]) (*SamplingError[T], error) {
+	if opt == nil {
+		opt = &SamplingErrorOptions[T]{}
+	}
+	// Set defaults.
+	subsamples := opt.Subsamples
+	if subsamples == 0 {
+		subsamples = 10
+	}
+
+	// Check the parameters.
+	if subsamples < 2 {
+		return nil, fmt.Errorf("NewSamplingError: Subsamples is %d, must be at least 2", subsamples)
+	}
+	if opt.Estimator == nil {
+		return nil, fmt.Errorf("NewSamplingError: Estimator must be set")
+	}
+	if err := checks.CheckBoundsFloat64(opt.Lower, opt.Upper); err != nil {
+		return nil, fmt.Errorf("NewSamplingError: %w", err)
+	}
+	if err := checks.CheckBoundsNotEqual(opt.Lower, opt.Upper); err != nil {
+		return nil, fmt.Errorf("NewSamplingError: %w", err)
+	}
+	// Replacing the records of a privacy unit replaces a single estimate, i.e.
+	// removes an estimate and adds another.
+	varianceOpt := BoundedVarianceOptions{
+		Epsilon:                      opt.Epsilon,
+		Delta:                        opt.Delta,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 2,
+		Lower:                        opt.Lower,
+		Upper:                        opt.Upper,
+		Noise:                        opt.Noise,
+	}
+	if _, err := NewBoundedVariance(&varianceOpt); err != nil {
+		return nil, fmt.Errorf("NewSamplingError: %w", err)
+	}
+
+	return &SamplingError[T]{
+		estimator:   opt.Estimator,
+		lower:       opt.Lower,
+		upper:       opt.Upper,
+		varianceOpt: varianceOpt,
+		units:       newPrivacyUnitBlocks[T](subsamples),
+		state:       defaultState,
+	}, nil
+}
+
+// Add adds a record of the given privacy unit to its subsample. All the
+// records of a privacy unit are in the same subsample.
+func (se *SamplingError[T]) Add(privacyID string, record T) error {
+	if se.state != defaultState {
+		return fmt.Errorf("SamplingError cannot be amended: %w", se.state.transitionError(defaultState))
+	}
+	se.units.add(privacyID, record)
+	return nil
+}
+
+// Result runs the estimator on each subsample and returns the noisy estimate
+// of the sampling standard deviation of the statistic on all the records. The
+// method can be called only once.
+//
+// An error of the estimator is returned as is. Since it depends on the
+// records, it must not be released.
+func (se *SamplingError[T]) Result() (float64, error) {
+	if se.state != defaultState {
+		return 0, fmt.Errorf("SamplingError's noised result cannot be computed: %w", se.state.transitionError(resultReturned))
+	}
+	se.state = resultReturned
+
+	estimates, err := se.units.estimates(se.estimator, se.lower, se.upper)
+	if err != nil {
+		return 0, err
+	}
+	se.units = nil
+
+	bv, err := NewBoundedVariance(&se.varianceOpt)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't initialize BoundedVariance: %w", err)
+	}
+	for _, e := range estimates {
+		if err := bv.Add(e); err != nil {
+			return 0, err
+		}
+	}
+	variance, err := bv.Result()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't compute noised variance of the estimates: %w", err)
+	}
+	return math.Sqrt(variance / float64(len(estimates))), nil
+}
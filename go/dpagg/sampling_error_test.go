@@ -0,0 +1,102 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewSamplingErrorInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *SamplingErrorOptions[float64]
+	}{
+		{"nil options", nil},
+		{"a single subsample", &SamplingErrorOptions[float64]{Epsilon: ln3, Subsamples: 1, Estimator: meanEstimator, Lower: 0, Upper: 1}},
+		{"no Estimator", &SamplingErrorOptions[float64]{Epsilon: ln3, Lower: 0, Upper: 1}},
+		{"equal bounds", &SamplingErrorOptions[float64]{Epsilon: ln3, Estimator: meanEstimator, Lower: 1, Upper: 1}},
+		{"no Epsilon", &SamplingErrorOptions[float64]{Estimator: meanEstimator, Lower: 0, Upper: 1}},
+		{"Delta with Laplace noise", &SamplingErrorOptions[float64]{Epsilon: ln3, Delta: 1e-5, Estimator: meanEstimator, Lower: 0, Upper: 1}},
+		{"no Delta with Gaussian noise", &SamplingErrorOptions[float64]{Epsilon: ln3, Estimator: meanEstimator, Lower: 0, Upper: 1, Noise: noise.Gaussian()}},
+	} {
+		if _, err := NewSamplingError(tc.opt); err == nil {
+			t.Errorf("NewSamplingError with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSamplingErrorOfConstantStatistic(t *testing.T) {
+	se, err := NewSamplingError(&SamplingErrorOptions[float64]{
+		Epsilon:   ln3,
+		Estimator: meanEstimator,
+		Lower:     0,
+		Upper:     10,
+		Noise:     noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SamplingError: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		se.Add(fmt.Sprintf("user%d", i), 3)
+	}
+	got, err := se.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got, 0) {
+		t.Errorf("Result with constant records: got %f, want 0", got)
+	}
+	if err := se.Add("user", 3); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+	if _, err := se.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+}
+
+func TestSamplingErrorOfMean(t *testing.T) {
+	se, err := NewSamplingError(&SamplingErrorOptions[float64]{
+		Epsilon:    ln3,
+		Subsamples: 100,
+		Estimator:  meanEstimator,
+		Lower:      0,
+		Upper:      1,
+		Noise:      noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SamplingError: %v", err)
+	}
+	// The mean of n records with values 0 and 1 in equal proportions has a
+	// sampling standard deviation of 0.5/√n.
+	n := 100000
+	for i := 0; i < n; i++ {
+		se.Add(fmt.Sprintf("user%d", i), float64(i%2))
+	}
+	got, err := se.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// The estimate is based on 100 subsamples, so its relative error is about
+	// 1/√(2·100).
+	if want := 0.5 / math.Sqrt(float64(n)); math.Abs(got-want) > 0.5*want {
+		t.Errorf("Result: got %e, want %e", got, want)
+	}
+}
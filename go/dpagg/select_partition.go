@@ -21,6 +21,7 @@ import (
 	"math"
 
 	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/metrics"
 	"github.com/google/differential-privacy/go/noise"
 	"github.com/google/differential-privacy/go/rand"
 )
@@ -96,10 +97,24 @@ type PreAggSelectPartition struct {
 }
 
 func preAggSelectPartitionEquallyInitialized(s1, s2 *PreAggSelectPartition) bool {
-	return s1.epsilon == s2.epsilon &&
-		s1.delta == s2.delta &&
-		s1.l0Sensitivity == s2.l0Sensitivity &&
-		s1.state == s2.state
+	return preAggSelectPartitionIncompatibleField(s1, s2) == ""
+}
+
+// preAggSelectPartitionIncompatibleField returns the name of the first option
+// with which s1 and s2 were initialized differently, or "" if they were
+// initialized equally.
+func preAggSelectPartitionIncompatibleField(s1, s2 *PreAggSelectPartition) string {
+	switch {
+	case s1.epsilon != s2.epsilon:
+		return "Epsilon"
+	case s1.delta != s2.delta:
+		return "Delta"
+	case s1.l0Sensitivity != s2.l0Sensitivity:
+		return "MaxPartitionsContributed"
+	case s1.state != s2.state:
+		return "state"
+	}
+	return ""
 }
 
 // PreAggSelectPartitionOptions is used to set the privacy parameters when
@@ -128,16 +143,17 @@ func NewPreAggSelectPartition(opt *PreAggSelectPartitionOptions) (*PreAggSelectP
 	}
 
 	if err := checks.CheckDeltaStrict(s.delta); err != nil {
-		return nil, fmt.Errorf("NewPreAggSelectPartition: %v", err)
+		return nil, fmt.Errorf("NewPreAggSelectPartition: %w", err)
 	}
 	// ε=0 is theoretically acceptable, but in practice it's probably an error,
 	// so we do not accept it as argument.
 	if err := checks.CheckEpsilonStrict(s.epsilon); err != nil {
-		return nil, fmt.Errorf("NewPreAggSelectPartition: %v", err)
+		return nil, fmt.Errorf("NewPreAggSelectPartition: %w", err)
 	}
 	if err := checks.CheckL0Sensitivity(s.l0Sensitivity); err != nil {
-		return nil, fmt.Errorf("NewPreAggSelectPartition: %v", err)
+		return nil, fmt.Errorf("NewPreAggSelectPartition: %w", err)
 	}
+	metrics.Default().AggregationCreated("PreAggSelectPartition")
 	return &s, nil
 }
 
@@ -145,7 +161,7 @@ func NewPreAggSelectPartition(opt *PreAggSelectPartitionOptions) (*PreAggSelectP
 // The caller must ensure this methods called at most once per privacy ID.
 func (s *PreAggSelectPartition) Increment() error {
 	if s.state != defaultState {
-		return fmt.Errorf("PreAggSelectPartition cannot be amended: %v", s.state.errorMessage())
+		return fmt.Errorf("PreAggSelectPartition cannot be amended: %w", s.state.transitionError(defaultState))
 	}
 	s.idCount++
 	return nil
@@ -169,14 +185,14 @@ func (s *PreAggSelectPartition) Merge(s2 *PreAggSelectPartition) error {
 
 func checkMergePreAggSelectPartition(s1, s2 *PreAggSelectPartition) error {
 	if s1.state != defaultState {
-		return fmt.Errorf("checkMergePreAggSelectPartition: s1 cannot be merged with another PreAggSelectPartition instance: %v", s1.state.errorMessage())
+		return fmt.Errorf("checkMergePreAggSelectPartition: s1 cannot be merged with another PreAggSelectPartition instance: %w", s1.state.transitionError(merged))
 	}
 	if s2.state != defaultState {
-		return fmt.Errorf("checkMergePreAggSelectPartition: s2 cannot be merged with another PreAggSelectPartition instance: %v", s2.state.errorMessage())
+		return fmt.Errorf("checkMergePreAggSelectPartition: s2 cannot be merged with another PreAggSelectPartition instance: %w", s2.state.transitionError(merged))
 	}
 
-	if !preAggSelectPartitionEquallyInitialized(s1, s2) {
-		return fmt.Errorf("checkMergePreAggSelectPartition: s1 and s2 are not compatible")
+	if field := preAggSelectPartitionIncompatibleField(s1, s2); field != "" {
+		return fmt.Errorf("checkMergePreAggSelectPartition: s1 and s2 are not compatible: %w", &IncompatibleMergeError{Field: field})
 	}
 
 	return nil
@@ -185,7 +201,7 @@ func checkMergePreAggSelectPartition(s1, s2 *PreAggSelectPartition) error {
 // ShouldKeepPartition returns whether the partition should be materialized.
 func (s *PreAggSelectPartition) ShouldKeepPartition() (bool, error) {
 	if s.state != defaultState {
-		return false, fmt.Errorf("PreAggSelectPartition's ShouldKeepPartition cannot be computed: %v", s.state.errorMessage())
+		return false, fmt.Errorf("PreAggSelectPartition's ShouldKeepPartition cannot be computed: %w", s.state.transitionError(resultReturned))
 	}
 	s.state = resultReturned
 	if s.l0Sensitivity > 3 { // Gaussian thresholding outperforms in this case.
@@ -201,17 +217,29 @@ func (s *PreAggSelectPartition) ShouldKeepPartition() (bool, error) {
 		if err != nil {
 			return false, fmt.Errorf("couldn't increment count for PreAggSelectPartition: %v", err)
 		}
-		result, err := c.ThresholdedResult(s.delta / 2)
+		result, err := c.thresholdedResult(s.delta / 2)
 		if err != nil {
 			return false, fmt.Errorf("couldn't compute thresholded result for PreAggSelectPartition: %v", err)
 		}
-		return result != nil, nil
+		// The Count reports the budget of its noise.
+		metrics.Default().BudgetConsumed(thresholdingMechanism, 0, s.delta/2)
+		return s.reportKept(result != nil), nil
 	}
 	prob, err := keepPartitionProbability(s.idCount, s.l0Sensitivity, s.epsilon, s.delta)
 	if err != nil {
 		return false, fmt.Errorf("couldn't compute keepPartitionProbability for PreAggSelectPartition: %v", err)
 	}
-	return rand.Uniform() < prob, nil
+	metrics.Default().BudgetConsumed(partitionSelectionMechanism, s.epsilon, s.delta)
+	return s.reportKept(rand.Uniform() < prob), nil
+}
+
+// reportKept reports to metrics.Recorder whether the partition was kept, and
+// returns keep.
+func (s *PreAggSelectPartition) reportKept(keep bool) bool {
+	if !keep {
+		metrics.Default().PartitionsDropped("PreAggSelectPartition", 1)
+	}
+	return keep
 }
 
 // sumExpPowers returns the evaluation of
@@ -338,26 +366,79 @@ func (s *PreAggSelectPartition) GetHardThreshold() (int, error) {
 	}
 }
 
+// Serialize returns the partial aggregate of s as a serialized
+// PreAggSelectPartitionSummary protobuf message (see proto/summary.proto),
+// which can be loaded into a PreAggSelectPartition with Deserialize.
+//
+// Like GobEncode, Serialize consumes s: it may not be amended, merged or
+// queried afterwards.
+func (s *PreAggSelectPartition) Serialize() ([]byte, error) {
+	if s.state != defaultState && s.state != serialized {
+		return nil, fmt.Errorf("PreAggSelectPartition object cannot be serialized: %w", s.state.transitionError(serialized))
+	}
+	summary, err := s.summary()
+	if err != nil {
+		return nil, fmt.Errorf("PreAggSelectPartition object cannot be serialized: %w", err)
+	}
+	s.state = serialized
+	return summary.marshal(), nil
+}
+
+// Deserialize merges a serialized PreAggSelectPartitionSummary protobuf message
+// into s, adding its privacy ID count to the one accumulated so far.
+//
+// s must have been initialized with the same parameters as the aggregation that
+// produced the summary, and may not have been merged, serialized or queried.
+func (s *PreAggSelectPartition) Deserialize(data []byte) error {
+	if s.state != defaultState {
+		return fmt.Errorf("PreAggSelectPartition object cannot be deserialized: %w", s.state.transitionError(defaultState))
+	}
+	var summary preAggSelectPartitionSummary
+	if err := summary.unmarshal(data); err != nil {
+		return fmt.Errorf("couldn't deserialize PreAggSelectPartition: %w", err)
+	}
+	want, err := s.summary()
+	if err != nil {
+		return fmt.Errorf("couldn't deserialize PreAggSelectPartition: %w", err)
+	}
+	if err := summary.checkParameters(want); err != nil {
+		return fmt.Errorf("couldn't deserialize PreAggSelectPartition, summary is not compatible: %w", err)
+	}
+	s.idCount += summary.idCount
+	return nil
+}
+
+func (s *PreAggSelectPartition) summary() (*preAggSelectPartitionSummary, error) {
+	l0, err := toInt32("MaxPartitionsContributed", s.l0Sensitivity)
+	if err != nil {
+		return nil, err
+	}
+	return &preAggSelectPartitionSummary{
+		idCount:                  s.idCount,
+		epsilon:                  s.epsilon,
+		delta:                    s.delta,
+		maxPartitionsContributed: l0,
+	}, nil
+}
+
 // encodablePreAggSelectPartition can be encoded by the gob package.
 type encodablePreAggSelectPartition struct {
 	Epsilon       float64
 	Delta         float64
 	L0Sensitivity int64
 	IDCount       int64
-	State         aggregationState
 }
 
 // GobEncode encodes PreAggSelectPartition.
 func (s *PreAggSelectPartition) GobEncode() ([]byte, error) {
 	if s.state != defaultState && s.state != serialized {
-		return nil, fmt.Errorf("PreAggSelectPartition object cannot be serialized: " + s.state.errorMessage())
+		return nil, fmt.Errorf("PreAggSelectPartition object cannot be serialized: %w", s.state.transitionError(serialized))
 	}
 	enc := encodablePreAggSelectPartition{
 		Epsilon:       s.epsilon,
 		Delta:         s.delta,
 		L0Sensitivity: s.l0Sensitivity,
 		IDCount:       s.idCount,
-		State:         s.state,
 	}
 	s.state = serialized
 	return encode(enc)
@@ -375,7 +456,50 @@ func (s *PreAggSelectPartition) GobDecode(data []byte) error {
 		delta:         enc.Delta,
 		l0Sensitivity: enc.L0Sensitivity,
 		idCount:       enc.IDCount,
-		state:         enc.State,
+		state:         defaultState,
+	}
+	return nil
+}
+
+type jsonPreAggSelectPartitionParameters struct {
+	Epsilon                  float64 `json:"epsilon"`
+	Delta                    float64 `json:"delta"`
+	MaxPartitionsContributed int64   `json:"max_partitions_contributed"`
+}
+
+type jsonPreAggSelectPartitionState struct {
+	IDCount int64 `json:"id_count"`
+}
+
+// MarshalJSON returns the JSON summary of s, see json_summary.go. Like
+// GobEncode, it consumes s: it may not be amended, merged or queried
+// afterwards.
+func (s *PreAggSelectPartition) MarshalJSON() ([]byte, error) {
+	if s.state != defaultState && s.state != serialized {
+		return nil, fmt.Errorf("PreAggSelectPartition object cannot be serialized: %w", s.state.transitionError(serialized))
+	}
+	params := jsonPreAggSelectPartitionParameters{
+		Epsilon:                  s.epsilon,
+		Delta:                    s.delta,
+		MaxPartitionsContributed: s.l0Sensitivity,
+	}
+	s.state = serialized
+	return marshalJSONSummary("PreAggSelectPartition", params, jsonPreAggSelectPartitionState{IDCount: s.idCount})
+}
+
+// UnmarshalJSON loads the JSON summary of a PreAggSelectPartition into s.
+func (s *PreAggSelectPartition) UnmarshalJSON(data []byte) error {
+	var params jsonPreAggSelectPartitionParameters
+	var state jsonPreAggSelectPartitionState
+	if err := unmarshalJSONSummary(data, "PreAggSelectPartition", &params, &state); err != nil {
+		return fmt.Errorf("couldn't decode PreAggSelectPartition from JSON: %w", err)
+	}
+	*s = PreAggSelectPartition{
+		epsilon:       params.Epsilon,
+		delta:         params.Delta,
+		l0Sensitivity: params.MaxPartitionsContributed,
+		idCount:       state.IDCount,
+		state:         defaultState,
 	}
 	return nil
 }
@@ -519,3 +519,37 @@ func TestPreAggSelectPartitionResultSetsStateCorrectly(t *testing.T) {
 		t.Errorf("PreAggSelectPartition should have its state set to ResultReturned, got %v, want ResultReturned", s.state)
 	}
 }
+
+// Tests that a PreAggSelectPartition decoded on another worker can be merged
+// with local ones, even if it was encoded more than once.
+func TestPreAggSelectPartitionSerializeShipMerge(t *testing.T) {
+	opts := &PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 1e-5}
+	shipped, err := NewPreAggSelectPartition(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize shipped: %v", err)
+	}
+	shipped.Increment()
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	received := new(PreAggSelectPartition)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	local, err := NewPreAggSelectPartition(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize local: %v", err)
+	}
+	local.Increment()
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded PreAggSelectPartition: got error %v", err)
+	}
+	if received.idCount != 2 {
+		t.Errorf("idCount after merging a decoded PreAggSelectPartition: got %d, want 2", received.idCount)
+	}
+}
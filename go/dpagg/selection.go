@@ -0,0 +1,319 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// Selection privately selects one element among a set of public candidates,
+// favoring candidates with a high score. It is implemented by
+// ExponentialMechanism, ReportNoisyMax and PermuteAndFlip, which all have the
+// same privacy guarantee for the same ExponentialMechanismOptions, so that
+// they can be swapped for one another.
+type Selection interface {
+	// Select returns the index of the selected candidate among numCandidates
+	// candidates, where score(i) is the score of the i-th candidate. It can be
+	// called only once, and returns an error if a score is NaN or infinite.
+	Select(numCandidates int, score func(i int) float64) (int, error)
+}
+
+// SelectFrom returns the candidate selected by s among candidates, where
+// score(c) is the score of candidate c. It is a convenience wrapper around
+// s.Select for when the candidates are held in a slice; like Select, it can be
+// called only once for a given s.
+//
+// The candidates (and their order) must not depend on the private data.
+func SelectFrom[T any](s Selection, candidates []T, score func(T) float64) (T, error) {
+	i, err := s.Select(len(candidates), func(i int) float64 { return score(candidates[i]) })
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return candidates[i], nil
+}
+
+// ExponentialMechanism privately selects one element among a set of public
+// candidates, favoring candidates with a high score. The score of each
+// candidate is computed on the private data, and Sensitivity bounds how much a
+// single privacy unit can change the score of any candidate.
+//
+// Candidate i is selected with probability proportional to
+// exp(ε·score(i)/(2·Sensitivity)), or exp(ε·score(i)/Sensitivity) if the scores
+// are monotonic. This is implemented with the Gumbel-max trick: independent
+// Gumbel noise is added to the scaled scores, and the candidate with the highest
+// noisy score is returned. This samples from the exact distribution of the
+// exponential mechanism without computing (possibly overflowing) weights.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type ExponentialMechanism struct {
+	// Parameters
+	epsilon     float64
+	sensitivity float64
+	monotonic   bool
+
+	// State variables
+	state aggregationState
+}
+
+// ExponentialMechanismOptions contains the options necessary to initialize an
+// ExponentialMechanism or a ReportNoisyMax.
+type ExponentialMechanismOptions struct {
+	Epsilon     float64 // Privacy parameter ε. Required.
+	Sensitivity float64 // Maximum change in the score of any candidate caused by a single privacy unit. Required.
+	// Whether adding a privacy unit to the data can only increase scores (or only
+	// decrease them), like for counts. Monotonic scores halve the required noise.
+	// Defaults to false.
+	Monotonic bool
+}
+
+// NewExponentialMechanism returns a new ExponentialMechanism.
+func NewExponentialMechanism(opt *ExponentialMechanismOptions) (*ExponentialMechanism, error) {
+	if err := checkExponentialMechanismOptions(opt); err != nil {
+		return nil, fmt.Errorf("NewExponentialMechanism: %w", err)
+	}
+	return &ExponentialMechanism{
+		epsilon:     opt.Epsilon,
+		sensitivity: opt.Sensitivity,
+		monotonic:   opt.Monotonic,
+		state:       defaultState,
+	}, nil
+}
+
+// Select returns the index of the selected candidate among numCandidates
+// candidates, where score(i) is the score of the i-th candidate. The method can
+// be called only once.
+//
+// The candidates (and their number) must not depend on the private data.
+func (em *ExponentialMechanism) Select(numCandidates int, score func(i int) float64) (int, error) {
+	if em.state != defaultState {
+		return 0, fmt.Errorf("ExponentialMechanism's selection cannot be computed: %w", em.state.transitionError(resultReturned))
+	}
+	if numCandidates <= 0 {
+		return 0, fmt.Errorf("ExponentialMechanism requires at least one candidate, got %d", numCandidates)
+	}
+	em.state = resultReturned
+	// With Gumbel noise of scale b, the argmax is distributed proportionally to
+	// exp(score(i)/b).
+	scale := 2 * em.sensitivity / em.epsilon
+	if em.monotonic {
+		scale = em.sensitivity / em.epsilon
+	}
+	return argmax(numCandidates, func(i int) (float64, error) {
+		s := score(i)
+		if math.IsNaN(s) || math.IsInf(s, 0) {
+			return 0, fmt.Errorf("score of candidate %d is %v, must be finite", i, s)
+		}
+		return s + scale*gumbel(), nil
+	})
+}
+
+// ReportNoisyMax privately selects one element among a set of public
+// candidates by adding independent Laplace noise to the score of each candidate
+// and returning the candidate with the highest noisy score. It has the same
+// privacy guarantee as ExponentialMechanism, and uses the Laplace sampler of the
+// noise package, which is robust against floating-point attacks.
+//
+// The Laplace noise has scale 2·Sensitivity/ε, or Sensitivity/ε if the scores
+// are monotonic.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type ReportNoisyMax struct {
+	// Parameters
+	epsilon     float64
+	sensitivity float64
+	monotonic   bool
+	Noise       noise.Noise
+
+	// State variables
+	state aggregationState
+}
+
+// NewReportNoisyMax returns a new ReportNoisyMax.
+func NewReportNoisyMax(opt *ExponentialMechanismOptions) (*ReportNoisyMax, error) {
+	if err := checkExponentialMechanismOptions(opt); err != nil {
+		return nil, fmt.Errorf("NewReportNoisyMax: %w", err)
+	}
+	return &ReportNoisyMax{
+		epsilon:     opt.Epsilon,
+		sensitivity: opt.Sensitivity,
+		monotonic:   opt.Monotonic,
+		Noise:       noise.Laplace(),
+		state:       defaultState,
+	}, nil
+}
+
+// Select returns the index of the selected candidate among numCandidates
+// candidates, where score(i) is the score of the i-th candidate. The method can
+// be called only once.
+//
+// The candidates (and their number) must not depend on the private data.
+func (rnm *ReportNoisyMax) Select(numCandidates int, score func(i int) float64) (int, error) {
+	if rnm.state != defaultState {
+		return 0, fmt.Errorf("ReportNoisyMax's selection cannot be computed: %w", rnm.state.transitionError(resultReturned))
+	}
+	if numCandidates <= 0 {
+		return 0, fmt.Errorf("ReportNoisyMax requires at least one candidate, got %d", numCandidates)
+	}
+	rnm.state = resultReturned
+	// Laplace noise with scale λ = lInfSensitivity/ε.
+	lInf := 2 * rnm.sensitivity
+	if rnm.monotonic {
+		lInf = rnm.sensitivity
+	}
+	return argmax(numCandidates, func(i int) (float64, error) {
+		s := score(i)
+		if math.IsNaN(s) || math.IsInf(s, 0) {
+			return 0, fmt.Errorf("score of candidate %d is %v, must be finite", i, s)
+		}
+		return rnm.Noise.AddNoiseFloat64(s, 1, lInf, rnm.epsilon, 0)
+	})
+}
+
+// PermuteAndFlip privately selects one element among a set of public
+// candidates with the permute-and-flip mechanism of McKenna and Sheldon's
+// "Permute-and-Flip: A new mechanism for differentially private selection"
+// (https://arxiv.org/abs/2010.12603). It has the same privacy guarantee as
+// ExponentialMechanism, and its expected score is never worse, and often
+// better, than the one of ExponentialMechanism.
+//
+// The candidates are visited in a random order, and candidate i is selected
+// with probability exp(ε·(score(i)-max)/(2·Sensitivity)) when visited, or
+// exp(ε·(score(i)-max)/Sensitivity) if the scores are monotonic, where max is
+// the highest score. A candidate with the highest score is always selected
+// when visited, so at most one pass over the candidates is needed.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type PermuteAndFlip struct {
+	// Parameters
+	epsilon     float64
+	sensitivity float64
+	monotonic   bool
+
+	// State variables
+	state aggregationState
+}
+
+// NewPermuteAndFlip returns a new PermuteAndFlip.
+func NewPermuteAndFlip(opt *ExponentialMechanismOptions) (*PermuteAndFlip, error) {
+	if err := checkExponentialMechanismOptions(opt); err != nil {
+		return nil, fmt.Errorf("NewPermuteAndFlip: %w", err)
+	}
+	return &PermuteAndFlip{
+		epsilon:     opt.Epsilon,
+		sensitivity: opt.Sensitivity,
+		monotonic:   opt.Monotonic,
+		state:       defaultState,
+	}, nil
+}
+
+// Select returns the index of the selected candidate among numCandidates
+// candidates, where score(i) is the score of the i-th candidate. The method can
+// be called only once.
+//
+// The candidates (and their number) must not depend on the private data.
+func (pf *PermuteAndFlip) Select(numCandidates int, score func(i int) float64) (int, error) {
+	if pf.state != defaultState {
+		return 0, fmt.Errorf("PermuteAndFlip's selection cannot be computed: %w", pf.state.transitionError(resultReturned))
+	}
+	if numCandidates <= 0 {
+		return 0, fmt.Errorf("PermuteAndFlip requires at least one candidate, got %d", numCandidates)
+	}
+	pf.state = resultReturned
+	scores := make([]float64, numCandidates)
+	maxScore := math.Inf(-1)
+	for i := range scores {
+		s := score(i)
+		if math.IsNaN(s) || math.IsInf(s, 0) {
+			return 0, fmt.Errorf("score of candidate %d is %v, must be finite", i, s)
+		}
+		scores[i] = s
+		maxScore = math.Max(maxScore, s)
+	}
+	factor := pf.epsilon / (2 * pf.sensitivity)
+	if pf.monotonic {
+		factor = pf.epsilon / pf.sensitivity
+	}
+	// Visit the candidates in the order of a random permutation, drawn lazily
+	// with a Fisher-Yates shuffle.
+	order := make([]int, numCandidates)
+	for i := range order {
+		order[i] = i
+	}
+	for i := range order {
+		j := i + int(rand.I63n(int64(numCandidates-i)))
+		order[i], order[j] = order[j], order[i]
+		c := order[i]
+		if scores[c] == maxScore || rand.Uniform() < math.Exp(factor*(scores[c]-maxScore)) {
+			return c, nil
+		}
+	}
+	// Unreachable: a candidate with the highest score is always selected.
+	return 0, fmt.Errorf("PermuteAndFlip: no candidate was selected")
+}
+
+func checkExponentialMechanismOptions(opt *ExponentialMechanismOptions) error {
+	if opt == nil {
+		opt = &ExponentialMechanismOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return err
+	}
+	if opt.Sensitivity <= 0 || math.IsInf(opt.Sensitivity, 0) || math.IsNaN(opt.Sensitivity) {
+		return fmt.Errorf("Sensitivity is %v, must be finite and strictly positive", opt.Sensitivity)
+	}
+	return nil
+}
+
+// argmax returns the index of the largest of the n values returned by value.
+// Exact ties are broken uniformly at random, so that the result doesn't depend
+// on the order of the candidates.
+func argmax(n int, value func(i int) (float64, error)) (int, error) {
+	best, ties := -1, 0
+	var bestValue float64
+	for i := 0; i < n; i++ {
+		v, err := value(i)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case best == -1 || v > bestValue:
+			best, bestValue, ties = i, v, 1
+		case v == bestValue:
+			// Reservoir sampling among the tied candidates.
+			ties++
+			if rand.I63n(int64(ties)) == 0 {
+				best = i
+			}
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,271 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewExponentialMechanismInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *ExponentialMechanismOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &ExponentialMechanismOptions{Sensitivity: 1}},
+		{"zero sensitivity", &ExponentialMechanismOptions{Epsilon: ln3}},
+		{"infinite sensitivity", &ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: math.Inf(1)}},
+	} {
+		if _, err := NewExponentialMechanism(tc.opts); err == nil {
+			t.Errorf("NewExponentialMechanism: when %s got no error, want error", tc.desc)
+		}
+		if _, err := NewReportNoisyMax(tc.opts); err == nil {
+			t.Errorf("NewReportNoisyMax: when %s got no error, want error", tc.desc)
+		}
+		if _, err := NewPermuteAndFlip(tc.opts); err == nil {
+			t.Errorf("NewPermuteAndFlip: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+// Tests that the exponential mechanism selects candidates with the expected
+// probabilities.
+func TestExponentialMechanismDistribution(t *testing.T) {
+	const numberOfTrials = 20000
+	scores := []float64{0, 1, 2}
+	for _, monotonic := range []bool{false, true} {
+		counts := make([]int, len(scores))
+		for i := 0; i < numberOfTrials; i++ {
+			em, err := NewExponentialMechanism(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1, Monotonic: monotonic})
+			if err != nil {
+				t.Fatalf("Couldn't initialize exponential mechanism: %v", err)
+			}
+			got, err := em.Select(len(scores), func(i int) float64 { return scores[i] })
+			if err != nil {
+				t.Fatalf("Select: got error %v", err)
+			}
+			counts[got]++
+		}
+		factor := ln3 / 2
+		if monotonic {
+			factor = ln3
+		}
+		var normalization float64
+		for _, s := range scores {
+			normalization += math.Exp(factor * s)
+		}
+		for i, s := range scores {
+			want := math.Exp(factor*s) / normalization
+			got := float64(counts[i]) / numberOfTrials
+			if math.Abs(got-want) > 5*math.Sqrt(want*(1-want)/numberOfTrials) {
+				t.Errorf("Select: with monotonic=%t selected candidate %d with frequency %f, want %f", monotonic, i, got, want)
+			}
+		}
+	}
+}
+
+func TestSelectionFavorsHighScores(t *testing.T) {
+	scores := []float64{10, 1000, 20}
+	em, err := NewExponentialMechanism(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize exponential mechanism: %v", err)
+	}
+	if got, err := em.Select(len(scores), func(i int) float64 { return scores[i] }); err != nil || got != 1 {
+		t.Errorf("ExponentialMechanism.Select: got (%d, %v), want (1, nil)", got, err)
+	}
+	rnm, err := NewReportNoisyMax(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize report noisy max: %v", err)
+	}
+	if got, err := rnm.Select(len(scores), func(i int) float64 { return scores[i] }); err != nil || got != 1 {
+		t.Errorf("ReportNoisyMax.Select: got (%d, %v), want (1, nil)", got, err)
+	}
+	pf, err := NewPermuteAndFlip(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize permute-and-flip: %v", err)
+	}
+	if got, err := pf.Select(len(scores), func(i int) float64 { return scores[i] }); err != nil || got != 1 {
+		t.Errorf("PermuteAndFlip.Select: got (%d, %v), want (1, nil)", got, err)
+	}
+}
+
+// Tests that permute-and-flip selects candidates with the expected
+// probabilities. With two candidates, the candidate with the lower score is
+// selected if it is visited first and accepted.
+func TestPermuteAndFlipDistribution(t *testing.T) {
+	const numberOfTrials = 20000
+	scores := []float64{0, 1}
+	for _, monotonic := range []bool{false, true} {
+		var count int
+		for i := 0; i < numberOfTrials; i++ {
+			pf, err := NewPermuteAndFlip(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1, Monotonic: monotonic})
+			if err != nil {
+				t.Fatalf("Couldn't initialize permute-and-flip: %v", err)
+			}
+			got, err := pf.Select(len(scores), func(i int) float64 { return scores[i] })
+			if err != nil {
+				t.Fatalf("Select: got error %v", err)
+			}
+			if got == 0 {
+				count++
+			}
+		}
+		factor := ln3 / 2
+		if monotonic {
+			factor = ln3
+		}
+		want := math.Exp(-factor) / 2
+		got := float64(count) / numberOfTrials
+		if math.Abs(got-want) > 5*math.Sqrt(want*(1-want)/numberOfTrials) {
+			t.Errorf("Select: with monotonic=%t selected candidate 0 with frequency %f, want %f", monotonic, got, want)
+		}
+	}
+}
+
+func TestSelectionInterface(t *testing.T) {
+	opt := &ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1}
+	em, err := NewExponentialMechanism(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize exponential mechanism: %v", err)
+	}
+	rnm, err := NewReportNoisyMax(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize report noisy max: %v", err)
+	}
+	pf, err := NewPermuteAndFlip(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize permute-and-flip: %v", err)
+	}
+	for _, s := range []Selection{em, rnm, pf} {
+		if got, err := s.Select(3, func(i int) float64 { return float64(i) }); err != nil || got < 0 || got >= 3 {
+			t.Errorf("%T.Select: got (%d, %v), want a candidate in [0, 3)", s, got, err)
+		}
+	}
+}
+
+func TestSelectFrom(t *testing.T) {
+	candidates := []string{"low", "high", "medium"}
+	scores := map[string]float64{"low": 10, "high": 1000, "medium": 20}
+	em, err := NewExponentialMechanism(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize exponential mechanism: %v", err)
+	}
+	if got, err := SelectFrom(em, candidates, func(c string) float64 { return scores[c] }); err != nil || got != "high" {
+		t.Errorf("SelectFrom: got (%q, %v), want (\"high\", nil)", got, err)
+	}
+	// Errors of Select are returned with the zero value.
+	if got, err := SelectFrom(em, candidates, func(c string) float64 { return scores[c] }); err == nil || got != "" {
+		t.Errorf("SelectFrom: when called twice got (%q, %v), want (\"\", error)", got, err)
+	}
+	rnm, err := NewReportNoisyMax(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize report noisy max: %v", err)
+	}
+	if _, err := SelectFrom(rnm, []string{}, func(c string) float64 { return scores[c] }); err == nil {
+		t.Errorf("SelectFrom: got no error for zero candidates, want error")
+	}
+}
+
+func TestSelectionNonFiniteScore(t *testing.T) {
+	opt := &ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1}
+	for _, nonFinite := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		em, err := NewExponentialMechanism(opt)
+		if err != nil {
+			t.Fatalf("Couldn't initialize exponential mechanism: %v", err)
+		}
+		rnm, err := NewReportNoisyMax(opt)
+		if err != nil {
+			t.Fatalf("Couldn't initialize report noisy max: %v", err)
+		}
+		pf, err := NewPermuteAndFlip(opt)
+		if err != nil {
+			t.Fatalf("Couldn't initialize permute-and-flip: %v", err)
+		}
+		score := func(i int) float64 {
+			if i == 1 {
+				return nonFinite
+			}
+			return float64(i)
+		}
+		for _, s := range []Selection{em, rnm, pf} {
+			if _, err := s.Select(3, score); err == nil {
+				t.Errorf("%T.Select: got no error for a score of %v, want error", s, nonFinite)
+			}
+		}
+	}
+}
+
+func TestSelectionStateChecks(t *testing.T) {
+	score := func(i int) float64 { return 0 }
+	em, err := NewExponentialMechanism(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize exponential mechanism: %v", err)
+	}
+	if _, err := em.Select(0, score); err == nil {
+		t.Errorf("ExponentialMechanism.Select: got no error for zero candidates, want error")
+	}
+	if _, err := em.Select(2, score); err != nil {
+		t.Fatalf("ExponentialMechanism.Select: got error %v", err)
+	}
+	if _, err := em.Select(2, score); err == nil {
+		t.Errorf("ExponentialMechanism.Select: got no error when called twice, want error")
+	}
+
+	rnm, err := NewReportNoisyMax(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize report noisy max: %v", err)
+	}
+	if _, err := rnm.Select(2, score); err != nil {
+		t.Fatalf("ReportNoisyMax.Select: got error %v", err)
+	}
+	if _, err := rnm.Select(2, score); err == nil {
+		t.Errorf("ReportNoisyMax.Select: got no error when called twice, want error")
+	}
+
+	pf, err := NewPermuteAndFlip(&ExponentialMechanismOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize permute-and-flip: %v", err)
+	}
+	if _, err := pf.Select(0, score); err == nil {
+		t.Errorf("PermuteAndFlip.Select: got no error for zero candidates, want error")
+	}
+	if _, err := pf.Select(2, score); err != nil {
+		t.Fatalf("PermuteAndFlip.Select: got error %v", err)
+	}
+	if _, err := pf.Select(2, score); err == nil {
+		t.Errorf("PermuteAndFlip.Select: got no error when called twice, want error")
+	}
+}
+
+func TestArgmaxBreaksTiesUniformly(t *testing.T) {
+	const numberOfTrials = 9000
+	counts := make([]int, 3)
+	for i := 0; i < numberOfTrials; i++ {
+		got, err := argmax(3, func(int) (float64, error) { return 1, nil })
+		if err != nil {
+			t.Fatalf("argmax: got error %v", err)
+		}
+		counts[got]++
+	}
+	for i, c := range counts {
+		// The standard deviation of each count is about 45.
+		if math.Abs(float64(c)-numberOfTrials/3) > 250 {
+			t.Errorf("argmax: selected tied candidate %d %d times out of %d, want about a third", i, c, numberOfTrials)
+		}
+	}
+}
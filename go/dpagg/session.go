@@ -0,0 +1,208 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// SessionBounder bounds contributions of privacy units (users) whose events
+// are grouped into sessions, like in most product analytics data. Bounding
+// happens at two levels:
+//   - at most MaxEventsPerSession events are kept for each session, and
+//   - at most MaxSessionsPerUser sessions are kept for each user.
+//
+// Kept events and sessions are chosen uniformly at random.
+//
+// After bounding, a user contributes at most
+// MaxEventsPerSession·MaxSessionsPerUser events, which is the sensitivity
+// multiplier to use when aggregating the kept events. PerUserSums and
+// PerUserCounts return the bounded contributions of each user pre-aggregated
+// into a single value, together with the bounds of that value, so they can be
+// passed to a BoundedSumFloat64 or a BoundedSumInt64 with one contribution per
+// user.
+//
+// A SessionBounder should be used for a single partition; contributions across
+// partitions are bounded separately (via MaxPartitionsContributed).
+//
+// Not thread-safe.
+type SessionBounder struct {
+	// Parameters
+	maxEventsPerSession int64
+	maxSessionsPerUser  int64
+
+	// State variables
+	users map[string]*userSessions
+	state aggregationState
+}
+
+// userSessions holds the sessions of a user, with a reservoir sample of
+// sessions and, within each session, a reservoir sample of events.
+type userSessions struct {
+	// Sampled sessions, in no particular order.
+	sessions []*session
+	// Index of each sampled session in sessions, by session ID.
+	indices map[string]int
+	// Number of distinct sessions seen so far, including those not sampled.
+	numSessions int64
+	// Session IDs that were seen but not sampled.
+	dropped map[string]bool
+}
+
+type session struct {
+	id        string
+	events    []float64
+	numEvents int64
+}
+
+// SessionBounderOptions contains the options necessary to initialize a SessionBounder.
+type SessionBounderOptions struct {
+	MaxEventsPerSession int64 // How many events of a single session are kept? Required.
+	MaxSessionsPerUser  int64 // How many sessions of a single user are kept? Required.
+}
+
+// NewSessionBounder returns a new SessionBounder.
+func NewSessionBounder(opt *SessionBounderOptions) (*SessionBounder, error) {
+	if opt == nil {
+		opt = &SessionBounderOptions{}
+	}
+	if opt.MaxEventsPerSession <= 0 {
+		return nil, fmt.Errorf("NewSessionBounder: MaxEventsPerSession is %d, must be strictly positive", opt.MaxEventsPerSession)
+	}
+	if opt.MaxSessionsPerUser <= 0 {
+		return nil, fmt.Errorf("NewSessionBounder: MaxSessionsPerUser is %d, must be strictly positive", opt.MaxSessionsPerUser)
+	}
+	if opt.MaxEventsPerSession > math.MaxInt64/opt.MaxSessionsPerUser {
+		return nil, fmt.Errorf("NewSessionBounder: MaxEventsPerSession = %d and MaxSessionsPerUser = %d are too high - the contribution bound overflows", opt.MaxEventsPerSession, opt.MaxSessionsPerUser)
+	}
+	return &SessionBounder{
+		maxEventsPerSession: opt.MaxEventsPerSession,
+		maxSessionsPerUser:  opt.MaxSessionsPerUser,
+		users:               make(map[string]*userSessions),
+		state:               defaultState,
+	}, nil
+}
+
+// MaxContributionsPerUser returns the maximum number of events kept for a
+// single user, i.e. MaxEventsPerSession·MaxSessionsPerUser.
+func (sb *SessionBounder) MaxContributionsPerUser() int64 {
+	return sb.maxEventsPerSession * sb.maxSessionsPerUser
+}
+
+// Add adds an event with the given value to the given session of the given user.
+func (sb *SessionBounder) Add(userID, sessionID string, value float64) error {
+	if sb.state != defaultState {
+		return fmt.Errorf("SessionBounder cannot be amended: %w", sb.state.transitionError(defaultState))
+	}
+	u, ok := sb.users[userID]
+	if !ok {
+		u = &userSessions{indices: make(map[string]int), dropped: make(map[string]bool)}
+		sb.users[userID] = u
+	}
+	if u.dropped[sessionID] {
+		return nil
+	}
+	i, ok := u.indices[sessionID]
+	if !ok {
+		// A new session: reservoir sampling over the sessions of the user.
+		u.numSessions++
+		s := &session{id: sessionID}
+		switch {
+		case int64(len(u.sessions)) < sb.maxSessionsPerUser:
+			i = len(u.sessions)
+			u.sessions = append(u.sessions, s)
+		case rand.I63n(u.numSessions) < sb.maxSessionsPerUser:
+			i = int(rand.I63n(sb.maxSessionsPerUser))
+			evicted := u.sessions[i]
+			delete(u.indices, evicted.id)
+			u.dropped[evicted.id] = true
+			u.sessions[i] = s
+		default:
+			u.dropped[sessionID] = true
+			return nil
+		}
+		u.indices[sessionID] = i
+	}
+	// Reservoir sampling over the events of the session.
+	s := u.sessions[i]
+	s.numEvents++
+	switch {
+	case int64(len(s.events)) < sb.maxEventsPerSession:
+		s.events = append(s.events, value)
+	case rand.I63n(s.numEvents) < sb.maxEventsPerSession:
+		s.events[rand.I63n(sb.maxEventsPerSession)] = value
+	}
+	return nil
+}
+
+// PerUserSums returns, for each user, the sum of the kept values after
+// clamping each of them to [lower, upper], together with the bounds of these
+// sums. The method can be called only once.
+//
+// The sums can be added to a BoundedSumFloat64 whose bounds are sumLower and
+// sumUpper, with one contribution per user.
+func (sb *SessionBounder) PerUserSums(lower, upper float64) (sums map[string]float64, sumLower, sumUpper float64, err error) {
+	if sb.state != defaultState {
+		return nil, 0, 0, fmt.Errorf("SessionBounder's per-user sums cannot be computed: %w", sb.state.transitionError(resultReturned))
+	}
+	if lower > upper {
+		return nil, 0, 0, fmt.Errorf("SessionBounder: lower (%f) must be lower than or equal to upper (%f)", lower, upper)
+	}
+	sb.state = resultReturned
+	sums = make(map[string]float64, len(sb.users))
+	for userID, u := range sb.users {
+		var sum float64
+		for _, s := range u.sessions {
+			for _, e := range s.events {
+				clamped, err := ClampFloat64(e, lower, upper)
+				if err != nil {
+					return nil, 0, 0, err
+				}
+				sum += clamped
+			}
+		}
+		sums[userID] = sum
+	}
+	// Users may contribute fewer events than the maximum, so the bounds must
+	// include 0.
+	n := float64(sb.MaxContributionsPerUser())
+	return sums, math.Min(0, n*lower), math.Max(0, n*upper), nil
+}
+
+// PerUserCounts returns, for each user, the number of kept events, together
+// with the largest possible count. The method can be called only once.
+//
+// The counts can be added to a BoundedSumInt64 whose bounds are 0 and
+// maxCount, with one contribution per user.
+func (sb *SessionBounder) PerUserCounts() (counts map[string]int64, maxCount int64, err error) {
+	if sb.state != defaultState {
+		return nil, 0, fmt.Errorf("SessionBounder's per-user counts cannot be computed: %w", sb.state.transitionError(resultReturned))
+	}
+	sb.state = resultReturned
+	counts = make(map[string]int64, len(sb.users))
+	for userID, u := range sb.users {
+		var count int64
+		for _, s := range u.sessions {
+			count += int64(len(s.events))
+		}
+		counts[userID] = count
+	}
+	return counts, sb.MaxContributionsPerUser(), nil
+}
@@ -0,0 +1,133 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewSessionBounderInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *SessionBounderOptions
+	}{
+		{"nil options", nil},
+		{"zero events per session", &SessionBounderOptions{MaxSessionsPerUser: 1}},
+		{"zero sessions per user", &SessionBounderOptions{MaxEventsPerSession: 1}},
+		{"overflowing contribution bound", &SessionBounderOptions{MaxEventsPerSession: math.MaxInt64, MaxSessionsPerUser: 2}},
+	} {
+		if _, err := NewSessionBounder(tc.opts); err == nil {
+			t.Errorf("NewSessionBounder: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSessionBounderPerUserCounts(t *testing.T) {
+	sb, err := NewSessionBounder(&SessionBounderOptions{MaxEventsPerSession: 3, MaxSessionsPerUser: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize session bounder: %v", err)
+	}
+	// user1 has 4 sessions of 5 events, user2 has 1 session of 2 events.
+	for s := 0; s < 4; s++ {
+		for e := 0; e < 5; e++ {
+			sb.Add("user1", fmt.Sprintf("session%d", s), 1)
+		}
+	}
+	sb.Add("user2", "session0", 1)
+	sb.Add("user2", "session0", 1)
+
+	counts, maxCount, err := sb.PerUserCounts()
+	if err != nil {
+		t.Fatalf("PerUserCounts: got error %v", err)
+	}
+	if maxCount != 6 {
+		t.Errorf("PerUserCounts: got max count %d, want 6", maxCount)
+	}
+	if counts["user1"] != 6 {
+		t.Errorf("PerUserCounts: got %d events for user1, want 6", counts["user1"])
+	}
+	if counts["user2"] != 2 {
+		t.Errorf("PerUserCounts: got %d events for user2, want 2", counts["user2"])
+	}
+}
+
+func TestSessionBounderPerUserSums(t *testing.T) {
+	sb, err := NewSessionBounder(&SessionBounderOptions{MaxEventsPerSession: 2, MaxSessionsPerUser: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize session bounder: %v", err)
+	}
+	sb.Add("user1", "a", 10) // clamped to 5
+	sb.Add("user1", "a", 1)
+	sb.Add("user1", "b", -10) // clamped to -1
+	sums, sumLower, sumUpper, err := sb.PerUserSums(-1, 5)
+	if err != nil {
+		t.Fatalf("PerUserSums: got error %v", err)
+	}
+	if sums["user1"] != 5 {
+		t.Errorf("PerUserSums: got sum %f for user1, want 5", sums["user1"])
+	}
+	if sumLower != -4 || sumUpper != 20 {
+		t.Errorf("PerUserSums: got bounds [%f, %f], want [-4, 20]", sumLower, sumUpper)
+	}
+}
+
+// Tests that the kept sessions are sampled uniformly at random.
+func TestSessionBounderSamplesSessionsUniformly(t *testing.T) {
+	const numberOfTrials = 4000
+	keptFirst := 0
+	for i := 0; i < numberOfTrials; i++ {
+		sb, err := NewSessionBounder(&SessionBounderOptions{MaxEventsPerSession: 1, MaxSessionsPerUser: 1})
+		if err != nil {
+			t.Fatalf("Couldn't initialize session bounder: %v", err)
+		}
+		for s := 0; s < 4; s++ {
+			// The value identifies the session.
+			sb.Add("user", fmt.Sprintf("session%d", s), float64(s))
+			// Subsequent events of a dropped session must be ignored.
+			sb.Add("user", fmt.Sprintf("session%d", s), float64(s))
+		}
+		sums, _, _, err := sb.PerUserSums(0, 10)
+		if err != nil {
+			t.Fatalf("PerUserSums: got error %v", err)
+		}
+		if sums["user"] == 0 {
+			keptFirst++
+		}
+	}
+	// The standard deviation of keptFirst is about 27.
+	if math.Abs(float64(keptFirst)-numberOfTrials/4) > 150 {
+		t.Errorf("kept the first session %d times out of %d, want about a quarter", keptFirst, numberOfTrials)
+	}
+}
+
+func TestSessionBounderStateChecks(t *testing.T) {
+	sb, err := NewSessionBounder(&SessionBounderOptions{MaxEventsPerSession: 1, MaxSessionsPerUser: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize session bounder: %v", err)
+	}
+	if _, _, err := sb.PerUserCounts(); err != nil {
+		t.Fatalf("PerUserCounts: got error %v", err)
+	}
+	if err := sb.Add("user", "session", 1); err == nil {
+		t.Errorf("Add: got no error after PerUserCounts, want error")
+	}
+	if _, _, _, err := sb.PerUserSums(0, 1); err == nil {
+		t.Errorf("PerUserSums: got no error after PerUserCounts, want error")
+	}
+}
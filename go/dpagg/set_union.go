@@ -0,0 +1,274 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// setUnionCutoffStdDevs is the number of standard deviations of the noise
+// between the release threshold and the cutoff of the policy: once the weight of
+// an item reaches the cutoff, it is likely to be released, and privacy units
+// spend their budget on their other items instead.
+const setUnionCutoffStdDevs = 3
+
+// SetUnion releases a differentially private subset of the union of the item
+// sets of privacy units, e.g. the vocabulary of the queries sent by users,
+// when the domain of the items is too large to be enumerated.
+//
+// It implements the policy mechanisms of Gopi et al.'s "Differentially Private
+// Set Union" (https://arxiv.org/abs/2002.09745). At most MaxItemsContributed
+// items of each privacy unit are kept, chosen uniformly at random. Privacy
+// units are then processed in a random order, and each privacy unit
+// distributes a total weight of 1 among its items, favoring the items whose
+// weight is the furthest from a cutoff above the release threshold: items
+// that are already likely to be released don't need more weight. The
+// distribution is an L_1 descent with Laplace noise and an L_2 descent with
+// Gaussian noise, so that the weights have an L_1 (respectively L_2)
+// sensitivity of 1. Finally, the weights are noised, and the items whose
+// noisy weight is above a threshold derived from δ are released.
+//
+// With Laplace noise, all of δ is used for thresholding. With Gaussian noise, δ
+// is split equally between noising and thresholding.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type SetUnion struct {
+	// Parameters
+	epsilon             float64
+	noiseDelta          float64
+	thresholdDelta      float64
+	maxItemsContributed int64
+	Noise               noise.Noise
+
+	// State variables
+	// Items of each privacy unit, with a reservoir sample of at most
+	// maxItemsContributed items.
+	users map[string]*userItems
+	state aggregationState
+}
+
+type userItems struct {
+	// Sampled items, in no particular order.
+	items []string
+	// Items seen so far, including those not sampled.
+	seen map[string]bool
+}
+
+// SetUnionOptions contains the options necessary to initialize a SetUnion.
+type SetUnionOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ, used for noising and thresholding. Required.
+	// How many distinct items may a single privacy unit contribute? Required.
+	MaxItemsContributed int64
+	// Type of noise used. Must be Laplace or Gaussian noise. Defaults to
+	// Laplace noise.
+	Noise noise.Noise
+}
+
+// NewSetUnion returns a new SetUnion without any item.
+func NewSetUnion(opt *SetUnionOptions) (*SetUnion, error) {
+	if opt == nil {
+		opt = &SetUnionOptions{}
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if opt.MaxItemsContributed <= 0 {
+		return nil, fmt.Errorf("NewSetUnion: MaxItemsContributed is %d, must be strictly positive", opt.MaxItemsContributed)
+	}
+	if err := checks.CheckDeltaStrict(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewSetUnion: %w", err)
+	}
+	var noiseDelta, thresholdDelta float64
+	switch noise.ToKind(n) {
+	case noise.LaplaceNoise, noise.GeometricNoise:
+		noiseDelta, thresholdDelta = 0, opt.Delta
+	case noise.GaussianNoise:
+		noiseDelta, thresholdDelta = opt.Delta/2, opt.Delta/2
+	default:
+		return nil, fmt.Errorf("NewSetUnion: Noise is %v, must be Laplace or Gaussian noise", n)
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseFloat64(0, 1, 1, opt.Epsilon, noiseDelta); err != nil {
+		return nil, fmt.Errorf("NewSetUnion: %w", err)
+	}
+
+	return &SetUnion{
+		epsilon:             opt.Epsilon,
+		noiseDelta:          noiseDelta,
+		thresholdDelta:      thresholdDelta,
+		maxItemsContributed: opt.MaxItemsContributed,
+		Noise:               n,
+		users:               make(map[string]*userItems),
+		state:               defaultState,
+	}, nil
+}
+
+// Add adds the given item to the item set of the given privacy unit. Adding an
+// item several times for the same privacy unit has no effect.
+func (su *SetUnion) Add(privacyID, item string) error {
+	if su.state != defaultState {
+		return fmt.Errorf("SetUnion cannot be amended: %w", su.state.transitionError(defaultState))
+	}
+	u, ok := su.users[privacyID]
+	if !ok {
+		u = &userItems{seen: make(map[string]bool)}
+		su.users[privacyID] = u
+	}
+	u.add(item, su.maxItemsContributed)
+	return nil
+}
+
+// Remove removes all the items of the given privacy unit, e.g. to honor a
+// deletion request that arrives before the result is computed. Removing a
+// privacy unit without items has no effect.
+func (su *SetUnion) Remove(privacyID string) error {
+	if su.state != defaultState {
+		return fmt.Errorf("SetUnion cannot be amended: %w", su.state.transitionError(defaultState))
+	}
+	delete(su.users, privacyID)
+	return nil
+}
+
+// add adds item to the items of the privacy unit, keeping a uniform sample of
+// at most maxItems distinct items.
+func (u *userItems) add(item string, maxItems int64) {
+	if u.seen[item] {
+		return
+	}
+	u.seen[item] = true
+	// Reservoir sampling over the distinct items of the privacy unit.
+	switch numItems := int64(len(u.seen)); {
+	case int64(len(u.items)) < maxItems:
+		u.items = append(u.items, item)
+	case rand.I63n(numItems) < maxItems:
+		u.items[rand.I63n(maxItems)] = item
+	}
+}
+
+// Result returns the released items, in lexicographic order. The method can
+// be called only once.
+func (su *SetUnion) Result() ([]string, error) {
+	if su.state != defaultState {
+		return nil, fmt.Errorf("SetUnion's noised result cannot be computed: %w", su.state.transitionError(resultReturned))
+	}
+	su.state = resultReturned
+
+	threshold, stdDev := su.threshold()
+	cutoff := threshold + setUnionCutoffStdDevs*stdDev
+	l2 := noise.ToKind(su.Noise) == noise.GaussianNoise
+
+	// Privacy units must be processed in a random order, since the weight a
+	// privacy unit gives to an item depends on the privacy units before it.
+	users := make([]*userItems, 0, len(su.users))
+	for _, u := range su.users {
+		users = append(users, u)
+	}
+	su.users = nil
+	for i := len(users) - 1; i > 0; i-- {
+		j := rand.I63n(int64(i) + 1)
+		users[i], users[j] = users[j], users[i]
+	}
+
+	weights := make(map[string]float64)
+	gaps := make([]float64, su.maxItemsContributed)
+	for _, u := range users {
+		var norm float64
+		for i, item := range u.items {
+			gaps[i] = math.Max(0, cutoff-weights[item])
+			if l2 {
+				norm += gaps[i] * gaps[i]
+			} else {
+				norm += gaps[i]
+			}
+		}
+		if l2 {
+			norm = math.Sqrt(norm)
+		}
+		if norm == 0 {
+			continue
+		}
+		// Move the weights of the items of the privacy unit towards the cutoff by
+		// a step of norm at most 1.
+		step := math.Min(1, norm) / norm
+		for i, item := range u.items {
+			weights[item] += gaps[i] * step
+		}
+	}
+
+	var result []string
+	for item, w := range weights {
+		noisedWeight, err := su.Noise.AddNoiseFloat64(w, 1, 1, su.epsilon, su.noiseDelta)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised weight of an item: %w", err)
+		}
+		if noisedWeight > threshold {
+			result = append(result, item)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// threshold returns the release threshold of the noisy weights, and the
+// standard deviation of the noise.
+//
+// The threshold ensures that the items that only a single privacy unit
+// contributes to are released with probability at most thresholdDelta. Such
+// items all have the same weight, at most 1/t with L_1 descent or 1/√t with
+// L_2 descent if there are t of them, so the threshold is the largest over t
+// of this weight plus the noise level that t independent noise samples all
+// stay below with probability 1-thresholdDelta.
+func (su *SetUnion) threshold() (threshold, stdDev float64) {
+	l2 := noise.ToKind(su.Noise) == noise.GaussianNoise
+	var sigma, scale float64
+	if l2 {
+		sigma = noise.SigmaForGaussian(1, 1, su.epsilon, su.noiseDelta)
+		stdDev = sigma
+	} else {
+		scale = 1 / su.epsilon
+		stdDev = math.Sqrt2 * scale
+	}
+	threshold = math.Inf(-1)
+	for t := int64(1); t <= su.maxItemsContributed; t++ {
+		// Probability that a single noise sample exceeds the noise level,
+		// 1-(1-δ)^(1/t), computed accurately for small δ.
+		p := -math.Expm1(math.Log1p(-su.thresholdDelta) / float64(t))
+		var weight, level float64
+		if l2 {
+			weight = 1 / math.Sqrt(float64(t))
+			level = sigma * math.Sqrt2 * math.Erfcinv(2*p)
+		} else {
+			weight = 1 / float64(t)
+			level = scale * math.Log(1/(2*p))
+		}
+		threshold = math.Max(threshold, weight+level)
+	}
+	return threshold, stdDev
+}
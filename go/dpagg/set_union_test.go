@@ -0,0 +1,175 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSetUnionInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *SetUnionOptions
+	}{
+		{"nil options", nil},
+		{"no max items", &SetUnionOptions{Epsilon: ln3, Delta: 1e-5}},
+		{"zero epsilon", &SetUnionOptions{Delta: 1e-5, MaxItemsContributed: 1}},
+		{"zero delta", &SetUnionOptions{Epsilon: ln3, MaxItemsContributed: 1}},
+		{"unsupported noise", &SetUnionOptions{Epsilon: ln3, Delta: 1e-5, MaxItemsContributed: 1, Noise: noNoise{}}},
+	} {
+		if _, err := NewSetUnion(tc.opts); err == nil {
+			t.Errorf("NewSetUnion: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSetUnionReleasesCommonItems(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		noise noise.Noise
+	}{
+		{"Laplace noise", noise.Laplace()},
+		{"Gaussian noise", noise.Gaussian()},
+	} {
+		su, err := NewSetUnion(&SetUnionOptions{Epsilon: ln3, Delta: 1e-5, MaxItemsContributed: 2, Noise: tc.noise})
+		if err != nil {
+			t.Fatalf("With %s, couldn't initialize SetUnion: %v", tc.desc, err)
+		}
+		for i := 0; i < 1000; i++ {
+			id := fmt.Sprintf("user%d", i)
+			su.Add(id, "common")
+			su.Add(id, "common") // Duplicates have no effect.
+			su.Add(id, fmt.Sprintf("rare%d", i))
+		}
+		got, err := su.Result()
+		if err != nil {
+			t.Fatalf("With %s, Result: got error %v", tc.desc, err)
+		}
+		// Each rare item has a weight of at most 1, well below the threshold.
+		if diff := cmp.Diff([]string{"common"}, got); diff != "" {
+			t.Errorf("With %s, Result: got diff (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
+func TestSetUnionBoundsItemsPerPrivacyUnit(t *testing.T) {
+	su, err := NewSetUnion(&SetUnionOptions{Epsilon: 1e6, Delta: 1e-5, MaxItemsContributed: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SetUnion: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		su.Add("alice", fmt.Sprintf("item%d", i))
+	}
+	if got := len(su.users["alice"].items); got != 2 {
+		t.Errorf("Add: got %d items kept for a privacy unit, want 2", got)
+	}
+}
+
+func TestSetUnionRemove(t *testing.T) {
+	su, err := NewSetUnion(&SetUnionOptions{Epsilon: ln3, Delta: 1e-5, MaxItemsContributed: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SetUnion: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		su.Add(fmt.Sprintf("user%d", i), "common")
+	}
+	su.Add("alice", "secret")
+	if err := su.Remove("alice"); err != nil {
+		t.Fatalf("Remove: got error %v", err)
+	}
+	if _, ok := su.users["alice"]; ok {
+		t.Errorf("Remove: the items of the privacy unit are still kept")
+	}
+	got, err := su.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if diff := cmp.Diff([]string{"common"}, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+	if err := su.Remove("user0"); err == nil {
+		t.Errorf("Remove after Result: got no error, want error")
+	}
+}
+
+// Tests that items of a single privacy unit are released with a probability of
+// at most δ, even when the privacy unit has a single item, which then gets the
+// full weight of 1.
+func TestSetUnionUniqueItemsAreRarelyReleased(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		noise noise.Noise
+	}{
+		{"Laplace noise", noise.Laplace()},
+		{"Gaussian noise", noise.Gaussian()},
+	} {
+		released := 0
+		for i := 0; i < 1000; i++ {
+			su, err := NewSetUnion(&SetUnionOptions{Epsilon: ln3, Delta: 1e-3, MaxItemsContributed: 3, Noise: tc.noise})
+			if err != nil {
+				t.Fatalf("With %s, couldn't initialize SetUnion: %v", tc.desc, err)
+			}
+			su.Add("alice", "a")
+			got, err := su.Result()
+			if err != nil {
+				t.Fatalf("With %s, Result: got error %v", tc.desc, err)
+			}
+			released += len(got)
+		}
+		// The expected number of releases is at most 1, so 10 releases have a
+		// negligible probability.
+		if released >= 10 {
+			t.Errorf("With %s, the item was released %d times out of 1000, want fewer than 10", tc.desc, released)
+		}
+	}
+}
+
+func TestSetUnionThreshold(t *testing.T) {
+	su, err := NewSetUnion(&SetUnionOptions{Epsilon: ln3, Delta: 1e-5, MaxItemsContributed: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SetUnion: %v", err)
+	}
+	// With a single item, the threshold is 1+log(1/(2δ))/ε.
+	threshold, stdDev := su.threshold()
+	if want := 1 + math.Log(1/(2*1e-5))/ln3; math.Abs(threshold-want) > 1e-6 {
+		t.Errorf("threshold: got %f, want %f", threshold, want)
+	}
+	if want := math.Sqrt2 / ln3; !ApproxEqual(stdDev, want) {
+		t.Errorf("threshold: got standard deviation %f, want %f", stdDev, want)
+	}
+}
+
+func TestSetUnionResultCalledTwice(t *testing.T) {
+	su, err := NewSetUnion(&SetUnionOptions{Epsilon: ln3, Delta: 1e-5, MaxItemsContributed: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SetUnion: %v", err)
+	}
+	if _, err := su.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if _, err := su.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := su.Add("alice", "a"); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
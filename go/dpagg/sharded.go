@@ -0,0 +1,190 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+)
+
+// The sharded aggregations below let multiple goroutines aggregate
+// contributions concurrently without synchronization. A sharded aggregation
+// holds numShards identically initialized aggregations; each goroutine adds
+// contributions to its own shard, which it obtains with Shard, and once all
+// goroutines are done, Merged merges all shards into one aggregation whose
+// result can be computed.
+//
+// Shard(i) must only be used by one goroutine at a time, and Merged must only
+// be called after all goroutines are done adding contributions, e.g. after a
+// sync.WaitGroup's Wait. As shards are merged before noise is added, the
+// result is the same as the one of a single aggregation that received all
+// contributions, and doesn't use more privacy budget.
+
+// ShardedCount is a sharded Count, see above.
+type ShardedCount struct {
+	shards []*Count
+	merged bool
+}
+
+// NewShardedCount returns a new ShardedCount with numShards shards, each
+// initialized with opt.
+func NewShardedCount(opt *CountOptions, numShards int) (*ShardedCount, error) {
+	if err := checkNumShards(numShards); err != nil {
+		return nil, fmt.Errorf("NewShardedCount: %w", err)
+	}
+	shards := make([]*Count, numShards)
+	for i := range shards {
+		c, err := NewCount(opt)
+		if err != nil {
+			return nil, fmt.Errorf("NewShardedCount: %w", err)
+		}
+		shards[i] = c
+	}
+	return &ShardedCount{shards: shards}, nil
+}
+
+// Shard returns the i-th shard, for i in [0, numShards).
+func (sc *ShardedCount) Shard(i int) *Count {
+	return sc.shards[i]
+}
+
+// Merged merges all shards into the first one and returns it. The method can
+// be called only once; afterwards, the shards may not be used.
+func (sc *ShardedCount) Merged() (*Count, error) {
+	if sc.merged {
+		return nil, fmt.Errorf("ShardedCount: shards have already been merged")
+	}
+	sc.merged = true
+	for _, c := range sc.shards[1:] {
+		if err := sc.shards[0].Merge(c); err != nil {
+			return nil, fmt.Errorf("ShardedCount: %w", err)
+		}
+	}
+	return sc.shards[0], nil
+}
+
+// ShardedBoundedSum is a sharded BoundedSum, see above.
+type ShardedBoundedSum[T Number] struct {
+	shards []*BoundedSum[T]
+	merged bool
+}
+
+// ShardedBoundedSumInt64 is a sharded BoundedSumInt64, see above.
+type ShardedBoundedSumInt64 = ShardedBoundedSum[int64]
+
+// ShardedBoundedSumFloat64 is a sharded BoundedSumFloat64, see above.
+type ShardedBoundedSumFloat64 = ShardedBoundedSum[float64]
+
+// NewShardedBoundedSumInt64 returns a new ShardedBoundedSumInt64 with
+// numShards shards, each initialized with opt.
+func NewShardedBoundedSumInt64(opt *BoundedSumInt64Options, numShards int) (*ShardedBoundedSumInt64, error) {
+	return NewShardedBoundedSum(opt, numShards)
+}
+
+// NewShardedBoundedSumFloat64 returns a new ShardedBoundedSumFloat64 with
+// numShards shards, each initialized with opt.
+func NewShardedBoundedSumFloat64(opt *BoundedSumFloat64Options, numShards int) (*ShardedBoundedSumFloat64, error) {
+	return NewShardedBoundedSum(opt, numShards)
+}
+
+// NewShardedBoundedSum returns a new ShardedBoundedSum with numShards shards,
+// each initialized with opt.
+func NewShardedBoundedSum[T Number](opt *BoundedSumOptions[T], numShards int) (*ShardedBoundedSum[T], error) {
+	name := "NewSharded" + bsName[T]()
+	if err := checkNumShards(numShards); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	shards := make([]*BoundedSum[T], numShards)
+	for i := range shards {
+		bs, err := NewBoundedSum(opt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		shards[i] = bs
+	}
+	return &ShardedBoundedSum[T]{shards: shards}, nil
+}
+
+// Shard returns the i-th shard, for i in [0, numShards).
+func (sbs *ShardedBoundedSum[T]) Shard(i int) *BoundedSum[T] {
+	return sbs.shards[i]
+}
+
+// Merged merges all shards into the first one and returns it. The method can
+// be called only once; afterwards, the shards may not be used.
+func (sbs *ShardedBoundedSum[T]) Merged() (*BoundedSum[T], error) {
+	name := "Sharded" + bsName[T]()
+	if sbs.merged {
+		return nil, fmt.Errorf("%s: shards have already been merged", name)
+	}
+	sbs.merged = true
+	for _, bs := range sbs.shards[1:] {
+		if err := sbs.shards[0].Merge(bs); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return sbs.shards[0], nil
+}
+
+// ShardedBoundedMeanFloat64 is a sharded BoundedMeanFloat64, see above.
+type ShardedBoundedMeanFloat64 struct {
+	shards []*BoundedMeanFloat64
+	merged bool
+}
+
+// NewShardedBoundedMeanFloat64 returns a new ShardedBoundedMeanFloat64 with
+// numShards shards, each initialized with opt.
+func NewShardedBoundedMeanFloat64(opt *BoundedMeanFloat64Options, numShards int) (*ShardedBoundedMeanFloat64, error) {
+	if err := checkNumShards(numShards); err != nil {
+		return nil, fmt.Errorf("NewShardedBoundedMeanFloat64: %w", err)
+	}
+	shards := make([]*BoundedMeanFloat64, numShards)
+	for i := range shards {
+		bm, err := NewBoundedMeanFloat64(opt)
+		if err != nil {
+			return nil, fmt.Errorf("NewShardedBoundedMeanFloat64: %w", err)
+		}
+		shards[i] = bm
+	}
+	return &ShardedBoundedMeanFloat64{shards: shards}, nil
+}
+
+// Shard returns the i-th shard, for i in [0, numShards).
+func (sbm *ShardedBoundedMeanFloat64) Shard(i int) *BoundedMeanFloat64 {
+	return sbm.shards[i]
+}
+
+// Merged merges all shards into the first one and returns it. The method can
+// be called only once; afterwards, the shards may not be used.
+func (sbm *ShardedBoundedMeanFloat64) Merged() (*BoundedMeanFloat64, error) {
+	if sbm.merged {
+		return nil, fmt.Errorf("ShardedBoundedMeanFloat64: shards have already been merged")
+	}
+	sbm.merged = true
+	for _, bm := range sbm.shards[1:] {
+		if err := sbm.shards[0].Merge(bm); err != nil {
+			return nil, fmt.Errorf("ShardedBoundedMeanFloat64: %w", err)
+		}
+	}
+	return sbm.shards[0], nil
+}
+
+func checkNumShards(numShards int) error {
+	if numShards <= 0 {
+		return fmt.Errorf("numShards is %d, must be strictly positive", numShards)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"sync"
+	"testing"
+)
+
+const (
+	testNumShards          = 8
+	testContributionsShard = 1000
+)
+
+// addConcurrently calls add(i) testContributionsShard times from one goroutine
+// per shard i, and waits for all goroutines to be done.
+func addConcurrently(add func(shard int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < testNumShards; i++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			for j := 0; j < testContributionsShard; j++ {
+				add(shard)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestShardedCount(t *testing.T) {
+	sc, err := NewShardedCount(&CountOptions{Epsilon: ln3, Noise: noNoise{}}, testNumShards)
+	if err != nil {
+		t.Fatalf("Couldn't initialize sharded count: %v", err)
+	}
+	addConcurrently(func(shard int) { sc.Shard(shard).Increment() })
+	c, err := sc.Merged()
+	if err != nil {
+		t.Fatalf("Merged: got error %v", err)
+	}
+	got, err := c.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if want := int64(testNumShards * testContributionsShard); got != want {
+		t.Errorf("Result: got %d, want %d", got, want)
+	}
+	if _, err := sc.Merged(); err == nil {
+		t.Errorf("Merged: got no error when called twice, want error")
+	}
+}
+
+func TestShardedBoundedSumInt64(t *testing.T) {
+	sbs, err := NewShardedBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, MaxPartitionsContributed: 1, Lower: 0, Upper: 5, Noise: noNoise{}}, testNumShards)
+	if err != nil {
+		t.Fatalf("Couldn't initialize sharded sum: %v", err)
+	}
+	addConcurrently(func(shard int) { sbs.Shard(shard).Add(int64(shard)) })
+	bs, err := sbs.Merged()
+	if err != nil {
+		t.Fatalf("Merged: got error %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// Shards 0 to 5 add their index, shards 6 and 7 are clamped to 5.
+	if want := int64((0 + 1 + 2 + 3 + 4 + 5 + 5 + 5) * testContributionsShard); got != want {
+		t.Errorf("Result: got %d, want %d", got, want)
+	}
+}
+
+func TestShardedBoundedSumFloat64(t *testing.T) {
+	sbs, err := NewShardedBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, MaxPartitionsContributed: 1, Lower: 0, Upper: 1, Noise: noNoise{}}, testNumShards)
+	if err != nil {
+		t.Fatalf("Couldn't initialize sharded sum: %v", err)
+	}
+	addConcurrently(func(shard int) { sbs.Shard(shard).Add(0.5) })
+	bs, err := sbs.Merged()
+	if err != nil {
+		t.Fatalf("Merged: got error %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if want := 0.5 * testNumShards * testContributionsShard; !ApproxEqual(got, want) {
+		t.Errorf("Result: got %f, want %f", got, want)
+	}
+}
+
+func TestShardedBoundedMeanFloat64(t *testing.T) {
+	sbm, err := NewShardedBoundedMeanFloat64(&BoundedMeanFloat64Options{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        float64(testNumShards - 1),
+		Noise:                        noNoise{},
+	}, testNumShards)
+	if err != nil {
+		t.Fatalf("Couldn't initialize sharded mean: %v", err)
+	}
+	addConcurrently(func(shard int) { sbm.Shard(shard).Add(float64(shard)) })
+	bm, err := sbm.Merged()
+	if err != nil {
+		t.Fatalf("Merged: got error %v", err)
+	}
+	got, err := bm.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if want := float64(testNumShards-1) / 2; !ApproxEqual(got, want) {
+		t.Errorf("Result: got %f, want %f", got, want)
+	}
+}
+
+func TestNewShardedCountInvalidNumShards(t *testing.T) {
+	for _, numShards := range []int{0, -1} {
+		if _, err := NewShardedCount(&CountOptions{Epsilon: ln3}, numShards); err == nil {
+			t.Errorf("NewShardedCount: with %d shards got no error, want error", numShards)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// The sliding-window aggregations below maintain differentially private
+// results over a window of the latest WindowSize buckets of time, e.g. the last
+// 24 hours with hourly buckets. Contributions are added to the current bucket,
+// and Advance closes it and starts a new one. A bucket is noised once, when it
+// is closed, and the result over the window is the sum of the noisy results of
+// its closed buckets, so it can be computed after each call to Advance without
+// further privacy loss. Buckets older than the window are retired and their
+// contributions discarded.
+//
+// A privacy unit may contribute to at most MaxBucketsContributed buckets over
+// the whole lifetime of the aggregation, in each of at most
+// MaxPartitionsContributed partitions, and the noise of each bucket is scaled
+// accordingly: the whole sequence of results is (ε,δ)-differentially private,
+// however many times the window is advanced.
+
+// SlidingWindowCount is a Count over a sliding window of buckets, see above.
+//
+// Not thread-safe.
+type SlidingWindowCount struct {
+	// Parameters
+	opt        CountOptions
+	windowSize int
+
+	// State variables
+	current *Count
+	// Noisy counts of the closed buckets in the window, oldest first.
+	noisyCounts []int64
+}
+
+// SlidingWindowCountOptions contains the options necessary to initialize a
+// SlidingWindowCount.
+type SlidingWindowCountOptions struct {
+	Epsilon                  float64     // Privacy parameter ε of all results. Required.
+	Delta                    float64     // Privacy parameter δ of all results. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed int64       // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	MaxBucketsContributed    int64       // How many distinct buckets may a single privacy unit contribute to? Defaults to 1.
+	WindowSize               int         // Number of closed buckets in the window. Required.
+	Noise                    noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewSlidingWindowCount returns a new SlidingWindowCount with an empty window.
+func NewSlidingWindowCount(opt *SlidingWindowCountOptions) (*SlidingWindowCount, error) {
+	if opt == nil {
+		opt = &SlidingWindowCountOptions{}
+	}
+	l0, err := slidingWindowL0(opt.WindowSize, opt.MaxPartitionsContributed, opt.MaxBucketsContributed)
+	if err != nil {
+		return nil, fmt.Errorf("NewSlidingWindowCount: %w", err)
+	}
+	countOpt := CountOptions{
+		Epsilon:                  opt.Epsilon,
+		Delta:                    opt.Delta,
+		MaxPartitionsContributed: l0,
+		Noise:                    opt.Noise,
+	}
+	c, err := NewCount(&countOpt)
+	if err != nil {
+		return nil, fmt.Errorf("NewSlidingWindowCount: %w", err)
+	}
+	return &SlidingWindowCount{
+		opt:        countOpt,
+		windowSize: opt.WindowSize,
+		current:    c,
+	}, nil
+}
+
+// slidingWindowL0 checks the parameters of a sliding-window aggregation and
+// returns the number of buckets and partitions a single privacy unit may
+// contribute to.
+func slidingWindowL0(windowSize int, maxPartitionsContributed, maxBucketsContributed int64) (int64, error) {
+	if windowSize <= 0 {
+		return 0, fmt.Errorf("WindowSize is %d, must be strictly positive", windowSize)
+	}
+	if maxPartitionsContributed == 0 {
+		maxPartitionsContributed = 1
+	}
+	if maxBucketsContributed == 0 {
+		maxBucketsContributed = 1
+	}
+	if maxPartitionsContributed < 0 || maxBucketsContributed < 0 {
+		return 0, fmt.Errorf("MaxPartitionsContributed = %d and MaxBucketsContributed = %d must be strictly positive", maxPartitionsContributed, maxBucketsContributed)
+	}
+	if maxPartitionsContributed > math.MaxInt64/maxBucketsContributed {
+		return 0, fmt.Errorf("MaxPartitionsContributed = %d and MaxBucketsContributed = %d are too high - the contribution bound overflows", maxPartitionsContributed, maxBucketsContributed)
+	}
+	return maxPartitionsContributed * maxBucketsContributed, nil
+}
+
+// Increment increments the count of the current bucket by one.
+func (sw *SlidingWindowCount) Increment() error {
+	return sw.IncrementBy(1)
+}
+
+// IncrementBy increments the count of the current bucket by the given value.
+// Note that this shouldn't be used to count multiple contributions to a
+// single partition from the same privacy unit.
+func (sw *SlidingWindowCount) IncrementBy(count int64) error {
+	return sw.current.IncrementBy(count)
+}
+
+// Advance closes the current bucket, adding its noisy count to the window and
+// retiring the oldest bucket if the window is full, and starts a new bucket.
+func (sw *SlidingWindowCount) Advance() error {
+	noisyCount, err := sw.current.Result()
+	if err != nil {
+		return fmt.Errorf("couldn't compute noisy count of bucket for SlidingWindowCount: %w", err)
+	}
+	sw.noisyCounts = append(sw.noisyCounts, noisyCount)
+	if len(sw.noisyCounts) > sw.windowSize {
+		sw.noisyCounts = sw.noisyCounts[1:]
+	}
+	sw.current, err = NewCount(&sw.opt)
+	return err
+}
+
+// Result returns a differentially private estimate of the count over the
+// closed buckets of the window, which are fewer than WindowSize until Advance
+// has been called WindowSize times. Contributions to the current bucket are
+// not included. Unlike for Count, the method can be called any number of
+// times, since it only post-processes the noisy counts of the buckets.
+func (sw *SlidingWindowCount) Result() int64 {
+	var result int64
+	for _, c := range sw.noisyCounts {
+		result += c
+	}
+	return result
+}
+
+// SlidingWindowBoundedSum is a BoundedSum over a sliding window of buckets,
+// see above.
+//
+// Not thread-safe.
+type SlidingWindowBoundedSum[T Number] struct {
+	// Parameters
+	opt        BoundedSumOptions[T]
+	windowSize int
+
+	// State variables
+	current *BoundedSum[T]
+	// Noisy sums of the closed buckets in the window, oldest first.
+	noisySums []T
+}
+
+// SlidingWindowBoundedSumOptions contains the options necessary to initialize
+// a SlidingWindowBoundedSum.
+type SlidingWindowBoundedSumOptions[T Number] struct {
+	Epsilon                  float64 // Privacy parameter ε of all results. Required.
+	Delta                    float64 // Privacy parameter δ of all results. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
+	MaxBucketsContributed    int64   // How many distinct buckets may a single privacy unit contribute to? Defaults to 1.
+	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower <= Upper.
+	Lower, Upper T
+	WindowSize   int         // Number of closed buckets in the window. Required.
+	Noise        noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewSlidingWindowBoundedSum returns a new SlidingWindowBoundedSum with an
+// empty window.
+func NewSlidingWindowBoundedSum[T Number](opt *SlidingWindowBoundedSumOptions[T]) (*SlidingWindowBoundedSum[T], error) {
+	if opt == nil {
+		opt = &SlidingWindowBoundedSumOptions[T]{}
+	}
+	l0, err := slidingWindowL0(opt.WindowSize, opt.MaxPartitionsContributed, opt.MaxBucketsContributed)
+	if err != nil {
+		return nil, fmt.Errorf("NewSlidingWindowBoundedSum: %w", err)
+	}
+	sumOpt := BoundedSumOptions[T]{
+		Epsilon:                  opt.Epsilon,
+		Delta:                    opt.Delta,
+		MaxPartitionsContributed: l0,
+		Lower:                    opt.Lower,
+		Upper:                    opt.Upper,
+		Noise:                    opt.Noise,
+	}
+	bs, err := NewBoundedSum(&sumOpt)
+	if err != nil {
+		return nil, fmt.Errorf("NewSlidingWindowBoundedSum: %w", err)
+	}
+	return &SlidingWindowBoundedSum[T]{
+		opt:        sumOpt,
+		windowSize: opt.WindowSize,
+		current:    bs,
+	}, nil
+}
+
+// Add adds a new summand to the current bucket.
+func (sw *SlidingWindowBoundedSum[T]) Add(e T) error {
+	return sw.current.Add(e)
+}
+
+// Advance closes the current bucket, adding its noisy sum to the window and
+// retiring the oldest bucket if the window is full, and starts a new bucket.
+func (sw *SlidingWindowBoundedSum[T]) Advance() error {
+	noisySum, err := sw.current.Result()
+	if err != nil {
+		return fmt.Errorf("couldn't compute noisy sum of bucket for SlidingWindowBoundedSum: %w", err)
+	}
+	sw.noisySums = append(sw.noisySums, noisySum)
+	if len(sw.noisySums) > sw.windowSize {
+		sw.noisySums = sw.noisySums[1:]
+	}
+	sw.current, err = NewBoundedSum(&sw.opt)
+	return err
+}
+
+// Result returns a differentially private estimate of the sum over the closed
+// buckets of the window, see SlidingWindowCount.Result.
+func (sw *SlidingWindowBoundedSum[T]) Result() T {
+	var result T
+	for _, s := range sw.noisySums {
+		result += s
+	}
+	return result
+}
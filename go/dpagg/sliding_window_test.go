@@ -0,0 +1,120 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+)
+
+func TestNewSlidingWindowCountInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *SlidingWindowCountOptions
+	}{
+		{"nil options", nil},
+		{"zero window size", &SlidingWindowCountOptions{Epsilon: ln3}},
+		{"zero epsilon", &SlidingWindowCountOptions{WindowSize: 24}},
+		{"negative MaxBucketsContributed", &SlidingWindowCountOptions{Epsilon: ln3, WindowSize: 24, MaxBucketsContributed: -1}},
+		{"overflowing contribution bound", &SlidingWindowCountOptions{Epsilon: ln3, WindowSize: 24, MaxBucketsContributed: 1 << 40, MaxPartitionsContributed: 1 << 40}},
+	} {
+		if _, err := NewSlidingWindowCount(tc.opts); err == nil {
+			t.Errorf("NewSlidingWindowCount: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSlidingWindowCountSensitivity(t *testing.T) {
+	sw, err := NewSlidingWindowCount(&SlidingWindowCountOptions{Epsilon: ln3, WindowSize: 24, MaxPartitionsContributed: 2, MaxBucketsContributed: 3})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sliding window count: %v", err)
+	}
+	if sw.current.l0Sensitivity != 6 {
+		t.Errorf("NewSlidingWindowCount: got l0Sensitivity %d for each bucket, want 6", sw.current.l0Sensitivity)
+	}
+}
+
+func TestSlidingWindowCountRetiresBuckets(t *testing.T) {
+	sw, err := NewSlidingWindowCount(&SlidingWindowCountOptions{Epsilon: ln3, WindowSize: 3, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sliding window count: %v", err)
+	}
+	for i, want := range []int64{
+		1,         // buckets {1}
+		1 + 2,     // buckets {1, 2}
+		1 + 2 + 3, // buckets {1, 2, 3}
+		2 + 3 + 4, // bucket 1 is retired
+		3 + 4 + 5, // bucket 2 is retired
+	} {
+		if err := sw.IncrementBy(int64(i + 1)); err != nil {
+			t.Fatalf("Couldn't increment sliding window count: %v", err)
+		}
+		if err := sw.Advance(); err != nil {
+			t.Fatalf("Couldn't advance sliding window count: %v", err)
+		}
+		if got := sw.Result(); got != want {
+			t.Errorf("Result: after %d buckets got %d, want %d", i+1, got, want)
+		}
+	}
+	// Contributions to the current bucket aren't included until it is closed.
+	sw.IncrementBy(100)
+	if got, want := sw.Result(), int64(3+4+5); got != want {
+		t.Errorf("Result: with an open bucket got %d, want %d", got, want)
+	}
+}
+
+func TestNewSlidingWindowBoundedSumInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *SlidingWindowBoundedSumOptions[float64]
+	}{
+		{"nil options", nil},
+		{"zero window size", &SlidingWindowBoundedSumOptions[float64]{Epsilon: ln3, Lower: 0, Upper: 1}},
+		{"lower larger than upper", &SlidingWindowBoundedSumOptions[float64]{Epsilon: ln3, WindowSize: 24, Lower: 1, Upper: 0}},
+	} {
+		if _, err := NewSlidingWindowBoundedSum(tc.opts); err == nil {
+			t.Errorf("NewSlidingWindowBoundedSum: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSlidingWindowBoundedSumRetiresBuckets(t *testing.T) {
+	sw, err := NewSlidingWindowBoundedSum(&SlidingWindowBoundedSumOptions[float64]{Epsilon: ln3, WindowSize: 2, Lower: 0, Upper: 5, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sliding window sum: %v", err)
+	}
+	for i, tc := range []struct {
+		entries []float64
+		want    float64
+	}{
+		{[]float64{1, 2}, 3},
+		{[]float64{10}, 3 + 5}, // 10 is clamped to 5
+		{[]float64{0.5}, 5 + 0.5},
+		{nil, 0.5},
+	} {
+		for _, e := range tc.entries {
+			if err := sw.Add(e); err != nil {
+				t.Fatalf("Couldn't add entry: %v", err)
+			}
+		}
+		if err := sw.Advance(); err != nil {
+			t.Fatalf("Couldn't advance sliding window sum: %v", err)
+		}
+		if got := sw.Result(); !ApproxEqual(got, tc.want) {
+			t.Errorf("Result: after %d buckets got %f, want %f", i+1, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// SparseCountMap calculates differentially private counts of many keys, e.g.
+// the groups of a group-by with millions of keys.
+//
+// Unlike a map of Count, which holds the parameters and state of a Count for
+// each key, SparseCountMap only stores the raw count of each key that was
+// added, next to a single set of parameters shared by all keys. The counts are
+// noised, and thresholded if the keys are not public, only at release time,
+// one key at a time.
+//
+// If PublicKeys is not set, the keys are derived from the data, and the keys
+// whose noisy count is below a threshold derived from δ are suppressed, as in
+// Histogram. With Laplace noise, all of δ is then used for thresholding, and
+// with Gaussian or discrete Gaussian noise, δ is split equally between noising
+// and thresholding. If
+// PublicKeys is set, exactly these keys are released, without thresholding, and
+// all of δ is used for noising.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type SparseCountMap[K comparable] struct {
+	// Parameters
+	epsilon         float64
+	noiseDelta      float64
+	thresholdDelta  float64
+	l0Sensitivity   int64
+	lInfSensitivity int64
+	Noise           noise.Noise
+	noiseKind       noise.Kind
+	publicKeys      []K // nil if the keys are derived from the data
+
+	// State variables
+	counts map[K]int64
+	state  aggregationState
+}
+
+// SparseCountMapOptions contains the options necessary to initialize a
+// SparseCountMap.
+type SparseCountMapOptions[K comparable] struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	// Privacy parameter δ. Required, unless PublicKeys is set and the noise is
+	// Laplace noise.
+	Delta float64
+	// How many distinct keys may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single key? Defaults to 1.
+	MaxContributionsPerPartition int64
+	Noise                        noise.Noise // Type of noise used. Defaults to Laplace noise.
+	// The keys to release, if they are known in advance. Optional. Contributions
+	// to other keys are discarded at release time.
+	PublicKeys []K
+}
+
+// NewSparseCountMap returns a new SparseCountMap without any key.
+func NewSparseCountMap[K comparable](opt *SparseCountMapOptions[K]) (*SparseCountMap[K], error) {
+	if opt == nil {
+		opt = &SparseCountMapOptions[K]{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	noiseDelta, thresholdDelta := opt.Delta, 0.0
+	if opt.PublicKeys == nil {
+		if err := checks.CheckDeltaStrict(opt.Delta); err != nil {
+			return nil, fmt.Errorf("NewSparseCountMap: %w", err)
+		}
+		noiseDelta, thresholdDelta = 0.0, opt.Delta
+		if noise.NeedsDelta(noise.ToKind(n)) {
+			noiseDelta, thresholdDelta = opt.Delta/2, opt.Delta/2
+		}
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, l0, lInf, opt.Epsilon, noiseDelta); err != nil {
+		return nil, fmt.Errorf("NewSparseCountMap: %w", err)
+	}
+	if opt.PublicKeys == nil {
+		if _, err := n.Threshold(l0, float64(lInf), opt.Epsilon, noiseDelta, thresholdDelta); err != nil {
+			return nil, fmt.Errorf("NewSparseCountMap: %w", err)
+		}
+	}
+
+	return &SparseCountMap[K]{
+		epsilon:         opt.Epsilon,
+		noiseDelta:      noiseDelta,
+		thresholdDelta:  thresholdDelta,
+		l0Sensitivity:   l0,
+		lInfSensitivity: lInf,
+		Noise:           n,
+		noiseKind:       noise.ToKind(n),
+		publicKeys:      opt.PublicKeys,
+		counts:          make(map[K]int64),
+		state:           defaultState,
+	}, nil
+}
+
+// Increment increments the count of the given key by one.
+func (m *SparseCountMap[K]) Increment(key K) error {
+	return m.IncrementBy(key, 1)
+}
+
+// IncrementBy increments the count of the given key by the given value. Note
+// that the total contribution of a privacy unit to a single key must not
+// exceed MaxContributionsPerPartition, and that a privacy unit must not
+// contribute to more than MaxPartitionsContributed keys.
+func (m *SparseCountMap[K]) IncrementBy(key K, count int64) error {
+	if m.state != defaultState {
+		return fmt.Errorf("SparseCountMap cannot be amended: %w", m.state.transitionError(defaultState))
+	}
+	m.counts[key] += count
+	return nil
+}
+
+// Len returns the number of keys whose raw count is stored, i.e. the keys that
+// were incremented so far.
+func (m *SparseCountMap[K]) Len() int {
+	return len(m.counts)
+}
+
+// Merge merges m2 into m, summing up the counts of their keys. The two maps
+// must have been initialized with the same parameters.
+//
+// m2 is consumed by this operation: it may not be used after it is merged
+// into m.
+func (m *SparseCountMap[K]) Merge(m2 *SparseCountMap[K]) error {
+	if err := checkMergeSparseCountMap(m, m2); err != nil {
+		return err
+	}
+	for key, count := range m2.counts {
+		m.counts[key] += count
+	}
+	m2.counts = nil
+	m2.state = merged
+	return nil
+}
+
+func checkMergeSparseCountMap[K comparable](m1, m2 *SparseCountMap[K]) error {
+	if m1.state != defaultState {
+		return fmt.Errorf("checkMergeSparseCountMap: m1 cannot be merged with another SparseCountMap instance: %w", m1.state.transitionError(merged))
+	}
+	if m2.state != defaultState {
+		return fmt.Errorf("checkMergeSparseCountMap: m2 cannot be merged with another SparseCountMap instance: %w", m2.state.transitionError(merged))
+	}
+
+	if field := sparseCountMapIncompatibleField(m1, m2); field != "" {
+		return fmt.Errorf("checkMergeSparseCountMap: m1 and m2 are not compatible: %w", &IncompatibleMergeError{Field: field})
+	}
+
+	return nil
+}
+
+// sparseCountMapIncompatibleField returns the name of the first option with
+// which m1 and m2 were initialized differently, or "" if they were initialized
+// equally.
+func sparseCountMapIncompatibleField[K comparable](m1, m2 *SparseCountMap[K]) string {
+	switch {
+	case m1.epsilon != m2.epsilon:
+		return "Epsilon"
+	case m1.noiseDelta != m2.noiseDelta || m1.thresholdDelta != m2.thresholdDelta:
+		return "Delta"
+	case m1.l0Sensitivity != m2.l0Sensitivity:
+		return "MaxPartitionsContributed"
+	case m1.lInfSensitivity != m2.lInfSensitivity:
+		return "MaxContributionsPerPartition"
+	case m1.noiseKind != m2.noiseKind:
+		return "Noise"
+	case !equalKeys(m1.publicKeys, m2.publicKeys):
+		return "PublicKeys"
+	}
+	return ""
+}
+
+// equalKeys returns whether k1 and k2 are both nil or hold the same keys in
+// the same order.
+func equalKeys[K comparable](k1, k2 []K) bool {
+	if (k1 == nil) != (k2 == nil) || len(k1) != len(k2) {
+		return false
+	}
+	for i := range k1 {
+		if k1[i] != k2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Result returns the noisy counts of the released keys: the public keys if
+// PublicKeys is set, and the keys whose noisy count is at least the threshold
+// derived from the parameters of the SparseCountMap otherwise. The method can
+// be called only once.
+//
+// For releases with many keys, ResultFunc avoids holding all the noisy counts
+// in memory at once.
+func (m *SparseCountMap[K]) Result() (map[K]int64, error) {
+	result := make(map[K]int64)
+	err := m.ResultFunc(func(key K, count int64) error {
+		result[key] = count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResultFunc is like Result, but instead of returning a map, it calls f with
+// each released key and its noisy count, one key at a time and in no
+// particular order, or in the order of PublicKeys if it is set. Each count is
+// noised right before it is passed to f, and the raw count of the key is
+// discarded afterwards. If f returns an error, ResultFunc stops and returns
+// it; the keys that haven't been passed to f yet can't be released anymore.
+// The method can be called only once, and ResultFunc and Result can't be used
+// together.
+func (m *SparseCountMap[K]) ResultFunc(f func(key K, count int64) error) error {
+	if m.state != defaultState {
+		return fmt.Errorf("SparseCountMap's noised result cannot be computed: %w", m.state.transitionError(resultReturned))
+	}
+	m.state = resultReturned
+	counts := m.counts
+	m.counts = nil
+
+	if m.publicKeys != nil {
+		for _, key := range m.publicKeys {
+			noisedCount, err := m.Noise.AddNoiseInt64(counts[key], m.l0Sensitivity, m.lInfSensitivity, m.epsilon, m.noiseDelta)
+			if err != nil {
+				return fmt.Errorf("couldn't compute noised count of a key: %w", err)
+			}
+			delete(counts, key)
+			if err := f(key, noisedCount); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	threshold, err := m.Noise.Threshold(m.l0Sensitivity, float64(m.lInfSensitivity), m.epsilon, m.noiseDelta, m.thresholdDelta)
+	if err != nil {
+		return err
+	}
+	// Rounding up the threshold to ensure that no DP guarantees are violated by
+	// releasing a count that is less than the fractional threshold.
+	minCount := int64(math.Ceil(threshold))
+	for key, count := range counts {
+		noisedCount, err := m.Noise.AddNoiseInt64(count, m.l0Sensitivity, m.lInfSensitivity, m.epsilon, m.noiseDelta)
+		if err != nil {
+			return fmt.Errorf("couldn't compute noised count of a key: %w", err)
+		}
+		delete(counts, key)
+		if noisedCount < minCount {
+			continue
+		}
+		if err := f(key, noisedCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
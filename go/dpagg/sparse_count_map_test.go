@@ -0,0 +1,199 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSparseCountMapInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *SparseCountMapOptions[string]
+	}{
+		{"nil options", nil},
+		{"zero delta", &SparseCountMapOptions[string]{Epsilon: ln3}},
+		{"zero epsilon", &SparseCountMapOptions[string]{Delta: 1e-5}},
+		{"negative max partitions", &SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: -1}},
+		{"public keys and Laplace noise with nonzero delta", &SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5, PublicKeys: []string{"a"}}},
+		{"public keys and Gaussian noise with zero delta", &SparseCountMapOptions[string]{Epsilon: ln3, Noise: noise.Gaussian(), PublicKeys: []string{"a"}}},
+	} {
+		if _, err := NewSparseCountMap(tc.opts); err == nil {
+			t.Errorf("NewSparseCountMap: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSparseCountMapSuppressesUnstableKeys(t *testing.T) {
+	m, err := NewSparseCountMap(&SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SparseCountMap: %v", err)
+	}
+	// noNoise has a threshold of 5.00001, so only keys with a count of at least
+	// 6 are released.
+	for key, count := range map[string]int64{"a": 1, "b": 5, "c": 6, "d": 100} {
+		if err := m.IncrementBy(key, count); err != nil {
+			t.Fatalf("IncrementBy(%q, %d): got error %v", key, count, err)
+		}
+	}
+	if m.Len() != 4 {
+		t.Errorf("Len: got %d, want 4", m.Len())
+	}
+	got, err := m.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := map[string]int64{"c": 6, "d": 100}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSparseCountMapPublicKeys(t *testing.T) {
+	m, err := NewSparseCountMap(&SparseCountMapOptions[int]{Epsilon: ln3, Noise: noNoise{}, PublicKeys: []int{3, 1, 2}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SparseCountMap: %v", err)
+	}
+	m.Increment(1)
+	m.IncrementBy(3, 7)
+	m.Increment(4)
+	var gotKeys []int
+	got := make(map[int]int64)
+	err = m.ResultFunc(func(key int, count int64) error {
+		gotKeys = append(gotKeys, key)
+		got[key] = count
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ResultFunc: got error %v", err)
+	}
+	// Public keys are released in order and without thresholding, and other keys
+	// are discarded.
+	if diff := cmp.Diff([]int{3, 1, 2}, gotKeys); diff != "" {
+		t.Errorf("ResultFunc: got keys diff (-want +got):\n%s", diff)
+	}
+	want := map[int]int64{3: 7, 1: 1, 2: 0}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ResultFunc: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// Tests that a key that a single privacy unit contributed to is released
+// with a probability of at most δ.
+func TestSparseCountMapSingleContributionIsRarelyReleased(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		noise noise.Noise
+	}{
+		{"Laplace noise", noise.Laplace()},
+		{"Gaussian noise", noise.Gaussian()},
+		{"discrete Gaussian noise", noise.DiscreteGaussian()},
+	} {
+		released := 0
+		for i := 0; i < 1000; i++ {
+			m, err := NewSparseCountMap(&SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-3, Noise: tc.noise})
+			if err != nil {
+				t.Fatalf("With %s, couldn't initialize SparseCountMap: %v", tc.desc, err)
+			}
+			m.Increment("a")
+			got, err := m.Result()
+			if err != nil {
+				t.Fatalf("With %s, Result: got error %v", tc.desc, err)
+			}
+			released += len(got)
+		}
+		// The expected number of releases is at most 1, so 10 releases have a
+		// negligible probability.
+		if released >= 10 {
+			t.Errorf("With %s, the key was released %d times out of 1000, want fewer than 10", tc.desc, released)
+		}
+	}
+}
+
+func TestSparseCountMapMerge(t *testing.T) {
+	opts := &SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5, Noise: noNoise{}}
+	m1, err := NewSparseCountMap(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize m1: %v", err)
+	}
+	m2, err := NewSparseCountMap(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize m2: %v", err)
+	}
+	m1.IncrementBy("a", 4)
+	m2.IncrementBy("a", 4)
+	m2.IncrementBy("b", 3)
+	if err := m1.Merge(m2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	if err := m2.Increment("a"); err == nil {
+		t.Errorf("Increment on merged SparseCountMap: got no error, want error")
+	}
+	got, err := m1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := map[string]int64{"a": 8}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Result: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSparseCountMapMergeIncompatible(t *testing.T) {
+	for _, tc := range []struct {
+		opt2      *SparseCountMapOptions[string]
+		wantField string
+	}{
+		{&SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5, MaxPartitionsContributed: 2}, "MaxPartitionsContributed"},
+		{&SparseCountMapOptions[string]{Epsilon: ln3, PublicKeys: []string{"a"}}, "Delta"},
+		{&SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5, Noise: noise.Gaussian()}, "Delta"},
+	} {
+		m1, err := NewSparseCountMap(&SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5})
+		if err != nil {
+			t.Fatalf("Couldn't initialize m1: %v", err)
+		}
+		m2, err := NewSparseCountMap(tc.opt2)
+		if err != nil {
+			t.Fatalf("Couldn't initialize m2: %v", err)
+		}
+		err = m1.Merge(m2)
+		var mergeErr *IncompatibleMergeError
+		if !errors.As(err, &mergeErr) || mergeErr.Field != tc.wantField {
+			t.Errorf("Merge: got error %v, want an IncompatibleMergeError for %s", err, tc.wantField)
+		}
+	}
+}
+
+func TestSparseCountMapResultCalledTwice(t *testing.T) {
+	m, err := NewSparseCountMap(&SparseCountMapOptions[string]{Epsilon: ln3, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize SparseCountMap: %v", err)
+	}
+	if _, err := m.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if _, err := m.Result(); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Result called twice: got error %v, want ErrBudgetExhausted", err)
+	}
+	if err := m.Increment("a"); err == nil {
+		t.Errorf("Increment after Result: got no error, want error")
+	}
+}
@@ -0,0 +1,147 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// SparseVector implements the sparse vector technique: it answers a stream of
+// adaptively chosen queries with whether their value is above a threshold,
+// and only pays privacy budget for the queries answered positively. Once
+// MaxPositives queries have been answered positively, the budget is exhausted
+// and no more queries can be answered.
+//
+// The implementation follows Algorithm 1 of Lyu, Su and Li's "Understanding the
+// Sparse Vector Technique for Differential Privacy"
+// (https://arxiv.org/abs/1603.01699): half of ε is used to noise the threshold
+// once, and the other half to noise each query value. The whole stream of
+// answers is ε-differentially private.
+//
+// Each query must have a sensitivity of at most Sensitivity. The values of the
+// queries must only be passed to Query; in particular, they must not be
+// released without additional noise.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type SparseVector struct {
+	// Parameters
+	queryEpsilon float64
+	// L_∞ sensitivity used to noise query values, see NewSparseVector.
+	queryLInfSensitivity float64
+	noisyThreshold       float64
+	maxPositives         int
+	Noise                noise.Noise
+
+	// State variables
+	positives int
+	state     aggregationState
+}
+
+// SparseVectorOptions contains the options necessary to initialize a SparseVector.
+type SparseVectorOptions struct {
+	Epsilon      float64 // Privacy parameter ε for the whole stream of answers. Required.
+	Threshold    float64 // Threshold to which query values are compared. Required.
+	Sensitivity  float64 // Maximum change in any query value caused by a single privacy unit. Required.
+	MaxPositives int     // How many queries may be answered positively? Defaults to 1.
+	// Whether adding a privacy unit to the data can only increase all query
+	// values (or only decrease all of them), like for counts. Monotonic queries
+	// require less noise. Defaults to false.
+	Monotonic bool
+}
+
+// NewSparseVector returns a new SparseVector. The threshold is noised when
+// the SparseVector is created.
+func NewSparseVector(opt *SparseVectorOptions) (*SparseVector, error) {
+	if opt == nil {
+		opt = &SparseVectorOptions{}
+	}
+	// Set defaults.
+	c := opt.MaxPositives
+	if c == 0 {
+		c = 1
+	}
+	if c < 0 {
+		return nil, fmt.Errorf("NewSparseVector: MaxPositives is %d, must be strictly positive", c)
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewSparseVector: %w", err)
+	}
+	if opt.Sensitivity <= 0 || math.IsInf(opt.Sensitivity, 0) || math.IsNaN(opt.Sensitivity) {
+		return nil, fmt.Errorf("NewSparseVector: Sensitivity is %v, must be finite and strictly positive", opt.Sensitivity)
+	}
+	if math.IsInf(opt.Threshold, 0) || math.IsNaN(opt.Threshold) {
+		return nil, fmt.Errorf("NewSparseVector: Threshold is %v, must be finite", opt.Threshold)
+	}
+
+	n := noise.Laplace()
+	thresholdEpsilon, queryEpsilon := opt.Epsilon/2, opt.Epsilon/2
+	// The threshold is noised with Laplace noise of scale Δ/ε₁.
+	noisyThreshold, err := n.AddNoiseFloat64(opt.Threshold, 1, opt.Sensitivity, thresholdEpsilon, 0)
+	if err != nil {
+		return nil, fmt.Errorf("NewSparseVector: %w", err)
+	}
+	// Query values are noised with Laplace noise of scale 2cΔ/ε₂, or cΔ/ε₂ for
+	// monotonic queries.
+	queryLInf := 2 * float64(c) * opt.Sensitivity
+	if opt.Monotonic {
+		queryLInf = float64(c) * opt.Sensitivity
+	}
+	return &SparseVector{
+		queryEpsilon:         queryEpsilon,
+		queryLInfSensitivity: queryLInf,
+		noisyThreshold:       noisyThreshold,
+		maxPositives:         c,
+		Noise:                n,
+		state:                defaultState,
+	}, nil
+}
+
+// Query returns whether the noisy value of the query is above the noisy
+// threshold. It returns an error once MaxPositives queries have been answered
+// positively.
+func (sv *SparseVector) Query(value float64) (bool, error) {
+	if sv.state != defaultState {
+		return false, fmt.Errorf("SparseVector cannot answer more queries: %w", sv.state.transitionError(resultReturned))
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return false, fmt.Errorf("SparseVector: query value is %v, must be finite", value)
+	}
+	noisyValue, err := sv.Noise.AddNoiseFloat64(value, 1, sv.queryLInfSensitivity, sv.queryEpsilon, 0)
+	if err != nil {
+		return false, fmt.Errorf("couldn't noise query value: %w", err)
+	}
+	if noisyValue < sv.noisyThreshold {
+		return false, nil
+	}
+	sv.positives++
+	if sv.positives == sv.maxPositives {
+		sv.state = resultReturned
+	}
+	return true, nil
+}
+
+// RemainingPositives returns how many more queries may be answered positively.
+func (sv *SparseVector) RemainingPositives() int {
+	return sv.maxPositives - sv.positives
+}
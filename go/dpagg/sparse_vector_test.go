@@ -0,0 +1,107 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewSparseVectorInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *SparseVectorOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &SparseVectorOptions{Sensitivity: 1}},
+		{"zero sensitivity", &SparseVectorOptions{Epsilon: ln3}},
+		{"infinite sensitivity", &SparseVectorOptions{Epsilon: ln3, Sensitivity: math.Inf(1)}},
+		{"negative max positives", &SparseVectorOptions{Epsilon: ln3, Sensitivity: 1, MaxPositives: -1}},
+		{"infinite threshold", &SparseVectorOptions{Epsilon: ln3, Sensitivity: 1, Threshold: math.Inf(1)}},
+	} {
+		if _, err := NewSparseVector(tc.opts); err == nil {
+			t.Errorf("NewSparseVector: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSparseVectorAnswersUntilBudgetIsExhausted(t *testing.T) {
+	// With a large ε, the noise is negligible compared to the distance between
+	// the query values and the threshold.
+	sv, err := NewSparseVector(&SparseVectorOptions{Epsilon: 1000, Threshold: 10, Sensitivity: 1, MaxPositives: 2})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sparse vector: %v", err)
+	}
+	for i, tc := range []struct {
+		value float64
+		want  bool
+	}{
+		{0, false},
+		{20, true},
+		{-5, false},
+		{0, false},
+		{30, true},
+	} {
+		got, err := sv.Query(tc.value)
+		if err != nil {
+			t.Fatalf("Query(%f) at index %d: got error %v", tc.value, i, err)
+		}
+		if got != tc.want {
+			t.Errorf("Query(%f) at index %d: got %t, want %t", tc.value, i, got, tc.want)
+		}
+	}
+	if got := sv.RemainingPositives(); got != 0 {
+		t.Errorf("RemainingPositives: got %d, want 0", got)
+	}
+	if _, err := sv.Query(0); err == nil {
+		t.Errorf("Query: got no error after the budget is exhausted, want error")
+	}
+}
+
+// Tests that queries exactly at the threshold are answered positively about
+// half of the time.
+func TestSparseVectorNoise(t *testing.T) {
+	const numberOfTrials = 4000
+	positives := 0
+	for i := 0; i < numberOfTrials; i++ {
+		sv, err := NewSparseVector(&SparseVectorOptions{Epsilon: ln3, Threshold: 5, Sensitivity: 1, Monotonic: true})
+		if err != nil {
+			t.Fatalf("Couldn't initialize sparse vector: %v", err)
+		}
+		got, err := sv.Query(5)
+		if err != nil {
+			t.Fatalf("Query: got error %v", err)
+		}
+		if got {
+			positives++
+		}
+	}
+	// The standard deviation of positives is about 32.
+	if math.Abs(float64(positives)-numberOfTrials/2) > 200 {
+		t.Errorf("Query: answered positively %d times out of %d, want about half", positives, numberOfTrials)
+	}
+}
+
+func TestSparseVectorInvalidQuery(t *testing.T) {
+	sv, err := NewSparseVector(&SparseVectorOptions{Epsilon: ln3, Sensitivity: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sparse vector: %v", err)
+	}
+	if _, err := sv.Query(math.NaN()); err == nil {
+		t.Errorf("Query: got no error for a NaN value, want error")
+	}
+}
@@ -47,8 +47,17 @@ type BoundedStandardDeviation struct {
 }
 
 func bstdvEquallyInitialized(bstdv1, bstdv2 *BoundedStandardDeviation) bool {
-	return bstdv1.state == bstdv2.state &&
-		bvEquallyInitialized(&bstdv1.Variance, &bstdv2.Variance)
+	return bstdvIncompatibleField(bstdv1, bstdv2) == ""
+}
+
+// bstdvIncompatibleField returns the name of the first option with which
+// bstdv1 and bstdv2 were initialized differently, or "" if they were
+// initialized equally.
+func bstdvIncompatibleField(bstdv1, bstdv2 *BoundedStandardDeviation) string {
+	if bstdv1.state != bstdv2.state {
+		return "state"
+	}
+	return bvIncompatibleField(&bstdv1.Variance, &bstdv2.Variance)
 }
 
 // BoundedStandardDeviationOptions contains the options necessary to initialize a BoundedStandardDeviation.
@@ -59,7 +68,16 @@ type BoundedStandardDeviationOptions struct {
 	MaxContributionsPerPartition int64   // How many times may a single user contribute to a single partition? Required.
 	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower < Upper.
 	Lower, Upper float64
-	Noise        noise.Noise // Type of noise used in BoundedStandardDeviation. Defaults to Laplace noise.
+	Noise        noise.Noise // Type of noise used in BoundedStandardDeviation. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+	// Transform used to bound contributions to [Lower, Upper]. Defaults to hard
+	// clamping; see Clamper.
+	Clamper Clamper
+	// What is protected by differential privacy, see PrivacyLevel. Defaults to
+	// UserLevel.
+	PrivacyLevel PrivacyLevel
 }
 
 // NewBoundedStandardDeviation returns a new BoundedStandardDeviation.
@@ -67,11 +85,14 @@ func NewBoundedStandardDeviation(opt *BoundedStandardDeviationOptions) (*Bounded
 	variance, err := NewBoundedVariance(&BoundedVarianceOptions{
 		Epsilon:                      opt.Epsilon,
 		Delta:                        opt.Delta,
+		Rho:                          opt.Rho,
 		MaxPartitionsContributed:     opt.MaxPartitionsContributed,
 		Lower:                        opt.Lower,
 		Upper:                        opt.Upper,
 		Noise:                        opt.Noise,
+		Clamper:                      opt.Clamper,
 		MaxContributionsPerPartition: opt.MaxContributionsPerPartition,
+		PrivacyLevel:                 opt.PrivacyLevel,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("couldn't initialize BoundedVariance for NewBoundedStandardDeviation: %w", err)
@@ -89,7 +110,7 @@ func NewBoundedStandardDeviation(opt *BoundedStandardDeviationOptions) (*Bounded
 // indistinguishability property required for differential privacy.
 func (bstdv *BoundedStandardDeviation) Add(e float64) error {
 	if bstdv.state != defaultState {
-		return fmt.Errorf("BoundedStandardDeviation cannot be amended: %v", bstdv.state.errorMessage())
+		return fmt.Errorf("BoundedStandardDeviation cannot be amended: %w", bstdv.state.transitionError(defaultState))
 	}
 	return bstdv.Variance.Add(e)
 }
@@ -101,7 +122,7 @@ func (bstdv *BoundedStandardDeviation) Add(e float64) error {
 // deviation.
 func (bstdv *BoundedStandardDeviation) Result() (float64, error) {
 	if bstdv.state != defaultState {
-		return 0, fmt.Errorf("BoundedStandardDeviation's noised result cannot be computed: " + bstdv.state.errorMessage())
+		return 0, fmt.Errorf("BoundedStandardDeviation's noised result cannot be computed: %w", bstdv.state.transitionError(resultReturned))
 	}
 	bstdv.state = resultReturned
 	variance, err := bstdv.Variance.Result()
@@ -111,6 +132,14 @@ func (bstdv *BoundedStandardDeviation) Result() (float64, error) {
 	return math.Sqrt(variance), nil
 }
 
+// Reset returns bstdv to the state it had when it was initialized, discarding
+// all entries and any result. Like Count.Reset, it starts a new expenditure of
+// the privacy budget of bstdv.
+func (bstdv *BoundedStandardDeviation) Reset() {
+	bstdv.Variance.Reset()
+	bstdv.state = defaultState
+}
+
 // Merge merges bstdv2 into bstdv (i.e., adds to bstdv all entries that were added to
 // bstdv2). bstdv2 is consumed by this operation: bstdv2 may not be used after it is
 // merged into bstdv.
@@ -125,14 +154,14 @@ func (bstdv *BoundedStandardDeviation) Merge(bstdv2 *BoundedStandardDeviation) e
 
 func checkMergeBoundedStandardDeviation(bstdv1, bstdv2 *BoundedStandardDeviation) error {
 	if bstdv1.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedStandardDeviation: bv1 cannot be merged with another BoundedStandardDeviation instance: %v", bstdv1.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedStandardDeviation: bv1 cannot be merged with another BoundedStandardDeviation instance: %w", bstdv1.state.transitionError(merged))
 	}
 	if bstdv2.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedStandardDeviation: bv2 cannot be merged with another BoundedStandardDeviation instance: %v", bstdv2.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedStandardDeviation: bv2 cannot be merged with another BoundedStandardDeviation instance: %w", bstdv2.state.transitionError(merged))
 	}
 
-	if !bstdvEquallyInitialized(bstdv1, bstdv2) {
-		return fmt.Errorf("checkMergeBoundedStandardDeviation: bstdv1 and bstdv2 are not compatible")
+	if field := bstdvIncompatibleField(bstdv1, bstdv2); field != "" {
+		return fmt.Errorf("checkMergeBoundedStandardDeviation: bstdv1 and bstdv2 are not compatible: %w", &IncompatibleMergeError{Field: field})
 	}
 
 	return nil
@@ -141,7 +170,7 @@ func checkMergeBoundedStandardDeviation(bstdv1, bstdv2 *BoundedStandardDeviation
 // GobEncode encodes BoundedStandardDeviation.
 func (bstdv *BoundedStandardDeviation) GobEncode() ([]byte, error) {
 	if bstdv.state != defaultState && bstdv.state != serialized {
-		return nil, fmt.Errorf("StandardDeviation object cannot be serialized: " + bstdv.state.errorMessage())
+		return nil, fmt.Errorf("StandardDeviation object cannot be serialized: %w", bstdv.state.transitionError(serialized))
 	}
 	enc := encodableBoundedStandardDeviation{
 		EncodableVariance: &bstdv.Variance,
@@ -163,6 +192,66 @@ func (bstdv *BoundedStandardDeviation) GobDecode(data []byte) error {
 	return nil
 }
 
+type jsonBoundedStandardDeviationState struct {
+	Variance *BoundedVariance `json:"variance"`
+}
+
+// MarshalJSON returns the JSON summary of bstdv, see json_summary.go, whose
+// state contains the JSON summary of its variance. Like GobEncode, it consumes
+// bstdv: it may not be amended, merged or queried afterwards.
+func (bstdv *BoundedStandardDeviation) MarshalJSON() ([]byte, error) {
+	if bstdv.state != defaultState && bstdv.state != serialized {
+		return nil, fmt.Errorf("BoundedStandardDeviation object cannot be serialized: %w", bstdv.state.transitionError(serialized))
+	}
+	bstdv.state = serialized
+	return marshalJSONSummary("BoundedStandardDeviation", struct{}{}, jsonBoundedStandardDeviationState{Variance: &bstdv.Variance})
+}
+
+// UnmarshalJSON loads the JSON summary of a BoundedStandardDeviation into bstdv.
+func (bstdv *BoundedStandardDeviation) UnmarshalJSON(data []byte) error {
+	var state jsonBoundedStandardDeviationState
+	if err := unmarshalJSONSummary(data, "BoundedStandardDeviation", &struct{}{}, &state); err != nil {
+		return fmt.Errorf("couldn't decode BoundedStandardDeviation from JSON: %w", err)
+	}
+	if state.Variance == nil {
+		return fmt.Errorf("couldn't decode BoundedStandardDeviation from JSON: state must contain a variance")
+	}
+	*bstdv = BoundedStandardDeviation{Variance: *state.Variance}
+	return nil
+}
+
+// Serialize returns the partial aggregate of bstdv as a serialized
+// BoundedVarianceSummary protobuf message (see proto/summary.proto), which is
+// also the summary used by standard deviations in the Java library. See
+// BoundedVariance.Serialize.
+//
+// Like GobEncode, Serialize consumes bstdv: it may not be amended, merged or
+// queried afterwards.
+func (bstdv *BoundedStandardDeviation) Serialize() ([]byte, error) {
+	if bstdv.state != defaultState && bstdv.state != serialized {
+		return nil, fmt.Errorf("BoundedStandardDeviation object cannot be serialized: %w", bstdv.state.transitionError(serialized))
+	}
+	b, err := bstdv.Variance.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedStandardDeviation object cannot be serialized: %w", err)
+	}
+	bstdv.state = serialized
+	return b, nil
+}
+
+// Deserialize merges a serialized BoundedVarianceSummary protobuf message into
+// bstdv, adding its partial sums and count to the ones accumulated so far. See
+// BoundedVariance.Deserialize.
+func (bstdv *BoundedStandardDeviation) Deserialize(data []byte) error {
+	if bstdv.state != defaultState {
+		return fmt.Errorf("BoundedStandardDeviation object cannot be deserialized: %w", bstdv.state.transitionError(defaultState))
+	}
+	if err := bstdv.Variance.Deserialize(data); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedStandardDeviation: %w", err)
+	}
+	return nil
+}
+
 // encodableBoundedStandardDeviation can be encoded by the gob package.
 type encodableBoundedStandardDeviation struct {
 	EncodableVariance *BoundedVariance
@@ -66,7 +66,6 @@ func TestNewBoundedStandardDeviation(t *testing.T) {
 						upper:           3,
 						Noise:           noNoise{},
 						noiseKind:       noise.Unrecognised,
-						sum:             0,
 						state:           defaultState,
 					},
 					NormalizedSumOfSquares: BoundedSumFloat64{
@@ -78,7 +77,6 @@ func TestNewBoundedStandardDeviation(t *testing.T) {
 						upper:           9,
 						Noise:           noNoise{},
 						noiseKind:       noise.Unrecognised,
-						sum:             0,
 						state:           defaultState,
 					},
 				}}},
@@ -116,7 +114,6 @@ func TestNewBoundedStandardDeviation(t *testing.T) {
 						upper:           3,
 						Noise:           noise.Laplace(),
 						noiseKind:       noise.LaplaceNoise,
-						sum:             0,
 						state:           defaultState,
 					},
 					NormalizedSumOfSquares: BoundedSumFloat64{
@@ -128,7 +125,6 @@ func TestNewBoundedStandardDeviation(t *testing.T) {
 						upper:           9,
 						Noise:           noise.Laplace(),
 						noiseKind:       noise.LaplaceNoise,
-						sum:             0,
 						state:           defaultState,
 					},
 				}}},
@@ -672,3 +668,50 @@ func TestBoundedStandardDeviationSerializationStateChecks(t *testing.T) {
 		}
 	}
 }
+
+func TestBSTDVReset(t *testing.T) {
+	bstdv := getNoiselessBSTDV(t, 0, 10)
+	bstdv.Add(1)
+	bstdv.Add(9)
+	if _, err := bstdv.Result(); err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	bstdv.Reset()
+	bstdv.Add(2)
+	bstdv.Add(4)
+	got, err := bstdv.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result after Reset: %v", err)
+	}
+	if !ApproxEqual(got, 1) {
+		t.Errorf("Result after Reset: got %f, want 1", got)
+	}
+}
+
+// Tests that a BoundedStandardDeviation decoded on another worker can be
+// merged with local standard deviations.
+func TestBSTDVSerializeShipMerge(t *testing.T) {
+	shipped := getNoiselessBSTDV(t, 0, 10)
+	shipped.Add(2)
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode(BoundedStandardDeviation) error: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode(BoundedStandardDeviation) error: %v", err)
+	}
+	received := new(BoundedStandardDeviation)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode(BoundedStandardDeviation) error: %v", err)
+	}
+	local := getNoiselessBSTDV(t, 0, 10)
+	local.Add(4)
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded BoundedStandardDeviation: got error %v", err)
+	}
+	// The normalized sums are relative to the midpoint 5 of [0, 10].
+	if v := received.Variance; v.Count.count != 2 || !ApproxEqual(v.NormalizedSum.sum.Float, -4) || !ApproxEqual(v.NormalizedSumOfSquares.sum.Float, 10) {
+		t.Errorf("count and normalized sums after merging a decoded BoundedStandardDeviation: got (%d, %f, %f), want (2, -4, 10)", v.Count.count, v.NormalizedSum.sum.Float, v.NormalizedSumOfSquares.sum.Float)
+	}
+}
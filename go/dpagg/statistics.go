@@ -0,0 +1,336 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Statistic is a set of statistics computed by BoundedStatistics.
+type Statistic int
+
+// Statistics that can be computed by BoundedStatistics, which can be combined
+// with |, e.g. CountStatistic | MeanStatistic.
+const (
+	CountStatistic Statistic = 1 << iota
+	SumStatistic
+	MeanStatistic
+	VarianceStatistic
+
+	AllStatistics = CountStatistic | SumStatistic | MeanStatistic | VarianceStatistic
+)
+
+// BoundedStatistics calculates differentially private estimates of the count,
+// sum, mean and variance of a collection of float64 values in a single pass,
+// using a single privacy budget.
+//
+// All statistics are computed by post-processing the same three noisy
+// aggregations as BoundedVariance: a count of the entries, a sum of the
+// entries normalized relative to the midpoint m of [Lower, Upper], and a sum
+// of their squares. The sum is recovered as the normalized sum plus m times
+// the count, and the mean and variance as in BoundedMeanFloat64 and
+// BoundedVariance. Only the aggregations needed by the requested statistics
+// are computed, and the budget is split equally between them: the count alone
+// uses the whole budget, the count, sum and mean use half of it for each of
+// the count and normalized sum, and the variance uses a third for each of the
+// three aggregations. Thus, requesting all four statistics costs the same as a
+// single BoundedVariance, instead of four times the budget.
+//
+// BoundedStatistics supports privacy units that contribute to multiple
+// partitions (via the MaxPartitionsContributed parameter) as well as
+// contribute to the same partition multiple times (via the
+// MaxContributionsPerPartition parameter), by scaling the added noise
+// appropriately.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Note: Do not use when your results may cause overflows for float64 values. This
+// aggregation is not hardened for such applications yet.
+//
+// Not thread-safe.
+type BoundedStatistics struct {
+	// Parameters
+	lower      float64
+	upper      float64
+	clamper    Clamper
+	statistics Statistic
+	// The midpoint between lower and upper bounds.
+	midPoint float64
+
+	// State variables
+	count                  *Count
+	normalizedSum          *BoundedSumFloat64 // nil if not needed by the requested statistics
+	normalizedSumOfSquares *BoundedSumFloat64 // nil if not needed by the requested statistics
+	state                  aggregationState
+}
+
+// BoundedStatisticsOptions contains the options necessary to initialize a BoundedStatistics.
+type BoundedStatisticsOptions struct {
+	Epsilon                      float64 // Privacy parameter ε, shared by all statistics. Required.
+	Delta                        float64 // Privacy parameter δ, shared by all statistics. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed     int64   // How many distinct partitions may a single user contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64   // How many times may a single user contribute to a single partition? Required.
+	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower < Upper.
+	Lower, Upper float64
+	Noise        noise.Noise // Type of noise used in BoundedStatistics. Defaults to Laplace noise.
+	// Transform used to bound contributions to [Lower, Upper]. Defaults to hard
+	// clamping; see Clamper.
+	Clamper Clamper
+	// Statistics to compute. Defaults to AllStatistics.
+	Statistics Statistic
+}
+
+// BoundedStatisticsResult contains the statistics computed by
+// BoundedStatistics. Statistics that were not requested are 0.
+type BoundedStatisticsResult struct {
+	Count int64
+	Sum   float64
+	// Mean and Variance are clamped like the results of BoundedMeanFloat64 and
+	// BoundedVariance.
+	Mean     float64
+	Variance float64
+}
+
+// NewBoundedStatistics returns a new BoundedStatistics.
+func NewBoundedStatistics(opt *BoundedStatisticsOptions) (*BoundedStatistics, error) {
+	if opt == nil {
+		opt = &BoundedStatisticsOptions{}
+	}
+
+	maxContributionsPerPartition := opt.MaxContributionsPerPartition
+	if err := checks.CheckMaxContributionsPerPartition(maxContributionsPerPartition); err != nil {
+		return nil, fmt.Errorf("NewBoundedStatistics: %w", err)
+	}
+
+	// Set defaults.
+	maxPartitionsContributed := opt.MaxPartitionsContributed
+	if maxPartitionsContributed == 0 {
+		maxPartitionsContributed = 1
+	}
+	statistics := opt.Statistics
+	if statistics == 0 {
+		statistics = AllStatistics
+	}
+	if statistics&^AllStatistics != 0 {
+		return nil, fmt.Errorf("NewBoundedStatistics: Statistics is %d, must be a combination of CountStatistic, SumStatistic, MeanStatistic and VarianceStatistic", statistics)
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	// Check bounds & use them to compute L_∞ sensitivity.
+	lower, upper := opt.Lower, opt.Upper
+	if err := checks.CheckBoundsNotDefault(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewBoundedStatistics: %w", err)
+	}
+	if err := checks.CheckBoundsFloat64(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewBoundedStatistics: %w", err)
+	}
+	if err := checks.CheckBoundsNotEqual(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewBoundedStatistics: %w", err)
+	}
+	// (lower + upper) / 2 may cause an overflow if lower and upper are large values.
+	midPoint := lower + (upper-lower)/2.0
+	maxDistFromMidpoint := upper - midPoint
+
+	// The count is always needed, the normalized sum for all the statistics but the
+	// count, and the normalized sum of squares for the variance only.
+	needsSum := statistics&(SumStatistic|MeanStatistic|VarianceStatistic) != 0
+	needsSumOfSquares := statistics&VarianceStatistic != 0
+	numAggregations := 1.0
+	if needsSum {
+		numAggregations++
+	}
+	if needsSumOfSquares {
+		numAggregations++
+	}
+	eps, del := opt.Epsilon/numAggregations, opt.Delta/numAggregations
+
+	bs := &BoundedStatistics{
+		lower:      lower,
+		upper:      upper,
+		clamper:    opt.Clamper,
+		statistics: statistics,
+		midPoint:   midPoint,
+		state:      defaultState,
+	}
+	var err error
+	bs.count, err = NewCount(&CountOptions{
+		Epsilon:                      eps,
+		Delta:                        del,
+		MaxPartitionsContributed:     maxPartitionsContributed,
+		Noise:                        n,
+		maxContributionsPerPartition: maxContributionsPerPartition,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize count for NewBoundedStatistics: %w", err)
+	}
+	if needsSum {
+		bs.normalizedSum, err = NewBoundedSumFloat64(&BoundedSumFloat64Options{
+			Epsilon:                      eps,
+			Delta:                        del,
+			MaxPartitionsContributed:     maxPartitionsContributed,
+			Lower:                        -maxDistFromMidpoint,
+			Upper:                        maxDistFromMidpoint,
+			Noise:                        n,
+			maxContributionsPerPartition: maxContributionsPerPartition,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize normalized sum for NewBoundedStatistics: %w", err)
+		}
+	}
+	if needsSumOfSquares {
+		bs.normalizedSumOfSquares, err = NewBoundedSumFloat64(&BoundedSumFloat64Options{
+			Epsilon:                      eps,
+			Delta:                        del,
+			MaxPartitionsContributed:     maxPartitionsContributed,
+			Lower:                        0,
+			Upper:                        maxDistFromMidpoint * maxDistFromMidpoint,
+			Noise:                        n,
+			maxContributionsPerPartition: maxContributionsPerPartition,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize normalized sum of squares for NewBoundedStatistics: %w", err)
+		}
+	}
+	return bs, nil
+}
+
+// Add an entry to a BoundedStatistics. It skips NaN entries and doesn't count
+// them in the final result, like BoundedMeanFloat64 and BoundedVariance.
+func (bs *BoundedStatistics) Add(e float64) error {
+	if bs.state != defaultState {
+		return fmt.Errorf("BoundedStatistics cannot be amended: %w", bs.state.transitionError(defaultState))
+	}
+	if math.IsNaN(e) {
+		return nil
+	}
+	clamped, err := clampWith(bs.clamper, e, bs.lower, bs.upper)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
+	}
+	normalizedVal := clamped - bs.midPoint
+	bs.count.Increment()
+	if bs.normalizedSum != nil {
+		bs.normalizedSum.Add(normalizedVal)
+	}
+	if bs.normalizedSumOfSquares != nil {
+		bs.normalizedSumOfSquares.Add(normalizedVal * normalizedVal)
+	}
+	return nil
+}
+
+// Merge merges bs2 into bs (i.e., adds to bs all entries that were added to
+// bs2). bs2 is consumed by this operation: bs2 may not be used after it is
+// merged into bs.
+func (bs *BoundedStatistics) Merge(bs2 *BoundedStatistics) error {
+	if err := checkMergeBoundedStatistics(bs, bs2); err != nil {
+		return err
+	}
+	bs.count.Merge(bs2.count)
+	if bs.normalizedSum != nil {
+		bs.normalizedSum.Merge(bs2.normalizedSum)
+	}
+	if bs.normalizedSumOfSquares != nil {
+		bs.normalizedSumOfSquares.Merge(bs2.normalizedSumOfSquares)
+	}
+	bs2.state = merged
+	return nil
+}
+
+func checkMergeBoundedStatistics(bs1, bs2 *BoundedStatistics) error {
+	if bs1.state != defaultState {
+		return fmt.Errorf("checkMergeBoundedStatistics: bs1 cannot be merged with another BoundedStatistics instance: %w", bs1.state.transitionError(merged))
+	}
+	if bs2.state != defaultState {
+		return fmt.Errorf("checkMergeBoundedStatistics: bs2 cannot be merged with another BoundedStatistics instance: %w", bs2.state.transitionError(merged))
+	}
+	if !bstatsEquallyInitialized(bs1, bs2) {
+		return fmt.Errorf("checkMergeBoundedStatistics: bs1 and bs2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+	return nil
+}
+
+func bstatsEquallyInitialized(bs1, bs2 *BoundedStatistics) bool {
+	// The requested statistics determine which normalized sums are set.
+	return bs1.lower == bs2.lower &&
+		bs1.upper == bs2.upper &&
+		bs1.statistics == bs2.statistics &&
+		bs1.midPoint == bs2.midPoint &&
+		bs1.state == bs2.state &&
+		countEquallyInitialized(bs1.count, bs2.count) &&
+		(bs1.normalizedSum == nil || bsEquallyInitialized(bs1.normalizedSum, bs2.normalizedSum)) &&
+		(bs1.normalizedSumOfSquares == nil || bsEquallyInitialized(bs1.normalizedSumOfSquares, bs2.normalizedSumOfSquares))
+}
+
+// Result returns differentially private estimates of the requested statistics
+// of the bounded elements added so far. The method can be called only once.
+//
+// The count is an unbiased estimate of the raw count, and the sum of the raw
+// bounded sum; the mean and variance are not unbiased estimates.
+func (bs *BoundedStatistics) Result() (BoundedStatisticsResult, error) {
+	if bs.state != defaultState {
+		return BoundedStatisticsResult{}, fmt.Errorf("BoundedStatistics's noised result cannot be computed: %w", bs.state.transitionError(resultReturned))
+	}
+	bs.state = resultReturned
+
+	var result BoundedStatisticsResult
+	noisedCount, err := bs.count.Result()
+	if err != nil {
+		return BoundedStatisticsResult{}, fmt.Errorf("couldn't compute dp count: %w", err)
+	}
+	if bs.statistics&CountStatistic != 0 {
+		result.Count = noisedCount
+	}
+	if bs.normalizedSum == nil {
+		return result, nil
+	}
+	noisedSum, err := bs.normalizedSum.Result()
+	if err != nil {
+		return BoundedStatisticsResult{}, fmt.Errorf("couldn't compute dp normalized sum: %w", err)
+	}
+	if bs.statistics&SumStatistic != 0 {
+		result.Sum = noisedSum + bs.midPoint*float64(noisedCount)
+	}
+	noisedCountClamped := math.Max(1.0, float64(noisedCount))
+	normalizedMean := noisedSum / noisedCountClamped
+	if bs.statistics&MeanStatistic != 0 {
+		result.Mean, err = ClampFloat64(normalizedMean+bs.midPoint, bs.lower, bs.upper)
+		if err != nil {
+			return BoundedStatisticsResult{}, fmt.Errorf("couldn't clamp the mean: %w", err)
+		}
+	}
+	if bs.normalizedSumOfSquares == nil {
+		return result, nil
+	}
+	noisedSumOfSquares, err := bs.normalizedSumOfSquares.Result()
+	if err != nil {
+		return BoundedStatisticsResult{}, fmt.Errorf("couldn't compute dp normalized sum of squares: %w", err)
+	}
+	normalizedMeanOfSquares := noisedSumOfSquares / noisedCountClamped
+	result.Variance, err = ClampFloat64(normalizedMeanOfSquares-normalizedMean*normalizedMean, 0.0, computeMaxVariance(bs.lower, bs.upper))
+	if err != nil {
+		return BoundedStatisticsResult{}, fmt.Errorf("couldn't clamp the variance: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,147 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+)
+
+func getNoiselessBStats(t *testing.T, statistics Statistic) *BoundedStatistics {
+	t.Helper()
+	bs, err := NewBoundedStatistics(&BoundedStatisticsOptions{
+		Epsilon:                      ln3,
+		Delta:                        tenten,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        -1,
+		Upper:                        5,
+		Noise:                        noNoise{},
+		Statistics:                   statistics,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't get noiseless BoundedStatistics: %v", err)
+	}
+	return bs
+}
+
+func TestNewBoundedStatisticsInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *BoundedStatisticsOptions
+	}{
+		{"nil options", nil},
+		{"no MaxContributionsPerPartition", &BoundedStatisticsOptions{Epsilon: ln3, Lower: -1, Upper: 5}},
+		{"equal bounds", &BoundedStatisticsOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: 1, Upper: 1}},
+		{"zero epsilon", &BoundedStatisticsOptions{MaxContributionsPerPartition: 1, Lower: -1, Upper: 5}},
+		{"unknown statistic", &BoundedStatisticsOptions{Epsilon: ln3, MaxContributionsPerPartition: 1, Lower: -1, Upper: 5, Statistics: 1 << 10}},
+	} {
+		if _, err := NewBoundedStatistics(tc.opt); err == nil {
+			t.Errorf("NewBoundedStatistics: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestBoundedStatisticsBudgetSplit(t *testing.T) {
+	for _, tc := range []struct {
+		statistics  Statistic
+		wantEpsilon float64
+	}{
+		{CountStatistic, ln3},
+		{CountStatistic | SumStatistic, ln3 / 2},
+		{MeanStatistic, ln3 / 2},
+		{AllStatistics, ln3 / 3},
+	} {
+		bs := getNoiselessBStats(t, tc.statistics)
+		if !ApproxEqual(bs.count.epsilon, tc.wantEpsilon) {
+			t.Errorf("NewBoundedStatistics: with statistics %d got count epsilon %f, want %f", tc.statistics, bs.count.epsilon, tc.wantEpsilon)
+		}
+		if bs.normalizedSum != nil && !ApproxEqual(bs.normalizedSum.epsilon, tc.wantEpsilon) {
+			t.Errorf("NewBoundedStatistics: with statistics %d got sum epsilon %f, want %f", tc.statistics, bs.normalizedSum.epsilon, tc.wantEpsilon)
+		}
+	}
+}
+
+func TestBoundedStatisticsResult(t *testing.T) {
+	bs := getNoiselessBStats(t, AllStatistics)
+	for _, e := range []float64{1, 2, 3, 10, math.NaN()} {
+		bs.Add(e)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// 10 is clamped to 5 and NaN is skipped.
+	values := []float64{1, 2, 3, 5}
+	var sum, sumOfSquares float64
+	for _, v := range values {
+		sum += v
+		sumOfSquares += v * v
+	}
+	mean := sum / 4
+	if got.Count != 4 {
+		t.Errorf("Result: got count %d, want 4", got.Count)
+	}
+	if !ApproxEqual(got.Sum, sum) {
+		t.Errorf("Result: got sum %f, want %f", got.Sum, sum)
+	}
+	if !ApproxEqual(got.Mean, mean) {
+		t.Errorf("Result: got mean %f, want %f", got.Mean, mean)
+	}
+	if want := sumOfSquares/4 - mean*mean; !ApproxEqual(got.Variance, want) {
+		t.Errorf("Result: got variance %f, want %f", got.Variance, want)
+	}
+	if _, err := bs.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
+
+func TestBoundedStatisticsOnlyReturnsRequestedStatistics(t *testing.T) {
+	bs := getNoiselessBStats(t, SumStatistic)
+	bs.Add(3)
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if want := (BoundedStatisticsResult{Sum: 3}); got != want {
+		t.Errorf("Result: got %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeBoundedStatistics(t *testing.T) {
+	bs1 := getNoiselessBStats(t, AllStatistics)
+	bs2 := getNoiselessBStats(t, AllStatistics)
+	bs1.Add(1)
+	bs2.Add(3)
+	if err := bs1.Merge(getNoiselessBStats(t, CountStatistic)); err == nil {
+		t.Errorf("Merge: got no error when merging different statistics, want error")
+	}
+	if err := bs1.Merge(bs2); err != nil {
+		t.Fatalf("Couldn't merge bs1 and bs2: %v", err)
+	}
+	if bs2.state != merged {
+		t.Errorf("Merge: for bs2.state got %v, want Merged", bs2.state)
+	}
+	got, err := bs1.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if want := (BoundedStatisticsResult{Count: 2, Sum: 4, Mean: 2, Variance: 1}); !ApproxEqual(got.Sum, want.Sum) || got.Count != want.Count ||
+		!ApproxEqual(got.Mean, want.Mean) || !ApproxEqual(got.Variance, want.Variance) {
+		t.Errorf("Merge: got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,270 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// PrivacyUnitScope declares how privacy units relate to the strata of a
+// Stratified aggregation, which determines how a privacy unit appearing in
+// several strata is handled and which overall guarantee the release provides.
+type PrivacyUnitScope int
+
+const (
+	// UnspecifiedScope is the zero value of PrivacyUnitScope, which is not a
+	// valid scope: the scope of a Stratified aggregation must be declared.
+	UnspecifiedScope PrivacyUnitScope = iota
+	// DisjointStrataScope declares that each privacy unit belongs to a single
+	// stratum, e.g. each user lives in a single country. Adding a contribution
+	// of a privacy unit to a second stratum is an error. By parallel
+	// composition, the release is differentially private with the largest
+	// budget of the strata.
+	DisjointStrataScope
+	// StratumScope declares that the privacy unit is the pair of a privacy ID
+	// and a stratum, so a privacy ID may appear in any number of strata and is
+	// bounded independently in each of them. The guarantee of each stratum only
+	// protects the contributions of a privacy ID to that stratum: no guarantee
+	// is provided across strata.
+	StratumScope
+	// CrossStrataScope declares that a privacy unit may appear in several
+	// strata, and that the guarantee must hold across strata. At most
+	// MaxStrataContributed strata are kept for each privacy unit, chosen
+	// uniformly at random, and by basic composition the release is
+	// differentially private with the sum of the MaxStrataContributed largest
+	// budgets of the strata.
+	CrossStrataScope
+)
+
+func (s PrivacyUnitScope) String() string {
+	switch s {
+	case UnspecifiedScope:
+		return "UnspecifiedScope"
+	case DisjointStrataScope:
+		return "DisjointStrataScope"
+	case StratumScope:
+		return "StratumScope"
+	case CrossStrataScope:
+		return "CrossStrataScope"
+	}
+	return fmt.Sprintf("PrivacyUnitScope(%d)", int(s))
+}
+
+// StratumBudget is the privacy budget and contribution bound of a stratum.
+type StratumBudget struct {
+	Epsilon float64 // Privacy parameter ε of the stratum. Required.
+	Delta   float64 // Privacy parameter δ of the stratum. Defaults to 0.
+	// How many times may a single privacy unit contribute to the stratum?
+	// Defaults to 1.
+	MaxContributions int64
+}
+
+// Stratified splits one logical release across public strata, or cohorts, e.g.
+// countries, each with an independent privacy budget and independent
+// contribution bounding. It maintains one aggregation of type M per stratum,
+// created by the New option with the budget of the stratum.
+//
+// At most MaxContributions contributions of each privacy unit are kept in each
+// stratum, chosen uniformly at random. Privacy units appearing in several
+// strata are handled according to the declared Scope, see PrivacyUnitScope.
+//
+// Contributions are kept in memory until the result is computed, since
+// contributions that are dropped by contribution bounding can't be removed
+// from an aggregation.
+//
+// Not thread-safe.
+type Stratified[S comparable, M any] struct {
+	// Parameters
+	newAggregation       func(stratum S, budget StratumBudget) (M, error)
+	strata               map[S]StratumBudget
+	scope                PrivacyUnitScope
+	maxStrataContributed int64
+
+	// State variables
+	users map[string]*userKeys[S, M]
+	state aggregationState
+}
+
+// StratifiedOptions contains the options necessary to initialize a Stratified
+// aggregation.
+type StratifiedOptions[S comparable, M any] struct {
+	// New returns a new aggregation for the given stratum, which must use the
+	// privacy budget and contribution bound of the stratum. Required.
+	New func(stratum S, budget StratumBudget) (M, error)
+	// Public set of strata, and their budgets. Required.
+	Strata map[S]StratumBudget
+	// Relation between privacy units and strata. Required.
+	Scope PrivacyUnitScope
+	// How many distinct strata may a single privacy unit contribute to?
+	// Required with CrossStrataScope, must be 0 otherwise.
+	MaxStrataContributed int64
+}
+
+// NewStratified returns a new Stratified aggregation, with no contributions in
+// any stratum.
+func NewStratified[S comparable, M any](opt *StratifiedOptions[S, M]) (*Stratified[S, M], error) {
+	if opt == nil {
+		opt = &StratifiedOptions[S, M]{}
+	}
+	if opt.New == nil {
+		return nil, fmt.Errorf("NewStratified requires a New function")
+	}
+	if len(opt.Strata) == 0 {
+		return nil, fmt.Errorf("NewStratified requires at least one stratum")
+	}
+	strata := make(map[S]StratumBudget, len(opt.Strata))
+	for stratum, budget := range opt.Strata {
+		if err := checks.CheckEpsilonStrict(budget.Epsilon); err != nil {
+			return nil, fmt.Errorf("NewStratified: stratum %v: %w", stratum, err)
+		}
+		if err := checks.CheckDelta(budget.Delta); err != nil {
+			return nil, fmt.Errorf("NewStratified: stratum %v: %w", stratum, err)
+		}
+		if budget.MaxContributions == 0 {
+			budget.MaxContributions = 1
+		}
+		if budget.MaxContributions < 0 {
+			return nil, fmt.Errorf("NewStratified: stratum %v: MaxContributions is %d, must be strictly positive", stratum, budget.MaxContributions)
+		}
+		strata[stratum] = budget
+	}
+	maxStrata := int64(len(strata))
+	switch opt.Scope {
+	case DisjointStrataScope, StratumScope:
+		if opt.MaxStrataContributed != 0 {
+			return nil, fmt.Errorf("NewStratified: MaxStrataContributed is %d, must be 0 with %v", opt.MaxStrataContributed, opt.Scope)
+		}
+		if opt.Scope == DisjointStrataScope {
+			maxStrata = 1
+		}
+	case CrossStrataScope:
+		if opt.MaxStrataContributed <= 0 || opt.MaxStrataContributed > maxStrata {
+			return nil, fmt.Errorf("NewStratified: MaxStrataContributed is %d, must be between 1 and the number of strata (%d) with %v", opt.MaxStrataContributed, maxStrata, opt.Scope)
+		}
+		maxStrata = opt.MaxStrataContributed
+	default:
+		return nil, fmt.Errorf("NewStratified: Scope is %v, must be DisjointStrataScope, StratumScope or CrossStrataScope", opt.Scope)
+	}
+	return &Stratified[S, M]{
+		newAggregation:       opt.New,
+		strata:               strata,
+		scope:                opt.Scope,
+		maxStrataContributed: maxStrata,
+		users:                make(map[string]*userKeys[S, M]),
+		state:                defaultState,
+	}, nil
+}
+
+// Budget returns the overall privacy budget (ε, δ) of the release, which
+// depends on the Scope, see PrivacyUnitScope. With StratumScope, it is the
+// largest budget of the strata, which is the guarantee for each pair of a
+// privacy ID and a stratum.
+func (st *Stratified[S, M]) Budget() (epsilon, delta float64) {
+	epsilons := make([]float64, 0, len(st.strata))
+	deltas := make([]float64, 0, len(st.strata))
+	for _, budget := range st.strata {
+		epsilons = append(epsilons, budget.Epsilon)
+		deltas = append(deltas, budget.Delta)
+	}
+	// ε and δ are bounded separately, which is conservative when the largest ε
+	// and the largest δ belong to different strata.
+	sort.Sort(sort.Reverse(sort.Float64Slice(epsilons)))
+	sort.Sort(sort.Reverse(sort.Float64Slice(deltas)))
+	n := 1
+	if st.scope == CrossStrataScope {
+		n = int(st.maxStrataContributed)
+	}
+	for i := 0; i < n; i++ {
+		epsilon += epsilons[i]
+		delta += deltas[i]
+	}
+	return epsilon, delta
+}
+
+// Add adds a contribution of the given privacy unit to the given stratum,
+// which must be one of the declared strata. contribute is called with the
+// aggregation of the stratum when the result is computed, if the contribution
+// is kept, e.g.
+//
+//	st.Add(userID, "FR", func(c *Count) error { return c.Increment() })
+//
+// With DisjointStrataScope, Add returns an error if the privacy unit already
+// contributed to another stratum.
+func (st *Stratified[S, M]) Add(privacyID string, stratum S, contribute func(M) error) error {
+	if st.state != defaultState {
+		return fmt.Errorf("Stratified cannot be amended: %w", st.state.transitionError(defaultState))
+	}
+	budget, ok := st.strata[stratum]
+	if !ok {
+		return fmt.Errorf("Stratified cannot be amended: %v is not a declared stratum", stratum)
+	}
+	u, ok := st.users[privacyID]
+	if !ok {
+		u = &userKeys[S, M]{indices: make(map[S]int), dropped: make(map[S]bool)}
+		st.users[privacyID] = u
+	}
+	if st.scope == DisjointStrataScope && len(u.keys) > 0 && u.keys[0].key != stratum {
+		return fmt.Errorf("Stratified cannot be amended: a privacy unit contributes to strata %v and %v, but Scope is %v", u.keys[0].key, stratum, st.scope)
+	}
+	u.add(stratum, contribute, 0, st.maxStrataContributed, budget.MaxContributions, RandomContributions)
+	return nil
+}
+
+// Remove removes all the contributions of the given privacy unit, e.g. to
+// honor a deletion request that arrives before the result is computed, see
+// KeyedAggregation.Remove. With DisjointStrataScope, the privacy unit can then
+// contribute to any stratum again.
+func (st *Stratified[S, M]) Remove(privacyID string) error {
+	if st.state != defaultState {
+		return fmt.Errorf("Stratified cannot be amended: %w", st.state.transitionError(defaultState))
+	}
+	delete(st.users, privacyID)
+	return nil
+}
+
+// Result returns the aggregations of all strata, including those without any
+// contribution, to which the kept contributions have been added. Their
+// differentially private results can then be computed with their own methods,
+// e.g. Result. The method can be called only once.
+func (st *Stratified[S, M]) Result() (map[S]M, error) {
+	if st.state != defaultState {
+		return nil, fmt.Errorf("Stratified's noised result cannot be computed: %w", st.state.transitionError(resultReturned))
+	}
+	st.state = resultReturned
+	result := make(map[S]M, len(st.strata))
+	for stratum, budget := range st.strata {
+		m, err := st.newAggregation(stratum, budget)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize aggregation of stratum %v: %w", stratum, err)
+		}
+		result[stratum] = m
+	}
+	for _, u := range st.users {
+		for _, s := range u.keys {
+			for _, contribute := range s.contributions {
+				if err := contribute(result[s.key]); err != nil {
+					return nil, fmt.Errorf("couldn't add contribution to aggregation of stratum %v: %w", s.key, err)
+				}
+			}
+		}
+	}
+	st.users = nil
+	return result, nil
+}
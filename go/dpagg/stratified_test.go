@@ -0,0 +1,252 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+)
+
+func newNoiselessCountForStratum(_ string, budget StratumBudget) (*Count, error) {
+	return NewCount(&CountOptions{Epsilon: budget.Epsilon, Delta: budget.Delta, maxContributionsPerPartition: budget.MaxContributions, Noise: noNoise{}})
+}
+
+func TestNewStratifiedInvalidOptions(t *testing.T) {
+	strata := map[string]StratumBudget{"FR": {Epsilon: ln3}, "US": {Epsilon: 1}}
+	for _, tc := range []struct {
+		desc string
+		opts *StratifiedOptions[string, *Count]
+	}{
+		{"nil options", nil},
+		{"no New function", &StratifiedOptions[string, *Count]{Strata: strata, Scope: DisjointStrataScope}},
+		{"no strata", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Scope: DisjointStrataScope}},
+		{"unspecified scope", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Strata: strata}},
+		{"zero epsilon", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Strata: map[string]StratumBudget{"FR": {}}, Scope: DisjointStrataScope}},
+		{"negative max contributions", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Strata: map[string]StratumBudget{"FR": {Epsilon: ln3, MaxContributions: -1}}, Scope: DisjointStrataScope}},
+		{"max strata with disjoint scope", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Strata: strata, Scope: DisjointStrataScope, MaxStrataContributed: 1}},
+		{"no max strata with cross-strata scope", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Strata: strata, Scope: CrossStrataScope}},
+		{"too many max strata with cross-strata scope", &StratifiedOptions[string, *Count]{New: newNoiselessCountForStratum, Strata: strata, Scope: CrossStrataScope, MaxStrataContributed: 3}},
+	} {
+		if _, err := NewStratified(tc.opts); err == nil {
+			t.Errorf("NewStratified: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestStratifiedBudget(t *testing.T) {
+	strata := map[string]StratumBudget{"FR": {Epsilon: 1, Delta: 1e-6}, "US": {Epsilon: 2, Delta: 1e-7}, "JP": {Epsilon: 0.5, Delta: 1e-5}}
+	for _, tc := range []struct {
+		scope                PrivacyUnitScope
+		maxStrataContributed int64
+		wantEpsilon          float64
+		wantDelta            float64
+	}{
+		{DisjointStrataScope, 0, 2, 1e-5},
+		{StratumScope, 0, 2, 1e-5},
+		{CrossStrataScope, 2, 3, 1e-5 + 1e-6},
+		{CrossStrataScope, 3, 3.5, 1e-5 + 1e-6 + 1e-7},
+	} {
+		st, err := NewStratified(&StratifiedOptions[string, *Count]{
+			New:                  newNoiselessCountForStratum,
+			Strata:               strata,
+			Scope:                tc.scope,
+			MaxStrataContributed: tc.maxStrataContributed,
+		})
+		if err != nil {
+			t.Fatalf("With %v, couldn't initialize Stratified: %v", tc.scope, err)
+		}
+		eps, del := st.Budget()
+		if !ApproxEqual(eps, tc.wantEpsilon) || !ApproxEqual(del, tc.wantDelta) {
+			t.Errorf("With %v and MaxStrataContributed=%d, Budget: got (%v, %v), want (%v, %v)", tc.scope, tc.maxStrataContributed, eps, del, tc.wantEpsilon, tc.wantDelta)
+		}
+	}
+}
+
+func TestStratifiedBoundsContributionsPerStratum(t *testing.T) {
+	st, err := NewStratified(&StratifiedOptions[string, *Count]{
+		New:    newNoiselessCountForStratum,
+		Strata: map[string]StratumBudget{"FR": {Epsilon: ln3, MaxContributions: 2}, "US": {Epsilon: ln3, MaxContributions: 5}, "JP": {Epsilon: ln3}},
+		Scope:  DisjointStrataScope,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Stratified: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := st.Add("alice", "FR", increment); err != nil {
+			t.Fatalf("Add: got error %v", err)
+		}
+		if err := st.Add("bob", "US", increment); err != nil {
+			t.Fatalf("Add: got error %v", err)
+		}
+		if err := st.Add("carol", "US", increment); err != nil {
+			t.Fatalf("Add: got error %v", err)
+		}
+	}
+	result, err := st.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := map[string]int64{"FR": 2, "US": 10, "JP": 0}
+	if len(result) != len(want) {
+		t.Errorf("Result: got %d strata, want %d", len(result), len(want))
+	}
+	for stratum, wantCount := range want {
+		c, ok := result[stratum]
+		if !ok {
+			t.Errorf("Result: stratum %q is missing", stratum)
+			continue
+		}
+		got, err := c.Result()
+		if err != nil {
+			t.Fatalf("Result of stratum %q: got error %v", stratum, err)
+		}
+		if got != wantCount {
+			t.Errorf("Result of stratum %q: got %d, want %d", stratum, got, wantCount)
+		}
+	}
+}
+
+func TestStratifiedDisjointScopeRejectsSeveralStrata(t *testing.T) {
+	st, err := NewStratified(&StratifiedOptions[string, *Count]{
+		New:    newNoiselessCountForStratum,
+		Strata: map[string]StratumBudget{"FR": {Epsilon: ln3}, "US": {Epsilon: ln3}},
+		Scope:  DisjointStrataScope,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Stratified: %v", err)
+	}
+	if err := st.Add("alice", "FR", increment); err != nil {
+		t.Fatalf("Add to first stratum: got error %v", err)
+	}
+	if err := st.Add("alice", "FR", increment); err != nil {
+		t.Errorf("Add to the same stratum: got error %v", err)
+	}
+	if err := st.Add("alice", "US", increment); err == nil {
+		t.Errorf("Add to a second stratum: got no error, want error")
+	}
+}
+
+func TestStratifiedRemove(t *testing.T) {
+	st, err := NewStratified(&StratifiedOptions[string, *Count]{
+		New:    newNoiselessCountForStratum,
+		Strata: map[string]StratumBudget{"FR": {Epsilon: ln3}, "US": {Epsilon: ln3}},
+		Scope:  DisjointStrataScope,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Stratified: %v", err)
+	}
+	if err := st.Add("alice", "FR", increment); err != nil {
+		t.Fatalf("Add: got error %v", err)
+	}
+	if err := st.Remove("alice"); err != nil {
+		t.Fatalf("Remove: got error %v", err)
+	}
+	// Once removed, the privacy unit can contribute to another stratum.
+	if err := st.Add("alice", "US", increment); err != nil {
+		t.Fatalf("Add to another stratum after Remove: got error %v", err)
+	}
+	result, err := st.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	for stratum, want := range map[string]int64{"FR": 0, "US": 1} {
+		got, err := result[stratum].Result()
+		if err != nil {
+			t.Fatalf("Result of stratum %q: got error %v", stratum, err)
+		}
+		if got != want {
+			t.Errorf("Result of stratum %q: got %d, want %d", stratum, got, want)
+		}
+	}
+}
+
+func TestStratifiedUnknownStratum(t *testing.T) {
+	st, err := NewStratified(&StratifiedOptions[string, *Count]{
+		New:    newNoiselessCountForStratum,
+		Strata: map[string]StratumBudget{"FR": {Epsilon: ln3}},
+		Scope:  StratumScope,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Stratified: %v", err)
+	}
+	if err := st.Add("alice", "US", increment); err == nil {
+		t.Errorf("Add to an undeclared stratum: got no error, want error")
+	}
+}
+
+func TestStratifiedSeveralStrataPerPrivacyUnit(t *testing.T) {
+	strata := map[string]StratumBudget{"FR": {Epsilon: ln3}, "US": {Epsilon: ln3}, "JP": {Epsilon: ln3}}
+	for _, tc := range []struct {
+		scope                PrivacyUnitScope
+		maxStrataContributed int64
+		wantTotal            int64
+	}{
+		// Each privacy unit is bounded independently in each stratum.
+		{StratumScope, 0, 3},
+		// Only MaxStrataContributed strata are kept for each privacy unit.
+		{CrossStrataScope, 2, 2},
+	} {
+		st, err := NewStratified(&StratifiedOptions[string, *Count]{
+			New:                  newNoiselessCountForStratum,
+			Strata:               strata,
+			Scope:                tc.scope,
+			MaxStrataContributed: tc.maxStrataContributed,
+		})
+		if err != nil {
+			t.Fatalf("With %v, couldn't initialize Stratified: %v", tc.scope, err)
+		}
+		for stratum := range strata {
+			if err := st.Add("alice", stratum, increment); err != nil {
+				t.Fatalf("With %v, Add: got error %v", tc.scope, err)
+			}
+		}
+		result, err := st.Result()
+		if err != nil {
+			t.Fatalf("With %v, Result: got error %v", tc.scope, err)
+		}
+		var total int64
+		for stratum, c := range result {
+			got, err := c.Result()
+			if err != nil {
+				t.Fatalf("With %v, Result of stratum %q: got error %v", tc.scope, stratum, err)
+			}
+			total += got
+		}
+		if total != tc.wantTotal {
+			t.Errorf("With %v, total count across strata: got %d, want %d", tc.scope, total, tc.wantTotal)
+		}
+	}
+}
+
+func TestStratifiedResultCalledTwice(t *testing.T) {
+	st, err := NewStratified(&StratifiedOptions[string, *Count]{
+		New:    newNoiselessCountForStratum,
+		Strata: map[string]StratumBudget{"FR": {Epsilon: ln3}},
+		Scope:  StratumScope,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Stratified: %v", err)
+	}
+	if _, err := st.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if _, err := st.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := st.Add("alice", "FR", increment); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
@@ -0,0 +1,188 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// StreamingCount calculates differentially private running counts of a stream
+// of values, released repeatedly over time (e.g. every minute), using the
+// binary tree mechanism of Chan, Shi and Song's "Private and Continual Release
+// of Statistics" (https://eprint.iacr.org/2010/076.pdf).
+//
+// Time is split into at most MaxSteps steps. Values are counted in the current
+// step, and Release ends the step and returns a noisy count of all the values
+// of the steps so far. Each step is a leaf of a binary tree whose nodes hold
+// noisy counts of the values of their leaves, and each released count is the
+// sum of at most log₂(MaxSteps)+1 nodes. A value is in one node per level of
+// the tree, so the noise of each node scales with the number of levels instead
+// of the number of releases, and the whole sequence of releases is (ε,δ)-
+// differentially private.
+//
+// A privacy unit may contribute to at most MaxStepsContributed steps, at most
+// MaxContributionsPerStep times per step.
+//
+// Note: Do not use when your results may cause overflows for int64 values.
+// This aggregation is not hardened for such applications yet.
+//
+// Not thread-safe.
+type StreamingCount struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	l0Sensitivity   int64 // Number of tree nodes a privacy unit may contribute to.
+	lInfSensitivity int64
+	maxSteps        int64
+	Noise           noise.Noise
+
+	// State variables
+	// Number of steps released so far.
+	step int64
+	// Raw count of the current step.
+	count int64
+	// Raw and noisy counts of the node at each level of the tree that is
+	// complete or currently being filled, see Release.
+	nodes      []int64
+	noisyNodes []int64
+	state      aggregationState
+}
+
+// StreamingCountOptions contains the options necessary to initialize a
+// StreamingCount.
+type StreamingCountOptions struct {
+	Epsilon  float64 // Privacy parameter ε of the whole sequence of releases. Required.
+	Delta    float64 // Privacy parameter δ of the whole sequence of releases. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxSteps int64   // Maximum number of releases. Required.
+	// How many distinct steps may a single privacy unit contribute to? Defaults to 1.
+	MaxStepsContributed int64
+	// How many times may a single privacy unit contribute to a single step? Defaults to 1.
+	MaxContributionsPerStep int64
+	Noise                   noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// NewStreamingCount returns a new StreamingCount, initialized at 0, in its
+// first step.
+func NewStreamingCount(opt *StreamingCountOptions) (*StreamingCount, error) {
+	if opt == nil {
+		opt = &StreamingCountOptions{}
+	}
+	// Set defaults.
+	if opt.MaxSteps <= 0 {
+		return nil, fmt.Errorf("NewStreamingCount: MaxSteps is %d, must be strictly positive", opt.MaxSteps)
+	}
+	stepsContributed := opt.MaxStepsContributed
+	if stepsContributed == 0 {
+		stepsContributed = 1
+	}
+	if stepsContributed < 0 {
+		return nil, fmt.Errorf("NewStreamingCount: MaxStepsContributed is %d, must be strictly positive", stepsContributed)
+	}
+	lInf := opt.MaxContributionsPerStep
+	if lInf == 0 {
+		lInf = 1
+	}
+	levels := int64(bits.Len64(uint64(opt.MaxSteps)))
+	if stepsContributed > math.MaxInt64/levels {
+		return nil, fmt.Errorf("NewStreamingCount: MaxStepsContributed = %d is too high for MaxSteps = %d", stepsContributed, opt.MaxSteps)
+	}
+	// A contribution is in one node per level.
+	l0 := stepsContributed * levels
+
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	if _, err := n.AddNoiseInt64(0, l0, lInf, opt.Epsilon, opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewStreamingCount: %w", err)
+	}
+
+	return &StreamingCount{
+		epsilon:         opt.Epsilon,
+		delta:           opt.Delta,
+		l0Sensitivity:   l0,
+		lInfSensitivity: lInf,
+		maxSteps:        opt.MaxSteps,
+		Noise:           n,
+		nodes:           make([]int64, levels),
+		noisyNodes:      make([]int64, levels),
+		state:           defaultState,
+	}, nil
+}
+
+// Increment increments the count of the current step by one.
+func (sc *StreamingCount) Increment() error {
+	return sc.IncrementBy(1)
+}
+
+// IncrementBy increments the count of the current step by the given value.
+// Note that this shouldn't be used to count more than MaxContributionsPerStep
+// contributions to a single step from the same privacy unit.
+func (sc *StreamingCount) IncrementBy(count int64) error {
+	if sc.state != defaultState {
+		return fmt.Errorf("StreamingCount cannot be amended: %w", sc.state.transitionError(defaultState))
+	}
+	sc.count += count
+	return nil
+}
+
+// Release ends the current step and returns a differentially private estimate
+// of the count of all the values of the steps released so far, including the
+// current one. It can be called at most MaxSteps times; afterwards, the
+// StreamingCount can't be used anymore.
+//
+// The returned value is an unbiased estimate of the raw count, and may
+// sometimes be negative.
+func (sc *StreamingCount) Release() (int64, error) {
+	if sc.state != defaultState {
+		return 0, fmt.Errorf("StreamingCount's noised result cannot be computed: %w", sc.state.transitionError(resultReturned))
+	}
+	sc.step++
+	if sc.step == sc.maxSteps {
+		sc.state = resultReturned
+	}
+	// The step completes the node at the level of the lowest set bit of step,
+	// which covers the nodes at the lower levels, and all nodes of the lower
+	// levels are started anew.
+	level := bits.TrailingZeros64(uint64(sc.step))
+	node := sc.count
+	for i := 0; i < level; i++ {
+		node += sc.nodes[i]
+		sc.nodes[i], sc.noisyNodes[i] = 0, 0
+	}
+	sc.count = 0
+	noisyNode, err := sc.Noise.AddNoiseInt64(node, sc.l0Sensitivity, sc.lInfSensitivity, sc.epsilon, sc.delta)
+	if err != nil {
+		return 0, err
+	}
+	sc.nodes[level], sc.noisyNodes[level] = node, noisyNode
+	// The steps so far are covered by the complete nodes at the levels of the
+	// set bits of step.
+	var result int64
+	for i := range sc.noisyNodes {
+		if sc.step&(1<<i) != 0 {
+			result += sc.noisyNodes[i]
+		}
+	}
+	return result, nil
+}
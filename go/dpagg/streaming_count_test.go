@@ -0,0 +1,116 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNewStreamingCountInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *StreamingCountOptions
+	}{
+		{"nil options", nil},
+		{"zero MaxSteps", &StreamingCountOptions{Epsilon: ln3}},
+		{"zero epsilon", &StreamingCountOptions{MaxSteps: 10}},
+		{"negative MaxStepsContributed", &StreamingCountOptions{Epsilon: ln3, MaxSteps: 10, MaxStepsContributed: -1}},
+		{"negative MaxContributionsPerStep", &StreamingCountOptions{Epsilon: ln3, MaxSteps: 10, MaxContributionsPerStep: -1}},
+		{"non-zero delta with Laplace noise", &StreamingCountOptions{Epsilon: ln3, Delta: 1e-5, MaxSteps: 10, Noise: noise.Laplace()}},
+	} {
+		if _, err := NewStreamingCount(tc.opts); err == nil {
+			t.Errorf("NewStreamingCount: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestNewStreamingCountSensitivity(t *testing.T) {
+	for _, tc := range []struct {
+		maxSteps, maxStepsContributed, wantL0 int64
+	}{
+		{1, 1, 1},
+		{2, 1, 2},
+		{7, 1, 3},
+		{8, 1, 4},
+		{1000, 1, 10},
+		{1000, 3, 30},
+	} {
+		sc, err := NewStreamingCount(&StreamingCountOptions{Epsilon: ln3, MaxSteps: tc.maxSteps, MaxStepsContributed: tc.maxStepsContributed})
+		if err != nil {
+			t.Fatalf("Couldn't initialize streaming count: %v", err)
+		}
+		if sc.l0Sensitivity != tc.wantL0 {
+			t.Errorf("NewStreamingCount: with MaxSteps=%d and MaxStepsContributed=%d got l0Sensitivity %d, want %d", tc.maxSteps, tc.maxStepsContributed, sc.l0Sensitivity, tc.wantL0)
+		}
+	}
+}
+
+func TestStreamingCountRelease(t *testing.T) {
+	const maxSteps = 20
+	sc, err := NewStreamingCount(&StreamingCountOptions{Epsilon: ln3, MaxSteps: maxSteps, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize streaming count: %v", err)
+	}
+	var want int64
+	for step := int64(1); step <= maxSteps; step++ {
+		if err := sc.IncrementBy(step); err != nil {
+			t.Fatalf("Couldn't increment streaming count: %v", err)
+		}
+		want += step
+		got, err := sc.Release()
+		if err != nil {
+			t.Fatalf("Couldn't release step %d: %v", step, err)
+		}
+		if got != want {
+			t.Errorf("Release: at step %d got %d, want %d", step, got, want)
+		}
+	}
+	if _, err := sc.Release(); err == nil {
+		t.Errorf("Release: after MaxSteps releases got no error, want error")
+	}
+	if err := sc.Increment(); err == nil {
+		t.Errorf("Increment: after MaxSteps releases got no error, want error")
+	}
+}
+
+func TestStreamingCountNoiseDoesNotGrowWithSteps(t *testing.T) {
+	// Each release is the sum of at most log₂(MaxSteps)+1 noisy nodes, so its
+	// variance is at most that many times the variance of a node.
+	const maxSteps, numRuns = 64, 1000
+	levels := 7.0
+	nodeVariance := 2 * (levels / ln3) * (levels / ln3)
+	var sumOfSquares float64
+	for run := 0; run < numRuns; run++ {
+		sc, err := NewStreamingCount(&StreamingCountOptions{Epsilon: ln3, MaxSteps: maxSteps})
+		if err != nil {
+			t.Fatalf("Couldn't initialize streaming count: %v", err)
+		}
+		var got int64
+		for step := 0; step < maxSteps-1; step++ {
+			if got, err = sc.Release(); err != nil {
+				t.Fatalf("Couldn't release step %d: %v", step, err)
+			}
+		}
+		// Step 63 has 6 set bits, so its release is the sum of 6 nodes.
+		sumOfSquares += float64(got * got)
+	}
+	if variance := sumOfSquares / numRuns; variance > 1.5*6*nodeVariance {
+		t.Errorf("Release: got variance %f, want at most about %f", variance, 6*nodeVariance)
+	}
+}
@@ -0,0 +1,241 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+const (
+	defaultSuggestedEpsilon = 1.0
+	// Contribution caps are kept small: the noise grows linearly with them.
+	maxSuggestedContributionCap = 8
+	// Ranks of the quantiles used to estimate bounds.
+	suggestedBoundsLowerRank = 0.05
+	suggestedBoundsUpperRank = 0.95
+)
+
+// BoundsStrategy specifies how the bounds of sums and means are chosen in a
+// SuggestedDefaults.
+type BoundsStrategy int
+
+const (
+	// NoBounds is used when the profile has no value range, in which case only
+	// counts are suggested.
+	NoBounds BoundsStrategy = iota
+	// PublicBounds uses the public value range of the profile as bounds.
+	PublicBounds
+	// EstimatedBounds estimates the bounds with differentially private
+	// quantiles, searched in the approximate value range of the profile, which
+	// uses part of the budget.
+	EstimatedBounds
+)
+
+// String returns the name of the bounds strategy.
+func (bs BoundsStrategy) String() string {
+	switch bs {
+	case NoBounds:
+		return "NoBounds"
+	case PublicBounds:
+		return "PublicBounds"
+	case EstimatedBounds:
+		return "EstimatedBounds"
+	}
+	return fmt.Sprintf("BoundsStrategy(%d)", int(bs))
+}
+
+// DatasetProfile describes a dataset with public or approximate statistics,
+// e.g. from a data catalog. The statistics are not protected by differential
+// privacy, so they must not be computed exactly from the private data.
+type DatasetProfile struct {
+	Rows         int64 // Approximate number of rows. Required.
+	PrivacyUnits int64 // Approximate number of distinct privacy units, e.g. users. Required.
+	Partitions   int64 // Approximate number of distinct partition keys. Required.
+	// Whether the partition keys are public, e.g. the days of a reporting
+	// period, in which case no partition selection is needed.
+	PublicPartitions bool
+	// Range of the aggregated values. Both 0 if there are only counts.
+	ValueLower, ValueUpper float64
+	// Whether ValueLower and ValueUpper are public bounds, e.g. the range of a
+	// rating, or approximate ones, in which case the bounds are estimated.
+	PublicValueRange bool
+}
+
+// SuggestDefaultsOptions contains the options necessary to suggest defaults.
+type SuggestDefaultsOptions struct {
+	Profile DatasetProfile // Profile of the dataset. Required.
+	// Total privacy budget ε. Defaults to 1, a common starting point.
+	Epsilon float64
+	// Number of aggregations computed per partition, e.g. 2 for a count and a
+	// mean, which share the budget of the aggregations. Defaults to 1.
+	Aggregations int
+}
+
+// SuggestedDefaults is a complete starting configuration for a differentially
+// private group-by, see SuggestDefaults. All options use Laplace noise.
+type SuggestedDefaults struct {
+	// Total privacy budget spent by partition selection, bounds estimation and
+	// the aggregations.
+	Epsilon, Delta               float64
+	MaxPartitionsContributed     int64
+	MaxContributionsPerPartition int64
+	BoundsStrategy               BoundsStrategy
+	// Options of partition selection, or nil with public partitions.
+	PartitionSelection *PreAggSelectPartitionOptions
+	// Options of the quantiles estimating the bounds, at ranks
+	// BoundsRanks, or nil unless BoundsStrategy is EstimatedBounds.
+	BoundsEstimation *BoundedQuantilesOptions
+	BoundsRanks      [2]float64
+	// Options of the aggregations, each using the budget of one aggregation
+	// per partition. Sum and Mean are nil with NoBounds; with EstimatedBounds,
+	// their bounds must be replaced by the estimated ones. Sum bounds the total
+	// contribution of a privacy unit to a partition, so contributions must be
+	// pre-aggregated per privacy unit.
+	Count *CountOptions
+	Sum   *BoundedSumFloat64Options
+	Mean  *BoundedMeanFloat64Options
+	// Explanation of each choice, to review the configuration.
+	Rationale []string
+}
+
+// SuggestDefaults proposes a starting configuration from a dataset profile,
+// for users who don't know which parameters to set:
+//   - contribution caps are derived from the average number of rows per
+//     privacy unit, and capped to keep the noise small,
+//   - δ is well below the inverse of the number of privacy units,
+//   - the budget ε is split between partition selection (half of it, unless
+//     partitions are public), bounds estimation (a quarter of the rest, if the
+//     value range isn't public) and the aggregations.
+//
+// The configuration is a starting point: the contribution caps and bounds
+// should then be tuned, e.g. with a ContributionTuner, and the budget set
+// according to the privacy policy.
+func SuggestDefaults(opt *SuggestDefaultsOptions) (*SuggestedDefaults, error) {
+	if opt == nil {
+		opt = &SuggestDefaultsOptions{}
+	}
+	p := opt.Profile
+	if p.PrivacyUnits <= 0 || p.Partitions <= 0 {
+		return nil, fmt.Errorf("SuggestDefaults: PrivacyUnits is %d and Partitions is %d, must be strictly positive", p.PrivacyUnits, p.Partitions)
+	}
+	if p.Rows < p.PrivacyUnits {
+		return nil, fmt.Errorf("SuggestDefaults: Rows is %d, must be at least PrivacyUnits (%d)", p.Rows, p.PrivacyUnits)
+	}
+	if math.IsInf(p.ValueLower, 0) || math.IsInf(p.ValueUpper, 0) || math.IsNaN(p.ValueLower) || math.IsNaN(p.ValueUpper) || p.ValueLower > p.ValueUpper {
+		return nil, fmt.Errorf("SuggestDefaults: value range [%f, %f] must be finite and non-empty", p.ValueLower, p.ValueUpper)
+	}
+	hasValues := p.ValueLower != 0 || p.ValueUpper != 0
+	if hasValues && !p.PublicValueRange && p.ValueLower == p.ValueUpper {
+		return nil, fmt.Errorf("SuggestDefaults: ValueLower and ValueUpper are both %f, an approximate range must not be empty", p.ValueLower)
+	}
+	epsilon := opt.Epsilon
+	if epsilon == 0 {
+		epsilon = defaultSuggestedEpsilon
+	}
+	if err := checks.CheckEpsilonStrict(epsilon); err != nil {
+		return nil, fmt.Errorf("SuggestDefaults: %w", err)
+	}
+	aggregations := opt.Aggregations
+	if aggregations == 0 {
+		aggregations = 1
+	}
+	if aggregations < 0 {
+		return nil, fmt.Errorf("SuggestDefaults: Aggregations is %d, must be strictly positive", aggregations)
+	}
+
+	s := &SuggestedDefaults{Epsilon: epsilon}
+	rowsPerUnit := float64(p.Rows) / float64(p.PrivacyUnits)
+	s.MaxPartitionsContributed = suggestedCap(math.Ceil(rowsPerUnit), p.Partitions)
+	s.MaxContributionsPerPartition = suggestedCap(math.Ceil(rowsPerUnit/float64(s.MaxPartitionsContributed)), maxSuggestedContributionCap)
+	s.Rationale = append(s.Rationale, fmt.Sprintf(
+		"privacy units have %.3g rows on average: MaxPartitionsContributed = %d and MaxContributionsPerPartition = %d, at most %d each since the noise grows linearly with them",
+		rowsPerUnit, s.MaxPartitionsContributed, s.MaxContributionsPerPartition, maxSuggestedContributionCap))
+
+	remaining := epsilon
+	if !p.PublicPartitions {
+		// δ is only needed by partition selection with Laplace noise.
+		s.Delta = math.Min(1e-5, 1/(10*float64(p.PrivacyUnits)))
+		s.PartitionSelection = &PreAggSelectPartitionOptions{
+			Epsilon:                  epsilon / 2,
+			Delta:                    s.Delta,
+			MaxPartitionsContributed: s.MaxPartitionsContributed,
+		}
+		remaining -= epsilon / 2
+		s.Rationale = append(s.Rationale, fmt.Sprintf(
+			"partitions aren't public: half of ε is used by partition selection, with δ = %g, well below 1/%d privacy units", s.Delta, p.PrivacyUnits))
+	} else {
+		s.Rationale = append(s.Rationale, "partitions are public: no partition selection, and δ = 0 with Laplace noise")
+	}
+
+	switch {
+	case !hasValues:
+		s.BoundsStrategy = NoBounds
+		s.Rationale = append(s.Rationale, "no value range: only counts are suggested")
+	case p.PublicValueRange:
+		s.BoundsStrategy = PublicBounds
+		s.Rationale = append(s.Rationale, fmt.Sprintf("the value range [%g, %g] is public and used as bounds", p.ValueLower, p.ValueUpper))
+	default:
+		s.BoundsStrategy = EstimatedBounds
+		s.BoundsEstimation = &BoundedQuantilesOptions{
+			Epsilon:                      remaining / 4,
+			MaxPartitionsContributed:     s.MaxPartitionsContributed,
+			MaxContributionsPerPartition: s.MaxContributionsPerPartition,
+			Lower:                        p.ValueLower,
+			Upper:                        p.ValueUpper,
+			Noise:                        noise.Laplace(),
+		}
+		s.BoundsRanks = [2]float64{suggestedBoundsLowerRank, suggestedBoundsUpperRank}
+		remaining -= remaining / 4
+		s.Rationale = append(s.Rationale, fmt.Sprintf(
+			"the value range [%g, %g] is approximate: a quarter of the remaining ε estimates bounds as the %g and %g quantiles",
+			p.ValueLower, p.ValueUpper, suggestedBoundsLowerRank, suggestedBoundsUpperRank))
+	}
+
+	perAggregation := remaining / float64(aggregations)
+	s.Rationale = append(s.Rationale, fmt.Sprintf("each of the %d aggregations per partition gets ε = %g", aggregations, perAggregation))
+	// Counts of privacy units only need the partition cap.
+	s.Count = &CountOptions{Epsilon: perAggregation, MaxPartitionsContributed: s.MaxPartitionsContributed, Noise: noise.Laplace()}
+	if s.BoundsStrategy != NoBounds {
+		lInf := float64(s.MaxContributionsPerPartition)
+		s.Sum = &BoundedSumFloat64Options{
+			Epsilon:                  perAggregation,
+			MaxPartitionsContributed: s.MaxPartitionsContributed,
+			Lower:                    lInf * math.Min(0, p.ValueLower),
+			Upper:                    lInf * math.Max(0, p.ValueUpper),
+			Noise:                    noise.Laplace(),
+		}
+		s.Mean = &BoundedMeanFloat64Options{
+			Epsilon:                      perAggregation,
+			MaxPartitionsContributed:     s.MaxPartitionsContributed,
+			MaxContributionsPerPartition: s.MaxContributionsPerPartition,
+			Lower:                        p.ValueLower,
+			Upper:                        p.ValueUpper,
+			Noise:                        noise.Laplace(),
+		}
+	}
+	return s, nil
+}
+
+// suggestedCap returns c clamped to [1, min(limit, maxSuggestedContributionCap)].
+func suggestedCap(c float64, limit int64) int64 {
+	limit = minInt64(limit, maxSuggestedContributionCap)
+	return minInt64(int64(math.Max(1, c)), limit)
+}
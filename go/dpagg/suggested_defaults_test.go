@@ -0,0 +1,136 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+)
+
+func TestSuggestDefaultsInvalidProfile(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *SuggestDefaultsOptions
+	}{
+		{"nil options", nil},
+		{"no PrivacyUnits", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 10, Partitions: 2}}},
+		{"no Partitions", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 10, PrivacyUnits: 5}}},
+		{"fewer Rows than PrivacyUnits", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 4, PrivacyUnits: 5, Partitions: 2}}},
+		{"empty value range", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 10, PrivacyUnits: 5, Partitions: 2, ValueLower: 1, ValueUpper: 0}}},
+		{"empty approximate value range", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 10, PrivacyUnits: 5, Partitions: 2, ValueLower: 1, ValueUpper: 1}}},
+		{"negative Epsilon", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 10, PrivacyUnits: 5, Partitions: 2}, Epsilon: -1}},
+		{"negative Aggregations", &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 10, PrivacyUnits: 5, Partitions: 2}, Aggregations: -1}},
+	} {
+		if _, err := SuggestDefaults(tc.opt); err == nil {
+			t.Errorf("SuggestDefaults with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestSuggestDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		desc                   string
+		opt                    *SuggestDefaultsOptions
+		wantDelta              float64
+		wantL0, wantLInf       int64
+		wantBounds             BoundsStrategy
+		wantAggregationEpsilon float64
+	}{
+		{
+			desc:                   "public partitions, counts only",
+			opt:                    &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 300, PrivacyUnits: 100, Partitions: 10, PublicPartitions: true}},
+			wantDelta:              0,
+			wantL0:                 3,
+			wantLInf:               1,
+			wantBounds:             NoBounds,
+			wantAggregationEpsilon: 1,
+		},
+		{
+			desc:                   "private partitions, public value range",
+			opt:                    &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 1000, PrivacyUnits: 1000, Partitions: 50, ValueLower: 0, ValueUpper: 5, PublicValueRange: true}, Epsilon: 2, Aggregations: 2},
+			wantDelta:              1e-5,
+			wantL0:                 1,
+			wantLInf:               1,
+			wantBounds:             PublicBounds,
+			wantAggregationEpsilon: 0.5,
+		},
+		{
+			// Caps are limited by the number of partitions and by
+			// maxSuggestedContributionCap.
+			desc:                   "private partitions, approximate value range",
+			opt:                    &SuggestDefaultsOptions{Profile: DatasetProfile{Rows: 1e8, PrivacyUnits: 1e6, Partitions: 4, ValueLower: -10, ValueUpper: 100}},
+			wantDelta:              1e-7,
+			wantL0:                 4,
+			wantLInf:               8,
+			wantBounds:             EstimatedBounds,
+			wantAggregationEpsilon: 0.375,
+		},
+	} {
+		s, err := SuggestDefaults(tc.opt)
+		if err != nil {
+			t.Fatalf("SuggestDefaults with %s: got error %v", tc.desc, err)
+		}
+		if !ApproxEqual(s.Delta, tc.wantDelta) {
+			t.Errorf("SuggestDefaults with %s: got Delta %g, want %g", tc.desc, s.Delta, tc.wantDelta)
+		}
+		if s.MaxPartitionsContributed != tc.wantL0 || s.MaxContributionsPerPartition != tc.wantLInf {
+			t.Errorf("SuggestDefaults with %s: got caps (%d, %d), want (%d, %d)", tc.desc, s.MaxPartitionsContributed, s.MaxContributionsPerPartition, tc.wantL0, tc.wantLInf)
+		}
+		if s.BoundsStrategy != tc.wantBounds {
+			t.Errorf("SuggestDefaults with %s: got BoundsStrategy %v, want %v", tc.desc, s.BoundsStrategy, tc.wantBounds)
+		}
+		if !ApproxEqual(s.Count.Epsilon, tc.wantAggregationEpsilon) {
+			t.Errorf("SuggestDefaults with %s: got Count.Epsilon %g, want %g", tc.desc, s.Count.Epsilon, tc.wantAggregationEpsilon)
+		}
+		if len(s.Rationale) == 0 {
+			t.Errorf("SuggestDefaults with %s: got no rationale", tc.desc)
+		}
+
+		// The suggested options are valid, and the budget adds up.
+		spent := s.Count.Epsilon * float64(tc.opt.Aggregations)
+		if tc.opt.Aggregations == 0 {
+			spent = s.Count.Epsilon
+		}
+		if _, err := NewCount(s.Count); err != nil {
+			t.Errorf("NewCount with the suggestion for %s: got error %v", tc.desc, err)
+		}
+		if s.PartitionSelection != nil {
+			spent += s.PartitionSelection.Epsilon
+			if _, err := NewPreAggSelectPartition(s.PartitionSelection); err != nil {
+				t.Errorf("NewPreAggSelectPartition with the suggestion for %s: got error %v", tc.desc, err)
+			}
+		}
+		if s.BoundsEstimation != nil {
+			spent += s.BoundsEstimation.Epsilon
+			if _, err := NewBoundedQuantiles(s.BoundsEstimation); err != nil {
+				t.Errorf("NewBoundedQuantiles with the suggestion for %s: got error %v", tc.desc, err)
+			}
+		}
+		if s.BoundsStrategy != NoBounds {
+			if _, err := NewBoundedSumFloat64(s.Sum); err != nil {
+				t.Errorf("NewBoundedSumFloat64 with the suggestion for %s: got error %v", tc.desc, err)
+			}
+			if _, err := NewBoundedMeanFloat64(s.Mean); err != nil {
+				t.Errorf("NewBoundedMeanFloat64 with the suggestion for %s: got error %v", tc.desc, err)
+			}
+		} else if s.Sum != nil || s.Mean != nil {
+			t.Errorf("SuggestDefaults with %s: got Sum or Mean options without bounds", tc.desc)
+		}
+		if !ApproxEqual(spent, s.Epsilon) {
+			t.Errorf("SuggestDefaults with %s: the suggestion spends ε=%g, want %g", tc.desc, spent, s.Epsilon)
+		}
+	}
+}
@@ -18,21 +18,61 @@
 package dpagg
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"unsafe"
 
 	log "github.com/golang/glog"
 	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/metrics"
 	"github.com/google/differential-privacy/go/noise"
 )
 
-// BoundedSumInt64 calculates a differentially private sum of a collection of
-// int64 values. It supports privacy units that contribute to multiple partitions
+// ErrOverflow is returned (wrapped) when adding entries to an integer
+// BoundedSum makes its sum overflow int64. The entries are added nonetheless:
+// the sum saturates to the range of int64 instead of wrapping around.
+var ErrOverflow = errors.New("sum overflows its integer type")
+
+// Number is the set of types of values that BoundedSum can aggregate: signed
+// integers and floating point numbers.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~float32 | ~float64
+}
+
+// BoundedSum calculates a differentially private sum of a collection of values
+// of type T. It supports privacy units that contribute to multiple partitions
 // (via the MaxPartitionsContributed parameter) by scaling the added noise
-// appropriately. However, it assumes that for each BoundedSumInt64 instance
+// appropriately. However, it assumes that for each BoundedSum instance
 // (partition), each privacy unit contributes at most one value. If a privacy unit
 // contributes more, the contributions should be pre-aggregated before passing them
-// to BoundedSumInt64.
+// to BoundedSum.
+//
+// The sum is accumulated in int64 for integer types and in float64 for
+// floating point types, whatever the width of T, and only converted to T by
+// Result, saturating integer types to their range: sums of a few int8 or
+// float32 values don't overflow or lose precision.
+//
+// For integer types, the sum is computed and noised with integer arithmetic.
+// If the sum of the clamped entries overflows int64, it saturates to the range
+// of int64, and the method adding the entry causing the overflow returns an
+// error wrapping ErrOverflow. Saturating additions change the sum by at most
+// the change of an entry, so the sensitivity is unchanged, and Result releases
+// the noised saturated sum as usual: whether the sum overflowed depends on the
+// raw data, so it isn't revealed by Result. The errors of the other methods
+// should only be used to detect misconfigured bounds, not be released.
+// For floating point types, NaN summands are ignored and contributions may be
+// bounded with a Clamper; the sum is noised in float64 precision before being
+// converted to T. The L_∞ sensitivity of float32 sums
+// is rounded up, so that it is never underestimated.
+//
+// If MaxWeight is set, BoundedSum computes a weighted sum Σ_i w_i·e_i of
+// entries added with AddWithWeight, where the weights w_i are public, e.g. the
+// design weights of a survey. The L_∞ sensitivity is then scaled by MaxWeight.
+// Weighted sums are only supported for floating point types; a weighted count
+// can be computed as a weighted sum of ones with bounds [0, 1].
 //
 // The provided differentially private sum is an unbiased estimate of the raw
 // bounded sum in the sense that its expected value is equal to the raw bounded sum.
@@ -40,118 +80,429 @@ import (
 // For general details and key definitions, see
 // https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
 //
-// Note: Do not use when your results may cause overflows for int64
-// values. This aggregation is not hardened for such applications yet.
-//
-// Not thread-safe.
-type BoundedSumInt64 struct {
+// Not thread-safe. To aggregate from multiple goroutines, use ShardedBoundedSum.
+type BoundedSum[T Number] struct {
 	// Parameters
 	epsilon         float64
 	delta           float64
 	l0Sensitivity   int64
-	lInfSensitivity int64
-	lower           int64
-	upper           int64
+	lInfSensitivity T
+	lower           T
+	upper           T
+	clamper         Clamper // only used for floating point types
+	maxWeight       float64 // 0 if the sum is not weighted
+	maxPrivacyUnits int64   // 0 if there is no public bound on the number of privacy units
 	Noise           noise.Noise
 	noiseKind       noise.Kind // necessary for serializing noise.Noise information
 
 	// State variables
-	sum       int64
+	sum       wideSum
 	state     aggregationState
-	noisedSum int64
+	noisedSum T
+	clamped   bool // whether noisedSum was clamped to the population range
+	// Whether the sum saturated to the range of int64 at least once, in which
+	// case it may differ from the exact sum of the entries. It doesn't change
+	// the result, and must not be released.
+	overflowed bool
+	// Number of entries added and of entries changed by clamping, reported to
+	// metrics.Recorder. They are not serialized.
+	entries        int64
+	clampedEntries int64
+	// Budget spent by interim releases, see ResultWithBudget.
+	spentEpsilon float64
+	spentDelta   float64
+}
+
+// BoundedSumInt64 calculates a differentially private sum of a collection of
+// int64 values, see BoundedSum.
+type BoundedSumInt64 = BoundedSum[int64]
+
+// BoundedSumFloat64 calculates a differentially private sum of a collection of
+// float64 values, see BoundedSum.
+type BoundedSumFloat64 = BoundedSum[float64]
+
+// BoundedSumInt32 calculates a differentially private sum of a collection of
+// int32 values, see BoundedSum. The result is an int32, saturated to the range
+// of int32: use BoundedSumInt64 if it may overflow int32.
+type BoundedSumInt32 = BoundedSum[int32]
+
+// BoundedSumFloat32 calculates a differentially private sum of a collection of
+// float32 values, see BoundedSum. The sum is accumulated and returned as a
+// float32: use BoundedSumFloat64 with the values converted to float64, which is
+// exact, for a more precise sum.
+type BoundedSumFloat32 = BoundedSum[float32]
+
+func bsEquallyInitialized[T Number](s1, s2 *BoundedSum[T]) bool {
+	return bsIncompatibleField(s1, s2) == ""
 }
 
-func bsEquallyInitializedint64(s1, s2 *BoundedSumInt64) bool {
-	return s1.epsilon == s2.epsilon &&
-		s1.delta == s2.delta &&
-		s1.l0Sensitivity == s2.l0Sensitivity &&
-		s1.lInfSensitivity == s2.lInfSensitivity &&
-		s1.lower == s2.lower &&
-		s1.upper == s2.upper &&
-		s1.noiseKind == s2.noiseKind &&
-		s1.state == s2.state
+// bsIncompatibleField returns the name of the first option with which s1 and s2
+// were initialized differently, or "" if they were initialized equally.
+func bsIncompatibleField[T Number](s1, s2 *BoundedSum[T]) string {
+	switch {
+	case s1.epsilon != s2.epsilon:
+		return "Epsilon"
+	case s1.delta != s2.delta:
+		return "Delta"
+	case s1.l0Sensitivity != s2.l0Sensitivity:
+		return "MaxPartitionsContributed"
+	case s1.lower != s2.lower:
+		return "Lower"
+	case s1.upper != s2.upper:
+		return "Upper"
+	case s1.maxWeight != s2.maxWeight:
+		return "MaxWeight"
+	case s1.lInfSensitivity != s2.lInfSensitivity:
+		return "MaxContributionsPerPartition"
+	case s1.maxPrivacyUnits != s2.maxPrivacyUnits:
+		return "MaxPrivacyUnits"
+	case s1.noiseKind != s2.noiseKind:
+		return "Noise"
+	case s1.state != s2.state:
+		return "state"
+	}
+	return ""
 }
 
-// BoundedSumInt64Options contains the options necessary to initialize a BoundedSumInt64.
-type BoundedSumInt64Options struct {
+// BoundedSumOptions contains the options necessary to initialize a BoundedSum.
+type BoundedSumOptions[T Number] struct {
 	Epsilon                  float64 // Privacy parameter ε. Required.
 	Delta                    float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
 	MaxPartitionsContributed int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
 	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower <= Upper.
-	Lower, Upper int64
-	Noise        noise.Noise // Type of noise used in BoundedSum. Defaults to Laplace noise.
+	Lower, Upper T
+	Noise        noise.Noise // Type of noise used in BoundedSum. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+	// Transform used to bound contributions to [Lower, Upper]. Defaults to hard
+	// clamping; see Clamper. Only supported for floating point types.
+	Clamper Clamper
+	// Maximum public weight of a single entry, see AddWithWeight. Weights are
+	// clamped to [0, MaxWeight]. Defaults to 0, in which case the sum is not
+	// weighted and AddWithWeight can't be used. Only supported for floating
+	// point types.
+	MaxWeight float64
+	// Public upper bound on the number of privacy units, e.g. the number of
+	// registered users. If set, Result and ComputeConfidenceInterval are
+	// restricted to the possible raw bounded sums, see PopulationCapMetadata.
+	// Defaults to 0, in which case results are not restricted.
+	MaxPrivacyUnits int64
+	// What is protected by differential privacy, see PrivacyLevel. Defaults to
+	// UserLevel.
+	PrivacyLevel PrivacyLevel
 	// How many times may a single privacy unit contribute to a single partition?
 	// Defaults to 1. This is only needed for other aggregation functions using BoundedSum;
 	// which is why the option is not exported.
 	maxContributionsPerPartition int64
 }
 
+// BoundedSumInt64Options contains the options necessary to initialize a BoundedSumInt64.
+type BoundedSumInt64Options = BoundedSumOptions[int64]
+
+// BoundedSumFloat64Options contains the options necessary to initialize a BoundedSumFloat64.
+type BoundedSumFloat64Options = BoundedSumOptions[float64]
+
+// BoundedSumInt32Options contains the options necessary to initialize a BoundedSumInt32.
+type BoundedSumInt32Options = BoundedSumOptions[int32]
+
+// BoundedSumFloat32Options contains the options necessary to initialize a BoundedSumFloat32.
+type BoundedSumFloat32Options = BoundedSumOptions[float32]
+
 // NewBoundedSumInt64 returns a new BoundedSumInt64, whose sum is initialized at 0.
 func NewBoundedSumInt64(opt *BoundedSumInt64Options) (*BoundedSumInt64, error) {
+	return NewBoundedSum(opt)
+}
+
+// NewBoundedSumFloat64 returns a new BoundedSumFloat64, whose sum is initialized at 0.
+func NewBoundedSumFloat64(opt *BoundedSumFloat64Options) (*BoundedSumFloat64, error) {
+	return NewBoundedSum(opt)
+}
+
+// NewBoundedSumInt32 returns a new BoundedSumInt32, whose sum is initialized at 0.
+func NewBoundedSumInt32(opt *BoundedSumInt32Options) (*BoundedSumInt32, error) {
+	return NewBoundedSum(opt)
+}
+
+// NewBoundedSumFloat32 returns a new BoundedSumFloat32, whose sum is initialized at 0.
+func NewBoundedSumFloat32(opt *BoundedSumFloat32Options) (*BoundedSumFloat32, error) {
+	return NewBoundedSum(opt)
+}
+
+// NewBoundedSum returns a new BoundedSum, whose sum is initialized at 0.
+func NewBoundedSum[T Number](opt *BoundedSumOptions[T]) (*BoundedSum[T], error) {
+	name := "New" + bsName[T]()
 	if opt == nil {
-		opt = &BoundedSumInt64Options{}
+		opt = &BoundedSumOptions[T]{}
+	}
+	l0, maxContributionsPerPartition, err := opt.PrivacyLevel.contributionBounds(opt.MaxPartitionsContributed, opt.maxContributionsPerPartition)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 	// Set defaults.
-	l0 := opt.MaxPartitionsContributed
 	if l0 == 0 {
 		l0 = 1
 	}
 
-	maxContributionsPerPartition := opt.maxContributionsPerPartition
 	if maxContributionsPerPartition == 0 {
 		maxContributionsPerPartition = 1
 	}
 
-	n := opt.Noise
-	if n == nil {
-		n = noise.Laplace()
-	}
+	n := noiseOrDefault(opt.Noise, opt.Rho)
 	// Check bounds & use them to compute L_∞ sensitivity
 	lower, upper := opt.Lower, opt.Upper
-	if lower == 0 && upper == 0 {
-		return nil, fmt.Errorf("NewBoundedSumInt64 requires a non-default value for Lower and Upper (automatic bounds determination is not implemented yet). Lower and Upper cannot be both 0")
-	}
-	var err error
-	switch noise.ToKind(opt.Noise) {
-	case noise.Unrecognised:
-		err = checks.CheckBoundsInt64IgnoreOverflows(lower, upper)
-	default:
-		err = checks.CheckBoundsInt64(lower, upper)
+	if err := checks.CheckBoundsNotDefault(float64(lower), float64(upper)); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
+	lInf, err := getLInf(name, lower, upper, maxContributionsPerPartition, opt.Noise)
 	if err != nil {
-		return nil, fmt.Errorf("NewBoundedSumInt64: %w", err)
+		return nil, err
 	}
-	lInf, err := getLInfInt(lower, upper, maxContributionsPerPartition)
-	if err != nil {
-		if noise.ToKind(opt.Noise) == noise.Unrecognised {
-			// Ignore sensitivity overflows if noise is not recognised.
-			log.Warningf("NewBoundedSumInt64: getLInfInt failed with %q, using largest representable integer as lInf_sensitivity", err.Error())
-		} else {
-			return nil, fmt.Errorf("NewBoundedSumInt64: %w", err)
+	if !isFloat[T]() && opt.Clamper != nil {
+		return nil, fmt.Errorf("%s: Clamper is only supported for floating point values", name)
+	}
+	if opt.MaxWeight != 0 {
+		if !isFloat[T]() {
+			return nil, fmt.Errorf("%s: MaxWeight is only supported for floating point values", name)
+		}
+		if !(opt.MaxWeight > 0) || math.IsInf(opt.MaxWeight, 0) {
+			return nil, fmt.Errorf("%s: MaxWeight is %f, must be non-negative and finite", name, opt.MaxWeight)
+		}
+		// Each entry contributes at most MaxWeight times its clamped value.
+		lInf = roundUpTo[T](float64(lInf) * opt.MaxWeight)
+		if math.IsInf(float64(lInf), 0) {
+			return nil, fmt.Errorf("%s: the lInf sensitivity overflows %T when scaled by MaxWeight = %f", name, lInf, opt.MaxWeight)
 		}
 	}
 	// Check that the parameters are compatible with the noise chosen by calling
 	// the noise on some placeholder value.
-	eps, del := opt.Epsilon, opt.Delta
-	_, err = n.AddNoiseInt64(0, l0, lInf, eps, del)
+	eps, del, err := budgetFromRho(opt.Epsilon, opt.Delta, opt.Rho, n)
 	if err != nil {
-		return nil, fmt.Errorf("NewBoundedSumInt64: %w", err)
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
+	_, err = addNoise(n, wideSum{}, l0, lInf, eps, del)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := checkMaxPrivacyUnits(opt.MaxPrivacyUnits, float64(lInf), float64(lower), float64(upper), !isFloat[T]()); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	metrics.Default().AggregationCreated(bsName[T]())
 
-	return &BoundedSumInt64{
+	return &BoundedSum[T]{
 		epsilon:         eps,
 		delta:           del,
 		l0Sensitivity:   l0,
 		lInfSensitivity: lInf,
 		lower:           lower,
 		upper:           upper,
+		clamper:         opt.Clamper,
+		maxWeight:       opt.MaxWeight,
+		maxPrivacyUnits: opt.MaxPrivacyUnits,
 		Noise:           n,
 		noiseKind:       noise.ToKind(n),
-		sum:             0,
 		state:           defaultState,
 	}, nil
 }
 
+// getLInf checks the bounds and returns the L_∞ sensitivity of a BoundedSum,
+// see getLInfInt and getLInfFloat. Bounds and sensitivity overflows are ignored
+// if noise n is not recognised.
+func getLInf[T Number](name string, lower, upper T, maxContributionsPerPartition int64, n noise.Noise) (T, error) {
+	unrecognised := !noise.IsBuiltin(noise.ToKind(n))
+	if isFloat[T]() {
+		var err error
+		if unrecognised {
+			err = checks.CheckBoundsFloat64IgnoreOverflows(float64(lower), float64(upper))
+		} else {
+			err = checks.CheckBoundsFloat64(float64(lower), float64(upper))
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		lInf, err := getLInfFloat(float64(lower), float64(upper), maxContributionsPerPartition)
+		if err == nil && math.IsInf(float64(roundUpTo[T](lInf)), 0) {
+			err = fmt.Errorf("the lInf sensitivity %v overflows %T", lInf, lower)
+		}
+		if err != nil {
+			if !unrecognised {
+				return 0, fmt.Errorf("%s: %w", name, err)
+			}
+			// Ignore sensitivity overflows if noise is not recognised.
+			log.Warningf("%s: getLInfFloat failed with %q, using largest representable integer as lInf_sensitivity", name, err.Error())
+		}
+		return roundUpTo[T](lInf), nil
+	}
+	var err error
+	if unrecognised {
+		err = checks.CheckBoundsInt64IgnoreOverflows(int64(lower), int64(upper))
+	} else {
+		err = checks.CheckBoundsInt64(int64(lower), int64(upper))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	lInf, err := getLInfInt(int64(lower), int64(upper), maxContributionsPerPartition)
+	if err != nil {
+		if !unrecognised {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		// Ignore sensitivity overflows if noise is not recognised.
+		log.Warningf("%s: getLInfInt failed with %q, using largest representable integer as lInf_sensitivity", name, err.Error())
+	}
+	if int64(T(lInf)) != lInf {
+		return 0, fmt.Errorf("%s: the lInf sensitivity %d overflows %T", name, lInf, lower)
+	}
+	return T(lInf), nil
+}
+
+// isFloat returns whether T is a floating point type.
+func isFloat[T Number]() bool {
+	return T(1)/T(2) != 0
+}
+
+// roundUpTo converts x to T, rounding it up if T is float32 and x isn't
+// exactly representable, so that sensitivities are never underestimated.
+func roundUpTo[T Number](x float64) T {
+	t := T(x)
+	if isFloat[T]() && float64(t) < x {
+		t = T(math.Nextafter32(float32(t), float32(math.Inf(1))))
+	}
+	return t
+}
+
+// bsName returns the name of BoundedSum[T] used in error messages.
+func bsName[T Number]() string {
+	var zero T
+	switch any(zero).(type) {
+	case int64:
+		return "BoundedSumInt64"
+	case float64:
+		return "BoundedSumFloat64"
+	case int32:
+		return "BoundedSumInt32"
+	case float32:
+		return "BoundedSumFloat32"
+	}
+	return fmt.Sprintf("BoundedSum[%T]", zero)
+}
+
+// addNoise adds noise n to the sum x of values of type T and converts the
+// result to T, using AddNoiseInt64 if T is an integer type and AddNoiseFloat64
+// otherwise.
+func addNoise[T Number](n noise.Noise, x wideSum, l0 int64, lInf T, epsilon, delta float64) (T, error) {
+	if isFloat[T]() {
+		noised, err := n.AddNoiseFloat64(x.Float, l0, float64(lInf), epsilon, delta)
+		return fromWideSum[T](wideSum{Float: noised}), err
+	}
+	noised, err := n.AddNoiseInt64(x.Int, l0, int64(lInf), epsilon, delta)
+	return fromWideSum[T](wideSum{Int: noised}), err
+}
+
+// wideSum is a sum of values of type T, accumulated in Int for integer types
+// and in Float for floating point types; the other field stays 0. The fields
+// are exported for the gob package.
+type wideSum struct {
+	Int   int64
+	Float float64
+}
+
+// toWideSum returns x as a wideSum.
+func toWideSum[T Number](x T) wideSum {
+	if isFloat[T]() {
+		return wideSum{Float: float64(x)}
+	}
+	return wideSum{Int: int64(x)}
+}
+
+// fromWideSum converts s to T, saturating integer types to their range.
+func fromWideSum[T Number](s wideSum) T {
+	if isFloat[T]() {
+		return T(s.Float)
+	}
+	return saturateInt[T](s.Int)
+}
+
+// add returns s+x, saturated to the range of int64, and whether the sum
+// overflows int64.
+func (s wideSum) add(x wideSum) (wideSum, bool) {
+	sum, overflow := checkedAdd(s.Int, x.Int)
+	if overflow {
+		sum = saturationBound(x.Int)
+	}
+	return wideSum{Int: sum, Float: s.Float + x.Float}, overflow
+}
+
+// times returns s·count, saturated to the range of int64, and whether the
+// product overflows int64, for a non-negative count.
+func (s wideSum) times(count int64) (wideSum, bool) {
+	product, overflow := checkedMul(s.Int, count)
+	if overflow {
+		product = saturationBound(s.Int)
+	}
+	return wideSum{Int: product, Float: s.Float * float64(count)}, overflow
+}
+
+// saturationBound returns the bound of the range of int64 that an overflowing
+// sum or product with the sign of x saturates to.
+func saturationBound(x int64) int64 {
+	if x > 0 {
+		return math.MaxInt64
+	}
+	return math.MinInt64
+}
+
+// value returns s as a float64, e.g. to report it.
+func (s wideSum) value() float64 {
+	return float64(s.Int) + s.Float
+}
+
+// intRange returns the smallest and largest values of the integer type T.
+func intRange[T Number]() (int64, int64) {
+	var zero T
+	bits := 8 * unsafe.Sizeof(zero)
+	return -1 << (bits - 1), 1<<(bits-1) - 1
+}
+
+// saturateInt converts x to the integer type T, replacing values out of the
+// range of T with the closest bound of that range instead of wrapping around.
+func saturateInt[T Number](x int64) T {
+	lower, upper := intRange[T]()
+	if x < lower {
+		return T(lower)
+	}
+	if x > upper {
+		return T(upper)
+	}
+	return T(x)
+}
+
+// checkedAdd returns a+b and whether the sum overflows T. Floating point sums
+// never overflow; they round to ±Inf instead.
+func checkedAdd[T Number](a, b T) (T, bool) {
+	s := a + b
+	if isFloat[T]() {
+		return s, false
+	}
+	return s, (b > 0 && s < a) || (b < 0 && s > a)
+}
+
+// checkedMul returns a·count and whether the product overflows T, for a
+// non-negative count.
+func checkedMul[T Number](a T, count int64) (T, bool) {
+	if isFloat[T]() {
+		return a * T(count), false
+	}
+	if a == 0 || count == 0 {
+		return 0, false
+	}
+	if int64(T(count)) != count {
+		return 0, true
+	}
+	p := a * T(count)
+	return p, p/T(count) != a
+}
+
 // lInfIntOverflows checks if multiplication of the given number overflows int64.
 // If x != x*y/y then x*y overflowed and the multiplication result is incorrect.
 // Thus, the equation evaluates to false.
@@ -190,41 +541,282 @@ func getLInfInt(lower, upper, maxContributionsPerPartition int64) (int64, error)
 	return upper * maxContributionsPerPartition, nil
 }
 
-// Add adds a new summand to the BoundedSumInt64.
-func (bs *BoundedSumInt64) Add(e int64) error {
+func lInfFloatOverflows(bound float64, maxContributionsPerPartition int64) bool {
+	return math.IsInf(bound*float64(maxContributionsPerPartition), 0)
+}
+
+// getLInfFloat checks that the sensitivity parameters will not create overflow errors,
+// and returns the L_inf sensitivity of the BoundedSum object, which is calculated by the
+// formula = max(|lower|, |upper|) * maxContributionsPerPartition.
+func getLInfFloat(lower, upper float64, maxContributionsPerPartition int64) (float64, error) {
+	if lower < 0 {
+		lower = -lower
+	}
+	if upper < 0 {
+		upper = -upper
+	}
+	if lInfFloatOverflows(lower, maxContributionsPerPartition) {
+		return math.Inf(1), fmt.Errorf(
+			"lower = %f and maxContributionsPerPartition =%d are too high - the lInf sensitivity may overflow",
+			lower, maxContributionsPerPartition)
+	}
+	if lInfFloatOverflows(upper, maxContributionsPerPartition) {
+		return math.Inf(1), fmt.Errorf(
+			"upper = %f and maxContributionsPerPartition = %d are too high - the lInf sensitivity may overflow",
+			upper, maxContributionsPerPartition)
+	}
+	if lower > upper {
+		return lower * float64(maxContributionsPerPartition), nil
+	}
+	return upper * float64(maxContributionsPerPartition), nil
+}
+
+// clamp clamps e to the bounds of bs, using its Clamper for floating point types.
+func (bs *BoundedSum[T]) clamp(e T) (T, error) {
+	if isFloat[T]() {
+		clamped, err := clampWith(bs.clamper, float64(e), float64(bs.lower), float64(bs.upper))
+		return T(clamped), err
+	}
+	if bs.lower > bs.upper {
+		return 0, fmt.Errorf("lower must be less than or equal to upper, got lower = %v, upper = %v", bs.lower, bs.upper)
+	}
+	if e > bs.upper {
+		return bs.upper, nil
+	}
+	if e < bs.lower {
+		return bs.lower, nil
+	}
+	return e, nil
+}
+
+// countEntries updates the number of entries and of clamped entries with count
+// entries e whose clamped value is clamped.
+func (bs *BoundedSum[T]) countEntries(e, clamped T, count int64) {
+	bs.entries += count
+	if clamped != e {
+		bs.clampedEntries += count
+	}
+}
+
+// accumulate adds x to the sum. If the sum overflows int64, it saturates, bs
+// is marked as overflowed, and accumulate returns an error wrapping
+// ErrOverflow.
+func (bs *BoundedSum[T]) accumulate(x wideSum) error {
+	previous := bs.sum
+	var overflow bool
+	bs.sum, overflow = bs.sum.add(x)
+	if overflow {
+		bs.overflowed = true
+		return fmt.Errorf("%s: adding %v to %v: %w", bsName[T](), x.value(), previous.value(), ErrOverflow)
+	}
+	return nil
+}
+
+// Add adds a new summand to the BoundedSum. For floating point types, it
+// ignores NaN summands because introducing even a single NaN summand will
+// result in a NaN sum regardless of other summands, which would break the
+// indistinguishability property required for differential privacy.
+//
+// If the sum is weighted, Add(e) is equivalent to AddWithWeight(e, 1).
+func (bs *BoundedSum[T]) Add(e T) error {
 	if bs.state != defaultState {
-		return fmt.Errorf("BoundedSumInt64 cannot be amended: %v", bs.state.errorMessage())
+		return fmt.Errorf("%s cannot be amended: %w", bsName[T](), bs.state.transitionError(defaultState))
+	}
+	// e != e if and only if e is NaN.
+	if e != e {
+		return nil
+	}
+	clamped, err := bs.clamp(e)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
+	}
+	bs.countEntries(e, clamped, 1)
+	return bs.accumulate(toWideSum(clamped * bs.defaultWeight()))
+}
+
+// weighted returns whether bs computes a weighted sum.
+func (bs *BoundedSum[T]) weighted() bool {
+	return bs.maxWeight > 0
+}
+
+// defaultWeight returns the weight of the entries added without a weight,
+// i.e. 1, clamped to [0, MaxWeight] if bs is weighted.
+func (bs *BoundedSum[T]) defaultWeight() T {
+	if bs.weighted() {
+		return T(math.Min(1, bs.maxWeight))
+	}
+	return 1
+}
+
+// AddWithWeight adds the summand e with public weight w to a weighted
+// BoundedSum, i.e. one initialized with a MaxWeight, which adds w·e to the sum.
+// The summand is clamped like in Add, and the weight is clamped to
+// [0, MaxWeight]. Like Add, it skips NaN summands; it returns an error if w is
+// NaN.
+//
+// The weights must not depend on the private data, e.g. they should be the
+// design weights of a survey, since they are not protected by the noise.
+func (bs *BoundedSum[T]) AddWithWeight(e T, w float64) error {
+	if bs.state != defaultState {
+		return fmt.Errorf("%s cannot be amended: %w", bsName[T](), bs.state.transitionError(defaultState))
+	}
+	if !bs.weighted() {
+		return fmt.Errorf("%s: AddWithWeight requires a weighted sum, initialized with a MaxWeight", bsName[T]())
 	}
-	clamped, err := ClampInt64(e, bs.lower, bs.upper)
+	if math.IsNaN(w) {
+		return fmt.Errorf("couldn't add input value %v, weight is NaN", e)
+	}
+	if e != e {
+		return nil
+	}
+	clamped, err := bs.clamp(e)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
+	}
+	clampedWeight, err := ClampFloat64(w, 0, bs.maxWeight)
 	if err != nil {
-		return fmt.Errorf("couldn't clamp input value %v, err %v", e, err)
+		return fmt.Errorf("couldn't clamp weight %v: %w", w, err)
+	}
+	bs.countEntries(e, clamped, 1)
+	return bs.accumulate(wideSum{Float: float64(clamped) * clampedWeight})
+}
+
+// AddSlice adds all elements of s as summands to the BoundedSum, ignoring NaN
+// elements like Add. It is equivalent to calling Add on each element, up to
+// floating point rounding, but faster. If clamping an element fails, no
+// element is added; if the sum overflows, it saturates and AddSlice returns an
+// error wrapping ErrOverflow like Add.
+func (bs *BoundedSum[T]) AddSlice(s []T) error {
+	if bs.state != defaultState {
+		return fmt.Errorf("%s cannot be amended: %w", bsName[T](), bs.state.transitionError(defaultState))
+	}
+	// The elements are added to a copy of the sum, which is only kept if all of
+	// them could be clamped.
+	sum := bs.sum
+	var overflowed bool
+	var entries, clampedEntries int64
+	w := bs.defaultWeight()
+	for _, e := range s {
+		if e != e {
+			continue
+		}
+		clamped, err := bs.clamp(e)
+		if err != nil {
+			return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
+		}
+		var overflow bool
+		sum, overflow = sum.add(toWideSum(clamped * w))
+		overflowed = overflowed || overflow
+		entries++
+		if clamped != e {
+			clampedEntries++
+		}
+	}
+	bs.sum = sum
+	bs.entries += entries
+	bs.clampedEntries += clampedEntries
+	if overflowed {
+		bs.overflowed = true
+		return fmt.Errorf("%s: %w", bsName[T](), ErrOverflow)
 	}
-	bs.sum += clamped
 	return nil
 }
 
+// AddMany adds the summand e count times to the BoundedSum, or nothing if e
+// is NaN. It is equivalent to calling Add(e) count times, up to floating point
+// rounding, but faster. Note that this shouldn't be used to add more
+// contributions to a single partition from the same privacy unit than
+// MaxContributionsPerPartition allows.
+func (bs *BoundedSum[T]) AddMany(e T, count int64) error {
+	if bs.state != defaultState {
+		return fmt.Errorf("%s cannot be amended: %w", bsName[T](), bs.state.transitionError(defaultState))
+	}
+	if count < 0 {
+		return fmt.Errorf("couldn't add input value %v, count is %d, must be non-negative", e, count)
+	}
+	if e != e {
+		return nil
+	}
+	clamped, err := bs.clamp(e)
+	if err != nil {
+		return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
+	}
+	bs.countEntries(e, clamped, count)
+	product, overflow := toWideSum(clamped * bs.defaultWeight()).times(count)
+	if err := bs.accumulate(product); err != nil || !overflow {
+		return err
+	}
+	bs.overflowed = true
+	return fmt.Errorf("%s: adding %v %d times: %w", bsName[T](), e, count, ErrOverflow)
+}
+
+// clampedSum returns the sum of the elements of s clamped with c to
+// [lower, upper] and shifted by -offset, and the number of elements summed.
+// NaN elements are ignored.
+func clampedSum(c Clamper, s []float64, lower, upper, offset float64) (float64, int64, error) {
+	var sum float64
+	var n int64
+	for _, e := range s {
+		if math.IsNaN(e) {
+			continue
+		}
+		clamped, err := clampWith(c, e, lower, upper)
+		if err != nil {
+			return 0, 0, fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
+		}
+		sum += clamped - offset
+		n++
+	}
+	return sum, n, nil
+}
+
+// Reset returns bs to the state it had when it was initialized, discarding all
+// entries and any result. Like Count.Reset, it starts a new expenditure of the
+// privacy budget of bs.
+func (bs *BoundedSum[T]) Reset() {
+	bs.sum = wideSum{}
+	bs.noisedSum = 0
+	bs.clamped = false
+	bs.overflowed = false
+	bs.entries = 0
+	bs.clampedEntries = 0
+	bs.spentEpsilon, bs.spentDelta = 0, 0
+	bs.state = defaultState
+}
+
 // Merge merges bs2 into bs (i.e., adds to bs all entries that were added to
 // bs2). bs2 is consumed by this operation: bs2 may not be used after it is
-// merged into bs.
-func (bs *BoundedSumInt64) Merge(bs2 *BoundedSumInt64) error {
-	if err := checkMergeBoundedSumInt64(bs, bs2); err != nil {
+// merged into bs. If the merged sum overflows, it saturates and Merge returns
+// an error wrapping ErrOverflow. bs is marked as overflowed if bs2 was. The
+// budget spent by interim releases of bs2 is deducted from the remaining
+// budget of bs, like in Count.Merge.
+func (bs *BoundedSum[T]) Merge(bs2 *BoundedSum[T]) error {
+	if err := checkMergeBoundedSum(bs, bs2); err != nil {
 		return err
 	}
-	bs.sum += bs2.sum
+	bs.entries += bs2.entries
+	bs.clampedEntries += bs2.clampedEntries
+	bs.spentEpsilon += bs2.spentEpsilon
+	bs.spentDelta += bs2.spentDelta
 	bs2.state = merged
-	return nil
+	bs.overflowed = bs.overflowed || bs2.overflowed
+	return bs.accumulate(bs2.sum)
 }
 
-func checkMergeBoundedSumInt64(bs1, bs2 *BoundedSumInt64) error {
+func checkMergeBoundedSum[T Number](bs1, bs2 *BoundedSum[T]) error {
+	// The name is only formatted on errors, so that merging doesn't allocate.
 	if bs1.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedSumInt64: bs1 cannot be merged with another BoundedSum instance: %v", bs1.state.errorMessage())
+		return fmt.Errorf("checkMerge%s: bs1 cannot be merged with another BoundedSum instance: %w", bsName[T](), bs1.state.transitionError(merged))
 	}
 	if bs2.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedSumInt64: bs2 cannot be merged with another BoundedSum instance: %v", bs2.state.errorMessage())
+		return fmt.Errorf("checkMerge%s: bs2 cannot be merged with another BoundedSum instance: %w", bsName[T](), bs2.state.transitionError(merged))
 	}
 
-	if !bsEquallyInitializedint64(bs1, bs2) {
-		return fmt.Errorf("checkMergeBoundedSumInt64: bs1 and bs2 are not compatible")
+	if field := bsIncompatibleField(bs1, bs2); field != "" {
+		return fmt.Errorf("checkMerge%s: bs1 and bs2 are not compatible: %w", bsName[T](), &IncompatibleMergeError{Field: field})
+	}
+	if err := checkSpentBudget(bs1.epsilon, bs1.delta, bs1.spentEpsilon+bs2.spentEpsilon, bs1.spentDelta+bs2.spentDelta); err != nil {
+		return fmt.Errorf("checkMerge%s: %w", bsName[T](), err)
 	}
 	return nil
 }
@@ -240,25 +832,112 @@ func checkMergeBoundedSumInt64(bs1, bs2 *BoundedSumInt64) error {
 // by the caller of this method, e.g., by snapping the result to the closest
 // value representing a bounded sum that is possible. Note that such post
 // processing introduces bias to the result.
-func (bs *BoundedSumInt64) Result() (int64, error) {
+//
+// If MaxPrivacyUnits is set, the returned value is clamped to the possible raw
+// bounded sums, which introduces such a bias; see PopulationCapMetadata.
+//
+// For integer types, the result is saturated to the range of T. If the sum
+// overflowed int64, the noised saturated sum is released without error, so
+// that the result doesn't reveal whether it overflowed.
+func (bs *BoundedSum[T]) Result() (T, error) {
 	if bs.state != defaultState {
-		return 0, fmt.Errorf("BoundedSumInt64's noised result cannot be computed: " + bs.state.errorMessage())
+		return 0, fmt.Errorf("%s's noised result cannot be computed: %w", bsName[T](), bs.state.transitionError(resultReturned))
 	}
 	bs.state = resultReturned
+	eps, del := bs.remainingBudget()
 	var err error
-	bs.noisedSum, err = bs.Noise.AddNoiseInt64(bs.sum, bs.l0Sensitivity, bs.lInfSensitivity, bs.epsilon, bs.delta)
-	return bs.noisedSum, err
+	bs.noisedSum, err = addNoise(bs.Noise, bs.sum, bs.l0Sensitivity, bs.lInfSensitivity, eps, del)
+	if err != nil {
+		return bs.noisedSum, err
+	}
+	recorder := metrics.Default()
+	recorder.BudgetConsumed(mechanismName(bs.noiseKind), eps, del)
+	if bs.entries > 0 {
+		recorder.ValuesClamped(bsName[T](), bs.clampedEntries, bs.entries)
+	}
+	recordTranscript(bsName[T](), bs.noiseKind, bs.l0Sensitivity, float64(bs.lInfSensitivity), eps, del, bs.sum.value(), float64(bs.noisedSum))
+	bs.noisedSum, bs.clamped = bs.restrictToPopulation(bs.noisedSum)
+	return bs.noisedSum, nil
+}
+
+// restrictToPopulation clamps a noised sum to the range implied by
+// MaxPrivacyUnits if it is set, and returns whether it was clamped.
+func (bs *BoundedSum[T]) restrictToPopulation(noisedSum T) (T, bool) {
+	if bs.maxPrivacyUnits == 0 {
+		return noisedSum, false
+	}
+	lower, upper := bs.populationRange()
+	if float64(noisedSum) > upper {
+		return T(upper), true
+	} else if float64(noisedSum) < lower {
+		return T(lower), true
+	}
+	return noisedSum, false
+}
+
+// ResultWithBudget returns a differentially private estimate of the current
+// bounded sum that spends only the given fractions of the remaining budget of
+// bs, without consuming bs. See Count.ResultWithBudget.
+func (bs *BoundedSum[T]) ResultWithBudget(epsilonFraction, deltaFraction float64) (T, error) {
+	if bs.state != defaultState {
+		return 0, fmt.Errorf("%s's noised result cannot be computed: %w", bsName[T](), bs.state.transitionError(resultReturned))
+	}
+	if err := checkBudgetFractions(bs.Noise, epsilonFraction, deltaFraction); err != nil {
+		return 0, fmt.Errorf("ResultWithBudget: %w", err)
+	}
+	remainingEps, remainingDel := bs.remainingBudget()
+	eps, del := remainingEps*epsilonFraction, remainingDel*deltaFraction
+	noisedSum, err := addNoise(bs.Noise, bs.sum, bs.l0Sensitivity, bs.lInfSensitivity, eps, del)
+	if err != nil {
+		return 0, err
+	}
+	bs.spentEpsilon += eps
+	bs.spentDelta += del
+	metrics.Default().BudgetConsumed(mechanismName(bs.noiseKind), eps, del)
+	recordTranscript(bsName[T](), bs.noiseKind, bs.l0Sensitivity, float64(bs.lInfSensitivity), eps, del, bs.sum.value(), float64(noisedSum))
+	noisedSum, _ = bs.restrictToPopulation(noisedSum)
+	return noisedSum, nil
+}
+
+// remainingBudget returns the budget of bs left by interim releases.
+func (bs *BoundedSum[T]) remainingBudget() (epsilon, delta float64) {
+	return bs.epsilon - bs.spentEpsilon, bs.delta - bs.spentDelta
+}
+
+// populationRange returns the range of the raw bounded sum implied by
+// MaxPrivacyUnits. For integer types, the bounds are rounded inwards.
+func (bs *BoundedSum[T]) populationRange() (float64, float64) {
+	lower, upper := populationRange(bs.maxPrivacyUnits, float64(bs.lInfSensitivity), float64(bs.lower), float64(bs.upper))
+	if !isFloat[T]() {
+		lower, upper = math.Ceil(lower), math.Floor(upper)
+	}
+	return lower, upper
+}
+
+// PopulationCapMetadata returns how the result of bs was restricted using
+// MaxPrivacyUnits. Result() needs to be called before PopulationCapMetadata,
+// otherwise this will return an error.
+func (bs *BoundedSum[T]) PopulationCapMetadata() (PopulationCapMetadata, error) {
+	if bs.state != resultReturned {
+		return PopulationCapMetadata{}, fmt.Errorf("Result() must be called before calling PopulationCapMetadata()")
+	}
+	if bs.maxPrivacyUnits == 0 {
+		return PopulationCapMetadata{}, nil
+	}
+	lower, upper := bs.populationRange()
+	return PopulationCapMetadata{MaxPrivacyUnits: bs.maxPrivacyUnits, Lower: lower, Upper: upper, Clamped: bs.clamped}, nil
 }
 
 // ThresholdedResult is similar to Result() but applies thresholding to the result.
 // So, if the result is less than the threshold specified by the parameters of
-// BoundedSumInt64 as well as thresholdDelta, it returns nil. Otherwise, it returns
+// BoundedSum as well as thresholdDelta, it returns nil. Otherwise, it returns
 // the result.
 //
 // Note that the nil results should not be published when the existence of a
 // partition in the output depends on private data.
-func (bs *BoundedSumInt64) ThresholdedResult(thresholdDelta float64) (*int64, error) {
-	threshold, err := bs.Noise.Threshold(bs.l0Sensitivity, float64(bs.lInfSensitivity), bs.epsilon, bs.delta, thresholdDelta)
+func (bs *BoundedSum[T]) ThresholdedResult(thresholdDelta float64) (*T, error) {
+	eps, del := bs.remainingBudget()
+	threshold, err := bs.Noise.Threshold(bs.l0Sensitivity, float64(bs.lInfSensitivity), eps, del, thresholdDelta)
 	if err != nil {
 		return nil, err
 	}
@@ -266,28 +945,45 @@ func (bs *BoundedSumInt64) ThresholdedResult(thresholdDelta float64) (*int64, er
 	if err != nil {
 		return nil, err
 	}
+	metrics.Default().BudgetConsumed(thresholdingMechanism, 0, thresholdDelta)
+	if isFloat[T]() {
+		if float64(result) < threshold {
+			metrics.Default().PartitionsDropped(bsName[T](), 1)
+			return nil, nil
+		}
+		return &result, nil
+	}
 	// Rounding up the threshold when converting it to int64 to ensure that no DP guarantees
 	// are violated due to a result being returned that is less than the fractional threshold.
-	if result < int64(math.Ceil(threshold)) {
+	if int64(result) < int64(math.Ceil(threshold)) {
+		metrics.Default().PartitionsDropped(bsName[T](), 1)
 		return nil, nil
 	}
 	return &result, nil
 }
 
-// ComputeConfidenceInterval computes a confidence interval with integer bounds that
-// contains the true sum with a probability greater than or equal to 1 - alpha using
-// the noised sum computed by Result(). The computation is based exclusively on the
-// noised sum returned by Result(). Thus no privacy budget is consumed by this operation.
+// ComputeConfidenceInterval computes a confidence interval that contains the true sum
+// with a probability greater than or equal to 1 - alpha using the noised sum computed by
+// Result(). For integer types, the bounds of the interval are integers. The computation
+// is based exclusively on the noised sum returned by Result(). Thus no privacy budget is
+// consumed by this operation.
 //
 // Result() needs to be called before ComputeConfidenceInterval, otherwise this will return
 // an error.
 //
 // See https://github.com/google/differential-privacy/tree/main/common_docs/confidence_intervals.md.
-func (bs *BoundedSumInt64) ComputeConfidenceInterval(alpha float64) (noise.ConfidenceInterval, error) {
+func (bs *BoundedSum[T]) ComputeConfidenceInterval(alpha float64) (noise.ConfidenceInterval, error) {
 	if bs.state != resultReturned {
 		return noise.ConfidenceInterval{}, fmt.Errorf("Result() must be called before calling ComputeConfidenceInterval()")
 	}
-	confInt, err := bs.Noise.ComputeConfidenceIntervalInt64(bs.noisedSum, bs.l0Sensitivity, bs.lInfSensitivity, bs.epsilon, bs.delta, alpha)
+	eps, del := bs.remainingBudget()
+	var confInt noise.ConfidenceInterval
+	var err error
+	if isFloat[T]() {
+		confInt, err = bs.Noise.ComputeConfidenceIntervalFloat64(float64(bs.noisedSum), bs.l0Sensitivity, float64(bs.lInfSensitivity), eps, del, alpha)
+	} else {
+		confInt, err = bs.Noise.ComputeConfidenceIntervalInt64(int64(bs.noisedSum), bs.l0Sensitivity, int64(bs.lInfSensitivity), eps, del, alpha)
+	}
 	if err != nil {
 		return noise.ConfidenceInterval{}, err
 	}
@@ -299,375 +995,306 @@ func (bs *BoundedSumInt64) ComputeConfidenceInterval(alpha float64) (noise.Confi
 	if bs.upper <= 0 {
 		confInt.LowerBound, confInt.UpperBound = math.Min(0, confInt.LowerBound), math.Min(0, confInt.UpperBound)
 	}
+	if bs.maxPrivacyUnits != 0 {
+		lower, upper := bs.populationRange()
+		confInt = restrictConfidenceInterval(confInt, lower, upper)
+	}
 	return confInt, nil
 }
 
-// encodableBoundedSumFloat64 can be encoded by the gob package.
-type encodableBoundedSumInt64 struct {
+// ExpectedError returns the error e such that the noised sum returned by
+// Result is within e of the true sum of the clamped entries with a
+// probability greater than or equal to 1 - alpha. It only depends on the
+// parameters of the sum and on the budget left by interim releases, so it can
+// be called at any time, e.g. before adding any entry to tune the privacy
+// parameters and the bounds, and no privacy budget is consumed by this
+// operation.
+func (bs *BoundedSum[T]) ExpectedError(alpha float64) (float64, error) {
+	eps, del := bs.remainingBudget()
+	var confInt noise.ConfidenceInterval
+	var err error
+	if isFloat[T]() {
+		confInt, err = bs.Noise.ComputeConfidenceIntervalFloat64(0, bs.l0Sensitivity, float64(bs.lInfSensitivity), eps, del, alpha)
+	} else {
+		confInt, err = bs.Noise.ComputeConfidenceIntervalInt64(0, bs.l0Sensitivity, int64(bs.lInfSensitivity), eps, del, alpha)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return (confInt.UpperBound - confInt.LowerBound) / 2, nil
+}
+
+// encodableBoundedSum can be encoded by the gob package.
+type encodableBoundedSum[T Number] struct {
 	Epsilon         float64
 	Delta           float64
 	L0Sensitivity   int64
-	LInfSensitivity int64
-	Lower           int64
-	Upper           int64
+	LInfSensitivity T
+	Lower           T
+	Upper           T
+	MaxWeight       float64
+	MaxPrivacyUnits int64
 	NoiseKind       noise.Kind
-	Sum             int64
+	Sum             wideSum
+	Overflowed      bool
+	SpentEpsilon    float64
+	SpentDelta      float64
 }
 
-// GobEncode encodes BoundedSumInt64.
-func (bs *BoundedSumInt64) GobEncode() ([]byte, error) {
+// GobEncode encodes BoundedSum.
+func (bs *BoundedSum[T]) GobEncode() ([]byte, error) {
 	if bs.state != defaultState && bs.state != serialized {
-		return nil, fmt.Errorf("BoundedSumInt64 object cannot be serialized: " + bs.state.errorMessage())
+		return nil, fmt.Errorf("%s object cannot be serialized: %w", bsName[T](), bs.state.transitionError(serialized))
 	}
-	enc := encodableBoundedSumInt64{
+	enc := encodableBoundedSum[T]{
 		Epsilon:         bs.epsilon,
 		Delta:           bs.delta,
 		L0Sensitivity:   bs.l0Sensitivity,
 		LInfSensitivity: bs.lInfSensitivity,
 		Lower:           bs.lower,
 		Upper:           bs.upper,
+		MaxWeight:       bs.maxWeight,
+		MaxPrivacyUnits: bs.maxPrivacyUnits,
 		NoiseKind:       noise.ToKind(bs.Noise),
 		Sum:             bs.sum,
+		Overflowed:      bs.overflowed,
+		SpentEpsilon:    bs.spentEpsilon,
+		SpentDelta:      bs.spentDelta,
 	}
 	bs.state = serialized
 	return encode(enc)
 }
 
-// GobDecode decodes BoundedSumInt64.
-func (bs *BoundedSumInt64) GobDecode(data []byte) error {
-	var enc encodableBoundedSumInt64
+// GobDecode decodes BoundedSum.
+func (bs *BoundedSum[T]) GobDecode(data []byte) error {
+	var enc encodableBoundedSum[T]
 	err := decode(&enc, data)
 	if err != nil {
-		return fmt.Errorf("couldn't decode BoundedSumInt64 from bytes")
+		return fmt.Errorf("couldn't decode %s from bytes", bsName[T]())
 	}
-	*bs = BoundedSumInt64{
+	*bs = BoundedSum[T]{
 		epsilon:         enc.Epsilon,
 		delta:           enc.Delta,
 		l0Sensitivity:   enc.L0Sensitivity,
 		lInfSensitivity: enc.LInfSensitivity,
 		lower:           enc.Lower,
 		upper:           enc.Upper,
+		maxWeight:       enc.MaxWeight,
+		maxPrivacyUnits: enc.MaxPrivacyUnits,
 		noiseKind:       enc.NoiseKind,
 		Noise:           noise.ToNoise(enc.NoiseKind),
 		sum:             enc.Sum,
+		overflowed:      enc.Overflowed,
+		spentEpsilon:    enc.SpentEpsilon,
+		spentDelta:      enc.SpentDelta,
 		state:           defaultState,
 	}
 	return nil
 }
 
-// BoundedSumFloat64 calculates a differentially private sum of a collection of
-// float64 values. It supports privacy units that contribute to multiple partitions
-// (via the MaxPartitionsContributed parameter) by scaling the added noise
-// appropriately. However, it assumes that for each BoundedSumFloat64 instance
-// (partition), each privacy unit contributes at most one value. If a privacy unit
-// contributes more, the contributions should be pre-aggregated before passing them
-// to BoundedSumFloat64.
-//
-// The provided differentially private sum is an unbiased estimate of the raw
-// bounded sum meaning that its expected value is equal to the raw bounded sum.
-//
-// For general details and key definitions, see
-// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions,
-//
-// Not thread-safe.
-type BoundedSumFloat64 struct {
-	// Parameters
-	epsilon         float64
-	delta           float64
-	l0Sensitivity   int64
-	lInfSensitivity float64
-	lower           float64
-	upper           float64
-	Noise           noise.Noise
-	noiseKind       noise.Kind // necessary for serializing noise.Noise information
-
-	// State variables
-	sum       float64
-	state     aggregationState
-	noisedSum float64
+type jsonBoundedSumParameters[T Number] struct {
+	jsonPrivacyParameters
+	LInfSensitivity T       `json:"l_inf_sensitivity"`
+	Lower           T       `json:"lower"`
+	Upper           T       `json:"upper"`
+	MaxWeight       float64 `json:"max_weight,omitempty"`
+	MaxPrivacyUnits int64   `json:"max_privacy_units,omitempty"`
 }
 
-func bsEquallyInitializedFloat64(s1, s2 *BoundedSumFloat64) bool {
-	return s1.epsilon == s2.epsilon &&
-		s1.delta == s2.delta &&
-		s1.l0Sensitivity == s2.l0Sensitivity &&
-		s1.lInfSensitivity == s2.lInfSensitivity &&
-		s1.lower == s2.lower &&
-		s1.upper == s2.upper &&
-		s1.noiseKind == s2.noiseKind &&
-		s1.state == s2.state
+// jsonBoundedSumState holds the sum as a json.Number, since it is an int64 or
+// a float64 whatever the width of T.
+type jsonBoundedSumState struct {
+	Sum          json.Number `json:"sum"`
+	Overflowed   bool        `json:"overflowed,omitempty"`
+	SpentEpsilon float64     `json:"spent_epsilon,omitempty"`
+	SpentDelta   float64     `json:"spent_delta,omitempty"`
 }
 
-// BoundedSumFloat64Options contains the options necessary to initialize a BoundedSumFloat64.
-type BoundedSumFloat64Options struct {
-	Epsilon                  float64 // Privacy parameter ε. Required.
-	Delta                    float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
-	MaxPartitionsContributed int64   // How many distinct partitions may a single privacy unit contribute to? Defaults to 1.
-	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower <= Upper.
-	Lower, Upper float64
-	Noise        noise.Noise // Type of noise used in BoundedSum. Defaults to Laplace noise.
-	// How many times may a single privacy unit contribute to a single partition?
-	// Defaults to 1. This is only needed for other aggregation functions using BoundedSum;
-	// which is why the option is not exported.
-	maxContributionsPerPartition int64
-}
-
-// NewBoundedSumFloat64 returns a new BoundedSumFloat64, whose sum is initialized at 0.
-func NewBoundedSumFloat64(opt *BoundedSumFloat64Options) (*BoundedSumFloat64, error) {
-	if opt == nil {
-		opt = &BoundedSumFloat64Options{}
+// MarshalJSON returns the JSON summary of bs, see json_summary.go. Like
+// GobEncode, it consumes bs: it may not be amended, merged or queried
+// afterwards.
+func (bs *BoundedSum[T]) MarshalJSON() ([]byte, error) {
+	if bs.state != defaultState && bs.state != serialized {
+		return nil, fmt.Errorf("%s object cannot be serialized: %w", bsName[T](), bs.state.transitionError(serialized))
+	}
+	params := jsonBoundedSumParameters[T]{
+		jsonPrivacyParameters: jsonPrivacyParameters{
+			Epsilon:                  bs.epsilon,
+			Delta:                    bs.delta,
+			MaxPartitionsContributed: bs.l0Sensitivity,
+			Noise:                    jsonNoiseKind(noise.ToKind(bs.Noise)),
+		},
+		LInfSensitivity: bs.lInfSensitivity,
+		Lower:           bs.lower,
+		Upper:           bs.upper,
+		MaxWeight:       bs.maxWeight,
+		MaxPrivacyUnits: bs.maxPrivacyUnits,
 	}
-	// Set defaults.
-	l0 := opt.MaxPartitionsContributed
-	if l0 == 0 {
-		l0 = 1
-	}
-
-	maxContributionsPerPartition := opt.maxContributionsPerPartition
-	if maxContributionsPerPartition == 0 {
-		maxContributionsPerPartition = 1
+	sum := json.Number(strconv.FormatInt(bs.sum.Int, 10))
+	if isFloat[T]() {
+		sum = json.Number(strconv.FormatFloat(bs.sum.Float, 'g', -1, 64))
 	}
+	bs.state = serialized
+	return marshalJSONSummary(bsName[T](), params, jsonBoundedSumState{Sum: sum, Overflowed: bs.overflowed, SpentEpsilon: bs.spentEpsilon, SpentDelta: bs.spentDelta})
+}
 
-	n := opt.Noise
-	if n == nil {
-		n = noise.Laplace()
-	}
-	// Check bounds & use them to compute L_∞ sensitivity
-	lower, upper := opt.Lower, opt.Upper
-	if lower == 0 && upper == 0 {
-		return nil, fmt.Errorf("NewBoundedSumFloat64 requires a non-default value for Lower and Upper (automatic bounds determination is not implemented yet). Lower and Upper cannot be both 0")
-	}
+// UnmarshalJSON loads the JSON summary of a BoundedSum into bs.
+func (bs *BoundedSum[T]) UnmarshalJSON(data []byte) error {
+	var params jsonBoundedSumParameters[T]
+	var state jsonBoundedSumState
+	if err := unmarshalJSONSummary(data, bsName[T](), &params, &state); err != nil {
+		return fmt.Errorf("couldn't decode %s from JSON: %w", bsName[T](), err)
+	}
+	var sum wideSum
 	var err error
-	switch noise.ToKind(opt.Noise) {
-	case noise.Unrecognised:
-		err = checks.CheckBoundsFloat64IgnoreOverflows(lower, upper)
-	default:
-		err = checks.CheckBoundsFloat64(lower, upper)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("NewBoundedSumFloat64: %w", err)
+	if isFloat[T]() {
+		sum.Float, err = state.Sum.Float64()
+	} else {
+		sum.Int, err = state.Sum.Int64()
 	}
-	lInf, err := getLInfFloat(lower, upper, maxContributionsPerPartition)
 	if err != nil {
-		if noise.ToKind(opt.Noise) == noise.Unrecognised {
-			// Ignore sensitivity overflows if noise is not recognised.
-			log.Warningf("NewBoundedSumFloat64: getLInfFloat failed with %q, using largest representable integer as lInf_sensitivity", err.Error())
-		} else {
-			return nil, fmt.Errorf("NewBoundedSumFloat64: %w", err)
-		}
-	}
-	// Check that the parameters are compatible with the noise chosen by calling
-	// the noise on some placeholder value.
-	eps, del := opt.Epsilon, opt.Delta
-	_, err = n.AddNoiseFloat64(0, l0, lInf, eps, del)
-	if err != nil {
-		return nil, fmt.Errorf("NewBoundedSumFloat64: %w", err)
-	}
-
-	return &BoundedSumFloat64{
-		epsilon:         eps,
-		delta:           del,
-		l0Sensitivity:   l0,
-		lInfSensitivity: lInf,
-		lower:           lower,
-		upper:           upper,
-		Noise:           n,
-		noiseKind:       noise.ToKind(n),
-		sum:             0,
+		return fmt.Errorf("couldn't decode %s from JSON: %w", bsName[T](), err)
+	}
+	kind := noise.Kind(params.Noise)
+	*bs = BoundedSum[T]{
+		epsilon:         params.Epsilon,
+		delta:           params.Delta,
+		l0Sensitivity:   params.MaxPartitionsContributed,
+		lInfSensitivity: params.LInfSensitivity,
+		lower:           params.Lower,
+		upper:           params.Upper,
+		maxWeight:       params.MaxWeight,
+		maxPrivacyUnits: params.MaxPrivacyUnits,
+		noiseKind:       kind,
+		Noise:           noise.ToNoise(kind),
+		sum:             sum,
+		overflowed:      state.Overflowed,
+		spentEpsilon:    state.SpentEpsilon,
+		spentDelta:      state.SpentDelta,
 		state:           defaultState,
-	}, nil
-}
-
-func lInfFloatOverflows(bound float64, maxContributionsPerPartition int64) bool {
-	return math.IsInf(bound*float64(maxContributionsPerPartition), 0)
+	}
+	return nil
 }
 
-// getLInfFloat checks that the sensitivity parameters will not create overflow errors,
-// and returns the L_inf sensitivity of the BoundedSum object, which is calculated by the
-// formula = max(|lower|, |upper|) * maxContributionsPerPartition.
-func getLInfFloat(lower, upper float64, maxContributionsPerPartition int64) (float64, error) {
-	if lower < 0 {
-		lower = -lower
+// Serialize returns the partial aggregate of bs as a serialized
+// BoundedSumSummary protobuf message (see proto/summary.proto). This is the
+// format used by the C++ and Java libraries, so the summary can be merged into a
+// bounded sum of these libraries (e.g., with mergeWith in Java), or loaded into
+// a BoundedSum with Deserialize. For integer types, the sum is stored as an
+// integer value, and the bounds must be exactly representable as float64 values.
+//
+// Like GobEncode, Serialize consumes bs: it may not be amended, merged or
+// queried afterwards. Like Count.Serialize, it fails after ResultWithBudget.
+func (bs *BoundedSum[T]) Serialize() ([]byte, error) {
+	if bs.state != defaultState && bs.state != serialized {
+		return nil, fmt.Errorf("%s object cannot be serialized: %w", bsName[T](), bs.state.transitionError(serialized))
 	}
-	if upper < 0 {
-		upper = -upper
+	if bs.spentEpsilon != 0 || bs.spentDelta != 0 {
+		return nil, fmt.Errorf("%s object cannot be serialized: %w", bsName[T](), errBudgetSpent)
 	}
-	if lInfFloatOverflows(lower, maxContributionsPerPartition) {
-		return math.Inf(1), fmt.Errorf(
-			"lower = %f and maxContributionsPerPartition =%d are too high - the lInf sensitivity may overflow",
-			lower, maxContributionsPerPartition)
-	}
-	if lInfFloatOverflows(upper, maxContributionsPerPartition) {
-		return math.Inf(1), fmt.Errorf(
-			"upper = %f and maxContributionsPerPartition = %d are too high - the lInf sensitivity may overflow",
-			upper, maxContributionsPerPartition)
-	}
-	if lower > upper {
-		return lower * float64(maxContributionsPerPartition), nil
+	s, err := bs.summary()
+	if err != nil {
+		return nil, fmt.Errorf("%s object cannot be serialized: %w", bsName[T](), err)
 	}
-	return upper * float64(maxContributionsPerPartition), nil
+	bs.state = serialized
+	return s.marshal(), nil
 }
 
-// Add adds a new summand to the BoundedSumFloat64. It ignores NaN summands
-// because introducing even a single NaN summand will result in a NaN sum
-// regardless of other summands, which would break the indistinguishability
-// property required for differential privacy.
-func (bs *BoundedSumFloat64) Add(e float64) error {
+// Deserialize merges a serialized BoundedSumSummary protobuf message into bs,
+// adding its partial sum to the one accumulated so far, like Merge. The summary
+// may have been produced by Serialize or by the C++ or Java libraries; in the
+// latter case, for integer types, the partial sum must be integral.
+//
+// bs must have been initialized with the same parameters as the aggregation
+// that produced the summary, and may not have been merged, serialized or
+// queried.
+func (bs *BoundedSum[T]) Deserialize(data []byte) error {
+	name := bsName[T]()
 	if bs.state != defaultState {
-		return fmt.Errorf("BoundedSumFloat64 cannot be amended: %v", bs.state.errorMessage())
+		return fmt.Errorf("%s object cannot be deserialized: %w", name, bs.state.transitionError(defaultState))
 	}
-	if !math.IsNaN(e) {
-		clamped, err := ClampFloat64(e, bs.lower, bs.upper)
-		if err != nil {
-			return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
-		}
-		bs.sum += clamped
+	var s boundedSumSummary
+	if err := s.unmarshal(data); err != nil {
+		return fmt.Errorf("couldn't deserialize %s: %w", name, err)
 	}
-	return nil
-}
-
-// Merge merges bs2 into bs (i.e., adds to bs all entries that were added to
-// bs2). bs2 is consumed by this operation: bs2 may not be used after it is
-// merged into bs.
-func (bs *BoundedSumFloat64) Merge(bs2 *BoundedSumFloat64) error {
-	if err := checkMergeBoundedSumFloat64(bs, bs2); err != nil {
-		return err
+	want, err := bs.summary()
+	if err != nil {
+		return fmt.Errorf("couldn't deserialize %s: %w", name, err)
 	}
-	bs.sum += bs2.sum
-	bs2.state = merged
-	return nil
-}
-
-func checkMergeBoundedSumFloat64(bs1, bs2 *BoundedSumFloat64) error {
-	if bs1.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedSumFloat64: bs1 cannot be merged with another BoundedSum instance: %v", bs1.state.errorMessage())
+	if err := s.checkParameters(want); err != nil {
+		return fmt.Errorf("couldn't deserialize %s, summary is not compatible: %w", name, err)
 	}
-	if bs2.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedSumFloat64: bs2 cannot be merged with another BoundedSum instance: %v", bs2.state.errorMessage())
+	if isFloat[T]() {
+		sum := s.partialSum.floatValue
+		if s.partialSum.isInt {
+			sum = float64(s.partialSum.intValue)
+		}
+		return bs.accumulate(wideSum{Float: sum})
 	}
-
-	if !bsEquallyInitializedFloat64(bs1, bs2) {
-		return fmt.Errorf("checkMergeBoundedSumFloat64: bs1 and bs2 are not compatible")
+	sum := s.partialSum.intValue
+	if !s.partialSum.isInt {
+		f := s.partialSum.floatValue
+		if f != math.Trunc(f) || math.Abs(f) > maxExactFloat64Int {
+			return fmt.Errorf("couldn't deserialize %s: partial sum %v is not an exactly representable integer", name, f)
+		}
+		sum = int64(f)
 	}
-	return nil
+	return bs.accumulate(wideSum{Int: sum})
 }
 
-// Result returns a differentially private estimate of the sum of bounded
-// elements added so far. The method can be called only once.
-//
-// The returned value is an unbiased estimate of the raw bounded sum.
-//
-// The returned value may sometimes be outside the set of possible raw bounded
-// sums, e.g., the differentially private bounded sum may be positive although
-// neither the lower nor the upper bound are positive. This can be corrected
-// by the caller of this method, e.g., by snapping the result to the closest
-// value representing a bounded sum that is possible. Note that such post
-// processing introduces bias to the result.
-func (bs *BoundedSumFloat64) Result() (float64, error) {
-	if bs.state != defaultState {
-		return 0, fmt.Errorf("BoundedSumFloat64's noised result cannot be computed: " + bs.state.errorMessage())
+func (bs *BoundedSum[T]) summary() (*boundedSumSummary, error) {
+	if bs.weighted() {
+		return nil, fmt.Errorf("weighted sums can't be represented as a BoundedSumSummary")
 	}
-	bs.state = resultReturned
-	var err error
-	bs.noisedSum, err = bs.Noise.AddNoiseFloat64(bs.sum, bs.l0Sensitivity, bs.lInfSensitivity, bs.epsilon, bs.delta)
-	return bs.noisedSum, err
-}
-
-// ThresholdedResult is similar to Result() but applies thresholding to the
-// result. So, if the result is less than the threshold specified by the noise,
-// mechanism, it returns nil. Otherwise, it returns the result.
-func (bs *BoundedSumFloat64) ThresholdedResult(thresholdDelta float64) (*float64, error) {
-	threshold, err := bs.Noise.Threshold(bs.l0Sensitivity, bs.lInfSensitivity, bs.epsilon, bs.delta, thresholdDelta)
+	l0, err := toInt32("MaxPartitionsContributed", bs.l0Sensitivity)
 	if err != nil {
 		return nil, err
 	}
-	result, err := bs.Result()
+	if isFloat[T]() {
+		// The L_∞ sensitivity is max(|lower|, |upper|) * maxContributionsPerPartition,
+		// see getLInfFloat.
+		maxAbsBound := math.Max(math.Abs(float64(bs.lower)), math.Abs(float64(bs.upper)))
+		lInf, err := toInt32("MaxContributionsPerPartition", int64(math.Round(float64(bs.lInfSensitivity)/maxAbsBound)))
+		if err != nil {
+			return nil, err
+		}
+		return &boundedSumSummary{
+			partialSum:                   valueType{floatValue: bs.sum.Float},
+			epsilon:                      bs.epsilon,
+			delta:                        bs.delta,
+			mechanismType:                toMechanismType(bs.noiseKind),
+			lower:                        float64(bs.lower),
+			upper:                        float64(bs.upper),
+			maxPartitionsContributed:     l0,
+			maxContributionsPerPartition: lInf,
+		}, nil
+	}
+	lower, err := int64BoundToFloat64("Lower", int64(bs.lower))
 	if err != nil {
 		return nil, err
 	}
-	if result < threshold {
-		return nil, nil
-	}
-	return &result, nil
-}
-
-// ComputeConfidenceInterval computes a confidence interval that contains the true sum
-// with a probability greater than or equal to 1 - alpha using the noised sum computed by
-// Result(). The computation is based exclusively on the noised sum returned by Result().
-// Thus no privacy budget is consumed by this operation.
-//
-// Result() needs to be called before ComputeConfidenceInterval, otherwise this will return
-// an error.
-//
-// See https://github.com/google/differential-privacy/tree/main/common_docs/confidence_intervals.md.
-func (bs *BoundedSumFloat64) ComputeConfidenceInterval(alpha float64) (noise.ConfidenceInterval, error) {
-	if bs.state != resultReturned {
-		return noise.ConfidenceInterval{}, fmt.Errorf("Result() must be called before calling ComputeConfidenceInterval()")
-	}
-	confInt, err := bs.Noise.ComputeConfidenceIntervalFloat64(bs.noisedSum, bs.l0Sensitivity, bs.lInfSensitivity, bs.epsilon, bs.delta, alpha)
+	upper, err := int64BoundToFloat64("Upper", int64(bs.upper))
 	if err != nil {
-		return noise.ConfidenceInterval{}, err
-	}
-	// If lower and upper bounds are non-negative, trim the negative part of the interval.
-	if bs.lower >= 0 {
-		confInt.LowerBound, confInt.UpperBound = math.Max(0, confInt.LowerBound), math.Max(0, confInt.UpperBound)
-	}
-	// Similarly if lower and upper bounds are non-positive, trim the positive part of the interval.
-	if bs.upper <= 0 {
-		confInt.LowerBound, confInt.UpperBound = math.Min(0, confInt.LowerBound), math.Min(0, confInt.UpperBound)
-	}
-	return confInt, nil
-}
-
-// encodableBoundedSumFloat64 can be encoded by the gob package.
-type encodableBoundedSumFloat64 struct {
-	Epsilon         float64
-	Delta           float64
-	L0Sensitivity   int64
-	LInfSensitivity float64
-	Lower           float64
-	Upper           float64
-	NoiseKind       noise.Kind
-	Sum             float64
-}
-
-// GobEncode encodes BoundedSumInt64.
-func (bs *BoundedSumFloat64) GobEncode() ([]byte, error) {
-	if bs.state != defaultState && bs.state != serialized {
-		return nil, fmt.Errorf("BoundedSumFloat64 object cannot be serialized: " + bs.state.errorMessage())
+		return nil, err
 	}
-	enc := encodableBoundedSumFloat64{
-		Epsilon:         bs.epsilon,
-		Delta:           bs.delta,
-		L0Sensitivity:   bs.l0Sensitivity,
-		LInfSensitivity: bs.lInfSensitivity,
-		Lower:           bs.lower,
-		Upper:           bs.upper,
-		NoiseKind:       noise.ToKind(bs.Noise),
-		Sum:             bs.sum,
+	// The L_∞ sensitivity is max(|lower|, |upper|) * maxContributionsPerPartition,
+	// see getLInfInt.
+	maxAbsBound := int64(bs.upper)
+	if -int64(bs.lower) > maxAbsBound {
+		maxAbsBound = -int64(bs.lower)
 	}
-	bs.state = serialized
-	return encode(enc)
-}
-
-// GobDecode decodes BoundedSumInt64.
-func (bs *BoundedSumFloat64) GobDecode(data []byte) error {
-	var enc encodableBoundedSumFloat64
-	err := decode(&enc, data)
+	lInf, err := toInt32("MaxContributionsPerPartition", int64(bs.lInfSensitivity)/maxAbsBound)
 	if err != nil {
-		return fmt.Errorf("couldn't decode BoundedSumFloat64 from bytes")
-	}
-	*bs = BoundedSumFloat64{
-		epsilon:         enc.Epsilon,
-		delta:           enc.Delta,
-		l0Sensitivity:   enc.L0Sensitivity,
-		lInfSensitivity: enc.LInfSensitivity,
-		lower:           enc.Lower,
-		upper:           enc.Upper,
-		noiseKind:       enc.NoiseKind,
-		Noise:           noise.ToNoise(enc.NoiseKind),
-		sum:             enc.Sum,
-		state:           defaultState,
+		return nil, err
 	}
-	return nil
+	return &boundedSumSummary{
+		partialSum:                   valueType{isInt: true, intValue: bs.sum.Int},
+		epsilon:                      bs.epsilon,
+		delta:                        bs.delta,
+		mechanismType:                toMechanismType(bs.noiseKind),
+		lower:                        lower,
+		upper:                        upper,
+		maxPartitionsContributed:     l0,
+		maxContributionsPerPartition: lInf,
+	}, nil
 }
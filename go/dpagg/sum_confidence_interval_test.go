@@ -507,3 +507,41 @@ func TestSumFloat64ComputeConfidenceInterval_StateChecks(t *testing.T) {
 		}
 	}
 }
+
+// Tests that BoundedSumInt64.ExpectedError() and BoundedSumFloat64.ExpectedError() are half
+// the width of the confidence interval of the noise.
+func TestSumExpectedError(t *testing.T) {
+	for _, tc := range []struct {
+		n     noise.Noise
+		delta float64
+	}{
+		{noise.Gaussian(), arbitraryDelta},
+		{noise.Laplace(), 0.0},
+	} {
+		bsInt := getBoundedSumInt64(t, tc.n, arbitraryLowerInt64, arbitraryUpperInt64)
+		got, err := bsInt.ExpectedError(arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, ExpectedError of BoundedSumInt64: got error %v", tc.n, err)
+		}
+		confInt, err := tc.n.ComputeConfidenceIntervalInt64(0, arbitraryMaxPartitionsContributed, arbitraryUpperInt64, arbitraryEpsilon, tc.delta, arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, couldn't compute confidence interval: %v", tc.n, err)
+		}
+		if want := (confInt.UpperBound - confInt.LowerBound) / 2; got != want {
+			t.Errorf("With %v, ExpectedError of BoundedSumInt64: got %f, want %f", tc.n, got, want)
+		}
+
+		bsFloat := getBoundedSumFloat64(t, tc.n, arbitraryLower, arbitraryUpper)
+		got, err = bsFloat.ExpectedError(arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, ExpectedError of BoundedSumFloat64: got error %v", tc.n, err)
+		}
+		confInt, err = tc.n.ComputeConfidenceIntervalFloat64(0, arbitraryMaxPartitionsContributed, arbitraryUpper, arbitraryEpsilon, tc.delta, arbitraryAlpha)
+		if err != nil {
+			t.Fatalf("With %v, couldn't compute confidence interval: %v", tc.n, err)
+		}
+		if want := (confInt.UpperBound - confInt.LowerBound) / 2; !ApproxEqual(got, want) {
+			t.Errorf("With %v, ExpectedError of BoundedSumFloat64: got %f, want %f", tc.n, got, want)
+		}
+	}
+}
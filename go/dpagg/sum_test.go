@@ -17,8 +17,10 @@
 package dpagg
 
 import (
+	"errors"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/google/differential-privacy/go/noise"
@@ -60,6 +62,7 @@ func getNoiselessBSF(t *testing.T) *BoundedSumFloat64 {
 
 func compareBoundedSumInt64(bs1, bs2 *BoundedSumInt64) bool {
 	return bs1.epsilon == bs2.epsilon &&
+		bs1.maxPrivacyUnits == bs2.maxPrivacyUnits &&
 		bs1.delta == bs2.delta &&
 		bs1.l0Sensitivity == bs2.l0Sensitivity &&
 		bs1.lInfSensitivity == bs2.lInfSensitivity &&
@@ -140,6 +143,7 @@ func TestBoundedSumInt64SerializationStateChecks(t *testing.T) {
 
 func compareBoundedSumFloat64(bs1, bs2 *BoundedSumFloat64) bool {
 	return bs1.epsilon == bs2.epsilon &&
+		bs1.maxPrivacyUnits == bs2.maxPrivacyUnits &&
 		bs1.delta == bs2.delta &&
 		bs1.l0Sensitivity == bs2.l0Sensitivity &&
 		bs1.lInfSensitivity == bs2.lInfSensitivity &&
@@ -302,7 +306,6 @@ func TestNewBoundedSumInt64(t *testing.T) {
 				upper:           5,
 				Noise:           noNoise{},
 				noiseKind:       noise.Unrecognised,
-				sum:             0,
 				state:           defaultState,
 			}},
 		{"maxContributionsPerPartition is not set",
@@ -323,7 +326,6 @@ func TestNewBoundedSumInt64(t *testing.T) {
 				upper:           5,
 				Noise:           noNoise{},
 				noiseKind:       noise.Unrecognised,
-				sum:             0,
 				state:           defaultState,
 			}},
 		{"Noise is not set",
@@ -344,7 +346,6 @@ func TestNewBoundedSumInt64(t *testing.T) {
 				upper:           5,
 				Noise:           noise.Laplace(),
 				noiseKind:       noise.LaplaceNoise,
-				sum:             0,
 				state:           defaultState,
 			}},
 		{"lower==upper", // TODO: Move to a separate test function
@@ -365,7 +366,6 @@ func TestNewBoundedSumInt64(t *testing.T) {
 				upper:           5,
 				Noise:           noNoise{},
 				noiseKind:       noise.Unrecognised,
-				sum:             0,
 				state:           defaultState,
 			}},
 	} {
@@ -403,7 +403,6 @@ func TestNewBoundedSumFloat64(t *testing.T) {
 				upper:           5,
 				Noise:           noNoise{},
 				noiseKind:       noise.Unrecognised,
-				sum:             0,
 				state:           defaultState,
 			}},
 		{"maxContributionsPerPartition is not set",
@@ -424,7 +423,6 @@ func TestNewBoundedSumFloat64(t *testing.T) {
 				upper:           5,
 				Noise:           noNoise{},
 				noiseKind:       noise.Unrecognised,
-				sum:             0,
 				state:           defaultState,
 			}},
 		{"Noise is not set",
@@ -445,7 +443,6 @@ func TestNewBoundedSumFloat64(t *testing.T) {
 				upper:           5,
 				Noise:           noise.Laplace(),
 				noiseKind:       noise.LaplaceNoise,
-				sum:             0,
 				state:           defaultState,
 			}},
 		{"lower==upper", // TODO: Move to a separate test function
@@ -466,7 +463,6 @@ func TestNewBoundedSumFloat64(t *testing.T) {
 				upper:           5,
 				Noise:           noNoise{},
 				noiseKind:       noise.Unrecognised,
-				sum:             0,
 				state:           defaultState,
 			}},
 	} {
@@ -526,6 +522,386 @@ func TestAddFloat64IgnoresNaN(t *testing.T) {
 	}
 }
 
+func TestAddSliceInt64(t *testing.T) {
+	bsi := getNoiselessBSI(t)
+	if err := bsi.AddSlice([]int64{-3, 1, 2, 7}); err != nil {
+		t.Fatalf("AddSlice: got error %v", err)
+	}
+	if err := bsi.AddMany(2, 3); err != nil {
+		t.Fatalf("AddMany: got error %v", err)
+	}
+	if err := bsi.AddMany(2, -1); err == nil {
+		t.Errorf("AddMany: got no error with a negative count, want error")
+	}
+	got, err := bsi.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// -3 and 7 are clamped to -1 and 5.
+	const want = -1 + 1 + 2 + 5 + 3*2
+	if got != want {
+		t.Errorf("AddSlice and AddMany: got %d, want %d", got, want)
+	}
+	if err := bsi.AddSlice([]int64{1}); err == nil {
+		t.Errorf("AddSlice: got no error after Result, want error")
+	}
+}
+
+func TestAddSliceFloat64(t *testing.T) {
+	bsf := getNoiselessBSF(t)
+	if err := bsf.AddSlice([]float64{-3, 1.5, math.NaN(), 7}); err != nil {
+		t.Fatalf("AddSlice: got error %v", err)
+	}
+	if err := bsf.AddMany(0.5, 4); err != nil {
+		t.Fatalf("AddMany: got error %v", err)
+	}
+	if err := bsf.AddMany(math.NaN(), 4); err != nil {
+		t.Fatalf("AddMany: got error %v", err)
+	}
+	got, err := bsf.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// -3 and 7 are clamped to -1 and 5, NaN is ignored.
+	want := -1 + 1.5 + 5 + 4*0.5
+	if !ApproxEqual(got, want) {
+		t.Errorf("AddSlice and AddMany: got %f, want %f", got, want)
+	}
+}
+
+func TestAddInt32(t *testing.T) {
+	bs, err := NewBoundedSum(&BoundedSumOptions[int32]{
+		Epsilon:                  ln3,
+		MaxPartitionsContributed: 1,
+		Lower:                    -1,
+		Upper:                    5,
+		Noise:                    noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sum: %v", err)
+	}
+	bs.Add(-3)
+	bs.Add(2)
+	if err := bs.AddSlice([]int32{1, 7}); err != nil {
+		t.Fatalf("AddSlice: got error %v", err)
+	}
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// -3 and 7 are clamped to -1 and 5.
+	const want int32 = -1 + 2 + 1 + 5
+	if got != want {
+		t.Errorf("Add: got %d, want %d", got, want)
+	}
+}
+
+func TestAddFloat32(t *testing.T) {
+	bs, err := NewBoundedSum(&BoundedSumOptions[float32]{
+		Epsilon:                  ln3,
+		MaxPartitionsContributed: 1,
+		Lower:                    -1,
+		Upper:                    5,
+		Noise:                    noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sum: %v", err)
+	}
+	bs.Add(1.5)
+	bs.Add(float32(math.NaN()))
+	bs.Add(7)
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	// 7 is clamped to 5, NaN is ignored.
+	const want float32 = 1.5 + 5
+	if got != want {
+		t.Errorf("Add: got %f, want %f", got, want)
+	}
+}
+
+func TestBoundedSumFloat32SensitivityIsRoundedUp(t *testing.T) {
+	// 3·float32(0.7) rounds down to the nearest float32.
+	lower, upper := float32(-0.7), float32(0.7)
+	bs, err := NewBoundedSumFloat32(&BoundedSumFloat32Options{
+		Epsilon:                      ln3,
+		Lower:                        lower,
+		Upper:                        upper,
+		maxContributionsPerPartition: 3,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumFloat32: %v", err)
+	}
+	want := 3 * float64(upper)
+	if float64(float32(want)) >= want {
+		t.Fatalf("3·float32(0.7) = %v doesn't round down as a float32, the test is invalid", want)
+	}
+	if got := float64(bs.lInfSensitivity); got < want {
+		t.Errorf("NewBoundedSumFloat32: got lInf sensitivity %v, want at least %v", got, want)
+	}
+	if got := bs.lInfSensitivity; got != math.Nextafter32(float32(want), float32(math.Inf(1))) {
+		t.Errorf("NewBoundedSumFloat32: got lInf sensitivity %v, want the smallest float32 larger than %v", got, want)
+	}
+}
+
+func TestRoundUpTo(t *testing.T) {
+	for _, x := range []float64{0, 1, -1, 0.1, -0.1, 1e30, math.Pi} {
+		if got := roundUpTo[float64](x); got != x {
+			t.Errorf("roundUpTo[float64](%v): got %v, want %v", x, got, x)
+		}
+		got := roundUpTo[float32](x)
+		if float64(got) < x {
+			t.Errorf("roundUpTo[float32](%v): got %v, want at least %v", x, got, x)
+		}
+		if prev := math.Nextafter32(got, float32(math.Inf(-1))); float64(prev) >= x {
+			t.Errorf("roundUpTo[float32](%v): got %v, want %v", x, got, prev)
+		}
+	}
+}
+
+func TestBoundedSumInt32AndFloat32Names(t *testing.T) {
+	if _, err := NewBoundedSumInt32(nil); err == nil || !strings.Contains(err.Error(), "NewBoundedSumInt32") {
+		t.Errorf("NewBoundedSumInt32(nil): got error %v, want error mentioning NewBoundedSumInt32", err)
+	}
+	if _, err := NewBoundedSumFloat32(nil); err == nil || !strings.Contains(err.Error(), "NewBoundedSumFloat32") {
+		t.Errorf("NewBoundedSumFloat32(nil): got error %v, want error mentioning NewBoundedSumFloat32", err)
+	}
+}
+
+func TestNewBoundedSumInt32(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *BoundedSumOptions[int32]
+	}{
+		{"Clamper is set",
+			&BoundedSumOptions[int32]{Epsilon: ln3, Lower: -1, Upper: 5, Clamper: HardClamper{}}},
+		{"lInf sensitivity overflows int32",
+			&BoundedSumOptions[int32]{Epsilon: ln3, Lower: -1, Upper: math.MaxInt32, maxContributionsPerPartition: 2}},
+	} {
+		if _, err := NewBoundedSum(tc.opt); err == nil {
+			t.Errorf("NewBoundedSum: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+// Tests that sums of int32 values are accumulated in int64, so that they don't
+// overflow int32, and that the result is saturated to the range of int32.
+func TestBoundedSumInt32AccumulatesInInt64(t *testing.T) {
+	newSum := func() *BoundedSum[int32] {
+		bs, err := NewBoundedSum(&BoundedSumOptions[int32]{
+			Epsilon:                  ln3,
+			MaxPartitionsContributed: 1,
+			Lower:                    math.MinInt32 / 2,
+			Upper:                    math.MaxInt32 / 2,
+			Noise:                    noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize sum: %v", err)
+		}
+		return bs
+	}
+	for _, tc := range []struct {
+		desc string
+		add  func(bs *BoundedSum[int32]) error
+		want int32
+	}{
+		{"Add", func(bs *BoundedSum[int32]) error {
+			for i := 0; i < 3; i++ {
+				if err := bs.Add(math.MaxInt32 / 2); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, math.MaxInt32},
+		{"AddSlice", func(bs *BoundedSum[int32]) error {
+			return bs.AddSlice([]int32{math.MaxInt32 / 2, math.MaxInt32 / 2, math.MaxInt32 / 2})
+		}, math.MaxInt32},
+		{"AddMany", func(bs *BoundedSum[int32]) error {
+			return bs.AddMany(math.MinInt32/2, 3)
+		}, math.MinInt32},
+		{"AddMany with a count overflowing int32", func(bs *BoundedSum[int32]) error {
+			return bs.AddMany(1, math.MaxInt32+1)
+		}, math.MaxInt32},
+		{"Merge", func(bs *BoundedSum[int32]) error {
+			bs2 := newSum()
+			bs.AddMany(math.MaxInt32/2, 2)
+			bs2.AddMany(math.MaxInt32/2, 2)
+			return bs.Merge(bs2)
+		}, math.MaxInt32},
+		{"sum exceeding int32 then back in range", func(bs *BoundedSum[int32]) error {
+			bs.AddMany(math.MaxInt32/2, 3)
+			return bs.AddMany(math.MinInt32/2, 2)
+		}, math.MaxInt32/2 - 2},
+	} {
+		bs := newSum()
+		if err := tc.add(bs); err != nil {
+			t.Errorf("%s: got error %v, want nil", tc.desc, err)
+		}
+		got, err := bs.Result()
+		if err != nil {
+			t.Errorf("Result after %s: got error %v, want nil", tc.desc, err)
+		}
+		if got != tc.want {
+			t.Errorf("Result after %s: got %d, want %d", tc.desc, got, tc.want)
+		}
+	}
+}
+
+// Tests that sums of int8 and float32 values are accumulated in int64 and
+// float64 respectively.
+func TestBoundedSumNarrowTypesAccumulateWide(t *testing.T) {
+	bs8, err := NewBoundedSum(&BoundedSumOptions[int8]{Epsilon: ln3, Lower: -100, Upper: 100, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize int8 sum: %v", err)
+	}
+	// The running sum reaches 300, which overflows int8.
+	bs8.AddSlice([]int8{100, 100, 100, -100, -100, -50})
+	if got, err := bs8.Result(); err != nil || got != 50 {
+		t.Errorf("Result of the int8 sum: got (%d, %v), want (50, nil)", got, err)
+	}
+
+	bs32, err := NewBoundedSum(&BoundedSumOptions[float32]{Epsilon: ln3, Lower: 0, Upper: 1 << 24, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize float32 sum: %v", err)
+	}
+	// 2^24+1 isn't a float32, so accumulating in float32 would lose both ones.
+	bs32.Add(1 << 24)
+	bs32.Add(1)
+	bs32.Add(1)
+	if got, err := bs32.Result(); err != nil || got != 1<<24+2 {
+		t.Errorf("Result of the float32 sum: got (%v, %v), want (%v, nil)", got, err, 1<<24+2)
+	}
+}
+
+// Tests that an int64 sum saturates when it overflows, and that Result then
+// releases the noised saturated sum without error, so that it doesn't reveal
+// the overflow.
+func TestBoundedSumInt64Overflow(t *testing.T) {
+	newSum := func() *BoundedSumInt64 {
+		bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{
+			Epsilon:                  ln3,
+			MaxPartitionsContributed: 1,
+			Lower:                    -math.MaxInt64 / 2,
+			Upper:                    math.MaxInt64 / 2,
+			Noise:                    noNoise{},
+		})
+		if err != nil {
+			t.Fatalf("Couldn't initialize sum: %v", err)
+		}
+		return bs
+	}
+	for _, tc := range []struct {
+		desc string
+		add  func(bs *BoundedSumInt64) error
+		want int64
+	}{
+		{"Add", func(bs *BoundedSumInt64) error {
+			var err error
+			for i := 0; i < 3; i++ {
+				err = bs.Add(math.MaxInt64 / 2)
+			}
+			return err
+		}, math.MaxInt64},
+		{"AddSlice", func(bs *BoundedSumInt64) error {
+			return bs.AddSlice([]int64{math.MaxInt64 / 2, math.MaxInt64 / 2, math.MaxInt64 / 2})
+		}, math.MaxInt64},
+		{"AddMany", func(bs *BoundedSumInt64) error {
+			return bs.AddMany(-math.MaxInt64/2, 3)
+		}, math.MinInt64},
+		{"Merge", func(bs *BoundedSumInt64) error {
+			bs2 := newSum()
+			bs.AddMany(math.MaxInt64/2, 2)
+			bs2.AddMany(math.MaxInt64/2, 2)
+			return bs.Merge(bs2)
+		}, math.MaxInt64},
+		{"AddSlice back in range after saturating", func(bs *BoundedSumInt64) error {
+			return bs.AddSlice([]int64{math.MaxInt64 / 2, math.MaxInt64 / 2, math.MaxInt64 / 2, -math.MaxInt64 / 2})
+		}, math.MaxInt64 - math.MaxInt64/2},
+	} {
+		bs := newSum()
+		if err := tc.add(bs); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s: got error %v, want %v", tc.desc, err, ErrOverflow)
+		}
+		if !bs.overflowed {
+			t.Errorf("%s: got overflowed false, want true", tc.desc)
+		}
+		got, err := bs.Result()
+		if err != nil {
+			t.Errorf("Result after %s: got error %v, want nil", tc.desc, err)
+		}
+		if got != tc.want {
+			t.Errorf("Result after %s: got %d, want %d", tc.desc, got, tc.want)
+		}
+	}
+}
+
+// Tests that overflowed is only set when the sum actually overflows.
+func TestBoundedSumOverflowedOnlyOnOverflow(t *testing.T) {
+	bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, Lower: -10, Upper: 10, Noise: noNoise{}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sum: %v", err)
+	}
+	if err := bs.AddSlice([]int64{10, -10, math.MaxInt64}); err != nil {
+		t.Errorf("AddSlice: got error %v, want nil", err)
+	}
+	if err := bs.AddMany(math.MaxInt64, 1<<40); err != nil {
+		t.Errorf("AddMany: got error %v, want nil", err)
+	}
+	if bs.overflowed {
+		t.Errorf("got overflowed true without overflow, want false")
+	}
+}
+
+func TestBoundedSumOverflowIsSerialized(t *testing.T) {
+	bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{
+		Epsilon:                  ln3,
+		MaxPartitionsContributed: 1,
+		Lower:                    0,
+		Upper:                    math.MaxInt64 / 2,
+		Noise:                    noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize sum: %v", err)
+	}
+	if err := bs.AddMany(math.MaxInt64/2, 3); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("AddMany: got error %v, want %v", err, ErrOverflow)
+	}
+	data, err := bs.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode: got error %v", err)
+	}
+	var decoded BoundedSumInt64
+	if err := decoded.GobDecode(data); err != nil {
+		t.Fatalf("GobDecode: got error %v", err)
+	}
+	if !decoded.overflowed {
+		t.Errorf("GobDecode: got overflowed false, want true")
+	}
+	// noNoise isn't a built-in noise, so it isn't encoded.
+	decoded.Noise = noNoise{}
+	if got, err := decoded.Result(); err != nil || got != math.MaxInt64 {
+		t.Errorf("Result after GobDecode: got (%d, %v), want (%d, nil)", got, err, int64(math.MaxInt64))
+	}
+}
+
+func TestSaturateInt(t *testing.T) {
+	for _, tc := range []struct {
+		x    int64
+		want int8
+	}{
+		{0, 0},
+		{-128, -128},
+		{127, 127},
+		{128, 127},
+		{-1000, -128},
+	} {
+		if got := saturateInt[int8](tc.x); got != tc.want {
+			t.Errorf("saturateInt[int8](%d): got %d, want %d", tc.x, got, tc.want)
+		}
+	}
+}
+
 func TestMergeBoundedSumInt64(t *testing.T) {
 	bs1 := getNoiselessBSI(t)
 	bs2 := getNoiselessBSI(t)
@@ -720,7 +1096,7 @@ func TestCheckMergeBoundedSumInt64Compatibility(t *testing.T) {
 			t.Fatalf("Couldn't initialize bs2: %v", err)
 		}
 
-		if err := checkMergeBoundedSumInt64(bs1, bs2); (err != nil) != tc.wantErr {
+		if err := checkMergeBoundedSum(bs1, bs2); (err != nil) != tc.wantErr {
 			t.Errorf("CheckMerge: when %s for err got got %v, wantErr %t", tc.desc, err, tc.wantErr)
 		}
 	}
@@ -747,7 +1123,7 @@ func TestCheckMergeBoundedSumInt64StateChecks(t *testing.T) {
 		bs1.state = tc.state1
 		bs2.state = tc.state2
 
-		if err := checkMergeBoundedSumInt64(bs1, bs2); (err != nil) != tc.wantErr {
+		if err := checkMergeBoundedSum(bs1, bs2); (err != nil) != tc.wantErr {
 			t.Errorf("CheckMerge: when states [%v, %v] for err got %v, wantErr %t", tc.state1, tc.state2, err, tc.wantErr)
 		}
 	}
@@ -897,7 +1273,7 @@ func TestCheckMergeBoundedSumFloat64Compatibility(t *testing.T) {
 			t.Fatalf("Couldn't initialize bs2: %v", err)
 		}
 
-		if err := checkMergeBoundedSumFloat64(bs1, bs2); (err != nil) != tc.wantErr {
+		if err := checkMergeBoundedSum(bs1, bs2); (err != nil) != tc.wantErr {
 			t.Errorf("CheckMerge: when %s for err got %v, wantErr %t", tc.desc, err, tc.wantErr)
 		}
 	}
@@ -924,7 +1300,7 @@ func TestCheckMergeBoundedSumFloat64StateChecks(t *testing.T) {
 		bs1.state = tc.state1
 		bs2.state = tc.state2
 
-		if err := checkMergeBoundedSumFloat64(bs1, bs2); (err != nil) != tc.wantErr {
+		if err := checkMergeBoundedSum(bs1, bs2); (err != nil) != tc.wantErr {
 			t.Errorf("CheckMerge: when states [%v, %v] for err got %v, wantErr %t", tc.state1, tc.state2, err, tc.wantErr)
 		}
 	}
@@ -1203,7 +1579,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1213,7 +1588,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			true,
 		},
@@ -1227,7 +1601,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         1,
@@ -1237,7 +1610,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1251,7 +1623,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.GaussianNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1261,7 +1632,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.GaussianNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1275,7 +1645,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1285,7 +1654,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1299,7 +1667,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1309,7 +1676,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1323,7 +1689,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1333,7 +1698,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           -1,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1347,7 +1711,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1357,7 +1720,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           2,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1371,7 +1733,6 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumInt64{
 				epsilon:         ln3,
@@ -1381,12 +1742,11 @@ func TestBSEquallyInitializedInt64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           merged},
 			false,
 		},
 	} {
-		if bsEquallyInitializedint64(tc.bs1, tc.bs2) != tc.equal {
+		if bsEquallyInitialized(tc.bs1, tc.bs2) != tc.equal {
 			t.Errorf("bsEquallyInitializedInt64: when %s got %t, want %t", tc.desc, !tc.equal, tc.equal)
 		}
 	}
@@ -1409,7 +1769,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1419,7 +1778,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			true,
 		},
@@ -1433,7 +1791,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         1,
@@ -1443,7 +1800,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1457,7 +1813,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.GaussianNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1467,7 +1822,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.GaussianNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1481,7 +1835,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1491,7 +1844,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1505,7 +1857,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1515,7 +1866,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1529,7 +1879,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1539,7 +1888,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           -1,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1553,7 +1901,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1563,7 +1910,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           2,
-				sum:             0,
 				state:           defaultState},
 			false,
 		},
@@ -1577,7 +1923,6 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           defaultState},
 			&BoundedSumFloat64{
 				epsilon:         ln3,
@@ -1587,12 +1932,11 @@ func TestBSEquallyInitializedFloat64(t *testing.T) {
 				noiseKind:       noise.LaplaceNoise,
 				lower:           0,
 				upper:           1,
-				sum:             0,
 				state:           merged},
 			false,
 		},
 	} {
-		if bsEquallyInitializedFloat64(tc.bs1, tc.bs2) != tc.equal {
+		if bsEquallyInitialized(tc.bs1, tc.bs2) != tc.equal {
 			t.Errorf("bsEquallyInitializedFloat64: when %s got %t, want %t", tc.desc, !tc.equal, tc.equal)
 		}
 	}
@@ -1934,3 +2278,273 @@ func TestBoundedSumFloat64IsUnbiased(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundedSumReset(t *testing.T) {
+	bsi := getNoiselessBSI(t)
+	bsi.Add(4)
+	if _, err := bsi.Result(); err != nil {
+		t.Fatalf("Couldn't compute dp result of BSI: %v", err)
+	}
+	bsi.Reset()
+	bsi.Add(2)
+	if got, err := bsi.Result(); err != nil || got != 2 {
+		t.Errorf("Result of BSI after Reset: got (%d, %v), want (2, nil)", got, err)
+	}
+
+	bsf := getNoiselessBSF(t)
+	bsf.Add(4.5)
+	if _, err := bsf.Result(); err != nil {
+		t.Fatalf("Couldn't compute dp result of BSF: %v", err)
+	}
+	bsf.Reset()
+	bsf.Add(2.5)
+	if got, err := bsf.Result(); err != nil || !ApproxEqual(got, 2.5) {
+		t.Errorf("Result of BSF after Reset: got (%f, %v), want (2.5, nil)", got, err)
+	}
+}
+
+func TestBoundedSumWeighted(t *testing.T) {
+	bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
+		Epsilon:                  ln3,
+		MaxPartitionsContributed: 2,
+		Lower:                    -1,
+		Upper:                    5,
+		MaxWeight:                10,
+		Noise:                    noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize weighted BSF: %v", err)
+	}
+	if !ApproxEqual(bs.lInfSensitivity, 50) {
+		t.Errorf("lInfSensitivity: got %f, want 50", bs.lInfSensitivity)
+	}
+	for _, tc := range []struct{ e, w float64 }{
+		{2, 3},            // contributes 6
+		{10, 0.5},         // contributes 5·0.5
+		{-1, 20},          // weight is clamped, contributes -10
+		{3, -4},           // weight is clamped, contributes 0
+		{math.NaN(), 100}, // ignored
+	} {
+		if err := bs.AddWithWeight(tc.e, tc.w); err != nil {
+			t.Fatalf("AddWithWeight(%f, %f): got error %v", tc.e, tc.w, err)
+		}
+	}
+	if err := bs.AddWithWeight(1, math.NaN()); err == nil {
+		t.Errorf("AddWithWeight(1, NaN): got no error, want error")
+	}
+	// Add uses a weight of 1.
+	bs.Add(4)
+	bs.AddMany(1, 2)
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if want := 6 + 2.5 - 10 + 4 + 2.0; !ApproxEqual(got, want) {
+		t.Errorf("Result: got %f, want %f", got, want)
+	}
+}
+
+func TestBoundedSumWeightedInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		maxWeight float64
+	}{
+		{"negative MaxWeight", -1},
+		{"NaN MaxWeight", math.NaN()},
+		{"infinite MaxWeight", math.Inf(1)},
+	} {
+		if _, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Lower: -1, Upper: 5, MaxWeight: tc.maxWeight}); err == nil {
+			t.Errorf("NewBoundedSumFloat64: with %s got no error, want error", tc.desc)
+		}
+	}
+	if _, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, Lower: -1, Upper: 5, MaxWeight: 2}); err == nil {
+		t.Errorf("NewBoundedSumInt64: with MaxWeight got no error, want error")
+	}
+	if err := getNoiselessBSF(t).AddWithWeight(1, 1); err == nil {
+		t.Errorf("AddWithWeight on an unweighted sum: got no error, want error")
+	}
+
+	opt := &BoundedSumFloat64Options{Epsilon: ln3, Lower: -1, Upper: 5, MaxWeight: 2, Noise: noNoise{}}
+	weighted, err := NewBoundedSumFloat64(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize weighted BSF: %v", err)
+	}
+	opt.MaxWeight = 1
+	other, err := NewBoundedSumFloat64(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize weighted BSF: %v", err)
+	}
+	if err := weighted.Merge(other); err == nil {
+		t.Errorf("Merge with a different MaxWeight: got no error, want error")
+	}
+	if _, err := weighted.Serialize(); err == nil {
+		t.Errorf("Serialize of a weighted sum: got no error, want error")
+	}
+}
+
+// Tests that a BoundedSum decoded on another worker can be merged with local sums.
+func TestBoundedSumSerializeShipMerge(t *testing.T) {
+	shipped := getNoiselessBSF(t)
+	shipped.Add(2.5)
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode(BoundedSumFloat64) error: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode(BoundedSumFloat64) error: %v", err)
+	}
+	received := new(BoundedSumFloat64)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode(BoundedSumFloat64) error: %v", err)
+	}
+	local := getNoiselessBSF(t)
+	local.Add(1)
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded BoundedSumFloat64: got error %v", err)
+	}
+	if !ApproxEqual(received.sum.Float, 3.5) {
+		t.Errorf("sum after merging a decoded BoundedSumFloat64: got %f, want 3.5", received.sum.Float)
+	}
+}
+
+func TestBoundedSumMaxPrivacyUnits(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		entries     []int64
+		want        int64
+		wantClamped bool
+	}{
+		{"sum within the population range", []int64{3, -2, 3}, 4, false},
+		// More entries than privacy units, e.g. one per unit in each shard.
+		{"sum above the population range", []int64{3, 3, 3, 3, 3}, 12, true},
+		{"sum below the population range", []int64{-2, -2, -2, -2, -2}, -8, true},
+	} {
+		bs, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, Lower: -2, Upper: 3, MaxPrivacyUnits: 4, Noise: noNoise{}})
+		if err != nil {
+			t.Fatalf("Couldn't initialize BoundedSumInt64: %v", err)
+		}
+		for _, e := range tc.entries {
+			bs.Add(e)
+		}
+		got, err := bs.Result()
+		if err != nil {
+			t.Fatalf("Result for %s: got error %v", tc.desc, err)
+		}
+		if got != tc.want {
+			t.Errorf("Result for %s: got %d, want %d", tc.desc, got, tc.want)
+		}
+		metadata, err := bs.PopulationCapMetadata()
+		if err != nil {
+			t.Fatalf("PopulationCapMetadata for %s: got error %v", tc.desc, err)
+		}
+		want := PopulationCapMetadata{MaxPrivacyUnits: 4, Lower: -8, Upper: 12, Clamped: tc.wantClamped}
+		if metadata != want {
+			t.Errorf("PopulationCapMetadata for %s: got %+v, want %+v", tc.desc, metadata, want)
+		}
+	}
+}
+
+func TestBoundedSumFloat64MaxPrivacyUnitsConfidenceInterval(t *testing.T) {
+	// Entries are non-negative, so the sum over 4 units is in [0, 4·2.5·2].
+	bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
+		Epsilon:         ln3,
+		Lower:           0,
+		Upper:           2.5,
+		MaxWeight:       2,
+		MaxPrivacyUnits: 4,
+		Noise:           getMockConfInt(noise.ConfidenceInterval{LowerBound: -3, UpperBound: 25}),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+	}
+	bs.AddWithWeight(2, 1.5)
+	if _, err := bs.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	got, err := bs.ComputeConfidenceInterval(arbitraryAlpha)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceInterval: got error %v", err)
+	}
+	want := noise.ConfidenceInterval{LowerBound: 0, UpperBound: 20}
+	if got != want {
+		t.Errorf("ComputeConfidenceInterval: got %+v, want %+v", got, want)
+	}
+}
+
+func TestBoundedSumMaxPrivacyUnitsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *BoundedSumInt64Options
+	}{
+		{"negative MaxPrivacyUnits", &BoundedSumInt64Options{Epsilon: ln3, Lower: -2, Upper: 3, MaxPrivacyUnits: -1}},
+		{"overflowing population range", &BoundedSumInt64Options{Epsilon: ln3, Lower: -2, Upper: 3, MaxPrivacyUnits: math.MaxInt64 / 2}},
+	} {
+		if _, err := NewBoundedSumInt64(tc.opt); err == nil {
+			t.Errorf("NewBoundedSumInt64 with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestBoundedSumResultWithBudget(t *testing.T) {
+	bs := getNoiselessBSF(t)
+	bs.Add(1.5)
+	got, err := bs.ResultWithBudget(0.5, 0.5)
+	if err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	if got != 1.5 {
+		t.Errorf("ResultWithBudget: got %f, want 1.5", got)
+	}
+	if eps, _ := bs.remainingBudget(); !ApproxEqual(eps, 0.5*ln3) || bs.epsilon != ln3 {
+		t.Errorf("ResultWithBudget: got remaining epsilon %e and epsilon %e, want %e and %e", eps, bs.epsilon, 0.5*ln3, ln3)
+	}
+	bs.Add(2)
+	if got, err := bs.Result(); err != nil || got != 3.5 {
+		t.Errorf("Result after ResultWithBudget: got (%f, %v), want (3.5, nil)", got, err)
+	}
+	if _, err := bs.ResultWithBudget(0.5, 0.5); err == nil {
+		t.Errorf("ResultWithBudget after Result: got no error, want error")
+	}
+}
+
+// Tests that the budget spent by an interim release is serialized as state,
+// separately from the parameters of bs, and is kept by Merge with an untouched
+// BoundedSum.
+func TestBoundedSumResultWithBudgetIsSerialized(t *testing.T) {
+	bs1, bs2 := getNoiselessBSI(t), getNoiselessBSI(t)
+	if _, err := bs1.ResultWithBudget(0.5, 0.5); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	bytes, err := encode(bs1)
+	if err != nil {
+		t.Fatalf("encode(BoundedSumInt64) error: %v", err)
+	}
+	decoded := new(BoundedSumInt64)
+	if err := decode(decoded, bytes); err != nil {
+		t.Fatalf("decode(BoundedSumInt64) error: %v", err)
+	}
+	if decoded.epsilon != ln3 || !ApproxEqual(decoded.spentEpsilon, 0.5*ln3) {
+		t.Errorf("decode(encode(_)): got epsilon %e and spent epsilon %e, want %e and %e", decoded.epsilon, decoded.spentEpsilon, ln3, 0.5*ln3)
+	}
+	if err := bs2.Merge(decoded); err != nil {
+		t.Fatalf("Merge with a partially released BoundedSum: got error %v", err)
+	}
+	if eps, _ := bs2.remainingBudget(); !ApproxEqual(eps, 0.5*ln3) {
+		t.Errorf("Merge: got remaining epsilon %e, want %e", eps, 0.5*ln3)
+	}
+	if _, err := bs2.Serialize(); !errors.Is(err, errBudgetSpent) {
+		t.Errorf("Serialize after ResultWithBudget: got error %v, want %v", err, errBudgetSpent)
+	}
+}
+
+func TestBoundedSumResetRestoresBudget(t *testing.T) {
+	bs := getNoiselessBSF(t)
+	if _, err := bs.ResultWithBudget(0.5, 0.5); err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	bs.Reset()
+	if eps, del := bs.remainingBudget(); eps != bs.epsilon || del != bs.delta {
+		t.Errorf("Reset: got remaining budget (%e, %e), want (%e, %e)", eps, del, bs.epsilon, bs.delta)
+	}
+}
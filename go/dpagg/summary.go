@@ -0,0 +1,603 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/differential-privacy/go/noise"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Helpers for serializing DP aggregations into the protobuf summary messages
+// defined in proto/summary.proto. These are the messages produced and consumed
+// by the C++ and Java libraries (e.g., by getSerializableSummary() and
+// mergeWith() in Java), so partial aggregates can be exchanged across languages.
+//
+// The messages are encoded by hand using protowire so that the Go library does
+// not depend on generated code for the shared proto definitions.
+
+// mechanismType mirrors the MechanismType enum in proto/summary.proto.
+type mechanismType int32
+
+const (
+	mechanismEmpty    mechanismType = 0
+	mechanismLaplace  mechanismType = 1
+	mechanismGaussian mechanismType = 2
+)
+
+// maxExactFloat64Int is the largest integer magnitude up to which every int64
+// value is exactly representable as a float64.
+const maxExactFloat64Int = 1 << 53
+
+func toMechanismType(k noise.Kind) mechanismType {
+	switch k {
+	case noise.LaplaceNoise:
+		return mechanismLaplace
+	case noise.GaussianNoise:
+		return mechanismGaussian
+	default:
+		return mechanismEmpty
+	}
+}
+
+// countSummary corresponds to the CountSummary message.
+type countSummary struct {
+	count                        int64
+	epsilon                      float64
+	delta                        float64
+	mechanismType                mechanismType
+	maxPartitionsContributed     int32
+	maxContributionsPerPartition int32
+}
+
+// Field numbers of CountSummary.
+const (
+	countSummaryCountField                        = 1
+	countSummaryEpsilonField                      = 3
+	countSummaryDeltaField                        = 4
+	countSummaryMechanismTypeField                = 5
+	countSummaryMaxPartitionsContributedField     = 6
+	countSummaryMaxContributionsPerPartitionField = 7
+)
+
+func (s *countSummary) marshal() []byte {
+	var b []byte
+	b = appendInt64Field(b, countSummaryCountField, s.count)
+	b = appendDoubleField(b, countSummaryEpsilonField, s.epsilon)
+	// Like the Java library, delta is only set when it is used by the mechanism.
+	if s.delta != 0 {
+		b = appendDoubleField(b, countSummaryDeltaField, s.delta)
+	}
+	b = appendInt64Field(b, countSummaryMechanismTypeField, int64(s.mechanismType))
+	b = appendInt64Field(b, countSummaryMaxPartitionsContributedField, int64(s.maxPartitionsContributed))
+	b = appendInt64Field(b, countSummaryMaxContributionsPerPartitionField, int64(s.maxContributionsPerPartition))
+	return b
+}
+
+func (s *countSummary) unmarshal(b []byte) error {
+	*s = countSummary{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case countSummaryCountField:
+			return consumeInt64(b, typ, &s.count)
+		case countSummaryEpsilonField:
+			return consumeDouble(b, typ, &s.epsilon)
+		case countSummaryDeltaField:
+			return consumeDouble(b, typ, &s.delta)
+		case countSummaryMechanismTypeField:
+			return consumeMechanismType(b, typ, &s.mechanismType)
+		case countSummaryMaxPartitionsContributedField:
+			return consumeInt32(b, typ, &s.maxPartitionsContributed)
+		case countSummaryMaxContributionsPerPartitionField:
+			return consumeInt32(b, typ, &s.maxContributionsPerPartition)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// checkParameters returns an error if the parameters of s and want differ.
+// Accumulated values are ignored.
+func (s *countSummary) checkParameters(want *countSummary) error {
+	if s.mechanismType != want.mechanismType {
+		return fmt.Errorf("mechanism type is %d, want %d", s.mechanismType, want.mechanismType)
+	}
+	if s.epsilon != want.epsilon {
+		return fmt.Errorf("epsilon is %v, want %v", s.epsilon, want.epsilon)
+	}
+	if s.delta != want.delta {
+		return fmt.Errorf("delta is %v, want %v", s.delta, want.delta)
+	}
+	if s.maxPartitionsContributed != want.maxPartitionsContributed {
+		return fmt.Errorf("max partitions contributed is %d, want %d", s.maxPartitionsContributed, want.maxPartitionsContributed)
+	}
+	if s.maxContributionsPerPartition != want.maxContributionsPerPartition {
+		return fmt.Errorf("max contributions per partition is %d, want %d", s.maxContributionsPerPartition, want.maxContributionsPerPartition)
+	}
+	return nil
+}
+
+// valueType corresponds to the ValueType message of proto/data.proto. Only the
+// numeric cases of the oneof are supported.
+type valueType struct {
+	isInt      bool
+	intValue   int64
+	floatValue float64
+}
+
+// Field numbers of ValueType.
+const (
+	valueTypeIntValueField   = 1
+	valueTypeFloatValueField = 2
+)
+
+func (v *valueType) marshal() []byte {
+	if v.isInt {
+		return appendInt64Field(nil, valueTypeIntValueField, v.intValue)
+	}
+	return appendDoubleField(nil, valueTypeFloatValueField, v.floatValue)
+}
+
+func (v *valueType) unmarshal(b []byte) error {
+	*v = valueType{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case valueTypeIntValueField:
+			v.isInt, v.floatValue = true, 0
+			return consumeInt64(b, typ, &v.intValue)
+		case valueTypeFloatValueField:
+			v.isInt, v.intValue = false, 0
+			return consumeDouble(b, typ, &v.floatValue)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// boundedSumSummary corresponds to the BoundedSumSummary message. Like the
+// Java library, only partial_sum is used to store the sum.
+type boundedSumSummary struct {
+	partialSum                   valueType
+	epsilon                      float64
+	delta                        float64
+	mechanismType                mechanismType
+	lower                        float64
+	upper                        float64
+	maxPartitionsContributed     int32
+	maxContributionsPerPartition int32
+}
+
+// Field numbers of BoundedSumSummary.
+const (
+	boundedSumSummaryPartialSumField                   = 4
+	boundedSumSummaryEpsilonField                      = 5
+	boundedSumSummaryDeltaField                        = 6
+	boundedSumSummaryMechanismTypeField                = 7
+	boundedSumSummaryLowerField                        = 8
+	boundedSumSummaryUpperField                        = 9
+	boundedSumSummaryMaxPartitionsContributedField     = 10
+	boundedSumSummaryMaxContributionsPerPartitionField = 11
+)
+
+func (s *boundedSumSummary) marshal() []byte {
+	var b []byte
+	b = appendMessageField(b, boundedSumSummaryPartialSumField, s.partialSum.marshal())
+	b = appendDoubleField(b, boundedSumSummaryEpsilonField, s.epsilon)
+	if s.delta != 0 {
+		b = appendDoubleField(b, boundedSumSummaryDeltaField, s.delta)
+	}
+	b = appendInt64Field(b, boundedSumSummaryMechanismTypeField, int64(s.mechanismType))
+	b = appendDoubleField(b, boundedSumSummaryLowerField, s.lower)
+	b = appendDoubleField(b, boundedSumSummaryUpperField, s.upper)
+	b = appendInt64Field(b, boundedSumSummaryMaxPartitionsContributedField, int64(s.maxPartitionsContributed))
+	b = appendInt64Field(b, boundedSumSummaryMaxContributionsPerPartitionField, int64(s.maxContributionsPerPartition))
+	return b
+}
+
+func (s *boundedSumSummary) unmarshal(b []byte) error {
+	*s = boundedSumSummary{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case boundedSumSummaryPartialSumField:
+			return consumeMessage(b, typ, s.partialSum.unmarshal)
+		case boundedSumSummaryEpsilonField:
+			return consumeDouble(b, typ, &s.epsilon)
+		case boundedSumSummaryDeltaField:
+			return consumeDouble(b, typ, &s.delta)
+		case boundedSumSummaryMechanismTypeField:
+			return consumeMechanismType(b, typ, &s.mechanismType)
+		case boundedSumSummaryLowerField:
+			return consumeDouble(b, typ, &s.lower)
+		case boundedSumSummaryUpperField:
+			return consumeDouble(b, typ, &s.upper)
+		case boundedSumSummaryMaxPartitionsContributedField:
+			return consumeInt32(b, typ, &s.maxPartitionsContributed)
+		case boundedSumSummaryMaxContributionsPerPartitionField:
+			return consumeInt32(b, typ, &s.maxContributionsPerPartition)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// checkParameters returns an error if the parameters of s and want differ.
+// Accumulated values are ignored.
+func (s *boundedSumSummary) checkParameters(want *boundedSumSummary) error {
+	if s.mechanismType != want.mechanismType {
+		return fmt.Errorf("mechanism type is %d, want %d", s.mechanismType, want.mechanismType)
+	}
+	if s.epsilon != want.epsilon {
+		return fmt.Errorf("epsilon is %v, want %v", s.epsilon, want.epsilon)
+	}
+	if s.delta != want.delta {
+		return fmt.Errorf("delta is %v, want %v", s.delta, want.delta)
+	}
+	if s.lower != want.lower || s.upper != want.upper {
+		return fmt.Errorf("bounds are [%v, %v], want [%v, %v]", s.lower, s.upper, want.lower, want.upper)
+	}
+	if s.maxPartitionsContributed != want.maxPartitionsContributed {
+		return fmt.Errorf("max partitions contributed is %d, want %d", s.maxPartitionsContributed, want.maxPartitionsContributed)
+	}
+	if s.maxContributionsPerPartition != want.maxContributionsPerPartition {
+		return fmt.Errorf("max contributions per partition is %d, want %d", s.maxContributionsPerPartition, want.maxContributionsPerPartition)
+	}
+	return nil
+}
+
+// Field numbers of BoundedMeanSummary.
+const (
+	boundedMeanSummarySumSummaryField   = 5
+	boundedMeanSummaryCountSummaryField = 6
+)
+
+// Field numbers of BoundedVarianceSummary.
+const (
+	boundedVarianceSummarySumOfSquaresSummaryField = 7
+	boundedVarianceSummarySumSummaryField          = 8
+	boundedVarianceSummaryCountSummaryField        = 9
+)
+
+// boundedQuantilesSummary corresponds to the BoundedQuantilesSummary message.
+type boundedQuantilesSummary struct {
+	quantileTree                 map[int32]int64
+	epsilon                      float64
+	delta                        float64
+	mechanismType                mechanismType
+	lower                        float64
+	upper                        float64
+	maxPartitionsContributed     int32
+	maxContributionsPerPartition int32
+	treeHeight                   int32
+	branchingFactor              int32
+}
+
+// Field numbers of BoundedQuantilesSummary.
+const (
+	boundedQuantilesSummaryQuantileTreeField                 = 1
+	boundedQuantilesSummaryEpsilonField                      = 2
+	boundedQuantilesSummaryDeltaField                        = 3
+	boundedQuantilesSummaryMechanismTypeField                = 4
+	boundedQuantilesSummaryLowerField                        = 5
+	boundedQuantilesSummaryUpperField                        = 6
+	boundedQuantilesSummaryMaxPartitionsContributedField     = 7
+	boundedQuantilesSummaryMaxContributionsPerPartitionField = 8
+	boundedQuantilesSummaryTreeHeightField                   = 9
+	boundedQuantilesSummaryBranchingFactorField              = 10
+)
+
+// Field numbers of the entries of a protobuf map.
+const (
+	mapEntryKeyField   = 1
+	mapEntryValueField = 2
+)
+
+func (s *boundedQuantilesSummary) marshal() []byte {
+	var b []byte
+	for _, index := range sortedInt32Keys(s.quantileTree) {
+		var entry []byte
+		entry = appendInt64Field(entry, mapEntryKeyField, int64(index))
+		entry = appendInt64Field(entry, mapEntryValueField, s.quantileTree[index])
+		b = appendMessageField(b, boundedQuantilesSummaryQuantileTreeField, entry)
+	}
+	b = appendDoubleField(b, boundedQuantilesSummaryEpsilonField, s.epsilon)
+	if s.delta != 0 {
+		b = appendDoubleField(b, boundedQuantilesSummaryDeltaField, s.delta)
+	}
+	b = appendInt64Field(b, boundedQuantilesSummaryMechanismTypeField, int64(s.mechanismType))
+	b = appendDoubleField(b, boundedQuantilesSummaryLowerField, s.lower)
+	b = appendDoubleField(b, boundedQuantilesSummaryUpperField, s.upper)
+	b = appendInt64Field(b, boundedQuantilesSummaryMaxPartitionsContributedField, int64(s.maxPartitionsContributed))
+	b = appendInt64Field(b, boundedQuantilesSummaryMaxContributionsPerPartitionField, int64(s.maxContributionsPerPartition))
+	b = appendInt64Field(b, boundedQuantilesSummaryTreeHeightField, int64(s.treeHeight))
+	b = appendInt64Field(b, boundedQuantilesSummaryBranchingFactorField, int64(s.branchingFactor))
+	return b
+}
+
+func (s *boundedQuantilesSummary) unmarshal(b []byte) error {
+	*s = boundedQuantilesSummary{quantileTree: make(map[int32]int64)}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case boundedQuantilesSummaryQuantileTreeField:
+			return consumeMessage(b, typ, func(entry []byte) error {
+				var key int32
+				var value int64
+				err := consumeFields(entry, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					switch num {
+					case mapEntryKeyField:
+						return consumeInt32(b, typ, &key)
+					case mapEntryValueField:
+						return consumeInt64(b, typ, &value)
+					}
+					return skipField(num, typ, b)
+				})
+				s.quantileTree[key] = value
+				return err
+			})
+		case boundedQuantilesSummaryEpsilonField:
+			return consumeDouble(b, typ, &s.epsilon)
+		case boundedQuantilesSummaryDeltaField:
+			return consumeDouble(b, typ, &s.delta)
+		case boundedQuantilesSummaryMechanismTypeField:
+			return consumeMechanismType(b, typ, &s.mechanismType)
+		case boundedQuantilesSummaryLowerField:
+			return consumeDouble(b, typ, &s.lower)
+		case boundedQuantilesSummaryUpperField:
+			return consumeDouble(b, typ, &s.upper)
+		case boundedQuantilesSummaryMaxPartitionsContributedField:
+			return consumeInt32(b, typ, &s.maxPartitionsContributed)
+		case boundedQuantilesSummaryMaxContributionsPerPartitionField:
+			return consumeInt32(b, typ, &s.maxContributionsPerPartition)
+		case boundedQuantilesSummaryTreeHeightField:
+			return consumeInt32(b, typ, &s.treeHeight)
+		case boundedQuantilesSummaryBranchingFactorField:
+			return consumeInt32(b, typ, &s.branchingFactor)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// checkParameters returns an error if the parameters of s and want differ.
+// Accumulated values are ignored.
+func (s *boundedQuantilesSummary) checkParameters(want *boundedQuantilesSummary) error {
+	if s.mechanismType != want.mechanismType {
+		return fmt.Errorf("mechanism type is %d, want %d", s.mechanismType, want.mechanismType)
+	}
+	if s.epsilon != want.epsilon {
+		return fmt.Errorf("epsilon is %v, want %v", s.epsilon, want.epsilon)
+	}
+	if s.delta != want.delta {
+		return fmt.Errorf("delta is %v, want %v", s.delta, want.delta)
+	}
+	if s.lower != want.lower || s.upper != want.upper {
+		return fmt.Errorf("bounds are [%v, %v], want [%v, %v]", s.lower, s.upper, want.lower, want.upper)
+	}
+	if s.maxPartitionsContributed != want.maxPartitionsContributed {
+		return fmt.Errorf("max partitions contributed is %d, want %d", s.maxPartitionsContributed, want.maxPartitionsContributed)
+	}
+	if s.maxContributionsPerPartition != want.maxContributionsPerPartition {
+		return fmt.Errorf("max contributions per partition is %d, want %d", s.maxContributionsPerPartition, want.maxContributionsPerPartition)
+	}
+	if s.treeHeight != want.treeHeight {
+		return fmt.Errorf("tree height is %d, want %d", s.treeHeight, want.treeHeight)
+	}
+	if s.branchingFactor != want.branchingFactor {
+		return fmt.Errorf("branching factor is %d, want %d", s.branchingFactor, want.branchingFactor)
+	}
+	return nil
+}
+
+// preAggSelectPartitionSummary corresponds to the PreAggSelectPartitionSummary
+// message.
+type preAggSelectPartitionSummary struct {
+	idCount                  int64
+	epsilon                  float64
+	delta                    float64
+	maxPartitionsContributed int32
+}
+
+// Field numbers of PreAggSelectPartitionSummary.
+const (
+	preAggSelectPartitionSummaryIDCountField                  = 1
+	preAggSelectPartitionSummaryEpsilonField                  = 2
+	preAggSelectPartitionSummaryDeltaField                    = 3
+	preAggSelectPartitionSummaryMaxPartitionsContributedField = 4
+)
+
+func (s *preAggSelectPartitionSummary) marshal() []byte {
+	var b []byte
+	b = appendInt64Field(b, preAggSelectPartitionSummaryIDCountField, s.idCount)
+	b = appendDoubleField(b, preAggSelectPartitionSummaryEpsilonField, s.epsilon)
+	b = appendDoubleField(b, preAggSelectPartitionSummaryDeltaField, s.delta)
+	b = appendInt64Field(b, preAggSelectPartitionSummaryMaxPartitionsContributedField, int64(s.maxPartitionsContributed))
+	return b
+}
+
+func (s *preAggSelectPartitionSummary) unmarshal(b []byte) error {
+	*s = preAggSelectPartitionSummary{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case preAggSelectPartitionSummaryIDCountField:
+			return consumeInt64(b, typ, &s.idCount)
+		case preAggSelectPartitionSummaryEpsilonField:
+			return consumeDouble(b, typ, &s.epsilon)
+		case preAggSelectPartitionSummaryDeltaField:
+			return consumeDouble(b, typ, &s.delta)
+		case preAggSelectPartitionSummaryMaxPartitionsContributedField:
+			return consumeInt32(b, typ, &s.maxPartitionsContributed)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// checkParameters returns an error if the parameters of s and want differ.
+// Accumulated values are ignored.
+func (s *preAggSelectPartitionSummary) checkParameters(want *preAggSelectPartitionSummary) error {
+	if s.epsilon != want.epsilon {
+		return fmt.Errorf("epsilon is %v, want %v", s.epsilon, want.epsilon)
+	}
+	if s.delta != want.delta {
+		return fmt.Errorf("delta is %v, want %v", s.delta, want.delta)
+	}
+	if s.maxPartitionsContributed != want.maxPartitionsContributed {
+		return fmt.Errorf("max partitions contributed is %d, want %d", s.maxPartitionsContributed, want.maxPartitionsContributed)
+	}
+	return nil
+}
+
+// consumeSubmessages splits a message consisting of submessage fields into the
+// raw encodings of the submessages, keyed by field number. Other fields are
+// skipped.
+func consumeSubmessages(b []byte, fields ...protowire.Number) (map[protowire.Number][]byte, error) {
+	wanted := make(map[protowire.Number]bool)
+	for _, f := range fields {
+		wanted[f] = true
+	}
+	submessages := make(map[protowire.Number][]byte)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if !wanted[num] {
+			return skipField(num, typ, b)
+		}
+		return consumeMessage(b, typ, func(m []byte) error {
+			// Following protobuf semantics, repeated occurrences of a submessage
+			// field are merged, which for our encodings amounts to concatenation.
+			submessages[num] = append(submessages[num], m...)
+			return nil
+		})
+	})
+	return submessages, err
+}
+
+// toInt32 converts a contribution bound to int32, which is how contribution
+// bounds are represented in the summary messages.
+func toInt32(name string, x int64) (int32, error) {
+	if x > math.MaxInt32 || x < math.MinInt32 {
+		return 0, fmt.Errorf("%s = %d cannot be represented in a summary, must fit in an int32", name, x)
+	}
+	return int32(x), nil
+}
+
+// int64BoundToFloat64 converts an int64 bound to float64, which is how bounds are
+// represented in the summary messages. It returns an error if the conversion is
+// not exact.
+func int64BoundToFloat64(name string, x int64) (float64, error) {
+	if x > maxExactFloat64Int || x < -maxExactFloat64Int {
+		return 0, fmt.Errorf("%s = %d cannot be represented exactly in a summary, must be within [-2^53, 2^53]", name, x)
+	}
+	return float64(x), nil
+}
+
+// Low-level helpers for the protobuf wire format.
+
+func appendInt64Field(b []byte, num protowire.Number, v int64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDoubleField(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendMessageField(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// consumeFields parses the fields of an encoded message, calling f for every
+// field with the bytes following the field's tag. f returns the number of bytes
+// of the field's value it consumed.
+func consumeFields(b []byte, f func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("couldn't parse summary: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n, err := f(num, typ, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func skipField(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, fmt.Errorf("couldn't parse field %d of summary: %w", num, protowire.ParseError(n))
+	}
+	return n, nil
+}
+
+func consumeInt64(b []byte, typ protowire.Type, v *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("couldn't parse summary: got wire type %d, want varint", typ)
+	}
+	x, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, fmt.Errorf("couldn't parse summary: %w", protowire.ParseError(n))
+	}
+	*v = int64(x)
+	return n, nil
+}
+
+func consumeInt32(b []byte, typ protowire.Type, v *int32) (int, error) {
+	var x int64
+	n, err := consumeInt64(b, typ, &x)
+	*v = int32(x)
+	return n, err
+}
+
+func consumeMechanismType(b []byte, typ protowire.Type, v *mechanismType) (int, error) {
+	var x int32
+	n, err := consumeInt32(b, typ, &x)
+	*v = mechanismType(x)
+	return n, err
+}
+
+func consumeDouble(b []byte, typ protowire.Type, v *float64) (int, error) {
+	if typ != protowire.Fixed64Type {
+		return 0, fmt.Errorf("couldn't parse summary: got wire type %d, want fixed64", typ)
+	}
+	x, n := protowire.ConsumeFixed64(b)
+	if n < 0 {
+		return 0, fmt.Errorf("couldn't parse summary: %w", protowire.ParseError(n))
+	}
+	*v = math.Float64frombits(x)
+	return n, nil
+}
+
+func consumeMessage(b []byte, typ protowire.Type, unmarshal func([]byte) error) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("couldn't parse summary: got wire type %d, want length-delimited", typ)
+	}
+	m, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, fmt.Errorf("couldn't parse summary: %w", protowire.ParseError(n))
+	}
+	return n, unmarshal(m)
+}
+
+func sortedInt32Keys(m map[int32]int64) []int32 {
+	keys := make([]int32, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
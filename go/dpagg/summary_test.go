@@ -0,0 +1,494 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests that Count is serialized into the same bytes as a CountSummary
+// produced by the Java library.
+func TestCountSerializeWireFormat(t *testing.T) {
+	c, err := NewCount(&CountOptions{Epsilon: 1, Noise: noise.Laplace()})
+	if err != nil {
+		t.Fatalf("Couldn't initialize c: %v", err)
+	}
+	c.IncrementBy(3)
+	got, err := c.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	want := []byte{
+		0x08, 0x03, // count = 3
+		0x19, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // epsilon = 1.0
+		0x28, 0x01, // mechanism_type = LAPLACE
+		0x30, 0x01, // max_partitions_contributed = 1
+		0x38, 0x01, // max_contributions_per_partition = 1
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Serialize: got diff (-want +got):\n%s", diff)
+	}
+	if c.state != serialized {
+		t.Errorf("Count should have its state set to Serialized, got %v, want Serialized", c.state)
+	}
+}
+
+func TestCountSerializeDeserialize(t *testing.T) {
+	opts := &CountOptions{Epsilon: ln3, Delta: tenten, MaxPartitionsContributed: 2, Noise: noise.Gaussian()}
+	c1, err := NewCount(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize c1: %v", err)
+	}
+	c1.IncrementBy(7)
+	b, err := c1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	c2, err := NewCount(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize c2: %v", err)
+	}
+	if err := c2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if c2.count != 7 {
+		t.Errorf("Deserialize: got count %d, want 7", c2.count)
+	}
+}
+
+// Tests that Deserialize merges the summary into the count accumulated so far,
+// like Merge, rather than replacing it.
+func TestCountDeserializeMerges(t *testing.T) {
+	opts := &CountOptions{Epsilon: ln3, Noise: noise.Laplace()}
+	c1, err := NewCount(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize c1: %v", err)
+	}
+	c1.IncrementBy(7)
+	b, err := c1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	c2, err := NewCount(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize c2: %v", err)
+	}
+	c2.IncrementBy(2)
+	if err := c2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if c2.count != 9 {
+		t.Errorf("Deserialize: got count %d, want 9", c2.count)
+	}
+}
+
+func TestCountDeserializeIncompatibleParameters(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *CountOptions
+	}{
+		{"different epsilon", &CountOptions{Epsilon: 1, Noise: noise.Laplace()}},
+		{"different noise", &CountOptions{Epsilon: ln3, Delta: tenten, Noise: noise.Gaussian()}},
+		{"different max partitions contributed", &CountOptions{Epsilon: ln3, MaxPartitionsContributed: 2, Noise: noise.Laplace()}},
+	} {
+		src, err := NewCount(&CountOptions{Epsilon: ln3, Noise: noise.Laplace()})
+		if err != nil {
+			t.Fatalf("Couldn't initialize src: %v", err)
+		}
+		b, err := src.Serialize()
+		if err != nil {
+			t.Fatalf("Serialize: got error %v", err)
+		}
+		dst, err := NewCount(tc.opts)
+		if err != nil {
+			t.Fatalf("Couldn't initialize dst: %v", err)
+		}
+		if err := dst.Deserialize(b); err == nil {
+			t.Errorf("Deserialize: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestCountDeserializeInvalidBytes(t *testing.T) {
+	c := getNoiselessCount(t)
+	// Truncated double for the epsilon field.
+	if err := c.Deserialize([]byte{0x19, 0x00}); err == nil {
+		t.Errorf("Deserialize: got no error for invalid bytes, want error")
+	}
+}
+
+// Tests that Serialize() and Deserialize() return errors correctly with
+// different Count aggregation states.
+func TestCountSerializeStateChecks(t *testing.T) {
+	for _, tc := range []struct {
+		state              aggregationState
+		wantSerializeErr   bool
+		wantDeserializeErr bool
+	}{
+		{defaultState, false, false},
+		{merged, true, true},
+		{serialized, false, true},
+		{resultReturned, true, true},
+	} {
+		c := getNoiselessCount(t)
+		b, err := c.Serialize()
+		if err != nil {
+			t.Fatalf("Serialize: got error %v", err)
+		}
+
+		c = getNoiselessCount(t)
+		c.state = tc.state
+		if _, err := c.Serialize(); (err != nil) != tc.wantSerializeErr {
+			t.Errorf("Serialize: when state %v for err got %v, wantErr %t", tc.state, err, tc.wantSerializeErr)
+		}
+		c = getNoiselessCount(t)
+		c.state = tc.state
+		if err := c.Deserialize(b); (err != nil) != tc.wantDeserializeErr {
+			t.Errorf("Deserialize: when state %v for err got %v, wantErr %t", tc.state, err, tc.wantDeserializeErr)
+		}
+	}
+}
+
+func TestBoundedSumInt64SerializeDeserialize(t *testing.T) {
+	opts := &BoundedSumInt64Options{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     3,
+		Lower:                        -5,
+		Upper:                        2,
+		Noise:                        noise.Laplace(),
+		maxContributionsPerPartition: 4,
+	}
+	bs1, err := NewBoundedSumInt64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs1: %v", err)
+	}
+	bs1.Add(-3)
+	bs1.Add(10) // clamped to 2
+	b, err := bs1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bs2, err := NewBoundedSumInt64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs2: %v", err)
+	}
+	if err := bs2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if bs2.sum.Int != -1 {
+		t.Errorf("Deserialize: got sum %d, want -1", bs2.sum.Int)
+	}
+
+	bs3, err := NewBoundedSumInt64(&BoundedSumInt64Options{Epsilon: ln3, MaxPartitionsContributed: 3, Lower: -5, Upper: 3, Noise: noise.Laplace()})
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs3: %v", err)
+	}
+	if err := bs3.Deserialize(b); err == nil {
+		t.Errorf("Deserialize: got no error for different bounds, want error")
+	}
+}
+
+// Tests that Deserialize merges the summary into the sum accumulated so far,
+// like Merge, rather than replacing it.
+func TestBoundedSumFloat64DeserializeMerges(t *testing.T) {
+	opts := &BoundedSumFloat64Options{Epsilon: ln3, Lower: -1, Upper: 1, Noise: noise.Laplace()}
+	bs1, err := NewBoundedSumFloat64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs1: %v", err)
+	}
+	bs1.Add(0.5)
+	b, err := bs1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bs2, err := NewBoundedSumFloat64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs2: %v", err)
+	}
+	bs2.Add(0.25)
+	if err := bs2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if bs2.sum.Float != 0.75 {
+		t.Errorf("Deserialize: got sum %v, want 0.75", bs2.sum.Float)
+	}
+}
+
+// Tests that a BoundedSumInt64 accepts summaries whose partial sum is stored as a
+// float value, as long as it is integral.
+func TestBoundedSumInt64DeserializeFloatValue(t *testing.T) {
+	opts := &BoundedSumInt64Options{Epsilon: ln3, Lower: -1, Upper: 1, Noise: noise.Laplace()}
+	bs, err := NewBoundedSumInt64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs: %v", err)
+	}
+	s, err := bs.summary()
+	if err != nil {
+		t.Fatalf("summary: got error %v", err)
+	}
+	for _, tc := range []struct {
+		partialSum float64
+		want       int64
+		wantErr    bool
+	}{
+		{12, 12, false},
+		{-4, -4, false},
+		{1.5, 0, true},
+	} {
+		s.partialSum = valueType{floatValue: tc.partialSum}
+		bs, err := NewBoundedSumInt64(opts)
+		if err != nil {
+			t.Fatalf("Couldn't initialize bs: %v", err)
+		}
+		err = bs.Deserialize(s.marshal())
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Deserialize: with partial sum %v got err %v, wantErr %t", tc.partialSum, err, tc.wantErr)
+		}
+		if err == nil && bs.sum.Int != tc.want {
+			t.Errorf("Deserialize: with partial sum %v got sum %d, want %d", tc.partialSum, bs.sum.Int, tc.want)
+		}
+	}
+}
+
+func TestBoundedSumFloat64SerializeDeserialize(t *testing.T) {
+	opts := &BoundedSumFloat64Options{
+		Epsilon:                  ln3,
+		Delta:                    tenten,
+		MaxPartitionsContributed: 2,
+		Lower:                    -0.5,
+		Upper:                    1.5,
+		Noise:                    noise.Gaussian(),
+	}
+	bs1, err := NewBoundedSumFloat64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs1: %v", err)
+	}
+	bs1.Add(1.25)
+	bs1.Add(-0.25)
+	b, err := bs1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bs2, err := NewBoundedSumFloat64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bs2: %v", err)
+	}
+	if err := bs2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if bs2.sum.Float != 1 {
+		t.Errorf("Deserialize: got sum %f, want 1", bs2.sum.Float)
+	}
+}
+
+func TestBoundedMeanFloat64SerializeDeserialize(t *testing.T) {
+	opts := &BoundedMeanFloat64Options{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 2,
+		Lower:                        0,
+		Upper:                        4,
+		Noise:                        noNoise{},
+	}
+	bm1, err := NewBoundedMeanFloat64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bm1: %v", err)
+	}
+	for _, e := range []float64{1, 1, 1, 5} {
+		bm1.Add(e)
+	}
+	b, err := bm1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bm2, err := NewBoundedMeanFloat64(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bm2: %v", err)
+	}
+	if err := bm2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	got, err := bm2.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got, 1.75) {
+		t.Errorf("Result: after deserializing got %f, want 1.75", got)
+	}
+	if bm1.state != serialized {
+		t.Errorf("BoundedMeanFloat64 should have its state set to Serialized, got %v, want Serialized", bm1.state)
+	}
+}
+
+func TestBoundedVarianceSerializeDeserialize(t *testing.T) {
+	opts := &BoundedVarianceOptions{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        4,
+		Noise:                        noNoise{},
+	}
+	bv1, err := NewBoundedVariance(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bv1: %v", err)
+	}
+	for _, e := range []float64{1, 3} {
+		bv1.Add(e)
+	}
+	b, err := bv1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bv2, err := NewBoundedVariance(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bv2: %v", err)
+	}
+	if err := bv2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	got, err := bv2.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got, 1) {
+		t.Errorf("Result: after deserializing got %f, want 1", got)
+	}
+}
+
+func TestBoundedStandardDeviationSerializeDeserialize(t *testing.T) {
+	opts := &BoundedStandardDeviationOptions{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     1,
+		MaxContributionsPerPartition: 1,
+		Lower:                        0,
+		Upper:                        4,
+		Noise:                        noNoise{},
+	}
+	bstdv1, err := NewBoundedStandardDeviation(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bstdv1: %v", err)
+	}
+	for _, e := range []float64{0, 4} {
+		bstdv1.Add(e)
+	}
+	b, err := bstdv1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bstdv2, err := NewBoundedStandardDeviation(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bstdv2: %v", err)
+	}
+	if err := bstdv2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	got, err := bstdv2.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if !ApproxEqual(got, 2) {
+		t.Errorf("Result: after deserializing got %f, want 2", got)
+	}
+}
+
+func TestBoundedQuantilesSerializeDeserialize(t *testing.T) {
+	opts := &BoundedQuantilesOptions{
+		Epsilon:                      ln3,
+		MaxPartitionsContributed:     2,
+		MaxContributionsPerPartition: 3,
+		Lower:                        -1,
+		Upper:                        1,
+		Noise:                        noise.Laplace(),
+		TreeHeight:                   3,
+		BranchingFactor:              4,
+	}
+	bq1, err := NewBoundedQuantiles(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bq1: %v", err)
+	}
+	for _, e := range []float64{-0.5, 0, 0.25, 0.75} {
+		bq1.Add(e)
+	}
+	wantTree := make(map[int]int64)
+	for k, v := range bq1.tree {
+		wantTree[k] = v
+	}
+	b, err := bq1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	bq2, err := NewBoundedQuantiles(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bq2: %v", err)
+	}
+	if err := bq2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if diff := cmp.Diff(wantTree, bq2.tree); diff != "" {
+		t.Errorf("Deserialize: got tree diff (-want +got):\n%s", diff)
+	}
+
+	opts.BranchingFactor = 2
+	bq3, err := NewBoundedQuantiles(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize bq3: %v", err)
+	}
+	if err := bq3.Deserialize(b); err == nil {
+		t.Errorf("Deserialize: got no error for different branching factor, want error")
+	}
+}
+
+func TestPreAggSelectPartitionSerializeDeserialize(t *testing.T) {
+	opts := &PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 0.02, MaxPartitionsContributed: 2}
+	s1, err := NewPreAggSelectPartition(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize s1: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s1.Increment()
+	}
+	b, err := s1.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	if s1.state != serialized {
+		t.Errorf("PreAggSelectPartition should have its state set to Serialized, got %v, want Serialized", s1.state)
+	}
+	s2, err := NewPreAggSelectPartition(opts)
+	if err != nil {
+		t.Fatalf("Couldn't initialize s2: %v", err)
+	}
+	s2.Increment()
+	if err := s2.Deserialize(b); err != nil {
+		t.Fatalf("Deserialize: got error %v", err)
+	}
+	if s2.idCount != 4 {
+		t.Errorf("Deserialize: got id count %d, want 4", s2.idCount)
+	}
+
+	s3, err := NewPreAggSelectPartition(&PreAggSelectPartitionOptions{Epsilon: ln3, Delta: 0.02})
+	if err != nil {
+		t.Fatalf("Couldn't initialize s3: %v", err)
+	}
+	if err := s3.Deserialize(b); err == nil {
+		t.Errorf("Deserialize: got no error for different max partitions contributed, want error")
+	}
+}
@@ -0,0 +1,273 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+const (
+	hoursPerDay = 24
+	daysPerWeek = 7
+	// Number of levels of the hierarchy: weeks, days and hours.
+	timeHistogramLevels = 3
+)
+
+// TimeHistogram calculates differentially private counts of events at three
+// time resolutions: per hour, per day and per week, starting at a given time.
+//
+// All counts are released from a single (ε, δ) budget using the hierarchical
+// mechanism of Hay et al.'s "Boosting the Accuracy of Differentially Private
+// Histograms Through Consistency" (https://arxiv.org/abs/0904.0942): the counts
+// of all weeks, days and hours are noised once, and are then post-processed so
+// that they are consistent, i.e. the hourly counts of a day sum up to the daily
+// count and the daily counts of a week sum up to the weekly count. The
+// post-processing is the least squares estimate given all noisy counts, which is
+// more accurate than noising each level independently with a third of the
+// budget and more accurate than summing up noisy hourly counts.
+//
+// Days and weeks are consecutive intervals of 24 and 168 hours from Start, so
+// Start should be aligned to the beginning of a week in the relevant time zone.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type TimeHistogram struct {
+	// Parameters
+	epsilon         float64
+	delta           float64
+	l0Sensitivity   int64
+	lInfSensitivity int64
+	start           time.Time
+	numWeeks        int
+	Noise           noise.Noise
+
+	// State variables
+	hourlyCounts []int64
+	state        aggregationState
+}
+
+// TimeHistogramOptions contains the options necessary to initialize a TimeHistogram.
+type TimeHistogramOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	// How many distinct hours may a single privacy unit contribute to? Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single hour? Defaults to 1.
+	MaxContributionsPerPartition int64
+	Start                        time.Time   // Beginning of the first hour, day and week. Required.
+	NumWeeks                     int         // Number of weeks covered by the histogram. Required.
+	Noise                        noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// TimeHistogramResult contains the consistent differentially private counts
+// released by a TimeHistogram. Index i of each slice corresponds to the i-th
+// hour, day or week since Start.
+type TimeHistogramResult struct {
+	Hourly []float64
+	Daily  []float64
+	Weekly []float64
+}
+
+// NewTimeHistogram returns a new TimeHistogram, whose counts are initialized at 0.
+func NewTimeHistogram(opt *TimeHistogramOptions) (*TimeHistogram, error) {
+	if opt == nil {
+		opt = &TimeHistogramOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+
+	if opt.Start.IsZero() {
+		return nil, fmt.Errorf("NewTimeHistogram requires a non-zero Start")
+	}
+	if opt.NumWeeks <= 0 {
+		return nil, fmt.Errorf("NewTimeHistogram: NumWeeks is %d, must be strictly positive", opt.NumWeeks)
+	}
+	// Check that the parameters are compatible with the noise chosen by calling
+	// the noise on some placeholder value.
+	eps, del := opt.Epsilon, opt.Delta
+	noiseL0, noiseLInf := timeHistogramSensitivities(n, l0, lInf)
+	if _, err := n.AddNoiseFloat64(0, noiseL0, noiseLInf, eps, del); err != nil {
+		return nil, fmt.Errorf("NewTimeHistogram: %w", err)
+	}
+
+	return &TimeHistogram{
+		epsilon:         eps,
+		delta:           del,
+		l0Sensitivity:   l0,
+		lInfSensitivity: lInf,
+		start:           opt.Start,
+		numWeeks:        opt.NumWeeks,
+		Noise:           n,
+		hourlyCounts:    make([]int64, opt.NumWeeks*daysPerWeek*hoursPerDay),
+		state:           defaultState,
+	}, nil
+}
+
+// Add counts an event that happened at time t, which must be within the weeks
+// covered by the histogram.
+func (th *TimeHistogram) Add(t time.Time) error {
+	if th.state != defaultState {
+		return fmt.Errorf("TimeHistogram cannot be amended: %w", th.state.transitionError(defaultState))
+	}
+	if t.Before(th.start) {
+		return fmt.Errorf("TimeHistogram cannot be amended: %v is before the start of the histogram (%v)", t, th.start)
+	}
+	hour := int(t.Sub(th.start) / time.Hour)
+	if hour >= len(th.hourlyCounts) {
+		return fmt.Errorf("TimeHistogram cannot be amended: %v is after the end of the histogram (%v)", t, th.start.Add(time.Duration(len(th.hourlyCounts))*time.Hour))
+	}
+	th.hourlyCounts[hour]++
+	return nil
+}
+
+// Result returns consistent differentially private counts per hour, day and
+// week. The method can be called only once.
+//
+// Note that the returned values are not integers and may be negative.
+func (th *TimeHistogram) Result() (TimeHistogramResult, error) {
+	if th.state != defaultState {
+		return TimeHistogramResult{}, fmt.Errorf("TimeHistogram's noised result cannot be computed: %w", th.state.transitionError(resultReturned))
+	}
+	th.state = resultReturned
+
+	rawDaily := sumGroups(int64sToFloat64s(th.hourlyCounts), hoursPerDay)
+	rawWeekly := sumGroups(rawDaily, daysPerWeek)
+	l0, lInf := timeHistogramSensitivities(th.Noise, th.l0Sensitivity, th.lInfSensitivity)
+	addNoise := func(raw []float64) ([]float64, error) {
+		noised := make([]float64, len(raw))
+		for i, x := range raw {
+			var err error
+			noised[i], err = th.Noise.AddNoiseFloat64(x, l0, lInf, th.epsilon, th.delta)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return noised, nil
+	}
+	hourly, err := addNoise(int64sToFloat64s(th.hourlyCounts))
+	if err != nil {
+		return TimeHistogramResult{}, fmt.Errorf("couldn't compute noised hourly counts: %w", err)
+	}
+	daily, err := addNoise(rawDaily)
+	if err != nil {
+		return TimeHistogramResult{}, fmt.Errorf("couldn't compute noised daily counts: %w", err)
+	}
+	weekly, err := addNoise(rawWeekly)
+	if err != nil {
+		return TimeHistogramResult{}, fmt.Errorf("couldn't compute noised weekly counts: %w", err)
+	}
+
+	// Bottom-up pass: combine the noisy count of each node with the sum of the
+	// estimates of its children, weighting them by their inverse variances. As all
+	// noisy counts have the same variance, variances are expressed in units of
+	// that variance.
+	//
+	// Hourly estimates are the noisy counts themselves, with variance 1.
+	hourVariance := 1.0
+	dayEstimates, dayVariance := combineWithChildren(daily, hourly, hoursPerDay, hourVariance)
+	weekEstimates, _ := combineWithChildren(weekly, dayEstimates, daysPerWeek, dayVariance)
+
+	// Top-down pass: weekly estimates are final; the difference between a
+	// node's final value and the sum of its children's estimates is spread
+	// evenly among the children, which all have the same variance.
+	finalDaily := distributeToChildren(weekEstimates, dayEstimates, daysPerWeek)
+	finalHourly := distributeToChildren(finalDaily, hourly, hoursPerDay)
+	return TimeHistogramResult{
+		Hourly: finalHourly,
+		Daily:  finalDaily,
+		Weekly: weekEstimates,
+	}, nil
+}
+
+// timeHistogramSensitivities returns the sensitivities with which all the
+// counts of a TimeHistogram are noised, so that they have the same variance,
+// as assumed by the consistency post-processing.
+//
+// A privacy unit changes at most l0 hourly counts by at most lInf each. Its
+// hours may all fall in the same day and week, so it also changes a daily and
+// a weekly count by up to l0·lInf. The L1 sensitivity of all counts is thus
+// timeHistogramLevels·l0·lInf, and their L2 sensitivity is
+// √(l0·lInf² + 2·(l0·lInf)²) = √(l0+2·l0²)·lInf. Gaussian noise is calibrated
+// to the latter, and other noise to the former.
+func timeHistogramSensitivities(n noise.Noise, l0, lInf int64) (int64, float64) {
+	if noise.NeedsDelta(noise.ToKind(n)) {
+		l0f := float64(l0)
+		return 1, math.Sqrt(l0f+2*l0f*l0f) * float64(lInf)
+	}
+	return timeHistogramLevels * l0, float64(lInf)
+}
+
+// combineWithChildren returns the inverse-variance weighted combination of
+// each noisy parent count with the sum of the estimates of its children, and
+// the variance of the combined estimates.
+func combineWithChildren(parents, children []float64, branchingFactor int, childVariance float64) ([]float64, float64) {
+	childSums := sumGroups(children, branchingFactor)
+	const parentVariance = 1.0
+	childSumVariance := float64(branchingFactor) * childVariance
+	parentWeight := (1 / parentVariance) / (1/parentVariance + 1/childSumVariance)
+	combined := make([]float64, len(parents))
+	for i := range parents {
+		combined[i] = parentWeight*parents[i] + (1-parentWeight)*childSums[i]
+	}
+	return combined, 1 / (1/parentVariance + 1/childSumVariance)
+}
+
+// distributeToChildren returns children estimates adjusted so that the
+// children of each parent sum up to the parent's value.
+func distributeToChildren(parents, children []float64, branchingFactor int) []float64 {
+	childSums := sumGroups(children, branchingFactor)
+	adjusted := make([]float64, len(children))
+	for i, c := range children {
+		p := i / branchingFactor
+		adjusted[i] = c + (parents[p]-childSums[p])/float64(branchingFactor)
+	}
+	return adjusted
+}
+
+// sumGroups returns the sums of consecutive groups of groupSize values.
+func sumGroups(values []float64, groupSize int) []float64 {
+	sums := make([]float64, len(values)/groupSize)
+	for i, v := range values {
+		sums[i/groupSize] += v
+	}
+	return sums
+}
+
+func int64sToFloat64s(values []int64) []float64 {
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = float64(v)
+	}
+	return res
+}
@@ -0,0 +1,205 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+var timeHistogramStart = time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func TestNewTimeHistogramInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *TimeHistogramOptions
+	}{
+		{"nil options", nil},
+		{"zero start", &TimeHistogramOptions{Epsilon: ln3, NumWeeks: 1}},
+		{"zero weeks", &TimeHistogramOptions{Epsilon: ln3, Start: timeHistogramStart}},
+		{"zero epsilon", &TimeHistogramOptions{Start: timeHistogramStart, NumWeeks: 1}},
+	} {
+		if _, err := NewTimeHistogram(tc.opts); err == nil {
+			t.Errorf("NewTimeHistogram: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestTimeHistogramNoNoise(t *testing.T) {
+	th, err := NewTimeHistogram(&TimeHistogramOptions{
+		Epsilon:  ln3,
+		Start:    timeHistogramStart,
+		NumWeeks: 2,
+		Noise:    noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize time histogram: %v", err)
+	}
+	for _, ts := range []time.Time{
+		timeHistogramStart,
+		timeHistogramStart.Add(30 * time.Minute),
+		timeHistogramStart.Add(25 * time.Hour),
+		timeHistogramStart.Add(8 * 24 * time.Hour),
+	} {
+		if err := th.Add(ts); err != nil {
+			t.Fatalf("Add(%v): got error %v", ts, err)
+		}
+	}
+	got, err := th.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if len(got.Hourly) != 2*7*24 || len(got.Daily) != 14 || len(got.Weekly) != 2 {
+		t.Fatalf("Result: got %d hours, %d days and %d weeks, want 336, 14 and 2", len(got.Hourly), len(got.Daily), len(got.Weekly))
+	}
+	for _, tc := range []struct {
+		desc      string
+		got, want float64
+	}{
+		{"hour 0", got.Hourly[0], 2},
+		{"hour 25", got.Hourly[25], 1},
+		{"hour 1", got.Hourly[1], 0},
+		{"day 0", got.Daily[0], 2},
+		{"day 1", got.Daily[1], 1},
+		{"day 8", got.Daily[8], 1},
+		{"week 0", got.Weekly[0], 3},
+		{"week 1", got.Weekly[1], 1},
+	} {
+		if !ApproxEqual(tc.got, tc.want) {
+			t.Errorf("Result: got %f for %s, want %f", tc.got, tc.desc, tc.want)
+		}
+	}
+}
+
+func TestTimeHistogramIsConsistent(t *testing.T) {
+	th, err := NewTimeHistogram(&TimeHistogramOptions{
+		Epsilon:                  ln3,
+		Delta:                    1e-5,
+		MaxPartitionsContributed: 5,
+		Start:                    timeHistogramStart,
+		NumWeeks:                 3,
+		Noise:                    noise.Gaussian(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize time histogram: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		th.Add(timeHistogramStart.Add(time.Duration(i*37) * time.Minute))
+	}
+	got, err := th.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	for d, daily := range got.Daily {
+		if s := sumGroups(got.Hourly[d*24:(d+1)*24], 24)[0]; math.Abs(s-daily) > 1e-6 {
+			t.Errorf("Result: hourly counts of day %d sum up to %f, want daily count %f", d, s, daily)
+		}
+	}
+	for w, weekly := range got.Weekly {
+		if s := sumGroups(got.Daily[w*7:(w+1)*7], 7)[0]; math.Abs(s-weekly) > 1e-6 {
+			t.Errorf("Result: daily counts of week %d sum up to %f, want weekly count %f", w, s, weekly)
+		}
+	}
+}
+
+// Tests that Gaussian noise is calibrated to the L2 sensitivity of all the
+// counts when a privacy unit contributes to several hours of the same day.
+func TestTimeHistogramGaussianSigma(t *testing.T) {
+	const l0, lInf, delta = 4, 2, 1e-5
+	epsilon := ln3
+	th, err := NewTimeHistogram(&TimeHistogramOptions{
+		Epsilon:                      epsilon,
+		Delta:                        delta,
+		MaxPartitionsContributed:     l0,
+		MaxContributionsPerPartition: lInf,
+		Start:                        timeHistogramStart,
+		NumWeeks:                     1,
+		Noise:                        noise.Gaussian(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize time histogram: %v", err)
+	}
+	noiseL0, noiseLInf := timeHistogramSensitivities(th.Noise, th.l0Sensitivity, th.lInfSensitivity)
+	got := noise.SigmaForGaussian(noiseL0, noiseLInf, epsilon, delta)
+	// The l0 hours of a privacy unit may fall in the same day and week, which
+	// change by l0·lInf: the L2 sensitivity is √(4·2² + 2·(4·2)²) = 12.
+	want := noise.SigmaForGaussian(1, 12, epsilon, delta)
+	if !ApproxEqual(got, want) {
+		t.Errorf("timeHistogramSensitivities: got σ = %f, want %f", got, want)
+	}
+	// With Laplace noise, the L1 sensitivity is 3·l0·lInf.
+	if noiseL0, noiseLInf := timeHistogramSensitivities(noise.Laplace(), l0, lInf); float64(noiseL0)*noiseLInf != 3*l0*lInf {
+		t.Errorf("timeHistogramSensitivities: got L1 sensitivity %f with Laplace noise, want %d", float64(noiseL0)*noiseLInf, 3*l0*lInf)
+	}
+}
+
+// Tests that the consistent weekly counts are more accurate than the sum of
+// the noisy hourly counts.
+func TestTimeHistogramConsistencyImprovesAccuracy(t *testing.T) {
+	const numberOfTrials = 200
+	var squaredError float64
+	for i := 0; i < numberOfTrials; i++ {
+		th, err := NewTimeHistogram(&TimeHistogramOptions{Epsilon: ln3, Start: timeHistogramStart, NumWeeks: 1})
+		if err != nil {
+			t.Fatalf("Couldn't initialize time histogram: %v", err)
+		}
+		got, err := th.Result()
+		if err != nil {
+			t.Fatalf("Result: got error %v", err)
+		}
+		squaredError += got.Weekly[0] * got.Weekly[0]
+	}
+	// Each noisy count has variance 2·(3/ln3)², so that the sum of the 168 noisy
+	// hourly counts has a variance of 168 times that. The consistent weekly
+	// count has a lower variance than the noisy weekly count alone.
+	noiseVariance := 2 * math.Pow(3/ln3, 2)
+	if mse := squaredError / numberOfTrials; mse > 1.5*noiseVariance {
+		t.Errorf("Result: got mean squared error %f for the weekly count, want at most %f", mse, 1.5*noiseVariance)
+	}
+}
+
+func TestTimeHistogramAddOutOfRange(t *testing.T) {
+	th, err := NewTimeHistogram(&TimeHistogramOptions{Epsilon: ln3, Start: timeHistogramStart, NumWeeks: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize time histogram: %v", err)
+	}
+	if err := th.Add(timeHistogramStart.Add(-time.Second)); err == nil {
+		t.Errorf("Add: got no error for a time before Start, want error")
+	}
+	if err := th.Add(timeHistogramStart.Add(7 * 24 * time.Hour)); err == nil {
+		t.Errorf("Add: got no error for a time after the last week, want error")
+	}
+}
+
+func TestTimeHistogramStateChecks(t *testing.T) {
+	th, err := NewTimeHistogram(&TimeHistogramOptions{Epsilon: ln3, Start: timeHistogramStart, NumWeeks: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize time histogram: %v", err)
+	}
+	if _, err := th.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if err := th.Add(timeHistogramStart); err == nil {
+		t.Errorf("Add: got no error after Result, want error")
+	}
+	if _, err := th.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
@@ -0,0 +1,237 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// TokenStatistics releases differentially private frequencies of the tokens
+// or n-grams used by privacy units, e.g. of the words of the messages sent by
+// users, when the vocabulary isn't known in advance.
+//
+// The frequency of a token is the number of privacy units using it. Each
+// privacy unit contributes to at most MaxTokensContributed distinct tokens,
+// chosen uniformly at random among the tokens it uses. The release happens in
+// two steps, each with its own share of the privacy budget:
+//  1. The vocabulary is discovered with a SetUnion over the token sets of the
+//     privacy units.
+//  2. The tokens of the vocabulary are counted with a Count each, and the
+//     tokens whose noisy count is below MinCount are dropped.
+//
+// Since the vocabulary is differentially private, the second step doesn't
+// need to spend any δ on thresholding. With Laplace noise, all of δ is used by
+// the first step. With Gaussian noise, δ is split between the two steps in the
+// same proportions as ε.
+//
+// Not thread-safe.
+type TokenStatistics struct {
+	// Parameters
+	vocabularyOpt        SetUnionOptions
+	countOpt             CountOptions
+	nGramSize            int
+	maxTokensContributed int64
+	minCount             int64
+
+	// State variables
+	// Tokens of each privacy unit, with a reservoir sample of at most
+	// maxTokensContributed tokens.
+	users map[string]*userItems
+	state aggregationState
+}
+
+// TokenStatisticsOptions contains the options necessary to initialize a
+// TokenStatistics.
+type TokenStatisticsOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ, used for vocabulary discovery. Required.
+	// How many distinct tokens may a single privacy unit contribute to?
+	// Required.
+	MaxTokensContributed int64
+	// Number of consecutive tokens of the n-grams whose frequencies are
+	// released, see NGrams. Defaults to 1, i.e. single tokens.
+	NGramSize int
+	// Share of ε (and, with Gaussian noise, δ) used for vocabulary discovery,
+	// the rest being used for counting. Defaults to 0.5; must be in (0, 1).
+	VocabularyFraction float64
+	// Minimum noisy count of the released tokens. Defaults to 1.
+	MinCount int64
+	// Type of noise used. Must be Laplace or Gaussian noise. Defaults to
+	// Laplace noise.
+	Noise noise.Noise
+}
+
+// NewTokenStatistics returns a new TokenStatistics without any token.
+func NewTokenStatistics(opt *TokenStatisticsOptions) (*TokenStatistics, error) {
+	if opt == nil {
+		opt = &TokenStatisticsOptions{}
+	}
+	// Set defaults.
+	n := opt.Noise
+	if n == nil {
+		n = noise.Laplace()
+	}
+	nGramSize := opt.NGramSize
+	if nGramSize == 0 {
+		nGramSize = 1
+	}
+	fraction := opt.VocabularyFraction
+	if fraction == 0 {
+		fraction = 0.5
+	}
+	minCount := opt.MinCount
+	if minCount == 0 {
+		minCount = 1
+	}
+
+	// Check the parameters.
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewTokenStatistics: %w", err)
+	}
+	if nGramSize < 0 {
+		return nil, fmt.Errorf("NewTokenStatistics: NGramSize is %d, must be strictly positive", nGramSize)
+	}
+	if !(fraction > 0 && fraction < 1) {
+		return nil, fmt.Errorf("NewTokenStatistics: VocabularyFraction is %f, must be in (0, 1)", fraction)
+	}
+	vocabularyOpt := SetUnionOptions{
+		Epsilon:             opt.Epsilon * fraction,
+		Delta:               opt.Delta,
+		MaxItemsContributed: opt.MaxTokensContributed,
+		Noise:               n,
+	}
+	countOpt := CountOptions{
+		Epsilon:                  opt.Epsilon * (1 - fraction),
+		MaxPartitionsContributed: opt.MaxTokensContributed,
+		Noise:                    n,
+	}
+	if noise.NeedsDelta(noise.ToKind(n)) {
+		vocabularyOpt.Delta = opt.Delta * fraction
+		countOpt.Delta = opt.Delta * (1 - fraction)
+	}
+	// Check that the parameters of both steps are valid by initializing them.
+	if _, err := NewSetUnion(&vocabularyOpt); err != nil {
+		return nil, fmt.Errorf("NewTokenStatistics: vocabulary: %w", err)
+	}
+	if _, err := NewCount(&countOpt); err != nil {
+		return nil, fmt.Errorf("NewTokenStatistics: counts: %w", err)
+	}
+
+	return &TokenStatistics{
+		vocabularyOpt:        vocabularyOpt,
+		countOpt:             countOpt,
+		nGramSize:            nGramSize,
+		maxTokensContributed: opt.MaxTokensContributed,
+		minCount:             minCount,
+		users:                make(map[string]*userItems),
+		state:                defaultState,
+	}, nil
+}
+
+// NGrams returns the n-grams of the given tokens, i.e. their runs of n
+// consecutive tokens, each joined with a single space. It returns no n-grams
+// if there are fewer than n tokens.
+func NGrams(tokens []string, n int) []string {
+	if n <= 0 || len(tokens) < n {
+		return nil
+	}
+	nGrams := make([]string, 0, len(tokens)-n+1)
+	for i := 0; i+n <= len(tokens); i++ {
+		nGrams = append(nGrams, strings.Join(tokens[i:i+n], " "))
+	}
+	return nGrams
+}
+
+// Add adds the n-grams of the given tokens, e.g. of the words of a message,
+// to the n-grams used by the given privacy unit. A privacy unit using an
+// n-gram several times contributes to its frequency only once.
+func (ts *TokenStatistics) Add(privacyID string, tokens []string) error {
+	if ts.state != defaultState {
+		return fmt.Errorf("TokenStatistics cannot be amended: %w", ts.state.transitionError(defaultState))
+	}
+	u, ok := ts.users[privacyID]
+	if !ok {
+		u = &userItems{seen: make(map[string]bool)}
+		ts.users[privacyID] = u
+	}
+	for _, nGram := range NGrams(tokens, ts.nGramSize) {
+		u.add(nGram, ts.maxTokensContributed)
+	}
+	return nil
+}
+
+// Remove removes all the n-grams of the given privacy unit, e.g. to honor a
+// deletion request that arrives before the result is computed. Removing a
+// privacy unit without n-grams has no effect.
+func (ts *TokenStatistics) Remove(privacyID string) error {
+	if ts.state != defaultState {
+		return fmt.Errorf("TokenStatistics cannot be amended: %w", ts.state.transitionError(defaultState))
+	}
+	delete(ts.users, privacyID)
+	return nil
+}
+
+// Result returns the noisy frequencies of the released n-grams. The method can
+// be called only once.
+func (ts *TokenStatistics) Result() (map[string]int64, error) {
+	if ts.state != defaultState {
+		return nil, fmt.Errorf("TokenStatistics's noised result cannot be computed: %w", ts.state.transitionError(resultReturned))
+	}
+	ts.state = resultReturned
+
+	su, err := NewSetUnion(&ts.vocabularyOpt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize SetUnion for vocabulary discovery: %w", err)
+	}
+	counts := make(map[string]int64)
+	for privacyID, u := range ts.users {
+		for _, nGram := range u.items {
+			if err := su.Add(privacyID, nGram); err != nil {
+				return nil, err
+			}
+			counts[nGram]++
+		}
+	}
+	ts.users = nil
+	vocabulary, err := su.Result()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't discover vocabulary: %w", err)
+	}
+
+	result := make(map[string]int64)
+	for _, nGram := range vocabulary {
+		c, err := NewCount(&ts.countOpt)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize Count for n-gram: %w", err)
+		}
+		if err := c.IncrementBy(counts[nGram]); err != nil {
+			return nil, err
+		}
+		noisedCount, err := c.Result()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compute noised count of n-gram: %w", err)
+		}
+		if noisedCount >= ts.minCount {
+			result[nGram] = noisedCount
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,149 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+func TestNGrams(t *testing.T) {
+	tokens := []string{"the", "quick", "brown", "fox"}
+	for _, tc := range []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{"the", "quick", "brown", "fox"}},
+		{2, []string{"the quick", "quick brown", "brown fox"}},
+		{4, []string{"the quick brown fox"}},
+		{5, nil},
+	} {
+		if got := NGrams(tokens, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("NGrams(%v, %d): got %v, want %v", tokens, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestNewTokenStatisticsInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *TokenStatisticsOptions
+	}{
+		{"nil options", nil},
+		{"no MaxTokensContributed", &TokenStatisticsOptions{Epsilon: ln3, Delta: 1e-5}},
+		{"no Delta", &TokenStatisticsOptions{Epsilon: ln3, MaxTokensContributed: 2}},
+		{"no Epsilon", &TokenStatisticsOptions{Delta: 1e-5, MaxTokensContributed: 2}},
+		{"negative NGramSize", &TokenStatisticsOptions{Epsilon: ln3, Delta: 1e-5, MaxTokensContributed: 2, NGramSize: -1}},
+		{"VocabularyFraction of 1", &TokenStatisticsOptions{Epsilon: ln3, Delta: 1e-5, MaxTokensContributed: 2, VocabularyFraction: 1}},
+		{"unsupported noise", &TokenStatisticsOptions{Epsilon: ln3, Delta: 1e-5, MaxTokensContributed: 2, Noise: noise.DiscreteGaussian()}},
+	} {
+		if _, err := NewTokenStatistics(tc.opt); err == nil {
+			t.Errorf("NewTokenStatistics with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestTokenStatistics(t *testing.T) {
+	for _, n := range []noise.Noise{noise.Laplace(), noise.Gaussian()} {
+		ts, err := NewTokenStatistics(&TokenStatisticsOptions{
+			Epsilon:              100,
+			Delta:                1e-5,
+			MaxTokensContributed: 3,
+			NGramSize:            2,
+			Noise:                n,
+		})
+		if err != nil {
+			t.Fatalf("NewTokenStatistics with %v: got error %v", n, err)
+		}
+		for i := 0; i < 100; i++ {
+			id := fmt.Sprintf("user%d", i)
+			// Using an n-gram several times counts once.
+			ts.Add(id, []string{"hello", "world"})
+			ts.Add(id, []string{"hello", "world"})
+			if i%2 == 0 {
+				ts.Add(id, []string{"good", "morning"})
+			}
+		}
+		ts.Add("lonely", []string{"rare", "bigram"})
+		got, err := ts.Result()
+		if err != nil {
+			t.Fatalf("Result with %v: got error %v", n, err)
+		}
+		want := map[string]int64{"hello world": 100, "good morning": 50}
+		if len(got) != len(want) {
+			t.Errorf("Result with %v: got %v, want n-grams of %v", n, got, want)
+		}
+		for nGram, count := range want {
+			if c, ok := got[nGram]; !ok || c < count-5 || c > count+5 {
+				t.Errorf("Result with %v: got %d for %q, want about %d", n, c, nGram, count)
+			}
+		}
+		if err := ts.Add("user", []string{"late", "bigram"}); err == nil {
+			t.Errorf("Add after Result with %v: got no error, want error", n)
+		}
+		if _, err := ts.Result(); err == nil {
+			t.Errorf("Result called twice with %v: got no error, want error", n)
+		}
+	}
+}
+
+func TestTokenStatisticsCapsTokensPerUser(t *testing.T) {
+	ts, err := NewTokenStatistics(&TokenStatisticsOptions{Epsilon: 100, Delta: 1e-5, MaxTokensContributed: 2})
+	if err != nil {
+		t.Fatalf("NewTokenStatistics: got error %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		ts.Add(fmt.Sprintf("user%d", i), []string{"a", "b", "c", "d"})
+	}
+	got, err := ts.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// Each user contributes to 2 of the 4 tokens, so the counts sum to about
+	// 200.
+	var total int64
+	for _, c := range got {
+		total += c
+	}
+	if total < 180 || total > 220 {
+		t.Errorf("Result: got counts %v summing to %d, want a sum of about 200", got, total)
+	}
+}
+
+func TestTokenStatisticsRemove(t *testing.T) {
+	ts, err := NewTokenStatistics(&TokenStatisticsOptions{Epsilon: 100, Delta: 1e-5, MaxTokensContributed: 1})
+	if err != nil {
+		t.Fatalf("NewTokenStatistics: got error %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		ts.Add(fmt.Sprintf("user%d", i), []string{"a"})
+	}
+	if err := ts.Remove("user0"); err != nil {
+		t.Fatalf("Remove: got error %v", err)
+	}
+	got, err := ts.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	// With such a large ε, the count of "a" is close to the 99 remaining users.
+	if c := got["a"]; c < 95 || c > 103 {
+		t.Errorf("Result: got a count of %d for \"a\", want about 99", c)
+	}
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+)
+
+// TotalConsistencyResult contains per-partition releases reconciled with a
+// noisy grand total by ReconcileTotal.
+type TotalConsistencyResult struct {
+	// Partitions are the reconciled values of the released partitions, in the
+	// order in which they were given.
+	Partitions []float64
+	// Other is the part of the total that is not in the released partitions,
+	// e.g. the contributions of partitions dropped by partition selection. It
+	// is never negative.
+	Other float64
+	// Total is the reconciled total, which is the sum of Partitions and Other.
+	Total float64
+}
+
+// ReconcileTotal makes per-partition releases consistent with a separately
+// released noisy grand total of the same metric, so that downstream reports
+// don't show partitions summing to more than the total. The total is made up of
+// the released partitions and an "other" part, e.g. the partitions dropped by
+// partition selection, which must be non-negative.
+//
+// If the released partitions sum to at most the total, they are kept as is and
+// the difference is the other part. Otherwise, the other part is 0, and the
+// partitions and total are adjusted to the minimum-variance consistent
+// estimates: the excess of the partitions over the total is split between the
+// total and each partition proportionally to the variance of their noise,
+// given by their standard deviations, which can be computed with
+// NoiseStandardDeviation. The partitions are assumed to be noised
+// independently with the same standard deviation.
+//
+// This is post-processing of differentially private releases and doesn't
+// consume privacy budget. Note that reconciled values may be fractional or
+// negative.
+func ReconcileTotal(partitions []float64, partitionStdDev, total, totalStdDev float64) (TotalConsistencyResult, error) {
+	for _, stdDev := range []float64{partitionStdDev, totalStdDev} {
+		if stdDev < 0 || math.IsNaN(stdDev) || math.IsInf(stdDev, 0) {
+			return TotalConsistencyResult{}, fmt.Errorf("ReconcileTotal: standard deviation is %f, must be non-negative and finite", stdDev)
+		}
+	}
+	if math.IsNaN(total) || math.IsInf(total, 0) {
+		return TotalConsistencyResult{}, fmt.Errorf("ReconcileTotal: total is %f, must be finite", total)
+	}
+	var sum float64
+	for _, p := range partitions {
+		if math.IsNaN(p) || math.IsInf(p, 0) {
+			return TotalConsistencyResult{}, fmt.Errorf("ReconcileTotal: partition value is %f, must be finite", p)
+		}
+		sum += p
+	}
+	reconciled := append([]float64(nil), partitions...)
+	excess := sum - total
+	if excess <= 0 {
+		return TotalConsistencyResult{Partitions: reconciled, Other: -excess, Total: total}, nil
+	}
+	// Minimizing Σ_i (p'_i - p_i)²/σ_p² + (t' - t)²/σ_t² subject to Σ_i p'_i = t'
+	// moves each value by its variance times the same Lagrange multiplier.
+	partitionVariance := partitionStdDev * partitionStdDev
+	totalVariance := totalStdDev * totalStdDev
+	sumOfVariances := float64(len(partitions))*partitionVariance + totalVariance
+	if sumOfVariances == 0 {
+		return TotalConsistencyResult{}, fmt.Errorf("ReconcileTotal: partitions sum to %f, more than the total %f, but all values are exact", sum, total)
+	}
+	for i := range reconciled {
+		reconciled[i] -= excess * partitionVariance / sumOfVariances
+	}
+	return TotalConsistencyResult{
+		Partitions: reconciled,
+		Other:      0,
+		Total:      total + excess*totalVariance/sumOfVariances,
+	}, nil
+}
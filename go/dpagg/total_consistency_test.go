@@ -0,0 +1,112 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReconcileTotal(t *testing.T) {
+	for _, tc := range []struct {
+		desc                             string
+		partitions                       []float64
+		partitionStdDev, total, totalStd float64
+		want                             TotalConsistencyResult
+	}{
+		{
+			desc:            "partitions below total",
+			partitions:      []float64{10, 20},
+			partitionStdDev: 1, total: 50, totalStd: 1,
+			want: TotalConsistencyResult{Partitions: []float64{10, 20}, Other: 20, Total: 50},
+		},
+		{
+			desc:            "partitions equal to total",
+			partitions:      []float64{10, 20},
+			partitionStdDev: 1, total: 30, totalStd: 1,
+			want: TotalConsistencyResult{Partitions: []float64{10, 20}, Other: 0, Total: 30},
+		},
+		{
+			// The excess of 6 is split in thirds between the total and both
+			// partitions.
+			desc:            "partitions above total, same noise",
+			partitions:      []float64{10, 20},
+			partitionStdDev: 1, total: 24, totalStd: 1,
+			want: TotalConsistencyResult{Partitions: []float64{8, 18}, Other: 0, Total: 26},
+		},
+		{
+			desc:            "partitions above total, exact total",
+			partitions:      []float64{10, 20},
+			partitionStdDev: 1, total: 24, totalStd: 0,
+			want: TotalConsistencyResult{Partitions: []float64{7, 17}, Other: 0, Total: 24},
+		},
+		{
+			desc:            "partitions above total, exact partitions",
+			partitions:      []float64{10, 20},
+			partitionStdDev: 0, total: 24, totalStd: 2,
+			want: TotalConsistencyResult{Partitions: []float64{10, 20}, Other: 0, Total: 30},
+		},
+		{
+			desc:            "no partitions",
+			partitions:      nil,
+			partitionStdDev: 1, total: 5, totalStd: 1,
+			want: TotalConsistencyResult{Other: 5, Total: 5},
+		},
+		{
+			desc:            "no partitions, negative total",
+			partitions:      nil,
+			partitionStdDev: 1, total: -5, totalStd: 1,
+			want: TotalConsistencyResult{Other: 0, Total: 0},
+		},
+	} {
+		got, err := ReconcileTotal(tc.partitions, tc.partitionStdDev, tc.total, tc.totalStd)
+		if err != nil {
+			t.Fatalf("ReconcileTotal: when %s got err %v", tc.desc, err)
+		}
+		if diff := cmp.Diff(tc.want, got, cmp.Comparer(func(a, b float64) bool { return ApproxEqual(a, b) })); diff != "" {
+			t.Errorf("ReconcileTotal: when %s got diff (-want +got):\n%s", tc.desc, diff)
+		}
+		var sum float64
+		for _, p := range got.Partitions {
+			sum += p
+		}
+		if !ApproxEqual(sum+got.Other, got.Total) {
+			t.Errorf("ReconcileTotal: when %s got partitions summing to %f and other %f, want them to sum to total %f", tc.desc, sum, got.Other, got.Total)
+		}
+	}
+}
+
+func TestReconcileTotalInvalidInputs(t *testing.T) {
+	for _, tc := range []struct {
+		desc                             string
+		partitions                       []float64
+		partitionStdDev, total, totalStd float64
+	}{
+		{"negative partition standard deviation", []float64{1}, -1, 1, 1},
+		{"negative total standard deviation", []float64{1}, 1, 1, -1},
+		{"NaN standard deviation", []float64{1}, math.NaN(), 1, 1},
+		{"NaN total", []float64{1}, 1, math.NaN(), 1},
+		{"infinite partition", []float64{math.Inf(1)}, 1, 1, 1},
+		{"exact values above total", []float64{10}, 0, 5, 0},
+	} {
+		if _, err := ReconcileTotal(tc.partitions, tc.partitionStdDev, tc.total, tc.totalStd); err == nil {
+			t.Errorf("ReconcileTotal: when %s got no error, want error", tc.desc)
+		}
+	}
+}
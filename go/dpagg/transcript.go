@@ -0,0 +1,40 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"time"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/transcript"
+)
+
+// recordTranscript reports a release of the given aggregation, whose noise of
+// kind k was calibrated to the given parameters, to transcript.Recorder.
+func recordTranscript(aggregation string, k noise.Kind, l0Sensitivity int64, lInfSensitivity, epsilon, delta, preNoise, postNoise float64) {
+	transcript.Default().Record(transcript.Entry{
+		Time:            time.Now(),
+		Aggregation:     aggregation,
+		Mechanism:       mechanismName(k),
+		L0Sensitivity:   l0Sensitivity,
+		LInfSensitivity: lInfSensitivity,
+		Epsilon:         epsilon,
+		Delta:           delta,
+		PreNoise:        preNoise,
+		PostNoise:       postNoise,
+	})
+}
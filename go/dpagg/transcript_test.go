@@ -0,0 +1,119 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/transcript"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// recordTranscripts sets a transcript.Recorder keeping the entries in memory
+// for the duration of the test.
+func recordTranscripts(t *testing.T) *[]transcript.Entry {
+	t.Helper()
+	var mu sync.Mutex
+	var entries []transcript.Entry
+	transcript.SetRecorder(transcript.RecorderFunc(func(e transcript.Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		entries = append(entries, e)
+	}))
+	t.Cleanup(func() { transcript.SetRecorder(nil) })
+	return &entries
+}
+
+// ignoreTime ignores the time of transcript entries, which depends on when the
+// test runs.
+var ignoreTime = cmpopts.IgnoreFields(transcript.Entry{}, "Time")
+
+func TestCountTranscript(t *testing.T) {
+	entries := recordTranscripts(t)
+	c, err := NewCount(&CountOptions{Epsilon: ln3, MaxPartitionsContributed: 2, Noise: noise.Laplace()})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	c.IncrementBy(10)
+	interim, err := c.ResultWithBudget(0.5, 0)
+	if err != nil {
+		t.Fatalf("ResultWithBudget: got error %v", err)
+	}
+	c.Increment()
+	got, err := c.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []transcript.Entry{
+		{Aggregation: "Count", Mechanism: "laplace", L0Sensitivity: 2, LInfSensitivity: 1, Epsilon: ln3 / 2, PreNoise: 10, PostNoise: float64(interim)},
+		{Aggregation: "Count", Mechanism: "laplace", L0Sensitivity: 2, LInfSensitivity: 1, Epsilon: ln3 / 2, PreNoise: 11, PostNoise: float64(got)},
+	}
+	if diff := cmp.Diff(want, *entries, ignoreTime, cmpopts.EquateApprox(0, 1e-12)); diff != "" {
+		t.Errorf("Transcript: got diff (-want +got):\n%s", diff)
+	}
+	for _, e := range *entries {
+		if e.Time.IsZero() {
+			t.Errorf("Transcript: got entry %+v without time", e)
+		}
+	}
+}
+
+func TestBoundedSumTranscript(t *testing.T) {
+	entries := recordTranscripts(t)
+	bs, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{Epsilon: ln3, Delta: tenten, Lower: -1, Upper: 2.5, Noise: noise.Gaussian()})
+	if err != nil {
+		t.Fatalf("Couldn't initialize BoundedSumFloat64: %v", err)
+	}
+	bs.Add(1.5)
+	// Clamped to 2.5.
+	bs.Add(4)
+	got, err := bs.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []transcript.Entry{
+		{Aggregation: "BoundedSumFloat64", Mechanism: "gaussian", L0Sensitivity: 1, LInfSensitivity: 2.5, Epsilon: ln3, Delta: tenten, PreNoise: 4, PostNoise: got},
+	}
+	if diff := cmp.Diff(want, *entries, ignoreTime); diff != "" {
+		t.Errorf("Transcript: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// Checks that the transcript of a release records the noised value returned by
+// the mechanism, before clamping with MaxPrivacyUnits.
+func TestTranscriptBeforePopulationCap(t *testing.T) {
+	entries := recordTranscripts(t)
+	// NewCount draws noise once to check the parameters.
+	c, err := NewCount(&CountOptions{Epsilon: ln3, MaxPrivacyUnits: 1, Noise: offsetNoise{offsets: &[]int64{5, 5}}})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	c.Increment()
+	got, err := c.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 1 {
+		t.Errorf("Result: got %d, want the population cap 1", got)
+	}
+	if len(*entries) != 1 || (*entries)[0].PreNoise != 1 || (*entries)[0].PostNoise != 6 {
+		t.Errorf("Transcript: got %+v, want a single entry with PreNoise 1 and PostNoise 6", *entries)
+	}
+}
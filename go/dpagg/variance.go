@@ -49,8 +49,9 @@ import (
 // Not thread-safe.
 type BoundedVariance struct {
 	// Parameters
-	lower float64
-	upper float64
+	lower   float64
+	upper   float64
+	clamper Clamper
 
 	// State variables
 	NormalizedSumOfSquares BoundedSumFloat64
@@ -63,13 +64,27 @@ type BoundedVariance struct {
 }
 
 func bvEquallyInitialized(bv1, bv2 *BoundedVariance) bool {
-	return bv1.lower == bv2.lower &&
-		bv1.upper == bv2.upper &&
-		bv1.midPoint == bv2.midPoint &&
-		bv1.state == bv2.state &&
-		countEquallyInitialized(&bv1.Count, &bv2.Count) &&
-		bsEquallyInitializedFloat64(&bv1.NormalizedSum, &bv2.NormalizedSum) &&
-		bsEquallyInitializedFloat64(&bv1.NormalizedSumOfSquares, &bv2.NormalizedSumOfSquares)
+	return bvIncompatibleField(bv1, bv2) == ""
+}
+
+// bvIncompatibleField returns the name of the first option with which bv1 and
+// bv2 were initialized differently, or "" if they were initialized equally.
+func bvIncompatibleField(bv1, bv2 *BoundedVariance) string {
+	switch {
+	case bv1.lower != bv2.lower:
+		return "Lower"
+	case bv1.upper != bv2.upper:
+		return "Upper"
+	case bv1.state != bv2.state:
+		return "state"
+	}
+	if field := countIncompatibleField(&bv1.Count, &bv2.Count); field != "" {
+		return field
+	}
+	if field := bsIncompatibleField(&bv1.NormalizedSum, &bv2.NormalizedSum); field != "" {
+		return field
+	}
+	return bsIncompatibleField(&bv1.NormalizedSumOfSquares, &bv2.NormalizedSumOfSquares)
 }
 
 // BoundedVarianceOptions contains the options necessary to initialize a BoundedVariance.
@@ -80,7 +95,16 @@ type BoundedVarianceOptions struct {
 	MaxContributionsPerPartition int64   // How many times may a single user contribute to a single partition? Required.
 	// Lower and Upper bounds for clamping. Default to 0; must be such that Lower < Upper.
 	Lower, Upper float64
-	Noise        noise.Noise // Type of noise used in BoundedVariance. Defaults to Laplace noise.
+	Noise        noise.Noise // Type of noise used in BoundedVariance. Defaults to Laplace noise, or Gaussian noise if Rho is set.
+	// Privacy parameter ρ of zero-concentrated differential privacy, which can be
+	// set instead of Epsilon and Delta with Gaussian noise. Defaults to 0.
+	Rho float64
+	// Transform used to bound contributions to [Lower, Upper]. Defaults to hard
+	// clamping; see Clamper.
+	Clamper Clamper
+	// What is protected by differential privacy, see PrivacyLevel. Defaults to
+	// UserLevel.
+	PrivacyLevel PrivacyLevel
 }
 
 // NewBoundedVariance returns a new BoundedVariance.
@@ -89,25 +113,24 @@ func NewBoundedVariance(opt *BoundedVarianceOptions) (*BoundedVariance, error) {
 		opt = &BoundedVarianceOptions{}
 	}
 
-	maxContributionsPerPartition := opt.MaxContributionsPerPartition
+	maxPartitionsContributed, maxContributionsPerPartition, err := opt.PrivacyLevel.contributionBounds(opt.MaxPartitionsContributed, opt.MaxContributionsPerPartition)
+	if err != nil {
+		return nil, fmt.Errorf("NewBoundedVariance: %w", err)
+	}
 	if err := checks.CheckMaxContributionsPerPartition(maxContributionsPerPartition); err != nil {
 		return nil, fmt.Errorf("NewBoundedVariance: %w", err)
 	}
 
 	// Set defaults.
-	maxPartitionsContributed := opt.MaxPartitionsContributed
 	if maxPartitionsContributed == 0 {
 		maxPartitionsContributed = 1
 	}
 
-	n := opt.Noise
-	if n == nil {
-		n = noise.Laplace()
-	}
+	n := noiseOrDefault(opt.Noise, opt.Rho)
 	// Check bounds & use them to compute L_∞ sensitivity.
 	lower, upper := opt.Lower, opt.Upper
-	if lower == 0 && upper == 0 {
-		return nil, fmt.Errorf("NewBoundedVariance requires a non-default value for Lower and  Upper (automatic bounds determination is not implemented yet). Lower and Upper cannot be both 0")
+	if err := checks.CheckBoundsNotDefault(lower, upper); err != nil {
+		return nil, fmt.Errorf("NewBoundedVariance: %w", err)
 	}
 	if err := checks.CheckBoundsFloat64(lower, upper); err != nil {
 		return nil, fmt.Errorf("NewBoundedVariance: CheckBoundsFloat64: %w", err)
@@ -129,6 +152,9 @@ func NewBoundedVariance(opt *BoundedVarianceOptions) (*BoundedVariance, error) {
 	sumDelta := del / 3
 	sumOfSquaresEpsilon := eps - countEpsilon - sumEpsilon
 	sumOfSquaresDelta := del - countDelta - sumDelta
+	countRho := opt.Rho / 3
+	sumRho := opt.Rho / 3
+	sumOfSquaresRho := opt.Rho - countRho - sumRho
 
 	// Check that the parameters are compatible with the noise chosen by calling
 	// the noise on some placeholder value.
@@ -153,6 +179,7 @@ func NewBoundedVariance(opt *BoundedVarianceOptions) (*BoundedVariance, error) {
 	count, err := NewCount(&CountOptions{
 		Epsilon:                      countEpsilon,
 		Delta:                        countDelta,
+		Rho:                          countRho,
 		MaxPartitionsContributed:     maxPartitionsContributed,
 		Noise:                        n,
 		maxContributionsPerPartition: maxContributionsPerPartition,
@@ -164,6 +191,7 @@ func NewBoundedVariance(opt *BoundedVarianceOptions) (*BoundedVariance, error) {
 	normalizedSum, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
 		Epsilon:                      sumEpsilon,
 		Delta:                        sumDelta,
+		Rho:                          sumRho,
 		MaxPartitionsContributed:     maxPartitionsContributed,
 		Lower:                        -sumMaxDistFromMidpoint,
 		Upper:                        sumMaxDistFromMidpoint,
@@ -177,6 +205,7 @@ func NewBoundedVariance(opt *BoundedVarianceOptions) (*BoundedVariance, error) {
 	normalizedSumOfSquares, err := NewBoundedSumFloat64(&BoundedSumFloat64Options{
 		Epsilon:                  sumOfSquaresEpsilon,
 		Delta:                    sumOfSquaresDelta,
+		Rho:                      sumOfSquaresRho,
 		MaxPartitionsContributed: maxPartitionsContributed,
 		// TODO: Do a second round of normalization for halving the lInf by two.
 		Lower:                        0,
@@ -191,6 +220,7 @@ func NewBoundedVariance(opt *BoundedVarianceOptions) (*BoundedVariance, error) {
 	return &BoundedVariance{
 		lower:                  lower,
 		upper:                  upper,
+		clamper:                opt.Clamper,
 		midPoint:               midPoint,
 		Count:                  *count,
 		NormalizedSum:          *normalizedSum,
@@ -211,10 +241,10 @@ func computeMaxVariance(lower, upper float64) float64 {
 // property required for differential privacy.
 func (bv *BoundedVariance) Add(e float64) error {
 	if bv.state != defaultState {
-		return fmt.Errorf("BoundedVariance cannot be amended: %v", bv.state.errorMessage())
+		return fmt.Errorf("BoundedVariance cannot be amended: %w", bv.state.transitionError(defaultState))
 	}
 	if !math.IsNaN(e) {
-		clamped, err := ClampFloat64(e, bv.lower, bv.upper)
+		clamped, err := clampWith(bv.clamper, e, bv.lower, bv.upper)
 		if err != nil {
 			return fmt.Errorf("couldn't clamp input value %v, err %w", e, err)
 		}
@@ -234,7 +264,7 @@ func (bv *BoundedVariance) Add(e float64) error {
 // Note that the returned value is not an unbiased estimate of the raw bounded variance.
 func (bv *BoundedVariance) Result() (float64, error) {
 	if bv.state != defaultState {
-		return 0, fmt.Errorf("BoundedVariance's noised result cannot be computed: " + bv.state.errorMessage())
+		return 0, fmt.Errorf("BoundedVariance's noised result cannot be computed: %w", bv.state.transitionError(resultReturned))
 	}
 	bv.state = resultReturned
 
@@ -262,6 +292,16 @@ func (bv *BoundedVariance) Result() (float64, error) {
 	return clamped, nil
 }
 
+// Reset returns bv to the state it had when it was initialized, discarding all
+// entries and any result. Like Count.Reset, it starts a new expenditure of the
+// privacy budget of bv.
+func (bv *BoundedVariance) Reset() {
+	bv.NormalizedSumOfSquares.Reset()
+	bv.NormalizedSum.Reset()
+	bv.Count.Reset()
+	bv.state = defaultState
+}
+
 // Merge merges bv2 into bv (i.e., adds to bv all entries that were added to
 // bv2). bv2 is consumed by this operation: bv2 may not be used after it is
 // merged into bv.
@@ -278,14 +318,14 @@ func (bv *BoundedVariance) Merge(bv2 *BoundedVariance) error {
 
 func checkMergeBoundedVariance(bv1, bv2 *BoundedVariance) error {
 	if bv1.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedVariance: bv1 cannot be merged with another BoundedVariance instance: %v", bv1.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedVariance: bv1 cannot be merged with another BoundedVariance instance: %w", bv1.state.transitionError(merged))
 	}
 	if bv2.state != defaultState {
-		return fmt.Errorf("checkMergeBoundedVariance: bv2 cannot be merged with another BoundedVariance instance: %v", bv2.state.errorMessage())
+		return fmt.Errorf("checkMergeBoundedVariance: bv2 cannot be merged with another BoundedVariance instance: %w", bv2.state.transitionError(merged))
 	}
 
-	if !bvEquallyInitialized(bv1, bv2) {
-		return fmt.Errorf("checkMergeBoundedVariance: bv1 and bv2 are not compatible")
+	if field := bvIncompatibleField(bv1, bv2); field != "" {
+		return fmt.Errorf("checkMergeBoundedVariance: bv1 and bv2 are not compatible: %w", &IncompatibleMergeError{Field: field})
 	}
 
 	return nil
@@ -294,7 +334,7 @@ func checkMergeBoundedVariance(bv1, bv2 *BoundedVariance) error {
 // GobEncode encodes BoundedVariance.
 func (bv *BoundedVariance) GobEncode() ([]byte, error) {
 	if bv.state != defaultState && bv.state != serialized {
-		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: " + bv.state.errorMessage())
+		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: %w", bv.state.transitionError(serialized))
 	}
 	enc := encodableBoundedVariance{
 		Lower:                           bv.lower,
@@ -327,6 +367,121 @@ func (bv *BoundedVariance) GobDecode(data []byte) error {
 	return nil
 }
 
+type jsonBoundedVarianceParameters struct {
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+	MidPoint float64 `json:"midpoint"`
+}
+
+type jsonBoundedVarianceState struct {
+	Count                  *Count             `json:"count"`
+	NormalizedSum          *BoundedSumFloat64 `json:"normalized_sum"`
+	NormalizedSumOfSquares *BoundedSumFloat64 `json:"normalized_sum_of_squares"`
+}
+
+// MarshalJSON returns the JSON summary of bv, see json_summary.go, whose state
+// contains the JSON summaries of its count, normalized sum and normalized sum
+// of squares. Like GobEncode, it consumes bv: it may not be amended, merged or
+// queried afterwards.
+func (bv *BoundedVariance) MarshalJSON() ([]byte, error) {
+	if bv.state != defaultState && bv.state != serialized {
+		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: %w", bv.state.transitionError(serialized))
+	}
+	params := jsonBoundedVarianceParameters{Lower: bv.lower, Upper: bv.upper, MidPoint: bv.midPoint}
+	state := jsonBoundedVarianceState{
+		Count:                  &bv.Count,
+		NormalizedSum:          &bv.NormalizedSum,
+		NormalizedSumOfSquares: &bv.NormalizedSumOfSquares,
+	}
+	bv.state = serialized
+	return marshalJSONSummary("BoundedVariance", params, state)
+}
+
+// UnmarshalJSON loads the JSON summary of a BoundedVariance into bv.
+func (bv *BoundedVariance) UnmarshalJSON(data []byte) error {
+	var params jsonBoundedVarianceParameters
+	var state jsonBoundedVarianceState
+	if err := unmarshalJSONSummary(data, "BoundedVariance", &params, &state); err != nil {
+		return fmt.Errorf("couldn't decode BoundedVariance from JSON: %w", err)
+	}
+	if state.Count == nil || state.NormalizedSum == nil || state.NormalizedSumOfSquares == nil {
+		return fmt.Errorf("couldn't decode BoundedVariance from JSON: state must contain a count, a normalized sum and a normalized sum of squares")
+	}
+	*bv = BoundedVariance{
+		lower:                  params.Lower,
+		upper:                  params.Upper,
+		Count:                  *state.Count,
+		NormalizedSum:          *state.NormalizedSum,
+		NormalizedSumOfSquares: *state.NormalizedSumOfSquares,
+		midPoint:               params.MidPoint,
+		state:                  defaultState,
+	}
+	return nil
+}
+
+// Serialize returns the partial aggregate of bv as a serialized
+// BoundedVarianceSummary protobuf message (see proto/summary.proto), in the
+// format used by the Java library: the normalized sum of squares, the
+// normalized sum and the count are stored in the sum_of_squares_summary,
+// sum_summary and count_summary fields. The summary can be loaded into a
+// BoundedVariance with Deserialize.
+//
+// Like GobEncode, Serialize consumes bv: it may not be amended, merged or
+// queried afterwards.
+func (bv *BoundedVariance) Serialize() ([]byte, error) {
+	if bv.state != defaultState && bv.state != serialized {
+		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: %w", bv.state.transitionError(serialized))
+	}
+	sumOfSquares, err := bv.NormalizedSumOfSquares.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: %w", err)
+	}
+	sum, err := bv.NormalizedSum.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: %w", err)
+	}
+	count, err := bv.Count.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("BoundedVariance object cannot be serialized: %w", err)
+	}
+	bv.state = serialized
+	var b []byte
+	b = appendMessageField(b, boundedVarianceSummarySumOfSquaresSummaryField, sumOfSquares)
+	b = appendMessageField(b, boundedVarianceSummarySumSummaryField, sum)
+	b = appendMessageField(b, boundedVarianceSummaryCountSummaryField, count)
+	return b, nil
+}
+
+// Deserialize merges a serialized BoundedVarianceSummary protobuf message into
+// bv, adding its partial sums and count to the ones accumulated so far, like
+// Merge. The summary may have been produced by Serialize or by the Java library.
+//
+// bv must have been initialized with the same parameters as the aggregation
+// that produced the summary, and may not have been merged, serialized or
+// queried.
+func (bv *BoundedVariance) Deserialize(data []byte) error {
+	if bv.state != defaultState {
+		return fmt.Errorf("BoundedVariance object cannot be deserialized: %w", bv.state.transitionError(defaultState))
+	}
+	fields, err := consumeSubmessages(data,
+		boundedVarianceSummarySumOfSquaresSummaryField,
+		boundedVarianceSummarySumSummaryField,
+		boundedVarianceSummaryCountSummaryField)
+	if err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedVariance: %w", err)
+	}
+	if err := bv.NormalizedSumOfSquares.Deserialize(fields[boundedVarianceSummarySumOfSquaresSummaryField]); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedVariance: %w", err)
+	}
+	if err := bv.NormalizedSum.Deserialize(fields[boundedVarianceSummarySumSummaryField]); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedVariance: %w", err)
+	}
+	if err := bv.Count.Deserialize(fields[boundedVarianceSummaryCountSummaryField]); err != nil {
+		return fmt.Errorf("couldn't deserialize BoundedVariance: %w", err)
+	}
+	return nil
+}
+
 // encodableBoundedVariance can be encoded by the gob package.
 type encodableBoundedVariance struct {
 	Lower                           float64
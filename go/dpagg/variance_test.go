@@ -65,7 +65,6 @@ func TestNewBoundedVariance(t *testing.T) {
 					upper:           3,
 					Noise:           noNoise{},
 					noiseKind:       noise.Unrecognised,
-					sum:             0,
 					state:           defaultState,
 				},
 				NormalizedSumOfSquares: BoundedSumFloat64{
@@ -77,7 +76,6 @@ func TestNewBoundedVariance(t *testing.T) {
 					upper:           9,
 					Noise:           noNoise{},
 					noiseKind:       noise.Unrecognised,
-					sum:             0,
 					state:           defaultState,
 				},
 			}},
@@ -114,7 +112,6 @@ func TestNewBoundedVariance(t *testing.T) {
 					upper:           3,
 					noiseKind:       noise.LaplaceNoise,
 					Noise:           noise.Laplace(),
-					sum:             0,
 					state:           defaultState,
 				},
 				NormalizedSumOfSquares: BoundedSumFloat64{
@@ -126,7 +123,6 @@ func TestNewBoundedVariance(t *testing.T) {
 					upper:           9,
 					noiseKind:       noise.LaplaceNoise,
 					Noise:           noise.Laplace(),
-					sum:             0,
 					state:           defaultState,
 				},
 			}},
@@ -833,3 +829,50 @@ func TestBoundedVarianceSerializationStateChecks(t *testing.T) {
 		}
 	}
 }
+
+func TestBVReset(t *testing.T) {
+	bv := getNoiselessBV(t, 0, 10)
+	bv.Add(1)
+	bv.Add(9)
+	if _, err := bv.Result(); err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	bv.Reset()
+	bv.Add(2)
+	bv.Add(4)
+	got, err := bv.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result after Reset: %v", err)
+	}
+	if !ApproxEqual(got, 1) {
+		t.Errorf("Result after Reset: got %f, want 1", got)
+	}
+}
+
+// Tests that a BoundedVariance decoded on another worker can be merged with
+// local variances.
+func TestBVSerializeShipMerge(t *testing.T) {
+	shipped := getNoiselessBV(t, 0, 10)
+	shipped.Add(2)
+	// Encoding again, e.g. when retrying to send the aggregation, is allowed.
+	if _, err := encode(shipped); err != nil {
+		t.Fatalf("encode(BoundedVariance) error: %v", err)
+	}
+	bytes, err := encode(shipped)
+	if err != nil {
+		t.Fatalf("encode(BoundedVariance) error: %v", err)
+	}
+	received := new(BoundedVariance)
+	if err := decode(received, bytes); err != nil {
+		t.Fatalf("decode(BoundedVariance) error: %v", err)
+	}
+	local := getNoiselessBV(t, 0, 10)
+	local.Add(4)
+	if err := received.Merge(local); err != nil {
+		t.Fatalf("Merge of a decoded BoundedVariance: got error %v", err)
+	}
+	// The normalized sums are relative to the midpoint 5 of [0, 10].
+	if v := received; v.Count.count != 2 || !ApproxEqual(v.NormalizedSum.sum.Float, -4) || !ApproxEqual(v.NormalizedSumOfSquares.sum.Float, 10) {
+		t.Errorf("count and normalized sums after merging a decoded BoundedVariance: got (%d, %f, %f), want (2, -4, 10)", v.Count.count, v.NormalizedSum.sum.Float, v.NormalizedSumOfSquares.sum.Float)
+	}
+}
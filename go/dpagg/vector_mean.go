@@ -0,0 +1,255 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// VectorMean calculates a differentially private mean of a collection of
+// vectors, e.g. the centroid of the embeddings of a segment of users, using
+// Gaussian noise.
+//
+// Each vector is clipped to an L_2 norm of at most MaxNorm, i.e. scaled down
+// if its norm is larger. The mean is computed as the noisy sum of the clipped
+// vectors, noised once with noise.AddNoiseFloat64Vector under its L_2
+// sensitivity, divided by a single noisy count of the vectors shared by all
+// coordinates. The privacy budget is split between the sum and the count
+// according to CountFraction.
+//
+// To compute a mean vector per key, use VectorMean as the aggregation of a
+// KeyedAggregation.
+//
+// For general details and key definitions, see
+// https://github.com/google/differential-privacy/blob/main/differential_privacy.md#key-definitions.
+//
+// Not thread-safe.
+type VectorMean struct {
+	// Parameters
+	sumEpsilon                   float64
+	sumDelta                     float64
+	dimension                    int
+	maxNorm                      float64
+	maxPartitionsContributed     int64
+	maxContributionsPerPartition int64
+
+	// State variables
+	sum   []float64
+	count *Count
+	state aggregationState
+}
+
+// VectorMeanOptions contains the options necessary to initialize a VectorMean.
+type VectorMeanOptions struct {
+	Epsilon float64 // Privacy parameter ε. Required.
+	Delta   float64 // Privacy parameter δ. Required.
+	// Number of coordinates of the vectors. Required.
+	Dimension int
+	// Maximum L_2 norm of a single vector. Vectors with a larger norm are scaled
+	// down to this norm. Required.
+	MaxNorm float64
+	// How many distinct partitions may a single privacy unit contribute to?
+	// Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many times may a single privacy unit contribute to a single partition?
+	// Defaults to 1.
+	MaxContributionsPerPartition int64
+	// Share of ε and δ used for the count, the rest being used for the sum.
+	// Defaults to 0.5; must be in (0, 1).
+	CountFraction float64
+}
+
+// NewVectorMean returns a new VectorMean.
+func NewVectorMean(opt *VectorMeanOptions) (*VectorMean, error) {
+	if opt == nil {
+		opt = &VectorMeanOptions{}
+	}
+	// Set defaults.
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	fraction := opt.CountFraction
+	if fraction == 0 {
+		fraction = 0.5
+	}
+
+	// Check the parameters.
+	if opt.Dimension <= 0 {
+		return nil, fmt.Errorf("NewVectorMean: Dimension is %d, must be strictly positive", opt.Dimension)
+	}
+	if err := checks.CheckL2Sensitivity(opt.MaxNorm); err != nil {
+		return nil, fmt.Errorf("NewVectorMean: MaxNorm: %w", err)
+	}
+	if err := checks.CheckMaxContributionsPerPartition(lInf); err != nil {
+		return nil, fmt.Errorf("NewVectorMean: %w", err)
+	}
+	if !(fraction > 0 && fraction < 1) {
+		return nil, fmt.Errorf("NewVectorMean: CountFraction is %f, must be in (0, 1)", fraction)
+	}
+	sumEpsilon, sumDelta := opt.Epsilon*(1-fraction), opt.Delta*(1-fraction)
+	// Check that the parameters are compatible with the noise of the sum by
+	// calling it on some placeholder value.
+	if _, err := noise.AddNoiseFloat64Vector(make([]float64, 1), l0, float64(lInf)*opt.MaxNorm, sumEpsilon, sumDelta); err != nil {
+		return nil, fmt.Errorf("NewVectorMean: %w", err)
+	}
+	count, err := NewCount(&CountOptions{
+		Epsilon:                      opt.Epsilon * fraction,
+		Delta:                        opt.Delta * fraction,
+		MaxPartitionsContributed:     l0,
+		Noise:                        noise.Gaussian(),
+		maxContributionsPerPartition: lInf,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NewVectorMean: couldn't initialize count: %w", err)
+	}
+
+	return &VectorMean{
+		sumEpsilon:                   sumEpsilon,
+		sumDelta:                     sumDelta,
+		dimension:                    opt.Dimension,
+		maxNorm:                      opt.MaxNorm,
+		maxPartitionsContributed:     l0,
+		maxContributionsPerPartition: lInf,
+		sum:                          make([]float64, opt.Dimension),
+		count:                        count,
+		state:                        defaultState,
+	}, nil
+}
+
+// Add adds the given vector, clipped to an L_2 norm of MaxNorm, to the
+// VectorMean. Vectors with NaN or infinite coordinates are ignored.
+func (vm *VectorMean) Add(v []float64) error {
+	return addVector(vm, v)
+}
+
+// AddFloat32 adds the given float32 vector, e.g. an embedding or a gradient
+// from an ML pipeline, like Add. Each coordinate is converted to float64,
+// which is exact since every float32 is a float64, and clipping and summation
+// happen in float64 on the fly, without allocating a converted copy of v. Thus,
+// adding a vector with AddFloat32 is the same as adding its conversion to a
+// []float64 with Add. Note that the sum isn't subject to float32 rounding, so
+// it may differ slightly from a sum computed in float32.
+func (vm *VectorMean) AddFloat32(v []float32) error {
+	return addVector(vm, v)
+}
+
+func addVector[T float32 | float64](vm *VectorMean, v []T) error {
+	if vm.state != defaultState {
+		return fmt.Errorf("VectorMean cannot be amended: %w", vm.state.transitionError(defaultState))
+	}
+	if len(v) != vm.dimension {
+		return fmt.Errorf("VectorMean: vector has %d coordinates, want %d", len(v), vm.dimension)
+	}
+	var norm float64
+	for _, x := range v {
+		x := float64(x)
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil
+		}
+		norm = math.Hypot(norm, x)
+	}
+	scale := 1.0
+	if norm > vm.maxNorm {
+		scale = vm.maxNorm / norm
+	}
+	for i, x := range v {
+		vm.sum[i] += float64(x) * scale
+	}
+	return vm.count.Increment()
+}
+
+// Merge merges vm2 into vm, i.e. adds to vm all vectors that were added to
+// vm2. The two VectorMeans must have been initialized with the same
+// parameters.
+//
+// vm2 is consumed by this operation: it may not be used after it is merged
+// into vm.
+func (vm *VectorMean) Merge(vm2 *VectorMean) error {
+	if err := checkMergeVectorMean(vm, vm2); err != nil {
+		return err
+	}
+	if err := vm.count.Merge(vm2.count); err != nil {
+		return err
+	}
+	for i, x := range vm2.sum {
+		vm.sum[i] += x
+	}
+	vm2.state = merged
+	return nil
+}
+
+func checkMergeVectorMean(vm1, vm2 *VectorMean) error {
+	if vm1.state != defaultState {
+		return fmt.Errorf("checkMergeVectorMean: vm1 cannot be merged with another VectorMean instance: %w", vm1.state.transitionError(merged))
+	}
+	if vm2.state != defaultState {
+		return fmt.Errorf("checkMergeVectorMean: vm2 cannot be merged with another VectorMean instance: %w", vm2.state.transitionError(merged))
+	}
+
+	if vm1.sumEpsilon != vm2.sumEpsilon ||
+		vm1.sumDelta != vm2.sumDelta ||
+		vm1.dimension != vm2.dimension ||
+		vm1.maxNorm != vm2.maxNorm ||
+		vm1.maxPartitionsContributed != vm2.maxPartitionsContributed ||
+		vm1.maxContributionsPerPartition != vm2.maxContributionsPerPartition {
+		return fmt.Errorf("checkMergeVectorMean: vm1 and vm2 are not compatible: %w", &IncompatibleMergeError{})
+	}
+
+	return checkMergeCount(vm1.count, vm2.count)
+}
+
+// Result returns a differentially private estimate of the mean of the added
+// vectors. Since the norm of the mean of the clipped vectors is at most
+// MaxNorm, the estimate is scaled down to this norm if needed. The method can
+// be called only once.
+func (vm *VectorMean) Result() ([]float64, error) {
+	if vm.state != defaultState {
+		return nil, fmt.Errorf("VectorMean's noised result cannot be computed: %w", vm.state.transitionError(resultReturned))
+	}
+	vm.state = resultReturned
+
+	noisedSum, err := noise.AddNoiseFloat64Vector(vm.sum, vm.maxPartitionsContributed, float64(vm.maxContributionsPerPartition)*vm.maxNorm, vm.sumEpsilon, vm.sumDelta)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't compute noised sum of vectors: %w", err)
+	}
+	noisedCount, err := vm.count.Result()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't compute noised count of vectors: %w", err)
+	}
+	// A noisy count below 1 would blow up the mean.
+	count := math.Max(1, float64(noisedCount))
+	var norm float64
+	for i := range noisedSum {
+		noisedSum[i] /= count
+		norm = math.Hypot(norm, noisedSum[i])
+	}
+	if norm > vm.maxNorm {
+		for i := range noisedSum {
+			noisedSum[i] *= vm.maxNorm / norm
+		}
+	}
+	return noisedSum, nil
+}
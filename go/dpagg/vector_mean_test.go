@@ -0,0 +1,235 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpagg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewVectorMeanInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *VectorMeanOptions
+	}{
+		{"nil options", nil},
+		{"zero dimension", &VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, MaxNorm: 1}},
+		{"zero MaxNorm", &VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 2}},
+		{"infinite MaxNorm", &VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 2, MaxNorm: math.Inf(1)}},
+		{"negative epsilon", &VectorMeanOptions{Epsilon: -1, Delta: 1e-5, Dimension: 2, MaxNorm: 1}},
+		{"zero delta", &VectorMeanOptions{Epsilon: ln3, Dimension: 2, MaxNorm: 1}},
+		{"CountFraction of 1", &VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 2, MaxNorm: 1, CountFraction: 1}},
+		{"negative MaxContributionsPerPartition", &VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 2, MaxNorm: 1, MaxContributionsPerPartition: -1}},
+	} {
+		if _, err := NewVectorMean(tc.opts); err == nil {
+			t.Errorf("NewVectorMean: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestVectorMeanResult(t *testing.T) {
+	vm, err := NewVectorMean(&VectorMeanOptions{Epsilon: 50, Delta: 1e-5, Dimension: 2, MaxNorm: 5})
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		vm.Add([]float64{1, 2})
+		vm.Add([]float64{30, 40}) // Clipped to {3, 4}.
+	}
+	vm.Add([]float64{math.NaN(), 1}) // Ignored.
+	got, err := vm.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	want := []float64{2, 3}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 0.1 {
+			t.Errorf("Result: got %v, want approximately %v", got, want)
+			break
+		}
+	}
+	if _, err := vm.Result(); err == nil {
+		t.Errorf("Result called twice: got no error, want error")
+	}
+	if err := vm.Add([]float64{1, 2}); err == nil {
+		t.Errorf("Add after Result: got no error, want error")
+	}
+}
+
+func TestVectorMeanResultIsClippedToMaxNorm(t *testing.T) {
+	// Without any vector, the result is pure noise divided by a count of about
+	// 1, which is scaled down to MaxNorm.
+	vm, err := NewVectorMean(&VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 10, MaxNorm: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm: %v", err)
+	}
+	got, err := vm.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	var norm float64
+	for _, x := range got {
+		norm = math.Hypot(norm, x)
+	}
+	if norm > 1+1e-9 {
+		t.Errorf("Result: got %v with norm %f, want a norm of at most 1", got, norm)
+	}
+}
+
+func TestVectorMeanAddWrongDimension(t *testing.T) {
+	vm, err := NewVectorMean(&VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 2, MaxNorm: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm: %v", err)
+	}
+	if err := vm.Add([]float64{1, 2, 3}); err == nil {
+		t.Errorf("Add with 3 coordinates: got no error, want error")
+	}
+}
+
+func TestVectorMeanAddFloat32(t *testing.T) {
+	opt := &VectorMeanOptions{Epsilon: ln3, Delta: 1e-5, Dimension: 3, MaxNorm: 2}
+	vm32, err := NewVectorMean(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm32: %v", err)
+	}
+	vm64, err := NewVectorMean(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm64: %v", err)
+	}
+	for _, v := range [][]float32{
+		{0.1, 0.2, 0.3},
+		{1e-7, -3.5, 16777217},       // Clipped.
+		{float32(math.Inf(1)), 0, 0}, // Ignored.
+	} {
+		if err := vm32.AddFloat32(v); err != nil {
+			t.Fatalf("AddFloat32(%v): got error %v", v, err)
+		}
+		v64 := make([]float64, len(v))
+		for i, x := range v {
+			v64[i] = float64(x)
+		}
+		if err := vm64.Add(v64); err != nil {
+			t.Fatalf("Add(%v): got error %v", v64, err)
+		}
+	}
+	// Adding a float32 vector is exactly the same as adding its conversion.
+	for i := range vm64.sum {
+		if vm32.sum[i] != vm64.sum[i] {
+			t.Errorf("AddFloat32: got sum %v, want %v", vm32.sum, vm64.sum)
+			break
+		}
+	}
+	if got, want := vm32.count.count, vm64.count.count; got != want {
+		t.Errorf("AddFloat32: got count %d, want %d", got, want)
+	}
+	if err := vm32.AddFloat32([]float32{1, 2}); err == nil {
+		t.Errorf("AddFloat32 with 2 coordinates: got no error, want error")
+	}
+	if _, err := vm32.Result(); err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if err := vm32.AddFloat32([]float32{1, 2, 3}); err == nil {
+		t.Errorf("AddFloat32 after Result: got no error, want error")
+	}
+}
+
+func TestVectorMeanMerge(t *testing.T) {
+	opt := &VectorMeanOptions{Epsilon: 50, Delta: 1e-5, Dimension: 1, MaxNorm: 10}
+	vm1, err := NewVectorMean(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm1: %v", err)
+	}
+	vm2, err := NewVectorMean(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm2: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		vm1.Add([]float64{2})
+		vm2.Add([]float64{4})
+	}
+	if err := vm1.Merge(vm2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	got, err := vm1.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if math.Abs(got[0]-3) > 0.1 {
+		t.Errorf("Result after Merge: got %v, want approximately [3]", got)
+	}
+	if err := vm2.Add([]float64{1}); err == nil {
+		t.Errorf("Add after Merge: got no error, want error")
+	}
+
+	vm3, err := NewVectorMean(&VectorMeanOptions{Epsilon: 50, Delta: 1e-5, Dimension: 2, MaxNorm: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm3: %v", err)
+	}
+	vm4, err := NewVectorMean(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize vm4: %v", err)
+	}
+	if err := vm4.Merge(vm3); err == nil {
+		t.Errorf("Merge with a different dimension: got no error, want error")
+	}
+}
+
+func TestVectorMeanPerKey(t *testing.T) {
+	ka, err := NewKeyedAggregation(&KeyedAggregationOptions[string, *VectorMean]{
+		New: func() (*VectorMean, error) {
+			return NewVectorMean(&VectorMeanOptions{Epsilon: 50, Delta: 1e-5, Dimension: 2, MaxNorm: 2})
+		},
+		Epsilon:                  ln3,
+		Delta:                    1e-10,
+		MaxPartitionsContributed: 1,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize keyed aggregation: %v", err)
+	}
+	centroids := map[string][]float64{"a": {1, 0}, "b": {0, -1}}
+	for key, centroid := range centroids {
+		centroid := centroid
+		for i := 0; i < 1000; i++ {
+			ka.Add(fmt.Sprintf("%s%d", key, i), key, func(vm *VectorMean) error { return vm.Add(centroid) })
+		}
+	}
+	ka.Add("lonely", "c", func(vm *VectorMean) error { return vm.Add([]float64{1, 1}) })
+	got, err := ka.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if len(got) != len(centroids) {
+		t.Errorf("Result: got %d keys, want %d", len(got), len(centroids))
+	}
+	for key, want := range centroids {
+		vm, ok := got[key]
+		if !ok {
+			t.Fatalf("Result: key %q is missing", key)
+		}
+		mean, err := vm.Result()
+		if err != nil {
+			t.Fatalf("Result for key %q: got error %v", key, err)
+		}
+		for i := range want {
+			if math.Abs(mean[i]-want[i]) > 0.1 {
+				t.Errorf("Result for key %q: got %v, want approximately %v", key, mean, want)
+				break
+			}
+		}
+	}
+}
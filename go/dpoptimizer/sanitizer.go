@@ -0,0 +1,154 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dpoptimizer contains building blocks for differentially private
+// model training, such as differentially private stochastic gradient descent
+// (DP-SGD), see Abadi et al.'s "Deep Learning with Differential Privacy"
+// (https://arxiv.org/abs/1607.00133).
+package dpoptimizer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/accounting"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// GradientSanitizer computes differentially private sums of per-example
+// gradients for DP-SGD. At each step of training, Sanitize clips the gradient
+// of each example of the batch to an L_2 norm of at most L2NormClip, sums the
+// clipped gradients, and adds Gaussian noise with standard deviation
+// NoiseMultiplier·L2NormClip to each coordinate of the sum.
+//
+// The privacy guarantee of each step assumes that batches are drawn with
+// Poisson sampling, i.e. that each example of the training set is included in
+// a batch independently with probability SamplingRate. The privacy loss of the
+// steps is tracked with RDP accounting by an accounting.Accountant.
+//
+// Not thread-safe.
+type GradientSanitizer struct {
+	// Parameters
+	l2NormClip float64
+	sigma      float64
+	dimension  int
+	event      accounting.Event
+	accountant *accounting.Accountant
+
+	// State variables
+	steps int64
+}
+
+// GradientSanitizerOptions contains the options necessary to initialize a
+// GradientSanitizer.
+type GradientSanitizerOptions struct {
+	// Maximum L_2 norm of the gradient of a single example. Gradients with a
+	// larger norm are scaled down to this norm. Required.
+	L2NormClip float64
+	// Ratio between the standard deviation of the noise and L2NormClip.
+	// Required.
+	NoiseMultiplier float64
+	// Probability that each example of the training set is included in a batch,
+	// e.g. the expected batch size divided by the size of the training set.
+	// Required; must be in (0, 1].
+	SamplingRate float64
+	// Number of coordinates of the gradients. Required.
+	Dimension int
+	// Accountant on which the privacy loss of each step is spent. Optional; the
+	// privacy loss of the steps can also be tracked with Event and Steps. If the
+	// Accountant enforces its budget, Sanitize fails once it is exhausted.
+	Accountant *accounting.Accountant
+}
+
+// NewGradientSanitizer returns a new GradientSanitizer.
+func NewGradientSanitizer(opt *GradientSanitizerOptions) (*GradientSanitizer, error) {
+	if opt == nil {
+		opt = &GradientSanitizerOptions{}
+	}
+	if opt.L2NormClip <= 0 || math.IsInf(opt.L2NormClip, 0) || math.IsNaN(opt.L2NormClip) {
+		return nil, fmt.Errorf("NewGradientSanitizer: L2NormClip is %f, must be strictly positive and finite", opt.L2NormClip)
+	}
+	if opt.Dimension <= 0 {
+		return nil, fmt.Errorf("NewGradientSanitizer: Dimension is %d, must be strictly positive", opt.Dimension)
+	}
+	event, err := accounting.SampledGaussianEvent(opt.NoiseMultiplier, opt.SamplingRate)
+	if err != nil {
+		return nil, fmt.Errorf("NewGradientSanitizer: %w", err)
+	}
+	return &GradientSanitizer{
+		l2NormClip: opt.L2NormClip,
+		sigma:      opt.NoiseMultiplier * opt.L2NormClip,
+		dimension:  opt.Dimension,
+		event:      event,
+		accountant: opt.Accountant,
+	}, nil
+}
+
+// Sanitize returns the differentially private sum of the clipped per-example
+// gradients of a batch. The batch may be empty, in which case the result is
+// pure noise: skipping empty batches would reveal that they are empty. To get
+// the average gradient, the result should be divided by the expected batch
+// size rather than by len(gradients), which isn't private.
+//
+// If the GradientSanitizer has an Accountant, the privacy loss of the step is
+// spent on it first, and Sanitize fails without computing anything if the
+// Accountant can't spend it.
+func (gs *GradientSanitizer) Sanitize(gradients [][]float64) ([]float64, error) {
+	sum := make([]float64, gs.dimension)
+	for i, g := range gradients {
+		if len(g) != gs.dimension {
+			return nil, fmt.Errorf("Sanitize: gradient %d has %d coordinates, want %d", i, len(g), gs.dimension)
+		}
+		norm := l2Norm(g)
+		if math.IsInf(norm, 0) || math.IsNaN(norm) {
+			return nil, fmt.Errorf("Sanitize: gradient %d has a norm of %f, must be finite", i, norm)
+		}
+		scale := 1.0
+		if norm > gs.l2NormClip {
+			scale = gs.l2NormClip / norm
+		}
+		for j, v := range g {
+			sum[j] += v * scale
+		}
+	}
+	if gs.accountant != nil {
+		if err := gs.accountant.Spend(gs.event); err != nil {
+			return nil, fmt.Errorf("Sanitize: %w", err)
+		}
+	}
+	gs.steps++
+	return noise.AddGaussianNoiseFloat64Vector(sum, gs.sigma)
+}
+
+// Event returns the privacy loss of a single call to Sanitize, e.g. to track
+// it on an accounting.Accountant other than the one of the options.
+func (gs *GradientSanitizer) Event() accounting.Event {
+	return gs.event
+}
+
+// Steps returns the number of successful calls to Sanitize so far.
+func (gs *GradientSanitizer) Steps() int64 {
+	return gs.steps
+}
+
+// l2Norm returns the L_2 norm of v, avoiding overflows for large coordinates.
+func l2Norm(v []float64) float64 {
+	var norm float64
+	for _, x := range v {
+		norm = math.Hypot(norm, x)
+	}
+	return norm
+}
@@ -0,0 +1,150 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpoptimizer
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/accounting"
+)
+
+func TestNewGradientSanitizerInvalidOptions(t *testing.T) {
+	valid := GradientSanitizerOptions{L2NormClip: 1, NoiseMultiplier: 1, SamplingRate: 0.01, Dimension: 2}
+	for _, tc := range []struct {
+		desc   string
+		modify func(*GradientSanitizerOptions)
+	}{
+		{"zero L2NormClip", func(opt *GradientSanitizerOptions) { opt.L2NormClip = 0 }},
+		{"infinite L2NormClip", func(opt *GradientSanitizerOptions) { opt.L2NormClip = math.Inf(1) }},
+		{"zero NoiseMultiplier", func(opt *GradientSanitizerOptions) { opt.NoiseMultiplier = 0 }},
+		{"zero SamplingRate", func(opt *GradientSanitizerOptions) { opt.SamplingRate = 0 }},
+		{"SamplingRate larger than 1", func(opt *GradientSanitizerOptions) { opt.SamplingRate = 2 }},
+		{"zero Dimension", func(opt *GradientSanitizerOptions) { opt.Dimension = 0 }},
+	} {
+		opt := valid
+		tc.modify(&opt)
+		if _, err := NewGradientSanitizer(&opt); err == nil {
+			t.Errorf("NewGradientSanitizer with %s: got no error, want error", tc.desc)
+		}
+	}
+	if _, err := NewGradientSanitizer(nil); err == nil {
+		t.Errorf("NewGradientSanitizer with nil options: got no error, want error")
+	}
+}
+
+func TestSanitizeClipsGradients(t *testing.T) {
+	// With a tiny noise multiplier, the result is the sum of the clipped
+	// gradients up to negligible noise.
+	gs, err := NewGradientSanitizer(&GradientSanitizerOptions{L2NormClip: 1, NoiseMultiplier: 1e-9, SamplingRate: 1, Dimension: 2})
+	if err != nil {
+		t.Fatalf("NewGradientSanitizer: got error %v", err)
+	}
+	got, err := gs.Sanitize([][]float64{
+		{3, 4},     // Clipped to {0.6, 0.8}.
+		{0.5, 0},   // Not clipped.
+		{0, -1e10}, // Clipped to {0, -1}.
+	})
+	if err != nil {
+		t.Fatalf("Sanitize: got error %v", err)
+	}
+	want := []float64{1.1, -0.2}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("Sanitize: got %v, want %v", got, want)
+			break
+		}
+	}
+	if gs.Steps() != 1 {
+		t.Errorf("Steps: got %d, want 1", gs.Steps())
+	}
+}
+
+func TestSanitizeEmptyBatchIsNoised(t *testing.T) {
+	gs, err := NewGradientSanitizer(&GradientSanitizerOptions{L2NormClip: 1, NoiseMultiplier: 1, SamplingRate: 0.1, Dimension: 3})
+	if err != nil {
+		t.Fatalf("NewGradientSanitizer: got error %v", err)
+	}
+	got, err := gs.Sanitize(nil)
+	if err != nil {
+		t.Fatalf("Sanitize: got error %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Sanitize of an empty batch: got %v, want 3 coordinates", got)
+	}
+	if got[0] == 0 && got[1] == 0 && got[2] == 0 {
+		t.Errorf("Sanitize of an empty batch: got %v, want noise", got)
+	}
+}
+
+func TestSanitizeInvalidGradients(t *testing.T) {
+	gs, err := NewGradientSanitizer(&GradientSanitizerOptions{L2NormClip: 1, NoiseMultiplier: 1, SamplingRate: 0.1, Dimension: 2})
+	if err != nil {
+		t.Fatalf("NewGradientSanitizer: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc      string
+		gradients [][]float64
+	}{
+		{"wrong dimension", [][]float64{{1, 2, 3}}},
+		{"NaN coordinate", [][]float64{{math.NaN(), 0}}},
+		{"infinite coordinate", [][]float64{{math.Inf(1), 0}}},
+	} {
+		if _, err := gs.Sanitize(tc.gradients); err == nil {
+			t.Errorf("Sanitize with %s: got no error, want error", tc.desc)
+		}
+	}
+	if gs.Steps() != 0 {
+		t.Errorf("Steps after failed calls to Sanitize: got %d, want 0", gs.Steps())
+	}
+}
+
+func TestSanitizeSpendsOnAccountant(t *testing.T) {
+	a, err := accounting.NewAccountant(&accounting.AccountantOptions{Epsilon: 2, Delta: 1e-5, EnforceBudget: true})
+	if err != nil {
+		t.Fatalf("NewAccountant: got error %v", err)
+	}
+	gs, err := NewGradientSanitizer(&GradientSanitizerOptions{L2NormClip: 1, NoiseMultiplier: 2, SamplingRate: 0.05, Dimension: 1, Accountant: a})
+	if err != nil {
+		t.Fatalf("NewGradientSanitizer: got error %v", err)
+	}
+	var lastEpsilon float64
+	for {
+		_, err := gs.Sanitize([][]float64{{1}})
+		if errors.Is(err, accounting.ErrBudgetExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Sanitize: got error %v", err)
+		}
+		eps, _ := a.Spent()
+		if eps <= lastEpsilon {
+			t.Fatalf("Spent after %d steps: got ε = %f, want more than %f", gs.Steps(), eps, lastEpsilon)
+		}
+		lastEpsilon = eps
+		if gs.Steps() > 100000 {
+			t.Fatalf("Sanitize: budget never exhausted")
+		}
+	}
+	if gs.Steps() == 0 {
+		t.Errorf("Steps: got 0, want the budget to allow some steps")
+	}
+	if eps, _ := a.Spent(); eps > 2 {
+		t.Errorf("Spent: got ε = %f, want at most the budget of 2", eps)
+	}
+}
@@ -0,0 +1,346 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dpsql runs simple aggregate SQL queries against a database/sql
+// connection and returns differentially private results, a lightweight
+// analogue of the anonymization of ZetaSQL. A query of the form
+//
+//	SELECT country, COUNT(*), AVG(age) FROM users WHERE year = ? GROUP BY country
+//
+// is rewritten into a query aggregating the rows of each privacy unit and
+// partition in the database, whose results are then aggregated with dpagg:
+// contributions are bounded, partitions are chosen with differentially private
+// partition selection, and noise is added to the aggregates.
+//
+// The supported aggregates are COUNT(*), COUNT(column), SUM(column) and
+// AVG(column). Like in ZetaSQL, SUM and AVG are bounded per privacy unit: the
+// sum of the values of a privacy unit in a partition, and the average of these
+// values, are clamped to the Bounds of the column.
+package dpsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// Bounds are the bounds of the per privacy unit SUM and AVG of a column.
+type Bounds struct {
+	Lower, Upper float64
+}
+
+// DB runs differentially private queries on a database.
+//
+// Thread-safe, like the *sql.DB it wraps.
+type DB struct {
+	db                           *sql.DB
+	privacyUnitColumn            string
+	epsilon                      float64
+	delta                        float64
+	maxPartitionsContributed     int64
+	maxContributionsPerPartition int64
+	bounds                       map[string]Bounds
+}
+
+// DBOptions contains the options necessary to initialize a DB.
+type DBOptions struct {
+	DB *sql.DB // Database to query. Required.
+	// Column identifying the privacy unit of each row, e.g. a user ID. Required.
+	PrivacyUnitColumn string
+	// Privacy budget of each query, half of which is used by partition
+	// selection, including all of Delta, and half by the aggregates, shared
+	// equally between them. Both are required.
+	Epsilon, Delta float64
+	// How many distinct partitions may a single privacy unit contribute to?
+	// Defaults to 1.
+	MaxPartitionsContributed int64
+	// How many rows of a single privacy unit are counted in a single partition
+	// by COUNT? Defaults to 1.
+	MaxContributionsPerPartition int64
+	// Bounds of the columns aggregated with SUM and AVG. Required for these
+	// columns.
+	Bounds map[string]Bounds
+}
+
+// NewDB returns a new DB.
+func NewDB(opt *DBOptions) (*DB, error) {
+	if opt == nil {
+		opt = &DBOptions{}
+	}
+	if opt.DB == nil {
+		return nil, fmt.Errorf("NewDB requires a DB")
+	}
+	if !columnRegexp.MatchString(opt.PrivacyUnitColumn) {
+		return nil, fmt.Errorf("NewDB: PrivacyUnitColumn is %q, must be a column name", opt.PrivacyUnitColumn)
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewDB: %w", err)
+	}
+	if err := checks.CheckDeltaStrict(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewDB: %w", err)
+	}
+	l0 := opt.MaxPartitionsContributed
+	if l0 == 0 {
+		l0 = 1
+	}
+	if err := checks.CheckL0Sensitivity(l0); err != nil {
+		return nil, fmt.Errorf("NewDB: %w", err)
+	}
+	lInf := opt.MaxContributionsPerPartition
+	if lInf == 0 {
+		lInf = 1
+	}
+	if err := checks.CheckMaxContributionsPerPartition(lInf); err != nil {
+		return nil, fmt.Errorf("NewDB: %w", err)
+	}
+	bounds := make(map[string]Bounds, len(opt.Bounds))
+	for column, b := range opt.Bounds {
+		if err := checks.CheckBoundsFloat64(b.Lower, b.Upper); err != nil {
+			return nil, fmt.Errorf("NewDB: bounds of column %s: %w", column, err)
+		}
+		bounds[column] = b
+	}
+	return &DB{
+		db:                           opt.DB,
+		privacyUnitColumn:            opt.PrivacyUnitColumn,
+		epsilon:                      opt.Epsilon,
+		delta:                        opt.Delta,
+		maxPartitionsContributed:     l0,
+		maxContributionsPerPartition: lInf,
+		bounds:                       bounds,
+	}, nil
+}
+
+// Result is the result of a differentially private query.
+type Result struct {
+	// Names of the columns, i.e. the aliases or texts of the SELECT items.
+	Columns []string
+	// Rows of the released partitions, sorted by partition. GROUP BY columns
+	// have the values returned by the database, COUNT aggregates are int64s,
+	// and SUM and AVG aggregates float64s.
+	Rows [][]interface{}
+}
+
+// Query runs a differentially private query, where args are the arguments of
+// the placeholders of its WHERE clause. Each call spends the privacy budget of
+// the DB.
+func (d *DB) Query(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("dpsql: couldn't parse query: %w", err)
+	}
+	var numAggregates int
+	for _, item := range q.items {
+		if item.function == noAggregate {
+			continue
+		}
+		numAggregates++
+		if item.function != countAggregate {
+			if _, ok := d.bounds[item.column]; !ok {
+				return nil, fmt.Errorf("dpsql: %s requires Bounds for column %s", item.name, item.column)
+			}
+		}
+	}
+	epsilon := d.epsilon / 2 / float64(numAggregates)
+	ka, err := dpagg.NewKeyedAggregation(&dpagg.KeyedAggregationOptions[string, []interface{}]{
+		New:                      func() ([]interface{}, error) { return d.newAggregates(q, epsilon) },
+		Epsilon:                  d.epsilon / 2,
+		Delta:                    d.delta,
+		MaxPartitionsContributed: d.maxPartitionsContributed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dpsql: %w", err)
+	}
+
+	rows, err := d.db.QueryContext(ctx, q.perUnitQuery(d.privacyUnitColumn), args...)
+	if err != nil {
+		return nil, fmt.Errorf("dpsql: couldn't run per privacy unit query: %w", err)
+	}
+	defer rows.Close()
+	keys := make(map[string][]interface{})
+	for rows.Next() {
+		var unit interface{}
+		key := make([]interface{}, len(q.groupBy))
+		var count int64
+		aggregated := make([]sql.NullFloat64, 0, 2*numAggregates)
+		dest := []interface{}{&unit}
+		for i := range key {
+			dest = append(dest, &key[i])
+		}
+		dest = append(dest, &count)
+		for _, item := range q.items {
+			if item.function != noAggregate && item.column != "*" {
+				aggregated = append(aggregated, sql.NullFloat64{}, sql.NullFloat64{})
+				dest = append(dest, &aggregated[len(aggregated)-2], &aggregated[len(aggregated)-1])
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("dpsql: couldn't scan per privacy unit row: %w", err)
+		}
+		if unit == nil {
+			continue
+		}
+		for i, v := range key {
+			// Drivers may reuse the memory of []byte values.
+			if b, ok := v.([]byte); ok {
+				key[i] = string(b)
+			}
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, fmt.Errorf("dpsql: couldn't encode partition %v: %w", key, err)
+		}
+		keys[string(encodedKey)] = key
+		unitID, err := json.Marshal(unit)
+		if err != nil {
+			return nil, fmt.Errorf("dpsql: couldn't encode privacy unit: %w", err)
+		}
+		contribution := d.contribution(q, count, aggregated)
+		if err := ka.Add(string(unitID), string(encodedKey), contribution); err != nil {
+			return nil, fmt.Errorf("dpsql: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("dpsql: couldn't read per privacy unit rows: %w", err)
+	}
+
+	partitions, err := ka.SortedResult()
+	if err != nil {
+		return nil, fmt.Errorf("dpsql: %w", err)
+	}
+	result := &Result{}
+	for _, item := range q.items {
+		result.Columns = append(result.Columns, item.name)
+	}
+	groupByIndex := make(map[string]int)
+	for i, c := range q.groupBy {
+		groupByIndex[c] = i
+	}
+	for _, p := range partitions {
+		row := make([]interface{}, len(q.items))
+		for i, item := range q.items {
+			if item.function == noAggregate {
+				row[i] = keys[p.Key][groupByIndex[item.column]]
+				continue
+			}
+			if row[i], err = aggregateResult(p.Aggregation[i]); err != nil {
+				return nil, fmt.Errorf("dpsql: couldn't compute %s: %w", item.name, err)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
+
+// newAggregates returns the aggregations of a partition, one for each aggregate
+// of q at the index of its SELECT item, each with budget epsilon.
+func (d *DB) newAggregates(q *query, epsilon float64) ([]interface{}, error) {
+	aggregates := make([]interface{}, len(q.items))
+	var err error
+	for i, item := range q.items {
+		switch item.function {
+		case countAggregate:
+			// Each privacy unit contributes its number of rows, or non-null
+			// values, capped to MaxContributionsPerPartition.
+			aggregates[i], err = dpagg.NewBoundedSumInt64(&dpagg.BoundedSumInt64Options{
+				Epsilon:                  epsilon,
+				MaxPartitionsContributed: d.maxPartitionsContributed,
+				Lower:                    0,
+				Upper:                    d.maxContributionsPerPartition,
+				Noise:                    noise.Laplace(),
+			})
+		case sumAggregate:
+			b := d.bounds[item.column]
+			aggregates[i], err = dpagg.NewBoundedSumFloat64(&dpagg.BoundedSumFloat64Options{
+				Epsilon:                  epsilon,
+				MaxPartitionsContributed: d.maxPartitionsContributed,
+				Lower:                    b.Lower,
+				Upper:                    b.Upper,
+				Noise:                    noise.Laplace(),
+			})
+		case avgAggregate:
+			// Each privacy unit contributes its average.
+			b := d.bounds[item.column]
+			aggregates[i], err = dpagg.NewBoundedMeanFloat64(&dpagg.BoundedMeanFloat64Options{
+				Epsilon:                      epsilon,
+				MaxPartitionsContributed:     d.maxPartitionsContributed,
+				MaxContributionsPerPartition: 1,
+				Lower:                        b.Lower,
+				Upper:                        b.Upper,
+				Noise:                        noise.Laplace(),
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggregates, nil
+}
+
+// contribution returns the contribution of a privacy unit to a partition,
+// given its number of rows and, for each aggregate of a column, the sum and the
+// number of non-null values of the column.
+func (d *DB) contribution(q *query, count int64, aggregated []sql.NullFloat64) func([]interface{}) error {
+	return func(aggregates []interface{}) error {
+		j := 0
+		for i, item := range q.items {
+			if item.function == noAggregate {
+				continue
+			}
+			var sum, n float64
+			if item.column != "*" {
+				sum, n = aggregated[j].Float64, aggregated[j+1].Float64
+				j += 2
+			}
+			var err error
+			switch item.function {
+			case countAggregate:
+				c := count
+				if item.column != "*" {
+					c = int64(n)
+				}
+				err = aggregates[i].(*dpagg.BoundedSumInt64).Add(c)
+			case sumAggregate:
+				err = aggregates[i].(*dpagg.BoundedSumFloat64).Add(sum)
+			case avgAggregate:
+				if n > 0 {
+					err = aggregates[i].(*dpagg.BoundedMeanFloat64).Add(sum / n)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func aggregateResult(aggregate interface{}) (interface{}, error) {
+	switch a := aggregate.(type) {
+	case *dpagg.BoundedSumInt64:
+		return a.Result()
+	case *dpagg.BoundedSumFloat64:
+		return a.Result()
+	case *dpagg.BoundedMeanFloat64:
+		return a.Result()
+	}
+	return nil, fmt.Errorf("unexpected aggregation %T", aggregate)
+}
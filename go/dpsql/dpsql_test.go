@@ -0,0 +1,203 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"testing"
+)
+
+// fakeDriver is a database/sql driver that returns the same rows for any
+// query, and records the queries and their arguments.
+type fakeDriver struct {
+	mu      sync.Mutex
+	rows    map[string][][]driver.Value
+	queries []string
+	args    [][]driver.Value
+}
+
+var (
+	testDriver         = &fakeDriver{rows: make(map[string][][]driver.Value)}
+	registerTestDriver sync.Once
+)
+
+// openFakeDB returns a database whose queries return the given rows.
+func openFakeDB(t *testing.T, rows [][]driver.Value) *sql.DB {
+	t.Helper()
+	registerTestDriver.Do(func() { sql.Register("fakedpsql", testDriver) })
+	testDriver.mu.Lock()
+	testDriver.rows[t.Name()] = rows
+	testDriver.mu.Unlock()
+	db, err := sql.Open("fakedpsql", t.Name())
+	if err != nil {
+		t.Fatalf("sql.Open: got error %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d, name: name}, nil
+}
+
+type fakeConn struct {
+	d    *fakeDriver
+	name string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("unsupported query")
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	d.args = append(d.args, args)
+	return &fakeRows{rows: d.rows[s.c.name]}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestQuery(t *testing.T) {
+	// Columns of the per privacy unit query: uid, country, COUNT(*), SUM(spend),
+	// COUNT(spend), SUM(age), COUNT(age).
+	db := openFakeDB(t, [][]driver.Value{
+		{"u1", "FR", int64(3), 30.0, int64(3), 60.0, int64(2)},
+		{"u2", "FR", int64(1), 5.0, int64(1), 40.0, int64(1)},
+		{"u3", "FR", int64(1), nil, int64(0), nil, int64(0)},
+		// Partitions with a single privacy unit are dropped by partition
+		// selection, except with probability δ.
+		{"u4", "DE", int64(1), 5.0, int64(1), 40.0, int64(1)},
+		// Rows without a privacy unit are ignored.
+		{nil, "FR", int64(10), 10.0, int64(10), 10.0, int64(10)},
+	})
+	d, err := NewDB(&DBOptions{
+		DB:                           db,
+		PrivacyUnitColumn:            "uid",
+		Epsilon:                      1e6,
+		Delta:                        1e-10,
+		MaxContributionsPerPartition: 2,
+		Bounds:                       map[string]Bounds{"spend": {0, 20}, "age": {0, 100}},
+	})
+	if err != nil {
+		t.Fatalf("NewDB: got error %v", err)
+	}
+	got, err := d.Query(context.Background(), "SELECT country, COUNT(*) AS n, SUM(spend), AVG(age) FROM events WHERE year = ? GROUP BY country", 2021)
+	if err != nil {
+		t.Fatalf("Query: got error %v", err)
+	}
+	wantQuery := "SELECT uid, country, COUNT(*), SUM(spend), COUNT(spend), SUM(age), COUNT(age) FROM events WHERE year = ? GROUP BY uid, country"
+	if q := testDriver.queries[len(testDriver.queries)-1]; q != wantQuery {
+		t.Errorf("Query: ran %q, want %q", q, wantQuery)
+	}
+	if args := testDriver.args[len(testDriver.args)-1]; len(args) != 1 || args[0] != int64(2021) {
+		t.Errorf("Query: ran with arguments %v, want [2021]", args)
+	}
+	if len(got.Columns) != 4 || got.Columns[1] != "n" || got.Columns[2] != "SUM(spend)" {
+		t.Errorf("Query: got columns %v, want [country n SUM(spend) AVG(age)]", got.Columns)
+	}
+	if len(got.Rows) != 1 {
+		t.Fatalf("Query: got rows %v, want a single row", got.Rows)
+	}
+	row := got.Rows[0]
+	if row[0] != "FR" {
+		t.Errorf("Query: got partition %v, want FR", row[0])
+	}
+	// u1 has 3 rows, of which 2 are counted, and a sum of 30, clamped to 20. u3
+	// has no age, so it doesn't contribute to the average.
+	if row[1] != int64(4) {
+		t.Errorf("Query: got COUNT(*) %v, want 4", row[1])
+	}
+	if s := row[2].(float64); math.Abs(s-25) > 0.1 {
+		t.Errorf("Query: got SUM(spend) %f, want 25", s)
+	}
+	if a := row[3].(float64); math.Abs(a-35) > 0.1 {
+		t.Errorf("Query: got AVG(age) %f, want 35", a)
+	}
+}
+
+func TestQueryWithoutBounds(t *testing.T) {
+	db := openFakeDB(t, nil)
+	d, err := NewDB(&DBOptions{DB: db, PrivacyUnitColumn: "uid", Epsilon: 1, Delta: 1e-5})
+	if err != nil {
+		t.Fatalf("NewDB: got error %v", err)
+	}
+	if _, err := d.Query(context.Background(), "SELECT country, SUM(spend) FROM events GROUP BY country"); err == nil {
+		t.Errorf("Query with SUM of a column without Bounds: got no error, want error")
+	}
+}
+
+func TestNewDBInvalidOptions(t *testing.T) {
+	db := openFakeDB(t, nil)
+	for _, tc := range []struct {
+		desc string
+		opt  *DBOptions
+	}{
+		{"nil options", nil},
+		{"no DB", &DBOptions{PrivacyUnitColumn: "uid", Epsilon: 1, Delta: 1e-5}},
+		{"invalid PrivacyUnitColumn", &DBOptions{DB: db, PrivacyUnitColumn: "uid; DROP TABLE users", Epsilon: 1, Delta: 1e-5}},
+		{"no Epsilon", &DBOptions{DB: db, PrivacyUnitColumn: "uid", Delta: 1e-5}},
+		{"no Delta", &DBOptions{DB: db, PrivacyUnitColumn: "uid", Epsilon: 1}},
+		{"negative MaxContributionsPerPartition", &DBOptions{DB: db, PrivacyUnitColumn: "uid", Epsilon: 1, Delta: 1e-5, MaxContributionsPerPartition: -1}},
+		{"invalid Bounds", &DBOptions{DB: db, PrivacyUnitColumn: "uid", Epsilon: 1, Delta: 1e-5, Bounds: map[string]Bounds{"age": {10, 0}}}},
+	} {
+		if _, err := NewDB(tc.opt); err == nil {
+			t.Errorf("NewDB with %s: got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpsql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// aggregateFunction is an aggregate function supported in queries.
+type aggregateFunction int
+
+const (
+	noAggregate aggregateFunction = iota
+	countAggregate
+	sumAggregate
+	avgAggregate
+)
+
+// selectItem is an item of the SELECT clause: a column of the GROUP BY clause,
+// or an aggregate function of a column.
+type selectItem struct {
+	function aggregateFunction
+	// Column, or "*" for COUNT(*).
+	column string
+	// Name of the item in the result, i.e. its alias or its text.
+	name string
+}
+
+// query is a parsed query of the form
+//
+//	SELECT items FROM table [WHERE condition] GROUP BY columns
+type query struct {
+	items   []selectItem
+	table   string
+	where   string
+	groupBy []string
+}
+
+var (
+	queryRegexp    = regexp.MustCompile(`(?is)^\s*SELECT\s+(.+?)\s+FROM\s+([A-Za-z_][A-Za-z0-9_.]*)(?:\s+WHERE\s+(.+?))?\s+GROUP\s+BY\s+(.+?)\s*;?\s*$`)
+	columnRegexp   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	itemRegexp     = regexp.MustCompile(`(?is)^(?:([A-Za-z_][A-Za-z0-9_.]*)|(COUNT|SUM|AVG)\s*\(\s*(\*|[A-Za-z_][A-Za-z0-9_.]*)\s*\))(?:\s+AS\s+([A-Za-z_][A-Za-z0-9_]*))?$`)
+	aggregateNames = map[string]aggregateFunction{"COUNT": countAggregate, "SUM": sumAggregate, "AVG": avgAggregate}
+)
+
+// parseQuery parses a query with aggregates and a GROUP BY clause. The
+// condition of the WHERE clause is kept verbatim.
+func parseQuery(s string) (*query, error) {
+	m := queryRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("query must be of the form SELECT ... FROM table [WHERE ...] GROUP BY ...")
+	}
+	q := &query{table: m[2], where: m[3]}
+	groupBy := make(map[string]bool)
+	for _, c := range strings.Split(m[4], ",") {
+		c = strings.TrimSpace(c)
+		if !columnRegexp.MatchString(c) {
+			return nil, fmt.Errorf("GROUP BY item %q must be a column", c)
+		}
+		if groupBy[c] {
+			return nil, fmt.Errorf("column %s appears twice in GROUP BY", c)
+		}
+		groupBy[c] = true
+		q.groupBy = append(q.groupBy, c)
+	}
+	hasAggregate := false
+	for _, text := range strings.Split(m[1], ",") {
+		text = strings.TrimSpace(text)
+		im := itemRegexp.FindStringSubmatch(text)
+		if im == nil {
+			return nil, fmt.Errorf("SELECT item %q must be a column, COUNT(*), COUNT(column), SUM(column) or AVG(column)", text)
+		}
+		item := selectItem{name: im[4]}
+		if im[1] != "" {
+			if !groupBy[im[1]] {
+				return nil, fmt.Errorf("column %s must appear in GROUP BY", im[1])
+			}
+			item.column = im[1]
+		} else {
+			item.function = aggregateNames[strings.ToUpper(im[2])]
+			item.column = im[3]
+			if item.column == "*" && item.function != countAggregate {
+				return nil, fmt.Errorf("%s(*) is not supported", im[2])
+			}
+			hasAggregate = true
+		}
+		if item.name == "" {
+			item.name = text
+		}
+		q.items = append(q.items, item)
+	}
+	if !hasAggregate {
+		return nil, fmt.Errorf("query must have at least one aggregate")
+	}
+	return q, nil
+}
+
+// perUnitQuery returns the query aggregating the rows of each privacy unit and
+// partition, whose columns are the privacy unit, the GROUP BY columns, the
+// number of rows, and for each aggregate of a column, the sum and the number of
+// non-null values of the column.
+func (q *query) perUnitQuery(privacyUnitColumn string) string {
+	keys := strings.Join(append([]string{privacyUnitColumn}, q.groupBy...), ", ")
+	columns := []string{keys, "COUNT(*)"}
+	for _, item := range q.items {
+		if item.function != noAggregate && item.column != "*" {
+			columns = append(columns, "SUM("+item.column+")", "COUNT("+item.column+")")
+		}
+	}
+	s := "SELECT " + strings.Join(columns, ", ") + " FROM " + q.table
+	if q.where != "" {
+		s += " WHERE " + q.where
+	}
+	return s + " GROUP BY " + keys
+}
@@ -0,0 +1,66 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpsql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseQuery(t *testing.T) {
+	q, err := parseQuery("select country, COUNT(*) AS n, sum(spend), AVG( age ) FROM events WHERE year = ? AND spend > 0 GROUP BY country, city;")
+	if err != nil {
+		t.Fatalf("parseQuery: got error %v", err)
+	}
+	want := &query{
+		items: []selectItem{
+			{function: noAggregate, column: "country", name: "country"},
+			{function: countAggregate, column: "*", name: "n"},
+			{function: sumAggregate, column: "spend", name: "sum(spend)"},
+			{function: avgAggregate, column: "age", name: "AVG( age )"},
+		},
+		table:   "events",
+		where:   "year = ? AND spend > 0",
+		groupBy: []string{"country", "city"},
+	}
+	if diff := cmp.Diff(want, q, cmp.AllowUnexported(query{}, selectItem{})); diff != "" {
+		t.Errorf("parseQuery: got diff (-want +got):\n%s", diff)
+	}
+	wantQuery := "SELECT uid, country, city, COUNT(*), SUM(spend), COUNT(spend), SUM(age), COUNT(age) FROM events WHERE year = ? AND spend > 0 GROUP BY uid, country, city"
+	if got := q.perUnitQuery("uid"); got != wantQuery {
+		t.Errorf("perUnitQuery: got %q, want %q", got, wantQuery)
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	for _, s := range []string{
+		"SELECT COUNT(*) FROM events",
+		"DELETE FROM events",
+		"SELECT country FROM events GROUP BY country",
+		"SELECT city, COUNT(*) FROM events GROUP BY country",
+		"SELECT country, SUM(*) FROM events GROUP BY country",
+		"SELECT country, MAX(age) FROM events GROUP BY country",
+		"SELECT country, COUNT(*) FROM events GROUP BY country, country",
+		"SELECT country, COUNT(*) FROM events GROUP BY LOWER(country)",
+		"SELECT country, COUNT(*) FROM (SELECT * FROM events) GROUP BY country",
+	} {
+		if _, err := parseQuery(s); err == nil {
+			t.Errorf("parseQuery(%q): got no error, want error", s)
+		}
+	}
+}
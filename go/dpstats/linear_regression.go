@@ -0,0 +1,134 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dpstats contains differentially private statistical models built
+// on top of the aggregations of package dpagg.
+package dpstats
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// LinearRegression fits a differentially private simple linear regression
+// y = Slope·x + Intercept with ordinary least squares, on a collection of
+// pairs (x, y) of float64 values.
+//
+// It uses sufficient statistics perturbation: the count, means, variances and
+// covariance of the pairs are computed with a dpagg.BoundedCovariance, and
+// the regression is derived from them by post-processing, i.e. Slope is the
+// covariance divided by the variance of x, and Intercept is the mean of y
+// minus Slope times the mean of x. The pairs are clamped to [LowerX, UpperX]
+// and [LowerY, UpperY].
+//
+// LinearRegression supports privacy units that contribute to multiple
+// partitions (via the MaxPartitionsContributed parameter) as well as
+// contribute to the same partition multiple times (via the
+// MaxContributionsPerPartition parameter), by scaling the added noise
+// appropriately.
+//
+// Not thread-safe.
+type LinearRegression struct {
+	covariance *dpagg.BoundedCovariance
+}
+
+// LinearRegressionOptions contains the options necessary to initialize a
+// LinearRegression.
+type LinearRegressionOptions struct {
+	Epsilon                      float64 // Privacy parameter ε. Required.
+	Delta                        float64 // Privacy parameter δ. Required with Gaussian noise, must be 0 with Laplace noise.
+	MaxPartitionsContributed     int64   // How many distinct partitions may a single user contribute to? Defaults to 1.
+	MaxContributionsPerPartition int64   // How many pairs may a single user contribute to a single partition? Required.
+	// Bounds for clamping x and y. Default to 0; must be such that
+	// LowerX < UpperX and LowerY < UpperY.
+	LowerX, UpperX float64
+	LowerY, UpperY float64
+	Noise          noise.Noise // Type of noise used. Defaults to Laplace noise.
+}
+
+// LinearRegressionResult contains the fitted model of a LinearRegression.
+type LinearRegressionResult struct {
+	Slope, Intercept float64
+	// RSquared is the coefficient of determination of the model, i.e. the
+	// square of the correlation between x and y, in [0, 1].
+	RSquared float64
+	// Count is the differentially private number of pairs the model was fitted
+	// on.
+	Count int64
+}
+
+// NewLinearRegression returns a new LinearRegression.
+func NewLinearRegression(opt *LinearRegressionOptions) (*LinearRegression, error) {
+	if opt == nil {
+		opt = &LinearRegressionOptions{}
+	}
+	bc, err := dpagg.NewBoundedCovariance(&dpagg.BoundedCovarianceOptions{
+		Epsilon:                      opt.Epsilon,
+		Delta:                        opt.Delta,
+		MaxPartitionsContributed:     opt.MaxPartitionsContributed,
+		MaxContributionsPerPartition: opt.MaxContributionsPerPartition,
+		LowerX:                       opt.LowerX,
+		UpperX:                       opt.UpperX,
+		LowerY:                       opt.LowerY,
+		UpperY:                       opt.UpperY,
+		Noise:                        opt.Noise,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NewLinearRegression: %w", err)
+	}
+	return &LinearRegression{covariance: bc}, nil
+}
+
+// Add adds a pair (x, y) to a LinearRegression. Pairs with a NaN coordinate
+// are skipped.
+func (lr *LinearRegression) Add(x, y float64) error {
+	return lr.covariance.Add(x, y)
+}
+
+// Merge merges lr2 into lr (i.e., adds to lr all pairs that were added to
+// lr2). lr2 is consumed by this operation: lr2 may not be used after it is
+// merged into lr.
+func (lr *LinearRegression) Merge(lr2 *LinearRegression) error {
+	return lr.covariance.Merge(lr2.covariance)
+}
+
+// Result returns the differentially private regression fitted on the pairs
+// added so far. The method can be called only once.
+//
+// If the differentially private variance of x is 0, there is no best fit:
+// Result then returns a model of slope 0 whose intercept is the mean of y.
+//
+// Note that the slope is not bounded: when the variance of x is small
+// compared to the noise, the slope may be arbitrarily large. Bounds on x
+// that are tight around the data reduce this effect.
+func (lr *LinearRegression) Result() (LinearRegressionResult, error) {
+	stats, err := lr.covariance.Result()
+	if err != nil {
+		return LinearRegressionResult{}, fmt.Errorf("couldn't compute dp covariance: %w", err)
+	}
+	result := LinearRegressionResult{
+		Intercept: stats.MeanY,
+		RSquared:  stats.Correlation * stats.Correlation,
+		Count:     stats.Count,
+	}
+	if stats.VarianceX > 0 {
+		result.Slope = stats.Covariance / stats.VarianceX
+		result.Intercept = stats.MeanY - result.Slope*stats.MeanX
+	}
+	return result, nil
+}
@@ -0,0 +1,173 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dpstats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// noNoise is a Noise instance that doesn't add noise to the data.
+type noNoise struct {
+	noise.Noise
+}
+
+func (noNoise) AddNoiseInt64(x, _, _ int64, _, _ float64) (int64, error) {
+	return x, nil
+}
+
+func (noNoise) AddNoiseFloat64(x float64, _ int64, _, _, _ float64) (float64, error) {
+	return x, nil
+}
+
+func getNoiselessLinearRegression(t *testing.T) *LinearRegression {
+	t.Helper()
+	lr, err := NewLinearRegression(&LinearRegressionOptions{
+		Epsilon:                      math.Log(3),
+		MaxContributionsPerPartition: 1,
+		LowerX:                       0,
+		UpperX:                       10,
+		LowerY:                       -20,
+		UpperY:                       20,
+		Noise:                        noNoise{},
+	})
+	if err != nil {
+		t.Fatalf("Couldn't get noiseless LinearRegression: %v", err)
+	}
+	return lr
+}
+
+func TestNewLinearRegressionInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *LinearRegressionOptions
+	}{
+		{"nil options", nil},
+		{"no MaxContributionsPerPartition", &LinearRegressionOptions{Epsilon: 1, LowerX: 0, UpperX: 10, LowerY: 0, UpperY: 1}},
+		{"no bounds of x", &LinearRegressionOptions{Epsilon: 1, MaxContributionsPerPartition: 1, LowerY: 0, UpperY: 1}},
+		{"zero epsilon", &LinearRegressionOptions{MaxContributionsPerPartition: 1, LowerX: 0, UpperX: 10, LowerY: 0, UpperY: 1}},
+	} {
+		if _, err := NewLinearRegression(tc.opt); err == nil {
+			t.Errorf("NewLinearRegression: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestLinearRegressionExactFit(t *testing.T) {
+	lr := getNoiselessLinearRegression(t)
+	// y = -2x + 5
+	for x := 0.0; x <= 10; x++ {
+		lr.Add(x, -2*x+5)
+	}
+	got, err := lr.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if !approxEqual(got.Slope, -2) || !approxEqual(got.Intercept, 5) {
+		t.Errorf("Result: got y = %fx + %f, want y = -2x + 5", got.Slope, got.Intercept)
+	}
+	if !approxEqual(got.RSquared, 1) {
+		t.Errorf("Result: got R² = %f, want 1", got.RSquared)
+	}
+	if got.Count != 11 {
+		t.Errorf("Result: got count %d, want 11", got.Count)
+	}
+	if _, err := lr.Result(); err == nil {
+		t.Errorf("Result: got no error when called twice, want error")
+	}
+}
+
+func TestLinearRegressionLeastSquares(t *testing.T) {
+	lr := getNoiselessLinearRegression(t)
+	// The least squares fit of these points is y = 0.5x + 1.
+	for _, p := range [][2]float64{{0, 0}, {0, 2}, {4, 2}, {4, 4}} {
+		lr.Add(p[0], p[1])
+	}
+	got, err := lr.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if !approxEqual(got.Slope, 0.5) || !approxEqual(got.Intercept, 1) {
+		t.Errorf("Result: got y = %fx + %f, want y = 0.5x + 1", got.Slope, got.Intercept)
+	}
+	if !approxEqual(got.RSquared, 0.5) {
+		t.Errorf("Result: got R² = %f, want 0.5", got.RSquared)
+	}
+}
+
+func TestLinearRegressionConstantX(t *testing.T) {
+	lr := getNoiselessLinearRegression(t)
+	for _, y := range []float64{1, 2, 6} {
+		lr.Add(4, y)
+	}
+	got, err := lr.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if got.Slope != 0 || !approxEqual(got.Intercept, 3) {
+		t.Errorf("Result: with constant x got y = %fx + %f, want y = 0x + 3", got.Slope, got.Intercept)
+	}
+}
+
+func TestLinearRegressionMerge(t *testing.T) {
+	lr1, lr2 := getNoiselessLinearRegression(t), getNoiselessLinearRegression(t)
+	lr1.Add(0, 0)
+	lr1.Add(0, 2)
+	lr2.Add(4, 2)
+	lr2.Add(4, 4)
+	if err := lr1.Merge(lr2); err != nil {
+		t.Fatalf("Merge: got error %v", err)
+	}
+	got, err := lr1.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if !approxEqual(got.Slope, 0.5) || !approxEqual(got.Intercept, 1) {
+		t.Errorf("Merge: got y = %fx + %f, want y = 0.5x + 1", got.Slope, got.Intercept)
+	}
+}
+
+func TestLinearRegressionWithNoise(t *testing.T) {
+	lr, err := NewLinearRegression(&LinearRegressionOptions{
+		Epsilon:                      10,
+		MaxContributionsPerPartition: 1,
+		LowerX:                       0,
+		UpperX:                       10,
+		LowerY:                       -20,
+		UpperY:                       20,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize LinearRegression: %v", err)
+	}
+	for i := 0; i < 100000; i++ {
+		x := float64(i % 11)
+		lr.Add(x, -2*x+5)
+	}
+	got, err := lr.Result()
+	if err != nil {
+		t.Fatalf("Couldn't compute dp result: %v", err)
+	}
+	if math.Abs(got.Slope+2) > 0.01 || math.Abs(got.Intercept-5) > 0.05 {
+		t.Errorf("Result: got y = %fx + %f, want approximately y = -2x + 5", got.Slope, got.Intercept)
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9
+}
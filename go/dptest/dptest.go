@@ -0,0 +1,157 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dptest provides noise.Noise implementations for testing pipelines
+// that use differentially private aggregations without dealing with random
+// noise.
+//
+// These do NOT provide any privacy protections, so they should only be used in
+// test code.
+package dptest
+
+import (
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// ZeroNoise is a noise.Noise that doesn't add any noise. Its threshold is 0, so
+// that thresholding keeps all partitions, and its confidence intervals only
+// contain the noised value.
+type ZeroNoise struct{}
+
+// AddNoiseInt64 returns x.
+func (ZeroNoise) AddNoiseInt64(x, _, _ int64, _, _ float64) (int64, error) {
+	return x, nil
+}
+
+// AddNoiseFloat64 returns x.
+func (ZeroNoise) AddNoiseFloat64(x float64, _ int64, _, _, _ float64) (float64, error) {
+	return x, nil
+}
+
+// Threshold returns 0.
+func (ZeroNoise) Threshold(_ int64, _, _, _, _ float64) (float64, error) {
+	return 0, nil
+}
+
+// ComputeConfidenceIntervalInt64 returns [noisedX, noisedX].
+func (ZeroNoise) ComputeConfidenceIntervalInt64(noisedX, _, _ int64, _, _, _ float64) (noise.ConfidenceInterval, error) {
+	return noise.ConfidenceInterval{LowerBound: float64(noisedX), UpperBound: float64(noisedX)}, nil
+}
+
+// ComputeConfidenceIntervalFloat64 returns [noisedX, noisedX].
+func (ZeroNoise) ComputeConfidenceIntervalFloat64(noisedX float64, _ int64, _, _, _, _ float64) (noise.ConfidenceInterval, error) {
+	return noise.ConfidenceInterval{LowerBound: noisedX, UpperBound: noisedX}, nil
+}
+
+// ConstantNoise is a noise.Noise that adds a constant to all values, e.g. to
+// check that a pipeline uses noisy values rather than raw ones. Its confidence
+// intervals only contain the raw value.
+type ConstantNoise struct {
+	Int64   int64   // Noise added by AddNoiseInt64.
+	Float64 float64 // Noise added by AddNoiseFloat64.
+	// Value returned by Threshold. Defaults to 0, so that thresholding keeps
+	// all partitions unless the noise is negative.
+	ThresholdValue float64
+}
+
+// AddNoiseInt64 returns x + n.Int64.
+func (n ConstantNoise) AddNoiseInt64(x, _, _ int64, _, _ float64) (int64, error) {
+	return x + n.Int64, nil
+}
+
+// AddNoiseFloat64 returns x + n.Float64.
+func (n ConstantNoise) AddNoiseFloat64(x float64, _ int64, _, _, _ float64) (float64, error) {
+	return x + n.Float64, nil
+}
+
+// Threshold returns n.ThresholdValue.
+func (n ConstantNoise) Threshold(_ int64, _, _, _, _ float64) (float64, error) {
+	return n.ThresholdValue, nil
+}
+
+// ComputeConfidenceIntervalInt64 returns [noisedX - n.Int64, noisedX - n.Int64].
+func (n ConstantNoise) ComputeConfidenceIntervalInt64(noisedX, _, _ int64, _, _, _ float64) (noise.ConfidenceInterval, error) {
+	x := float64(noisedX - n.Int64)
+	return noise.ConfidenceInterval{LowerBound: x, UpperBound: x}, nil
+}
+
+// ComputeConfidenceIntervalFloat64 returns [noisedX - n.Float64, noisedX - n.Float64].
+func (n ConstantNoise) ComputeConfidenceIntervalFloat64(noisedX float64, _ int64, _, _, _, _ float64) (noise.ConfidenceInterval, error) {
+	x := noisedX - n.Float64
+	return noise.ConfidenceInterval{LowerBound: x, UpperBound: x}, nil
+}
+
+// Call is a call to a method of a RecordingNoise, with its privacy
+// parameters.
+type Call struct {
+	// Name of the method, e.g. "AddNoiseInt64".
+	Method          string
+	L0Sensitivity   int64
+	LInfSensitivity float64
+	Epsilon         float64
+	// Parameter δ of the noise, i.e. noiseDelta for Threshold.
+	Delta float64
+	// Parameter thresholdDelta of Threshold, 0 for the other methods.
+	ThresholdDelta float64
+	// Parameter alpha of the confidence interval methods, 0 for the other
+	// methods.
+	Alpha float64
+}
+
+// RecordingNoise is a noise.Noise that records the calls to its methods, e.g.
+// to check the sensitivities and the privacy budget used by an aggregation,
+// and forwards them to another Noise. It must be used as a *RecordingNoise.
+//
+// Not thread-safe.
+type RecordingNoise struct {
+	// Noise to which the calls are forwarded. Defaults to ZeroNoise.
+	Noise noise.Noise
+	// Calls made so far, in order.
+	Calls []Call
+}
+
+func (n *RecordingNoise) record(c Call) noise.Noise {
+	n.Calls = append(n.Calls, c)
+	if n.Noise == nil {
+		return ZeroNoise{}
+	}
+	return n.Noise
+}
+
+// AddNoiseInt64 records the call and forwards it.
+func (n *RecordingNoise) AddNoiseInt64(x, l0, lInf int64, eps, del float64) (int64, error) {
+	return n.record(Call{Method: "AddNoiseInt64", L0Sensitivity: l0, LInfSensitivity: float64(lInf), Epsilon: eps, Delta: del}).AddNoiseInt64(x, l0, lInf, eps, del)
+}
+
+// AddNoiseFloat64 records the call and forwards it.
+func (n *RecordingNoise) AddNoiseFloat64(x float64, l0 int64, lInf, eps, del float64) (float64, error) {
+	return n.record(Call{Method: "AddNoiseFloat64", L0Sensitivity: l0, LInfSensitivity: lInf, Epsilon: eps, Delta: del}).AddNoiseFloat64(x, l0, lInf, eps, del)
+}
+
+// Threshold records the call and forwards it.
+func (n *RecordingNoise) Threshold(l0 int64, lInf, eps, noiseDel, thresholdDel float64) (float64, error) {
+	return n.record(Call{Method: "Threshold", L0Sensitivity: l0, LInfSensitivity: lInf, Epsilon: eps, Delta: noiseDel, ThresholdDelta: thresholdDel}).Threshold(l0, lInf, eps, noiseDel, thresholdDel)
+}
+
+// ComputeConfidenceIntervalInt64 records the call and forwards it.
+func (n *RecordingNoise) ComputeConfidenceIntervalInt64(noisedX, l0, lInf int64, eps, del, alpha float64) (noise.ConfidenceInterval, error) {
+	return n.record(Call{Method: "ComputeConfidenceIntervalInt64", L0Sensitivity: l0, LInfSensitivity: float64(lInf), Epsilon: eps, Delta: del, Alpha: alpha}).ComputeConfidenceIntervalInt64(noisedX, l0, lInf, eps, del, alpha)
+}
+
+// ComputeConfidenceIntervalFloat64 records the call and forwards it.
+func (n *RecordingNoise) ComputeConfidenceIntervalFloat64(noisedX float64, l0 int64, lInf, eps, del, alpha float64) (noise.ConfidenceInterval, error) {
+	return n.record(Call{Method: "ComputeConfidenceIntervalFloat64", L0Sensitivity: l0, LInfSensitivity: lInf, Epsilon: eps, Delta: del, Alpha: alpha}).ComputeConfidenceIntervalFloat64(noisedX, l0, lInf, eps, del, alpha)
+}
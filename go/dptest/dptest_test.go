@@ -0,0 +1,117 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dptest
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Checks that the types implement noise.Noise.
+var (
+	_ noise.Noise = ZeroNoise{}
+	_ noise.Noise = ConstantNoise{}
+	_ noise.Noise = &RecordingNoise{}
+)
+
+// newCount returns a Count with the given noise, to which 10 is added.
+func newCount(t *testing.T, n noise.Noise) *dpagg.Count {
+	t.Helper()
+	c, err := dpagg.NewCount(&dpagg.CountOptions{Epsilon: 1, MaxPartitionsContributed: 2, Noise: n})
+	if err != nil {
+		t.Fatalf("Couldn't initialize count: %v", err)
+	}
+	if err := c.IncrementBy(10); err != nil {
+		t.Fatalf("Couldn't increment count: %v", err)
+	}
+	return c
+}
+
+func TestZeroNoise(t *testing.T) {
+	got, err := newCount(t, ZeroNoise{}).ThresholdedResult(1e-5)
+	if err != nil {
+		t.Fatalf("ThresholdedResult: got error %v", err)
+	}
+	if got == nil || *got != 10 {
+		t.Errorf("ThresholdedResult: got %v, want 10", got)
+	}
+	ci, err := ZeroNoise{}.ComputeConfidenceIntervalFloat64(1.5, 1, 1, 1, 0, 0.1)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceIntervalFloat64: got error %v", err)
+	}
+	if want := (noise.ConfidenceInterval{LowerBound: 1.5, UpperBound: 1.5}); ci != want {
+		t.Errorf("ComputeConfidenceIntervalFloat64: got %v, want %v", ci, want)
+	}
+}
+
+func TestConstantNoise(t *testing.T) {
+	n := ConstantNoise{Int64: 3, Float64: -0.5, ThresholdValue: 20}
+	c := newCount(t, n)
+	got, err := c.Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 13 {
+		t.Errorf("Result: got %d, want 13", got)
+	}
+	ci, err := c.ComputeConfidenceInterval(0.1)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceInterval: got error %v", err)
+	}
+	if want := (noise.ConfidenceInterval{LowerBound: 10, UpperBound: 10}); ci != want {
+		t.Errorf("ComputeConfidenceInterval: got %v, want %v", ci, want)
+	}
+	// The noisy count of 13 is below the threshold of 20.
+	thresholded, err := newCount(t, n).ThresholdedResult(1e-5)
+	if err != nil {
+		t.Fatalf("ThresholdedResult: got error %v", err)
+	}
+	if thresholded != nil {
+		t.Errorf("ThresholdedResult: got %d, want nil", *thresholded)
+	}
+	if got, _ := n.AddNoiseFloat64(1, 1, 1, 1, 0); got != 0.5 {
+		t.Errorf("AddNoiseFloat64: got %f, want 0.5", got)
+	}
+}
+
+func TestRecordingNoise(t *testing.T) {
+	n := &RecordingNoise{Noise: ConstantNoise{Int64: 1}}
+	got, err := newCount(t, n).Result()
+	if err != nil {
+		t.Fatalf("Result: got error %v", err)
+	}
+	if got != 11 {
+		t.Errorf("Result: got %d, want 11", got)
+	}
+	// NewCount validates its parameters by adding noise to a placeholder value.
+	call := Call{Method: "AddNoiseInt64", L0Sensitivity: 2, LInfSensitivity: 1, Epsilon: 1}
+	if diff := cmp.Diff([]Call{call, call}, n.Calls); diff != "" {
+		t.Errorf("Calls: got diff (-want +got):\n%s", diff)
+	}
+
+	n = &RecordingNoise{}
+	if _, err := n.Threshold(3, 2, 1, 1e-5, 1e-6); err != nil {
+		t.Fatalf("Threshold: got error %v", err)
+	}
+	want := []Call{{Method: "Threshold", L0Sensitivity: 3, LInfSensitivity: 2, Epsilon: 1, Delta: 1e-5, ThresholdDelta: 1e-6}}
+	if diff := cmp.Diff(want, n.Calls); diff != "" {
+		t.Errorf("Calls: got diff (-want +got):\n%s", diff)
+	}
+}
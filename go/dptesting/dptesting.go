@@ -0,0 +1,222 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dptesting contains statistical tests to empirically check that a
+// mechanism is differentially private, by running it many times on a pair of
+// neighboring datasets and comparing the histograms of its outputs, like the
+// statistical tests of the C++ library. They can be used to check custom
+// mechanisms or noise in tests. CheckFloatingPointSafety also checks that a
+// noise is robust against floating point attacks.
+//
+// A passing test doesn't prove that a mechanism is differentially private, it
+// only means that no violation was detected with the given number of samples.
+// Conversely, each test has a small probability of failing for a mechanism
+// that is differentially private, which RunBallot reduces by taking the
+// majority of several independent votes.
+package dptesting
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// BuildHistogram returns the number of occurrences of each sample.
+func BuildHistogram[T comparable](samples []T) map[T]int64 {
+	histogram := make(map[T]int64)
+	for _, s := range samples {
+		histogram[s]++
+	}
+	return histogram
+}
+
+// approximateDPTestValue returns the estimate, from histograms of n samples
+// each, of the smallest δ such that the distribution of a is (ε, δ)-close to
+// the distribution of b in one direction, i.e. the sum over all outputs x of
+// max(0, P_a(x) - e^ε·P_b(x)).
+func approximateDPTestValue[T comparable](histogramA, histogramB map[T]int64, epsilon float64, n int) float64 {
+	var testValue float64
+	for x, countA := range histogramA {
+		testValue += math.Max(0, (float64(countA)-math.Exp(epsilon)*float64(histogramB[x]))/float64(n))
+	}
+	return testValue
+}
+
+// VerifyApproximateDP decides whether two sets of samples of equal size were
+// likely drawn from a pair of discrete distributions that satisfy (ε, δ)
+// differential privacy, i.e. such that the probability of any event under one
+// distribution is at most e^ε times its probability under the other
+// distribution plus δ, in both directions. The test passes if the δ estimated
+// from the samples is less than delta + deltaTolerance for both directions.
+//
+// Assuming that deltaTolerance > (m / n)^0.5 * (1 + e^(2ε)), where m is the
+// size of the support of the distributions and n the number of samples, the
+// probability of error is at most (1 + e^(2ε)) / (n * (deltaTolerance -
+// (m / n)^0.5 * (1 + e^(2ε)))^2).
+func VerifyApproximateDP[T comparable](samplesA, samplesB []T, epsilon, delta, deltaTolerance float64) (bool, error) {
+	if len(samplesA) != len(samplesB) || len(samplesA) == 0 {
+		return false, fmt.Errorf("VerifyApproximateDP: got %d and %d samples, want the same non-zero number of samples", len(samplesA), len(samplesB))
+	}
+	if err := checks.CheckEpsilon(epsilon); err != nil {
+		return false, fmt.Errorf("VerifyApproximateDP: %w", err)
+	}
+	if err := checks.CheckDelta(delta); err != nil {
+		return false, fmt.Errorf("VerifyApproximateDP: %w", err)
+	}
+	if !(deltaTolerance > 0 && deltaTolerance < 1) {
+		return false, fmt.Errorf("VerifyApproximateDP: deltaTolerance is %f, must be in (0, 1)", deltaTolerance)
+	}
+	histogramA, histogramB := BuildHistogram(samplesA), BuildHistogram(samplesB)
+	n := len(samplesA)
+	return approximateDPTestValue(histogramA, histogramB, epsilon, n) < delta+deltaTolerance &&
+		approximateDPTestValue(histogramB, histogramA, epsilon, n) < delta+deltaTolerance, nil
+}
+
+// VerifyCloseness decides whether two sets of samples of equal size were
+// likely drawn from similar discrete distributions, e.g. to check that a
+// mechanism follows a reference distribution. The distributions are
+// considered similar if the L2 distance between them is less than half of
+// l2Tolerance, and dissimilar if it is more than l2Tolerance. The probability
+// of error is at most 4014 / (n * l2Tolerance^2), where n is the number of
+// samples.
+func VerifyCloseness[T comparable](samplesA, samplesB []T, l2Tolerance float64) (bool, error) {
+	if len(samplesA) != len(samplesB) || len(samplesA) == 0 {
+		return false, fmt.Errorf("VerifyCloseness: got %d and %d samples, want the same non-zero number of samples", len(samplesA), len(samplesB))
+	}
+	if !(l2Tolerance > 0 && l2Tolerance < 1) {
+		return false, fmt.Errorf("VerifyCloseness: l2Tolerance is %f, must be in (0, 1)", l2Tolerance)
+	}
+	histogramA, histogramB := BuildHistogram(samplesA), BuildHistogram(samplesB)
+	var selfCollisionsA, selfCollisionsB, crossCollisions float64
+	for _, count := range histogramA {
+		selfCollisionsA += float64(count*(count-1)) / 2
+	}
+	for x, count := range histogramB {
+		selfCollisionsB += float64(count*(count-1)) / 2
+		crossCollisions += float64(histogramA[x] * count)
+	}
+	n := float64(len(samplesA))
+	testValue := selfCollisionsA + selfCollisionsB - (n-1)/n*crossCollisions
+	threshold := l2Tolerance * (n - 1) * l2Tolerance * n / 4
+	return testValue < threshold, nil
+}
+
+// RunBallot calls vote until a majority of numVotes votes is reached, and
+// returns the majority. It stops early as soon as the majority is known.
+func RunBallot(vote func() (bool, error), numVotes int) (bool, error) {
+	if numVotes <= 0 {
+		return false, fmt.Errorf("RunBallot: numVotes is %d, must be strictly positive", numVotes)
+	}
+	var accept, reject int
+	for accept <= numVotes/2 && reject <= numVotes/2 {
+		v, err := vote()
+		if err != nil {
+			return false, err
+		}
+		if v {
+			accept++
+		} else {
+			reject++
+		}
+	}
+	return accept > reject, nil
+}
+
+// Bucketize splits the interval [lower, upper) into numBuckets buckets of
+// equal size and returns the index of the bucket of sample, from 0 to
+// numBuckets-1. Samples outside of the interval are assigned to the first or
+// last bucket, e.g. to build histograms of continuous outputs.
+func Bucketize(sample, lower, upper float64, numBuckets int) int {
+	b := int(math.Floor((sample - lower) / (upper - lower) * float64(numBuckets)))
+	if b < 0 {
+		return 0
+	}
+	if b > numBuckets-1 {
+		return numBuckets - 1
+	}
+	return b
+}
+
+// Options contains the options of VerifyNeighbors.
+type Options struct {
+	Epsilon float64 // Privacy parameter ε claimed for the mechanism. Required.
+	Delta   float64 // Privacy parameter δ claimed for the mechanism. Defaults to 0.
+	// Slack allowed on δ to account for sampling errors, see
+	// VerifyApproximateDP. Required.
+	DeltaTolerance float64
+	// Number of samples of each mechanism per vote. Required.
+	NumSamples int
+	// Number of votes of the ballot, see RunBallot. Defaults to 1.
+	NumVotes int
+	// Outputs of the mechanisms are rounded to the nearest multiple of
+	// Granularity to build the histograms. Defaults to 1, e.g. for mechanisms
+	// with integer outputs.
+	Granularity float64
+}
+
+// VerifyNeighbors runs the mechanisms a and b, i.e. a mechanism run on two
+// neighboring datasets, opt.NumSamples times each and decides whether their
+// outputs satisfy (ε, δ) differential privacy, see VerifyApproximateDP. It
+// returns the majority of opt.NumVotes independent tests, or the first error
+// returned by a mechanism. For instance, for a count computed on datasets
+// whose counts differ by 1:
+//
+//	ok, err := dptesting.VerifyNeighbors(
+//		func() (float64, error) { return countOf(dataset) },
+//		func() (float64, error) { return countOf(neighbor) },
+//		&dptesting.Options{Epsilon: 1, DeltaTolerance: 0.05, NumSamples: 100000, NumVotes: 5})
+func VerifyNeighbors(a, b func() (float64, error), opt *Options) (bool, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+	if opt.NumSamples <= 0 {
+		return false, fmt.Errorf("VerifyNeighbors: NumSamples is %d, must be strictly positive", opt.NumSamples)
+	}
+	numVotes := opt.NumVotes
+	if numVotes == 0 {
+		numVotes = 1
+	}
+	granularity := opt.Granularity
+	if granularity == 0 {
+		granularity = 1
+	}
+	if !(granularity > 0) || math.IsInf(granularity, 0) {
+		return false, fmt.Errorf("VerifyNeighbors: Granularity is %f, must be strictly positive and finite", granularity)
+	}
+	sample := func(mechanism func() (float64, error)) ([]float64, error) {
+		samples := make([]float64, opt.NumSamples)
+		for i := range samples {
+			x, err := mechanism()
+			if err != nil {
+				return nil, fmt.Errorf("VerifyNeighbors: mechanism failed: %w", err)
+			}
+			samples[i] = math.Round(x/granularity) * granularity
+		}
+		return samples, nil
+	}
+	return RunBallot(func() (bool, error) {
+		samplesA, err := sample(a)
+		if err != nil {
+			return false, err
+		}
+		samplesB, err := sample(b)
+		if err != nil {
+			return false, err
+		}
+		return VerifyApproximateDP(samplesA, samplesB, opt.Epsilon, opt.Delta, opt.DeltaTolerance)
+	}, numVotes)
+}
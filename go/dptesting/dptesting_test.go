@@ -0,0 +1,132 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dptesting
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// laplaceCount returns a mechanism adding Laplace noise calibrated to ε = ln(3)
+// to the given count.
+func laplaceCount(count int64) func() (float64, error) {
+	return func() (float64, error) {
+		x, err := noise.Laplace().AddNoiseInt64(count, 1, 1, math.Log(3), 0)
+		return float64(x), err
+	}
+}
+
+func TestVerifyNeighbors(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		a, b    func() (float64, error)
+		epsilon float64
+		want    bool
+	}{
+		{"Laplace noise with its ε", laplaceCount(0), laplaceCount(1), math.Log(3), true},
+		{"Laplace noise with a smaller ε", laplaceCount(0), laplaceCount(1), 0.1, false},
+		{"no noise", func() (float64, error) { return 0, nil }, func() (float64, error) { return 1, nil }, 10, false},
+	} {
+		got, err := VerifyNeighbors(tc.a, tc.b, &Options{Epsilon: tc.epsilon, DeltaTolerance: 0.05, NumSamples: 50000, NumVotes: 3})
+		if err != nil {
+			t.Fatalf("With %s, VerifyNeighbors: got error %v", tc.desc, err)
+		}
+		if got != tc.want {
+			t.Errorf("With %s, VerifyNeighbors: got %t, want %t", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyNeighborsInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *Options
+	}{
+		{"nil options", nil},
+		{"no samples", &Options{Epsilon: 1, DeltaTolerance: 0.05}},
+		{"negative epsilon", &Options{Epsilon: -1, DeltaTolerance: 0.05, NumSamples: 10}},
+		{"zero delta tolerance", &Options{Epsilon: 1, NumSamples: 10}},
+		{"negative granularity", &Options{Epsilon: 1, DeltaTolerance: 0.05, NumSamples: 10, Granularity: -1}},
+	} {
+		if _, err := VerifyNeighbors(laplaceCount(0), laplaceCount(1), tc.opt); err == nil {
+			t.Errorf("With %s, VerifyNeighbors: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestVerifyCloseness(t *testing.T) {
+	sample := func(count int64) []int64 {
+		samples := make([]int64, 50000)
+		for i := range samples {
+			samples[i], _ = noise.Laplace().AddNoiseInt64(count, 1, 1, math.Log(3), 0)
+		}
+		return samples
+	}
+	if got, err := VerifyCloseness(sample(0), sample(0), 0.1); err != nil || !got {
+		t.Errorf("VerifyCloseness with the same distribution: got (%t, %v), want (true, nil)", got, err)
+	}
+	if got, err := VerifyCloseness(sample(0), sample(3), 0.1); err != nil || got {
+		t.Errorf("VerifyCloseness with different distributions: got (%t, %v), want (false, nil)", got, err)
+	}
+	if _, err := VerifyCloseness([]int64{1}, []int64{1, 2}, 0.1); err == nil {
+		t.Errorf("VerifyCloseness with different numbers of samples: got no error, want error")
+	}
+}
+
+func TestRunBallot(t *testing.T) {
+	// Votes alternate between true and false, starting with true.
+	var calls int
+	got, err := RunBallot(func() (bool, error) {
+		calls++
+		return calls%2 == 1, nil
+	}, 5)
+	if err != nil {
+		t.Fatalf("RunBallot: got error %v", err)
+	}
+	if !got || calls != 5 {
+		t.Errorf("RunBallot: got %t after %d votes, want true after 5 votes", got, calls)
+	}
+	// The ballot stops as soon as the majority is known.
+	calls = 0
+	got, _ = RunBallot(func() (bool, error) {
+		calls++
+		return false, nil
+	}, 5)
+	if got || calls != 3 {
+		t.Errorf("RunBallot: got %t after %d votes, want false after 3 votes", got, calls)
+	}
+}
+
+func TestBucketize(t *testing.T) {
+	for _, tc := range []struct {
+		sample float64
+		want   int
+	}{
+		{-1, 0},
+		{0, 0},
+		{0.25, 1},
+		{0.99, 3},
+		{1, 3},
+		{2, 3},
+	} {
+		if got := Bucketize(tc.sample, 0, 1, 4); got != tc.want {
+			t.Errorf("Bucketize(%f, 0, 1, 4): got %d, want %d", tc.sample, got, tc.want)
+		}
+	}
+}
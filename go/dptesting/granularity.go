@@ -0,0 +1,86 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dptesting
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// NoiseParameters are the parameters with which a noise.Noise is called.
+type NoiseParameters struct {
+	L0Sensitivity   int64
+	LInfSensitivity float64
+	Epsilon, Delta  float64
+}
+
+// CheckGranularity checks that n is robust against the floating point attack
+// described in noise.Granular at the given inputs: n must implement
+// noise.Granular with a granularity that is a power of two, and the outputs of
+// numSamples calls of AddNoiseFloat64 at each input must be multiples of the
+// granularity. The outputs then have no gaps near the inputs, i.e. the low
+// order bits of an output don't depend on the input. It returns an error
+// describing the first failure, or nil if all checks pass.
+func CheckGranularity(n noise.Noise, p NoiseParameters, inputs []float64, numSamples int) error {
+	g, ok := n.(noise.Granular)
+	if !ok {
+		return fmt.Errorf("%v noise doesn't implement noise.Granular", n)
+	}
+	granularity, err := g.Granularity(p.L0Sensitivity, p.LInfSensitivity, p.Epsilon, p.Delta)
+	if err != nil {
+		return fmt.Errorf("%v.Granularity(%+v): %w", n, p, err)
+	}
+	if exp := math.Log2(granularity); !(granularity > 0) || exp != math.Round(exp) {
+		return fmt.Errorf("%v.Granularity(%+v) = %e, want a power of two", n, p, granularity)
+	}
+	for _, x := range inputs {
+		for i := 0; i < numSamples; i++ {
+			got, err := n.AddNoiseFloat64(x, p.L0Sensitivity, p.LInfSensitivity, p.Epsilon, p.Delta)
+			if err != nil {
+				return fmt.Errorf("%v.AddNoiseFloat64(%e, %+v): %w", n, x, p, err)
+			}
+			if r := got / granularity; r != math.Round(r) || math.IsInf(r, 0) {
+				return fmt.Errorf("%v.AddNoiseFloat64(%e, %+v) = %e, want a multiple of the granularity %e", n, x, p, got, granularity)
+			}
+		}
+	}
+	return nil
+}
+
+// SensitiveInputs returns inputs at which the floating point representation of
+// noisy outputs is the most likely to reveal the input for the given L_∞
+// sensitivity: 0, values that aren't exactly representable in binary, powers
+// of two of various magnitudes, negative values, and the floating point
+// neighbors of all of them.
+func SensitiveInputs(lInfSensitivity float64) []float64 {
+	base := []float64{0, 1, 0.1, math.Pi, 1e-300, 1e6, math.Ldexp(1, -20), math.Ldexp(1, 40)}
+	var inputs []float64
+	for _, b := range base {
+		for _, x := range []float64{b * lInfSensitivity, -b * lInfSensitivity} {
+			inputs = append(inputs, x, math.Nextafter(x, math.Inf(-1)), math.Nextafter(x, math.Inf(1)))
+		}
+	}
+	return inputs
+}
+
+// CheckFloatingPointSafety runs CheckGranularity at SensitiveInputs, e.g. to
+// hold a custom noise.Noise to the same bar as the noise of the noise package.
+func CheckFloatingPointSafety(n noise.Noise, p NoiseParameters, numSamples int) error {
+	return CheckGranularity(n, p, SensitiveInputs(p.LInfSensitivity), numSamples)
+}
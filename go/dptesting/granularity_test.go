@@ -0,0 +1,70 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dptesting
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// floatNoise adds Laplace noise with floating point arithmetic, which is
+// vulnerable to the floating point attack.
+type floatNoise struct {
+	noise.Noise
+}
+
+func (floatNoise) AddNoiseFloat64(x float64, l0 int64, lInf, eps, _ float64) (float64, error) {
+	b := float64(l0) * lInf / eps
+	u := rand.Uniform() - 0.5
+	return x - b*math.Copysign(math.Log(1-2*math.Abs(u)), u), nil
+}
+
+func (floatNoise) Granularity(_ int64, _, _, _ float64) (float64, error) {
+	return math.Ldexp(1, -40), nil
+}
+
+func TestCheckFloatingPointSafety(t *testing.T) {
+	for _, tc := range []struct {
+		n     noise.Noise
+		delta float64
+	}{
+		{noise.Laplace(), 0},
+		{noise.Gaussian(), 1e-5},
+		{noise.DiscreteGaussian(), 1e-5},
+	} {
+		for _, lInf := range []float64{1e-6, 1, 1e6} {
+			p := NoiseParameters{L0Sensitivity: 1, LInfSensitivity: lInf, Epsilon: math.Log(3), Delta: tc.delta}
+			if err := CheckFloatingPointSafety(tc.n, p, 20); err != nil {
+				t.Errorf("CheckFloatingPointSafety(%v, %+v): got error %v", tc.n, p, err)
+			}
+		}
+	}
+}
+
+func TestCheckGranularityFails(t *testing.T) {
+	p := NoiseParameters{L0Sensitivity: 1, LInfSensitivity: 1, Epsilon: math.Log(3)}
+	// The laplace noise doesn't implement noise.Granular once embedded.
+	if err := CheckGranularity(struct{ noise.Noise }{noise.Laplace()}, p, []float64{0}, 1); err == nil {
+		t.Errorf("CheckGranularity with a noise that isn't granular: got no error, want error")
+	}
+	if err := CheckFloatingPointSafety(floatNoise{}, p, 20); err == nil {
+		t.Errorf("CheckFloatingPointSafety with floating point noise: got no error, want error")
+	}
+}
@@ -1,10 +1,22 @@
 module github.com/google/differential-privacy/go
 
-go 1.16
+go 1.18
 
 require (
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/google/go-cmp v0.5.5
 	github.com/grd/stat v0.0.0-20130623202159-138af3fd5012
 	gonum.org/v1/gonum v0.8.2
-)
\ No newline at end of file
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.26.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.0 // indirect
+	golang.org/x/exp v0.0.0-20190125153040-c74c464bbbf2 // indirect
+	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd // indirect
+	golang.org/x/text v0.3.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
+)
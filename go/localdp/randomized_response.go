@@ -0,0 +1,131 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package localdp contains local differential privacy mechanisms, which
+// randomize the value of each privacy unit before it is sent to an aggregator,
+// e.g. on the device of a user, together with the server-side estimators that
+// debias the aggregated randomized reports.
+//
+// Unlike the aggregations of package dpagg, the privacy guarantee of a local
+// mechanism holds for each report independently of the aggregator, so the
+// aggregator doesn't need to be trusted; the price is much larger errors.
+package localdp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// RandomizedResponse implements k-ary randomized response, also known as
+// generalized randomized response: a value in [0, NumValues) is reported
+// truthfully with probability p = e^ε/(e^ε+k-1), and otherwise replaced by one
+// of the k-1 other values chosen uniformly at random. Each report is
+// ε-locally differentially private.
+//
+// Randomized response has lower error than UnaryEncoding when the number of
+// values is small, roughly when k < 3·e^ε+2.
+type RandomizedResponse struct {
+	epsilon   float64
+	numValues int
+	// Probability of reporting the true value, and of reporting each other value.
+	p, q float64
+}
+
+// RandomizedResponseOptions contains the options necessary to initialize a
+// RandomizedResponse.
+type RandomizedResponseOptions struct {
+	Epsilon   float64 // Privacy parameter ε of each report. Required.
+	NumValues int     // Number k of possible values, which are in [0, k). Required; must be at least 2.
+}
+
+// NewRandomizedResponse returns a new RandomizedResponse.
+func NewRandomizedResponse(opt *RandomizedResponseOptions) (*RandomizedResponse, error) {
+	if opt == nil {
+		opt = &RandomizedResponseOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewRandomizedResponse: %w", err)
+	}
+	if opt.NumValues < 2 {
+		return nil, fmt.Errorf("NewRandomizedResponse: NumValues is %d, must be at least 2", opt.NumValues)
+	}
+	expEps := math.Exp(opt.Epsilon)
+	k := float64(opt.NumValues)
+	return &RandomizedResponse{
+		epsilon:   opt.Epsilon,
+		numValues: opt.NumValues,
+		p:         expEps / (expEps + k - 1),
+		q:         1 / (expEps + k - 1),
+	}, nil
+}
+
+// Randomize returns the randomized report of value, which must be in
+// [0, NumValues). It is meant to be called on the client.
+func (rr *RandomizedResponse) Randomize(value int) (int, error) {
+	if err := checkValue(value, rr.numValues); err != nil {
+		return 0, fmt.Errorf("RandomizedResponse: %w", err)
+	}
+	if rand.Uniform() < rr.p {
+		return value, nil
+	}
+	// Choose one of the other values uniformly at random.
+	other := int(rand.I63n(int64(rr.numValues - 1)))
+	if other >= value {
+		other++
+	}
+	return other, nil
+}
+
+// EstimateFrequencies returns unbiased estimates of the number of privacy
+// units with each value in [0, NumValues), given the randomized reports of all
+// privacy units. It is meant to be called on the server, and doesn't consume
+// any privacy budget.
+//
+// The estimates may be negative or fractional; they can be post-processed,
+// e.g. clamped to 0, at the cost of introducing bias.
+func (rr *RandomizedResponse) EstimateFrequencies(reports []int) ([]float64, error) {
+	counts := make([]int64, rr.numValues)
+	for _, r := range reports {
+		if err := checkValue(r, rr.numValues); err != nil {
+			return nil, fmt.Errorf("RandomizedResponse: invalid report: %w", err)
+		}
+		counts[r]++
+	}
+	return debias(counts, int64(len(reports)), rr.p, rr.q), nil
+}
+
+// checkValue returns an error if value isn't in [0, numValues).
+func checkValue(value, numValues int) error {
+	if value < 0 || value >= numValues {
+		return fmt.Errorf("value is %d, must be in [0, %d)", value, numValues)
+	}
+	return nil
+}
+
+// debias returns unbiased estimates of the true counts of each value, given
+// the counts of n randomized reports in which each value is reported with
+// probability p for privacy units having this value, and with probability q
+// otherwise: E[count] = p·trueCount + q·(n-trueCount).
+func debias(counts []int64, n int64, p, q float64) []float64 {
+	estimates := make([]float64, len(counts))
+	for i, c := range counts {
+		estimates[i] = (float64(c) - float64(n)*q) / (p - q)
+	}
+	return estimates
+}
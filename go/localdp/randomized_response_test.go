@@ -0,0 +1,117 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package localdp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewRandomizedResponseInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *RandomizedResponseOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &RandomizedResponseOptions{NumValues: 4}},
+		{"infinite epsilon", &RandomizedResponseOptions{Epsilon: math.Inf(1), NumValues: 4}},
+		{"single value", &RandomizedResponseOptions{Epsilon: math.Log(3), NumValues: 1}},
+	} {
+		if _, err := NewRandomizedResponse(tc.opts); err == nil {
+			t.Errorf("NewRandomizedResponse: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestRandomizedResponseRandomizeInvalidValue(t *testing.T) {
+	rr, err := NewRandomizedResponse(&RandomizedResponseOptions{Epsilon: math.Log(3), NumValues: 4})
+	if err != nil {
+		t.Fatalf("Couldn't initialize randomized response: %v", err)
+	}
+	for _, v := range []int{-1, 4} {
+		if _, err := rr.Randomize(v); err == nil {
+			t.Errorf("Randomize(%d): got no error, want error", v)
+		}
+	}
+	if _, err := rr.EstimateFrequencies([]int{0, 4}); err == nil {
+		t.Errorf("EstimateFrequencies: with an invalid report got no error, want error")
+	}
+}
+
+func TestRandomizedResponseDistribution(t *testing.T) {
+	const numValues, n = 4, 100000
+	rr, err := NewRandomizedResponse(&RandomizedResponseOptions{Epsilon: math.Log(3), NumValues: numValues})
+	if err != nil {
+		t.Fatalf("Couldn't initialize randomized response: %v", err)
+	}
+	counts := make([]int, numValues)
+	for i := 0; i < n; i++ {
+		r, err := rr.Randomize(1)
+		if err != nil {
+			t.Fatalf("Randomize: got err %v", err)
+		}
+		counts[r]++
+	}
+	// p = 3/6 and q = 1/6.
+	for v, c := range counts {
+		want := 1.0 / 6
+		if v == 1 {
+			want = 0.5
+		}
+		if got := float64(c) / n; math.Abs(got-want) > 0.01 {
+			t.Errorf("Randomize: value %d reported with frequency %f, want %f", v, got, want)
+		}
+	}
+}
+
+func TestRandomizedResponseEstimateFrequencies(t *testing.T) {
+	const numValues = 3
+	trueCounts := []int{20000, 10000, 0}
+	rr, err := NewRandomizedResponse(&RandomizedResponseOptions{Epsilon: 2, NumValues: numValues})
+	if err != nil {
+		t.Fatalf("Couldn't initialize randomized response: %v", err)
+	}
+	var reports []int
+	for v, c := range trueCounts {
+		for i := 0; i < c; i++ {
+			r, err := rr.Randomize(v)
+			if err != nil {
+				t.Fatalf("Randomize: got err %v", err)
+			}
+			reports = append(reports, r)
+		}
+	}
+	got, err := rr.EstimateFrequencies(reports)
+	if err != nil {
+		t.Fatalf("EstimateFrequencies: got err %v", err)
+	}
+	for v, want := range trueCounts {
+		// The standard deviation of each estimate is below 250.
+		if math.Abs(got[v]-float64(want)) > 1000 {
+			t.Errorf("EstimateFrequencies: got %f for value %d, want about %d", got[v], v, want)
+		}
+	}
+}
+
+func TestDebias(t *testing.T) {
+	// With p = 0.75 and q = 0.25, 10 privacy units with the value and 10 without
+	// give 0.75·10 + 0.25·10 = 10 reports in expectation.
+	got := debias([]int64{10, 5}, 20, 0.75, 0.25)
+	if want := []float64{10, 0}; got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("debias: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package localdp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// UnaryEncoding implements optimized unary encoding (OUE), from Wang et al.'s
+// "Locally Differentially Private Protocols for Frequency Estimation"
+// (https://www.usenix.org/system/files/conference/usenixsecurity17/sec17-wang-tianhao.pdf):
+// a value in [0, NumValues) is one-hot encoded as NumValues bits, then the bit
+// of the value is kept with probability 1/2, and every other bit is set with
+// probability 1/(e^ε+1). Each report is ε-locally differentially private.
+//
+// The error of unary encoding doesn't depend on the number of values, so it is
+// preferable to RandomizedResponse for large domains, at the cost of reports
+// of NumValues bits.
+type UnaryEncoding struct {
+	epsilon   float64
+	numValues int
+	// Probability of setting the bit of the true value, and each other bit.
+	p, q float64
+}
+
+// UnaryEncodingOptions contains the options necessary to initialize a
+// UnaryEncoding.
+type UnaryEncodingOptions struct {
+	Epsilon   float64 // Privacy parameter ε of each report. Required.
+	NumValues int     // Number of possible values, which are in [0, NumValues). Required.
+}
+
+// NewUnaryEncoding returns a new UnaryEncoding.
+func NewUnaryEncoding(opt *UnaryEncodingOptions) (*UnaryEncoding, error) {
+	if opt == nil {
+		opt = &UnaryEncodingOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewUnaryEncoding: %w", err)
+	}
+	if opt.NumValues < 1 {
+		return nil, fmt.Errorf("NewUnaryEncoding: NumValues is %d, must be strictly positive", opt.NumValues)
+	}
+	return &UnaryEncoding{
+		epsilon:   opt.Epsilon,
+		numValues: opt.NumValues,
+		p:         0.5,
+		q:         1 / (math.Exp(opt.Epsilon) + 1),
+	}, nil
+}
+
+// Randomize returns the randomized report of value, which must be in
+// [0, NumValues), as NumValues bits. It is meant to be called on the client.
+func (ue *UnaryEncoding) Randomize(value int) ([]bool, error) {
+	if err := checkValue(value, ue.numValues); err != nil {
+		return nil, fmt.Errorf("UnaryEncoding: %w", err)
+	}
+	report := make([]bool, ue.numValues)
+	for i := range report {
+		if i == value {
+			report[i] = rand.Boolean()
+		} else {
+			report[i] = rand.Uniform() < ue.q
+		}
+	}
+	return report, nil
+}
+
+// EstimateFrequencies returns unbiased estimates of the number of privacy
+// units with each value in [0, NumValues), given the randomized reports of all
+// privacy units. It is meant to be called on the server, and doesn't consume
+// any privacy budget.
+//
+// The estimates may be negative or fractional; they can be post-processed,
+// e.g. clamped to 0, at the cost of introducing bias.
+func (ue *UnaryEncoding) EstimateFrequencies(reports [][]bool) ([]float64, error) {
+	counts := make([]int64, ue.numValues)
+	for _, r := range reports {
+		if len(r) != ue.numValues {
+			return nil, fmt.Errorf("UnaryEncoding: invalid report of %d bits, want %d", len(r), ue.numValues)
+		}
+		for i, bit := range r {
+			if bit {
+				counts[i]++
+			}
+		}
+	}
+	return debias(counts, int64(len(reports)), ue.p, ue.q), nil
+}
@@ -0,0 +1,108 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package localdp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewUnaryEncodingInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts *UnaryEncodingOptions
+	}{
+		{"nil options", nil},
+		{"zero epsilon", &UnaryEncodingOptions{NumValues: 4}},
+		{"zero values", &UnaryEncodingOptions{Epsilon: math.Log(3)}},
+	} {
+		if _, err := NewUnaryEncoding(tc.opts); err == nil {
+			t.Errorf("NewUnaryEncoding: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestUnaryEncodingInvalidInputs(t *testing.T) {
+	ue, err := NewUnaryEncoding(&UnaryEncodingOptions{Epsilon: math.Log(3), NumValues: 4})
+	if err != nil {
+		t.Fatalf("Couldn't initialize unary encoding: %v", err)
+	}
+	if _, err := ue.Randomize(4); err == nil {
+		t.Errorf("Randomize(4): got no error, want error")
+	}
+	if _, err := ue.EstimateFrequencies([][]bool{{true, false}}); err == nil {
+		t.Errorf("EstimateFrequencies: with a report of the wrong length got no error, want error")
+	}
+}
+
+func TestUnaryEncodingDistribution(t *testing.T) {
+	const numValues, n = 3, 100000
+	ue, err := NewUnaryEncoding(&UnaryEncodingOptions{Epsilon: math.Log(3), NumValues: numValues})
+	if err != nil {
+		t.Fatalf("Couldn't initialize unary encoding: %v", err)
+	}
+	counts := make([]int, numValues)
+	for i := 0; i < n; i++ {
+		r, err := ue.Randomize(0)
+		if err != nil {
+			t.Fatalf("Randomize: got err %v", err)
+		}
+		for v, bit := range r {
+			if bit {
+				counts[v]++
+			}
+		}
+	}
+	// p = 1/2 and q = 1/4.
+	for v, c := range counts {
+		want := 0.25
+		if v == 0 {
+			want = 0.5
+		}
+		if got := float64(c) / n; math.Abs(got-want) > 0.01 {
+			t.Errorf("Randomize: bit %d set with frequency %f, want %f", v, got, want)
+		}
+	}
+}
+
+func TestUnaryEncodingEstimateFrequencies(t *testing.T) {
+	trueCounts := []int{20000, 10000, 0, 5000}
+	ue, err := NewUnaryEncoding(&UnaryEncodingOptions{Epsilon: 2, NumValues: len(trueCounts)})
+	if err != nil {
+		t.Fatalf("Couldn't initialize unary encoding: %v", err)
+	}
+	var reports [][]bool
+	for v, c := range trueCounts {
+		for i := 0; i < c; i++ {
+			r, err := ue.Randomize(v)
+			if err != nil {
+				t.Fatalf("Randomize: got err %v", err)
+			}
+			reports = append(reports, r)
+		}
+	}
+	got, err := ue.EstimateFrequencies(reports)
+	if err != nil {
+		t.Fatalf("EstimateFrequencies: got err %v", err)
+	}
+	for v, want := range trueCounts {
+		// The standard deviation of each estimate is below 300.
+		if math.Abs(got[v]-float64(want)) > 1200 {
+			t.Errorf("EstimateFrequencies: got %f for value %d, want about %d", got[v], v, want)
+		}
+	}
+}
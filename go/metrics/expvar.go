@@ -0,0 +1,95 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+// ExpvarRecorder is a Recorder publishing metrics with the expvar package, as
+// a map with the following keys, each mapping a label to a counter:
+//   - "aggregations_created": number of aggregations by type,
+//   - "epsilon_consumed" and "delta_consumed": budget by mechanism,
+//   - "values_clamped" and "values_total": values by aggregation type,
+//   - "partitions_dropped": dropped partitions by aggregation type.
+type ExpvarRecorder struct {
+	aggregationsCreated *expvar.Map
+	epsilonConsumed     *expvar.Map
+	deltaConsumed       *expvar.Map
+	valuesClamped       *expvar.Map
+	valuesTotal         *expvar.Map
+	partitionsDropped   *expvar.Map
+}
+
+var (
+	expvarMu        sync.Mutex
+	expvarRecorders = make(map[string]*ExpvarRecorder)
+)
+
+// NewExpvarRecorder returns an ExpvarRecorder publishing its metrics under the
+// given expvar name, e.g. "differential_privacy". Since expvar names can only
+// be published once, calling it again with the same name returns the same
+// ExpvarRecorder.
+func NewExpvarRecorder(name string) *ExpvarRecorder {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if r, ok := expvarRecorders[name]; ok {
+		return r
+	}
+	r := &ExpvarRecorder{
+		aggregationsCreated: new(expvar.Map),
+		epsilonConsumed:     new(expvar.Map),
+		deltaConsumed:       new(expvar.Map),
+		valuesClamped:       new(expvar.Map),
+		valuesTotal:         new(expvar.Map),
+		partitionsDropped:   new(expvar.Map),
+	}
+	m := expvar.NewMap(name)
+	m.Set("aggregations_created", r.aggregationsCreated)
+	m.Set("epsilon_consumed", r.epsilonConsumed)
+	m.Set("delta_consumed", r.deltaConsumed)
+	m.Set("values_clamped", r.valuesClamped)
+	m.Set("values_total", r.valuesTotal)
+	m.Set("partitions_dropped", r.partitionsDropped)
+	expvarRecorders[name] = r
+	return r
+}
+
+// AggregationCreated increments the number of aggregations of the given type.
+func (r *ExpvarRecorder) AggregationCreated(aggregation string) {
+	r.aggregationsCreated.Add(aggregation, 1)
+}
+
+// BudgetConsumed adds epsilon and delta to the budget consumed by mechanism.
+func (r *ExpvarRecorder) BudgetConsumed(mechanism string, epsilon, delta float64) {
+	r.epsilonConsumed.AddFloat(mechanism, epsilon)
+	r.deltaConsumed.AddFloat(mechanism, delta)
+}
+
+// ValuesClamped adds clamped and total to the values of the given aggregation
+// type.
+func (r *ExpvarRecorder) ValuesClamped(aggregation string, clamped, total int64) {
+	r.valuesClamped.Add(aggregation, clamped)
+	r.valuesTotal.Add(aggregation, total)
+}
+
+// PartitionsDropped adds count to the partitions dropped by the given
+// aggregation type.
+func (r *ExpvarRecorder) PartitionsDropped(aggregation string, count int64) {
+	r.partitionsDropped.Add(aggregation, count)
+}
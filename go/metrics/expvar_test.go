@@ -0,0 +1,57 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metrics
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestExpvarRecorder(t *testing.T) {
+	r := NewExpvarRecorder("test_expvar_recorder")
+	r.AggregationCreated("Count")
+	r.AggregationCreated("Count")
+	r.BudgetConsumed("laplace", 0.5, 0)
+	r.BudgetConsumed("laplace", 0.25, 0)
+	r.ValuesClamped("BoundedSum", 1, 4)
+	r.PartitionsDropped("PreAggSelectPartition", 2)
+	// Creating the recorder again doesn't publish the name twice.
+	if got := NewExpvarRecorder("test_expvar_recorder"); got != r {
+		t.Errorf("NewExpvarRecorder with the same name: got a different ExpvarRecorder")
+	}
+
+	m := expvar.Get("test_expvar_recorder").(*expvar.Map)
+	for _, tc := range []struct {
+		metric, label, want string
+	}{
+		{"aggregations_created", "Count", "2"},
+		{"epsilon_consumed", "laplace", "0.75"},
+		{"delta_consumed", "laplace", "0"},
+		{"values_clamped", "BoundedSum", "1"},
+		{"values_total", "BoundedSum", "4"},
+		{"partitions_dropped", "PreAggSelectPartition", "2"},
+	} {
+		v := m.Get(tc.metric).(*expvar.Map).Get(tc.label)
+		if v == nil {
+			t.Errorf("%s[%s]: got no value, want %s", tc.metric, tc.label, tc.want)
+			continue
+		}
+		if got := v.String(); got != tc.want {
+			t.Errorf("%s[%s]: got %s, want %s", tc.metric, tc.label, got, tc.want)
+		}
+	}
+}
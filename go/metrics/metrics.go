@@ -0,0 +1,120 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package metrics provides optional instrumentation hooks, so that operators
+// can monitor differentially private pipelines in dashboards, e.g. with
+// Prometheus or expvar.
+//
+// The aggregations of the dpagg package report to the Recorder set with
+// SetRecorder, which by default discards everything. Metrics only describe
+// the parameters of the aggregations and the post-processing of their noised
+// results, they don't reveal private data: e.g. the number of dropped
+// partitions is derived from the noised results.
+//
+// To export metrics to Prometheus, wire Funcs to Prometheus counters:
+//
+//	metrics.SetRecorder(metrics.Funcs{
+//		OnBudgetConsumed: func(mechanism string, epsilon, delta float64) {
+//			epsilonCounter.WithLabelValues(mechanism).Add(epsilon)
+//			deltaCounter.WithLabelValues(mechanism).Add(delta)
+//		},
+//	})
+package metrics
+
+import "sync/atomic"
+
+// Recorder receives the metrics reported by differentially private
+// aggregations. Implementations must be safe for concurrent use.
+type Recorder interface {
+	// AggregationCreated is called when an aggregation is initialized, with the
+	// name of its type, e.g. "Count". Aggregations built on top of others, e.g.
+	// "BoundedMean", also report the aggregations they use.
+	AggregationCreated(aggregation string)
+	// BudgetConsumed is called when a mechanism consumes privacy budget, e.g.
+	// when noise is added to a result, with the name of the mechanism, e.g.
+	// "laplace", "gaussian" or "thresholding".
+	BudgetConsumed(mechanism string, epsilon, delta float64)
+	// ValuesClamped is called when an aggregation releases a result, with the
+	// number of values it clamped to its bounds among its total number of
+	// values.
+	ValuesClamped(aggregation string, clamped, total int64)
+	// PartitionsDropped is called when an aggregation drops partitions because
+	// of thresholding or partition selection.
+	PartitionsDropped(aggregation string, count int64)
+}
+
+// Funcs is a Recorder calling the given functions; nil functions are ignored.
+// Its zero value discards all metrics.
+type Funcs struct {
+	OnAggregationCreated func(aggregation string)
+	OnBudgetConsumed     func(mechanism string, epsilon, delta float64)
+	OnValuesClamped      func(aggregation string, clamped, total int64)
+	OnPartitionsDropped  func(aggregation string, count int64)
+}
+
+// AggregationCreated calls f.OnAggregationCreated if it is set.
+func (f Funcs) AggregationCreated(aggregation string) {
+	if f.OnAggregationCreated != nil {
+		f.OnAggregationCreated(aggregation)
+	}
+}
+
+// BudgetConsumed calls f.OnBudgetConsumed if it is set.
+func (f Funcs) BudgetConsumed(mechanism string, epsilon, delta float64) {
+	if f.OnBudgetConsumed != nil {
+		f.OnBudgetConsumed(mechanism, epsilon, delta)
+	}
+}
+
+// ValuesClamped calls f.OnValuesClamped if it is set.
+func (f Funcs) ValuesClamped(aggregation string, clamped, total int64) {
+	if f.OnValuesClamped != nil {
+		f.OnValuesClamped(aggregation, clamped, total)
+	}
+}
+
+// PartitionsDropped calls f.OnPartitionsDropped if it is set.
+func (f Funcs) PartitionsDropped(aggregation string, count int64) {
+	if f.OnPartitionsDropped != nil {
+		f.OnPartitionsDropped(aggregation, count)
+	}
+}
+
+// recorderHolder wraps a Recorder so that atomic.Value always stores the same
+// concrete type.
+type recorderHolder struct {
+	r Recorder
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(recorderHolder{Funcs{}})
+}
+
+// SetRecorder sets the Recorder the aggregations report to. A nil Recorder
+// discards all metrics, which is the default.
+func SetRecorder(r Recorder) {
+	if r == nil {
+		r = Funcs{}
+	}
+	current.Store(recorderHolder{r})
+}
+
+// Default returns the Recorder set with SetRecorder.
+func Default() Recorder {
+	return current.Load().(recorderHolder).r
+}
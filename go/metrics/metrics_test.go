@@ -0,0 +1,58 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metrics
+
+import "testing"
+
+func TestFuncs(t *testing.T) {
+	var created []string
+	var epsilon, delta float64
+	r := Funcs{
+		OnAggregationCreated: func(aggregation string) { created = append(created, aggregation) },
+		OnBudgetConsumed: func(mechanism string, eps, del float64) {
+			epsilon += eps
+			delta += del
+		},
+	}
+	r.AggregationCreated("Count")
+	r.BudgetConsumed("laplace", 0.5, 0)
+	r.BudgetConsumed("gaussian", 1, 1e-5)
+	// Functions that aren't set are ignored.
+	r.ValuesClamped("BoundedSum", 1, 2)
+	r.PartitionsDropped("Count", 1)
+	if len(created) != 1 || created[0] != "Count" {
+		t.Errorf("AggregationCreated: got %v, want [Count]", created)
+	}
+	if epsilon != 1.5 || delta != 1e-5 {
+		t.Errorf("BudgetConsumed: got (%f, %g), want (1.5, 1e-5)", epsilon, delta)
+	}
+}
+
+func TestSetRecorder(t *testing.T) {
+	defer SetRecorder(nil)
+	var count int64
+	SetRecorder(Funcs{OnPartitionsDropped: func(_ string, c int64) { count += c }})
+	Default().PartitionsDropped("Count", 3)
+	if count != 3 {
+		t.Errorf("PartitionsDropped with the Recorder set: got %d dropped partitions, want 3", count)
+	}
+	SetRecorder(nil)
+	Default().PartitionsDropped("Count", 3)
+	if count != 3 {
+		t.Errorf("PartitionsDropped after SetRecorder(nil): got %d dropped partitions, want 3", count)
+	}
+}
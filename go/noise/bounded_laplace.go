@@ -0,0 +1,166 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// AddBoundedLaplaceNoiseFloat64 adds noise to x with the bounded Laplace
+// mechanism, whose output always lies in [lower, upper], so that the output
+// is ε-differentially private given the L_0 and L_∞ sensitivities of the
+// database. x is clamped to [lower, upper] first.
+//
+// The bounded Laplace mechanism samples Laplace noise conditioned on the
+// noised value lying in [lower, upper], see Holohan, Antonatos, Braghin and
+// Mac Aonghusa's "The Bounded Laplace Mechanism in Differential Privacy"
+// (https://arxiv.org/abs/1808.10410). Conditioning changes the normalization
+// of the distribution depending on x, so the scale of the noise must be larger
+// than l1Sensitivity/ε, see BoundedLaplaceScale. Clamping a sample of
+// AddNoiseFloat64 to [lower, upper] is also ε-differentially private, but
+// piles up probability mass on the bounds and biases the result.
+//
+// Like AddNoiseFloat64 with Laplace noise, the outputs are multiples of a power
+// of two granularity, and the conditioning is done by rejection sampling, so
+// the running time depends on x.
+func AddBoundedLaplaceNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, lower, upper float64) (float64, error) {
+	return addBoundedLaplaceFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, lower, upper)
+}
+
+// BoundedLaplaceScale returns the scale b of the Laplace noise used by
+// AddBoundedLaplaceNoiseFloat64 with the same arguments, i.e. the smallest
+// scale for which the bounded Laplace mechanism is ε-differentially private.
+// It is larger than the scale l1Sensitivity/ε of the unbounded Laplace
+// mechanism, even for wide bounds, since the normalization of a value at a
+// bound is about half the one of a value far from the bounds.
+func BoundedLaplaceScale(l0Sensitivity int64, lInfSensitivity, epsilon, lower, upper float64) (float64, error) {
+	g, err := newBoundedLaplaceGrid(l0Sensitivity, lInfSensitivity, epsilon, lower, upper)
+	if err != nil {
+		return 0, fmt.Errorf("BoundedLaplaceScale: %w", err)
+	}
+	return g.scale(epsilon), nil
+}
+
+func addBoundedLaplaceFloat64(r rand.Source, x float64, l0Sensitivity int64, lInfSensitivity, epsilon, lower, upper float64) (float64, error) {
+	g, err := newBoundedLaplaceGrid(l0Sensitivity, lInfSensitivity, epsilon, lower, upper)
+	if err != nil {
+		return 0, fmt.Errorf("AddBoundedLaplaceNoiseFloat64: %w", err)
+	}
+	lambda := g.granularity / g.scale(epsilon)
+	x = math.Min(math.Max(roundToMultipleOfPowerOfTwo(x, g.granularity), g.lower), g.upper)
+	for {
+		noised := x + float64(twoSidedGeometric(r, lambda))*g.granularity
+		if noised >= g.lower && noised <= g.upper {
+			return noised, nil
+		}
+	}
+}
+
+// boundedLaplaceGrid describes the outputs of the bounded Laplace mechanism:
+// the multiples of granularity in [lower, upper], which are steps+1 points.
+type boundedLaplaceGrid struct {
+	granularity  float64
+	lower, upper float64
+	steps        float64
+	// Maximum number of steps between the rounded values of two neighbouring
+	// databases.
+	sensitivitySteps float64
+}
+
+func newBoundedLaplaceGrid(l0Sensitivity int64, lInfSensitivity, epsilon, lower, upper float64) (boundedLaplaceGrid, error) {
+	if err := checks.CheckL0Sensitivity(l0Sensitivity); err != nil {
+		return boundedLaplaceGrid{}, err
+	}
+	if err := checks.CheckLInfSensitivity(lInfSensitivity); err != nil {
+		return boundedLaplaceGrid{}, err
+	}
+	if err := checks.CheckEpsilonStrict(epsilon); err != nil {
+		return boundedLaplaceGrid{}, err
+	}
+	if err := checks.CheckBoundsFloat64(lower, upper); err != nil {
+		return boundedLaplaceGrid{}, err
+	}
+	if err := checks.CheckBoundsNotEqual(lower, upper); err != nil {
+		return boundedLaplaceGrid{}, err
+	}
+	l1Sensitivity := lInfSensitivity * float64(l0Sensitivity)
+	granularity := laplaceGranularity(epsilon, l1Sensitivity)
+	g := boundedLaplaceGrid{
+		granularity: granularity,
+		lower:       math.Ceil(lower/granularity) * granularity,
+		upper:       math.Floor(upper/granularity) * granularity,
+	}
+	g.steps = math.Round((g.upper - g.lower) / granularity)
+	if !(g.steps >= 1) || g.steps > 1<<52 {
+		return boundedLaplaceGrid{}, fmt.Errorf("the width of [%f, %f] must be between 1 and 2^52 times the noise granularity %e", lower, upper, granularity)
+	}
+	// Rounding to the granularity can increase the distance between the values
+	// of two neighbouring databases by at most one step.
+	g.sensitivitySteps = math.Min(math.Ceil(l1Sensitivity/granularity)+1, g.steps)
+	return g, nil
+}
+
+// logNormalization returns the logarithm of the normalization of the
+// distribution of the mechanism for a value at the given number of steps from
+// the lower bound, up to an additive constant that only depends on λ:
+//
+//	log Σ_{i ∈ [0, steps]} exp(-λ·|i-position|)
+func (g boundedLaplaceGrid) logNormalization(lambda, position float64) float64 {
+	// Σ_{i ∈ [0, a]} q^i + Σ_{i ∈ [1, b]} q^i = (1 + q - q^(a+1) - q^(b+1)) / (1-q)
+	// with q = exp(-λ), a = position and b = steps-position.
+	return math.Log(-math.Expm1(-lambda*(position+1)) - math.Exp(-lambda)*math.Expm1(-lambda*(g.steps-position)))
+}
+
+// privacyLoss returns an upper bound on the privacy loss of the bounded
+// Laplace mechanism with scale b, i.e. on the log-ratio of the probabilities
+// of an output for two neighbouring databases.
+func (g boundedLaplaceGrid) privacyLoss(b float64) float64 {
+	lambda := g.granularity / b
+	// The ratio between the unnormalized probabilities is at most
+	// exp(λ·sensitivitySteps). The normalization is symmetric around the
+	// midpoint and increases towards it, so the largest ratio between the
+	// normalizations of two neighbouring databases is between a database at the
+	// lower bound and one as far from it as possible.
+	far := math.Min(g.sensitivitySteps, math.Floor(g.steps/2))
+	return lambda*g.sensitivitySteps + g.logNormalization(lambda, far) - g.logNormalization(lambda, 0)
+}
+
+// scale returns the smallest scale b such that the privacy loss of the bounded
+// Laplace mechanism is at most ε, up to a relative accuracy of 1e-12.
+func (g boundedLaplaceGrid) scale(epsilon float64) float64 {
+	// The privacy loss at the scale of the unbounded Laplace mechanism is at
+	// least ε, and tends to 0 as the scale grows. The binary search maintains
+	// privacyLoss(upper) <= ε.
+	lower := g.granularity * g.sensitivitySteps / epsilon
+	upper := 2 * lower
+	for g.privacyLoss(upper) > epsilon {
+		lower, upper = upper, 2*upper
+	}
+	for upper-lower > 1e-12*upper {
+		middle := lower*0.5 + upper*0.5
+		if g.privacyLoss(middle) > epsilon {
+			lower = middle
+		} else {
+			upper = middle
+		}
+	}
+	return upper
+}
@@ -0,0 +1,131 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+)
+
+// continuousBoundedLaplaceScale returns the scale of the continuous bounded Laplace mechanism,
+// i.e. the smallest b such that Δ/b + log(C(lower+Δ)/C(lower)) <= ε, where
+// C(x) = 1 - (exp(-(x-lower)/b) + exp(-(upper-x)/b))/2, see Holohan et al.
+func continuousBoundedLaplaceScale(l1Sensitivity, epsilon, lower, upper float64) float64 {
+	c := func(b, x float64) float64 {
+		return 1 - (math.Exp(-(x-lower)/b)+math.Exp(-(upper-x)/b))/2
+	}
+	loss := func(b float64) float64 {
+		return l1Sensitivity/b + math.Log(c(b, lower+l1Sensitivity)/c(b, lower))
+	}
+	lo, hi := l1Sensitivity/epsilon, 1e6*l1Sensitivity/epsilon
+	for hi-lo > 1e-12*hi {
+		if mid := (lo + hi) / 2; loss(mid) > epsilon {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
+
+func TestBoundedLaplaceScale(t *testing.T) {
+	for _, tc := range []struct {
+		l0           int64
+		lInf         float64
+		epsilon      float64
+		lower, upper float64
+	}{
+		{1, 1, 1, 0, 10},
+		{1, 1, 0.1, -50, 50},
+		{2, 0.5, 2, 0, 3},
+		{1, 1, 0.5, 0, 1000},
+	} {
+		b, err := BoundedLaplaceScale(tc.l0, tc.lInf, tc.epsilon, tc.lower, tc.upper)
+		if err != nil {
+			t.Fatalf("BoundedLaplaceScale(%+v): got error %v", tc, err)
+		}
+		l1 := float64(tc.l0) * tc.lInf
+		if b <= l1/tc.epsilon {
+			t.Errorf("BoundedLaplaceScale(%+v) = %f, want more than the unbounded scale %f", tc, b, l1/tc.epsilon)
+		}
+		g, err := newBoundedLaplaceGrid(tc.l0, tc.lInf, tc.epsilon, tc.lower, tc.upper)
+		if err != nil {
+			t.Fatalf("newBoundedLaplaceGrid(%+v): got error %v", tc, err)
+		}
+		if got := g.privacyLoss(b); got > tc.epsilon {
+			t.Errorf("BoundedLaplaceScale(%+v) = %f: got a privacy loss of %f, want at most %f", tc, b, got, tc.epsilon)
+		}
+		if got := g.privacyLoss(0.999 * b); got <= tc.epsilon {
+			t.Errorf("BoundedLaplaceScale(%+v) = %f is not the smallest scale: got a privacy loss of %f at a smaller scale", tc, b, got)
+		}
+		// The granularity is negligible, so the scale is the one of the continuous mechanism.
+		if want := continuousBoundedLaplaceScale(l1, tc.epsilon, tc.lower, tc.upper); math.Abs(b-want) > 1e-6*want {
+			t.Errorf("BoundedLaplaceScale(%+v) = %f, want %f", tc, b, want)
+		}
+	}
+}
+
+func TestAddBoundedLaplaceNoiseFloat64(t *testing.T) {
+	const lower, upper = 0.0, 10.0
+	const numSamples = 20000
+	// Values outside of the bounds are clamped.
+	for _, x := range []float64{5, -3, lower, upper, 12} {
+		var sum float64
+		for i := 0; i < numSamples; i++ {
+			noised, err := AddBoundedLaplaceNoiseFloat64(x, 1, 1, 1, lower, upper)
+			if err != nil {
+				t.Fatalf("AddBoundedLaplaceNoiseFloat64(%f): got error %v", x, err)
+			}
+			if noised < lower || noised > upper {
+				t.Fatalf("AddBoundedLaplaceNoiseFloat64(%f) = %f, want a value in [%f, %f]", x, noised, lower, upper)
+			}
+			sum += noised
+		}
+		// The distribution is symmetric around the midpoint. The standard deviation of the samples
+		// is at most the width of the bounds, so the mean is within 6 standard errors with high
+		// probability.
+		if mean := sum / numSamples; x == 5 && math.Abs(mean-5) > 6*(upper-lower)/math.Sqrt(numSamples) {
+			t.Errorf("AddBoundedLaplaceNoiseFloat64(%f): got a mean of %f, want 5", x, mean)
+		}
+	}
+}
+
+func TestBoundedLaplaceInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		l0           int64
+		lInf         float64
+		epsilon      float64
+		lower, upper float64
+	}{
+		{"zero l0", 0, 1, 1, 0, 10},
+		{"zero lInf", 1, 0, 1, 0, 10},
+		{"zero epsilon", 1, 1, 0, 0, 10},
+		{"infinite epsilon", 1, 1, math.Inf(1), 0, 10},
+		{"equal bounds", 1, 1, 1, 5, 5},
+		{"inverted bounds", 1, 1, 1, 10, 0},
+		{"infinite bound", 1, 1, 1, 0, math.Inf(1)},
+		{"bounds narrower than the granularity", 1, 1, 1, 0, 1e-20},
+	} {
+		if _, err := BoundedLaplaceScale(tc.l0, tc.lInf, tc.epsilon, tc.lower, tc.upper); err == nil {
+			t.Errorf("BoundedLaplaceScale with %s: got no error, want error", tc.desc)
+		}
+		if _, err := AddBoundedLaplaceNoiseFloat64(0, tc.l0, tc.lInf, tc.epsilon, tc.lower, tc.upper); err == nil {
+			t.Errorf("AddBoundedLaplaceNoiseFloat64 with %s: got no error, want error", tc.desc)
+		}
+	}
+}
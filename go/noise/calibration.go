@@ -0,0 +1,197 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+)
+
+// This file contains the inverse of the noise calibration: given a target
+// accuracy, i.e. a maximum error that the noise may exceed with probability at
+// most alpha, and the sensitivities, the helpers return the smallest privacy
+// budget, or standard deviation, that achieves it. This is the error of the
+// confidence intervals computed by ComputeConfidenceIntervalFloat64. It also
+// contains the noise scale calibrated to a privacy budget, and conversely the
+// privacy guarantee implied by an explicit noise scale, e.g. to build custom
+// mechanisms.
+
+// LaplaceScale returns the scale λ = l0·lInf/ε of the Laplace noise added by
+// Laplace calibrated to ε and the given sensitivities. Its standard deviation
+// is √2·λ.
+func LaplaceScale(l0Sensitivity int64, lInfSensitivity, epsilon float64) (float64, error) {
+	if err := checkArgsLaplace(l0Sensitivity, lInfSensitivity, epsilon, 0); err != nil {
+		return 0, fmt.Errorf("LaplaceScale: %w", err)
+	}
+	return laplaceLambda(l0Sensitivity, lInfSensitivity, epsilon), nil
+}
+
+// GaussianSigma returns the standard deviation σ of the Gaussian noise added
+// by Gaussian calibrated to (ε,δ) and the given sensitivities, using the
+// analytic Gaussian mechanism of Balle and Wang
+// (https://arxiv.org/abs/1805.06530). Unlike SigmaForGaussian, it checks its
+// arguments.
+//
+// The result exceeds the tight standard deviation by a factor of at most
+// 1+gaussianSigmaAccuracy, i.e. 1.001.
+func GaussianSigma(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	if err := checkArgsGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
+		return 0, fmt.Errorf("GaussianSigma: %w", err)
+	}
+	return SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta), nil
+}
+
+// GaussianDeltaForSigma returns the smallest δ such that Gaussian noise of
+// standard deviation sigma is (ε,δ)-differentially private for the given
+// sensitivities. It is the inverse of GaussianSigma in δ, like
+// GaussianEpsilonForSigma is in ε.
+func GaussianDeltaForSigma(l0Sensitivity int64, lInfSensitivity, sigma, epsilon float64) (float64, error) {
+	if err := checkArgsForScale(l0Sensitivity, lInfSensitivity, sigma); err != nil {
+		return 0, fmt.Errorf("GaussianDeltaForSigma: %w", err)
+	}
+	if err := checks.CheckEpsilon(epsilon); err != nil {
+		return 0, fmt.Errorf("GaussianDeltaForSigma: %w", err)
+	}
+	return deltaForGaussian(sigma, l0Sensitivity, lInfSensitivity, epsilon), nil
+}
+
+// LaplaceEpsilonForError returns the smallest ε such that Laplace noise
+// calibrated to ε and the given sensitivities exceeds maxError in absolute
+// value with probability at most alpha.
+func LaplaceEpsilonForError(l0Sensitivity int64, lInfSensitivity, maxError, alpha float64) (float64, error) {
+	if err := checkArgsForError(l0Sensitivity, lInfSensitivity, maxError, alpha); err != nil {
+		return 0, fmt.Errorf("LaplaceEpsilonForError: %w", err)
+	}
+	// The error is lambda*log(1/alpha) with lambda = l1Sensitivity/ε, see
+	// computeConfidenceIntervalLaplace.
+	l1Sensitivity := lInfSensitivity * float64(l0Sensitivity)
+	return l1Sensitivity * math.Log(1/alpha) / maxError, nil
+}
+
+// GaussianSigmaForError returns the largest standard deviation σ such that
+// Gaussian noise of standard deviation σ exceeds maxError in absolute value
+// with probability at most alpha.
+func GaussianSigmaForError(maxError, alpha float64) (float64, error) {
+	if err := checkArgsForError(1, 1, maxError, alpha); err != nil {
+		return 0, fmt.Errorf("GaussianSigmaForError: %w", err)
+	}
+	// The error is -inverseCDFGaussian(sigma, alpha/2), see
+	// computeConfidenceIntervalGaussian.
+	return maxError / (math.Sqrt2 * math.Erfcinv(alpha)), nil
+}
+
+// GaussianEpsilonForError returns the smallest ε such that Gaussian noise
+// calibrated to (ε,δ) and the given sensitivities, see SigmaForGaussian,
+// exceeds maxError in absolute value with probability at most alpha. It
+// returns 0 if the noise calibrated to ε = 0 is already accurate enough.
+func GaussianEpsilonForError(l0Sensitivity int64, lInfSensitivity, delta, maxError, alpha float64) (float64, error) {
+	if err := checkArgsForError(l0Sensitivity, lInfSensitivity, maxError, alpha); err != nil {
+		return 0, fmt.Errorf("GaussianEpsilonForError: %w", err)
+	}
+	if err := checks.CheckDeltaStrict(delta); err != nil {
+		return 0, fmt.Errorf("GaussianEpsilonForError: %w", err)
+	}
+	sigma, err := GaussianSigmaForError(maxError, alpha)
+	if err != nil {
+		return 0, err
+	}
+	// SigmaForGaussian may exceed the tight standard deviation by a factor of
+	// 1+gaussianSigmaAccuracy, so the search targets a slightly smaller one.
+	sigma /= 1 + gaussianSigmaAccuracy
+	return epsilonForGaussianSigma(l0Sensitivity, lInfSensitivity, sigma, delta), nil
+}
+
+// LaplaceEpsilonForScale returns the ε implied by Laplace noise of scale b
+// for the given sensitivities, i.e. the ε such that an aggregation calibrated
+// to ε adds Laplace noise of scale b.
+func LaplaceEpsilonForScale(l0Sensitivity int64, lInfSensitivity, b float64) (float64, error) {
+	if err := checkArgsForScale(l0Sensitivity, lInfSensitivity, b); err != nil {
+		return 0, fmt.Errorf("LaplaceEpsilonForScale: %w", err)
+	}
+	return lInfSensitivity * float64(l0Sensitivity) / b, nil
+}
+
+// GaussianEpsilonForSigma returns the smallest ε such that Gaussian noise of
+// standard deviation sigma is (ε,δ)-differentially private for the given
+// sensitivities. It returns 0 if sigma already achieves (0,δ)-differential
+// privacy.
+//
+// The guarantee is tight for noise of standard deviation sigma. An aggregation
+// calibrated to the returned (ε,δ), see SigmaForGaussian, adds noise whose
+// standard deviation may exceed sigma by a factor of at most
+// 1+gaussianSigmaAccuracy.
+func GaussianEpsilonForSigma(l0Sensitivity int64, lInfSensitivity, sigma, delta float64) (float64, error) {
+	if err := checkArgsForScale(l0Sensitivity, lInfSensitivity, sigma); err != nil {
+		return 0, fmt.Errorf("GaussianEpsilonForSigma: %w", err)
+	}
+	if err := checks.CheckDeltaStrict(delta); err != nil {
+		return 0, fmt.Errorf("GaussianEpsilonForSigma: %w", err)
+	}
+	return epsilonForGaussianSigma(l0Sensitivity, lInfSensitivity, sigma, delta), nil
+}
+
+// epsilonForGaussianSigma returns the smallest ε, up to a relative accuracy
+// of 1e-12, such that deltaForGaussian(sigma, l0Sensitivity, lInfSensitivity, ε) <= δ.
+func epsilonForGaussianSigma(l0Sensitivity int64, lInfSensitivity, sigma, delta float64) float64 {
+	if deltaForGaussian(sigma, l0Sensitivity, lInfSensitivity, 0) <= delta {
+		return 0
+	}
+	// deltaForGaussian is decreasing in ε. The binary search maintains
+	// deltaForGaussian(sigma, l0Sensitivity, lInfSensitivity, upper) <= δ, so
+	// that the standard deviation calibrated to (upper, δ) is at most sigma.
+	lower, upper := 0.0, 1.0
+	for deltaForGaussian(sigma, l0Sensitivity, lInfSensitivity, upper) > delta {
+		lower, upper = upper, 2*upper
+	}
+	for upper-lower > 1e-12*upper {
+		middle := lower*0.5 + upper*0.5
+		if deltaForGaussian(sigma, l0Sensitivity, lInfSensitivity, middle) > delta {
+			lower = middle
+		} else {
+			upper = middle
+		}
+	}
+	return upper
+}
+
+func checkArgsForError(l0Sensitivity int64, lInfSensitivity, maxError, alpha float64) error {
+	if err := checks.CheckL0Sensitivity(l0Sensitivity); err != nil {
+		return err
+	}
+	if err := checks.CheckLInfSensitivity(lInfSensitivity); err != nil {
+		return err
+	}
+	if !(maxError > 0) || math.IsInf(maxError, 0) {
+		return fmt.Errorf("maxError is %f, must be strictly positive and finite", maxError)
+	}
+	return checks.CheckAlpha(alpha)
+}
+
+func checkArgsForScale(l0Sensitivity int64, lInfSensitivity, scale float64) error {
+	if err := checks.CheckL0Sensitivity(l0Sensitivity); err != nil {
+		return err
+	}
+	if err := checks.CheckLInfSensitivity(lInfSensitivity); err != nil {
+		return err
+	}
+	if !(scale > 0) || math.IsInf(scale, 0) {
+		return fmt.Errorf("noise scale is %f, must be strictly positive and finite", scale)
+	}
+	return nil
+}
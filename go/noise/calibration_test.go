@@ -0,0 +1,209 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+)
+
+// Tests that the budgets returned by the calibration helpers yield confidence intervals whose
+// half-width is the target error.
+func TestEpsilonForError(t *testing.T) {
+	for _, tc := range []struct {
+		l0       int64
+		lInf     float64
+		maxError float64
+		alpha    float64
+	}{
+		{1, 1, 10, 0.05},
+		{5, 2.5, 100, 0.01},
+		{3, 0.1, 0.5, 0.3},
+	} {
+		eps, err := LaplaceEpsilonForError(tc.l0, tc.lInf, tc.maxError, tc.alpha)
+		if err != nil {
+			t.Fatalf("LaplaceEpsilonForError(%+v): got error %v", tc, err)
+		}
+		ci, err := Laplace().ComputeConfidenceIntervalFloat64(0, tc.l0, tc.lInf, eps, 0, tc.alpha)
+		if err != nil {
+			t.Fatalf("With Laplace noise, couldn't compute confidence interval: %v", err)
+		}
+		if got := ci.UpperBound; math.Abs(got-tc.maxError) > 1e-9*tc.maxError {
+			t.Errorf("LaplaceEpsilonForError(%+v) = %f: got an error of %f, want %f", tc, eps, got, tc.maxError)
+		}
+
+		sigma, err := GaussianSigmaForError(tc.maxError, tc.alpha)
+		if err != nil {
+			t.Fatalf("GaussianSigmaForError(%+v): got error %v", tc, err)
+		}
+		if got := -inverseCDFGaussian(sigma, tc.alpha/2); math.Abs(got-tc.maxError) > 1e-9*tc.maxError {
+			t.Errorf("GaussianSigmaForError(%+v) = %f: got an error of %f, want %f", tc, sigma, got, tc.maxError)
+		}
+
+		eps, err = GaussianEpsilonForError(tc.l0, tc.lInf, 1e-5, tc.maxError, tc.alpha)
+		if err != nil {
+			t.Fatalf("GaussianEpsilonForError(%+v): got error %v", tc, err)
+		}
+		ci, err = Gaussian().ComputeConfidenceIntervalFloat64(0, tc.l0, tc.lInf, eps, 1e-5, tc.alpha)
+		if err != nil {
+			t.Fatalf("With Gaussian noise, couldn't compute confidence interval: %v", err)
+		}
+		// The error is at most the target, and close to it since ε is the smallest one.
+		if got := ci.UpperBound; got > tc.maxError || got < 0.99*tc.maxError {
+			t.Errorf("GaussianEpsilonForError(%+v) = %f: got an error of %f, want at most and close to %f", tc, eps, got, tc.maxError)
+		}
+	}
+}
+
+func TestEpsilonForErrorInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		desc           string
+		l0             int64
+		lInf, maxError float64
+		alpha, delta   float64
+	}{
+		{"zero l0", 0, 1, 1, 0.05, 1e-5},
+		{"zero lInf", 1, 0, 1, 0.05, 1e-5},
+		{"zero maxError", 1, 1, 0, 0.05, 1e-5},
+		{"infinite maxError", 1, 1, math.Inf(1), 0.05, 1e-5},
+		{"alpha of 1", 1, 1, 1, 1, 1e-5},
+	} {
+		if _, err := LaplaceEpsilonForError(tc.l0, tc.lInf, tc.maxError, tc.alpha); err == nil {
+			t.Errorf("LaplaceEpsilonForError with %s: got no error, want error", tc.desc)
+		}
+		if _, err := GaussianEpsilonForError(tc.l0, tc.lInf, tc.delta, tc.maxError, tc.alpha); err == nil {
+			t.Errorf("GaussianEpsilonForError with %s: got no error, want error", tc.desc)
+		}
+	}
+	if _, err := GaussianEpsilonForError(1, 1, 0, 1, 0.05); err == nil {
+		t.Errorf("GaussianEpsilonForError with zero delta: got no error, want error")
+	}
+}
+
+// Tests that aggregations calibrated to the budgets implied by an explicit noise scale add noise
+// of that scale.
+func TestEpsilonForScale(t *testing.T) {
+	for _, tc := range []struct {
+		l0    int64
+		lInf  float64
+		scale float64
+	}{
+		{1, 1, 10},
+		{5, 2.5, 3},
+		{3, 0.1, 0.05},
+	} {
+		eps, err := LaplaceEpsilonForScale(tc.l0, tc.lInf, tc.scale)
+		if err != nil {
+			t.Fatalf("LaplaceEpsilonForScale(%+v): got error %v", tc, err)
+		}
+		if got := float64(tc.l0) * tc.lInf / eps; math.Abs(got-tc.scale) > 1e-9*tc.scale {
+			t.Errorf("LaplaceEpsilonForScale(%+v) = %f: got a scale of %f, want %f", tc, eps, got, tc.scale)
+		}
+
+		eps, err = GaussianEpsilonForSigma(tc.l0, tc.lInf, tc.scale, 1e-5)
+		if err != nil {
+			t.Fatalf("GaussianEpsilonForSigma(%+v): got error %v", tc, err)
+		}
+		if got := deltaForGaussian(tc.scale, tc.l0, tc.lInf, eps); got > 1e-5 {
+			t.Errorf("GaussianEpsilonForSigma(%+v) = %f: got a delta of %e, want at most 1e-5", tc, eps, got)
+		}
+		got := SigmaForGaussian(tc.l0, tc.lInf, eps, 1e-5)
+		if math.Abs(got-tc.scale) > (gaussianSigmaAccuracy+1e-9)*tc.scale {
+			t.Errorf("GaussianEpsilonForSigma(%+v) = %f: got a standard deviation of %f, want %f", tc, eps, got, tc.scale)
+		}
+	}
+}
+
+func TestEpsilonForScaleInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		l0          int64
+		lInf, scale float64
+		delta       float64
+	}{
+		{"zero l0", 0, 1, 1, 1e-5},
+		{"zero lInf", 1, 0, 1, 1e-5},
+		{"zero scale", 1, 1, 0, 1e-5},
+		{"infinite scale", 1, 1, math.Inf(1), 1e-5},
+		{"NaN scale", 1, 1, math.NaN(), 1e-5},
+	} {
+		if _, err := LaplaceEpsilonForScale(tc.l0, tc.lInf, tc.scale); err == nil {
+			t.Errorf("LaplaceEpsilonForScale with %s: got no error, want error", tc.desc)
+		}
+		if _, err := GaussianEpsilonForSigma(tc.l0, tc.lInf, tc.scale, tc.delta); err == nil {
+			t.Errorf("GaussianEpsilonForSigma with %s: got no error, want error", tc.desc)
+		}
+	}
+	if _, err := GaussianEpsilonForSigma(1, 1, 1, 0); err == nil {
+		t.Errorf("GaussianEpsilonForSigma with zero delta: got no error, want error")
+	}
+}
+
+func TestScaleForBudget(t *testing.T) {
+	for _, tc := range []struct {
+		l0      int64
+		lInf    float64
+		epsilon float64
+	}{
+		{1, 1, ln3},
+		{5, 2.5, 0.1},
+		{3, 0.1, 2},
+	} {
+		b, err := LaplaceScale(tc.l0, tc.lInf, tc.epsilon)
+		if err != nil {
+			t.Fatalf("LaplaceScale(%+v): got error %v", tc, err)
+		}
+		if eps, err := LaplaceEpsilonForScale(tc.l0, tc.lInf, b); err != nil || math.Abs(eps-tc.epsilon) > 1e-9*tc.epsilon {
+			t.Errorf("LaplaceEpsilonForScale(LaplaceScale(%+v) = %f): got %f, err %v, want %f", tc, b, eps, err, tc.epsilon)
+		}
+
+		sigma, err := GaussianSigma(tc.l0, tc.lInf, tc.epsilon, 1e-5)
+		if err != nil {
+			t.Fatalf("GaussianSigma(%+v): got error %v", tc, err)
+		}
+		if want := SigmaForGaussian(tc.l0, tc.lInf, tc.epsilon, 1e-5); sigma != want {
+			t.Errorf("GaussianSigma(%+v): got %f, want %f", tc, sigma, want)
+		}
+		// σ is at least the tight standard deviation, so its δ is at most 1e-5,
+		// and close to it.
+		delta, err := GaussianDeltaForSigma(tc.l0, tc.lInf, sigma, tc.epsilon)
+		if err != nil {
+			t.Fatalf("GaussianDeltaForSigma(%+v): got error %v", tc, err)
+		}
+		if delta > 1e-5 || delta < 0.9e-5 {
+			t.Errorf("GaussianDeltaForSigma(GaussianSigma(%+v) = %f): got %e, want at most and close to 1e-5", tc, sigma, delta)
+		}
+	}
+}
+
+func TestScaleForBudgetInvalidArguments(t *testing.T) {
+	if _, err := LaplaceScale(1, 1, 0); err == nil {
+		t.Errorf("LaplaceScale with zero epsilon: got no error, want error")
+	}
+	if _, err := LaplaceScale(0, 1, 1); err == nil {
+		t.Errorf("LaplaceScale with zero l0: got no error, want error")
+	}
+	if _, err := GaussianSigma(1, 1, 1, 0); err == nil {
+		t.Errorf("GaussianSigma with zero delta: got no error, want error")
+	}
+	if _, err := GaussianDeltaForSigma(1, 1, 0, 1); err == nil {
+		t.Errorf("GaussianDeltaForSigma with zero sigma: got no error, want error")
+	}
+	if _, err := GaussianDeltaForSigma(1, 1, 1, -1); err == nil {
+		t.Errorf("GaussianDeltaForSigma with negative epsilon: got no error, want error")
+	}
+}
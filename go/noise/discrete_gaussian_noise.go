@@ -0,0 +1,272 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+type discreteGaussian struct{}
+
+// DiscreteGaussian returns a Noise instance that adds discrete Gaussian noise
+// to its input.
+//
+// Samples are drawn with the rejection sampler of Canonne, Kamath and Steinke's
+// "The Discrete Gaussian for Differential Privacy"
+// (https://arxiv.org/abs/2004.00010), which only relies on exact rational
+// arithmetic and uniformly random bits. As a result, AddNoiseInt64 is not
+// subject to the floating-point artifacts that can leak information about the
+// raw value.
+//
+// The scale σ of the noise is calibrated like that of Gaussian, i.e. using the
+// L_2 sensitivity of the input. For integer valued inputs, the discrete Gaussian
+// with parameter σ offers the same ρ-zCDP guarantee as the continuous Gaussian
+// with standard deviation σ, so it composes in the same way.
+//
+// Random numbers are drawn from rand.Default(). Use WithSource to draw them
+// from another rand.Source, e.g. a seeded one for reproducible simulations.
+func DiscreteGaussian() Noise {
+	return discreteGaussian{}
+}
+
+// AddNoiseFloat64 adds discrete Gaussian noise to the specified float64, so
+// that the output is (ε,δ)-differentially private.
+//
+// x is rounded to a multiple of a power of two granularity and the noise is
+// drawn from a discrete Gaussian over the multiples of that granularity. The
+// L_∞ sensitivity is increased by the granularity to account for the rounding.
+func (n discreteGaussian) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (discreteGaussian) addNoiseFloat64(r rand.Source, x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	if err := checkArgsGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
+		return 0, err
+	}
+
+	granularity := discreteGaussianGranularity(l0Sensitivity, lInfSensitivity, epsilon, delta)
+	sigma := SigmaForGaussian(l0Sensitivity, lInfSensitivity+granularity, epsilon, delta)
+	// Dividing by a power of two is exact.
+	sample := sampleDiscreteGaussian(r, sigma/granularity)
+	return roundToMultipleOfPowerOfTwo(x, granularity) + float64(sample)*granularity, nil
+}
+
+// AddNoiseInt64 adds discrete Gaussian noise to the specified int64, so that
+// the output is (ε,δ)-differentially private.
+func (n discreteGaussian) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (discreteGaussian) addNoiseInt64(r rand.Source, x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	if err := checkArgsGaussian(l0Sensitivity, float64(lInfSensitivity), epsilon, delta); err != nil {
+		return 0, err
+	}
+
+	sigma := SigmaForGaussian(l0Sensitivity, float64(lInfSensitivity), epsilon, delta)
+	return x + sampleDiscreteGaussian(r, sigma), nil
+}
+
+// Threshold returns the smallest threshold k to use in a differentially private
+// histogram with added discrete Gaussian noise.
+//
+// The threshold is derived from the one of Gaussian, using that the tails of
+// the discrete Gaussian are bounded by the tails of the continuous Gaussian
+// shifted by one unit (Proposition 25 of https://arxiv.org/abs/2004.00010).
+func (discreteGaussian) Threshold(l0Sensitivity int64, lInfSensitivity, epsilon, noiseDelta, thresholdDelta float64) (float64, error) {
+	k, err := gaussian{}.Threshold(l0Sensitivity, lInfSensitivity, epsilon, noiseDelta, thresholdDelta)
+	if err != nil {
+		return 0, err
+	}
+	return k + 1, nil
+}
+
+// DeltaForThreshold is the inverse operation of Threshold: given the
+// parameters and a threshold, it returns the delta induced by thresholding.
+func (discreteGaussian) DeltaForThreshold(l0Sensitivity int64, lInfSensitivity, epsilon, delta, threshold float64) (float64, error) {
+	return gaussian{}.DeltaForThreshold(l0Sensitivity, lInfSensitivity, epsilon, delta, threshold-1)
+}
+
+// ComputeConfidenceIntervalInt64 computes a confidence interval that contains the raw integer value x from which int64 noisedX
+// is computed with a probability greater or equal to 1 - alpha based on the specified discrete Gaussian noise parameters.
+func (discreteGaussian) ComputeConfidenceIntervalInt64(noisedX, l0Sensitivity, lInfSensitivity int64, epsilon, delta, alpha float64) (ConfidenceInterval, error) {
+	confInt, err := gaussian{}.ComputeConfidenceIntervalInt64(noisedX, l0Sensitivity, lInfSensitivity, epsilon, delta, alpha)
+	if err != nil {
+		return ConfidenceInterval{}, err
+	}
+	// Widen the interval by one on each side, following the tail bound used in Threshold.
+	lowerBound := nextSmallerFloat64(int64(confInt.LowerBound) - 1)
+	upperBound := nextLargerFloat64(int64(confInt.UpperBound) + 1)
+	return ConfidenceInterval{LowerBound: lowerBound, UpperBound: upperBound}, nil
+}
+
+// ComputeConfidenceIntervalFloat64 computes a confidence interval that contains the raw value x from which float64
+// noisedX is computed with a probability greater or equal to 1 - alpha based on the specified discrete Gaussian noise parameters.
+func (discreteGaussian) ComputeConfidenceIntervalFloat64(noisedX float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta, alpha float64) (ConfidenceInterval, error) {
+	err := checkArgsConfidenceIntervalGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta, alpha)
+	if err != nil {
+		return ConfidenceInterval{}, err
+	}
+	granularity := discreteGaussianGranularity(l0Sensitivity, lInfSensitivity, epsilon, delta)
+	sigma := SigmaForGaussian(l0Sensitivity, lInfSensitivity+granularity, epsilon, delta)
+	// The noise is a discrete Gaussian in units of granularity, so its tails are
+	// bounded by the ones of a continuous Gaussian shifted by one granularity.
+	confInt := computeConfidenceIntervalGaussian(noisedX, sigma, alpha)
+	return ConfidenceInterval{LowerBound: confInt.LowerBound - granularity, UpperBound: confInt.UpperBound + granularity}, nil
+}
+
+// Granularity returns the granularity of the outputs of AddNoiseFloat64, see
+// Granular.
+func (discreteGaussian) Granularity(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	if err := checkArgsGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
+		return 0, err
+	}
+	return discreteGaussianGranularity(l0Sensitivity, lInfSensitivity, epsilon, delta), nil
+}
+
+func (discreteGaussian) String() string {
+	return "Discrete Gaussian Noise"
+}
+
+// discreteGaussianGranularity returns the power of two granularity at which
+// AddNoiseFloat64 discretizes its input and its noise.
+func discreteGaussianGranularity(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) float64 {
+	return ceilPowerOfTwo(SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta) / granularityParam)
+}
+
+// sampleDiscreteGaussian returns a sample from the discrete Gaussian
+// distribution over the integers with parameter σ, i.e. the distribution where
+// the probability of x is proportional to exp(-x²/(2σ²)).
+//
+// σ is converted exactly into a rational number and all subsequent computations
+// use exact rational arithmetic, see Algorithm 3 of
+// https://arxiv.org/abs/2004.00010.
+func sampleDiscreteGaussian(r rand.Source, sigma float64) int64 {
+	sigmaSquared := new(big.Rat).SetFloat64(sigma)
+	sigmaSquared.Mul(sigmaSquared, sigmaSquared)
+	// t = ⌊σ⌋ + 1. Note that ⌊√x⌋ = ⌊√⌊x⌋⌋ for x ≥ 0.
+	t := new(big.Int).Quo(sigmaSquared.Num(), sigmaSquared.Denom())
+	t.Sqrt(t)
+	t.Add(t, big.NewInt(1))
+	tRat := new(big.Rat).SetInt(t)
+	// σ²/t and 2σ² are reused across iterations.
+	sigmaSquaredOverT := new(big.Rat).Quo(sigmaSquared, tRat)
+	twoSigmaSquared := new(big.Rat).Add(sigmaSquared, sigmaSquared)
+
+	gamma := new(big.Rat)
+	for {
+		y := sampleDiscreteLaplace(r, big.NewInt(1), t)
+		// Accept y with probability exp(-(|y| - σ²/t)² / (2σ²)).
+		gamma.SetInt(new(big.Int).Abs(y))
+		gamma.Sub(gamma, sigmaSquaredOverT)
+		gamma.Mul(gamma, gamma)
+		gamma.Quo(gamma, twoSigmaSquared)
+		if bernoulliExp(r, gamma) {
+			// The probability of |y| exceeding the int64 range is negligible for any
+			// σ that SigmaForGaussian can return.
+			return y.Int64()
+		}
+	}
+}
+
+// sampleDiscreteLaplace returns a sample from the discrete Laplace distribution
+// over the integers with scale t/s, i.e. the distribution where the probability
+// of x is proportional to exp(-|x|·s/t), for positive integers s and t. See
+// Algorithm 2 of https://arxiv.org/abs/2004.00010.
+func sampleDiscreteLaplace(r rand.Source, s, t *big.Int) *big.Int {
+	tRat := new(big.Rat).SetInt(t)
+	gamma := new(big.Rat)
+	for {
+		u := uniformBigInt(r, t)
+		if !bernoulliExp(r, gamma.Quo(new(big.Rat).SetInt(u), tRat)) {
+			continue
+		}
+		var v int64
+		for bernoulliExp(r, big.NewRat(1, 1)) {
+			v++
+		}
+		// u + t·v is geometrically distributed with parameter 1 - exp(-1/t), so
+		// x = ⌊(u + t·v)/s⌋ is geometrically distributed with parameter
+		// 1 - exp(-s/t).
+		x := new(big.Int).Mul(t, big.NewInt(v))
+		x.Add(x, u)
+		x.Quo(x, s)
+		if r.Boolean() {
+			if x.Sign() == 0 {
+				// Reject negative zero so that zero isn't sampled twice as often.
+				continue
+			}
+			x.Neg(x)
+		}
+		return x
+	}
+}
+
+// bernoulliExp returns true with probability exp(-γ) for a rational γ ≥ 0. See
+// Algorithm 1 of https://arxiv.org/abs/2004.00010.
+func bernoulliExp(r rand.Source, gamma *big.Rat) bool {
+	one := big.NewRat(1, 1)
+	if gamma.Cmp(one) <= 0 {
+		// Sample K with Pr[K ≥ k] = γ^(k-1)/(k-1)!, then exp(-γ) = Pr[K odd].
+		k := int64(1)
+		p := new(big.Rat)
+		for bernoulli(r, p.Quo(gamma, big.NewRat(k, 1))) {
+			k++
+		}
+		return k%2 == 1
+	}
+	// exp(-γ) = exp(-1)^⌊γ⌋ · exp(-(γ - ⌊γ⌋)).
+	floor := new(big.Int).Quo(gamma.Num(), gamma.Denom())
+	for i := new(big.Int); i.Cmp(floor) < 0; i.Add(i, big.NewInt(1)) {
+		if !bernoulliExp(r, one) {
+			return false
+		}
+	}
+	return bernoulliExp(r, new(big.Rat).Sub(gamma, new(big.Rat).SetInt(floor)))
+}
+
+// bernoulli returns true with probability p, for a rational p in [0, 1].
+func bernoulli(r rand.Source, p *big.Rat) bool {
+	return uniformBigInt(r, p.Denom()).Cmp(p.Num()) < 0
+}
+
+// uniformBigInt returns an integer drawn uniformly at random from [0, n) for
+// n > 0, using rejection sampling on random bits.
+func uniformBigInt(r rand.Source, n *big.Int) *big.Int {
+	if n.IsInt64() {
+		return big.NewInt(r.I63n(n.Int64()))
+	}
+	bitLen := n.BitLen()
+	words := (bitLen + 63) / 64
+	// Excess bits of the most significant word are masked out so that each
+	// candidate is accepted with probability at least 1/2.
+	mask := uint64(math.MaxUint64) >> uint(words*64-bitLen)
+	x := new(big.Int)
+	word := new(big.Int)
+	for {
+		x.SetUint64(r.U64() & mask)
+		for i := 1; i < words; i++ {
+			x.Lsh(x, 64)
+			x.Or(x, word.SetUint64(r.U64()))
+		}
+		if x.Cmp(n) < 0 {
+			return x
+		}
+	}
+}
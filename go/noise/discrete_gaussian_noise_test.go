@@ -0,0 +1,219 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/google/differential-privacy/go/rand"
+	"github.com/grd/stat"
+)
+
+func TestSampleDiscreteGaussianStatistics(t *testing.T) {
+	const numberOfSamples = 50000
+	for _, sigma := range []float64{0.7, 1.0, 5.5, 100.0} {
+		samples := make(stat.Float64Slice, numberOfSamples)
+		for i := 0; i < numberOfSamples; i++ {
+			samples[i] = float64(sampleDiscreteGaussian(rand.Default(), sigma))
+		}
+		// The variance of the discrete Gaussian is at most σ², and it is very close
+		// to σ² for σ ≥ 1.
+		wantVariance := discreteGaussianVariance(sigma)
+		sampleMean, sampleVariance := stat.Mean(samples), stat.Variance(samples)
+		// Assuming that the sample mean is approximately Gaussian distributed, a
+		// deviation of 5 standard errors only happens with negligible probability.
+		if !nearEqual(sampleMean, 0, 5*math.Sqrt(wantVariance/numberOfSamples)) {
+			t.Errorf("sampleDiscreteGaussian(%f): got mean = %f, want 0", sigma, sampleMean)
+		}
+		if !nearEqual(sampleVariance, wantVariance, 0.05*wantVariance) {
+			t.Errorf("sampleDiscreteGaussian(%f): got variance = %f, want %f", sigma, sampleVariance, wantVariance)
+		}
+	}
+}
+
+// discreteGaussianVariance computes the variance of the discrete Gaussian with
+// parameter σ by summing over its support.
+func discreteGaussianVariance(sigma float64) float64 {
+	var normalization, secondMoment float64
+	for x := -math.Ceil(40 * sigma); x <= math.Ceil(40*sigma); x++ {
+		p := math.Exp(-x * x / (2 * sigma * sigma))
+		normalization += p
+		secondMoment += x * x * p
+	}
+	return secondMoment / normalization
+}
+
+func TestBernoulliExp(t *testing.T) {
+	const numberOfSamples = 100000
+	for _, gamma := range []*big.Rat{
+		big.NewRat(0, 1),
+		big.NewRat(1, 3),
+		big.NewRat(1, 1),
+		big.NewRat(5, 2),
+	} {
+		var successes int
+		for i := 0; i < numberOfSamples; i++ {
+			if bernoulliExp(rand.Default(), gamma) {
+				successes++
+			}
+		}
+		g, _ := gamma.Float64()
+		want := math.Exp(-g)
+		got := float64(successes) / numberOfSamples
+		if !nearEqual(got, want, 5*math.Sqrt(want*(1-want)/numberOfSamples)+1e-9) {
+			t.Errorf("bernoulliExp(%v): got success rate %f, want %f", gamma, got, want)
+		}
+	}
+}
+
+func TestUniformBigInt(t *testing.T) {
+	// 2^64 + 3 doesn't fit in an int64, which exercises the multi-word path.
+	n := new(big.Int).Lsh(big.NewInt(1), 64)
+	n.Add(n, big.NewInt(3))
+	half := new(big.Int).Rsh(n, 1)
+	const numberOfSamples = 10000
+	var belowHalf int
+	for i := 0; i < numberOfSamples; i++ {
+		x := uniformBigInt(rand.Default(), n)
+		if x.Sign() < 0 || x.Cmp(n) >= 0 {
+			t.Fatalf("uniformBigInt(%v): got %v, want value in [0, %v)", n, x, n)
+		}
+		if x.Cmp(half) < 0 {
+			belowHalf++
+		}
+	}
+	if !nearEqual(float64(belowHalf)/numberOfSamples, 0.5, 0.025) {
+		t.Errorf("uniformBigInt(%v): got %d samples below n/2 out of %d, want about half", n, belowHalf, numberOfSamples)
+	}
+}
+
+func TestDiscreteGaussianAddNoiseInt64Statistics(t *testing.T) {
+	const numberOfSamples = 20000
+	dg := DiscreteGaussian()
+	sigma := SigmaForGaussian(1, 1, ln3, 1e-10)
+	samples := make(stat.Float64Slice, numberOfSamples)
+	for i := 0; i < numberOfSamples; i++ {
+		noised, err := dg.AddNoiseInt64(1000, 1, 1, ln3, 1e-10)
+		if err != nil {
+			t.Fatalf("AddNoiseInt64: got error %v", err)
+		}
+		samples[i] = float64(noised)
+	}
+	sampleMean, sampleVariance := stat.Mean(samples), stat.Variance(samples)
+	if !nearEqual(sampleMean, 1000, 5*sigma/math.Sqrt(numberOfSamples)) {
+		t.Errorf("AddNoiseInt64: got mean = %f, want 1000", sampleMean)
+	}
+	if !nearEqual(sampleVariance, sigma*sigma, 0.05*sigma*sigma) {
+		t.Errorf("AddNoiseInt64: got variance = %f, want %f", sampleVariance, sigma*sigma)
+	}
+}
+
+func TestDiscreteGaussianAddNoiseFloat64RoundsToGranularity(t *testing.T) {
+	const numberOfTrials = 100
+	dg := DiscreteGaussian()
+	for _, lInf := range []float64{1e-3, 1, 1e6} {
+		granularity := discreteGaussianGranularity(1, lInf, ln3, 1e-10)
+		for i := 0; i < numberOfTrials; i++ {
+			noised, err := dg.AddNoiseFloat64(0.123456789, 1, lInf, ln3, 1e-10)
+			if err != nil {
+				t.Fatalf("AddNoiseFloat64: got error %v", err)
+			}
+			if math.Round(noised/granularity) != noised/granularity {
+				t.Errorf("AddNoiseFloat64: with lInf = %f got noised x: %f, not a multiple of: %f", lInf, noised, granularity)
+				break
+			}
+		}
+	}
+}
+
+func TestDiscreteGaussianArgumentChecks(t *testing.T) {
+	dg := DiscreteGaussian()
+	for _, tc := range []struct {
+		desc            string
+		l0Sensitivity   int64
+		lInfSensitivity int64
+		epsilon, delta  float64
+	}{
+		{"zero delta", 1, 1, ln3, 0},
+		{"negative epsilon", 1, 1, -1, 1e-10},
+		{"zero l0 sensitivity", 0, 1, ln3, 1e-10},
+		{"negative lInf sensitivity", 1, -1, ln3, 1e-10},
+	} {
+		if _, err := dg.AddNoiseInt64(0, tc.l0Sensitivity, tc.lInfSensitivity, tc.epsilon, tc.delta); err == nil {
+			t.Errorf("AddNoiseInt64: when %s got no error, want error", tc.desc)
+		}
+		if _, err := dg.AddNoiseFloat64(0, tc.l0Sensitivity, float64(tc.lInfSensitivity), tc.epsilon, tc.delta); err == nil {
+			t.Errorf("AddNoiseFloat64: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestThresholdDiscreteGaussian(t *testing.T) {
+	got, err := DiscreteGaussian().Threshold(1, 1, ln3, 1e-10, 1e-10)
+	if err != nil {
+		t.Fatalf("Threshold: got error %v", err)
+	}
+	want, err := Gaussian().Threshold(1, 1, ln3, 1e-10, 1e-10)
+	if err != nil {
+		t.Fatalf("Threshold: got error %v", err)
+	}
+	if got != want+1 {
+		t.Errorf("Threshold: got %f, want %f", got, want+1)
+	}
+}
+
+func TestDeltaForThresholdDiscreteGaussianInvertsThreshold(t *testing.T) {
+	for _, thresholdDelta := range []float64{1e-10, 1e-5, 0.1} {
+		k, err := DiscreteGaussian().Threshold(2, 3, ln3, 1e-10, thresholdDelta)
+		if err != nil {
+			t.Fatalf("Threshold: got error %v", err)
+		}
+		got, err := DiscreteGaussian().(discreteGaussian).DeltaForThreshold(2, 3, ln3, 1e-10, k)
+		if err != nil {
+			t.Fatalf("DeltaForThreshold: got error %v", err)
+		}
+		if !nearEqual(got, thresholdDelta, 1e-3*thresholdDelta) {
+			t.Errorf("DeltaForThreshold(Threshold(δ = %e)): got %e, want %e", thresholdDelta, got, thresholdDelta)
+		}
+	}
+}
+
+func TestComputeConfidenceIntervalInt64DiscreteGaussian(t *testing.T) {
+	got, err := DiscreteGaussian().ComputeConfidenceIntervalInt64(100, 1, 1, ln3, 1e-10, 0.1)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceIntervalInt64: got error %v", err)
+	}
+	gaussianConfInt, err := Gaussian().ComputeConfidenceIntervalInt64(100, 1, 1, ln3, 1e-10, 0.1)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceIntervalInt64: got error %v", err)
+	}
+	want := ConfidenceInterval{LowerBound: gaussianConfInt.LowerBound - 1, UpperBound: gaussianConfInt.UpperBound + 1}
+	if got != want {
+		t.Errorf("ComputeConfidenceIntervalInt64: got %+v, want %+v", got, want)
+	}
+}
+
+func TestDiscreteGaussianKind(t *testing.T) {
+	if got := ToKind(DiscreteGaussian()); got != DiscreteGaussianNoise {
+		t.Errorf("ToKind(DiscreteGaussian()): got %v, want %v", got, DiscreteGaussianNoise)
+	}
+	if got := ToNoise(DiscreteGaussianNoise); got != DiscreteGaussian() {
+		t.Errorf("ToNoise(DiscreteGaussianNoise): got %v, want %v", got, DiscreteGaussian())
+	}
+}
@@ -0,0 +1,170 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// Functions adding a share of the noise of a mechanism, for distributed noise
+// generation: when numShares mutually distrusting workers each add a share to
+// their partial aggregate, e.g. before sending it to a secure aggregation
+// protocol that only reveals the sum of the partial aggregates, the sum
+// carries exactly the noise of the mechanism, without any party ever seeing a
+// value noised with less than the shares of the others.
+//
+// This relies on the noise distributions being infinitely divisible: Laplace
+// noise is the sum of numShares differences of two Gamma(1/numShares)
+// samples, discrete Laplace noise (i.e. the two-sided geometric distribution)
+// the sum of numShares differences of two Pólya(1/numShares) samples, and
+// Gaussian noise the sum of numShares Gaussian samples with 1/numShares of its
+// variance.
+//
+// The privacy guarantee only holds if the shares of numShares workers are
+// summed: if some workers may drop out or collude, numShares should be the
+// number of shares that are guaranteed to be honest and summed, which
+// increases the total noise accordingly.
+//
+// Unlike AddNoiseFloat64 of Laplace(), the continuous Laplace shares are
+// sampled with floating-point arithmetic and aren't hardened against the
+// attacks described in
+// https://github.com/google/differential-privacy/blob/main/common_docs/Secure_Noise_Generation.pdf.
+// Prefer AddLaplaceNoiseShareInt64 where possible, e.g. when the partial
+// aggregates are integers, as is required by most secure aggregation
+// protocols anyway.
+
+// polyaMaxPoissonMean is the largest mean of the Poisson samples drawn at once
+// by samplePoisson, so that e^-mean doesn't underflow.
+const polyaMaxPoissonMean = 100
+
+// AddLaplaceNoiseShareFloat64 adds a share of the Laplace noise that makes a
+// sum of partial aggregates ε-differentially private given the L_0 and L_∞
+// sensitivities of the database, when numShares workers each add a share.
+func AddLaplaceNoiseShareFloat64(x float64, numShares, l0Sensitivity int64, lInfSensitivity, epsilon float64) (float64, error) {
+	return addLaplaceNoiseShareFloat64(rand.Default(), x, numShares, l0Sensitivity, lInfSensitivity, epsilon)
+}
+
+func addLaplaceNoiseShareFloat64(r rand.Source, x float64, numShares, l0Sensitivity int64, lInfSensitivity, epsilon float64) (float64, error) {
+	if err := checkNumShares(numShares); err != nil {
+		return 0, err
+	}
+	if err := checkArgsLaplace(l0Sensitivity, lInfSensitivity, epsilon, 0); err != nil {
+		return 0, err
+	}
+	lambda := laplaceLambda(l0Sensitivity, lInfSensitivity, epsilon)
+	shape := 1 / float64(numShares)
+	return x + lambda*(sampleGamma(r, shape)-sampleGamma(r, shape)), nil
+}
+
+// AddLaplaceNoiseShareInt64 adds a share of the discrete Laplace noise that
+// makes a sum of partial aggregates ε-differentially private given the L_0
+// and L_∞ sensitivities of the database, when numShares workers each add a
+// share. The sum of the shares follows the two-sided geometric distribution
+// with parameter e^-ε/(l0Sensitivity·lInfSensitivity).
+func AddLaplaceNoiseShareInt64(x, numShares, l0Sensitivity, lInfSensitivity int64, epsilon float64) (int64, error) {
+	return addLaplaceNoiseShareInt64(rand.Default(), x, numShares, l0Sensitivity, lInfSensitivity, epsilon)
+}
+
+func addLaplaceNoiseShareInt64(r rand.Source, x, numShares, l0Sensitivity, lInfSensitivity int64, epsilon float64) (int64, error) {
+	if err := checkNumShares(numShares); err != nil {
+		return 0, err
+	}
+	if err := checkArgsLaplace(l0Sensitivity, float64(lInfSensitivity), epsilon, 0); err != nil {
+		return 0, err
+	}
+	alpha := math.Exp(-1 / laplaceLambda(l0Sensitivity, float64(lInfSensitivity), epsilon))
+	shape := 1 / float64(numShares)
+	return x + samplePolya(r, shape, alpha) - samplePolya(r, shape, alpha), nil
+}
+
+// AddGaussianNoiseShareFloat64 adds a share of the Gaussian noise that makes a
+// sum of partial aggregates (ε,δ)-differentially private given the L_0 and
+// L_∞ sensitivities of the database, when numShares workers each add a share.
+// The standard deviation of each share is σ/√numShares, where σ is the
+// standard deviation of Gaussian().AddNoiseFloat64 for the same parameters.
+func AddGaussianNoiseShareFloat64(x float64, numShares, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return addGaussianNoiseShareFloat64(rand.Default(), x, numShares, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func addGaussianNoiseShareFloat64(r rand.Source, x float64, numShares, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	if err := checkNumShares(numShares); err != nil {
+		return 0, err
+	}
+	if err := checkArgsGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
+		return 0, err
+	}
+	sigma := SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta)
+	return addGaussianFloat64(r, x, sigma/math.Sqrt(float64(numShares))), nil
+}
+
+func checkNumShares(numShares int64) error {
+	if numShares <= 0 {
+		return fmt.Errorf("NumShares is %d, must be strictly positive", numShares)
+	}
+	return nil
+}
+
+// sampleGamma draws a sample from the Gamma distribution with the given shape
+// and scale 1, using the method of Marsaglia and Tsang, "A Simple Method for
+// Generating Gamma Variables" (https://doi.org/10.1145/358407.358414).
+func sampleGamma(r rand.Source, shape float64) float64 {
+	if shape < 1 {
+		// If X ~ Gamma(shape+1) and U is uniform on [0, 1), X·U^(1/shape) ~ Gamma(shape).
+		return sampleGamma(r, shape+1) * math.Pow(r.Uniform(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.Normal()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		if math.Log(r.Uniform()) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// samplePolya draws a sample from the Pólya (i.e. negative binomial)
+// distribution with the given shape and success probability p, whose
+// probability of k is proportional to Γ(k+shape)/k!·pᵏ. With a shape of 1,
+// this is the geometric distribution of parameter 1-p starting at 0. The
+// sample is drawn as a Poisson sample whose mean is Gamma distributed.
+func samplePolya(r rand.Source, shape, p float64) int64 {
+	return samplePoisson(r, sampleGamma(r, shape)*p/(1-p))
+}
+
+// samplePoisson draws a sample from the Poisson distribution with the given
+// mean, as the sum of Poisson samples of mean at most polyaMaxPoissonMean
+// drawn by multiplying uniform samples, which takes time linear in the mean.
+func samplePoisson(r rand.Source, mean float64) int64 {
+	var sample int64
+	for mean > 0 {
+		m := math.Min(mean, polyaMaxPoissonMean)
+		mean -= m
+		limit := math.Exp(-m)
+		for product := r.Uniform(); product > limit; product *= r.Uniform() {
+			sample++
+		}
+	}
+	return sample
+}
@@ -0,0 +1,162 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/rand"
+	"github.com/grd/stat"
+)
+
+// The tolerances of the tests below are set to the 99.9995% quantiles of the
+// anticipated distributions of the sample mean and variance, see
+// TestLaplaceStatistics and TestGaussianStatistics.
+const distributedNumberOfSamples = 20000
+
+func TestLaplaceNoiseSharesSumToLaplaceNoise(t *testing.T) {
+	for _, numShares := range []int64{1, 5} {
+		lambda := laplaceLambda(2, 1.5, ln3)
+		samples := make(stat.Float64Slice, distributedNumberOfSamples)
+		for i := range samples {
+			for j := int64(0); j < numShares; j++ {
+				share, err := AddLaplaceNoiseShareFloat64(0, numShares, 2, 1.5, ln3)
+				if err != nil {
+					t.Fatalf("AddLaplaceNoiseShareFloat64: got error %v", err)
+				}
+				samples[i] += share
+			}
+		}
+		// The kurtosis of the Laplace distribution is 6, so the variance of the
+		// sample variance is 5·variance²/n.
+		variance := 2 * lambda * lambda
+		meanErrorTolerance := 4.41717 * math.Sqrt(variance/distributedNumberOfSamples)
+		varianceErrorTolerance := 4.41717 * math.Sqrt(5) * variance / math.Sqrt(distributedNumberOfSamples)
+		if got := stat.Mean(samples); !nearEqual(got, 0, meanErrorTolerance) {
+			t.Errorf("Sum of %d Laplace shares: got mean %f, want 0", numShares, got)
+		}
+		if got := stat.Variance(samples); !nearEqual(got, variance, varianceErrorTolerance) {
+			t.Errorf("Sum of %d Laplace shares: got variance %f, want %f", numShares, got, variance)
+		}
+	}
+}
+
+func TestDiscreteLaplaceNoiseSharesSumToDiscreteLaplaceNoise(t *testing.T) {
+	for _, numShares := range []int64{1, 5} {
+		// With ε = ln(3) and an L_1 sensitivity of 1, the sum of the shares k
+		// has a probability of (1-α)/(1+α)·α^|k| with α = 1/3.
+		alpha := 1.0 / 3
+		var zeros int
+		samples := make(stat.Float64Slice, distributedNumberOfSamples)
+		for i := range samples {
+			var sum int64
+			for j := int64(0); j < numShares; j++ {
+				share, err := AddLaplaceNoiseShareInt64(0, numShares, 1, 1, ln3)
+				if err != nil {
+					t.Fatalf("AddLaplaceNoiseShareInt64: got error %v", err)
+				}
+				sum += share
+			}
+			if sum == 0 {
+				zeros++
+			}
+			samples[i] = float64(sum)
+		}
+		variance := 2 * alpha / ((1 - alpha) * (1 - alpha))
+		meanErrorTolerance := 4.41717 * math.Sqrt(variance/distributedNumberOfSamples)
+		if got := stat.Mean(samples); !nearEqual(got, 0, meanErrorTolerance) {
+			t.Errorf("Sum of %d discrete Laplace shares: got mean %f, want 0", numShares, got)
+		}
+		p := (1 - alpha) / (1 + alpha)
+		zerosErrorTolerance := 4.41717 * math.Sqrt(p*(1-p)/distributedNumberOfSamples)
+		if got := float64(zeros) / distributedNumberOfSamples; !nearEqual(got, p, zerosErrorTolerance) {
+			t.Errorf("Sum of %d discrete Laplace shares: got a probability of 0 of %f, want %f", numShares, got, p)
+		}
+	}
+}
+
+func TestGaussianNoiseSharesSumToGaussianNoise(t *testing.T) {
+	for _, numShares := range []int64{1, 5} {
+		sigma := SigmaForGaussian(2, 1.5, ln3, 1e-5)
+		samples := make(stat.Float64Slice, distributedNumberOfSamples)
+		for i := range samples {
+			for j := int64(0); j < numShares; j++ {
+				share, err := AddGaussianNoiseShareFloat64(0, numShares, 2, 1.5, ln3, 1e-5)
+				if err != nil {
+					t.Fatalf("AddGaussianNoiseShareFloat64: got error %v", err)
+				}
+				samples[i] += share
+			}
+		}
+		variance := sigma * sigma
+		meanErrorTolerance := 4.41717 * math.Sqrt(variance/distributedNumberOfSamples)
+		varianceErrorTolerance := 4.41717 * math.Sqrt2 * variance / math.Sqrt(distributedNumberOfSamples)
+		if got := stat.Mean(samples); !nearEqual(got, 0, meanErrorTolerance) {
+			t.Errorf("Sum of %d Gaussian shares: got mean %f, want 0", numShares, got)
+		}
+		if got := stat.Variance(samples); !nearEqual(got, variance, varianceErrorTolerance) {
+			t.Errorf("Sum of %d Gaussian shares: got variance %f, want %f", numShares, got, variance)
+		}
+	}
+}
+
+func TestNoiseSharesAreReproducible(t *testing.T) {
+	seed := rand.NewSeed()
+	r1, err := rand.NewRand(seed)
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	r2, err := rand.NewRand(seed)
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		a, _ := addLaplaceNoiseShareInt64(r1, 0, 3, 1, 1, ln3)
+		b, _ := addLaplaceNoiseShareInt64(r2, 0, 3, 1, 1, ln3)
+		if a != b {
+			t.Fatalf("addLaplaceNoiseShareInt64 with the same seed: got %d and %d, want equal shares", a, b)
+		}
+	}
+}
+
+func TestNoiseSharesInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		desc                 string
+		numShares, l0        int64
+		lInf, epsilon, delta float64
+	}{
+		{"no shares", 0, 1, 1, ln3, 1e-5},
+		{"negative shares", -1, 1, 1, ln3, 1e-5},
+		{"no l0Sensitivity", 3, 0, 1, ln3, 1e-5},
+		{"no lInfSensitivity", 3, 1, 0, ln3, 1e-5},
+		{"negative epsilon", 3, 1, 1, -1, 1e-5},
+	} {
+		if _, err := AddLaplaceNoiseShareFloat64(0, tc.numShares, tc.l0, tc.lInf, tc.epsilon); err == nil {
+			t.Errorf("AddLaplaceNoiseShareFloat64 with %s: got no error, want error", tc.desc)
+		}
+		if _, err := AddLaplaceNoiseShareInt64(0, tc.numShares, tc.l0, int64(tc.lInf), tc.epsilon); err == nil {
+			t.Errorf("AddLaplaceNoiseShareInt64 with %s: got no error, want error", tc.desc)
+		}
+		if _, err := AddGaussianNoiseShareFloat64(0, tc.numShares, tc.l0, tc.lInf, tc.epsilon, tc.delta); err == nil {
+			t.Errorf("AddGaussianNoiseShareFloat64 with %s: got no error, want error", tc.desc)
+		}
+	}
+	if _, err := AddGaussianNoiseShareFloat64(0, 3, 1, 1, ln3, 0); err == nil {
+		t.Errorf("AddGaussianNoiseShareFloat64 without delta: got no error, want error")
+	}
+}
@@ -0,0 +1,219 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// This file contains noise whose scale is set directly by the caller instead
+// of being calibrated to a privacy budget, e.g. because it was computed by an
+// external accountant.
+
+// FixedScale is implemented by the Noise returned by GaussianWithStddev and
+// LaplaceWithScale.
+//
+// Their AddNoise*, ComputeConfidenceInterval* and Granularity functions ignore
+// the epsilon and delta they are called with, and the sensitivities except to
+// compute thresholds. In particular, an aggregation of package dpagg using such
+// noise adds noise of the fixed scale regardless of its Epsilon and Delta
+// options, which may be left at 0. Privacy accounting is then the caller's
+// responsibility: the budget recorded by the aggregation, e.g. in metrics, is
+// the one of its options, not the one implied by the noise. Use
+// GaussianEpsilonForSigma and LaplaceEpsilonForScale to derive the latter.
+//
+// Aggregations using FixedScale noise can't be serialized along with their
+// noise: ToKind returns Unrecognised for it.
+type FixedScale interface {
+	Noise
+	// StandardDeviation returns the standard deviation of the noise.
+	StandardDeviation() float64
+}
+
+type fixedGaussian struct {
+	sigma float64
+}
+
+// GaussianWithStddev returns a Noise instance that adds Gaussian noise of
+// standard deviation sigma to its input, see FixedScale. The noise is drawn
+// with the same sampler as Gaussian.
+func GaussianWithStddev(sigma float64) (FixedScale, error) {
+	if err := checkFixedScale(sigma); err != nil {
+		return nil, fmt.Errorf("GaussianWithStddev: %w", err)
+	}
+	return fixedGaussian{sigma: sigma}, nil
+}
+
+func (n fixedGaussian) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (n fixedGaussian) addNoiseFloat64(r rand.Source, x float64, _ int64, _, _, _ float64) (float64, error) {
+	return addGaussianFloat64(r, x, n.sigma), nil
+}
+
+func (n fixedGaussian) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (n fixedGaussian) addNoiseInt64(r rand.Source, x, _, _ int64, _, _ float64) (int64, error) {
+	return addGaussianInt64(r, x, n.sigma), nil
+}
+
+// Threshold returns the smallest threshold k to use in a differentially private
+// histogram with added Gaussian noise of standard deviation σ, ignoring epsilon
+// and noiseDelta.
+func (n fixedGaussian) Threshold(l0Sensitivity int64, lInfSensitivity, _, noiseDelta, thresholdDelta float64) (float64, error) {
+	if err := checkFixedScaleSensitivities(l0Sensitivity, lInfSensitivity); err != nil {
+		return 0, err
+	}
+	if err := checks.CheckThresholdDelta(thresholdDelta, noiseDelta); err != nil {
+		return 0, err
+	}
+	return gaussianThreshold(l0Sensitivity, lInfSensitivity, n.sigma, thresholdDelta), nil
+}
+
+// DeltaForThreshold is the inverse operation of Threshold.
+func (n fixedGaussian) DeltaForThreshold(l0Sensitivity int64, lInfSensitivity, _, _, threshold float64) (float64, error) {
+	if err := checkFixedScaleSensitivities(l0Sensitivity, lInfSensitivity); err != nil {
+		return 0, err
+	}
+	return gaussianDeltaForThreshold(l0Sensitivity, lInfSensitivity, n.sigma, threshold), nil
+}
+
+func (n fixedGaussian) ComputeConfidenceIntervalInt64(noisedX, _, _ int64, _, _, alpha float64) (ConfidenceInterval, error) {
+	if err := checks.CheckAlpha(alpha); err != nil {
+		return ConfidenceInterval{}, err
+	}
+	return computeConfidenceIntervalInt64Gaussian(noisedX, n.sigma, alpha), nil
+}
+
+func (n fixedGaussian) ComputeConfidenceIntervalFloat64(noisedX float64, _ int64, _, _, _, alpha float64) (ConfidenceInterval, error) {
+	if err := checks.CheckAlpha(alpha); err != nil {
+		return ConfidenceInterval{}, err
+	}
+	return computeConfidenceIntervalGaussian(noisedX, n.sigma, alpha), nil
+}
+
+// Granularity returns the granularity of the outputs of AddNoiseFloat64, see
+// Granular.
+func (n fixedGaussian) Granularity(_ int64, _, _, _ float64) (float64, error) {
+	return gaussianGranularity(n.sigma), nil
+}
+
+func (n fixedGaussian) StandardDeviation() float64 {
+	return n.sigma
+}
+
+func (n fixedGaussian) String() string {
+	return fmt.Sprintf("Gaussian Noise (σ = %v)", n.sigma)
+}
+
+type fixedLaplace struct {
+	b float64
+}
+
+// LaplaceWithScale returns a Noise instance that adds Laplace noise of scale b,
+// i.e. of standard deviation √2·b, to its input, see FixedScale. The noise is
+// drawn with the same sampler as Laplace.
+func LaplaceWithScale(b float64) (FixedScale, error) {
+	if err := checkFixedScale(b); err != nil {
+		return nil, fmt.Errorf("LaplaceWithScale: %w", err)
+	}
+	return fixedLaplace{b: b}, nil
+}
+
+// epsilon returns the ε for which Laplace noise calibrated to the given
+// sensitivities has scale b. It is used to reuse the functions of laplace.
+func (n fixedLaplace) epsilon(l0Sensitivity int64, lInfSensitivity float64) float64 {
+	return lInfSensitivity * float64(l0Sensitivity) / n.b
+}
+
+func (n fixedLaplace) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (n fixedLaplace) addNoiseFloat64(r rand.Source, x float64, _ int64, _, _, _ float64) (float64, error) {
+	// Laplace noise with an L_1 sensitivity of 1 and ε = 1/b has scale b.
+	return addLaplaceFloat64(r, x, 1/n.b, 1), nil
+}
+
+func (n fixedLaplace) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (n fixedLaplace) addNoiseInt64(r rand.Source, x, _, _ int64, _, _ float64) (int64, error) {
+	return addLaplaceInt64(r, x, 1/n.b, 1), nil
+}
+
+// Threshold returns the smallest threshold k to use in a differentially private
+// histogram with added Laplace noise of scale b, ignoring epsilon. Like
+// Laplace, it fails if noiseDelta is non-zero.
+func (n fixedLaplace) Threshold(l0Sensitivity int64, lInfSensitivity, _, noiseDelta, thresholdDelta float64) (float64, error) {
+	if err := checkFixedScaleSensitivities(l0Sensitivity, lInfSensitivity); err != nil {
+		return 0, err
+	}
+	return laplace{}.Threshold(l0Sensitivity, lInfSensitivity, n.epsilon(l0Sensitivity, lInfSensitivity), noiseDelta, thresholdDelta)
+}
+
+// DeltaForThreshold is the inverse operation of Threshold.
+func (n fixedLaplace) DeltaForThreshold(l0Sensitivity int64, lInfSensitivity, _, delta, threshold float64) (float64, error) {
+	if err := checkFixedScaleSensitivities(l0Sensitivity, lInfSensitivity); err != nil {
+		return 0, err
+	}
+	return laplace{}.DeltaForThreshold(l0Sensitivity, lInfSensitivity, n.epsilon(l0Sensitivity, lInfSensitivity), delta, threshold)
+}
+
+func (n fixedLaplace) ComputeConfidenceIntervalInt64(noisedX, _, _ int64, _, _, alpha float64) (ConfidenceInterval, error) {
+	return laplace{}.ComputeConfidenceIntervalInt64(noisedX, 1, 1, 1/n.b, 0, alpha)
+}
+
+func (n fixedLaplace) ComputeConfidenceIntervalFloat64(noisedX float64, _ int64, _, _, _, alpha float64) (ConfidenceInterval, error) {
+	return laplace{}.ComputeConfidenceIntervalFloat64(noisedX, 1, 1, 1/n.b, 0, alpha)
+}
+
+// Granularity returns the granularity of the outputs of AddNoiseFloat64, see
+// Granular.
+func (n fixedLaplace) Granularity(_ int64, _, _, _ float64) (float64, error) {
+	return laplaceGranularity(1/n.b, 1), nil
+}
+
+func (n fixedLaplace) StandardDeviation() float64 {
+	return math.Sqrt2 * n.b
+}
+
+func (n fixedLaplace) String() string {
+	return fmt.Sprintf("Laplace Noise (b = %v)", n.b)
+}
+
+func checkFixedScale(scale float64) error {
+	if !(scale > 0) || math.IsInf(scale, 0) {
+		return fmt.Errorf("noise scale is %f, must be strictly positive and finite", scale)
+	}
+	return nil
+}
+
+func checkFixedScaleSensitivities(l0Sensitivity int64, lInfSensitivity float64) error {
+	if err := checks.CheckL0Sensitivity(l0Sensitivity); err != nil {
+		return err
+	}
+	return checks.CheckLInfSensitivity(lInfSensitivity)
+}
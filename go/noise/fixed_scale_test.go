@@ -0,0 +1,129 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grd/stat"
+)
+
+func TestFixedScaleInvalidScale(t *testing.T) {
+	for _, scale := range []float64{0, -1, math.Inf(1), math.NaN()} {
+		if _, err := GaussianWithStddev(scale); err == nil {
+			t.Errorf("GaussianWithStddev(%f): got no error, want error", scale)
+		}
+		if _, err := LaplaceWithScale(scale); err == nil {
+			t.Errorf("LaplaceWithScale(%f): got no error, want error", scale)
+		}
+	}
+}
+
+func TestFixedScaleStatistics(t *testing.T) {
+	const numberOfSamples = 50000
+	gaussianNoise, err := GaussianWithStddev(3)
+	if err != nil {
+		t.Fatalf("GaussianWithStddev: got error %v", err)
+	}
+	laplaceNoise, err := LaplaceWithScale(2)
+	if err != nil {
+		t.Fatalf("LaplaceWithScale: got error %v", err)
+	}
+	for _, n := range []FixedScale{gaussianNoise, laplaceNoise} {
+		floats := make(stat.Float64Slice, numberOfSamples)
+		ints := make(stat.Float64Slice, numberOfSamples)
+		for i := 0; i < numberOfSamples; i++ {
+			// The budget and sensitivities are ignored, so they may be invalid.
+			f, err := n.AddNoiseFloat64(10, 0, 0, 0, 0)
+			if err != nil {
+				t.Fatalf("%v.AddNoiseFloat64: got error %v", n, err)
+			}
+			floats[i] = f
+			x, err := n.AddNoiseInt64(10, 0, 0, 0, 0)
+			if err != nil {
+				t.Fatalf("%v.AddNoiseInt64: got error %v", n, err)
+			}
+			ints[i] = float64(x)
+		}
+		wantVariance := n.StandardDeviation() * n.StandardDeviation()
+		for _, samples := range []stat.Float64Slice{floats, ints} {
+			sampleMean, sampleVariance := stat.Mean(samples), stat.Variance(samples)
+			if !nearEqual(sampleMean, 10, 5*math.Sqrt(wantVariance/numberOfSamples)) {
+				t.Errorf("%v: got mean = %f, want 10", n, sampleMean)
+			}
+			// Rounding to integers adds a variance of about 1/12.
+			if !nearEqual(sampleVariance, wantVariance, 0.05*wantVariance+1.0/12) {
+				t.Errorf("%v: got variance = %f, want %f", n, sampleVariance, wantVariance)
+			}
+		}
+	}
+}
+
+func TestFixedScaleMatchesCalibratedNoise(t *testing.T) {
+	const l0, lInf, delta, thresholdDelta = 2, 3.0, 1e-10, 1e-5
+	sigma := SigmaForGaussian(l0, lInf, ln3, delta)
+	gaussianNoise, err := GaussianWithStddev(sigma)
+	if err != nil {
+		t.Fatalf("GaussianWithStddev: got error %v", err)
+	}
+	laplaceNoise, err := LaplaceWithScale(laplaceLambda(l0, lInf, ln3))
+	if err != nil {
+		t.Fatalf("LaplaceWithScale: got error %v", err)
+	}
+	for _, tc := range []struct {
+		fixed      FixedScale
+		calibrated Noise
+		noiseDelta float64
+	}{
+		{gaussianNoise, Gaussian(), delta},
+		{laplaceNoise, Laplace(), 0},
+	} {
+		got, err := tc.fixed.Threshold(l0, lInf, 0, tc.noiseDelta, thresholdDelta)
+		if err != nil {
+			t.Fatalf("%v.Threshold: got error %v", tc.fixed, err)
+		}
+		want, err := tc.calibrated.Threshold(l0, lInf, ln3, tc.noiseDelta, thresholdDelta)
+		if err != nil {
+			t.Fatalf("%v.Threshold: got error %v", tc.calibrated, err)
+		}
+		if !nearEqual(got, want, 1e-9*want) {
+			t.Errorf("%v.Threshold: got %f, want %f", tc.fixed, got, want)
+		}
+		gotConfInt, err := tc.fixed.ComputeConfidenceIntervalFloat64(0, l0, lInf, 0, 0, 0.1)
+		if err != nil {
+			t.Fatalf("%v.ComputeConfidenceIntervalFloat64: got error %v", tc.fixed, err)
+		}
+		wantConfInt, err := tc.calibrated.ComputeConfidenceIntervalFloat64(0, l0, lInf, ln3, tc.noiseDelta, 0.1)
+		if err != nil {
+			t.Fatalf("%v.ComputeConfidenceIntervalFloat64: got error %v", tc.calibrated, err)
+		}
+		if !nearEqual(gotConfInt.UpperBound, wantConfInt.UpperBound, 1e-9*wantConfInt.UpperBound) {
+			t.Errorf("%v.ComputeConfidenceIntervalFloat64: got %+v, want %+v", tc.fixed, gotConfInt, wantConfInt)
+		}
+	}
+}
+
+func TestFixedScaleKind(t *testing.T) {
+	n, err := GaussianWithStddev(1)
+	if err != nil {
+		t.Fatalf("GaussianWithStddev: got error %v", err)
+	}
+	if got := ToKind(n); got != Unrecognised {
+		t.Errorf("ToKind(GaussianWithStddev(1)): got %v, want %v", got, Unrecognised)
+	}
+}
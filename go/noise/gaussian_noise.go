@@ -52,30 +52,45 @@ type gaussian struct{}
 // unintentional privacy leaks due to artifacts of floating-point arithmetic. See
 // https://github.com/google/differential-privacy/blob/main/common_docs/Secure_Noise_Generation.pdf
 // for more information.
+//
+// Outputs of AddNoiseFloat64 are multiples of a power of two granularity, which is
+// the smallest one that is at least 2σ/2⁵⁷ where σ is the standard deviation of the
+// noise, see Granularity. The returned Noise implements Granular.
+//
+// Random numbers are drawn from rand.Default(). Use WithSource to draw them
+// from another rand.Source, e.g. a seeded one for reproducible simulations.
 func Gaussian() Noise {
 	return gaussian{}
 }
 
 // AddNoiseFloat64 adds Gaussian noise to the specified float64, so that its
 // output is (ε,δ)-differentially private.
-func (gaussian) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+func (n gaussian) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (gaussian) addNoiseFloat64(r rand.Source, x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
 	if err := checkArgsGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
 		return 0, err
 	}
 
 	sigma := SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta)
-	return addGaussianFloat64(x, sigma), nil
+	return addGaussianFloat64(r, x, sigma), nil
 }
 
 // AddNoiseInt64 adds Gaussian noise to the specified int64, so that the
 // output is (ε,δ)-differentially private.
-func (gaussian) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+func (n gaussian) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (gaussian) addNoiseInt64(r rand.Source, x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
 	if err := checkArgsGaussian(l0Sensitivity, float64(lInfSensitivity), epsilon, delta); err != nil {
 		return 0, err
 	}
 
 	sigma := SigmaForGaussian(l0Sensitivity, float64(lInfSensitivity), epsilon, delta)
-	return addGaussianInt64(x, sigma), nil
+	return addGaussianInt64(r, x, sigma), nil
 }
 
 // Threshold returns the smallest threshold k to use in a differentially private
@@ -91,8 +106,14 @@ func (gaussian) Threshold(l0Sensitivity int64, lInfSensitivity, epsilon, noiseDe
 	}
 
 	sigma := SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, noiseDelta)
+	return gaussianThreshold(l0Sensitivity, lInfSensitivity, sigma, thresholdDelta), nil
+}
+
+// gaussianThreshold returns the threshold of Gaussian noise with standard
+// deviation σ, see Threshold.
+func gaussianThreshold(l0Sensitivity int64, lInfSensitivity, sigma, thresholdDelta float64) float64 {
 	noiseDist := distuv.Normal{Mu: 0, Sigma: sigma}
-	return lInfSensitivity + noiseDist.Quantile(math.Pow(1-thresholdDelta, 1.0/float64(l0Sensitivity))), nil
+	return lInfSensitivity + noiseDist.Quantile(math.Pow(1-thresholdDelta, 1.0/float64(l0Sensitivity)))
 }
 
 // DeltaForThreshold is the inverse operation of Threshold. Specifically, given
@@ -104,8 +125,14 @@ func (gaussian) DeltaForThreshold(l0Sensitivity int64, lInfSensitivity, epsilon,
 		return 0, err
 	}
 	sigma := SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta)
+	return gaussianDeltaForThreshold(l0Sensitivity, lInfSensitivity, sigma, threshold), nil
+}
+
+// gaussianDeltaForThreshold returns the delta induced by thresholding Gaussian
+// noise with standard deviation σ, see DeltaForThreshold.
+func gaussianDeltaForThreshold(l0Sensitivity int64, lInfSensitivity, sigma, threshold float64) float64 {
 	noiseDist := distuv.Normal{Mu: 0, Sigma: sigma}
-	return 1 - math.Pow(noiseDist.CDF(threshold-lInfSensitivity), float64(l0Sensitivity)), nil
+	return 1 - math.Pow(noiseDist.CDF(threshold-lInfSensitivity), float64(l0Sensitivity))
 }
 
 // ComputeConfidenceIntervalInt64 computes a confidence interval that contains the raw integer value x from which int64 noisedX
@@ -118,6 +145,12 @@ func (gaussian) ComputeConfidenceIntervalInt64(noisedX, l0Sensitivity, lInfSensi
 		return ConfidenceInterval{}, err
 	}
 	sigma := SigmaForGaussian(l0Sensitivity, float64(lInfSensitivity), epsilon, delta)
+	return computeConfidenceIntervalInt64Gaussian(noisedX, sigma, alpha), nil
+}
+
+// computeConfidenceIntervalInt64Gaussian computes a confidence interval that contains the raw integer value x from which
+// int64 noisedX is computed with a probability greater or equal to 1 - alpha with the given sigma.
+func computeConfidenceIntervalInt64Gaussian(noisedX int64, sigma, alpha float64) ConfidenceInterval {
 	// Computing the confidence interval around zero rather than nosiedX helps represent the
 	// interval bounds more accurately. The reason is that the resolution of float64 values is most
 	// fine grained around zero.
@@ -126,7 +159,7 @@ func (gaussian) ComputeConfidenceIntervalInt64(noisedX, l0Sensitivity, lInfSensi
 	// due to the coarse resolution of float64 values for large instances of noisedX.
 	lowerBound := nextSmallerFloat64(int64(confIntAroundZero.LowerBound) + noisedX)
 	upperBound := nextLargerFloat64(int64(confIntAroundZero.UpperBound) + noisedX)
-	return ConfidenceInterval{LowerBound: lowerBound, UpperBound: upperBound}, nil
+	return ConfidenceInterval{LowerBound: lowerBound, UpperBound: upperBound}
 }
 
 // ComputeConfidenceIntervalFloat64 computes a confidence interval that contains the raw value x from which float64
@@ -155,6 +188,21 @@ func checkArgsGaussian(l0Sensitivity int64, lInfSensitivity, epsilon, delta floa
 	return checks.CheckDeltaStrict(delta)
 }
 
+// Granularity returns the granularity of the outputs of AddNoiseFloat64, see
+// Granular.
+func (gaussian) Granularity(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	if err := checkArgsGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
+		return 0, err
+	}
+	return gaussianGranularity(SigmaForGaussian(l0Sensitivity, lInfSensitivity, epsilon, delta)), nil
+}
+
+// gaussianGranularity returns the power of two granularity of Gaussian noise
+// with standard deviation σ.
+func gaussianGranularity(sigma float64) float64 {
+	return ceilPowerOfTwo(2.0 * sigma / binomialBound)
+}
+
 func (gaussian) String() string {
 	return "Gaussian Noise"
 }
@@ -168,26 +216,26 @@ func checkArgsConfidenceIntervalGaussian(l0Sensitivity int64, lInfSensitivity, e
 }
 
 // addGaussianFloat64 adds Gaussian noise of scale σ to the specified float64.
-func addGaussianFloat64(x, sigma float64) float64 {
-	granularity := ceilPowerOfTwo(2.0 * sigma / binomialBound)
+func addGaussianFloat64(r rand.Source, x, sigma float64) float64 {
+	granularity := gaussianGranularity(sigma)
 
 	// sqrtN is chosen in a way that places it in the interval between binomialBound
 	// and binomialBound / 2. This ensures that the respective binomial distribution
 	// consists of enough Bernoulli samples to closely approximate a Gaussian distribution.
 	sqrtN := 2.0 * sigma / granularity
-	sample := symmetricBinomial(sqrtN)
+	sample := symmetricBinomial(r, sqrtN)
 	return roundToMultipleOfPowerOfTwo(x, granularity) + float64(sample)*granularity
 }
 
 // addGaussianInt64 adds Gaussian noise of scale σ to the specified int64.
-func addGaussianInt64(x int64, sigma float64) int64 {
-	granularity := ceilPowerOfTwo(2.0 * sigma / binomialBound)
+func addGaussianInt64(r rand.Source, x int64, sigma float64) int64 {
+	granularity := gaussianGranularity(sigma)
 
 	// sqrtN is chosen in a way that places it in the interval between binomialBound
 	// and binomialBound / 2. This ensures that the respective binomial distribution
 	// consists of enough Bernoulli samples to closely approximate a Gaussian distribution.
 	sqrtN := 2.0 * sigma / granularity
-	sample := symmetricBinomial(sqrtN)
+	sample := symmetricBinomial(r, sqrtN)
 	if granularity < 1 {
 		return x + int64(math.Round(float64(sample)*granularity))
 	}
@@ -219,22 +267,22 @@ func inverseCDFGaussian(sigma, p float64) float64 {
 // 0.5 each. The sampling technique is based on Bringmann et al.'s rejection sampling
 // approach proposed in "Internal DLA: Efficient Simulation of a Physical Growth Model"
 // (https://people.mpi-inf.mpg.de/~kbringma/paper/2014ICALP.pdf).
-func symmetricBinomial(sqrtN float64) int64 {
+func symmetricBinomial(r rand.Source, sqrtN float64) int64 {
 	stepSize := int64(math.Round(math.Sqrt2*sqrtN + 1.0))
 	var result int64
 	i := 0
 	for true {
 		// 1 is subtracted from the geometric sample to count the number of Bernoulli fails
 		// rather than the number of trials until the first success.
-		boundedGeometricSample := int64(math.Min(rand.Geometric()-1.0, float64(geometricBound)))
+		boundedGeometricSample := int64(math.Min(r.Geometric()-1.0, float64(geometricBound)))
 		twoSidedGeometricSample := boundedGeometricSample
-		if rand.Boolean() {
+		if r.Boolean() {
 			twoSidedGeometricSample = -twoSidedGeometricSample - 1
 		}
 
-		result = stepSize*twoSidedGeometricSample + rand.I63n(stepSize)
+		result = stepSize*twoSidedGeometricSample + r.I63n(stepSize)
 		resultProbability := binomialProbability(sqrtN, result)
-		rejectProbability := rand.Uniform()
+		rejectProbability := r.Uniform()
 		if resultProbability > 0.0 &&
 			rejectProbability < resultProbability*float64(stepSize)*math.Pow(2.0, float64(boundedGeometricSample))/4.0 {
 			break
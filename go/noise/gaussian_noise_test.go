@@ -21,6 +21,7 @@ import (
 	"math/rand"
 	"testing"
 
+	dprand "github.com/google/differential-privacy/go/rand"
 	"github.com/grd/stat"
 )
 
@@ -147,7 +148,7 @@ func TestSymmetricBinomialStatisitcs(t *testing.T) {
 	} {
 		binomialSamples := make(stat.IntSlice, numberOfSamples)
 		for i := 0; i < numberOfSamples; i++ {
-			binomialSamples[i] = symmetricBinomial(tc.sqrtN)
+			binomialSamples[i] = symmetricBinomial(dprand.Default(), tc.sqrtN)
 		}
 		sampleMean, sampleVariance := stat.Mean(binomialSamples), stat.Variance(binomialSamples)
 		// Assuming that the binomial samples have a mean of 0 and the specified standard deviation
@@ -330,7 +331,7 @@ func TestAddGaussianFloat64RoundsToGranularity(t *testing.T) {
 		for i := 0; i < numberOfTrials; i++ {
 			// the input x of addGaussianFloat64 can be arbitrary
 			x := rand.Float64()*tc.wantGranularity*10 - tc.wantGranularity*5
-			noisedX := addGaussianFloat64(x, tc.sigma)
+			noisedX := addGaussianFloat64(dprand.Default(), x, tc.sigma)
 			if math.Round(noisedX/tc.wantGranularity) != noisedX/tc.wantGranularity {
 				t.Errorf("Got noised x: %f, not a multiple of: %f", noisedX, tc.wantGranularity)
 				break
@@ -370,7 +371,7 @@ func TestAddGaussianInt64RoundsToGranularity(t *testing.T) {
 			// the input x of addGaussianInt64 can be arbitrary but should cover all congruence
 			// classes of the anticipated granularity
 			x := rand.Int63n(tc.wantGranularity*10) - tc.wantGranularity*5
-			noisedX := addGaussianInt64(x, tc.sigma)
+			noisedX := addGaussianInt64(dprand.Default(), x, tc.sigma)
 			if noisedX%tc.wantGranularity != 0 {
 				t.Errorf("Got noised x: %d, not devisible by: %d", noisedX, tc.wantGranularity)
 				break
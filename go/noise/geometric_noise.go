@@ -0,0 +1,136 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math/big"
+
+	"github.com/google/differential-privacy/go/rand"
+)
+
+type geometricNoise struct{}
+
+// Geometric returns a Noise instance that adds two-sided geometric noise, also
+// known as discrete Laplace noise, to its input. Like Laplace, its AddNoise*
+// functions will fail if called with a non-zero delta.
+//
+// AddNoiseInt64 implements the geometric mechanism of Ghosh, Roughgarden and
+// Sundararajan: the noise is drawn from the distribution over the integers
+// where the probability of k is proportional to exp(-ε·|k|/Δ), with Δ = l0·lInf
+// the L_1 sensitivity. Samples are drawn with the exact sampler of Canonne,
+// Kamath and Steinke (https://arxiv.org/abs/2004.00010), using rational
+// arithmetic on the exact value of ε and uniformly random bits only, so no
+// floating point operation is involved and the output is exactly
+// ε-differentially private.
+//
+// AddNoiseFloat64 is the same as the one of Laplace, which discretizes its
+// input and adds geometric noise at a power of two granularity. The returned
+// Noise implements Granular.
+//
+// Random numbers are drawn from rand.Default(). Use WithSource to draw them
+// from another rand.Source, e.g. a seeded one for reproducible simulations.
+func Geometric() Noise {
+	return geometricNoise{}
+}
+
+// AddNoiseFloat64 adds Laplace noise to the specified float64, see Laplace.
+func (n geometricNoise) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (geometricNoise) addNoiseFloat64(r rand.Source, x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return laplace{}.addNoiseFloat64(r, x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+// AddNoiseInt64 adds two-sided geometric noise to the specified int64 x so that
+// the output is ε-differentially private given the L_0 and L_∞ sensitivities
+// of the database.
+func (n geometricNoise) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (geometricNoise) addNoiseInt64(r rand.Source, x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	if err := checkArgsLaplace(l0Sensitivity, float64(lInfSensitivity), epsilon, delta); err != nil {
+		return 0, err
+	}
+	return x + sampleGeometric(r, l0Sensitivity, lInfSensitivity, epsilon), nil
+}
+
+// Threshold returns the smallest threshold k to use in a differentially private
+// histogram with added geometric noise.
+//
+// The threshold is derived from the one of Laplace, using that the tails of
+// the two-sided geometric distribution with parameter exp(-ε/Δ) are bounded by
+// the tails of the Laplace distribution with scale Δ/ε shifted by one unit.
+func (geometricNoise) Threshold(l0Sensitivity int64, lInfSensitivity, epsilon, noiseDelta, thresholdDelta float64) (float64, error) {
+	k, err := laplace{}.Threshold(l0Sensitivity, lInfSensitivity, epsilon, noiseDelta, thresholdDelta)
+	if err != nil {
+		return 0, err
+	}
+	return k + 1, nil
+}
+
+// DeltaForThreshold is the inverse operation of Threshold: given the
+// parameters and a threshold, it returns the delta induced by thresholding.
+func (geometricNoise) DeltaForThreshold(l0Sensitivity int64, lInfSensitivity, epsilon, delta, threshold float64) (float64, error) {
+	return laplace{}.DeltaForThreshold(l0Sensitivity, lInfSensitivity, epsilon, delta, threshold-1)
+}
+
+// ComputeConfidenceIntervalInt64 computes a confidence interval that contains the raw integer value x from which int64 noisedX
+// is computed with a probability greater or equal to 1 - alpha based on the specified geometric noise parameters.
+func (geometricNoise) ComputeConfidenceIntervalInt64(noisedX, l0Sensitivity, lInfSensitivity int64, epsilon, delta, alpha float64) (ConfidenceInterval, error) {
+	confInt, err := laplace{}.ComputeConfidenceIntervalInt64(noisedX, l0Sensitivity, lInfSensitivity, epsilon, delta, alpha)
+	if err != nil {
+		return ConfidenceInterval{}, err
+	}
+	// Widen the interval by one on each side, following the tail bound used in Threshold.
+	lowerBound := nextSmallerFloat64(int64(confInt.LowerBound) - 1)
+	upperBound := nextLargerFloat64(int64(confInt.UpperBound) + 1)
+	return ConfidenceInterval{LowerBound: lowerBound, UpperBound: upperBound}, nil
+}
+
+// ComputeConfidenceIntervalFloat64 computes a confidence interval that contains the raw value x from which float64
+// noisedX is computed with a probability equal to 1 - alpha, see Laplace.
+func (geometricNoise) ComputeConfidenceIntervalFloat64(noisedX float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta, alpha float64) (ConfidenceInterval, error) {
+	return laplace{}.ComputeConfidenceIntervalFloat64(noisedX, l0Sensitivity, lInfSensitivity, epsilon, delta, alpha)
+}
+
+// Granularity returns the granularity of the outputs of AddNoiseFloat64, see
+// Granular.
+func (geometricNoise) Granularity(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return laplace{}.Granularity(l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (geometricNoise) String() string {
+	return "Geometric Noise"
+}
+
+// sampleGeometric returns a sample from the two-sided geometric distribution
+// over the integers where the probability of k is proportional to
+// exp(-ε·|k|/(l0·lInf)).
+//
+// ε is converted exactly into a rational number p/q, so that
+// ε/(l0·lInf) = p/(q·l0·lInf) can be passed to sampleDiscreteLaplace as a
+// ratio of integers.
+func sampleGeometric(r rand.Source, l0Sensitivity, lInfSensitivity int64, epsilon float64) int64 {
+	eps := new(big.Rat).SetFloat64(epsilon)
+	t := new(big.Int).Mul(big.NewInt(l0Sensitivity), big.NewInt(lInfSensitivity))
+	t.Mul(t, eps.Denom())
+	// The probability of the sample exceeding the int64 range is negligible for
+	// any ε that checkArgsLaplace accepts.
+	return sampleDiscreteLaplace(r, eps.Num(), t).Int64()
+}
@@ -0,0 +1,163 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/rand"
+	"github.com/grd/stat"
+)
+
+func TestSampleGeometricStatistics(t *testing.T) {
+	const numberOfSamples = 50000
+	for _, tc := range []struct {
+		l0, lInf int64
+		epsilon  float64
+	}{
+		{1, 1, ln3},
+		{1, 1, 0.1},
+		{2, 3, 1},
+	} {
+		samples := make(stat.Float64Slice, numberOfSamples)
+		for i := 0; i < numberOfSamples; i++ {
+			samples[i] = float64(sampleGeometric(rand.Default(), tc.l0, tc.lInf, tc.epsilon))
+		}
+		// The two-sided geometric distribution with parameter p = exp(-ε/Δ) has
+		// variance 2p/(1-p)².
+		p := math.Exp(-tc.epsilon / float64(tc.l0*tc.lInf))
+		wantVariance := 2 * p / ((1 - p) * (1 - p))
+		sampleMean, sampleVariance := stat.Mean(samples), stat.Variance(samples)
+		if !nearEqual(sampleMean, 0, 5*math.Sqrt(wantVariance/numberOfSamples)) {
+			t.Errorf("sampleGeometric(%+v): got mean = %f, want 0", tc, sampleMean)
+		}
+		if !nearEqual(sampleVariance, wantVariance, 0.05*wantVariance) {
+			t.Errorf("sampleGeometric(%+v): got variance = %f, want %f", tc, sampleVariance, wantVariance)
+		}
+	}
+}
+
+func TestSampleGeometricProbabilityOfZero(t *testing.T) {
+	const numberOfSamples = 100000
+	// With ε = ln(3) and Δ = 1, Pr[0] = (1-p)/(1+p) = 1/2 for p = 1/3.
+	var zeros int
+	for i := 0; i < numberOfSamples; i++ {
+		if sampleGeometric(rand.Default(), 1, 1, ln3) == 0 {
+			zeros++
+		}
+	}
+	if got := float64(zeros) / numberOfSamples; !nearEqual(got, 0.5, 5*math.Sqrt(0.25/numberOfSamples)) {
+		t.Errorf("sampleGeometric: got Pr[0] = %f, want 0.5", got)
+	}
+}
+
+func TestGeometricAddNoiseInt64(t *testing.T) {
+	const numberOfSamples = 20000
+	g := Geometric()
+	samples := make(stat.Float64Slice, numberOfSamples)
+	for i := 0; i < numberOfSamples; i++ {
+		noised, err := g.AddNoiseInt64(1000, 1, 1, ln3, 0)
+		if err != nil {
+			t.Fatalf("AddNoiseInt64: got error %v", err)
+		}
+		samples[i] = float64(noised)
+	}
+	// p = 1/3, so the variance is 2p/(1-p)² = 1.5.
+	const wantVariance = 1.5
+	sampleMean, sampleVariance := stat.Mean(samples), stat.Variance(samples)
+	if !nearEqual(sampleMean, 1000, 5*math.Sqrt(wantVariance/numberOfSamples)) {
+		t.Errorf("AddNoiseInt64: got mean = %f, want 1000", sampleMean)
+	}
+	if !nearEqual(sampleVariance, wantVariance, 0.05*wantVariance) {
+		t.Errorf("AddNoiseInt64: got variance = %f, want %f", sampleVariance, wantVariance)
+	}
+}
+
+func TestGeometricArgumentChecks(t *testing.T) {
+	g := Geometric()
+	for _, tc := range []struct {
+		desc            string
+		l0Sensitivity   int64
+		lInfSensitivity int64
+		epsilon, delta  float64
+	}{
+		{"non-zero delta", 1, 1, ln3, 1e-10},
+		{"negative epsilon", 1, 1, -1, 0},
+		{"zero l0 sensitivity", 0, 1, ln3, 0},
+		{"negative lInf sensitivity", 1, -1, ln3, 0},
+	} {
+		if _, err := g.AddNoiseInt64(0, tc.l0Sensitivity, tc.lInfSensitivity, tc.epsilon, tc.delta); err == nil {
+			t.Errorf("AddNoiseInt64: when %s got no error, want error", tc.desc)
+		}
+		if _, err := g.AddNoiseFloat64(0, tc.l0Sensitivity, float64(tc.lInfSensitivity), tc.epsilon, tc.delta); err == nil {
+			t.Errorf("AddNoiseFloat64: when %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestThresholdGeometric(t *testing.T) {
+	got, err := Geometric().Threshold(1, 1, ln3, 0, 1e-10)
+	if err != nil {
+		t.Fatalf("Threshold: got error %v", err)
+	}
+	want, err := Laplace().Threshold(1, 1, ln3, 0, 1e-10)
+	if err != nil {
+		t.Fatalf("Threshold: got error %v", err)
+	}
+	if got != want+1 {
+		t.Errorf("Threshold: got %f, want %f", got, want+1)
+	}
+	delta, err := Geometric().(geometricNoise).DeltaForThreshold(1, 1, ln3, 0, got)
+	if err != nil {
+		t.Fatalf("DeltaForThreshold: got error %v", err)
+	}
+	if !nearEqual(delta, 1e-10, 1e-13) {
+		t.Errorf("DeltaForThreshold(Threshold(δ = 1e-10)): got %e, want 1e-10", delta)
+	}
+}
+
+func TestComputeConfidenceIntervalInt64Geometric(t *testing.T) {
+	got, err := Geometric().ComputeConfidenceIntervalInt64(100, 1, 1, ln3, 0, 0.1)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceIntervalInt64: got error %v", err)
+	}
+	laplaceConfInt, err := Laplace().ComputeConfidenceIntervalInt64(100, 1, 1, ln3, 0, 0.1)
+	if err != nil {
+		t.Fatalf("ComputeConfidenceIntervalInt64: got error %v", err)
+	}
+	want := ConfidenceInterval{LowerBound: laplaceConfInt.LowerBound - 1, UpperBound: laplaceConfInt.UpperBound + 1}
+	if got != want {
+		t.Errorf("ComputeConfidenceIntervalInt64: got %+v, want %+v", got, want)
+	}
+}
+
+func TestGeometricKind(t *testing.T) {
+	if got := ToKind(Geometric()); got != GeometricNoise {
+		t.Errorf("ToKind(Geometric()): got %v, want %v", got, GeometricNoise)
+	}
+	if got := ToNoise(GeometricNoise); got != Geometric() {
+		t.Errorf("ToNoise(GeometricNoise): got %v, want %v", got, Geometric())
+	}
+	n, err := WithSource(Geometric(), rand.Default())
+	if err != nil {
+		t.Fatalf("WithSource(Geometric()): got error %v", err)
+	}
+	if got := ToKind(n); got != GeometricNoise {
+		t.Errorf("ToKind(WithSource(Geometric())): got %v, want %v", got, GeometricNoise)
+	}
+}
@@ -50,6 +50,13 @@ type laplace struct{}
 // unintentional privacy leaks due to artifacts of floating point arithmetic. See
 // https://github.com/google/differential-privacy/blob/main/common_docs/Secure_Noise_Generation.pdf
 // for more information.
+//
+// Outputs of AddNoiseFloat64 are multiples of a power of two granularity, which is
+// the smallest one that is at least λ/2⁴⁰ where λ = l0·lInf/ε is the scale of the
+// noise, see Granularity. The returned Noise implements Granular.
+//
+// Random numbers are drawn from rand.Default(). Use WithSource to draw them
+// from another rand.Source, e.g. a seeded one for reproducible simulations.
 func Laplace() Noise {
 	return laplace{}
 }
@@ -57,21 +64,29 @@ func Laplace() Noise {
 // AddNoiseFloat64 adds Laplace noise to the specified float64 x so that the
 // output is ε-differentially private given the L_0 and L_∞ sensitivities of the
 // database.
-func (laplace) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+func (n laplace) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (laplace) addNoiseFloat64(r rand.Source, x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
 	if err := checkArgsLaplace(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
 		return 0, err
 	}
-	return addLaplaceFloat64(x, epsilon, lInfSensitivity*float64(l0Sensitivity) /* l1Sensitivity */), nil
+	return addLaplaceFloat64(r, x, epsilon, lInfSensitivity*float64(l0Sensitivity) /* l1Sensitivity */), nil
 }
 
 // AddNoiseInt64 adds Laplace noise to the specified int64 x so that the
 // output is ε-differentially private given the L_0 and L_∞ sensitivities of the
 // database.
-func (laplace) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+func (n laplace) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(rand.Default(), x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (laplace) addNoiseInt64(r rand.Source, x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
 	if err := checkArgsLaplace(l0Sensitivity, float64(lInfSensitivity), epsilon, delta); err != nil {
 		return 0, err
 	}
-	return addLaplaceInt64(x, epsilon, lInfSensitivity*l0Sensitivity /* l1Sensitivity */), nil
+	return addLaplaceInt64(r, x, epsilon, lInfSensitivity*l0Sensitivity /* l1Sensitivity */), nil
 }
 
 // Threshold returns the smallest threshold k to use in a differentially private
@@ -189,6 +204,21 @@ func (laplace) ComputeConfidenceIntervalFloat64(noisedX float64, l0Sensitivity i
 	return computeConfidenceIntervalLaplace(noisedX, lambda, alpha), nil
 }
 
+// Granularity returns the granularity of the outputs of AddNoiseFloat64, see
+// Granular.
+func (laplace) Granularity(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	if err := checkArgsLaplace(l0Sensitivity, lInfSensitivity, epsilon, delta); err != nil {
+		return 0, err
+	}
+	return laplaceGranularity(epsilon, lInfSensitivity*float64(l0Sensitivity)), nil
+}
+
+// laplaceGranularity returns the power of two granularity of Laplace noise
+// with scale l1Sensitivity/ε.
+func laplaceGranularity(epsilon, l1Sensitivity float64) float64 {
+	return ceilPowerOfTwo((l1Sensitivity / epsilon) / granularityParam)
+}
+
 func (laplace) String() string {
 	return "Laplace Noise"
 }
@@ -215,17 +245,17 @@ func checkArgsConfidenceIntervalLaplace(l0Sensitivity int64, lInfSensitivity, ep
 
 // addLaplaceFloat64 adds Laplace noise scaled to the given epsilon and l1Sensitivity to the
 // specified float64
-func addLaplaceFloat64(x, epsilon, l1Sensitivity float64) float64 {
-	granularity := ceilPowerOfTwo((l1Sensitivity / epsilon) / granularityParam)
-	sample := twoSidedGeometric(granularity * epsilon / (l1Sensitivity + granularity))
+func addLaplaceFloat64(r rand.Source, x, epsilon, l1Sensitivity float64) float64 {
+	granularity := laplaceGranularity(epsilon, l1Sensitivity)
+	sample := twoSidedGeometric(r, granularity * epsilon / (l1Sensitivity + granularity))
 	return roundToMultipleOfPowerOfTwo(x, granularity) + float64(sample)*granularity
 }
 
 // addLaplaceInt64 adds Laplace noise scaled to the given epsilon and l1Sensitivity to the
 // specified int64
-func addLaplaceInt64(x int64, epsilon float64, l1Sensitivity int64) int64 {
-	granularity := ceilPowerOfTwo((float64(l1Sensitivity) / epsilon) / granularityParam)
-	sample := twoSidedGeometric(granularity * epsilon / (float64(l1Sensitivity) + granularity))
+func addLaplaceInt64(r rand.Source, x int64, epsilon float64, l1Sensitivity int64) int64 {
+	granularity := laplaceGranularity(epsilon, float64(l1Sensitivity))
+	sample := twoSidedGeometric(r, granularity * epsilon / (float64(l1Sensitivity) + granularity))
 	if granularity < 1 {
 		return x + int64(math.Round(float64(sample)*granularity))
 	}
@@ -271,9 +301,9 @@ func inverseCDFLaplace(lambda, p float64) float64 {
 //
 // Note that to ensure that a truncation happens with probability less than 10⁻⁶,
 // λ must be greater than 2⁻⁵⁹.
-func geometric(lambda float64) int64 {
+func geometric(r rand.Source, lambda float64) int64 {
 	// Return truncated sample in the case that the sample exceeds the max int64.
-	if rand.Uniform() > -1.0*math.Expm1(-1.0*lambda*math.MaxInt64) {
+	if r.Uniform() > -1.0*math.Expm1(-1.0*lambda*math.MaxInt64) {
 		return math.MaxInt64
 	}
 
@@ -305,7 +335,7 @@ func geometric(lambda float64) int64 {
 		//   q = Pr[X ≤ mid | left < X ≤ right]
 		// where X denotes the sample. The value of q should be approximately one half.
 		q := math.Expm1(lambda*float64(left-mid)) / math.Expm1(lambda*float64(left-right))
-		if rand.Uniform() <= q {
+		if r.Uniform() <= q {
 			right = mid
 		} else {
 			left = mid
@@ -318,14 +348,14 @@ func geometric(lambda float64) int64 {
 // mirrored at 0. The non-negative part of the distribution's PDF matches
 // the PDF of a geometric distribution of parameter p = 1 - e^-λ that is
 // shifted to the left by 1 and scaled accordingly.
-func twoSidedGeometric(lambda float64) int64 {
+func twoSidedGeometric(r rand.Source, lambda float64) int64 {
 	var sample int64 = 0
 	var sign int64 = -1
 	// Keep a sample of 0 only if the sign is positive. Otherwise, the
 	// probability of 0 would be twice as high as it should be.
 	for sample == 0 && sign == -1 {
-		sample = geometric(lambda) - 1
-		sign = int64(rand.Sign())
+		sample = geometric(r, lambda) - 1
+		sign = int64(r.Sign())
 	}
 	return sample * sign
 }
@@ -21,6 +21,7 @@ import (
 	"math/rand"
 	"testing"
 
+	dprand "github.com/google/differential-privacy/go/rand"
 	"github.com/grd/stat"
 )
 
@@ -172,7 +173,7 @@ func TestAddLaplaceFloat64RoundsToGranularity(t *testing.T) {
 		for i := 0; i < numberOfTrials; i++ {
 			// the input x of addLaplaceFloat64 can be arbitrary
 			x := rand.Float64()*tc.wantGranularity*10 - tc.wantGranularity*5
-			noisedX := addLaplaceFloat64(x, tc.epsilon, tc.l1Sensitivity)
+			noisedX := addLaplaceFloat64(dprand.Default(), x, tc.epsilon, tc.l1Sensitivity)
 			if math.Round(noisedX/tc.wantGranularity) != noisedX/tc.wantGranularity {
 				t.Errorf("Got noised x: %f, not a multiple of: %f", noisedX, tc.wantGranularity)
 				break
@@ -218,7 +219,7 @@ func TestAddLaplaceInt64RoundsToGranularity(t *testing.T) {
 			// the input x of addLaplaceInt64 can be arbitrary but should cover all congruence
 			// classes of the anticipated granularity
 			x := rand.Int63n(tc.wantGranularity*10) - tc.wantGranularity*5
-			noisedX := addLaplaceInt64(x, tc.epsilon, tc.l1Sensitivity)
+			noisedX := addLaplaceInt64(dprand.Default(), x, tc.epsilon, tc.l1Sensitivity)
 			if noisedX%tc.wantGranularity != 0 {
 				t.Errorf("Got noised x: %d, not devisible by: %d", noisedX, tc.wantGranularity)
 				break
@@ -857,7 +858,7 @@ func TestGeometricStatistics(t *testing.T) {
 	} {
 		geometricSamples := make(stat.IntSlice, numberOfSamples)
 		for i := 0; i < numberOfSamples; i++ {
-			geometricSamples[i] = geometric(tc.lambda)
+			geometricSamples[i] = geometric(dprand.Default(), tc.lambda)
 		}
 		sampleMean := stat.Mean(geometricSamples)
 		// Assuming that the geometric samples are distributed according to the specified lambda, the
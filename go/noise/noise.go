@@ -18,9 +18,11 @@
 package noise
 
 import (
+	"fmt"
 	"math"
 
 	log "github.com/golang/glog"
+	"github.com/google/differential-privacy/go/rand"
 )
 
 // Kind is an enum type. Its values are the supported noise distributions types
@@ -32,15 +34,27 @@ const (
 	GaussianNoise Kind = iota
 	LaplaceNoise
 	Unrecognised
+	// New kinds are added after Unrecognised so that the values of existing kinds,
+	// which are part of serialized aggregations, don't change.
+	DiscreteGaussianNoise
+	GeometricNoise
 )
 
-// ToNoise converts a Kind into a Noise instance.
+// ToNoise converts a Kind into a Noise instance, including the Kinds of noise
+// registered with Register.
 func ToNoise(k Kind) Noise {
+	if n, ok := registeredNoise(k); ok {
+		return n
+	}
 	switch k {
 	case GaussianNoise:
 		return Gaussian()
 	case LaplaceNoise:
 		return Laplace()
+	case DiscreteGaussianNoise:
+		return DiscreteGaussian()
+	case GeometricNoise:
+		return Geometric()
 	case Unrecognised:
 		log.Warningf("ToNoise: Unrecognised noise specified, returning nil")
 	default:
@@ -49,13 +63,28 @@ func ToNoise(k Kind) Noise {
 	return nil
 }
 
-// ToKind converts a Noise instance into a Kind.
+// ToKind converts a Noise instance into a Kind, including noise registered with
+// Register.
 func ToKind(n Noise) Kind {
+	if sn, ok := n.(sourced); ok {
+		n = sn.sampler
+	}
+	if k, ok := registeredKind(n); ok {
+		return k
+	}
+	if _, ok := n.(FixedScale); ok {
+		// The scale of the noise can't be represented by a Kind.
+		return Unrecognised
+	}
 	switch n {
 	case Gaussian():
 		return GaussianNoise
 	case Laplace():
 		return LaplaceNoise
+	case DiscreteGaussian():
+		return DiscreteGaussianNoise
+	case Geometric():
+		return GeometricNoise
 	case nil:
 		log.Warningf("ToKind: nil noise specified, returning Unresognised")
 	default:
@@ -64,6 +93,56 @@ func ToKind(n Noise) Kind {
 	return Unrecognised
 }
 
+// NeedsDelta returns whether noise of kind k requires a strictly positive δ,
+// i.e. whether it is Gaussian or discrete Gaussian noise. Aggregations use it
+// to decide whether to split δ between the noise and thresholding.
+func NeedsDelta(k Kind) bool {
+	return k == GaussianNoise || k == DiscreteGaussianNoise
+}
+
+// WithSource returns a Noise of the same kind as n, drawing its random numbers
+// from r instead of rand.Default(), e.g. a rand.Rand so that the noise can be
+// reproduced from its seed, or a source returned by rand.NewReaderSource for a
+// user-provided random number generator. n must be Laplace, Gaussian, discrete
+// Gaussian or geometric noise. The returned Noise can be used in the options of
+// any aggregation, and implements Granular.
+func WithSource(n Noise, r rand.Source) (Noise, error) {
+	if r == nil {
+		return nil, fmt.Errorf("WithSource: r is nil")
+	}
+	if sn, ok := n.(sourced); ok {
+		n = sn.sampler
+	}
+	s, ok := n.(sampler)
+	if !ok {
+		return nil, fmt.Errorf("WithSource: noise %v is not supported", n)
+	}
+	return sourced{sampler: s, r: r}, nil
+}
+
+// sampler is implemented by the noise types that can draw their random numbers
+// from any rand.Source.
+type sampler interface {
+	Noise
+	Granular
+	addNoiseFloat64(r rand.Source, x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error)
+	addNoiseInt64(r rand.Source, x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error)
+}
+
+// sourced is a Noise drawing its random numbers from r, see WithSource.
+type sourced struct {
+	sampler
+	r rand.Source
+}
+
+func (n sourced) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	return n.addNoiseFloat64(n.r, x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
+func (n sourced) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	return n.addNoiseInt64(n.r, x, l0Sensitivity, lInfSensitivity, epsilon, delta)
+}
+
 // ConfidenceInterval holds lower and upper bounds as float64 for the confidence interval.
 type ConfidenceInterval struct {
 	LowerBound, UpperBound float64
@@ -127,3 +206,24 @@ type Noise interface {
 	// noisedX is computed with a probability equal to 1 - alpha based on the specified noise parameters.
 	ComputeConfidenceIntervalFloat64(noisedX float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta, alpha float64) (ConfidenceInterval, error)
 }
+
+// Granular is implemented by Noise instances whose AddNoiseFloat64 outputs are
+// multiples of a power of two, the granularity. Both the input and the noise
+// are snapped to that grid, and the noise is sampled from a discrete
+// distribution over it rather than with floating point arithmetic. This makes
+// the noise robust against the floating point attack of Mironov's "On
+// Significance of the Least Significant Bits For Differential Privacy"
+// (https://www.microsoft.com/en-us/research/wp-content/uploads/2012/10/lsbs.pdf),
+// in which the low order bits of noisy outputs reveal the input.
+//
+// AddNoiseInt64 only uses integer arithmetic, so it is not affected by the
+// attack.
+//
+// Laplace, Gaussian, DiscreteGaussian and Geometric noise implement Granular.
+type Granular interface {
+	// Granularity returns the granularity of the outputs of AddNoiseFloat64
+	// called with the same parameters. Inputs are rounded to a multiple of the
+	// granularity, so an output can differ from the noiseless input by up to
+	// half the granularity even if the noise is 0.
+	Granularity(l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error)
+}
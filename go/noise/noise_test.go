@@ -19,6 +19,8 @@ package noise
 import (
 	"math"
 	"testing"
+
+	"github.com/google/differential-privacy/go/rand"
 )
 
 var (
@@ -47,6 +49,32 @@ func BenchmarkLaplaceFloat64(b *testing.B) {
 	benchResultFloat64 = r
 }
 
+// Noise is added to every released value, so adding noise must not allocate.
+func TestAddNoiseDoesNotAllocate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		noise Noise
+		delta float64
+	}{
+		{"Laplace", lap, 0},
+		{"Gaussian", gauss, 1e-5},
+	} {
+		addFloat64 := func() {
+			benchResultFloat64, _ = tc.noise.AddNoiseFloat64(42, 1, 1, ln3, tc.delta)
+		}
+		if allocs := testing.AllocsPerRun(100, addFloat64); allocs != 0 {
+			t.Errorf("%s.AddNoiseFloat64: got %f allocations per call, want 0", tc.name, allocs)
+		}
+		addInt64 := func() {
+			r, _ := tc.noise.AddNoiseInt64(42, 1, 1, ln3, tc.delta)
+			benchResultFloat64 = float64(r)
+		}
+		if allocs := testing.AllocsPerRun(100, addInt64); allocs != 0 {
+			t.Errorf("%s.AddNoiseInt64: got %f allocations per call, want 0", tc.name, allocs)
+		}
+	}
+}
+
 func approxEqual(a, b float64) bool {
 	maxMagnitude := math.Max(math.Abs(a), math.Abs(b))
 	if math.IsInf(maxMagnitude, +1) {
@@ -54,3 +82,153 @@ func approxEqual(a, b float64) bool {
 	}
 	return math.Abs(a-b) <= 1e-6*maxMagnitude
 }
+
+func TestNeedsDelta(t *testing.T) {
+	for _, tc := range []struct {
+		kind Kind
+		want bool
+	}{
+		{GaussianNoise, true},
+		{DiscreteGaussianNoise, true},
+		{LaplaceNoise, false},
+		{GeometricNoise, false},
+		{Unrecognised, false},
+	} {
+		if got := NeedsDelta(tc.kind); got != tc.want {
+			t.Errorf("NeedsDelta(%v): got %t, want %t", tc.kind, got, tc.want)
+		}
+	}
+}
+
+func TestGranularity(t *testing.T) {
+	for _, tc := range []struct {
+		n     Noise
+		delta float64
+	}{
+		{Laplace(), 0},
+		{Gaussian(), 1e-5},
+		{DiscreteGaussian(), 1e-5},
+	} {
+		g, ok := tc.n.(Granular)
+		if !ok {
+			t.Fatalf("%v noise doesn't implement Granular", tc.n)
+		}
+		for _, lInf := range []float64{1e-6, 1, 1e6} {
+			granularity, err := g.Granularity(1, lInf, ln3, tc.delta)
+			if err != nil {
+				t.Fatalf("%v.Granularity: got error %v", tc.n, err)
+			}
+			if exp := math.Log2(granularity); exp != math.Round(exp) {
+				t.Errorf("%v.Granularity(1, %f, ln3, %e) = %e, want a power of two", tc.n, lInf, tc.delta, granularity)
+			}
+			for i := 0; i < 100; i++ {
+				got, err := tc.n.AddNoiseFloat64(math.Pi*lInf, 1, lInf, ln3, tc.delta)
+				if err != nil {
+					t.Fatalf("%v.AddNoiseFloat64: got error %v", tc.n, err)
+				}
+				if r := got / granularity; r != math.Round(r) {
+					t.Errorf("%v.AddNoiseFloat64(π·%f, 1, %f, ln3, %e) = %e, want a multiple of the granularity %e", tc.n, lInf, lInf, tc.delta, got, granularity)
+				}
+			}
+		}
+		if _, err := g.Granularity(1, 1, -1, tc.delta); err == nil {
+			t.Errorf("%v.Granularity with negative epsilon: got no error", tc.n)
+		}
+	}
+}
+
+func TestWithSourceIsReproducible(t *testing.T) {
+	seed := rand.NewSeed()
+	for _, tc := range []struct {
+		n     Noise
+		delta float64
+	}{
+		{Laplace(), 0},
+		{Gaussian(), 1e-5},
+		{DiscreteGaussian(), 1e-5},
+	} {
+		n := tc.n
+		r1, err := rand.NewRand(seed)
+		if err != nil {
+			t.Fatalf("NewRand: got error %v", err)
+		}
+		r2, err := rand.NewRand(seed)
+		if err != nil {
+			t.Fatalf("NewRand: got error %v", err)
+		}
+		n1, err := WithSource(n, r1)
+		if err != nil {
+			t.Fatalf("WithSource(%v): got error %v", n, err)
+		}
+		n2, err := WithSource(n, r2)
+		if err != nil {
+			t.Fatalf("WithSource(%v): got error %v", n, err)
+		}
+		if got, want := ToKind(n1), ToKind(n); got != want {
+			t.Errorf("ToKind(WithSource(%v)): got %v, want %v", n, got, want)
+		}
+		for i := 0; i < 10; i++ {
+			a, err := n1.AddNoiseInt64(0, 1, 1, ln3, tc.delta)
+			if err != nil {
+				t.Fatalf("AddNoiseInt64 with %v: got error %v", n, err)
+			}
+			b, err := n2.AddNoiseInt64(0, 1, 1, ln3, tc.delta)
+			if err != nil {
+				t.Fatalf("AddNoiseInt64 with %v: got error %v", n, err)
+			}
+			if a != b {
+				t.Errorf("AddNoiseInt64 with %v seeded twice with the same seed: got %d and %d, want equal values", n, a, b)
+			}
+		}
+	}
+}
+
+func TestWithSourceIsGranular(t *testing.T) {
+	for _, tc := range []struct {
+		n     Noise
+		delta float64
+	}{
+		{Laplace(), 0},
+		{Gaussian(), 1e-5},
+		{DiscreteGaussian(), 1e-5},
+	} {
+		sn, err := WithSource(tc.n, rand.Default())
+		if err != nil {
+			t.Fatalf("WithSource(%v): got error %v", tc.n, err)
+		}
+		g, ok := sn.(Granular)
+		if !ok {
+			t.Fatalf("WithSource(%v) doesn't implement Granular", tc.n)
+		}
+		got, err := g.Granularity(1, 1, ln3, tc.delta)
+		if err != nil {
+			t.Fatalf("Granularity of WithSource(%v): got error %v", tc.n, err)
+		}
+		want, err := tc.n.(Granular).Granularity(1, 1, ln3, tc.delta)
+		if err != nil {
+			t.Fatalf("Granularity of %v: got error %v", tc.n, err)
+		}
+		if got != want {
+			t.Errorf("Granularity of WithSource(%v): got %v, want %v", tc.n, got, want)
+		}
+	}
+}
+
+func TestWithSourceInvalid(t *testing.T) {
+	r, err := rand.NewRand(rand.NewSeed())
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		n    Noise
+		r    rand.Source
+	}{
+		{"nil source", Laplace(), nil},
+		{"nil noise", nil, r},
+	} {
+		if _, err := WithSource(tc.n, tc.r); err == nil {
+			t.Errorf("WithSource with %s: got no error, want error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+)
+
+// Kinds of registered noise are above customKindBase, so that they never
+// collide with the kinds of this package, and below customKindBase +
+// customKindRange, so that they fit in a 32-bit int.
+const (
+	customKindBase  = 1 << 16
+	customKindRange = 1 << 24
+)
+
+// registered is a Noise registered with Register.
+type registered struct {
+	name  string
+	noise Noise
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[Kind]registered)
+)
+
+// Register registers n, a custom Noise implementation, under the given name,
+// and returns its Kind. Afterwards, ToKind returns the Kind for n and ToNoise
+// returns n for the Kind, so that aggregations using n can be serialized and
+// deserialized like aggregations using the noise of this package.
+//
+// The Kind is derived from the name only, so that it is the same in every
+// process registering n under the same name, regardless of the order of
+// registrations; register custom noise in an init function of the package
+// defining it. Registering the same name and Noise again returns the same
+// Kind. Register returns an error if the name is empty, if n is a noise of
+// this package, if another Noise is registered under the name or under a name
+// with the same Kind, or if n can't be compared with ==, which ToKind relies
+// on.
+//
+// Aggregations can't check the overflow behavior of custom noise, and treat
+// it as unrecognised noise when checking their bounds, see IsBuiltin.
+func Register(name string, n Noise) (Kind, error) {
+	if name == "" {
+		return Unrecognised, fmt.Errorf("Register: name must be non-empty")
+	}
+	if n == nil {
+		return Unrecognised, fmt.Errorf("Register: noise %q is nil", name)
+	}
+	if _, ok := n.(sourced); ok {
+		return Unrecognised, fmt.Errorf("Register: noise %q is a noise of this package", name)
+	}
+	switch n {
+	case Gaussian(), Laplace(), DiscreteGaussian(), Geometric():
+		return Unrecognised, fmt.Errorf("Register: noise %q is a noise of this package", name)
+	}
+	if !reflect.TypeOf(n).Comparable() {
+		return Unrecognised, fmt.Errorf("Register: noise %q of type %T is not comparable", name, n)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	k := Kind(customKindBase + int(h.Sum32()%customKindRange))
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if r, ok := registry[k]; ok {
+		if r.name == name && r.noise == n {
+			return k, nil
+		}
+		if r.name == name {
+			return Unrecognised, fmt.Errorf("Register: another noise is already registered as %q", name)
+		}
+		return Unrecognised, fmt.Errorf("Register: the kind of noise %q collides with the kind of noise %q, use another name", name, r.name)
+	}
+	registry[k] = registered{name: name, noise: n}
+	return k, nil
+}
+
+// KindByName returns the Kind of the noise registered under the given name,
+// and whether there is one.
+func KindByName(name string) (Kind, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for k, r := range registry {
+		if r.name == name {
+			return k, true
+		}
+	}
+	return Unrecognised, false
+}
+
+// RegisteredName returns the name under which the noise of Kind k was
+// registered, and whether k is the Kind of a registered noise.
+func RegisteredName(k Kind) (string, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[k]
+	return r.name, ok
+}
+
+// IsBuiltin returns whether k is the Kind of a noise of this package, i.e.
+// neither Unrecognised nor the Kind of a registered noise.
+func IsBuiltin(k Kind) bool {
+	switch k {
+	case GaussianNoise, LaplaceNoise, DiscreteGaussianNoise, GeometricNoise:
+		return true
+	}
+	return false
+}
+
+// registeredNoise returns the noise registered with Kind k, if any.
+func registeredNoise(k Kind) (Noise, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[k]
+	return r.noise, ok
+}
+
+// registeredKind returns the Kind of n if it was registered.
+func registeredKind(n Noise) (Kind, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for k, r := range registry {
+		// The comparison can't panic: registered noise is comparable, and values
+		// of different dynamic types are unequal.
+		if r.noise == n {
+			return k, true
+		}
+	}
+	return Unrecognised, false
+}
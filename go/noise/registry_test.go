@@ -0,0 +1,110 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"testing"
+)
+
+// customNoise is a Noise that isn't part of this package.
+type customNoise struct {
+	Noise
+	scale int
+}
+
+// uncomparableNoise is a Noise that can't be compared with ==.
+type uncomparableNoise struct {
+	Noise
+	scales []float64
+}
+
+func TestRegister(t *testing.T) {
+	n := customNoise{Noise: Laplace(), scale: 1}
+	k, err := Register("test_custom_noise", n)
+	if err != nil {
+		t.Fatalf("Register: got error %v", err)
+	}
+	if IsBuiltin(k) || k == Unrecognised {
+		t.Errorf("Register: got kind %v, want a custom kind", k)
+	}
+	if got := ToKind(n); got != k {
+		t.Errorf("ToKind: got %v, want %v", got, k)
+	}
+	if got := ToNoise(k); got != n {
+		t.Errorf("ToNoise: got %v, want %v", got, n)
+	}
+	if got, ok := KindByName("test_custom_noise"); !ok || got != k {
+		t.Errorf("KindByName: got (%v, %t), want (%v, true)", got, ok, k)
+	}
+	if got, ok := RegisteredName(k); !ok || got != "test_custom_noise" {
+		t.Errorf("RegisteredName: got (%q, %t), want (\"test_custom_noise\", true)", got, ok)
+	}
+	// Registering again is a no-op.
+	if got, err := Register("test_custom_noise", n); err != nil || got != k {
+		t.Errorf("Register again: got (%v, %v), want (%v, nil)", got, err, k)
+	}
+	// Noise of the same type but with other parameters isn't registered.
+	if got := ToKind(customNoise{Noise: Laplace(), scale: 2}); got != Unrecognised {
+		t.Errorf("ToKind of unregistered noise: got %v, want Unrecognised", got)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	if _, err := Register("test_taken_noise", customNoise{scale: 3}); err != nil {
+		t.Fatalf("Register: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		name string
+		n    Noise
+	}{
+		{"empty name", "", customNoise{scale: 4}},
+		{"nil noise", "test_nil_noise", nil},
+		{"noise of this package", "test_laplace", Laplace()},
+		{"name taken", "test_taken_noise", customNoise{scale: 5}},
+		{"uncomparable noise", "test_uncomparable_noise", uncomparableNoise{}},
+	} {
+		if _, err := Register(tc.name, tc.n); err == nil {
+			t.Errorf("Register: with %s got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestToKindIgnoresRegistryForBuiltinNoise(t *testing.T) {
+	if _, err := Register("test_other_noise", customNoise{scale: 6}); err != nil {
+		t.Fatalf("Register: got error %v", err)
+	}
+	for _, tc := range []struct {
+		n    Noise
+		want Kind
+	}{
+		{Laplace(), LaplaceNoise},
+		{Gaussian(), GaussianNoise},
+		{Geometric(), GeometricNoise},
+		{DiscreteGaussian(), DiscreteGaussianNoise},
+	} {
+		if got := ToKind(tc.n); got != tc.want {
+			t.Errorf("ToKind(%v): got %v, want %v", tc.n, got, tc.want)
+		}
+		if !IsBuiltin(tc.want) {
+			t.Errorf("IsBuiltin(%v): got false, want true", tc.want)
+		}
+	}
+	if IsBuiltin(Unrecognised) {
+		t.Errorf("IsBuiltin(Unrecognised): got true, want false")
+	}
+}
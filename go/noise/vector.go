@@ -0,0 +1,81 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/rand"
+)
+
+// AddNoiseFloat64Vector adds Gaussian noise to each coordinate of the vector
+// x, so that the output is (ε,δ)-differentially private given the L_0
+// sensitivity of the database and the L_2 sensitivity of each vector, e.g. a
+// histogram to which each privacy unit contributes at most l0Sensitivity times,
+// or a sum of gradients clipped to an L_2 norm of l2Sensitivity.
+//
+// All coordinates are noised at once with the same standard deviation, which
+// is smaller than the standard deviation needed to noise each coordinate
+// separately with AddNoiseFloat64 and compose the results, since the L_∞
+// sensitivity of each coordinate can be as large as the L_2 sensitivity of the
+// vector. The returned vector is a new slice; x isn't modified.
+func AddNoiseFloat64Vector(x []float64, l0Sensitivity int64, l2Sensitivity, epsilon, delta float64) ([]float64, error) {
+	return addNoiseFloat64Vector(rand.Default(), x, l0Sensitivity, l2Sensitivity, epsilon, delta)
+}
+
+func addNoiseFloat64Vector(r rand.Source, x []float64, l0Sensitivity int64, l2Sensitivity, epsilon, delta float64) ([]float64, error) {
+	if err := checks.CheckL0Sensitivity(l0Sensitivity); err != nil {
+		return nil, err
+	}
+	if err := checks.CheckL2Sensitivity(l2Sensitivity); err != nil {
+		return nil, err
+	}
+	if err := checks.CheckEpsilon(epsilon); err != nil {
+		return nil, err
+	}
+	if err := checks.CheckDeltaStrict(delta); err != nil {
+		return nil, err
+	}
+
+	// The L_2 sensitivity of the concatenation of the l0Sensitivity vectors a
+	// privacy unit contributes to is √l0Sensitivity·l2Sensitivity, which is what
+	// SigmaForGaussian derives from its L_0 and L_∞ sensitivities.
+	return addGaussianFloat64Vector(r, x, SigmaForGaussian(l0Sensitivity, l2Sensitivity, epsilon, delta)), nil
+}
+
+// AddGaussianNoiseFloat64Vector adds Gaussian noise with standard deviation σ
+// to each coordinate of the vector x. Unlike AddNoiseFloat64Vector, the noise
+// isn't calibrated to a privacy budget, so the caller is responsible for
+// deriving the privacy guarantee of the output from σ and the L_2 sensitivity
+// of x, e.g. with an accounting.Accountant. The returned vector is a new slice;
+// x isn't modified.
+func AddGaussianNoiseFloat64Vector(x []float64, sigma float64) ([]float64, error) {
+	if sigma <= 0 || math.IsInf(sigma, 0) || math.IsNaN(sigma) {
+		return nil, fmt.Errorf("Sigma is %f, must be strictly positive and finite", sigma)
+	}
+	return addGaussianFloat64Vector(rand.Default(), x, sigma), nil
+}
+
+func addGaussianFloat64Vector(r rand.Source, x []float64, sigma float64) []float64 {
+	noised := make([]float64, len(x))
+	for i, v := range x {
+		noised[i] = addGaussianFloat64(r, v, sigma)
+	}
+	return noised
+}
@@ -0,0 +1,142 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/differential-privacy/go/rand"
+	"github.com/grd/stat"
+)
+
+func TestAddNoiseFloat64VectorStatistics(t *testing.T) {
+	const numberOfSamples = 50000
+	x := []float64{0, 10, -5}
+	sigma := SigmaForGaussian(2, 1, ln3, 1e-5)
+	variance := sigma * sigma
+	samples := make([]stat.Float64Slice, len(x))
+	for i := range samples {
+		samples[i] = make(stat.Float64Slice, numberOfSamples)
+	}
+	for j := 0; j < numberOfSamples; j++ {
+		noised, err := AddNoiseFloat64Vector(x, 2, 1, ln3, 1e-5)
+		if err != nil {
+			t.Fatalf("Couldn't noise vector: %v", err)
+		}
+		for i, v := range noised {
+			samples[i][j] = v
+		}
+	}
+	// The tolerances are set to the 99.9995% quantiles of the anticipated
+	// distributions of the sample mean and variance, see TestGaussianStatistics.
+	meanErrorTolerance := 4.41717 * math.Sqrt(variance/numberOfSamples)
+	varianceErrorTolerance := 4.41717 * math.Sqrt2 * variance / math.Sqrt(numberOfSamples)
+	for i, want := range x {
+		if got := stat.Mean(samples[i]); !nearEqual(got, want, meanErrorTolerance) {
+			t.Errorf("AddNoiseFloat64Vector: got mean %f for coordinate %d, want %f", got, i, want)
+		}
+		if got := stat.Variance(samples[i]); !nearEqual(got, variance, varianceErrorTolerance) {
+			t.Errorf("AddNoiseFloat64Vector: got variance %f for coordinate %d, want %f", got, i, variance)
+		}
+	}
+}
+
+func TestAddNoiseFloat64VectorDoesNotModifyInput(t *testing.T) {
+	x := []float64{1, 2, 3}
+	noised, err := AddNoiseFloat64Vector(x, 1, 1, ln3, 1e-5)
+	if err != nil {
+		t.Fatalf("AddNoiseFloat64Vector: got error %v", err)
+	}
+	if len(noised) != len(x) {
+		t.Errorf("AddNoiseFloat64Vector: got %d coordinates, want %d", len(noised), len(x))
+	}
+	if x[0] != 1 || x[1] != 2 || x[2] != 3 {
+		t.Errorf("AddNoiseFloat64Vector: got input modified to %v, want [1 2 3]", x)
+	}
+}
+
+func TestAddNoiseFloat64VectorIsReproducible(t *testing.T) {
+	seed := rand.NewSeed()
+	x := []float64{1, 2, 3}
+	var results [2][]float64
+	for i := range results {
+		r, err := rand.NewRand(seed)
+		if err != nil {
+			t.Fatalf("NewRand: got error %v", err)
+		}
+		results[i], err = addNoiseFloat64Vector(r, x, 1, 1, ln3, 1e-5)
+		if err != nil {
+			t.Fatalf("addNoiseFloat64Vector: got error %v", err)
+		}
+	}
+	for i := range x {
+		if results[0][i] != results[1][i] {
+			t.Errorf("addNoiseFloat64Vector seeded twice with the same seed: got %v and %v, want equal vectors", results[0], results[1])
+			break
+		}
+	}
+}
+
+func TestAddNoiseFloat64VectorInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		l0Sensitivity int64
+		l2Sensitivity float64
+		epsilon       float64
+		delta         float64
+	}{
+		{"zero l0 sensitivity", 0, 1, ln3, 1e-5},
+		{"zero l2 sensitivity", 1, 0, ln3, 1e-5},
+		{"infinite l2 sensitivity", 1, math.Inf(1), ln3, 1e-5},
+		{"negative epsilon", 1, 1, -1, 1e-5},
+		{"zero delta", 1, 1, ln3, 0},
+		{"delta is 1", 1, 1, ln3, 1},
+	} {
+		if _, err := AddNoiseFloat64Vector([]float64{0}, tc.l0Sensitivity, tc.l2Sensitivity, tc.epsilon, tc.delta); err == nil {
+			t.Errorf("AddNoiseFloat64Vector with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestAddGaussianNoiseFloat64Vector(t *testing.T) {
+	const numberOfSamples = 50000
+	const sigma = 3.0
+	samples := make(stat.Float64Slice, numberOfSamples)
+	for i := range samples {
+		noised, err := AddGaussianNoiseFloat64Vector([]float64{1}, sigma)
+		if err != nil {
+			t.Fatalf("Couldn't noise vector: %v", err)
+		}
+		samples[i] = noised[0]
+	}
+	// The tolerances are set to the 99.9995% quantiles of the anticipated
+	// distributions of the sample mean and variance, see TestGaussianStatistics.
+	meanErrorTolerance := 4.41717 * sigma / math.Sqrt(numberOfSamples)
+	varianceErrorTolerance := 4.41717 * math.Sqrt2 * sigma * sigma / math.Sqrt(numberOfSamples)
+	if got := stat.Mean(samples); !nearEqual(got, 1, meanErrorTolerance) {
+		t.Errorf("AddGaussianNoiseFloat64Vector: got mean %f, want 1", got)
+	}
+	if got := stat.Variance(samples); !nearEqual(got, sigma*sigma, varianceErrorTolerance) {
+		t.Errorf("AddGaussianNoiseFloat64Vector: got variance %f, want %f", got, sigma*sigma)
+	}
+	for _, sigma := range []float64{0, -1, math.Inf(1), math.NaN()} {
+		if _, err := AddGaussianNoiseFloat64Vector([]float64{1}, sigma); err == nil {
+			t.Errorf("AddGaussianNoiseFloat64Vector with sigma %f: got no error, want error", sigma)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"fmt"
+	"math"
+)
+
+// This file contains helpers for zero-concentrated differential privacy
+// (zCDP), see Bun and Steinke's "Concentrated Differential Privacy:
+// Simplifications, Extensions, and Lower Bounds"
+// (https://arxiv.org/abs/1605.02065).
+
+// RhoForGaussian returns the smallest ρ such that adding Gaussian noise with
+// standard deviation σ is ρ-zCDP, i.e. ρ = Δ₂²/(2σ²) where Δ₂ is the L_2
+// sensitivity derived from the L_0 and L_∞ sensitivities.
+func RhoForGaussian(l0Sensitivity int64, lInfSensitivity, sigma float64) float64 {
+	l2Sensitivity := lInfSensitivity * math.Sqrt(float64(l0Sensitivity))
+	return l2Sensitivity * l2Sensitivity / (2 * sigma * sigma)
+}
+
+// SigmaForRho returns the standard deviation σ of Gaussian noise needed to
+// achieve ρ-zCDP, i.e. σ = Δ₂/√(2ρ) where Δ₂ is the L_2 sensitivity derived
+// from the L_0 and L_∞ sensitivities.
+func SigmaForRho(l0Sensitivity int64, lInfSensitivity, rho float64) float64 {
+	l2Sensitivity := lInfSensitivity * math.Sqrt(float64(l0Sensitivity))
+	return l2Sensitivity / math.Sqrt(2*rho)
+}
+
+// EpsilonForZCDP returns ε such that any ρ-zCDP mechanism is (ε,δ)-differentially
+// private, i.e. ε = ρ + 2√(ρ·log(1/δ)) (Proposition 1.3 of Bun and Steinke).
+//
+// For the Gaussian mechanism, GaussianEpsilonForRho is tighter.
+func EpsilonForZCDP(rho, delta float64) float64 {
+	return rho + 2*math.Sqrt(rho*math.Log(1/delta))
+}
+
+// GaussianEpsilonForRho returns ε such that calibrating Gaussian noise to
+// (ε,δ) yields noise with at least the standard deviation required for
+// ρ-zCDP. Unlike EpsilonForZCDP, the conversion is tight: it uses the exact
+// privacy curve of the Gaussian mechanism, so that Gaussian noise calibrated to
+// the returned (ε,δ) has the same standard deviation as Gaussian noise
+// calibrated to ρ, up to the accuracy of SigmaForGaussian.
+//
+// Returns an error if ρ is so small that no ε > 0 is needed for δ.
+func GaussianEpsilonForRho(rho, delta float64) (float64, error) {
+	if rho <= 0 || math.IsInf(rho, 0) || math.IsNaN(rho) {
+		return 0, fmt.Errorf("Rho is %f, must be strictly positive and finite", rho)
+	}
+	if !(delta > 0 && delta < 1) {
+		return 0, fmt.Errorf("Delta is %e, must be in (0, 1)", delta)
+	}
+	// Standard deviation for an L_2 sensitivity of 1. The privacy curve only
+	// depends on the ratio between the two.
+	sigma := SigmaForRho(1, 1, rho)
+	if deltaForGaussian(sigma, 1, 1, 0) <= delta {
+		return 0, fmt.Errorf("Rho is %e, too small to be converted to (ε,δ) with δ = %e", rho, delta)
+	}
+	// deltaForGaussian is decreasing in ε. The binary search maintains
+	// deltaForGaussian(sigma, 1, 1, lower) > δ, so that the standard deviation
+	// calibrated to (lower, δ) is at least sigma.
+	lower, upper := 0.0, 1.0
+	for deltaForGaussian(sigma, 1, 1, upper) > delta {
+		lower, upper = upper, 2*upper
+	}
+	for upper-lower > 1e-12*upper {
+		middle := lower*0.5 + upper*0.5
+		if deltaForGaussian(sigma, 1, 1, middle) > delta {
+			lower = middle
+		} else {
+			upper = middle
+		}
+	}
+	if lower == 0 {
+		return 0, fmt.Errorf("Rho is %e, too small to be converted to (ε,δ) with δ = %e", rho, delta)
+	}
+	return lower, nil
+}
@@ -0,0 +1,85 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRhoForGaussianInvertsSigmaForRho(t *testing.T) {
+	for _, tc := range []struct {
+		l0   int64
+		lInf float64
+		rho  float64
+	}{
+		{1, 1, 0.5},
+		{4, 2.5, 0.01},
+		{25, 0.1, 3},
+	} {
+		sigma := SigmaForRho(tc.l0, tc.lInf, tc.rho)
+		if got := RhoForGaussian(tc.l0, tc.lInf, sigma); !nearEqual(got, tc.rho, 1e-12*tc.rho) {
+			t.Errorf("RhoForGaussian(%d, %f, SigmaForRho(...)): got %f, want %f", tc.l0, tc.lInf, got, tc.rho)
+		}
+	}
+	// σ = Δ₂/√(2ρ), with Δ₂ = 2·√4 = 4.
+	if got, want := SigmaForRho(4, 2, 0.5), 4.0; !nearEqual(got, want, 1e-12) {
+		t.Errorf("SigmaForRho(4, 2, 0.5): got %f, want %f", got, want)
+	}
+}
+
+func TestGaussianEpsilonForRho(t *testing.T) {
+	for _, tc := range []struct {
+		rho, delta float64
+	}{
+		{0.5, 1e-10},
+		{0.01, 1e-5},
+		{2, 1e-6},
+	} {
+		eps, err := GaussianEpsilonForRho(tc.rho, tc.delta)
+		if err != nil {
+			t.Fatalf("GaussianEpsilonForRho(%f, %e): got error %v", tc.rho, tc.delta, err)
+		}
+		// Gaussian noise calibrated to (ε, δ) has at least the standard deviation
+		// required for ρ-zCDP, and at most slightly more.
+		want := SigmaForRho(1, 1, tc.rho)
+		got := SigmaForGaussian(1, 1, eps, tc.delta)
+		if got < want || got > want*(1+2*gaussianSigmaAccuracy) {
+			t.Errorf("SigmaForGaussian(GaussianEpsilonForRho(%f, %e)): got %f, want %f", tc.rho, tc.delta, got, want)
+		}
+		// The generic zCDP conversion is looser.
+		if generic := EpsilonForZCDP(tc.rho, tc.delta); generic < eps {
+			t.Errorf("EpsilonForZCDP(%f, %e): got %f, want at least %f", tc.rho, tc.delta, generic, eps)
+		}
+	}
+}
+
+func TestGaussianEpsilonForRhoInvalidParameters(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		rho, delta float64
+	}{
+		{"zero rho", 0, 1e-5},
+		{"infinite rho", math.Inf(1), 1e-5},
+		{"zero delta", 0.5, 0},
+		{"tiny rho", 1e-30, 0.5},
+	} {
+		if _, err := GaussianEpsilonForRho(tc.rho, tc.delta); err == nil {
+			t.Errorf("GaussianEpsilonForRho: when %s got no error, want error", tc.desc)
+		}
+	}
+}
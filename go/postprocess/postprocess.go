@@ -0,0 +1,143 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package postprocess contains functions projecting noisy differentially
+// private outputs onto the sets of values they are known to be in, e.g.
+// non-negative counts, fractions summing to 1 or non-decreasing CDFs.
+//
+// Noisy outputs often violate such constraints, and fixing them in an ad hoc
+// way, e.g. rounding each fraction independently or clamping each point of a
+// CDF, easily breaks other constraints, e.g. fractions no longer sum to 1.
+// The functions of this package return the closest values, in Euclidean
+// distance, that satisfy the constraints, which never increases the error
+// when the true values satisfy them.
+//
+// Like any computation on differentially private outputs that doesn't access
+// the data, post-processing doesn't consume privacy budget. The input slices
+// are never modified.
+package postprocess
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// checkFinite returns an error if any of the values is NaN or infinite.
+func checkFinite(function string, values []float64) error {
+	for i, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%s: value %d is %f, must be finite", function, i, v)
+		}
+	}
+	return nil
+}
+
+// NonNegative returns the values with their negative values set to 0, e.g. for
+// noisy counts. To also keep the total of the values, use Simplex instead.
+func NonNegative(values []float64) ([]float64, error) {
+	if err := checkFinite("NonNegative", values); err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = math.Max(0, v)
+	}
+	return result, nil
+}
+
+// Simplex returns the non-negative values closest to the given values that sum
+// to total, e.g. fractions summing to 1 or counts summing to a separately
+// released total. The values are all shifted by the same amount, and the
+// values that would become negative are set to 0 instead, as in Duchi et al.'s
+// "Efficient Projections onto the ℓ1-Ball for Learning in High Dimensions"
+// (https://doi.org/10.1145/1390156.1390191).
+func Simplex(values []float64, total float64) ([]float64, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("Simplex: values must not be empty")
+	}
+	if err := checkFinite("Simplex", values); err != nil {
+		return nil, err
+	}
+	if total < 0 || math.IsNaN(total) || math.IsInf(total, 0) {
+		return nil, fmt.Errorf("Simplex: total is %f, must be non-negative and finite", total)
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	// The shift is determined by the values that stay positive, which are the
+	// largest ones. The largest value is always kept, even if total is 0.
+	sum, shift := sorted[0], sorted[0]-total
+	for j := 1; j < len(sorted); j++ {
+		sum += sorted[j]
+		if s := (sum - total) / float64(j+1); sorted[j]-s > 0 {
+			shift = s
+		}
+	}
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = math.Max(0, v-shift)
+	}
+	return result, nil
+}
+
+// Monotone returns the non-decreasing values closest to the given values, e.g.
+// for noisy cumulative counts. Runs of values that decrease are replaced by
+// their mean, with the pool adjacent violators algorithm of isotonic
+// regression.
+func Monotone(values []float64) ([]float64, error) {
+	if err := checkFinite("Monotone", values); err != nil {
+		return nil, err
+	}
+	// Each block is a run of consecutive values replaced by their mean. The
+	// means of the blocks are non-decreasing.
+	type block struct {
+		mean float64
+		size int
+	}
+	var blocks []block
+	for _, v := range values {
+		b := block{mean: v, size: 1}
+		for len(blocks) > 0 && blocks[len(blocks)-1].mean > b.mean {
+			last := blocks[len(blocks)-1]
+			size := last.size + b.size
+			b = block{mean: (last.mean*float64(last.size) + b.mean*float64(b.size)) / float64(size), size: size}
+			blocks = blocks[:len(blocks)-1]
+		}
+		blocks = append(blocks, b)
+	}
+	result := make([]float64, 0, len(values))
+	for _, b := range blocks {
+		for j := 0; j < b.size; j++ {
+			result = append(result, b.mean)
+		}
+	}
+	return result, nil
+}
+
+// MonotoneCDF returns the non-decreasing values in [0, 1] closest to the given
+// values, which are the points of a noisy cumulative distribution function,
+// e.g. cumulative counts divided by a total. This is the result of Monotone
+// with its values clamped to [0, 1].
+func MonotoneCDF(cdf []float64) ([]float64, error) {
+	result, err := Monotone(cdf)
+	if err != nil {
+		return nil, fmt.Errorf("MonotoneCDF: %w", err)
+	}
+	for i, v := range result {
+		result[i] = math.Min(1, math.Max(0, v))
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package postprocess
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var approx = cmpopts.EquateApprox(0, 1e-9)
+
+func TestNonNegative(t *testing.T) {
+	values := []float64{-2, 0, 3.5, -0.1}
+	got, err := NonNegative(values)
+	if err != nil {
+		t.Fatalf("NonNegative(%v): got error %v", values, err)
+	}
+	if diff := cmp.Diff([]float64{0, 0, 3.5, 0}, got); diff != "" {
+		t.Errorf("NonNegative(%v): got diff (-want +got):\n%s", values, diff)
+	}
+	if values[0] != -2 {
+		t.Errorf("NonNegative(%v): modified its input", values)
+	}
+	if _, err := NonNegative([]float64{1, math.NaN()}); err == nil {
+		t.Errorf("NonNegative with NaN: got no error, want error")
+	}
+}
+
+func TestSimplex(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		values []float64
+		total  float64
+		want   []float64
+	}{
+		{"already in the simplex", []float64{0.2, 0.3, 0.5}, 1, []float64{0.2, 0.3, 0.5}},
+		{"values shifted down", []float64{0.5, 0.5, 0.6}, 1, []float64{0.3, 0.3, 0.4}},
+		{"values shifted up", []float64{0.1, 0.2, 0.1}, 1, []float64{0.3, 0.4, 0.3}},
+		// Shifting all values by 0.1 would make the last one negative, so it is
+		// set to 0 and the others are shifted by 0.2.
+		{"negative value", []float64{0.7, 0.5, -0.3}, 1, []float64{0.6, 0.4, 0}},
+		{"counts with a total", []float64{40, -5, 70}, 100, []float64{35, 0, 65}},
+		{"zero total", []float64{2, -1}, 0, []float64{0, 0}},
+	} {
+		got, err := Simplex(tc.values, tc.total)
+		if err != nil {
+			t.Fatalf("Simplex(%v, %f) for %s: got error %v", tc.values, tc.total, tc.desc, err)
+		}
+		if diff := cmp.Diff(tc.want, got, approx); diff != "" {
+			t.Errorf("Simplex(%v, %f) for %s: got diff (-want +got):\n%s", tc.values, tc.total, tc.desc, diff)
+		}
+	}
+}
+
+func TestSimplexInvalidInputs(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		values []float64
+		total  float64
+	}{
+		{"no values", nil, 1},
+		{"infinite value", []float64{math.Inf(1), 0}, 1},
+		{"negative total", []float64{0.5, 0.5}, -1},
+		{"NaN total", []float64{0.5, 0.5}, math.NaN()},
+	} {
+		if _, err := Simplex(tc.values, tc.total); err == nil {
+			t.Errorf("Simplex with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestMonotone(t *testing.T) {
+	for _, tc := range []struct {
+		values []float64
+		want   []float64
+	}{
+		{nil, []float64{}},
+		{[]float64{1, 2, 3}, []float64{1, 2, 3}},
+		{[]float64{1, 3, 2, 4}, []float64{1, 2.5, 2.5, 4}},
+		// The mean of 5 and 1 is below 4, so 4 is pooled with them too.
+		{[]float64{4, 5, 1, 6}, []float64{10.0 / 3, 10.0 / 3, 10.0 / 3, 6}},
+		{[]float64{3, 2, 1}, []float64{2, 2, 2}},
+	} {
+		got, err := Monotone(tc.values)
+		if err != nil {
+			t.Fatalf("Monotone(%v): got error %v", tc.values, err)
+		}
+		if diff := cmp.Diff(tc.want, got, approx); diff != "" {
+			t.Errorf("Monotone(%v): got diff (-want +got):\n%s", tc.values, diff)
+		}
+	}
+	if _, err := Monotone([]float64{math.Inf(-1)}); err == nil {
+		t.Errorf("Monotone with infinite value: got no error, want error")
+	}
+}
+
+func TestMonotoneCDF(t *testing.T) {
+	cdf := []float64{-0.1, 0.3, 0.2, 0.9, 1.2, 1.1}
+	got, err := MonotoneCDF(cdf)
+	if err != nil {
+		t.Fatalf("MonotoneCDF(%v): got error %v", cdf, err)
+	}
+	want := []float64{0, 0.25, 0.25, 0.9, 1, 1}
+	if diff := cmp.Diff(want, got, approx); diff != "" {
+		t.Errorf("MonotoneCDF(%v): got diff (-want +got):\n%s", cdf, diff)
+	}
+}
@@ -0,0 +1,101 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package postprocess
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Round returns the values rounded to the nearest integer, with halves rounded
+// away from zero. Unlike converting the values with int64(v), which truncates
+// them and is undefined for values out of the range of int64, it returns an
+// error if a value can't be represented. To keep the total of the values, use
+// RoundPreservingSum instead.
+func Round(values []float64) ([]int64, error) {
+	result := make([]int64, len(values))
+	for i, v := range values {
+		r, err := roundToInt64(v)
+		if err != nil {
+			return nil, fmt.Errorf("Round: value %d: %w", i, err)
+		}
+		result[i] = r
+	}
+	return result, nil
+}
+
+// roundToInt64 returns v rounded to the nearest int64.
+func roundToInt64(v float64) (int64, error) {
+	r := math.Round(v)
+	// -2⁶³ is exactly representable as a float64, but 2⁶³-1 isn't, and is
+	// rounded up to 2⁶³ which is out of range.
+	if math.IsNaN(r) || r < math.MinInt64 || r >= math.MaxInt64 {
+		return 0, fmt.Errorf("%f can't be rounded to an int64", v)
+	}
+	return int64(r), nil
+}
+
+// RoundPreservingSum returns integers close to the values whose sum is the sum
+// of the values rounded to the nearest integer, e.g. for counts that must add
+// up to their rounded total. Each value is rounded down or up, and the values
+// with the largest fractional parts are rounded up, so each integer is less
+// than 1 away from its value. Non-negative values stay non-negative, so it can
+// be applied to the result of Simplex.
+func RoundPreservingSum(values []float64) ([]int64, error) {
+	result := make([]int64, len(values))
+	fractions := make([]float64, len(values))
+	var sum float64
+	var floorSum int64
+	for i, v := range values {
+		floor, err := roundToInt64(math.Floor(v))
+		if err != nil {
+			return nil, fmt.Errorf("RoundPreservingSum: value %d: %w", i, err)
+		}
+		result[i] = floor
+		fractions[i] = v - math.Floor(v)
+		sum += v
+		floorSum += floor
+	}
+	total, err := roundToInt64(sum)
+	if err != nil {
+		return nil, fmt.Errorf("RoundPreservingSum: sum of the values: %w", err)
+	}
+	// The sum of the values rounded down is at most the sum of the values and
+	// more than the sum minus the number of values, so between 0 and
+	// len(values) values must be rounded up.
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fractions[order[a]] > fractions[order[b]] })
+	for _, i := range order[:clampInt(total-floorSum, 0, int64(len(values)))] {
+		result[i]++
+	}
+	return result, nil
+}
+
+// clampInt returns x clamped to [lower, upper].
+func clampInt(x, lower, upper int64) int64 {
+	if x < lower {
+		return lower
+	}
+	if x > upper {
+		return upper
+	}
+	return x
+}
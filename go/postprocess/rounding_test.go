@@ -0,0 +1,67 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package postprocess
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRound(t *testing.T) {
+	values := []float64{-2.5, -0.4, 0.5, 1.49, 3}
+	got, err := Round(values)
+	if err != nil {
+		t.Fatalf("Round(%v): got error %v", values, err)
+	}
+	if diff := cmp.Diff([]int64{-3, 0, 1, 1, 3}, got); diff != "" {
+		t.Errorf("Round(%v): got diff (-want +got):\n%s", values, diff)
+	}
+	for _, v := range []float64{math.NaN(), math.Inf(1), 1e19, -1e19} {
+		if _, err := Round([]float64{v}); err == nil {
+			t.Errorf("Round([%f]): got no error, want error", v)
+		}
+	}
+}
+
+func TestRoundPreservingSum(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		values []float64
+		want   []int64
+	}{
+		{"integers", []float64{1, 2, 3}, []int64{1, 2, 3}},
+		// Rounding each value to the nearest integer would give a total of 0.
+		{"thirds", []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}, []int64{1, 0, 0}},
+		// Rounding each value to the nearest integer would give a total of 102.
+		{"percentages", []float64{33.5, 33.5, 33}, []int64{34, 33, 33}},
+		{"largest fractional parts rounded up", []float64{0.2, 1.7, 2.6}, []int64{0, 2, 3}},
+		{"negative values", []float64{-1.5, 0.7}, []int64{-2, 1}},
+	} {
+		got, err := RoundPreservingSum(tc.values)
+		if err != nil {
+			t.Fatalf("RoundPreservingSum(%v) with %s: got error %v", tc.values, tc.desc, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("RoundPreservingSum(%v) with %s: got diff (-want +got):\n%s", tc.values, tc.desc, diff)
+		}
+	}
+	if _, err := RoundPreservingSum([]float64{1, math.NaN()}); err == nil {
+		t.Errorf("RoundPreservingSum with NaN: got no error, want error")
+	}
+}
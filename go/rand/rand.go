@@ -37,16 +37,23 @@ import (
 var (
 	randBufLock sync.Mutex
 	randBuf     io.Reader = bufio.NewReaderSize(cryptorand.Reader, 65536)
+	// randScratch is the buffer randBuf is read into, guarded by randBufLock.
+	// Reading into the callers' buffers would make them escape to the heap,
+	// since randBuf is an interface, and allocate on each call.
+	randScratch [8]byte
 
 	randBitLock sync.Mutex
 	randBitBuf  uint8
 	randBitPos  int8 = math.MaxInt8
 )
 
+// readRandBuf fills b, which must have at most 8 bytes, with random bytes.
 func readRandBuf(b []byte) (int, error) {
 	randBufLock.Lock()
 	defer randBufLock.Unlock()
-	return io.ReadFull(randBuf, b)
+	n, err := io.ReadFull(randBuf, randScratch[:len(b)])
+	copy(b, randScratch[:n])
+	return n, err
 }
 
 // U64 returns a uniformly random uint64.
@@ -91,11 +98,15 @@ func Boolean() bool {
 // I63n returns an integer from the set {0,...,n-1} uniformly at random.
 // The value of n must be positive.
 func I63n(n int64) int64 {
+	return i63n(U64, n)
+}
+
+func i63n(u64 func() uint64, n int64) int64 {
 	largestMultipleOfN := (math.MaxInt64 / n) * n
 	var positiveRandomInteger int64
 	for true {
 		// Draw random 64 bit sequence and set sign bit to 0.
-		positiveRandomInteger = int64(U64()) & 0x7fffffffffffffff
+		positiveRandomInteger = int64(u64()) & 0x7fffffffffffffff
 		if positiveRandomInteger < largestMultipleOfN {
 			break
 		}
@@ -109,8 +120,12 @@ func I63n(n int64) int64 {
 //
 // See http://g/go-nuts/GndbDnHKHuw/VNSrkl9vBQAJ for details.
 func Uniform() float64 {
-	i := U64() % (1 << 53)
-	r := (1 + float64(i)/(1<<53)) / math.Pow(2, Geometric())
+	return uniform(U64, U8)
+}
+
+func uniform(u64 func() uint64, u8 func() uint8) float64 {
+	i := u64() % (1 << 53)
+	r := (1 + float64(i)/(1<<53)) / math.Pow(2, geometric(u8))
 	// We want to avoid returning 0, since we're taking the log of the output.
 	if r == 0 {
 		return 1
@@ -121,20 +136,67 @@ func Uniform() float64 {
 // Geometric returns a float64 that counts the number of Bernoulli trials until
 // the first success for a success probability of 0.5.
 func Geometric() float64 {
+	return geometric(U8)
+}
+
+func geometric(u8 func() uint8) float64 {
 	// 1 plus the number of leading zeros from an infinite stream of random bits
 	// follows the desired geometric distribution.
 	b := 1
 	var r uint8
 	for r == 0 {
-		r = U8()
+		r = u8()
 		b += bits.LeadingZeros8(r)
 	}
 	return float64(b)
 }
 
+// Source generates random numbers from the distributions of this package. The
+// package-level functions use a cryptographically secure source backed by
+// crypto/rand, see Default. Rand is a deterministic source derived from a
+// seed, e.g. for reproducible simulations and golden tests, and
+// NewReaderSource derives a source from any stream of random bytes, e.g. a
+// user-provided cryptographically secure random number generator.
+type Source interface {
+	U64() uint64
+	U8() uint8
+	Sign() float64
+	Boolean() bool
+	I63n(n int64) int64
+	Uniform() float64
+	Geometric() float64
+	Normal() float64
+}
+
+// Default returns the Source used by the package-level functions.
+func Default() Source {
+	return defaultSource{}
+}
+
+type defaultSource struct{}
+
+func (defaultSource) U64() uint64        { return U64() }
+func (defaultSource) U8() uint8          { return U8() }
+func (defaultSource) Sign() float64      { return Sign() }
+func (defaultSource) Boolean() bool      { return Boolean() }
+func (defaultSource) I63n(n int64) int64 { return I63n(n) }
+func (defaultSource) Uniform() float64   { return Uniform() }
+func (defaultSource) Geometric() float64 { return Geometric() }
+func (defaultSource) Normal() float64    { return Normal() }
+
+var (
+	// normalRand draws normally distributed floats from randSource. A
+	// math/rand.Rand isn't safe for concurrent use, so it is guarded by
+	// normalRandLock.
+	normalRandLock sync.Mutex
+	normalRand     = mathrand.New(randSource{})
+)
+
 // Normal returns a normally distributed float with mean 0 and standard deviation 1.
 func Normal() float64 {
-	return mathrand.New(&randSource{}).NormFloat64()
+	normalRandLock.Lock()
+	defer normalRandLock.Unlock()
+	return normalRand.NormFloat64()
 }
 
 // randSource implements a cryptographically secure implementation of math.Source.
@@ -17,7 +17,10 @@
 package rand
 
 import (
+	"bufio"
 	"bytes"
+	cryptorand "crypto/rand"
+	"io"
 	"testing"
 )
 
@@ -51,3 +54,24 @@ func TestBooleanBufIsShifting(t *testing.T) {
 		}
 	}
 }
+
+// Noise is drawn for every released value, so drawing random numbers must not
+// allocate.
+func TestDrawsDoNotAllocate(t *testing.T) {
+	defer func(r io.Reader) { randBuf = r }(randBuf)
+	randBuf = bufio.NewReaderSize(cryptorand.Reader, 65536)
+	for _, tc := range []struct {
+		name string
+		draw func()
+	}{
+		{"U64", func() { U64() }},
+		{"Boolean", func() { Boolean() }},
+		{"Uniform", func() { Uniform() }},
+		{"Geometric", func() { Geometric() }},
+		{"Normal", func() { Normal() }},
+	} {
+		if allocs := testing.AllocsPerRun(100, tc.draw); allocs != 0 {
+			t.Errorf("%s: got %f allocations per call, want 0", tc.name, allocs)
+		}
+	}
+}
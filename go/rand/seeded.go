@@ -0,0 +1,177 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rand
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+
+	log "github.com/golang/glog"
+)
+
+// SeedLength is the length in bytes of the seeds of Rand.
+const SeedLength = 32
+
+// Rand is a deterministic Source, which generates the same random numbers for
+// the same seed, e.g. to reproduce the noise of a release during a review. The
+// random bytes are SHA-256 hashes of the seed and a counter.
+//
+// Anyone who knows the seed can recompute the noise, and therefore remove it
+// from the output of a differentially private mechanism: the seed must be
+// generated with NewSeed and kept as secret as the raw data.
+//
+// Not thread-safe.
+type Rand struct {
+	byteSource
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+// NewSeed returns a new random seed for Rand, generated with crypto/rand.
+func NewSeed() []byte {
+	seed := make([]byte, SeedLength)
+	if _, err := cryptorand.Read(seed); err != nil {
+		log.Fatalf("out of randomness, should never happen: %v", err)
+	}
+	return seed
+}
+
+// NewRand returns a Rand generating random numbers from the given seed, which
+// must be SeedLength bytes long.
+func NewRand(seed []byte) (*Rand, error) {
+	if len(seed) != SeedLength {
+		return nil, fmt.Errorf("NewRand: seed is %d bytes long, must be %d bytes long", len(seed), SeedLength)
+	}
+	r := &Rand{seed: append([]byte(nil), seed...)}
+	r.byteSource = byteSource{read: r.read, bitPos: 8}
+	return r, nil
+}
+
+// read fills b with the next random bytes of r.
+func (r *Rand) read(b []byte) {
+	for i := range b {
+		if len(r.buf) == 0 {
+			var c [8]byte
+			binary.LittleEndian.PutUint64(c[:], r.counter)
+			r.counter++
+			block := sha256.Sum256(append(append([]byte(nil), r.seed...), c[:]...))
+			r.buf = block[:]
+		}
+		b[i] = r.buf[0]
+		r.buf = r.buf[1:]
+	}
+}
+
+// NewReaderSource returns a Source drawing its random bytes from r, e.g. a
+// user-provided cryptographically secure random number generator. The secrecy
+// of the noise generated from the Source relies on r being unpredictable.
+// Since the methods of Source can't return errors, reading from r must not
+// fail: a read error is fatal, like running out of entropy with Default.
+//
+// The returned Source is not thread-safe, even if r is.
+func NewReaderSource(r io.Reader) Source {
+	return &byteSource{
+		read: func(b []byte) {
+			if _, err := io.ReadFull(r, b); err != nil {
+				log.Fatalf("couldn't read random bytes: %v", err)
+			}
+		},
+		bitPos: 8,
+	}
+}
+
+// byteSource implements Source with the random bytes returned by read.
+type byteSource struct {
+	read func(b []byte)
+
+	bitBuf uint8
+	bitPos int8
+}
+
+// U64 returns a uniformly random uint64.
+func (s *byteSource) U64() uint64 {
+	var b [8]byte
+	s.read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// U8 returns a uniformly random uint8.
+func (s *byteSource) U8() uint8 {
+	var b [1]byte
+	s.read(b[:])
+	return b[0]
+}
+
+// Sign returns +1.0 or -1.0 with equal probabilities.
+func (s *byteSource) Sign() float64 {
+	if s.Boolean() {
+		return 1.0
+	}
+	return -1.0
+}
+
+// Boolean returns true or false with equal probability.
+func (s *byteSource) Boolean() bool {
+	if s.bitPos > 7 { // Out of random bits.
+		s.bitBuf = s.U8()
+		s.bitPos = 0
+	}
+	res := s.bitBuf&(1<<s.bitPos) > 0
+	s.bitPos++
+	return res
+}
+
+// I63n returns an integer from the set {0,...,n-1} uniformly at random.
+// The value of n must be positive.
+func (s *byteSource) I63n(n int64) int64 {
+	return i63n(s.U64, n)
+}
+
+// Uniform returns a float64 from the interval (0,1], see the package-level
+// function Uniform.
+func (s *byteSource) Uniform() float64 {
+	return uniform(s.U64, s.U8)
+}
+
+// Geometric returns a float64 that counts the number of Bernoulli trials until
+// the first success for a success probability of 0.5.
+func (s *byteSource) Geometric() float64 {
+	return geometric(s.U8)
+}
+
+// Normal returns a normally distributed float with mean 0 and standard deviation 1.
+func (s *byteSource) Normal() float64 {
+	return mathrand.New(mathSource{s}).NormFloat64()
+}
+
+// mathSource implements math.Source with the random bytes of a byteSource.
+type mathSource struct {
+	s *byteSource
+}
+
+// Int63 returns a uniformly random int64 in [0, 1<<63).
+func (ms mathSource) Int63() int64 {
+	return int64(ms.s.U64() & 0x7fffffffffffffff)
+}
+
+// Seed is a no-op.
+func (mathSource) Seed(_ int64) {}
@@ -0,0 +1,126 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rand
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"testing"
+)
+
+func TestNewRandInvalidSeed(t *testing.T) {
+	for _, seed := range [][]byte{nil, make([]byte, SeedLength-1), make([]byte, SeedLength+1)} {
+		if _, err := NewRand(seed); err == nil {
+			t.Errorf("NewRand with a seed of %d bytes: got no error, want error", len(seed))
+		}
+	}
+}
+
+func TestRandIsDeterministic(t *testing.T) {
+	seed := NewSeed()
+	if len(seed) != SeedLength {
+		t.Fatalf("NewSeed: got a seed of %d bytes, want %d", len(seed), SeedLength)
+	}
+	r1, err := NewRand(seed)
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	r2, err := NewRand(seed)
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if a, b := r1.Uniform(), r2.Uniform(); a != b {
+			t.Fatalf("Uniform: got %v and %v from the same seed, want equal values", a, b)
+		}
+		if a, b := r1.Boolean(), r2.Boolean(); a != b {
+			t.Fatalf("Boolean: got %v and %v from the same seed, want equal values", a, b)
+		}
+		if a, b := r1.I63n(1000), r2.I63n(1000); a != b {
+			t.Fatalf("I63n: got %v and %v from the same seed, want equal values", a, b)
+		}
+		if a, b := r1.Normal(), r2.Normal(); a != b {
+			t.Fatalf("Normal: got %v and %v from the same seed, want equal values", a, b)
+		}
+	}
+}
+
+func TestRandDependsOnSeed(t *testing.T) {
+	r1, err := NewRand(bytes.Repeat([]byte{1}, SeedLength))
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	r2, err := NewRand(bytes.Repeat([]byte{2}, SeedLength))
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	if r1.U64() == r2.U64() && r1.U64() == r2.U64() {
+		t.Errorf("U64: got the same values from different seeds, want different values")
+	}
+}
+
+func TestRandBooleanIsBalanced(t *testing.T) {
+	r, err := NewRand(NewSeed())
+	if err != nil {
+		t.Fatalf("NewRand: got error %v", err)
+	}
+	const n = 10000
+	trues := 0
+	for i := 0; i < n; i++ {
+		if r.Boolean() {
+			trues++
+		}
+	}
+	// The standard deviation of the number of trues is 50.
+	if trues < n/2-300 || trues > n/2+300 {
+		t.Errorf("Boolean: got %d trues out of %d, want about %d", trues, n, n/2)
+	}
+}
+
+func TestReaderSource(t *testing.T) {
+	s := NewReaderSource(bytes.NewReader([]byte{0x2a, 0x01, 1, 0, 0, 0, 0, 0, 0, 0}))
+	if got := s.U8(); got != 0x2a {
+		t.Errorf("U8: got %#x, want 0x2a", got)
+	}
+	// Booleans use the bits of the next byte, starting from the lowest.
+	if got := s.Boolean(); !got {
+		t.Errorf("Boolean: got %t, want true", got)
+	}
+	if got := s.Boolean(); got {
+		t.Errorf("Boolean: got %t, want false", got)
+	}
+	if got := s.U64(); got != 1 {
+		t.Errorf("U64: got %d, want 1", got)
+	}
+}
+
+func TestReaderSourceIsDeterministic(t *testing.T) {
+	stream := make([]byte, 4096)
+	if _, err := cryptorand.Read(stream); err != nil {
+		t.Fatalf("couldn't generate random bytes: %v", err)
+	}
+	s1 := NewReaderSource(bytes.NewReader(stream))
+	s2 := NewReaderSource(bytes.NewReader(stream))
+	for i := 0; i < 50; i++ {
+		if a, b := s1.Uniform(), s2.Uniform(); a != b {
+			t.Fatalf("Uniform: got %v and %v from the same stream, want equal values", a, b)
+		}
+		if a, b := s1.Geometric(), s2.Geometric(); a != b {
+			t.Fatalf("Geometric: got %v and %v from the same stream, want equal values", a, b)
+		}
+	}
+}
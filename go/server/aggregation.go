@@ -0,0 +1,192 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/google/differential-privacy/go/accounting"
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// aggregation is an aggregation of a session.
+type aggregation struct {
+	session string
+	aggregator
+}
+
+// aggregator wraps a dpagg aggregation.
+type aggregator interface {
+	add(values []float64) error
+	// merge merges src, which is consumed, into the aggregation.
+	merge(src aggregator) error
+	// mergeSummary merges a serialized summary into the aggregation.
+	mergeSummary(summary []byte) error
+	result() (float64, error)
+}
+
+// newAggregation creates the aggregation requested by req, spending its privacy
+// loss on acc.
+func newAggregation(acc *accounting.Accountant, req *CreateAggregationRequest, n noise.Noise) (*aggregation, error) {
+	var (
+		a   aggregator
+		err error
+	)
+	switch req.Type {
+	case Count:
+		opt := &dpagg.CountOptions{
+			Epsilon:                  req.Epsilon,
+			Delta:                    req.Delta,
+			MaxPartitionsContributed: req.MaxPartitionsContributed,
+			Noise:                    n,
+		}
+		var c *dpagg.Count
+		c, err = acc.NewCount(opt)
+		a = &countAggregator{c: c, opt: opt}
+	case BoundedSum:
+		opt := &dpagg.BoundedSumFloat64Options{
+			Epsilon:                  req.Epsilon,
+			Delta:                    req.Delta,
+			MaxPartitionsContributed: req.MaxPartitionsContributed,
+			Lower:                    req.Lower,
+			Upper:                    req.Upper,
+			Noise:                    n,
+		}
+		var bs *dpagg.BoundedSumFloat64
+		bs, err = acc.NewBoundedSumFloat64(opt)
+		a = &sumAggregator{bs: bs, opt: opt}
+	case BoundedMean:
+		opt := &dpagg.BoundedMeanFloat64Options{
+			Epsilon:                      req.Epsilon,
+			Delta:                        req.Delta,
+			MaxPartitionsContributed:     req.MaxPartitionsContributed,
+			MaxContributionsPerPartition: req.MaxContributionsPerPartition,
+			Lower:                        req.Lower,
+			Upper:                        req.Upper,
+			Noise:                        n,
+		}
+		var bm *dpagg.BoundedMeanFloat64
+		bm, err = acc.NewBoundedMeanFloat64(opt)
+		a = &meanAggregator{bm: bm, opt: opt}
+	default:
+		return nil, fmt.Errorf("unsupported aggregation type %v", req.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &aggregation{aggregator: a}, nil
+}
+
+type countAggregator struct {
+	c   *dpagg.Count
+	opt *dpagg.CountOptions
+}
+
+func (a *countAggregator) add(values []float64) error {
+	return a.c.IncrementBy(int64(len(values)))
+}
+
+func (a *countAggregator) merge(src aggregator) error {
+	s, ok := src.(*countAggregator)
+	if !ok {
+		return fmt.Errorf("can't merge a %T into a Count", src)
+	}
+	return a.c.Merge(s.c)
+}
+
+func (a *countAggregator) mergeSummary(summary []byte) error {
+	// The summary is loaded into an aggregation with the same parameters, which
+	// doesn't spend budget since it is merged.
+	c, err := dpagg.NewCount(a.opt)
+	if err != nil {
+		return err
+	}
+	if err := c.Deserialize(summary); err != nil {
+		return err
+	}
+	return a.c.Merge(c)
+}
+
+func (a *countAggregator) result() (float64, error) {
+	r, err := a.c.Result()
+	return float64(r), err
+}
+
+type sumAggregator struct {
+	bs  *dpagg.BoundedSumFloat64
+	opt *dpagg.BoundedSumFloat64Options
+}
+
+func (a *sumAggregator) add(values []float64) error {
+	return a.bs.AddSlice(values)
+}
+
+func (a *sumAggregator) merge(src aggregator) error {
+	s, ok := src.(*sumAggregator)
+	if !ok {
+		return fmt.Errorf("can't merge a %T into a BoundedSumFloat64", src)
+	}
+	return a.bs.Merge(s.bs)
+}
+
+func (a *sumAggregator) mergeSummary(summary []byte) error {
+	bs, err := dpagg.NewBoundedSumFloat64(a.opt)
+	if err != nil {
+		return err
+	}
+	if err := bs.Deserialize(summary); err != nil {
+		return err
+	}
+	return a.bs.Merge(bs)
+}
+
+func (a *sumAggregator) result() (float64, error) {
+	return a.bs.Result()
+}
+
+type meanAggregator struct {
+	bm  *dpagg.BoundedMeanFloat64
+	opt *dpagg.BoundedMeanFloat64Options
+}
+
+func (a *meanAggregator) add(values []float64) error {
+	return a.bm.AddSlice(values)
+}
+
+func (a *meanAggregator) merge(src aggregator) error {
+	s, ok := src.(*meanAggregator)
+	if !ok {
+		return fmt.Errorf("can't merge a %T into a BoundedMeanFloat64", src)
+	}
+	return a.bm.Merge(s.bm)
+}
+
+func (a *meanAggregator) mergeSummary(summary []byte) error {
+	bm, err := dpagg.NewBoundedMeanFloat64(a.opt)
+	if err != nil {
+		return err
+	}
+	if err := bm.Deserialize(summary); err != nil {
+		return err
+	}
+	return a.bm.Merge(bm)
+}
+
+func (a *meanAggregator) result() (float64, error) {
+	return a.bm.Result()
+}
@@ -0,0 +1,103 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec returns the gRPC codec of the AggregationService messages. It encodes
+// other protobuf messages like the default codec, so a gRPC server using it can
+// serve other services too.
+func Codec() encoding.Codec {
+	return codec{}
+}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case message:
+		return m.marshal(), nil
+	case proto.Message:
+		return proto.Marshal(m)
+	}
+	return nil, fmt.Errorf("couldn't marshal message of type %T", v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case message:
+		if err := m.unmarshal(data); err != nil {
+			return fmt.Errorf("couldn't parse %T: %w", v, err)
+		}
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	}
+	return fmt.Errorf("couldn't unmarshal message of type %T", v)
+}
+
+// Name returns the name of the default codec, since AggregationService
+// messages use the protobuf wire format.
+func (codec) Name() string {
+	return "proto"
+}
+
+// Client is a client of the AggregationService.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a new Client using the connection cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// CreateAggregation calls the CreateAggregation method.
+func (c *Client) CreateAggregation(ctx context.Context, req *CreateAggregationRequest, opts ...grpc.CallOption) (*CreateAggregationResponse, error) {
+	resp := new(CreateAggregationResponse)
+	return resp, c.invoke(ctx, "CreateAggregation", req, resp, opts)
+}
+
+// Add calls the Add method.
+func (c *Client) Add(ctx context.Context, req *AddRequest, opts ...grpc.CallOption) (*AddResponse, error) {
+	resp := new(AddResponse)
+	return resp, c.invoke(ctx, "Add", req, resp, opts)
+}
+
+// Merge calls the Merge method.
+func (c *Client) Merge(ctx context.Context, req *MergeRequest, opts ...grpc.CallOption) (*MergeResponse, error) {
+	resp := new(MergeResponse)
+	return resp, c.invoke(ctx, "Merge", req, resp, opts)
+}
+
+// GetResult calls the GetResult method.
+func (c *Client) GetResult(ctx context.Context, req *GetResultRequest, opts ...grpc.CallOption) (*GetResultResponse, error) {
+	resp := new(GetResultResponse)
+	return resp, c.invoke(ctx, "GetResult", req, resp, opts)
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp message, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.ForceCodec(codec{})}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, resp, opts...)
+}
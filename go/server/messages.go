@@ -0,0 +1,392 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Messages of proto/aggregation-service.proto. Like the summaries of dpagg,
+// they are encoded by hand using protowire so that the Go library does not
+// depend on generated code for the shared proto definitions.
+
+// AggregationType mirrors the AggregationType enum.
+type AggregationType int32
+
+// The aggregation types.
+const (
+	AggregationTypeUnspecified AggregationType = 0
+	Count                      AggregationType = 1
+	BoundedSum                 AggregationType = 2
+	BoundedMean                AggregationType = 3
+)
+
+// String returns the name of the aggregation type in the proto definition.
+func (t AggregationType) String() string {
+	switch t {
+	case AggregationTypeUnspecified:
+		return "AGGREGATION_TYPE_UNSPECIFIED"
+	case Count:
+		return "COUNT"
+	case BoundedSum:
+		return "BOUNDED_SUM"
+	case BoundedMean:
+		return "BOUNDED_MEAN"
+	}
+	return fmt.Sprintf("AggregationType(%d)", int32(t))
+}
+
+// MechanismType mirrors the MechanismType enum of proto/summary.proto.
+type MechanismType int32
+
+// The mechanism types.
+const (
+	MechanismEmpty    MechanismType = 0
+	MechanismLaplace  MechanismType = 1
+	MechanismGaussian MechanismType = 2
+)
+
+// message is implemented by the request and response messages.
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// CreateAggregationRequest corresponds to the CreateAggregationRequest message.
+type CreateAggregationRequest struct {
+	SessionID                    string
+	Type                         AggregationType
+	Epsilon                      float64
+	Delta                        float64
+	MechanismType                MechanismType
+	MaxPartitionsContributed     int64
+	MaxContributionsPerPartition int64
+	Lower                        float64
+	Upper                        float64
+}
+
+func (m *CreateAggregationRequest) marshal() []byte {
+	var b []byte
+	b = appendStringField(b, 1, m.SessionID)
+	b = appendInt64Field(b, 2, int64(m.Type))
+	b = appendDoubleField(b, 3, m.Epsilon)
+	b = appendDoubleField(b, 4, m.Delta)
+	b = appendInt64Field(b, 5, int64(m.MechanismType))
+	b = appendInt64Field(b, 6, m.MaxPartitionsContributed)
+	b = appendInt64Field(b, 7, m.MaxContributionsPerPartition)
+	b = appendDoubleField(b, 8, m.Lower)
+	b = appendDoubleField(b, 9, m.Upper)
+	return b
+}
+
+func (m *CreateAggregationRequest) unmarshal(b []byte) error {
+	*m = CreateAggregationRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.SessionID)
+		case 2:
+			var v int64
+			n, err := consumeInt64(b, typ, &v)
+			m.Type = AggregationType(v)
+			return n, err
+		case 3:
+			return consumeDouble(b, typ, &m.Epsilon)
+		case 4:
+			return consumeDouble(b, typ, &m.Delta)
+		case 5:
+			var v int64
+			n, err := consumeInt64(b, typ, &v)
+			m.MechanismType = MechanismType(v)
+			return n, err
+		case 6:
+			return consumeInt64(b, typ, &m.MaxPartitionsContributed)
+		case 7:
+			return consumeInt64(b, typ, &m.MaxContributionsPerPartition)
+		case 8:
+			return consumeDouble(b, typ, &m.Lower)
+		case 9:
+			return consumeDouble(b, typ, &m.Upper)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// CreateAggregationResponse corresponds to the CreateAggregationResponse message.
+type CreateAggregationResponse struct {
+	AggregationID string
+	// Privacy loss spent by the session, including the new aggregation.
+	SpentEpsilon, SpentDelta float64
+}
+
+func (m *CreateAggregationResponse) marshal() []byte {
+	var b []byte
+	b = appendStringField(b, 1, m.AggregationID)
+	b = appendDoubleField(b, 2, m.SpentEpsilon)
+	b = appendDoubleField(b, 3, m.SpentDelta)
+	return b
+}
+
+func (m *CreateAggregationResponse) unmarshal(b []byte) error {
+	*m = CreateAggregationResponse{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.AggregationID)
+		case 2:
+			return consumeDouble(b, typ, &m.SpentEpsilon)
+		case 3:
+			return consumeDouble(b, typ, &m.SpentDelta)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// AddRequest corresponds to the AddRequest message.
+type AddRequest struct {
+	AggregationID string
+	Values        []float64
+}
+
+func (m *AddRequest) marshal() []byte {
+	var b []byte
+	b = appendStringField(b, 1, m.AggregationID)
+	if len(m.Values) > 0 {
+		packed := make([]byte, 0, 8*len(m.Values))
+		for _, v := range m.Values {
+			packed = protowire.AppendFixed64(packed, math.Float64bits(v))
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b
+}
+
+func (m *AddRequest) unmarshal(b []byte) error {
+	*m = AddRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.AggregationID)
+		case 2:
+			// Parsers must accept both packed and unpacked repeated fields.
+			if typ == protowire.Fixed64Type {
+				var v float64
+				n, err := consumeDouble(b, typ, &v)
+				m.Values = append(m.Values, v)
+				return n, err
+			}
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			if typ != protowire.BytesType || len(packed)%8 != 0 {
+				return 0, fmt.Errorf("field values has wire type %v and length %d, want packed doubles", typ, len(packed))
+			}
+			for len(packed) > 0 {
+				v, _ := protowire.ConsumeFixed64(packed)
+				m.Values = append(m.Values, math.Float64frombits(v))
+				packed = packed[8:]
+			}
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// AddResponse corresponds to the AddResponse message.
+type AddResponse struct{}
+
+func (m *AddResponse) marshal() []byte { return nil }
+
+func (m *AddResponse) unmarshal(b []byte) error {
+	return consumeFields(b, skipField)
+}
+
+// MergeRequest corresponds to the MergeRequest message. At most one of
+// SourceAggregationID and Summary is set.
+type MergeRequest struct {
+	AggregationID       string
+	SourceAggregationID string
+	Summary             []byte
+}
+
+func (m *MergeRequest) marshal() []byte {
+	var b []byte
+	b = appendStringField(b, 1, m.AggregationID)
+	if m.SourceAggregationID != "" {
+		b = appendStringField(b, 2, m.SourceAggregationID)
+	}
+	if m.Summary != nil {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Summary)
+	}
+	return b
+}
+
+func (m *MergeRequest) unmarshal(b []byte) error {
+	*m = MergeRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.AggregationID)
+		case 2:
+			// The last field of a oneof wins.
+			m.Summary = nil
+			return consumeString(b, typ, &m.SourceAggregationID)
+		case 3:
+			m.SourceAggregationID = ""
+			if typ != protowire.BytesType {
+				return 0, fmt.Errorf("field summary has wire type %v, want bytes", typ)
+			}
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			m.Summary = append([]byte{}, v...)
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// MergeResponse corresponds to the MergeResponse message.
+type MergeResponse struct{}
+
+func (m *MergeResponse) marshal() []byte { return nil }
+
+func (m *MergeResponse) unmarshal(b []byte) error {
+	return consumeFields(b, skipField)
+}
+
+// GetResultRequest corresponds to the GetResultRequest message.
+type GetResultRequest struct {
+	AggregationID string
+}
+
+func (m *GetResultRequest) marshal() []byte {
+	return appendStringField(nil, 1, m.AggregationID)
+}
+
+func (m *GetResultRequest) unmarshal(b []byte) error {
+	*m = GetResultRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 {
+			return consumeString(b, typ, &m.AggregationID)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// GetResultResponse corresponds to the GetResultResponse message.
+type GetResultResponse struct {
+	Result float64
+}
+
+func (m *GetResultResponse) marshal() []byte {
+	return appendDoubleField(nil, 1, m.Result)
+}
+
+func (m *GetResultResponse) unmarshal(b []byte) error {
+	*m = GetResultResponse{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 {
+			return consumeDouble(b, typ, &m.Result)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func appendStringField(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt64Field(b []byte, num protowire.Number, v int64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDoubleField(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// consumeFields calls f on each field of the message b. f returns the length of
+// the field value it consumed.
+func consumeFields(b []byte, f func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := f(num, typ, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func skipField(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	return n, nil
+}
+
+func consumeString(b []byte, typ protowire.Type, v *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("got wire type %v, want bytes", typ)
+	}
+	s, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = s
+	return n, nil
+}
+
+func consumeInt64(b []byte, typ protowire.Type, v *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("got wire type %v, want varint", typ)
+	}
+	x, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = int64(x)
+	return n, nil
+}
+
+func consumeDouble(b []byte, typ protowire.Type, v *float64) (int, error) {
+	if typ != protowire.Fixed64Type {
+		return 0, fmt.Errorf("got wire type %v, want fixed64", typ)
+	}
+	x, n := protowire.ConsumeFixed64(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = math.Float64frombits(x)
+	return n, nil
+}
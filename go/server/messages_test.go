@@ -0,0 +1,72 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestMessagesRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		m, got message
+	}{
+		{&CreateAggregationRequest{SessionID: "s", Type: BoundedMean, Epsilon: 1, Delta: 1e-5, MechanismType: MechanismGaussian, MaxPartitionsContributed: 2, MaxContributionsPerPartition: 3, Lower: -1, Upper: 4}, &CreateAggregationRequest{}},
+		{&CreateAggregationResponse{AggregationID: "1", SpentEpsilon: 0.5, SpentDelta: 1e-6}, &CreateAggregationResponse{}},
+		{&AddRequest{AggregationID: "1", Values: []float64{1, -2.5, 3}}, &AddRequest{}},
+		{&MergeRequest{AggregationID: "1", SourceAggregationID: "2"}, &MergeRequest{}},
+		{&MergeRequest{AggregationID: "1", Summary: []byte{1, 2}}, &MergeRequest{}},
+		{&GetResultRequest{AggregationID: "1"}, &GetResultRequest{}},
+		{&GetResultResponse{Result: 4.5}, &GetResultResponse{}},
+	} {
+		if err := tc.got.unmarshal(tc.m.marshal()); err != nil {
+			t.Fatalf("unmarshal(marshal(%+v)): got error %v", tc.m, err)
+		}
+		if diff := cmp.Diff(tc.m, tc.got); diff != "" {
+			t.Errorf("unmarshal(marshal(%+v)): got diff (-want +got):\n%s", tc.m, diff)
+		}
+	}
+}
+
+func TestAddRequestUnpackedValues(t *testing.T) {
+	var b []byte
+	for _, v := range []float64{1, 2} {
+		b = appendDoubleField(b, 2, v)
+	}
+	var got AddRequest
+	if err := got.unmarshal(b); err != nil {
+		t.Fatalf("unmarshal: got error %v", err)
+	}
+	if diff := cmp.Diff([]float64{1, 2}, got.Values); diff != "" {
+		t.Errorf("unmarshal of unpacked values: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestMessagesUnknownFields(t *testing.T) {
+	b := (&GetResultRequest{AggregationID: "1"}).marshal()
+	b = protowire.AppendTag(b, 42, protowire.VarintType)
+	b = protowire.AppendVarint(b, 7)
+	var got GetResultRequest
+	if err := got.unmarshal(b); err != nil {
+		t.Fatalf("unmarshal with an unknown field: got error %v", err)
+	}
+	if got.AggregationID != "1" {
+		t.Errorf("unmarshal with an unknown field: got AggregationID %q, want \"1\"", got.AggregationID)
+	}
+}
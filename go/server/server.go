@@ -0,0 +1,261 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package server implements the AggregationService gRPC service of
+// proto/aggregation-service.proto, backed by dpagg aggregations, so that
+// clients in any language can use the library as a differentially private
+// aggregation sidecar.
+//
+// Each aggregation belongs to a session, which has its own privacy budget:
+// creating an aggregation spends its privacy loss on the accounting.Accountant
+// of the session, and fails with codes.ResourceExhausted if the budget of the
+// session would be exceeded.
+//
+// The messages are encoded by hand, so the service must be served with the
+// codec returned by Codec:
+//
+//	gs := grpc.NewServer(grpc.ForceServerCodec(server.Codec()))
+//	s, err := server.NewServer(&server.ServerOptions{Epsilon: 1, Delta: 1e-5})
+//	...
+//	s.Register(gs)
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/google/differential-privacy/go/accounting"
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/noise"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serviceName is the full name of the AggregationService.
+const serviceName = "differential_privacy.AggregationService"
+
+// Server implements the AggregationService.
+//
+// Thread-safe.
+type Server struct {
+	// Parameters
+	epsilon float64
+	delta   float64
+
+	// State variables
+	mu           sync.Mutex
+	sessions     map[string]*accounting.Accountant
+	aggregations map[string]*aggregation
+	lastID       int64
+}
+
+// ServerOptions contains the options necessary to initialize a Server.
+type ServerOptions struct {
+	Epsilon float64 // Privacy budget ε of each session. Required.
+	Delta   float64 // Privacy budget δ of each session. Defaults to 0.
+}
+
+// NewServer returns a new Server, without sessions.
+func NewServer(opt *ServerOptions) (*Server, error) {
+	if opt == nil {
+		opt = &ServerOptions{}
+	}
+	if err := checks.CheckEpsilonStrict(opt.Epsilon); err != nil {
+		return nil, fmt.Errorf("NewServer: %w", err)
+	}
+	if err := checks.CheckDelta(opt.Delta); err != nil {
+		return nil, fmt.Errorf("NewServer: %w", err)
+	}
+	return &Server{
+		epsilon:      opt.Epsilon,
+		delta:        opt.Delta,
+		sessions:     make(map[string]*accounting.Accountant),
+		aggregations: make(map[string]*aggregation),
+	}, nil
+}
+
+// Register registers the AggregationService on gs, which must use the codec
+// returned by Codec.
+func (s *Server) Register(gs *grpc.Server) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+// aggregationService is the interface of the handlers of serviceDesc.
+type aggregationService interface {
+	CreateAggregation(context.Context, *CreateAggregationRequest) (*CreateAggregationResponse, error)
+	Add(context.Context, *AddRequest) (*AddResponse, error)
+	Merge(context.Context, *MergeRequest) (*MergeResponse, error)
+	GetResult(context.Context, *GetResultRequest) (*GetResultResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*aggregationService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "CreateAggregation", Handler: handler("CreateAggregation", aggregationService.CreateAggregation)},
+		{MethodName: "Add", Handler: handler("Add", aggregationService.Add)},
+		{MethodName: "Merge", Handler: handler("Merge", aggregationService.Merge)},
+		{MethodName: "GetResult", Handler: handler("GetResult", aggregationService.GetResult)},
+	},
+	Metadata: "proto/aggregation-service.proto",
+}
+
+// handler returns the grpc.MethodDesc handler of a unary method.
+func handler[Req any, Resp any, PReq interface {
+	*Req
+	message
+}](method string, f func(aggregationService, context.Context, PReq) (Resp, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := PReq(new(Req))
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return f(srv.(aggregationService), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return f(srv.(aggregationService), ctx, req.(PReq))
+		})
+	}
+}
+
+// CreateAggregation creates an aggregation in a session, spending its privacy
+// loss on the budget of the session.
+func (s *Server) CreateAggregation(_ context.Context, req *CreateAggregationRequest) (*CreateAggregationResponse, error) {
+	if req.SessionID == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+	n, err := toNoise(req.MechanismType)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.sessions[req.SessionID]
+	if !ok {
+		acc, err = accounting.NewAccountant(&accounting.AccountantOptions{Epsilon: s.epsilon, Delta: s.delta, EnforceBudget: true})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	agg, err := newAggregation(acc, req, n)
+	if err != nil {
+		if errors.Is(err, accounting.ErrBudgetExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Sessions are only kept once they spent budget.
+	s.sessions[req.SessionID] = acc
+	agg.session = req.SessionID
+	s.lastID++
+	id := strconv.FormatInt(s.lastID, 10)
+	s.aggregations[id] = agg
+	eps, del := acc.Spent()
+	return &CreateAggregationResponse{AggregationID: id, SpentEpsilon: eps, SpentDelta: del}, nil
+}
+
+// Add adds values to an aggregation.
+func (s *Server) Add(_ context.Context, req *AddRequest) (*AddResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg, err := s.aggregation(req.AggregationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := agg.add(req.Values); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &AddResponse{}, nil
+}
+
+// Merge merges another aggregation of the same session, which is deleted, or a
+// serialized summary into an aggregation.
+func (s *Server) Merge(_ context.Context, req *MergeRequest) (*MergeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg, err := s.aggregation(req.AggregationID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case req.SourceAggregationID != "":
+		if req.SourceAggregationID == req.AggregationID {
+			return nil, status.Error(codes.InvalidArgument, "an aggregation can't be merged into itself")
+		}
+		src, err := s.aggregation(req.SourceAggregationID)
+		if err != nil {
+			return nil, err
+		}
+		// Merging aggregations of different sessions would let a session use
+		// the budget of another one.
+		if src.session != agg.session {
+			return nil, status.Errorf(codes.InvalidArgument, "aggregation %s belongs to another session", req.SourceAggregationID)
+		}
+		if err := agg.merge(src.aggregator); err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		delete(s.aggregations, req.SourceAggregationID)
+	case req.Summary != nil:
+		if err := agg.mergeSummary(req.Summary); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "either source_aggregation_id or summary is required")
+	}
+	return &MergeResponse{}, nil
+}
+
+// GetResult returns the result of an aggregation, and deletes it.
+func (s *Server) GetResult(_ context.Context, req *GetResultRequest) (*GetResultResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg, err := s.aggregation(req.AggregationID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := agg.result()
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	delete(s.aggregations, req.AggregationID)
+	return &GetResultResponse{Result: result}, nil
+}
+
+// aggregation returns the aggregation with the given ID, or a NotFound error.
+// s.mu must be held.
+func (s *Server) aggregation(id string) (*aggregation, error) {
+	agg, ok := s.aggregations[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "aggregation %q not found", id)
+	}
+	return agg, nil
+}
+
+func toNoise(mt MechanismType) (noise.Noise, error) {
+	switch mt {
+	case MechanismEmpty, MechanismLaplace:
+		return noise.Laplace(), nil
+	case MechanismGaussian:
+		return noise.Gaussian(), nil
+	}
+	return nil, fmt.Errorf("unknown mechanism_type %d", mt)
+}
@@ -0,0 +1,230 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves s in memory and returns a client connected to it.
+func newTestClient(t *testing.T, s *Server) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(grpc.ForceServerCodec(Codec()))
+	s.Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Couldn't dial the test server: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc)
+}
+
+func TestNewServerInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opt  *ServerOptions
+	}{
+		{"nil options", nil},
+		{"negative Epsilon", &ServerOptions{Epsilon: -1}},
+		{"Delta larger than 1", &ServerOptions{Epsilon: 1, Delta: 2}},
+	} {
+		if _, err := NewServer(tc.opt); err == nil {
+			t.Errorf("NewServer with %s: got no error, want error", tc.desc)
+		}
+	}
+}
+
+func TestServerAggregations(t *testing.T) {
+	s, err := NewServer(&ServerOptions{Epsilon: 3e6})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Server: %v", err)
+	}
+	c := newTestClient(t, s)
+	ctx := context.Background()
+	values := []float64{1, 2, 3, 10}
+	for _, tc := range []struct {
+		typ  AggregationType
+		want float64
+	}{
+		{Count, 4},
+		// 10 is clamped to 5.
+		{BoundedSum, 11},
+		{BoundedMean, 2.75},
+	} {
+		// With a very large ε, the noise is negligible.
+		created, err := c.CreateAggregation(ctx, &CreateAggregationRequest{
+			SessionID:                    "session",
+			Type:                         tc.typ,
+			Epsilon:                      1e6,
+			MaxPartitionsContributed:     1,
+			MaxContributionsPerPartition: 4,
+			Lower:                        0,
+			Upper:                        5,
+		})
+		if err != nil {
+			t.Fatalf("CreateAggregation(%v): got error %v", tc.typ, err)
+		}
+		if _, err := c.Add(ctx, &AddRequest{AggregationID: created.AggregationID, Values: values}); err != nil {
+			t.Fatalf("Add to %v: got error %v", tc.typ, err)
+		}
+		got, err := c.GetResult(ctx, &GetResultRequest{AggregationID: created.AggregationID})
+		if err != nil {
+			t.Fatalf("GetResult of %v: got error %v", tc.typ, err)
+		}
+		if diff := got.Result - tc.want; diff < -1e-3 || diff > 1e-3 {
+			t.Errorf("GetResult of %v: got %f, want %f", tc.typ, got.Result, tc.want)
+		}
+		// The aggregation is deleted after its result is returned.
+		if _, err := c.GetResult(ctx, &GetResultRequest{AggregationID: created.AggregationID}); status.Code(err) != codes.NotFound {
+			t.Errorf("GetResult of %v called twice: got error %v, want code %v", tc.typ, err, codes.NotFound)
+		}
+	}
+}
+
+func TestServerBudgetPerSession(t *testing.T) {
+	s, err := NewServer(&ServerOptions{Epsilon: 1})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Server: %v", err)
+	}
+	c := newTestClient(t, s)
+	ctx := context.Background()
+	req := &CreateAggregationRequest{SessionID: "a", Type: Count, Epsilon: 0.6}
+	created, err := c.CreateAggregation(ctx, req)
+	if err != nil {
+		t.Fatalf("CreateAggregation: got error %v", err)
+	}
+	if created.SpentEpsilon != 0.6 {
+		t.Errorf("CreateAggregation: got SpentEpsilon %f, want 0.6", created.SpentEpsilon)
+	}
+	if _, err := c.CreateAggregation(ctx, req); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("CreateAggregation exceeding the budget: got error %v, want code %v", err, codes.ResourceExhausted)
+	}
+	// Other sessions have their own budget.
+	if _, err := c.CreateAggregation(ctx, &CreateAggregationRequest{SessionID: "b", Type: Count, Epsilon: 0.6}); err != nil {
+		t.Errorf("CreateAggregation in another session: got error %v", err)
+	}
+}
+
+func TestServerInvalidRequests(t *testing.T) {
+	s, err := NewServer(&ServerOptions{Epsilon: 10})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Server: %v", err)
+	}
+	c := newTestClient(t, s)
+	ctx := context.Background()
+	for _, tc := range []struct {
+		desc string
+		req  *CreateAggregationRequest
+	}{
+		{"no session", &CreateAggregationRequest{Type: Count, Epsilon: 1}},
+		{"no type", &CreateAggregationRequest{SessionID: "a", Epsilon: 1}},
+		{"unknown mechanism", &CreateAggregationRequest{SessionID: "a", Type: Count, Epsilon: 1, MechanismType: 3}},
+		{"invalid bounds", &CreateAggregationRequest{SessionID: "a", Type: BoundedSum, Epsilon: 1, MaxPartitionsContributed: 1, Lower: 2, Upper: 1}},
+	} {
+		if _, err := c.CreateAggregation(ctx, tc.req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateAggregation with %s: got error %v, want code %v", tc.desc, err, codes.InvalidArgument)
+		}
+	}
+	if _, err := c.Add(ctx, &AddRequest{AggregationID: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Add to an unknown aggregation: got error %v, want code %v", err, codes.NotFound)
+	}
+	created, err := c.CreateAggregation(ctx, &CreateAggregationRequest{SessionID: "a", Type: Count, Epsilon: 1})
+	if err != nil {
+		t.Fatalf("CreateAggregation: got error %v", err)
+	}
+	other, err := c.CreateAggregation(ctx, &CreateAggregationRequest{SessionID: "b", Type: Count, Epsilon: 1})
+	if err != nil {
+		t.Fatalf("CreateAggregation: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		req  *MergeRequest
+	}{
+		{"no source", &MergeRequest{AggregationID: created.AggregationID}},
+		{"itself", &MergeRequest{AggregationID: created.AggregationID, SourceAggregationID: created.AggregationID}},
+		{"another session", &MergeRequest{AggregationID: created.AggregationID, SourceAggregationID: other.AggregationID}},
+		{"an invalid summary", &MergeRequest{AggregationID: created.AggregationID, Summary: []byte{0xff}}},
+	} {
+		if _, err := c.Merge(ctx, tc.req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Merge with %s: got error %v, want code %v", tc.desc, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestServerMerge(t *testing.T) {
+	s, err := NewServer(&ServerOptions{Epsilon: 3e6})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Server: %v", err)
+	}
+	c := newTestClient(t, s)
+	ctx := context.Background()
+	req := &CreateAggregationRequest{SessionID: "a", Type: Count, Epsilon: 1e6, MaxPartitionsContributed: 1}
+	var ids []string
+	for i := 0; i < 2; i++ {
+		created, err := c.CreateAggregation(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateAggregation: got error %v", err)
+		}
+		if _, err := c.Add(ctx, &AddRequest{AggregationID: created.AggregationID, Values: []float64{1, 2}}); err != nil {
+			t.Fatalf("Add: got error %v", err)
+		}
+		ids = append(ids, created.AggregationID)
+	}
+	if _, err := c.Merge(ctx, &MergeRequest{AggregationID: ids[0], SourceAggregationID: ids[1]}); err != nil {
+		t.Fatalf("Merge of an aggregation: got error %v", err)
+	}
+
+	// Summaries come from an aggregation with the same parameters, e.g. in
+	// another sidecar.
+	count, err := dpagg.NewCount(&dpagg.CountOptions{Epsilon: 1e6, MaxPartitionsContributed: 1, Noise: noise.Laplace()})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Count: %v", err)
+	}
+	count.IncrementBy(3)
+	summary, err := count.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: got error %v", err)
+	}
+	if _, err := c.Merge(ctx, &MergeRequest{AggregationID: ids[0], Summary: summary}); err != nil {
+		t.Fatalf("Merge of a summary: got error %v", err)
+	}
+	got, err := c.GetResult(ctx, &GetResultRequest{AggregationID: ids[0]})
+	if err != nil {
+		t.Fatalf("GetResult: got error %v", err)
+	}
+	if got.Result != 7 {
+		t.Errorf("GetResult after merges: got %f, want 7", got.Result)
+	}
+	// The source aggregation is consumed by the merge.
+	if _, err := c.GetResult(ctx, &GetResultRequest{AggregationID: ids[1]}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetResult of a merged aggregation: got error %v, want code %v", err, codes.NotFound)
+	}
+}
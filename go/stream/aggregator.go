@@ -0,0 +1,249 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/google/differential-privacy/go/dpagg"
+)
+
+// Aggregator maintains a dpagg.KeyedAggregation for each time bucket of the
+// messages it consumes, and emits the results of each bucket when it closes.
+//
+// A bucket closes AllowedLateness after its end, in processing time, or when
+// the stream ends; later messages for the bucket are dropped, see Dropped.
+// Closing the buckets in processing time rather than in event time, i.e. from
+// the times of the messages, ensures that which messages are dropped doesn't
+// depend on the messages of other users.
+//
+// Each bucket is a separate release, with the privacy budget given by the
+// options of its keyed aggregation, and the contributions of each user to a
+// bucket are bounded by these options. A user contributing to several buckets
+// is protected in each of them: the total privacy loss of a user composes over
+// the buckets they contribute to.
+//
+// Not thread-safe.
+type Aggregator[M any] struct {
+	// Parameters
+	bucketWidth     time.Duration
+	allowedLateness time.Duration
+	keyed           *dpagg.KeyedAggregationOptions[string, M]
+	contribute      func(M, Message) error
+	sink            Sink[M]
+	now             func() time.Time
+
+	// State variables
+	buckets map[time.Time]*dpagg.KeyedAggregation[string, M]
+	dropped int64
+	flushed bool
+}
+
+// AggregatorOptions contains the options necessary to initialize an
+// Aggregator.
+type AggregatorOptions[M any] struct {
+	// Width of the time buckets, which are aligned on multiples of
+	// BucketWidth since the zero time. Required.
+	BucketWidth time.Duration
+	// How long, in processing time, messages are accepted after the end of
+	// their bucket. Defaults to 0.
+	AllowedLateness time.Duration
+	// Options of the keyed aggregation of each bucket, which include the
+	// privacy budget of a bucket and the contribution bounds of a user.
+	// Required.
+	Keyed *dpagg.KeyedAggregationOptions[string, M]
+	// Contribute adds a message to the aggregation of its key, e.g.
+	//
+	//	func(c *dpagg.Count, _ stream.Message) error { return c.Increment() }
+	//
+	// Required.
+	Contribute func(m M, msg Message) error
+	// Receives the results of the buckets. Required.
+	Sink Sink[M]
+	// Returns the current time, used to close the buckets. Defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+// NewAggregator returns a new Aggregator, with no buckets.
+func NewAggregator[M any](opt *AggregatorOptions[M]) (*Aggregator[M], error) {
+	if opt == nil {
+		opt = &AggregatorOptions[M]{}
+	}
+	if opt.BucketWidth <= 0 {
+		return nil, fmt.Errorf("NewAggregator: BucketWidth is %v, must be strictly positive", opt.BucketWidth)
+	}
+	if opt.AllowedLateness < 0 {
+		return nil, fmt.Errorf("NewAggregator: AllowedLateness is %v, must be non-negative", opt.AllowedLateness)
+	}
+	if opt.Keyed == nil {
+		return nil, fmt.Errorf("NewAggregator requires Keyed options")
+	}
+	if opt.Contribute == nil {
+		return nil, fmt.Errorf("NewAggregator requires a Contribute function")
+	}
+	if opt.Sink == nil {
+		return nil, fmt.Errorf("NewAggregator requires a Sink")
+	}
+	now := opt.Now
+	if now == nil {
+		now = time.Now
+	}
+	// Check the keyed options, which are used for every bucket.
+	if _, err := dpagg.NewKeyedAggregation(opt.Keyed); err != nil {
+		return nil, fmt.Errorf("NewAggregator: %w", err)
+	}
+	return &Aggregator[M]{
+		bucketWidth:     opt.BucketWidth,
+		allowedLateness: opt.AllowedLateness,
+		keyed:           opt.Keyed,
+		contribute:      opt.Contribute,
+		sink:            opt.Sink,
+		now:             now,
+		buckets:         make(map[time.Time]*dpagg.KeyedAggregation[string, M]),
+	}, nil
+}
+
+// Run consumes the messages of src until it ends, and then closes all the
+// buckets, or until an error occurs. It returns nil if src ended.
+//
+// While waiting for a message, Run closes the buckets when they are due,
+// which requires src to return when the context passed to Next is done.
+func (a *Aggregator[M]) Run(ctx context.Context, src Source) error {
+	for {
+		msg, err := a.next(ctx, src)
+		if errors.Is(err, io.EOF) {
+			return a.Flush(ctx)
+		}
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			// A bucket is due.
+			if err := a.Close(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("stream.Aggregator: couldn't read message: %w", err)
+		}
+		if err := a.Consume(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// next returns the next message of src, or context.DeadlineExceeded when the
+// first open bucket is due.
+func (a *Aggregator[M]) next(ctx context.Context, src Source) (Message, error) {
+	if len(a.buckets) == 0 {
+		return src.Next(ctx)
+	}
+	var first time.Time
+	for start := range a.buckets {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+	}
+	deadlineCtx, cancel := context.WithTimeout(ctx, a.due(first).Sub(a.now()))
+	defer cancel()
+	return src.Next(deadlineCtx)
+}
+
+// due returns the time at which the bucket starting at start closes.
+func (a *Aggregator[M]) due(start time.Time) time.Time {
+	return start.Add(a.bucketWidth).Add(a.allowedLateness)
+}
+
+// Consume adds msg to the aggregation of its bucket, unless the bucket is
+// closed, and then closes the buckets that are due.
+func (a *Aggregator[M]) Consume(ctx context.Context, msg Message) error {
+	if a.flushed {
+		return fmt.Errorf("stream.Aggregator: cannot consume messages after Flush")
+	}
+	if msg.Time.IsZero() {
+		return fmt.Errorf("stream.Aggregator: message has no Time")
+	}
+	start := msg.Time.Truncate(a.bucketWidth)
+	if !a.now().Before(a.due(start)) {
+		a.dropped++
+		return a.Close(ctx)
+	}
+	ka, ok := a.buckets[start]
+	if !ok {
+		var err error
+		if ka, err = dpagg.NewKeyedAggregation(a.keyed); err != nil {
+			return fmt.Errorf("stream.Aggregator: couldn't create aggregation of bucket %v: %w", start, err)
+		}
+		a.buckets[start] = ka
+	}
+	if err := ka.AddValue(msg.PrivacyID, msg.Key, msg.Value, func(m M) error { return a.contribute(m, msg) }); err != nil {
+		return fmt.Errorf("stream.Aggregator: couldn't add message to bucket %v: %w", start, err)
+	}
+	return a.Close(ctx)
+}
+
+// Close closes the buckets that are due, and emits their results. Consume and
+// Run call it, so it only needs to be called when consuming messages with
+// Consume and no messages arrive for a while.
+func (a *Aggregator[M]) Close(ctx context.Context) error {
+	now := a.now()
+	return a.closeBuckets(ctx, func(start time.Time) bool { return !now.Before(a.due(start)) })
+}
+
+// Flush closes all the buckets, e.g. before shutting down, and emits their
+// results. The Aggregator can't consume messages afterwards, since they could
+// belong to buckets that were already released.
+func (a *Aggregator[M]) Flush(ctx context.Context) error {
+	a.flushed = true
+	return a.closeBuckets(ctx, func(time.Time) bool { return true })
+}
+
+// closeBuckets closes the buckets whose start satisfies isDue, in order of
+// start, and emits their results.
+func (a *Aggregator[M]) closeBuckets(ctx context.Context, isDue func(start time.Time) bool) error {
+	var starts []time.Time
+	for start := range a.buckets {
+		if isDue(start) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	for _, start := range starts {
+		ka := a.buckets[start]
+		delete(a.buckets, start)
+		aggregations, err := ka.Result()
+		if err != nil {
+			return fmt.Errorf("stream.Aggregator: couldn't compute result of bucket %v: %w", start, err)
+		}
+		r := BucketResult[M]{Start: start, End: start.Add(a.bucketWidth), Aggregations: aggregations}
+		if err := a.sink.Emit(ctx, r); err != nil {
+			return fmt.Errorf("stream.Aggregator: couldn't emit result of bucket %v: %w", start, err)
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of messages dropped so far because they arrived
+// after their bucket closed. It is computed from the raw data and must not be
+// released, but it can be monitored to tune AllowedLateness.
+func (a *Aggregator[M]) Dropped() int64 {
+	return a.dropped
+}
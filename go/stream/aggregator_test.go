@@ -0,0 +1,256 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/go-cmp/cmp"
+)
+
+// noNoise is a Noise instance that doesn't add noise to the data.
+type noNoise struct {
+	noise.Noise
+}
+
+func (noNoise) AddNoiseInt64(x, _, _ int64, _, _ float64) (int64, error) {
+	return x, nil
+}
+
+// countResult is the result of a bucket, with the counts of its keys.
+type countResult struct {
+	Start  time.Time
+	Counts map[string]int64
+}
+
+// countSink collects the results of the buckets of counts.
+type countSink struct {
+	results []countResult
+}
+
+func (s *countSink) Emit(_ context.Context, r BucketResult[*dpagg.Count]) error {
+	counts := make(map[string]int64)
+	for key, c := range r.Aggregations {
+		count, err := c.Result()
+		if err != nil {
+			return err
+		}
+		counts[key] = count
+	}
+	s.results = append(s.results, countResult{Start: r.Start, Counts: counts})
+	return nil
+}
+
+// fakeClock is a clock whose time is set by the test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+var t0 = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newCountAggregator(t *testing.T, sink Sink[*dpagg.Count], clock *fakeClock) *Aggregator[*dpagg.Count] {
+	t.Helper()
+	opt := &AggregatorOptions[*dpagg.Count]{
+		BucketWidth:     time.Hour,
+		AllowedLateness: 10 * time.Minute,
+		Keyed: &dpagg.KeyedAggregationOptions[string, *dpagg.Count]{
+			New: func() (*dpagg.Count, error) {
+				return dpagg.NewCount(&dpagg.CountOptions{Epsilon: 1, MaxPartitionsContributed: 1, Noise: noNoise{}})
+			},
+			PublicPartitions:             []string{"crash", "launch"},
+			MaxPartitionsContributed:     1,
+			MaxContributionsPerPartition: 2,
+		},
+		Contribute: func(c *dpagg.Count, _ Message) error { return c.Increment() },
+		Sink:       sink,
+	}
+	if clock != nil {
+		opt.Now = clock.Now
+	}
+	a, err := NewAggregator(opt)
+	if err != nil {
+		t.Fatalf("Couldn't initialize Aggregator: %v", err)
+	}
+	return a
+}
+
+func TestAggregatorEmitsBucketsWhenDue(t *testing.T) {
+	ctx := context.Background()
+	sink := &countSink{}
+	clock := &fakeClock{now: t0}
+	a := newCountAggregator(t, sink, clock)
+	for _, msg := range []Message{
+		{PrivacyID: "alice", Key: "launch", Time: t0},
+		// Alice contributes more than MaxContributionsPerPartition times.
+		{PrivacyID: "alice", Key: "launch", Time: t0.Add(time.Minute)},
+		{PrivacyID: "alice", Key: "launch", Time: t0.Add(2 * time.Minute)},
+		{PrivacyID: "bob", Key: "crash", Time: t0.Add(30 * time.Minute)},
+		{PrivacyID: "bob", Key: "launch", Time: t0.Add(time.Hour)},
+	} {
+		if err := a.Consume(ctx, msg); err != nil {
+			t.Fatalf("Consume(%v): got error %v", msg, err)
+		}
+	}
+	if len(sink.results) != 0 {
+		t.Errorf("Consume: emitted %v before any bucket is due, want nothing", sink.results)
+	}
+	// The first bucket closes 10 minutes after its end.
+	clock.now = t0.Add(70 * time.Minute)
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("Close: got error %v", err)
+	}
+	want := []countResult{{Start: t0, Counts: map[string]int64{"crash": 1, "launch": 2}}}
+	if diff := cmp.Diff(want, sink.results); diff != "" {
+		t.Errorf("Close: got diff (-want +got):\n%s", diff)
+	}
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("Flush: got error %v", err)
+	}
+	want = append(want, countResult{Start: t0.Add(time.Hour), Counts: map[string]int64{"crash": 0, "launch": 1}})
+	if diff := cmp.Diff(want, sink.results); diff != "" {
+		t.Errorf("Flush: got diff (-want +got):\n%s", diff)
+	}
+	if err := a.Consume(ctx, Message{PrivacyID: "carol", Key: "crash", Time: clock.now}); err == nil {
+		t.Errorf("Consume after Flush: got no error, want error")
+	}
+}
+
+func TestAggregatorDropsLateMessages(t *testing.T) {
+	ctx := context.Background()
+	sink := &countSink{}
+	clock := &fakeClock{now: t0.Add(70 * time.Minute)}
+	a := newCountAggregator(t, sink, clock)
+	// The bucket of the first message is already due.
+	for _, msg := range []Message{
+		{PrivacyID: "alice", Key: "launch", Time: t0.Add(59 * time.Minute)},
+		{PrivacyID: "bob", Key: "launch", Time: t0.Add(time.Hour)},
+	} {
+		if err := a.Consume(ctx, msg); err != nil {
+			t.Fatalf("Consume(%v): got error %v", msg, err)
+		}
+	}
+	if got := a.Dropped(); got != 1 {
+		t.Errorf("Dropped: got %d, want 1", got)
+	}
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("Flush: got error %v", err)
+	}
+	want := []countResult{{Start: t0.Add(time.Hour), Counts: map[string]int64{"crash": 0, "launch": 1}}}
+	if diff := cmp.Diff(want, sink.results); diff != "" {
+		t.Errorf("Flush: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestAggregatorRun(t *testing.T) {
+	ch := make(chan Message)
+	emitted := make(chan BucketResult[*dpagg.Count], 1)
+	sink := SinkFunc[*dpagg.Count](func(_ context.Context, r BucketResult[*dpagg.Count]) error {
+		emitted <- r
+		return nil
+	})
+	a, err := NewAggregator(&AggregatorOptions[*dpagg.Count]{
+		BucketWidth: 10 * time.Millisecond,
+		Keyed: &dpagg.KeyedAggregationOptions[string, *dpagg.Count]{
+			New: func() (*dpagg.Count, error) {
+				return dpagg.NewCount(&dpagg.CountOptions{Epsilon: 1, MaxPartitionsContributed: 1, Noise: noNoise{}})
+			},
+			PublicPartitions:         []string{"launch"},
+			MaxPartitionsContributed: 1,
+		},
+		Contribute: func(c *dpagg.Count, _ Message) error { return c.Increment() },
+		Sink:       sink,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't initialize Aggregator: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- a.Run(context.Background(), ChannelSource(ch)) }()
+	ch <- Message{PrivacyID: "alice", Key: "launch", Time: time.Now()}
+	// The bucket is emitted when it is due, while Run waits for messages.
+	select {
+	case r := <-emitted:
+		if got, err := r.Aggregations["launch"].Result(); err != nil || got != 1 {
+			t.Errorf("Run: got count (%d, %v) for the first bucket, want 1", got, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Run: the first bucket wasn't emitted when due")
+	}
+	ch <- Message{PrivacyID: "bob", Key: "launch", Time: time.Now().Add(time.Hour)}
+	close(ch)
+	// The second bucket is emitted when the stream ends.
+	if err := <-done; err != nil {
+		t.Errorf("Run: got error %v", err)
+	}
+	if r := <-emitted; !r.Start.After(time.Now()) {
+		t.Errorf("Run: got bucket starting at %v after the stream ended, want the bucket of the second message", r.Start)
+	}
+}
+
+func TestAggregatorRunReturnsErrors(t *testing.T) {
+	sink := SinkFunc[*dpagg.Count](func(context.Context, BucketResult[*dpagg.Count]) error {
+		return errors.New("sink unavailable")
+	})
+	a := newCountAggregator(t, sink, nil)
+	ch := make(chan Message, 1)
+	ch <- Message{PrivacyID: "alice", Key: "launch", Time: time.Now()}
+	close(ch)
+	if err := a.Run(context.Background(), ChannelSource(ch)); err == nil {
+		t.Errorf("Run with failing sink: got no error, want error")
+	}
+
+	a = newCountAggregator(t, &countSink{}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Run(ctx, ChannelSource(make(chan Message))); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run with cancelled context: got error %v, want context.Canceled", err)
+	}
+}
+
+func TestNewAggregatorInvalidOptions(t *testing.T) {
+	keyed := &dpagg.KeyedAggregationOptions[string, *dpagg.Count]{
+		New:                      func() (*dpagg.Count, error) { return dpagg.NewCount(&dpagg.CountOptions{Epsilon: 1}) },
+		PublicPartitions:         []string{"launch"},
+		MaxPartitionsContributed: 1,
+	}
+	contribute := func(c *dpagg.Count, _ Message) error { return c.Increment() }
+	sink := &countSink{}
+	for _, tc := range []struct {
+		desc string
+		opt  *AggregatorOptions[*dpagg.Count]
+	}{
+		{"nil options", nil},
+		{"no BucketWidth", &AggregatorOptions[*dpagg.Count]{Keyed: keyed, Contribute: contribute, Sink: sink}},
+		{"negative AllowedLateness", &AggregatorOptions[*dpagg.Count]{BucketWidth: time.Hour, AllowedLateness: -time.Minute, Keyed: keyed, Contribute: contribute, Sink: sink}},
+		{"no Keyed options", &AggregatorOptions[*dpagg.Count]{BucketWidth: time.Hour, Contribute: contribute, Sink: sink}},
+		{"invalid Keyed options", &AggregatorOptions[*dpagg.Count]{BucketWidth: time.Hour, Keyed: &dpagg.KeyedAggregationOptions[string, *dpagg.Count]{New: keyed.New}, Contribute: contribute, Sink: sink}},
+		{"no Contribute", &AggregatorOptions[*dpagg.Count]{BucketWidth: time.Hour, Keyed: keyed, Sink: sink}},
+		{"no Sink", &AggregatorOptions[*dpagg.Count]{BucketWidth: time.Hour, Keyed: keyed, Contribute: contribute}},
+	} {
+		if _, err := NewAggregator(tc.opt); err == nil {
+			t.Errorf("NewAggregator with %s: got no error, want error", tc.desc)
+		}
+	}
+}
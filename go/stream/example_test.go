@@ -0,0 +1,85 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stream_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/stream"
+)
+
+// This example counts events per hour and per event type, with each user
+// contributing at most once to a single event type per hour.
+func Example() {
+	sink := stream.SinkFunc[*dpagg.Count](func(_ context.Context, r stream.BucketResult[*dpagg.Count]) error {
+		var keys []string
+		for key := range r.Aggregations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			count, err := r.Aggregations[key].Result()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d\n", key, count)
+		}
+		return nil
+	})
+	aggregator, err := stream.NewAggregator(&stream.AggregatorOptions[*dpagg.Count]{
+		BucketWidth:     time.Hour,
+		AllowedLateness: 5 * time.Minute,
+		Keyed: &dpagg.KeyedAggregationOptions[string, *dpagg.Count]{
+			New: func() (*dpagg.Count, error) {
+				// ε is very large so that the output of the example is
+				// deterministic. Use a much lower ε in practice.
+				return dpagg.NewCount(&dpagg.CountOptions{Epsilon: 1e6, MaxPartitionsContributed: 1})
+			},
+			PublicPartitions:         []string{"crash", "launch"},
+			MaxPartitionsContributed: 1,
+			// Keep the first contributions of each user, e.g. the earliest
+			// events if they are consumed in chronological order.
+			ContributionSelection: dpagg.FirstContributions,
+		},
+		Contribute: func(c *dpagg.Count, _ stream.Message) error { return c.Increment() },
+		Sink:       sink,
+	})
+	if err != nil {
+		log.Fatalf("Couldn't initialize Aggregator: %v", err)
+	}
+
+	// In practice, the messages are consumed from a message queue, see the
+	// package documentation.
+	ch := make(chan stream.Message, 3)
+	now := time.Now()
+	ch <- stream.Message{PrivacyID: "alice", Key: "launch", Time: now}
+	ch <- stream.Message{PrivacyID: "bob", Key: "launch", Time: now}
+	// Alice can only contribute once per bucket, so this is dropped.
+	ch <- stream.Message{PrivacyID: "alice", Key: "launch", Time: now}
+	close(ch)
+	if err := aggregator.Run(context.Background(), stream.ChannelSource(ch)); err != nil {
+		log.Fatalf("Run: %v", err)
+	}
+	// Output:
+	// crash: 0
+	// launch: 2
+}
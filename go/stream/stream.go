@@ -0,0 +1,118 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package stream aggregates telemetry consumed from a message stream, e.g. a
+// Kafka topic, with differential privacy. Messages are grouped in time buckets
+// by their event time, and within each bucket by key with a
+// dpagg.KeyedAggregation, which bounds the contributions of each user and
+// selects the keys to release. When a bucket closes, its differentially
+// private results are emitted to a Sink.
+//
+// The stream is read through the Source interface, so that any message queue
+// can be plugged in. For instance, with github.com/segmentio/kafka-go and
+// messages encoded as JSON:
+//
+//	type kafkaSource struct {
+//		r *kafka.Reader
+//	}
+//
+//	func (s kafkaSource) Next(ctx context.Context) (stream.Message, error) {
+//		m, err := s.r.ReadMessage(ctx)
+//		if err != nil {
+//			return stream.Message{}, err
+//		}
+//		var msg stream.Message
+//		err = json.Unmarshal(m.Value, &msg)
+//		return msg, err
+//	}
+//
+// which is then consumed with:
+//
+//	r := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, GroupID: "dp-telemetry", Topic: "events"})
+//	defer r.Close()
+//	err := aggregator.Run(ctx, kafkaSource{r})
+package stream
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Message is a telemetry event consumed from a stream.
+type Message struct {
+	// Privacy identifier of the user who generated the event, used to bound
+	// the contributions of each user. It is never released.
+	PrivacyID string
+	// Key the event is aggregated under, e.g. the name of a metric or a
+	// country.
+	Key string
+	// Event time, which determines the time bucket of the event.
+	Time time.Time
+	// Value of the event, e.g. a latency, for aggregations that need one.
+	Value float64
+}
+
+// Source is a stream of messages, e.g. a Kafka topic.
+type Source interface {
+	// Next blocks until the next message is available and returns it, or
+	// returns io.EOF if the stream ended, or the error of ctx if it is done
+	// first.
+	Next(ctx context.Context) (Message, error)
+}
+
+// ChannelSource returns a Source consuming the messages sent on ch, which ends
+// when ch is closed.
+func ChannelSource(ch <-chan Message) Source {
+	return channelSource(ch)
+}
+
+type channelSource <-chan Message
+
+func (ch channelSource) Next(ctx context.Context) (Message, error) {
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return Message{}, io.EOF
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// BucketResult contains the aggregations released for a time bucket, whose
+// results are computed by the Sink, e.g. with Result for a *dpagg.Count.
+type BucketResult[M any] struct {
+	// Start and End of the bucket: it contains the events at or after Start
+	// and before End.
+	Start, End time.Time
+	// Aggregations of the released keys.
+	Aggregations map[string]M
+}
+
+// Sink receives the results of the time buckets when they close.
+type Sink[M any] interface {
+	Emit(ctx context.Context, r BucketResult[M]) error
+}
+
+// SinkFunc is a function implementing Sink.
+type SinkFunc[M any] func(ctx context.Context, r BucketResult[M]) error
+
+// Emit calls f.
+func (f SinkFunc[M]) Emit(ctx context.Context, r BucketResult[M]) error {
+	return f(ctx, r)
+}
@@ -0,0 +1,198 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package transcript
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// minKeyBits is the minimum size of the RSA key of the auditor.
+const minKeyBits = 2048
+
+// maxSealedSize is the maximum size of a sealed entry, which protects readers
+// from corrupted length prefixes.
+const maxSealedSize = 1 << 20
+
+// sealingLabel is the OAEP label of the sealed keys, which binds them to
+// transcripts.
+var sealingLabel = []byte("differential-privacy transcript")
+
+// SealedRecorder is a Recorder writing each entry to w, encrypted for the
+// auditor: each entry is encrypted with a fresh AES-256-GCM key, which is
+// itself encrypted with RSA-OAEP and the public key of the auditor. Entries
+// can only be read back with the private key, see SealedReader, so the
+// deployment writing them can't.
+//
+// Record can't return errors to the aggregations, so the first error, e.g. a
+// failed write, is kept and returned by Err; later entries are then dropped.
+type SealedRecorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	key *rsa.PublicKey
+	err error
+}
+
+// NewSealedRecorder returns a SealedRecorder writing to w with the public key
+// of the auditor, which must have at least 2048 bits.
+func NewSealedRecorder(w io.Writer, auditorKey *rsa.PublicKey) (*SealedRecorder, error) {
+	if w == nil {
+		return nil, fmt.Errorf("NewSealedRecorder requires a writer")
+	}
+	if auditorKey == nil {
+		return nil, fmt.Errorf("NewSealedRecorder requires the public key of the auditor")
+	}
+	if bits := auditorKey.N.BitLen(); bits < minKeyBits {
+		return nil, fmt.Errorf("NewSealedRecorder: the key of the auditor has %d bits, must have at least %d", bits, minKeyBits)
+	}
+	return &SealedRecorder{w: w, key: auditorKey}, nil
+}
+
+// Record seals e and writes it, unless a previous entry failed.
+func (r *SealedRecorder) Record(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	sealed, err := seal(e, r.key)
+	if err != nil {
+		r.err = fmt.Errorf("couldn't seal transcript entry: %w", err)
+		return
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := r.w.Write(append(length[:], sealed...)); err != nil {
+		r.err = fmt.Errorf("couldn't write transcript entry: %w", err)
+	}
+}
+
+// Err returns the first error encountered by Record, or nil.
+func (r *SealedRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// seal returns the sealed key, the nonce and the encrypted JSON encoding of e,
+// concatenated.
+func seal(e Entry, key *rsa.PublicKey) ([]byte, error) {
+	plaintext, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	entryKey := make([]byte, 32)
+	if _, err := rand.Read(entryKey); err != nil {
+		return nil, err
+	}
+	sealedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, entryKey, sealingLabel)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(entryKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 0, len(sealedKey)+len(nonce)+len(plaintext)+aead.Overhead())
+	sealed = append(append(sealed, sealedKey...), nonce...)
+	return aead.Seal(sealed, nonce, plaintext, sealedKey), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealedReader reads the entries written by a SealedRecorder with the private
+// key of the auditor.
+type SealedReader struct {
+	r   *bufio.Reader
+	key *rsa.PrivateKey
+}
+
+// NewSealedReader returns a SealedReader reading from r with the private key
+// of the auditor.
+func NewSealedReader(r io.Reader, auditorKey *rsa.PrivateKey) (*SealedReader, error) {
+	if r == nil {
+		return nil, fmt.Errorf("NewSealedReader requires a reader")
+	}
+	if auditorKey == nil {
+		return nil, fmt.Errorf("NewSealedReader requires the private key of the auditor")
+	}
+	return &SealedReader{r: bufio.NewReader(r), key: auditorKey}, nil
+}
+
+// Next returns the next entry, in the order in which they were recorded. It
+// returns io.EOF after the last entry, and an error if an entry was truncated,
+// tampered with, or sealed for another key.
+func (sr *SealedReader) Next() (Entry, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(sr.r, length[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Entry{}, io.EOF
+		}
+		return Entry{}, fmt.Errorf("SealedReader: couldn't read length of entry: %w", err)
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	keySize := sr.key.Size()
+	if n > maxSealedSize || int(n) < keySize {
+		return Entry{}, fmt.Errorf("SealedReader: entry has %d bytes, must have between %d and %d", n, keySize, maxSealedSize)
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, sealed); err != nil {
+		return Entry{}, fmt.Errorf("SealedReader: couldn't read entry: %w", err)
+	}
+	sealedKey, rest := sealed[:keySize], sealed[keySize:]
+	entryKey, err := rsa.DecryptOAEP(sha256.New(), nil, sr.key, sealedKey, sealingLabel)
+	if err != nil {
+		return Entry{}, fmt.Errorf("SealedReader: couldn't open key of entry: %w", err)
+	}
+	aead, err := newAEAD(entryKey)
+	if err != nil {
+		return Entry{}, fmt.Errorf("SealedReader: %w", err)
+	}
+	if len(rest) < aead.NonceSize() {
+		return Entry{}, fmt.Errorf("SealedReader: entry is too short")
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, sealedKey)
+	if err != nil {
+		return Entry{}, fmt.Errorf("SealedReader: couldn't open entry: %w", err)
+	}
+	var e Entry
+	if err := json.Unmarshal(plaintext, &e); err != nil {
+		return Entry{}, fmt.Errorf("SealedReader: couldn't decode entry: %w", err)
+	}
+	return e, nil
+}
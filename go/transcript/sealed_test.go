@@ -0,0 +1,193 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package transcript
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	keyOnce  sync.Once
+	auditKey *rsa.PrivateKey
+)
+
+// testKey returns an RSA key generated once for all tests, since generating
+// keys is slow.
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	keyOnce.Do(func() {
+		var err error
+		if auditKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatalf("Couldn't generate key: %v", err)
+		}
+	})
+	return auditKey
+}
+
+func testEntries() []Entry {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	return []Entry{
+		{Time: start, Aggregation: "Count", Mechanism: "laplace", L0Sensitivity: 1, LInfSensitivity: 1, Epsilon: 0.5, PreNoise: 42, PostNoise: 44},
+		{Time: start.Add(time.Second), Aggregation: "BoundedSumFloat64", Mechanism: "gaussian", L0Sensitivity: 3, LInfSensitivity: 2.5, Epsilon: 1, Delta: 1e-5, PreNoise: -3.25, PostNoise: 1.5},
+	}
+}
+
+func TestSealedRecorderRoundTrip(t *testing.T) {
+	key := testKey(t)
+	var buf bytes.Buffer
+	r, err := NewSealedRecorder(&buf, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("NewSealedRecorder: got error %v", err)
+	}
+	want := testEntries()
+	for _, e := range want {
+		r.Record(e)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Err: got %v", err)
+	}
+	// The exact values aren't written in the clear.
+	if bytes.Contains(buf.Bytes(), []byte("BoundedSumFloat64")) {
+		t.Errorf("Record: the sealed transcript contains an entry in the clear")
+	}
+
+	sr, err := NewSealedReader(&buf, key)
+	if err != nil {
+		t.Fatalf("NewSealedReader: got error %v", err)
+	}
+	var got []Entry
+	for {
+		e, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: got error %v", err)
+		}
+		got = append(got, e)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Next: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSealedReaderRejectsOtherKey(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v", err)
+	}
+	var buf bytes.Buffer
+	r, err := NewSealedRecorder(&buf, &other.PublicKey)
+	if err != nil {
+		t.Fatalf("NewSealedRecorder: got error %v", err)
+	}
+	r.Record(testEntries()[0])
+	sr, err := NewSealedReader(&buf, testKey(t))
+	if err != nil {
+		t.Fatalf("NewSealedReader: got error %v", err)
+	}
+	if _, err := sr.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next: with another key got error %v, want a decryption error", err)
+	}
+}
+
+func TestSealedReaderRejectsTampering(t *testing.T) {
+	key := testKey(t)
+	var buf bytes.Buffer
+	r, err := NewSealedRecorder(&buf, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("NewSealedRecorder: got error %v", err)
+	}
+	r.Record(testEntries()[0])
+	sealed := buf.Bytes()
+	for _, tc := range []struct {
+		desc   string
+		sealed []byte
+	}{
+		{"flipped ciphertext byte", func() []byte {
+			s := append([]byte(nil), sealed...)
+			s[len(s)-1] ^= 1
+			return s
+		}()},
+		{"truncated entry", sealed[:len(sealed)-10]},
+		{"truncated length", sealed[:2]},
+		{"oversized length", []byte{0xff, 0xff, 0xff, 0xff}},
+	} {
+		sr, err := NewSealedReader(bytes.NewReader(tc.sealed), key)
+		if err != nil {
+			t.Fatalf("NewSealedReader: got error %v", err)
+		}
+		if _, err := sr.Next(); err == nil || err == io.EOF {
+			t.Errorf("Next with %s: got error %v, want an error", tc.desc, err)
+		}
+	}
+}
+
+func TestNewSealedRecorderInvalidArguments(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		w    io.Writer
+		key  *rsa.PublicKey
+	}{
+		{"nil writer", nil, &testKey(t).PublicKey},
+		{"nil key", &bytes.Buffer{}, nil},
+		{"1024-bit key", &bytes.Buffer{}, &small.PublicKey},
+	} {
+		if _, err := NewSealedRecorder(tc.w, tc.key); err == nil {
+			t.Errorf("NewSealedRecorder with %s: got no error, want error", tc.desc)
+		}
+	}
+	if _, err := NewSealedReader(nil, testKey(t)); err == nil {
+		t.Errorf("NewSealedReader with nil reader: got no error, want error")
+	}
+	if _, err := NewSealedReader(&bytes.Buffer{}, nil); err == nil {
+		t.Errorf("NewSealedReader with nil key: got no error, want error")
+	}
+}
+
+// failingWriter fails all writes.
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errWrite }
+
+func TestSealedRecorderKeepsFirstError(t *testing.T) {
+	r, err := NewSealedRecorder(failingWriter{}, &testKey(t).PublicKey)
+	if err != nil {
+		t.Fatalf("NewSealedRecorder: got error %v", err)
+	}
+	for _, e := range testEntries() {
+		r.Record(e)
+	}
+	if err := r.Err(); !errors.Is(err, errWrite) {
+		t.Errorf("Err: got %v, want %v", err, errWrite)
+	}
+}
@@ -0,0 +1,106 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package transcript provides an optional recorder of mechanism transcripts,
+// so that a trusted auditor can review the releases of a differentially
+// private deployment, e.g. for compliance reviews or to debug unexpected
+// results.
+//
+// The aggregations of the dpagg package report each noised release of a Count
+// or a BoundedSum, including those of the aggregations built on them such as
+// BoundedMeanFloat64, to the Recorder set with SetRecorder, which by default
+// discards everything. Recording doesn't change the released results.
+//
+// Unlike metrics, transcripts hold the exact values before noise, which are as
+// sensitive as the raw data: they must never be published. Record them with a
+// SealedRecorder, which encrypts each entry with the public key of the
+// auditor, so that only the auditor can read them back with a SealedReader:
+//
+//	f, err := os.Create("transcript.sealed")
+//	...
+//	r, err := transcript.NewSealedRecorder(f, auditorPublicKey)
+//	...
+//	transcript.SetRecorder(r)
+package transcript
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Entry is the transcript of a single release of a noise mechanism.
+type Entry struct {
+	// When the release was made.
+	Time time.Time
+	// Type of the released aggregation, e.g. "Count" or "BoundedSumFloat64".
+	Aggregation string
+	// Name of the mechanism adding the noise, e.g. "laplace" or "gaussian", as
+	// reported to metrics.Recorder.
+	Mechanism string
+	// Sensitivity parameters the noise was calibrated to.
+	L0Sensitivity   int64
+	LInfSensitivity float64
+	// Budget consumed by the release.
+	Epsilon, Delta float64
+	// Exact value before noise, and value returned by the mechanism, before
+	// post-processing such as clamping with MaxPrivacyUnits.
+	PreNoise, PostNoise float64
+}
+
+// Recorder receives the transcripts of the releases of differentially private
+// aggregations. Implementations must be safe for concurrent use.
+type Recorder interface {
+	Record(e Entry)
+}
+
+// RecorderFunc is a Recorder calling the function.
+type RecorderFunc func(e Entry)
+
+// Record calls f.
+func (f RecorderFunc) Record(e Entry) {
+	f(e)
+}
+
+// discard is the default Recorder.
+type discard struct{}
+
+func (discard) Record(Entry) {}
+
+// recorderHolder wraps a Recorder so that atomic.Value always stores the same
+// concrete type.
+type recorderHolder struct {
+	r Recorder
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(recorderHolder{discard{}})
+}
+
+// SetRecorder sets the Recorder the aggregations report to. A nil Recorder
+// discards all transcripts, which is the default.
+func SetRecorder(r Recorder) {
+	if r == nil {
+		r = discard{}
+	}
+	current.Store(recorderHolder{r})
+}
+
+// Default returns the Recorder set with SetRecorder.
+func Default() Recorder {
+	return current.Load().(recorderHolder).r
+}
@@ -0,0 +1,31 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package transcript
+
+import "testing"
+
+func TestSetRecorder(t *testing.T) {
+	var got []Entry
+	SetRecorder(RecorderFunc(func(e Entry) { got = append(got, e) }))
+	Default().Record(Entry{Aggregation: "Count"})
+	SetRecorder(nil)
+	// With a nil Recorder, entries are discarded.
+	Default().Record(Entry{Aggregation: "BoundedSumFloat64"})
+	if len(got) != 1 || got[0].Aggregation != "Count" {
+		t.Errorf("Record: got entries %v, want a single Count entry", got)
+	}
+}
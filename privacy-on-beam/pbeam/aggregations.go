@@ -29,6 +29,7 @@ import (
 	"github.com/google/differential-privacy/privacy-on-beam/internal/kv"
 	"github.com/apache/beam/sdks/go/pkg/beam"
 	"github.com/apache/beam/sdks/go/pkg/beam/core/typex"
+	"github.com/apache/beam/sdks/go/pkg/beam/transforms/stats"
 	"github.com/apache/beam/sdks/go/pkg/beam/transforms/top"
 )
 
@@ -53,6 +54,8 @@ func init() {
 	beam.RegisterType(reflect.TypeOf((*prunePartitionsInMemoryKVFn)(nil)).Elem())
 	beam.RegisterType(reflect.TypeOf((*pMap)(nil)).Elem())
 	beam.RegisterType(reflect.TypeOf((*emitPartitionsNotInTheDataFn)(nil)).Elem())
+	beam.RegisterType(reflect.TypeOf((*clampInt64Fn)(nil)))
+	beam.RegisterType(reflect.TypeOf((*noisyTotalInt64Fn)(nil)))
 
 	beam.RegisterFunction(randBool)
 	beam.RegisterFunction(clampNegativePartitionsInt64Fn)
@@ -66,6 +69,7 @@ func init() {
 	beam.RegisterFunction(dereferenceValueToInt64Fn)
 	beam.RegisterFunction(dereferenceValueToFloat64Fn)
 	beam.RegisterFunction(prunePartitionsKVFn)
+	beam.RegisterFunction(otherPartitionInt64Fn)
 	// TODO: add tests to make sure we don't forget anything here
 }
 
@@ -593,6 +597,94 @@ func clampNegativePartitionsInt64Fn(v beam.V, r int64) (beam.V, int64) {
 	return v, r
 }
 
+// clampInt64Fn clamps values to [Lower, Upper].
+type clampInt64Fn struct {
+	Lower, Upper int64
+}
+
+func (fn *clampInt64Fn) ProcessElement(v int64) int64 {
+	if v < fn.Lower {
+		return fn.Lower
+	}
+	if v > fn.Upper {
+		return fn.Upper
+	}
+	return v
+}
+
+// sumInt64 sums the values of col. Unlike stats.Sum, the result is a
+// singleton PCollection even if col is empty.
+func sumInt64(s beam.Scope, col beam.PCollection) beam.PCollection {
+	return stats.Sum(s, beam.Flatten(s, beam.Create(s, int64(0)), col))
+}
+
+// noisyTotalInt64Fn adds noise to the total of an aggregation over all
+// partitions, to which a privacy unit contributes at most
+// MaxPartitionsContributed * MaxValue. Do not initialize it yourself, use
+// newNoisyTotalInt64Fn to create a noisyTotalInt64Fn instance.
+type noisyTotalInt64Fn struct {
+	Epsilon         float64
+	Delta           float64
+	LInfSensitivity int64
+	NoiseKind       noise.Kind
+	noise           noise.Noise // Set during Setup phase according to NoiseKind.
+	TestMode        testMode
+}
+
+// newNoisyTotalInt64Fn returns a noisyTotalInt64Fn with the given budget, and
+// the clampInt64Fn bounding the contributions of a privacy unit to a single
+// partition before they are summed into the total.
+func newNoisyTotalInt64Fn(epsilon, delta float64, maxPartitionsContributed, maxValue int64, noiseKind noise.Kind, testMode testMode) (*noisyTotalInt64Fn, *clampInt64Fn) {
+	clampFn := &clampInt64Fn{Lower: 0, Upper: maxValue}
+	if testMode == noNoiseWithoutContributionBounding {
+		clampFn = &clampInt64Fn{Lower: math.MinInt64, Upper: math.MaxInt64}
+	}
+	// The total is a single value, so the sensitivity of all the partitions a
+	// privacy unit contributes to is its L_∞ sensitivity.
+	return &noisyTotalInt64Fn{
+		Epsilon:         epsilon,
+		Delta:           delta,
+		LInfSensitivity: maxPartitionsContributed * maxValue,
+		NoiseKind:       noiseKind,
+		TestMode:        testMode,
+	}, clampFn
+}
+
+func (fn *noisyTotalInt64Fn) Setup() {
+	fn.noise = noise.ToNoise(fn.NoiseKind)
+	if fn.TestMode.isEnabled() {
+		fn.noise = noNoise{}
+	}
+}
+
+func (fn *noisyTotalInt64Fn) ProcessElement(total int64) (int64, error) {
+	return fn.noise.AddNoiseInt64(total, 1, fn.LInfSensitivity, fn.Epsilon, fn.Delta)
+}
+
+// otherPartitionInt64Fn returns the other partition k, whose value is the
+// noisy total minus the sum of the released partitions, clamped to zero.
+func otherPartitionInt64Fn(k beam.X, total, released int64) (beam.X, int64) {
+	if total < released {
+		return k, 0
+	}
+	return k, total - released
+}
+
+// checkOtherPartition returns an error if the OtherPartition parameter of an
+// aggregation is not valid.
+func checkOtherPartition(otherPartition, publicPartitions interface{}, partitionType reflect.Type) error {
+	if otherPartition == nil {
+		return nil
+	}
+	if publicPartitions != nil {
+		return fmt.Errorf("OtherPartition can't be used with PublicPartitions, since no partition is dropped")
+	}
+	if reflect.TypeOf(otherPartition) != partitionType {
+		return fmt.Errorf("OtherPartition=%+v needs to have the same type as the partition key (%+v), got %+v", otherPartition, partitionType, reflect.TypeOf(otherPartition))
+	}
+	return nil
+}
+
 // Clamp negative partitions to zero for float64 partitions.
 func clampNegativePartitionsFloat64Fn(v beam.V, r float64) (beam.V, float64) {
 	if r < 0 {
@@ -1145,6 +1237,17 @@ func checkPublicPartitions(publicPartitions interface{}, partitionType reflect.T
 	return nil
 }
 
+// hasNoPublicPartitions returns true if publicPartitions is an empty slice or
+// array, in which case the output of an aggregation is empty regardless of
+// the data.
+func hasNoPublicPartitions(publicPartitions interface{}) bool {
+	if publicPartitions == nil {
+		return false
+	}
+	v := reflect.ValueOf(publicPartitions)
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() == 0
+}
+
 // checkDelta returns an error if delta parameter of an aggregation is not valid. Delta
 // is valid in the following cases:
 //     delta == 0; when laplace noise with public partitions are used
@@ -0,0 +1,99 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+)
+
+// BudgetSplit is an aggregations param that splits the budget of an
+// aggregation explicitly between the MaxPartitionsContributed partitions a
+// privacy unit contributes to: the result of each partition, including its
+// partition selection, is then computed with its own share (ε₀,δ₀) of the
+// budget, as if privacy units contributed to a single partition. The share of
+// each partition is recorded in the Ledger of the PrivacySpec.
+//
+// It is either EvenSplit{} or AdvancedCompositionSplit{...}. Without
+// BudgetSplit, the noise of each partition is scaled to MaxPartitionsContributed
+// instead, which is equivalent to EvenSplit{} with Laplace noise, and better
+// with Gaussian noise. Splits weighted by partition are only available with
+// dpagg.KeyedAggregation, since the budget of the partitions of a pbeam
+// aggregation can't depend on their key.
+type BudgetSplit interface {
+	partitionBudget(epsilon, delta float64, maxPartitionsContributed int64) (eps, del float64, err error)
+}
+
+// EvenSplit is a BudgetSplit that gives each partition
+// ε/MaxPartitionsContributed and δ/MaxPartitionsContributed, by basic
+// composition.
+type EvenSplit struct{}
+
+func (EvenSplit) partitionBudget(epsilon, delta float64, maxPartitionsContributed int64) (eps, del float64, err error) {
+	return epsilon / float64(maxPartitionsContributed), delta / float64(maxPartitionsContributed), nil
+}
+
+// AdvancedCompositionSplit is a BudgetSplit that gives each partition the ε₀
+// of the advanced composition theorem, see dpagg.AdvancedCompositionEpsilon,
+// which is larger than ε/MaxPartitionsContributed when privacy units
+// contribute to many partitions, at the cost of a part of δ.
+type AdvancedCompositionSplit struct {
+	// Part of the Delta of the aggregation spent by advanced composition. The
+	// rest of Delta is split evenly between the partitions, e.g. for
+	// partition selection or Gaussian noise; it must be 0 with Laplace noise
+	// and PublicPartitions.
+	//
+	// Required.
+	CompositionDelta float64
+}
+
+func (s AdvancedCompositionSplit) partitionBudget(epsilon, delta float64, maxPartitionsContributed int64) (eps, del float64, err error) {
+	if s.CompositionDelta <= 0 || s.CompositionDelta > delta {
+		return 0, 0, fmt.Errorf("CompositionDelta is %e, must be strictly positive and at most Delta (%e)", s.CompositionDelta, delta)
+	}
+	eps, err = dpagg.AdvancedCompositionEpsilon(epsilon, s.CompositionDelta, maxPartitionsContributed)
+	if err != nil {
+		return 0, 0, err
+	}
+	return eps, (delta - s.CompositionDelta) / float64(maxPartitionsContributed), nil
+}
+
+// splitPartitionBudget returns the budget and MaxPartitionsContributed that
+// the result of each partition of the given transform is computed with: the
+// share of a partition and 1 with a BudgetSplit, in which case the share is
+// recorded in the ledger of spec unless the transform's budget wasn't consumed,
+// and the given values unchanged otherwise.
+func splitPartitionBudget(spec *PrivacySpec, transform string, split BudgetSplit, epsilon, delta float64, maxPartitionsContributed int64, noiseKind noise.Kind, publicPartitions interface{}) (eps, del float64, l0 int64, err error) {
+	if split == nil {
+		return epsilon, delta, maxPartitionsContributed, nil
+	}
+	eps, del, err = split.partitionBudget(epsilon, delta, maxPartitionsContributed)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("BudgetSplit: %w", err)
+	}
+	if err := checkDelta(del, noiseKind, publicPartitions); err != nil {
+		return 0, 0, 0, fmt.Errorf("BudgetSplit: Delta of each partition: %w", err)
+	}
+	log.Infof("%s: budget of each partition with %T is epsilon=%f, delta=%e", transform, split, eps, del)
+	if !hasNoPublicPartitions(publicPartitions) {
+		spec.recordPartitionBudget(transform, eps, del)
+	}
+	return eps, del, 1, nil
+}
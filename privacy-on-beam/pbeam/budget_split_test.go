@@ -0,0 +1,128 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/privacy-on-beam/pbeam/testutils"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/testing/ptest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPartitionBudget(t *testing.T) {
+	advanced, err := dpagg.AdvancedCompositionEpsilon(1, 1e-6, 1000)
+	if err != nil {
+		t.Fatalf("AdvancedCompositionEpsilon: got error %v", err)
+	}
+	for _, tc := range []struct {
+		desc                     string
+		split                    BudgetSplit
+		epsilon, delta           float64
+		maxPartitionsContributed int64
+		wantEpsilon, wantDelta   float64
+	}{
+		{"EvenSplit", EvenSplit{}, 2, 1e-4, 4, 0.5, 2.5e-5},
+		{"AdvancedCompositionSplit", AdvancedCompositionSplit{CompositionDelta: 1e-6}, 1, 1e-5, 1000, advanced, 9e-9},
+		{"AdvancedCompositionSplit with the entire Delta", AdvancedCompositionSplit{CompositionDelta: 1e-6}, 1, 1e-6, 1000, advanced, 0},
+	} {
+		eps, del, err := tc.split.partitionBudget(tc.epsilon, tc.delta, tc.maxPartitionsContributed)
+		if err != nil {
+			t.Fatalf("With %s, partitionBudget: got error %v", tc.desc, err)
+		}
+		if !testutils.ApproxEquals(eps, tc.wantEpsilon) || !testutils.ApproxEquals(del, tc.wantDelta) {
+			t.Errorf("With %s, partitionBudget: got (epsilon,delta)=(%f,%e), expected=(%f,%e)", tc.desc, eps, del, tc.wantEpsilon, tc.wantDelta)
+		}
+	}
+	if advanced <= 1.0/1000 {
+		t.Errorf("AdvancedCompositionSplit: got epsilon %f, expected more than the even split %f", advanced, 1.0/1000)
+	}
+}
+
+func TestSplitPartitionBudgetInvalidParams(t *testing.T) {
+	spec := NewPrivacySpec(1, 1e-5)
+	for _, tc := range []struct {
+		desc             string
+		split            BudgetSplit
+		delta            float64
+		noiseKind        noise.Kind
+		publicPartitions interface{}
+	}{
+		{"AdvancedCompositionSplit without CompositionDelta", AdvancedCompositionSplit{}, 1e-5, noise.GaussianNoise, nil},
+		{"AdvancedCompositionSplit with CompositionDelta larger than Delta", AdvancedCompositionSplit{CompositionDelta: 1e-4}, 1e-5, noise.GaussianNoise, nil},
+		// Laplace noise with public partitions requires a Delta of 0 for each partition.
+		{"AdvancedCompositionSplit with Delta left for Laplace noise", AdvancedCompositionSplit{CompositionDelta: 1e-6}, 1e-5, noise.LaplaceNoise, []int{0}},
+		// Partition selection requires a strictly positive Delta for each partition.
+		{"AdvancedCompositionSplit without Delta left for partition selection", AdvancedCompositionSplit{CompositionDelta: 1e-5}, 1e-5, noise.LaplaceNoise, nil},
+	} {
+		if _, _, _, err := splitPartitionBudget(spec, "test", tc.split, 1, tc.delta, 10, tc.noiseKind, tc.publicPartitions); err == nil {
+			t.Errorf("With %s, splitPartitionBudget: got no error, expected an error", tc.desc)
+		}
+	}
+}
+
+func TestBudgetSplitLedger(t *testing.T) {
+	values := []testutils.PairII{
+		{1, 1},
+		{2, 2},
+	}
+	_, s, col := ptest.CreateList(values)
+	colKV := beam.ParDo(s, testutils.PairToKV, col)
+	spec := NewPrivacySpec(4, 1e-4)
+	pcol := MakePrivate(s, colKV, spec)
+	Count(s, pcol, CountParams{Epsilon: 2, Delta: 1e-4, MaxValue: 1, MaxPartitionsContributed: 4, NoiseKind: LaplaceNoise{}, BudgetSplit: EvenSplit{}})
+	// An aggregation whose output is known to be empty records no budget, and
+	// leaves the entry of the previous Count unchanged.
+	Count(s, pcol, CountParams{Epsilon: 1, MaxValue: 1, MaxPartitionsContributed: 2, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{}, BudgetSplit: EvenSplit{}})
+	// An aggregation without BudgetSplit records no budget per partition.
+	Count(s, pcol, CountParams{Epsilon: 1, MaxValue: 1, MaxPartitionsContributed: 2, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{1, 2}})
+	want := []BudgetLedgerEntry{
+		{Transform: "Count", Epsilon: 2, Delta: 1e-4, PartitionEpsilon: 0.5, PartitionDelta: 2.5e-5},
+		{Transform: "Count", Epsilon: 1},
+	}
+	if diff := cmp.Diff(want, spec.Ledger()); diff != "" {
+		t.Errorf("Ledger: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// Checks that with a BudgetSplit, each partition is computed with its share of
+// the budget, as if privacy units contributed to a single partition.
+func TestCountWithBudgetSplit(t *testing.T) {
+	// Each privacy identifier contributes to 3 partitions.
+	pairs := testutils.ConcatenatePairs(
+		testutils.MakePairsWithFixedV(100, 0),
+		testutils.MakePairsWithFixedV(100, 1),
+		testutils.MakePairsWithFixedV(100, 2))
+	result := []testutils.TestInt64Metric{{0, 100}, {1, 100}, {2, 100}}
+	p, s, col, want := ptest.CreateList2(pairs, result)
+	col = beam.ParDo(s, testutils.PairToKV, col)
+
+	// ε is very large, so the noise is negligible even with a third of it.
+	epsilon := 150.0
+	pcol := MakePrivate(s, col, NewPrivacySpec(epsilon, 0))
+	got := Count(s, pcol, CountParams{MaxValue: 1, MaxPartitionsContributed: 3, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{0, 1, 2}, BudgetSplit: EvenSplit{}})
+	want = beam.ParDo(s, testutils.Int64MetricToKV, want)
+	if err := testutils.ApproxEqualsKVInt64(s, got, want, 1); err != nil {
+		t.Fatalf("TestCountWithBudgetSplit: %v", err)
+	}
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("TestCountWithBudgetSplit: Count(%v) = %v, expected %v: %v", col, got, want, err)
+	}
+}
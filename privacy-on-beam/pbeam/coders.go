@@ -32,6 +32,7 @@ func init() {
 	beam.RegisterCoder(reflect.TypeOf(boundedSumAccumFloat64{}), encodeBoundedSumAccumFloat64, decodeBoundedSumAccumFloat64)
 	beam.RegisterCoder(reflect.TypeOf(boundedMeanAccumFloat64{}), encodeBoundedMeanAccumFloat64, decodeBoundedMeanAccumFloat64)
 	beam.RegisterCoder(reflect.TypeOf(boundedQuantilesAccum{}), encodeBoundedQuantilesAccum, decodeBoundedQuantilesAccum)
+	beam.RegisterCoder(reflect.TypeOf(boundedVarianceAccum{}), encodeBoundedVarianceAccum, decodeBoundedVarianceAccum)
 	beam.RegisterCoder(reflect.TypeOf(expandValuesAccum{}), encodeExpandValuesAccum, decodeExpandValuesAccum)
 	beam.RegisterCoder(reflect.TypeOf(expandFloat64ValuesAccum{}), encodeExpandFloat64ValuesAccum, decodeExpandFloat64ValuesAccum)
 	beam.RegisterCoder(reflect.TypeOf(partitionSelectionAccum{}), encodePartitionSelectionAccum, decodePartitionSelectionAccum)
@@ -87,6 +88,16 @@ func decodeBoundedQuantilesAccum(data []byte) (boundedQuantilesAccum, error) {
 	return ret, err
 }
 
+func encodeBoundedVarianceAccum(v boundedVarianceAccum) ([]byte, error) {
+	return encode(v)
+}
+
+func decodeBoundedVarianceAccum(data []byte) (boundedVarianceAccum, error) {
+	var ret boundedVarianceAccum
+	err := decode(&ret, data)
+	return ret, err
+}
+
 func encodeExpandValuesAccum(v expandValuesAccum) ([]byte, error) {
 	return encode(v)
 }
@@ -48,6 +48,13 @@ type CountParams struct {
 	//
 	// Required.
 	MaxPartitionsContributed int64
+	// How the budget of the aggregation is split between the partitions a
+	// privacy unit contributes to, see BudgetSplit. The estimate of the total
+	// count of OtherPartition isn't computed per partition, so its budget isn't
+	// split.
+	//
+	// Optional.
+	BudgetSplit BudgetSplit
 	// The maximum number of times that a privacy identifier can contribute to
 	// a single count (or, equivalently, the maximum value that a privacy
 	// identifier can add to a single count in total). If MaxValue=10 and a
@@ -80,8 +87,25 @@ type CountParams struct {
 	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
 	// otherwise.
 	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
 	// Optional.
 	PublicPartitions interface{}
+	// If set, contributions to the partitions dropped by partition selection
+	// are rolled up into a single released partition with this key, so that
+	// the released counts add up to an estimate of the total count, e.g. for
+	// dashboards. The count of this partition is a differentially private
+	// estimate of the total count minus the sum of the other released counts;
+	// estimating the total count consumes a third of the budget of the
+	// aggregation.
+	//
+	// OtherPartition must have the partition type of the PrivatePCollection,
+	// and must not be a key that can appear in the data. It can't be used with
+	// PublicPartitions, since no partition is dropped in that case.
+	//
+	// Optional.
+	OtherPartition interface{}
 }
 
 // Count counts the number of times a value appears in a PrivatePCollection,
@@ -104,7 +128,12 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 
 	// Get privacy parameters.
 	spec := pcol.privacySpec
-	epsilon, delta, err := spec.consumeBudget(params.Epsilon, params.Delta)
+	maxValue, err := getMaxContributionsPerPartition(spec, params.MaxValue)
+	if err != nil {
+		log.Fatalf("Couldn't get MaxValue for Count: %v", err)
+	}
+	params.MaxValue = maxValue
+	epsilon, delta, err := spec.consumeBudgetUnlessEmpty("Count", params.PublicPartitions, params.Epsilon, params.Delta)
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for Count: %v", err)
 	}
@@ -150,11 +179,20 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 		decodePairInt64Fn,
 		countPairs,
 		beam.TypeDefinition{Var: beam.XType, T: partitionT.Type()})
+	var totalEpsilon, totalDelta float64
+	if params.OtherPartition != nil {
+		epsilon, delta, totalEpsilon, totalDelta = splitBudgetForOtherPartition(epsilon, delta, noiseKind)
+	}
+	// Split the budget between the partitions, if a BudgetSplit is specified.
+	epsilon, delta, partitionMaxPartitionsContributed, err := splitPartitionBudget(spec, "Count", params.BudgetSplit, epsilon, delta, maxPartitionsContributed, noiseKind, params.PublicPartitions)
+	if err != nil {
+		log.Fatalf("Couldn't split budget for Count: %v", err)
+	}
 	// Add public partitions and return the aggregation output, if public partitions are specified.
 	if params.PublicPartitions != nil {
-		return addPublicPartitionsForCount(s, epsilon, delta, maxPartitionsContributed, params, noiseKind, countsKV, spec.testMode)
+		return addPublicPartitionsForCount(s, epsilon, delta, partitionMaxPartitionsContributed, params, noiseKind, countsKV, spec.testMode)
 	}
-	boundedSumInt64Fn, err := newBoundedSumInt64Fn(epsilon, delta, maxPartitionsContributed, 0, params.MaxValue, noiseKind, false, spec.testMode)
+	boundedSumInt64Fn, err := newBoundedSumInt64Fn(epsilon, delta, partitionMaxPartitionsContributed, 0, params.MaxValue, noiseKind, false, spec.testMode)
 	if err != nil {
 		log.Fatalf("Couldn't get boundedSumInt64Fn for Count: %v", err)
 	}
@@ -163,8 +201,29 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 		countsKV)
 	// Drop thresholded partitions.
 	counts := beam.ParDo(s, dropThresholdedPartitionsInt64Fn, sums)
-	// Clamp negative counts to zero and return.
-	return beam.ParDo(s, clampNegativePartitionsInt64Fn, counts)
+	// Clamp negative counts to zero.
+	counts = beam.ParDo(s, clampNegativePartitionsInt64Fn, counts)
+	if params.OtherPartition == nil {
+		return counts
+	}
+	// Roll up the dropped partitions into the other partition and return.
+	totalFn, clampFn := newNoisyTotalInt64Fn(totalEpsilon, totalDelta, maxPartitionsContributed, params.MaxValue, noiseKind, spec.testMode)
+	total := beam.ParDo(s, totalFn, sumInt64(s, beam.ParDo(s, clampFn, beam.DropKey(s, countsKV))))
+	released := sumInt64(s, beam.DropKey(s, counts))
+	other := beam.ParDo(s, otherPartitionInt64Fn, beam.Create(s, params.OtherPartition),
+		beam.SideInput{Input: total}, beam.SideInput{Input: released})
+	return beam.Flatten(s, counts, other)
+}
+
+// splitBudgetForOtherPartition splits the budget of an aggregation with an
+// other partition into the budget of the per-partition results and the budget
+// of the total, which gets a third of ε and, with Gaussian noise, of δ.
+func splitBudgetForOtherPartition(epsilon, delta float64, noiseKind noise.Kind) (partitionsEpsilon, partitionsDelta, totalEpsilon, totalDelta float64) {
+	totalEpsilon = epsilon / 3
+	if noiseKind == noise.GaussianNoise {
+		totalDelta = delta / 3
+	}
+	return epsilon - totalEpsilon, delta - totalDelta, totalEpsilon, totalDelta
 }
 
 func checkCountParams(params CountParams, epsilon, delta float64, noiseKind noise.Kind, partitionType reflect.Type) error {
@@ -183,7 +242,7 @@ func checkCountParams(params CountParams, epsilon, delta float64, noiseKind nois
 	if params.MaxValue <= 0 {
 		return fmt.Errorf("MaxValue should be strictly positive, got %d", params.MaxValue)
 	}
-	return nil
+	return checkOtherPartition(params.OtherPartition, params.PublicPartitions, partitionType)
 }
 
 func addPublicPartitionsForCount(s beam.Scope, epsilon, delta float64, maxPartitionsContributed int64, params CountParams, noiseKind noise.Kind, countsKV beam.PCollection, testMode testMode) beam.PCollection {
@@ -499,6 +499,39 @@ func TestCountWithPartitionsReturnsNonNegative(t *testing.T) {
 	}
 }
 
+// Checks that Count rolls up the dropped partitions into the other partition.
+func TestCountOtherPartition(t *testing.T) {
+	// Values 0 to 9 are associated with 1 privacy unit each, so they should be
+	// thresholded and rolled up into the other partition -1; value 10 is
+	// associated with 100 privacy units.
+	var pairs []testutils.PairII
+	for v := 0; v < 10; v++ {
+		pairs = append(pairs, testutils.MakePairsWithFixedVStartingFromKey(v, 1, v)...)
+	}
+	pairs = append(pairs, testutils.MakePairsWithFixedVStartingFromKey(10, 100, 10)...)
+	result := []testutils.TestInt64Metric{
+		{10, 100},
+		{-1, 10},
+	}
+	p, s, col, want := ptest.CreateList2(pairs, result)
+	col = beam.ParDo(s, testutils.PairToKV, col)
+
+	// ε is split by 3 for the total, noise and partition selection, so each
+	// gets ε=10⁴. With δ=10⁻¹⁰, a partition with a single privacy unit is
+	// kept with probability ≈10⁻¹⁰.
+	epsilon, delta, k, l1Sensitivity := 1e4, 1e-10, 25.0, 1.0
+	pcol := MakePrivate(s, col, NewPrivacySpec(3*epsilon, delta))
+	got := Count(s, pcol, CountParams{MaxValue: 1, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}, OtherPartition: -1})
+	want = beam.ParDo(s, testutils.Int64MetricToKV, want)
+	// The other partition has the noise of the total and of the released count.
+	if err := testutils.ApproxEqualsKVInt64(s, got, want, 2*testutils.RoundedLaplaceTolerance(k, l1Sensitivity, epsilon)); err != nil {
+		t.Fatalf("TestCountOtherPartition: %v", err)
+	}
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("TestCountOtherPartition: Count(%v) = %v, expected %v: %v", col, got, want, err)
+	}
+}
+
 func TestCheckCountParams(t *testing.T) {
 	_, _, partitions := ptest.CreateList([]int{0})
 	for _, tc := range []struct {
@@ -600,6 +633,33 @@ func TestCheckCountParams(t *testing.T) {
 			partitionType: nil,
 			wantErr:       true,
 		},
+		{
+			desc:          "valid other partition",
+			params:        CountParams{MaxValue: 1, OtherPartition: -1},
+			epsilon:       1,
+			delta:         1e-10,
+			noiseKind:     noise.LaplaceNoise,
+			partitionType: reflect.TypeOf(0),
+			wantErr:       false,
+		},
+		{
+			desc:          "other partition of wrong type",
+			params:        CountParams{MaxValue: 1, OtherPartition: "other"},
+			epsilon:       1,
+			delta:         1e-10,
+			noiseKind:     noise.LaplaceNoise,
+			partitionType: reflect.TypeOf(0),
+			wantErr:       true,
+		},
+		{
+			desc:          "other partition w/ public partitions",
+			params:        CountParams{MaxValue: 1, OtherPartition: -1, PublicPartitions: []int{0}},
+			epsilon:       1,
+			delta:         0,
+			noiseKind:     noise.LaplaceNoise,
+			partitionType: reflect.TypeOf(0),
+			wantErr:       true,
+		},
 	} {
 		if err := checkCountParams(tc.params, tc.epsilon, tc.delta, tc.noiseKind, tc.partitionType); (err != nil) != tc.wantErr {
 			t.Errorf("With %s, got=%v error, wantErr=%t", tc.desc, err, tc.wantErr)
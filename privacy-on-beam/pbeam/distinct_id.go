@@ -77,6 +77,9 @@ type DistinctPrivacyIDParams struct {
 	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
 	// otherwise.
 	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
 	// Optional.
 	PublicPartitions interface{}
 }
@@ -110,7 +113,7 @@ func DistinctPrivacyID(s beam.Scope, pcol PrivatePCollection, params DistinctPri
 	}
 	// Get privacy parameters.
 	spec := pcol.privacySpec
-	epsilon, delta, err := spec.consumeBudget(params.Epsilon, params.Delta)
+	epsilon, delta, err := spec.consumeBudgetUnlessEmpty("DistinctPrivacyID", params.PublicPartitions, params.Epsilon, params.Delta)
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for DistinctPrivacyID: %v", err)
 	}
@@ -56,6 +56,33 @@ type DistinctPerKeyParams struct {
 	//
 	// Required.
 	MaxContributionsPerPartition int64
+	// You can input the list of partitions present in the output if you know
+	// them in advance. When you specify partitions, partition selection /
+	// thresholding will be disabled and partitions will appear in the output
+	// if and only if they appear in the set of public partitions.
+	//
+	// You should not derive the list of partitions non-privately from private
+	// data. You should only use this in either of the following cases:
+	// 	1. The list of partitions is data-independent. For example, if you are
+	// 	aggregating a metric by hour, you could provide a list of all possible
+	// 	hourly period.
+	// 	2. You use a differentially private operation to come up with the list of
+	// 	partitions. For example, you could use the output of a SelectPartitions
+	//  operation or the keys of a DistinctPrivacyID operation as the list of
+	//  public partitions.
+	//
+	// PublicPartitions needs to be a beam.PCollection, slice, or array. The
+	// underlying type needs to match the partition type of the PrivatePCollection.
+	//
+	// Prefer slices or arrays if the list of public partitions is small and
+	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
+	// otherwise.
+	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
+	// Optional.
+	PublicPartitions interface{}
 }
 
 // DistinctPerKey estimates the number of distinct values associated to
@@ -63,7 +90,9 @@ type DistinctPerKeyParams struct {
 // to the estimates and doing pre-aggregation thresholding to remove
 // estimates with a low number of distinct privacy identifiers.
 //
-// DistinctPerKey does not support public partitions yet.
+// It is also possible to manually specify the list of partitions
+// present in the output, in which case the partition selection/thresholding
+// step is skipped.
 //
 // Note: Do not use when your results may cause overflows for Int64 values.
 // This aggregation is not hardened for such applications yet.
@@ -85,6 +114,11 @@ func DistinctPerKey(s beam.Scope, pcol PrivatePCollection, params DistinctPerKey
 	if err != nil {
 		log.Fatalf("Couldn't get MaxPartitionsContributed for DistinctPerKey: %v", err)
 	}
+	maxContributionsPerPartition, err := getMaxContributionsPerPartition(spec, params.MaxContributionsPerPartition)
+	if err != nil {
+		log.Fatalf("Couldn't get MaxContributionsPerPartition for DistinctPerKey: %v", err)
+	}
+	params.MaxContributionsPerPartition = maxContributionsPerPartition
 
 	var noiseKind noise.Kind
 	if params.NoiseKind == nil {
@@ -100,11 +134,17 @@ func DistinctPerKey(s beam.Scope, pcol PrivatePCollection, params DistinctPerKey
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for DistinctPerKey: %v", err)
 	}
-	err = checkDistinctPerKeyParams(params, epsilon, delta, maxPartitionsContributed)
+	err = checkDistinctPerKeyParams(params, epsilon, delta, noiseKind, pcol.codec.KType.T)
 	if err != nil {
 		log.Fatalf("pbeam.DistinctPerKey: %v", err)
 	}
 
+	// Drop non-public partitions, if public partitions are specified.
+	pcol.col, err = dropNonPublicPartitions(s, pcol, params.PublicPartitions, pcol.codec.KType.T)
+	if err != nil {
+		log.Fatalf("Couldn't drop non-public partitions for DistinctPerKey: %v", err)
+	}
+
 	// Do initial per- and cross-partition contribution bounding and swap kv.Pair<K,V> and ID.
 	// This is not great in terms of utility, since dropping contributions randomly might
 	// mean that we keep duplicates instead of distinct values. However, this is necessary
@@ -133,7 +173,7 @@ func DistinctPerKey(s beam.Scope, pcol PrivatePCollection, params DistinctPerKey
 			beam.TypeDefinition{Var: beam.WType, T: idT.Type()}) // PCollection<ID, kv.Pair{K,[]codedV}>, where codedV=[]byte
 
 		// Second, do cross-partition contribution bounding.
-		decoded = boundContributions(s, decoded, params.MaxPartitionsContributed)
+		decoded = boundContributions(s, decoded, maxPartitionsContributed)
 
 		rekeyed = beam.ParDo(
 			s,
@@ -150,12 +190,17 @@ func DistinctPerKey(s beam.Scope, pcol PrivatePCollection, params DistinctPerKey
 			beam.TypeDefinition{Var: beam.WType, T: idT.Type()}) // PCollection<ID, kv.Pair{K,V}>
 	}
 
-	// Perform partition selection.
+	// Perform partition selection, unless public partitions are specified.
 	// We do partition selection after cross-partition contribution bounding because
 	// we want to keep the same contributions across partitions for partition selection
 	// and Count.
-	noiseEpsilon, partitionSelectionEpsilon, noiseDelta, partitionSelectionDelta := splitBudget(epsilon, delta, noiseKind)
-	partitions := SelectPartitions(s, pcol, SelectPartitionsParams{Epsilon: partitionSelectionEpsilon, Delta: partitionSelectionDelta, MaxPartitionsContributed: params.MaxPartitionsContributed})
+	noiseEpsilon, noiseDelta := epsilon, delta
+	partitions := params.PublicPartitions
+	if partitions == nil {
+		var partitionSelectionEpsilon, partitionSelectionDelta float64
+		noiseEpsilon, partitionSelectionEpsilon, noiseDelta, partitionSelectionDelta = splitBudget(epsilon, delta, noiseKind)
+		partitions = SelectPartitions(s, pcol, SelectPartitionsParams{Epsilon: partitionSelectionEpsilon, Delta: partitionSelectionDelta, MaxPartitionsContributed: params.MaxPartitionsContributed})
+	}
 
 	// Keep only one privacyKey per (partitionKey, value) pair
 	// (i.e. remove duplicate values for each partition).
@@ -196,12 +241,16 @@ func splitBudget(epsilon, delta float64, noiseKind noise.Kind) (noiseEpsilon flo
 	return noiseEpsilon, partitionSelectionEpsilon, noiseDelta, partitionSelectionDelta
 }
 
-func checkDistinctPerKeyParams(params DistinctPerKeyParams, epsilon, delta float64, maxPartitionsContributed int64) error {
-	err := checks.CheckEpsilon(epsilon)
+func checkDistinctPerKeyParams(params DistinctPerKeyParams, epsilon, delta float64, noiseKind noise.Kind, partitionType reflect.Type) error {
+	err := checkPublicPartitions(params.PublicPartitions, partitionType)
+	if err != nil {
+		return err
+	}
+	err = checks.CheckEpsilon(epsilon)
 	if err != nil {
 		return err
 	}
-	err = checks.CheckDeltaStrict(delta)
+	err = checkDelta(delta, noiseKind, params.PublicPartitions)
 	if err != nil {
 		return err
 	}
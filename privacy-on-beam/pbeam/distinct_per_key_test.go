@@ -437,3 +437,46 @@ func TestDistinctPerKeyThresholdsOnPrivacyIDs(t *testing.T) {
 		t.Errorf("TestDistinctPerKeyNoNoise: DistinctPerKey(%v) = %v, expected %v: %v", col, got, want, err)
 	}
 }
+
+// Checks that DistinctPerKey with public partitions drops the non-public partitions, keeps the
+// public partitions with few privacy IDs, and adds the empty public ones.
+func TestDistinctPerKeyWithPartitionsNoNoise(t *testing.T) {
+	var triples []testutils.TripleWithIntValue
+	for i := 0; i < 7; i++ { // Add 7 distinct values to Partition 0, which would be thresholded without public partitions.
+		triples = append(triples, testutils.TripleWithIntValue{ID: i, Partition: 0, Value: i})
+	}
+	for i := 0; i < 100; i++ { // Add 100 distinct values to Partition 1, which isn't public.
+		triples = append(triples, testutils.TripleWithIntValue{ID: i, Partition: 1, Value: i})
+	}
+	result := []testutils.TestInt64Metric{
+		{0, 7},
+		{2, 0},
+	}
+	for _, inMemory := range []bool{false, true} {
+		p, s, col, want := ptest.CreateList2(triples, result)
+		col = beam.ParDo(s, testutils.ExtractIDFromTripleWithIntValue, col)
+		publicPartitionsSlice := []int{0, 2}
+		var publicPartitions interface{}
+		if inMemory {
+			publicPartitions = publicPartitionsSlice
+		} else {
+			publicPartitions = beam.CreateList(s, publicPartitionsSlice)
+		}
+
+		// We have ε=50, δ=0 and l1Sensitivity=2. No thresholding is done because partitions are public.
+		// We have 2 partitions. So, to get an overall flakiness of 10⁻²³,
+		// we can have each partition fail with 10⁻²⁵ probability (k=25).
+		epsilon, k, l1Sensitivity := 50.0, 25.0, 2.0
+		// ε is not split because partitions are public.
+		pcol := MakePrivate(s, col, NewPrivacySpec(epsilon, 0))
+		pcol = ParDo(s, testutils.TripleWithIntValueToKV, pcol)
+		got := DistinctPerKey(s, pcol, DistinctPerKeyParams{MaxPartitionsContributed: 2, NoiseKind: LaplaceNoise{}, MaxContributionsPerPartition: 1, PublicPartitions: publicPartitions})
+		want = beam.ParDo(s, testutils.Int64MetricToKV, want)
+		if err := testutils.ApproxEqualsKVInt64(s, got, want, testutils.RoundedLaplaceTolerance(k, l1Sensitivity, epsilon)); err != nil {
+			t.Fatalf("TestDistinctPerKeyWithPartitionsNoNoise with inMemory=%t: %v", inMemory, err)
+		}
+		if err := ptest.Run(p); err != nil {
+			t.Errorf("TestDistinctPerKeyWithPartitionsNoNoise with inMemory=%t: DistinctPerKey(%v) = %v, expected %v: %v", inMemory, col, got, want, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	log "github.com/golang/glog"
+	"github.com/google/differential-privacy/privacy-on-beam/internal/kv"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+)
+
+func init() {
+	beam.RegisterType(reflect.TypeOf((*countDistinctValuesFn)(nil)))
+}
+
+// DistinctPerUnitPerKeyParams specifies the parameters associated with a
+// DistinctPerUnitPerKey aggregation.
+type DistinctPerUnitPerKeyParams struct {
+	// Noise type (which is either LaplaceNoise{} or GaussianNoise{}).
+	//
+	// Defaults to LaplaceNoise{}.
+	NoiseKind NoiseKind
+	// Differential privacy budget consumed by this aggregation. If there is
+	// only one aggregation, both Epsilon and Delta can be left 0; in that
+	// case, the entire budget of the PrivacySpec is consumed.
+	Epsilon, Delta float64
+	// The maximum number of distinct keys that a given privacy identifier
+	// can influence. If a privacy identifier is associated to more keys,
+	// random keys will be dropped. There is an inherent trade-off when
+	// choosing this parameter: a larger MaxPartitionsContributed leads to less
+	// data loss due to contribution bounding, but since the noise added in
+	// aggregations is scaled according to maxPartitionsContributed, it also
+	// means that more noise is added to each mean.
+	//
+	// Required.
+	MaxPartitionsContributed int64
+	// The maximum number of distinct values counted for a given privacy
+	// identifier and key. Privacy identifiers with more distinct values for a
+	// key count as having MaxDistinctValuesPerKey distinct values. A larger
+	// MaxDistinctValuesPerKey leads to less data loss due to contribution
+	// bounding, but more noise is added to each mean.
+	//
+	// Required.
+	MaxDistinctValuesPerKey int64
+	// You can input the list of partitions present in the output if you know
+	// them in advance. When you specify partitions, partition selection /
+	// thresholding will be disabled and partitions will appear in the output
+	// if and only if they appear in the set of public partitions.
+	//
+	// You should not derive the list of partitions non-privately from private
+	// data. You should only use this in either of the following cases:
+	// 	1. The list of partitions is data-independent. For example, if you are
+	// 	aggregating a metric by hour, you could provide a list of all possible
+	// 	hourly period.
+	// 	2. You use a differentially private operation to come up with the list of
+	// 	partitions. For example, you could use the output of a SelectPartitions
+	//  operation or the keys of a DistinctPrivacyID operation as the list of
+	//  public partitions.
+	//
+	// PublicPartitions needs to be a beam.PCollection, slice, or array. The
+	// underlying type needs to match the partition type of the PrivatePCollection.
+	//
+	// Prefer slices or arrays if the list of public partitions is small and
+	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
+	// otherwise.
+	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
+	// Optional.
+	PublicPartitions interface{}
+}
+
+// DistinctPerUnitPerKey estimates, for each key in a PrivatePCollection, the
+// mean number of distinct values associated to the key by each privacy
+// identifier, e.g. the mean number of distinct products viewed per user in
+// each region. Privacy identifiers that aren't associated to a key don't count
+// in the mean of this key.
+//
+// The number of distinct values of each privacy identifier is computed inside
+// the transform and bounded by MaxDistinctValuesPerKey, and each privacy
+// identifier contributes to at most MaxPartitionsContributed keys. The means
+// are then computed as in MeanPerKey, with differentially private noise and,
+// unless public partitions are specified, partition selection.
+//
+// DistinctPerUnitPerKey transforms a PrivatePCollection<K,V> into a
+// PCollection<K,float64>.
+func DistinctPerUnitPerKey(s beam.Scope, pcol PrivatePCollection, params DistinctPerUnitPerKeyParams) beam.PCollection {
+	s = s.Scope("pbeam.DistinctPerUnitPerKey")
+	// Obtain type information from the underlying PCollection<K,V>.
+	idT, kvT := beam.ValidateKVType(pcol.col)
+	if kvT.Type() != reflect.TypeOf(kv.Pair{}) {
+		log.Fatalf("DistinctPerUnitPerKey must be used on a PrivatePCollection of type <K,V>, got type %v instead", kvT)
+	}
+	if pcol.codec == nil {
+		log.Fatalf("DistinctPerUnitPerKey: no codec found for the input PrivatePCollection.")
+	}
+	if err := checkDistinctPerUnitPerKeyParams(params, pcol.codec.KType.T); err != nil {
+		log.Fatalf("pbeam.DistinctPerUnitPerKey: %v", err)
+	}
+
+	// Drop non-public partitions, if public partitions are specified.
+	var err error
+	pcol.col, err = dropNonPublicPartitions(s, pcol, params.PublicPartitions, pcol.codec.KType.T)
+	if err != nil {
+		log.Fatalf("Couldn't drop non-public partitions for DistinctPerUnitPerKey: %v", err)
+	}
+
+	// Collect all values per kv.Pair{ID,K} and count the distinct ones.
+	rekeyed := beam.ParDo(
+		s,
+		newEncodeIDKFn(idT, pcol.codec),
+		pcol.col,
+		beam.TypeDefinition{Var: beam.VType, T: pcol.codec.VType.T}) // PCollection<kv.Pair{ID,K}, V>.
+	combined := beam.CombinePerKey(s,
+		newExpandValuesCombineFn(pcol.codec.VType),
+		rekeyed) // PCollection<kv.Pair{ID,K}, []codedV}>, where codedV=[]byte
+	maxDistinctValues := params.MaxDistinctValuesPerKey
+	if pcol.privacySpec.testMode == noNoiseWithoutContributionBounding {
+		maxDistinctValues = math.MaxInt64
+	}
+	counted := beam.ParDo(s, &countDistinctValuesFn{MaxDistinctValues: maxDistinctValues}, combined) // PCollection<kv.Pair{ID,K}, float64>
+	_, countT := beam.ValidateKVType(counted)
+	pcol.col = beam.ParDo(
+		s,
+		newDecodeIDKFn(countT, kv.NewCodec(idT.Type(), pcol.codec.KType.T)),
+		counted,
+		beam.TypeDefinition{Var: beam.WType, T: idT.Type()}) // PCollection<ID, kv.Pair{K,float64}>
+	pcol.codec = kv.NewCodec(pcol.codec.KType.T, countT.Type())
+
+	// Each privacy identifier now has a single value per key, so cross-partition
+	// contribution bounding, noise and partition selection are done by MeanPerKey.
+	return MeanPerKey(s, pcol, MeanParams{
+		NoiseKind:                    params.NoiseKind,
+		Epsilon:                      params.Epsilon,
+		Delta:                        params.Delta,
+		MaxPartitionsContributed:     params.MaxPartitionsContributed,
+		MaxContributionsPerPartition: 1,
+		MinValue:                     0,
+		MaxValue:                     float64(params.MaxDistinctValuesPerKey),
+		PublicPartitions:             params.PublicPartitions,
+	})
+}
+
+func checkDistinctPerUnitPerKeyParams(params DistinctPerUnitPerKeyParams, partitionType reflect.Type) error {
+	err := checkPublicPartitions(params.PublicPartitions, partitionType)
+	if err != nil {
+		return err
+	}
+	if params.MaxDistinctValuesPerKey <= 0 {
+		return fmt.Errorf("MaxDistinctValuesPerKey should be strictly positive, got %d", params.MaxDistinctValuesPerKey)
+	}
+	return nil
+}
+
+// countDistinctValuesFn takes a PCollection<kv.Pair{ID,K}, []codedV> as input,
+// and returns a PCollection<kv.Pair{ID,K}, float64> with the number of
+// distinct values of each kv.Pair{ID,K}, bounded by MaxDistinctValues.
+type countDistinctValuesFn struct {
+	MaxDistinctValues int64
+}
+
+func (fn *countDistinctValuesFn) ProcessElement(idk kv.Pair, values [][]byte) (kv.Pair, float64) {
+	distinct := make(map[string]bool)
+	for _, v := range values {
+		if int64(len(distinct)) >= fn.MaxDistinctValues {
+			break
+		}
+		distinct[string(v)] = true
+	}
+	return idk, float64(len(distinct))
+}
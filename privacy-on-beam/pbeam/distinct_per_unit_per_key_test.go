@@ -0,0 +1,133 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/privacy-on-beam/pbeam/testutils"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/testing/ptest"
+)
+
+func TestDistinctPerUnitPerKeyNoNoise(t *testing.T) {
+	var triples []testutils.TripleWithIntValue
+	for i := 0; i < 10; i++ {
+		// In partition 0, privacy IDs 0 to 4 have 5 distinct values, bounded to
+		// MaxDistinctValuesPerKey=3, and privacy IDs 5 to 9 have a single value
+		// contributed twice, so the mean is (5*3+5*1)/10 = 2.
+		if i < 5 {
+			for v := 0; v < 5; v++ {
+				triples = append(triples, testutils.TripleWithIntValue{ID: i, Partition: 0, Value: v})
+			}
+		} else {
+			triples = append(triples,
+				testutils.TripleWithIntValue{ID: i, Partition: 0, Value: 0},
+				testutils.TripleWithIntValue{ID: i, Partition: 0, Value: 0})
+		}
+		// In partition 1, privacy IDs 10 to 19 have the same 2 distinct values.
+		triples = append(triples,
+			testutils.TripleWithIntValue{ID: 10 + i, Partition: 1, Value: 0},
+			testutils.TripleWithIntValue{ID: 10 + i, Partition: 1, Value: 1})
+	}
+	result := []testutils.TestFloat64Metric{
+		{0, 2},
+		{1, 2},
+	}
+	p, s, col, want := ptest.CreateList2(triples, result)
+	col = beam.ParDo(s, testutils.ExtractIDFromTripleWithIntValue, col)
+
+	// δ=10⁻²³, ε=1e100 and l0Sensitivity=1 gives a threshold of =2, so both
+	// partitions are kept. Since ε=1e100, the noise is negligible.
+	// ε is split by 2 for noise and for partition selection, so we use 2*ε.
+	pcol := MakePrivate(s, col, NewPrivacySpec(2e100, 1e-23))
+	pcol = ParDo(s, testutils.TripleWithIntValueToKV, pcol)
+	got := DistinctPerUnitPerKey(s, pcol, DistinctPerUnitPerKeyParams{
+		MaxPartitionsContributed: 1,
+		MaxDistinctValuesPerKey:  3,
+		NoiseKind:                LaplaceNoise{},
+	})
+	want = beam.ParDo(s, testutils.Float64MetricToKV, want)
+	if err := testutils.ApproxEqualsKVFloat64(s, got, want, 1e-6); err != nil {
+		t.Fatalf("ApproxEqualsKVFloat64: got error %v", err)
+	}
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("TestDistinctPerUnitPerKeyNoNoise: DistinctPerUnitPerKey(%v) = %v, expected %v: %v", col, got, want, err)
+	}
+}
+
+// Checks that DistinctPerUnitPerKey with public partitions drops the
+// non-public partitions and adds the empty public ones.
+func TestDistinctPerUnitPerKeyWithPartitionsNoNoise(t *testing.T) {
+	var triples []testutils.TripleWithIntValue
+	for i := 0; i < 3; i++ { // Partition 0 would be thresholded without public partitions.
+		triples = append(triples,
+			testutils.TripleWithIntValue{ID: i, Partition: 0, Value: 0},
+			testutils.TripleWithIntValue{ID: i, Partition: 0, Value: 1})
+	}
+	for i := 0; i < 100; i++ { // Partition 1 isn't public.
+		triples = append(triples, testutils.TripleWithIntValue{ID: 3 + i, Partition: 1, Value: i})
+	}
+	// The mean of the empty public partition 2 is the midpoint of [0, 3].
+	result := []testutils.TestFloat64Metric{
+		{0, 2},
+		{2, 1.5},
+	}
+	for _, inMemory := range []bool{false, true} {
+		p, s, col, want := ptest.CreateList2(triples, result)
+		col = beam.ParDo(s, testutils.ExtractIDFromTripleWithIntValue, col)
+		publicPartitionsSlice := []int{0, 2}
+		var publicPartitions interface{}
+		if inMemory {
+			publicPartitions = publicPartitionsSlice
+		} else {
+			publicPartitions = beam.CreateList(s, publicPartitionsSlice)
+		}
+
+		pcol := MakePrivate(s, col, NewPrivacySpec(1e100, 0))
+		pcol = ParDo(s, testutils.TripleWithIntValueToKV, pcol)
+		got := DistinctPerUnitPerKey(s, pcol, DistinctPerUnitPerKeyParams{
+			MaxPartitionsContributed: 1,
+			MaxDistinctValuesPerKey:  3,
+			NoiseKind:                LaplaceNoise{},
+			PublicPartitions:         publicPartitions,
+		})
+		want = beam.ParDo(s, testutils.Float64MetricToKV, want)
+		if err := testutils.ApproxEqualsKVFloat64(s, got, want, 1e-6); err != nil {
+			t.Fatalf("TestDistinctPerUnitPerKeyWithPartitionsNoNoise with inMemory=%t: %v", inMemory, err)
+		}
+		if err := ptest.Run(p); err != nil {
+			t.Errorf("TestDistinctPerUnitPerKeyWithPartitionsNoNoise with inMemory=%t: DistinctPerUnitPerKey(%v) = %v, expected %v: %v", inMemory, col, got, want, err)
+		}
+	}
+}
+
+func TestCheckDistinctPerUnitPerKeyParams(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		params  DistinctPerUnitPerKeyParams
+		wantErr bool
+	}{
+		{"valid parameters", DistinctPerUnitPerKeyParams{MaxDistinctValuesPerKey: 3}, false},
+		{"zero MaxDistinctValuesPerKey", DistinctPerUnitPerKeyParams{}, true},
+		{"negative MaxDistinctValuesPerKey", DistinctPerUnitPerKeyParams{MaxDistinctValuesPerKey: -1}, true},
+	} {
+		if err := checkDistinctPerUnitPerKeyParams(tc.params, nil); (err != nil) != tc.wantErr {
+			t.Errorf("With %s, got=%v, wantErr=%t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/apache/beam/sdks/go/pkg/beam"
+)
+
+func init() {
+	beam.RegisterType(reflect.TypeOf((*assignEventIDsFn)(nil)))
+}
+
+// EventLevel is a PrivacySpecOption that makes each record its own privacy
+// unit, instead of the records sharing a privacy identifier, e.g. for
+// timestamped telemetry events that aren't tied to a user ID. The privacy
+// identifiers of the PCollections given to MakePrivate, MakePrivateFromStruct
+// and MakePrivateFromProto are then ignored, and each record gets a unique one.
+//
+// Each privacy unit contributes a single record, so the aggregations use
+// contribution bounds of 1: MaxPartitionsContributed, and
+// MaxContributionsPerPartition or the MaxValue of Count, must be left unset or
+// set to 1. Note that a user contributing several records is only protected
+// to the extent of a single record.
+//
+// With UnitSampling, records are sampled individually.
+type EventLevel struct{}
+
+// assignEventIDs replaces the privacy identifiers of col, a PCollection<ID,V>,
+// by unique string identifiers if spec has EventLevel, so that each record is
+// its own privacy unit.
+func assignEventIDs(s beam.Scope, col beam.PCollection, spec *PrivacySpec) beam.PCollection {
+	if !spec.eventLevel {
+		return col
+	}
+	return beam.ParDo(s.Scope("pbeam.assignEventIDs"), &assignEventIDsFn{}, col)
+}
+
+// assignEventIDsFn keys each record by a unique identifier, made of a random
+// prefix drawn for each bundle and the index of the record in the bundle.
+type assignEventIDsFn struct {
+	prefix string
+	index  int64
+}
+
+func (fn *assignEventIDsFn) StartBundle(_ func(string, beam.V)) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("pbeam.assignEventIDsFn.StartBundle: couldn't generate prefix: %w", err)
+	}
+	fn.prefix = hex.EncodeToString(b)
+	fn.index = 0
+	return nil
+}
+
+func (fn *assignEventIDsFn) ProcessElement(_ beam.W, v beam.V, emit func(string, beam.V)) {
+	fn.index++
+	emit(fn.prefix+"-"+strconv.FormatInt(fn.index, 10), v)
+}
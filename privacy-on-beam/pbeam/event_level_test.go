@@ -0,0 +1,76 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"testing"
+
+	"github.com/google/differential-privacy/privacy-on-beam/pbeam/testutils"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/testing/ptest"
+)
+
+func TestContributionBoundsWithEventLevel(t *testing.T) {
+	spec := NewPrivacySpec(1, 1e-10, EventLevel{})
+	for _, tc := range []struct {
+		bound   int64
+		want    int64
+		wantErr bool
+	}{
+		{0, 1, false},
+		{1, 1, false},
+		{2, 0, true},
+	} {
+		got, err := getMaxPartitionsContributed(spec, tc.bound)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("getMaxPartitionsContributed(%d): with EventLevel got (%d, %v), want %d and error %t", tc.bound, got, err, tc.want, tc.wantErr)
+		}
+		got, err = getMaxContributionsPerPartition(spec, tc.bound)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("getMaxContributionsPerPartition(%d): with EventLevel got (%d, %v), want %d and error %t", tc.bound, got, err, tc.want, tc.wantErr)
+		}
+	}
+	if got, err := getMaxContributionsPerPartition(NewPrivacySpec(1, 1e-10), 3); err != nil || got != 3 {
+		t.Errorf("getMaxContributionsPerPartition(3): without EventLevel got (%d, %v), want (3, nil)", got, err)
+	}
+}
+
+// Checks that with EventLevel, all the records of a privacy identifier are
+// counted, since each of them is its own privacy unit.
+func TestMakePrivateWithEventLevel(t *testing.T) {
+	const numRecords = 100
+	pairs := make([]testutils.PairII, numRecords)
+	for i := range pairs {
+		// All records have the same privacy identifier and partition.
+		pairs[i] = testutils.PairII{A: 1, B: 0}
+	}
+	result := []testutils.TestInt64Metric{{0, numRecords}}
+	p, s, col, want := ptest.CreateList2(pairs, result)
+	col = beam.ParDo(s, testutils.PairToKV, col)
+
+	// ε is very large, so the noise is negligible.
+	epsilon := 50.0
+	pcol := MakePrivate(s, col, NewPrivacySpec(epsilon, 0, EventLevel{}))
+	got := Count(s, pcol, CountParams{NoiseKind: LaplaceNoise{}, PublicPartitions: []int{0}})
+	want = beam.ParDo(s, testutils.Int64MetricToKV, want)
+	if err := testutils.ApproxEqualsKVInt64(s, got, want, 1); err != nil {
+		t.Fatalf("TestMakePrivateWithEventLevel: %v", err)
+	}
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("TestMakePrivateWithEventLevel: Count(%v) = %v, expected %v: %v", col, got, want, err)
+	}
+}
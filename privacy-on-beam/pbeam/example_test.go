@@ -109,3 +109,80 @@ func Example() {
 		fmt.Printf("Pipeline failed: %v", err)
 	}
 }
+
+// This example first privately discovers the weekdays present in the data of
+// the example above, and then computes several aggregations over them. Since
+// the weekdays are selected privately, they can be used as public partitions:
+// the aggregations skip partition selection, don't spend any δ on it, and
+// return a result for each selected weekday.
+func ExampleSelectPartitions() {
+	// visit contains the data corresponding to a single restaurant visit.
+	type visit struct {
+		visitorID  string
+		eurosSpent int
+		weekday    int
+	}
+
+	beam.Init()
+	p := beam.NewPipeline()
+	s := p.Root()
+
+	icol := textio.Read(s, "week_data.csv")
+	icol = beam.ParDo(s, func(s string, emit func(visit)) {
+		var visitorID string
+		var euros, weekday int
+		_, err := fmt.Sscanf(s, "%s, %d, %d", &visitorID, &euros, &weekday)
+		if err != nil {
+			return
+		}
+		emit(visit{visitorID, euros, weekday})
+	}, icol)
+
+	// The budget is shared by the three aggregations below: the partition
+	// selection uses all of δ, and the aggregations with Laplace noise don't
+	// need any.
+	const ε, δ = 1, 1e-3
+	privacySpec := pbeam.NewPrivacySpec(ε, δ)
+	pcol := pbeam.MakePrivateFromStruct(s, icol, privacySpec, "visitorID")
+	pWeekdayEuros := pbeam.ParDo(s, func(v visit) (int, int) {
+		return v.weekday, v.eurosSpent
+	}, pcol)
+
+	// weekdays is a regular PCollection<int> of the selected weekdays.
+	weekdays := pbeam.SelectPartitions(s, pWeekdayEuros, pbeam.SelectPartitionsParams{
+		Epsilon:                  ε / 3,
+		Delta:                    δ,
+		MaxPartitionsContributed: 4,
+	})
+
+	pWeekdays := pbeam.ParDo(s, func(v visit) int {
+		return v.weekday
+	}, pcol)
+	visits := pbeam.Count(s, pWeekdays, pbeam.CountParams{
+		Epsilon:                  ε / 3,
+		MaxPartitionsContributed: 4,
+		MaxValue:                 1,
+		PublicPartitions:         weekdays,
+	})
+	means := pbeam.MeanPerKey(s, pWeekdayEuros, pbeam.MeanParams{
+		Epsilon:                      ε / 3,
+		MaxPartitionsContributed:     4,
+		MaxContributionsPerPartition: 1,
+		MinValue:                     0,
+		MaxValue:                     50,
+		PublicPartitions:             weekdays,
+	})
+
+	formattedVisits := beam.ParDo(s, func(weekday int, count int64) string {
+		return fmt.Sprintf("Weekday n°%d: %d visits", weekday, count)
+	}, visits)
+	formattedMeans := beam.ParDo(s, func(weekday int, mean float64) string {
+		return fmt.Sprintf("Weekday n°%d: average spend is %.2f euros", weekday, mean)
+	}, means)
+	textio.Write(s, "visits_per_weekday.txt", formattedVisits)
+	textio.Write(s, "mean_spend_per_weekday.txt", formattedMeans)
+
+	if _, err := direct.Execute(context.Background(), p); err != nil {
+		fmt.Printf("Pipeline failed: %v", err)
+	}
+}
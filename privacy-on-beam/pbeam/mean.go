@@ -52,6 +52,11 @@ type MeanParams struct {
 	//
 	// Required.
 	MaxPartitionsContributed int64
+	// How the budget of the aggregation is split between the partitions a
+	// privacy unit contributes to, see BudgetSplit.
+	//
+	// Optional.
+	BudgetSplit BudgetSplit
 	// The maximum number of contributions from a given privacy identifier
 	// for each key. There is an inherent trade-off when choosing this
 	// parameter: a larger MaxContributionsPerPartition leads to less data loss due
@@ -96,6 +101,9 @@ type MeanParams struct {
 	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
 	// otherwise.
 	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
 	// Optional.
 	PublicPartitions interface{}
 }
@@ -126,7 +134,12 @@ func MeanPerKey(s beam.Scope, pcol PrivatePCollection, params MeanParams) beam.P
 
 	// Get privacy parameters.
 	spec := pcol.privacySpec
-	epsilon, delta, err := spec.consumeBudget(params.Epsilon, params.Delta)
+	maxContributionsPerPartition, err := getMaxContributionsPerPartition(spec, params.MaxContributionsPerPartition)
+	if err != nil {
+		log.Fatalf("Couldn't get MaxContributionsPerPartition for MeanPerKey: %v", err)
+	}
+	params.MaxContributionsPerPartition = maxContributionsPerPartition
+	epsilon, delta, err := spec.consumeBudgetUnlessEmpty("MeanPerKey", params.PublicPartitions, params.Epsilon, params.Delta)
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for Mean: %v", err)
 	}
@@ -186,6 +199,11 @@ func MeanPerKey(s beam.Scope, pcol PrivatePCollection, params MeanParams) beam.P
 	if spec.testMode != noNoiseWithoutContributionBounding {
 		rekeyed = boundContributions(s, rekeyed, maxPartitionsContributed)
 	}
+	// Split the budget between the partitions, if a BudgetSplit is specified.
+	epsilon, delta, maxPartitionsContributed, err = splitPartitionBudget(spec, "MeanPerKey", params.BudgetSplit, epsilon, delta, maxPartitionsContributed, noiseKind, params.PublicPartitions)
+	if err != nil {
+		log.Fatalf("Couldn't split budget for MeanPerKey: %v", err)
+	}
 
 	// Now that the cross-partition contribution bounding is done, remove the privacy keys and decode the values.
 	// Result is PCollection<partition, []float64>.
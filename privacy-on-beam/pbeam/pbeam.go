@@ -136,11 +136,22 @@ func init() {
 // you have multiple pipelines in the same binary, and want them to use
 // different privacy budgets, call NewPrivacySpec multiple times and give a
 // different PrivacySpec to each PrivatePCollection.
+//
+// To make the output of pipelines deterministic in unit tests, use the
+// PrivacySpecs of the pbeamtest package instead:
+// pbeamtest.NewPrivacySpecNoNoiseWithContributionBounding disables noise and
+// partition selection but keeps contribution bounding, and
+// pbeamtest.NewPrivacySpecNoNoiseWithoutContributionBounding also disables
+// contribution bounding. They don't provide any privacy protection, and must
+// only be used in test code.
 type PrivacySpec struct {
 	epsilon           float64 // ε budget available for this PrivatePCollection.
 	delta             float64 // δ budget available for this PrivatePCollection.
 	partiallyConsumed bool    // Whether some privacy budget has already been consumed from this PrivacySpec.
+	ledger   []BudgetLedgerEntry // Budget consumed by each transform, see Ledger.
 	testMode testMode // Used for test pipelines, disabled by default.
+	sampling *unitSampler // Sampling of privacy units, see UnitSampling. Disabled by default.
+	eventLevel bool // Whether each record is its own privacy unit, see EventLevel. Disabled by default.
 	mux      sync.Mutex
 }
 
@@ -168,16 +179,82 @@ func (ps *PrivacySpec) getBudgetThreadUnsafe(epsilon, delta float64) (eps, del f
 }
 
 // consumeBudget consumes a differential privacy budget (ε,δ) from a
-// PrivacySpec. If epsilon and delta are 0, it consumes the entire budget,
-// which is only possible if this is the first time its budget is consumed.
+// PrivacySpec on behalf of the given transform, and records it in the ledger.
+// If epsilon and delta are 0, it consumes the entire budget, which is only
+// possible if this is the first time its budget is consumed.
 // Returns the budget consumed.
-func (ps *PrivacySpec) consumeBudget(epsilon, delta float64) (eps, del float64, err error) {
+func (ps *PrivacySpec) consumeBudget(transform string, epsilon, delta float64) (eps, del float64, err error) {
 	ps.mux.Lock()
 	defer ps.mux.Unlock()
 	eps, del, err = ps.getBudgetThreadUnsafe(epsilon, delta)
 	ps.epsilon = ps.epsilon - eps
 	ps.delta = ps.delta - del
 	ps.partiallyConsumed = true
+	if err == nil {
+		ps.ledger = append(ps.ledger, BudgetLedgerEntry{Transform: transform, Epsilon: eps, Delta: del})
+	}
+	return eps, del, err
+}
+
+// BudgetLedgerEntry is the privacy budget consumed from a PrivacySpec by a
+// transform, see PrivacySpec.Ledger.
+type BudgetLedgerEntry struct {
+	// Name of the transform, e.g. "Count". Transforms built on other
+	// transforms, like DistinctPerKey, record the budget of each of them.
+	Transform      string
+	Epsilon, Delta float64
+	// Budget of the result of each partition with a BudgetSplit, and 0
+	// otherwise.
+	PartitionEpsilon, PartitionDelta float64
+}
+
+// Ledger returns the privacy budget consumed by each transform using the
+// PrivacySpec so far, in the order in which the transforms were added to the
+// pipeline. The budget is consumed when the pipeline is constructed, so the
+// ledger is complete once all the transforms have been added.
+func (ps *PrivacySpec) Ledger() []BudgetLedgerEntry {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	return append([]BudgetLedgerEntry(nil), ps.ledger...)
+}
+
+// recordPartitionBudget records the budget of each partition of the last
+// ledger entry of the given transform, see BudgetSplit. Nothing is recorded if
+// the transform didn't consume any budget, e.g. with empty PublicPartitions.
+func (ps *PrivacySpec) recordPartitionBudget(transform string, epsilon, delta float64) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	for i := len(ps.ledger) - 1; i >= 0; i-- {
+		if ps.ledger[i].Transform == transform {
+			ps.ledger[i].PartitionEpsilon = epsilon
+			ps.ledger[i].PartitionDelta = delta
+			return
+		}
+	}
+}
+
+// RemainingBudget returns the privacy budget (ε,δ) of the PrivacySpec that
+// hasn't been consumed by any transform yet.
+func (ps *PrivacySpec) RemainingBudget() (epsilon, delta float64) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	return ps.epsilon, ps.delta
+}
+
+// consumeBudgetUnlessEmpty is like consumeBudget, except that it doesn't
+// consume the budget of an aggregation whose output is known to be empty when
+// the pipeline is constructed, i.e. whose public partitions are an empty slice
+// or array. Such an aggregation doesn't release anything, so its budget is left
+// in the PrivacySpec for the other aggregations. The budget is still returned,
+// since it is needed to construct the (empty) aggregation.
+func (ps *PrivacySpec) consumeBudgetUnlessEmpty(transform string, publicPartitions interface{}, epsilon, delta float64) (eps, del float64, err error) {
+	if !hasNoPublicPartitions(publicPartitions) {
+		return ps.consumeBudget(transform, epsilon, delta)
+	}
+	eps, del, err = ps.getBudget(epsilon, delta)
+	if err == nil {
+		log.Infof("PublicPartitions is empty, the aggregation's budget (epsilon=%f, delta=%e) is left in the PrivacySpec", eps, del)
+	}
 	return eps, del, err
 }
 
@@ -194,7 +271,7 @@ func (ps *PrivacySpec) getPartialBudget(epsilon, delta float64) (eps, del float6
 		epsilon = ps.epsilon
 	}
 	if budgetSlightlyTooLarge(ps.delta, delta) {
-		log.Infof("corrected rounding error for delta budget allocation (requested: %e, available: %e, difference: %e)", epsilon, ps.epsilon, epsilon-ps.epsilon)
+		log.Infof("corrected rounding error for delta budget allocation (requested: %e, available: %e, difference: %e)", delta, ps.delta, delta-ps.delta)
 		delta = ps.delta
 	}
 	if ps.epsilon < epsilon || ps.delta < delta {
@@ -224,6 +301,14 @@ func budgetSlightlyTooLarge(remaining, requested float64) bool {
 type PrivacySpecOption interface{}
 
 func evaluatePrivacySpecOption(opt PrivacySpecOption, spec *PrivacySpec) {
+	if us, ok := opt.(UnitSampling); ok {
+		spec.sampling = mustNewUnitSampler(us)
+		return
+	}
+	if _, ok := opt.(EventLevel); ok {
+		spec.eventLevel = true
+		return
+	}
 	switch opt {
 	case testoption.EnableNoNoiseWithContributionBounding{}:
 		spec.testMode = noNoiseWithContributionBounding
@@ -233,14 +318,34 @@ func evaluatePrivacySpecOption(opt PrivacySpecOption, spec *PrivacySpec) {
 }
 
 // getMaxPartitionsContributed returns a maxPartitionsContributed parameter
-// if it greater than zero, otherwise it fails.
+// if it greater than zero, otherwise it fails. With EventLevel, it returns 1,
+// and fails if the parameter is set to another value.
 func getMaxPartitionsContributed(spec *PrivacySpec, maxPartitionsContributed int64) (int64, error) {
+	if spec.eventLevel {
+		if maxPartitionsContributed != 0 && maxPartitionsContributed != 1 {
+			return 0, fmt.Errorf("MaxPartitionsContributed must be unset or 1 with EventLevel, was %d instead.", maxPartitionsContributed)
+		}
+		return 1, nil
+	}
 	if maxPartitionsContributed <= 0 {
 		return 0, fmt.Errorf("MaxPartitionsContributed must be set to a positive value, was %d instead.", maxPartitionsContributed)
 	}
 	return maxPartitionsContributed, nil
 }
 
+// getMaxContributionsPerPartition returns the maximum number of contributions
+// of a privacy unit to a single partition: 1 with EventLevel, in which case
+// the parameter must be unset or 1, and the parameter unchanged otherwise.
+func getMaxContributionsPerPartition(spec *PrivacySpec, maxContributionsPerPartition int64) (int64, error) {
+	if !spec.eventLevel {
+		return maxContributionsPerPartition, nil
+	}
+	if maxContributionsPerPartition != 0 && maxContributionsPerPartition != 1 {
+		return 0, fmt.Errorf("MaxContributionsPerPartition must be unset or 1 with EventLevel, was %d instead.", maxContributionsPerPartition)
+	}
+	return 1, nil
+}
+
 // NoiseKind represents the kind of noise to be used in an aggregations.
 type NoiseKind interface {
 	toNoiseKind() noise.Kind
@@ -266,7 +371,9 @@ func (ln LaplaceNoise) toNoiseKind() noise.Kind {
 // The epsilon and delta arguments are the total (ε,δ)-differential privacy
 // budget for the pipeline. If there is only one aggregation, the entire budget
 // will be used for this aggregation. Otherwise, the user must specify how the
-// privacy budget is split across aggregations.
+// privacy budget is split across aggregations. If privacy units are sampled
+// with the UnitSampling option, the budget that can be split across
+// aggregations is larger, see UnitSampling.
 func NewPrivacySpec(epsilon, delta float64, options ...PrivacySpecOption) *PrivacySpec {
 	ps := &PrivacySpec{
 		epsilon: epsilon,
@@ -275,6 +382,9 @@ func NewPrivacySpec(epsilon, delta float64, options ...PrivacySpecOption) *Priva
 	for _, opt := range options {
 		evaluatePrivacySpecOption(opt, ps)
 	}
+	if ps.sampling != nil {
+		ps.epsilon, ps.delta = budgetBeforeSampling(epsilon, delta, ps.sampling.rate)
+	}
 	return ps
 }
 
@@ -307,12 +417,13 @@ type PrivatePCollection struct {
 
 // MakePrivate transforms a PCollection<K,V> into a PrivatePCollection<V>,
 // where <K> is the privacy unit.
-func MakePrivate(_ beam.Scope, col beam.PCollection, spec *PrivacySpec) PrivatePCollection {
+func MakePrivate(s beam.Scope, col beam.PCollection, spec *PrivacySpec) PrivatePCollection {
 	if !typex.IsKV(col.Type()) {
 		log.Fatalf("MakePrivate: PCollection col=%v  must be of KV type", col)
 	}
+	s = s.Scope("pbeam.MakePrivate")
 	return PrivatePCollection{
-		col:         col,
+		col:         sampleUnits(s, assignEventIDs(s, col, spec), spec.sampling),
 		privacySpec: spec,
 	}
 }
@@ -357,7 +468,7 @@ func MakePrivateFromStruct(s beam.Scope, col beam.PCollection, spec *PrivacySpec
 	}
 	extractFn := &extractStructFieldFn{IDFieldPath: idFieldPath}
 	return PrivatePCollection{
-		col:         beam.ParDo(s, extractFn, col),
+		col:         sampleUnits(s, assignEventIDs(s, beam.ParDo(s, extractFn, col), spec), spec.sampling),
 		privacySpec: spec,
 	}
 }
@@ -442,7 +553,7 @@ func MakePrivateFromProto(s beam.Scope, col beam.PCollection, spec *PrivacySpec,
 		MsgType:     beam.EncodedType{msgType},
 	}
 	return PrivatePCollection{
-		col:         beam.ParDo(s, extractFn, col),
+		col:         sampleUnits(s, assignEventIDs(s, beam.ParDo(s, extractFn, col), spec), spec.sampling),
 		privacySpec: spec,
 	}
 }
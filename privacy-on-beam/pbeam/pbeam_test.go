@@ -303,14 +303,14 @@ func TestGetFullBudget(t *testing.T) {
 	}
 
 	// Split the budget and consume it in two calls.
-	eps, del, err = spec.consumeBudget(1, 1e-10)
+	eps, del, err = spec.consumeBudget("test", 1, 1e-10)
 	if err != nil {
 		t.Errorf("expected no error but got error: %v", err)
 	}
 	if eps != 1.0 || del != 1e-10 {
 		t.Errorf("Trying to consume the budget after getBudget call: Got (epsilon,delta)=(%f,%e), expected=(%f,%e)", eps, del, 1.0, 1e-10)
 	}
-	eps, del, err = spec.consumeBudget(1, 1e-10)
+	eps, del, err = spec.consumeBudget("test", 1, 1e-10)
 	if err != nil {
 		t.Errorf("expected no error but got error: %v", err)
 	}
@@ -330,7 +330,7 @@ func TestGetPartialBudget(t *testing.T) {
 		t.Errorf("Trying to get first half of the budget: Got (epsilon,delta)=(%f,%e), expected=(%f,%e)", eps, del, 1.0, 1e-10)
 	}
 
-	eps, del, err = spec.consumeBudget(1, 1e-10)
+	eps, del, err = spec.consumeBudget("test", 1, 1e-10)
 	if err != nil {
 		t.Errorf("expected no error but got error: %v", err)
 	}
@@ -346,7 +346,7 @@ func TestGetPartialBudget(t *testing.T) {
 		t.Errorf("Trying to get second half of the budget: Got (epsilon,delta)=(%f,%e), expected=(%f,%e)", eps, del, 1.0, 1e-10)
 	}
 
-	eps, del, err = spec.consumeBudget(1, 1e-10)
+	eps, del, err = spec.consumeBudget("test", 1, 1e-10)
 	if err != nil {
 		t.Errorf("expected no error but got error: %v", err)
 	}
@@ -371,7 +371,7 @@ func TestBudgetFullyConsumed(t *testing.T) {
 		t.Errorf("expected no error but got error: %v", err)
 	}
 	// Try consuming 1% of the initial budget.
-	if eps, del, err := spec.consumeBudget(0.01, 1e-32); err == nil {
+	if eps, del, err := spec.consumeBudget("test", 0.01, 1e-32); err == nil {
 		t.Errorf("expected spec to be out of budget, but could consume (%f,%e) without any error", eps, del)
 	}
 }
@@ -396,10 +396,10 @@ func TestTwoDistinctBudgets(t *testing.T) {
 		t.Errorf("expected no error but got error: %v", err)
 	}
 	// Try consuming 1% of the initial budget independently for ε and δ.
-	if eps, del, err := spec1.consumeBudget(0, 1e-32); err == nil {
+	if eps, del, err := spec1.consumeBudget("test", 0, 1e-32); err == nil {
 		t.Errorf("expected spec1 to be out of budget, but could consume (%f,%e) without any error", eps, del)
 	}
-	if eps, del, err := spec2.consumeBudget(0.01, 0); err == nil {
+	if eps, del, err := spec2.consumeBudget("test", 0.01, 0); err == nil {
 		t.Errorf("expected spec2 to be out of budget, but could consume (%f,%e) without any error", eps, del)
 	}
 }
@@ -426,8 +426,64 @@ func TestBudgetRounding(t *testing.T) {
 			t.Errorf("with %d aggregations, expected no error but got error: %v", numAggregations, err)
 		}
 		// Now, the budget should be really empty.
-		if eps, del, err := spec.consumeBudget(1e-15, 1e-40); err == nil {
+		if eps, del, err := spec.consumeBudget("test", 1e-15, 1e-40); err == nil {
 			t.Errorf("with %d aggregations, expected spec to be out of budget, but could consume (%f,%e) without any error", numAggregations, eps, del)
 		}
 	}
 }
+
+// Tests that aggregations with no public partitions don't consume their budget,
+// so that it can be used by other aggregations.
+func TestBudgetNotConsumedWithoutPublicPartitions(t *testing.T) {
+	values := []testutils.PairII{
+		{1, 1},
+		{2, 2},
+	}
+	p, s, col := ptest.CreateList(values)
+	colKV := beam.ParDo(s, testutils.PairToKV, col)
+	spec := NewPrivacySpec(1, 0)
+	pcol := MakePrivate(s, colKV, spec)
+	got := Count(s, pcol, CountParams{Epsilon: 1, MaxValue: 1, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{}})
+	passert.Empty(s, got)
+	got = DistinctPrivacyID(s, pcol, DistinctPrivacyIDParams{Epsilon: 1, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{}})
+	passert.Empty(s, got)
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("expected no error but got error: %v", err)
+	}
+	// The entire budget should still be available.
+	if eps, del, err := spec.consumeBudget("test", 1, 0); err != nil || eps != 1 || del != 0 {
+		t.Errorf("Trying to consume the entire budget after aggregations without public partitions: Got (epsilon,delta)=(%f,%e) and err=%v, expected=(%f,%e) and no error", eps, del, err, 1.0, 0.0)
+	}
+}
+
+func TestBudgetLedger(t *testing.T) {
+	values := []testutils.PairII{
+		{1, 1},
+		{2, 2},
+	}
+	_, s, col := ptest.CreateList(values)
+	colKV := beam.ParDo(s, testutils.PairToKV, col)
+	spec := NewPrivacySpec(2, 1e-5)
+	pcol := MakePrivate(s, colKV, spec)
+	Count(s, pcol, CountParams{Epsilon: 0.5, Delta: 1e-6, MaxValue: 1, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}})
+	// An aggregation whose output is known to be empty consumes no budget.
+	Count(s, pcol, CountParams{Epsilon: 1, MaxValue: 1, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{}})
+	DistinctPrivacyID(s, pcol, DistinctPrivacyIDParams{Epsilon: 1, Delta: 1e-6, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}})
+	want := []BudgetLedgerEntry{
+		{Transform: "Count", Epsilon: 0.5, Delta: 1e-6},
+		{Transform: "DistinctPrivacyID", Epsilon: 1, Delta: 1e-6},
+	}
+	if diff := cmp.Diff(want, spec.Ledger()); diff != "" {
+		t.Errorf("Ledger: got diff (-want +got):\n%s", diff)
+	}
+	if eps, del := spec.RemainingBudget(); !testutils.ApproxEquals(eps, 0.5) || !testutils.ApproxEquals(del, 8e-6) {
+		t.Errorf("RemainingBudget: got (epsilon,delta)=(%f,%e), expected=(%f,%e)", eps, del, 0.5, 8e-6)
+	}
+	// Consuming more than the remaining budget fails, and isn't recorded.
+	if _, _, err := spec.consumeBudget("test", 1, 0); err == nil {
+		t.Errorf("Trying to consume more than the remaining budget: got no error, expected an error")
+	}
+	if got := len(spec.Ledger()); got != 2 {
+		t.Errorf("Ledger after a failed consumption: got %d entries, expected 2", got)
+	}
+}
@@ -51,6 +51,11 @@ type QuantilesParams struct {
 	//
 	// Required.
 	MaxPartitionsContributed int64
+	// How the budget of the aggregation is split between the partitions a
+	// privacy unit contributes to, see BudgetSplit.
+	//
+	// Optional.
+	BudgetSplit BudgetSplit
 	// The maximum number of contributions from a given privacy identifier
 	// for each key. There is an inherent trade-off when choosing this
 	// parameter: a larger MaxContributionsPerPartition leads to less data loss due
@@ -105,6 +110,9 @@ type QuantilesParams struct {
 	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
 	// otherwise.
 	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
 	// Optional.
 	PublicPartitions interface{}
 }
@@ -142,7 +150,12 @@ func QuantilesPerKey(s beam.Scope, pcol PrivatePCollection, params QuantilesPara
 
 	// Get privacy parameters.
 	spec := pcol.privacySpec
-	epsilon, delta, err := spec.consumeBudget(params.Epsilon, params.Delta)
+	maxContributionsPerPartition, err := getMaxContributionsPerPartition(spec, params.MaxContributionsPerPartition)
+	if err != nil {
+		log.Fatalf("Couldn't get MaxContributionsPerPartition for QuantilesPerKey: %v", err)
+	}
+	params.MaxContributionsPerPartition = maxContributionsPerPartition
+	epsilon, delta, err := spec.consumeBudgetUnlessEmpty("QuantilesPerKey", params.PublicPartitions, params.Epsilon, params.Delta)
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for Quantiles: %v", err)
 	}
@@ -202,6 +215,11 @@ func QuantilesPerKey(s beam.Scope, pcol PrivatePCollection, params QuantilesPara
 	if spec.testMode != noNoiseWithoutContributionBounding {
 		rekeyed = boundContributions(s, rekeyed, maxPartitionsContributed)
 	}
+	// Split the budget between the partitions, if a BudgetSplit is specified.
+	epsilon, delta, maxPartitionsContributed, err = splitPartitionBudget(spec, "QuantilesPerKey", params.BudgetSplit, epsilon, delta, maxPartitionsContributed, noiseKind, params.PublicPartitions)
+	if err != nil {
+		log.Fatalf("Couldn't split budget for QuantilesPerKey: %v", err)
+	}
 
 	// Now that the cross-partition contribution bounding is done, remove the privacy keys and decode the values.
 	// Result is PCollection<partition, []float64>.
@@ -320,7 +338,7 @@ func checkQuantilesPerKeyParams(params QuantilesParams, epsilon, delta float64,
 		return fmt.Errorf("there should at least be one rank to compute")
 	}
 	for i, rank := range params.Ranks {
-		if rank < 0.0 || rank > 1.0 {
+		if !(rank >= 0.0 && rank <= 1.0) {
 			return fmt.Errorf("Ranks[%d]=%f must be >= 0 and <= 1", i, rank)
 		}
 	}
@@ -17,6 +17,7 @@
 package pbeam
 
 import (
+	"math"
 	"reflect"
 	"testing"
 
@@ -1120,6 +1121,15 @@ func TestCheckQuantilesPerKeyParams(t *testing.T) {
 			partitionType: nil,
 			wantErr:       true,
 		},
+		{
+			desc:          "NaN rank",
+			epsilon:       1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        QuantilesParams{MaxContributionsPerPartition: 1, MinValue: -5.0, MaxValue: 5.0, Ranks: []float64{0.3, math.NaN()}},
+			partitionType: nil,
+			wantErr:       true,
+		},
 		{
 			desc:          "non-zero delta w/ public partitions & Laplace",
 			epsilon:       1.0,
@@ -0,0 +1,145 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+
+	log "github.com/golang/glog"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+)
+
+func init() {
+	beam.RegisterType(reflect.TypeOf((*sampleUnitsFn)(nil)))
+}
+
+// UnitSampling is a PrivacySpecOption that samples privacy units when a
+// PrivatePCollection is created from a PCollection, e.g. to reduce the cost of
+// a pipeline on a large dataset: each privacy unit is kept with probability
+// Rate, by comparing a keyed hash of its privacy identifier with Rate, and all
+// the records of the other privacy units are dropped.
+//
+// Sampling amplifies privacy, which is accounted for automatically: the
+// budget (ε,δ) of NewPrivacySpec is the guarantee of the whole pipeline, and
+// the aggregations can spend the larger budget (ε',δ') such that sampling with
+// rate q of an (ε',δ')-differentially private pipeline is (ε,δ)-differentially
+// private, i.e. ε = ln(1+q(exp(ε')-1)) and δ = q·δ'. Note that this only holds
+// if the sampling is hidden: the key must stay secret, and whether a privacy
+// unit was sampled mustn't be revealed.
+//
+// All PrivatePCollections created with the same PrivacySpec keep the same
+// privacy units.
+type UnitSampling struct {
+	// Probability of keeping each privacy unit, in (0, 1]. Required.
+	Rate float64
+	// Secret key of the hash of the privacy identifiers. Defaults to a random
+	// key, generated when the PrivacySpec is created.
+	Key []byte
+}
+
+// unitSampler holds the parameters of a UnitSampling.
+type unitSampler struct {
+	rate float64
+	key  []byte
+}
+
+// newUnitSampler checks the parameters of us and returns the corresponding
+// unitSampler.
+func newUnitSampler(us UnitSampling) (*unitSampler, error) {
+	if !(us.Rate > 0 && us.Rate <= 1) {
+		return nil, fmt.Errorf("UnitSampling: Rate is %f, must be in (0, 1]", us.Rate)
+	}
+	key := us.Key
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("UnitSampling: couldn't generate key: %w", err)
+		}
+	}
+	return &unitSampler{rate: us.Rate, key: key}, nil
+}
+
+// budgetBeforeSampling returns the budget (ε',δ') that an (ε',δ')-differentially
+// private pipeline can use so that sampling privacy units with the given rate
+// makes it (ε,δ)-differentially private.
+func budgetBeforeSampling(epsilon, delta, rate float64) (float64, float64) {
+	return math.Log1p(math.Expm1(epsilon) / rate), delta / rate
+}
+
+// sampleUnits drops the records of the privacy units that aren't sampled from
+// col, a PCollection<ID,V>, if sampler is not nil.
+func sampleUnits(s beam.Scope, col beam.PCollection, sampler *unitSampler) beam.PCollection {
+	if sampler == nil {
+		return col
+	}
+	idT, _ := beam.ValidateKVType(col)
+	return beam.ParDo(s, &sampleUnitsFn{IDType: beam.EncodedType{T: idT.Type()}, Rate: sampler.rate, Key: sampler.key}, col)
+}
+
+// sampleUnitsFn keeps the records of a privacy unit if the keyed hash of its
+// privacy identifier is below Rate.
+type sampleUnitsFn struct {
+	IDType beam.EncodedType
+	Rate   float64
+	Key    []byte
+	idEnc  beam.ElementEncoder
+}
+
+func (fn *sampleUnitsFn) Setup() {
+	fn.idEnc = beam.NewElementEncoder(fn.IDType.T)
+}
+
+func (fn *sampleUnitsFn) ProcessElement(id beam.W, v beam.V, emit func(beam.W, beam.V)) error {
+	var idBuf bytes.Buffer
+	if err := fn.idEnc.Encode(id, &idBuf); err != nil {
+		return fmt.Errorf("pbeam.sampleUnitsFn.ProcessElement: couldn't encode privacy ID %v: %w", id, err)
+	}
+	if keepUnit(fn.Key, idBuf.Bytes(), fn.Rate) {
+		emit(id, v)
+	}
+	return nil
+}
+
+// keepUnit returns true if the privacy unit whose encoded identifier is id is
+// sampled, i.e. if the HMAC-SHA256 of id with the given key, seen as a number
+// in [0, 1), is below rate.
+func keepUnit(key, id []byte, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(id)
+	h := binary.BigEndian.Uint64(mac.Sum(nil))
+	return float64(h>>11)/(1<<53) < rate
+}
+
+// mustNewUnitSampler is like newUnitSampler, but fails if the parameters are
+// invalid, like other invalid parameters of NewPrivacySpec.
+func mustNewUnitSampler(us UnitSampling) *unitSampler {
+	sampler, err := newUnitSampler(us)
+	if err != nil {
+		log.Fatalf("NewPrivacySpec: %v", err)
+	}
+	return sampler
+}
@@ -0,0 +1,140 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/differential-privacy/privacy-on-beam/pbeam/testutils"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/testing/ptest"
+)
+
+func TestNewUnitSampler(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		us      UnitSampling
+		wantErr bool
+	}{
+		{"valid rate", UnitSampling{Rate: 0.1}, false},
+		{"rate of 1", UnitSampling{Rate: 1}, false},
+		{"zero rate", UnitSampling{}, true},
+		{"rate above 1", UnitSampling{Rate: 1.5}, true},
+		{"NaN rate", UnitSampling{Rate: math.NaN()}, true},
+	} {
+		sampler, err := newUnitSampler(tc.us)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("newUnitSampler: when %s got err=%v, wantErr=%t", tc.desc, err, tc.wantErr)
+		}
+		if err == nil && len(sampler.key) == 0 {
+			t.Errorf("newUnitSampler: when %s got no key, want a random key", tc.desc)
+		}
+	}
+}
+
+func TestBudgetBeforeSampling(t *testing.T) {
+	for _, tc := range []struct {
+		epsilon, delta, rate float64
+	}{
+		{1, 1e-10, 1},
+		{1, 1e-10, 0.5},
+		{0.1, 1e-5, 0.01},
+		{5, 0, 0.2},
+	} {
+		eps, del := budgetBeforeSampling(tc.epsilon, tc.delta, tc.rate)
+		// Sampling with rate q makes an (ε',δ')-DP pipeline (ln(1+q(exp(ε')-1)), qδ')-DP.
+		if got := math.Log1p(tc.rate * math.Expm1(eps)); math.Abs(got-tc.epsilon) > 1e-9 {
+			t.Errorf("budgetBeforeSampling(%f, %e, %f): got epsilon %f, amplified to %f, want %f", tc.epsilon, tc.delta, tc.rate, eps, got, tc.epsilon)
+		}
+		if got := tc.rate * del; math.Abs(got-tc.delta) > 1e-20 {
+			t.Errorf("budgetBeforeSampling(%f, %e, %f): got delta %e, amplified to %e, want %e", tc.epsilon, tc.delta, tc.rate, del, got, tc.delta)
+		}
+		if eps < tc.epsilon {
+			t.Errorf("budgetBeforeSampling(%f, %e, %f): got epsilon %f, want at least %f", tc.epsilon, tc.delta, tc.rate, eps, tc.epsilon)
+		}
+	}
+}
+
+func TestKeepUnit(t *testing.T) {
+	key := []byte("test key")
+	const n = 10000
+	kept := 0
+	for i := 0; i < n; i++ {
+		id := []byte{byte(i), byte(i >> 8)}
+		k := keepUnit(key, id, 0.3)
+		if k != keepUnit(key, id, 0.3) {
+			t.Errorf("keepUnit: got different results for the same unit")
+		}
+		if k && !keepUnit(key, id, 0.6) {
+			t.Errorf("keepUnit: unit kept with rate 0.3 but not 0.6, want units kept with a lower rate to be kept with a higher rate")
+		}
+		if k {
+			kept++
+		}
+	}
+	if got := float64(kept) / n; math.Abs(got-0.3) > 0.03 {
+		t.Errorf("keepUnit: got %f of units kept, want about 0.3", got)
+	}
+}
+
+func TestNewPrivacySpecWithUnitSampling(t *testing.T) {
+	spec := NewPrivacySpec(1, 1e-10, UnitSampling{Rate: 0.5})
+	wantEps, wantDel := budgetBeforeSampling(1, 1e-10, 0.5)
+	if spec.epsilon != wantEps || spec.delta != wantDel {
+		t.Errorf("NewPrivacySpec: with UnitSampling got budget (%f, %e), want (%f, %e)", spec.epsilon, spec.delta, wantEps, wantDel)
+	}
+}
+
+// Checks that MakePrivate with UnitSampling keeps exactly the sampled privacy
+// units.
+func TestMakePrivateWithUnitSampling(t *testing.T) {
+	key := []byte("test key")
+	const numIDs = 1000
+	pairs := testutils.MakePairsWithFixedVStartingFromKey(0, numIDs, 0)
+	enc := beam.NewElementEncoder(reflect.TypeOf(0))
+	var wantCount int64
+	for i := 0; i < numIDs; i++ {
+		var buf bytes.Buffer
+		if err := enc.Encode(i, &buf); err != nil {
+			t.Fatalf("Couldn't encode ID %d: %v", i, err)
+		}
+		if keepUnit(key, buf.Bytes(), 0.5) {
+			wantCount++
+		}
+	}
+	result := []testutils.TestInt64Metric{{0, wantCount}}
+	p, s, col, want := ptest.CreateList2(pairs, result)
+	col = beam.ParDo(s, testutils.PairToKV, col)
+
+	// ε is very large, so the noise is negligible.
+	epsilon := 50.0
+	pcol := MakePrivate(s, col, NewPrivacySpec(epsilon, 0, UnitSampling{Rate: 0.5, Key: key}))
+	got := Count(s, pcol, CountParams{MaxValue: 1, MaxPartitionsContributed: 1, NoiseKind: LaplaceNoise{}, PublicPartitions: []int{0}})
+	want = beam.ParDo(s, testutils.Int64MetricToKV, want)
+	if err := testutils.ApproxEqualsKVInt64(s, got, want, 1); err != nil {
+		t.Fatalf("TestMakePrivateWithUnitSampling: %v", err)
+	}
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("TestMakePrivateWithUnitSampling: Count(%v) = %v, expected %v: %v", col, got, want, err)
+	}
+	if wantCount < 400 || wantCount > 600 {
+		t.Errorf("TestMakePrivateWithUnitSampling: %d units were sampled, want about %d", wantCount, numIDs/2)
+	}
+}
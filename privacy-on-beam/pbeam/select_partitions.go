@@ -56,6 +56,10 @@ type SelectPartitionsParams struct {
 // dpagg.PreAggSelectPartitions and returns the list of partitions to keep as
 // a PCollection.
 //
+// The selected partitions can be passed as PublicPartitions to the other
+// aggregations on the same data, e.g. to compute several statistics per
+// partition while only spending the δ of the partition selection once.
+//
 // In a PrivatePCollection<K,V>, K is the partition key and in a PrivatePCollection<V>,
 // V is the partition key. SelectPartitions transforms a PrivatePCollection<K,V> into a
 // PCollection<K> and a PrivatePCollection<V> into a PCollection<V>.
@@ -64,7 +68,7 @@ func SelectPartitions(s beam.Scope, pcol PrivatePCollection, params SelectPartit
 	// Obtain type information from the underlying PCollection<K,V>.
 	_, pT := beam.ValidateKVType(pcol.col)
 
-	epsilon, delta, err := pcol.privacySpec.consumeBudget(params.Epsilon, params.Delta)
+	epsilon, delta, err := pcol.privacySpec.consumeBudget("SelectPartitions", params.Epsilon, params.Delta)
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for SelectPartition: %v", err)
 	}
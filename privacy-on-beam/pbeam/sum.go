@@ -57,6 +57,11 @@ type SumParams struct {
 	//
 	// Required.
 	MaxPartitionsContributed int64
+	// How the budget of the aggregation is split between the partitions a
+	// privacy unit contributes to, see BudgetSplit.
+	//
+	// Optional.
+	BudgetSplit BudgetSplit
 	// The total contribution of a given privacy identifier to partition can be
 	// at at least MinValue, and at most MaxValue; otherwise it will be clamped
 	// to these bounds. For example, if a privacy identifier is associated with
@@ -92,6 +97,9 @@ type SumParams struct {
 	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
 	// otherwise.
 	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
 	// Optional.
 	PublicPartitions interface{}
 }
@@ -124,7 +132,7 @@ func SumPerKey(s beam.Scope, pcol PrivatePCollection, params SumParams) beam.PCo
 
 	// Get privacy parameters.
 	spec := pcol.privacySpec
-	epsilon, delta, err := spec.consumeBudget(params.Epsilon, params.Delta)
+	epsilon, delta, err := spec.consumeBudgetUnlessEmpty("SumPerKey", params.PublicPartitions, params.Epsilon, params.Delta)
 	if err != nil {
 		log.Fatalf("Couldn't consume budget for SumPerKey: %v", err)
 	}
@@ -178,6 +186,11 @@ func SumPerKey(s beam.Scope, pcol PrivatePCollection, params SumParams) beam.PCo
 	if spec.testMode != noNoiseWithoutContributionBounding {
 		rekeyed = boundContributions(s, rekeyed, maxPartitionsContributed)
 	}
+	// Split the budget between the partitions, if a BudgetSplit is specified.
+	epsilon, delta, maxPartitionsContributed, err = splitPartitionBudget(spec, "SumPerKey", params.BudgetSplit, epsilon, delta, maxPartitionsContributed, noiseKind, params.PublicPartitions)
+	if err != nil {
+		log.Fatalf("Couldn't split budget for SumPerKey: %v", err)
+	}
 	// Fourth, now that contribution bounding is done, remove the privacy keys,
 	// decode the value, and do a DP sum with all the partial sums.
 	partialSumPairs := beam.DropKey(s, rekeyed)
@@ -0,0 +1,522 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"fmt"
+	"reflect"
+
+	log "github.com/golang/glog"
+	"github.com/google/differential-privacy/go/checks"
+	"github.com/google/differential-privacy/go/dpagg"
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/privacy-on-beam/internal/kv"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+)
+
+func init() {
+	beam.RegisterType(reflect.TypeOf((*boundedVarianceFn)(nil)))
+}
+
+// VarianceParams specifies the parameters associated with a Variance or a
+// Stddev aggregation.
+type VarianceParams struct {
+	// Noise type (which is either LaplaceNoise{} or GaussianNoise{}).
+	//
+	// Defaults to LaplaceNoise{}.
+	NoiseKind NoiseKind
+	// Differential privacy budget consumed by this aggregation. If there is
+	// only one aggregation, both Epsilon and Delta can be left 0; in that
+	// case, the entire budget of the PrivacySpec is consumed.
+	Epsilon, Delta float64
+	// The maximum number of distinct values that a given privacy identifier
+	// can influence. There is an inherent trade-off when choosing this
+	// parameter: a larger MaxPartitionsContributed leads to less data loss due
+	// to contribution bounding, but since the noise added in aggregations is
+	// scaled according to maxPartitionsContributed, it also means that more
+	// noise is added to each variance.
+	//
+	// Required.
+	MaxPartitionsContributed int64
+	// How the budget of the aggregation is split between the partitions a
+	// privacy unit contributes to, see BudgetSplit.
+	//
+	// Optional.
+	BudgetSplit BudgetSplit
+	// The maximum number of contributions from a given privacy identifier
+	// for each key. There is an inherent trade-off when choosing this
+	// parameter: a larger MaxContributionsPerPartition leads to less data loss due
+	// to contribution bounding, but since the noise added in aggregations is
+	// scaled according to maxContributionsPerPartition, it also means that more
+	// noise is added to each variance.
+	//
+	// Required.
+	MaxContributionsPerPartition int64
+	// The total contribution of a given privacy identifier to partition can be
+	// at at least MinValue, and at most MaxValue; otherwise it will be clamped
+	// to these bounds. For example, if a privacy identifier is associated with
+	// the key-value pairs [("a", -5), ("a", 2), ("b", 7), ("c", 3)] and the
+	// (MinValue, MaxValue) bounds are (0, 5), the contribution for "a" will be
+	// clamped up to 0, the contribution for "b" will be clamped down to 5, and
+	// the contribution for "c" will be untouched. There is an inherent
+	// trade-off when choosing MinValue and MaxValue: a small MinValue and a
+	// large MaxValue means that less records will be clamped, but that more
+	// noise will be added.
+	//
+	// Required.
+	MinValue, MaxValue float64
+	// You can input the list of partitions present in the output if you know
+	// them in advance. When you specify partitions, partition selection /
+	// thresholding will be disabled and partitions will appear in the output
+	// if and only if they appear in the set of public partitions.
+	//
+	// You should not derive the list of partitions non-privately from private
+	// data. You should only use this in either of the following cases:
+	// 	1. The list of partitions is data-independent. For example, if you are
+	// 	aggregating a metric by hour, you could provide a list of all possible
+	// 	hourly period.
+	// 	2. You use a differentially private operation to come up with the list of
+	// 	partitions. For example, you could use the output of a SelectPartitions
+	//  operation or the keys of a DistinctPrivacyID operation as the list of
+	//  public partitions.
+	//
+	// PublicPartitions needs to be a beam.PCollection, slice, or array. The
+	// underlying type needs to match the partition type of the PrivatePCollection.
+	//
+	// Prefer slices or arrays if the list of public partitions is small and
+	// can fit into memory (e.g., up to a million). Prefer beam.PCollection
+	// otherwise.
+	//
+	// If PublicPartitions is an empty slice or array, the output is empty and
+	// the budget of the aggregation isn't consumed from the PrivacySpec.
+	//
+	// Optional.
+	PublicPartitions interface{}
+}
+
+// VariancePerKey obtains the variance of the values associated with each key
+// in a PrivatePCollection<K,V>, adding differentially private noise to the
+// variances and doing pre-aggregation thresholding to remove variances with a
+// low number of distinct privacy identifiers.
+//
+// It is also possible to manually specify the list of partitions
+// present in the output, in which case the partition selection/thresholding
+// step is skipped.
+//
+// VariancePerKey transforms a PrivatePCollection<K,V> into a PCollection<K,float64>.
+//
+// Note that it is not possible to not clamp input values when using
+// pbeamtest.NewPrivacySpecNoNoiseWithoutContributionBounding(), so clamping to
+// Min/MaxValue will still be applied. However, MaxContributionsPerPartition and
+// MaxPartitionsContributed contribution bounding will be disabled.
+//
+// Note: Do not use when your results may cause overflows for float64 values.
+// This aggregation is not hardened for such applications yet.
+func VariancePerKey(s beam.Scope, pcol PrivatePCollection, params VarianceParams) beam.PCollection {
+	s = s.Scope("pbeam.VariancePerKey")
+	return variancePerKey(s, pcol, params, "VariancePerKey", false)
+}
+
+// StddevPerKey obtains the standard deviation of the values associated with
+// each key in a PrivatePCollection<K,V>. It is computed as the square root of
+// the variance of VariancePerKey, and has the same parameters and caveats.
+//
+// StddevPerKey transforms a PrivatePCollection<K,V> into a PCollection<K,float64>.
+func StddevPerKey(s beam.Scope, pcol PrivatePCollection, params VarianceParams) beam.PCollection {
+	s = s.Scope("pbeam.StddevPerKey")
+	return variancePerKey(s, pcol, params, "StddevPerKey", true)
+}
+
+// variancePerKey contains the implementation of VariancePerKey and, if
+// standardDeviation is set, of StddevPerKey. name is used in error messages.
+func variancePerKey(s beam.Scope, pcol PrivatePCollection, params VarianceParams, name string, standardDeviation bool) beam.PCollection {
+	// Obtain & validate type information from the underlying PCollection<K,V>.
+	idT, kvT := beam.ValidateKVType(pcol.col)
+	if kvT.Type() != reflect.TypeOf(kv.Pair{}) {
+		log.Fatalf("%s must be used on a PrivatePCollection of type <K,V>, got type %v instead", name, kvT)
+	}
+	if pcol.codec == nil {
+		log.Fatalf("%s: no codec found for the input PrivatePCollection.", name)
+	}
+
+	// Get privacy parameters.
+	spec := pcol.privacySpec
+	maxContributionsPerPartition, err := getMaxContributionsPerPartition(spec, params.MaxContributionsPerPartition)
+	if err != nil {
+		log.Fatalf("Couldn't get MaxContributionsPerPartition for %s: %v", name, err)
+	}
+	params.MaxContributionsPerPartition = maxContributionsPerPartition
+	epsilon, delta, err := spec.consumeBudgetUnlessEmpty(name, params.PublicPartitions, params.Epsilon, params.Delta)
+	if err != nil {
+		log.Fatalf("Couldn't consume budget for %s: %v", name, err)
+	}
+	var noiseKind noise.Kind
+	if params.NoiseKind == nil {
+		noiseKind = noise.LaplaceNoise
+		log.Infof("No NoiseKind specified, using Laplace Noise by default.")
+	} else {
+		noiseKind = params.NoiseKind.toNoiseKind()
+	}
+	err = checkVariancePerKeyParams(params, epsilon, delta, noiseKind, pcol.codec.KType.T)
+	if err != nil {
+		log.Fatalf("pbeam.%s: %v", name, err)
+	}
+
+	// Drop non-public partitions, if public partitions are specified.
+	pcol.col, err = dropNonPublicPartitions(s, pcol, params.PublicPartitions, pcol.codec.KType.T)
+	if err != nil {
+		log.Fatalf("Couldn't drop non-public partitions for %s: %v", name, err)
+	}
+
+	// First, group together the privacy ID and the partition ID and do per-partition contribution bounding.
+	// Result is PCollection<kv.Pair{ID,K},V>
+	encodeIDKFn := newEncodeIDKFn(idT, pcol.codec)
+	decoded := beam.ParDo(s,
+		encodeIDKFn,
+		pcol.col,
+		beam.TypeDefinition{Var: beam.VType, T: pcol.codec.VType.T})
+
+	// Don't do per-partition contribution bounding if in test mode without contribution bounding.
+	if spec.testMode != noNoiseWithoutContributionBounding {
+		decoded = boundContributions(s, decoded, params.MaxContributionsPerPartition)
+	}
+
+	// Convert value to float64.
+	// Result is PCollection<kv.Pair{ID,K},float64>.
+	_, valueT := beam.ValidateKVType(decoded)
+	convertFn, err := findConvertToFloat64Fn(valueT)
+	if err != nil {
+		log.Fatalf("Couldn't get convertFn for %s: %v", name, err)
+	}
+	converted := beam.ParDo(s, convertFn, decoded)
+
+	// Combine all values for <id, partition> into a slice.
+	// Result is PCollection<kv.Pair{ID,K},[]float64>.
+	combined := beam.CombinePerKey(s,
+		&expandFloat64ValuesCombineFn{},
+		converted)
+
+	// Result is PCollection<ID, pairArrayFloat64>.
+	maxPartitionsContributed, err := getMaxPartitionsContributed(spec, params.MaxPartitionsContributed)
+	if err != nil {
+		log.Fatalf("Couldn't get MaxPartitionsContributed for %s: %v", name, err)
+	}
+	rekeyed := beam.ParDo(s, rekeyArrayFloat64Fn, combined)
+	// Second, do cross-partition contribution bounding if not in test mode without contribution bounding.
+	if spec.testMode != noNoiseWithoutContributionBounding {
+		rekeyed = boundContributions(s, rekeyed, maxPartitionsContributed)
+	}
+	// Split the budget between the partitions, if a BudgetSplit is specified.
+	epsilon, delta, maxPartitionsContributed, err = splitPartitionBudget(spec, name, params.BudgetSplit, epsilon, delta, maxPartitionsContributed, noiseKind, params.PublicPartitions)
+	if err != nil {
+		log.Fatalf("Couldn't split budget for %s: %v", name, err)
+	}
+
+	// Now that the cross-partition contribution bounding is done, remove the privacy keys and decode the values.
+	// Result is PCollection<partition, []float64>.
+	partialPairs := beam.DropKey(s, rekeyed)
+	partitionT := pcol.codec.KType.T
+	partialKV := beam.ParDo(s,
+		newDecodePairArrayFloat64Fn(partitionT),
+		partialPairs,
+		beam.TypeDefinition{Var: beam.XType, T: partitionT})
+	fnParams := boundedVarianceFnParams{
+		epsilon:                      epsilon,
+		delta:                        delta,
+		maxPartitionsContributed:     maxPartitionsContributed,
+		maxContributionsPerPartition: params.MaxContributionsPerPartition,
+		minValue:                     params.MinValue,
+		maxValue:                     params.MaxValue,
+		noiseKind:                    noiseKind,
+		standardDeviation:            standardDeviation,
+		publicPartitions:             false,
+		testMode:                     spec.testMode,
+		emptyPartitions:              false}
+	// Add public partitions and return the aggregation output, if public partitions are specified.
+	if params.PublicPartitions != nil {
+		fnParams.publicPartitions = true
+		return addPublicPartitionsForVariance(s, fnParams, params.PublicPartitions, name, partialKV)
+	}
+	// Compute the variance for each partition. Result is PCollection<partition, float64>.
+	boundedVarianceFn, err := newBoundedVarianceFn(fnParams)
+	if err != nil {
+		log.Fatalf("Couldn't get boundedVarianceFn for %s: %v", name, err)
+	}
+	variances := beam.CombinePerKey(s,
+		boundedVarianceFn,
+		partialKV)
+	// Finally, drop thresholded partitions.
+	return beam.ParDo(s, dropThresholdedPartitionsFloat64Fn, variances)
+}
+
+func addPublicPartitionsForVariance(s beam.Scope, fnParams boundedVarianceFnParams, publicPartitionsParam interface{}, name string, partialKV beam.PCollection) beam.PCollection {
+	// Compute the variance for each partition with non-public partitions dropped. Result is PCollection<partition, float64>.
+	boundedVarianceFn, err := newBoundedVarianceFn(fnParams)
+	if err != nil {
+		log.Fatalf("Couldn't get boundedVarianceFn for %s: %v", name, err)
+	}
+	variances := beam.CombinePerKey(s,
+		boundedVarianceFn,
+		partialKV)
+	partitionT, _ := beam.ValidateKVType(variances)
+	variancesPartitions := beam.DropValue(s, variances)
+	// Create map with partitions in the data as keys.
+	partitionMap := beam.Combine(s, newPartitionsMapFn(beam.EncodedType{partitionT.Type()}), variancesPartitions)
+	publicPartitions, isPCollection := publicPartitionsParam.(beam.PCollection)
+	if !isPCollection {
+		publicPartitions = beam.Reshuffle(s, beam.CreateList(s, publicPartitionsParam))
+	}
+	// Add value of empty array to each partition key in PublicPartitions.
+	publicPartitionsWithValues := beam.ParDo(s, addEmptySliceToPublicPartitionsFloat64Fn, publicPartitions)
+	// emptyPublicPartitions are the partitions that are public but not found in the data.
+	emptyPublicPartitions := beam.ParDo(s, newEmitPartitionsNotInTheDataFn(partitionT), publicPartitionsWithValues, beam.SideInput{Input: partitionMap})
+	// Add noise to the empty public partitions.
+	fnParams.emptyPartitions = true
+	boundedVarianceFn, err = newBoundedVarianceFn(fnParams)
+	if err != nil {
+		log.Fatalf("Couldn't get boundedVarianceFn for %s: %v", name, err)
+	}
+	emptyVariances := beam.CombinePerKey(s,
+		boundedVarianceFn,
+		emptyPublicPartitions)
+	variances = beam.ParDo(s, dereferenceValueToFloat64Fn, variances)
+	emptyVariances = beam.ParDo(s, dereferenceValueToFloat64Fn, emptyVariances)
+	// Merge variances from data with variances from the empty public partitions.
+	return beam.Flatten(s, variances, emptyVariances)
+}
+
+func checkVariancePerKeyParams(params VarianceParams, epsilon, delta float64, noiseKind noise.Kind, partitionType reflect.Type) error {
+	err := checkPublicPartitions(params.PublicPartitions, partitionType)
+	if err != nil {
+		return err
+	}
+	err = checks.CheckEpsilon(epsilon)
+	if err != nil {
+		return err
+	}
+	err = checkDelta(delta, noiseKind, params.PublicPartitions)
+	if err != nil {
+		return err
+	}
+	err = checks.CheckBoundsFloat64(params.MinValue, params.MaxValue)
+	if err != nil {
+		return err
+	}
+	err = checks.CheckBoundsNotEqual(params.MinValue, params.MaxValue)
+	if err != nil {
+		return err
+	}
+	return checks.CheckMaxContributionsPerPartition(params.MaxContributionsPerPartition)
+}
+
+// boundedVarianceAccum holds a BoundedStandardDeviation if the combineFn
+// computes standard deviations, and a BoundedVariance otherwise.
+type boundedVarianceAccum struct {
+	BV               *dpagg.BoundedVariance
+	BSTDV            *dpagg.BoundedStandardDeviation
+	SP               *dpagg.PreAggSelectPartition
+	PublicPartitions bool
+}
+
+// variance returns the BoundedVariance that the values are added to.
+func (a boundedVarianceAccum) variance() *dpagg.BoundedVariance {
+	if a.BSTDV != nil {
+		return &a.BSTDV.Variance
+	}
+	return a.BV
+}
+
+// boundedVarianceFn is a differentially private combineFn for obtaining the variance or the
+// standard deviation of values. Do not initialize it yourself, use newBoundedVarianceFn to create
+// a boundedVarianceFn instance.
+type boundedVarianceFn struct {
+	// Privacy spec parameters (set during initial construction).
+	NoiseEpsilon                 float64
+	PartitionSelectionEpsilon    float64
+	NoiseDelta                   float64
+	PartitionSelectionDelta      float64
+	MaxPartitionsContributed     int64
+	MaxContributionsPerPartition int64
+	Lower                        float64
+	Upper                        float64
+	NoiseKind                    noise.Kind
+	noise                        noise.Noise // Set during Setup phase according to NoiseKind.
+	StandardDeviation            bool        // Set to true if this combineFn returns standard deviations.
+	PublicPartitions             bool        // Set to true if public partitions are used.
+	TestMode                     testMode
+	EmptyPartitions              bool // Set to true if this combineFn is for adding noise to empty public partitions.
+}
+
+// boundedVarianceFnParams contains the parameters for creating a new boundedVarianceFn.
+type boundedVarianceFnParams struct {
+	epsilon                      float64
+	delta                        float64
+	maxPartitionsContributed     int64
+	maxContributionsPerPartition int64
+	minValue                     float64
+	maxValue                     float64
+	noiseKind                    noise.Kind
+	standardDeviation            bool // True if the boundedVarianceFn returns standard deviations.
+	publicPartitions             bool // True if public partitions are used.
+	testMode                     testMode
+	emptyPartitions              bool // Set to true if the boundedVarianceFn is for adding noise to empty public partitions.
+}
+
+// newBoundedVarianceFn returns a boundedVarianceFn with the given budget and parameters.
+func newBoundedVarianceFn(params boundedVarianceFnParams) (*boundedVarianceFn, error) {
+	fn := &boundedVarianceFn{
+		MaxPartitionsContributed:     params.maxPartitionsContributed,
+		MaxContributionsPerPartition: params.maxContributionsPerPartition,
+		Lower:                        params.minValue,
+		Upper:                        params.maxValue,
+		NoiseKind:                    params.noiseKind,
+		StandardDeviation:            params.standardDeviation,
+		PublicPartitions:             params.publicPartitions,
+		TestMode:                     params.testMode,
+		EmptyPartitions:              params.emptyPartitions,
+	}
+	if fn.PublicPartitions {
+		fn.NoiseEpsilon = params.epsilon
+		fn.NoiseDelta = params.delta
+		return fn, nil
+	}
+	fn.NoiseEpsilon = params.epsilon / 2
+	fn.PartitionSelectionEpsilon = params.epsilon - fn.NoiseEpsilon
+	switch params.noiseKind {
+	case noise.GaussianNoise:
+		fn.NoiseDelta = params.delta / 2
+	case noise.LaplaceNoise:
+		fn.NoiseDelta = 0
+	default:
+		return nil, fmt.Errorf("unknown noise.Kind (%v) is specified. Please specify a valid noise", params.noiseKind)
+	}
+	fn.PartitionSelectionDelta = params.delta - fn.NoiseDelta
+	return fn, nil
+}
+
+func (fn *boundedVarianceFn) Setup() {
+	fn.noise = noise.ToNoise(fn.NoiseKind)
+	if fn.TestMode.isEnabled() {
+		fn.noise = noNoise{}
+	}
+}
+
+func (fn *boundedVarianceFn) CreateAccumulator() (boundedVarianceAccum, error) {
+	accum := boundedVarianceAccum{PublicPartitions: fn.PublicPartitions}
+	var err error
+	if fn.StandardDeviation {
+		accum.BSTDV, err = dpagg.NewBoundedStandardDeviation(&dpagg.BoundedStandardDeviationOptions{
+			Epsilon:                      fn.NoiseEpsilon,
+			Delta:                        fn.NoiseDelta,
+			MaxPartitionsContributed:     fn.MaxPartitionsContributed,
+			MaxContributionsPerPartition: fn.MaxContributionsPerPartition,
+			Lower:                        fn.Lower,
+			Upper:                        fn.Upper,
+			Noise:                        fn.noise,
+		})
+	} else {
+		accum.BV, err = dpagg.NewBoundedVariance(&dpagg.BoundedVarianceOptions{
+			Epsilon:                      fn.NoiseEpsilon,
+			Delta:                        fn.NoiseDelta,
+			MaxPartitionsContributed:     fn.MaxPartitionsContributed,
+			MaxContributionsPerPartition: fn.MaxContributionsPerPartition,
+			Lower:                        fn.Lower,
+			Upper:                        fn.Upper,
+			Noise:                        fn.noise,
+		})
+	}
+	if err != nil {
+		return boundedVarianceAccum{}, err
+	}
+	if !fn.PublicPartitions {
+		accum.SP, err = dpagg.NewPreAggSelectPartition(&dpagg.PreAggSelectPartitionOptions{
+			Epsilon:                  fn.PartitionSelectionEpsilon,
+			Delta:                    fn.PartitionSelectionDelta,
+			MaxPartitionsContributed: fn.MaxPartitionsContributed,
+		})
+	}
+	return accum, err
+}
+
+func (fn *boundedVarianceFn) AddInput(a boundedVarianceAccum, values []float64) (boundedVarianceAccum, error) {
+	var err error
+	// We can have multiple values for each (privacy_key, partition_key) pair.
+	// We need to add each value to BoundedVariance as input but we need to add a single input
+	// for each privacy_key to SelectPartition.
+	for _, v := range values {
+		if fn.StandardDeviation {
+			err = a.BSTDV.Add(v)
+		} else {
+			err = a.BV.Add(v)
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+	if !fn.PublicPartitions {
+		err = a.SP.Increment()
+	}
+	return a, err
+}
+
+func (fn *boundedVarianceFn) MergeAccumulators(a, b boundedVarianceAccum) (boundedVarianceAccum, error) {
+	var err error
+	if fn.StandardDeviation {
+		err = a.BSTDV.Merge(b.BSTDV)
+	} else {
+		err = a.BV.Merge(b.BV)
+	}
+	if err != nil {
+		return a, err
+	}
+	if !fn.PublicPartitions {
+		err = a.SP.Merge(b.SP)
+	}
+	return a, err
+}
+
+func (fn *boundedVarianceFn) ExtractOutput(a boundedVarianceAccum) (*float64, error) {
+	if fn.TestMode.isEnabled() {
+		bv := a.variance()
+		bv.NormalizedSumOfSquares.Noise = noNoise{}
+		bv.NormalizedSum.Noise = noNoise{}
+		bv.Count.Noise = noNoise{}
+	}
+	var err error
+	shouldKeepPartition := fn.TestMode.isEnabled() || a.PublicPartitions // If in test mode or public partitions are specified, we always keep the partition.
+	if !shouldKeepPartition {                                            // If not, we need to perform private partition selection.
+		shouldKeepPartition, err = a.SP.ShouldKeepPartition()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if shouldKeepPartition {
+		var result float64
+		if fn.StandardDeviation {
+			result, err = a.BSTDV.Result()
+		} else {
+			result, err = a.BV.Result()
+		}
+		return &result, err
+	}
+	return nil, nil
+}
+
+func (fn *boundedVarianceFn) String() string {
+	return fmt.Sprintf("%#v", fn)
+}
@@ -0,0 +1,272 @@
+//
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/differential-privacy/go/noise"
+	"github.com/google/differential-privacy/privacy-on-beam/pbeam/testutils"
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/testing/ptest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewBoundedVarianceFn(t *testing.T) {
+	opts := []cmp.Option{
+		cmpopts.EquateApprox(0, 1e-10),
+		cmpopts.IgnoreUnexported(boundedVarianceFn{}),
+	}
+	for _, tc := range []struct {
+		desc              string
+		noiseKind         noise.Kind
+		standardDeviation bool
+		want              interface{}
+	}{
+		{"Laplace noise kind", noise.LaplaceNoise, false,
+			&boundedVarianceFn{
+				NoiseEpsilon:                 0.5,
+				PartitionSelectionEpsilon:    0.5,
+				NoiseDelta:                   0,
+				PartitionSelectionDelta:      1e-5,
+				MaxPartitionsContributed:     17,
+				MaxContributionsPerPartition: 5,
+				Lower:                        0,
+				Upper:                        10,
+				NoiseKind:                    noise.LaplaceNoise,
+			}},
+		{"Gaussian noise kind for standard deviation", noise.GaussianNoise, true,
+			&boundedVarianceFn{
+				NoiseEpsilon:                 0.5,
+				PartitionSelectionEpsilon:    0.5,
+				NoiseDelta:                   5e-6,
+				PartitionSelectionDelta:      5e-6,
+				MaxPartitionsContributed:     17,
+				MaxContributionsPerPartition: 5,
+				Lower:                        0,
+				Upper:                        10,
+				NoiseKind:                    noise.GaussianNoise,
+				StandardDeviation:            true,
+			}},
+	} {
+		got, err := newBoundedVarianceFn(boundedVarianceFnParams{
+			epsilon:                      1,
+			delta:                        1e-5,
+			maxPartitionsContributed:     17,
+			maxContributionsPerPartition: 5,
+			minValue:                     0,
+			maxValue:                     10,
+			noiseKind:                    tc.noiseKind,
+			standardDeviation:            tc.standardDeviation,
+			publicPartitions:             false,
+			testMode:                     disabled,
+			emptyPartitions:              false})
+		if err != nil {
+			t.Fatalf("Couldn't get newBoundedVarianceFn: %v", err)
+		}
+		if diff := cmp.Diff(tc.want, got, opts...); diff != "" {
+			t.Errorf("newBoundedVarianceFn: for %q (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
+// Checks that VariancePerKey and StddevPerKey return the exact statistics when
+// the noise is negligible.
+func TestVariancePerKeyNoNoise(t *testing.T) {
+	// Partition 0 has 5 values of 1 and 5 values of 3, so its variance is 1.
+	// Partition 1 has 10 values of 2, so its variance is 0.
+	triples := testutils.ConcatenateTriplesWithFloatValue(
+		testutils.MakeTripleWithFloatValue(5, 0, 1),
+		testutils.MakeTripleWithFloatValueStartingFromKey(5, 5, 0, 3),
+		testutils.MakeTripleWithFloatValueStartingFromKey(10, 10, 1, 2))
+	for _, tc := range []struct {
+		desc              string
+		standardDeviation bool
+		// Results for partitions 0 and 1.
+		want []testutils.TestFloat64Metric
+	}{
+		{"variance", false, []testutils.TestFloat64Metric{{0, 1}, {1, 0}}},
+		{"standard deviation", true, []testutils.TestFloat64Metric{{0, 1}, {1, 0}}},
+	} {
+		p, s, col, want := ptest.CreateList2(triples, tc.want)
+		col = beam.ParDo(s, testutils.ExtractIDFromTripleWithFloatValue, col)
+
+		// δ=10⁻²³, ε=1e100 and l0Sensitivity=1 gives a threshold of =2, so both
+		// partitions are kept. Since ε=1e100, the noise is negligible.
+		// ε is split by 2 for noise and for partition selection, so we use 2*ε.
+		pcol := MakePrivate(s, col, NewPrivacySpec(2e100, 1e-23))
+		pcol = ParDo(s, testutils.TripleWithFloatValueToKV, pcol)
+		params := VarianceParams{
+			MaxPartitionsContributed:     1,
+			MaxContributionsPerPartition: 1,
+			MinValue:                     0,
+			MaxValue:                     5,
+			NoiseKind:                    LaplaceNoise{},
+		}
+		var got beam.PCollection
+		if tc.standardDeviation {
+			got = StddevPerKey(s, pcol, params)
+		} else {
+			got = VariancePerKey(s, pcol, params)
+		}
+		want = beam.ParDo(s, testutils.Float64MetricToKV, want)
+		if err := testutils.ApproxEqualsKVFloat64(s, got, want, 1e-6); err != nil {
+			t.Fatalf("ApproxEqualsKVFloat64 for %s: got error %v", tc.desc, err)
+		}
+		if err := ptest.Run(p); err != nil {
+			t.Errorf("TestVariancePerKeyNoNoise for %s: got %v, want %v, error %v", tc.desc, got, want, err)
+		}
+	}
+}
+
+// Checks that VariancePerKey with public partitions drops the non-public
+// partitions and adds the empty public ones.
+func TestVariancePerKeyWithPartitionsNoNoise(t *testing.T) {
+	triples := testutils.ConcatenateTriplesWithFloatValue(
+		testutils.MakeTripleWithFloatValue(5, 0, 1),
+		testutils.MakeTripleWithFloatValueStartingFromKey(5, 5, 0, 3),
+		testutils.MakeTripleWithFloatValueStartingFromKey(10, 10, 1, 2))
+	for _, inMemory := range []bool{false, true} {
+		result := []testutils.TestFloat64Metric{
+			{0, 1},
+			// Partition 1 is dropped because it's not in the list of public partitions,
+			// and partition 2 has no data, hence a variance of 0.
+			{2, 0},
+		}
+		publicPartitionsSlice := []int{0, 2}
+		p, s, col, want := ptest.CreateList2(triples, result)
+		col = beam.ParDo(s, testutils.ExtractIDFromTripleWithFloatValue, col)
+
+		var publicPartitions interface{}
+		if inMemory {
+			publicPartitions = publicPartitionsSlice
+		} else {
+			publicPartitions = beam.CreateList(s, publicPartitionsSlice)
+		}
+
+		// ε is not split because partitions are public. Since ε=1e100, the noise is negligible.
+		pcol := MakePrivate(s, col, NewPrivacySpec(1e100, 0))
+		pcol = ParDo(s, testutils.TripleWithFloatValueToKV, pcol)
+		got := VariancePerKey(s, pcol, VarianceParams{
+			MaxPartitionsContributed:     1,
+			MaxContributionsPerPartition: 1,
+			MinValue:                     0,
+			MaxValue:                     5,
+			NoiseKind:                    LaplaceNoise{},
+			PublicPartitions:             publicPartitions,
+		})
+		want = beam.ParDo(s, testutils.Float64MetricToKV, want)
+		if err := testutils.ApproxEqualsKVFloat64(s, got, want, 1e-6); err != nil {
+			t.Fatalf("ApproxEqualsKVFloat64 with inMemory=%t: got error %v", inMemory, err)
+		}
+		if err := ptest.Run(p); err != nil {
+			t.Errorf("TestVariancePerKeyWithPartitionsNoNoise with inMemory=%t: got %v, want %v, error %v", inMemory, got, want, err)
+		}
+	}
+}
+
+func TestCheckVariancePerKeyParams(t *testing.T) {
+	_, _, publicPartitions := ptest.CreateList([]int{0, 1})
+	for _, tc := range []struct {
+		desc          string
+		epsilon       float64
+		delta         float64
+		noiseKind     noise.Kind
+		params        VarianceParams
+		partitionType reflect.Type
+		wantErr       bool
+	}{
+		{
+			desc:          "valid parameters",
+			epsilon:       1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: -5.0, MaxValue: 5.0},
+			partitionType: nil,
+			wantErr:       false,
+		},
+		{
+			desc:          "negative epsilon",
+			epsilon:       -1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: -5.0, MaxValue: 5.0},
+			partitionType: nil,
+			wantErr:       true,
+		},
+		{
+			desc:          "zero delta w/o public partitions",
+			epsilon:       1.0,
+			delta:         0.0,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: -5.0, MaxValue: 5.0},
+			partitionType: nil,
+			wantErr:       true,
+		},
+		{
+			desc:          "MaxValue < MinValue",
+			epsilon:       1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: 6.0, MaxValue: 5.0},
+			partitionType: nil,
+			wantErr:       true,
+		},
+		{
+			desc:          "MaxValue = MinValue",
+			epsilon:       1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: 5.0, MaxValue: 5.0},
+			partitionType: nil,
+			wantErr:       true,
+		},
+		{
+			desc:          "zero MaxContributionsPerPartition",
+			epsilon:       1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 0, MinValue: -5.0, MaxValue: 5.0},
+			partitionType: nil,
+			wantErr:       true,
+		},
+		{
+			desc:          "non-zero delta w/ public partitions & Laplace",
+			epsilon:       1.0,
+			delta:         1e-5,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: -5.0, MaxValue: 5.0, PublicPartitions: publicPartitions},
+			partitionType: reflect.TypeOf(0),
+			wantErr:       true,
+		},
+		{
+			desc:          "wrong partition type w/ public partitions as slice",
+			epsilon:       1.0,
+			delta:         0,
+			noiseKind:     noise.LaplaceNoise,
+			params:        VarianceParams{MaxContributionsPerPartition: 1, MinValue: -5.0, MaxValue: 5.0, PublicPartitions: []int{0}},
+			partitionType: reflect.TypeOf(""),
+			wantErr:       true,
+		},
+	} {
+		if err := checkVariancePerKeyParams(tc.params, tc.epsilon, tc.delta, tc.noiseKind, tc.partitionType); (err != nil) != tc.wantErr {
+			t.Errorf("With %s, got=%v, wantErr=%t", tc.desc, err, tc.wantErr)
+		}
+	}
+}